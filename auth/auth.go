@@ -0,0 +1,57 @@
+// Package auth verifies bearer tokens and maps them to caller identities.
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is wrapped by errors reporting a rejected token.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnavailable is wrapped by errors reporting that a token could not be
+	// verified, e.g. because the keys of its issuer could not be fetched.
+	ErrUnavailable = errors.New("token verification unavailable")
+)
+
+// Identity is the verified identity of a caller.
+type Identity struct {
+	// Subject is the sub claim, identifying the caller within its issuer
+	Subject string
+	// Issuer is the iss claim
+	Issuer string
+	// Audience is the aud claim
+	Audience []string
+	// ExpiresAt is the exp claim
+	ExpiresAt time.Time
+	// Email is the email claim, if any
+	Email string
+	// Name is the name claim, if any
+	Name string
+	// Roles is empty unless filled in by a claims mapper
+	Roles []string
+	// Claims are all claims of the token
+	Claims map[string]any
+}
+
+// HasRole reports whether the identity has the given role.
+func (id *Identity) HasRole(role string) bool {
+	return slices.Contains(id.Roles, role)
+}
+
+// Verifier verifies bearer tokens. Rejected tokens are reported with errors
+// wrapping ErrInvalidToken, and failures to verify them with errors wrapping
+// ErrUnavailable.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Identity, error)
+}
+
+// VerifierFunc adapts a function to a Verifier.
+type VerifierFunc func(ctx context.Context, token string) (*Identity, error)
+
+// Verify implements Verifier.
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Identity, error) {
+	return f(ctx, token)
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC defaults
+const (
+	defaultLeeway             = time.Minute
+	defaultKeyCacheTTL        = time.Hour
+	defaultMinRefreshInterval = 30 * time.Second
+	defaultFetchTimeout       = 10 * time.Second
+	// maxDocumentSize limits the size of discovery documents and JWK sets.
+	maxDocumentSize = 1 << 20
+)
+
+// DiscoveryPath is appended to an issuer URL to find its OpenID configuration.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// OIDCConfig configures the verification of ID tokens of one issuer.
+type OIDCConfig struct {
+	// Issuer is the issuer URL. It must match the iss claim of tokens, and its
+	// configuration is discovered at Issuer + "/.well-known/openid-configuration".
+	Issuer string
+	// Audiences are the accepted aud values, usually the client IDs of the
+	// service. Tokens must be issued for at least one of them.
+	Audiences []string
+	// JWKSURL skips discovery and fetches the keys of the issuer from this URL.
+	JWKSURL string
+	// HTTPClient fetches discovery documents and keys (default: a client with
+	// a 10 second timeout).
+	HTTPClient *http.Client
+	// Leeway tolerates clock skew when checking exp and nbf (default 1 minute).
+	Leeway time.Duration
+	// KeyCacheTTL is how long keys are used before they are fetched again
+	// (default 1 hour). Stale keys keep being used while fetching fails.
+	KeyCacheTTL time.Duration
+	// MinRefreshInterval limits how often keys are fetched for tokens signed
+	// with an unknown key, e.g. after the issuer rotated its keys (default 30
+	// seconds).
+	MinRefreshInterval time.Duration
+	// ClaimsMapper customizes the identity built from the verified claims,
+	// e.g. to fill in Roles from a provider-specific claim. Returning an error
+	// rejects the token.
+	ClaimsMapper func(claims map[string]any, identity *Identity) error
+}
+
+// OIDCProvider verifies ID tokens of one OpenID Connect issuer. The JWKS URI
+// is discovered and the keys fetched on first use, then cached and refreshed
+// when they expire or a token is signed with a key not seen before.
+type OIDCProvider struct {
+	config OIDCConfig
+
+	// fetchMu serializes fetches, so concurrent requests share one.
+	fetchMu sync.Mutex
+
+	mu        sync.RWMutex
+	jwksURL   string
+	keys      []verificationKey
+	fetchedAt time.Time
+	attempted time.Time
+}
+
+// NewOIDCProvider creates a provider for config. Nothing is fetched until the
+// first token is verified.
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	if config.Issuer == "" {
+		return nil, errors.New("OIDC issuer is required")
+	}
+	if len(config.Audiences) == 0 {
+		return nil, fmt.Errorf("OIDC issuer %s: at least one audience is required", config.Issuer)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultFetchTimeout}
+	}
+	if config.Leeway == 0 {
+		config.Leeway = defaultLeeway
+	}
+	if config.KeyCacheTTL <= 0 {
+		config.KeyCacheTTL = defaultKeyCacheTTL
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = defaultMinRefreshInterval
+	}
+	return &OIDCProvider{config: config, jwksURL: config.JWKSURL}, nil
+}
+
+// Issuer returns the issuer of the provider.
+func (p *OIDCProvider) Issuer() string {
+	return p.config.Issuer
+}
+
+// Verify verifies the signature and claims of an ID token and returns the
+// identity of its subject.
+func (p *OIDCProvider) Verify(ctx context.Context, token string) (*Identity, error) {
+	t, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	return p.verify(ctx, t)
+}
+
+// verify verifies a parsed token.
+func (p *OIDCProvider) verify(ctx context.Context, t *jwt) (*Identity, error) {
+	if iss := t.stringClaim("iss"); iss != p.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+	}
+
+	keys, err := p.keysFor(ctx, t.header)
+	if err != nil {
+		return nil, err
+	}
+	err = fmt.Errorf("%w: no key for algorithm %q", ErrInvalidToken, t.header.Alg)
+	for _, key := range keys {
+		if err = t.verifySignature(key.key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.validateClaims(t, time.Now()); err != nil {
+		return nil, err
+	}
+	return p.identity(t)
+}
+
+// validateClaims checks the expiry, validity start, and audience of a token.
+func (p *OIDCProvider) validateClaims(t *jwt, now time.Time) error {
+	exp, ok := t.timeClaim("exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(exp.Add(p.config.Leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := t.timeClaim("nbf"); ok && now.Add(p.config.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if !slices.ContainsFunc(t.audience(), func(aud string) bool {
+		return slices.Contains(p.config.Audiences, aud)
+	}) {
+		return fmt.Errorf("%w: token not issued for this audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// identity maps the claims of a verified token to an Identity.
+func (p *OIDCProvider) identity(t *jwt) (*Identity, error) {
+	exp, _ := t.timeClaim("exp")
+	identity := &Identity{
+		Subject:   t.stringClaim("sub"),
+		Issuer:    t.stringClaim("iss"),
+		Audience:  t.audience(),
+		ExpiresAt: exp,
+		Email:     t.stringClaim("email"),
+		Name:      t.stringClaim("name"),
+		Claims:    t.claims,
+	}
+	if p.config.ClaimsMapper != nil {
+		if err := p.config.ClaimsMapper(t.claims, identity); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+	return identity, nil
+}
+
+// keysFor returns the cached keys that may have signed a token with header,
+// fetching them if they expired or none matches.
+func (p *OIDCProvider) keysFor(ctx context.Context, header jwtHeader) ([]verificationKey, error) {
+	p.mu.RLock()
+	keys, fetchedAt, attempted := p.keys, p.fetchedAt, p.attempted
+	p.mu.RUnlock()
+
+	now := time.Now()
+	matching := matchKeys(keys, header)
+	fresh := !fetchedAt.IsZero() && now.Sub(fetchedAt) < p.config.KeyCacheTTL
+	if fresh && len(matching) > 0 {
+		return matching, nil
+	}
+	if now.Sub(attempted) < p.config.MinRefreshInterval {
+		// Don't refetch on every token signed with an unknown key
+		if len(matching) > 0 {
+			return matching, nil
+		}
+		if fetchedAt.IsZero() {
+			return nil, fmt.Errorf("%w: keys of %s not available", ErrUnavailable, p.config.Issuer)
+		}
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, header.Kid)
+	}
+
+	if err := p.refresh(ctx, attempted); err != nil {
+		if len(matching) > 0 {
+			// Keep using stale keys while the issuer is unreachable
+			return matching, nil
+		}
+		return nil, err
+	}
+	p.mu.RLock()
+	matching = matchKeys(p.keys, header)
+	p.mu.RUnlock()
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, header.Kid)
+	}
+	return matching, nil
+}
+
+// matchKeys returns the keys with the key ID and algorithm of header. Tokens
+// without a key ID match every key.
+func matchKeys(keys []verificationKey, header jwtHeader) []verificationKey {
+	var matching []verificationKey
+	for _, key := range keys {
+		if header.Kid != "" && key.kid != header.Kid {
+			continue
+		}
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		matching = append(matching, key)
+	}
+	return matching
+}
+
+// refresh fetches the keys of the issuer, unless another request did so
+// since the attempt observed by the caller.
+func (p *OIDCProvider) refresh(ctx context.Context, observed time.Time) error {
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+
+	p.mu.Lock()
+	if p.attempted.After(observed) {
+		p.mu.Unlock()
+		return nil
+	}
+	p.attempted = time.Now()
+	jwksURL := p.jwksURL
+	p.mu.Unlock()
+
+	if jwksURL == "" {
+		var err error
+		if jwksURL, err = p.discover(ctx); err != nil {
+			return fmt.Errorf("%w: discovery of %s failed: %w", ErrUnavailable, p.config.Issuer, err)
+		}
+	}
+	data, err := p.fetch(ctx, jwksURL)
+	if err != nil {
+		return fmt.Errorf("%w: fetching keys of %s failed: %w", ErrUnavailable, p.config.Issuer, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("%w: keys of %s: %w", ErrUnavailable, p.config.Issuer, err)
+	}
+
+	p.mu.Lock()
+	p.jwksURL = jwksURL
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// discover fetches the configuration of the issuer and returns its JWKS URI.
+func (p *OIDCProvider) discover(ctx context.Context) (string, error) {
+	data, err := p.fetch(ctx, strings.TrimSuffix(p.config.Issuer, "/")+DiscoveryPath)
+	if err != nil {
+		return "", err
+	}
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("invalid discovery document: %w", err)
+	}
+	if doc.Issuer != p.config.Issuer {
+		return "", fmt.Errorf("discovery document is for issuer %q", doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+// fetch returns the body of a successful GET request to url.
+func (p *OIDCProvider) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
+
+// OIDCVerifier verifies ID tokens of several trusted issuers, using the
+// provider of the issuer named by each token.
+type OIDCVerifier struct {
+	providers map[string]*OIDCProvider
+}
+
+// NewOIDCVerifier creates a verifier trusting the issuers of configs.
+//
+//	verifier, err := auth.NewOIDCVerifier(
+//		auth.OIDCConfig{Issuer: "https://accounts.google.com", Audiences: []string{googleClientID}},
+//		auth.OIDCConfig{Issuer: "https://login.example.com", Audiences: []string{"orders-api"}},
+//	)
+func NewOIDCVerifier(configs ...OIDCConfig) (*OIDCVerifier, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("at least one OIDC issuer is required")
+	}
+	v := &OIDCVerifier{providers: make(map[string]*OIDCProvider, len(configs))}
+	for _, config := range configs {
+		if _, exists := v.providers[config.Issuer]; exists {
+			return nil, fmt.Errorf("duplicate OIDC issuer %s", config.Issuer)
+		}
+		provider, err := NewOIDCProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		v.providers[config.Issuer] = provider
+	}
+	return v, nil
+}
+
+// Issuers returns the trusted issuers, sorted.
+func (v *OIDCVerifier) Issuers() []string {
+	issuers := make([]string, 0, len(v.providers))
+	for issuer := range v.providers {
+		issuers = append(issuers, issuer)
+	}
+	slices.Sort(issuers)
+	return issuers
+}
+
+// Verify implements Verifier. Tokens of untrusted issuers are rejected
+// without fetching anything.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	t, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	iss := t.stringClaim("iss")
+	provider, ok := v.providers[iss]
+	if !ok {
+		return nil, fmt.Errorf("%w: untrusted issuer %q", ErrInvalidToken, iss)
+	}
+	return provider.verify(ctx, t)
+}
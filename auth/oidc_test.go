@@ -0,0 +1,302 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/auth"
+)
+
+// testIssuer serves a discovery document and a JWK set that can be rotated.
+type testIssuer struct {
+	server      *httptest.Server
+	mu          sync.Mutex
+	keys        []map[string]string
+	jwksGets    atomic.Int32
+	failFetches atomic.Bool
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	ti := &testIssuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   ti.server.URL,
+			"jwks_uri": ti.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		ti.jwksGets.Add(1)
+		if ti.failFetches.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": ti.keys})
+	})
+	ti.server = httptest.NewServer(mux)
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+// publish replaces the keys served by the issuer.
+func (ti *testIssuer) publish(keys ...map[string]string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.keys = keys
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// sign creates a token with claims signed by key.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(sig)
+}
+
+func TestOIDCProvider(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuer := newTestIssuer(t)
+	issuer.publish(rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey))
+
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:             issuer.server.URL,
+		Audiences:          []string{"orders-api"},
+		MinRefreshInterval: 100 * time.Millisecond,
+		ClaimsMapper: func(claims map[string]any, identity *auth.Identity) error {
+			if claims["banned"] == true {
+				return errors.New("banned")
+			}
+			if groups, ok := claims["groups"].([]any); ok {
+				for _, g := range groups {
+					identity.Roles = append(identity.Roles, g.(string))
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss": issuer.server.URL, "sub": "user-1", "aud": "orders-api",
+			"exp": now.Add(time.Hour).Unix(), "email": "user@example.com",
+			"groups": []string{"admin"},
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	t.Run("valid tokens", func(t *testing.T) {
+		for _, token := range []string{
+			sign(t, "RS256", "rsa-1", rsaKey, claims(nil)),
+			sign(t, "ES256", "ec-1", ecKey, claims(map[string]any{"aud": []string{"other", "orders-api"}})),
+		} {
+			identity, err := provider.Verify(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if identity.Subject != "user-1" || identity.Email != "user@example.com" || !identity.HasRole("admin") {
+				t.Errorf("Unexpected identity %+v", identity)
+			}
+			if identity.ExpiresAt.Unix() != now.Add(time.Hour).Unix() {
+				t.Errorf("Expected expiry %v, got %v", now.Add(time.Hour), identity.ExpiresAt)
+			}
+		}
+		if got := issuer.jwksGets.Load(); got != 1 {
+			t.Errorf("Expected keys to be fetched once, got %d", got)
+		}
+	})
+
+	t.Run("rejected tokens", func(t *testing.T) {
+		otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		valid := sign(t, "RS256", "rsa-1", rsaKey, claims(nil))
+		tests := map[string]string{
+			"expired":       sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})),
+			"not yet valid": sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})),
+			"missing exp":   sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"exp": nil})),
+			"audience":      sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"aud": "billing-api"})),
+			"issuer":        sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"iss": "https://evil.example.com"})),
+			"signature":     sign(t, "RS256", "rsa-1", otherKey, claims(nil)),
+			"algorithm":     sign(t, "ES256", "rsa-1", ecKey, claims(nil)),
+			"claims mapper": sign(t, "RS256", "rsa-1", rsaKey, claims(map[string]any{"banned": true})),
+			"alg none":      strings.Replace(valid, valid[:strings.Index(valid, ".")], b64([]byte(`{"alg":"none","kid":"rsa-1"}`)), 1),
+			"malformed":     "not-a-token",
+		}
+		for name, token := range tests {
+			t.Run(name, func(t *testing.T) {
+				if _, err := provider.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidToken) {
+					t.Errorf("Expected an invalid token error, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		rotated, _ := rsa.GenerateKey(rand.Reader, 2048)
+		issuer.publish(rsaJWK("rsa-2", rotated))
+		before := issuer.jwksGets.Load()
+		time.Sleep(150 * time.Millisecond)
+
+		// The unknown key ID triggers a refetch of the keys
+		token := sign(t, "RS256", "rsa-2", rotated, claims(nil))
+		if _, err := provider.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Expected the rotated key to be fetched, got %v", err)
+		}
+		if got := issuer.jwksGets.Load() - before; got != 1 {
+			t.Errorf("Expected one refetch, got %d", got)
+		}
+
+		// Unknown keys don't refetch again within the minimum refresh interval
+		unknown := sign(t, "RS256", "rsa-3", rotated, claims(nil))
+		if _, err := provider.Verify(context.Background(), unknown); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("Expected an invalid token error, got %v", err)
+		}
+		if got := issuer.jwksGets.Load() - before; got != 1 {
+			t.Errorf("Expected no further refetch, got %d", got)
+		}
+	})
+}
+
+func TestOIDCProvider_Unavailable(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	issuer := newTestIssuer(t)
+	issuer.publish(rsaJWK("rsa-1", key))
+	issuer.failFetches.Store(true)
+
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:      issuer.server.URL,
+		Audiences:   []string{"orders-api"},
+		KeyCacheTTL: time.Nanosecond,
+		// Retry right away
+		MinRefreshInterval: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, "RS256", "rsa-1", key, map[string]any{
+		"iss": issuer.server.URL, "sub": "user-1", "aud": "orders-api", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if _, err := provider.Verify(context.Background(), token); !errors.Is(err, auth.ErrUnavailable) {
+		t.Fatalf("Expected an unavailable error, got %v", err)
+	}
+
+	issuer.failFetches.Store(false)
+	if _, err := provider.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Expired keys are still used while the issuer is unreachable
+	issuer.failFetches.Store(true)
+	if _, err := provider.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Expected stale keys to be used, got %v", err)
+	}
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	first, second := newTestIssuer(t), newTestIssuer(t)
+	firstKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	secondKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	first.publish(rsaJWK("k", firstKey))
+	second.publish(ecJWK("k", secondKey))
+
+	verifier, err := auth.NewOIDCVerifier(
+		auth.OIDCConfig{Issuer: first.server.URL, Audiences: []string{"orders-api"}},
+		auth.OIDCConfig{Issuer: second.server.URL, Audiences: []string{"orders-web"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	for _, tt := range []struct {
+		issuer string
+		token  string
+	}{
+		{first.server.URL, sign(t, "RS256", "k", firstKey, map[string]any{"iss": first.server.URL, "aud": "orders-api", "exp": exp})},
+		{second.server.URL, sign(t, "ES256", "k", secondKey, map[string]any{"iss": second.server.URL, "aud": "orders-web", "exp": exp})},
+	} {
+		identity, err := verifier.Verify(context.Background(), tt.token)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if identity.Issuer != tt.issuer {
+			t.Errorf("Expected issuer %s, got %s", tt.issuer, identity.Issuer)
+		}
+	}
+
+	// Audiences are per issuer
+	token := sign(t, "RS256", "k", firstKey, map[string]any{"iss": first.server.URL, "aud": "orders-web", "exp": exp})
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected an invalid token error, got %v", err)
+	}
+
+	// Untrusted issuers are rejected without fetching anything
+	token = sign(t, "RS256", "k", firstKey, map[string]any{"iss": "https://untrusted.example.com", "aud": "orders-api", "exp": exp})
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected an invalid token error, got %v", err)
+	}
+
+	if _, err := auth.NewOIDCVerifier(auth.OIDCConfig{Issuer: first.server.URL}); err == nil {
+		t.Error("Expected an error for a config without audiences")
+	}
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/i2y/hyperway/compat"
+)
+
+// compatOptions holds options for the compat command.
+type compatOptions struct {
+	endpoint  string
+	service   string
+	unary     string
+	unaryData string
+	expect    string
+	stream    string
+	streamReq string
+	messages  int
+	errMethod string
+	errData   string
+	errCode   string
+	clients   []string
+	checks    []string
+	timeout   time.Duration
+}
+
+// NewCompatCommand creates the compat command.
+func NewCompatCommand() *cobra.Command {
+	opts := &compatOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "compat [flags]",
+		Short: "Check compatibility with grpcurl, buf curl, evans, and connect-web",
+		Long: `Drive popular RPC clients against a service and check that reflection,
+unary calls, server streaming, errors, and compression work with each of them.
+
+Without --endpoint a built-in sample service is started on a local port and
+checked with its own calls. With --endpoint, checks whose method flag is not
+set are skipped. Command-line clients that are not installed are skipped.
+The command exits with an error if any check fails.
+
+Examples:
+  # Check the built-in sample service
+  hyperway compat
+
+  # Check your own service
+  hyperway compat --endpoint http://localhost:8080 --service user.v1.UserService \
+    --unary GetUser --unary-data '{"id":"1"}' \
+    --stream WatchUsers --stream-data '{}' \
+    --error GetUser --error-data '{"id":"missing"}' --error-code not_found
+
+  # Only run grpcurl and connect-web
+  hyperway compat --clients grpcurl,connect-web`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCompat(opts)
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "", "Service endpoint URL (default: start the sample service)")
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Fully-qualified service name (required with --endpoint)")
+	cmd.Flags().StringVar(&opts.unary, "unary", "", "Unary method used by the unary and compression checks")
+	cmd.Flags().StringVar(&opts.unaryData, "unary-data", "{}", "JSON request of the unary method")
+	cmd.Flags().StringVar(&opts.expect, "unary-expect", "", "Substring the unary response must contain")
+	cmd.Flags().StringVar(&opts.stream, "stream", "", "Server-streaming method used by the streaming check")
+	cmd.Flags().StringVar(&opts.streamReq, "stream-data", "{}", "JSON request of the streaming method")
+	cmd.Flags().IntVar(&opts.messages, "stream-messages", 0, "Number of messages the stream must return (0 for at least one)")
+	cmd.Flags().StringVar(&opts.errMethod, "error", "", "Method that must fail, used by the errors check")
+	cmd.Flags().StringVar(&opts.errData, "error-data", "{}", "JSON request of the failing method")
+	cmd.Flags().StringVar(&opts.errCode, "error-code", "", "Expected error code (e.g., not_found)")
+	cmd.Flags().StringSliceVar(&opts.clients, "clients", []string{}, "Clients to run: grpcurl, buf, evans, connect-web (default all)")
+	cmd.Flags().StringSliceVar(&opts.checks, "checks", []string{}, "Checks to run: reflection, unary, streaming, errors, compression (default all)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Timeout of each check")
+
+	return cmd
+}
+
+func runCompat(opts *compatOptions) error {
+	var target compat.Target
+	if opts.endpoint == "" {
+		server, err := compat.StartSample("127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = server.Close(context.Background()) }()
+		fmt.Printf("Started sample service at %s\n\n", server.URL)
+		target = server.Target()
+	} else {
+		target = compatTarget(opts)
+	}
+
+	runOpts := []compat.Option{compat.WithTimeout(opts.timeout)}
+	if len(opts.clients) > 0 {
+		clients, err := compatClients(opts.clients)
+		if err != nil {
+			return err
+		}
+		runOpts = append(runOpts, compat.WithClients(clients...))
+	}
+	if len(opts.checks) > 0 {
+		checks, err := compatChecks(opts.checks)
+		if err != nil {
+			return err
+		}
+		runOpts = append(runOpts, compat.WithChecks(checks...))
+	}
+
+	report, err := compat.Run(context.Background(), target, runOpts...)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteTable(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("compatibility checks failed")
+	}
+	return nil
+}
+
+// compatTarget builds the target from the command flags.
+func compatTarget(opts *compatOptions) compat.Target {
+	return compat.Target{
+		URL:     opts.endpoint,
+		Service: opts.service,
+		Unary: compat.Call{
+			Method:  opts.unary,
+			Request: opts.unaryData,
+			Expect:  opts.expect,
+		},
+		Stream: compat.Call{
+			Method:   opts.stream,
+			Request:  opts.streamReq,
+			Messages: opts.messages,
+		},
+		Error: compat.Call{
+			Method:  opts.errMethod,
+			Request: opts.errData,
+		},
+		ErrorCode: opts.errCode,
+	}
+}
+
+// compatClients resolves client names.
+func compatClients(names []string) ([]compat.Client, error) {
+	clients := make([]compat.Client, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "grpcurl":
+			clients = append(clients, compat.GRPCurl())
+		case "buf", "buf-curl":
+			clients = append(clients, compat.BufCurl())
+		case "evans":
+			clients = append(clients, compat.Evans())
+		case "connect-web":
+			clients = append(clients, compat.ConnectWeb())
+		default:
+			return nil, fmt.Errorf("unknown client: %s", name)
+		}
+	}
+	return clients, nil
+}
+
+// compatChecks resolves check names.
+func compatChecks(names []string) ([]compat.Check, error) {
+	checks := make([]compat.Check, 0, len(names))
+	for _, name := range names {
+		check := compat.Check(strings.ToLower(strings.TrimSpace(name)))
+		found := false
+		for _, known := range compat.AllChecks {
+			if check == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown check: %s", name)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/i2y/hyperway/conformance"
+)
+
+// conformanceOptions holds options for the conformance command.
+type conformanceOptions struct {
+	endpoint  string
+	protocols []string
+	features  []string
+	suite     string
+	timeout   time.Duration
+}
+
+// NewConformanceCommand creates the conformance command.
+func NewConformanceCommand() *cobra.Command {
+	opts := &conformanceOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "conformance [flags]",
+		Short: "Check protocol conformance with connect-go and grpc-go",
+		Long: `Drive connect-go over the Connect, gRPC, and gRPC-Web protocols and grpc-go
+with the gRPC interop cases against the conformance service, and print a
+matrix of the features passing over each protocol: unary calls, empty and
+large messages, server streaming, errors, metadata, deadlines, and compression.
+
+Without --endpoint the conformance service is started on a local port with
+the hyperway server. With --endpoint, the service must be served there, e.g.
+by your own server to check its middleware and settings.
+
+With --connect-suite the official Connect conformance runner is run as well,
+with the given command line, and skipped if it is not installed. The command
+exits with an error if any case fails.
+
+Examples:
+  # Check the built-in conformance service
+  hyperway conformance
+
+  # Only check gRPC-Web and grpc-go streaming and deadlines
+  hyperway conformance --protocols grpc-web,grpc-go --features server-stream,deadline
+
+  # Also run the official Connect conformance suite
+  hyperway conformance --connect-suite "connectconformance --mode server --conf config.yaml -- ./server-under-test"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConformance(opts)
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "", "URL serving the conformance service (default: start it)")
+	cmd.Flags().StringSliceVar(&opts.protocols, "protocols", []string{}, "Protocols to check: connect, connect+json, grpc, grpc-web, grpc-go (default all)")
+	cmd.Flags().StringSliceVar(&opts.features, "features", []string{}, "Features to check: unary, empty, large, server-stream, errors, metadata, deadline, compression (default all)")
+	cmd.Flags().StringVar(&opts.suite, "connect-suite", "", "Command line of the official Connect conformance runner")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Timeout of each case")
+
+	return cmd
+}
+
+func runConformance(opts *conformanceOptions) error {
+	url := opts.endpoint
+	if url == "" {
+		server, err := conformance.Start("127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = server.Close(context.Background()) }()
+		fmt.Printf("Started conformance service at %s\n\n", server.URL)
+		url = server.URL
+	}
+
+	runOpts := []conformance.Option{conformance.WithTimeout(opts.timeout)}
+	if len(opts.protocols) > 0 {
+		protocols, err := conformanceNames(opts.protocols, conformance.AllProtocols, "protocol")
+		if err != nil {
+			return err
+		}
+		runOpts = append(runOpts, conformance.WithProtocols(protocols...))
+	}
+	if len(opts.features) > 0 {
+		features, err := conformanceNames(opts.features, conformance.AllFeatures, "feature")
+		if err != nil {
+			return err
+		}
+		runOpts = append(runOpts, conformance.WithFeatures(features...))
+	}
+	if suite := strings.Fields(opts.suite); len(suite) > 0 {
+		runOpts = append(runOpts, conformance.WithConnectSuite(suite...))
+	}
+
+	report, err := conformance.Run(context.Background(), url, runOpts...)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteMatrix(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("conformance checks failed")
+	}
+	return nil
+}
+
+// conformanceNames resolves protocol or feature names.
+func conformanceNames[T ~string](names []string, known []T, kind string) ([]T, error) {
+	resolved := make([]T, 0, len(names))
+	for _, name := range names {
+		value := T(strings.ToLower(strings.TrimSpace(name)))
+		if !slices.Contains(known, value) {
+			return nil, fmt.Errorf("unknown %s: %s", kind, name)
+		}
+		resolved = append(resolved, value)
+	}
+	return resolved, nil
+}
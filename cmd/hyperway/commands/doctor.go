@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/i2y/hyperway/doctor"
+)
+
+// doctorProbeTimeout bounds each probe of the doctor command.
+const doctorProbeTimeout = 10 * time.Second
+
+// doctorOptions holds options for the doctor command.
+type doctorOptions struct {
+	url      string
+	method   string
+	data     string
+	origin   string
+	insecure bool
+	timeout  time.Duration
+}
+
+// NewDoctorCommand creates the doctor command.
+func NewDoctorCommand() *cobra.Command {
+	opts := &doctorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "doctor --url host:port [flags]",
+		Short: "Diagnose the HTTP and RPC setup of a running server",
+		Long: `Probe a running server and report the negotiated HTTP versions, the RPC
+protocols it answers, reflection, compression, CORS, and keepalive behavior,
+with hints for common misconfigurations such as a listener without h2c or a
+proxy that strips trailers.
+
+Probes call a method that does not exist, so they have no side effects. Pass
+--method to check trailers and compression on a real call; it is called
+several times and should be free of side effects. The command exits with an
+error if any check fails.
+
+Examples:
+  # Diagnose a local server without TLS
+  hyperway doctor --url localhost:8080
+
+  # Diagnose a TLS server, checking trailers and compression with GetUser
+  hyperway doctor --url https://api.example.com \
+    --method user.v1.UserService/GetUser --data '{"id":"1"}'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(opts)
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.url, "url", "u", "", "Server address: host:port without TLS, or an http or https URL")
+	cmd.Flags().StringVarP(&opts.method, "method", "m", "", "Method to call (e.g., user.v1.UserService/GetUser) instead of relying on reflection")
+	cmd.Flags().StringVarP(&opts.data, "data", "d", "{}", "JSON request of the method")
+	cmd.Flags().StringVar(&opts.origin, "origin", "https://example.com", "Origin of the CORS preflight request")
+	cmd.Flags().BoolVarP(&opts.insecure, "insecure", "k", false, "Skip TLS certificate verification")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", doctorProbeTimeout, "Timeout of each probe")
+	_ = cmd.MarkFlagRequired("url")
+
+	return cmd
+}
+
+func runDoctor(opts *doctorOptions) error {
+	runOpts := []doctor.Option{
+		doctor.WithTimeout(opts.timeout),
+		doctor.WithOrigin(opts.origin),
+	}
+	if opts.method != "" {
+		runOpts = append(runOpts, doctor.WithMethod(opts.method, opts.data))
+	}
+	if opts.insecure {
+		runOpts = append(runOpts, doctor.WithTLSConfig(&tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true, //nolint:gosec // Requested with --insecure
+		}))
+	}
+
+	report, err := doctor.Run(context.Background(), opts.url, runOpts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Diagnosing %s\n\n", report.URL)
+	if err := report.WriteTable(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("diagnosis found problems")
+	}
+	return nil
+}
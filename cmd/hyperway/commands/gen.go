@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewGenCommand creates the gen command with subcommands.
+func NewGenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "Code generation commands",
+		Long:  "Commands for generating Go code from the API surface of a running service.",
+	}
+
+	cmd.AddCommand(
+		newGenMocksCommand(),
+		newGenPBGoCommand(),
+	)
+
+	return cmd
+}
+
+// genMocksOptions holds options for the gen mocks command.
+type genMocksOptions struct {
+	endpoint    string
+	output      string
+	packageName string
+	services    []string
+	timeout     time.Duration
+}
+
+func newGenMocksCommand() *cobra.Command {
+	opts := &genMocksOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "mocks [flags]",
+		Short: "Generate Go mocks for the services of a running service",
+		Long: `Generate Go mock implementations for every service exposed by a running
+hyperway service, using reflection to discover the API surface.
+
+For each service the generated file contains a client interface, request and
+response structs, and a mock with configurable expectations and typed request
+matchers, so consumers can unit-test against the API without running the server.
+
+Examples:
+  # Generate mocks for all services
+  hyperway gen mocks --endpoint http://localhost:8080
+
+  # Generate into a specific file and package
+  hyperway gen mocks --endpoint http://localhost:8080 --output ./internal/usermock/mocks.go --package usermock
+
+  # Generate mocks for selected services only
+  hyperway gen mocks --endpoint http://localhost:8080 --services user.v1.UserService`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenMocks(opts)
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "http://localhost:8080", "Service endpoint URL")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "mocks.go", "Output Go file")
+	cmd.Flags().StringVarP(&opts.packageName, "package", "p", "mocks", "Go package name of the generated file")
+	cmd.Flags().StringSliceVarP(&opts.services, "services", "s", []string{}, "Fully-qualified services to mock (comma-separated, default all)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Request timeout")
+
+	return cmd
+}
+
+func runGenMocks(opts *genMocksOptions) error {
+	fdset, err := fetchFileDescriptors(opts.endpoint, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	src, err := generateMocks(fdset, mockOptions{
+		PackageName: opts.packageName,
+		Services:    opts.services,
+		Source:      opts.endpoint,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate mocks: %w", err)
+	}
+
+	if dir := filepath.Dir(opts.output); dir != "." {
+		if err := os.MkdirAll(dir, dirPermission); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	if err := os.WriteFile(opts.output, src, filePermission); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.output, err)
+	}
+
+	fmt.Printf("Generated mocks: %s\n", opts.output)
+	return nil
+}
+
+// genPBGoOptions holds options for the gen pb-go command.
+type genPBGoOptions struct {
+	endpoint string
+	output   string
+	module   string
+	connect  bool
+	plugin   string
+	timeout  time.Duration
+}
+
+func newGenPBGoCommand() *cobra.Command {
+	opts := &genPBGoOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pb-go [flags]",
+		Short: "Generate protoc-gen-go compatible Go packages for a running service",
+		Long: `Generate standard protobuf Go code for every proto file exposed by a running
+hyperway service, using reflection to discover the API surface.
+
+The output is what protoc-gen-go and protoc-gen-connect-go would generate from
+the exported schema: message types with protoreflect support, generated by
+running the protoc-gen-go plugin, plus Connect clients and handlers in a
+"connect" sub-package. Consumers can depend on the generated packages without
+running protoc or buf.
+
+Each proto package is written to a directory derived from its name, e.g.
+"user.v1" is generated into <output>/user/v1 as Go package userv1, imported as
+<module>/user/v1.
+
+Examples:
+  # Generate into ./gen for the module path github.com/acme/api/gen
+  hyperway gen pb-go --endpoint http://localhost:8080 --output ./gen --module github.com/acme/api/gen
+
+  # Generate message types only
+  hyperway gen pb-go --endpoint http://localhost:8080 --module github.com/acme/api/gen --connect=false`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenPBGo(opts)
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "http://localhost:8080", "Service endpoint URL")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "gen", "Output directory")
+	cmd.Flags().StringVarP(&opts.module, "module", "m", "", "Go import path of the output directory (required)")
+	cmd.Flags().BoolVar(&opts.connect, "connect", true, "Generate connect-go clients and handlers")
+	cmd.Flags().StringVar(&opts.plugin, "protoc-gen-go", defaultProtocGenGo, "protoc-gen-go plugin generating the message types")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Request timeout")
+	_ = cmd.MarkFlagRequired("module")
+
+	return cmd
+}
+
+func runGenPBGo(opts *genPBGoOptions) error {
+	fdset, err := fetchFileDescriptors(opts.endpoint, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	files, err := generatePBGo(context.Background(), fdset, pbGoOptions{
+		ImportPrefix: opts.module,
+		Connect:      opts.connect,
+		ProtocGenGo:  opts.plugin,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate Go code: %w", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(opts.output, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), dirPermission); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, files[name], filePermission); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Generated: %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,612 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// mockOptions configures mock generation.
+type mockOptions struct {
+	// PackageName is the Go package of the generated file.
+	PackageName string
+	// Services limits generation to these fully-qualified service names.
+	// Empty means all services.
+	Services []string
+	// Source is recorded in the generated file header.
+	Source string
+}
+
+// wellKnownGoTypes maps well-known protobuf messages to the Go types hyperway
+// uses for them, so generated structs look like the server's own types.
+var wellKnownGoTypes = map[string]string{
+	".google.protobuf.Timestamp":   "time.Time",
+	".google.protobuf.Duration":    "time.Duration",
+	".google.protobuf.Empty":       "struct{}",
+	".google.protobuf.Any":         "any",
+	".google.protobuf.Value":       "any",
+	".google.protobuf.Struct":      "map[string]any",
+	".google.protobuf.ListValue":   "[]any",
+	".google.protobuf.FieldMask":   "[]string",
+	".google.protobuf.StringValue": "*string",
+	".google.protobuf.BytesValue":  "[]byte",
+	".google.protobuf.BoolValue":   "*bool",
+	".google.protobuf.Int32Value":  "*int32",
+	".google.protobuf.Int64Value":  "*int64",
+	".google.protobuf.UInt32Value": "*uint32",
+	".google.protobuf.UInt64Value": "*uint64",
+	".google.protobuf.FloatValue":  "*float32",
+	".google.protobuf.DoubleValue": "*float64",
+}
+
+// commonInitialisms are rendered in upper case in Go identifiers.
+var commonInitialisms = map[string]bool{
+	"api": true, "grpc": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "rpc": true, "sql": true, "uri": true, "url": true, "uuid": true,
+}
+
+// mockGenerator renders Go mocks for a set of file descriptors.
+type mockGenerator struct {
+	buf       bytes.Buffer
+	files     []*descriptorpb.FileDescriptorProto
+	messages  map[string]*descriptorpb.DescriptorProto // fully-qualified name -> message
+	typeNames map[string]string                        // fully-qualified name -> Go type name
+	enums     map[string]string                        // fully-qualified name -> Go type name
+	usesTime  bool
+}
+
+// generateMocks renders a gofmt-ed Go file containing a client interface and a
+// mock implementation for every service in fdset.
+func generateMocks(fdset *descriptorpb.FileDescriptorSet, opts mockOptions) ([]byte, error) {
+	if opts.PackageName == "" {
+		opts.PackageName = "mocks"
+	}
+
+	g := &mockGenerator{
+		messages:  make(map[string]*descriptorpb.DescriptorProto),
+		typeNames: make(map[string]string),
+		enums:     make(map[string]string),
+	}
+	for _, file := range fdset.GetFile() {
+		if strings.HasPrefix(file.GetPackage(), "google.protobuf") {
+			continue
+		}
+		g.files = append(g.files, file)
+	}
+	g.assignTypeNames()
+
+	services, err := g.selectServices(opts.Services)
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services to mock")
+	}
+
+	g.writeHelpers()
+	g.writeTypes()
+	for _, svc := range services {
+		g.writeService(svc.pkg, svc.desc)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by hyperway gen mocks. DO NOT EDIT.\n")
+	if opts.Source != "" {
+		fmt.Fprintf(&out, "// Source: %s\n", opts.Source)
+	}
+	fmt.Fprintf(&out, "\npackage %s\n\nimport (\n", opts.PackageName)
+	imports := []string{"context", "errors", "fmt", "reflect", "sync"}
+	if g.usesTime {
+		imports = append(imports, "time")
+	}
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n")
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return src, nil
+}
+
+type mockService struct {
+	pkg  string
+	desc *descriptorpb.ServiceDescriptorProto
+}
+
+// selectServices returns the services to mock in a stable order.
+func (g *mockGenerator) selectServices(filter []string) ([]mockService, error) {
+	wanted := make(map[string]string, len(filter))
+	for _, name := range filter {
+		wanted[name] = name
+	}
+
+	var services []mockService
+	for _, file := range g.files {
+		for _, svc := range file.GetService() {
+			fullName := qualify(file.GetPackage(), svc.GetName())
+			if strings.HasPrefix(fullName, "grpc.") {
+				continue
+			}
+			if _, ok := wanted[fullName]; len(filter) > 0 && !ok {
+				continue
+			}
+			delete(wanted, fullName)
+			services = append(services, mockService{pkg: file.GetPackage(), desc: svc})
+		}
+	}
+	if len(wanted) > 0 {
+		return nil, fmt.Errorf("services not found: %s", strings.Join(sortedKeys(wanted), ", "))
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return qualify(services[i].pkg, services[i].desc.GetName()) < qualify(services[j].pkg, services[j].desc.GetName())
+	})
+	return services, nil
+}
+
+// assignTypeNames picks a Go name for every message and enum. Nested types are
+// joined with an underscore; names that clash across packages are prefixed
+// with the package name.
+func (g *mockGenerator) assignTypeNames() {
+	type entry struct {
+		fullName, pkg, local string
+		enum                 bool
+	}
+	var entries []entry
+	counts := make(map[string]int)
+
+	var walk func(pkg, scope, prefix string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto)
+	walk = func(pkg, scope, prefix string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto) {
+		for _, enum := range enums {
+			local := joinLocal(prefix, enum.GetName())
+			entries = append(entries, entry{fullName: "." + qualify(scope, enum.GetName()), pkg: pkg, local: local, enum: true})
+			counts[local]++
+		}
+		for _, msg := range msgs {
+			msgScope := qualify(scope, msg.GetName())
+			g.messages["."+msgScope] = msg
+			if msg.GetOptions().GetMapEntry() {
+				continue
+			}
+			local := joinLocal(prefix, msg.GetName())
+			entries = append(entries, entry{fullName: "." + msgScope, pkg: pkg, local: local})
+			counts[local]++
+			walk(pkg, msgScope, local, msg.GetNestedType(), msg.GetEnumType())
+		}
+	}
+	for _, file := range g.files {
+		walk(file.GetPackage(), file.GetPackage(), "", file.GetMessageType(), file.GetEnumType())
+	}
+
+	for _, e := range entries {
+		name := e.local
+		if counts[e.local] > 1 {
+			name = goName(strings.ReplaceAll(e.pkg, ".", "_")) + "_" + e.local
+		}
+		if e.enum {
+			g.enums[e.fullName] = name
+		} else {
+			g.typeNames[e.fullName] = name
+		}
+	}
+}
+
+func (g *mockGenerator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *mockGenerator) writeHelpers() {
+	g.printf(`
+// ErrUnexpectedCall is returned by a mock method when no expectation matches the request.
+var ErrUnexpectedCall = errors.New("mock: unexpected call")
+
+// TestingT is the subset of testing.TB used by the generated mocks.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Any returns a request matcher that accepts every request.
+func Any[T any]() func(*T) bool {
+	return func(*T) bool { return true }
+}
+
+// Eq returns a request matcher that accepts requests deeply equal to want.
+func Eq[T any](want *T) func(*T) bool {
+	return func(got *T) bool { return reflect.DeepEqual(got, want) }
+}
+`)
+}
+
+// writeTypes renders enums and messages in a stable order.
+func (g *mockGenerator) writeTypes() {
+	for _, fullName := range sortedKeys(g.enums) {
+		g.writeEnum(fullName)
+	}
+	for _, fullName := range sortedKeys(g.typeNames) {
+		g.writeMessage(fullName, g.messages[fullName])
+	}
+}
+
+func (g *mockGenerator) writeEnum(fullName string) {
+	enum := g.findEnum(fullName)
+	name := g.enums[fullName]
+
+	g.printf("\n// %s mirrors the %s enum. Values use their protobuf names.\n", name, fullName[1:])
+	g.printf("type %s string\n\n", name)
+	if enum == nil || len(enum.GetValue()) == 0 {
+		return
+	}
+	g.printf("const (\n")
+	for _, v := range enum.GetValue() {
+		g.printf("\t%s_%s %s = %q\n", name, v.GetName(), name, v.GetName())
+	}
+	g.printf(")\n")
+}
+
+func (g *mockGenerator) findEnum(fullName string) *descriptorpb.EnumDescriptorProto {
+	parent, local := splitFullName(fullName)
+	if msg, ok := g.messages[parent]; ok {
+		for _, enum := range msg.GetEnumType() {
+			if enum.GetName() == local {
+				return enum
+			}
+		}
+		return nil
+	}
+	for _, file := range g.files {
+		if "."+file.GetPackage() != parent && !(file.GetPackage() == "" && parent == "") {
+			continue
+		}
+		for _, enum := range file.GetEnumType() {
+			if enum.GetName() == local {
+				return enum
+			}
+		}
+	}
+	return nil
+}
+
+func (g *mockGenerator) writeMessage(fullName string, msg *descriptorpb.DescriptorProto) {
+	name := g.typeNames[fullName]
+	g.printf("\n// %s mirrors the %s message.\n", name, fullName[1:])
+	g.printf("type %s struct {\n", name)
+	for _, field := range msg.GetField() {
+		jsonName := field.GetJsonName()
+		if jsonName == "" {
+			jsonName = field.GetName()
+		}
+		g.printf("\t%s %s `json:\"%s,omitempty\"`\n", goName(field.GetName()), g.fieldType(field), jsonName)
+	}
+	g.printf("}\n")
+}
+
+// fieldType returns the Go type of a message field.
+func (g *mockGenerator) fieldType(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		if entry, ok := g.messages[field.GetTypeName()]; ok && entry.GetOptions().GetMapEntry() {
+			var key, value *descriptorpb.FieldDescriptorProto
+			for _, f := range entry.GetField() {
+				switch f.GetNumber() {
+				case 1:
+					key = f
+				case 2:
+					value = f
+				}
+			}
+			if key != nil && value != nil {
+				return "map[" + g.elemType(key) + "]" + g.elemType(value)
+			}
+		}
+	}
+
+	elem := g.elemType(field)
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return "[]" + elem
+	}
+	if field.GetProto3Optional() && !strings.HasPrefix(elem, "*") && !strings.HasPrefix(elem, "[]") {
+		return "*" + elem
+	}
+	return elem
+}
+
+// elemType returns the Go type of a single value of the field.
+func (g *mockGenerator) elemType(field *descriptorpb.FieldDescriptorProto) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return "float64"
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return "float32"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return "int64"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return "uint64"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return "int32"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return "uint32"
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "bool"
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return "string"
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "[]byte"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if name, ok := g.enums[field.GetTypeName()]; ok {
+			return name
+		}
+		return "string"
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		if goType, ok := wellKnownGoTypes[field.GetTypeName()]; ok {
+			if strings.HasPrefix(goType, "time.") {
+				g.usesTime = true
+			}
+			return goType
+		}
+		if name, ok := g.typeNames[field.GetTypeName()]; ok {
+			return "*" + name
+		}
+		return "any"
+	default:
+		return "any"
+	}
+}
+
+// messageType returns the Go type name used for a method input or output.
+func (g *mockGenerator) messageType(typeName string) string {
+	if name, ok := g.typeNames[typeName]; ok {
+		return name
+	}
+	if goType, ok := wellKnownGoTypes[typeName]; ok && goType == "struct{}" {
+		return goType
+	}
+	// Messages outside the fetched files are not known in detail
+	return "map[string]any"
+}
+
+// writeService renders the client interface, the mock, and one expectation
+// type per mockable method.
+func (g *mockGenerator) writeService(pkg string, svc *descriptorpb.ServiceDescriptorProto) {
+	fullName := qualify(pkg, svc.GetName())
+	svcName := goName(svc.GetName())
+	if g.typeNames["."+fullName] != "" || g.countServices(svc.GetName()) > 1 {
+		svcName = goName(strings.ReplaceAll(pkg, ".", "_")) + "_" + svcName
+	}
+	clientName := svcName + "Client"
+	mockName := "Mock" + svcName
+
+	type method struct {
+		name, field, in, result, zero, expectation, path string
+		desc                                             *descriptorpb.MethodDescriptorProto
+	}
+	var methods []method
+	var skipped []string
+	for _, m := range svc.GetMethod() {
+		if m.GetClientStreaming() {
+			skipped = append(skipped, m.GetName())
+			continue
+		}
+		out := g.messageType(m.GetOutputType())
+		result, zero := "*"+out, "new("+out+")"
+		if m.GetServerStreaming() {
+			result, zero = "[]*"+out, "nil"
+		}
+		name := goName(m.GetName())
+		methods = append(methods, method{
+			name:        name,
+			field:       lowerFirst(name),
+			in:          g.messageType(m.GetInputType()),
+			result:      result,
+			zero:        zero,
+			expectation: svcName + name + "Expectation",
+			path:        fullName + "/" + m.GetName(),
+			desc:        m,
+		})
+	}
+
+	g.printf("\n// %s is the API surface of %s.\n", clientName, fullName)
+	if len(skipped) > 0 {
+		g.printf("// Client and bidirectional streaming methods are not mocked: %s.\n", strings.Join(skipped, ", "))
+	}
+	g.printf("type %s interface {\n", clientName)
+	for _, m := range methods {
+		if m.desc.GetServerStreaming() {
+			g.printf("\t// %s is server streaming; the mock returns every message at once.\n", m.name)
+		}
+		g.printf("\t%s(ctx context.Context, req *%s) (%s, error)\n", m.name, m.in, m.result)
+	}
+	g.printf("}\n")
+
+	g.printf("\n// %s is a mock implementation of %s.\n", mockName, clientName)
+	g.printf("type %s struct {\n\tmu sync.Mutex\n", mockName)
+	for _, m := range methods {
+		g.printf("\t%s []*%s\n", m.field, m.expectation)
+		g.printf("\t%sCalls []*%s\n", m.field, m.in)
+	}
+	g.printf("}\n")
+	g.printf("\nvar _ %s = (*%s)(nil)\n", clientName, mockName)
+	g.printf("\n// New%s creates a mock with no expectations.\nfunc New%s() *%s {\n\treturn &%s{}\n}\n",
+		mockName, mockName, mockName, mockName)
+
+	for _, m := range methods {
+		g.printf(`
+// %[1]s configures the result of %[2]s calls matching a request.
+type %[1]s struct {
+	match func(*%[3]s) bool
+	fn    func(context.Context, *%[3]s) (%[4]s, error)
+	times int
+	calls int
+}
+
+// Return sets a fixed result for matching calls.
+func (e *%[1]s) Return(resp %[4]s, err error) *%[1]s {
+	e.fn = func(context.Context, *%[3]s) (%[4]s, error) { return resp, err }
+	return e
+}
+
+// ReturnFunc computes the result of matching calls.
+func (e *%[1]s) ReturnFunc(fn func(ctx context.Context, req *%[3]s) (%[4]s, error)) *%[1]s {
+	e.fn = fn
+	return e
+}
+
+// Times limits the expectation to n matching calls and makes AssertExpectations
+// require exactly n calls. Without Times the expectation matches any number of calls.
+func (e *%[1]s) Times(n int) *%[1]s {
+	e.times = n
+	return e
+}
+
+// Once is shorthand for Times(1).
+func (e *%[1]s) Once() *%[1]s {
+	return e.Times(1)
+}
+
+// On%[5]s registers an expectation for %[2]s. A nil matcher accepts every request.
+// Expectations are matched in registration order.
+func (m *%[6]s) On%[5]s(match func(*%[3]s) bool) *%[1]s {
+	if match == nil {
+		match = Any[%[3]s]()
+	}
+	e := &%[1]s{match: match}
+	m.mu.Lock()
+	m.%[7]s = append(m.%[7]s, e)
+	m.mu.Unlock()
+	return e
+}
+
+// %[5]s implements %[8]s.
+func (m *%[6]s) %[5]s(ctx context.Context, req *%[3]s) (%[4]s, error) {
+	m.mu.Lock()
+	m.%[7]sCalls = append(m.%[7]sCalls, req)
+	var matched *%[1]s
+	for _, e := range m.%[7]s {
+		if (e.times == 0 || e.calls < e.times) && e.match(req) {
+			e.calls++
+			matched = e
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if matched == nil {
+		return nil, fmt.Errorf("%%w: %[2]s(%%+v)", ErrUnexpectedCall, req)
+	}
+	if matched.fn == nil {
+		return %[9]s, nil
+	}
+	return matched.fn(ctx, req)
+}
+
+// %[5]sCalls returns the requests received by %[5]s.
+func (m *%[6]s) %[5]sCalls() []*%[3]s {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*%[3]s(nil), m.%[7]sCalls...)
+}
+`, m.expectation, m.path, m.in, m.result, m.name, mockName, m.field, clientName, m.zero)
+	}
+
+	g.printf("\n// AssertExpectations reports expectations limited with Times that were not\n")
+	g.printf("// called exactly the configured number of times.\n")
+	g.printf("func (m *%s) AssertExpectations(t TestingT) {\n\tt.Helper()\n\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", mockName)
+	for _, m := range methods {
+		g.printf("\tfor _, e := range m.%s {\n", m.field)
+		g.printf("\t\tif e.times > 0 && e.calls != e.times {\n")
+		g.printf("\t\t\tt.Errorf(\"%s: expected %%d calls, got %%d\", e.times, e.calls)\n", m.path)
+		g.printf("\t\t}\n\t}\n")
+	}
+	g.printf("}\n")
+}
+
+func (g *mockGenerator) countServices(name string) int {
+	count := 0
+	for _, file := range g.files {
+		for _, svc := range file.GetService() {
+			if svc.GetName() == name {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// qualify joins a package or scope with a local name.
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// joinLocal builds the Go name of a possibly nested type.
+func joinLocal(prefix, name string) string {
+	if prefix == "" {
+		return upperFirst(name)
+	}
+	return prefix + "_" + name
+}
+
+// splitFullName splits ".pkg.Parent.Name" into ".pkg.Parent" and "Name".
+func splitFullName(fullName string) (parent, local string) {
+	idx := strings.LastIndex(fullName, ".")
+	if idx <= 0 {
+		return "", strings.TrimPrefix(fullName, ".")
+	}
+	return fullName[:idx], fullName[idx+1:]
+}
+
+// goName converts a snake_case or lowerCamel protobuf name to an exported Go identifier.
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' })
+	var b strings.Builder
+	for _, part := range parts {
+		if commonInitialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+func upperFirst(s string) string {
+	runes := []rune(s)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type User struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type GetUserRequest struct {
+	ID string `json:"id"`
+}
+
+type GetUserResponse struct {
+	User *User `json:"user"`
+}
+
+type WatchUsersRequest struct {
+	Limit int32 `json:"limit"`
+}
+
+func TestGenerateMocks(t *testing.T) {
+	svc := rpc.NewService("UserService",
+		rpc.WithPackage("user.v1"),
+		rpc.WithReflection(true),
+	)
+	rpc.MustRegister(svc, "GetUser", func(ctx context.Context, req *GetUserRequest) (*GetUserResponse, error) {
+		return &GetUserResponse{}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "WatchUsers", func(ctx context.Context, req *WatchUsersRequest, stream rpc.ServerStream[User]) error {
+		return nil
+	})
+
+	fdset := svc.GetFileDescriptorSet()
+	src, err := generateMocks(fdset, mockOptions{PackageName: "usermock", Source: "user.v1"})
+	if err != nil {
+		t.Fatalf("Failed to generate mocks: %v", err)
+	}
+	code := string(src)
+
+	for _, want := range []string{
+		"package usermock",
+		"type UserServiceClient interface",
+		"GetUser(ctx context.Context, req *GetUserRequest) (*GetUserResponse, error)",
+		"WatchUsers(ctx context.Context, req *WatchUsersRequest) ([]*User, error)",
+		"func (m *MockUserService) OnGetUser(match func(*GetUserRequest) bool) *UserServiceGetUserExpectation",
+		"CreatedAt time.Time",
+		"Labels    map[string]string",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected generated code to contain %q", want)
+		}
+	}
+
+	// The generated file must compile on its own
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "mocks.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse generated code: %v", err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("usermock", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("Generated code does not type-check: %v\n%s", err, code)
+	}
+
+	t.Run("unknown service", func(t *testing.T) {
+		_, err := generateMocks(fdset, mockOptions{Services: []string{"user.v1.Missing"}})
+		if err == nil || !strings.Contains(err.Error(), "user.v1.Missing") {
+			t.Errorf("Expected not found error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,522 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/token"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// defaultProtocGenGo is the protoc-gen-go plugin run by default.
+const defaultProtocGenGo = "protoc-gen-go"
+
+// Identifiers used by generated Connect code
+const (
+	contextPackage = protogen.GoImportPath("context")
+	errorsPackage  = protogen.GoImportPath("errors")
+	httpPackage    = protogen.GoImportPath("net/http")
+	stringsPackage = protogen.GoImportPath("strings")
+	connectPackage = protogen.GoImportPath("connectrpc.com/connect")
+
+	connectFileSuffix    = ".connect.go"
+	connectPackageSuffix = "connect"
+	commentWidth         = 97 // leave room for "// "
+)
+
+// pbGoOptions configures protobuf Go code generation.
+type pbGoOptions struct {
+	// ImportPrefix is the Go import path of the output directory, e.g.
+	// "github.com/acme/api/gen". Each proto package is generated into a
+	// subdirectory derived from its name, e.g. "user.v1" -> "user/v1".
+	ImportPrefix string
+	// Connect also generates connect-go clients and handlers for services.
+	Connect bool
+	// ProtocGenGo is the protoc-gen-go plugin generating the message types
+	// (default "protoc-gen-go" on the PATH).
+	ProtocGenGo string
+}
+
+// generatePBGo renders the Go code protoc-gen-go (and protoc-gen-connect-go)
+// would generate for the files in fdset. It returns file contents keyed by
+// path relative to the output directory.
+func generatePBGo(ctx context.Context, fdset *descriptorpb.FileDescriptorSet, opts pbGoOptions) (map[string][]byte, error) {
+	if opts.ImportPrefix == "" {
+		return nil, fmt.Errorf("an import prefix is required")
+	}
+
+	files, generate, err := pbGoRequestFiles(fdset, opts.ImportPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(generate) == 0 {
+		return nil, fmt.Errorf("no proto files to generate")
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: generate,
+		Parameter:      proto.String("module=" + opts.ImportPrefix),
+		ProtoFile:      files,
+	}
+
+	// Message types come from protoc-gen-go itself, run as a plugin
+	resp, err := runProtocPlugin(ctx, opts.ProtocGenGo, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]byte, len(resp.File))
+	for _, file := range resp.File {
+		out[file.GetName()] = []byte(file.GetContent())
+	}
+	if !opts.Connect {
+		return out, nil
+	}
+
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare generator: %w", err)
+	}
+	// Support what protoc-gen-go does, as the code refers to its messages
+	gen.SupportedFeatures = resp.GetSupportedFeatures()
+	gen.SupportedEditionsMinimum = descriptorpb.Edition(resp.GetMinimumEdition())
+	gen.SupportedEditionsMaximum = descriptorpb.Edition(resp.GetMaximumEdition())
+	for _, file := range gen.Files {
+		if file.Generate && len(file.Services) > 0 {
+			generateConnectFile(gen, file)
+		}
+	}
+
+	connectResp := gen.Response()
+	if connectResp.Error != nil {
+		return nil, fmt.Errorf("code generation failed: %s", connectResp.GetError())
+	}
+	for _, file := range connectResp.File {
+		out[file.GetName()] = []byte(file.GetContent())
+	}
+	return out, nil
+}
+
+// runProtocPlugin runs a protoc plugin on req, as protoc does: the encoded
+// request on stdin, the encoded response on stdout.
+func runProtocPlugin(ctx context.Context, plugin string, req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	if plugin == "" {
+		plugin = defaultProtocGenGo
+	}
+	in, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the generator request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, plugin) //nolint:gosec // The plugin is configured by the caller
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", plugin, err, strings.TrimSpace(stderr.String()))
+	}
+
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("invalid response of %s: %w", plugin, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s failed: %s", plugin, resp.GetError())
+	}
+	return resp, nil
+}
+
+// pbGoRequestFiles returns the files of a generator request in dependency
+// order, with go_package set on the files to generate. Missing dependencies,
+// such as well-known types, are filled in from the global registry.
+func pbGoRequestFiles(fdset *descriptorpb.FileDescriptorSet, importPrefix string) ([]*descriptorpb.FileDescriptorProto, []string, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, file := range fdset.GetFile() {
+		byName[file.GetName()] = file
+	}
+
+	var ordered []*descriptorpb.FileDescriptorProto
+	var generate []string
+	visited := make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+
+		file, ok := byName[name]
+		registered, err := protoregistry.GlobalFiles.FindFileByPath(name)
+		switch {
+		case err == nil && (!ok || registered.Options().(*descriptorpb.FileOptions).GetGoPackage() != ""):
+			// Files with existing Go packages, such as well-known types, are imported
+			file = protodesc.ToFileDescriptorProto(registered)
+		case ok:
+			file = proto.Clone(file).(*descriptorpb.FileDescriptorProto)
+			if file.Options == nil {
+				file.Options = &descriptorpb.FileOptions{}
+			}
+			if file.Options.GoPackage == nil {
+				file.Options.GoPackage = proto.String(goPackageFor(importPrefix, file))
+			}
+			generate = append(generate, name)
+		default:
+			return fmt.Errorf("missing dependency %s", name)
+		}
+
+		for _, dep := range file.GetDependency() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		ordered = append(ordered, file)
+		return nil
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ordered, generate, nil
+}
+
+// goPackageFor derives a go_package option from a file's proto package, in
+// the style of buf managed mode: "user.v1" -> "<prefix>/user/v1;userv1".
+func goPackageFor(importPrefix string, file *descriptorpb.FileDescriptorProto) string {
+	pkg := file.GetPackage()
+	if pkg == "" {
+		pkg = strings.TrimSuffix(path.Base(file.GetName()), ".proto")
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(pkg))
+	if !token.IsIdentifier(name) {
+		name = "pb" + name
+	}
+	return path.Join(importPrefix, strings.ReplaceAll(pkg, ".", "/")) + ";" + name
+}
+
+// generateConnectFile renders the connect-go clients and handlers of a file
+// into a "connect" sub-package, matching the output of protoc-gen-connect-go.
+func generateConnectFile(gen *protogen.Plugin, file *protogen.File) {
+	packageName := file.GoPackageName + connectPackageSuffix
+	prefix := path.Join(path.Dir(file.GeneratedFilenamePrefix), string(packageName), path.Base(file.GeneratedFilenamePrefix))
+	g := gen.NewGeneratedFile(prefix+connectFileSuffix, protogen.GoImportPath(path.Join(string(file.GoImportPath), string(packageName))))
+	g.Import(file.GoImportPath)
+
+	g.P("// Code generated by protoc-gen-connect-go. DO NOT EDIT.")
+	g.P("//")
+	g.P("// Source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", packageName)
+	g.P()
+	wrapComments(g, "This is a compile-time assertion to ensure that this generated file ",
+		"and the connect package are compatible. If you get a compiler error that this constant ",
+		"is not defined, this code was generated with a version of connect newer than the one ",
+		"compiled into your binary. You can fix the problem by either regenerating this code ",
+		"with an older version of connect or updating the connect version compiled into your binary.")
+	g.P("const _ = ", connectPackage.Ident("IsAtLeastVersion1_13_0"))
+	g.P()
+
+	g.P("const (")
+	for _, service := range file.Services {
+		wrapComments(g, service.Desc.Name(), "Name is the fully-qualified name of the ", service.Desc.Name(), " service.")
+		g.P(service.Desc.Name(), `Name = "`, service.Desc.FullName(), `"`)
+	}
+	g.P(")")
+	g.P()
+
+	wrapComments(g, "These constants are the fully-qualified names of the RPCs defined in this package. ",
+		"They're exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.")
+	g.P("const (")
+	for _, service := range file.Services {
+		for _, method := range service.Methods {
+			wrapComments(g, procedureConstName(method), " is the fully-qualified name of the ",
+				service.Desc.Name(), "'s ", method.Desc.Name(), " RPC.")
+			g.P(procedureConstName(method), ` = "/`, service.Desc.FullName(), "/", method.Desc.Name(), `"`)
+		}
+	}
+	g.P(")")
+	g.P()
+
+	for _, service := range file.Services {
+		generateConnectClient(g, file, service)
+		generateConnectHandler(g, file, service)
+	}
+}
+
+// generateConnectClient renders the client interface and implementation of a service.
+func generateConnectClient(g *protogen.GeneratedFile, file *protogen.File, service *protogen.Service) {
+	client := service.GoName + "Client"
+	impl := unexport(service.GoName) + "Client"
+
+	wrapComments(g, client, " is a client for the ", service.Desc.FullName(), " service.")
+	g.P("type ", client, " interface {")
+	for _, method := range service.Methods {
+		methodComments(g, method)
+		g.P(clientSignature(g, method, false))
+	}
+	g.P("}")
+	g.P()
+
+	wrapComments(g, "New", client, " constructs a client for the ", service.Desc.FullName(),
+		" service. By default, it uses the Connect protocol with the binary Protobuf Codec, ",
+		"asks for gzipped responses, and sends uncompressed requests. ",
+		"To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or ",
+		"connect.WithGRPCWeb() options.")
+	g.P("func New", client, "(httpClient ", connectPackage.Ident("HTTPClient"), ", baseURL string, opts ...", connectPackage.Ident("ClientOption"), ") ", client, " {")
+	if len(service.Methods) > 0 {
+		g.P("baseURL = ", stringsPackage.Ident("TrimRight"), `(baseURL, "/")`)
+		g.P(methodsVarName(service), " := ", file.GoDescriptorIdent, `.Services().ByName("`, service.Desc.Name(), `").Methods()`)
+	}
+	g.P("return &", impl, "{")
+	for _, method := range service.Methods {
+		g.P(unexport(method.GoName), ": ", connectPackage.Ident("NewClient"), "[", method.Input.GoIdent, ", ", method.Output.GoIdent, "](")
+		g.P("httpClient,")
+		g.P("baseURL + ", procedureConstName(method), ",")
+		g.P(connectPackage.Ident("WithSchema"), "(", methodsVarName(service), `.ByName("`, method.Desc.Name(), `")),`)
+		idempotencyOption(g, method)
+		g.P(connectPackage.Ident("WithClientOptions"), "(opts...),")
+		g.P("),")
+	}
+	g.P("}")
+	g.P("}")
+	g.P()
+
+	wrapComments(g, impl, " implements ", client, ".")
+	g.P("type ", impl, " struct {")
+	for _, method := range service.Methods {
+		g.P(unexport(method.GoName), " *", connectPackage.Ident("Client"), "[", method.Input.GoIdent, ", ", method.Output.GoIdent, "]")
+	}
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Methods {
+		wrapComments(g, method.GoName, " calls ", method.Desc.FullName(), ".")
+		g.P("func (c *", impl, ") ", clientSignature(g, method, true), " {")
+		switch {
+		case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+			g.P("return c.", unexport(method.GoName), ".CallBidiStream(ctx)")
+		case method.Desc.IsStreamingClient():
+			g.P("return c.", unexport(method.GoName), ".CallClientStream(ctx)")
+		case method.Desc.IsStreamingServer():
+			g.P("return c.", unexport(method.GoName), ".CallServerStream(ctx, req)")
+		default:
+			g.P("return c.", unexport(method.GoName), ".CallUnary(ctx, req)")
+		}
+		g.P("}")
+		g.P()
+	}
+}
+
+// generateConnectHandler renders the handler interface, constructor, and
+// unimplemented handler of a service.
+func generateConnectHandler(g *protogen.GeneratedFile, file *protogen.File, service *protogen.Service) {
+	handler := service.GoName + "Handler"
+
+	wrapComments(g, handler, " is an implementation of the ", service.Desc.FullName(), " service.")
+	g.P("type ", handler, " interface {")
+	for _, method := range service.Methods {
+		methodComments(g, method)
+		g.P(method.GoName, serverSignatureParams(g, method, false))
+	}
+	g.P("}")
+	g.P()
+
+	wrapComments(g, "New", handler, " builds an HTTP handler from the service implementation.",
+		" It returns the path on which to mount the handler and the handler itself.")
+	g.P("//")
+	wrapComments(g, "By default, handlers support the Connect, gRPC, and gRPC-Web protocols with ",
+		"the binary Protobuf and JSON codecs. They also support gzip compression.")
+	g.P("func New", handler, "(svc ", handler, ", opts ...", connectPackage.Ident("HandlerOption"), ") (string, ", httpPackage.Ident("Handler"), ") {")
+	if len(service.Methods) > 0 {
+		g.P(methodsVarName(service), " := ", file.GoDescriptorIdent, `.Services().ByName("`, service.Desc.Name(), `").Methods()`)
+	}
+	for _, method := range service.Methods {
+		constructor := "NewUnaryHandler"
+		switch {
+		case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+			constructor = "NewBidiStreamHandler"
+		case method.Desc.IsStreamingClient():
+			constructor = "NewClientStreamHandler"
+		case method.Desc.IsStreamingServer():
+			constructor = "NewServerStreamHandler"
+		}
+		g.P(handlerVarName(method), " := ", connectPackage.Ident(constructor), "(")
+		g.P(procedureConstName(method), ",")
+		g.P("svc.", method.GoName, ",")
+		g.P(connectPackage.Ident("WithSchema"), "(", methodsVarName(service), `.ByName("`, method.Desc.Name(), `")),`)
+		idempotencyOption(g, method)
+		g.P(connectPackage.Ident("WithHandlerOptions"), "(opts...),")
+		g.P(")")
+	}
+	g.P(`return "/`, service.Desc.FullName(), `/", `, httpPackage.Ident("HandlerFunc"), "(func(w ", httpPackage.Ident("ResponseWriter"), ", r *", httpPackage.Ident("Request"), ") {")
+	g.P("switch r.URL.Path {")
+	for _, method := range service.Methods {
+		g.P("case ", procedureConstName(method), ":")
+		g.P(handlerVarName(method), ".ServeHTTP(w, r)")
+	}
+	g.P("default:")
+	g.P(httpPackage.Ident("NotFound"), "(w, r)")
+	g.P("}")
+	g.P("})")
+	g.P("}")
+	g.P()
+
+	unimplemented := "Unimplemented" + handler
+	wrapComments(g, unimplemented, " returns CodeUnimplemented from all methods.")
+	g.P("type ", unimplemented, " struct{}")
+	g.P()
+	for _, method := range service.Methods {
+		g.P("func (", unimplemented, ") ", method.GoName, serverSignatureParams(g, method, false), " {")
+		result := "nil, "
+		if method.Desc.IsStreamingServer() {
+			result = ""
+		}
+		g.P("return ", result, connectPackage.Ident("NewError"), "(", connectPackage.Ident("CodeUnimplemented"), ", ",
+			errorsPackage.Ident("New"), `("`, method.Desc.FullName(), ` is not implemented"))`)
+		g.P("}")
+		g.P()
+	}
+}
+
+// clientSignature returns the client method signature of a method.
+func clientSignature(g *protogen.GeneratedFile, method *protogen.Method, named bool) string {
+	ctx := ""
+	if named {
+		ctx = "ctx "
+	}
+	ctxType := ctx + g.QualifiedGoIdent(contextPackage.Ident("Context"))
+	in := g.QualifiedGoIdent(method.Input.GoIdent)
+	out := g.QualifiedGoIdent(method.Output.GoIdent)
+	switch {
+	case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+		return method.GoName + "(" + ctxType + ") *" + g.QualifiedGoIdent(connectPackage.Ident("BidiStreamForClient")) + "[" + in + ", " + out + "]"
+	case method.Desc.IsStreamingClient():
+		return method.GoName + "(" + ctxType + ") *" + g.QualifiedGoIdent(connectPackage.Ident("ClientStreamForClient")) + "[" + in + ", " + out + "]"
+	case method.Desc.IsStreamingServer():
+		req := ""
+		if named {
+			req = "req "
+		}
+		return method.GoName + "(" + ctxType + ", " + req + "*" + g.QualifiedGoIdent(connectPackage.Ident("Request")) + "[" + in + "]) (*" +
+			g.QualifiedGoIdent(connectPackage.Ident("ServerStreamForClient")) + "[" + out + "], error)"
+	}
+	return method.GoName + serverSignatureParams(g, method, named)
+}
+
+// serverSignatureParams returns the handler parameters and results of a method.
+func serverSignatureParams(g *protogen.GeneratedFile, method *protogen.Method, named bool) string {
+	ctx, req, stream := "", "", ""
+	if named {
+		ctx, req, stream = "ctx ", "req ", "stream "
+	}
+	ctxType := ctx + g.QualifiedGoIdent(contextPackage.Ident("Context"))
+	in := g.QualifiedGoIdent(method.Input.GoIdent)
+	out := g.QualifiedGoIdent(method.Output.GoIdent)
+	response := "(*" + g.QualifiedGoIdent(connectPackage.Ident("Response")) + "[" + out + "], error)"
+	switch {
+	case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+		return "(" + ctxType + ", " + stream + "*" + g.QualifiedGoIdent(connectPackage.Ident("BidiStream")) + "[" + in + ", " + out + "]) error"
+	case method.Desc.IsStreamingClient():
+		return "(" + ctxType + ", " + stream + "*" + g.QualifiedGoIdent(connectPackage.Ident("ClientStream")) + "[" + in + "]) " + response
+	case method.Desc.IsStreamingServer():
+		return "(" + ctxType + ", " + req + "*" + g.QualifiedGoIdent(connectPackage.Ident("Request")) + "[" + in + "], " +
+			stream + "*" + g.QualifiedGoIdent(connectPackage.Ident("ServerStream")) + "[" + out + "]) error"
+	}
+	return "(" + ctxType + ", " + req + "*" + g.QualifiedGoIdent(connectPackage.Ident("Request")) + "[" + in + "]) " + response
+}
+
+// idempotencyOption renders the idempotency option of a method, if any.
+func idempotencyOption(g *protogen.GeneratedFile, method *protogen.Method) {
+	options, _ := method.Desc.Options().(*descriptorpb.MethodOptions)
+	switch options.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		g.P(connectPackage.Ident("WithIdempotency"), "(", connectPackage.Ident("IdempotencyNoSideEffects"), "),")
+	case descriptorpb.MethodOptions_IDEMPOTENT:
+		g.P(connectPackage.Ident("WithIdempotency"), "(", connectPackage.Ident("IdempotencyIdempotent"), "),")
+	case descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN:
+	}
+}
+
+// methodComments renders the leading comments and deprecation notice of a method.
+func methodComments(g *protogen.GeneratedFile, method *protogen.Method) {
+	leading := strings.TrimSpace(method.Comments.Leading.String())
+	if leading != "" {
+		g.P(leading)
+	}
+	if options, ok := method.Desc.Options().(*descriptorpb.MethodOptions); ok && options.GetDeprecated() {
+		if leading != "" {
+			g.P("//")
+		}
+		g.P("// Deprecated: do not use.")
+	}
+}
+
+func procedureConstName(method *protogen.Method) string {
+	return method.Parent.GoName + method.GoName + "Procedure"
+}
+
+func handlerVarName(method *protogen.Method) string {
+	return unexport(method.Parent.GoName) + method.GoName + "Handler"
+}
+
+func methodsVarName(service *protogen.Service) string {
+	return unexport(service.GoName) + "Methods"
+}
+
+// unexport lower-cases the first letter of s, avoiding Go keywords.
+func unexport(s string) string {
+	lowered := strings.ToLower(s[:1]) + s[1:]
+	if token.IsKeyword(lowered) {
+		return "_" + lowered
+	}
+	return lowered
+}
+
+// wrapComments renders a comment wrapped at commentWidth.
+func wrapComments(g *protogen.GeneratedFile, elems ...any) {
+	var text bytes.Buffer
+	for _, elem := range elems {
+		fmt.Fprint(&text, elem)
+	}
+	var line bytes.Buffer
+	width := 0
+	for _, word := range strings.Fields(text.String()) {
+		runes := utf8.RuneCountInString(word)
+		if width > 0 && width+runes+1 > commentWidth {
+			g.P("// ", line.String())
+			line.Reset()
+			width = 0
+		}
+		if width > 0 {
+			line.WriteByte(' ')
+			width++
+		}
+		line.WriteString(word)
+		width += runes
+	}
+	if line.Len() > 0 {
+		g.P("// ", line.String())
+	}
+}
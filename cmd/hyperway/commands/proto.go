@@ -29,11 +29,14 @@ func NewProtoCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "proto",
 		Short: "Proto file management commands",
-		Long:  "Commands for exporting and generating proto files from services and Go code.",
+		Long:  "Commands for exporting proto files from services and publishing them to schema registries.",
 	}
 
 	cmd.AddCommand(
 		newProtoExportCommand(),
+		newProtoPushCommand(),
+		newProtoPullCommand(),
+		newProtoCheckCommand(),
 		// TODO: Implement proto generate command
 		// newProtoGenerateCommand(),
 	)
@@ -61,6 +64,11 @@ type protoExportOptions struct {
 	rubyPackage          string
 	pythonPackage        string
 	objcClassPrefix      string
+
+	// buf module options
+	buf                bool
+	bufModule          string
+	bufGoPackagePrefix string
 }
 
 func newProtoExportCommand() *cobra.Command {
@@ -72,7 +80,8 @@ func newProtoExportCommand() *cobra.Command {
 		Long: `Export proto files from a running hyperway service using reflection.
 
 The command connects to a service endpoint and exports all available proto definitions.
-It supports exporting to individual files or a ZIP archive.
+It supports exporting to individual files, a ZIP archive, or a binary
+FileDescriptorSet for protoc --descriptor_set_in, buf, or grpcurl -protoset.
 
 Examples:
   # Export to current directory
@@ -84,6 +93,13 @@ Examples:
   # Export as ZIP archive
   hyperway proto export --endpoint http://localhost:8080 --format zip --output service.zip
 
+  # Export as a self-contained descriptor set
+  hyperway proto export --endpoint http://localhost:8080 --format binpb --output service.binpb
+
+  # Export as a buf module, ready for buf generate or buf push
+  hyperway proto export --endpoint http://localhost:8080 --output ./api \
+    --buf --buf-module buf.build/acme/api
+
   # Export without comments and sorted
   hyperway proto export --endpoint http://localhost:8080 --no-comments --sort
 
@@ -108,8 +124,8 @@ Examples:
 
 	// Add flags
 	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "http://localhost:8080", "Service endpoint URL")
-	cmd.Flags().StringVarP(&opts.output, "output", "o", ".", "Output directory or file (for ZIP)")
-	cmd.Flags().StringVarP(&opts.format, "format", "f", "files", "Output format: files or zip")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", ".", "Output directory or file (for ZIP and binpb)")
+	cmd.Flags().StringVarP(&opts.format, "format", "f", "files", "Output format: files, zip, or binpb")
 	cmd.Flags().BoolVar(&opts.includeComments, "comments", true, "Include comments in proto files")
 	cmd.Flags().BoolVar(&opts.sortElements, "sort", false, "Sort proto elements alphabetically")
 	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Request timeout")
@@ -126,17 +142,71 @@ Examples:
 	cmd.Flags().StringVar(&opts.pythonPackage, "python-package", "", "Python package option")
 	cmd.Flags().StringVar(&opts.objcClassPrefix, "objc-class-prefix", "", "Objective-C class prefix option")
 
+	// buf module flags
+	cmd.Flags().BoolVar(&opts.buf, "buf", false, "Lay out files by package with buf.yaml and buf.gen.yaml (files and zip formats)")
+	cmd.Flags().StringVar(&opts.bufModule, "buf-module", "", "Buf Schema Registry module name for buf.yaml, e.g. buf.build/acme/api")
+	cmd.Flags().StringVar(&opts.bufGoPackagePrefix, "buf-go-package-prefix", "", "Enable managed mode in buf.gen.yaml with this go_package prefix")
+
 	return cmd
 }
 
 func runProtoExport(opts *protoExportOptions) error {
+	fdset, err := fetchFileDescriptors(opts.endpoint, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	// Create exporter with language options
+	exportOpts := hyperwayproto.ExportOptions{
+		IncludeComments: opts.includeComments,
+		SortElements:    opts.sortElements,
+		Indent:          "  ",
+		LanguageOptions: hyperwayproto.LanguageOptions{
+			GoPackage:            opts.goPackage,
+			JavaPackage:          opts.javaPackage,
+			JavaOuterClass:       opts.javaOuterClass,
+			JavaMultipleFiles:    opts.javaMultipleFiles,
+			CSharpNamespace:      opts.csharpNamespace,
+			PhpNamespace:         opts.phpNamespace,
+			PhpMetadataNamespace: opts.phpMetadataNamespace,
+			RubyPackage:          opts.rubyPackage,
+			PythonPackage:        opts.pythonPackage,
+			ObjcClassPrefix:      opts.objcClassPrefix,
+		},
+	}
+	exporter := hyperwayproto.NewExporter(&exportOpts)
+
+	var bufOpts *hyperwayproto.BufOptions
+	if opts.buf {
+		bufOpts = &hyperwayproto.BufOptions{Module: opts.bufModule, GoPackagePrefix: opts.bufGoPackagePrefix}
+	}
+
+	// Export based on format
+	switch opts.format {
+	case "zip":
+		return exportToZip(exporter, fdset, opts.output, bufOpts)
+	case "files":
+		return exportToFiles(exporter, fdset, opts.output, bufOpts)
+	case "binpb":
+		if bufOpts != nil {
+			return fmt.Errorf("--buf requires the files or zip format")
+		}
+		return exportToDescriptorSet(exporter, fdset, opts.output)
+	default:
+		return fmt.Errorf("unknown format: %s", opts.format)
+	}
+}
+
+// fetchFileDescriptors collects the file descriptors of every service exposed
+// by the reflection endpoint at the given URL.
+func fetchFileDescriptors(endpoint string, timeout time.Duration) (*descriptorpb.FileDescriptorSet, error) {
 	// Create HTTP client with timeout
 	client := &http.Client{
-		Timeout: opts.timeout,
+		Timeout: timeout,
 	}
 
 	// Create reflection client
-	reflectClient := grpcreflect.NewClient(client, opts.endpoint)
+	reflectClient := grpcreflect.NewClient(client, endpoint)
 
 	// Create a new stream
 	ctx := context.Background()
@@ -146,14 +216,14 @@ func runProtoExport(opts *protoExportOptions) error {
 	// List services
 	services, err := stream.ListServices()
 	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
+		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
 	if len(services) == 0 {
-		return fmt.Errorf("no services found at %s", opts.endpoint)
+		return nil, fmt.Errorf("no services found at %s", endpoint)
 	}
 
-	fmt.Printf("Found %d services at %s\n", len(services), opts.endpoint)
+	fmt.Printf("Found %d services at %s\n", len(services), endpoint)
 
 	// Create file descriptor set
 	fdset := &descriptorpb.FileDescriptorSet{}
@@ -185,43 +255,21 @@ func runProtoExport(opts *protoExportOptions) error {
 	}
 
 	if len(fdset.File) == 0 {
-		return fmt.Errorf("no proto files could be exported")
+		return nil, fmt.Errorf("no proto files could be exported")
 	}
 
-	// Create exporter with language options
-	exportOpts := hyperwayproto.ExportOptions{
-		IncludeComments: opts.includeComments,
-		SortElements:    opts.sortElements,
-		Indent:          "  ",
-		LanguageOptions: hyperwayproto.LanguageOptions{
-			GoPackage:            opts.goPackage,
-			JavaPackage:          opts.javaPackage,
-			JavaOuterClass:       opts.javaOuterClass,
-			JavaMultipleFiles:    opts.javaMultipleFiles,
-			CSharpNamespace:      opts.csharpNamespace,
-			PhpNamespace:         opts.phpNamespace,
-			PhpMetadataNamespace: opts.phpMetadataNamespace,
-			RubyPackage:          opts.rubyPackage,
-			PythonPackage:        opts.pythonPackage,
-			ObjcClassPrefix:      opts.objcClassPrefix,
-		},
-	}
-	exporter := hyperwayproto.NewExporter(&exportOpts)
-
-	// Export based on format
-	switch opts.format {
-	case "zip":
-		return exportToZip(exporter, fdset, opts.output)
-	case "files":
-		return exportToFiles(exporter, fdset, opts.output)
-	default:
-		return fmt.Errorf("unknown format: %s", opts.format)
-	}
+	return fdset, nil
 }
 
-func exportToZip(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescriptorSet, output string) error {
-	// Export to ZIP
-	zipData, err := exporter.ExportToZip(fdset)
+func exportToZip(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescriptorSet, output string, bufOpts *hyperwayproto.BufOptions) error {
+	// Export to ZIP, as a buf module if requested
+	var zipData []byte
+	var err error
+	if bufOpts != nil {
+		zipData, err = exporter.ExportBufModuleToZip(fdset, *bufOpts)
+	} else {
+		zipData, err = exporter.ExportToZip(fdset)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create ZIP: %w", err)
 	}
@@ -245,9 +293,39 @@ func exportToZip(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescr
 	return nil
 }
 
-func exportToFiles(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescriptorSet, output string) error {
-	// Export all files
-	files, err := exporter.ExportFileDescriptorSet(fdset)
+func exportToDescriptorSet(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescriptorSet, output string) error {
+	data, err := exporter.ExportDescriptorSetBytes(fdset)
+	if err != nil {
+		return fmt.Errorf("failed to create descriptor set: %w", err)
+	}
+
+	// Determine output file
+	outputFile := output
+	if ext := filepath.Ext(outputFile); ext != ".binpb" && ext != ".pb" && ext != ".protoset" {
+		if output == "." {
+			outputFile = "descriptor_set.binpb"
+		} else {
+			outputFile = filepath.Join(output, "descriptor_set.binpb")
+		}
+	}
+
+	if err := os.WriteFile(outputFile, data, filePermission); err != nil {
+		return fmt.Errorf("failed to write descriptor set: %w", err)
+	}
+
+	fmt.Printf("Exported descriptor set (%d bytes) to %s\n", len(data), outputFile)
+	return nil
+}
+
+func exportToFiles(exporter *hyperwayproto.Exporter, fdset *descriptorpb.FileDescriptorSet, output string, bufOpts *hyperwayproto.BufOptions) error {
+	// Export all files, as a buf module if requested
+	var files map[string]string
+	var err error
+	if bufOpts != nil {
+		files, err = exporter.ExportBufModule(fdset, *bufOpts)
+	} else {
+		files, err = exporter.ExportFileDescriptorSet(fdset)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to export files: %w", err)
 	}
@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	hyperwayproto "github.com/i2y/hyperway/proto"
+)
+
+// registryBuf selects the Buf Schema Registry as --registry.
+const registryBuf = "buf"
+
+// registryTokenEnv is the environment variable holding the token of an HTTP registry.
+const registryTokenEnv = "HYPERWAY_REGISTRY_TOKEN"
+
+// registryOptions holds the options shared by the registry commands.
+type registryOptions struct {
+	registry string
+	module   string
+	version  string
+	timeout  time.Duration
+}
+
+// addRegistryFlags adds the registry flags to cmd.
+func addRegistryFlags(cmd *cobra.Command, opts *registryOptions, versionDefault string) {
+	cmd.Flags().StringVarP(&opts.registry, "registry", "r", "", `Registry URL, or "buf" for the Buf Schema Registry (required)`)
+	cmd.Flags().StringVarP(&opts.module, "module", "m", "", "Module name, e.g. acme/users or buf.build/acme/users (required)")
+	cmd.Flags().StringVarP(&opts.version, "version", "v", versionDefault, "Schema version")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Request timeout")
+	_ = cmd.MarkFlagRequired("registry")
+	_ = cmd.MarkFlagRequired("module")
+}
+
+// newRegistry returns the registry selected by opts. The token of HTTP
+// registries is read from HYPERWAY_REGISTRY_TOKEN.
+func (opts *registryOptions) newRegistry() hyperwayproto.Registry {
+	if opts.registry == registryBuf {
+		return &hyperwayproto.BufRegistry{}
+	}
+	return hyperwayproto.NewHTTPRegistry(opts.registry, os.Getenv(registryTokenEnv))
+}
+
+// protoPushOptions holds options for the proto push command.
+type protoPushOptions struct {
+	registryOptions
+	endpoint      string
+	allowBreaking bool
+}
+
+func newProtoPushCommand() *cobra.Command {
+	opts := &protoPushOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "push [flags]",
+		Short: "Publish the schema of a running service to a registry",
+		Long: `Publish the FileDescriptorSet of a running service to a schema registry as a
+new version, after checking it against the latest registered version.
+
+The registry is either the URL of an HTTP registry, which stores versions with
+PUT and GET <registry>/<module>/<version>, or "buf" for the Buf Schema
+Registry through the buf CLI. The token of HTTP registries is read from
+HYPERWAY_REGISTRY_TOKEN.
+
+Examples:
+  # Publish version v1.2.0
+  hyperway proto push --endpoint http://localhost:8080 \
+    --registry https://schemas.example.com --module acme/users --version v1.2.0
+
+  # Publish to the Buf Schema Registry with a label
+  hyperway proto push --registry buf --module buf.build/acme/users --version v1.2.0
+
+  # Publish despite breaking changes
+  hyperway proto push --registry https://schemas.example.com --module acme/users \
+    --version v2.0.0 --allow-breaking`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProtoPush(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "http://localhost:8080", "Service endpoint URL")
+	cmd.Flags().BoolVar(&opts.allowBreaking, "allow-breaking", false, "Publish even if the schema breaks the latest version")
+	addRegistryFlags(cmd, &opts.registryOptions, "")
+	_ = cmd.MarkFlagRequired("version")
+
+	return cmd
+}
+
+func runProtoPush(opts *protoPushOptions) error {
+	fdset, err := fetchDescriptorSet(opts.endpoint, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	changes, err := hyperwayproto.Push(ctx, opts.newRegistry(), opts.module, opts.version, fdset,
+		hyperwayproto.PushOptions{AllowBreaking: opts.allowBreaking})
+	printBreakingChanges(changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pushed %s %s (%d files)\n", opts.module, opts.version, len(fdset.File))
+	return nil
+}
+
+// protoPullOptions holds options for the proto pull command.
+type protoPullOptions struct {
+	registryOptions
+	output string
+	format string
+}
+
+func newProtoPullCommand() *cobra.Command {
+	opts := &protoPullOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pull [flags]",
+		Short: "Download a schema version from a registry",
+		Long: `Download a version of a module from a schema registry as proto files, a ZIP
+archive, or a binary FileDescriptorSet.
+
+Examples:
+  # Download the latest version as proto files
+  hyperway proto pull --registry https://schemas.example.com --module acme/users --output ./protos
+
+  # Download a version as a descriptor set
+  hyperway proto pull --registry https://schemas.example.com --module acme/users \
+    --version v1.2.0 --format binpb --output users.binpb`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProtoPull(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", ".", "Output directory or file (for ZIP and binpb)")
+	cmd.Flags().StringVarP(&opts.format, "format", "f", "files", "Output format: files, zip, or binpb")
+	addRegistryFlags(cmd, &opts.registryOptions, hyperwayproto.LatestVersion)
+
+	return cmd
+}
+
+func runProtoPull(opts *protoPullOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	fdset, err := opts.newRegistry().Pull(ctx, opts.module, opts.version)
+	if err != nil {
+		return err
+	}
+
+	exportOpts := hyperwayproto.DefaultExportOptions()
+	exporter := hyperwayproto.NewExporter(&exportOpts)
+	switch opts.format {
+	case "zip":
+		return exportToZip(exporter, fdset, opts.output, nil)
+	case "files":
+		return exportToFiles(exporter, fdset, opts.output, nil)
+	case "binpb":
+		return exportToDescriptorSet(exporter, fdset, opts.output)
+	default:
+		return fmt.Errorf("unknown format: %s", opts.format)
+	}
+}
+
+// protoCheckOptions holds options for the proto check command.
+type protoCheckOptions struct {
+	registryOptions
+	endpoint string
+}
+
+func newProtoCheckCommand() *cobra.Command {
+	opts := &protoCheckOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "check [flags]",
+		Short: "Check the schema of a running service against a registry",
+		Long: `Pull a version of a module from a schema registry and report the changes of a
+running service that break its clients: removed services, methods, messages,
+fields, and enum values, and changed types, cardinalities, and names. The
+command exits with an error if there are any.
+
+Examples:
+  # Check against the latest version
+  hyperway proto check --endpoint http://localhost:8080 \
+    --registry https://schemas.example.com --module acme/users`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProtoCheck(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.endpoint, "endpoint", "e", "http://localhost:8080", "Service endpoint URL")
+	addRegistryFlags(cmd, &opts.registryOptions, hyperwayproto.LatestVersion)
+
+	return cmd
+}
+
+func runProtoCheck(opts *protoCheckOptions) error {
+	fdset, err := fetchDescriptorSet(opts.endpoint, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	registered, err := opts.newRegistry().Pull(ctx, opts.module, opts.version)
+	if errors.Is(err, hyperwayproto.ErrSchemaNotFound) {
+		fmt.Printf("No registered version of %s to check against\n", opts.module)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	changes := hyperwayproto.CheckCompatibility(registered, fdset)
+	printBreakingChanges(changes)
+	if len(changes) > 0 {
+		return fmt.Errorf("%w: %d changes against %s %s", hyperwayproto.ErrBreakingChanges, len(changes), opts.module, opts.version)
+	}
+	fmt.Printf("Compatible with %s %s\n", opts.module, opts.version)
+	return nil
+}
+
+// fetchDescriptorSet fetches the file descriptors of a running service as a
+// self-contained descriptor set.
+func fetchDescriptorSet(endpoint string, timeout time.Duration) (*descriptorpb.FileDescriptorSet, error) {
+	fdset, err := fetchFileDescriptors(endpoint, timeout)
+	if err != nil {
+		return nil, err
+	}
+	exportOpts := hyperwayproto.DefaultExportOptions()
+	return hyperwayproto.NewExporter(&exportOpts).ExportDescriptorSet(fdset)
+}
+
+// printBreakingChanges lists breaking changes on stderr.
+func printBreakingChanges(changes []hyperwayproto.BreakingChange) {
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "Breaking: %s\n", change)
+	}
+}
@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http2"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// Replay constants
+const (
+	maxReportedFailures = 10
+	percentile50        = 50
+	percentile90        = 90
+	percentile99        = 99
+	percentDenominator  = 100
+)
+
+// replayOptions holds options for the replay command.
+type replayOptions struct {
+	target      string
+	concurrency int
+	rate        float64
+	repeat      int
+	compare     bool
+	compareBody bool
+	headers     []string
+	timeout     time.Duration
+}
+
+// NewReplayCommand creates the replay command.
+func NewReplayCommand() *cobra.Command {
+	opts := &replayOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "replay <capture-file> [flags]",
+		Short: "Replay captured traffic against an endpoint",
+		Long: `Re-send the requests of a capture file, recorded by a gateway with
+gateway.Options.Capture, to another endpoint for regression and load testing,
+and report the latency of the responses.
+
+With --compare, the HTTP status and grpc-status of each response must match
+the captured one, and with --compare-body its body as well; the command exits
+with an error on mismatches. Redacted headers are sent as "[REDACTED]", so pass
+credentials with --header. Records with dropped bodies are skipped.
+
+Examples:
+  # Check a new version against production traffic
+  hyperway replay traffic.jsonl --target http://localhost:9090 --compare
+
+  # Load test with 32 concurrent clients at 500 requests per second
+  hyperway replay traffic.jsonl --target http://staging:8080 --concurrency 32 --rate 500 --repeat 10
+
+  # Replace redacted credentials
+  hyperway replay traffic.jsonl --target https://staging.example.com --header "Authorization: Bearer $TOKEN"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReplay(cmd.Context(), args[0], opts, cmd.OutOrStdout())
+		},
+	}
+
+	// Add flags
+	cmd.Flags().StringVarP(&opts.target, "target", "t", "", "Base URL of the endpoint to replay against")
+	cmd.Flags().IntVarP(&opts.concurrency, "concurrency", "n", 1, "Number of requests in flight")
+	cmd.Flags().Float64Var(&opts.rate, "rate", 0, "Requests per second (0: as fast as possible)")
+	cmd.Flags().IntVar(&opts.repeat, "repeat", 1, "Number of times the capture is replayed")
+	cmd.Flags().BoolVar(&opts.compare, "compare", false, "Compare the status of responses with the captured ones")
+	cmd.Flags().BoolVar(&opts.compareBody, "compare-body", false, "Compare the bodies of responses too (implies --compare)")
+	cmd.Flags().StringArrayVarP(&opts.headers, "header", "H", nil, "Header to set on requests, \"Key: Value\" (repeatable)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "Timeout of each request")
+	_ = cmd.MarkFlagRequired("target")
+
+	return cmd
+}
+
+func runReplay(ctx context.Context, path string, opts *replayOptions, out io.Writer) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f, err := os.Open(path) //nolint:gosec // path is chosen by the user
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	records, err := gateway.ReadCaptureRecords(f)
+	if err != nil {
+		return err
+	}
+
+	report, err := replay(ctx, records, opts)
+	if err != nil {
+		return err
+	}
+	report.write(out, opts.target)
+	if report.errors > 0 || report.mismatches > 0 {
+		return fmt.Errorf("replay found %d errors and %d mismatches", report.errors, report.mismatches)
+	}
+	return nil
+}
+
+// replayReport summarizes a replay.
+type replayReport struct {
+	sent       int
+	skipped    int
+	errors     int
+	mismatches int
+	failures   []string // Descriptions of the errors and mismatches
+	latencies  []time.Duration
+	elapsed    time.Duration
+}
+
+// replay sends the complete records to opts.target.
+func replay(ctx context.Context, records []*gateway.CaptureRecord, opts *replayOptions) (*replayReport, error) {
+	header, err := parseReplayHeaders(opts.headers)
+	if err != nil {
+		return nil, err
+	}
+	client := newReplayClient(opts.target)
+	defer client.CloseIdleConnections()
+
+	report := &replayReport{}
+	var replayed []*gateway.CaptureRecord
+	for _, record := range records {
+		if record.Incomplete {
+			report.skipped++
+			continue
+		}
+		replayed = append(replayed, record)
+	}
+
+	jobs := make(chan *gateway.CaptureRecord)
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		if opts.rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for range max(opts.repeat, 1) {
+			for _, record := range replayed {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case jobs <- record:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range max(opts.concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range jobs {
+				latency, mismatch, err := replayRecord(ctx, client, record, header, opts)
+				mu.Lock()
+				report.sent++
+				switch {
+				case err != nil:
+					report.errors++
+					report.failures = append(report.failures, fmt.Sprintf("%s %s: %v", record.Method, record.Path, err))
+				case mismatch != "":
+					report.mismatches++
+					report.failures = append(report.failures, fmt.Sprintf("%s %s: %s", record.Method, record.Path, mismatch))
+				}
+				report.latencies = append(report.latencies, latency)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	report.elapsed = time.Since(start)
+	return report, ctx.Err()
+}
+
+// replayRecord sends a record and compares the response with the captured one.
+func replayRecord(ctx context.Context, client *http.Client, record *gateway.CaptureRecord, header http.Header, opts *replayOptions) (time.Duration, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	req, err := record.NewRequest(ctx, opts.target)
+	if err != nil {
+		return 0, "", err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Since(start), "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, "", err
+	}
+
+	if !opts.compare && !opts.compareBody {
+		return latency, "", nil
+	}
+	want := fmt.Sprintf("status %d grpc-status %q", record.Status, grpcStatus(record.ResponseHeader, record.ResponseTrailer))
+	got := fmt.Sprintf("status %d grpc-status %q", resp.StatusCode, grpcStatus(resp.Header, resp.Trailer))
+	if got != want {
+		return latency, fmt.Sprintf("got %s, expected %s", got, want), nil
+	}
+	if opts.compareBody && !bytes.Equal(body, record.ResponseBody) {
+		return latency, fmt.Sprintf("got a %d-byte body different from the captured %d bytes", len(body), len(record.ResponseBody)), nil
+	}
+	return latency, "", nil
+}
+
+// grpcStatus returns the grpc-status of a response, sent as a trailer or, in
+// trailers-only responses, as a header.
+func grpcStatus(header, trailer http.Header) string {
+	if status := trailer.Get("Grpc-Status"); status != "" {
+		return status
+	}
+	return header.Get("Grpc-Status")
+}
+
+// newReplayClient creates a client speaking HTTP/2, without TLS for http://
+// targets as the gRPC protocol requires.
+func newReplayClient(target string) *http.Client {
+	if strings.HasPrefix(target, "https://") {
+		return &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true}}
+	}
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// parseReplayHeaders parses "Key: Value" headers.
+func parseReplayHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, errors.New("invalid header, expected \"Key: Value\": " + value)
+		}
+		header.Add(strings.TrimSpace(key), strings.TrimSpace(val))
+	}
+	return header, nil
+}
+
+// write prints the summary of a replay.
+func (r *replayReport) write(w io.Writer, target string) {
+	rate := 0.0
+	if r.elapsed > 0 {
+		rate = float64(r.sent) / r.elapsed.Seconds()
+	}
+	_, _ = fmt.Fprintf(w, "Replayed %d requests to %s in %s (%.1f req/s)\n", r.sent, target, r.elapsed.Round(time.Millisecond), rate)
+	if r.skipped > 0 {
+		_, _ = fmt.Fprintf(w, "Skipped %d incomplete records\n", r.skipped)
+	}
+	if len(r.latencies) > 0 {
+		slices.Sort(r.latencies)
+		_, _ = fmt.Fprintf(w, "Latency: p50 %s, p90 %s, p99 %s, max %s\n",
+			r.percentile(percentile50), r.percentile(percentile90), r.percentile(percentile99), r.latencies[len(r.latencies)-1])
+	}
+	_, _ = fmt.Fprintf(w, "Errors: %d, mismatches: %d\n", r.errors, r.mismatches)
+	for i, failure := range r.failures {
+		if i == maxReportedFailures {
+			_, _ = fmt.Fprintf(w, "  ... and %d more\n", len(r.failures)-i)
+			break
+		}
+		_, _ = fmt.Fprintf(w, "  %s\n", failure)
+	}
+}
+
+// percentile returns a percentile of the sorted latencies.
+func (r *replayReport) percentile(p int) time.Duration {
+	return r.latencies[(len(r.latencies)-1)*p/percentDenominator]
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+func TestReplay(t *testing.T) {
+	// Capture two calls of a service echoing its requests
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	file, err := gateway.NewCaptureFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	gw, err := gateway.New([]*gateway.Service{{
+		Name:     "EchoService",
+		Package:  "test.v1",
+		Handlers: map[string]http.Handler{"/test.v1.EchoService/Echo": echo},
+	}}, gateway.Options{Capture: &gateway.CaptureConfig{Sink: file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"name":"same"}`, `{"name":"changed"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/test.v1.EchoService/Echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer production")
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new version fails the second call
+	var calls atomic.Int32
+	target := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer staging" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "changed") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(body)
+	}), &http2.Server{}))
+	defer target.Close()
+
+	opts := &replayOptions{target: target.URL, concurrency: 2, repeat: 2, compare: true, timeout: defaultTimeout, headers: []string{"Authorization: Bearer staging"}}
+	var out bytes.Buffer
+	err = runReplay(t.Context(), path, opts, &out)
+	if err == nil || !strings.Contains(err.Error(), "2 mismatches") {
+		t.Errorf("Expected the changed call to mismatch, got %v", err)
+	}
+	if calls.Load() != 4 || !strings.Contains(out.String(), "Replayed 4 requests") ||
+		!strings.Contains(out.String(), "got status 500") {
+		t.Errorf("Unexpected report after %d calls:\n%s", calls.Load(), out.String())
+	}
+
+	opts = &replayOptions{target: target.URL, rate: 1000, timeout: defaultTimeout, headers: []string{"Authorization: Bearer staging"}}
+	if err := runReplay(t.Context(), path, opts, io.Discard); err != nil {
+		t.Errorf("Expected a replay without comparison to succeed, got %v", err)
+	}
+}
@@ -2,30 +2,36 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
 )
 
 // Constants
 const (
-	defaultPort             = 8080
-	defaultKeepaliveTime    = 30 * time.Second
-	defaultKeepaliveTimeout = 15 * time.Second
-	defaultMaxPingStrikes   = 2
-	defaultKeepaliveMinTime = 60 * time.Second
+	defaultPort           = 8080
+	defaultKeepaliveTime  = 30 * time.Second
+	defaultMaxPingStrikes = 2
 )
 
 // serveOptions holds options for the serve command.
 type serveOptions struct {
 	port             int
 	host             string
+	listen           string
 	configFile       string
+	descriptors      []string
+	backends         []string
 	enableReflection bool
 	enableOpenAPI    bool
 	enableMetrics    bool
@@ -44,6 +50,23 @@ func NewServeCommand() *cobra.Command {
 This command starts an HTTP server that can handle gRPC, Connect, and REST protocols
 simultaneously.
 
+With --descriptor, it serves the services of FileDescriptorSets (protoc
+--descriptor_set_out or buf build -o) without Go code, routing their unary
+methods to backends with --backend pattern=target. Patterns are
+"pkg.Service/Method", "pkg.Service/*", or "*", the most specific one matching.
+Targets are:
+
+  http(s)://host/prefix  POST the request as JSON to prefix/pkg.Service/Method
+  exec:command args      run the command with the request as JSON on stdin and
+                         the procedure in HYPERWAY_PROCEDURE; it writes the
+                         response as JSON on stdout
+  plugin:handlers.so     call the Handle function of a Go plugin, a
+                         func(ctx context.Context, procedure string, req []byte) ([]byte, error)
+                         with JSON messages
+
+Backends fail calls with a {"code": "not_found", "message": "..."} response,
+with a non-2xx status or exit code.
+
 Examples:
   # Start server on default port
   hyperway serve
@@ -51,6 +74,17 @@ Examples:
   # Start server on specific port
   hyperway serve --port 9090
 
+  # Listen on a unix socket, e.g. for a sidecar
+  hyperway serve --listen unix:///run/hyperway.sock
+
+  # Serve the socket passed by systemd socket activation
+  hyperway serve --listen systemd://
+
+  # Serve a schema, forwarding calls to an HTTP service and a script
+  hyperway serve --descriptor api.binpb \
+    --backend 'user.v1.UserService/*=http://localhost:3000' \
+    --backend 'user.v1.UserService/DeleteUser=exec:./delete-user.sh'
+
   # Start with configuration file
   hyperway serve --config server.yaml
 
@@ -64,7 +98,10 @@ Examples:
 	// Add flags
 	cmd.Flags().IntVarP(&opts.port, "port", "p", defaultPort, "Server port")
 	cmd.Flags().StringVar(&opts.host, "host", "0.0.0.0", "Server host")
+	cmd.Flags().StringVar(&opts.listen, "listen", "", "Listen address: host:port, unix:///path, or systemd://[name] (overrides --host and --port)")
 	cmd.Flags().StringVarP(&opts.configFile, "config", "c", "", "Configuration file path")
+	cmd.Flags().StringArrayVarP(&opts.descriptors, "descriptor", "d", nil, "FileDescriptorSet of the services to serve (repeatable)")
+	cmd.Flags().StringArrayVarP(&opts.backends, "backend", "b", nil, "Backend of methods, pattern=target (repeatable)")
 	cmd.Flags().BoolVar(&opts.enableReflection, "reflection", true, "Enable gRPC reflection")
 	cmd.Flags().BoolVar(&opts.enableOpenAPI, "openapi", true, "Enable OpenAPI endpoint")
 	cmd.Flags().BoolVar(&opts.enableMetrics, "metrics", false, "Enable metrics endpoint")
@@ -74,16 +111,7 @@ Examples:
 }
 
 func runServe(opts *serveOptions) error {
-	// TODO: Implement actual server startup
-	// This would require:
-	// 1. Loading configuration
-	// 2. Setting up services
-	// 3. Configuring middleware
-	// 4. Starting HTTP server
-
 	fmt.Printf("Starting hyperway server...\n")
-	fmt.Printf("Host: %s\n", opts.host)
-	fmt.Printf("Port: %d\n", opts.port)
 	fmt.Printf("Reflection: %v\n", opts.enableReflection)
 	fmt.Printf("OpenAPI: %v\n", opts.enableOpenAPI)
 	fmt.Printf("Metrics: %v\n", opts.enableMetrics)
@@ -92,7 +120,31 @@ func runServe(opts *serveOptions) error {
 		fmt.Printf("Config file: %s\n", opts.configFile)
 	}
 
-	// For now, just create a simple HTTP server
+	handler, err := newServeHandler(opts, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	addr := opts.listen
+	if addr == "" {
+		addr = net.JoinHostPort(opts.host, strconv.Itoa(opts.port))
+	}
+	fmt.Printf("\nServer listening on %s\n", addr)
+
+	// Serves until interrupted, then waits for requests in flight
+	if err := rpc.Run(context.Background(), addr, handler, rpc.WithShutdownTimeout(opts.gracefulTimeout)); err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+
+	fmt.Println("Server stopped")
+	return nil
+}
+
+// newServeHandler creates the handler of the serve command: the gateway of
+// the services of the descriptor sets, and the health and metrics endpoints.
+// Routing is reported on out, and exec backends write their errors to
+// stderr.
+func newServeHandler(opts *serveOptions, out, stderr io.Writer) (http.Handler, error) {
 	mux := http.NewServeMux()
 
 	// Add a health check endpoint
@@ -101,14 +153,6 @@ func runServe(opts *serveOptions) error {
 		_, _ = fmt.Fprintln(w, "OK")
 	})
 
-	// Add placeholder endpoints
-	if opts.enableOpenAPI {
-		mux.HandleFunc("/openapi", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = fmt.Fprintln(w, `{"info":{"title":"Hyperway API","version":"1.0.0"}}`)
-		})
-	}
-
 	if opts.enableMetrics {
 		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/plain")
@@ -118,40 +162,74 @@ func runServe(opts *serveOptions) error {
 		})
 	}
 
-	// Create server
-	addr := fmt.Sprintf("%s:%d", opts.host, opts.port)
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      mux,
-		ReadTimeout:  defaultKeepaliveTimeout,
-		WriteTimeout: defaultKeepaliveTimeout,
-		IdleTimeout:  defaultKeepaliveMinTime,
-	}
-
-	// Start server in goroutine
-	go func() {
-		fmt.Printf("\nServer listening on %s\n", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
-			os.Exit(1)
+	if len(opts.descriptors) == 0 {
+		if len(opts.backends) > 0 {
+			return nil, errors.New("backends require services: pass a FileDescriptorSet with --descriptor")
 		}
-	}()
-
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-
-	fmt.Println("\nShutting down server...")
-
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), opts.gracefulTimeout)
-	defer cancel()
+		return mux, nil
+	}
+	services, err := newDescriptorServices(opts, out, stderr)
+	if err != nil {
+		return nil, err
+	}
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{
+		EnableReflection: opts.enableReflection,
+		EnableOpenAPI:    opts.enableOpenAPI,
+		OpenAPIPath:      "/openapi.json",
+		CORSConfig:       gateway.DefaultCORSConfig(),
+	}, services...)
+	if err != nil {
+		return nil, err
+	}
+	mux.Handle("/", gw)
+	return mux, nil
+}
 
-	if err := server.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server forced to shutdown: %w", err)
+// newDescriptorServices creates the services of the descriptor sets, with
+// their unary methods handled by their backends. Methods without a backend,
+// and streaming methods, are unimplemented.
+func newDescriptorServices(opts *serveOptions, out, stderr io.Writer) ([]*rpc.Service, error) {
+	files, fdset, err := loadDescriptorSets(opts.descriptors)
+	if err != nil {
+		return nil, err
+	}
+	types, err := gateway.NewTypeRegistry(fdset)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := parseBackendRoutes(opts.backends, stderr)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("Server stopped")
-	return nil
+	var services []*rpc.Service
+	for _, file := range fdset.GetFile() {
+		fd, err := files.FindFileByPath(file.GetName())
+		if err != nil {
+			return nil, err
+		}
+		for i := range fd.Services().Len() {
+			sd := fd.Services().Get(i)
+			svc := rpc.NewServiceFromDescriptor(sd)
+			for j := range sd.Methods().Len() {
+				md := sd.Methods().Get(j)
+				b, ok := routes.lookup(md)
+				switch {
+				case md.IsStreamingClient() || md.IsStreamingServer():
+					_, _ = fmt.Fprintf(out, "  %s: streaming, unimplemented\n", md.FullName())
+				case !ok:
+					_, _ = fmt.Fprintf(out, "  %s: no backend, unimplemented\n", md.FullName())
+				default:
+					if err := rpc.RegisterDynamic(svc, string(md.Name()), dynamicHandler(b, md, types)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return nil, errors.New("the descriptor sets define no services")
+	}
+	return services, nil
 }
@@ -0,0 +1,311 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/internal/grpcutil"
+	"github.com/i2y/hyperway/rpc"
+)
+
+// Backend targets
+const (
+	execPrefix      = "exec:"
+	pluginPrefix    = "plugin:"
+	pluginSymbol    = "Handle"
+	procedureEnv    = "HYPERWAY_PROCEDURE"
+	maxBackendReply = 32 << 20 // Bytes of a backend response
+	routeWildcard   = "*"
+)
+
+// backend handles the calls of the methods routed to it. Requests and
+// responses are protobuf JSON, errors are rpc errors.
+type backend interface {
+	call(ctx context.Context, procedure string, req []byte) ([]byte, error)
+}
+
+// pluginHandler is the type of the Handle function of Go plugins.
+type pluginHandler = func(ctx context.Context, procedure string, req []byte) ([]byte, error)
+
+// backendError is the JSON of errors returned by HTTP and exec backends, as
+// in Connect: {"code": "not_found", "message": "..."}.
+type backendError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// httpBackend forwards calls as JSON POST requests to the procedure path of
+// its base URL.
+type httpBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+// forwardedHeader reports whether an incoming header is forwarded to HTTP
+// backends: protocol and hop-by-hop headers are not.
+func forwardedHeader(key string) bool {
+	key = strings.ToLower(key)
+	switch {
+	case strings.HasPrefix(key, "grpc-"), strings.HasPrefix(key, "connect-"):
+		return false
+	}
+	switch key {
+	case "content-type", "content-length", "content-encoding", "accept-encoding",
+		"connection", "te", "trailer", "transfer-encoding", "upgrade", "host":
+		return false
+	}
+	return true
+}
+
+func (b *httpBackend) call(ctx context.Context, procedure string, req []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(b.baseURL, "/")+procedure, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range rpc.Meta(ctx).Incoming() {
+		if forwardedHeader(key) {
+			for _, value := range values {
+				httpReq.Header.Add(key, value)
+			}
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return nil, rpc.NewErrorf(rpc.CodeUnavailable, "backend unavailable: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBackendReply))
+	if err != nil {
+		return nil, rpc.NewErrorf(rpc.CodeUnavailable, "failed to read backend response: %v", err)
+	}
+	if resp.StatusCode/100 != 2 { //nolint:mnd // 2xx
+		if err := parseBackendError(body); err != nil {
+			return nil, err
+		}
+		return nil, rpc.NewErrorf(rpc.Code(grpcutil.CodeForHTTPStatus(resp.StatusCode)), "backend returned %s", resp.Status)
+	}
+	return body, nil
+}
+
+// execBackend runs a command for each call, with the request on its standard
+// input and the procedure in HYPERWAY_PROCEDURE. It writes the response on
+// its standard output and exits with 0, or writes an error and fails.
+type execBackend struct {
+	args   []string
+	stderr io.Writer
+}
+
+func (b *execBackend) call(ctx context.Context, procedure string, req []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, b.args[0], b.args[1:]...) //nolint:gosec // Commands are configured by the operator
+	cmd.Env = append(os.Environ(), procedureEnv+"="+procedure)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stderr = b.stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, rpc.NewErrorf(rpc.CodeDeadlineExceeded, "handler interrupted: %v", ctx.Err())
+		}
+		if err := parseBackendError(stdout.Bytes()); err != nil {
+			return nil, err
+		}
+		return nil, rpc.NewErrorf(rpc.CodeInternal, "handler failed: %v", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// pluginBackend calls the Handle function of a Go plugin, built with
+// go build -buildmode=plugin against the same hyperway version.
+type pluginBackend struct {
+	handle pluginHandler
+}
+
+func (b *pluginBackend) call(ctx context.Context, procedure string, req []byte) ([]byte, error) {
+	return b.handle(ctx, procedure, req)
+}
+
+// parseBackendError returns the error of a backend response, or nil if it
+// carries none. Codes that are not error codes of the spec become unknown.
+func parseBackendError(body []byte) error {
+	var e backendError
+	if json.Unmarshal(body, &e) != nil || e.Code == "" {
+		return nil
+	}
+	// Known codes map to themselves through their gRPC status, others to unknown
+	code := rpc.Code(grpcutil.CodeForGRPCStatus(grpcutil.GRPCStatus(e.Code)))
+	return rpc.NewError(code, e.Message)
+}
+
+// newBackend creates the backend of a target: an http(s):// URL,
+// "exec:command args...", or "plugin:path.so".
+func newBackend(target string, stderr io.Writer) (backend, error) {
+	switch {
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return &httpBackend{baseURL: target, client: &http.Client{}}, nil
+	case strings.HasPrefix(target, execPrefix):
+		args := strings.Fields(strings.TrimPrefix(target, execPrefix))
+		if len(args) == 0 {
+			return nil, errors.New("exec backend without a command")
+		}
+		return &execBackend{args: args, stderr: stderr}, nil
+	case strings.HasPrefix(target, pluginPrefix):
+		path := strings.TrimPrefix(target, pluginPrefix)
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open plugin: %w", err)
+		}
+		sym, err := p.Lookup(pluginSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", path, err)
+		}
+		handle, ok := sym.(pluginHandler)
+		if !ok {
+			if ptr, isPtr := sym.(*pluginHandler); isPtr {
+				handle, ok = *ptr, true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s is a %T, not a %T", path, pluginSymbol, sym, pluginHandler(nil))
+		}
+		return &pluginBackend{handle: handle}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q: expected an http(s):// URL, exec:command, or plugin:path", target)
+	}
+}
+
+// backendRoutes maps methods to backends by patterns: "pkg.Service/Method",
+// "pkg.Service/*", or "*", the most specific one matching.
+type backendRoutes map[string]backend
+
+// parseBackendRoutes parses rules of the form pattern=target.
+func parseBackendRoutes(rules []string, stderr io.Writer) (backendRoutes, error) {
+	routes := make(backendRoutes)
+	for _, rule := range rules {
+		pattern, target, ok := strings.Cut(rule, "=")
+		if !ok || pattern == "" || target == "" {
+			return nil, fmt.Errorf("invalid backend %q: expected pattern=target", rule)
+		}
+		if _, exists := routes[pattern]; exists {
+			return nil, fmt.Errorf("backend for %s is set twice", pattern)
+		}
+		b, err := newBackend(target, stderr)
+		if err != nil {
+			return nil, err
+		}
+		routes[pattern] = b
+	}
+	return routes, nil
+}
+
+// lookup returns the backend of a method.
+func (r backendRoutes) lookup(md protoreflect.MethodDescriptor) (backend, bool) {
+	service := string(md.Parent().FullName())
+	for _, pattern := range []string{service + "/" + string(md.Name()), service + "/" + routeWildcard, routeWildcard} {
+		if b, ok := r[pattern]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// dynamicHandler handles the calls of md with b, converting messages to and
+// from JSON with types resolved by types.
+func dynamicHandler(b backend, md protoreflect.MethodDescriptor, types *gateway.TypeRegistry) rpc.DynamicHandler {
+	procedure := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	marshal := protojson.MarshalOptions{Resolver: types}
+	unmarshal := protojson.UnmarshalOptions{Resolver: types, DiscardUnknown: true}
+	return func(ctx context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error) {
+		data, err := marshal.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		out, err := b.call(ctx, procedure, data)
+		if err != nil {
+			return nil, err
+		}
+		resp := dynamicpb.NewMessage(md.Output())
+		if len(bytes.TrimSpace(out)) == 0 {
+			return resp, nil
+		}
+		if err := unmarshal.Unmarshal(out, resp); err != nil {
+			return nil, rpc.NewErrorf(rpc.CodeInternal, "backend returned an invalid %s: %v", md.Output().FullName(), err)
+		}
+		return resp, nil
+	}
+}
+
+// loadDescriptorSets reads FileDescriptorSets, as written by
+// protoc --descriptor_set_out or buf build -o. Well-known types may be left
+// out of them.
+func loadDescriptorSets(paths []string) (*protoregistry.Files, *descriptorpb.FileDescriptorSet, error) {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path) //nolint:gosec // Paths are given by the operator
+		if err != nil {
+			return nil, nil, err
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(data, set); err != nil {
+			return nil, nil, fmt.Errorf("%s is not a FileDescriptorSet: %w", path, err)
+		}
+		for _, file := range set.GetFile() {
+			if !seen[file.GetName()] {
+				seen[file.GetName()] = true
+				fdset.File = append(fdset.File, file)
+			}
+		}
+	}
+
+	files := &protoregistry.Files{}
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if strings.HasPrefix(fd.Path(), "google/protobuf/") && !seen[fd.Path()] {
+			_ = files.RegisterFile(fd)
+		}
+		return true
+	})
+
+	// Register files once their imports are, whatever their order
+	pending := fdset.GetFile()
+	for len(pending) > 0 {
+		var next []*descriptorpb.FileDescriptorProto
+		var lastErr error
+		for _, file := range pending {
+			fd, err := protodesc.NewFile(file, files)
+			if err != nil {
+				next = append(next, file)
+				lastErr = fmt.Errorf("invalid descriptor %s: %w", file.GetName(), err)
+				continue
+			}
+			if err := files.RegisterFile(fd); err != nil {
+				return nil, nil, fmt.Errorf("failed to register file %s: %w", fd.Path(), err)
+			}
+		}
+		if len(next) == len(pending) {
+			return nil, nil, lastErr
+		}
+		pending = next
+	}
+	return files, fdset, nil
+}
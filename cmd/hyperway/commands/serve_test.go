@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// writeGreeterDescriptors writes the FileDescriptorSet of a greeter service
+// with a unary method per backend and a streaming method.
+func writeGreeterDescriptors(t *testing.T) string {
+	t.Helper()
+	stringField := func(name string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), Number: proto.Int32(1), JsonName: proto.String(name),
+			Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+	method := func(name string, streaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".greet.v1.GreetRequest"),
+			OutputType:      proto.String(".greet.v1.GreetResponse"),
+			ServerStreaming: proto.Bool(streaming),
+		}
+	}
+	fdset := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("greet/v1/greet.proto"),
+		Package: proto.String("greet.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GreetRequest"), Field: []*descriptorpb.FieldDescriptorProto{stringField("name")}},
+			{Name: proto.String("GreetResponse"), Field: []*descriptorpb.FieldDescriptorProto{stringField("greeting")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("GreetService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Greet", false), method("Script", false), method("Missing", false), method("Watch", true),
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(fdset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "greet.binpb")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServeDescriptors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"code":"invalid_argument","message":"name is required"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"greeting":"Hello, `+req.Name+` from `+r.URL.Path+` as `+r.Header.Get("Authorization")+`"}`)
+	}))
+	t.Cleanup(upstream.Close)
+
+	backends := []string{"greet.v1.GreetService/*=" + upstream.URL + "/api"}
+	if runtime.GOOS != "windows" {
+		script := filepath.Join(t.TempDir(), "script.sh")
+		body := "#!/bin/sh\ncat > /dev/null\necho '{\"greeting\":\"Hello from '\"$HYPERWAY_PROCEDURE\"'\"}'\n"
+		if err := os.WriteFile(script, []byte(body), 0o700); err != nil { //nolint:gosec // The script must be executable
+			t.Fatal(err)
+		}
+		backends = append(backends, "greet.v1.GreetService/Script=exec:"+script)
+	}
+
+	var out bytes.Buffer
+	handler, err := newServeHandler(&serveOptions{
+		descriptors:   []string{writeGreeterDescriptors(t)},
+		backends:      backends,
+		enableOpenAPI: true,
+	}, &out, io.Discard)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	call := func(method, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/greet.v1.GreetService/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("forwards calls to HTTP backends", func(t *testing.T) {
+		_, body := call("Greet", `{"name":"ann"}`)
+		if want := `"greeting":"Hello, ann from /api/greet.v1.GreetService/Greet as Bearer token"`; !strings.Contains(body, want) {
+			t.Errorf("Expected %s, got %s", want, body)
+		}
+		if code, body := call("Greet", `{}`); code != http.StatusBadRequest || !strings.Contains(body, "name is required") {
+			t.Errorf("Expected the backend error, got %d: %s", code, body)
+		}
+	})
+
+	t.Run("runs exec backends", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Requires sh")
+		}
+		if _, body := call("Script", `{"name":"ann"}`); !strings.Contains(body, `"greeting":"Hello from /greet.v1.GreetService/Script"`) {
+			t.Errorf("Expected the script's response, got %s", body)
+		}
+	})
+
+	t.Run("leaves other methods unimplemented", func(t *testing.T) {
+		if !strings.Contains(out.String(), "greet.v1.GreetService.Watch: streaming, unimplemented") {
+			t.Errorf("Expected the streaming method to be reported, got %s", out.String())
+		}
+		if _, body := call("Watch", `{}`); strings.Contains(body, "greeting") {
+			t.Errorf("Expected the streaming method to be unimplemented, got %s", body)
+		}
+	})
+
+	t.Run("serves the schema", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if !strings.Contains(rec.Body.String(), "GreetRequest") {
+			t.Errorf("Expected an OpenAPI document of the service, got %s", rec.Body)
+		}
+	})
+
+	t.Run("rejects invalid backends", func(t *testing.T) {
+		for _, backend := range []string{"greet.v1.GreetService/*", "*=ftp://example.com", "*=exec:", "*=plugin:missing.so"} {
+			if _, err := newServeHandler(&serveOptions{
+				descriptors: []string{writeGreeterDescriptors(t)},
+				backends:    []string{backend},
+			}, io.Discard, io.Discard); err == nil {
+				t.Errorf("Expected %q to be rejected", backend)
+			}
+		}
+	})
+}
+
+func TestParseBackendError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want rpc.Code
+	}{
+		{"known code", `{"code":"not_found","message":"no such user"}`, rpc.CodeNotFound},
+		{"unknown code", `{"code":"teapot","message":"short and stout"}`, rpc.CodeUnknown},
+		{"no code", `{"greeting":"hi"}`, ""},
+		{"not JSON", `oops`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseBackendError([]byte(tt.body))
+			var rpcErr *rpc.Error
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case tt.want != "" && (!errors.As(err, &rpcErr) || rpcErr.Code != tt.want):
+				t.Errorf("Expected a %s error, got %v", tt.want, err)
+			}
+		})
+	}
+}
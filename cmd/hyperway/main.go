@@ -24,16 +24,20 @@ func main() {
 		Long: `Hyperway is a Go RPC library that eliminates the need for manual .proto files 
 by generating Protobuf schemas dynamically at runtime from Go structs.
 
-It provides tools for exporting proto files, generating schemas, and managing services.`,
+It provides tools for exporting proto files, generating schemas and mocks, and managing services.`,
 		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, buildDate),
 	}
 
 	// Add commands
 	rootCmd.AddCommand(
 		commands.NewProtoCommand(),
+		commands.NewGenCommand(),
+		commands.NewCompatCommand(),
+		commands.NewConformanceCommand(),
+		commands.NewReplayCommand(),
+		commands.NewDoctorCommand(),
 		commands.NewVersionCommand(version, commit, buildDate),
-		// TODO: Implement serve command
-		// commands.NewServeCommand(),
+		commands.NewServeCommand(),
 	)
 
 	// Execute
@@ -0,0 +1,97 @@
+package codec
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"buf.build/go/hyperpb"
+)
+
+// arenaContextKey stores the Arena of a request.
+type arenaContextKey struct{}
+
+// sharedPool reuses the hyperpb arenas of messages decoded into an Arena.
+var sharedPool = sync.Pool{
+	New: func() any {
+		return new(hyperpb.Shared)
+	},
+}
+
+// Arena amortizes the allocations of all hyperpb messages decoded during a
+// request, such as the messages of a client stream. Each message takes pooled
+// memory that is released together with the others by Release.
+//
+// An Arena is not safe for concurrent use, except for Retain.
+type Arena struct {
+	shared   []*hyperpb.Shared
+	retained atomic.Bool
+	released bool
+}
+
+// NewArena returns an empty arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Retain keeps the memory of the arena alive after Release, for when a
+// handler retains references to decoded messages or their strings and bytes.
+// The memory is then left to the garbage collector instead of being reused.
+// Retain may be called from any goroutine, but only calls made before
+// Release take effect.
+func (a *Arena) Retain() {
+	a.retained.Store(true)
+}
+
+// Release frees the messages decoded into the arena for reuse, unless Retain
+// was called. Neither the messages nor values read from them may be used
+// afterwards. Messages decoded after Release are not pooled.
+func (a *Arena) Release() {
+	if a.released {
+		return
+	}
+	a.released = true
+	if !a.retained.Load() {
+		for _, shared := range a.shared {
+			shared.Free()
+			sharedPool.Put(shared)
+		}
+	}
+	clear(a.shared)
+	a.shared = a.shared[:0]
+}
+
+// Reset makes a released arena ready for the messages of another request,
+// keeping its capacity, so that arenas can be reused.
+func (a *Arena) Reset() {
+	a.Release()
+	a.retained.Store(false)
+	a.released = false
+}
+
+// newShared returns memory for a new message, owned by the arena.
+func (a *Arena) newShared() *hyperpb.Shared {
+	if a.released {
+		return new(hyperpb.Shared)
+	}
+	shared := sharedPool.Get().(*hyperpb.Shared)
+	a.shared = append(a.shared, shared)
+	return shared
+}
+
+// WithArena returns a copy of ctx carrying arena, so UnmarshalContext decodes
+// into it.
+//
+//	arena := codec.NewArena()
+//	defer arena.Release()
+//	ctx = codec.WithArena(ctx, arena)
+//	msg, err := c.UnmarshalContext(ctx, data)
+func WithArena(ctx context.Context, arena *Arena) context.Context {
+	return context.WithValue(ctx, arenaContextKey{}, arena)
+}
+
+// ArenaFrom returns the arena of ctx, or nil.
+func ArenaFrom(ctx context.Context) *Arena {
+	arena, _ := ctx.Value(arenaContextKey{}).(*Arena)
+	return arena
+}
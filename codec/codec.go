@@ -2,11 +2,16 @@
 package codec
 
 import (
+	"context"
 	"fmt"
+	"sort"
 
 	"buf.build/go/hyperpb"
 	protobuf "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/internal/proto"
 )
 
 // Constants for buffer and pool sizes
@@ -29,6 +34,26 @@ type Options struct {
 	PoolSize int
 	// AllowUnknownFields allows unknown fields when decoding
 	AllowUnknownFields bool
+	// Backend selects the representation of decoded messages (default: BackendHyperpb)
+	Backend Backend
+	// AllowAlias lets decoded hyperpb messages reference the input instead of
+	// copying it. The input must not change while the message is in use.
+	AllowAlias bool
+	// EnablePGO records decode profiles of hyperpb messages, used to
+	// recompile them for the observed traffic
+	EnablePGO bool
+	// RecompileAfter recompiles the message type once this many messages
+	// were decoded (0: only on RecompileWithProfiles)
+	RecompileAfter uint64
+	// Drift recompiles the message type or reports regressions when the
+	// decoded traffic changes (default: off)
+	Drift *DriftPolicy
+	// UseJSONNames encodes JSON with the json_name of fields instead of
+	// their proto names
+	UseJSONNames bool
+	// JSONInt64 selects whether JSON encodes 64-bit integers as strings or
+	// numbers (default: strings, as protojson does)
+	JSONInt64 JSONInt64
 }
 
 // DefaultOptions returns default codec options.
@@ -37,14 +62,54 @@ func DefaultOptions() Options {
 		EnablePooling:      true,
 		PoolSize:           initialBufSize,
 		AllowUnknownFields: false,
+		Backend:            BackendHyperpb,
+		EnablePGO:          true,
+	}
+}
+
+// Stats describes a codec, e.g. for debug endpoints.
+type Stats struct {
+	// Message is the full name of the message type
+	Message string `json:"message"`
+	// Backend is the representation of decoded messages
+	Backend string `json:"backend"`
+	// PGO reports whether decodes are profiled for recompilation
+	PGO bool `json:"pgo"`
+	DecodeStats
+}
+
+// PGOStatus describes the profile-guided optimization of hyperpb message types.
+type PGOStatus struct {
+	// Generation is the number of recompilations so far
+	Generation uint64 `json:"generation"`
+	// Messages are the full names of the message types compiled with PGO
+	Messages []string `json:"messages"`
+}
+
+// CurrentPGOStatus returns the state of profile-guided optimization.
+func CurrentPGOStatus() PGOStatus {
+	messages := proto.GlobalPGOManager.Messages()
+	sort.Strings(messages)
+	return PGOStatus{
+		Generation: proto.GlobalPGOManager.Generation(),
+		Messages:   messages,
 	}
 }
 
+// RecompileWithProfiles recompiles all hyperpb message types with the decode
+// profiles recorded so far. Codecs switch to the recompiled types on their
+// next decode and start recording new profiles.
+func RecompileWithProfiles() error {
+	return proto.GlobalPGOManager.RecompileAll()
+}
+
 // New creates a new codec for the given message descriptor.
 func New(md protoreflect.MessageDescriptor, opts Options) (*Codec, error) {
 	encoder, err := NewEncoder(md, EncoderOptions{
 		EnablePooling:   opts.EnablePooling,
 		InitialPoolSize: opts.PoolSize,
+		UseJSONNames:    opts.UseJSONNames,
+		JSONInt64:       opts.JSONInt64,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create encoder: %w", err)
@@ -54,7 +119,11 @@ func New(md protoreflect.MessageDescriptor, opts Options) (*Codec, error) {
 		EnablePooling:      opts.EnablePooling,
 		InitialPoolSize:    opts.PoolSize,
 		AllowUnknownFields: opts.AllowUnknownFields,
-		EnablePGO:          true,
+		EnablePGO:          opts.EnablePGO && opts.Backend == BackendHyperpb,
+		Backend:            opts.Backend,
+		AllowAlias:         opts.AllowAlias,
+		RecompileAfter:     opts.RecompileAfter,
+		Drift:              opts.Drift,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create decoder: %w", err)
@@ -74,9 +143,19 @@ func (c *Codec) Marshal(msg protobuf.Message) ([]byte, error) {
 	return c.encoder.Encode(msg)
 }
 
-// Unmarshal decodes bytes to a message.
+// Unmarshal decodes bytes to a message of the configured backend.
 func (c *Codec) Unmarshal(data []byte) (protobuf.Message, error) {
-	return c.decoder.Decode(data)
+	return c.decoder.DecodeMessage(data)
+}
+
+// UnmarshalContext decodes bytes to a message like Unmarshal, allocating
+// hyperpb messages in the arena of ctx, if any. Such messages are released
+// with the arena and must not be passed to ReleaseMessage.
+func (c *Codec) UnmarshalContext(ctx context.Context, data []byte) (protobuf.Message, error) {
+	if arena := ArenaFrom(ctx); arena != nil && c.decoder.options.Backend == BackendHyperpb {
+		return c.decoder.DecodeInArena(arena, data)
+	}
+	return c.Unmarshal(data)
 }
 
 // MarshalToJSON encodes a message to JSON.
@@ -84,24 +163,41 @@ func (c *Codec) MarshalToJSON(msg protobuf.Message) ([]byte, error) {
 	return c.encoder.EncodeJSON(msg)
 }
 
-// UnmarshalFromJSON decodes JSON to a message.
+// UnmarshalFromJSON decodes JSON to a message of the configured backend.
 func (c *Codec) UnmarshalFromJSON(data []byte) (protobuf.Message, error) {
-	return c.decoder.DecodeJSON(data)
+	return c.decoder.DecodeJSONMessage(data)
 }
 
-// NewMessage creates a new message instance.
+// NewMessage creates a new message instance of the configured backend.
 func (c *Codec) NewMessage() protobuf.Message {
+	if c.decoder.options.Backend == BackendDynamicpb {
+		return dynamicpb.NewMessage(c.decoder.Descriptor())
+	}
 	return c.decoder.GetMessage()
 }
 
-// ReleaseMessage returns a message to the pool.
+// ReleaseMessage recycles the memory of a message returned by Unmarshal,
+// UnmarshalFromJSON, or NewMessage, including nested messages, repeated
+// fields, and maps. Neither the message nor values read from it may be used
+// afterwards. Messages that are still referenced must simply not be released;
+// they are then garbage collected.
 func (c *Codec) ReleaseMessage(msg protobuf.Message) {
-	// Only release hyperpb messages
+	// Only hyperpb messages are pooled; dynamicpb messages are reset on decoding anyway
 	if hm, ok := msg.(*hyperpb.Message); ok {
 		c.decoder.PutMessage(hm)
 	}
 }
 
+// Stats returns the current statistics of the codec.
+func (c *Codec) Stats() Stats {
+	return Stats{
+		Message:     string(c.decoder.Descriptor().FullName()),
+		Backend:     c.decoder.options.Backend.String(),
+		PGO:         c.decoder.options.EnablePGO,
+		DecodeStats: c.decoder.Stats(),
+	}
+}
+
 // Descriptor returns the message descriptor.
 func (c *Codec) Descriptor() protoreflect.MessageDescriptor {
 	return c.encoder.Descriptor()
@@ -1,7 +1,12 @@
 package codec_test
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"buf.build/go/hyperpb"
 	"google.golang.org/protobuf/proto"
@@ -225,6 +230,200 @@ func TestCodec_Pooling(t *testing.T) {
 	}
 }
 
+func TestCodec_Backends(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	testData := []byte{
+		0x0a, 0x04, 'a', 'b', 'c', 'd', // field 1 (id)
+		0x10, 0x07, // field 2 (value), varint 7
+	}
+
+	tests := []struct {
+		backend    codec.Backend
+		allowAlias bool
+		wantType   string
+	}{
+		{codec.BackendHyperpb, false, "*hyperpb.Message"},
+		{codec.BackendHyperpb, true, "*hyperpb.Message"},
+		{codec.BackendDynamicpb, false, "*dynamicpb.Message"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s alias=%v", tt.backend, tt.allowAlias), func(t *testing.T) {
+			opts := codec.DefaultOptions()
+			opts.Backend = tt.backend
+			opts.AllowAlias = tt.allowAlias
+			c, err := codec.New(md, opts)
+			if err != nil {
+				t.Fatalf("Failed to create codec: %v", err)
+			}
+
+			data := slices.Clone(testData)
+			decoded, err := c.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			fromJSON, err := c.UnmarshalFromJSON([]byte(`{"id":"abcd","value":7}`))
+			if err != nil {
+				t.Fatalf("Failed to unmarshal JSON: %v", err)
+			}
+			for _, msg := range []proto.Message{decoded, fromJSON, c.NewMessage()} {
+				if got := fmt.Sprintf("%T", msg); got != tt.wantType {
+					t.Errorf("Expected %s, got %s", tt.wantType, got)
+				}
+			}
+
+			m := decoded.ProtoReflect()
+			fields := m.Descriptor().Fields()
+			if id := m.Get(fields.ByName("id")).String(); id != "abcd" {
+				t.Errorf("Expected id abcd, got %q", id)
+			}
+			if value := m.Get(fields.ByName("value")).Int(); value != 7 {
+				t.Errorf("Expected value 7, got %d", value)
+			}
+			if !proto.Equal(decoded, fromJSON) {
+				t.Errorf("Expected binary and JSON decoding to agree")
+			}
+		})
+	}
+}
+
+func TestCodec_PGORecompile(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	testData := []byte{0x0a, 0x02, 'i', 'd', 0x10, 0x01}
+
+	opts := codec.DefaultOptions()
+	opts.RecompileAfter = 100
+	c, err := codec.New(md, opts)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	msgType := func() *hyperpb.MessageType {
+		t.Helper()
+		decoded, err := c.Unmarshal(testData)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		return decoded.(*hyperpb.Message).HyperType()
+	}
+
+	// Reaching RecompileAfter recompiles in the background
+	initial := msgType()
+	for range opts.RecompileAfter {
+		msgType()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for msgType() == initial {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the codec to switch to the recompiled type")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Explicit recompilation
+	recompiled := msgType()
+	if err := codec.RecompileWithProfiles(); err != nil {
+		t.Fatalf("Failed to recompile: %v", err)
+	}
+	if msgType() == recompiled {
+		t.Error("Expected the codec to switch to the new type")
+	}
+}
+
+func TestCodec_ReleaseMessage(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	c, err := codec.New(md, codec.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	// Released arenas are reused by later messages
+	for i := range 20 {
+		id := fmt.Sprintf("message-%d", i)
+		data := append([]byte{0x0a, byte(len(id))}, id...)
+		msg, err := c.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		m := msg.ProtoReflect()
+		if got := m.Get(m.Descriptor().Fields().ByName("id")).String(); got != id {
+			t.Fatalf("Expected id %q, got %q", id, got)
+		}
+		c.ReleaseMessage(msg)
+	}
+}
+
+func TestCodec_Arena(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	c, err := codec.New(md, codec.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	idOf := func(msg proto.Message) string {
+		m := msg.ProtoReflect()
+		return m.Get(m.Descriptor().Fields().ByName("id")).String()
+	}
+	decode := func(ctx context.Context, id string) proto.Message {
+		t.Helper()
+		msg, err := c.UnmarshalContext(ctx, append([]byte{0x0a, byte(len(id))}, id...))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		return msg
+	}
+
+	t.Run("messages share the arena", func(t *testing.T) {
+		arena := codec.NewArena()
+		ctx := codec.WithArena(context.Background(), arena)
+		if codec.ArenaFrom(ctx) != arena {
+			t.Fatal("Expected the arena in the context")
+		}
+		var msgs []proto.Message
+		for i := range 10 {
+			msgs = append(msgs, decode(ctx, fmt.Sprintf("stream-%d", i)))
+		}
+		for i, msg := range msgs {
+			if got, want := idOf(msg), fmt.Sprintf("stream-%d", i); got != want {
+				t.Errorf("Expected id %q, got %q", want, got)
+			}
+		}
+		arena.Release()
+		arena.Release() // no-op
+
+		// Without an arena in the context, decoding falls back to pooled messages
+		if got := idOf(decode(context.Background(), "plain")); got != "plain" {
+			t.Errorf("Expected id plain, got %q", got)
+		}
+	})
+
+	t.Run("retained arena", func(t *testing.T) {
+		arena := codec.NewArena()
+		msg := decode(codec.WithArena(context.Background(), arena), "retained")
+		arena.Retain()
+		arena.Release()
+
+		// Decoding into new arenas must not overwrite the retained message
+		for range 10 {
+			other := codec.NewArena()
+			decode(codec.WithArena(context.Background(), other), "overwrite")
+			other.Release()
+		}
+		if got := idOf(msg); got != "retained" {
+			t.Errorf("Expected the retained message to stay intact, got %q", got)
+		}
+	})
+}
+
 func BenchmarkCodec_Marshal(b *testing.B) {
 	// Benchmarking unmarshal since hyperpb messages are read-only
 	b.Skip("Skipping marshal benchmark - hyperpb messages are read-only")
@@ -259,6 +458,56 @@ func BenchmarkCodec_Unmarshal(b *testing.B) {
 	}
 }
 
+// BenchmarkCodec_UnmarshalRelease recycles the arena of each message.
+func BenchmarkCodec_UnmarshalRelease(b *testing.B) {
+	c, testData := newBenchmarkCodec(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		msg, err := c.Unmarshal(testData)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.ReleaseMessage(msg)
+	}
+}
+
+// BenchmarkCodec_UnmarshalArena decodes ten messages per request arena, like
+// a client stream.
+func BenchmarkCodec_UnmarshalArena(b *testing.B) {
+	const messagesPerRequest = 10
+	c, testData := newBenchmarkCodec(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		arena := codec.NewArena()
+		ctx := codec.WithArena(context.Background(), arena)
+		for range messagesPerRequest {
+			if _, err := c.UnmarshalContext(ctx, testData); err != nil {
+				b.Fatal(err)
+			}
+		}
+		arena.Release()
+	}
+}
+
+func newBenchmarkCodec(b *testing.B) (*codec.Codec, []byte) {
+	b.Helper()
+	md, err := createTestDescriptor()
+	if err != nil {
+		b.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	c, err := codec.New(md, codec.DefaultOptions())
+	if err != nil {
+		b.Fatalf("Failed to create codec: %v", err)
+	}
+	testData := []byte{
+		0x0a, 0x0a, // field 1 (id), length 10
+		'b', 'e', 'n', 'c', 'h', '-', 't', 'e', 's', 't',
+		0x10, 0xc0, 0xc4, 0x07, // field 2 (value), varint 123456
+		0x18, 0x01, // field 3 (active), varint 1 (true)
+	}
+	return c, testData
+}
+
 // Helper functions.
 func labelPtr(l descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto_Label {
 	return &l
@@ -267,3 +516,127 @@ func labelPtr(l descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDesc
 func typePtr(t descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto_Type {
 	return &t
 }
+
+func TestCodec_Stats(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	testData := []byte{0x0a, 0x02, 'i', 'd', 0x10, 0x01}
+
+	opts := codec.DefaultOptions()
+	opts.EnablePooling = false
+	c, err := codec.New(md, opts)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	for range 64 {
+		if _, err := c.Unmarshal(testData); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Message != "test.v1.TestMessage" || stats.Backend != "hyperpb" {
+		t.Errorf("Unexpected codec %+v", stats)
+	}
+	if stats.Decodes != 64 || stats.Bytes != uint64(64*len(testData)) {
+		t.Errorf("Expected 64 decodes of %d bytes, got %d decodes of %d bytes", len(testData), stats.Decodes, stats.Bytes)
+	}
+	if stats.Sampled == 0 || stats.P50 == 0 || stats.P50 > stats.P90 || stats.P90 > stats.P99 {
+		t.Errorf("Unexpected latencies %+v", stats.DecodeStats)
+	}
+	if stats.ArenaAllocs != 64 {
+		t.Errorf("Expected an arena per decode without pooling, got %d", stats.ArenaAllocs)
+	}
+}
+
+func TestCodec_Drift(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+	small := []byte{0x0a, 0x02, 'i', 'd'}
+	large := append([]byte{0x0a, 0x20}, []byte("an identifier of thirty-two byte")...)
+
+	reports := make(chan codec.DriftReport, 1)
+	opts := codec.DefaultOptions()
+	opts.Drift = &codec.DriftPolicy{
+		Window:    32,
+		Recompile: true,
+		OnDrift:   func(report codec.DriftReport) { reports <- report },
+	}
+	c, err := codec.New(md, opts)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	decode := func(data []byte, n int) {
+		t.Helper()
+		for range n {
+			if _, err := c.Unmarshal(data); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+		}
+	}
+
+	// The baseline and a window like it
+	decode(small, 64)
+	select {
+	case report := <-reports:
+		t.Fatalf("Unexpected drift %+v", report)
+	default:
+	}
+
+	// Larger messages drift from the baseline
+	decode(large, 32)
+	select {
+	case report := <-reports:
+		if report.Message != "test.v1.TestMessage" || !report.Recompiled {
+			t.Errorf("Unexpected report %+v", report)
+		}
+		if report.Baseline.MeanSize != float64(len(small)) || report.Current.MeanSize != float64(len(large)) {
+			t.Errorf("Expected mean sizes %d and %d, got %+v", len(small), len(large), report)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a drift report")
+	}
+	if drifts := c.Stats().Drifts; drifts != 1 {
+		t.Errorf("Expected 1 drift, got %d", drifts)
+	}
+}
+
+func TestCodec_JSONInt64(t *testing.T) {
+	md, err := createTestDescriptor()
+	if err != nil {
+		t.Fatalf("Failed to create test descriptor: %v", err)
+	}
+
+	opts := codec.DefaultOptions()
+	opts.JSONInt64 = codec.JSONInt64Number
+	c, err := codec.New(md, opts)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	msg, err := c.UnmarshalFromJSON([]byte(`{"id":"9007199254740993","value":"9007199254740993"}`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	data, err := c.MarshalToJSON(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if got := string(data); !strings.Contains(got, `"value":9007199254740993`) || !strings.Contains(got, `"id":"9007199254740993"`) {
+		t.Errorf("Expected a numeric value and a string id, got %s", got)
+	}
+
+	for encoding, want := range map[codec.JSONInt64]string{
+		codec.JSONInt64Default: `{"value": 42, "id": "7"}`,
+		codec.JSONInt64String:  `{"value":"42","id":"7"}`,
+		codec.JSONInt64Number:  `{"value":42,"id":"7"}`,
+	} {
+		got, err := codec.RewriteJSONInt64([]byte(`{"value": 42, "id": "7"}`), md, encoding)
+		if err != nil || string(got) != want {
+			t.Errorf("%v: expected %s, got %s (%v)", encoding, want, got, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package codec
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"buf.build/go/hyperpb"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -16,12 +17,49 @@ import (
 // Default pool size
 const defaultPoolSize = 10
 
+// defaultProfileSamplingRate is the fraction of decodes recorded for PGO,
+// low enough to keep the overhead small.
+const defaultProfileSamplingRate = 0.1
+
+// Backend selects how a Decoder represents decoded messages.
+type Backend int
+
+const (
+	// BackendHyperpb decodes into hyperpb messages, which are laid out in an
+	// arena and decoded lazily where possible. It is the fastest backend for
+	// large messages, but the messages are read-only.
+	BackendHyperpb Backend = iota
+	// BackendDynamicpb decodes eagerly into mutable dynamicpb messages.
+	BackendDynamicpb
+)
+
+// String returns the name of the backend.
+func (b Backend) String() string {
+	switch b {
+	case BackendHyperpb:
+		return "hyperpb"
+	case BackendDynamicpb:
+		return "dynamicpb"
+	default:
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+}
+
 // Decoder handles decoding protobuf format to Go values using hyperpb.
 type Decoder struct {
-	msgType    *hyperpb.MessageType
+	compiled   atomic.Pointer[compiledType]
+	generation atomic.Uint64
+	decodes    atomic.Uint64
 	descriptor protoreflect.MessageDescriptor
 	pool       *sync.Pool
 	options    DecoderOptions
+	stats      *decodeStats
+}
+
+// compiledType is a hyperpb message type with the profile recording its decodes.
+type compiledType struct {
+	msgType *hyperpb.MessageType
+	profile *hyperpb.Profile
 }
 
 // DecoderOptions configures the decoder.
@@ -34,6 +72,18 @@ type DecoderOptions struct {
 	AllowUnknownFields bool
 	// EnablePGO enables profile-guided optimization
 	EnablePGO bool
+	// Backend selects the message representation (default: BackendHyperpb)
+	Backend Backend
+	// AllowAlias lets hyperpb messages reference the decoded bytes instead of
+	// copying them. The bytes must not change while the message is in use.
+	AllowAlias bool
+	// RecompileAfter recompiles the message type with its profile once this
+	// many messages were decoded, when PGO is enabled. 0 leaves recompilation
+	// to RecompileWithProfiles.
+	RecompileAfter uint64
+	// Drift detects changes of the decoded traffic, to recompile the message
+	// type or report regressions (default: off)
+	Drift *DriftPolicy
 }
 
 // NewDecoder creates a new decoder for the given message descriptor.
@@ -56,48 +106,101 @@ func NewDecoder(md protoreflect.MessageDescriptor, opts DecoderOptions) (*Decode
 	}
 
 	dec := &Decoder{
-		msgType:    msgType,
 		descriptor: md,
 		options:    opts,
+		stats:      newDecodeStats(opts.Drift),
 	}
+	ct := &compiledType{msgType: msgType}
+	if opts.EnablePGO {
+		ct.profile = proto.GlobalPGOManager.GetOrCreateProfile(msgType)
+		dec.generation.Store(proto.GlobalPGOManager.Generation())
+	}
+	dec.compiled.Store(ct)
 
 	if opts.EnablePooling {
+		// Arenas hold the memory of a message and all its nested messages,
+		// repeated fields, and maps, so they are pooled instead of messages
 		dec.pool = &sync.Pool{
 			New: func() any {
-				return hyperpb.NewMessage(msgType)
+				dec.countArenaAlloc()
+				return new(hyperpb.Shared)
 			},
 		}
 		// Pre-populate pool
 		for i := 0; i < opts.InitialPoolSize; i++ {
-			dec.pool.Put(hyperpb.NewMessage(msgType))
+			dec.pool.Put(new(hyperpb.Shared))
 		}
 	}
 
 	return dec, nil
 }
 
-// Decode unmarshals bytes to a protobuf message.
-func (d *Decoder) Decode(data []byte) (*hyperpb.Message, error) {
-	msg := d.GetMessage()
-
-	// Get profile if PGO is enabled
-	var unmarshalOpts []hyperpb.UnmarshalOption
+// current returns the message type to decode with, switching to the
+// recompiled type after a PGO recompilation.
+func (d *Decoder) current() *compiledType {
 	if d.options.EnablePGO {
-		profile := proto.GlobalPGOManager.GetOrCreateProfile(d.msgType)
-		if profile != nil {
-			// Record with 10% sampling rate by default to minimize overhead
-			const defaultSamplingRate = 0.1
-			unmarshalOpts = append(unmarshalOpts, hyperpb.WithRecordProfile(profile, defaultSamplingRate))
+		if gen := proto.GlobalPGOManager.Generation(); gen != d.generation.Load() {
+			if msgType, profile := proto.GlobalPGOManager.Current(string(d.descriptor.FullName())); msgType != nil {
+				d.compiled.Store(&compiledType{msgType: msgType, profile: profile})
+			}
+			d.generation.Store(gen)
 		}
 	}
+	return d.compiled.Load()
+}
 
-	err := msg.Unmarshal(data, unmarshalOpts...)
+// Decode unmarshals bytes to a hyperpb message, regardless of the backend.
+// Pass the message to PutMessage once it is no longer used to recycle its memory.
+func (d *Decoder) Decode(data []byte) (*hyperpb.Message, error) {
+	shared := d.getShared()
+	msg, err := d.decodeIn(shared, data)
 	if err != nil {
-		d.PutMessage(msg) // Return to pool on error
+		d.putShared(shared)
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DecodeInArena unmarshals bytes to a hyperpb message allocated in arena.
+// The message is released with the arena and must not be passed to PutMessage.
+func (d *Decoder) DecodeInArena(arena *Arena, data []byte) (*hyperpb.Message, error) {
+	return d.decodeIn(arena.newShared(), data)
+}
+
+// decodeIn unmarshals bytes to a hyperpb message allocated in shared.
+func (d *Decoder) decodeIn(shared *hyperpb.Shared, data []byte) (*hyperpb.Message, error) {
+	ct := d.current()
+	msg := shared.NewMessage(ct.msgType)
+
+	var unmarshalOpts []hyperpb.UnmarshalOption
+	if ct.profile != nil {
+		unmarshalOpts = append(unmarshalOpts, hyperpb.WithRecordProfile(ct.profile, defaultProfileSamplingRate))
+	}
+	if d.options.AllowAlias {
+		unmarshalOpts = append(unmarshalOpts, hyperpb.WithAllowAlias(true))
+	}
 
+	start := d.startTimer()
+	if err := msg.Unmarshal(data, unmarshalOpts...); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
+	d.recordDecode(start, len(data))
+	return msg, nil
+}
+
+// DecodeMessage unmarshals bytes to a message of the configured backend.
+func (d *Decoder) DecodeMessage(data []byte) (protobuf.Message, error) {
+	if d.options.Backend != BackendDynamicpb {
+		return d.Decode(data)
+	}
+
+	start := d.startTimer()
+	msg := dynamicpb.NewMessage(d.descriptor)
+	if err := d.DecodeInto(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	d.recordDecode(start, len(data))
 	return msg, nil
 }
 
@@ -112,21 +215,13 @@ func (d *Decoder) DecodeInto(data []byte, msg protobuf.Message) error {
 	return opts.Unmarshal(data, msg)
 }
 
-// DecodeJSON unmarshals JSON to a protobuf message.
+// DecodeJSON unmarshals JSON to a hyperpb message, regardless of the backend.
 func (d *Decoder) DecodeJSON(data []byte) (*hyperpb.Message, error) {
 	// Since hyperpb messages are read-only, we can't unmarshal JSON directly.
 	// We need to use dynamicpb as an intermediate step
-	dynamicMsg := dynamicpb.NewMessage(d.descriptor)
-
-	// Convert from JSON using protojson
-	opts := protojson.UnmarshalOptions{
-		AllowPartial:   false,
-		DiscardUnknown: !d.options.AllowUnknownFields,
-	}
-
-	err := opts.Unmarshal(data, dynamicMsg)
+	dynamicMsg, err := d.decodeJSONDynamic(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		return nil, err
 	}
 
 	// Marshal to binary protobuf
@@ -139,19 +234,65 @@ func (d *Decoder) DecodeJSON(data []byte) (*hyperpb.Message, error) {
 	return d.Decode(protoData)
 }
 
-// GetMessage returns a message from the pool or creates a new one.
+// DecodeJSONMessage unmarshals JSON to a message of the configured backend.
+func (d *Decoder) DecodeJSONMessage(data []byte) (protobuf.Message, error) {
+	if d.options.Backend != BackendDynamicpb {
+		return d.DecodeJSON(data)
+	}
+	start := d.startTimer()
+	msg, err := d.decodeJSONDynamic(data)
+	if err != nil {
+		return nil, err
+	}
+	d.recordDecode(start, len(data))
+	return msg, nil
+}
+
+// decodeJSONDynamic unmarshals JSON to a dynamicpb message.
+func (d *Decoder) decodeJSONDynamic(data []byte) (*dynamicpb.Message, error) {
+	dynamicMsg := dynamicpb.NewMessage(d.descriptor)
+
+	// Convert from JSON using protojson
+	opts := protojson.UnmarshalOptions{
+		AllowPartial:   false,
+		DiscardUnknown: !d.options.AllowUnknownFields,
+	}
+
+	if err := opts.Unmarshal(data, dynamicMsg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	return dynamicMsg, nil
+}
+
+// GetMessage returns an empty message allocated in a pooled arena.
 func (d *Decoder) GetMessage() *hyperpb.Message {
-	// hyperpb messages are read-only and don't support Clear/Reset
-	// So we don't use pooling for now
-	// TODO: Implement pooling when hyperpb supports it
-	return hyperpb.NewMessage(d.msgType)
+	return d.getShared().NewMessage(d.current().msgType)
 }
 
-// PutMessage returns a message to the pool.
+// PutMessage recycles the memory of a message returned by Decode or
+// GetMessage, including its nested messages, repeated fields, and maps. The
+// message and any values read from it, including strings and bytes, must not
+// be used afterwards; copy them first if they need to outlive the message.
 func (d *Decoder) PutMessage(msg *hyperpb.Message) {
-	// hyperpb messages are read-only and don't support Clear/Reset
-	// So we don't use pooling for now
-	// TODO: Implement pooling when hyperpb supports it
+	d.putShared(msg.Shared())
+}
+
+// getShared returns an arena for a new message.
+func (d *Decoder) getShared() *hyperpb.Shared {
+	if d.pool == nil {
+		d.countArenaAlloc()
+		return new(hyperpb.Shared)
+	}
+	return d.pool.Get().(*hyperpb.Shared)
+}
+
+// putShared frees an arena and returns it to the pool.
+func (d *Decoder) putShared(shared *hyperpb.Shared) {
+	if d.pool == nil {
+		return
+	}
+	shared.Free()
+	d.pool.Put(shared)
 }
 
 // Descriptor returns the message descriptor.
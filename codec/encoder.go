@@ -26,6 +26,12 @@ type EncoderOptions struct {
 	EnablePooling bool
 	// InitialPoolSize sets the initial pool size
 	InitialPoolSize int
+	// UseJSONNames encodes JSON with the json_name of fields instead of
+	// their proto names
+	UseJSONNames bool
+	// JSONInt64 selects whether JSON encodes 64-bit integers as strings or
+	// numbers
+	JSONInt64 JSONInt64
 }
 
 // NewEncoder creates a new encoder for the given message descriptor.
@@ -66,10 +72,14 @@ func (e *Encoder) Encode(msg protobuf.Message) ([]byte, error) {
 // EncodeJSON marshals a protobuf message to JSON.
 func (e *Encoder) EncodeJSON(msg protobuf.Message) ([]byte, error) {
 	// Convert to JSON using protojson
-	return protojson.MarshalOptions{
+	data, err := protojson.MarshalOptions{
 		EmitUnpopulated: true,
-		UseProtoNames:   true,
+		UseProtoNames:   !e.options.UseJSONNames,
 	}.Marshal(msg)
+	if err != nil || e.options.JSONInt64 != JSONInt64Number {
+		return data, err
+	}
+	return RewriteJSONInt64(data, msg.ProtoReflect().Descriptor(), JSONInt64Number)
 }
 
 // GetMessage returns a message from the pool or creates a new one.
@@ -0,0 +1,256 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// JSONInt64 selects how 64-bit integers (int64, uint64, and their sint,
+// fixed, and wrapper forms) are encoded in JSON.
+type JSONInt64 int
+
+const (
+	// JSONInt64Default leaves integers as each encoder writes them: strings
+	// with the proto3 JSON mapping, numbers with encoding/json.
+	JSONInt64Default JSONInt64 = iota
+	// JSONInt64String encodes integers as strings, the proto3 JSON standard,
+	// so JavaScript clients don't round values above 2^53.
+	JSONInt64String
+	// JSONInt64Number encodes integers as numbers.
+	JSONInt64Number
+)
+
+// String returns the name of the encoding.
+func (e JSONInt64) String() string {
+	switch e {
+	case JSONInt64Default:
+		return "default"
+	case JSONInt64String:
+		return "string"
+	case JSONInt64Number:
+		return "number"
+	default:
+		return fmt.Sprintf("JSONInt64(%d)", int(e))
+	}
+}
+
+// RewriteJSONInt64 rewrites the 64-bit integers of data, the JSON encoding
+// of a message of type md, to strings or numbers as encoding selects. Fields
+// are found by their proto, JSON, or snake_case names, so the output of both
+// protojson and encoding/json is rewritten. Values that are not integers,
+// and data with JSONInt64Default, are copied as-is.
+func RewriteJSONInt64(data []byte, md protoreflect.MessageDescriptor, encoding JSONInt64) ([]byte, error) {
+	if encoding == JSONInt64Default || md == nil {
+		return data, nil
+	}
+	var out bytes.Buffer
+	out.Grow(len(data))
+	if err := rewriteJSONMessage(&out, bytes.TrimSpace(data), md, encoding == JSONInt64String); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// rewriteJSONMessage rewrites a JSON object holding a message of type md.
+func rewriteJSONMessage(out *bytes.Buffer, data []byte, md protoreflect.MessageDescriptor, toString bool) error {
+	if len(data) == 0 || data[0] != '{' {
+		out.Write(data)
+		return nil
+	}
+	return rewriteJSONObject(out, data, func(name string, value []byte) error {
+		fd := jsonField(md, name)
+		if fd == nil {
+			out.Write(value)
+			return nil
+		}
+		return rewriteJSONField(out, value, fd, toString)
+	})
+}
+
+// rewriteJSONField rewrites the value of field fd.
+func rewriteJSONField(out *bytes.Buffer, value []byte, fd protoreflect.FieldDescriptor, toString bool) error {
+	switch {
+	case fd.IsMap():
+		if !holdsInt64(fd.MapValue()) || len(value) == 0 || value[0] != '{' {
+			out.Write(value)
+			return nil
+		}
+		return rewriteJSONObject(out, value, func(_ string, elem []byte) error {
+			return rewriteJSONValue(out, elem, fd.MapValue(), toString)
+		})
+	case fd.IsList():
+		if !holdsInt64(fd) || len(value) == 0 || value[0] != '[' {
+			out.Write(value)
+			return nil
+		}
+		return rewriteJSONArray(out, value, func(elem []byte) error {
+			return rewriteJSONValue(out, elem, fd, toString)
+		})
+	default:
+		return rewriteJSONValue(out, value, fd, toString)
+	}
+}
+
+// rewriteJSONValue rewrites a single value of field fd, an integer or a
+// message.
+func rewriteJSONValue(out *bytes.Buffer, value []byte, fd protoreflect.FieldDescriptor, toString bool) error {
+	switch {
+	case isInt64Field(fd):
+		out.Write(convertJSONInt64(value, toString))
+		return nil
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		switch md := fd.Message(); {
+		case isInt64Wrapper(md):
+			out.Write(convertJSONInt64(value, toString))
+			return nil
+		case strings.HasPrefix(string(md.FullName()), "google.protobuf."):
+			// Other well-known types have JSON forms of their own
+			out.Write(value)
+			return nil
+		default:
+			return rewriteJSONMessage(out, value, md, toString)
+		}
+	default:
+		out.Write(value)
+		return nil
+	}
+}
+
+// convertJSONInt64 returns the integer value as a string or a number. Values
+// that are not integers are returned as-is.
+func convertJSONInt64(value []byte, toString bool) []byte {
+	if len(value) == 0 {
+		return value
+	}
+	text := value
+	if value[0] == '"' {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return value
+		}
+		text = []byte(s)
+	}
+	if _, err := strconv.ParseInt(string(text), 10, 64); err != nil {
+		if _, err := strconv.ParseUint(string(text), 10, 64); err != nil {
+			return value
+		}
+	}
+	if toString {
+		return strconv.AppendQuote(nil, string(text))
+	}
+	return text
+}
+
+// jsonField finds the field of md named name in JSON.
+func jsonField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	if fd := fields.ByJSONName(name); fd != nil {
+		return fd
+	}
+	return fields.ByName(protoreflect.Name(snakeCase(name)))
+}
+
+// snakeCase converts a lowerCamelCase JSON name to snake_case.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// holdsInt64 reports whether values of fd are or may contain 64-bit
+// integers.
+func holdsInt64(fd protoreflect.FieldDescriptor) bool {
+	return isInt64Field(fd) || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+}
+
+// isInt64Field reports whether fd is a 64-bit integer field.
+func isInt64Field(fd protoreflect.FieldDescriptor) bool {
+	switch fd.Kind() { //nolint:exhaustive // Other kinds are not 64-bit integers
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
+// isInt64Wrapper reports whether md is google.protobuf.Int64Value or
+// UInt64Value.
+func isInt64Wrapper(md protoreflect.MessageDescriptor) bool {
+	name := md.FullName()
+	return name == "google.protobuf.Int64Value" || name == "google.protobuf.UInt64Value"
+}
+
+// rewriteJSONObject writes the JSON object data to out, with each member
+// value written by rewrite.
+func rewriteJSONObject(out *bytes.Buffer, data []byte, rewrite func(name string, value []byte) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte('{')
+	for i := 0; dec.More(); i++ {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		name, _ := key.(string)
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		out.Write(quoted)
+		out.WriteByte(':')
+		if err := rewrite(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// rewriteJSONArray writes the JSON array data to out, with each element
+// written by rewrite.
+func rewriteJSONArray(out *bytes.Buffer, data []byte, rewrite func(elem []byte) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return err
+		}
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if err := rewrite(elem); err != nil {
+			return err
+		}
+	}
+	out.WriteByte(']')
+	return nil
+}
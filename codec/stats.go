@@ -0,0 +1,324 @@
+package codec
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/i2y/hyperway/internal/proto"
+)
+
+// Decode statistics defaults
+const (
+	// latencySampleMask times one in 16 decodes, so measuring the latency
+	// stays cheap next to decoding small messages.
+	latencySampleMask     = 15
+	defaultDriftWindow    = 10000
+	defaultDriftThreshold = 0.5
+	// minDriftSamples is the number of timed decodes a window needs for its
+	// latency to be compared.
+	minDriftSamples = 16
+)
+
+// Latency histogram layout: bucket 0 holds decodes faster than
+// minLatencyBucket, then each power of two is split into latencySubBuckets.
+const (
+	minLatencyShift   = 6 // 64ns
+	minLatencyBucket  = 1 << minLatencyShift
+	latencySubShift   = 2
+	latencySubBuckets = 1 << latencySubShift
+	latencyOctaves    = 31 // up to about 137s
+	latencyBuckets    = 1 + latencyOctaves*latencySubBuckets
+)
+
+// DecodeStats are runtime statistics of the decodes of a message type.
+type DecodeStats struct {
+	// Decodes is the number of messages decoded
+	Decodes uint64 `json:"decodes"`
+	// Bytes is the number of bytes decoded
+	Bytes uint64 `json:"bytes"`
+	// Sampled is the number of decodes whose latency was measured
+	Sampled uint64 `json:"sampled"`
+	// P50, P90, and P99 are percentiles of the decode latency. They are
+	// upper bounds of histogram buckets, at most 25% above the exact value.
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	// ArenaAllocs is the number of hyperpb arenas allocated because none
+	// could be reused
+	ArenaAllocs uint64 `json:"arena_allocs"`
+	// Drifts is the number of windows that drifted from their baseline
+	Drifts uint64 `json:"drifts"`
+}
+
+// DriftPolicy detects when the decodes of a message type drift from a
+// baseline, e.g. because clients started sending other fields, so the
+// message type can be recompiled for the new traffic and regressions
+// reported.
+//
+// Decodes are compared in windows. The first window after the message type
+// was compiled is the baseline; a later window drifts when its mean message
+// size changed by more than Threshold, or its median latency grew by more.
+type DriftPolicy struct {
+	// Window is the number of decodes per window (default 10000)
+	Window uint64
+	// Threshold is the relative change that counts as drift (default 0.5)
+	Threshold float64
+	// Recompile recompiles the message type with its profile on drift, when
+	// PGO is enabled
+	Recompile bool
+	// OnDrift is called in the background with each drift
+	OnDrift func(DriftReport)
+}
+
+// DriftReport describes a window of decodes that drifted from the baseline.
+type DriftReport struct {
+	// Message is the full name of the message type
+	Message string
+	// Baseline is the window the current one was compared with
+	Baseline WindowStats
+	// Current is the window that drifted
+	Current WindowStats
+	// Recompiled reports whether the message type was recompiled
+	Recompiled bool
+}
+
+// WindowStats summarizes a window of decodes.
+type WindowStats struct {
+	// Decodes is the number of messages decoded in the window
+	Decodes uint64
+	// MeanSize is the mean size of the decoded messages in bytes
+	MeanSize float64
+	// Sampled is the number of decodes whose latency was measured
+	Sampled uint64
+	// P50 and P99 are percentiles of the decode latency
+	P50 time.Duration
+	P99 time.Duration
+	// ArenaAllocs is the number of hyperpb arenas allocated in the window
+	ArenaAllocs uint64
+}
+
+// latencyHistogram counts decode latencies in logarithmic buckets.
+type latencyHistogram struct {
+	buckets [latencyBuckets]atomic.Uint64
+}
+
+// latencyBucket returns the bucket of a latency.
+func latencyBucket(d time.Duration) int {
+	if d < minLatencyBucket {
+		return 0
+	}
+	ns := uint64(d)
+	exp := bits.Len64(ns) - 1
+	sub := int(ns>>(exp-latencySubShift)) & (latencySubBuckets - 1)
+	return min(1+(exp-minLatencyShift)*latencySubBuckets+sub, latencyBuckets-1)
+}
+
+// latencyBucketBound returns the upper bound of a bucket.
+func latencyBucketBound(i int) time.Duration {
+	if i == 0 {
+		return minLatencyBucket
+	}
+	exp := (i-1)/latencySubBuckets + minLatencyShift
+	sub := (i - 1) % latencySubBuckets
+	return time.Duration(latencySubBuckets+sub+1) << (exp - latencySubShift)
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.buckets[latencyBucket(d)].Add(1)
+}
+
+// percentiles returns the count and the given percentiles (0-1) of the
+// recorded latencies.
+func (h *latencyHistogram) percentiles(qs ...float64) (uint64, []time.Duration) {
+	var counts [latencyBuckets]uint64
+	var total uint64
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+	result := make([]time.Duration, len(qs))
+	if total == 0 {
+		return 0, result
+	}
+	for j, q := range qs {
+		target := uint64(math.Ceil(q * float64(total)))
+		var cumulative uint64
+		for i, count := range counts {
+			cumulative += count
+			if cumulative >= target {
+				result[j] = latencyBucketBound(i)
+				break
+			}
+		}
+	}
+	return total, result
+}
+
+func (h *latencyHistogram) reset() {
+	for i := range h.buckets {
+		h.buckets[i].Store(0)
+	}
+}
+
+// decodeStats records the decodes of a Decoder.
+type decodeStats struct {
+	bytes       atomic.Uint64
+	arenaAllocs atomic.Uint64
+	drifts      atomic.Uint64
+	latency     latencyHistogram
+
+	// The current window, if a drift policy is configured. Decodes racing
+	// with the end of a window may be counted in the next one.
+	window        *DriftPolicy
+	windowDecodes atomic.Uint64
+	windowBytes   atomic.Uint64
+	windowAllocs  atomic.Uint64
+	windowLatency latencyHistogram
+
+	mu          sync.Mutex
+	baseline    *WindowStats
+	baselineGen uint64
+}
+
+// newDecodeStats returns the statistics of a decoder, with the defaults of
+// policy filled in.
+func newDecodeStats(policy *DriftPolicy) *decodeStats {
+	s := &decodeStats{}
+	if policy != nil {
+		window := *policy
+		if window.Window == 0 {
+			window.Window = defaultDriftWindow
+		}
+		if window.Threshold <= 0 {
+			window.Threshold = defaultDriftThreshold
+		}
+		s.window = &window
+	}
+	return s
+}
+
+// startTimer returns the start of a decode whose latency is sampled, or the
+// zero time.
+func (d *Decoder) startTimer() time.Time {
+	if d.decodes.Load()&latencySampleMask != 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// recordDecode counts a decoded message of size bytes, started at start if
+// sampled. It recompiles the message type in the background once
+// RecompileAfter messages were decoded, and ends drift windows.
+func (d *Decoder) recordDecode(start time.Time, size int) {
+	decodes := d.decodes.Add(1)
+	stats := d.stats
+	stats.bytes.Add(uint64(size))
+	var elapsed time.Duration
+	if !start.IsZero() {
+		elapsed = time.Since(start)
+		stats.latency.record(elapsed)
+	}
+	if stats.window != nil {
+		stats.windowBytes.Add(uint64(size))
+		if !start.IsZero() {
+			stats.windowLatency.record(elapsed)
+		}
+		if stats.windowDecodes.Add(1) == stats.window.Window {
+			d.endWindow()
+		}
+	}
+
+	if d.options.EnablePGO && d.options.RecompileAfter != 0 && decodes == d.options.RecompileAfter {
+		go func() {
+			// Fails only without a profile, in which case there is nothing to do
+			_, _ = proto.GlobalPGOManager.RecompileWithProfile(string(d.descriptor.FullName()))
+		}()
+	}
+}
+
+// countArenaAlloc counts an arena allocated for lack of a pooled one.
+func (d *Decoder) countArenaAlloc() {
+	d.stats.arenaAllocs.Add(1)
+	if d.stats.window != nil {
+		d.stats.windowAllocs.Add(1)
+	}
+}
+
+// endWindow compares the window that just ended with the baseline and
+// starts the next one.
+func (d *Decoder) endWindow() {
+	stats := d.stats
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	sampled, latencies := stats.windowLatency.percentiles(0.5, 0.99)
+	current := WindowStats{
+		Decodes:     stats.windowDecodes.Swap(0),
+		Sampled:     sampled,
+		P50:         latencies[0],
+		P99:         latencies[1],
+		ArenaAllocs: stats.windowAllocs.Swap(0),
+	}
+	current.MeanSize = float64(stats.windowBytes.Swap(0)) / float64(current.Decodes)
+	stats.windowLatency.reset()
+
+	// A recompiled message type gets a new baseline
+	gen := proto.GlobalPGOManager.Generation()
+	if stats.baseline == nil || gen != stats.baselineGen {
+		stats.baseline, stats.baselineGen = &current, gen
+		return
+	}
+	baseline := *stats.baseline
+	if !drifted(baseline, current, stats.window.Threshold) {
+		return
+	}
+	stats.drifts.Add(1)
+	// Report each drift once, against the traffic it drifted to
+	stats.baseline = &current
+
+	policy := stats.window
+	recompile := policy.Recompile && d.options.EnablePGO
+	if !recompile && policy.OnDrift == nil {
+		return
+	}
+	go func() {
+		report := DriftReport{Message: string(d.descriptor.FullName()), Baseline: baseline, Current: current}
+		if recompile {
+			_, err := proto.GlobalPGOManager.RecompileWithProfile(report.Message)
+			report.Recompiled = err == nil
+		}
+		if policy.OnDrift != nil {
+			policy.OnDrift(report)
+		}
+	}()
+}
+
+// drifted reports whether current differs from baseline by more than
+// threshold in mean size, or in median latency when both have enough samples.
+func drifted(baseline, current WindowStats, threshold float64) bool {
+	if baseline.MeanSize > 0 && math.Abs(current.MeanSize-baseline.MeanSize)/baseline.MeanSize > threshold {
+		return true
+	}
+	if baseline.Sampled < minDriftSamples || current.Sampled < minDriftSamples {
+		return false
+	}
+	return float64(current.P50) > float64(baseline.P50)*(1+threshold)
+}
+
+// Stats returns the decode statistics of the message type.
+func (d *Decoder) Stats() DecodeStats {
+	sampled, latencies := d.stats.latency.percentiles(0.5, 0.9, 0.99)
+	return DecodeStats{
+		Decodes:     d.decodes.Load(),
+		Bytes:       d.stats.bytes.Load(),
+		Sampled:     sampled,
+		P50:         latencies[0],
+		P90:         latencies[1],
+		P99:         latencies[2],
+		ArenaAllocs: d.stats.arenaAllocs.Load(),
+		Drifts:      d.stats.drifts.Load(),
+	}
+}
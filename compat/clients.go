@@ -0,0 +1,345 @@
+package compat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// commandClient drives an RPC client installed as an executable.
+type commandClient struct {
+	name   string
+	binary string
+	run    func(ctx context.Context, c *commandClient, check Check, target Target) error
+}
+
+// Name returns the client name.
+func (c *commandClient) Name() string {
+	return c.name
+}
+
+// Available reports whether the executable is in PATH.
+func (c *commandClient) Available() error {
+	if _, err := exec.LookPath(c.binary); err != nil {
+		return fmt.Errorf("%s not found in PATH", c.binary)
+	}
+	return nil
+}
+
+// Run performs a check.
+func (c *commandClient) Run(ctx context.Context, check Check, target Target) error {
+	return c.run(ctx, c, check, target)
+}
+
+// exec runs the executable and returns its combined output. A non-zero exit
+// status is returned as an *exec.ExitError.
+func (c *commandClient) exec(ctx context.Context, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, c.binary, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// call runs the executable and fails with its output if it exits non-zero.
+func (c *commandClient) call(ctx context.Context, stdin string, args ...string) (string, error) {
+	out, err := c.exec(ctx, stdin, args...)
+	if err != nil {
+		return out, fmt.Errorf("%s failed: %w: %s", c.binary, err, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// GRPCurl drives grpcurl (https://github.com/fullstorydev/grpcurl) over gRPC.
+// It does not support request compression.
+func GRPCurl() Client {
+	return &commandClient{name: "grpcurl", binary: "grpcurl", run: runGRPCurl}
+}
+
+func runGRPCurl(ctx context.Context, c *commandClient, check Check, target Target) error {
+	host, secure, err := parseTarget(target.URL)
+	if err != nil {
+		return err
+	}
+	base := []string{}
+	if !secure {
+		base = append(base, "-plaintext")
+	}
+	args := func(extra ...string) []string {
+		return append(append([]string{}, base...), extra...)
+	}
+	method := func(call Call) string {
+		return target.Service + "/" + call.Method
+	}
+
+	switch check {
+	case CheckReflection:
+		out, err := c.call(ctx, "", args(host, "list")...)
+		if err != nil {
+			return err
+		}
+		if !containsLine(out, target.Service) {
+			return fmt.Errorf("service %s not listed: %s", target.Service, strings.TrimSpace(out))
+		}
+		if target.Unary.Method == "" {
+			return nil
+		}
+		out, err = c.call(ctx, "", args(host, "describe", target.Service)...)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(out, "rpc "+target.Unary.Method+" ") {
+			return fmt.Errorf("method %s not described: %s", target.Unary.Method, strings.TrimSpace(out))
+		}
+		return nil
+	case CheckUnary:
+		out, err := c.call(ctx, "", args("-d", target.Unary.Request, host, method(target.Unary))...)
+		if err != nil {
+			return err
+		}
+		return expectMessages(out, target.Unary, false)
+	case CheckStreaming:
+		out, err := c.call(ctx, "", args("-d", target.Stream.Request, host, method(target.Stream))...)
+		if err != nil {
+			return err
+		}
+		return expectMessages(out, target.Stream, true)
+	case CheckErrors:
+		out, err := c.exec(ctx, "", args("-d", target.Error.Request, host, method(target.Error))...)
+		return expectError(out, err, target.ErrorCode)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// BufCurl drives buf curl (https://buf.build/docs/reference/cli/buf/curl).
+// Unary calls are made over the Connect, gRPC, and gRPC-Web protocols; streams
+// over gRPC. It does not support request compression.
+func BufCurl() Client {
+	return &commandClient{name: "buf curl", binary: "buf", run: runBufCurl}
+}
+
+func runBufCurl(ctx context.Context, c *commandClient, check Check, target Target) error {
+	_, secure, err := parseTarget(target.URL)
+	if err != nil {
+		return err
+	}
+	args := func(extra ...string) []string {
+		args := []string{"curl"}
+		if !secure {
+			// Reflection and gRPC need HTTP/2 without TLS
+			args = append(args, "--http2-prior-knowledge")
+		}
+		return append(args, extra...)
+	}
+	methodURL := func(call Call) string {
+		return target.URL + "/" + target.Service + "/" + call.Method
+	}
+
+	switch check {
+	case CheckReflection:
+		out, err := c.call(ctx, "", args("--list-methods", target.URL)...)
+		if err != nil {
+			return err
+		}
+		want := target.Service + "/"
+		if target.Unary.Method != "" {
+			want += target.Unary.Method
+		}
+		if !strings.Contains(out, want) {
+			return fmt.Errorf("%s not listed: %s", want, strings.TrimSpace(out))
+		}
+		return nil
+	case CheckUnary:
+		for _, protocol := range []string{"connect", "grpc", "grpcweb"} {
+			out, err := c.call(ctx, "", args("--protocol", protocol, "-d", target.Unary.Request, methodURL(target.Unary))...)
+			if err != nil {
+				return fmt.Errorf("%s: %w", protocol, err)
+			}
+			if err := expectMessages(out, target.Unary, false); err != nil {
+				return fmt.Errorf("%s: %w", protocol, err)
+			}
+		}
+		return nil
+	case CheckStreaming:
+		out, err := c.call(ctx, "", args("--protocol", "grpc", "-d", target.Stream.Request, methodURL(target.Stream))...)
+		if err != nil {
+			return err
+		}
+		return expectMessages(out, target.Stream, true)
+	case CheckErrors:
+		out, err := c.exec(ctx, "", args("--protocol", "connect", "-d", target.Error.Request, methodURL(target.Error))...)
+		return expectError(out, err, target.ErrorCode)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// Evans drives evans (https://github.com/ktr0731/evans) in CLI mode over gRPC.
+// It does not support request compression.
+func Evans() Client {
+	return &commandClient{name: "evans", binary: "evans", run: runEvans}
+}
+
+func runEvans(ctx context.Context, c *commandClient, check Check, target Target) error {
+	host, secure, err := parseTarget(target.URL)
+	if err != nil {
+		return err
+	}
+	hostname, port, _ := net.SplitHostPort(host)
+	args := func(extra ...string) []string {
+		args := []string{"--host", hostname, "--port", port, "--reflection"}
+		if secure {
+			args = append(args, "--tls")
+		}
+		return append(append(args, "cli"), extra...)
+	}
+	method := func(call Call) string {
+		return target.Service + "." + call.Method
+	}
+
+	switch check {
+	case CheckReflection:
+		out, err := c.call(ctx, "", args("list")...)
+		if err != nil {
+			return err
+		}
+		if !containsLine(out, target.Service) {
+			return fmt.Errorf("service %s not listed: %s", target.Service, strings.TrimSpace(out))
+		}
+		if target.Unary.Method == "" {
+			return nil
+		}
+		out, err = c.call(ctx, "", args("list", target.Service)...)
+		if err != nil {
+			return err
+		}
+		if !containsLine(out, method(target.Unary)) {
+			return fmt.Errorf("method %s not listed: %s", method(target.Unary), strings.TrimSpace(out))
+		}
+		return nil
+	case CheckUnary:
+		out, err := c.call(ctx, target.Unary.Request, args("call", method(target.Unary))...)
+		if err != nil {
+			return err
+		}
+		return expectMessages(out, target.Unary, false)
+	case CheckStreaming:
+		out, err := c.call(ctx, target.Stream.Request, args("call", method(target.Stream))...)
+		if err != nil {
+			return err
+		}
+		return expectMessages(out, target.Stream, true)
+	case CheckErrors:
+		out, err := c.exec(ctx, target.Error.Request, args("call", method(target.Error))...)
+		return expectError(out, err, target.ErrorCode)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// parseTarget splits a target URL into host:port and whether TLS is used.
+func parseTarget(rawURL string) (host string, secure bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("invalid target URL %q", rawURL)
+	}
+	secure = u.Scheme == "https"
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if secure {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), secure, nil
+}
+
+// containsLine reports whether any trimmed line of out equals want.
+func containsLine(out, want string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// expectMessages decodes the JSON messages printed by a client and checks them
+// against the call's expectations.
+func expectMessages(out string, call Call, streaming bool) error {
+	var messages []json.RawMessage
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("unexpected output: %s", strings.TrimSpace(out))
+		}
+		messages = append(messages, msg)
+	}
+	return checkMessages(messages, call, streaming)
+}
+
+// checkMessages checks decoded response messages against the call's expectations.
+func checkMessages(messages []json.RawMessage, call Call, streaming bool) error {
+	switch {
+	case len(messages) == 0:
+		return errors.New("no response messages")
+	case !streaming && len(messages) != 1:
+		return fmt.Errorf("expected 1 response message, got %d", len(messages))
+	case streaming && call.Messages > 0 && len(messages) != call.Messages:
+		return fmt.Errorf("expected %d response messages, got %d", call.Messages, len(messages))
+	}
+	for _, msg := range messages {
+		if !strings.Contains(string(msg), call.Expect) {
+			return fmt.Errorf("response %s does not contain %q", msg, call.Expect)
+		}
+	}
+	return nil
+}
+
+// expectError checks that a client exited with an error reporting the code.
+func expectError(out string, err error, code string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("expected an error, got: %s", strings.TrimSpace(out))
+	}
+	if code == "" {
+		return nil
+	}
+	for _, form := range codeForms(code) {
+		if strings.Contains(out, form) {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected code %s, got: %s", code, strings.TrimSpace(out))
+}
+
+// codeForms returns the spellings of a Connect code used by clients:
+// "not_found" for Connect clients and "NotFound" for gRPC clients.
+func codeForms(code string) []string {
+	var camel strings.Builder
+	for _, part := range strings.Split(code, "_") {
+		if part != "" {
+			camel.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return []string{code, camel.String()}
+}
@@ -0,0 +1,254 @@
+// Package compat verifies that a service works with popular RPC clients.
+//
+// It drives grpcurl, buf curl, evans, and a connect-web compatible client
+// against a running service and asserts that reflection, unary calls, server
+// streaming, errors, and compression behave the way each client expects.
+// Command-line clients that are not installed are skipped, so the suite can run
+// anywhere and becomes stricter as more tools are available.
+//
+//	report, err := compat.Run(ctx, compat.Target{
+//		URL:     "http://localhost:8080",
+//		Service: "user.v1.UserService",
+//		Unary:   compat.Call{Method: "GetUser", Request: `{"id":"1"}`, Expect: `"1"`},
+//	})
+package compat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Check identifies a compatibility assertion.
+type Check string
+
+const (
+	// CheckReflection lists services and methods via gRPC server reflection.
+	CheckReflection Check = "reflection"
+	// CheckUnary performs the target's unary call.
+	CheckUnary Check = "unary"
+	// CheckStreaming performs the target's server-streaming call.
+	CheckStreaming Check = "streaming"
+	// CheckErrors performs the target's failing call and asserts the error code.
+	CheckErrors Check = "errors"
+	// CheckCompression performs the unary call with gzip compression.
+	CheckCompression Check = "compression"
+)
+
+// AllChecks lists every check in execution order.
+var AllChecks = []Check{CheckReflection, CheckUnary, CheckStreaming, CheckErrors, CheckCompression}
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// StatusPass means the client behaved as expected.
+	StatusPass Status = "pass"
+	// StatusFail means the client did not behave as expected.
+	StatusFail Status = "fail"
+	// StatusSkip means the check did not run, e.g. because the client is not installed.
+	StatusSkip Status = "skip"
+)
+
+// ErrUnsupported is returned by a client for checks it cannot perform.
+var ErrUnsupported = errors.New("not supported by client")
+
+// Call describes an RPC performed by a check.
+type Call struct {
+	// Method is the method name within the target service (e.g., "GetUser").
+	Method string
+	// Request is the request message in JSON form.
+	Request string
+	// Expect is a substring every response must contain. Empty accepts any response.
+	Expect string
+	// Messages is the number of messages a streaming call must return.
+	// Zero requires at least one.
+	Messages int
+}
+
+// Target describes the service under test. Checks whose call has no method are skipped.
+type Target struct {
+	// URL is the base URL of the server (e.g., "http://localhost:8080").
+	URL string
+	// Service is the fully-qualified service name (e.g., "user.v1.UserService").
+	Service string
+	// Unary is used by the unary and compression checks.
+	Unary Call
+	// Stream is a server-streaming call used by the streaming check.
+	Stream Call
+	// Error is a call that must fail with ErrorCode.
+	Error Call
+	// ErrorCode is the expected error code in Connect form (e.g., "not_found").
+	ErrorCode string
+}
+
+// call returns the call exercised by a check.
+func (t Target) call(check Check) Call {
+	switch check {
+	case CheckStreaming:
+		return t.Stream
+	case CheckErrors:
+		return t.Error
+	case CheckUnary, CheckCompression:
+		return t.Unary
+	default:
+		return Call{Method: "-"}
+	}
+}
+
+// Client is an RPC client the suite can drive.
+type Client interface {
+	// Name identifies the client in reports.
+	Name() string
+	// Available returns an error if the client cannot run on this machine.
+	Available() error
+	// Run performs a check against the target. It returns ErrUnsupported for
+	// checks the client cannot express.
+	Run(ctx context.Context, check Check, target Target) error
+}
+
+// DefaultClients returns grpcurl, buf curl, evans, and connect-web.
+func DefaultClients() []Client {
+	return []Client{GRPCurl(), BufCurl(), Evans(), ConnectWeb()}
+}
+
+// Result is the outcome of one check for one client.
+type Result struct {
+	Client   string
+	Check    Check
+	Status   Status
+	Detail   string
+	Duration time.Duration
+}
+
+// Report collects the results of a run.
+type Report struct {
+	Results []Result
+}
+
+// Failed reports whether any check failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable writes the results as an aligned table.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "CLIENT\tCHECK\tSTATUS\tDURATION\tDETAIL"); err != nil {
+		return err
+	}
+	for _, result := range r.Results {
+		duration := "-"
+		if result.Status != StatusSkip {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			result.Client, result.Check, result.Status, duration, result.Detail); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// Option configures a run.
+type Option func(*options)
+
+type options struct {
+	clients []Client
+	checks  []Check
+	timeout time.Duration
+}
+
+// defaultCheckTimeout bounds each check.
+const defaultCheckTimeout = 30 * time.Second
+
+// WithClients sets the clients to drive (default: DefaultClients).
+func WithClients(clients ...Client) Option {
+	return func(o *options) {
+		o.clients = clients
+	}
+}
+
+// WithChecks limits the run to the given checks (default: AllChecks).
+func WithChecks(checks ...Check) Option {
+	return func(o *options) {
+		o.checks = checks
+	}
+}
+
+// WithTimeout sets the timeout of each check (default: 30s).
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Run drives every client through every check against the target.
+// An error is returned only for an invalid target; check failures are
+// recorded in the report.
+func Run(ctx context.Context, target Target, opts ...Option) (*Report, error) {
+	o := &options{
+		clients: DefaultClients(),
+		checks:  AllChecks,
+		timeout: defaultCheckTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if target.URL == "" {
+		return nil, errors.New("compat: target URL is required")
+	}
+	if target.Service == "" {
+		return nil, errors.New("compat: target service is required")
+	}
+	target.URL = strings.TrimSuffix(target.URL, "/")
+
+	report := &Report{}
+	for _, client := range o.clients {
+		availability := client.Available()
+		for _, check := range o.checks {
+			result := Result{Client: client.Name(), Check: check}
+			switch {
+			case availability != nil:
+				result.Status = StatusSkip
+				result.Detail = availability.Error()
+			case target.call(check).Method == "":
+				result.Status = StatusSkip
+				result.Detail = "no call configured"
+			default:
+				result.Status, result.Detail, result.Duration = runCheck(ctx, client, check, target, o.timeout)
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	return report, nil
+}
+
+// runCheck runs a single check with a timeout.
+func runCheck(ctx context.Context, client Client, check Check, target Target, timeout time.Duration) (Status, string, time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Run(ctx, check, target)
+	elapsed := time.Since(start)
+
+	switch {
+	case err == nil:
+		return StatusPass, "", elapsed
+	case errors.Is(err, ErrUnsupported):
+		return StatusSkip, err.Error(), elapsed
+	default:
+		return StatusFail, err.Error(), elapsed
+	}
+}
@@ -0,0 +1,88 @@
+package compat_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/compat"
+)
+
+func startSample(t *testing.T) *compat.SampleServer {
+	t.Helper()
+	server, err := compat.StartSample("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start sample: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close(context.Background()) })
+	return server
+}
+
+func TestRunAgainstSample(t *testing.T) {
+	server := startSample(t)
+
+	report, err := compat.Run(context.Background(), server.Target())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var table bytes.Buffer
+	if err := report.WriteTable(&table); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if report.Failed() {
+		t.Errorf("Compatibility checks failed:\n%s", table.String())
+	}
+	t.Logf("\n%s", table.String())
+
+	// connect-web needs no external tools, so its checks always run
+	for _, result := range report.Results {
+		if result.Client != "connect-web" {
+			continue
+		}
+		want := compat.StatusPass
+		if result.Check == compat.CheckReflection {
+			want = compat.StatusSkip
+		}
+		if result.Status != want {
+			t.Errorf("connect-web %s: expected %s, got %s (%s)", result.Check, want, result.Status, result.Detail)
+		}
+	}
+}
+
+func TestRunDetectsFailures(t *testing.T) {
+	server := startSample(t)
+
+	target := server.Target()
+	target.Unary.Expect = "not in the response"
+	target.ErrorCode = "permission_denied"
+
+	report, err := compat.Run(context.Background(), target,
+		compat.WithClients(compat.ConnectWeb()),
+		compat.WithChecks(compat.CheckUnary, compat.CheckErrors),
+	)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(report.Results))
+	}
+	for _, result := range report.Results {
+		if result.Status != compat.StatusFail {
+			t.Errorf("%s: expected failure, got %s", result.Check, result.Status)
+		}
+	}
+	if !strings.Contains(report.Results[1].Detail, "not_found") {
+		t.Errorf("Expected actual code in detail, got %q", report.Results[1].Detail)
+	}
+}
+
+func TestRunRequiresTarget(t *testing.T) {
+	if _, err := compat.Run(context.Background(), compat.Target{Service: "a.B"}); err == nil {
+		t.Error("Expected error for missing URL")
+	}
+	if _, err := compat.Run(context.Background(), compat.Target{URL: "http://localhost"}); err == nil {
+		t.Error("Expected error for missing service")
+	}
+}
@@ -0,0 +1,265 @@
+package compat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Connect streaming envelope flags.
+const (
+	envelopeFlagCompressed = 0x01
+	envelopeFlagEndStream  = 0x02
+)
+
+// connectWebClient issues the requests the connect-web transport sends from a
+// browser: the Connect protocol with JSON over HTTP/1.1, using fetch semantics.
+type connectWebClient struct {
+	httpClient *http.Client
+}
+
+// ConnectWeb returns a client that reproduces the wire behavior of
+// @connectrpc/connect-web's Connect transport with the JSON format, so browser
+// compatibility can be verified without a browser or Node.js toolchain.
+// connect-web has no reflection support, so the reflection check is skipped.
+func ConnectWeb() Client {
+	return &connectWebClient{
+		httpClient: &http.Client{
+			// Compression is negotiated explicitly by the compression check
+			Transport: &http.Transport{DisableCompression: true},
+		},
+	}
+}
+
+// Name returns the client name.
+func (c *connectWebClient) Name() string {
+	return "connect-web"
+}
+
+// Available always succeeds; the client needs no external tools.
+func (c *connectWebClient) Available() error {
+	return nil
+}
+
+// Run performs a check.
+func (c *connectWebClient) Run(ctx context.Context, check Check, target Target) error {
+	switch check {
+	case CheckUnary:
+		msg, err := c.unary(ctx, target, target.Unary, false)
+		if err != nil {
+			return err
+		}
+		return checkMessages([]json.RawMessage{msg}, target.Unary, false)
+	case CheckCompression:
+		msg, err := c.unary(ctx, target, target.Unary, true)
+		if err != nil {
+			return err
+		}
+		return checkMessages([]json.RawMessage{msg}, target.Unary, false)
+	case CheckStreaming:
+		return c.stream(ctx, target)
+	case CheckErrors:
+		return c.expectError(ctx, target)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// connectError is the JSON error object of the Connect protocol.
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// unary performs a Connect unary call and returns the response body.
+func (c *connectWebClient) unary(ctx context.Context, target Target, call Call, compress bool) (json.RawMessage, error) {
+	body := []byte(call.Request)
+	if compress {
+		var err error
+		if body, err = gzipBytes(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		target.URL+"/"+target.Service+"/"+call.Method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := readBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON response: %s", data)
+	}
+	var cerr connectError
+	if json.Unmarshal(data, &cerr) == nil && cerr.Code != "" {
+		return nil, fmt.Errorf("unexpected error %s: %s", cerr.Code, cerr.Message)
+	}
+	return data, nil
+}
+
+// expectError performs the failing call and checks the Connect error code.
+func (c *connectWebClient) expectError(ctx context.Context, target Target) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		target.URL+"/"+target.Service+"/"+target.Error.Method, strings.NewReader(target.Error.Request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := readBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return err
+	}
+	var cerr connectError
+	if err := json.Unmarshal(data, &cerr); err != nil || cerr.Code == "" {
+		return fmt.Errorf("expected a Connect error, got HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if target.ErrorCode != "" && cerr.Code != target.ErrorCode {
+		return fmt.Errorf("expected code %s, got %s: %s", target.ErrorCode, cerr.Code, cerr.Message)
+	}
+	return nil
+}
+
+// stream performs a Connect server-streaming call.
+func (c *connectWebClient) stream(ctx context.Context, target Target) error {
+	var body bytes.Buffer
+	writeEnvelope(&body, 0, []byte(target.Stream.Request))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		target.URL+"/"+target.Service+"/"+target.Stream.Method, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/connect+json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var messages []json.RawMessage
+	for {
+		flags, data, err := readEnvelope(resp.Body)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("stream ended without an end-stream message")
+			}
+			return err
+		}
+		if flags&envelopeFlagCompressed != 0 {
+			if data, err = gunzipBytes(data); err != nil {
+				return err
+			}
+		}
+		if flags&envelopeFlagEndStream == 0 {
+			messages = append(messages, data)
+			continue
+		}
+
+		var end struct {
+			Error *connectError `json:"error"`
+		}
+		if err := json.Unmarshal(data, &end); err != nil {
+			return fmt.Errorf("invalid end-stream message: %s", data)
+		}
+		if end.Error != nil {
+			return fmt.Errorf("stream failed with %s: %s", end.Error.Code, end.Error.Message)
+		}
+		return checkMessages(messages, target.Stream, true)
+	}
+}
+
+// writeEnvelope writes a Connect streaming envelope.
+func writeEnvelope(w *bytes.Buffer, flags byte, data []byte) {
+	var header [5]byte
+	header[0] = flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data))) //nolint:gosec // request messages are small
+	w.Write(header[:])
+	w.Write(data)
+}
+
+// readEnvelope reads a Connect streaming envelope.
+func readEnvelope(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, fmt.Errorf("truncated envelope: %w", err)
+	}
+	return header[0], data, nil
+}
+
+// readBody reads a response body, decompressing it if needed.
+func readBody(r io.Reader, encoding string) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == "gzip" {
+		return gunzipBytes(data)
+	}
+	return data, nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+	return io.ReadAll(zr)
+}
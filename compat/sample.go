@@ -0,0 +1,144 @@
+package compat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// SampleServiceName is the fully-qualified name of the sample service.
+const SampleServiceName = "hyperway.compat.v1.CompatService"
+
+// EchoRequest is the request of the sample Echo method.
+type EchoRequest struct {
+	Message string `json:"message"`
+}
+
+// EchoResponse is the response of the sample Echo method.
+type EchoResponse struct {
+	Message string `json:"message"`
+}
+
+// CountRequest is the request of the sample Count method.
+type CountRequest struct {
+	Count int32 `json:"count"`
+}
+
+// CountResponse is a message of the sample Count stream.
+type CountResponse struct {
+	Number int32 `json:"number"`
+}
+
+// FailRequest is the request of the sample Fail method.
+type FailRequest struct {
+	Reason string `json:"reason"`
+}
+
+// FailResponse is the response of the sample Fail method, which is never sent.
+type FailResponse struct{}
+
+// NewSampleService creates the service the suite runs against when no target
+// is given. It exposes Echo (unary), Count (server streaming), and Fail (always
+// returns not_found), with reflection enabled.
+func NewSampleService() *rpc.Service {
+	svc := rpc.NewService("CompatService",
+		rpc.WithPackage("hyperway.compat.v1"),
+		rpc.WithReflection(true),
+	)
+
+	rpc.MustRegister(svc, "Echo", func(ctx context.Context, req *EchoRequest) (*EchoResponse, error) {
+		return &EchoResponse{Message: req.Message}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "Count", func(ctx context.Context, req *CountRequest, stream rpc.ServerStream[CountResponse]) error {
+		for i := int32(1); i <= req.Count; i++ {
+			if err := stream.Send(&CountResponse{Number: i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	rpc.MustRegister(svc, "Fail", func(ctx context.Context, req *FailRequest) (*FailResponse, error) {
+		return nil, rpc.NewError(rpc.CodeNotFound, "compat: "+req.Reason)
+	})
+
+	return svc
+}
+
+// SampleTarget returns the target describing the sample service served at url.
+func SampleTarget(url string) Target {
+	return Target{
+		URL:     url,
+		Service: SampleServiceName,
+		Unary: Call{
+			Method:  "Echo",
+			Request: `{"message":"hello compat"}`,
+			Expect:  "hello compat",
+		},
+		Stream: Call{
+			Method:   "Count",
+			Request:  `{"count":3}`,
+			Expect:   "number",
+			Messages: 3,
+		},
+		Error: Call{
+			Method:  "Fail",
+			Request: `{"reason":"missing"}`,
+		},
+		ErrorCode: string(rpc.CodeNotFound),
+	}
+}
+
+// SampleServer is a running sample service.
+type SampleServer struct {
+	// URL is the base URL of the server.
+	URL string
+
+	server *http.Server
+}
+
+// StartSample serves the sample service on addr (e.g., "127.0.0.1:0") with
+// HTTP/1.1 and HTTP/2 without TLS, so every client can reach it.
+func StartSample(addr string) (*SampleServer, error) {
+	gw, err := rpc.NewGateway(NewSampleService())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gateway: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           h2c.NewHandler(gw, &http2.Server{}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = listener.Close()
+		}
+	}()
+
+	return &SampleServer{
+		URL:    "http://" + listener.Addr().String(),
+		server: server,
+	}, nil
+}
+
+// Target returns the target describing the running sample service.
+func (s *SampleServer) Target() Target {
+	return SampleTarget(s.URL)
+}
+
+// Close shuts the server down.
+func (s *SampleServer) Close(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
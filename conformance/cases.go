@@ -0,0 +1,151 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Case parameters
+const (
+	largeSize       = 1 << 20 // Bytes of the large messages
+	compressedSize  = 1 << 10 // Bytes of the compressed payload
+	streamCount     = 5
+	streamSize      = 16
+	sleepMillis     = 2000 // Server delay of the deadline case
+	deadlineMillis  = 100  // Client deadline of the deadline case
+	echoValue       = "hyperway"
+	errorMessage    = "conformance error"
+	unaryPayload    = "hello conformance"
+	payloadField    = "payload"
+	indexField      = "index"
+	errorCodeField  = "error_code"
+	errorMsgField   = "error_message"
+	respSizeField   = "response_size"
+	sleepField      = "sleep_millis"
+	countField      = "count"
+	streamSizeField = "size"
+)
+
+// caseFunc checks a feature with a client.
+type caseFunc func(ctx context.Context, c client) error
+
+// cases are the checks of each feature.
+var cases = map[Feature]caseFunc{
+	FeatureUnary: func(ctx context.Context, c client) error {
+		return expectPayload(ctx, c, call{method: methodUnary, req: unaryRequest(map[string]any{payloadField: unaryPayload})}, unaryPayload)
+	},
+	FeatureEmpty: func(ctx context.Context, c client) error {
+		return expectPayload(ctx, c, call{method: methodUnary, req: unaryRequest(nil)}, "")
+	},
+	FeatureLarge: func(ctx context.Context, c client) error {
+		req := unaryRequest(map[string]any{payloadField: strings.Repeat("y", largeSize), respSizeField: int32(largeSize)})
+		return expectPayload(ctx, c, call{method: methodUnary, req: req}, strings.Repeat("x", largeSize))
+	},
+	FeatureServerStream: func(ctx context.Context, c client) error {
+		req := newRequest(methodStream, map[string]any{countField: int32(streamCount), streamSizeField: int32(streamSize)})
+		r, err := c.serverStream(ctx, call{method: methodStream, req: req})
+		if err != nil {
+			return err
+		}
+		if len(r.messages) != streamCount {
+			return fmt.Errorf("expected %d messages, got %d", streamCount, len(r.messages))
+		}
+		for i, msg := range r.messages {
+			if index := get(msg, indexField).Int(); index != int64(i) {
+				return fmt.Errorf("message %d has index %d", i, index)
+			}
+			if payload := get(msg, payloadField).String(); len(payload) != streamSize {
+				return fmt.Errorf("message %d has a %d-byte payload, expected %d", i, len(payload), streamSize)
+			}
+		}
+		return nil
+	},
+	FeatureErrors: func(ctx context.Context, c client) error {
+		req := unaryRequest(map[string]any{errorCodeField: connect.CodeNotFound.String(), errorMsgField: errorMessage})
+		_, err := c.unary(ctx, call{method: methodUnary, req: req})
+		if err := expectCode(err, connect.CodeNotFound); err != nil {
+			return err
+		}
+		var connectErr *connect.Error
+		if errors.As(err, &connectErr) && connectErr.Message() != errorMessage {
+			return fmt.Errorf("expected message %q, got %q", errorMessage, connectErr.Message())
+		}
+		return nil
+	},
+	FeatureMetadata: func(ctx context.Context, c client) error {
+		r, err := c.unary(ctx, call{method: methodUnary, req: unaryRequest(nil), echo: echoValue})
+		if err != nil {
+			return err
+		}
+		if r.header != echoValue {
+			return fmt.Errorf("expected header %s: %s, got %q", EchoHeader, echoValue, r.header)
+		}
+		if r.trailer != echoValue {
+			return fmt.Errorf("expected trailer %s: %s, got %q", EchoTrailer, echoValue, r.trailer)
+		}
+		return nil
+	},
+	FeatureDeadline: func(ctx context.Context, c client) error {
+		ctx, cancel := context.WithTimeout(ctx, deadlineMillis*time.Millisecond)
+		defer cancel()
+		_, err := c.unary(ctx, call{method: methodUnary, req: unaryRequest(map[string]any{sleepField: int32(sleepMillis)})})
+		return expectCode(err, connect.CodeDeadlineExceeded)
+	},
+	FeatureCompression: func(ctx context.Context, c client) error {
+		payload := strings.Repeat("z", compressedSize)
+		return expectPayload(ctx, c, call{method: methodUnary, req: unaryRequest(map[string]any{payloadField: payload}), gzip: true}, payload)
+	},
+}
+
+// newRequest creates a request of a method with the given fields.
+func newRequest(method string, fields map[string]any) *dynamicpb.Message {
+	methods, _ := serviceMethods() // Checked by Run
+	msg := dynamicpb.NewMessage(methods.ByName(protoreflect.Name(method)).Input())
+	for name, value := range fields {
+		msg.Set(msg.Descriptor().Fields().ByName(protoreflect.Name(name)), protoreflect.ValueOf(value))
+	}
+	return msg
+}
+
+// unaryRequest creates a request of the Unary method.
+func unaryRequest(fields map[string]any) *dynamicpb.Message {
+	return newRequest(methodUnary, fields)
+}
+
+// get returns a field of a message.
+func get(msg *dynamicpb.Message, name string) protoreflect.Value {
+	return msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+// expectPayload makes a unary call and checks the payload of the response.
+func expectPayload(ctx context.Context, c client, cl call, want string) error {
+	r, err := c.unary(ctx, cl)
+	if err != nil {
+		return err
+	}
+	if got := get(r.messages[0], payloadField).String(); got != want {
+		if len(got) > len(unaryPayload) || len(want) > len(unaryPayload) {
+			return fmt.Errorf("expected a %d-byte payload, got %d bytes", len(want), len(got))
+		}
+		return fmt.Errorf("expected payload %q, got %q", want, got)
+	}
+	return nil
+}
+
+// expectCode checks that a call failed with code.
+func expectCode(err error, code connect.Code) error {
+	if err == nil {
+		return fmt.Errorf("expected %s, got a response", code)
+	}
+	if got := connect.CodeOf(err); got != code {
+		return fmt.Errorf("expected %s, got %s: %w", code, got, err)
+	}
+	return nil
+}
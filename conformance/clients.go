@@ -0,0 +1,255 @@
+package conformance
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Methods of the conformance service
+const (
+	methodUnary  = "Unary"
+	methodStream = "ServerStream"
+)
+
+// call is a call made by a case.
+type call struct {
+	method string
+	req    *dynamicpb.Message
+	echo   string // Value of the EchoHeader request header
+	gzip   bool
+}
+
+// reply is the outcome of a call. Errors are connect errors, whatever the
+// client.
+type reply struct {
+	messages []*dynamicpb.Message
+	header   string // Value of the EchoHeader response header
+	trailer  string // Value of the EchoTrailer response trailer
+}
+
+// client makes calls with a protocol.
+type client interface {
+	unary(ctx context.Context, c call) (reply, error)
+	serverStream(ctx context.Context, c call) (reply, error)
+	close()
+}
+
+// serviceMethods returns the method descriptors of the conformance service,
+// which clients build dynamic messages from.
+var serviceMethods = sync.OnceValues(func() (protoreflect.MethodDescriptors, error) {
+	files, err := protodesc.NewFiles(NewService().GetFileDescriptorSet())
+	if err != nil {
+		return nil, fmt.Errorf("conformance: invalid service descriptors: %w", err)
+	}
+	desc, err := files.FindDescriptorByName(ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: %w", err)
+	}
+	return desc.(protoreflect.ServiceDescriptor).Methods(), nil //nolint:forcetypeassert // ServiceName is a service
+})
+
+// newClient creates the client of a protocol.
+func newClient(protocol Protocol, url string, methods protoreflect.MethodDescriptors) (client, error) {
+	switch protocol {
+	case ProtocolConnect:
+		return newConnectClient(url, methods), nil
+	case ProtocolConnectJSON:
+		return newConnectClient(url, methods, connect.WithProtoJSON()), nil
+	case ProtocolGRPC:
+		return newConnectClient(url, methods, connect.WithGRPC()), nil
+	case ProtocolGRPCWeb:
+		return newConnectClient(url, methods, connect.WithGRPCWeb()), nil
+	case ProtocolGRPCGo:
+		return newGRPCClient(url, methods)
+	default:
+		return nil, fmt.Errorf("conformance: unknown protocol %q", protocol)
+	}
+}
+
+// connectClient is connect-go with a protocol.
+type connectClient struct {
+	url        string
+	methods    protoreflect.MethodDescriptors
+	httpClient *http.Client
+	opts       []connect.ClientOption
+}
+
+func newConnectClient(url string, methods protoreflect.MethodDescriptors, opts ...connect.ClientOption) *connectClient {
+	// HTTP/2 without TLS, which the gRPC protocol requires
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	return &connectClient{
+		url:        url,
+		methods:    methods,
+		httpClient: &http.Client{Transport: transport},
+		opts:       opts,
+	}
+}
+
+func (c *connectClient) client(cl call) *connect.Client[dynamicpb.Message, dynamicpb.Message] {
+	md := c.methods.ByName(protoreflect.Name(cl.method))
+	opts := append([]connect.ClientOption{
+		connect.WithSchema(md),
+		connect.WithResponseInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(md.Output()) //nolint:forcetypeassert // Clients only receive dynamic messages
+			return nil
+		}),
+	}, c.opts...)
+	if cl.gzip {
+		opts = append(opts, connect.WithSendGzip())
+	}
+	return connect.NewClient[dynamicpb.Message, dynamicpb.Message](c.httpClient, c.url+"/"+ServiceName+"/"+cl.method, opts...)
+}
+
+func (c *connectClient) request(cl call) *connect.Request[dynamicpb.Message] {
+	req := connect.NewRequest(cl.req)
+	if cl.echo != "" {
+		req.Header().Set(EchoHeader, cl.echo)
+	}
+	return req
+}
+
+func (c *connectClient) unary(ctx context.Context, cl call) (reply, error) {
+	resp, err := c.client(cl).CallUnary(ctx, c.request(cl))
+	if err != nil {
+		return reply{}, err
+	}
+	return reply{
+		messages: []*dynamicpb.Message{resp.Msg},
+		header:   resp.Header().Get(EchoHeader),
+		trailer:  resp.Trailer().Get(EchoTrailer),
+	}, nil
+}
+
+func (c *connectClient) serverStream(ctx context.Context, cl call) (reply, error) {
+	stream, err := c.client(cl).CallServerStream(ctx, c.request(cl))
+	if err != nil {
+		return reply{}, err
+	}
+	defer func() { _ = stream.Close() }()
+	var r reply
+	for stream.Receive() {
+		r.messages = append(r.messages, stream.Msg())
+	}
+	if err := stream.Err(); err != nil {
+		return reply{}, err
+	}
+	r.header = stream.ResponseHeader().Get(EchoHeader)
+	r.trailer = stream.ResponseTrailer().Get(EchoTrailer)
+	return r, nil
+}
+
+func (c *connectClient) close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// grpcClient is grpc-go.
+type grpcClient struct {
+	conn    *grpc.ClientConn
+	methods protoreflect.MethodDescriptors
+}
+
+func newGRPCClient(url string, methods protoreflect.MethodDescriptors) (*grpcClient, error) {
+	target, ok := strings.CutPrefix(url, "http://")
+	if !ok {
+		return nil, fmt.Errorf("conformance: grpc-go needs an http:// URL, got %s", url)
+	}
+	conn, err := grpc.NewClient("passthrough:///"+target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("conformance: %w", err)
+	}
+	return &grpcClient{conn: conn, methods: methods}, nil
+}
+
+// prepare returns the context and options of a call.
+func (c *grpcClient) prepare(ctx context.Context, cl call, header, trailer *metadata.MD) (context.Context, []grpc.CallOption) {
+	if cl.echo != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, EchoHeader, cl.echo)
+	}
+	opts := []grpc.CallOption{grpc.Header(header), grpc.Trailer(trailer)}
+	if cl.gzip {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+	return ctx, opts
+}
+
+func (c *grpcClient) unary(ctx context.Context, cl call) (reply, error) {
+	var header, trailer metadata.MD
+	ctx, opts := c.prepare(ctx, cl, &header, &trailer)
+	resp := dynamicpb.NewMessage(c.methods.ByName(protoreflect.Name(cl.method)).Output())
+	if err := c.conn.Invoke(ctx, "/"+ServiceName+"/"+cl.method, cl.req, resp, opts...); err != nil {
+		return reply{}, connectError(err)
+	}
+	return reply{messages: []*dynamicpb.Message{resp}, header: first(header, EchoHeader), trailer: first(trailer, EchoTrailer)}, nil
+}
+
+func (c *grpcClient) serverStream(ctx context.Context, cl call) (reply, error) {
+	var header, trailer metadata.MD
+	ctx, opts := c.prepare(ctx, cl, &header, &trailer)
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/"+ServiceName+"/"+cl.method, opts...)
+	if err != nil {
+		return reply{}, connectError(err)
+	}
+	if err := stream.SendMsg(cl.req); err != nil {
+		return reply{}, connectError(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return reply{}, connectError(err)
+	}
+	output := c.methods.ByName(protoreflect.Name(cl.method)).Output()
+	var r reply
+	for {
+		msg := dynamicpb.NewMessage(output)
+		err := stream.RecvMsg(msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return reply{}, connectError(err)
+		}
+		r.messages = append(r.messages, msg)
+	}
+	r.header, r.trailer = first(header, EchoHeader), first(trailer, EchoTrailer)
+	return r, nil
+}
+
+func (c *grpcClient) close() {
+	_ = c.conn.Close()
+}
+
+// connectError converts a gRPC status error to a connect error; the codes
+// are the same.
+func connectError(err error) error {
+	st := status.Convert(err)
+	return connect.NewError(connect.Code(st.Code()), errors.New(st.Message())) //nolint:gosec // gRPC codes are small
+}
+
+// first returns the first value of key in md.
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
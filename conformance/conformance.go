@@ -0,0 +1,274 @@
+// Package conformance checks that hyperway speaks Connect, gRPC, and gRPC-Web
+// the way the reference implementations expect.
+//
+// It drives connect-go over each of its protocols and grpc-go with the cases
+// of the gRPC interop suite against the conformance service, and reports a
+// matrix of features per protocol. The official Connect conformance runner,
+// connectconformance, is run as well when it is installed and configured.
+//
+//	server, _ := conformance.Start("127.0.0.1:0")
+//	defer server.Close(ctx)
+//	report, err := conformance.Run(ctx, server.URL)
+//	report.WriteMatrix(os.Stdout)
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Protocol identifies a client and the protocol it speaks.
+type Protocol string
+
+const (
+	// ProtocolConnect is connect-go with the Connect protocol and binary messages.
+	ProtocolConnect Protocol = "connect"
+	// ProtocolConnectJSON is connect-go with the Connect protocol and JSON messages.
+	ProtocolConnectJSON Protocol = "connect+json"
+	// ProtocolGRPC is connect-go with the gRPC protocol.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolGRPCWeb is connect-go with the gRPC-Web protocol.
+	ProtocolGRPCWeb Protocol = "grpc-web"
+	// ProtocolGRPCGo is grpc-go, running the gRPC interop cases.
+	ProtocolGRPCGo Protocol = "grpc-go"
+)
+
+// AllProtocols lists every protocol in report order.
+var AllProtocols = []Protocol{ProtocolConnect, ProtocolConnectJSON, ProtocolGRPC, ProtocolGRPCWeb, ProtocolGRPCGo}
+
+// Feature identifies a conformance case, named after the gRPC interop case
+// it follows where there is one.
+type Feature string
+
+const (
+	// FeatureUnary echoes a payload.
+	FeatureUnary Feature = "unary"
+	// FeatureEmpty sends and receives empty messages (interop: empty_unary).
+	FeatureEmpty Feature = "empty"
+	// FeatureLarge sends and receives 1 MiB messages (interop: large_unary).
+	FeatureLarge Feature = "large"
+	// FeatureServerStream receives a server stream (interop: server_streaming).
+	FeatureServerStream Feature = "server-stream"
+	// FeatureErrors receives an error code and message (interop: status_code_and_message).
+	FeatureErrors Feature = "errors"
+	// FeatureMetadata has a request header echoed in a header and a trailer (interop: custom_metadata).
+	FeatureMetadata Feature = "metadata"
+	// FeatureDeadline times out on a sleeping server (interop: timeout_on_sleeping_server).
+	FeatureDeadline Feature = "deadline"
+	// FeatureCompression sends a gzip-compressed request (interop: client_compressed_unary).
+	FeatureCompression Feature = "compression"
+)
+
+// AllFeatures lists every feature in report order.
+var AllFeatures = []Feature{
+	FeatureUnary, FeatureEmpty, FeatureLarge, FeatureServerStream,
+	FeatureErrors, FeatureMetadata, FeatureDeadline, FeatureCompression,
+}
+
+// Status is the outcome of a case.
+type Status string
+
+const (
+	// StatusPass means the client behaved as expected.
+	StatusPass Status = "pass"
+	// StatusFail means the client did not behave as expected.
+	StatusFail Status = "fail"
+	// StatusSkip means the case did not run.
+	StatusSkip Status = "skip"
+)
+
+// Result is the outcome of one feature for one protocol.
+type Result struct {
+	Protocol Protocol
+	Feature  Feature
+	Status   Status
+	Detail   string
+	Duration time.Duration
+}
+
+// Report collects the results of a run.
+type Report struct {
+	Protocols []Protocol
+	Features  []Feature
+	Results   []Result
+	// Suite is the result of the official Connect conformance runner, or nil
+	// if it was not configured.
+	Suite *Result
+}
+
+// Failed reports whether any case failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return r.Suite != nil && r.Suite.Status == StatusFail
+}
+
+// Result returns the result of a feature for a protocol.
+func (r *Report) Result(protocol Protocol, feature Feature) (Result, bool) {
+	for _, result := range r.Results {
+		if result.Protocol == protocol && result.Feature == feature {
+			return result, true
+		}
+	}
+	return Result{}, false
+}
+
+// WriteMatrix writes the compatibility matrix, a row per protocol and a
+// column per feature, followed by the details of failures and the result of
+// the Connect conformance runner.
+func (r *Report) WriteMatrix(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"PROTOCOL"}
+	for _, feature := range r.Features {
+		header = append(header, strings.ToUpper(string(feature)))
+	}
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, protocol := range r.Protocols {
+		row := []string{string(protocol)}
+		for _, feature := range r.Features {
+			result, _ := r.Result(protocol, feature)
+			row = append(row, string(result.Status))
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, result := range r.Results {
+		if result.Status != StatusFail {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\n%s %s: %s", result.Protocol, result.Feature, result.Detail); err != nil {
+			return err
+		}
+	}
+	if r.Suite != nil {
+		line := fmt.Sprintf("\n\nconnectconformance: %s", r.Suite.Status)
+		if r.Suite.Detail != "" {
+			line += " (" + r.Suite.Detail + ")"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Option configures a run.
+type Option func(*options)
+
+type options struct {
+	protocols []Protocol
+	features  []Feature
+	timeout   time.Duration
+	suite     []string
+}
+
+// defaultCaseTimeout bounds each case.
+const defaultCaseTimeout = 30 * time.Second
+
+// WithProtocols limits the run to the given protocols (default: AllProtocols).
+func WithProtocols(protocols ...Protocol) Option {
+	return func(o *options) {
+		o.protocols = protocols
+	}
+}
+
+// WithFeatures limits the run to the given features (default: AllFeatures).
+func WithFeatures(features ...Feature) Option {
+	return func(o *options) {
+		o.features = features
+	}
+}
+
+// WithTimeout sets the timeout of each case (default: 30s).
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithConnectSuite runs the official Connect conformance runner with the
+// given command line, such as
+//
+//	connectconformance --mode server --conf config.yaml -- ./server-under-test
+//
+// The runner starts and checks a server under test implementing
+// connectrpc.conformance.v1.ConformanceService. It is skipped if the
+// command is not installed.
+func WithConnectSuite(command ...string) Option {
+	return func(o *options) {
+		o.suite = command
+	}
+}
+
+// Run checks every feature over every protocol against the conformance
+// service served at url. An error is returned only for an invalid target;
+// failures are recorded in the report.
+func Run(ctx context.Context, url string, opts ...Option) (*Report, error) {
+	o := &options{
+		protocols: AllProtocols,
+		features:  AllFeatures,
+		timeout:   defaultCaseTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if url == "" {
+		return nil, errors.New("conformance: URL is required")
+	}
+
+	methods, err := serviceMethods()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Protocols: o.protocols, Features: o.features}
+	for _, protocol := range o.protocols {
+		c, err := newClient(protocol, strings.TrimSuffix(url, "/"), methods)
+		if err != nil {
+			return nil, err
+		}
+		for _, feature := range o.features {
+			result := Result{Protocol: protocol, Feature: feature}
+			result.Status, result.Detail, result.Duration = runCase(ctx, c, feature, o.timeout)
+			report.Results = append(report.Results, result)
+		}
+		c.close()
+	}
+	if len(o.suite) > 0 {
+		report.Suite = runConnectSuite(ctx, o.suite)
+	}
+	return report, nil
+}
+
+// runCase runs a single case with a timeout.
+func runCase(ctx context.Context, c client, feature Feature, timeout time.Duration) (Status, string, time.Duration) {
+	check, ok := cases[feature]
+	if !ok {
+		return StatusSkip, "unknown feature", 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx, c)
+	elapsed := time.Since(start)
+	if err != nil {
+		return StatusFail, err.Error(), elapsed
+	}
+	return StatusPass, "", elapsed
+}
@@ -0,0 +1,70 @@
+package conformance_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/compat"
+	"github.com/i2y/hyperway/conformance"
+)
+
+func TestRunAgainstService(t *testing.T) {
+	server, err := conformance.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close(context.Background()) })
+
+	report, err := conformance.Run(context.Background(), server.URL,
+		conformance.WithConnectSuite("connectconformance-not-installed", "--mode", "server"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var matrix bytes.Buffer
+	if err := report.WriteMatrix(&matrix); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if report.Failed() {
+		t.Errorf("Conformance cases failed:\n%s", matrix.String())
+	}
+	t.Logf("\n%s", matrix.String())
+
+	if want := len(conformance.AllProtocols) * len(conformance.AllFeatures); len(report.Results) != want {
+		t.Errorf("Expected %d results, got %d", want, len(report.Results))
+	}
+	if report.Suite == nil || report.Suite.Status != conformance.StatusSkip {
+		t.Errorf("Expected the missing runner to be skipped, got %+v", report.Suite)
+	}
+}
+
+func TestRunDetectsFailures(t *testing.T) {
+	// The compat sample is not the conformance service, so every call fails
+	sample, err := compat.StartSample("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start sample: %v", err)
+	}
+	t.Cleanup(func() { _ = sample.Close(context.Background()) })
+
+	report, err := conformance.Run(context.Background(), sample.URL,
+		conformance.WithProtocols(conformance.ProtocolConnect, conformance.ProtocolGRPCGo),
+		conformance.WithFeatures(conformance.FeatureUnary),
+	)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(report.Results) != 2 || !report.Failed() {
+		t.Fatalf("Expected 2 failures, got %+v", report.Results)
+	}
+	for _, result := range report.Results {
+		if !strings.Contains(result.Detail, "unimplemented") {
+			t.Errorf("%s: expected an unimplemented error, got %q", result.Protocol, result.Detail)
+		}
+	}
+
+	if _, err := conformance.Run(context.Background(), ""); err == nil {
+		t.Error("Expected error for missing URL")
+	}
+}
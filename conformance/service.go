@@ -0,0 +1,150 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// ServiceName is the fully-qualified name of the conformance service.
+const ServiceName = "hyperway.conformance.v1.ConformanceService"
+
+// Metadata keys echoed by the conformance service: the value of the EchoHeader
+// request header is returned in the EchoHeader response header and the
+// EchoTrailer response trailer.
+const (
+	EchoHeader  = "x-conformance-echo"
+	EchoTrailer = "x-conformance-echo-trailer"
+)
+
+// UnaryRequest is the request of the Unary method.
+type UnaryRequest struct {
+	// Payload is echoed in the response unless ResponseSize is set.
+	Payload string `json:"payload"`
+	// ResponseSize is the size of the response payload.
+	ResponseSize int32 `json:"responseSize"`
+	// ErrorCode makes the call fail with this code (e.g., "not_found").
+	ErrorCode string `json:"errorCode"`
+	// ErrorMessage is the message of the error.
+	ErrorMessage string `json:"errorMessage"`
+	// SleepMillis delays the response, or the deadline of the call.
+	SleepMillis int32 `json:"sleepMillis"`
+}
+
+// UnaryResponse is the response of the Unary method.
+type UnaryResponse struct {
+	Payload string `json:"payload"`
+}
+
+// StreamRequest is the request of the ServerStream method.
+type StreamRequest struct {
+	// Count is the number of messages to send.
+	Count int32 `json:"count"`
+	// Size is the payload size of each message.
+	Size int32 `json:"size"`
+}
+
+// StreamResponse is a message of the ServerStream method.
+type StreamResponse struct {
+	Index   int32  `json:"index"`
+	Payload string `json:"payload"`
+}
+
+// NewService creates the service the suite runs against. It exposes Unary,
+// whose request controls the response, errors, and delays, and ServerStream.
+// Both echo the EchoHeader request header.
+func NewService() *rpc.Service {
+	svc := rpc.NewService("ConformanceService",
+		rpc.WithPackage("hyperway.conformance.v1"),
+		rpc.WithReflection(true),
+	)
+
+	rpc.MustRegister(svc, "Unary", func(ctx context.Context, req *UnaryRequest) (*UnaryResponse, error) {
+		echoMetadata(ctx)
+		if req.SleepMillis > 0 {
+			timer := time.NewTimer(time.Duration(req.SleepMillis) * time.Millisecond)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return nil, rpc.NewError(rpc.CodeDeadlineExceeded, ctx.Err().Error())
+			}
+		}
+		if req.ErrorCode != "" {
+			return nil, rpc.NewError(rpc.Code(req.ErrorCode), req.ErrorMessage)
+		}
+		if req.ResponseSize > 0 {
+			return &UnaryResponse{Payload: strings.Repeat("x", int(req.ResponseSize))}, nil
+		}
+		return &UnaryResponse{Payload: req.Payload}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "ServerStream", func(ctx context.Context, req *StreamRequest, stream rpc.ServerStream[StreamResponse]) error {
+		echoMetadata(ctx)
+		payload := strings.Repeat("x", int(req.Size))
+		for i := range req.Count {
+			if err := stream.Send(&StreamResponse{Index: i, Payload: payload}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return svc
+}
+
+// echoMetadata returns the EchoHeader request header in the response.
+func echoMetadata(ctx context.Context) {
+	md := rpc.Meta(ctx)
+	if value := md.Get(EchoHeader); value != "" {
+		md.SetHeader(rpc.Pairs(EchoHeader, value))
+		md.SetTrailer(rpc.Pairs(EchoTrailer, value))
+	}
+}
+
+// Server is a running conformance service.
+type Server struct {
+	// URL is the base URL of the server.
+	URL string
+
+	server *http.Server
+}
+
+// Start serves the conformance service on addr (e.g., "127.0.0.1:0") with
+// the server of rpc.NewServer, so HTTP/1.1 and HTTP/2 without TLS, and the
+// given options, are what the suite checks.
+func Start(addr string, opts ...rpc.ServerOption) (*Server, error) {
+	gw, err := rpc.NewGateway(NewService())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gateway: %w", err)
+	}
+	server, err := rpc.NewServer(addr, gw, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = listener.Close()
+		}
+	}()
+
+	return &Server{
+		URL:    "http://" + listener.Addr().String(),
+		server: server,
+	}, nil
+}
+
+// Close shuts the server down.
+func (s *Server) Close(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
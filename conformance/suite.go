@@ -0,0 +1,57 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxSuiteDetail is the number of output bytes kept in the result of a
+// failed runner.
+const maxSuiteDetail = 2048
+
+// runConnectSuite runs the official Connect conformance runner. Its own
+// timeouts apply rather than the timeout of each case.
+func runConnectSuite(ctx context.Context, command []string) *Result {
+	result := &Result{Protocol: "connectconformance", Feature: "suite"}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		result.Status = StatusSkip
+		result.Detail = command[0] + " not installed"
+		return result
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, command[1:]...) //nolint:gosec // The command is configured by the caller
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	start := time.Now()
+	err = cmd.Run()
+	result.Duration = time.Since(start)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Status = StatusPass
+	case errors.As(err, &exitErr):
+		result.Status = StatusFail
+		result.Detail = lastLines(output.String())
+	default:
+		result.Status = StatusFail
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// lastLines returns the end of the runner's output, where it summarizes
+// failures.
+func lastLines(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxSuiteDetail {
+		output = "..." + output[len(output)-maxSuiteDetail:]
+	}
+	return output
+}
@@ -0,0 +1,227 @@
+// Package doctor diagnoses the deployment of a running server.
+//
+// It probes the server over HTTP/1.1 and HTTP/2 and reports the negotiated
+// HTTP versions, the RPC protocols it answers, reflection, compression, CORS,
+// and keepalive behavior, along with hints for common misconfigurations such
+// as a listener without h2c or a proxy that strips trailers.
+//
+//	report, err := doctor.Run(ctx, "localhost:8080",
+//		doctor.WithMethod("user.v1.UserService/GetUser", `{"id":"1"}`))
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Check identifies a diagnosis.
+type Check string
+
+const (
+	// CheckHTTP1 reaches the server over HTTP/1.1.
+	CheckHTTP1 Check = "http/1.1"
+	// CheckHTTP2 negotiates HTTP/2, with prior knowledge (h2c) without TLS
+	// and via ALPN with TLS.
+	CheckHTTP2 Check = "http/2"
+	// CheckProtocols detects which of Connect, gRPC, and gRPC-Web the server
+	// answers.
+	CheckProtocols Check = "protocols"
+	// CheckReflection lists services via gRPC server reflection.
+	CheckReflection Check = "reflection"
+	// CheckTrailers verifies that gRPC trailers reach the client.
+	CheckTrailers Check = "trailers"
+	// CheckCompression sends a gzip-compressed request.
+	CheckCompression Check = "compression"
+	// CheckCORS sends a browser preflight request.
+	CheckCORS Check = "cors"
+	// CheckKeepalive pings HTTP/2 connections and reuses HTTP/1.1 ones.
+	CheckKeepalive Check = "keepalive"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// StatusOK means the server behaves as clients expect.
+	StatusOK Status = "ok"
+	// StatusWarn means some clients or features will not work.
+	StatusWarn Status = "warn"
+	// StatusFail means the server is unreachable or broken for clients.
+	StatusFail Status = "fail"
+	// StatusSkip means the check could not run.
+	StatusSkip Status = "skip"
+)
+
+// Finding is the outcome of one check.
+type Finding struct {
+	Check  Check
+	Status Status
+	Detail string
+	// Hint suggests how to fix a warning or failure
+	Hint string
+}
+
+// Report collects the findings of a diagnosis.
+type Report struct {
+	// URL is the base URL of the diagnosed server.
+	URL      string
+	Findings []Finding
+}
+
+// Failed reports whether any check failed.
+func (r *Report) Failed() bool {
+	for _, finding := range r.Findings {
+		if finding.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Finding returns the finding of check, if it ran.
+func (r *Report) Finding(check Check) (Finding, bool) {
+	for _, finding := range r.Findings {
+		if finding.Check == check {
+			return finding, true
+		}
+	}
+	return Finding{}, false
+}
+
+// WriteTable writes the findings as an aligned table followed by the hints.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL"); err != nil {
+		return err
+	}
+	for _, finding := range r.Findings {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", finding.Check, finding.Status, finding.Detail); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	header := false
+	for _, finding := range r.Findings {
+		if finding.Hint == "" {
+			continue
+		}
+		if !header {
+			if _, err := fmt.Fprintln(w, "\nHints:"); err != nil {
+				return err
+			}
+			header = true
+		}
+		if _, err := fmt.Fprintf(w, "  %s: %s\n", finding.Check, finding.Hint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Option configures a diagnosis.
+type Option func(*options)
+
+type options struct {
+	timeout   time.Duration
+	method    string
+	data      string
+	origin    string
+	tlsConfig *tls.Config
+}
+
+// Defaults of a diagnosis
+const (
+	defaultProbeTimeout = 10 * time.Second
+	defaultOrigin       = "https://example.com"
+)
+
+// WithTimeout sets the timeout of each probe (default: 10s).
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithMethod calls method ("pkg.Service/Method") with the JSON request data
+// to check trailers and compression on a real call instead of reflection.
+// The method is called several times, so it should be free of side effects.
+func WithMethod(method, data string) Option {
+	return func(o *options) {
+		o.method = "/" + strings.TrimPrefix(method, "/")
+		o.data = data
+	}
+}
+
+// WithOrigin sets the origin of the CORS preflight request
+// (default: https://example.com).
+func WithOrigin(origin string) Option {
+	return func(o *options) {
+		o.origin = origin
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https targets, e.g. to
+// trust a private CA.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// Run diagnoses the server at target, a host:port for a server without TLS
+// or an http or https URL. An error is returned only for an invalid target;
+// problems of the server are recorded in the report.
+func Run(ctx context.Context, target string, opts ...Option) (*Report, error) {
+	o := &options{
+		timeout: defaultProbeTimeout,
+		data:    "{}",
+		origin:  defaultOrigin,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	base, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	d := newDiagnosis(base, o)
+	defer d.close()
+	return d.run(ctx), nil
+}
+
+// parseTarget returns the base URL of target.
+func parseTarget(target string) (*url.URL, error) {
+	if target == "" {
+		return nil, errors.New("doctor: target is required")
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("doctor: invalid target %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("doctor: invalid target %q: want host:port or an http or https URL", target)
+	}
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host += ":" + port
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
@@ -0,0 +1,148 @@
+package doctor_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/doctor"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type GreetRequest struct {
+	Name string `json:"name"`
+}
+
+type GreetResponse struct {
+	Message string `json:"message"`
+}
+
+func newGateway(t *testing.T) http.Handler {
+	t.Helper()
+	svc := rpc.NewService("GreetService", rpc.WithPackage("greet.v1"), rpc.WithReflection(true))
+	rpc.MustRegister(svc, "Greet", func(_ context.Context, req *GreetRequest) (*GreetResponse, error) {
+		return &GreetResponse{Message: "Hello, " + req.Name}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	return gw
+}
+
+func diagnose(t *testing.T, target string, opts ...doctor.Option) *doctor.Report {
+	t.Helper()
+	opts = append([]doctor.Option{doctor.WithTimeout(5 * time.Second)}, opts...)
+	report, err := doctor.Run(context.Background(), target, opts...)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	var table bytes.Buffer
+	if err := report.WriteTable(&table); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	t.Logf("\n%s", table.String())
+	return report
+}
+
+func expect(t *testing.T, report *doctor.Report, check doctor.Check, status doctor.Status, detail string) doctor.Finding {
+	t.Helper()
+	finding, ok := report.Finding(check)
+	if !ok {
+		t.Fatalf("%s: no finding", check)
+	}
+	if finding.Status != status || !strings.Contains(finding.Detail, detail) {
+		t.Errorf("%s: expected %s containing %q, got %s %q", check, status, detail, finding.Status, finding.Detail)
+	}
+	return finding
+}
+
+func TestRunHealthyServer(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(newGateway(t), &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	t.Run("reflection", func(t *testing.T) {
+		report := diagnose(t, strings.TrimPrefix(server.URL, "http://"))
+		if report.Failed() {
+			t.Error("Expected no failures")
+		}
+		expect(t, report, doctor.CheckHTTP1, doctor.StatusOK, "served")
+		expect(t, report, doctor.CheckHTTP2, doctor.StatusOK, "h2c")
+		expect(t, report, doctor.CheckProtocols, doctor.StatusOK, "connect, grpc, grpc-web")
+		expect(t, report, doctor.CheckReflection, doctor.StatusOK, "greet.v1.GreetService")
+		expect(t, report, doctor.CheckTrailers, doctor.StatusOK, "reflection")
+		expect(t, report, doctor.CheckCompression, doctor.StatusOK, "gzip")
+		expect(t, report, doctor.CheckCORS, doctor.StatusOK, "allowed")
+		expect(t, report, doctor.CheckKeepalive, doctor.StatusOK, "PING answered")
+	})
+
+	t.Run("method", func(t *testing.T) {
+		report := diagnose(t, server.URL, doctor.WithMethod("greet.v1.GreetService/Greet", `{"name":"doctor"}`))
+		expect(t, report, doctor.CheckTrailers, doctor.StatusOK, "/greet.v1.GreetService/Greet")
+		expect(t, report, doctor.CheckCompression, doctor.StatusOK, "gzip requests")
+	})
+}
+
+func TestRunWithoutH2C(t *testing.T) {
+	server := httptest.NewServer(newGateway(t))
+	t.Cleanup(server.Close)
+
+	report := diagnose(t, server.URL)
+	expect(t, report, doctor.CheckHTTP1, doctor.StatusOK, "served")
+	if finding := expect(t, report, doctor.CheckHTTP2, doctor.StatusWarn, "h2c"); !strings.Contains(finding.Hint, "h2c.NewHandler") {
+		t.Errorf("Expected a remediation hint, got %q", finding.Hint)
+	}
+	expect(t, report, doctor.CheckProtocols, doctor.StatusWarn, "grpc (needs HTTP/2)")
+	expect(t, report, doctor.CheckReflection, doctor.StatusSkip, "needs HTTP/2")
+}
+
+func TestRunDetectsStrippedTrailers(t *testing.T) {
+	gw := newGateway(t)
+	// A proxy that buffers responses and forwards only headers and body
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, r)
+		resp := rec.Result()
+		for key, values := range resp.Header {
+			if key != "Trailer" {
+				w.Header()[key] = values
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = w.Write(rec.Body.Bytes())
+	})
+	server := httptest.NewServer(h2c.NewHandler(proxy, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	report := diagnose(t, server.URL, doctor.WithMethod("/greet.v1.GreetService/Greet", `{"name":"doctor"}`))
+	if !report.Failed() {
+		t.Error("Expected the report to fail")
+	}
+	if finding := expect(t, report, doctor.CheckTrailers, doctor.StatusFail, "without grpc-status"); !strings.Contains(finding.Hint, "proxy") {
+		t.Errorf("Expected a remediation hint, got %q", finding.Hint)
+	}
+}
+
+func TestRunUnreachable(t *testing.T) {
+	report := diagnose(t, "127.0.0.1:1", doctor.WithTimeout(time.Second))
+	if !report.Failed() {
+		t.Error("Expected the report to fail")
+	}
+	expect(t, report, doctor.CheckHTTP1, doctor.StatusFail, "unreachable")
+	expect(t, report, doctor.CheckKeepalive, doctor.StatusSkip, "unreachable")
+}
+
+func TestRunRejectsInvalidTargets(t *testing.T) {
+	for _, target := range []string{"", "grpc://localhost:8080", "http://"} {
+		if _, err := doctor.Run(context.Background(), target); err == nil {
+			t.Errorf("Run(%q) succeeded", target)
+		}
+	}
+}
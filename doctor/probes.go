@@ -0,0 +1,703 @@
+package doctor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+)
+
+const (
+	// probeProcedure is a method no server implements, so probes have no
+	// side effects
+	probeProcedure = "/hyperway.doctor.v1.DoctorService/Probe"
+	// reflectionProcedure lists services with gRPC server reflection
+	reflectionProcedure = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	// maxResponseSize bounds the responses read by probes
+	maxResponseSize = 4 << 20
+	// frameHeaderSize is the size of the header of gRPC messages
+	frameHeaderSize = 5
+)
+
+// Remediation hints
+const (
+	hintUnreachable = "Check the address and that the server is running; use an https:// URL for servers with TLS."
+	hintHTTP1       = "Browsers and most HTTP tools use HTTP/1.1; serve it alongside HTTP/2, e.g. with rpc.NewServer or h2c.NewHandler."
+	hintH2C         = "gRPC clients need HTTP/2. Serve with rpc.NewServer, or wrap the handler with h2c.NewHandler(handler, &http2.Server{}); a proxy in front must forward h2c as well."
+	hintALPN        = "gRPC clients need HTTP/2. Offer h2 via ALPN on the TLS listener or the proxy terminating TLS."
+	hintProtocols   = "Check that proxies forward the application/connect+*, application/grpc*, and application/grpc-web* content types to the server unchanged."
+	hintReflection  = "Enable reflection with rpc.WithReflection(true) so grpcurl, buf curl, and evans can discover services."
+	hintTrailers    = "A proxy in front of the server drops HTTP/2 trailers. Forward gRPC end to end over HTTP/2 (e.g. nginx grpc_pass, Envoy), or use Connect or gRPC-Web through the proxy."
+	hintCompression = "Check that the server decompresses requests and that proxies pass Content-Encoding and grpc-encoding through."
+	hintNoCORS      = "Browsers can't call the server from other origins. Set gateway.Options.CORSConfig, or configure the proxy, if browser clients need it."
+	hintCORS        = "Allow POST and the Connect and gRPC-Web request headers, and expose grpc-status and grpc-message, in the CORS configuration of the server or proxy."
+	hintPing        = "Clients sending keepalive pings will drop their connections; check that proxies pass HTTP/2 PING frames."
+	hintReuse       = "Every HTTP/1.1 request pays for a new connection; check for Connection: close set by the server or a proxy."
+)
+
+var (
+	// emptyFrame is a gRPC message with an empty payload
+	emptyFrame = []byte{0, 0, 0, 0, 0}
+	// corsRequestHeaders are sent by browser Connect and gRPC-Web clients
+	corsRequestHeaders = []string{"content-type", "connect-protocol-version", "connect-timeout-ms", "grpc-timeout", "x-grpc-web", "x-user-agent"}
+	// corsExposedHeaders must be readable by browser gRPC-Web clients
+	corsExposedHeaders = []string{"grpc-status", "grpc-message"}
+)
+
+// diagnosis holds the state shared by the probes of a run.
+type diagnosis struct {
+	base   *url.URL
+	opts   *options
+	report *Report
+
+	http1 *http.Transport
+	h2    *http2.ClientConn // nil without HTTP/2
+	// web sends the requests of browser clients, over HTTP/1.1 if possible
+	web http.RoundTripper
+
+	grpc       bool
+	reflection *grpcResult // nil unless reflection answered
+	webHeader  http.Header // headers of the gRPC-Web probe sent with an origin
+}
+
+// grpcResult is the outcome of a gRPC call.
+type grpcResult struct {
+	header   http.Header
+	messages [][]byte
+	status   string // grpc-status, empty without one
+	message  string
+	// inTrailers reports whether the status arrived in trailers
+	inTrailers bool
+}
+
+func newDiagnosis(base *url.URL, o *options) *diagnosis {
+	return &diagnosis{
+		base:   base,
+		opts:   o,
+		report: &Report{URL: base.String()},
+		http1: &http.Transport{
+			DialContext:        (&net.Dialer{}).DialContext,
+			TLSClientConfig:    tlsConfig(o.tlsConfig, "http/1.1"),
+			TLSNextProto:       map[string]func(string, *tls.Conn) http.RoundTripper{}, // HTTP/1.1 only
+			DisableCompression: true,
+		},
+	}
+}
+
+// tlsConfig returns a copy of base offering protos via ALPN.
+func tlsConfig(base *tls.Config, protos ...string) *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		config = base.Clone()
+	}
+	config.NextProtos = protos
+	return config
+}
+
+func (d *diagnosis) close() {
+	d.http1.CloseIdleConnections()
+	if d.h2 != nil {
+		_ = d.h2.Close()
+	}
+}
+
+func (d *diagnosis) add(check Check, status Status, detail, hint string) {
+	d.report.Findings = append(d.report.Findings, Finding{Check: check, Status: status, Detail: detail, Hint: hint})
+}
+
+// run probes the server. Without any connection the remaining checks are
+// skipped.
+func (d *diagnosis) run(ctx context.Context) *Report {
+	http1Err := d.probeHTTP1(ctx)
+	http2Finding := d.probeHTTP2(ctx)
+	switch {
+	case http1Err == nil:
+		d.add(CheckHTTP1, StatusOK, "served", "")
+		d.web = d.http1
+	case d.h2 != nil:
+		d.add(CheckHTTP1, StatusWarn, fmt.Sprintf("not served: %v", http1Err), hintHTTP1)
+		d.web = d.h2
+	default:
+		d.add(CheckHTTP1, StatusFail, fmt.Sprintf("unreachable: %v", http1Err), hintUnreachable)
+		for _, check := range []Check{CheckHTTP2, CheckProtocols, CheckReflection, CheckTrailers, CheckCompression, CheckCORS, CheckKeepalive} {
+			d.add(check, StatusSkip, "server unreachable", "")
+		}
+		return d.report
+	}
+	d.report.Findings = append(d.report.Findings, http2Finding)
+
+	d.checkProtocols(ctx)
+	d.checkReflection(ctx)
+	d.checkTrailers(ctx)
+	d.checkCompression(ctx)
+	d.checkCORS(ctx)
+	d.checkKeepalive(ctx, http1Err == nil)
+	return d.report
+}
+
+// probeHTTP1 sends a request over HTTP/1.1.
+func (d *diagnosis) probeHTTP1(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+	_, _, err := d.post(ctx, d.http1, probeProcedure, connectHeader(), []byte("{}"))
+	return err
+}
+
+// probeHTTP2 opens an HTTP/2 connection and sends a gRPC request over it,
+// keeping the connection for later probes.
+func (d *diagnosis) probeHTTP2(ctx context.Context) Finding {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	conn, negotiated, err := d.dial(ctx)
+	if err != nil {
+		return Finding{Check: CheckHTTP2, Status: StatusWarn, Detail: fmt.Sprintf("failed to connect: %v", err), Hint: hintUnreachable}
+	}
+	if d.base.Scheme == "https" && negotiated != http2.NextProtoTLS {
+		_ = conn.Close()
+		if negotiated == "" {
+			negotiated = "no protocol"
+		}
+		return Finding{Check: CheckHTTP2, Status: StatusWarn, Detail: fmt.Sprintf("TLS negotiated %s instead of h2", negotiated), Hint: hintALPN}
+	}
+
+	cc, err := (&http2.Transport{AllowHTTP: true}).NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return Finding{Check: CheckHTTP2, Status: StatusWarn, Detail: fmt.Sprintf("failed to start HTTP/2: %v", err), Hint: hintH2C}
+	}
+	resp, _, err := d.post(ctx, cc, probeProcedure, grpcHeader("application/grpc"), emptyFrame)
+	if err != nil {
+		_ = cc.Close()
+		if d.base.Scheme == "https" {
+			return Finding{Check: CheckHTTP2, Status: StatusWarn, Detail: fmt.Sprintf("HTTP/2 request failed: %v", err), Hint: hintALPN}
+		}
+		return Finding{Check: CheckHTTP2, Status: StatusWarn, Detail: fmt.Sprintf("HTTP/2 without TLS (h2c) not accepted: %v", err), Hint: hintH2C}
+	}
+	d.h2 = cc
+	d.grpc = grpcStatus(resp.Header, resp.Trailer) != ""
+
+	if d.base.Scheme == "https" {
+		return Finding{Check: CheckHTTP2, Status: StatusOK, Detail: "h2 negotiated via ALPN"}
+	}
+	return Finding{Check: CheckHTTP2, Status: StatusOK, Detail: "h2c with prior knowledge"}
+}
+
+// checkProtocols detects the RPC protocols the server answers. Probes call a
+// method that does not exist, which servers answer in the protocol of the
+// request.
+func (d *diagnosis) checkProtocols(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	var supported, missing []string
+	resp, body, err := d.post(ctx, d.web, probeProcedure, connectHeader(), []byte("{}"))
+	if err == nil && isConnectResponse(resp, body) {
+		supported = append(supported, "connect")
+	} else {
+		missing = append(missing, "connect")
+	}
+
+	switch {
+	case d.grpc:
+		supported = append(supported, "grpc")
+	case d.h2 == nil:
+		missing = append(missing, "grpc (needs HTTP/2)")
+	default:
+		missing = append(missing, "grpc")
+	}
+
+	header := http.Header{
+		"Content-Type": {"application/grpc-web+proto"},
+		"X-Grpc-Web":   {"1"},
+		"Origin":       {d.opts.origin},
+	}
+	resp, body, err = d.post(ctx, d.web, probeProcedure, header, emptyFrame)
+	if err == nil {
+		d.webHeader = resp.Header
+	}
+	if err == nil && (resp.Header.Get("Grpc-Status") != "" || bytes.Contains(body, []byte("grpc-status"))) {
+		supported = append(supported, "grpc-web")
+	} else {
+		missing = append(missing, "grpc-web")
+	}
+
+	switch {
+	case len(supported) == 0:
+		d.add(CheckProtocols, StatusWarn, "no RPC protocol answered", "The probes reached something other than an RPC server; check the URL and the routes of any proxy in front of the server.")
+	case len(missing) > 0:
+		hint := hintProtocols
+		if len(missing) == 1 && d.h2 == nil {
+			hint = "" // Reported by the http/2 check
+		}
+		d.add(CheckProtocols, StatusWarn, fmt.Sprintf("%s; no answer for %s", strings.Join(supported, ", "), strings.Join(missing, ", ")), hint)
+	default:
+		d.add(CheckProtocols, StatusOK, strings.Join(supported, ", "), "")
+	}
+}
+
+// checkReflection lists services with gRPC server reflection.
+func (d *diagnosis) checkReflection(ctx context.Context) {
+	if d.h2 == nil {
+		d.add(CheckReflection, StatusSkip, "needs HTTP/2", "")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	result, err := d.grpcCall(ctx, reflectionProcedure, "application/grpc", listServicesRequest(), false)
+	switch {
+	case err != nil:
+		d.add(CheckReflection, StatusWarn, fmt.Sprintf("call failed: %v", err), hintReflection)
+		return
+	case result.status == "12": // UNIMPLEMENTED
+		d.add(CheckReflection, StatusWarn, "disabled", hintReflection)
+		return
+	case result.status != "" && result.status != "0":
+		d.add(CheckReflection, StatusWarn, fmt.Sprintf("failed with grpc-status %s: %s", result.status, result.message), "")
+		return
+	}
+
+	services, err := listedServices(result.messages)
+	if err != nil {
+		d.add(CheckReflection, StatusWarn, err.Error(), "")
+		return
+	}
+	d.reflection = result
+	d.add(CheckReflection, StatusOK, fmt.Sprintf("%d services: %s", len(services), strings.Join(services, ", ")), "")
+}
+
+// checkTrailers verifies that the status of a gRPC call arrives in trailers,
+// which proxies that only speak HTTP/1.1 to the server drop.
+func (d *diagnosis) checkTrailers(ctx context.Context) {
+	if d.h2 == nil {
+		d.add(CheckTrailers, StatusSkip, "needs HTTP/2", "")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	result, source := d.reflection, "reflection"
+	if d.opts.method != "" {
+		var err error
+		result, err = d.grpcCall(ctx, d.opts.method, "application/grpc+json", []byte(d.opts.data), false)
+		if err != nil {
+			d.add(CheckTrailers, StatusWarn, fmt.Sprintf("gRPC call of %s failed: %v", d.opts.method, err), "")
+			return
+		}
+		source = d.opts.method
+	}
+
+	switch {
+	case result == nil:
+		d.add(CheckTrailers, StatusSkip, "needs reflection or a method to call", "")
+	case result.inTrailers:
+		d.add(CheckTrailers, StatusOK, fmt.Sprintf("grpc-status of %s arrived in trailers", source), "")
+	case result.status == "":
+		d.add(CheckTrailers, StatusFail, fmt.Sprintf("%s responded without grpc-status", source), hintTrailers)
+	case len(result.messages) > 0:
+		d.add(CheckTrailers, StatusWarn, fmt.Sprintf("grpc-status of %s arrived in headers before the messages", source), hintTrailers)
+	default:
+		d.add(CheckTrailers, StatusSkip, fmt.Sprintf("%s failed with grpc-status %s before responding: %s", source, result.status, result.message), "")
+	}
+}
+
+// checkCompression sends a gzip-compressed request.
+func (d *diagnosis) checkCompression(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	if d.opts.method != "" {
+		body, err := gzipBytes([]byte(d.opts.data))
+		if err != nil {
+			d.add(CheckCompression, StatusWarn, err.Error(), "")
+			return
+		}
+		header := connectHeader()
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Accept-Encoding", "gzip")
+		resp, data, err := d.post(ctx, d.web, d.opts.method, header, body)
+		switch {
+		case err != nil:
+			d.add(CheckCompression, StatusWarn, fmt.Sprintf("compressed call of %s failed: %v", d.opts.method, err), hintCompression)
+		case resp.StatusCode != http.StatusOK:
+			d.add(CheckCompression, StatusWarn, fmt.Sprintf("compressed call of %s failed with HTTP %d: %s", d.opts.method, resp.StatusCode, connectError(data)), hintCompression)
+		case resp.Header.Get("Content-Encoding") == "gzip":
+			d.add(CheckCompression, StatusOK, "gzip requests and responses", "")
+		default:
+			d.add(CheckCompression, StatusOK, "gzip requests; small responses are sent uncompressed", "")
+		}
+		return
+	}
+
+	if d.reflection == nil {
+		d.add(CheckCompression, StatusSkip, "needs reflection or a method to call", "")
+		return
+	}
+	result, err := d.grpcCall(ctx, reflectionProcedure, "application/grpc", listServicesRequest(), true)
+	switch {
+	case err != nil:
+		d.add(CheckCompression, StatusWarn, fmt.Sprintf("compressed reflection call failed: %v", err), hintCompression)
+	case result.status != "0" && result.status != "":
+		d.add(CheckCompression, StatusWarn, fmt.Sprintf("compressed reflection call failed with grpc-status %s: %s", result.status, result.message), hintCompression)
+	default:
+		detail := "gzip requests"
+		if accepted := result.header.Get("Grpc-Accept-Encoding"); accepted != "" {
+			detail += "; accepts " + accepted
+		}
+		d.add(CheckCompression, StatusOK, detail, "")
+	}
+}
+
+// checkCORS sends a browser preflight request and checks the headers of the
+// gRPC-Web probe that was sent with an origin.
+func (d *diagnosis) checkCORS(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, d.base.JoinPath(probeProcedure).String(), nil)
+	if err != nil {
+		d.add(CheckCORS, StatusWarn, err.Error(), "")
+		return
+	}
+	req.Header.Set("Origin", d.opts.origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", strings.Join(corsRequestHeaders, ","))
+	resp, err := d.web.RoundTrip(req)
+	if err != nil {
+		d.add(CheckCORS, StatusWarn, fmt.Sprintf("preflight failed: %v", err), "")
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	_ = resp.Body.Close()
+
+	allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if allowOrigin == "" {
+		d.add(CheckCORS, StatusWarn, fmt.Sprintf("preflight from %s not allowed", d.opts.origin), hintNoCORS)
+		return
+	}
+
+	var issues []string
+	if resp.StatusCode/100 != 2 {
+		issues = append(issues, fmt.Sprintf("preflight answered with HTTP %d", resp.StatusCode))
+	}
+	credentials := strings.EqualFold(resp.Header.Get("Access-Control-Allow-Credentials"), "true")
+	if allowOrigin == "*" && credentials {
+		issues = append(issues, "wildcard origin with credentials, which browsers reject for credentialed requests")
+	} else if allowOrigin != "*" && allowOrigin != d.opts.origin {
+		issues = append(issues, fmt.Sprintf("allows origin %s instead of %s", allowOrigin, d.opts.origin))
+	}
+	if methods := resp.Header.Values("Access-Control-Allow-Methods"); len(methods) > 0 && !listed(methods, http.MethodPost) {
+		issues = append(issues, "POST not allowed")
+	}
+	if missing := unlisted(resp.Header.Values("Access-Control-Allow-Headers"), corsRequestHeaders); len(missing) > 0 {
+		issues = append(issues, "request headers not allowed: "+strings.Join(missing, ", "))
+	}
+	if d.webHeader.Get("Access-Control-Allow-Origin") != "" {
+		if missing := unlisted(d.webHeader.Values("Access-Control-Expose-Headers"), corsExposedHeaders); len(missing) > 0 {
+			issues = append(issues, "response headers not exposed: "+strings.Join(missing, ", "))
+		}
+	}
+
+	if len(issues) > 0 {
+		d.add(CheckCORS, StatusWarn, strings.Join(issues, "; "), hintCORS)
+		return
+	}
+	d.add(CheckCORS, StatusOK, fmt.Sprintf("preflight from %s allowed", d.opts.origin), "")
+}
+
+// checkKeepalive pings the HTTP/2 connection and checks that HTTP/1.1
+// connections are reused.
+func (d *diagnosis) checkKeepalive(ctx context.Context, http1 bool) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.timeout)
+	defer cancel()
+
+	var details []string
+	status, hint := StatusOK, ""
+	if d.h2 != nil {
+		start := time.Now()
+		if err := d.h2.Ping(ctx); err != nil {
+			details = append(details, fmt.Sprintf("HTTP/2 PING unanswered: %v", err))
+			status, hint = StatusWarn, hintPing
+		} else {
+			details = append(details, fmt.Sprintf("HTTP/2 PING answered in %s", time.Since(start).Round(time.Microsecond)))
+			if streams := d.h2.State().MaxConcurrentStreams; streams > 0 {
+				details = append(details, fmt.Sprintf("max %d concurrent streams", streams))
+			}
+		}
+	}
+	if http1 {
+		reused, err := d.http1Reused(ctx)
+		switch {
+		case err != nil:
+			details = append(details, fmt.Sprintf("HTTP/1.1 request failed: %v", err))
+		case reused:
+			details = append(details, "HTTP/1.1 connections reused")
+		default:
+			details = append(details, "HTTP/1.1 connections closed after each request")
+			if status == StatusOK {
+				status, hint = StatusWarn, hintReuse
+			}
+		}
+	}
+	d.add(CheckKeepalive, status, strings.Join(details, "; "), hint)
+}
+
+// http1Reused reports whether a second HTTP/1.1 request reuses the
+// connection of the first.
+func (d *diagnosis) http1Reused(ctx context.Context) (bool, error) {
+	if _, _, err := d.post(ctx, d.http1, probeProcedure, connectHeader(), []byte("{}")); err != nil {
+		return false, err
+	}
+	reused := false
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+	}
+	_, _, err := d.post(httptrace.WithClientTrace(ctx, trace), d.http1, probeProcedure, connectHeader(), []byte("{}"))
+	return reused, err
+}
+
+// dial connects to the server, over TLS offering h2 for https targets, and
+// returns the protocol negotiated via ALPN.
+func (d *diagnosis) dial(ctx context.Context) (net.Conn, string, error) {
+	dialer := &net.Dialer{}
+	if d.base.Scheme == "http" {
+		conn, err := dialer.DialContext(ctx, "tcp", d.base.Host)
+		return conn, "", err
+	}
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig(d.opts.tlsConfig, http2.NextProtoTLS, "http/1.1")}
+	conn, err := tlsDialer.DialContext(ctx, "tcp", d.base.Host)
+	if err != nil {
+		return nil, "", err
+	}
+	return conn, conn.(*tls.Conn).ConnectionState().NegotiatedProtocol, nil
+}
+
+// post sends a POST request to procedure and reads the response.
+func (d *diagnosis) post(ctx context.Context, rt http.RoundTripper, procedure string, header http.Header, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.base.JoinPath(procedure).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// grpcCall sends a unary gRPC request over HTTP/2, optionally compressed.
+func (d *diagnosis) grpcCall(ctx context.Context, procedure, contentType string, message []byte, compress bool) (*grpcResult, error) {
+	header := grpcHeader(contentType)
+	frame, err := encodeFrame(message, compress)
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		header.Set("Grpc-Encoding", "gzip")
+		header.Set("Grpc-Accept-Encoding", "gzip")
+	}
+	resp, body, err := d.post(ctx, d.h2, procedure, header, frame)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	result := &grpcResult{header: resp.Header}
+	if result.messages, err = decodeFrames(body); err != nil {
+		return nil, err
+	}
+	if status := resp.Header.Get("Grpc-Status"); status != "" {
+		result.status, result.message = status, resp.Header.Get("Grpc-Message")
+	} else if status := resp.Trailer.Get("Grpc-Status"); status != "" {
+		result.status, result.message, result.inTrailers = status, resp.Trailer.Get("Grpc-Message"), true
+	}
+	return result, nil
+}
+
+// connectHeader returns the headers of a Connect unary JSON request.
+func connectHeader() http.Header {
+	return http.Header{
+		"Content-Type":             {"application/json"},
+		"Connect-Protocol-Version": {"1"},
+	}
+}
+
+// grpcHeader returns the headers of a gRPC request.
+func grpcHeader(contentType string) http.Header {
+	return http.Header{
+		"Content-Type": {contentType},
+		"Te":           {"trailers"},
+	}
+}
+
+// grpcStatus returns the grpc-status in headers or trailers.
+func grpcStatus(header, trailer http.Header) string {
+	if status := header.Get("Grpc-Status"); status != "" {
+		return status
+	}
+	return trailer.Get("Grpc-Status")
+}
+
+// isConnectResponse reports whether a response is a Connect unary response
+// or error.
+func isConnectResponse(resp *http.Response, body []byte) bool {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+	if resp.StatusCode == http.StatusOK {
+		return true
+	}
+	var e struct {
+		Code string `json:"code"`
+	}
+	return json.Unmarshal(body, &e) == nil && e.Code != ""
+}
+
+// connectError describes the Connect error in body.
+func connectError(body []byte) string {
+	var e struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &e) != nil || e.Code == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return e.Code + ": " + e.Message
+}
+
+// listed reports whether the comma-separated values contain name.
+func listed(values []string, name string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unlisted returns the names missing from the comma-separated values.
+func unlisted(values, names []string) []string {
+	var missing []string
+	for _, name := range names {
+		if !listed(values, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// listServicesRequest returns a reflection request listing all services.
+func listServicesRequest() []byte {
+	data, _ := proto.Marshal(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	return data
+}
+
+// listedServices returns the services of a reflection response, without the
+// reflection service itself.
+func listedServices(messages [][]byte) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("no reflection response")
+	}
+	var resp reflectionpb.ServerReflectionResponse
+	if err := proto.Unmarshal(messages[0], &resp); err != nil {
+		return nil, fmt.Errorf("invalid reflection response: %w", err)
+	}
+	var services []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if !strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			services = append(services, service.GetName())
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// encodeFrame encodes a gRPC message.
+func encodeFrame(message []byte, compress bool) ([]byte, error) {
+	flags := byte(0)
+	if compress {
+		var err error
+		if message, err = gzipBytes(message); err != nil {
+			return nil, err
+		}
+		flags = 1
+	}
+	frame := make([]byte, frameHeaderSize+len(message))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(message))) //nolint:gosec // bounded by the probe sizes
+	copy(frame[frameHeaderSize:], message)
+	return frame, nil
+}
+
+// decodeFrames decodes the gRPC messages in body.
+func decodeFrames(body []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < frameHeaderSize {
+			return nil, errors.New("truncated gRPC message")
+		}
+		size := int(binary.BigEndian.Uint32(body[1:frameHeaderSize]))
+		if len(body) < frameHeaderSize+size {
+			return nil, errors.New("truncated gRPC message")
+		}
+		message := body[frameHeaderSize : frameHeaderSize+size]
+		if body[0]&1 != 0 {
+			reader, err := gzip.NewReader(bytes.NewReader(message))
+			if err != nil {
+				return nil, fmt.Errorf("invalid compressed gRPC message: %w", err)
+			}
+			if message, err = io.ReadAll(io.LimitReader(reader, maxResponseSize)); err != nil {
+				return nil, fmt.Errorf("invalid compressed gRPC message: %w", err)
+			}
+		}
+		messages = append(messages, message)
+		body = body[frameHeaderSize+size:]
+	}
+	return messages, nil
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
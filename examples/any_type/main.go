@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/i2y/hyperway/rpc"
@@ -38,11 +40,10 @@ type TestService struct{}
 
 // ProcessAny processes a request with Any type
 func (s *TestService) ProcessAny(ctx context.Context, req *AnyTestRequest) (*AnyTestResponse, error) {
-	log.Printf("Received request with name=%s", req.Name)
+	slog.InfoContext(ctx, "Processing Any", "name", req.Name, "type_url", req.Details.GetTypeUrl())
 
 	// Unpack the Any type to see what's inside
 	if req.Details != nil {
-		log.Printf("Details type_url: %s", req.Details.TypeUrl)
 
 		// Try to unmarshal as different types
 		var msg string
@@ -88,6 +89,9 @@ func (s *TestService) ProcessAny(ctx context.Context, req *AnyTestRequest) (*Any
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service
 	svc := rpc.NewService("AnyTestService",
 		rpc.WithPackage("example.anytest.v1"))
@@ -105,17 +109,20 @@ func main() {
 	}
 
 	// Create gateway
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
 	// Start server
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
-	log.Println("Starting Any type test server on :8080")
-	log.Println("Service registered at: /example.anytest.v1.AnyTestService/ProcessAny")
+	logger.Info("Starting Any type test server",
+		"addr", ":8080",
+		"procedure", "/example.anytest.v1.AnyTestService/ProcessAny")
 
 	// Create server with timeouts
 	server := &http.Server{
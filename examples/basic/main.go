@@ -4,19 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
-)
-
-// Constants for timeouts
-const (
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
 )
 
 // Model definitions
@@ -93,20 +82,9 @@ func main() {
 	log.Println("  Create user: curl -X POST http://localhost:8091/user.v1.UserService/CreateUser -H 'Content-Type: application/json' -d '{\"name\":\"Alice\",\"email\":\"alice@example.com\"}'")
 	log.Println("  Get user: curl -X POST http://localhost:8091/user.v1.UserService/GetUser -H 'Content-Type: application/json' -d '{\"id\":\"user-123\"}'")
 
-	// Use h2c (HTTP/2 without TLS) for gRPC reflection support
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(mux, h2s)
-
-	server := &http.Server{
-		Addr:              ":8091",
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
-	if err := server.ListenAndServe(); err != nil {
+	// Serves HTTP/1.1 and h2c (HTTP/2 without TLS) for gRPC clients.
+	// Add rpc.WithTLS(certFile, keyFile) to serve HTTP/2 over TLS.
+	if err := rpc.ListenAndServe(":8091", mux); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -72,7 +73,7 @@ func (s *UserService) CreateUser(ctx context.Context, req *CreateUserRequest) (*
 
 	s.users[user.ID] = user
 
-	log.Printf("Created user: %s", user.ID)
+	slog.InfoContext(ctx, "Created user", "id", user.ID)
 	return &CreateUserResponse{User: user}, nil
 }
 
@@ -107,6 +108,9 @@ func (s *UserService) ListUsers(ctx context.Context, req *ListUsersRequest) (*Li
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service
 	userService := NewUserService()
 
@@ -122,7 +126,7 @@ func main() {
 
 	// Export proto file if requested
 	if len(os.Args) > 1 && os.Args[1] == "export-proto" {
-		log.Println("Exporting proto file...")
+		logger.Info("Exporting proto files")
 
 		// Export proto files with Go package option for Connect-go code generation
 		files, err := svc.ExportAllProtosWithOptions(
@@ -144,24 +148,24 @@ func main() {
 			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
 				log.Fatalf("Failed to write %s: %v", filename, err)
 			}
-			log.Printf("Exported: %s", filename)
+			logger.Info("Exported proto file", "file", filename)
 		}
 
-		log.Println("\nProto files exported successfully!")
-		log.Println("Note: go_package option has been automatically added for Connect-go code generation")
-		log.Println("You can now generate Connect-go client code with:")
-		log.Println("  buf generate")
+		// The go_package option is added for Connect-go code generation
+		logger.Info("Proto files exported, generate the Connect-go client code with buf generate")
 		return
 	}
 
 	// Create and start server
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
 	h2s := &http2.Server{}
 	handler := h2c.NewHandler(mux, h2s)
@@ -173,11 +177,11 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	log.Println("Starting Hyperway server on :8888")
-	log.Println("Service: user.v1.UserService")
-	log.Println("Protocols: gRPC, Connect, gRPC-Web")
-	log.Println("")
-	log.Println("To export proto file, run: go run main.go export-proto")
+	logger.Info("Starting Hyperway server",
+		"addr", ":8888",
+		"service", "user.v1.UserService",
+		"protocols", "gRPC, Connect, gRPC-Web",
+		"export", "go run main.go export-proto")
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Server failed: %v", err)
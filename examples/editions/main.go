@@ -5,20 +5,8 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
-	"time"
 
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
-)
-
-// Constants
-const (
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
 )
 
 // UserRequest represents a user creation request.
@@ -78,23 +66,11 @@ func main() {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
-	// Start server with h2c for both HTTP/1.1 and HTTP/2 support
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(gateway, h2s)
-
 	fmt.Println("\nServer running on http://localhost:8080")
 	fmt.Println("Try: curl -X POST http://localhost:8080/example.user.v1.UserService/CreateUser -d '{\"name\":\"Alice\",\"email\":\"alice@example.com\",\"age\":30}'")
 
-	server := &http.Server{
-		Addr:              ":8080",
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
-	if err := server.ListenAndServe(); err != nil {
+	// Serves HTTP/1.1 and HTTP/2 (h2c) until interrupted
+	if err := rpc.Run(context.Background(), ":8080", gateway); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
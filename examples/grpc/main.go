@@ -5,22 +5,17 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 // Constants
 const (
-	defaultLimit      = 10
-	maxLimit          = 100
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
+	defaultLimit = 10
+	maxLimit     = 100
 )
 
 // Service models
@@ -149,6 +144,9 @@ func deleteUser(ctx context.Context, req *DeleteUserRequest) (*DeleteUserRespons
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service with full gRPC support
 	svc := rpc.NewService("UserService",
 		rpc.WithPackage("grpc.example.v1"),
@@ -171,21 +169,13 @@ func main() {
 	}
 
 	// Create gateway with gRPC support
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gateway, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Start HTTP/2 server with h2c for gRPC support
-	srv := &http.Server{
-		Addr:              ":9095",
-		Handler:           h2c.NewHandler(gateway, &http2.Server{}),
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
 	// Add some initial data
 	users["user-0"] = &User{
 		ID:        "user-0",
@@ -194,25 +184,17 @@ func main() {
 		CreatedAt: time.Now(),
 	}
 
-	log.Println("gRPC server starting on :9095")
-	log.Println("")
-	log.Println("Test with grpcurl:")
-	log.Println("")
-	log.Println("# List available services")
-	log.Println("grpcurl -plaintext localhost:9095 list")
-	log.Println("")
-	log.Println("# Describe the service")
-	log.Println("grpcurl -plaintext localhost:9095 describe grpc.example.v1.UserService")
-	log.Println("")
-	log.Println("# Create a user")
-	log.Println(`grpcurl -plaintext -d '{"name":"Alice","email":"alice@example.com"}' localhost:9095 grpc.example.v1.UserService/CreateUser`)
-	log.Println("")
-	log.Println("# List users")
-	log.Println(`grpcurl -plaintext -d '{"limit":10}' localhost:9095 grpc.example.v1.UserService/ListUsers`)
-	log.Println("")
-	log.Println("# Get a specific user")
-	log.Println(`grpcurl -plaintext -d '{"id":"user-0"}' localhost:9095 grpc.example.v1.UserService/GetUser`)
-	log.Println("")
-
-	log.Fatal(srv.ListenAndServe())
+	addr := ":9095"
+	logger.Info("gRPC server starting",
+		"addr", addr,
+		"list", "grpcurl -plaintext localhost"+addr+" list",
+		"describe", "grpcurl -plaintext localhost"+addr+" describe grpc.example.v1.UserService",
+		"create", `grpcurl -plaintext -d '{"name":"Alice","email":"alice@example.com"}' localhost`+addr+" grpc.example.v1.UserService/CreateUser",
+		"list_users", `grpcurl -plaintext -d '{"limit":10}' localhost`+addr+" grpc.example.v1.UserService/ListUsers",
+		"get", `grpcurl -plaintext -d '{"id":"user-0"}' localhost`+addr+" grpc.example.v1.UserService/GetUser")
+
+	// Serves HTTP/2 (h2c) for gRPC until interrupted
+	if err := rpc.Run(context.Background(), addr, gateway); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -11,16 +12,6 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/i2y/hyperway/gateway"
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
-)
-
-// Constants
-const (
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
 )
 
 // Request and response types
@@ -107,6 +98,9 @@ func serveStaticFiles(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service instance
 	greeterService := NewGreeterService()
 
@@ -136,6 +130,7 @@ func main() {
 		EnableReflection: true,
 		EnableOpenAPI:    true,
 		CORSConfig:       gateway.DefaultCORSConfig(),
+		Logger:           logger,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
@@ -159,27 +154,17 @@ func main() {
 		addr = ":" + port
 	}
 
-	log.Printf("Starting gRPC-Web example server on %s", addr)
-	log.Printf("Open http://localhost%s in your browser to test the gRPC-Web client", addr)
-	log.Printf("Available endpoints:")
-	log.Printf("  - /grpcweb.example.v1.GreeterService/Greet")
-	log.Printf("  - /grpcweb.example.v1.GreeterService/Calculate")
-	log.Printf("  - /openapi.json (OpenAPI specification)")
-
-	// Create h2c handler to support HTTP/2 cleartext
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(mux, h2s)
-
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
-	if err := server.ListenAndServe(); err != nil {
+	logger.Info("Starting gRPC-Web example server",
+		"addr", addr,
+		"client", "http://localhost"+addr,
+		"endpoints", []string{
+			"/grpcweb.example.v1.GreeterService/Greet",
+			"/grpcweb.example.v1.GreeterService/Calculate",
+			"/openapi.json",
+		})
+
+	// Serves HTTP/1.1 and HTTP/2 cleartext (h2c) until interrupted
+	if err := rpc.Run(context.Background(), addr, mux); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/i2y/hyperway/examples/http-client-example/server"
@@ -12,6 +14,9 @@ import (
 )
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	userService := server.NewUserService()
 
 	svc := rpc.NewService("user.v1",
@@ -24,13 +29,15 @@ func main() {
 	rpc.MustRegister(svc, "UpdateUser", userService.UpdateUser)
 	rpc.MustRegister(svc, "DeleteUser", userService.DeleteUser)
 
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
 	h2s := &http2.Server{}
 	handler := h2c.NewHandler(mux, h2s)
@@ -42,9 +49,10 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	log.Println("Starting Hyperway server on :8080")
-	log.Println("Service: user.v1")
-	log.Println("Protocols: gRPC, Connect, gRPC-Web")
+	logger.Info("Starting Hyperway server",
+		"addr", ":8080",
+		"service", "user.v1",
+		"protocols", "gRPC, Connect, gRPC-Web")
 
 	if err := httpServer.ListenAndServe(); err != nil {
 		log.Fatalf("Server failed: %v", err)
@@ -3,7 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/i2y/hyperway/examples/http-client-example/shared"
@@ -29,7 +29,7 @@ func (s *UserService) CreateUser(ctx context.Context, req *shared.CreateUserRequ
 
 	s.users[user.ID] = user
 
-	log.Printf("Created user: %s", user.ID)
+	slog.InfoContext(ctx, "Created user", "id", user.ID)
 	return &shared.CreateUserResponse{User: user}, nil
 }
 
@@ -76,7 +76,7 @@ func (s *UserService) UpdateUser(ctx context.Context, req *shared.UpdateUserRequ
 		user.Email = req.Email
 	}
 
-	log.Printf("Updated user: %s", user.ID)
+	slog.InfoContext(ctx, "Updated user", "id", user.ID)
 	return &shared.UpdateUserResponse{User: user}, nil
 }
 
@@ -86,6 +86,6 @@ func (s *UserService) DeleteUser(ctx context.Context, req *shared.DeleteUserRequ
 	}
 
 	delete(s.users, req.ID)
-	log.Printf("Deleted user: %s", req.ID)
+	slog.InfoContext(ctx, "Deleted user", "id", req.ID)
 	return &shared.DeleteUserResponse{Success: true}, nil
 }
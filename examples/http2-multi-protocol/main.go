@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -43,6 +45,9 @@ func subtract(ctx context.Context, req *CalcRequest) (*CalcResponse, error) {
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create a service with JSON-RPC enabled
 	svc := rpc.NewService("CalculatorService",
 		rpc.WithPackage("calculator.v1"),
@@ -59,7 +64,9 @@ func main() {
 	rpc.MustRegister(svc, "subtract", subtract)
 
 	// Create gateway - this supports gRPC, Connect, gRPC-Web, and JSON-RPC
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
@@ -68,7 +75,7 @@ func main() {
 	h2s := &http2.Server{}
 
 	// Create handler that supports both HTTP/1.1 and HTTP/2
-	handler := h2c.NewHandler(gateway, h2s)
+	handler := h2c.NewHandler(gw, h2s)
 
 	addr := ":8084"
 	server := &http.Server{
@@ -83,11 +90,11 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Printf("Starting HTTP/2 server on %s", addr)
-	log.Printf("Endpoints:")
-	log.Printf("  - JSON-RPC: http://localhost%s/api/jsonrpc", addr)
-	log.Printf("  - gRPC/Connect: http://localhost%s/calculator.v1.CalculatorService/[method]", addr)
-	log.Printf("Server supports: HTTP/1.1, HTTP/2 (h2c), gRPC, Connect-RPC, gRPC-Web, JSON-RPC")
+	logger.Info("Starting HTTP/2 server",
+		"addr", addr,
+		"jsonrpc", "http://localhost"+addr+"/api/jsonrpc",
+		"rpc", "http://localhost"+addr+"/calculator.v1.CalculatorService/[method]",
+		"protocols", "HTTP/1.1, HTTP/2 (h2c), gRPC, Connect-RPC, gRPC-Web, JSON-RPC")
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Server failed: %v", err)
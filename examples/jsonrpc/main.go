@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/i2y/hyperway/rpc"
@@ -51,6 +53,9 @@ func subtract(ctx context.Context, req *AddRequest) (*AddResponse, error) {
 const defaultBatchLimit = 50
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create a service with JSON-RPC enabled
 	svc := rpc.NewService("CalculatorService",
 		rpc.WithPackage("calculator.v1"),
@@ -66,14 +71,16 @@ func main() {
 	rpc.MustRegister(svc, "subtract", subtract)
 
 	// Create gateway - this supports gRPC, Connect, gRPC-Web, and JSON-RPC
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
 	// Create HTTP server
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
 	// Add a simple index page
 	mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
@@ -81,9 +88,10 @@ func main() {
 	})
 
 	addr := ":8082"
-	log.Printf("Starting server on %s", addr)
-	log.Printf("JSON-RPC endpoint: http://localhost%s/api/jsonrpc", addr)
-	log.Printf("Try the demo at: http://localhost%s/index.html", addr)
+	logger.Info("Starting server",
+		"addr", addr,
+		"jsonrpc", "http://localhost"+addr+"/api/jsonrpc",
+		"demo", "http://localhost"+addr+"/index.html")
 
 	server := &http.Server{
 		Addr:    addr,
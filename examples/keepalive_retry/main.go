@@ -11,8 +11,6 @@ import (
 
 	"github.com/i2y/hyperway/gateway"
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 // Constants for configuration
@@ -31,10 +29,6 @@ const (
 	retryThrottleMax       = 100
 	retryThrottleRatio     = 0.875
 	retryTokenRatio        = 0.1
-	httpReadTimeout        = 30 * time.Second
-	httpWriteTimeout       = 30 * time.Second
-	httpIdleTimeout        = 120 * time.Second
-	httpHeaderTimeout      = 5 * time.Second
 )
 
 // EchoRequest represents an echo request.
@@ -165,17 +159,8 @@ func main() {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
-	// Create HTTP server with h2c for both HTTP/1.1 and HTTP/2 support
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(gw, h2s)
-	server := &http.Server{
-		Addr:              serverPort,
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
+	// Create an HTTP/2 server that sends keepalive pings and enforces the ping policy
+	server := gateway.NewHTTP2Server(serverPort, gw, gatewayOpts)
 
 	fmt.Println("Server Configuration:")
 	fmt.Printf("- Keepalive Time: %v\n", keepaliveParams.Time)
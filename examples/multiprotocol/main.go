@@ -6,21 +6,14 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 // Constants
 const (
 	maxConcurrentStreams = 100
-	httpReadTimeout      = 30 * time.Second
-	httpWriteTimeout     = 30 * time.Second
-	httpIdleTimeout      = 120 * time.Second
-	httpHeaderTimeout    = 5 * time.Second
 )
 
 // Simple echo service for testing
@@ -72,18 +65,6 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Create server with h2c to support both HTTP/1.1 and HTTP/2
-	srv := &http.Server{
-		Addr: ":9090",
-		Handler: h2c.NewHandler(gateway, &http2.Server{
-			MaxConcurrentStreams: maxConcurrentStreams,
-		}),
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
 	log.Println("Multi-protocol server starting on :9090")
 	log.Println("This server supports all of the following on the SAME PORT:")
 	log.Println("")
@@ -112,5 +93,10 @@ func main() {
 	log.Println(`   grpcurl -plaintext localhost:9090 describe multiprotocol.v1.EchoService`)
 	log.Println("")
 
-	log.Fatal(srv.ListenAndServe())
+	// Serves HTTP/1.1 and HTTP/2 (h2c) on the same port until interrupted
+	if err := rpc.Run(context.Background(), ":9090", gateway,
+		rpc.WithMaxConcurrentStreams(maxConcurrentStreams),
+	); err != nil {
+		log.Fatal(err)
+	}
 }
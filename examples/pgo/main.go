@@ -5,23 +5,20 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/i2y/hyperway/codec"
-	"github.com/i2y/hyperway/internal/proto"
+	"github.com/i2y/hyperway/gateway"
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 // Constants
 const (
-	pgoRecompileDelay = 30 * time.Second
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
+	pgoWarmupDecodes = 1000
+	pgoDriftWindow   = 1000
+	accessLogSample  = 0.01
 )
 
 // ComplexMessage represents a complex message for PGO demonstration
@@ -58,10 +55,30 @@ func processMessage(ctx context.Context, req *ComplexMessage) (*Response, error)
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service with PGO enabled
+	codecOpts := codec.DefaultOptions()
+	codecOpts.Backend = codec.BackendHyperpb
+	codecOpts.EnablePGO = true
+	// Recompile after a warm-up, then again whenever the traffic drifts
+	codecOpts.RecompileAfter = pgoWarmupDecodes
+	codecOpts.Drift = &codec.DriftPolicy{
+		Window:    pgoDriftWindow,
+		Recompile: true,
+		OnDrift: func(report codec.DriftReport) {
+			logger.Warn("Decode drift",
+				"message", report.Message,
+				"size_before", report.Baseline.MeanSize, "size_after", report.Current.MeanSize,
+				"p50_before", report.Baseline.P50, "p50_after", report.Current.P50,
+				"recompiled", report.Recompiled)
+		},
+	}
 	svc := rpc.NewService("PGODemo",
 		rpc.WithPackage("pgo.v1"),
 		rpc.WithValidation(false), // Disable validation for performance testing
+		rpc.WithCodecOptions(codecOpts),
 	)
 
 	// Register method
@@ -69,62 +86,33 @@ func main() {
 		log.Fatalf("Failed to register ProcessMessage: %v", err)
 	}
 
-	// Create gateway
-	gateway, err := rpc.NewGateway(svc)
+	// Create gateway, logging a sample of the load test requests
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	opts.AccessLog = &gateway.AccessLogConfig{SampleRate: accessLogSample}
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Start server with h2c for both HTTP/1.1 and HTTP/2 support
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(gateway, h2s)
-	srv := &http.Server{
-		Addr:              ":8090",
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
-
-	log.Println("PGO Demo server starting on :8090")
-	log.Println("The server will collect profiles for the first 30 seconds,")
-	log.Println("then recompile with PGO for optimized performance.")
-
-	// Schedule PGO recompilation after 30 seconds
-	go func() {
-		time.Sleep(pgoRecompileDelay)
-		log.Println("Recompiling message types with collected profiles...")
+	logger.Info("PGO Demo server starting", "addr", ":8090",
+		"recompile_after", pgoWarmupDecodes, "drift_window", pgoDriftWindow)
 
-		if err := proto.GlobalPGOManager.RecompileAll(); err != nil {
-			log.Printf("Failed to recompile with PGO: %v", err)
-		} else {
-			log.Println("Successfully recompiled with PGO! Performance should now be optimized.")
-		}
-	}()
-
-	// Enable PGO in codec options
-	codec.DefaultDecoderOptions.EnablePGO = true
-
-	log.Fatal(srv.ListenAndServe())
+	// Serves HTTP/1.1 and HTTP/2 (h2c) until interrupted
+	if err := rpc.Run(context.Background(), ":8090", gw); err != nil {
+		log.Fatal(err)
+	}
 }
 
 // To test this example:
 // 1. Start the server: go run examples/pgo/main.go
-// 2. Send many requests during the first 30 seconds to build a profile:
-//    for i in {1..1000}; do
+// 2. Send many protobuf requests to build a profile (JSON requests are not
+//    decoded with hyperpb), with message.binpb holding an encoded ComplexMessage:
+//    for i in {1..2000}; do
 //      curl -X POST http://localhost:8090/pgo.v1.PGODemo/ProcessMessage \
-//        -H "Content-Type: application/json" \
-//        -d '{
-//          "id": "msg-'$i'",
-//          "timestamp": "'$(date -u +"%Y-%m-%dT%H:%M:%SZ")'",
-//          "data": {"key1": "value1", "key2": "value2"},
-//          "items": [
-//            {"name": "item1", "value": 123.45, "tags": ["tag1", "tag2"]},
-//            {"name": "item2", "value": 678.90, "tags": ["tag3"]}
-//          ],
-//          "metadata": {"version": 1, "source": "test"}
-//        }' &
+//        -H "Content-Type: application/proto" \
+//        --data-binary @message.binpb &
 //    done
-// 3. After 30 seconds, the server will recompile with PGO
-// 4. Continue sending requests to see optimized performance
+// 3. After 1000 requests, the server recompiles with PGO
+// 4. Change the shape of the requests (e.g. more items) to see the drift
+//    being detected and the message type recompiled
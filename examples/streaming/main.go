@@ -4,21 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/i2y/hyperway/gateway"
 	"github.com/i2y/hyperway/rpc"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 // Constants
 const (
-	countDelay        = 100 * time.Millisecond
-	httpReadTimeout   = 30 * time.Second
-	httpWriteTimeout  = 30 * time.Second
-	httpIdleTimeout   = 120 * time.Second
-	httpHeaderTimeout = 5 * time.Second
+	countDelay = 100 * time.Millisecond
 )
 
 // CountRequest represents a request to count
@@ -46,12 +43,8 @@ type TimeResponse struct {
 
 // Service handlers
 func handleCount(ctx context.Context, req *CountRequest, stream rpc.ServerStream[CountResponse]) error {
-	log.Printf("Count request: up to %d", req.UpTo)
-
-	// Get handler context to set headers
-	if hctx := rpc.GetHandlerContext(ctx); hctx != nil {
-		hctx.SetResponseHeader("X-Stream-Type", "count")
-	}
+	// Set headers through the call metadata
+	rpc.Meta(ctx).SetHeader(rpc.Pairs("X-Stream-Type", "count"))
 
 	for i := 1; i <= req.UpTo; i++ {
 		resp := &CountResponse{
@@ -68,20 +61,14 @@ func handleCount(ctx context.Context, req *CountRequest, stream rpc.ServerStream
 	}
 
 	// Set trailer
-	if hctx := rpc.GetHandlerContext(ctx); hctx != nil {
-		hctx.SetResponseTrailer("X-Total-Count", fmt.Sprintf("%d", req.UpTo))
-	}
+	rpc.Meta(ctx).SetTrailer(rpc.Pairs("X-Total-Count", fmt.Sprintf("%d", req.UpTo)))
 
 	return nil
 }
 
 func handleTime(ctx context.Context, req *TimeRequest, stream rpc.ServerStream[TimeResponse]) error {
-	log.Printf("Time request: %d updates every %d seconds", req.Count, req.Interval)
-
-	// Get handler context to set headers
-	if hctx := rpc.GetHandlerContext(ctx); hctx != nil {
-		hctx.SetResponseHeader("X-Stream-Type", "time")
-	}
+	// Set headers through the call metadata
+	rpc.Meta(ctx).SetHeader(rpc.Pairs("X-Stream-Type", "time"))
 
 	ticker := time.NewTicker(time.Duration(req.Interval) * time.Second)
 	defer ticker.Stop()
@@ -110,6 +97,9 @@ func handleTime(ctx context.Context, req *TimeRequest, stream rpc.ServerStream[T
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service
 	svc := rpc.NewService("StreamingExample",
 		rpc.WithPackage("examples.streaming.v1"),
@@ -119,15 +109,20 @@ func main() {
 	rpc.MustRegisterServerStream(svc, "Count", handleCount)
 	rpc.MustRegisterServerStream(svc, "Time", handleTime)
 
-	// Create gateway
-	gateway, err := rpc.NewGateway(svc)
+	// Create gateway with structured access logging
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{
+		EnableOpenAPI: true,
+		CORSConfig:    gateway.DefaultCORSConfig(),
+		Logger:        logger,
+		AccessLog:     &gateway.AccessLogConfig{GenerateRequestID: true},
+	}, svc)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Create HTTP server
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
 	// Add a simple HTML page for testing
 	mux.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
@@ -135,28 +130,17 @@ func main() {
 		_, _ = fmt.Fprint(w, testHTML)
 	})
 
-	log.Println("Streaming server starting on :8080")
-	log.Println("Test page: http://localhost:8080/test")
-	log.Println("")
-	log.Println("Example requests:")
-	log.Println("  Count (Connect): curl -X POST http://localhost:8080/examples.streaming.v1.StreamingExample/Count -H 'Content-Type: application/json' -d '{\"up_to\": 5}'")
-	log.Println("  Time (Connect):  curl -X POST http://localhost:8080/examples.streaming.v1.StreamingExample/Time -H 'Content-Type: application/json' -d '{\"interval_seconds\": 1, \"count\": 3}'")
-	log.Println("  Count (gRPC):    grpcurl -plaintext -d '{\"up_to\": 5}' localhost:8080 examples.streaming.v1.StreamingExample/Count")
-
-	// Use h2c (HTTP/2 without TLS) for gRPC support
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(mux, h2s)
-
-	server := &http.Server{
-		Addr:              ":8080",
-		Handler:           handler,
-		ReadTimeout:       httpReadTimeout,
-		WriteTimeout:      httpWriteTimeout,
-		IdleTimeout:       httpIdleTimeout,
-		ReadHeaderTimeout: httpHeaderTimeout,
-	}
+	addr := ":8080"
+	logger.Info("Streaming server starting",
+		"addr", addr,
+		"test", "http://localhost"+addr+"/test",
+		"count_connect", "curl -X POST http://localhost"+addr+`/examples.streaming.v1.StreamingExample/Count -H 'Content-Type: application/json' -d '{"up_to": 5}'`,
+		"time_connect", "curl -X POST http://localhost"+addr+`/examples.streaming.v1.StreamingExample/Time -H 'Content-Type: application/json' -d '{"interval_seconds": 1, "count": 3}'`,
+		"count_grpc", `grpcurl -plaintext -d '{"up_to": 5}' localhost`+addr+" examples.streaming.v1.StreamingExample/Count")
 
-	if err := server.ListenAndServe(); err != nil {
+	// Serves h2c (HTTP/2 without TLS) for gRPC, without write timeouts that
+	// would cut off the streams
+	if err := rpc.Run(context.Background(), addr, mux); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -47,27 +49,10 @@ type FlexibleDataResponse struct {
 type ConfigService struct{}
 
 func (s *ConfigService) UpdateConfig(ctx context.Context, req *ConfigUpdateRequest) (*ConfigUpdateResponse, error) {
-	log.Printf("UpdateConfig called")
-	log.Printf("Request type: %T", req)
-
-	// Safely handle nil UpdateMask
-	if req.UpdateMask != nil {
-		log.Printf("UpdateMask paths: %v", req.UpdateMask.GetPaths())
-		log.Printf("UpdateMask type: %T", req.UpdateMask)
-	} else {
-		log.Printf("UpdateMask is nil")
-	}
-
-	// Safely handle nil Config
-	if req.Config != nil {
-		log.Printf("Config has %d fields", len(req.Config.Fields))
-		log.Printf("Config type: %T", req.Config)
-		for k, v := range req.Config.Fields {
-			log.Printf("  %s: %v (type: %T)", k, v, v)
-		}
-	} else {
-		log.Printf("Config is nil")
-	}
+	// GetPaths and AsMap handle a nil UpdateMask and Config
+	slog.InfoContext(ctx, "Updating config",
+		"update_mask", req.UpdateMask.GetPaths(),
+		"config", req.Config.AsMap())
 
 	// In a real implementation, you would:
 	// 1. Load existing config
@@ -82,8 +67,6 @@ func (s *ConfigService) UpdateConfig(ctx context.Context, req *ConfigUpdateReque
 }
 
 func (s *ConfigService) ProcessFlexibleData(ctx context.Context, req *FlexibleDataRequest) (*FlexibleDataResponse, error) {
-	log.Printf("ProcessFlexibleData called")
-
 	propertyCount := 0
 	if req.Properties != nil {
 		propertyCount = len(req.Properties)
@@ -111,7 +94,7 @@ func (s *ConfigService) ProcessFlexibleData(ctx context.Context, req *FlexibleDa
 		summary += fmt.Sprintf(", list has %d items", len(req.MixedList.Values))
 	}
 
-	log.Printf("ProcessFlexibleData: %s", summary)
+	slog.InfoContext(ctx, "Processed flexible data", "summary", summary)
 
 	return &FlexibleDataResponse{
 		Processed: true,
@@ -120,6 +103,9 @@ func (s *ConfigService) ProcessFlexibleData(ctx context.Context, req *FlexibleDa
 }
 
 func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
 	// Create service
 	svc := rpc.NewService("ConfigService",
 		rpc.WithPackage("config.v1"),
@@ -139,14 +125,16 @@ func main() {
 	}
 
 	// Create gateway
-	gateway, err := rpc.NewGateway(svc)
+	opts := rpc.DefaultGatewayOptions()
+	opts.Logger = logger
+	gw, err := rpc.NewGatewayWithOptions(opts, svc)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Start server
 	mux := http.NewServeMux()
-	mux.Handle("/", gateway)
+	mux.Handle("/", gw)
 
 	// Add a test endpoint that demonstrates usage
 	mux.HandleFunc("/test", testEndpoint)
@@ -155,9 +143,10 @@ func main() {
 	h2s := &http2.Server{}
 	handler := h2c.NewHandler(mux, h2s)
 
-	log.Println("Well-Known Types example server running on :8080")
-	log.Println("- gRPC/Connect: :8080 (with HTTP/2 h2c support)")
-	log.Println("- Test endpoint: http://localhost:8080/test")
+	logger.Info("Well-Known Types example server running",
+		"addr", ":8080",
+		"protocols", "gRPC/Connect with HTTP/2 h2c support",
+		"test", "http://localhost:8080/test")
 	log.Fatal(http.ListenAndServe(":8080", handler))
 }
 
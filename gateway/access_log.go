@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Access log constants
+const (
+	defaultRequestIDHeader = "X-Request-Id"
+	requestIDBytes         = 8
+	httpStatusErrorFloor   = 400
+)
+
+// AccessLogConfig configures structured access logging.
+// Access logs are only emitted when Options.Logger is set.
+type AccessLogConfig struct {
+	// SampleRate is the fraction of successful requests that are logged (0.0-1.0).
+	// Zero logs every request. Failed requests are always logged.
+	SampleRate float64
+	// RequestIDHeader is the header used to read and propagate request IDs.
+	// Default: "X-Request-Id"
+	RequestIDHeader string
+	// GenerateRequestID generates a request ID when the client did not send one.
+	GenerateRequestID bool
+	// Level is the log level for successful requests. Default: slog.LevelInfo
+	Level slog.Level
+}
+
+// accessLogger emits one structured record per request.
+type accessLogger struct {
+	logger *slog.Logger
+	config AccessLogConfig
+	path   func(*http.Request) string // Redacts sensitive path values, if set
+}
+
+// newAccessLogger creates an access logger, returning nil if logging is disabled.
+func newAccessLogger(logger *slog.Logger, config *AccessLogConfig) *accessLogger {
+	if logger == nil {
+		return nil
+	}
+
+	al := &accessLogger{logger: logger}
+	if config != nil {
+		al.config = *config
+	}
+	if al.config.RequestIDHeader == "" {
+		al.config.RequestIDHeader = defaultRequestIDHeader
+	}
+	return al
+}
+
+// wrap wraps a handler with access logging.
+func (al *accessLogger) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(al.config.RequestIDHeader)
+		if requestID == "" && al.config.GenerateRequestID {
+			requestID = newRequestID()
+			r.Header.Set(al.config.RequestIDHeader, requestID)
+		}
+		if requestID != "" {
+			w.Header().Set(al.config.RequestIDHeader, requestID)
+		}
+
+		body := &countingReadCloser{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		aw := &ResponseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(aw, r)
+
+		al.log(r, aw, body.n, requestID, time.Since(start))
+	})
+}
+
+// log writes the access log record if it passes sampling.
+func (al *accessLogger) log(r *http.Request, aw *ResponseRecorder, bytesIn int64, requestID string, latency time.Duration) {
+	status := aw.Status()
+	grpcStatus := aw.Header().Get("grpc-status")
+	failed := status >= httpStatusErrorFloor || (grpcStatus != "" && grpcStatus != "0")
+
+	if !failed && !al.sampled() {
+		return
+	}
+
+	level := al.config.Level
+	if failed {
+		level = slog.LevelError
+	}
+
+	path := r.URL.Path
+	if al.path != nil {
+		path = al.path(r)
+	}
+	attrs := []slog.Attr{
+		slog.String("method", path),
+		slog.String("http_method", r.Method),
+		slog.String("protocol", requestProtocol(r)),
+		slog.Int("status", status),
+		slog.Duration("latency", latency),
+		slog.Int64("bytes_in", bytesIn),
+		slog.Int64("bytes_out", aw.BytesWritten()),
+		slog.String("peer", r.RemoteAddr),
+		slog.String("client_ip", clientIP(r)),
+	}
+	if grpcStatus != "" {
+		attrs = append(attrs, slog.String("grpc_status", grpcStatus))
+	}
+	if requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+
+	al.logger.LogAttrs(context.Background(), level, "rpc request", attrs...)
+}
+
+// sampled reports whether a successful request should be logged.
+func (al *accessLogger) sampled() bool {
+	rate := al.config.SampleRate
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate //nolint:gosec // sampling does not need a secure source
+}
+
+// requestProtocol returns a short protocol name for logging.
+func requestProtocol(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case isGRPCWeb(r):
+		return "grpc-web"
+	case strings.HasPrefix(contentType, "application/grpc"):
+		return "grpc"
+	case strings.Contains(contentType, "json-rpc") || strings.HasSuffix(r.URL.Path, "/jsonrpc"):
+		return "jsonrpc"
+	case r.Header.Get("Connect-Protocol-Version") != "" || strings.HasPrefix(contentType, "application/connect"):
+		return "connect"
+	default:
+		return "http"
+	}
+}
+
+// newRequestID generates a random hex request ID.
+func newRequestID() string {
+	b := make([]byte, requestIDBytes)
+	if _, err := crand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// countingReadCloser counts bytes read from the request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read reads from the underlying body and counts bytes.
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	if c.ReadCloser == nil {
+		return 0, io.EOF
+	}
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
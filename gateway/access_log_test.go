@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	svc := &Service{
+		Name:    "EchoService",
+		Package: "test.v1",
+		Handlers: map[string]http.Handler{
+			"/test.v1.EchoService/Echo": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(body)
+			}),
+		},
+	}
+
+	gw, err := New([]*Service{svc}, Options{
+		Logger:    logger,
+		AccessLog: &AccessLogConfig{GenerateRequestID: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	t.Run("logs request attributes", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/test.v1.EchoService/Echo", strings.NewReader(`{"msg":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+
+		gw.ServeHTTP(rec, req)
+
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to parse log entry %q: %v", buf.String(), err)
+		}
+		if entry["method"] != "/test.v1.EchoService/Echo" {
+			t.Errorf("Expected method in log, got %v", entry["method"])
+		}
+		if entry["protocol"] != "connect" {
+			t.Errorf("Expected protocol connect, got %v", entry["protocol"])
+		}
+		if entry["bytes_in"] != float64(12) || entry["bytes_out"] != float64(12) {
+			t.Errorf("Unexpected byte counts: in=%v out=%v", entry["bytes_in"], entry["bytes_out"])
+		}
+		if entry["request_id"] == nil || rec.Header().Get("X-Request-Id") != entry["request_id"] {
+			t.Errorf("Expected generated request ID to be logged and echoed, got %v", entry["request_id"])
+		}
+	})
+
+	t.Run("failures bypass sampling", func(t *testing.T) {
+		gw, err := New([]*Service{svc}, Options{
+			Logger:    logger,
+			AccessLog: &AccessLogConfig{SampleRate: 0.0000001},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/test.v1.EchoService/Missing", nil)
+		req.Header.Set("Content-Type", "application/grpc")
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !strings.Contains(buf.String(), `"grpc_status":"12"`) {
+			t.Errorf("Expected failed request to be logged, got %q", buf.String())
+		}
+		if !strings.Contains(buf.String(), `"level":"ERROR"`) {
+			t.Errorf("Expected failed request at error level, got %q", buf.String())
+		}
+	})
+}
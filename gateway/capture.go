@@ -0,0 +1,724 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Capture constants
+const (
+	defaultCaptureMaxBodySize = 1 << 20
+	captureFrameHeaderSize    = 5
+	captureMaxLineSize        = 64 << 20
+)
+
+// defaultCaptureRedactHeaders are the headers redacted without CaptureConfig.RedactHeaders.
+var defaultCaptureRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// CaptureRecord is a captured request and its response, in a format that can
+// be replayed against another server, see NewRequest. Records are written as
+// JSON Lines, with bodies encoded in base64.
+type CaptureRecord struct {
+	// Time is when the request was received
+	Time time.Time `json:"time"`
+	// Duration is how long the server took to respond
+	Duration time.Duration `json:"duration"`
+	// Protocol is the RPC protocol: connect, grpc, grpc-web, jsonrpc, or http
+	Protocol string `json:"protocol"`
+	// Method is the HTTP method
+	Method string `json:"method"`
+	// Path is the request path with its query, e.g. "/user.v1.UserService/GetUser"
+	Path string `json:"path"`
+	// Header is the request header, with the redacted headers replaced
+	Header http.Header `json:"header,omitempty"`
+	// Body is the request body the handler read
+	Body []byte `json:"body,omitempty"`
+	// Status is the HTTP status of the response
+	Status int `json:"status"`
+	// ResponseHeader is the response header
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	// ResponseBody is the response body
+	ResponseBody []byte `json:"response_body,omitempty"`
+	// ResponseTrailer is the response trailer, e.g. grpc-status
+	ResponseTrailer http.Header `json:"response_trailer,omitempty"`
+	// Incomplete is set when a body was larger than CaptureConfig.MaxBodySize
+	// or could not be redacted, and was dropped. Such records are not replayed.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// NewRequest creates a request replaying the record against baseURL, e.g.
+// "http://localhost:8080". Content-Length and hop-by-hop headers are not copied.
+func (r *CaptureRecord) NewRequest(ctx context.Context, baseURL string) (*http.Request, error) {
+	if r.Incomplete {
+		return nil, errors.New("capture record is incomplete")
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, strings.TrimSuffix(baseURL, "/")+r.Path, bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Connection", "Keep-Alive", "Transfer-Encoding", "Upgrade", "Host":
+			continue
+		}
+		req.Header[key] = slices.Clone(values)
+	}
+	return req, nil
+}
+
+// CaptureSink receives captured records. Capture is called after the response
+// is written, from the goroutine of the request, so it must be quick and safe
+// for concurrent use.
+type CaptureSink interface {
+	Capture(record *CaptureRecord) error
+}
+
+// CaptureConfig configures the capture of requests and responses for replay,
+// e.g. with "hyperway replay".
+type CaptureConfig struct {
+	// Sink receives the records; capture is disabled without one
+	Sink CaptureSink
+	// Methods limits capture to these procedures (e.g. "user.v1.UserService/GetUser").
+	// Empty captures all requests.
+	Methods []string
+	// SampleRate is the fraction of requests captured. 0 or 1 captures all requests.
+	SampleRate float64
+	// RedactHeaders are replaced with RedactedValue in requests and responses.
+	// Default: Authorization, Cookie, Set-Cookie, and Proxy-Authorization
+	RedactHeaders []string
+	// RedactFields clears these dot-separated field paths (e.g. "user.password")
+	// in request and response messages, in addition to the fields with the
+	// debug_redact option, such as fields tagged sensitive. Segments match
+	// protobuf or JSON field names. Bodies that cannot be redacted, such as
+	// compressed messages, are dropped.
+	RedactFields []string
+	// MaxBodySize is the number of bytes of a body captured (default 1 MiB).
+	// Larger bodies are dropped.
+	MaxBodySize int
+	// OnError is called when the sink fails
+	OnError func(error)
+}
+
+// capturer records the requests of the gateway.
+type capturer struct {
+	config  CaptureConfig
+	headers map[string]bool
+	fields  [][]string
+	methods func(path string) protoreflect.MethodDescriptor // Finds the method of a path, if set
+	// sensitive caches whether messages have debug_redact fields
+	sensitive sync.Map // protoreflect.FullName -> bool
+}
+
+// newCapturer creates a capturer, returning nil if capture is disabled.
+func newCapturer(config *CaptureConfig) *capturer {
+	if config == nil || config.Sink == nil {
+		return nil
+	}
+
+	c := &capturer{config: *config, headers: make(map[string]bool)}
+	if c.config.MaxBodySize <= 0 {
+		c.config.MaxBodySize = defaultCaptureMaxBodySize
+	}
+	redact := c.config.RedactHeaders
+	if redact == nil {
+		redact = defaultCaptureRedactHeaders
+	}
+	for _, key := range redact {
+		c.headers[http.CanonicalHeaderKey(key)] = true
+	}
+	for _, path := range c.config.RedactFields {
+		c.fields = append(c.fields, strings.Split(path, "."))
+	}
+	return c
+}
+
+// wrap wraps a handler with capture.
+func (c *capturer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.selected(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		record := &CaptureRecord{
+			Time:     start,
+			Protocol: requestProtocol(r),
+			Method:   r.Method,
+			Path:     r.URL.RequestURI(),
+			Header:   c.redactHeader(r.Header),
+		}
+		body := &captureBuffer{limit: c.config.MaxBodySize}
+		if r.Body != nil {
+			r.Body = &captureReadCloser{ReadCloser: r.Body, buf: body}
+		}
+		// Copy the response header when it is written, and the body
+		respBody := &captureBuffer{limit: c.config.MaxBodySize}
+		var respHeader http.Header
+		rw := &ResponseRecorder{
+			ResponseWriter: w,
+			beforeHeader:   func() { respHeader = snapshotHeader(w.Header()) },
+			onWrite:        respBody.capture,
+		}
+
+		next.ServeHTTP(rw, r)
+
+		if !rw.Written() {
+			respHeader = snapshotHeader(w.Header())
+		}
+		record.Duration = time.Since(start)
+		record.Status = rw.Status()
+		record.ResponseHeader = c.redactHeader(respHeader)
+		record.ResponseTrailer = c.redactHeader(responseTrailers(w.Header()))
+		c.setBodies(record, r, body, respBody)
+
+		if err := c.config.Sink.Capture(record); err != nil && c.config.OnError != nil {
+			c.config.OnError(err)
+		}
+	})
+}
+
+// selected reports whether a request is captured.
+func (c *capturer) selected(r *http.Request) bool {
+	if len(c.config.Methods) > 0 && !slices.Contains(c.config.Methods, strings.TrimPrefix(r.URL.Path, "/")) {
+		return false
+	}
+	rate := c.config.SampleRate
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate //nolint:gosec // sampling does not need a secure source
+}
+
+// redactHeader returns a copy of header with the redacted headers replaced.
+func (c *capturer) redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := header.Clone()
+	for key, values := range redacted {
+		if c.headers[http.CanonicalHeaderKey(key)] {
+			redacted[key] = slices.Repeat([]string{RedactedValue}, len(values))
+		}
+	}
+	return redacted
+}
+
+// methodsOf returns a function finding the methods of request paths in resolver.
+func methodsOf(resolver *descriptorResolver) func(path string) protoreflect.MethodDescriptor {
+	return func(path string) protoreflect.MethodDescriptor {
+		service, method, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+		if !ok {
+			return nil
+		}
+		desc, err := resolver.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			return nil
+		}
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil
+		}
+		return sd.Methods().ByName(protoreflect.Name(method))
+	}
+}
+
+// setBodies sets the redacted bodies of a record, dropping the ones that were
+// truncated or cannot be redacted.
+func (c *capturer) setBodies(record *CaptureRecord, r *http.Request, req, resp *captureBuffer) {
+	if req.truncated || resp.truncated {
+		record.Incomplete = true
+		return
+	}
+	record.Body, record.ResponseBody = req.Bytes(), resp.Bytes()
+
+	var method protoreflect.MethodDescriptor
+	if c.methods != nil {
+		method = c.methods(r.URL.Path)
+	}
+	var input, output protoreflect.MessageDescriptor
+	if method != nil {
+		input, output = method.Input(), method.Output()
+	}
+	if len(c.fields) == 0 && !c.hasSensitiveFields(input) && !c.hasSensitiveFields(output) {
+		return
+	}
+	var err error
+	if record.Body, err = c.redactBody(record.Body, r.Header.Get("Content-Type"), input); err != nil {
+		record.Body, record.ResponseBody, record.Incomplete = nil, nil, true
+		return
+	}
+	if record.ResponseBody, err = c.redactBody(record.ResponseBody, record.ResponseHeader.Get("Content-Type"), output); err != nil {
+		record.Body, record.ResponseBody, record.Incomplete = nil, nil, true
+	}
+}
+
+// errCaptureUnredactable is returned for bodies whose fields cannot be redacted.
+var errCaptureUnredactable = errors.New("body cannot be redacted")
+
+// redactBody clears the redacted fields and the debug_redact fields of desc
+// in a body: a JSON document, a protobuf message, or enveloped messages of
+// gRPC, gRPC-Web, or Connect streams.
+func (c *capturer) redactBody(body []byte, contentType string, desc protoreflect.MessageDescriptor) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case mediaType == "application/json":
+		return c.redactJSON(body, desc)
+	case mediaType == "application/proto" || mediaType == "application/protobuf" || mediaType == "application/x-protobuf":
+		return c.redactProto(body, desc, false)
+	case strings.HasPrefix(mediaType, "application/grpc-web-text"):
+		return nil, errCaptureUnredactable
+	case strings.HasPrefix(mediaType, "application/grpc"), strings.HasPrefix(mediaType, "application/connect+"):
+		return c.redactEnvelopes(body, desc, strings.HasSuffix(mediaType, "+json"))
+	default:
+		return nil, errCaptureUnredactable
+	}
+}
+
+// redactEnvelopes redacts the uncompressed messages of enveloped frames,
+// keeping end-of-stream and trailer frames as they are.
+func (c *capturer) redactEnvelopes(body []byte, desc protoreflect.MessageDescriptor, isJSON bool) ([]byte, error) {
+	var out bytes.Buffer
+	for len(body) > 0 {
+		if len(body) < captureFrameHeaderSize {
+			return nil, errCaptureUnredactable
+		}
+		flag, size := body[0], binary.BigEndian.Uint32(body[1:captureFrameHeaderSize])
+		if uint64(len(body)-captureFrameHeaderSize) < uint64(size) {
+			return nil, errCaptureUnredactable
+		}
+		payload := body[captureFrameHeaderSize : captureFrameHeaderSize+int(size)]
+		body = body[captureFrameHeaderSize+int(size):]
+
+		switch {
+		case flag == 0:
+			redacted, err := c.redactProto(payload, desc, isJSON)
+			if err != nil {
+				return nil, err
+			}
+			payload = redacted
+		case flag&grpcWebMessageFlagCompressed != 0:
+			return nil, errCaptureUnredactable
+		}
+		var header [captureFrameHeaderSize]byte
+		header[0] = flag
+		binary.BigEndian.PutUint32(header[1:], uint32(len(payload))) //nolint:gosec // redacted messages are not larger
+		out.Write(header[:])
+		out.Write(payload)
+	}
+	return out.Bytes(), nil
+}
+
+// redactProto clears the redacted fields of a protobuf message.
+func (c *capturer) redactProto(data []byte, desc protoreflect.MessageDescriptor, isJSON bool) ([]byte, error) {
+	if isJSON {
+		return c.redactJSON(data, desc)
+	}
+	if desc == nil {
+		return nil, errCaptureUnredactable
+	}
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCaptureUnredactable, err)
+	}
+	for _, path := range c.fields {
+		redactMessageField(msg, path)
+	}
+	clearSensitiveFields(msg)
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// redactJSON sets the redacted fields of a JSON document, and the
+// debug_redact fields of desc if set, to null, which protobuf JSON reads as
+// the default value.
+func (c *capturer) redactJSON(data []byte, desc protoreflect.MessageDescriptor) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCaptureUnredactable, err)
+	}
+	for _, path := range c.fields {
+		redactJSONField(doc, path)
+	}
+	if desc != nil {
+		redactSensitiveJSON(doc, desc)
+	}
+	return json.Marshal(doc)
+}
+
+// hasSensitiveFields reports whether desc or its nested messages have fields
+// with the debug_redact option.
+func (c *capturer) hasSensitiveFields(desc protoreflect.MessageDescriptor) bool {
+	if desc == nil {
+		return false
+	}
+	if sensitive, ok := c.sensitive.Load(desc.FullName()); ok {
+		return sensitive.(bool)
+	}
+	sensitive := sensitiveDescriptor(desc, make(map[protoreflect.FullName]bool))
+	c.sensitive.Store(desc.FullName(), sensitive)
+	return sensitive
+}
+
+// sensitiveDescriptor reports whether desc or the messages it nests, which
+// are not in visited, have debug_redact fields.
+func sensitiveDescriptor(desc protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) bool {
+	if visited[desc.FullName()] {
+		return false
+	}
+	visited[desc.FullName()] = true
+	fields := desc.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if debugRedact(fd) {
+			return true
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Message() != nil && sensitiveDescriptor(fd.Message(), visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// debugRedact reports whether a field has the debug_redact option.
+func debugRedact(fd protoreflect.FieldDescriptor) bool {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && opts.GetDebugRedact()
+}
+
+// clearSensitiveFields clears the debug_redact fields of msg and its nested
+// messages.
+func clearSensitiveFields(msg protoreflect.Message) {
+	var clears []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case debugRedact(fd):
+			clears = append(clears, fd)
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			for i := range v.List().Len() {
+				clearSensitiveFields(v.List().Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Kind() == protoreflect.MessageKind:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				clearSensitiveFields(mv.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Kind() == protoreflect.MessageKind:
+			clearSensitiveFields(v.Message())
+		}
+		return true
+	})
+	for _, fd := range clears {
+		msg.Clear(fd)
+	}
+}
+
+// redactSensitiveJSON sets the debug_redact fields of desc in a JSON value
+// to null, descending into arrays, maps, and nested messages.
+func redactSensitiveJSON(value any, desc protoreflect.MessageDescriptor) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			redactSensitiveJSON(item, desc)
+		}
+	case map[string]any:
+		fields := desc.Fields()
+		for key, field := range v {
+			fd := fields.ByJSONName(key)
+			if fd == nil {
+				fd = fields.ByName(protoreflect.Name(key))
+			}
+			switch {
+			case fd == nil:
+			case debugRedact(fd):
+				v[key] = nil
+			case fd.IsMap() && fd.MapValue().Message() != nil:
+				if entries, ok := field.(map[string]any); ok {
+					for _, entry := range entries {
+						redactSensitiveJSON(entry, fd.MapValue().Message())
+					}
+				}
+			case fd.Message() != nil && !fd.IsMap():
+				redactSensitiveJSON(field, fd.Message())
+			}
+		}
+	}
+}
+
+// redactJSONField sets a field path of a JSON value to null, descending
+// into arrays.
+func redactJSONField(value any, path []string) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			redactJSONField(item, path)
+		}
+	case map[string]any:
+		for _, key := range []string{path[0], jsonCamelCase(path[0])} {
+			field, ok := v[key]
+			if !ok {
+				continue
+			}
+			if len(path) == 1 {
+				v[key] = nil
+			} else {
+				redactJSONField(field, path[1:])
+			}
+		}
+	}
+}
+
+// jsonCamelCase returns the JSON name of a protobuf field name, e.g.
+// "createdAt" for "created_at".
+func jsonCamelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// redactMessageField clears a field path of a message, descending into
+// repeated and map message fields.
+func redactMessageField(msg protoreflect.Message, path []string) {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(path[0]))
+	if fd == nil {
+		fd = fields.ByJSONName(path[0])
+	}
+	if fd == nil || !msg.Has(fd) {
+		return
+	}
+	if len(path) == 1 {
+		msg.Clear(fd)
+		return
+	}
+
+	switch {
+	case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+		list := msg.Mutable(fd).List()
+		for i := range list.Len() {
+			redactMessageField(list.Get(i).Message(), path[1:])
+		}
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.MessageKind:
+		msg.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+			redactMessageField(v.Message(), path[1:])
+			return true
+		})
+	case !fd.IsList() && !fd.IsMap() && fd.Kind() == protoreflect.MessageKind:
+		redactMessageField(msg.Mutable(fd).Message(), path[1:])
+	}
+}
+
+// responseTrailers returns the trailers of a response: the fields declared
+// in the Trailer header and the ones set with the http.TrailerPrefix.
+func responseTrailers(headers http.Header) http.Header {
+	declared := declaredTrailers(headers)
+	trailers := make(http.Header)
+	for key, values := range headers {
+		if name, prefixed := strings.CutPrefix(key, http.TrailerPrefix); prefixed {
+			trailers[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+		} else if declared[http.CanonicalHeaderKey(key)] {
+			trailers[key] = slices.Clone(values)
+		}
+	}
+	return trailers
+}
+
+// captureBuffer keeps the first limit bytes written to it.
+type captureBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// capture appends b while the buffer is under its limit.
+func (b *captureBuffer) capture(p []byte) {
+	if b.truncated {
+		return
+	}
+	if b.Len()+len(p) > b.limit {
+		b.truncated = true
+		b.Reset()
+		return
+	}
+	b.Write(p)
+}
+
+// captureReadCloser copies the request body read by the handler.
+type captureReadCloser struct {
+	io.ReadCloser
+	buf *captureBuffer
+}
+
+// Read copies the bytes read.
+func (r *captureReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.capture(p[:n])
+	return n, err
+}
+
+// snapshotHeader copies a response header, without the trailers declared in
+// it.
+func snapshotHeader(h http.Header) http.Header {
+	header := h.Clone()
+	for key := range header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			delete(header, key)
+		}
+	}
+	return header
+}
+
+// CaptureWriter writes records as JSON Lines.
+type CaptureWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewCaptureWriter creates a sink writing records to w as JSON Lines.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: w}
+}
+
+// NewCaptureFile creates a sink appending records to a JSON Lines file,
+// creating it if needed.
+func NewCaptureFile(path string) (*CaptureWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec // path is chosen by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	return &CaptureWriter{w: f, closer: f}, nil
+}
+
+// Capture implements CaptureSink.
+func (cw *CaptureWriter) Capture(record *CaptureRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	_, err = cw.w.Write(line)
+	return err
+}
+
+// Close closes the file of a sink created by NewCaptureFile.
+func (cw *CaptureWriter) Close() error {
+	if cw.closer == nil {
+		return nil
+	}
+	return cw.closer.Close()
+}
+
+// CaptureRing keeps the latest records in memory, e.g. to dump them on
+// demand from an admin endpoint.
+type CaptureRing struct {
+	mu      sync.Mutex
+	records []*CaptureRecord
+	next    int
+	full    bool
+}
+
+// NewCaptureRing creates a sink keeping the latest size records.
+func NewCaptureRing(size int) *CaptureRing {
+	return &CaptureRing{records: make([]*CaptureRecord, max(size, 1))}
+}
+
+// Capture implements CaptureSink.
+func (cr *CaptureRing) Capture(record *CaptureRecord) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.records[cr.next] = record
+	cr.next = (cr.next + 1) % len(cr.records)
+	if cr.next == 0 {
+		cr.full = true
+	}
+	return nil
+}
+
+// Records returns the records kept, oldest first.
+func (cr *CaptureRing) Records() []*CaptureRecord {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if !cr.full {
+		return slices.Clone(cr.records[:cr.next])
+	}
+	return append(slices.Clone(cr.records[cr.next:]), cr.records[:cr.next]...)
+}
+
+// WriteTo writes the records kept to w as JSON Lines, oldest first.
+func (cr *CaptureRing) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, record := range cr.Records() {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return n, err
+		}
+		written, err := w.Write(append(line, '\n'))
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadCaptureRecords reads JSON Lines records, as written by CaptureWriter.
+func ReadCaptureRecords(r io.Reader) ([]*CaptureRecord, error) {
+	var records []*CaptureRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, captureMaxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := &CaptureRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("invalid capture record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read capture records: %w", err)
+	}
+	return records, nil
+}
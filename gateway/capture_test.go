@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestCapture(t *testing.T) {
+	fdset := newUserServiceDescriptors()
+	fd, err := protodesc.NewFile(fdset.File[0], protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, response := fd.Messages().ByName("GetUserRequest"), fd.Messages().ByName("GetUserResponse")
+	newRequest := func(id string) *dynamicpb.Message {
+		msg := dynamicpb.NewMessage(request)
+		msg.Set(request.Fields().ByName("id"), protoreflect.ValueOfString(id))
+		return msg
+	}
+	envelope := func(msg proto.Message) []byte {
+		data, _ := proto.Marshal(msg)
+		frame := make([]byte, 5, 5+len(data))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(data))) //nolint:gosec // test messages are small
+		return append(frame, data...)
+	}
+
+	// GetUser wraps the request in the response, as JSON or with the gRPC protocol
+	svc := &Service{
+		Name:        "UserService",
+		Package:     "internal.users",
+		Descriptors: fdset,
+		Handlers: map[string]http.Handler{
+			"/internal.users.UserService/GetUser": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+				w.Header().Set("Set-Cookie", "session=secret")
+				if r.Header.Get("Content-Type") == "application/json" {
+					_, _ = w.Write([]byte(`{"request":` + string(body) + `}`))
+					return
+				}
+				req := dynamicpb.NewMessage(request)
+				_ = proto.Unmarshal(body[5:], req)
+				resp := dynamicpb.NewMessage(response)
+				resp.Set(response.Fields().ByName("request"), protoreflect.ValueOfMessage(req))
+				w.Header().Set("Trailer", "Grpc-Status")
+				_, _ = w.Write(envelope(resp))
+				w.Header().Set("Grpc-Status", "0")
+			}),
+		},
+	}
+	serve := func(t *testing.T, config *CaptureConfig, req *http.Request) {
+		t.Helper()
+		gw, err := New([]*Service{svc}, Options{Capture: config})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	jsonRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/internal.users.UserService/GetUser", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		return req
+	}
+
+	t.Run("records replayable requests", func(t *testing.T) {
+		ring := NewCaptureRing(1)
+		serve(t, &CaptureConfig{Sink: ring}, jsonRequest(`{"id":"1"}`))
+		serve(t, &CaptureConfig{Sink: ring}, jsonRequest(`{"id":"2"}`))
+
+		records := ring.Records()
+		if len(records) != 1 {
+			t.Fatalf("Expected the ring to keep 1 record, got %d", len(records))
+		}
+		record := records[0]
+		if string(record.Body) != `{"id":"2"}` || string(record.ResponseBody) != `{"request":{"id":"2"}}` || record.Status != http.StatusOK {
+			t.Errorf("Unexpected record: %s -> %d %s", record.Body, record.Status, record.ResponseBody)
+		}
+		if record.Header.Get("Authorization") != RedactedValue || record.ResponseHeader.Get("Set-Cookie") != RedactedValue {
+			t.Errorf("Expected credentials to be redacted, got %v and %v", record.Header, record.ResponseHeader)
+		}
+
+		var buf bytes.Buffer
+		if _, err := ring.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadCaptureRecords(&buf)
+		if err != nil || len(read) != 1 {
+			t.Fatalf("Expected to read the record back, got %v: %v", read, err)
+		}
+		replay, err := read[0].NewRequest(context.Background(), "http://replay.example/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(replay.Body)
+		if replay.URL.String() != "http://replay.example/internal.users.UserService/GetUser" || string(body) != `{"id":"2"}` ||
+			replay.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected replay request %s %s %v", replay.URL, body, replay.Header)
+		}
+	})
+
+	t.Run("redacts fields", func(t *testing.T) {
+		ring := NewCaptureRing(2)
+		config := &CaptureConfig{Sink: ring, RedactFields: []string{"id", "request.id"}}
+		serve(t, config, jsonRequest(`{"id":"1"}`))
+
+		req := httptest.NewRequest(http.MethodPost, "/internal.users.UserService/GetUser", bytes.NewReader(envelope(newRequest("secret"))))
+		req.Header.Set("Content-Type", "application/grpc")
+		serve(t, config, req)
+
+		records := ring.Records()
+		if string(records[0].Body) != `{"id":null}` || string(records[0].ResponseBody) != `{"request":{"id":null}}` {
+			t.Errorf("Expected JSON fields to be redacted, got %s and %s", records[0].Body, records[0].ResponseBody)
+		}
+		grpcRecord := records[1]
+		if grpcRecord.Incomplete || bytes.Contains(grpcRecord.Body, []byte("secret")) || bytes.Contains(grpcRecord.ResponseBody, []byte("secret")) {
+			t.Errorf("Expected gRPC messages to be redacted, got %q and %q", grpcRecord.Body, grpcRecord.ResponseBody)
+		}
+		if !bytes.Equal(grpcRecord.Body, envelope(dynamicpb.NewMessage(request))) {
+			t.Errorf("Expected an empty request message, got %q", grpcRecord.Body)
+		}
+		if grpcRecord.ResponseTrailer.Get("Grpc-Status") != "0" {
+			t.Errorf("Expected the grpc-status trailer, got %v", grpcRecord.ResponseTrailer)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/internal.users.UserService/GetUser", strings.NewReader("opaque"))
+		req.Header.Set("Content-Type", "text/plain")
+		serve(t, config, req)
+		if record := ring.Records()[1]; !record.Incomplete || record.Body != nil {
+			t.Errorf("Expected a body that cannot be redacted to be dropped, got %q", record.Body)
+		}
+	})
+
+	t.Run("redacts debug_redact fields by default", func(t *testing.T) {
+		sensitive := *svc
+		sensitive.Descriptors = newUserServiceDescriptors()
+		sensitive.Descriptors.File[0].MessageType[0].Field[0].Options = &descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)}
+		ring := NewCaptureRing(2)
+		gw, err := New([]*Service{&sensitive}, Options{Capture: &CaptureConfig{Sink: ring}})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		gw.ServeHTTP(httptest.NewRecorder(), jsonRequest(`{"id":"secret"}`))
+		req := httptest.NewRequest(http.MethodPost, "/internal.users.UserService/GetUser", bytes.NewReader(envelope(newRequest("secret"))))
+		req.Header.Set("Content-Type", "application/grpc")
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+
+		records := ring.Records()
+		if string(records[0].Body) != `{"id":null}` || string(records[0].ResponseBody) != `{"request":{"id":null}}` {
+			t.Errorf("Expected JSON fields to be redacted, got %s and %s", records[0].Body, records[0].ResponseBody)
+		}
+		if grpcRecord := records[1]; grpcRecord.Incomplete || !bytes.Equal(grpcRecord.Body, envelope(dynamicpb.NewMessage(request))) ||
+			bytes.Contains(grpcRecord.ResponseBody, []byte("secret")) {
+			t.Errorf("Expected gRPC messages to be redacted, got %q and %q", grpcRecord.Body, grpcRecord.ResponseBody)
+		}
+	})
+
+	t.Run("samples and filters", func(t *testing.T) {
+		ring := NewCaptureRing(10)
+		serve(t, &CaptureConfig{Sink: ring, Methods: []string{"internal.users.UserService/Other"}}, jsonRequest(`{}`))
+		serve(t, &CaptureConfig{Sink: ring, SampleRate: 0.0000001}, jsonRequest(`{}`))
+		serve(t, &CaptureConfig{Sink: ring, MaxBodySize: 4}, jsonRequest(`{"id":"1"}`))
+		records := ring.Records()
+		if len(records) != 1 || !records[0].Incomplete {
+			t.Errorf("Expected only the large request to be recorded without bodies, got %v", records)
+		}
+	})
+
+	t.Run("writes files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "capture.jsonl")
+		file, err := NewCaptureFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, &CaptureConfig{Sink: file}, jsonRequest(`{"id":"1"}`))
+		serve(t, &CaptureConfig{Sink: file}, jsonRequest(`{"id":"2"}`))
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path) //nolint:gosec // test file
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		records, err := ReadCaptureRecords(f)
+		if err != nil || len(records) != 2 || string(records[1].Body) != `{"id":"2"}` {
+			t.Errorf("Expected 2 records, got %v: %v", records, err)
+		}
+	})
+}
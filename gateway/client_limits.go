@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+)
+
+// ClientLimitEvent describes a stream or connection rejected by the
+// per-client limits.
+type ClientLimitEvent struct {
+	// Client is the client IP, see Peer, or the key returned by
+	// Options.ClientKey. Connections are counted by remote IP.
+	Client string
+	// Connection is true for rejected connections and false for streams
+	Connection bool
+	// Active is the number of streams or connections the client has open
+	Active int
+}
+
+// clientCounter counts the open streams or connections of each client.
+type clientCounter struct {
+	max     int
+	onLimit func(ClientLimitEvent)
+	conns   bool // Whether connections are counted
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// newClientCounter returns a counter admitting up to limit streams or
+// connections per client, or nil without a limit.
+func newClientCounter(limit int, conns bool, onLimit func(ClientLimitEvent)) *clientCounter {
+	if limit <= 0 {
+		return nil
+	}
+	return &clientCounter{max: limit, onLimit: onLimit, conns: conns, active: make(map[string]int)}
+}
+
+// acquire takes a slot of client and returns the function freeing it, or
+// reports the rejection and returns false if the client is at the limit.
+func (c *clientCounter) acquire(client string) (func(), bool) {
+	c.mu.Lock()
+	active := c.active[client]
+	if active >= c.max {
+		c.mu.Unlock()
+		if c.onLimit != nil {
+			c.onLimit(ClientLimitEvent{Client: client, Connection: c.conns, Active: active})
+		}
+		return nil, false
+	}
+	c.active[client] = active + 1
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.active[client]--; c.active[client] <= 0 {
+				delete(c.active, client)
+			}
+		})
+	}, true
+}
+
+// remoteIP returns the IP of a remote address such as "10.0.0.1:5000".
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// limitStreamsPerClient rejects requests of clients that already have
+// counter.max requests in flight, with RESOURCE_EXHAUSTED in the protocol of
+// the request.
+func limitStreamsPerClient(next http.Handler, counter *clientCounter, clientKey func(*http.Request) string) http.Handler {
+	if clientKey == nil {
+		clientKey = clientIP
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientKey(r)
+		if client == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := counter.acquire(client)
+		if !ok {
+			writeResourceExhausted(w, r, fmt.Sprintf("too many concurrent streams (limit %d per client)", counter.max))
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeResourceExhausted rejects a request with RESOURCE_EXHAUSTED, or HTTP
+// 429 for plain HTTP clients.
+func writeResourceExhausted(w http.ResponseWriter, r *http.Request, message string) {
+	contentType := r.Header.Get("Content-Type")
+	connectErr := map[string]string{"code": "resource_exhausted", "message": message}
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc"):
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("grpc-status", "8") // RESOURCE_EXHAUSTED
+		w.Header().Set("grpc-message", grpcutil.EncodeMessage(message))
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(contentType, "application/connect+"):
+		// Connect streams end with an end-stream message carrying the error
+		data, _ := json.Marshal(map[string]any{"error": connectErr})
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(connectEnvelope(0x02, data))
+	case strings.Contains(contentType, "connect") || r.Header.Get("Connect-Protocol-Version") == "1":
+		data, _ := json.Marshal(connectErr)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, message, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestMaxConcurrentStreamsPerClient(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	svc := &Service{
+		Name:    "EchoService",
+		Package: "test.v1",
+		Handlers: map[string]http.Handler{
+			"/test.v1.EchoService/Echo": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Block") != "" {
+					close(started)
+					<-unblock
+				}
+				_, _ = w.Write([]byte("{}"))
+			}),
+		},
+	}
+	var mu sync.Mutex
+	var events []ClientLimitEvent
+	gw, err := New([]*Service{svc}, Options{
+		MaxConcurrentStreamsPerClient: 1,
+		ClientKey:                     func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		OnClientLimit: func(e ClientLimitEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(tenant, contentType string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/test.v1.EchoService/Echo", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Tenant", tenant)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call("acme", "application/json", http.Header{"X-Block": {"1"}})
+	}()
+	<-started
+
+	if rec := call("acme", "application/grpc", nil); rec.Header().Get("grpc-status") != "8" ||
+		rec.Header().Get("grpc-message") != "too many concurrent streams (limit 1 per client)" {
+		t.Errorf("Expected RESOURCE_EXHAUSTED over gRPC, got %v", rec.Header())
+	}
+	if rec := call("acme", "application/json", http.Header{"Connect-Protocol-Version": {"1"}}); rec.Code != http.StatusTooManyRequests ||
+		!strings.Contains(rec.Body.String(), `"code":"resource_exhausted"`) {
+		t.Errorf("Expected a Connect resource_exhausted error, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call("acme", "application/connect+json", http.Header{"Connect-Protocol-Version": {"1"}}); rec.Code != http.StatusOK ||
+		rec.Body.Len() < 5 || rec.Body.Bytes()[0] != 0x02 || !strings.Contains(rec.Body.String(), `{"error":{"code":"resource_exhausted"`) {
+		t.Errorf("Expected a Connect end-stream message with resource_exhausted, got %d %q", rec.Code, rec.Body)
+	}
+	if rec := call("globex", "application/json", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected other clients to be served, got %d", rec.Code)
+	}
+	if rec := call("", "application/json", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected requests without a key to be served, got %d", rec.Code)
+	}
+
+	close(unblock)
+	<-done
+	if rec := call("acme", "application/json", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the client to be served once its stream ended, got %d", rec.Code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 3 || events[0].Client != "acme" || events[0].Connection || events[0].Active != 1 {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	rejected := make(chan ClientLimitEvent, 1)
+	addr := startHTTP2Server(t, Options{
+		MaxConnectionsPerIP: 1,
+		OnClientLimit:       func(e ClientLimitEvent) { rejected <- e },
+	})
+
+	// readSettings reads the SETTINGS frame of the server, which only
+	// admitted connections get
+	readSettings := func(framer *http2.Framer) bool {
+		frame, err := framer.ReadFrame()
+		_, ok := frame.(*http2.SettingsFrame)
+		return err == nil && ok
+	}
+
+	first, framer := dialH2C(t, addr)
+	if !readSettings(framer) {
+		t.Fatal("Expected the first connection to be served")
+	}
+
+	_, framer = dialH2C(t, addr)
+	expectClosed(t, framer)
+	select {
+	case e := <-rejected:
+		if e.Client != "127.0.0.1" || !e.Connection || e.Active != 1 {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the rejection to be reported")
+	}
+
+	// Closing the first connection frees its slot
+	_ = first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, framer = dialH2C(t, addr)
+		if readSettings(framer) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a new connection to be served after the first one closed")
+		}
+		select {
+		case <-rejected:
+		default:
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
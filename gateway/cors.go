@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig configures CORS settings.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the gateway, or "*"
+	AllowedOrigins []string
+	// AllowedMethods are allowed in preflight requests; "*" allows the
+	// requested method
+	AllowedMethods []string
+	// AllowedHeaders are allowed in preflight requests; "*" allows the
+	// requested headers, including Authorization and with credentials
+	AllowedHeaders []string
+	// ExposedHeaders are readable by browser scripts, in addition to the
+	// gRPC status headers and the headers and trailers of each response
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies and HTTP authentication
+	AllowCredentials bool
+	// MaxAge is the number of seconds browsers may cache preflight
+	// responses (0: not sent, browsers cache them for 5 seconds)
+	MaxAge int
+	// AllowPrivateNetwork answers the Private Network Access preflights of
+	// browsers, which allows public sites to call a gateway on a private
+	// network or on localhost
+	AllowPrivateNetwork bool
+	// Routes configure CORS differently for some paths. Keys are path
+	// prefixes such as "/uploads/", or service names such as
+	// "user.v1.UserService" for the paths of their methods. The config of
+	// the longest matching key replaces this one, and its own Routes are
+	// ignored; a nil config disables CORS on the route.
+	Routes map[string]*CORSConfig
+}
+
+// DefaultCORSConfig returns a permissive CORS configuration for development.
+func DefaultCORSConfig() *CORSConfig {
+	return &CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+		MaxAge:           corsMaxAgeHours * hoursToSeconds, // 24 hours in seconds
+	}
+}
+
+// corsStatusHeaders are exposed on every CORS response, so that browser
+// gRPC-Web clients can read the status of calls without trailers.
+var corsStatusHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+
+// corsSafelistedHeaders are response headers readable by browser scripts
+// without being exposed, or that are never readable.
+var corsSafelistedHeaders = map[string]bool{
+	"Cache-Control":    true,
+	"Content-Language": true,
+	"Content-Length":   true,
+	"Content-Type":     true,
+	"Expires":          true,
+	"Last-Modified":    true,
+	"Pragma":           true,
+	"Date":             true,
+	"Set-Cookie":       true,
+	"Trailer":          true,
+	"Vary":             true,
+}
+
+// corsRouter picks the CORS configuration of each request.
+type corsRouter struct {
+	base *CORSConfig
+	// routes are sorted by decreasing prefix length
+	routes []corsRoute
+}
+
+// corsRoute is the CORS configuration of a path prefix.
+type corsRoute struct {
+	prefix string
+	cfg    *CORSConfig
+}
+
+// newCORSRouter returns the router of cfg, or nil without a configuration.
+func newCORSRouter(cfg *CORSConfig) *corsRouter {
+	if cfg == nil {
+		return nil
+	}
+	router := &corsRouter{base: cfg}
+	for key, routeCfg := range cfg.Routes {
+		prefix := key
+		if !strings.HasPrefix(prefix, "/") {
+			// Service names match the paths of their methods
+			prefix = "/" + key + "/"
+		}
+		router.routes = append(router.routes, corsRoute{prefix: prefix, cfg: routeCfg})
+	}
+	sort.Slice(router.routes, func(i, j int) bool {
+		return len(router.routes[i].prefix) > len(router.routes[j].prefix)
+	})
+	return router
+}
+
+// configFor returns the CORS configuration of path, or nil if CORS is
+// disabled on its route.
+func (c *corsRouter) configFor(path string) *CORSConfig {
+	for _, route := range c.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.cfg
+		}
+	}
+	return c.base
+}
+
+// handle sets the CORS headers of a request, answering preflight requests.
+// It returns the writer to serve the request with, and whether the request
+// was a preflight request, which has then been answered.
+func (c *corsRouter) handle(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	cfg := c.configFor(r.URL.Path)
+	preflight := r.Method == http.MethodOptions
+
+	// Responses depend on these request headers, which shared caches must
+	// take into account
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if cfg != nil && cfg.AllowPrivateNetwork {
+			h.Add("Vary", "Access-Control-Request-Private-Network")
+		}
+	}
+
+	origin := r.Header.Get("Origin")
+	if cfg == nil || origin == "" || !cfg.allowsOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return w, preflight
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	if cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if preflight {
+		cfg.setPreflightHeaders(h, r)
+		w.WriteHeader(http.StatusNoContent)
+		return w, true
+	}
+
+	exposed := append(slices.Clone(corsStatusHeaders), cfg.ExposedHeaders...)
+	h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	return &ResponseRecorder{ResponseWriter: w, beforeHeader: func() { exposeHeaders(h) }}, false
+}
+
+// allowsOrigin reports whether origin may call the gateway.
+func (cfg *CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// setPreflightHeaders sets the headers of a preflight response from an
+// allowed origin.
+func (cfg *CORSConfig) setPreflightHeaders(h http.Header, r *http.Request) {
+	// "*" is taken literally by browsers for requests with credentials, and
+	// never covers Authorization, so the requested values are echoed
+	if slices.Contains(cfg.AllowedMethods, "*") {
+		if method := r.Header.Get("Access-Control-Request-Method"); method != "" {
+			h.Set("Access-Control-Allow-Methods", method)
+		}
+	} else if len(cfg.AllowedMethods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+	}
+	if slices.Contains(cfg.AllowedHeaders, "*") {
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+	} else if len(cfg.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+	}
+	if cfg.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+	}
+	if cfg.AllowPrivateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
+}
+
+// exposeHeaders adds the headers of a response that browser scripts can't
+// read by default to Access-Control-Expose-Headers, when the response is
+// written. These include the headers set by handlers and the Trailer- headers
+// of Connect unary responses.
+func exposeHeaders(h http.Header) {
+	exposed := h.Get("Access-Control-Expose-Headers")
+	listed := make(map[string]bool)
+	for _, name := range strings.Split(exposed, ",") {
+		listed[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+
+	var names []string
+	for name := range h {
+		if listed[name] || corsSafelistedHeaders[name] ||
+			strings.HasPrefix(name, "Access-Control-") || strings.HasPrefix(name, http.TrailerPrefix) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	h.Set("Access-Control-Expose-Headers", exposed+", "+strings.Join(names, ", "))
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.Header().Set("Trailer-Checksum", "123")
+		_, _ = io.WriteString(w, "ok")
+	})
+	users := &Service{
+		Name:     "UserService",
+		Package:  "user.v1",
+		Handlers: map[string]http.Handler{"/user.v1.UserService/GetUser": echo},
+	}
+	admin := &Service{
+		Name:     "AdminService",
+		Package:  "admin.v1",
+		Handlers: map[string]http.Handler{"/admin.v1.AdminService/Reset": echo},
+	}
+	gw, err := New([]*Service{users, admin}, Options{
+		CORSConfig: &CORSConfig{
+			AllowedOrigins:      []string{"https://app.example.com"},
+			AllowedMethods:      []string{"POST"},
+			AllowedHeaders:      []string{"*"},
+			ExposedHeaders:      []string{"X-Custom"},
+			AllowCredentials:    true,
+			MaxAge:              600,
+			AllowPrivateNetwork: true,
+			Routes: map[string]*CORSConfig{
+				"admin.v1.AdminService": nil,
+				"/user.v1.UserService/": {
+					AllowedOrigins: []string{"*"},
+					AllowedMethods: []string{"POST", "GET"},
+					AllowedHeaders: []string{"Content-Type"},
+					MaxAge:         60,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "authorization,x-grpc-web")
+		req.Header.Set("Access-Control-Request-Private-Network", "true")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		w := preflight("/other.v1.OtherService/Call", "https://app.example.com")
+		if w.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", w.Code)
+		}
+		want := map[string]string{
+			"Access-Control-Allow-Origin":          "https://app.example.com",
+			"Access-Control-Allow-Credentials":     "true",
+			"Access-Control-Allow-Methods":         "POST",
+			"Access-Control-Allow-Headers":         "authorization,x-grpc-web",
+			"Access-Control-Max-Age":               "600",
+			"Access-Control-Allow-Private-Network": "true",
+		}
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s: expected %q, got %q", name, value, got)
+			}
+		}
+		vary := strings.Join(w.Header().Values("Vary"), ", ")
+		for _, name := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers", "Access-Control-Request-Private-Network"} {
+			if !strings.Contains(vary, name) {
+				t.Errorf("Expected Vary to list %s, got %q", name, vary)
+			}
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		w := preflight("/other.v1.OtherService/Call", "https://evil.example.com")
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected a preflight without CORS headers, got %d %v", w.Code, w.Header())
+		}
+	})
+
+	t.Run("route override", func(t *testing.T) {
+		w := preflight("/user.v1.UserService/GetUser", "https://other.example.com")
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://other.example.com" {
+			t.Errorf("Expected the route to allow any origin, got %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type" {
+			t.Errorf("Expected the route's headers, got %q", got)
+		}
+		if w.Header().Get("Access-Control-Allow-Credentials") != "" || w.Header().Get("Access-Control-Allow-Private-Network") != "" {
+			t.Errorf("Expected the route config to replace the base config, got %v", w.Header())
+		}
+		if got := w.Header().Get("Access-Control-Max-Age"); got != "60" {
+			t.Errorf("Expected the route's max age, got %q", got)
+		}
+	})
+
+	t.Run("route disabled", func(t *testing.T) {
+		w := preflight("/admin.v1.AdminService/Reset", "https://app.example.com")
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected no CORS headers, got %v", w.Header())
+		}
+	})
+
+	t.Run("exposed headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user.v1.UserService/GetUser", strings.NewReader("{}"))
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+		if values := w.Header().Values("Access-Control-Allow-Origin"); len(values) != 1 {
+			t.Errorf("Expected a single allowed origin, got %v", values)
+		}
+		exposed := w.Header().Get("Access-Control-Expose-Headers")
+		if exposed != "Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin, Trailer-Checksum, X-Request-Id" {
+			t.Errorf("Unexpected exposed headers: %q", exposed)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/codec"
+)
+
+// DefaultDebugPath is the default prefix of the debug endpoints.
+const DefaultDebugPath = "/debug/hyperway"
+
+// Debug endpoint paths, relative to Options.DebugPath
+const (
+	debugServicesPath    = "/services"
+	debugDescriptorsPath = "/descriptors"
+	debugCodecsPath      = "/codecs"
+	debugPGOPath         = "/pgo"
+	debugStreamsPath     = "/streams"
+)
+
+// errDebugForbidden rejects debug requests of remote clients when no
+// authorizer is configured.
+var errDebugForbidden = errors.New("debug endpoints are only served to loopback clients")
+
+// ServiceDebugInfo is the runtime state of a service shown on the debug endpoints.
+type ServiceDebugInfo struct {
+	// Methods are the registered methods, sorted by name
+	Methods []DebugMethod `json:"methods"`
+	// Codecs are the codecs of the messages of the service
+	Codecs []codec.Stats `json:"codecs,omitempty"`
+}
+
+// DebugMethod describes a registered method.
+type DebugMethod struct {
+	// Name is the method name
+	Name string `json:"name"`
+	// Path is the HTTP path of the method
+	Path string `json:"path"`
+	// StreamType is "unary", "server_stream", "client_stream", or "bidi_stream"
+	StreamType string `json:"stream_type"`
+	// InputType is the full name of the request message
+	InputType string `json:"input_type"`
+	// OutputType is the full name of the response message
+	OutputType string `json:"output_type"`
+	// Interceptors are the types of the interceptors, outermost first
+	Interceptors []string `json:"interceptors,omitempty"`
+	// InterceptorChain describes the interceptors, outermost first
+	InterceptorChain []DebugInterceptor `json:"interceptor_chain,omitempty"`
+	// ActiveStreams is the number of streams of the method in progress
+	ActiveStreams int64 `json:"active_streams"`
+	// Concurrency reports the saturation of the method's concurrency limit,
+	// if it has one
+	Concurrency *DebugConcurrency `json:"concurrency,omitempty"`
+}
+
+// DebugInterceptor describes an interceptor of a method.
+type DebugInterceptor struct {
+	// Name is the name the interceptor is registered under, if any
+	Name string `json:"name,omitempty"`
+	// Phase is the phase ordering the interceptor, e.g. "auth"
+	Phase string `json:"phase"`
+	// Type is the Go type of the interceptor
+	Type string `json:"type"`
+}
+
+// DebugConcurrency describes the saturation of a method's concurrency limit.
+type DebugConcurrency struct {
+	// Limit is the maximum number of concurrent calls
+	Limit int `json:"limit"`
+	// InFlight is the number of calls being handled
+	InFlight int64 `json:"in_flight"`
+	// Queued is the number of calls waiting for a slot
+	Queued int64 `json:"queued"`
+	// Admitted is the number of calls admitted so far
+	Admitted int64 `json:"admitted"`
+	// Rejected is the number of calls rejected so far
+	Rejected int64 `json:"rejected"`
+}
+
+// debugService is a service as listed by the services endpoint.
+type debugService struct {
+	Name       string        `json:"name"`
+	Package    string        `json:"package"`
+	SchemaHash string        `json:"schema_hash,omitempty"`
+	Methods    []DebugMethod `json:"methods"`
+}
+
+// debugPath returns the path of a debug endpoint.
+func (g *Gateway) debugPath(path string) string {
+	return strings.TrimSuffix(g.options.DebugPath, "/") + path
+}
+
+// serveDebug serves the debug endpoints and reports whether path is one.
+func (g *Gateway) serveDebug(w http.ResponseWriter, r *http.Request) bool {
+	base := g.debugPath("")
+	if r.URL.Path != base && r.URL.Path != base+"/" && !strings.HasPrefix(r.URL.Path, base+"/") {
+		return false
+	}
+
+	if err := g.authorizeDebug(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch strings.TrimPrefix(r.URL.Path, base) {
+	case "", "/":
+		g.serveDebugIndex(w)
+	case debugServicesPath:
+		g.serveDebugServices(w)
+	case debugDescriptorsPath:
+		g.serveDebugDescriptors(w, r)
+	case debugCodecsPath:
+		g.serveDebugCodecs(w)
+	case debugPGOPath:
+		writeDebugJSON(w, codec.CurrentPGOStatus())
+	case debugStreamsPath:
+		g.serveDebugStreams(w)
+	default:
+		http.NotFound(w, r)
+	}
+	return true
+}
+
+// authorizeDebug runs Options.DebugAuthorizer, or only admits loopback
+// clients without one. Requests forwarded by trusted proxies are admitted
+// by the address of their client, not of the proxy.
+func (g *Gateway) authorizeDebug(r *http.Request) error {
+	if g.options.DebugAuthorizer != nil {
+		return g.options.DebugAuthorizer(r)
+	}
+	if ip := PeerFromRequest(r).IP; !ip.IsValid() || !ip.IsLoopback() {
+		return errDebugForbidden
+	}
+	return nil
+}
+
+// serveDebugIndex lists the debug endpoints.
+func (g *Gateway) serveDebugIndex(w http.ResponseWriter) {
+	paths := []string{debugServicesPath, debugDescriptorsPath, debugCodecsPath, debugPGOPath, debugStreamsPath}
+	endpoints := make([]string, 0, len(paths))
+	for _, path := range paths {
+		endpoints = append(endpoints, g.debugPath(path))
+	}
+	writeDebugJSON(w, map[string]any{"endpoints": endpoints})
+}
+
+// serveDebugServices lists the services with their methods and interceptors.
+func (g *Gateway) serveDebugServices(w http.ResponseWriter) {
+	services := make([]debugService, 0, len(g.services))
+	for _, svc := range g.services {
+		entry := debugService{Name: svc.Name, Package: svc.Package, SchemaHash: svc.SchemaHash}
+		if svc.Debug != nil {
+			entry.Methods = svc.Debug().Methods
+		}
+		services = append(services, entry)
+	}
+	writeDebugJSON(w, map[string]any{"services": services})
+}
+
+// serveDebugDescriptors dumps the descriptors of all services, or of the
+// service named by the "service" query parameter (e.g. "user.v1.UserService").
+func (g *Gateway) serveDebugDescriptors(w http.ResponseWriter, r *http.Request) {
+	fdset := g.descriptor
+	if name := r.URL.Query().Get("service"); name != "" {
+		fdset = nil
+		for _, svc := range g.services {
+			if qualifiedName(svc.Package, svc.Name) == name {
+				fdset = svc.Descriptors
+				break
+			}
+		}
+		if fdset == nil {
+			http.Error(w, "unknown service "+name, http.StatusNotFound)
+			return
+		}
+	}
+	if fdset == nil {
+		fdset = &descriptorpb.FileDescriptorSet{}
+	}
+
+	data, err := protojson.MarshalOptions{Multiline: true}.Marshal(fdset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serveDebugCodecs reports the codec statistics of each service.
+func (g *Gateway) serveDebugCodecs(w http.ResponseWriter) {
+	codecs := make(map[string][]codec.Stats, len(g.services))
+	for _, svc := range g.services {
+		if svc.Debug != nil {
+			codecs[qualifiedName(svc.Package, svc.Name)] = svc.Debug().Codecs
+		}
+	}
+	writeDebugJSON(w, map[string]any{"codecs": codecs})
+}
+
+// serveDebugStreams reports the streams in progress per method.
+func (g *Gateway) serveDebugStreams(w http.ResponseWriter) {
+	var total int64
+	methods := make(map[string]int64)
+	for _, svc := range g.services {
+		if svc.Debug == nil {
+			continue
+		}
+		for _, method := range svc.Debug().Methods {
+			if method.StreamType != "unary" {
+				methods[method.Path] = method.ActiveStreams
+				total += method.ActiveStreams
+			}
+		}
+	}
+	writeDebugJSON(w, map[string]any{"total": total, "methods": methods})
+}
+
+// writeDebugJSON writes v as indented JSON.
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"fmt"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MergeDescriptors combines the descriptors of services into one set, as
+// served by reflection and described by OpenAPI documents.
+//
+// Services of the same package each describe themselves in a file of the
+// same name, so files with the same name are merged: messages and enums
+// defined by several services must be identical and are kept once, and the
+// services are appended. Any other type, service, or file defined twice
+// differently is an error naming the services involved, since it would
+// break reflection and generated clients.
+func MergeDescriptors(services []*Service) (*descriptorpb.FileDescriptorSet, error) {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	owners := make(map[string]string) // file and type names to the service defining them
+
+	for _, svc := range services {
+		if svc.Descriptors == nil {
+			continue
+		}
+		owner := qualifiedName(svc.Package, svc.Name)
+		for _, file := range svc.Descriptors.File {
+			existing, ok := files[file.GetName()]
+			switch {
+			case !ok:
+				if err := declareTypes(owners, file, owner); err != nil {
+					return nil, err
+				}
+				merged := proto.Clone(file).(*descriptorpb.FileDescriptorProto)
+				files[file.GetName()] = merged
+				owners[file.GetName()] = owner
+				fdset.File = append(fdset.File, merged)
+			case proto.Equal(existing, file):
+				// Shared dependency, e.g. a well-known type
+			default:
+				if err := mergeFile(existing, file, owners, owner); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return fdset, nil
+}
+
+// declareTypes records the top-level types and services of file as defined
+// by owner, failing if another file defines any of them.
+func declareTypes(owners map[string]string, file *descriptorpb.FileDescriptorProto, owner string) error {
+	for _, name := range topLevelNames(file) {
+		if other, ok := owners[name]; ok {
+			return fmt.Errorf("%s is defined by both %s and %s in different files", name, other, owner)
+		}
+	}
+	for _, name := range topLevelNames(file) {
+		owners[name] = owner
+	}
+	return nil
+}
+
+// topLevelNames returns the full names of the top-level messages, enums, and
+// services of file.
+func topLevelNames(file *descriptorpb.FileDescriptorProto) []string {
+	var names []string
+	for _, msg := range file.GetMessageType() {
+		names = append(names, qualifiedName(file.GetPackage(), msg.GetName()))
+	}
+	for _, enum := range file.GetEnumType() {
+		names = append(names, qualifiedName(file.GetPackage(), enum.GetName()))
+	}
+	for _, svc := range file.GetService() {
+		names = append(names, qualifiedName(file.GetPackage(), svc.GetName()))
+	}
+	return names
+}
+
+// mergeFile merges src, a file of owner, into dst, a file of the same name
+// defined by other services.
+func mergeFile(dst, src *descriptorpb.FileDescriptorProto, owners map[string]string, owner string) error {
+	other := owners[dst.GetName()]
+	if dst.GetPackage() != src.GetPackage() {
+		return fmt.Errorf("file %s declares package %s for %s and %s for %s",
+			dst.GetName(), dst.GetPackage(), other, src.GetPackage(), owner)
+	}
+	if dst.GetSyntax() != src.GetSyntax() || dst.GetEdition() != src.GetEdition() {
+		return fmt.Errorf("file %s uses different syntax for %s and %s", dst.GetName(), other, owner)
+	}
+
+	// Indexes of the elements of src in dst, -1 for ones already in dst
+	messages, err := mergeElements(&dst.MessageType, src.GetMessageType(), dst.GetPackage(), owners, owner)
+	if err != nil {
+		return err
+	}
+	enums, err := mergeElements(&dst.EnumType, src.GetEnumType(), dst.GetPackage(), owners, owner)
+	if err != nil {
+		return err
+	}
+	services := make([]int, len(src.GetService()))
+	for i, svc := range src.GetService() {
+		name := qualifiedName(src.GetPackage(), svc.GetName())
+		if defined, ok := owners[name]; ok {
+			return fmt.Errorf("service %s is defined by both %s and %s", name, defined, owner)
+		}
+		owners[name] = owner
+		services[i] = len(dst.Service)
+		dst.Service = append(dst.Service, proto.Clone(svc).(*descriptorpb.ServiceDescriptorProto))
+	}
+
+	for _, dep := range src.GetDependency() {
+		if !slices.Contains(dst.Dependency, dep) {
+			dst.Dependency = append(dst.Dependency, dep)
+		}
+	}
+	mergeSourceCodeInfo(dst, src, map[int32][]int{
+		pathFileMessageType: messages,
+		pathFileEnumType:    enums,
+		pathFileService:     services,
+	})
+	return nil
+}
+
+// namedDescriptor is a message or enum descriptor.
+type namedDescriptor interface {
+	proto.Message
+	GetName() string
+}
+
+// mergeElements appends the elements of src missing from dst and returns
+// their indexes in dst, or -1 for elements dst already has. Elements of the
+// same name must be identical.
+func mergeElements[T namedDescriptor](dst *[]T, src []T, pkg string, owners map[string]string, owner string) ([]int, error) {
+	indexes := make([]int, len(src))
+	for i, element := range src {
+		j := slices.IndexFunc(*dst, func(e T) bool { return e.GetName() == element.GetName() })
+		if j < 0 {
+			indexes[i] = len(*dst)
+			*dst = append(*dst, proto.Clone(element).(T))
+			owners[qualifiedName(pkg, element.GetName())] = owner
+			continue
+		}
+		if !proto.Equal((*dst)[j], element) {
+			name := qualifiedName(pkg, element.GetName())
+			return nil, fmt.Errorf("%s is defined differently by %s and %s", name, owners[name], owner)
+		}
+		indexes[i] = -1
+	}
+	return indexes, nil
+}
+
+// mergeSourceCodeInfo appends the comments of the elements of src that were
+// added to dst, renumbering their paths with indexes.
+func mergeSourceCodeInfo(dst, src *descriptorpb.FileDescriptorProto, indexes map[int32][]int) {
+	for _, location := range src.GetSourceCodeInfo().GetLocation() {
+		path := location.GetPath()
+		if len(path) < 2 {
+			continue
+		}
+		elements, ok := indexes[path[0]]
+		if !ok || int(path[1]) >= len(elements) || elements[path[1]] < 0 {
+			continue
+		}
+
+		location = proto.Clone(location).(*descriptorpb.SourceCodeInfo_Location)
+		location.Path[1] = pathIndex(elements[path[1]])
+		if dst.SourceCodeInfo == nil {
+			dst.SourceCodeInfo = &descriptorpb.SourceCodeInfo{}
+		}
+		dst.SourceCodeInfo.Location = append(dst.SourceCodeInfo.Location, location)
+	}
+}
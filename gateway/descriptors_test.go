@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// newDescriptorService returns a service of the user fixture renamed to name
+// in pkg, with its file named after the package like rpc services.
+func newDescriptorService(pkg, name string) *Service {
+	fdset := newUserServiceDescriptors()
+	file := fdset.File[0]
+	replacer := strings.NewReplacer(".internal.users.", "."+pkg+".")
+	file.Name = proto.String(pkg + ".proto")
+	file.Package = proto.String(pkg)
+	for _, msg := range file.MessageType {
+		for _, field := range msg.Field {
+			if field.TypeName != nil {
+				field.TypeName = proto.String(replacer.Replace(field.GetTypeName()))
+			}
+		}
+	}
+	file.Service[0].Name = proto.String(name)
+	for _, method := range file.Service[0].Method {
+		method.InputType = proto.String(replacer.Replace(method.GetInputType()))
+		method.OutputType = proto.String(replacer.Replace(method.GetOutputType()))
+	}
+	return &Service{
+		Name:        name,
+		Package:     pkg,
+		Handlers:    map[string]http.Handler{"/" + pkg + "." + name + "/GetUser": http.NotFoundHandler()},
+		Descriptors: fdset,
+	}
+}
+
+func TestMergeFileDescriptors(t *testing.T) {
+	t.Run("merges services of a package", func(t *testing.T) {
+		users := newDescriptorService("acme.v1", "UserService")
+		admins := newDescriptorService("acme.v1", "AdminService")
+		admins.Descriptors.File[0].SourceCodeInfo = &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:            []int32{pathFileService, 0},
+				Span:            []int32{0, 0, 0},
+				LeadingComments: proto.String(" Manages users on behalf of admins.\n"),
+			}},
+		}
+
+		gw, err := New([]*Service{users, admins}, Options{EnableOpenAPI: true, EnableReflection: true})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		if len(gw.descriptor.File) != 1 {
+			t.Fatalf("Expected one merged file, got %d", len(gw.descriptor.File))
+		}
+		file := gw.descriptor.File[0]
+		if len(file.MessageType) != 2 || len(file.Service) != 2 {
+			t.Fatalf("Expected 2 messages and 2 services, got %d and %d", len(file.MessageType), len(file.Service))
+		}
+		if path := file.SourceCodeInfo.Location[0].Path; path[1] != 1 {
+			t.Errorf("Expected the comment of AdminService at service index 1, got %v", path)
+		}
+
+		resolver, err := newDescriptorResolver(gw.descriptor)
+		if err != nil {
+			t.Fatalf("Failed to resolve descriptors: %v", err)
+		}
+		for _, name := range []protoreflect.FullName{"acme.v1.UserService", "acme.v1.AdminService", "acme.v1.GetUserRequest"} {
+			if _, err := resolver.FindDescriptorByName(name); err != nil {
+				t.Errorf("Failed to resolve %s: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("rejects conflicting messages", func(t *testing.T) {
+		users := newDescriptorService("acme.v1", "UserService")
+		admins := newDescriptorService("acme.v1", "AdminService")
+		admins.Descriptors.File[0].MessageType[0].Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+
+		_, err := New([]*Service{users, admins}, Options{})
+		if err == nil || !strings.Contains(err.Error(), "acme.v1.GetUserRequest is defined differently by acme.v1.UserService and acme.v1.AdminService") {
+			t.Errorf("Expected a conflict diagnostic, got %v", err)
+		}
+	})
+
+	t.Run("rejects duplicate services", func(t *testing.T) {
+		users := newDescriptorService("acme.v1", "UserService")
+		again := newDescriptorService("acme.v1", "UserService")
+		again.Descriptors.File[0].Service[0].Method[0].Name = proto.String("FindUser")
+
+		_, err := New([]*Service{users, again}, Options{})
+		if err == nil || !strings.Contains(err.Error(), "service acme.v1.UserService is defined by both") {
+			t.Errorf("Expected a duplicate service diagnostic, got %v", err)
+		}
+	})
+
+	t.Run("qualifies colliding operation IDs", func(t *testing.T) {
+		v1 := newDescriptorService("acme.v1", "UserService")
+		v2 := newDescriptorService("acme.v2", "UserService")
+
+		gw, err := New([]*Service{v1, v2}, Options{EnableOpenAPI: true})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		var spec OpenAPISpec
+		if err := json.Unmarshal(gw.openAPI, &spec); err != nil {
+			t.Fatalf("Failed to parse OpenAPI: %v", err)
+		}
+		for path, want := range map[string]string{
+			"/acme.v1.UserService/GetUser": "acme_v1_UserService_GetUser",
+			"/acme.v2.UserService/GetUser": "acme_v2_UserService_GetUser",
+		} {
+			operation := spec.Paths[path].(map[string]any)["post"].(map[string]any)
+			if operation["operationId"] != want {
+				t.Errorf("operationId of %s = %v, want %s", path, operation["operationId"], want)
+			}
+		}
+	})
+}
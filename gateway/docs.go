@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// docsHTML is the API explorer page. It is self-contained so that it works
+// without access to a CDN.
+//
+//go:embed docs.html
+var docsHTML string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsHTML))
+
+// docsPage holds the values rendered into the API explorer page.
+type docsPage struct {
+	Title   string
+	SpecURL string
+}
+
+// docsSpecPath returns the path of the OpenAPI spec used by the docs page.
+// The spec is served next to the page so that it is available even when the
+// OpenAPI endpoint itself is disabled.
+func (g *Gateway) docsSpecPath() string {
+	return strings.TrimSuffix(g.options.DocsPath, "/") + "/openapi.json"
+}
+
+// isDocsPath reports whether path is served by the docs endpoint.
+func (g *Gateway) isDocsPath(path string) bool {
+	docsPath := strings.TrimSuffix(g.options.DocsPath, "/")
+	return path == docsPath || path == docsPath+"/" || path == g.docsSpecPath()
+}
+
+// serveDocs serves the API explorer page and its OpenAPI spec.
+func (g *Gateway) serveDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == g.docsSpecPath() {
+		g.serveOpenAPI(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = docsTemplate.Execute(w, docsPage{
+		Title:   defaultAPITitle,
+		SpecURL: g.docsSpecPath(),
+	})
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocsEndpoint(t *testing.T) {
+	svc := &Service{
+		Name:        "UserService",
+		Package:     "internal.users",
+		Handlers:    map[string]http.Handler{},
+		Descriptors: newUserServiceDescriptors(),
+	}
+
+	gw, err := New([]*Service{svc}, Options{EnableDocs: true})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	t.Run("serves the explorer page", func(t *testing.T) {
+		for _, path := range []string{"/docs", "/docs/"} {
+			rec := serve(http.MethodGet, path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: expected 200, got %d", path, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("%s: expected HTML, got %q", path, ct)
+			}
+			if !strings.Contains(rec.Body.String(), `var specURL = "/docs/openapi.json";`) {
+				t.Errorf("%s: expected the spec URL in the page", path)
+			}
+		}
+	})
+
+	t.Run("serves the spec without the OpenAPI endpoint", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/docs/openapi.json")
+		if !strings.Contains(rec.Body.String(), "/internal.users.UserService/GetUser") {
+			t.Errorf("Expected generated spec, got %s", rec.Body.String())
+		}
+		if rec := serve(http.MethodGet, "/openapi.json"); strings.Contains(rec.Body.String(), `"openapi"`) {
+			t.Error("Expected the OpenAPI endpoint to stay disabled")
+		}
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		if rec := serve(http.MethodPost, "/docs"); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405, got %d", rec.Code)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		gw, err := New([]*Service{svc}, Options{})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		if strings.Contains(rec.Body.String(), "<html") {
+			t.Error("Expected no explorer page when docs are disabled")
+		}
+	})
+}
@@ -2,8 +2,11 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -17,6 +20,7 @@ const (
 	defaultTimeout  = 30 * time.Second
 	corsMaxAgeHours = 24
 	hoursToSeconds  = 60 * 60
+	defaultAPITitle = "Hyperway API"
 )
 
 // Gateway wraps HTTP handlers for multi-protocol support.
@@ -26,6 +30,13 @@ type Gateway struct {
 	options    Options
 	descriptor *descriptorpb.FileDescriptorSet
 	openAPI    []byte // Cached OpenAPI JSON
+	// openAPIByPackage caches the OpenAPI JSON of each package
+	openAPIByPackage map[string][]byte
+	graphql          *gqlSchema     // GraphQL schema, when enabled
+	types            *TypeRegistry  // Message types of the services
+	entry            http.Handler   // Top-level handler including access logging
+	trustedProxies   []netip.Prefix // Parsed Options.TrustedProxies
+	cors             *corsRouter    // CORS configuration of each route, when enabled
 }
 
 // Options configures the gateway.
@@ -34,23 +45,73 @@ type Options struct {
 	EnableReflection bool
 	// EnableOpenAPI enables OpenAPI endpoint
 	EnableOpenAPI bool
-	// OpenAPIPath is the path to serve OpenAPI spec
+	// OpenAPIPath is the path to serve OpenAPI spec. The spec of each package
+	// is served next to it, e.g. "/openapi/user.v1.json" for "/openapi.json".
 	OpenAPIPath string
+	// OpenAPIServers are listed as the servers of OpenAPI specs
+	OpenAPIServers []OpenAPIServer
+	// EnableDocs enables the interactive API explorer, which renders the
+	// OpenAPI spec and can issue Connect JSON calls
+	EnableDocs bool
+	// DocsPath is the path to serve the API explorer (default "/docs")
+	DocsPath string
+	// EnableGraphQL serves unary methods as queries and mutations and
+	// server-streaming methods as subscriptions over GraphQL, with the SDL
+	// at GraphQLPath + "/schema.graphql"
+	EnableGraphQL bool
+	// GraphQLPath is the path of the GraphQL endpoint (default "/graphql")
+	GraphQLPath string
 	// CORSConfig configures CORS
 	CORSConfig *CORSConfig
 	// KeepaliveParams configures client-side keepalive
 	KeepaliveParams *KeepaliveParameters
 	// KeepaliveEnforcementPolicy configures server-side keepalive enforcement
 	KeepaliveEnforcementPolicy *KeepaliveEnforcementPolicy
-}
-
-// CORSConfig configures CORS settings.
-type CORSConfig struct {
-	AllowedOrigins   []string
-	AllowedMethods   []string
-	AllowedHeaders   []string
-	AllowCredentials bool
-	MaxAge           int
+	// Logger enables structured per-request access logs when set
+	Logger *slog.Logger
+	// AccessLog configures access log sampling and request IDs
+	AccessLog *AccessLogConfig
+	// Capture records sampled, redacted requests and responses for replay
+	Capture *CaptureConfig
+	// ServiceNameOverrides maps routed service names (e.g. "internal.users.UserService")
+	// to the names exported in protos, reflection, and OpenAPI (e.g. "acme.user.v1.UserService").
+	// Handlers are served under both names.
+	ServiceNameOverrides map[string]string
+	// EnableProbes serves /livez, /readyz, and /version for platform health
+	// probes and dashboards, see SetBuildInfo. Probes are not access logged.
+	EnableProbes bool
+	// ProbesBasePath prefixes the probe endpoints (e.g. "/-" serves "/-/livez")
+	ProbesBasePath string
+	// ReadinessCheck decides whether /readyz reports ready; nil always does
+	ReadinessCheck func(context.Context) error
+	// EnableDebug serves admin endpoints describing services, descriptors,
+	// codecs, PGO, and active streams under DebugPath
+	EnableDebug bool
+	// DebugPath prefixes the debug endpoints (default "/debug/hyperway")
+	DebugPath string
+	// DebugAuthorizer admits debug requests by returning nil. Without one,
+	// only loopback clients are admitted.
+	DebugAuthorizer func(*http.Request) error
+	// MaxConcurrentStreamsPerClient bounds the requests a client may have in
+	// flight across all its connections; more are rejected with
+	// RESOURCE_EXHAUSTED (0: unlimited)
+	MaxConcurrentStreamsPerClient int
+	// ClientKey identifies the client of a request for
+	// MaxConcurrentStreamsPerClient, e.g. by API key or tenant. Requests with
+	// an empty key are not limited. (default: remote IP)
+	ClientKey func(*http.Request) string
+	// MaxConnectionsPerIP bounds the open connections of a remote IP; more
+	// are closed when accepted. It is enforced by servers configured with
+	// NewHTTP2Transport. (0: unlimited)
+	MaxConnectionsPerIP int
+	// OnClientLimit is called when a stream or connection is rejected by the
+	// per-client limits, e.g. to emit metrics
+	OnClientLimit func(ClientLimitEvent)
+	// TrustedProxies are the IP addresses or CIDR prefixes (e.g.
+	// "10.0.0.0/8") of reverse proxies whose Forwarded and X-Forwarded-For
+	// headers are trusted to identify clients, see Peer. Without them, the
+	// client is the remote address of the connection.
+	TrustedProxies []string
 }
 
 // Service represents a service with its handlers.
@@ -59,6 +120,16 @@ type Service struct {
 	Package     string
 	Handlers    map[string]http.Handler
 	Descriptors *descriptorpb.FileDescriptorSet
+	// SchemaHash identifies the descriptors of the service and versions its
+	// OpenAPI spec; "1.0.0" is used without one
+	SchemaHash string
+	// Security describes the authentication of the service in OpenAPI specs
+	Security *ServiceSecurity
+	// Debug reports the runtime state of the service on the debug endpoints
+	Debug func() *ServiceDebugInfo
+	// Routes serve methods under path templates as well, and are documented
+	// in OpenAPI specs
+	Routes []Route
 }
 
 // New creates a new gateway.
@@ -66,18 +137,43 @@ func New(services []*Service, opts Options) (*Gateway, error) {
 	// Set defaults
 	opts = setDefaultOptions(opts)
 
+	// Apply exported service name overrides
+	services, err := applyServiceNameOverrides(services, opts.ServiceNameOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply service name overrides: %w", err)
+	}
+
 	// Build FileDescriptorSet from all services
-	fdset := buildFileDescriptorSet(services)
+	fdset, err := MergeDescriptors(services)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge service descriptors: %w", err)
+	}
 
 	// Create handlers map
 	handlers := buildHandlersMap(services)
+	routes, err := buildRoutes(services)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := NewTypeRegistry(fdset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register service message types: %w", err)
+	}
 
 	// Create gateway instance
 	gw := &Gateway{
-		handler:    nil, // Will be set later
-		services:   services,
-		options:    opts,
-		descriptor: fdset,
+		handler:        nil, // Will be set later
+		services:       services,
+		options:        opts,
+		descriptor:     fdset,
+		types:          types,
+		trustedProxies: trustedProxies,
 	}
 
 	// Add reflection handlers if enabled
@@ -88,11 +184,39 @@ func New(services []*Service, opts Options) (*Gateway, error) {
 	}
 
 	// Create multi-protocol handler
-	gw.handler = createMultiProtocolHandler(handlers)
+	gw.cors = newCORSRouter(opts.CORSConfig)
+	gw.handler = createMultiProtocolHandler(handlers, routes, gw.cors == nil)
+
+	// Wrap the entry point with capture and access logging if enabled
+	gw.entry = http.HandlerFunc(gw.serve)
+	if counter := newClientCounter(opts.MaxConcurrentStreamsPerClient, false, opts.OnClientLimit); counter != nil {
+		gw.entry = limitStreamsPerClient(gw.entry, counter, opts.ClientKey)
+	}
+	if c := newCapturer(opts.Capture); c != nil {
+		// Bodies are redacted by the descriptors of their methods
+		resolver, err := newDescriptorResolver(fdset)
+		if err != nil {
+			return nil, err
+		}
+		c.methods = methodsOf(resolver)
+		gw.entry = c.wrap(gw.entry)
+	}
+	if al := newAccessLogger(opts.Logger, opts.AccessLog); al != nil {
+		al.path = redactedPathFunc(routes)
+		gw.entry = al.wrap(gw.entry)
+	}
+
+	if opts.EnableGraphQL {
+		schema, err := newGraphQLSchema(gw.descriptor)
+		if err != nil {
+			return nil, err
+		}
+		gw.graphql = schema
+	}
 
-	// Generate OpenAPI if enabled
-	if opts.EnableOpenAPI {
-		if err := gw.generateOpenAPI(fdset); err != nil {
+	// Generate OpenAPI if enabled, also used by the docs page
+	if opts.EnableOpenAPI || opts.EnableDocs {
+		if err := gw.openAPIDocuments(); err != nil {
 			return nil, err
 		}
 	}
@@ -105,18 +229,16 @@ func setDefaultOptions(opts Options) Options {
 	if opts.OpenAPIPath == "" {
 		opts.OpenAPIPath = "/openapi.json"
 	}
-	return opts
-}
-
-// buildFileDescriptorSet builds a FileDescriptorSet from all services
-func buildFileDescriptorSet(services []*Service) *descriptorpb.FileDescriptorSet {
-	fdset := &descriptorpb.FileDescriptorSet{}
-	for _, svc := range services {
-		if svc.Descriptors != nil {
-			fdset.File = append(fdset.File, svc.Descriptors.File...)
-		}
+	if opts.DocsPath == "" {
+		opts.DocsPath = "/docs"
+	}
+	if opts.GraphQLPath == "" {
+		opts.GraphQLPath = DefaultGraphQLPath
+	}
+	if opts.DebugPath == "" {
+		opts.DebugPath = DefaultDebugPath
 	}
-	return fdset
+	return opts
 }
 
 // buildHandlersMap creates a map of handlers from all services
@@ -144,35 +266,21 @@ func (g *Gateway) addReflectionHandlers(handlers map[string]http.Handler) error
 	return nil
 }
 
-// generateOpenAPI generates OpenAPI specification
-func (g *Gateway) generateOpenAPI(fdset *descriptorpb.FileDescriptorSet) error {
-	info := OpenAPIInfo{
-		Title:   "Hyperway API",
-		Version: "1.0.0",
-	}
-
-	spec, err := GenerateOpenAPI(fdset, info)
-	if err != nil {
-		return fmt.Errorf("failed to generate OpenAPI: %w", err)
-	}
-
-	g.openAPI, err = MarshalOpenAPI(spec)
-	if err != nil {
-		return fmt.Errorf("failed to marshal OpenAPI: %w", err)
-	}
-	return nil
-}
-
-// createMultiProtocolHandler creates the main HTTP handler
-func createMultiProtocolHandler(handlers map[string]http.Handler) http.Handler {
+// createMultiProtocolHandler creates the main HTTP handler. Paths without a
+// handler are matched against the path templates of routes. Without a CORS
+// configuration, allowCORS answers requests of any origin.
+func createMultiProtocolHandler(handlers map[string]http.Handler, routes []compiledRoute, allowCORS bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Handle CORS headers
-		if handleCORSHeaders(w, r) {
+		if allowCORS && handleCORSHeaders(w, r) {
 			return
 		}
 
 		// Find the appropriate handler
 		handler := findHandler(handlers, r.URL.Path)
+		if handler == nil {
+			handler = matchRoute(routes, r)
+		}
 		if handler == nil {
 			handleUnimplemented(w, r)
 			return
@@ -236,19 +344,49 @@ func handleGRPCWebRequest(w http.ResponseWriter, r *http.Request, handler http.H
 
 // ServeHTTP implements http.Handler.
 func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withPeer(r, g.trustedProxies)
+
+	// Probes bypass access logging to keep logs free of polling noise
+	if g.options.EnableProbes && g.serveProbe(w, r) {
+		return
+	}
+	g.entry.ServeHTTP(w, r)
+}
+
+// serve dispatches a request to the gateway endpoints.
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) {
 	// Handle CORS if configured
-	if g.options.CORSConfig != nil {
-		g.handleCORS(w, r)
-		if r.Method == http.MethodOptions {
+	if g.cors != nil {
+		var preflight bool
+		if w, preflight = g.cors.handle(w, r); preflight {
 			return
 		}
 	}
 
+	// Handle debug endpoints
+	if g.options.EnableDebug && g.serveDebug(w, r) {
+		return
+	}
+
 	// Handle OpenAPI endpoint
 	if g.options.EnableOpenAPI && r.URL.Path == g.options.OpenAPIPath {
 		g.serveOpenAPI(w, r)
 		return
 	}
+	if g.options.EnableOpenAPI && g.serveOpenAPIPackage(w, r) {
+		return
+	}
+
+	// Handle GraphQL endpoint
+	if g.options.EnableGraphQL && g.serveGraphQL(w, r) {
+		return
+	}
+
+	// Handle API explorer endpoint
+	if g.options.EnableDocs && g.isDocsPath(r.URL.Path) {
+		g.serveDocs(w, r)
+		return
+	}
 
 	// Handle proto export endpoints
 	// Only match exact paths for proto export, not all paths starting with /proto
@@ -261,56 +399,14 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	g.handler.ServeHTTP(w, r)
 }
 
-// handleCORS handles CORS headers.
-func (g *Gateway) handleCORS(w http.ResponseWriter, r *http.Request) {
-	cfg := g.options.CORSConfig
-
-	// Set allowed origin
-	origin := r.Header.Get("Origin")
-	if len(cfg.AllowedOrigins) > 0 {
-		for _, allowed := range cfg.AllowedOrigins {
-			if allowed == "*" || allowed == origin {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				break
-			}
-		}
-	}
-
-	// Set other CORS headers
-	if len(cfg.AllowedMethods) > 0 {
-		w.Header().Set("Access-Control-Allow-Methods", joinStrings(cfg.AllowedMethods))
-	}
-	if len(cfg.AllowedHeaders) > 0 {
-		w.Header().Set("Access-Control-Allow-Headers", joinStrings(cfg.AllowedHeaders))
-	}
-	if cfg.AllowCredentials {
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-	}
-	if cfg.MaxAge > 0 {
-		w.Header().Set("Access-Control-Max-Age", fmt.Sprintf("%d", cfg.MaxAge))
-	}
-}
-
 // serveOpenAPI serves the OpenAPI specification.
 func (g *Gateway) serveOpenAPI(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if g.openAPI != nil {
 		_, _ = w.Write(g.openAPI)
 	} else {
-		_, _ = w.Write([]byte(`{"openapi":"3.0.0","info":{"title":"Hyperway API","version":"1.0.0"}}`))
-	}
-}
-
-// joinStrings joins strings with comma.
-func joinStrings(strs []string) string {
-	result := ""
-	for i, s := range strs {
-		if i > 0 {
-			result += ", "
-		}
-		result += s
+		_, _ = w.Write([]byte(`{"openapi":"3.1.0","info":{"title":"Hyperway API","version":"1.0.0"}}`))
 	}
-	return result
 }
 
 // ServiceBuilder helps build services.
@@ -353,17 +449,6 @@ func (sb *ServiceBuilder) Build() (*Service, error) {
 	}, nil
 }
 
-// DefaultCORSConfig returns a permissive CORS configuration for development.
-func DefaultCORSConfig() *CORSConfig {
-	return &CORSConfig{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-		MaxAge:           corsMaxAgeHours * hoursToSeconds, // 24 hours in seconds
-	}
-}
-
 // handleUnimplemented returns appropriate unimplemented error based on protocol
 func handleUnimplemented(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header.Get("Content-Type")
@@ -0,0 +1,1126 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultGraphQLPath is the default path of the GraphQL endpoint.
+const DefaultGraphQLPath = "/graphql"
+
+// graphQLSchemaSuffix is appended to the GraphQL path to serve the SDL.
+const graphQLSchemaSuffix = "/schema.graphql"
+
+// maxGraphQLRequestSize bounds the size of GraphQL requests.
+const maxGraphQLRequestSize = 1 << 20
+
+// maxGraphQLRootFields bounds the root fields of an operation, each of which
+// is a method call.
+const maxGraphQLRootFields = 100
+
+// graphQLSkippedHeaders are request headers that are not forwarded to the
+// methods called by GraphQL fields.
+var graphQLSkippedHeaders = map[string]bool{
+	"Accept":            true,
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Last-Event-Id":     true,
+	"Origin":            true,
+	"Te":                true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// graphQLRequest is a GraphQL request, sent as JSON or query parameters.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLResponse is the result of a GraphQL operation. Data is omitted for
+// requests that fail before execution.
+type graphQLResponse struct {
+	Data   *gqlObject `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// gqlError is a GraphQL error.
+type gqlError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// gqlObject is a response object that keeps its keys in selection order.
+type gqlObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func newGQLObject() *gqlObject {
+	return &gqlObject{values: make(map[string]any)}
+}
+
+func (o *gqlObject) set(key string, value any) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// serveGraphQL serves the GraphQL endpoint and its SDL, and reports whether
+// the path was one of them.
+func (g *Gateway) serveGraphQL(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case g.options.GraphQLPath:
+	case g.options.GraphQLPath + graphQLSchemaSuffix:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, g.graphql.SDL())
+		return true
+	default:
+		return false
+	}
+
+	req, status, err := readGraphQLRequest(r)
+	if err != nil {
+		writeGraphQLResponse(w, status, &graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return true
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		writeGraphQLResponse(w, http.StatusOK, &graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return true
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		writeGraphQLResponse(w, http.StatusOK, &graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return true
+	}
+	if r.Method == http.MethodGet && op.kind != "query" {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGraphQLResponse(w, http.StatusMethodNotAllowed, &graphQLResponse{Errors: []gqlError{{Message: "only queries can be sent with GET"}}})
+		return true
+	}
+
+	e := &gqlExecutor{gateway: g, schema: g.graphql, doc: doc, r: r, variables: req.Variables}
+	e.applyDefaults(op)
+	if !e.validate(op) {
+		writeGraphQLResponse(w, http.StatusOK, &graphQLResponse{Errors: e.errors})
+		return true
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		e.serveEvents(w, op)
+		return true
+	}
+	if op.kind == "subscription" {
+		writeGraphQLResponse(w, http.StatusOK, &graphQLResponse{Errors: []gqlError{{Message: "subscriptions must be requested with Accept: text/event-stream"}}})
+		return true
+	}
+	data := e.execute(op)
+	writeGraphQLResponse(w, http.StatusOK, &graphQLResponse{Data: data, Errors: e.errors})
+	return true
+}
+
+// readGraphQLRequest reads a request from the query parameters of a GET
+// request or the body of a POST request.
+func readGraphQLRequest(r *http.Request) (*graphQLRequest, int, error) {
+	req := &graphQLRequest{}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := decodeJSONNumbers(strings.NewReader(variables), &req.Variables); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	case http.MethodPost:
+		body := io.LimitReader(r.Body, maxGraphQLRequestSize)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") &&
+			!strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql-response") {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("failed to read request: %w", err)
+			}
+			req.Query = string(data)
+		} else if err := decodeJSONNumbers(body, req); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err)
+		}
+	default:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if req.Query == "" {
+		return nil, http.StatusBadRequest, errors.New("missing query")
+	}
+	return req, http.StatusOK, nil
+}
+
+// decodeJSONNumbers decodes JSON keeping numbers as json.Number.
+func decodeJSONNumbers(r io.Reader, v any) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// writeGraphQLResponse writes a response as JSON.
+func writeGraphQLResponse(w http.ResponseWriter, status int, resp *graphQLResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// operation returns the operation to execute.
+func (d *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, errors.New("operationName is required for documents with several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// gqlExecutor executes an operation by calling the methods behind its fields.
+type gqlExecutor struct {
+	gateway   *Gateway
+	schema    *gqlSchema
+	doc       *gqlDocument
+	r         *http.Request
+	variables map[string]any
+	errors    []gqlError
+}
+
+// gqlFieldGroup is the selections of a response key.
+type gqlFieldGroup struct {
+	key        string
+	field      *gqlSelection
+	selections []*gqlSelection // Merged sub-selections
+}
+
+// applyDefaults sets the default values of variables that were not provided.
+func (e *gqlExecutor) applyDefaults(op *gqlOperation) {
+	if e.variables == nil {
+		e.variables = make(map[string]any)
+	}
+	for _, variable := range op.variables {
+		if _, ok := e.variables[variable.name]; !ok && variable.defaultValue != nil {
+			e.variables[variable.name] = e.resolve(variable.defaultValue)
+		}
+	}
+}
+
+func (e *gqlExecutor) fail(path []any, format string, args ...any) {
+	e.errors = append(e.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+// rootType returns the root type of an operation.
+func (e *gqlExecutor) rootType(op *gqlOperation) (*gqlType, error) {
+	switch op.kind {
+	case "mutation":
+		if e.schema.mutation == nil {
+			return nil, errors.New("schema has no mutations")
+		}
+		return e.schema.mutation, nil
+	case "subscription":
+		if e.schema.subscription == nil {
+			return nil, errors.New("schema has no subscriptions")
+		}
+		return e.schema.subscription, nil
+	default:
+		return e.schema.query, nil
+	}
+}
+
+// execute executes a query or mutation, calling the methods of its fields in
+// order.
+func (e *gqlExecutor) execute(op *gqlOperation) *gqlObject {
+	root, err := e.rootType(op)
+	if err != nil {
+		e.fail(nil, "%v", err)
+		return nil
+	}
+	groups, err := e.collectFields(root.name, op.selections)
+	if err != nil {
+		e.fail(nil, "%v", err)
+		return nil
+	}
+
+	data := newGQLObject()
+	for _, group := range groups {
+		path := []any{group.key}
+		switch group.field.name {
+		case "__typename":
+			data.set(group.key, root.name)
+		case "__schema":
+			data.set(group.key, e.selectIntrospection(e.schema.introspection(), group.selections, path))
+		case "__type":
+			var typ any
+			for _, arg := range group.field.args {
+				if name, ok := e.resolve(arg.value).(string); ok && arg.name == "name" {
+					if t, exists := e.schema.introspection()["types"].([]any); exists {
+						for _, candidate := range t {
+							if candidate.(map[string]any)["name"] == name {
+								typ = candidate
+							}
+						}
+					}
+				}
+			}
+			data.set(group.key, e.selectIntrospection(typ, group.selections, path))
+		default:
+			field := root.field(group.field.name)
+			if field == nil {
+				e.fail(path, "Cannot query field %q on type %q.", group.field.name, root.name)
+				data.set(group.key, nil)
+				continue
+			}
+			if !e.checkSelections(field, group, path) {
+				data.set(group.key, nil)
+				continue
+			}
+			value, err := e.call(field, group.field)
+			if err != nil {
+				e.errors = append(e.errors, errorAt(err, path))
+				data.set(group.key, nil)
+				continue
+			}
+			data.set(group.key, e.complete(field.typ, value, group.selections, path))
+		}
+	}
+	return data
+}
+
+// validate checks the selected fields and arguments against the schema
+// before any method is called, so that invalid mutations have no effect.
+func (e *gqlExecutor) validate(op *gqlOperation) bool {
+	root, err := e.rootType(op)
+	if err != nil {
+		e.fail(nil, "%v", err)
+		return false
+	}
+	groups, err := e.collectFields(root.name, op.selections)
+	if err != nil {
+		e.fail(nil, "%v", err)
+		return false
+	}
+	if len(groups) > maxGraphQLRootFields {
+		e.fail(nil, "Operation selects %d root fields, more than the maximum of %d.", len(groups), maxGraphQLRootFields)
+		return false
+	}
+	e.validateSelections(root, op.selections, nil)
+	return len(e.errors) == 0
+}
+
+// validateSelections validates selections on an object type.
+func (e *gqlExecutor) validateSelections(t *gqlType, selections []*gqlSelection, path []any) {
+	groups, err := e.collectFields(t.name, selections)
+	if err != nil {
+		e.fail(path, "%v", err)
+		return
+	}
+	for _, group := range groups {
+		fieldPath := append(path[:len(path):len(path)], group.key)
+		if strings.HasPrefix(group.field.name, "__") {
+			continue // Introspection fields are shaped by their data
+		}
+		field := t.field(group.field.name)
+		if field == nil {
+			e.fail(fieldPath, "Cannot query field %q on type %q.", group.field.name, t.name)
+			continue
+		}
+		for _, arg := range group.field.args {
+			known := false
+			for _, candidate := range field.args {
+				known = known || candidate.name == arg.name
+			}
+			if !known {
+				e.fail(fieldPath, "Unknown argument %q on field %q.", arg.name, field.name)
+			}
+		}
+		if e.checkSelections(field, group, fieldPath) {
+			if sub := e.schema.types[field.typ.name]; sub != nil && sub.kind == gqlKindObject {
+				e.validateSelections(sub, group.selections, fieldPath)
+			}
+		}
+	}
+}
+
+// checkSelections reports whether a field has sub-selections if and only if
+// it is of an object type.
+func (e *gqlExecutor) checkSelections(field *gqlField, group *gqlFieldGroup, path []any) bool {
+	t := e.schema.types[field.typ.name]
+	if t == nil || field.procedure == "" && field.name == gqlEmptyField {
+		return true
+	}
+	switch {
+	case t.kind == gqlKindObject && len(group.selections) == 0:
+		e.fail(path, "Field %q of type %q must have a selection of subfields.", field.name, field.typ)
+		return false
+	case t.kind != gqlKindObject && len(group.selections) > 0:
+		e.fail(path, "Field %q must not have a selection since type %q has no subfields.", field.name, field.typ)
+		return false
+	}
+	return true
+}
+
+// collectFields groups the fields selected on a type by response key,
+// expanding fragments and applying @skip and @include.
+func (e *gqlExecutor) collectFields(typeName string, selections []*gqlSelection) ([]*gqlFieldGroup, error) {
+	var groups []*gqlFieldGroup
+	byKey := make(map[string]*gqlFieldGroup)
+	var collect func(selections []*gqlSelection, visited map[string]bool) error
+	collect = func(selections []*gqlSelection, visited map[string]bool) error {
+		for _, selection := range selections {
+			if !e.included(selection) {
+				continue
+			}
+			switch {
+			case selection.fragment != "":
+				fragment, ok := e.doc.fragments[selection.fragment]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", selection.fragment)
+				}
+				if visited[selection.fragment] || fragment.typeCondition != typeName {
+					continue
+				}
+				visited[selection.fragment] = true
+				if err := collect(fragment.selections, visited); err != nil {
+					return err
+				}
+			case selection.inline:
+				if selection.typeCondition != "" && selection.typeCondition != typeName {
+					continue
+				}
+				if err := collect(selection.selections, visited); err != nil {
+					return err
+				}
+			default:
+				key := selection.responseKey()
+				group, ok := byKey[key]
+				if !ok {
+					group = &gqlFieldGroup{key: key, field: selection}
+					byKey[key] = group
+					groups = append(groups, group)
+				}
+				group.selections = append(group.selections, selection.selections...)
+			}
+		}
+		return nil
+	}
+	if err := collect(selections, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// included applies the @skip and @include directives of a selection.
+func (e *gqlExecutor) included(selection *gqlSelection) bool {
+	for _, directive := range selection.directives {
+		for _, arg := range directive.args {
+			if arg.name != "if" {
+				continue
+			}
+			value, _ := e.resolve(arg.value).(bool)
+			if directive.name == "skip" && value || directive.name == "include" && !value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// complete shapes a value of a method response by the selections.
+func (e *gqlExecutor) complete(ref gqlTypeRef, value any, selections []*gqlSelection, path []any) any {
+	if ref.list {
+		if value == nil && !ref.nonNull {
+			return nil
+		}
+		items, _ := value.([]any)
+		result := make([]any, len(items))
+		elem := gqlTypeRef{name: ref.name, nonNull: ref.elemNonNull}
+		for i, item := range items {
+			result[i] = e.complete(elem, item, selections, append(path[:len(path):len(path)], i))
+		}
+		return result
+	}
+
+	t := e.schema.types[ref.name]
+	switch t.kind {
+	case gqlKindObject:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		return e.completeObject(t, obj, selections, path)
+	case gqlKindEnum:
+		return enumName(t, value, ref.nonNull)
+	default:
+		if value == nil && ref.nonNull {
+			return scalarZero(t.name)
+		}
+		return value
+	}
+}
+
+// completeObject selects the fields of a message.
+func (e *gqlExecutor) completeObject(t *gqlType, obj map[string]any, selections []*gqlSelection, path []any) *gqlObject {
+	groups, err := e.collectFields(t.name, selections)
+	if err != nil {
+		e.fail(path, "%v", err)
+		return nil
+	}
+	result := newGQLObject()
+	for _, group := range groups {
+		fieldPath := append(path[:len(path):len(path)], group.key)
+		if group.field.name == "__typename" {
+			result.set(group.key, t.name)
+			continue
+		}
+		field := t.field(group.field.name)
+		if field == nil {
+			e.fail(fieldPath, "Cannot query field %q on type %q.", group.field.name, t.name)
+			result.set(group.key, nil)
+			continue
+		}
+		if !e.checkSelections(field, group, fieldPath) {
+			result.set(group.key, nil)
+			continue
+		}
+		var value any
+		for _, name := range field.jsonNames {
+			if v, ok := obj[name]; ok {
+				value = v
+				break
+			}
+		}
+		result.set(group.key, e.complete(field.typ, value, group.selections, fieldPath))
+	}
+	return result
+}
+
+// enumName returns the name of an enum value encoded as a name or number.
+func enumName(t *gqlType, value any, nonNull bool) any {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		for _, candidate := range t.values {
+			if v.String() == fmt.Sprint(candidate.number) {
+				return candidate.name
+			}
+		}
+	}
+	if nonNull && len(t.values) > 0 {
+		return t.values[0].name
+	}
+	return nil
+}
+
+// scalarZero returns the default value of a scalar omitted by protobuf JSON.
+func scalarZero(name string) any {
+	switch name {
+	case gqlString, gqlBytes:
+		return ""
+	case gqlInt, gqlInt64, gqlFloat:
+		return 0
+	case gqlBoolean:
+		return false
+	default:
+		return nil
+	}
+}
+
+// resolve returns the JSON value of a literal or variable.
+func (e *gqlExecutor) resolve(v *gqlValue) any {
+	switch v.kind {
+	case gqlValueVariable:
+		return e.variables[v.raw]
+	case gqlValueInt, gqlValueFloat:
+		return json.Number(v.raw)
+	case gqlValueString, gqlValueEnum:
+		return v.raw
+	case gqlValueBoolean:
+		return v.raw == "true"
+	case gqlValueList:
+		list := make([]any, len(v.list))
+		for i, item := range v.list {
+			list[i] = e.resolve(item)
+		}
+		return list
+	case gqlValueObject:
+		obj := make(map[string]any, len(v.fields))
+		for _, field := range v.fields {
+			obj[field.name] = e.resolve(field.value)
+		}
+		return obj
+	default:
+		return nil
+	}
+}
+
+// requestBody encodes the arguments of a root field as the JSON request of
+// its method.
+func (e *gqlExecutor) requestBody(field *gqlField, selection *gqlSelection) ([]byte, error) {
+	request := make(map[string]any)
+	for _, arg := range selection.args {
+		var argField *gqlField
+		for _, candidate := range field.args {
+			if candidate.name == arg.name {
+				argField = candidate
+			}
+		}
+		if argField == nil {
+			return nil, fmt.Errorf("unknown argument %q on field %q", arg.name, field.name)
+		}
+		value, err := e.coerceInput(argField.typ, e.resolve(arg.value))
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			request[argField.protoName] = value
+		}
+	}
+	return json.Marshal(request)
+}
+
+// coerceInput converts an input value from GraphQL to protobuf field names.
+func (e *gqlExecutor) coerceInput(ref gqlTypeRef, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if ref.list {
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+		result := make([]any, 0, len(items))
+		for _, item := range items {
+			coerced, err := e.coerceInput(gqlTypeRef{name: ref.name}, item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, coerced)
+		}
+		return result, nil
+	}
+
+	t := e.schema.types[ref.name]
+	if t == nil || t.kind != gqlKindInput {
+		return value, nil
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected an object of type %q", t.name)
+	}
+	result := make(map[string]any, len(obj))
+	for name, v := range obj {
+		field := t.field(name)
+		if field == nil || field.name == gqlEmptyField {
+			return nil, fmt.Errorf("unknown field %q of type %q", name, t.name)
+		}
+		coerced, err := e.coerceInput(field.typ, v)
+		if err != nil {
+			return nil, err
+		}
+		if coerced != nil {
+			result[field.protoName] = coerced
+		}
+	}
+	return result, nil
+}
+
+// call calls the unary method of a root field.
+func (e *gqlExecutor) call(field *gqlField, selection *gqlSelection) (any, error) {
+	body, err := e.requestBody(field, selection)
+	if err != nil {
+		return nil, err
+	}
+	rec := &graphQLResponseWriter{header: make(http.Header)}
+	e.gateway.handler.ServeHTTP(rec, e.subrequest(field.procedure, contentTypeJSON, body))
+	if rec.status != 0 && rec.status != http.StatusOK {
+		return nil, connectErrorOf(rec.body.Bytes(), rec.status)
+	}
+	var value any
+	if err := decodeJSONNumbers(&rec.body, &value); err != nil {
+		return nil, fmt.Errorf("invalid response of %s: %w", field.procedure, err)
+	}
+	return value, nil
+}
+
+// subrequest returns a request to procedure carrying the headers of the
+// GraphQL request, such as credentials. Unary calls are plain JSON requests,
+// whose errors have an HTTP status; streaming calls use the Connect protocol.
+func (e *gqlExecutor) subrequest(procedure, contentType string, body []byte) *http.Request {
+	req, _ := http.NewRequestWithContext(e.r.Context(), http.MethodPost, procedure, bytes.NewReader(body))
+	for key, values := range e.r.Header {
+		if !graphQLSkippedHeaders[key] {
+			req.Header[key] = values
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if contentType == contentTypeConnectJSON {
+		req.Header.Set("Connect-Protocol-Version", "1")
+	}
+	req.RemoteAddr, req.Host, req.TLS = e.r.RemoteAddr, e.r.Host, e.r.TLS
+	return req
+}
+
+// gqlCallError is the error of a method called by a field.
+type gqlCallError struct {
+	code    string
+	message string
+}
+
+func (e *gqlCallError) Error() string {
+	return e.message
+}
+
+// connectErrorOf decodes the error of a failed call, either a Connect error
+// or a JSON error of the form {"error": "code: message"}.
+func connectErrorOf(body []byte, status int) error {
+	var connectErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	err := json.Unmarshal(body, &connectErr)
+	if err == nil && connectErr.Code == "" && connectErr.Error != "" {
+		connectErr.Code, connectErr.Message, _ = strings.Cut(connectErr.Error, ": ")
+	}
+	if err != nil || connectErr.Code == "" {
+		return &gqlCallError{code: "unknown", message: fmt.Sprintf("HTTP %d: %s", status, strings.TrimSpace(string(body)))}
+	}
+	if connectErr.Message == "" {
+		connectErr.Message = connectErr.Code
+	}
+	return &gqlCallError{code: connectErr.Code, message: connectErr.Message}
+}
+
+// errorAt converts an error into a GraphQL error at path, with the code of a
+// failed call as an extension.
+func errorAt(err error, path []any) gqlError {
+	gqlErr := gqlError{Message: err.Error(), Path: path}
+	var callErr *gqlCallError
+	if errors.As(err, &callErr) {
+		gqlErr.Extensions = map[string]any{"code": strings.ToUpper(callErr.code)}
+	}
+	return gqlErr
+}
+
+// graphQLResponseWriter buffers the response of a unary call.
+type graphQLResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *graphQLResponseWriter) Header() http.Header { return w.header }
+
+func (w *graphQLResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *graphQLResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
+
+// serveEvents serves an operation as server-sent events in the distinct
+// connections mode of the GraphQL over SSE protocol: each result is a "next"
+// event, followed by a "complete" event.
+func (e *gqlExecutor) serveEvents(w http.ResponseWriter, op *gqlOperation) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	var mu sync.Mutex // Serializes events and the heartbeats of subscriptions
+	next := func(resp *graphQLResponse) {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			data, _ = json.Marshal(&graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	defer func() {
+		_, _ = io.WriteString(w, "event: complete\ndata:\n\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}()
+
+	if op.kind != "subscription" {
+		data := e.execute(op)
+		next(&graphQLResponse{Data: data, Errors: e.errors})
+		return
+	}
+
+	root, err := e.rootType(op)
+	if err != nil {
+		next(&graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	groups, err := e.collectFields(root.name, op.selections)
+	if err == nil && len(groups) != 1 {
+		err = errors.New("subscriptions must select exactly one field")
+	}
+	if err != nil {
+		next(&graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	group := groups[0]
+	path := []any{group.key}
+	field := root.field(group.field.name)
+	if field == nil {
+		next(&graphQLResponse{Errors: []gqlError{{Message: fmt.Sprintf("Cannot query field %q on type %q.", group.field.name, root.name), Path: path}}})
+		return
+	}
+	if !e.checkSelections(field, group, path) {
+		next(&graphQLResponse{Errors: e.errors})
+		return
+	}
+	body, err := e.requestBody(field, group.field)
+	if err != nil {
+		next(&graphQLResponse{Errors: []gqlError{errorAt(err, path)}})
+		return
+	}
+
+	stream := &graphQLStreamWriter{header: make(http.Header)}
+	stream.onMessage = func(message []byte) {
+		var value any
+		if err := decodeJSONNumbers(bytes.NewReader(message), &value); err != nil {
+			next(&graphQLResponse{Errors: []gqlError{errorAt(err, path)}})
+			return
+		}
+		e.errors = nil
+		data := newGQLObject()
+		data.set(group.key, e.complete(field.typ, value, group.selections, path))
+		next(&graphQLResponse{Data: data, Errors: e.errors})
+	}
+	stream.onEnd = func(err error) {
+		next(&graphQLResponse{Errors: []gqlError{errorAt(err, path)}})
+	}
+	stream.onHeartbeat = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = io.WriteString(w, ": heartbeat\n\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	e.gateway.handler.ServeHTTP(stream, e.subrequest(field.procedure, contentTypeConnectJSON, connectEnvelope(0, body)))
+	stream.finish()
+}
+
+// connectEnvelope frames a Connect streaming message.
+func connectEnvelope(flags byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data))) //nolint:gosec // bounded by maxGraphQLRequestSize
+	copy(frame[5:], data)
+	return frame
+}
+
+// graphQLStreamWriter decodes the Connect stream of a server-streaming call
+// as it is written.
+type graphQLStreamWriter struct {
+	header      http.Header
+	status      int
+	buf         bytes.Buffer
+	onMessage   func([]byte)
+	onEnd       func(error)
+	onHeartbeat func()
+	ended       bool
+}
+
+func (w *graphQLStreamWriter) Header() http.Header { return w.header }
+
+func (w *graphQLStreamWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *graphQLStreamWriter) Flush() {}
+
+// WriteHeartbeat sends the heartbeats of an idle stream as SSE comments,
+// instead of empty messages.
+func (w *graphQLStreamWriter) WriteHeartbeat() error {
+	w.onHeartbeat()
+	return nil
+}
+
+func (w *graphQLStreamWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.buf.Write(data)
+	if w.status != http.StatusOK {
+		return len(data), nil // An error response, decoded by finish
+	}
+	for w.buf.Len() >= 5 {
+		frame := w.buf.Bytes()
+		size := int(binary.BigEndian.Uint32(frame[1:5]))
+		if len(frame) < 5+size {
+			break
+		}
+		flags, message := frame[0], append([]byte(nil), frame[5:5+size]...)
+		w.buf.Next(5 + size)
+		if flags&0x02 != 0 {
+			w.end(message)
+		} else if !w.ended {
+			w.onMessage(message)
+		}
+	}
+	return len(data), nil
+}
+
+// end handles the end-of-stream message, reporting its error if any.
+func (w *graphQLStreamWriter) end(message []byte) {
+	w.ended = true
+	var end struct {
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(message, &end); err == nil && end.Error != nil {
+		w.onEnd(&gqlCallError{code: end.Error.Code, message: end.Error.Message})
+	}
+}
+
+// finish reports calls that failed before streaming.
+func (w *graphQLStreamWriter) finish() {
+	if w.status != 0 && w.status != http.StatusOK {
+		w.onEnd(connectErrorOf(w.buf.Bytes(), w.status))
+	}
+}
+
+// selectIntrospection selects fields of introspection data, whose objects
+// carry their type in "__typename".
+func (e *gqlExecutor) selectIntrospection(value any, selections []*gqlSelection, path []any) any {
+	switch v := value.(type) {
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = e.selectIntrospection(item, selections, append(path[:len(path):len(path)], i))
+		}
+		return result
+	case map[string]any:
+		typeName, _ := v["__typename"].(string)
+		groups, err := e.collectFields(typeName, selections)
+		if err != nil {
+			e.fail(path, "%v", err)
+			return nil
+		}
+		result := newGQLObject()
+		for _, group := range groups {
+			result.set(group.key, e.selectIntrospection(v[group.field.name], group.selections, append(path[:len(path):len(path)], group.key)))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// introspection returns the schema as introspection data, built once.
+func (s *gqlSchema) introspection() map[string]any {
+	s.introspectOnce.Do(func() {
+		s.introspected = s.buildIntrospection()
+	})
+	return s.introspected
+}
+
+// buildIntrospection converts the schema into introspection data.
+func (s *gqlSchema) buildIntrospection() map[string]any {
+	names := append([]string(nil), s.names...)
+	sort.Strings(names)
+	types := make(map[string]map[string]any, len(names))
+	list := make([]any, 0, len(names))
+	for _, name := range names {
+		t := s.types[name]
+		types[name] = map[string]any{
+			"__typename":     "__Type",
+			"kind":           t.kind,
+			"name":           name,
+			"description":    nullableString(t.description),
+			"specifiedByURL": nil,
+			"isOneOf":        false,
+		}
+		list = append(list, types[name])
+	}
+
+	ref := func(r gqlTypeRef) map[string]any {
+		named := types[r.name]
+		if r.list {
+			elem := named
+			if r.elemNonNull {
+				elem = wrapIntrospectionType("NON_NULL", elem)
+			}
+			named = wrapIntrospectionType("LIST", elem)
+		}
+		if r.nonNull {
+			return wrapIntrospectionType("NON_NULL", named)
+		}
+		return named
+	}
+	inputValue := func(f *gqlField) map[string]any {
+		return map[string]any{
+			"__typename":        "__InputValue",
+			"name":              f.name,
+			"description":       nullableString(f.description),
+			"type":              ref(f.typ),
+			"defaultValue":      nil,
+			"isDeprecated":      f.deprecated,
+			"deprecationReason": deprecationReason(f.deprecated),
+		}
+	}
+
+	for _, name := range names {
+		t, data := s.types[name], types[name]
+		switch t.kind {
+		case gqlKindObject:
+			fields := make([]any, len(t.fields))
+			for i, f := range t.fields {
+				args := make([]any, len(f.args))
+				for j, arg := range f.args {
+					args[j] = inputValue(arg)
+				}
+				fields[i] = map[string]any{
+					"__typename":        "__Field",
+					"name":              f.name,
+					"description":       nullableString(f.description),
+					"args":              args,
+					"type":              ref(f.typ),
+					"isDeprecated":      f.deprecated,
+					"deprecationReason": deprecationReason(f.deprecated),
+				}
+			}
+			data["fields"], data["interfaces"] = fields, []any{}
+		case gqlKindInput:
+			fields := make([]any, len(t.fields))
+			for i, f := range t.fields {
+				fields[i] = inputValue(f)
+			}
+			data["inputFields"] = fields
+		case gqlKindEnum:
+			values := make([]any, len(t.values))
+			for i, value := range t.values {
+				values[i] = map[string]any{
+					"__typename":        "__EnumValue",
+					"name":              value.name,
+					"description":       nil,
+					"isDeprecated":      false,
+					"deprecationReason": nil,
+				}
+			}
+			data["enumValues"] = values
+		}
+	}
+
+	ifArg := []any{map[string]any{
+		"__typename":   "__InputValue",
+		"name":         "if",
+		"description":  nil,
+		"type":         wrapIntrospectionType("NON_NULL", types[gqlBoolean]),
+		"defaultValue": nil,
+	}}
+	directive := func(name, description string, args []any, locations ...string) map[string]any {
+		locationList := make([]any, len(locations))
+		for i, location := range locations {
+			locationList[i] = location
+		}
+		return map[string]any{
+			"__typename":   "__Directive",
+			"name":         name,
+			"description":  description,
+			"locations":    locationList,
+			"args":         args,
+			"isRepeatable": false,
+		}
+	}
+
+	schema := map[string]any{
+		"__typename":       "__Schema",
+		"description":      nil,
+		"queryType":        types[s.query.name],
+		"mutationType":     nil,
+		"subscriptionType": nil,
+		"types":            list,
+		"directives": []any{
+			directive("skip", "Skips the field or fragment when the argument is true.", ifArg, "FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"),
+			directive("include", "Includes the field or fragment only when the argument is true.", ifArg, "FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"),
+			directive("deprecated", "Marks a field as deprecated.", []any{}, "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INPUT_FIELD_DEFINITION", "ENUM_VALUE"),
+		},
+	}
+	if s.mutation != nil {
+		schema["mutationType"] = types[s.mutation.name]
+	}
+	if s.subscription != nil {
+		schema["subscriptionType"] = types[s.subscription.name]
+	}
+	return schema
+}
+
+// wrapIntrospectionType returns a list or non-null type of ofType.
+func wrapIntrospectionType(kind string, ofType map[string]any) map[string]any {
+	return map[string]any{"__typename": "__Type", "kind": kind, "name": nil, "ofType": ofType}
+}
+
+// nullableString returns nil for an empty string.
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// deprecationReason returns the reason of deprecated elements.
+func deprecationReason(deprecated bool) any {
+	if deprecated {
+		return "No longer supported"
+	}
+	return nil
+}
@@ -0,0 +1,576 @@
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// gqlDocument is a parsed GraphQL executable document.
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// gqlOperation is a query, mutation, or subscription.
+type gqlOperation struct {
+	kind       string
+	name       string
+	variables  []gqlVariable
+	selections []*gqlSelection
+}
+
+// gqlVariable is a variable definition with its default value.
+type gqlVariable struct {
+	name         string
+	defaultValue *gqlValue
+}
+
+// gqlFragment is a named fragment.
+type gqlFragment struct {
+	typeCondition string
+	selections    []*gqlSelection
+}
+
+// gqlSelection is a field, fragment spread, or inline fragment.
+type gqlSelection struct {
+	// Fields have a name, and an alias if it differs from the response key
+	alias      string
+	name       string
+	args       []gqlArgument
+	directives []gqlArgumentList
+	selections []*gqlSelection
+
+	// Spreads name a fragment; inline fragments have selections and an
+	// optional type condition
+	fragment      string
+	inline        bool
+	typeCondition string
+}
+
+// gqlArgument is a named value.
+type gqlArgument struct {
+	name  string
+	value *gqlValue
+}
+
+// gqlArgumentList is a directive with its arguments.
+type gqlArgumentList struct {
+	name string
+	args []gqlArgument
+}
+
+// responseKey returns the key of a field in the response.
+func (s *gqlSelection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// gqlValueKind is the kind of a literal value.
+type gqlValueKind int
+
+const (
+	gqlValueVariable gqlValueKind = iota
+	gqlValueInt
+	gqlValueFloat
+	gqlValueString
+	gqlValueBoolean
+	gqlValueNull
+	gqlValueEnum
+	gqlValueList
+	gqlValueObject
+)
+
+// gqlValue is a literal or variable in a document.
+type gqlValue struct {
+	kind   gqlValueKind
+	raw    string // Scalars, enum values, and variable names
+	list   []*gqlValue
+	fields []gqlArgument
+}
+
+// gqlToken kinds
+const (
+	gqlTokenEOF = iota
+	gqlTokenPunct
+	gqlTokenName
+	gqlTokenInt
+	gqlTokenFloat
+	gqlTokenString
+)
+
+type gqlToken struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// maxGraphQLDepth bounds the nesting of selection sets, values, and type
+// references, so that deeply nested documents cannot exhaust the stack.
+const maxGraphQLDepth = 64
+
+// gqlParser parses GraphQL documents by recursive descent.
+type gqlParser struct {
+	src   string
+	pos   int
+	tok   gqlToken
+	depth int
+}
+
+// parseGraphQL parses an executable document.
+func parseGraphQL(src string) (doc *gqlDocument, err error) {
+	p := &gqlParser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(gqlSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+	p.next()
+	return p.document(), nil
+}
+
+// gqlSyntaxError is a syntax error at a position of the source.
+type gqlSyntaxError struct {
+	message string
+	line    int
+	column  int
+}
+
+func (e gqlSyntaxError) Error() string {
+	return fmt.Sprintf("Syntax Error: %s (line %d, column %d)", e.message, e.line, e.column)
+}
+
+func (p *gqlParser) fail(format string, args ...any) {
+	line, column := 1, 1
+	for _, r := range p.src[:p.tok.pos] {
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	panic(gqlSyntaxError{message: fmt.Sprintf(format, args...), line: line, column: column})
+}
+
+// enter descends into a nested construct; the caller defers leave.
+func (p *gqlParser) enter() {
+	p.depth++
+	if p.depth > maxGraphQLDepth {
+		p.fail("document exceeds the maximum nesting depth of %d", maxGraphQLDepth)
+	}
+}
+
+func (p *gqlParser) leave() {
+	p.depth--
+}
+
+func (p *gqlParser) document() *gqlDocument {
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.tok.kind != gqlTokenEOF {
+		switch {
+		case p.peek("{"):
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: p.selectionSet()})
+		case p.peek("query"), p.peek("mutation"), p.peek("subscription"):
+			doc.operations = append(doc.operations, p.operation())
+		case p.peek("fragment"):
+			p.next()
+			name := p.name()
+			if name == "on" {
+				p.fail("unexpected fragment name %q", name)
+			}
+			if _, exists := doc.fragments[name]; exists {
+				p.fail("duplicate fragment %q", name)
+			}
+			p.expectKeyword("on")
+			fragment := &gqlFragment{typeCondition: p.name()}
+			p.directives()
+			fragment.selections = p.selectionSet()
+			doc.fragments[name] = fragment
+		default:
+			p.fail("unexpected %q", p.tok.value)
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail("document has no operations")
+	}
+	return doc
+}
+
+func (p *gqlParser) operation() *gqlOperation {
+	op := &gqlOperation{kind: p.name()}
+	if p.tok.kind == gqlTokenName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			variable := gqlVariable{name: p.name()}
+			p.expect(":")
+			p.typeRef()
+			if p.skip("=") {
+				variable.defaultValue = p.value(true)
+			}
+			p.directives()
+			op.variables = append(op.variables, variable)
+		}
+	}
+	p.directives()
+	op.selections = p.selectionSet()
+	return op
+}
+
+// typeRef skips a type reference; variables are coerced by the schema.
+func (p *gqlParser) typeRef() {
+	p.enter()
+	defer p.leave()
+	if p.skip("[") {
+		p.typeRef()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	p.skip("!")
+}
+
+func (p *gqlParser) selectionSet() []*gqlSelection {
+	p.enter()
+	defer p.leave()
+	p.expect("{")
+	var selections []*gqlSelection
+	for !p.skip("}") {
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *gqlParser) selection() *gqlSelection {
+	if p.skip("...") {
+		if p.tok.kind == gqlTokenName && p.tok.value != "on" {
+			return &gqlSelection{fragment: p.name(), directives: p.directives()}
+		}
+		selection := &gqlSelection{inline: true}
+		if p.peek("on") {
+			p.next()
+			selection.typeCondition = p.name()
+		}
+		selection.directives = p.directives()
+		selection.selections = p.selectionSet()
+		return selection
+	}
+
+	selection := &gqlSelection{name: p.name()}
+	if p.skip(":") {
+		selection.alias, selection.name = selection.name, p.name()
+	}
+	selection.args = p.arguments(false)
+	selection.directives = p.directives()
+	if p.peek("{") {
+		selection.selections = p.selectionSet()
+	}
+	return selection
+}
+
+func (p *gqlParser) arguments(constant bool) []gqlArgument {
+	if !p.skip("(") {
+		return nil
+	}
+	var args []gqlArgument
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		args = append(args, gqlArgument{name: name, value: p.value(constant)})
+	}
+	return args
+}
+
+func (p *gqlParser) directives() []gqlArgumentList {
+	var directives []gqlArgumentList
+	for p.skip("@") {
+		directives = append(directives, gqlArgumentList{name: p.name(), args: p.arguments(false)})
+	}
+	return directives
+}
+
+func (p *gqlParser) value(constant bool) *gqlValue {
+	p.enter()
+	defer p.leave()
+	tok := p.tok
+	switch {
+	case tok.kind == gqlTokenPunct && tok.value == "$":
+		if constant {
+			p.fail("unexpected variable in a constant value")
+		}
+		p.next()
+		return &gqlValue{kind: gqlValueVariable, raw: p.name()}
+	case tok.kind == gqlTokenPunct && tok.value == "[":
+		p.next()
+		v := &gqlValue{kind: gqlValueList}
+		for !p.skip("]") {
+			v.list = append(v.list, p.value(constant))
+		}
+		return v
+	case tok.kind == gqlTokenPunct && tok.value == "{":
+		p.next()
+		v := &gqlValue{kind: gqlValueObject}
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			v.fields = append(v.fields, gqlArgument{name: name, value: p.value(constant)})
+		}
+		return v
+	case tok.kind == gqlTokenInt:
+		p.next()
+		return &gqlValue{kind: gqlValueInt, raw: tok.value}
+	case tok.kind == gqlTokenFloat:
+		p.next()
+		return &gqlValue{kind: gqlValueFloat, raw: tok.value}
+	case tok.kind == gqlTokenString:
+		p.next()
+		return &gqlValue{kind: gqlValueString, raw: tok.value}
+	case tok.kind == gqlTokenName:
+		p.next()
+		switch tok.value {
+		case "true", "false":
+			return &gqlValue{kind: gqlValueBoolean, raw: tok.value}
+		case "null":
+			return &gqlValue{kind: gqlValueNull}
+		default:
+			return &gqlValue{kind: gqlValueEnum, raw: tok.value}
+		}
+	}
+	p.fail("unexpected %q", tok.value)
+	return nil
+}
+
+// name consumes a name token.
+func (p *gqlParser) name() string {
+	if p.tok.kind != gqlTokenName {
+		p.fail("expected a name, found %q", p.tok.value)
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+// peek reports whether the current token is the punctuator or name value.
+func (p *gqlParser) peek(value string) bool {
+	return (p.tok.kind == gqlTokenPunct || p.tok.kind == gqlTokenName) && p.tok.value == value
+}
+
+// skip consumes the punctuator value if it is the current token.
+func (p *gqlParser) skip(value string) bool {
+	if p.tok.kind == gqlTokenPunct && p.tok.value == value {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(value string) {
+	if !p.skip(value) {
+		p.fail("expected %q, found %q", value, p.tok.value)
+	}
+}
+
+func (p *gqlParser) expectKeyword(value string) {
+	if !p.peek(value) || p.tok.kind != gqlTokenName {
+		p.fail("expected %q, found %q", value, p.tok.value)
+	}
+	p.next()
+}
+
+// next reads the next token, skipping ignored characters and comments.
+func (p *gqlParser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			p.token()
+			return
+		}
+	}
+	p.tok = gqlToken{kind: gqlTokenEOF, pos: p.pos}
+}
+
+func (p *gqlParser) token() {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{kind: gqlTokenPunct, value: "...", pos: start}
+	case strings.ContainsRune("!$&()/:=@[]{|}", rune(c)):
+		p.pos++
+		p.tok = gqlToken{kind: gqlTokenPunct, value: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlTokenName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		p.tok = gqlToken{pos: start, value: string(c)}
+		p.fail("unexpected character %q", c)
+	}
+}
+
+func (p *gqlParser) number() {
+	start := p.pos
+	kind := gqlTokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		begin := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == begin {
+			p.tok = gqlToken{pos: start}
+			p.fail("invalid number %q", p.src[start:p.pos])
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = gqlTokenFloat
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = gqlTokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	p.tok = gqlToken{kind: kind, value: p.src[start:p.pos], pos: start}
+}
+
+func (p *gqlParser) string() {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := p.pos + 3
+		for {
+			idx := strings.Index(p.src[end:], `"""`)
+			if idx < 0 {
+				p.tok = gqlToken{pos: start}
+				p.fail("unterminated block string")
+			}
+			end += idx
+			if p.src[end-1] != '\\' {
+				break
+			}
+			end += 3
+		}
+		raw := strings.ReplaceAll(p.src[p.pos+3:end], `\"""`, `"""`)
+		p.pos = end + 3
+		p.tok = gqlToken{kind: gqlTokenString, value: blockStringValue(raw), pos: start}
+		return
+	}
+
+	var sb strings.Builder
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			p.tok = gqlToken{pos: start}
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			p.tok = gqlToken{kind: gqlTokenString, value: sb.String(), pos: start}
+			return
+		case '\\':
+			p.escape(&sb, start)
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			sb.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// escape decodes an escape sequence of a string.
+func (p *gqlParser) escape(sb *strings.Builder, start int) {
+	if p.pos+1 >= len(p.src) {
+		p.tok = gqlToken{pos: start}
+		p.fail("unterminated string")
+	}
+	escapes := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+	c := p.src[p.pos+1]
+	if s, ok := escapes[c]; ok {
+		sb.WriteString(s)
+		p.pos += 2
+		return
+	}
+	if c == 'u' && p.pos+6 <= len(p.src) {
+		code, err := strconv.ParseUint(p.src[p.pos+2:p.pos+6], 16, 32)
+		if err == nil {
+			sb.WriteRune(rune(code))
+			p.pos += 6
+			return
+		}
+	}
+	p.tok = gqlToken{pos: p.pos}
+	p.fail("invalid escape sequence")
+}
+
+// blockStringValue removes the common indentation and the blank first and
+// last lines of a block string.
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
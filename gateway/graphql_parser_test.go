@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# Comments are ignored
+		query Get($id: ID = "1", $skip: Boolean!) @cached {
+			user: getUser(id: $id, filter: {tags: ["a", "b"], limit: -2.5e3, kind: ADMIN, note: null}) {
+				...Fields @skip(if: $skip)
+				... on User { bio(text: """
+					Block
+					  string
+				""") }
+			}
+		}
+		fragment Fields on User { id, name }`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Get" || len(op.variables) != 2 || op.variables[0].defaultValue.raw != "1" {
+		t.Fatalf("Unexpected operation: %+v", op)
+	}
+	user := op.selections[0]
+	if user.responseKey() != "user" || user.name != "getUser" || len(user.args) != 2 {
+		t.Fatalf("Unexpected selection: %+v", user)
+	}
+	filter := user.args[1].value
+	if filter.kind != gqlValueObject || len(filter.fields) != 4 {
+		t.Fatalf("Unexpected object value: %+v", filter)
+	}
+	for i, want := range []struct {
+		kind gqlValueKind
+		raw  string
+	}{{gqlValueList, ""}, {gqlValueFloat, "-2.5e3"}, {gqlValueEnum, "ADMIN"}, {gqlValueNull, ""}} {
+		if got := filter.fields[i].value; got.kind != want.kind || got.raw != want.raw {
+			t.Errorf("Field %d: expected %v %q, got %v %q", i, want.kind, want.raw, got.kind, got.raw)
+		}
+	}
+
+	spread, inline := user.selections[0], user.selections[1]
+	if spread.fragment != "Fields" || len(spread.directives) != 1 || spread.directives[0].name != "skip" {
+		t.Errorf("Unexpected fragment spread: %+v", spread)
+	}
+	if !inline.inline || inline.typeCondition != "User" {
+		t.Errorf("Unexpected inline fragment: %+v", inline)
+	}
+	if text := inline.selections[0].args[0].value.raw; text != "Block\n  string" {
+		t.Errorf("Expected the block string to be dedented, got %q", text)
+	}
+	if fragment := doc.fragments["Fields"]; fragment == nil || len(fragment.selections) != 2 {
+		t.Errorf("Unexpected fragment: %+v", fragment)
+	}
+
+	// The shorthand query form
+	doc, err = parseGraphQL(`{ a: b(s: "é\n") }`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if op := doc.operations[0]; op.kind != "query" || op.selections[0].args[0].value.raw != "é\n" {
+		t.Errorf("Unexpected shorthand query: %+v", op)
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"", "(line 1, column 1)"},
+		{"{ a ", "(line 1, column 5)"},
+		{"query {\n  a(x: )\n}", "(line 2, column 8)"},
+		{`{ a(s: "open) }`, "unterminated string"},
+		{"{ a } extra", "(line 1, column 7)"},
+		{"{" + strings.Repeat("a{", 100000) + "b" + strings.Repeat("}", 100001), "maximum nesting depth"},
+		{"{ a(x: " + strings.Repeat("[", 1000000) + ") }", "maximum nesting depth"},
+		{"query($x: " + strings.Repeat("[", 1000) + "Int) { a }", "maximum nesting depth"},
+	} {
+		_, err := parseGraphQL(tc.src)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseGraphQL(%q): expected an error containing %q, got %v", tc.src, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,615 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// GraphQL type kinds, as reported by introspection
+const (
+	gqlKindScalar = "SCALAR"
+	gqlKindObject = "OBJECT"
+	gqlKindInput  = "INPUT_OBJECT"
+	gqlKindEnum   = "ENUM"
+)
+
+// Built-in and custom GraphQL scalars
+const (
+	gqlString    = "String"
+	gqlInt       = "Int"
+	gqlFloat     = "Float"
+	gqlBoolean   = "Boolean"
+	gqlInt64     = "Int64"
+	gqlBytes     = "Bytes"
+	gqlJSON      = "JSON"
+	gqlTimestamp = "Timestamp"
+	gqlDuration  = "Duration"
+)
+
+// gqlEmptyField is the placeholder field of types without fields, which
+// GraphQL does not allow.
+const gqlEmptyField = "_"
+
+// gqlCustomScalars describes the scalars added for protobuf types.
+var gqlCustomScalars = map[string]string{
+	gqlInt64:     "A 64-bit or unsigned integer, encoded as a JSON number or string.",
+	gqlBytes:     "Binary data, encoded as a base64 string.",
+	gqlJSON:      "An arbitrary JSON value, used for maps and google.protobuf.Struct, Value, ListValue, and Any.",
+	gqlTimestamp: "A point in time, encoded as an RFC 3339 string.",
+	gqlDuration:  `A duration, encoded as a string of seconds with an "s" suffix, e.g. "1.5s".`,
+}
+
+// gqlWellKnownScalars maps well-known types to the scalars they are encoded as.
+var gqlWellKnownScalars = map[string]string{
+	"google.protobuf.Timestamp":   gqlTimestamp,
+	"google.protobuf.Duration":    gqlDuration,
+	"google.protobuf.Struct":      gqlJSON,
+	"google.protobuf.Value":       gqlJSON,
+	"google.protobuf.ListValue":   gqlJSON,
+	"google.protobuf.Any":         gqlJSON,
+	"google.protobuf.FieldMask":   gqlString,
+	"google.protobuf.StringValue": gqlString,
+	"google.protobuf.BoolValue":   gqlBoolean,
+	"google.protobuf.Int32Value":  gqlInt,
+	"google.protobuf.UInt32Value": gqlInt64,
+	"google.protobuf.Int64Value":  gqlInt64,
+	"google.protobuf.UInt64Value": gqlInt64,
+	"google.protobuf.FloatValue":  gqlFloat,
+	"google.protobuf.DoubleValue": gqlFloat,
+	"google.protobuf.BytesValue":  gqlBytes,
+}
+
+// gqlQueryPrefixes start the names of unary methods exposed as queries.
+var gqlQueryPrefixes = []string{"Get", "List", "Search", "Find", "Query", "Count", "Lookup", "Check", "Describe", "Fetch", "BatchGet"}
+
+// gqlSchema is the GraphQL schema of the services of a gateway.
+type gqlSchema struct {
+	types map[string]*gqlType
+	// names lists the type names in declaration order
+	names        []string
+	query        *gqlType
+	mutation     *gqlType // nil without mutations
+	subscription *gqlType // nil without subscriptions
+
+	introspectOnce sync.Once
+	introspected   map[string]any
+}
+
+// gqlType is a named GraphQL type.
+type gqlType struct {
+	name        string
+	kind        string
+	description string
+	fields      []*gqlField
+	values      []gqlEnumValue
+}
+
+// gqlEnumValue is a value of an enum type.
+type gqlEnumValue struct {
+	name   string
+	number int32
+}
+
+// gqlField is a field of an object or input type, or an argument.
+type gqlField struct {
+	name        string
+	description string
+	deprecated  bool
+	typ         gqlTypeRef
+	// protoName is the name of the field in requests, and jsonNames the
+	// names it may have in responses
+	protoName string
+	jsonNames []string
+
+	// Root fields call a method with their arguments
+	args      []*gqlField
+	procedure string
+	streaming bool
+}
+
+// gqlTypeRef refers to a possibly wrapped named type.
+type gqlTypeRef struct {
+	name        string
+	nonNull     bool
+	list        bool
+	elemNonNull bool
+}
+
+// String renders the reference in SDL.
+func (r gqlTypeRef) String() string {
+	s := r.name
+	if r.list {
+		if r.elemNonNull {
+			s += "!"
+		}
+		s = "[" + s + "]"
+	}
+	if r.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// field returns the field named name.
+func (t *gqlType) field(name string) *gqlField {
+	for _, field := range t.fields {
+		if field.name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// gqlSchemaBuilder converts descriptors into a GraphQL schema.
+type gqlSchemaBuilder struct {
+	schema   *gqlSchema
+	messages map[string]*descriptorpb.DescriptorProto
+	enums    map[string]*descriptorpb.EnumDescriptorProto
+	comments map[string]string // Leading comments by full name
+	// typeNames holds the GraphQL name of each message and enum
+	typeNames map[string]string
+}
+
+// newGraphQLSchema builds the GraphQL schema of the services in fdset.
+// Unary methods become queries if their names start with a read verb such as
+// Get or List, or they are marked free of side effects, and mutations
+// otherwise. Server-streaming methods become subscriptions; client and bidi
+// streams are not exposed.
+func newGraphQLSchema(fdset *descriptorpb.FileDescriptorSet) (*gqlSchema, error) {
+	b := &gqlSchemaBuilder{
+		schema:    &gqlSchema{types: make(map[string]*gqlType)},
+		messages:  make(map[string]*descriptorpb.DescriptorProto),
+		enums:     make(map[string]*descriptorpb.EnumDescriptorProto),
+		comments:  make(map[string]string),
+		typeNames: make(map[string]string),
+	}
+	for _, file := range fdset.GetFile() {
+		comments := indexComments(file.GetSourceCodeInfo())
+		for i, msg := range file.MessageType {
+			b.indexMessage(qualifiedName(file.GetPackage(), msg.GetName()), msg, comments, []int32{pathFileMessageType, pathIndex(i)})
+		}
+		for i, enum := range file.EnumType {
+			b.indexEnum(qualifiedName(file.GetPackage(), enum.GetName()), enum, comments, []int32{pathFileEnumType, pathIndex(i)})
+		}
+	}
+	b.nameTypes()
+
+	for _, name := range []string{gqlString, gqlInt, gqlFloat, gqlBoolean} {
+		b.add(&gqlType{name: name, kind: gqlKindScalar})
+	}
+	query := &gqlType{name: "Query", kind: gqlKindObject}
+	mutation := &gqlType{name: "Mutation", kind: gqlKindObject}
+	subscription := &gqlType{name: "Subscription", kind: gqlKindObject}
+
+	var roots []*gqlField
+	rootKinds := make(map[*gqlField]*gqlType)
+	for _, file := range fdset.GetFile() {
+		comments := indexComments(file.GetSourceCodeInfo())
+		for i, svc := range file.Service {
+			serviceName := qualifiedName(file.GetPackage(), svc.GetName())
+			for j, method := range svc.Method {
+				if method.GetClientStreaming() {
+					continue
+				}
+				field, err := b.rootField(serviceName, method)
+				if err != nil {
+					return nil, err
+				}
+				field.description = comments.leading([]int32{pathFileService, pathIndex(i), pathServiceMethod, pathIndex(j)})
+				roots = append(roots, field)
+				switch {
+				case method.GetServerStreaming():
+					rootKinds[field] = subscription
+				case isGraphQLQuery(method):
+					rootKinds[field] = query
+				default:
+					rootKinds[field] = mutation
+				}
+			}
+		}
+	}
+
+	// Methods of the same name in several services are qualified
+	counts := make(map[string]int)
+	for _, field := range roots {
+		counts[field.name]++
+	}
+	for _, field := range roots {
+		if counts[field.name] > 1 {
+			service, method, _ := strings.Cut(strings.TrimPrefix(field.procedure, "/"), "/")
+			field.name = strings.ReplaceAll(service, ".", "_") + "_" + method
+		}
+		root := rootKinds[field]
+		root.fields = append(root.fields, field)
+	}
+
+	if len(query.fields) == 0 {
+		query.fields = []*gqlField{{name: gqlEmptyField, typ: gqlTypeRef{name: gqlBoolean}}}
+	}
+	b.schema.query = b.add(query)
+	if len(mutation.fields) > 0 {
+		b.schema.mutation = b.add(mutation)
+	}
+	if len(subscription.fields) > 0 {
+		b.schema.subscription = b.add(subscription)
+	}
+	return b.schema, nil
+}
+
+// isGraphQLQuery reports whether a unary method is exposed as a query.
+func isGraphQLQuery(method *descriptorpb.MethodDescriptorProto) bool {
+	if method.GetOptions().GetIdempotencyLevel() == descriptorpb.MethodOptions_NO_SIDE_EFFECTS {
+		return true
+	}
+	name := method.GetName()
+	for _, prefix := range gqlQueryPrefixes {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if ok && (rest == "" || unicode.IsUpper(rune(rest[0]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexMessage records a message, its nested types, and their comments.
+func (b *gqlSchemaBuilder) indexMessage(fullName string, msg *descriptorpb.DescriptorProto, comments sourceComments, path []int32) {
+	b.messages[fullName] = msg
+	b.comments[fullName] = comments.leading(path)
+	for i := range msg.Field {
+		b.comments[fullName+"#"+msg.Field[i].GetName()] = comments.leading(appendPath(path, pathMessageField, pathIndex(i)))
+	}
+	for i, nested := range msg.NestedType {
+		b.indexMessage(fullName+"."+nested.GetName(), nested, comments, appendPath(path, pathMessageNestedType, pathIndex(i)))
+	}
+	for i, enum := range msg.EnumType {
+		b.indexEnum(fullName+"."+enum.GetName(), enum, comments, appendPath(path, pathMessageEnumType, pathIndex(i)))
+	}
+}
+
+// indexEnum records an enum and its comment.
+func (b *gqlSchemaBuilder) indexEnum(fullName string, enum *descriptorpb.EnumDescriptorProto, comments sourceComments, path []int32) {
+	b.enums[fullName] = enum
+	b.comments[fullName] = comments.leading(path)
+}
+
+// nameTypes assigns GraphQL names to messages and enums: their simple names,
+// or their full names with underscores where simple names clash.
+func (b *gqlSchemaBuilder) nameTypes() {
+	fullNames := make([]string, 0, len(b.messages)+len(b.enums))
+	for name := range b.messages {
+		fullNames = append(fullNames, name)
+	}
+	for name := range b.enums {
+		fullNames = append(fullNames, name)
+	}
+	sort.Strings(fullNames)
+
+	reserved := map[string]bool{"Query": true, "Mutation": true, "Subscription": true}
+	for _, scalar := range []string{gqlString, gqlInt, gqlFloat, gqlBoolean, "ID"} {
+		reserved[scalar] = true
+	}
+	for scalar := range gqlCustomScalars {
+		reserved[scalar] = true
+	}
+
+	counts := make(map[string]int)
+	for _, fullName := range fullNames {
+		counts[simpleName(fullName)]++
+	}
+	for _, fullName := range fullNames {
+		name := simpleName(fullName)
+		if counts[name] > 1 || reserved[name] || reserved[strings.TrimSuffix(name, "Input")] {
+			name = strings.ReplaceAll(fullName, ".", "_")
+		}
+		b.typeNames[fullName] = name
+	}
+}
+
+// simpleName returns the last element of a full name.
+func simpleName(fullName string) string {
+	return fullName[strings.LastIndex(fullName, ".")+1:]
+}
+
+// add adds a type to the schema once and returns the added type.
+func (b *gqlSchemaBuilder) add(t *gqlType) *gqlType {
+	if existing, ok := b.schema.types[t.name]; ok {
+		return existing
+	}
+	b.schema.types[t.name] = t
+	b.schema.names = append(b.schema.names, t.name)
+	return t
+}
+
+// rootField returns the root field calling method, with the fields of its
+// input as arguments.
+func (b *gqlSchemaBuilder) rootField(serviceName string, method *descriptorpb.MethodDescriptorProto) (*gqlField, error) {
+	output, err := b.messageRef(strings.TrimPrefix(method.GetOutputType(), "."), false)
+	if err != nil {
+		return nil, err
+	}
+	field := &gqlField{
+		name:       lowerFirst(method.GetName()),
+		deprecated: method.GetOptions().GetDeprecated(),
+		typ:        output,
+		procedure:  "/" + serviceName + "/" + method.GetName(),
+		streaming:  method.GetServerStreaming(),
+	}
+
+	inputName := strings.TrimPrefix(method.GetInputType(), ".")
+	input, ok := b.messages[inputName]
+	if !ok {
+		return nil, fmt.Errorf("graphql: unknown input type %s of %s", inputName, field.procedure)
+	}
+	if _, wellKnown := gqlWellKnownScalars[inputName]; !wellKnown {
+		if field.args, err = b.fields(inputName, input, true); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// messageRef returns a reference to the type of a message, adding it and the
+// types it uses to the schema.
+func (b *gqlSchemaBuilder) messageRef(fullName string, input bool) (gqlTypeRef, error) {
+	if scalar, ok := gqlWellKnownScalars[fullName]; ok {
+		return gqlTypeRef{name: b.scalar(scalar)}, nil
+	}
+	msg, ok := b.messages[fullName]
+	if !ok {
+		return gqlTypeRef{}, fmt.Errorf("graphql: unknown message %s", fullName)
+	}
+
+	name, kind := b.typeNames[fullName], gqlKindObject
+	if input {
+		name, kind = name+"Input", gqlKindInput
+	}
+	if _, exists := b.schema.types[name]; exists {
+		return gqlTypeRef{name: name}, nil
+	}
+	t := b.add(&gqlType{name: name, kind: kind, description: b.comments[fullName]})
+	fields, err := b.fields(fullName, msg, input)
+	if err != nil {
+		return gqlTypeRef{}, err
+	}
+	if len(fields) == 0 {
+		fields = []*gqlField{{name: gqlEmptyField, typ: gqlTypeRef{name: gqlBoolean}}}
+	}
+	t.fields = fields
+	return gqlTypeRef{name: name}, nil
+}
+
+// fields converts the fields of a message.
+func (b *gqlSchemaBuilder) fields(fullName string, msg *descriptorpb.DescriptorProto, input bool) ([]*gqlField, error) {
+	fields := make([]*gqlField, 0, len(msg.Field))
+	for _, f := range msg.Field {
+		typ, err := b.fieldType(f, input)
+		if err != nil {
+			return nil, err
+		}
+		name := f.GetJsonName()
+		if name == "" {
+			name = lowerCamel(f.GetName())
+		}
+		fields = append(fields, &gqlField{
+			name:        name,
+			description: b.comments[fullName+"#"+f.GetName()],
+			deprecated:  f.GetOptions().GetDeprecated(),
+			typ:         typ,
+			protoName:   f.GetName(),
+			jsonNames:   uniqueStrings(f.GetName(), f.GetJsonName(), lowerCamel(f.GetName())),
+		})
+	}
+	return fields, nil
+}
+
+// fieldType returns the type of a field. Output scalars, enums, and lists are
+// non-null since protobuf encodes their defaults by omission; input fields
+// are all optional.
+func (b *gqlSchemaBuilder) fieldType(f *descriptorpb.FieldDescriptorProto, input bool) (gqlTypeRef, error) {
+	typeName := strings.TrimPrefix(f.GetTypeName(), ".")
+	repeated := f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	if msg, ok := b.messages[typeName]; ok && repeated && msg.GetOptions().GetMapEntry() {
+		return gqlTypeRef{name: b.scalar(gqlJSON)}, nil
+	}
+
+	var ref gqlTypeRef
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		var err error
+		if ref, err = b.messageRef(typeName, input); err != nil {
+			return gqlTypeRef{}, err
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		ref = gqlTypeRef{name: b.enum(typeName), nonNull: !input}
+	default:
+		ref = gqlTypeRef{name: b.scalar(scalarForField(f.GetType())), nonNull: !input}
+	}
+	if f.GetProto3Optional() {
+		ref.nonNull = false
+	}
+	if repeated {
+		return gqlTypeRef{name: ref.name, list: true, elemNonNull: true, nonNull: !input}, nil
+	}
+	return ref, nil
+}
+
+// scalarForField returns the scalar encoding a protobuf scalar type.
+func scalarForField(t descriptorpb.FieldDescriptorProto_Type) string {
+	switch t { //nolint:exhaustive // Other types are 64-bit or unsigned integers
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return gqlString
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return gqlBoolean
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return gqlBytes
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return gqlFloat
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return gqlInt
+	default:
+		return gqlInt64
+	}
+}
+
+// scalar adds a scalar type and returns its name.
+func (b *gqlSchemaBuilder) scalar(name string) string {
+	b.add(&gqlType{name: name, kind: gqlKindScalar, description: gqlCustomScalars[name]})
+	return name
+}
+
+// enum adds the type of an enum and returns its name.
+func (b *gqlSchemaBuilder) enum(fullName string) string {
+	enum, ok := b.enums[fullName]
+	if !ok {
+		return b.scalar(gqlString)
+	}
+	name := b.typeNames[fullName]
+	if _, exists := b.schema.types[name]; exists {
+		return name
+	}
+	t := &gqlType{name: name, kind: gqlKindEnum, description: b.comments[fullName]}
+	for _, value := range enum.Value {
+		t.values = append(t.values, gqlEnumValue{name: value.GetName(), number: value.GetNumber()})
+	}
+	b.add(t)
+	return name
+}
+
+// SDL renders the schema in the GraphQL schema definition language.
+func (s *gqlSchema) SDL() string {
+	var sb strings.Builder
+	sb.WriteString("schema {\n  query: Query\n")
+	if s.mutation != nil {
+		sb.WriteString("  mutation: Mutation\n")
+	}
+	if s.subscription != nil {
+		sb.WriteString("  subscription: Subscription\n")
+	}
+	sb.WriteString("}\n")
+
+	for _, root := range []*gqlType{s.query, s.mutation, s.subscription} {
+		if root != nil {
+			writeGraphQLType(&sb, root)
+		}
+	}
+	names := append([]string(nil), s.names...)
+	sort.Strings(names)
+	for _, name := range names {
+		t := s.types[name]
+		if t == s.query || t == s.mutation || t == s.subscription {
+			continue
+		}
+		if t.kind == gqlKindScalar && gqlCustomScalars[name] == "" {
+			continue // Built in
+		}
+		writeGraphQLType(&sb, t)
+	}
+	return sb.String()
+}
+
+// writeGraphQLType writes the definition of a type.
+func writeGraphQLType(sb *strings.Builder, t *gqlType) {
+	sb.WriteString("\n")
+	writeGraphQLDescription(sb, t.description, "")
+	switch t.kind {
+	case gqlKindScalar:
+		fmt.Fprintf(sb, "scalar %s\n", t.name)
+	case gqlKindEnum:
+		fmt.Fprintf(sb, "enum %s {\n", t.name)
+		for _, value := range t.values {
+			fmt.Fprintf(sb, "  %s\n", value.name)
+		}
+		sb.WriteString("}\n")
+	default:
+		keyword := "type"
+		if t.kind == gqlKindInput {
+			keyword = "input"
+		}
+		fmt.Fprintf(sb, "%s %s {\n", keyword, t.name)
+		for _, field := range t.fields {
+			writeGraphQLDescription(sb, field.description, "  ")
+			sb.WriteString("  " + field.name)
+			if len(field.args) > 0 {
+				args := make([]string, len(field.args))
+				for i, arg := range field.args {
+					args[i] = arg.name + ": " + arg.typ.String()
+				}
+				sb.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			sb.WriteString(": " + field.typ.String())
+			if field.deprecated {
+				sb.WriteString(" @deprecated")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("}\n")
+	}
+}
+
+// writeGraphQLDescription writes a description as a block string.
+func writeGraphQLDescription(sb *strings.Builder, description, indent string) {
+	if description == "" {
+		return
+	}
+	description = strings.ReplaceAll(description, `"""`, `\"""`)
+	fmt.Fprintf(sb, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(sb, "%s%s\n", indent, strings.TrimRight(line, " "))
+	}
+	fmt.Fprintf(sb, "%s\"\"\"\n", indent)
+}
+
+// lowerFirst lowercases the first letter of s.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// lowerCamel converts a snake_case name to lowerCamelCase as protoc derives
+// JSON names.
+func lowerCamel(s string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range s {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// uniqueStrings returns the distinct non-empty values in order.
+func uniqueStrings(values ...string) []string {
+	var unique []string
+	for _, value := range values {
+		if value != "" && !containsString(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
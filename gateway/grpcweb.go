@@ -13,6 +13,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
 )
 
 // Constants
@@ -72,14 +74,14 @@ func (h *grpcWebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // processRequest handles the main request processing logic
 func (h *grpcWebHandler) processRequest(w http.ResponseWriter, r *http.Request, frameReader *grpcWebFrameReader, frameWriter *grpcWebFrameWriter, codec *grpcWebCodec) {
 	// Read the request message
-	requestData, err := h.readRequestMessage(frameReader)
+	requestData, compressed, err := h.readRequestMessage(frameReader)
 	if err != nil {
 		h.writeErrorResponse(frameWriter, err)
 		return
 	}
 
 	// Create a new request for the underlying gRPC handler
-	grpcReq, err := h.createGRPCRequest(r, requestData, codec)
+	grpcReq, err := h.createGRPCRequest(r, requestData, compressed, codec)
 	if err != nil {
 		h.writeErrorResponse(frameWriter, err)
 		return
@@ -108,6 +110,18 @@ func (h *grpcWebHandler) handleResponse(w http.ResponseWriter, frameWriter *grpc
 		return
 	}
 
+	// Streams are written as gRPC frames, which are gRPC-Web data frames, and
+	// end with their status in trailers
+	if isGRPCContentType(recorder.Header().Get("Content-Type")) {
+		h.copyResponseHeaders(w.Header(), recorder.Header())
+		w.WriteHeader(http.StatusOK)
+		if err := frameWriter.writeFrames(recorder.body.Bytes()); err != nil {
+			return
+		}
+		_ = frameWriter.writeTrailerFrame(formatTrailerFrame(h.prepareTrailers(recorder)))
+		return
+	}
+
 	// Check if the handler returned an error via grpc-status header
 	if grpcStatus := recorder.Header().Get("grpc-status"); grpcStatus != "" && grpcStatus != "0" {
 		h.writeResponseWithError(frameWriter, recorder)
@@ -121,7 +135,14 @@ func (h *grpcWebHandler) handleResponse(w http.ResponseWriter, frameWriter *grpc
 		}
 	}
 
-	// Write HTTP status before frames
+	// Other failed responses have the status gRPC clients give them
+	if recorder.status != http.StatusOK {
+		h.writeErrorStatus(frameWriter, grpcCode(grpcutil.CodeForHTTPStatus(recorder.status)), http.StatusText(recorder.status))
+		return
+	}
+
+	// Write HTTP status and headers before frames
+	h.copyResponseHeaders(w.Header(), recorder.Header())
 	w.WriteHeader(http.StatusOK)
 
 	// Write the response
@@ -156,9 +177,9 @@ func (h *grpcWebHandler) handleJSONError(frameWriter *grpcWebFrameWriter, bodyBy
 
 	// Convert to gRPC-Web error
 	code := h.parseErrorCode(errorResp.Code, errorResp.Error, errorResp.Message)
-	message := errorResp.Error
+	message := errorResp.Message
 	if message == "" {
-		message = errorResp.Message
+		message = errorResp.Error
 	}
 
 	h.writeErrorStatus(frameWriter, code, message)
@@ -167,8 +188,8 @@ func (h *grpcWebHandler) handleJSONError(frameWriter *grpcWebFrameWriter, bodyBy
 
 // parseErrorCode converts string error codes to gRPC codes
 func (h *grpcWebHandler) parseErrorCode(codeStr, errorMsg, message string) codes.Code {
-	if code, ok := stringToGRPCCode[codeStr]; ok {
-		return code
+	if codeStr != "" {
+		return grpcCode(codeStr)
 	}
 
 	// If there's no code but we have an error message, try to infer from message
@@ -185,29 +206,15 @@ func (h *grpcWebHandler) parseErrorCode(codeStr, errorMsg, message string) codes
 	return codes.Unknown
 }
 
-// stringToGRPCCode maps string codes to gRPC codes
-var stringToGRPCCode = map[string]codes.Code{
-	"canceled":            codes.Canceled,
-	"unknown":             codes.Unknown,
-	"invalid_argument":    codes.InvalidArgument,
-	"deadline_exceeded":   codes.DeadlineExceeded,
-	"not_found":           codes.NotFound,
-	"already_exists":      codes.AlreadyExists,
-	"permission_denied":   codes.PermissionDenied,
-	"resource_exhausted":  codes.ResourceExhausted,
-	"failed_precondition": codes.FailedPrecondition,
-	"aborted":             codes.Aborted,
-	"out_of_range":        codes.OutOfRange,
-	"unimplemented":       codes.Unimplemented,
-	"internal":            codes.Internal,
-	"unavailable":         codes.Unavailable,
-	"data_loss":           codes.DataLoss,
-	"unauthenticated":     codes.Unauthenticated,
-}
-
-// readRequestMessage reads the request message from gRPC-Web frames
-func (h *grpcWebHandler) readRequestMessage(reader *grpcWebFrameReader) ([]byte, error) {
-	var requestData []byte
+// grpcCode returns the gRPC code of an error code such as "not_found".
+func grpcCode(code string) codes.Code {
+	return codes.Code(grpcutil.GRPCStatus(code)) //nolint:gosec // statuses range from 0 to 16
+}
+
+// readRequestMessage reads the request message from gRPC-Web frames, and
+// whether it is compressed with the grpc-encoding of the request
+func (h *grpcWebHandler) readRequestMessage(reader *grpcWebFrameReader) (requestData []byte, compressed bool, err error) {
+	frames := 0
 
 	for {
 		frame, err := reader.readFrame()
@@ -215,22 +222,34 @@ func (h *grpcWebHandler) readRequestMessage(reader *grpcWebFrameReader) ([]byte,
 			if err == io.EOF {
 				break
 			}
-			return nil, status.Errorf(codes.InvalidArgument, "failed to read frame: %v", err)
+			return nil, false, status.Errorf(codes.InvalidArgument, "failed to read frame: %v", err)
 		}
 
 		// We only expect data frames in the request
 		if frame.isTrailer() {
-			return nil, status.Error(codes.InvalidArgument, "unexpected trailer frame in request")
+			return nil, false, status.Error(codes.InvalidArgument, "unexpected trailer frame in request")
+		}
+		if frames > 0 && frame.isCompressed() != compressed {
+			return nil, false, status.Error(codes.InvalidArgument, "compressed and uncompressed frames in request")
 		}
 
+		compressed = frame.isCompressed()
 		requestData = append(requestData, frame.payload...)
+		frames++
 	}
 
-	return requestData, nil
+	return requestData, compressed, nil
 }
 
-// createGRPCRequest creates a new HTTP request for the underlying gRPC handler
-func (h *grpcWebHandler) createGRPCRequest(originalReq *http.Request, requestData []byte, codec *grpcWebCodec) (*http.Request, error) {
+// createGRPCRequest creates a new HTTP request for the underlying gRPC handler.
+// A compressed message is passed with its grpc-encoding as Content-Encoding,
+// so the handler decompresses it within its limits.
+func (h *grpcWebHandler) createGRPCRequest(originalReq *http.Request, requestData []byte, compressed bool, codec *grpcWebCodec) (*http.Request, error) {
+	encoding := originalReq.Header.Get("Grpc-Encoding")
+	if compressed && (encoding == "" || encoding == "identity") {
+		return nil, status.Error(codes.Internal, "compressed message without grpc-encoding")
+	}
+
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(originalReq.Context(), h.timeout)
 	// Don't defer cancel here, let the caller handle it
@@ -264,11 +283,17 @@ func (h *grpcWebHandler) createGRPCRequest(originalReq *http.Request, requestDat
 		case "x-user-agent":
 			// Convert X-User-Agent to User-Agent for gRPC
 			req.Header.Set("User-Agent", values[0])
+		case "accept-encoding", "content-encoding":
+			// Messages are compressed per frame, not per HTTP body
 		default:
 			req.Header[key] = values
 		}
 	}
 
+	if compressed {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
 	// Set content length
 	req.ContentLength = int64(len(requestData))
 
@@ -325,35 +350,61 @@ func (h *grpcWebHandler) extractGRPCStatus(recorder *responseRecorder) (statusCo
 	return statusCode, statusMsg
 }
 
-// copyHeadersToTrailers copies appropriate headers to trailers
+// copyHeadersToTrailers copies the trailers of the gRPC handler, which share
+// the header map of the recorder with its headers: grpc- fields other than the
+// status, fields declared in the Trailer header, and fields set with the
+// http.TrailerPrefix after the body was written.
 func (h *grpcWebHandler) copyHeadersToTrailers(headers, trailers http.Header) {
-	// Copy grpc-prefixed headers (except status and message)
+	declared := declaredTrailers(headers)
 	for key, values := range headers {
-		if h.shouldCopyAsGRPCTrailer(key) {
+		name, prefixed := strings.CutPrefix(key, http.TrailerPrefix)
+		switch {
+		case prefixed:
+			for _, value := range values {
+				trailers.Add(name, value)
+			}
+		case h.shouldCopyAsGRPCTrailer(key), declared[http.CanonicalHeaderKey(key)]:
 			trailers[key] = values
 		}
 	}
+}
 
-	// Copy custom headers as trailers
+// copyResponseHeaders copies the response headers of the gRPC handler, all
+// fields but trailers and the ones the gRPC-Web response sets itself.
+func (h *grpcWebHandler) copyResponseHeaders(dst, headers http.Header) {
+	declared := declaredTrailers(headers)
 	for key, values := range headers {
-		if h.shouldCopyAsCustomTrailer(key) {
-			for _, value := range values {
-				trailers.Add(key, value)
+		if strings.HasPrefix(key, http.TrailerPrefix) || declared[http.CanonicalHeaderKey(key)] || !h.shouldCopyAsCustomHeader(key) {
+			continue
+		}
+		dst[key] = values
+	}
+}
+
+// declaredTrailers returns the fields declared in the Trailer header.
+func declaredTrailers(headers http.Header) map[string]bool {
+	declared := make(map[string]bool)
+	for _, value := range headers.Values("Trailer") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				declared[http.CanonicalHeaderKey(key)] = true
 			}
 		}
 	}
+	return declared
 }
 
 // shouldCopyAsGRPCTrailer checks if a header should be copied as a gRPC trailer
 func (h *grpcWebHandler) shouldCopyAsGRPCTrailer(key string) bool {
 	lowerKey := strings.ToLower(key)
 	return strings.HasPrefix(lowerKey, "grpc-") &&
-		key != "grpc-status" &&
-		key != "grpc-message"
+		lowerKey != "grpc-status" &&
+		lowerKey != "grpc-message"
 }
 
-// shouldCopyAsCustomTrailer checks if a header should be copied as a custom trailer
-func (h *grpcWebHandler) shouldCopyAsCustomTrailer(key string) bool {
+// shouldCopyAsCustomHeader checks if a header of the gRPC handler is a
+// custom header of the response
+func (h *grpcWebHandler) shouldCopyAsCustomHeader(key string) bool {
 	lowerKey := strings.ToLower(key)
 
 	// Skip grpc-specific headers
@@ -363,10 +414,12 @@ func (h *grpcWebHandler) shouldCopyAsCustomTrailer(key string) bool {
 
 	// Skip standard HTTP headers
 	standardHeaders := map[string]bool{
-		headerContentType: true,
-		"content-length":  true,
-		"date":            true,
-		"server":          true,
+		headerContentType:  true,
+		"content-length":   true,
+		"content-encoding": true,
+		"trailer":          true,
+		"date":             true,
+		"server":           true,
 	}
 
 	return !standardHeaders[lowerKey]
@@ -383,7 +436,7 @@ func (h *grpcWebHandler) writeErrorResponse(writer *grpcWebFrameWriter, err erro
 	// Create trailers with error status
 	trailers := make(http.Header)
 	trailers.Set("grpc-status", strconv.Itoa(int(st.Code())))
-	trailers.Set("grpc-message", st.Message())
+	trailers.Set("grpc-message", grpcutil.EncodeMessage(st.Message()))
 
 	// Write empty data frame followed by trailer
 	_ = writer.writeDataFrame(nil)
@@ -407,7 +460,7 @@ func (h *grpcWebHandler) writeErrorStatus(writer *grpcWebFrameWriter, code codes
 	// Create trailers with error status
 	trailers := make(http.Header)
 	trailers.Set("grpc-status", strconv.Itoa(int(code)))
-	trailers.Set("grpc-message", message)
+	trailers.Set("grpc-message", grpcutil.EncodeMessage(message))
 
 	// Write empty data frame followed by trailer
 	_ = writer.writeDataFrame(nil)
@@ -427,7 +480,7 @@ func (h *grpcWebHandler) writeResponseWithError(writer *grpcWebFrameWriter, reco
 	}
 
 	if grpcMessage := recorder.Header().Get("grpc-message"); grpcMessage != "" {
-		statusMsg = grpcMessage
+		statusMsg = grpcutil.DecodeMessage(grpcMessage)
 	}
 
 	// Write empty data frame and trailers
@@ -461,6 +514,11 @@ func (r *responseRecorder) WriteHeader(statusCode int) {
 	r.status = statusCode
 }
 
+// isGRPCContentType reports whether a content type is a gRPC one, not gRPC-Web.
+func isGRPCContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/grpc") && !strings.HasPrefix(contentType, "application/grpc-web")
+}
+
 // isGRPCWeb checks if the request is a gRPC-Web request
 func isGRPCWeb(r *http.Request) bool {
 	contentType := r.Header.Get("Content-Type")
@@ -20,6 +20,8 @@ const (
 	grpcWebMessageFlagData = 0x00
 	// grpcWebMessageFlagTrailer indicates a trailer frame
 	grpcWebMessageFlagTrailer = 0x80
+	// grpcWebMessageFlagCompressed indicates a data frame compressed with the grpc-encoding
+	grpcWebMessageFlagCompressed = 0x01
 	// grpcWebFrameHeaderSize is the size of gRPC-Web frame header (1 flag + 4 length)
 	grpcWebFrameHeaderSize = 5
 )
@@ -51,6 +53,11 @@ func (f *grpcWebFrame) isTrailer() bool {
 	return f.flag == grpcWebMessageFlagTrailer
 }
 
+// isCompressed returns true if the payload is compressed
+func (f *grpcWebFrame) isCompressed() bool {
+	return f.flag&grpcWebMessageFlagCompressed != 0
+}
+
 // grpcWebFrameWriter writes gRPC-Web frames
 type grpcWebFrameWriter struct {
 	w              io.Writer
@@ -103,6 +110,15 @@ func (fw *grpcWebFrameWriter) writeDataFrame(data []byte) error {
 	})
 }
 
+// writeFrames writes data frames that are already framed, such as the frames
+// of a gRPC response.
+func (fw *grpcWebFrameWriter) writeFrames(frames []byte) error {
+	if _, err := fw.w.Write(frames); err != nil {
+		return fmt.Errorf("failed to write frames: %w", err)
+	}
+	return nil
+}
+
 // writeTrailerFrame writes a trailer frame
 func (fw *grpcWebFrameWriter) writeTrailerFrame(trailers []byte) error {
 	return fw.writeFrame(&grpcWebFrame{
@@ -332,11 +332,88 @@ func TestGRPCWebHandler(t *testing.T) {
 	}
 }
 
+func TestGRPCWebMetadataAndCompression(t *testing.T) {
+	var gotEncoding string
+	var gotBody []byte
+	handler := newGRPCWebHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("X-Custom", "header")
+		w.Header().Set("Trailer", "x-late")
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		_, _ = w.Write([]byte("response data"))
+		w.Header().Set("x-late", "trailer")
+		w.Header().Set(http.TrailerPrefix+"x-undeclared", "trailer")
+	}), 0)
+
+	call := func(t *testing.T, flag byte, encoding string) (*httptest.ResponseRecorder, http.Header) {
+		t.Helper()
+		var body bytes.Buffer
+		writer := newGRPCWebFrameWriter(&body, grpcWebModeBinary)
+		if err := writer.writeFrame(&grpcWebFrame{flag: flag, payload: []byte("compressed")}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/test.Service/Method", &body)
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("Accept-Encoding", "gzip")
+		if encoding != "" {
+			req.Header.Set("Grpc-Encoding", encoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		reader := newGRPCWebFrameReader(rec.Body, grpcWebModeBinary)
+		for {
+			frame, err := reader.readFrame()
+			if err != nil {
+				t.Fatalf("failed to read trailer frame: %v", err)
+			}
+			if frame.isTrailer() {
+				return rec, parseTrailerFrame(frame.payload)
+			}
+		}
+	}
+
+	t.Run("headers and trailers", func(t *testing.T) {
+		rec, trailers := call(t, grpcWebMessageFlagData, "")
+		if got := rec.Header().Get("X-Custom"); got != "header" {
+			t.Errorf("expected the custom header in the response headers, got %q", got)
+		}
+		if got := trailers.Get("X-Custom"); got != "" {
+			t.Errorf("expected the custom header not to be a trailer, got %q", got)
+		}
+		for _, key := range []string{"x-late", "x-undeclared"} {
+			if got := trailers.Get(key); got != "trailer" {
+				t.Errorf("expected trailer %s, got %q", key, got)
+			}
+			if got := rec.Header().Get(key); got != "" {
+				t.Errorf("expected trailer %s not to be a header, got %q", key, got)
+			}
+		}
+	})
+
+	t.Run("compressed messages", func(t *testing.T) {
+		call(t, grpcWebMessageFlagCompressed, "gzip")
+		if gotEncoding != "gzip" || string(gotBody) != "compressed" {
+			t.Errorf("expected the message with Content-Encoding gzip, got %q with %q", gotBody, gotEncoding)
+		}
+		call(t, grpcWebMessageFlagData, "gzip")
+		if gotEncoding != "" {
+			t.Errorf("expected an uncompressed message without Content-Encoding, got %q", gotEncoding)
+		}
+		gotBody = nil
+		_, trailers := call(t, grpcWebMessageFlagCompressed, "")
+		if trailers.Get("grpc-status") != strconv.Itoa(int(codes.Internal)) || gotBody != nil {
+			t.Errorf("expected a compressed message without grpc-encoding to fail, got %v", trailers)
+		}
+	})
+}
+
 func TestGRPCWebErrorHandling(t *testing.T) {
 	// Create a handler that returns an error
 	grpcHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("grpc-status", strconv.Itoa(int(codes.NotFound)))
-		w.Header().Set("grpc-message", "resource not found")
+		w.Header().Set("grpc-message", "resource 100%25 not found")
 		// Don't write body for error response
 	})
 
@@ -376,6 +453,10 @@ func TestGRPCWebErrorHandling(t *testing.T) {
 	if grpcStatus := trailers.Get("grpc-status"); grpcStatus != strconv.Itoa(int(codes.NotFound)) {
 		t.Errorf("expected NotFound status, got %q", grpcStatus)
 	}
+	// The percent-encoded message is passed on, not encoded twice
+	if message := trailers.Get("grpc-message"); message != "resource 100%25 not found" {
+		t.Errorf("expected encoded message, got %q", message)
+	}
 }
 
 func TestGRPCWebBase64Encoding(t *testing.T) {
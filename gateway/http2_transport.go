@@ -2,25 +2,42 @@
 package gateway
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
 // HTTP2Transport wraps an HTTP/2 server with keepalive support.
+//
+// Keepalive parameters make the server send PING frames to detect dead peers
+// and bound the idle time and age of connections. Connections past their
+// maximum age are closed once idle; the next response on a busy one makes the
+// HTTP/2 server send a GOAWAY frame, letting the calls in flight complete,
+// and the connection is closed after MaxConnectionAgeGrace. The enforcement
+// policy counts client PING frames and closes connections that ping more
+// often than permitted.
 type HTTP2Transport struct {
-	server          *http2.Server
-	keepaliveConfig *keepaliveConfig
-	activeStreams   sync.Map // track active streams
-	lastPingTime    time.Time
-	pingStrikes     int
-	mu              sync.Mutex
+	server    *http2.Server
+	keepalive *KeepaliveParameters
+	policy    *KeepaliveEnforcementPolicy
+	perIP     *clientCounter // Open connections per remote IP, if limited
+	conns     sync.Map       // net.Conn -> *connState, until closed or hijacked
+	h2cConns  atomic.Int64   // Open h2c connections, hijacked from net/http
+	h2cState  *http.Server   // Holds the state tracking the connections of server for graceful shutdown
 }
 
 // HTTP/2 configuration constants
@@ -29,24 +46,25 @@ const (
 	defaultMaxReadFrameSize     = 16 * 1024         // 16KB
 	defaultIdleTimeout          = 120 * time.Second // 2 minutes
 	defaultReadHeaderTimeout    = 10 * time.Second  // Slowloris mitigation
-	timeoutMultiplier           = 2
+	maxConnectionAgeJitter      = 0.1               // +/-10%
+	shutdownPollInterval        = 10 * time.Millisecond
 )
 
-// NewHTTP2Transport creates a new HTTP/2 transport with keepalive support.
-func NewHTTP2Transport(opts Options) *HTTP2Transport {
-	config := newKeepaliveConfig()
+// priorKnowledgeBody is the part of the HTTP/2 client preface that follows
+// the "PRI * HTTP/2.0" request line parsed by net/http.
+const priorKnowledgeBody = "SM\r\n\r\n"
 
-	// Apply custom keepalive parameters if provided
-	if opts.KeepaliveParams != nil {
-		config.clientParams = *opts.KeepaliveParams
-	}
-	if opts.KeepaliveEnforcementPolicy != nil {
-		config.enforcementPolicy = *opts.KeepaliveEnforcementPolicy
-	}
+// h2cUpgradeResponse switches an HTTP/1.1 connection to h2c.
+const h2cUpgradeResponse = "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"
 
+// NewHTTP2Transport creates a new HTTP/2 transport with keepalive support.
+// Pings are only sent when opts.KeepaliveParams is set, and client pings are
+// only policed when opts.KeepaliveEnforcementPolicy is set.
+func NewHTTP2Transport(opts Options) *HTTP2Transport {
 	transport := &HTTP2Transport{
-		keepaliveConfig: config,
-		lastPingTime:    time.Now(),
+		keepalive: opts.KeepaliveParams,
+		policy:    opts.KeepaliveEnforcementPolicy,
+		perIP:     newClientCounter(opts.MaxConnectionsPerIP, true, opts.OnClientLimit),
 	}
 
 	// Configure HTTP/2 server
@@ -54,101 +72,339 @@ func NewHTTP2Transport(opts Options) *HTTP2Transport {
 		MaxConcurrentStreams: defaultMaxConcurrentStreams,
 		MaxReadFrameSize:     defaultMaxReadFrameSize,
 		IdleTimeout:          defaultIdleTimeout,
-		// Configure keepalive enforcement
-		PermitProhibitedCipherSuites: false,
+	}
+	if params := opts.KeepaliveParams; params != nil {
+		// Ping after Time without frames from the peer, close if not acknowledged
+		transport.server.ReadIdleTimeout = params.Time
+		transport.server.PingTimeout = params.Timeout
+		if params.MaxConnectionIdle > 0 {
+			transport.server.IdleTimeout = params.MaxConnectionIdle
+		}
 	}
 
 	return transport
 }
 
-// WrapHandler wraps an HTTP handler with HTTP/2 and keepalive support.
+// Server returns the HTTP/2 server configuration, e.g. to change
+// MaxConcurrentStreams. Changes must be made before the transport is used.
+func (t *HTTP2Transport) Server() *http2.Server {
+	return t.server
+}
+
+// WrapHandler wraps an HTTP handler with cleartext HTTP/2 (h2c) and keepalive
+// support. Keepalive applies to h2c connections, whether with prior knowledge
+// or upgraded from HTTP/1.1; the age of HTTP/1.1 connections and the
+// connections per IP are only enforced for servers configured with
+// ConfigureServer.
 func (t *HTTP2Transport) WrapHandler(handler http.Handler) http.Handler {
-	// Create HTTP/2 handler with h2c for non-TLS
-	h2cHandler := h2c.NewHandler(handler, t.server)
+	return t.wrapHandler(handler, true)
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Track active streams
-		streamID := fmt.Sprintf("%s-%d", r.RemoteAddr, time.Now().UnixNano())
-		t.activeStreams.Store(streamID, true)
-		defer t.activeStreams.Delete(streamID)
-
-		// Check if this is a PING frame (handled by HTTP/2 layer)
-		if r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
-			// This is an HTTP/2 connection preface, let h2c handle it
-			h2cHandler.ServeHTTP(w, r)
+// wrapHandler tracks the active streams of connections and, for cleartext
+// servers, serves HTTP/2 with prior knowledge and h2c upgrades.
+func (t *HTTP2Transport) wrapHandler(handler http.Handler, cleartext bool) http.Handler {
+	var wrapped http.Handler
+	wrapped = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := connStateFromContext(r.Context())
+		if state == nil {
+			handler.ServeHTTP(w, r)
 			return
 		}
+		state.streams.Add(1)
+		defer state.streams.Add(-1)
+		// Responses of aged connections, including those of streams in flight
+		// when the connection aged, make the HTTP/2 server send GOAWAY and
+		// close HTTP/1.1 connections after them
+		handler.ServeHTTP(&ResponseRecorder{ResponseWriter: w, beforeHeader: func() {
+			if state.aged.Load() {
+				w.Header().Set("Connection", "close")
+			}
+		}}, r)
+	})
+	if !cleartext {
+		return wrapped
+	}
 
-		// For regular requests, check keepalive enforcement
-		if err := t.enforceKeepalive(r); err != nil {
-			// Send GOAWAY frame for too many pings
-			w.Header().Set("Grpc-Status", "14") // UNAVAILABLE
-			w.Header().Set("Grpc-Message", "too_many_pings")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			return
+	upgrade := h2c.NewHandler(wrapped, t.server)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priorKnowledge := r.Method == "PRI" && len(r.Header) == 0 && r.URL.Path == "*" && r.Proto == "HTTP/2.0"
+		if priorKnowledge || isH2CUpgrade(r.Header) {
+			// h2c connections are served until they close
+			t.h2cConns.Add(1)
+			defer t.h2cConns.Add(-1)
+		}
+		if t.tracksConnections() {
+			switch {
+			case priorKnowledge:
+				t.servePriorKnowledge(w, r, wrapped)
+				return
+			case isH2CUpgrade(r.Header):
+				t.serveUpgrade(w, r, wrapped)
+				return
+			}
+		}
+		upgrade.ServeHTTP(w, r)
+		if state := connStateFromContext(r.Context()); state != nil && state.hijacked.Load() {
+			// The upgraded connection was served and closed
+			state.stop()
 		}
+	})
+}
+
+// servePriorKnowledge serves a cleartext HTTP/2 connection whose client
+// preface was parsed as a "PRI" request (RFC 7540 Section 3.4).
+func (t *HTTP2Transport) servePriorKnowledge(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "HTTP/2 with prior knowledge is not supported", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	defer func() { _ = conn.Close() }()
 
-		// Serve the request
-		h2cHandler.ServeHTTP(w, r)
+	preface := make([]byte, len(priorKnowledgeBody))
+	if _, err := io.ReadFull(rw, preface); err != nil || string(preface) != priorKnowledgeBody {
+		return
+	}
+
+	state, ctx := t.hijackedConnState(r, conn)
+	defer state.stop()
+	server, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+	t.server.ServeConn(t.newKeepaliveConn(&bufferedConn{Conn: conn, reader: rw.Reader}, state, 0), &http2.ServeConnOpts{
+		Context:          ctx,
+		BaseConfig:       server,
+		Handler:          handler,
+		SawClientPreface: true,
 	})
 }
 
-// enforceKeepalive checks if the client is respecting keepalive policies.
-func (t *HTTP2Transport) enforceKeepalive(_ *http.Request) error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// serveUpgrade serves a cleartext HTTP/2 connection upgraded from HTTP/1.1
+// (RFC 7540 Section 3.2). The upgrade request is answered on stream 1.
+func (t *HTTP2Transport) serveUpgrade(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	values := r.Header.Values("Http2-Settings")
+	if len(values) != 1 {
+		http.Error(w, "expected one HTTP2-Settings header", http.StatusBadRequest)
+		return
+	}
+	settings, err := base64.RawURLEncoding.DecodeString(values[0])
+	if err != nil {
+		http.Error(w, "invalid HTTP2-Settings header", http.StatusBadRequest)
+		return
+	}
+	// The body is sent before the upgrade, and handled on stream 1
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
 
-	now := time.Now()
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "h2c upgrades are not supported", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := rw.WriteString(h2cUpgradeResponse); err != nil || rw.Flush() != nil {
+		return
+	}
 
-	// Check if there are active streams
-	hasActiveStreams := false
-	t.activeStreams.Range(func(_, _ any) bool {
-		hasActiveStreams = true
-		return false
+	state, ctx := t.hijackedConnState(r, conn)
+	defer state.stop()
+	server, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+	kc := t.newKeepaliveConn(&bufferedConn{Conn: conn, reader: rw.Reader}, state, len(http2.ClientPreface))
+	t.server.ServeConn(kc, &http2.ServeConnOpts{
+		Context:        ctx,
+		BaseConfig:     server,
+		Handler:        handler,
+		UpgradeRequest: r,
+		Settings:       settings,
 	})
+}
 
-	// If no active streams and not permitted, check ping frequency
-	if !hasActiveStreams && !t.keepaliveConfig.enforcementPolicy.PermitWithoutStream {
-		timeSinceLastPing := now.Sub(t.lastPingTime)
+// hijackedConnState returns the state of a connection hijacked from r, new if
+// the server does not track connections, and the context of its streams.
+func (t *HTTP2Transport) hijackedConnState(r *http.Request, conn net.Conn) (*connState, context.Context) {
+	if state := connStateFromContext(r.Context()); state != nil {
+		return state, r.Context()
+	}
+	state := t.newConnState(conn)
+	return state, context.WithValue(r.Context(), connStateContextKey{}, state)
+}
 
-		if timeSinceLastPing < t.keepaliveConfig.enforcementPolicy.MinTime {
-			t.pingStrikes++
+// isH2CUpgrade reports whether a request asks to upgrade to h2c.
+func isH2CUpgrade(h http.Header) bool {
+	return httpguts.HeaderValuesContainsToken(h.Values("Upgrade"), "h2c") &&
+		httpguts.HeaderValuesContainsToken(h.Values("Connection"), "HTTP2-Settings")
+}
 
-			// Check if we've exceeded max strikes
-			if t.keepaliveConfig.enforcementPolicy.MaxPingStrikes > 0 &&
-				t.pingStrikes > t.keepaliveConfig.enforcementPolicy.MaxPingStrikes {
-				return fmt.Errorf("too many keepalive pings")
-			}
-		} else {
-			// Reset strikes if enough time has passed
-			t.pingStrikes = 0
+// ConfigureServer configures server for HTTP/2 with keepalive support: h2c
+// without TLS, or h2 via ALPN when server.TLSConfig is set. It wraps the
+// server handler, so the handler must be set first.
+func (t *HTTP2Transport) ConfigureServer(server *http.Server) error {
+	if t.keepalive != nil && t.keepalive.MaxConnectionIdle > 0 {
+		server.IdleTimeout = t.keepalive.MaxConnectionIdle
+	}
+	if t.tracksConnections() {
+		t.trackConnections(server)
+	}
+
+	cleartext := server.TLSConfig == nil
+	server.Handler = t.wrapHandler(server.Handler, cleartext)
+	if cleartext {
+		// Let Shutdown send GOAWAY to h2c connections, as it does over TLS.
+		// http2.ConfigureServer would enable TLS on server itself.
+		t.h2cState = &http.Server{}
+		if err := http2.ConfigureServer(t.h2cState, t.server); err != nil {
+			return fmt.Errorf("failed to configure HTTP/2: %w", err)
 		}
+		server.RegisterOnShutdown(func() { _ = t.h2cState.Shutdown(context.Background()) })
+		return nil
+	}
+
+	// Advertise h2 via ALPN
+	if err := http2.ConfigureServer(server, t.server); err != nil {
+		return fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	if t.tracksConnections() {
+		server.TLSNextProto[http2.NextProtoTLS] = t.serveTLS
 	}
+	return nil
+}
 
-	t.lastPingTime = now
+// Shutdown gracefully shuts down the h2c connections of a cleartext server
+// configured with ConfigureServer, and waits until they are closed or ctx is
+// done. http.Server.Shutdown sends them GOAWAY frames but does not wait for
+// them, since they are hijacked from net/http; call Shutdown after it:
+//
+//	err := server.Shutdown(ctx)
+//	err = errors.Join(err, transport.Shutdown(ctx))
+//
+// Connections close once their streams complete.
+func (t *HTTP2Transport) Shutdown(ctx context.Context) error {
+	if t.h2cState != nil {
+		_ = t.h2cState.Shutdown(ctx)
+	}
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for t.h2cConns.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 	return nil
 }
 
-// ConfigureServer configures an HTTP server with keepalive parameters.
+// serveTLS serves an HTTP/2 connection negotiated via ALPN.
+func (t *HTTP2Transport) serveTLS(server *http.Server, conn *tls.Conn, handler http.Handler) {
+	// net/http passes the connection context via the handler
+	ctx := context.Background()
+	if bc, ok := handler.(interface{ BaseContext() context.Context }); ok {
+		ctx = bc.BaseContext()
+	}
+	state := connStateFromContext(ctx)
+	if state == nil {
+		state = t.newConnState(conn)
+	}
+	defer state.stop()
+	kc := t.newKeepaliveConn(conn, state, len(http2.ClientPreface))
+	t.server.ServeConn(&keepaliveTLSConn{keepaliveConn: kc, tls: conn}, &http2.ServeConnOpts{
+		Context:    ctx,
+		BaseConfig: server,
+		Handler:    handler,
+	})
+}
+
+// trackConnections attaches a connState to every connection of server.
+func (t *HTTP2Transport) trackConnections(server *http.Server) {
+	connContext := server.ConnContext
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		state := t.newConnState(c)
+		t.conns.Store(c, state)
+		return context.WithValue(ctx, connStateContextKey{}, state)
+	}
+
+	onConnState := server.ConnState
+	server.ConnState = func(c net.Conn, cs http.ConnState) {
+		switch cs { //nolint:exhaustive // Only the start and end of net/http ownership matter
+		case http.StateNew:
+			if state, ok := t.conns.Load(c); ok && !t.admit(state.(*connState)) {
+				_ = c.Close()
+			}
+		case http.StateClosed:
+			if state, ok := t.conns.LoadAndDelete(c); ok {
+				state.(*connState).stop()
+			}
+		case http.StateHijacked:
+			// Hijacked connections are served as HTTP/2 with prior knowledge
+			// or after an h2c upgrade, which stop their state when done
+			if state, ok := t.conns.LoadAndDelete(c); ok {
+				state.(*connState).hijacked.Store(true)
+			}
+		}
+		if onConnState != nil {
+			onConnState(c, cs)
+		}
+	}
+}
+
+// tracksConnections reports whether connections need to be tracked to
+// enforce the ping policy, connection age, or connections per IP.
+func (t *HTTP2Transport) tracksConnections() bool {
+	return t.policy != nil || (t.keepalive != nil && t.keepalive.MaxConnectionAge > 0) || t.perIP != nil
+}
+
+// admit counts a new connection against the limit of its remote IP, and
+// reports false if the IP has too many connections open.
+func (t *HTTP2Transport) admit(state *connState) bool {
+	if t.perIP == nil {
+		return true
+	}
+	release, ok := t.perIP.acquire(remoteIP(state.conn.RemoteAddr().String()))
+	if !ok {
+		return false
+	}
+	state.mu.Lock()
+	state.release = release
+	state.mu.Unlock()
+	return true
+}
+
+// newConnState starts tracking a connection, including its age.
+func (t *HTTP2Transport) newConnState(conn net.Conn) *connState {
+	state := &connState{conn: conn}
+	if t.keepalive == nil || t.keepalive.MaxConnectionAge <= 0 {
+		return state
+	}
+
+	jitter := 1 + maxConnectionAgeJitter*(2*rand.Float64()-1) //nolint:gosec // jitter does not need a secure source
+	age := time.Duration(float64(t.keepalive.MaxConnectionAge) * jitter)
+	grace := t.keepalive.MaxConnectionAgeGrace
+	state.afterFunc(age, func() {
+		state.expire()
+		if grace > 0 {
+			state.afterFunc(grace, func() { _ = conn.Close() })
+		}
+	})
+	return state
+}
+
+// ConfigureServerWithKeepalive configures an HTTP server with keepalive parameters.
+// Read and write timeouts are not set, since they would cut off long-lived streams.
 func ConfigureServerWithKeepalive(server *http.Server, keepalive *KeepaliveParameters) {
 	if keepalive == nil {
 		return
 	}
 
-	// Set server timeouts based on keepalive parameters
-	if server.IdleTimeout == 0 {
+	if keepalive.MaxConnectionIdle > 0 {
+		server.IdleTimeout = keepalive.MaxConnectionIdle
+	} else if server.IdleTimeout == 0 {
 		// Set idle timeout based on keepalive time
 		server.IdleTimeout = keepalive.Time + keepalive.Timeout
 	}
-
-	if server.ReadTimeout == 0 {
-		// Allow enough time for keepalive
-		server.ReadTimeout = keepalive.Timeout * timeoutMultiplier
-	}
-
-	if server.WriteTimeout == 0 {
-		server.WriteTimeout = keepalive.Timeout * timeoutMultiplier
-	}
 }
 
 // NewHTTP2Server creates an HTTP server configured for HTTP/2 with keepalive.
@@ -157,7 +413,7 @@ func NewHTTP2Server(addr string, handler http.Handler, opts Options) *http.Serve
 
 	server := &http.Server{
 		Addr:              addr,
-		Handler:           transport.WrapHandler(handler),
+		Handler:           handler,
 		ReadHeaderTimeout: defaultReadHeaderTimeout,
 	}
 
@@ -167,7 +423,7 @@ func NewHTTP2Server(addr string, handler http.Handler, opts Options) *http.Serve
 	}
 
 	// Configure HTTP/2
-	if err := http2.ConfigureServer(server, transport.server); err != nil {
+	if err := transport.ConfigureServer(server); err != nil {
 		// This should not happen in practice
 		panic(fmt.Sprintf("failed to configure HTTP/2: %v", err))
 	}
@@ -186,27 +442,19 @@ func ListenAndServeHTTP2(addr string, handler http.Handler, opts Options) error
 		return err
 	}
 
-	// Start keepalive timer if configured
-	if opts.KeepaliveParams != nil && opts.KeepaliveParams.PermitWithoutStream {
-		go startKeepaliveTimer(server.BaseContext(lis), opts.KeepaliveParams)
-	}
-
 	return server.Serve(lis)
 }
 
-// startKeepaliveTimer sends periodic PING frames according to keepalive parameters.
-func startKeepaliveTimer(ctx context.Context, params *KeepaliveParameters) {
-	ticker := time.NewTicker(params.Time)
-	defer ticker.Stop()
+// bufferedConn reads data buffered by net/http before the connection was
+// hijacked, then from the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			// HTTP/2 PING frames are handled at the transport layer
-			// This is just a placeholder for the timer logic
-			// Actual PING frame sending is done by the HTTP/2 implementation
-		}
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if c.reader.Buffered() > 0 {
+		return c.reader.Read(p)
 	}
+	return c.Conn.Read(p)
 }
@@ -0,0 +1,292 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// startHTTP2Server serves handler with keepalive options and returns its address.
+func startHTTP2Server(t *testing.T, opts Options) string {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = io.WriteString(w, "ok")
+	})
+	server := NewHTTP2Server("", handler, opts)
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return lis.Addr().String()
+}
+
+// dialH2C opens a cleartext HTTP/2 connection with prior knowledge.
+func dialH2C(t *testing.T, addr string) (net.Conn, *http2.Framer) {
+	t.Helper()
+	conn, err := (&net.Dialer{}).DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+	return conn, framer
+}
+
+// readGoAway reads frames until a GOAWAY frame, and fails on connection errors.
+func readGoAway(t *testing.T, framer *http2.Framer) *http2.GoAwayFrame {
+	t.Helper()
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("Expected a GOAWAY frame, got %v", err)
+		}
+		if goAway, ok := frame.(*http2.GoAwayFrame); ok {
+			return goAway
+		}
+	}
+}
+
+// expectClosed reads frames until the server closes the connection.
+func expectClosed(t *testing.T, framer *http2.Framer) {
+	t.Helper()
+	for {
+		_, err := framer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("Expected the server to close the connection")
+			}
+			return
+		}
+	}
+}
+
+func TestHTTP2TransportPingStrikes(t *testing.T) {
+	addr := startHTTP2Server(t, Options{
+		KeepaliveEnforcementPolicy: &KeepaliveEnforcementPolicy{
+			MinTime:        time.Minute,
+			MaxPingStrikes: 2,
+		},
+	})
+
+	t.Run("too many pings", func(t *testing.T) {
+		_, framer := dialH2C(t, addr)
+		// The first ping is free, the next three are strikes
+		for i := range 4 {
+			if err := framer.WritePing(false, [8]byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expectClosed(t, framer)
+	})
+
+	t.Run("pings within the limit", func(t *testing.T) {
+		_, framer := dialH2C(t, addr)
+		for i := range 3 {
+			if err := framer.WritePing(false, [8]byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// All pings are acknowledged and the connection stays open
+		acks := 0
+		for acks < 3 {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			switch f := frame.(type) {
+			case *http2.PingFrame:
+				if f.IsAck() {
+					acks++
+				}
+			case *http2.GoAwayFrame:
+				t.Fatalf("Unexpected GOAWAY: %v", f.ErrCode)
+			}
+		}
+	})
+}
+
+// writeGet opens a stream with a GET request of path.
+func writeGet(t *testing.T, framer *http2.Framer, streamID uint32, path string) {
+	t.Helper()
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, f := range [][2]string{{":method", "GET"}, {":scheme", "http"}, {":authority", "localhost"}, {":path", path}} {
+		_ = enc.WriteField(hpack.HeaderField{Name: f[0], Value: f[1]})
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID: streamID, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTP2TransportMaxConnectionAge(t *testing.T) {
+	addr := startHTTP2Server(t, Options{
+		KeepaliveParams: &KeepaliveParameters{
+			Time:                  time.Hour,
+			Timeout:               time.Second,
+			MaxConnectionAge:      100 * time.Millisecond,
+			MaxConnectionAgeGrace: time.Second,
+		},
+	})
+
+	_, framer := dialH2C(t, addr)
+	start := time.Now()
+	writeGet(t, framer, 1, "/slow")
+
+	// The response of the stream in flight makes the HTTP/2 server send a
+	// GOAWAY frame, and the stream completes
+	var goAway *http2.GoAwayFrame
+	completed := false
+	for !completed || goAway == nil {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		switch f := frame.(type) {
+		case *http2.GoAwayFrame:
+			goAway = f
+		case *http2.DataFrame:
+			completed = f.StreamEnded()
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("GOAWAY sent before the maximum age: %v", elapsed)
+	}
+	if goAway.ErrCode != http2.ErrCodeNo || goAway.LastStreamID != 1 {
+		t.Errorf("Expected NO_ERROR with last stream 1, got %v %d", goAway.ErrCode, goAway.LastStreamID)
+	}
+
+	// The connection is closed after the grace period
+	expectClosed(t, framer)
+}
+
+func TestHTTP2TransportMaxConnectionIdle(t *testing.T) {
+	addr := startHTTP2Server(t, Options{
+		KeepaliveParams: &KeepaliveParameters{Time: time.Hour, MaxConnectionIdle: 100 * time.Millisecond},
+	})
+
+	_, framer := dialH2C(t, addr)
+	start := time.Now()
+	if goAway := readGoAway(t, framer); goAway.ErrCode != http2.ErrCodeNo {
+		t.Errorf("Expected NO_ERROR, got %v", goAway.ErrCode)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("GOAWAY sent before the connection was idle: %v", elapsed)
+	}
+	expectClosed(t, framer)
+}
+
+func TestHTTP2TransportUpgradeMaxConnectionAge(t *testing.T) {
+	transport := NewHTTP2Transport(Options{
+		KeepaliveParams: &KeepaliveParameters{
+			MaxConnectionAge:      100 * time.Millisecond,
+			MaxConnectionAgeGrace: 200 * time.Millisecond,
+		},
+	})
+	server := httptest.NewServer(transport.WrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})))
+	t.Cleanup(server.Close)
+
+	conn, err := (&net.Dialer{}).DialContext(context.Background(), "tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\nHTTP2-Settings: \r\n\r\n")
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(status, "101") {
+		t.Fatalf("Expected 101 Switching Protocols, got %q %v", status, err)
+	}
+	for line := ""; line != "\r\n"; {
+		if line, err = reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, reader)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upgrade request is answered on stream 1, then the idle connection
+	// is closed once it ages
+	start := time.Now()
+	expectClosed(t, framer)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Connection closed before the maximum age: %v", elapsed)
+	}
+}
+
+func TestHTTP2TransportServesRequests(t *testing.T) {
+	addr := startHTTP2Server(t, Options{
+		KeepaliveEnforcementPolicy: &KeepaliveEnforcementPolicy{MinTime: time.Minute, MaxPingStrikes: 2},
+	})
+
+	get := func(client *http.Client) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	if resp, body := get(h2c); resp.ProtoMajor != 2 || body != "ok" {
+		t.Errorf("Expected an HTTP/2 response, got %s %q", resp.Proto, body)
+	}
+
+	// HTTP/1.1 clients are unaffected
+	if resp, body := get(http.DefaultClient); resp.ProtoMajor != 1 || body != "ok" {
+		t.Errorf("Expected an HTTP/1.1 response, got %s %q", resp.Proto, body)
+	}
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// NewHTTP3Server creates an HTTP/3 server for handler on the UDP address addr.
+// HTTP/3 always runs over TLS, so tlsConfig must provide a certificate; the
+// "h3" protocol is negotiated automatically.
+//
+// Handlers behave as over HTTP/2: responses can be flushed while the request
+// body is still being read, and declared trailers are sent after the body, so
+// gRPC, gRPC-Web, and Connect streaming work unchanged. Keepalive parameters map
+// to QUIC: Time is the keepalive period, Time+Timeout bounds the time without
+// packets from a peer, and MaxConnectionIdle the time without requests. The
+// enforcement policy and connection age only apply to HTTP/2.
+func NewHTTP3Server(addr string, handler http.Handler, tlsConfig *tls.Config, opts Options) *http3.Server {
+	quicConfig := &quic.Config{
+		MaxIncomingStreams: defaultMaxConcurrentStreams,
+	}
+	server := &http3.Server{
+		Addr:        addr,
+		Handler:     handler,
+		TLSConfig:   tlsConfig,
+		QUICConfig:  quicConfig,
+		IdleTimeout: defaultIdleTimeout,
+	}
+
+	if params := opts.KeepaliveParams; params != nil {
+		quicConfig.KeepAlivePeriod = params.Time
+		if params.Time > 0 && params.Timeout > 0 {
+			quicConfig.MaxIdleTimeout = params.Time + params.Timeout
+		}
+		if params.MaxConnectionIdle > 0 {
+			server.IdleTimeout = params.MaxConnectionIdle
+		}
+	}
+
+	return server
+}
+
+// AltSvcHandler advertises server to clients of handler with the Alt-Svc
+// response header (RFC 7838), so HTTP/1.1 and HTTP/2 clients can switch to
+// HTTP/3 for later requests. server must listen on the same host, and nothing
+// is advertised until it does.
+func AltSvcHandler(handler http.Handler, server *http3.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			// Fails only while the server is not listening
+			_ = server.SetQUICHeaders(w.Header())
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
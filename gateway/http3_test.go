@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// selfSignedCert returns a certificate for 127.0.0.1 and a pool trusting it.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestHTTP3Server(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+
+	// Streams two chunks, echoing the request body, then sends a trailer
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "grpc-status")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "first;")
+		http.NewResponseController(w).Flush()
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+		w.Header().Set("grpc-status", "0")
+	})
+
+	server := NewHTTP3Server("127.0.0.1:0", handler, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	}, Options{
+		KeepaliveParams: &KeepaliveParameters{Time: time.Second, Timeout: time.Second},
+	})
+	conn, err := (&net.ListenConfig{}).ListenPacket(context.Background(), "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(conn) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	if server.QUICConfig.KeepAlivePeriod != time.Second || server.QUICConfig.MaxIdleTimeout != 2*time.Second {
+		t.Errorf("Unexpected QUIC config: %+v", server.QUICConfig)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS13}}
+	t.Cleanup(func() { _ = transport.Close() })
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		"https://"+conn.LocalAddr().String()+"/", strings.NewReader("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.ProtoMajor != 3 || string(body) != "first;second" {
+		t.Errorf("Expected an HTTP/3 response, got %s %q", resp.Proto, body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected trailer grpc-status 0, got %q", got)
+	}
+
+	t.Run("alt-svc", func(t *testing.T) {
+		altSvc := AltSvcHandler(http.NotFoundHandler(), server)
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+
+		rec := httptest.NewRecorder()
+		altSvc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got, want := rec.Header().Get("Alt-Svc"), fmt.Sprintf(`h3=":%d"; ma=2592000`, port); got != want {
+			t.Errorf("Expected Alt-Svc %q, got %q", want, got)
+		}
+
+		// HTTP/3 clients already use HTTP/3
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.ProtoMajor = 3
+		rec = httptest.NewRecorder()
+		altSvc.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Alt-Svc"); got != "" {
+			t.Errorf("Expected no Alt-Svc header over HTTP/3, got %q", got)
+		}
+	})
+}
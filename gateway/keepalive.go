@@ -16,7 +16,8 @@ const (
 )
 
 // KeepaliveParameters configures gRPC keepalive according to the specification.
-// These settings control HTTP/2 PING frames for connection health checking.
+// These settings control HTTP/2 PING frames for connection health checking
+// and the lifetime of server connections.
 type KeepaliveParameters struct {
 	// Time after which a keepalive ping is sent on the transport.
 	// Default: 2 hours (7200000ms)
@@ -34,6 +35,23 @@ type KeepaliveParameters struct {
 	// Maximum number of pings that can be sent when there is no data/header frame to be sent.
 	// Default: 2
 	MaxPingsWithoutData int
+
+	// MaxConnectionIdle is the time after which a connection without active
+	// streams is closed with a GOAWAY frame.
+	// Default: 0 (the server idle timeout applies)
+	MaxConnectionIdle time.Duration
+
+	// MaxConnectionAge is the maximum age of a connection before the server
+	// closes it, or sends a GOAWAY frame with the next response if calls are
+	// in flight, so clients reconnect and rebalance. A jitter of
+	// +/-10% is applied to spread out reconnection storms.
+	// Default: 0 (infinite)
+	MaxConnectionAge time.Duration
+
+	// MaxConnectionAgeGrace is the time after MaxConnectionAge after which
+	// the connection is closed, even with streams still in flight.
+	// Default: 0 (infinite)
+	MaxConnectionAgeGrace time.Duration
 }
 
 // KeepaliveEnforcementPolicy configures server-side keepalive enforcement.
@@ -87,17 +105,3 @@ func AggressiveKeepaliveParams() KeepaliveParameters {
 		MaxPingsWithoutData: defaultMaxPingsWithoutData,
 	}
 }
-
-// keepaliveConfig holds the complete keepalive configuration.
-type keepaliveConfig struct {
-	clientParams      KeepaliveParameters
-	enforcementPolicy KeepaliveEnforcementPolicy
-}
-
-// newKeepaliveConfig creates a new keepalive configuration with defaults.
-func newKeepaliveConfig() *keepaliveConfig {
-	return &keepaliveConfig{
-		clientParams:      DefaultKeepaliveParams(),
-		enforcementPolicy: DefaultKeepaliveEnforcementPolicy(),
-	}
-}
@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTP/2 frame layout (RFC 7540 Section 4.1)
+const (
+	frameHeaderLen  = 9
+	frameTypeData   = 0x0
+	frameTypeHeader = 0x1
+	frameTypePing   = 0x6
+	flagPingAck     = 0x1
+)
+
+// pingIntervalWithoutStreams is the minimum ping interval without active
+// streams when pings without streams are not permitted, as in gRPC.
+const pingIntervalWithoutStreams = 2 * time.Hour
+
+// connStateContextKey stores the state of the connection of a request.
+type connStateContextKey struct{}
+
+// connState tracks a server connection across protocols.
+type connState struct {
+	conn     net.Conn
+	streams  atomic.Int32
+	aged     atomic.Bool
+	hijacked atomic.Bool
+
+	mu      sync.Mutex
+	timers  []*time.Timer
+	release func() // Frees the slot of the connection in the per-IP limit
+}
+
+func connStateFromContext(ctx context.Context) *connState {
+	state, _ := ctx.Value(connStateContextKey{}).(*connState)
+	return state
+}
+
+// afterFunc runs f after d unless the connection is closed first.
+func (s *connState) afterFunc(d time.Duration, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timers = append(s.timers, time.AfterFunc(d, f))
+}
+
+// stop releases the timers and the per-IP slot of a closed connection.
+func (s *connState) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	s.timers = nil
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+}
+
+// expire marks the connection as past its maximum age. Responses written
+// from then on carry "Connection: close", with which the HTTP/2 server sends
+// a GOAWAY frame itself, and idle connections are closed.
+func (s *connState) expire() {
+	s.aged.Store(true)
+	if s.streams.Load() == 0 {
+		_ = s.conn.Close()
+	}
+}
+
+// keepaliveConn counts the PING frames a client sends on a server-side
+// HTTP/2 connection to enforce the keepalive policy, closing the connection
+// when the client pings too often. It only reads frame headers and never
+// writes to the connection, which the HTTP/2 server owns.
+type keepaliveConn struct {
+	net.Conn
+	state  *connState
+	policy *KeepaliveEnforcementPolicy
+
+	// Only used by the reading goroutine of the HTTP/2 server
+	readSkip    int // Bytes of the client preface or frame payload to skip
+	readHeader  [frameHeaderLen]byte
+	readLen     int
+	lastPing    time.Time
+	pingStrikes int
+	resetPings  bool // Set when the client sends headers or data
+}
+
+// keepaliveTLSConn exposes the TLS state of the connection to the HTTP/2
+// server, which sets Request.TLS from it.
+type keepaliveTLSConn struct {
+	*keepaliveConn
+	tls *tls.Conn
+}
+
+// ConnectionState returns the TLS state of the connection.
+func (c *keepaliveTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+// newKeepaliveConn wraps an HTTP/2 connection. prefaceLen is the length of
+// the client preface still to be read from conn.
+func (t *HTTP2Transport) newKeepaliveConn(conn net.Conn, state *connState, prefaceLen int) *keepaliveConn {
+	return &keepaliveConn{
+		Conn:     conn,
+		state:    state,
+		policy:   t.policy,
+		readSkip: prefaceLen,
+	}
+}
+
+func (c *keepaliveConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.policy != nil {
+		c.readFrames(p[:n])
+	}
+	return n, err
+}
+
+// readFrames parses frame headers from data received from the client.
+func (c *keepaliveConn) readFrames(data []byte) {
+	for len(data) > 0 {
+		if c.readSkip > 0 {
+			n := min(c.readSkip, len(data))
+			c.readSkip -= n
+			data = data[n:]
+			continue
+		}
+		n := copy(c.readHeader[c.readLen:], data)
+		c.readLen += n
+		data = data[n:]
+		if c.readLen < frameHeaderLen {
+			return
+		}
+		c.readLen = 0
+		c.readSkip = int(c.readHeader[0])<<16 | int(c.readHeader[1])<<8 | int(c.readHeader[2])
+
+		switch frameType, flags := c.readHeader[3], c.readHeader[4]; {
+		case frameType == frameTypeData || frameType == frameTypeHeader:
+			c.resetPings = true
+		case frameType == frameTypePing && flags&flagPingAck == 0:
+			c.receivePing()
+		}
+	}
+}
+
+// receivePing counts pings received more often than the policy permits, and
+// closes the connection after too many, following gRPC servers.
+func (c *keepaliveConn) receivePing() {
+	now := time.Now()
+	defer func() { c.lastPing = now }()
+
+	// Pings after the client sent headers or data are always fine
+	if c.resetPings {
+		c.resetPings = false
+		c.pingStrikes = 0
+		return
+	}
+
+	interval := c.policy.MinTime
+	if c.state.streams.Load() == 0 && !c.policy.PermitWithoutStream {
+		interval = pingIntervalWithoutStreams
+	}
+	if !c.lastPing.IsZero() && now.Sub(c.lastPing) < interval {
+		c.pingStrikes++
+	}
+	if c.policy.MaxPingStrikes > 0 && c.pingStrikes > c.policy.MaxPingStrikes {
+		_ = c.Conn.Close()
+	}
+}
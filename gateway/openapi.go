@@ -3,12 +3,47 @@ package gateway
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// OpenAPIVersion is the OpenAPI version of generated specs.
+const OpenAPIVersion = "3.1.0"
+
+// ErrorSchemaName is the component schema describing Connect error responses.
+const ErrorSchemaName = "connect.Error"
+
+// errorDetailSchemaName is the component schema describing an error detail.
+const errorDetailSchemaName = "connect.ErrorDetail"
+
+// validationCommentPrefix starts the trailing field comment carrying validation rules.
+const validationCommentPrefix = "Validation:"
+
+// maxExampleDepth bounds example generation for recursive messages.
+const maxExampleDepth = 4
+
+// Descriptor field numbers used in SourceCodeInfo paths.
+const (
+	pathFileMessageType    = 4
+	pathFileEnumType       = 5
+	pathFileService        = 6
+	pathMessageField       = 2
+	pathMessageNestedType  = 3
+	pathMessageEnumType    = 4
+	pathServiceMethod      = 2
+	pathEnumValue          = 2
+	schemaRefPrefix        = "#/components/schemas/"
+	contentTypeJSON        = "application/json"
+	contentTypeConnectJSON = "application/connect+json"
 )
 
-// OpenAPISpec represents an OpenAPI 3.0 specification.
+// OpenAPISpec represents an OpenAPI 3.1 specification.
 type OpenAPISpec struct {
 	OpenAPI    string            `json:"openapi"`
 	Info       OpenAPIInfo       `json:"info"`
@@ -32,42 +67,92 @@ type OpenAPIServer struct {
 
 // OpenAPIComponents holds reusable components.
 type OpenAPIComponents struct {
-	Schemas map[string]any `json:"schemas"`
+	Schemas         map[string]any                   `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// openAPIGenerator accumulates state while converting descriptors.
+type openAPIGenerator struct {
+	spec *OpenAPISpec
+	// mapEntries holds synthetic map entry messages by full name.
+	mapEntries map[string]*descriptorpb.DescriptorProto
+	// serviceNames counts the services of each unqualified name.
+	serviceNames map[string]int
 }
 
+// sourceComments holds the comments of a file keyed by SourceCodeInfo path.
+type sourceComments map[string]*descriptorpb.SourceCodeInfo_Location
+
 // GenerateOpenAPI generates an OpenAPI spec from a FileDescriptorSet.
+//
+// Every message and enum becomes a component schema. Well-known types map to
+// their JSON representation, leading comments (from `doc` tags or .proto
+// comments) become descriptions, and validation rules recorded by the schema
+// builder become JSON Schema keywords. Each operation documents the Connect
+// error schema as its default response and carries generated examples.
 func GenerateOpenAPI(fdset *descriptorpb.FileDescriptorSet, info OpenAPIInfo) (*OpenAPISpec, error) {
-	spec := &OpenAPISpec{
-		OpenAPI: "3.0.3",
-		Info:    info,
-		Paths:   make(map[string]any),
-		Components: OpenAPIComponents{
-			Schemas: make(map[string]any),
+	g := &openAPIGenerator{
+		spec: &OpenAPISpec{
+			OpenAPI: OpenAPIVersion,
+			Info:    info,
+			Paths:   make(map[string]any),
+			Components: OpenAPIComponents{
+				Schemas: make(map[string]any),
+			},
 		},
+		mapEntries:   make(map[string]*descriptorpb.DescriptorProto),
+		serviceNames: make(map[string]int),
+	}
+
+	// Index map entries first so fields in any file can resolve them, and
+	// service names to keep operation IDs unique across packages
+	for _, file := range fdset.File {
+		for _, msg := range file.MessageType {
+			g.indexMapEntries(qualifiedName(file.GetPackage(), msg.GetName()), msg)
+		}
+		for _, svc := range file.Service {
+			g.serviceNames[svc.GetName()]++
+		}
 	}
 
 	// Process each file in the descriptor set
 	for _, file := range fdset.File {
-		if err := processFile(spec, file); err != nil {
+		if err := g.processFile(file); err != nil {
 			return nil, fmt.Errorf("failed to process file %s: %w", file.GetName(), err)
 		}
 	}
 
-	return spec, nil
+	g.addErrorSchemas()
+	return g.spec, nil
+}
+
+// indexMapEntries records the map entry messages nested in msg.
+func (g *openAPIGenerator) indexMapEntries(fullName string, msg *descriptorpb.DescriptorProto) {
+	for _, nested := range msg.NestedType {
+		nestedName := fullName + "." + nested.GetName()
+		if nested.GetOptions().GetMapEntry() {
+			g.mapEntries[nestedName] = nested
+			continue
+		}
+		g.indexMapEntries(nestedName, nested)
+	}
 }
 
 // processFile processes a single file descriptor.
-func processFile(spec *OpenAPISpec, file *descriptorpb.FileDescriptorProto) error {
-	// Process messages as schemas
-	for _, msg := range file.MessageType {
-		schema := generateMessageSchema(msg)
-		schemaName := fmt.Sprintf("%s.%s", file.GetPackage(), msg.GetName())
-		spec.Components.Schemas[schemaName] = schema
+func (g *openAPIGenerator) processFile(file *descriptorpb.FileDescriptorProto) error {
+	comments := indexComments(file.GetSourceCodeInfo())
+
+	// Process messages and enums as schemas
+	for i, msg := range file.MessageType {
+		g.addMessageSchema(qualifiedName(file.GetPackage(), msg.GetName()), msg, comments, []int32{pathFileMessageType, pathIndex(i)})
+	}
+	for i, enum := range file.EnumType {
+		g.addEnumSchema(qualifiedName(file.GetPackage(), enum.GetName()), enum, comments, []int32{pathFileEnumType, pathIndex(i)})
 	}
 
 	// Process services as paths
-	for _, svc := range file.Service {
-		if err := processService(spec, file, svc); err != nil {
+	for i, svc := range file.Service {
+		if err := g.processService(file, svc, comments, []int32{pathFileService, pathIndex(i)}); err != nil {
 			return err
 		}
 	}
@@ -75,25 +160,74 @@ func processFile(spec *OpenAPISpec, file *descriptorpb.FileDescriptorProto) erro
 	return nil
 }
 
+// addMessageSchema adds the schema of a message and its nested types.
+func (g *openAPIGenerator) addMessageSchema(fullName string, msg *descriptorpb.DescriptorProto, comments sourceComments, path []int32) {
+	if msg.GetOptions().GetMapEntry() {
+		return
+	}
+	if _, ok := wellKnownTypeSchema(fullName); ok {
+		// Well-known types are inlined where they are used
+		return
+	}
+
+	g.spec.Components.Schemas[fullName] = g.generateMessageSchema(msg, comments, path)
+
+	for i, nested := range msg.NestedType {
+		g.addMessageSchema(fullName+"."+nested.GetName(), nested, comments, appendPath(path, pathMessageNestedType, pathIndex(i)))
+	}
+	for i, enum := range msg.EnumType {
+		g.addEnumSchema(fullName+"."+enum.GetName(), enum, comments, appendPath(path, pathMessageEnumType, pathIndex(i)))
+	}
+}
+
 // generateMessageSchema generates a JSON schema for a message.
-func generateMessageSchema(msg *descriptorpb.DescriptorProto) map[string]any {
+func (g *openAPIGenerator) generateMessageSchema(msg *descriptorpb.DescriptorProto, comments sourceComments, path []int32) map[string]any {
 	schema := map[string]any{
 		"type":       "object",
 		"properties": make(map[string]any),
 	}
+	if description := comments.leading(path); description != "" {
+		schema["description"] = description
+	}
 
 	properties := schema["properties"].(map[string]any)
 	required := []string{}
 
-	for _, field := range msg.Field {
-		fieldSchema := generateFieldSchema(field)
+	for i, field := range msg.Field {
+		fieldPath := appendPath(path, pathMessageField, pathIndex(i))
+		fieldSchema := g.generateFieldSchema(field)
 		fieldName := field.GetName()
-		properties[fieldName] = fieldSchema
+		if jsonName := field.GetJsonName(); jsonName != "" {
+			fieldName = jsonName
+		}
 
-		// Check if field is required (not optional in proto3)
-		if field.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL {
+		if description := comments.leading(fieldPath); description != "" {
+			fieldSchema["description"] = description
+		}
+
+		// Validation rules are recorded in the trailing comment by the schema builder
+		rules := parseValidationComment(comments.trailing(fieldPath))
+		if applyValidationKeywords(fieldSchema, field, rules) {
 			required = append(required, fieldName)
 		}
+
+		if value, ok := defaultValue(fieldSchema, field, comments.trailing(fieldPath)); ok {
+			fieldSchema["default"] = value
+		}
+
+		if field.GetOptions().GetDeprecated() {
+			fieldSchema["deprecated"] = true
+		}
+
+		// Fields tagged sensitive carry the debug_redact option
+		if field.GetOptions().GetDebugRedact() {
+			fieldSchema["x-sensitive"] = true
+			if fieldSchema["type"] == "string" && fieldSchema["format"] == nil && fieldSchema["contentEncoding"] == nil {
+				fieldSchema["format"] = "password"
+			}
+		}
+
+		properties[fieldName] = fieldSchema
 	}
 
 	if len(required) > 0 {
@@ -104,127 +238,235 @@ func generateMessageSchema(msg *descriptorpb.DescriptorProto) map[string]any {
 }
 
 // generateFieldSchema generates a JSON schema for a field.
-func generateFieldSchema(field *descriptorpb.FieldDescriptorProto) map[string]any {
-	schema := make(map[string]any)
+func (g *openAPIGenerator) generateFieldSchema(field *descriptorpb.FieldDescriptorProto) map[string]any {
+	if field.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return g.fieldTypeSchema(field)
+	}
 
-	// Handle repeated fields
-	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
-		schema["type"] = "array"
-		schema["items"] = getFieldTypeSchema(field)
-		return schema
+	// Map fields are repeated map entry messages
+	if entry, ok := g.mapEntries[strings.TrimPrefix(field.GetTypeName(), ".")]; ok && len(entry.Field) == 2 {
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": g.fieldTypeSchema(entry.Field[1]),
+		}
 	}
 
-	// Handle non-repeated fields
-	return getFieldTypeSchema(field)
+	return map[string]any{
+		"type":  "array",
+		"items": g.fieldTypeSchema(field),
+	}
 }
 
-// getFieldTypeSchema returns the schema for a field type.
-func getFieldTypeSchema(field *descriptorpb.FieldDescriptorProto) map[string]any {
+// fieldTypeSchema returns the schema for a single value of a field.
+func (g *openAPIGenerator) fieldTypeSchema(field *descriptorpb.FieldDescriptorProto) map[string]any {
 	switch field.GetType() {
 	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
 		return map[string]any{"type": "string"}
 	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
-		descriptorpb.FieldDescriptorProto_TYPE_INT64,
-		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
-		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
 		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return map[string]any{"type": "integer", "format": "int32", "minimum": 0}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
 		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
-		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
-		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
-		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
 		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
-		return map[string]any{"type": "integer"}
-	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
-		descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
-		return map[string]any{"type": "number"}
+		// Fields with a jstype of JS_STRING are encoded as decimal strings
+		if field.GetOptions().GetJstype() == descriptorpb.FieldOptions_JS_STRING {
+			return map[string]any{"type": "string", "format": "int64", "pattern": `^-?[0-9]+$`}
+		}
+		return map[string]any{"type": "integer", "format": "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if field.GetOptions().GetJstype() == descriptorpb.FieldOptions_JS_STRING {
+			return map[string]any{"type": "string", "format": "int64", "pattern": `^[0-9]+$`}
+		}
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return map[string]any{"type": "number", "format": "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return map[string]any{"type": "number", "format": "double"}
 	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
 		return map[string]any{"type": "boolean"}
 	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
-		return map[string]any{
-			"type":   "string",
-			"format": "byte",
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
-		// Reference to another message
-		typeName := field.GetTypeName()
-		// Remove leading dot from type name
-		typeName = strings.TrimPrefix(typeName, ".")
-
-		// Handle well-known types
-		switch typeName {
-		case "google.protobuf.Timestamp":
-			return map[string]any{
-				"type":   "string",
-				"format": "date-time",
-			}
-		case "google.protobuf.Duration":
-			return map[string]any{
-				"type":   "string",
-				"format": "duration",
-			}
-		case "google.protobuf.Empty":
-			return map[string]any{
-				"type": "object",
-			}
-		}
-
-		return map[string]any{
-			"$ref": fmt.Sprintf("#/components/schemas/%s", typeName),
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
 		// Groups are deprecated, treat as message
-		return map[string]any{
-			"$ref": fmt.Sprintf("#/components/schemas/%s", field.GetTypeName()),
+		typeName := strings.TrimPrefix(field.GetTypeName(), ".")
+		if schema, ok := wellKnownTypeSchema(typeName); ok {
+			return schema
 		}
+		return map[string]any{"$ref": schemaRefPrefix + typeName}
 	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
-		// Enum types
-		return map[string]any{
-			"type": "string",
-			"enum": []string{}, // Would need enum values from descriptor
-		}
+		return map[string]any{"$ref": schemaRefPrefix + strings.TrimPrefix(field.GetTypeName(), ".")}
 	default:
 		return map[string]any{"type": "string"}
 	}
 }
 
-// processService processes a service into API paths.
-func processService(spec *OpenAPISpec, file *descriptorpb.FileDescriptorProto, svc *descriptorpb.ServiceDescriptorProto) error {
-	for _, method := range svc.Method {
-		path := fmt.Sprintf("/%s.%s/%s", file.GetPackage(), svc.GetName(), method.GetName())
+// wellKnownTypeSchema returns the JSON representation of a well-known type.
+func wellKnownTypeSchema(typeName string) (map[string]any, bool) {
+	switch typeName {
+	case "google.protobuf.Timestamp":
+		return map[string]any{"type": "string", "format": "date-time"}, true
+	case "google.protobuf.Duration":
+		return map[string]any{"type": "string", "format": "duration", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}, true
+	case "google.protobuf.Empty":
+		return map[string]any{"type": "object"}, true
+	case "google.protobuf.Struct":
+		return map[string]any{"type": "object", "additionalProperties": true}, true
+	case "google.protobuf.Value":
+		return map[string]any{"description": "Any JSON value"}, true
+	case "google.protobuf.ListValue":
+		return map[string]any{"type": "array", "items": map[string]any{}}, true
+	case "google.protobuf.Any":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"@type": map[string]any{"type": "string"},
+			},
+			"required":             []string{"@type"},
+			"additionalProperties": true,
+		}, true
+	case "google.protobuf.FieldMask":
+		return map[string]any{"type": "string", "description": "Comma-separated field paths"}, true
+	case "google.protobuf.StringValue":
+		return map[string]any{"type": []string{"string", "null"}}, true
+	case "google.protobuf.BytesValue":
+		return map[string]any{"type": []string{"string", "null"}, "contentEncoding": "base64"}, true
+	case "google.protobuf.BoolValue":
+		return map[string]any{"type": []string{"boolean", "null"}}, true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return map[string]any{"type": []string{"integer", "null"}, "format": "int32"}, true
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return map[string]any{"type": []string{"integer", "null"}, "format": "int64"}, true
+	case "google.protobuf.FloatValue":
+		return map[string]any{"type": []string{"number", "null"}, "format": "float"}, true
+	case "google.protobuf.DoubleValue":
+		return map[string]any{"type": []string{"number", "null"}, "format": "double"}, true
+	}
+	return nil, false
+}
+
+// addEnumSchema adds the schema of an enum. Enums are represented by value names.
+func (g *openAPIGenerator) addEnumSchema(fullName string, enum *descriptorpb.EnumDescriptorProto, comments sourceComments, path []int32) {
+	values := make([]string, 0, len(enum.Value))
+	var documented []string
+	for i, value := range enum.Value {
+		values = append(values, value.GetName())
+		if doc := comments.leading(appendPath(path, pathEnumValue, pathIndex(i))); doc != "" {
+			documented = append(documented, fmt.Sprintf("- %s: %s", value.GetName(), doc))
+		}
+	}
+
+	schema := map[string]any{
+		"type": "string",
+		"enum": values,
+	}
+	description := comments.leading(path)
+	if len(documented) > 0 {
+		description = strings.TrimSpace(description + "\n\n" + strings.Join(documented, "\n"))
+	}
+	if description != "" {
+		schema["description"] = description
+	}
+	g.spec.Components.Schemas[fullName] = schema
+}
+
+// addErrorSchemas adds the schemas of Connect error responses.
+func (g *openAPIGenerator) addErrorSchemas() {
+	g.spec.Components.Schemas[ErrorSchemaName] = map[string]any{
+		"type":        "object",
+		"description": "Connect protocol error",
+		"properties": map[string]any{
+			"code": map[string]any{
+				"type": "string",
+				"enum": []string{
+					"canceled", "unknown", "invalid_argument", "deadline_exceeded",
+					"not_found", "already_exists", "permission_denied", "resource_exhausted",
+					"failed_precondition", "aborted", "out_of_range", "unimplemented",
+					"internal", "unavailable", "data_loss", "unauthenticated",
+				},
+			},
+			"message": map[string]any{"type": "string"},
+			"details": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"$ref": schemaRefPrefix + errorDetailSchemaName},
+			},
+		},
+		"required": []string{"code"},
+	}
+	g.spec.Components.Schemas[errorDetailSchemaName] = map[string]any{
+		"type":        "object",
+		"description": "Error detail carrying a serialized protobuf message",
+		"properties": map[string]any{
+			"type":  map[string]any{"type": "string", "description": "Fully-qualified message name"},
+			"value": map[string]any{"type": "string", "contentEncoding": "base64"},
+			"debug": map[string]any{"type": "object", "additionalProperties": true},
+		},
+	}
+}
+
+// processService processes a service into API paths. Operation IDs are
+// "Service_Method", qualified with the package if services of several
+// packages share the name.
+func (g *openAPIGenerator) processService(file *descriptorpb.FileDescriptorProto, svc *descriptorpb.ServiceDescriptorProto, comments sourceComments, path []int32) error {
+	serviceName := qualifiedName(file.GetPackage(), svc.GetName())
+	operationPrefix := svc.GetName()
+	if g.serviceNames[svc.GetName()] > 1 {
+		operationPrefix = strings.ReplaceAll(serviceName, ".", "_")
+	}
+
+	for i, method := range svc.Method {
+		methodPath := fmt.Sprintf("/%s/%s", serviceName, method.GetName())
 
 		// Get input and output types, removing leading dots
-		inputType := method.GetInputType()
-		outputType := method.GetOutputType()
-		inputType = strings.TrimPrefix(inputType, ".")
-		outputType = strings.TrimPrefix(outputType, ".")
+		inputType := strings.TrimPrefix(method.GetInputType(), ".")
+		outputType := strings.TrimPrefix(method.GetOutputType(), ".")
+
+		contentType := contentTypeJSON
+		if method.GetClientStreaming() || method.GetServerStreaming() {
+			contentType = contentTypeConnectJSON
+		}
 
 		operation := map[string]any{
-			"operationId": fmt.Sprintf("%s_%s", svc.GetName(), method.GetName()),
+			"operationId": fmt.Sprintf("%s_%s", operationPrefix, method.GetName()),
+			"tags":        []string{serviceName},
 			"requestBody": map[string]any{
 				"required": true,
 				"content": map[string]any{
-					"application/json": map[string]any{
-						"schema": map[string]any{
-							"$ref": fmt.Sprintf("#/components/schemas/%s", inputType),
-						},
-					},
+					contentType: g.mediaType(inputType),
 				},
 			},
 			"responses": map[string]any{
 				"200": map[string]any{
 					"description": "Success",
 					"content": map[string]any{
-						"application/json": map[string]any{
-							"schema": map[string]any{
-								"$ref": fmt.Sprintf("#/components/schemas/%s", outputType),
-							},
+						contentType: g.mediaType(outputType),
+					},
+				},
+				"default": map[string]any{
+					"description": "Error",
+					"content": map[string]any{
+						contentTypeJSON: map[string]any{
+							"schema": map[string]any{"$ref": schemaRefPrefix + ErrorSchemaName},
 						},
 					},
 				},
 			},
 		}
 
-		spec.Paths[path] = map[string]any{
+		if description := comments.leading(appendPath(path, pathServiceMethod, pathIndex(i))); description != "" {
+			operation["summary"] = firstSentence(description)
+			operation["description"] = description
+		}
+		if method.GetOptions().GetDeprecated() || svc.GetOptions().GetDeprecated() {
+			operation["deprecated"] = true
+		}
+
+		g.spec.Paths[methodPath] = map[string]any{
 			"post": operation,
 		}
 	}
@@ -232,6 +474,313 @@ func processService(spec *OpenAPISpec, file *descriptorpb.FileDescriptorProto, s
 	return nil
 }
 
+// mediaType returns a media type object referencing a message with an example.
+func (g *openAPIGenerator) mediaType(typeName string) map[string]any {
+	media := map[string]any{}
+	if schema, ok := wellKnownTypeSchema(typeName); ok {
+		media["schema"] = schema
+	} else {
+		media["schema"] = map[string]any{"$ref": schemaRefPrefix + typeName}
+	}
+	if example := g.example(media["schema"], 0); example != nil {
+		media["example"] = example
+	}
+	return media
+}
+
+// example builds an example value for a schema.
+func (g *openAPIGenerator) example(schema any, depth int) any {
+	object, ok := schema.(map[string]any)
+	if !ok || depth > maxExampleDepth {
+		return nil
+	}
+
+	if ref, ok := object["$ref"].(string); ok {
+		return g.example(g.spec.Components.Schemas[strings.TrimPrefix(ref, schemaRefPrefix)], depth+1)
+	}
+	if values, ok := object["enum"].([]string); ok && len(values) > 0 {
+		return values[0]
+	}
+
+	schemaType := object["type"]
+	if types, ok := schemaType.([]string); ok && len(types) > 0 {
+		schemaType = types[0]
+	}
+
+	switch schemaType {
+	case "object":
+		result := map[string]any{}
+		properties, _ := object["properties"].(map[string]any)
+		for name, property := range properties {
+			if value := g.example(property, depth+1); value != nil {
+				result[name] = value
+			}
+		}
+		return result
+	case "array":
+		if item := g.example(object["items"], depth+1); item != nil {
+			return []any{item}
+		}
+		return []any{}
+	case "string":
+		switch object["format"] {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "duration":
+			return "1.5s"
+		case "email":
+			return "user@example.com"
+		case "uri":
+			return "https://example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "int64":
+			return "0"
+		}
+		if object["contentEncoding"] == "base64" {
+			return ""
+		}
+		return "string"
+	case "integer":
+		if minimum, ok := object["minimum"].(float64); ok {
+			return int64(minimum)
+		}
+		return 0
+	case "number":
+		if minimum, ok := object["minimum"].(float64); ok {
+			return minimum
+		}
+		return 0.0
+	case "boolean":
+		return false
+	default:
+		return nil
+	}
+}
+
+// defaultValue returns the default of a field, applied by servers to unset
+// fields: the value of its `default` tag, recorded in the trailing comment by
+// the schema builder, or the default of proto2 and Editions descriptors. It is
+// typed like the field schema.
+func defaultValue(fieldSchema map[string]any, field *descriptorpb.FieldDescriptorProto, comment string) (any, bool) {
+	value, ok := schema.ParseDefaultComment(comment)
+	if !ok {
+		if field.DefaultValue == nil || field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+			return nil, false
+		}
+		value = field.GetDefaultValue()
+	}
+
+	var typed any
+	var err error
+	switch fieldSchema["type"] {
+	case "integer":
+		typed, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			typed, err = strconv.ParseUint(value, 10, 64)
+		}
+	case "number":
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, false // Not representable in JSON
+		}
+		typed = f
+	case "boolean":
+		typed, err = strconv.ParseBool(value)
+	default:
+		if fieldSchema["contentEncoding"] != nil {
+			return nil, false // Escaped bytes of descriptors
+		}
+		typed = value
+	}
+	if err != nil {
+		return nil, false
+	}
+	return typed, true
+}
+
+// validationRule is a rule recorded by the schema builder from a validate tag.
+type validationRule struct {
+	name  string
+	value string
+}
+
+// validationRulePattern matches "@name" and "@name(value)" in validation comments.
+var validationRulePattern = regexp.MustCompile(`@(\w+)(?:\(([^)]*)\))?`)
+
+// parseValidationComment parses a "Validation: @required @min(3)" comment,
+// the first line of the trailing comments the schema builder records.
+func parseValidationComment(comment string) []validationRule {
+	comment, _, _ = strings.Cut(strings.TrimSpace(comment), "\n")
+	if !strings.HasPrefix(comment, validationCommentPrefix) {
+		return nil
+	}
+	var rules []validationRule
+	for _, match := range validationRulePattern.FindAllStringSubmatch(comment, -1) {
+		rules = append(rules, validationRule{name: match[1], value: match[2]})
+	}
+	return rules
+}
+
+// applyValidationKeywords adds JSON Schema keywords for validation rules and
+// reports whether the field is required.
+func applyValidationKeywords(schema map[string]any, field *descriptorpb.FieldDescriptorProto, rules []validationRule) bool {
+	required := false
+	kind := schemaKind(schema, field)
+
+	for _, rule := range rules {
+		number, numErr := strconv.ParseFloat(rule.value, 64)
+		switch rule.name {
+		case "required":
+			required = true
+		case "min", "gte", "max", "lte", "len", "gt", "lt":
+			if numErr != nil {
+				continue
+			}
+			applyBound(schema, kind, rule.name, number)
+		case "oneof":
+			if kind == "string" {
+				schema["enum"] = strings.Fields(rule.value)
+			}
+		case "email":
+			schema["format"] = "email"
+		case "url", "uri":
+			schema["format"] = "uri"
+		case "uuid", "uuid4":
+			schema["format"] = "uuid"
+		case "ipv4":
+			schema["format"] = "ipv4"
+		case "ipv6":
+			schema["format"] = "ipv6"
+		case "alpha":
+			schema["pattern"] = "^[a-zA-Z]+$"
+		case "alphanum":
+			schema["pattern"] = "^[a-zA-Z0-9]+$"
+		case "numeric":
+			schema["pattern"] = "^[0-9]+$"
+		}
+	}
+	return required
+}
+
+// schemaKind returns the JSON Schema kind constrained by size rules.
+func schemaKind(schema map[string]any, field *descriptorpb.FieldDescriptorProto) string {
+	switch schema["type"] {
+	case "array":
+		return "array"
+	case "object":
+		return "object"
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	}
+	if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING {
+		return "string"
+	}
+	return ""
+}
+
+// applyBound adds the keyword for a size or range rule, which go-playground/validator
+// applies to lengths of strings, arrays, and maps and to values of numbers.
+func applyBound(schema map[string]any, kind, rule string, value float64) {
+	keywords := map[string]map[string]string{
+		"string": {"min": "minLength", "gte": "minLength", "max": "maxLength", "lte": "maxLength"},
+		"array":  {"min": "minItems", "gte": "minItems", "max": "maxItems", "lte": "maxItems"},
+		"object": {"min": "minProperties", "gte": "minProperties", "max": "maxProperties", "lte": "maxProperties"},
+		"number": {"min": "minimum", "gte": "minimum", "max": "maximum", "lte": "maximum", "gt": "exclusiveMinimum", "lt": "exclusiveMaximum"},
+	}[kind]
+	if keywords == nil {
+		return
+	}
+
+	if rule == "len" {
+		if kind == "number" {
+			return
+		}
+		schema[keywords["min"]] = int(value)
+		schema[keywords["max"]] = int(value)
+		return
+	}
+	keyword, ok := keywords[rule]
+	if !ok {
+		return
+	}
+	if kind == "number" {
+		schema[keyword] = value
+	} else {
+		schema[keyword] = int(value)
+	}
+}
+
+// indexComments indexes the locations of a file by path.
+func indexComments(info *descriptorpb.SourceCodeInfo) sourceComments {
+	comments := make(sourceComments)
+	for _, location := range info.GetLocation() {
+		comments[pathKey(location.GetPath())] = location
+	}
+	return comments
+}
+
+// leading returns the trimmed leading comment at path.
+func (c sourceComments) leading(path []int32) string {
+	return trimComment(c[pathKey(path)].GetLeadingComments())
+}
+
+// trailing returns the trimmed trailing comment at path.
+func (c sourceComments) trailing(path []int32) string {
+	return trimComment(c[pathKey(path)].GetTrailingComments())
+}
+
+// trimComment removes the space starting each line of a comment, as protoc
+// keeps it after "//", and the surrounding whitespace.
+func trimComment(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// pathKey converts a SourceCodeInfo path into a map key.
+func pathKey(path []int32) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = strconv.Itoa(int(p))
+	}
+	return strings.Join(parts, ".")
+}
+
+// appendPath returns a copy of path with elements appended.
+func appendPath(path []int32, elems ...int32) []int32 {
+	result := make([]int32, 0, len(path)+len(elems))
+	result = append(result, path...)
+	return append(result, elems...)
+}
+
+// qualifiedName joins a package and a name.
+func qualifiedName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// firstSentence returns the first sentence or line of a description.
+func firstSentence(description string) string {
+	line, _, _ := strings.Cut(description, "\n")
+	if idx := strings.Index(line, ". "); idx != -1 {
+		return line[:idx+1]
+	}
+	return line
+}
+
+// pathIndex converts a descriptor index into a path element.
+func pathIndex(i int) int32 {
+	return int32(i) //nolint:gosec // descriptor indices fit in int32
+}
+
 // MarshalOpenAPI marshals the OpenAPI spec to JSON.
 func MarshalOpenAPI(spec *OpenAPISpec) ([]byte, error) {
 	return json.MarshalIndent(spec, "", "  ")
@@ -0,0 +1,283 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultAPIVersion is the OpenAPI version of services without a schema hash.
+const defaultAPIVersion = "1.0.0"
+
+// schemaVersionLength is the number of hex digits of the schema hash used as
+// the OpenAPI document version.
+const schemaVersionLength = 12
+
+// OpenAPISecurityScheme is an OpenAPI security scheme object.
+type OpenAPISecurityScheme struct {
+	Type             string `json:"type"`
+	Description      string `json:"description,omitempty"`
+	Scheme           string `json:"scheme,omitempty"`
+	BearerFormat     string `json:"bearerFormat,omitempty"`
+	OpenIDConnectURL string `json:"openIdConnectUrl,omitempty"`
+}
+
+// ServiceSecurity describes how calls to a service are authenticated, for
+// OpenAPI documents.
+type ServiceSecurity struct {
+	// Schemes are the accepted security schemes by name; any one of them
+	// authenticates a call
+	Schemes map[string]OpenAPISecurityScheme
+	// PublicMethods can be called without credentials
+	PublicMethods []string
+	// Optional means calls without credentials are accepted too
+	Optional bool
+}
+
+// openAPIDocuments generates the merged OpenAPI document of all services and
+// one document per package.
+func (g *Gateway) openAPIDocuments() error {
+	merged, err := g.buildOpenAPI(OpenAPIInfo{Title: defaultAPITitle}, g.services)
+	if err != nil {
+		return err
+	}
+	if g.openAPI, err = MarshalOpenAPI(merged); err != nil {
+		return fmt.Errorf("failed to marshal OpenAPI: %w", err)
+	}
+
+	byPackage := make(map[string][]*Service)
+	for _, svc := range g.services {
+		byPackage[svc.Package] = append(byPackage[svc.Package], svc)
+	}
+	g.openAPIByPackage = make(map[string][]byte, len(byPackage))
+	for pkg, services := range byPackage {
+		spec, err := g.buildOpenAPI(OpenAPIInfo{Title: pkg}, services)
+		if err != nil {
+			return fmt.Errorf("package %s: %w", pkg, err)
+		}
+		if g.openAPIByPackage[pkg], err = MarshalOpenAPI(spec); err != nil {
+			return fmt.Errorf("failed to marshal OpenAPI of package %s: %w", pkg, err)
+		}
+	}
+	return nil
+}
+
+// buildOpenAPI generates the OpenAPI document of services, with the servers
+// of the gateway options and the security of each service. The version is
+// derived from the schema hashes of the services, so it changes whenever
+// their messages or methods do.
+func (g *Gateway) buildOpenAPI(info OpenAPIInfo, services []*Service) (*OpenAPISpec, error) {
+	info.Version = schemaVersion(services)
+	if len(services) == 1 && info.Description == "" {
+		info.Description = serviceDescription(services[0])
+	}
+
+	fdset, err := MergeDescriptors(services)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := GenerateOpenAPI(fdset, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate OpenAPI: %w", err)
+	}
+	spec.Servers = g.options.OpenAPIServers
+	for _, svc := range services {
+		if err := applySecurity(spec, svc); err != nil {
+			return nil, err
+		}
+		applyRoutes(spec, svc)
+	}
+	return spec, nil
+}
+
+// schemaVersion returns a version identifying the schemas of services.
+func schemaVersion(services []*Service) string {
+	if len(services) == 1 && len(services[0].SchemaHash) >= schemaVersionLength {
+		return services[0].SchemaHash[:schemaVersionLength]
+	}
+
+	hashes := make([]string, 0, len(services))
+	for _, svc := range services {
+		if svc.SchemaHash == "" {
+			return defaultAPIVersion
+		}
+		hashes = append(hashes, svc.Package+"."+svc.Name+"="+svc.SchemaHash)
+	}
+	if len(hashes) == 0 {
+		return defaultAPIVersion
+	}
+	sort.Strings(hashes)
+	sum := sha256.Sum256([]byte(strings.Join(hashes, "\n")))
+	return hex.EncodeToString(sum[:])[:schemaVersionLength]
+}
+
+// serviceDescription returns the leading comment of a service, if any.
+func serviceDescription(svc *Service) string {
+	if svc.Descriptors == nil {
+		return ""
+	}
+	for _, file := range svc.Descriptors.File {
+		comments := indexComments(file.GetSourceCodeInfo())
+		for i, s := range file.Service {
+			if s.GetName() == svc.Name {
+				return comments.leading([]int32{pathFileService, pathIndex(i)})
+			}
+		}
+	}
+	return ""
+}
+
+// applySecurity adds the security schemes of svc to spec and the security
+// requirements to its operations. Public methods get an empty requirement, and
+// optional authentication an empty alternative.
+func applySecurity(spec *OpenAPISpec, svc *Service) error {
+	security := svc.Security
+	if security == nil || len(security.Schemes) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(security.Schemes))
+	for name, scheme := range security.Schemes {
+		if existing, ok := spec.Components.SecuritySchemes[name]; ok && existing != scheme {
+			return fmt.Errorf("conflicting OpenAPI security schemes named %s", name)
+		}
+		if spec.Components.SecuritySchemes == nil {
+			spec.Components.SecuritySchemes = make(map[string]OpenAPISecurityScheme)
+		}
+		spec.Components.SecuritySchemes[name] = scheme
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	requirements := make([]map[string][]string, 0, len(names)+1)
+	for _, name := range names {
+		requirements = append(requirements, map[string][]string{name: {}})
+	}
+	if security.Optional {
+		requirements = append(requirements, map[string][]string{})
+	}
+
+	prefix := "/" + qualifiedName(svc.Package, svc.Name) + "/"
+	for path, item := range spec.Paths {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		operation, ok := item.(map[string]any)["post"].(map[string]any)
+		if !ok {
+			continue
+		}
+		if slices.Contains(security.PublicMethods, strings.TrimPrefix(path, prefix)) {
+			operation["security"] = []map[string][]string{}
+		} else {
+			operation["security"] = requirements
+		}
+	}
+	return nil
+}
+
+// applyRoutes adds the path templates of svc to spec. Each copies the
+// operation of its method with the template variables as path parameters and
+// an optional request body.
+func applyRoutes(spec *OpenAPISpec, svc *Service) {
+	for _, route := range svc.Routes {
+		item, _ := spec.Paths["/"+qualifiedName(svc.Package, svc.Name)+"/"+route.Method].(map[string]any)
+		method, ok := item["post"].(map[string]any)
+		if !ok {
+			continue
+		}
+		template, err := ParsePathTemplate(route.Template)
+		if err != nil {
+			continue
+		}
+
+		operation := maps.Clone(method)
+		operation["operationId"] = fmt.Sprintf("%s_Path", method["operationId"])
+		if body, ok := method["requestBody"].(map[string]any); ok {
+			body = maps.Clone(body)
+			body["required"] = false
+			operation["requestBody"] = body
+		}
+
+		inputSchema := requestSchema(spec, method)
+		parameters := make([]map[string]any, 0, len(template.Variables()))
+		for _, variable := range template.Variables() {
+			parameters = append(parameters, map[string]any{
+				"name":     variable,
+				"in":       "path",
+				"required": true,
+				"schema":   pathParameterSchema(spec, inputSchema, variable),
+			})
+		}
+		operation["parameters"] = parameters
+		spec.Paths[route.Template] = map[string]any{"post": operation}
+	}
+}
+
+// requestSchema returns the schema of the request body of operation.
+func requestSchema(spec *OpenAPISpec, operation map[string]any) map[string]any {
+	body, _ := operation["requestBody"].(map[string]any)
+	content, _ := body["content"].(map[string]any)
+	for _, media := range content {
+		schema, _ := media.(map[string]any)["schema"].(map[string]any)
+		return resolveSchemaRef(spec, schema)
+	}
+	return nil
+}
+
+// resolveSchemaRef returns the component schema referenced by schema, or
+// schema itself if it is not a reference.
+func resolveSchemaRef(spec *OpenAPISpec, schema map[string]any) map[string]any {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, _ := spec.Components.Schemas[strings.TrimPrefix(ref, schemaRefPrefix)].(map[string]any)
+		return resolved
+	}
+	return schema
+}
+
+// pathParameterSchema returns the schema of the field at a dot-separated
+// path of schema, or a string schema if it cannot be resolved. Segments
+// match property names regardless of case and underscores.
+func pathParameterSchema(spec *OpenAPISpec, schema map[string]any, path string) map[string]any {
+	for _, segment := range strings.Split(path, ".") {
+		properties, _ := schema["properties"].(map[string]any)
+		var field map[string]any
+		for name, property := range properties {
+			if strings.EqualFold(strings.ReplaceAll(name, "_", ""), strings.ReplaceAll(segment, "_", "")) {
+				field, _ = property.(map[string]any)
+				break
+			}
+		}
+		if schema = resolveSchemaRef(spec, field); schema == nil {
+			return map[string]any{"type": "string"}
+		}
+	}
+	return schema
+}
+
+// openAPIPackagePrefix returns the path under which per-package documents are
+// served: "/openapi/" for the default "/openapi.json".
+func (g *Gateway) openAPIPackagePrefix() string {
+	return strings.TrimSuffix(g.options.OpenAPIPath, ".json") + "/"
+}
+
+// serveOpenAPIPackage serves the document of the package named by the path,
+// e.g. "/openapi/user.v1.json". It reports false for other paths.
+func (g *Gateway) serveOpenAPIPackage(w http.ResponseWriter, r *http.Request) bool {
+	name, ok := strings.CutPrefix(r.URL.Path, g.openAPIPackagePrefix())
+	if !ok || !strings.HasSuffix(name, ".json") {
+		return false
+	}
+	doc, ok := g.openAPIByPackage[strings.TrimSuffix(name, ".json")]
+	if !ok {
+		http.NotFound(w, r)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(doc)
+	return true
+}
@@ -0,0 +1,307 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/auth"
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type OpenAPIAddress struct {
+	City string `json:"city" doc:"City name"`
+}
+
+type OpenAPICreateUserRequest struct {
+	Name      string            `json:"name" validate:"required,min=3,max=50" doc:"Display name"`
+	Email     string            `json:"email" validate:"required,email"`
+	Age       int32             `json:"age" validate:"gte=0,lte=150"`
+	Tags      []string          `json:"tags" validate:"max=5"`
+	Labels    map[string]string `json:"labels"`
+	Address   *OpenAPIAddress   `json:"address"`
+	BirthDate time.Time         `json:"birth_date"`
+	Role      string            `json:"role" validate:"oneof=admin member"`
+	Password  string            `json:"password" sensitive:"true"`
+	Secrets   map[string]string `json:"secrets" sensitive:"true"`
+}
+
+type OpenAPICreateUserResponse struct {
+	ID string `json:"id"`
+}
+
+// schemaAt walks a decoded spec along keys.
+func schemaAt(t *testing.T, v any, keys ...string) map[string]any {
+	t.Helper()
+	for _, key := range keys {
+		object, ok := v.(map[string]any)
+		if !ok {
+			t.Fatalf("Expected object at %q, got %T", key, v)
+		}
+		v = object[key]
+	}
+	object, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected object at %v, got %T", keys, v)
+	}
+	return object
+}
+
+func decodeSpec(t *testing.T, spec *gateway.OpenAPISpec) map[string]any {
+	t.Helper()
+	data, err := gateway.MarshalOpenAPI(spec)
+	if err != nil {
+		t.Fatalf("Failed to marshal spec: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode spec: %v", err)
+	}
+	return decoded
+}
+
+func TestGenerateOpenAPIFromService(t *testing.T) {
+	svc := rpc.NewService("UserService", rpc.WithPackage("user.v1"))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewMethod("CreateUser", func(ctx context.Context, req *OpenAPICreateUserRequest) (*OpenAPICreateUserResponse, error) {
+			return &OpenAPICreateUserResponse{}, nil
+		}).WithDescription("Creates a user. Names must be unique."),
+	)
+
+	spec, err := gateway.GenerateOpenAPI(svc.GetFileDescriptorSet(), gateway.OpenAPIInfo{Title: "Users", Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("Failed to generate OpenAPI: %v", err)
+	}
+	doc := decodeSpec(t, spec)
+
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("Expected OpenAPI 3.1.0, got %v", doc["openapi"])
+	}
+
+	request := schemaAt(t, doc, "components", "schemas", "user.v1.OpenAPICreateUserRequest")
+	if !reflect.DeepEqual(request["required"], []any{"name", "email"}) {
+		t.Errorf("Expected name and email to be required, got %v", request["required"])
+	}
+
+	properties := schemaAt(t, request, "properties")
+	tests := []struct {
+		field string
+		want  map[string]any
+	}{
+		{"name", map[string]any{"type": "string", "minLength": 3.0, "maxLength": 50.0, "description": "Display name"}},
+		{"email", map[string]any{"type": "string", "format": "email"}},
+		{"age", map[string]any{"type": "integer", "format": "int32", "minimum": 0.0, "maximum": 150.0}},
+		{"tags", map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "maxItems": 5.0}},
+		{"labels", map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}},
+		{"address", map[string]any{"$ref": "#/components/schemas/user.v1.OpenAPIAddress"}},
+		{"birth_date", map[string]any{"type": "string", "format": "date-time"}},
+		{"role", map[string]any{"type": "string", "enum": []any{"admin", "member"}}},
+		{"password", map[string]any{"type": "string", "format": "password", "x-sensitive": true}},
+		{"secrets", map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "x-sensitive": true}},
+	}
+	for _, tt := range tests {
+		if got := properties[tt.field]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.field, tt.want, got)
+		}
+	}
+
+	address := schemaAt(t, doc, "components", "schemas", "user.v1.OpenAPIAddress", "properties", "city")
+	if address["description"] != "City name" {
+		t.Errorf("Expected nested message field description, got %v", address)
+	}
+
+	operation := schemaAt(t, doc, "paths", "/user.v1.UserService/CreateUser", "post")
+	if operation["summary"] != "Creates a user." || operation["description"] != "Creates a user. Names must be unique." {
+		t.Errorf("Expected method description, got summary %v description %v", operation["summary"], operation["description"])
+	}
+	errorRef := schemaAt(t, operation, "responses", "default", "content", "application/json", "schema")
+	if errorRef["$ref"] != "#/components/schemas/"+gateway.ErrorSchemaName {
+		t.Errorf("Expected error response schema, got %v", errorRef)
+	}
+	schemaAt(t, doc, "components", "schemas", gateway.ErrorSchemaName)
+
+	example := schemaAt(t, operation, "requestBody", "content", "application/json", "example")
+	if example["birth_date"] != "2024-01-01T00:00:00Z" || example["email"] != "user@example.com" {
+		t.Errorf("Unexpected request example: %v", example)
+	}
+}
+
+func TestGenerateOpenAPIEnumsAndNestedTypes(t *testing.T) {
+	fdset := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("shop.proto"),
+			Package: proto.String("shop.v1"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("status"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(),
+						TypeName: proto.String(".shop.v1.Order.Status"),
+					},
+					{
+						Name:     proto.String("items"),
+						Number:   proto.Int32(2),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".shop.v1.Order.Item"),
+					},
+					{
+						Name:     proto.String("note"),
+						Number:   proto.Int32(3),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".google.protobuf.StringValue"),
+					},
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Item"),
+					Field: []*descriptorpb.FieldDescriptorProto{{
+						Name:   proto.String("sku"),
+						Number: proto.Int32(1),
+						Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					}},
+				}},
+				EnumType: []*descriptorpb.EnumDescriptorProto{{
+					Name: proto.String("Status"),
+					Value: []*descriptorpb.EnumValueDescriptorProto{
+						{Name: proto.String("STATUS_UNSPECIFIED"), Number: proto.Int32(0)},
+						{Name: proto.String("STATUS_PAID"), Number: proto.Int32(1)},
+					},
+				}},
+			}},
+			SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+				Location: []*descriptorpb.SourceCodeInfo_Location{
+					{Path: []int32{4, 0}, LeadingComments: proto.String(" An order.\n")},
+					{Path: []int32{4, 0, 4, 0, 2, 1}, LeadingComments: proto.String(" Payment received.\n")},
+				},
+			},
+		}},
+	}
+
+	spec, err := gateway.GenerateOpenAPI(fdset, gateway.OpenAPIInfo{})
+	if err != nil {
+		t.Fatalf("Failed to generate OpenAPI: %v", err)
+	}
+	doc := decodeSpec(t, spec)
+	schemas := schemaAt(t, doc, "components", "schemas")
+
+	order := schemaAt(t, schemas, "shop.v1.Order")
+	if order["description"] != "An order." {
+		t.Errorf("Expected message description, got %v", order["description"])
+	}
+	properties := schemaAt(t, order, "properties")
+	if ref := schemaAt(t, properties, "status")["$ref"]; ref != "#/components/schemas/shop.v1.Order.Status" {
+		t.Errorf("Expected enum reference, got %v", ref)
+	}
+	if ref := schemaAt(t, properties, "items", "items")["$ref"]; ref != "#/components/schemas/shop.v1.Order.Item" {
+		t.Errorf("Expected nested message reference, got %v", ref)
+	}
+	if note := schemaAt(t, properties, "note"); !reflect.DeepEqual(note["type"], []any{"string", "null"}) {
+		t.Errorf("Expected nullable string for StringValue, got %v", note)
+	}
+
+	status := schemaAt(t, schemas, "shop.v1.Order.Status")
+	if !reflect.DeepEqual(status["enum"], []any{"STATUS_UNSPECIFIED", "STATUS_PAID"}) {
+		t.Errorf("Expected enum values, got %v", status["enum"])
+	}
+	if status["description"] != "- STATUS_PAID: Payment received." {
+		t.Errorf("Expected enum value docs, got %v", status["description"])
+	}
+	schemaAt(t, schemas, "shop.v1.Order.Item")
+}
+
+func TestOpenAPIDocuments(t *testing.T) {
+	verifier, err := auth.NewOIDCVerifier(auth.OIDCConfig{Issuer: "https://login.example.com", Audiences: []string{"users-api"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := rpc.NewService("UserService", rpc.WithPackage("user.v1"),
+		rpc.WithAuth(rpc.AuthOptions{Verifier: verifier, PublicMethods: []string{"GetUser"}}))
+	handler := func(ctx context.Context, req *OpenAPICreateUserRequest) (*OpenAPICreateUserResponse, error) {
+		return &OpenAPICreateUserResponse{}, nil
+	}
+	rpc.MustRegister(users, "CreateUser", handler)
+	rpc.MustRegister(users, "GetUser", handler)
+	orders := rpc.NewService("OrderService", rpc.WithPackage("order.v1"))
+	rpc.MustRegister(orders, "CreateOrder", handler)
+
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{
+		EnableOpenAPI:  true,
+		OpenAPIServers: []gateway.OpenAPIServer{{URL: "https://api.example.com", Description: "Production"}},
+	}, users, orders)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	get := func(path string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var doc map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &doc)
+		return rec.Code, doc
+	}
+
+	_, merged := get("/openapi.json")
+	_, userDoc := get("/openapi/user.v1.json")
+	_, orderDoc := get("/openapi/order.v1.json")
+
+	if paths := schemaAt(t, merged, "paths"); len(paths) != 3 {
+		t.Errorf("Expected the merged spec to have all 3 methods, got %d", len(paths))
+	}
+	paths := schemaAt(t, userDoc, "paths")
+	if len(paths) != 2 {
+		t.Errorf("Expected the user.v1 spec to have 2 methods, got %d", len(paths))
+	}
+	for path := range paths {
+		if !strings.HasPrefix(path, "/user.v1.UserService/") {
+			t.Errorf("Unexpected path %s in the user.v1 spec", path)
+		}
+	}
+
+	// Versions follow the schema hash
+	info := schemaAt(t, userDoc, "info")
+	if info["title"] != "user.v1" || info["version"] != users.SchemaHash()[:12] {
+		t.Errorf("Expected user.v1 at version %s, got %v", users.SchemaHash()[:12], info)
+	}
+	mergedVersion := schemaAt(t, merged, "info")["version"]
+	if mergedVersion == info["version"] || mergedVersion == schemaAt(t, orderDoc, "info")["version"] {
+		t.Errorf("Expected the merged version to differ from the package versions, got %v", mergedVersion)
+	}
+
+	// Servers come from the gateway options
+	for _, doc := range []map[string]any{merged, userDoc, orderDoc} {
+		servers, _ := doc["servers"].([]any)
+		if len(servers) != 1 || servers[0].(map[string]any)["url"] != "https://api.example.com" {
+			t.Errorf("Expected the configured server, got %v", doc["servers"])
+		}
+	}
+
+	// Security schemes come from the OIDC issuers of the service
+	scheme := schemaAt(t, userDoc, "components", "securitySchemes", "oidc-login.example.com")
+	if scheme["type"] != "openIdConnect" || scheme["openIdConnectUrl"] != "https://login.example.com/.well-known/openid-configuration" {
+		t.Errorf("Unexpected security scheme %v", scheme)
+	}
+	create := schemaAt(t, paths, "/user.v1.UserService/CreateUser", "post")
+	if !reflect.DeepEqual(create["security"], []any{map[string]any{"oidc-login.example.com": []any{}}}) {
+		t.Errorf("Expected CreateUser to require the OIDC scheme, got %v", create["security"])
+	}
+	if public := schemaAt(t, paths, "/user.v1.UserService/GetUser", "post"); !reflect.DeepEqual(public["security"], []any{}) {
+		t.Errorf("Expected GetUser to be public, got %v", public["security"])
+	}
+	if _, ok := schemaAt(t, orderDoc, "components")["securitySchemes"]; ok {
+		t.Error("Expected no security schemes for order.v1")
+	}
+
+	if code, _ := get("/openapi/unknown.v1.json"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown package, got %d", code)
+	}
+}
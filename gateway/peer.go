@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxy headers carrying the addresses of clients
+const (
+	forwardedHeader     = "Forwarded"
+	xForwardedForHeader = "X-Forwarded-For"
+)
+
+// peerContextKey stores the Peer of a request.
+type peerContextKey struct{}
+
+// Peer describes the client of a request.
+type Peer struct {
+	// Addr is the network address of the connection, "host:port": the last
+	// proxy for requests forwarded by proxies, or the address sent with the
+	// PROXY protocol, see NewProxyProtocolListener
+	Addr string
+	// IP is the address of the client. For requests from trusted proxies it
+	// is read from the Forwarded or X-Forwarded-For headers.
+	IP netip.Addr
+	// Forwarded reports whether IP was read from proxy headers
+	Forwarded bool
+}
+
+// PeerFromContext returns the peer of the request served with ctx, set by
+// the gateway, or false outside of a gateway request.
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	peer, ok := ctx.Value(peerContextKey{}).(Peer)
+	return peer, ok
+}
+
+// PeerFromRequest returns the peer of r set by the gateway, or the peer of
+// its connection for requests served without a gateway.
+func PeerFromRequest(r *http.Request) Peer {
+	if peer, ok := PeerFromContext(r.Context()); ok {
+		return peer
+	}
+	return Peer{Addr: r.RemoteAddr, IP: parseHostIP(r.RemoteAddr)}
+}
+
+// parseTrustedProxies parses IP addresses and CIDR prefixes.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		ip = ip.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedIP reports whether ip belongs to one of prefixes.
+func trustedIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withPeer returns r with its Peer in the context. Proxy headers are only
+// followed from trusted proxies: starting at the connection, hops are walked
+// back from the last one while they were added by trusted proxies.
+func withPeer(r *http.Request, trusted []netip.Prefix) *http.Request {
+	peer := Peer{Addr: r.RemoteAddr, IP: parseHostIP(r.RemoteAddr)}
+	if len(trusted) > 0 && peer.IP.IsValid() {
+		hops := forwardedFor(r.Header)
+		for i := len(hops) - 1; i >= 0 && trustedIP(trusted, peer.IP); i-- {
+			ip := parseHostIP(hops[i])
+			if !ip.IsValid() {
+				break // "unknown" or obfuscated identifiers end the chain
+			}
+			peer.IP, peer.Forwarded = ip, true
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), peerContextKey{}, peer))
+}
+
+// forwardedFor returns the client addresses of the Forwarded header (RFC
+// 7239), or of the X-Forwarded-For header without one, first hop first.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, value := range h.Values(forwardedHeader) {
+		for element := range strings.SplitSeq(value, ",") {
+			for pair := range strings.SplitSeq(element, ";") {
+				key, node, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(node, `"`))
+				}
+			}
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, value := range h.Values(xForwardedForHeader) {
+		for hop := range strings.SplitSeq(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHostIP parses an IP address with or without a port, such as
+// "192.0.2.1", "192.0.2.1:443", "2001:db8::1", or "[2001:db8::1]:443".
+// It returns the zero Addr for other values.
+func parseHostIP(host string) netip.Addr {
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return ip.Unmap()
+	}
+	if addrPort, err := netip.ParseAddrPort(host); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	return netip.Addr{}
+}
+
+// clientIP returns the IP of the client of r as a string, or the remote
+// address if it is not an IP.
+func clientIP(r *http.Request) string {
+	if peer := PeerFromRequest(r); peer.IP.IsValid() {
+		return peer.IP.String()
+	}
+	return remoteIP(r.RemoteAddr)
+}
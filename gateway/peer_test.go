@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeer(t *testing.T) {
+	svc := &Service{
+		Name:    "EchoService",
+		Package: "test.v1",
+		Handlers: map[string]http.Handler{
+			"/test.v1.EchoService/Echo": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				peer, ok := PeerFromContext(r.Context())
+				if !ok {
+					t.Error("Expected the peer in the request context")
+				}
+				forwarded := ""
+				if peer.Forwarded {
+					forwarded = " forwarded"
+				}
+				_, _ = io.WriteString(w, peer.IP.String()+forwarded)
+			}),
+		},
+	}
+	gw, err := New([]*Service{svc}, Options{
+		TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"},
+		EnableDebug:    true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted proxy headers are ignored", "203.0.113.7:5000",
+			http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"X-Forwarded-For through trusted proxies", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-For": {"192.0.2.9, 198.51.100.1", "10.0.0.2"}}, "198.51.100.1 forwarded"},
+		{"Forwarded takes precedence", "10.0.0.1:5000",
+			http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https, for=198.51.100.2`}, "X-Forwarded-For": {"192.0.2.9"}},
+			"198.51.100.2 forwarded"},
+		{"Forwarded through a trusted IPv6 proxy", "10.0.0.1:5000",
+			http.Header{"Forwarded": {`for=198.51.100.3, for="[2001:db8::1]:4711"`}}, "198.51.100.3 forwarded"},
+		{"unknown hops end the chain", "10.0.0.1:5000",
+			http.Header{"Forwarded": {"for=198.51.100.4, for=unknown"}}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/test.v1.EchoService/Echo", strings.NewReader("{}"))
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Content-Type", "application/json")
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("Expected peer %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("debug endpoints authorize the client, not the proxy", func(t *testing.T) {
+		gw, err := New([]*Service{svc}, Options{TrustedProxies: []string{"127.0.0.1"}, EnableDebug: true})
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/debug/hyperway/services", nil)
+		req.RemoteAddr = "127.0.0.1:5000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a forwarded remote client to be forbidden, got %d", rec.Code)
+		}
+	})
+
+	t.Run("invalid trusted proxies fail the gateway", func(t *testing.T) {
+		if _, err := New([]*Service{svc}, Options{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+			t.Error("Expected an invalid prefix to fail")
+		}
+	})
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	serve := func(t *testing.T, trusted ...string) string {
+		t.Helper()
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxied, err := NewProxyProtocolListener(lis, trusted...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, r.RemoteAddr)
+			}),
+			ReadHeaderTimeout: time.Second,
+		}
+		go func() { _ = server.Serve(proxied) }()
+		t.Cleanup(func() { _ = server.Close() })
+		return lis.Addr().String()
+	}
+
+	// remoteAddr sends header and a request, and returns the remote address
+	// seen by the server, or "" if the connection was closed.
+	remoteAddr := func(t *testing.T, addr string, header []byte) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(append(header, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n"...)); err != nil {
+			return ""
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return ""
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	addr := serve(t)
+
+	t.Run("version 1", func(t *testing.T) {
+		if got := remoteAddr(t, addr, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 5555 80\r\n")); got != "203.0.113.7:5555" {
+			t.Errorf("Expected the client address of the header, got %q", got)
+		}
+	})
+
+	t.Run("version 2", func(t *testing.T) {
+		header := []byte(proxyV2Signature)
+		header = append(header, 0x21, 0x21) // PROXY command, TCP over IPv6
+		header = binary.BigEndian.AppendUint16(header, proxyV2Inet6Length)
+		header = append(header, net.ParseIP("2001:db8::7")...)
+		header = append(header, net.ParseIP("2001:db8::1")...)
+		header = binary.BigEndian.AppendUint16(header, 5555)
+		header = binary.BigEndian.AppendUint16(header, 80)
+		if got := remoteAddr(t, addr, header); got != "[2001:db8::7]:5555" {
+			t.Errorf("Expected the client address of the header, got %q", got)
+		}
+	})
+
+	t.Run("proxy health checks keep the connection address", func(t *testing.T) {
+		if got := remoteAddr(t, addr, []byte("PROXY UNKNOWN\r\n")); !strings.HasPrefix(got, "127.0.0.1:") {
+			t.Errorf("Expected the connection address, got %q", got)
+		}
+	})
+
+	t.Run("connections without a header are closed", func(t *testing.T) {
+		if got := remoteAddr(t, addr, nil); got != "" {
+			t.Errorf("Expected the connection to be closed, got %q", got)
+		}
+	})
+
+	t.Run("untrusted connections are served as they are", func(t *testing.T) {
+		addr := serve(t, "10.0.0.0/8")
+		if got := remoteAddr(t, addr, nil); !strings.HasPrefix(got, "127.0.0.1:") {
+			t.Errorf("Expected the connection address, got %q", got)
+		}
+	})
+}
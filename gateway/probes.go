@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe endpoint paths, relative to Options.ProbesBasePath
+const (
+	livezPath   = "/livez"
+	readyzPath  = "/readyz"
+	versionPath = "/version"
+	// defaultReadinessTimeout bounds Options.ReadinessCheck
+	defaultReadinessTimeout = 5 * time.Second
+)
+
+// BuildInfo describes the running build, as reported by the /version endpoint.
+type BuildInfo struct {
+	// Version is the release version (e.g. "v1.4.2")
+	Version string `json:"version,omitempty"`
+	// Commit is the VCS revision the binary was built from
+	Commit string `json:"commit,omitempty"`
+	// BuildTime is when the binary was built, typically RFC 3339
+	BuildTime string `json:"build_time,omitempty"`
+	// GoVersion is the Go version the binary was built with
+	GoVersion string `json:"go_version,omitempty"`
+}
+
+var (
+	buildInfoMu sync.RWMutex
+	buildInfo   *BuildInfo
+)
+
+// SetBuildInfo sets the build information reported by the /version endpoint,
+// usually from variables injected with -ldflags at build time:
+//
+//	var version, commit string // -ldflags "-X main.version=v1.4.2 -X main.commit=..."
+//
+//	gateway.SetBuildInfo(gateway.BuildInfo{Version: version, Commit: commit})
+//
+// Empty fields fall back to the module version and VCS stamps embedded by the
+// Go toolchain.
+func SetBuildInfo(info BuildInfo) {
+	buildInfoMu.Lock()
+	defer buildInfoMu.Unlock()
+	buildInfo = &info
+}
+
+// currentBuildInfo returns the build information set by SetBuildInfo,
+// completed from the build information embedded in the binary.
+func currentBuildInfo() BuildInfo {
+	buildInfoMu.RLock()
+	var info BuildInfo
+	if buildInfo != nil {
+		info = *buildInfo
+	}
+	buildInfoMu.RUnlock()
+
+	info.GoVersion = runtime.Version()
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+	for _, setting := range embedded.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildTime == "":
+			info.BuildTime = setting.Value
+		}
+	}
+	return info
+}
+
+// probePath returns the path of a probe endpoint.
+func (g *Gateway) probePath(path string) string {
+	return strings.TrimSuffix(g.options.ProbesBasePath, "/") + path
+}
+
+// serveProbe serves the probe endpoints and reports whether path is one.
+func (g *Gateway) serveProbe(w http.ResponseWriter, r *http.Request) bool {
+	var handler func(http.ResponseWriter, *http.Request)
+	switch r.URL.Path {
+	case g.probePath(livezPath):
+		handler = serveLivez
+	case g.probePath(readyzPath):
+		handler = g.serveReadyz
+	case g.probePath(versionPath):
+		handler = serveVersion
+	default:
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	handler(w, r)
+	return true
+}
+
+// serveLivez reports that the process is up.
+func serveLivez(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// serveReadyz reports whether the server can take traffic, as decided by
+// Options.ReadinessCheck.
+func (g *Gateway) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if check := g.options.ReadinessCheck; check != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), defaultReadinessTimeout)
+		defer cancel()
+		if err := check(ctx); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("not ready: " + err.Error() + "\n"))
+			return
+		}
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// serveVersion reports the build information as JSON.
+func serveVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(currentBuildInfo())
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProbeEndpoints(t *testing.T) {
+	var ready atomic.Bool
+	var logs bytes.Buffer
+	gw, err := New(nil, Options{
+		EnableProbes:   true,
+		ProbesBasePath: "/-/",
+		ReadinessCheck: func(context.Context) error {
+			if !ready.Load() {
+				return errors.New("warming up")
+			}
+			return nil
+		},
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	t.Run("livez", func(t *testing.T) {
+		if rec := serve(http.MethodGet, "/-/livez"); rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+			t.Errorf("Expected 200 ok, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("readyz", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/-/readyz")
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "warming up") {
+			t.Errorf("Expected 503 while not ready, got %d %q", rec.Code, rec.Body.String())
+		}
+		ready.Store(true)
+		if rec := serve(http.MethodGet, "/-/readyz"); rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 once ready, got %d", rec.Code)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		SetBuildInfo(BuildInfo{Version: "v1.4.2", Commit: "abc123"})
+		t.Cleanup(func() { SetBuildInfo(BuildInfo{}) })
+
+		rec := serve(http.MethodGet, "/-/version")
+		var info BuildInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatalf("Unexpected response %q: %v", rec.Body.String(), err)
+		}
+		if info.Version != "v1.4.2" || info.Commit != "abc123" || info.GoVersion != runtime.Version() {
+			t.Errorf("Unexpected build info %+v", info)
+		}
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		if rec := serve(http.MethodPost, "/-/livez"); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405, got %d", rec.Code)
+		}
+	})
+
+	t.Run("not access logged", func(t *testing.T) {
+		if logs.Len() != 0 {
+			t.Errorf("Expected no access logs for probes, got %s", logs.String())
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		gw, err := New(nil, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+		if rec.Body.String() == "ok\n" {
+			t.Error("Expected the probes to stay disabled")
+		}
+	})
+}
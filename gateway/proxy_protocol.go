@@ -0,0 +1,261 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol constants (https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt)
+const (
+	proxyV1Prefix       = "PROXY "
+	proxyV1MaxLength    = 107
+	proxyV1Fields       = 6 // PROXY, protocol, source, destination, ports
+	proxyV2Signature    = "\r\n\r\n\x00\r\nQUIT\n"
+	proxyV2HeaderLength = 16
+	proxyV2Version      = 0x2
+	proxyV2CommandLocal = 0x0
+	proxyV2CommandProxy = 0x1
+	proxyV2FamilyInet   = 0x1
+	proxyV2FamilyInet6  = 0x2
+	proxyV2Inet4Length  = 12 // Source and destination addresses and ports
+	proxyV2Inet6Length  = 36
+	nibbleBits          = 4
+	lowNibble           = 0xF
+	portBits            = 16
+)
+
+// Offsets in version 2 headers and address blocks
+const (
+	proxyV2CommandOffset = len(proxyV2Signature)
+	proxyV2FamilyOffset  = proxyV2CommandOffset + 1
+	proxyV2LengthOffset  = proxyV2FamilyOffset + 1
+	proxyV2Inet4Port     = 2 * net.IPv4len
+	proxyV2Inet6Port     = 2 * net.IPv6len
+)
+
+// errProxyHeader reports a missing or malformed PROXY protocol header.
+var errProxyHeader = errors.New("invalid PROXY protocol header")
+
+// NewProxyProtocolListener returns a listener for servers behind load
+// balancers sending the PROXY protocol, such as HAProxy or AWS Network Load
+// Balancers. It reads the version 1 or 2 header of accepted connections, and
+// their RemoteAddr is the client address it carries, so request peers,
+// access logs, and per-IP limits see clients rather than the load balancer.
+//
+// Connections from trustedProxies, IP addresses or CIDR prefixes, must start
+// with a header and are closed otherwise; connections from other addresses
+// are served as they are. Without trusted proxies, all connections must
+// start with a header. Headers are read concurrently, so slow connections
+// don't hold up others.
+//
+//	lis, _ := net.Listen("tcp", ":8080")
+//	lis, err := gateway.NewProxyProtocolListener(lis, "10.0.0.0/8")
+//	err = server.Serve(lis)
+func NewProxyProtocolListener(lis net.Listener, trustedProxies ...string) (net.Listener, error) {
+	trusted, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	l := &proxyProtocolListener{
+		Listener: lis,
+		trusted:  trusted,
+		accepted: make(chan acceptResult),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+// proxyProtocolListener reads the PROXY protocol headers of accepted
+// connections before handing them out.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted  []netip.Prefix
+	accepted chan acceptResult
+	done     chan struct{}
+	once     sync.Once
+}
+
+// acceptResult is a connection ready to be served, or an error of the
+// wrapped listener.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// Accept returns the next connection whose header was read.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-l.accepted:
+		return result.conn, result.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the wrapped listener and stops accepting connections.
+func (l *proxyProtocolListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts connections and reads their headers. Errors are passed
+// on to Accept, whose callers pace retries of temporary ones.
+func (l *proxyProtocolListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.accepted <- acceptResult{err: err}:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake reads the header of conn and hands the connection to Accept.
+func (l *proxyProtocolListener) handshake(conn net.Conn) {
+	ready := conn
+	if len(l.trusted) == 0 || trustedIP(l.trusted, parseHostIP(conn.RemoteAddr().String())) {
+		_ = conn.SetReadDeadline(time.Now().Add(defaultReadHeaderTimeout))
+		reader := bufio.NewReader(conn)
+		remote, err := readProxyHeader(reader)
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		pc := &proxyConn{bufferedConn: bufferedConn{Conn: conn, reader: reader}, remote: conn.RemoteAddr()}
+		if remote != nil {
+			pc.remote = remote
+		}
+		ready = pc
+	}
+
+	select {
+	case l.accepted <- acceptResult{conn: ready}:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// proxyConn is a connection with the client address of its PROXY protocol
+// header.
+type proxyConn struct {
+	bufferedConn
+	remote net.Addr
+}
+
+// RemoteAddr returns the address of the client.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// readProxyHeader reads a version 1 or 2 PROXY protocol header and returns
+// the source address it carries, or nil for health checks of the proxy
+// itself (LOCAL and UNKNOWN) and address families other than TCP over IP.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyV1Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+	}
+	if string(prefix) == proxyV1Prefix {
+		return readProxyV1(r)
+	}
+	if signature, err := r.Peek(len(proxyV2Signature)); err == nil && string(signature) == proxyV2Signature {
+		return readProxyV2(r)
+	}
+	return nil, errProxyHeader
+}
+
+// readProxyV1 reads a text header, e.g.
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: line too long", errProxyHeader)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != proxyV1Fields || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %q", errProxyHeader, strings.TrimSpace(string(line)))
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, portBits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip.Unmap(), uint16(port))), nil
+}
+
+// readProxyV2 reads a binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, proxyV2HeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+	}
+	versionCommand, family := header[proxyV2CommandOffset], header[proxyV2FamilyOffset]
+	body := make([]byte, binary.BigEndian.Uint16(header[proxyV2LengthOffset:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyHeader, err)
+	}
+	if versionCommand>>nibbleBits != proxyV2Version {
+		return nil, fmt.Errorf("%w: version %d", errProxyHeader, versionCommand>>nibbleBits)
+	}
+
+	switch versionCommand & lowNibble {
+	case proxyV2CommandLocal:
+		return nil, nil
+	case proxyV2CommandProxy:
+	default:
+		return nil, fmt.Errorf("%w: command %d", errProxyHeader, versionCommand&lowNibble)
+	}
+	switch family >> nibbleBits {
+	case proxyV2FamilyInet:
+		if len(body) < proxyV2Inet4Length {
+			return nil, fmt.Errorf("%w: short IPv4 addresses", errProxyHeader)
+		}
+		ip := netip.AddrFrom4([net.IPv4len]byte(body))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[proxyV2Inet4Port:]))), nil
+	case proxyV2FamilyInet6:
+		if len(body) < proxyV2Inet6Length {
+			return nil, fmt.Errorf("%w: short IPv6 addresses", errProxyHeader)
+		}
+		ip := netip.AddrFrom16([net.IPv6len]byte(body)).Unmap()
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[proxyV2Inet6Port:]))), nil
+	default:
+		return nil, nil // Unix sockets and unspecified families keep the connection address
+	}
+}
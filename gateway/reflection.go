@@ -9,33 +9,55 @@ import (
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
-// descriptorResolver implements resolution for our dynamic descriptors.
+// descriptorResolver resolves the merged descriptors of the services, with
+// the global registry as a fallback.
 type descriptorResolver struct {
-	services []*Service
+	files *protoregistry.Files
 }
 
-func (d *descriptorResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
-	// Create a file registry to handle dependencies
+// newDescriptorResolver registers the files of fdset and the well-known types
+// they import.
+func newDescriptorResolver(fdset *descriptorpb.FileDescriptorSet) (*descriptorResolver, error) {
 	files := &protoregistry.Files{}
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if strings.HasPrefix(fd.Path(), "google/protobuf/") {
+			_ = files.RegisterFile(fd) // Ignore registration errors for well-known types
+		}
+		return true
+	})
 
-	// First, register all files
-	for _, svc := range d.services {
-		if svc.Descriptors != nil {
-			for _, file := range svc.Descriptors.File {
-				fd, err := protodesc.NewFile(file, files)
-				if err == nil {
-					if err := files.RegisterFile(fd); err != nil {
-						return nil, fmt.Errorf("failed to register file %s: %w", fd.Path(), err)
-					}
-				}
+	// Register files once their imports are, whatever their order
+	pending := fdset.GetFile()
+	for len(pending) > 0 {
+		var next []*descriptorpb.FileDescriptorProto
+		var lastErr error
+		for _, file := range pending {
+			if _, err := files.FindFileByPath(file.GetName()); err == nil {
+				continue
+			}
+			fd, err := protodesc.NewFile(file, files)
+			if err != nil {
+				next = append(next, file)
+				lastErr = fmt.Errorf("invalid descriptor %s: %w", file.GetName(), err)
+				continue
+			}
+			if err := files.RegisterFile(fd); err != nil {
+				return nil, fmt.Errorf("failed to register file %s: %w", fd.Path(), err)
 			}
 		}
+		if len(next) == len(pending) {
+			return nil, lastErr
+		}
+		pending = next
 	}
+	return &descriptorResolver{files: files}, nil
+}
 
-	// Then find the requested file
-	fd, err := files.FindFileByPath(path)
+func (d *descriptorResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	fd, err := d.files.FindFileByPath(path)
 	if err != nil {
 		return nil, protoregistry.NotFound
 	}
@@ -48,44 +70,7 @@ func (d *descriptorResolver) FindDescriptorByName(name protoreflect.FullName) (p
 		return desc, nil
 	}
 
-	// Create a file registry to handle dependencies
-	files := &protoregistry.Files{}
-
-	// First, register well-known types from the global registry
-	// This ensures imports like google/protobuf/timestamp.proto are available
-	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
-		if strings.HasPrefix(fd.Path(), "google/protobuf/") {
-			_ = files.RegisterFile(fd) // Ignore registration errors for well-known types
-		}
-		return true
-	})
-
-	// Track which files we've already registered to avoid duplicates
-	registeredFiles := make(map[string]bool)
-
-	// Register all files from services
-	for _, svc := range d.services {
-		if svc.Descriptors != nil {
-			for _, file := range svc.Descriptors.File {
-				// Skip if already registered
-				if registeredFiles[file.GetName()] {
-					continue
-				}
-
-				fd, err := protodesc.NewFile(file, files)
-				if err == nil {
-					if err := files.RegisterFile(fd); err != nil {
-						// Continue on error to try other files
-						continue
-					}
-					registeredFiles[file.GetName()] = true
-				}
-			}
-		}
-	}
-
-	// Then find the descriptor
-	desc, err := files.FindDescriptorByName(name)
+	desc, err := d.files.FindDescriptorByName(name)
 	if err != nil {
 		return nil, protoregistry.NotFound
 	}
@@ -110,7 +95,10 @@ func (g *Gateway) CreateReflectionHandlers() (map[string]http.Handler, error) {
 	})
 
 	// Create resolver for our descriptors
-	resolver := &descriptorResolver{services: g.services}
+	resolver, err := newDescriptorResolver(g.descriptor)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a reflector with our namer and resolver
 	reflector := grpcreflect.NewReflector(namer, grpcreflect.WithDescriptorResolver(resolver))
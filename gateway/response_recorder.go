@@ -0,0 +1,77 @@
+package gateway
+
+import "net/http"
+
+// ResponseRecorder wraps a ResponseWriter to record the status code and size
+// of the response, for middleware reporting on responses such as access logs
+// and metrics. Unlike httptest.ResponseRecorder, it writes the response
+// through. The zero value with ResponseWriter set is ready to use.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+
+	// beforeHeader is called once, before the header is written, and
+	// onWrite with the bytes of the body written
+	beforeHeader func()
+	onWrite      func([]byte)
+}
+
+// WriteHeader records the status code.
+func (w *ResponseRecorder) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+		if w.beforeHeader != nil {
+			w.beforeHeader()
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the number of bytes written.
+func (w *ResponseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	if w.onWrite != nil {
+		w.onWrite(b[:n])
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher, writing the header first if needed, so
+// that streaming handlers keep working.
+func (w *ResponseRecorder) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code of the response, 200 if nothing was
+// written.
+func (w *ResponseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Written reports whether the header of the response was written.
+func (w *ResponseRecorder) Written() bool {
+	return w.status != 0
+}
+
+// BytesWritten returns the size of the response body written so far.
+func (w *ResponseRecorder) BytesWritten() int64 {
+	return w.bytes
+}
@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in logs and captures, such as the
+// values of sensitive path variables and redacted headers.
+const RedactedValue = "[REDACTED]"
+
+// Route serves a method under a path template in addition to its RPC path.
+type Route struct {
+	// Method is the name of the method
+	Method string
+	// Template is the path template, e.g. "/users/{id}"
+	Template string
+	// Handler serves the method. The values of the template variables are
+	// available from http.Request.PathValue.
+	Handler http.Handler
+	// Sensitive are the variables whose values are redacted in access logs,
+	// e.g. "email" for "/users/{email}"
+	Sensitive []string
+}
+
+// PathTemplate is a parsed path template. Each variable, written "{name}",
+// matches one non-empty path segment; names may be dotted field paths such
+// as "{user.id}".
+type PathTemplate struct {
+	template string
+	segments []templateSegment
+}
+
+// templateSegment is a literal segment or, if variable is set, a variable.
+type templateSegment struct {
+	literal  string
+	variable string
+}
+
+// ParsePathTemplate parses a path template such as "/users/{id}".
+func ParsePathTemplate(template string) (*PathTemplate, error) {
+	if !strings.HasPrefix(template, "/") || template == "/" {
+		return nil, fmt.Errorf("path template %q must start with / and have a segment", template)
+	}
+
+	t := &PathTemplate{template: template}
+	seen := make(map[string]bool)
+	for _, segment := range strings.Split(template[1:], "/") {
+		if segment == "" {
+			return nil, fmt.Errorf("path template %q has an empty segment", template)
+		}
+		if !strings.ContainsAny(segment, "{}") {
+			t.segments = append(t.segments, templateSegment{literal: segment})
+			continue
+		}
+
+		name, ok := strings.CutPrefix(segment, "{")
+		if name, ok = strings.CutSuffix(name, "}"); !ok || !validVariableName(name) {
+			return nil, fmt.Errorf("path template %q: invalid variable %s", template, segment)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("path template %q: duplicate variable %s", template, name)
+		}
+		seen[name] = true
+		t.segments = append(t.segments, templateSegment{variable: name})
+	}
+	return t, nil
+}
+
+// validVariableName reports whether name is a dotted path of identifiers.
+func validVariableName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for _, c := range part {
+			if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the template.
+func (t *PathTemplate) String() string {
+	return t.template
+}
+
+// Variables returns the names of the variables, in order.
+func (t *PathTemplate) Variables() []string {
+	var names []string
+	for _, segment := range t.segments {
+		if segment.variable != "" {
+			names = append(names, segment.variable)
+		}
+	}
+	return names
+}
+
+// Match matches an escaped path, as returned by url.URL.EscapedPath, against
+// the template and returns the unescaped values of the variables by name.
+// Escaped slashes in a segment are part of its value.
+func (t *PathTemplate) Match(escapedPath string) (map[string]string, bool) {
+	segments := strings.Split(strings.TrimPrefix(escapedPath, "/"), "/")
+	if len(segments) != len(t.segments) {
+		return nil, false
+	}
+	var values map[string]string
+	for i, segment := range t.segments {
+		value, err := url.PathUnescape(segments[i])
+		switch {
+		case err != nil:
+			return nil, false
+		case segment.variable == "":
+			if value != segment.literal {
+				return nil, false
+			}
+		case value == "":
+			return nil, false
+		default:
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[segment.variable] = value
+		}
+	}
+	return values, true
+}
+
+// literals returns the number of literal segments, used to prefer the most
+// specific template.
+func (t *PathTemplate) literals() int {
+	n := 0
+	for _, segment := range t.segments {
+		if segment.variable == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// compiledRoute is a route with its parsed template.
+type compiledRoute struct {
+	template  *PathTemplate
+	handler   http.Handler
+	sensitive []string
+}
+
+// buildRoutes parses the routes of all services, most specific first and
+// then by template.
+func buildRoutes(services []*Service) ([]compiledRoute, error) {
+	var routes []compiledRoute
+	templates := make(map[string]string)
+	for _, svc := range services {
+		for _, route := range svc.Routes {
+			template, err := ParsePathTemplate(route.Template)
+			if err != nil {
+				return nil, fmt.Errorf("method %s: %w", route.Method, err)
+			}
+			owner := qualifiedName(svc.Package, svc.Name) + "/" + route.Method
+			if other, ok := templates[route.Template]; ok {
+				return nil, fmt.Errorf("path template %s is used by %s and %s", route.Template, other, owner)
+			}
+			templates[route.Template] = owner
+			routes = append(routes, compiledRoute{template: template, handler: route.Handler, sensitive: route.Sensitive})
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i].template, routes[j].template
+		if a.literals() != b.literals() {
+			return a.literals() > b.literals()
+		}
+		return a.template < b.template
+	})
+	return routes, nil
+}
+
+// matchRoute returns the handler of the first route matching r, with the
+// values of the template variables set as path values of r.
+func matchRoute(routes []compiledRoute, r *http.Request) http.Handler {
+	for _, route := range routes {
+		values, ok := route.template.Match(r.URL.EscapedPath())
+		if !ok {
+			continue
+		}
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+		return route.handler
+	}
+	return nil
+}
+
+// redactedPathFunc returns the function computing the paths of requests for
+// access logs, with the values of sensitive variables of the routes they
+// match redacted, or nil if no route has sensitive variables.
+func redactedPathFunc(routes []compiledRoute) func(*http.Request) string {
+	if !slices.ContainsFunc(routes, func(route compiledRoute) bool { return len(route.sensitive) > 0 }) {
+		return nil
+	}
+	return func(r *http.Request) string {
+		escaped := r.URL.EscapedPath()
+		for _, route := range routes {
+			if _, ok := route.template.Match(escaped); ok {
+				return route.template.redact(escaped, route.sensitive)
+			}
+		}
+		return r.URL.Path
+	}
+}
+
+// redact returns a path matched by the template with the values of the named
+// variables replaced by "[REDACTED]".
+func (t *PathTemplate) redact(escapedPath string, variables []string) string {
+	segments := strings.Split(strings.TrimPrefix(escapedPath, "/"), "/")
+	for i, segment := range t.segments {
+		if segment.variable != "" && slices.Contains(variables, segment.variable) {
+			segments[i] = RedactedValue
+		}
+	}
+	path := "/" + strings.Join(segments, "/")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		return unescaped
+	}
+	return path
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// applyServiceNameOverrides returns services whose exported names follow the
+// overrides table. Keys are routed service names ("internal.users.UserService"),
+// values are the exported names ("acme.user.v1.UserService"). Handlers stay
+// reachable at the original routing path and are also mounted under the exported
+// name, so existing clients keep working while new clients move to the new name.
+func applyServiceNameOverrides(services []*Service, overrides map[string]string) ([]*Service, error) {
+	if len(overrides) == 0 {
+		return services, nil
+	}
+
+	// Collect package renames so that cross-file references can be rewritten
+	packageRenames := make(map[string]string)
+	for _, svc := range services {
+		exported, ok := overrides[svc.Package+"."+svc.Name]
+		if !ok {
+			continue
+		}
+		newPkg, _ := splitServiceName(exported)
+		if prev, seen := packageRenames[svc.Package]; seen && prev != newPkg {
+			return nil, fmt.Errorf("conflicting package overrides for %s: %s and %s", svc.Package, prev, newPkg)
+		}
+		packageRenames[svc.Package] = newPkg
+	}
+
+	result := make([]*Service, 0, len(services))
+	for _, svc := range services {
+		routed := svc.Package + "." + svc.Name
+		exported, ok := overrides[routed]
+		if !ok {
+			result = append(result, svc)
+			continue
+		}
+		newPkg, newName := splitServiceName(exported)
+		if newName == "" {
+			return nil, fmt.Errorf("invalid exported service name %q for %s", exported, routed)
+		}
+
+		renamed := &Service{
+			Name:       newName,
+			Package:    newPkg,
+			Handlers:   aliasHandlers(svc.Handlers, routed, exported),
+			SchemaHash: svc.SchemaHash,
+			Security:   svc.Security,
+			Debug:      svc.Debug,
+			Routes:     svc.Routes,
+		}
+		if svc.Descriptors != nil {
+			fdset := proto.Clone(svc.Descriptors).(*descriptorpb.FileDescriptorSet)
+			for _, file := range fdset.File {
+				renameServiceInFile(file, svc.Name, newName, packageRenames)
+			}
+			renamed.Descriptors = fdset
+		}
+		result = append(result, renamed)
+	}
+
+	return result, nil
+}
+
+// splitServiceName splits "pkg.sub.Service" into package and service name.
+func splitServiceName(fullName string) (pkg, name string) {
+	idx := strings.LastIndex(fullName, ".")
+	if idx < 0 {
+		return "", fullName
+	}
+	return fullName[:idx], fullName[idx+1:]
+}
+
+// aliasHandlers mounts every routed handler under the exported service name as well.
+func aliasHandlers(handlers map[string]http.Handler, routed, exported string) map[string]http.Handler {
+	routedPrefix := "/" + routed + "/"
+	exportedPrefix := "/" + exported + "/"
+
+	aliased := make(map[string]http.Handler, len(handlers))
+	for path, handler := range handlers {
+		aliased[path] = handler
+		if rest, ok := strings.CutPrefix(path, routedPrefix); ok {
+			aliased[exportedPrefix+rest] = handler
+		}
+	}
+	return aliased
+}
+
+// renameServiceInFile rewrites the package, service name, and type references of a file.
+func renameServiceInFile(file *descriptorpb.FileDescriptorProto, oldName, newName string, packageRenames map[string]string) {
+	oldPkg := file.GetPackage()
+	if newPkg, ok := packageRenames[oldPkg]; ok && newPkg != oldPkg {
+		file.Package = proto.String(newPkg)
+		if file.GetName() == oldPkg+".proto" {
+			file.Name = proto.String(newPkg + ".proto")
+		}
+	}
+
+	for i, dep := range file.Dependency {
+		depPkg := strings.TrimSuffix(dep, ".proto")
+		if newPkg, ok := packageRenames[depPkg]; ok {
+			file.Dependency[i] = newPkg + ".proto"
+		}
+	}
+
+	for _, svc := range file.Service {
+		if svc.GetName() == oldName {
+			svc.Name = proto.String(newName)
+		}
+		for _, method := range svc.Method {
+			method.InputType = renameTypeRef(method.InputType, packageRenames)
+			method.OutputType = renameTypeRef(method.OutputType, packageRenames)
+		}
+	}
+
+	for _, msg := range file.MessageType {
+		renameMessageRefs(msg, packageRenames)
+	}
+	for _, ext := range file.Extension {
+		ext.TypeName = renameTypeRef(ext.TypeName, packageRenames)
+		ext.Extendee = renameTypeRef(ext.Extendee, packageRenames)
+	}
+}
+
+// renameMessageRefs rewrites type references inside a message and its nested types.
+func renameMessageRefs(msg *descriptorpb.DescriptorProto, packageRenames map[string]string) {
+	for _, field := range msg.Field {
+		field.TypeName = renameTypeRef(field.TypeName, packageRenames)
+		field.Extendee = renameTypeRef(field.Extendee, packageRenames)
+	}
+	for _, nested := range msg.NestedType {
+		renameMessageRefs(nested, packageRenames)
+	}
+}
+
+// renameTypeRef rewrites a fully-qualified type reference (".pkg.Type") for renamed packages.
+func renameTypeRef(ref *string, packageRenames map[string]string) *string {
+	if ref == nil || !strings.HasPrefix(*ref, ".") {
+		return ref
+	}
+	name := (*ref)[1:]
+
+	// Match the longest renamed package prefix
+	best := ""
+	for oldPkg := range packageRenames {
+		if strings.HasPrefix(name, oldPkg+".") && len(oldPkg) > len(best) {
+			best = oldPkg
+		}
+	}
+	if best == "" {
+		return ref
+	}
+	return proto.String("." + packageRenames[best] + name[len(best):])
+}
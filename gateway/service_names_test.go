@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func newUserServiceDescriptors() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("internal.users.proto"),
+			Package: proto.String("internal.users"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("GetUserRequest"),
+					Field: []*descriptorpb.FieldDescriptorProto{{
+						Name:     proto.String("id"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						JsonName: proto.String("id"),
+					}},
+				},
+				{
+					Name: proto.String("GetUserResponse"),
+					Field: []*descriptorpb.FieldDescriptorProto{{
+						Name:     proto.String("request"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						TypeName: proto.String(".internal.users.GetUserRequest"),
+						JsonName: proto.String("request"),
+					}},
+				},
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("UserService"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("GetUser"),
+					InputType:  proto.String(".internal.users.GetUserRequest"),
+					OutputType: proto.String(".internal.users.GetUserResponse"),
+				}},
+			}},
+		}},
+	}
+}
+
+func TestServiceNameOverrides(t *testing.T) {
+	original := newUserServiceDescriptors()
+	svc := &Service{
+		Name:    "UserService",
+		Package: "internal.users",
+		Handlers: map[string]http.Handler{
+			"/internal.users.UserService/GetUser": http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			}),
+		},
+		Descriptors: original,
+	}
+
+	gw, err := New([]*Service{svc}, Options{
+		EnableOpenAPI:    true,
+		EnableReflection: true,
+		ServiceNameOverrides: map[string]string{
+			"internal.users.UserService": "acme.user.v1.UserService",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	t.Run("routes old and new paths", func(t *testing.T) {
+		for _, path := range []string{"/internal.users.UserService/GetUser", "/acme.user.v1.UserService/GetUser"} {
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+			if rec.Body.String() != "ok" {
+				t.Errorf("Expected %s to be routed, got status %d", path, rec.Code)
+			}
+		}
+	})
+
+	t.Run("exports the new name", func(t *testing.T) {
+		files, err := gw.ExportProtos()
+		if err != nil {
+			t.Fatalf("Failed to export protos: %v", err)
+		}
+		content, ok := files["acme.user.v1.proto"]
+		if !ok {
+			t.Fatalf("Expected renamed proto file, got %v", files)
+		}
+		if !strings.Contains(content, "package acme.user.v1;") {
+			t.Errorf("Expected renamed package, got:\n%s", content)
+		}
+		if strings.Contains(content, "internal.users") {
+			t.Errorf("Expected no references to the routed package, got:\n%s", content)
+		}
+	})
+
+	t.Run("openapi uses the new name", func(t *testing.T) {
+		if !strings.Contains(string(gw.openAPI), "/acme.user.v1.UserService/GetUser") {
+			t.Error("Expected OpenAPI path under the exported name")
+		}
+	})
+
+	t.Run("caller descriptors are untouched", func(t *testing.T) {
+		if original.File[0].GetPackage() != "internal.users" {
+			t.Errorf("Expected original descriptors to be unchanged, got %s", original.File[0].GetPackage())
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// TypeRegistry resolves the message types of the services of a gateway, and
+// the types linked into the binary, such as the well-known types. It lets
+// google.protobuf.Any values hold the messages of the services: it is a
+// protojson resolver, rendering them as JSON objects with an "@type", and
+// resolves the type URLs of packed messages.
+type TypeRegistry struct {
+	types *protoregistry.Types
+}
+
+// NewTypeRegistry builds the registry of the message types defined in fdset.
+func NewTypeRegistry(fdset *descriptorpb.FileDescriptorSet) (*TypeRegistry, error) {
+	resolver, err := newDescriptorResolver(fdset)
+	if err != nil {
+		return nil, err
+	}
+
+	types := &protoregistry.Types{}
+	for _, file := range fdset.GetFile() {
+		fd, err := resolver.files.FindFileByPath(file.GetName())
+		if err != nil {
+			continue
+		}
+		if err := registerMessageTypes(types, fd.Messages()); err != nil {
+			return nil, err
+		}
+	}
+	return &TypeRegistry{types: types}, nil
+}
+
+// registerMessageTypes registers messages and their nested messages, except
+// map entries and the types linked into the binary.
+func registerMessageTypes(types *protoregistry.Types, messages protoreflect.MessageDescriptors) error {
+	for i := range messages.Len() {
+		md := messages.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		if _, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err != nil {
+			if err := types.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+				return err
+			}
+		}
+		if err := registerMessageTypes(types, md.Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindMessageByName looks up a message by its full name.
+func (r *TypeRegistry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return r.types.FindMessageByName(name)
+}
+
+// FindMessageByURL looks up a message by the type URL of a
+// google.protobuf.Any, e.g. "type.googleapis.com/user.v1.User".
+func (r *TypeRegistry) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		url = url[i+1:]
+	}
+	return r.FindMessageByName(protoreflect.FullName(url))
+}
+
+// FindExtensionByName looks up an extension field by its full name.
+// Extensions are resolved among the types linked into the binary.
+func (r *TypeRegistry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+// FindExtensionByNumber looks up an extension field by the message it extends
+// and its field number.
+func (r *TypeRegistry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// Types returns the registry of the message types of the gateway's services.
+func (g *Gateway) Types() *TypeRegistry {
+	return g.types
+}
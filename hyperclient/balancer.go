@@ -0,0 +1,340 @@
+package hyperclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// Load balancing policies of service configs.
+const (
+	policyPickFirst  = "pick_first"
+	policyRoundRobin = "round_robin"
+)
+
+const (
+	// defaultResolveInterval is how often DNS targets are resolved again
+	defaultResolveInterval = 30 * time.Second
+	// resolveTimeout bounds DNS lookups
+	resolveTimeout = 10 * time.Second
+	// healthCheckInterval is how often endpoints are health checked
+	healthCheckInterval = 5 * time.Second
+	// minEviction and maxEviction bound how long endpoints that failed to
+	// connect are evicted; the time doubles with each consecutive failure
+	minEviction = time.Second
+	maxEviction = 30 * time.Second
+)
+
+// defaultLookupHost resolves the host of DNS targets, unless lookupHost is
+// replaced in tests.
+var (
+	defaultLookupHost = net.DefaultResolver.LookupHost
+	lookupHost        = defaultLookupHost
+)
+
+// endpoint is an address calls are sent to.
+type endpoint struct {
+	addr string
+	// failures counts the consecutive failed connections, which evict the
+	// endpoint until evictedUntil
+	failures     int
+	evictedUntil time.Time
+	// notServing is set while the last health check failed
+	notServing bool
+	checkedAt  time.Time
+	checking   bool
+}
+
+// balancer picks the endpoint of each call, skipping evicted and unhealthy
+// endpoints.
+type balancer struct {
+	policy  string
+	shuffle bool
+	// host and port of a DNS target, empty for static endpoints
+	host, port      string
+	resolveInterval time.Duration
+	// check health checks an endpoint, nil without health checking
+	check         func(ctx context.Context, addr string) error
+	checkInterval time.Duration
+
+	mu         sync.Mutex
+	endpoints  []*endpoint
+	next       int
+	resolvedAt time.Time
+	resolving  bool
+}
+
+// loadBalancingPolicy returns the load balancing policy of config, pick
+// first by default, and whether pick first shuffles the addresses.
+func loadBalancingPolicy(config *rpc.ServiceConfig) (string, bool, error) {
+	if config == nil {
+		return policyPickFirst, false, nil
+	}
+	var names []string
+	for _, lb := range config.LoadBalancingConfig {
+		for name, raw := range lb {
+			switch name {
+			case policyRoundRobin:
+				return name, false, nil
+			case policyPickFirst:
+				var pickFirst struct {
+					ShuffleAddressList bool `json:"shuffleAddressList"`
+				}
+				if len(raw) > 0 {
+					if err := json.Unmarshal(raw, &pickFirst); err != nil {
+						return "", false, fmt.Errorf("hyperclient: invalid pick_first config: %w", err)
+					}
+				}
+				return name, pickFirst.ShuffleAddressList, nil
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		return "", false, fmt.Errorf("hyperclient: unsupported load balancing policies %s", strings.Join(names, ", "))
+	}
+	switch policy := strings.ToLower(config.LoadBalancingPolicy); policy {
+	case "", policyPickFirst:
+		return policyPickFirst, false, nil
+	case policyRoundRobin:
+		return policy, false, nil
+	default:
+		return "", false, fmt.Errorf("hyperclient: unsupported load balancing policy %q", config.LoadBalancingPolicy)
+	}
+}
+
+// newStaticBalancer returns a balancer over the addresses addrs.
+func newStaticBalancer(policy string, shuffle bool, addrs []string) *balancer {
+	b := &balancer{policy: policy, shuffle: shuffle}
+	b.setAddrs(addrs)
+	return b
+}
+
+// newDNSBalancer returns a balancer over the addresses of host, resolved on
+// the first call and every interval after.
+func newDNSBalancer(policy string, shuffle bool, host, port string, interval time.Duration) *balancer {
+	return &balancer{policy: policy, shuffle: shuffle, host: host, port: port, resolveInterval: interval}
+}
+
+// pick returns the address of the endpoint of the next call. When every
+// endpoint is evicted or unhealthy, the one evicted the longest ago is tried
+// rather than failing the call.
+func (b *balancer) pick(ctx context.Context) (string, error) {
+	if b.host != "" {
+		b.mu.Lock()
+		resolved := len(b.endpoints) > 0
+		b.mu.Unlock()
+		if !resolved {
+			if err := b.resolve(ctx); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.host != "" && now.Sub(b.resolvedAt) >= b.resolveInterval {
+		b.startResolve()
+	}
+	b.startChecks(now)
+
+	var healthy []*endpoint
+	for _, e := range b.endpoints {
+		if !e.notServing && !now.Before(e.evictedUntil) {
+			healthy = append(healthy, e)
+		}
+	}
+	switch {
+	case len(b.endpoints) == 0:
+		return "", rpc.NewErrorf(rpc.CodeUnavailable, "no addresses for %s", b.host)
+	case len(healthy) == 0:
+		// The endpoints may have moved
+		if b.host != "" {
+			b.startResolve()
+		}
+		next := b.endpoints[0]
+		for _, e := range b.endpoints[1:] {
+			if e.evictedUntil.Before(next.evictedUntil) {
+				next = e
+			}
+		}
+		return next.addr, nil
+	case b.policy == policyRoundRobin:
+		e := healthy[b.next%len(healthy)]
+		b.next++
+		return e.addr, nil
+	default:
+		return healthy[0].addr, nil
+	}
+}
+
+// succeeded records that a call connected to addr.
+func (b *balancer) succeeded(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.find(addr); e != nil {
+		e.failures = 0
+		e.evictedUntil = time.Time{}
+	}
+}
+
+// failed records that a call failed to connect to addr, which evicts it.
+func (b *balancer) failed(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.find(addr)
+	if e == nil {
+		return
+	}
+	e.failures++
+	e.evictedUntil = time.Now().Add(min(minEviction<<min(e.failures-1, 5), maxEviction))
+	if b.host != "" {
+		b.startResolve()
+	}
+}
+
+// find returns the endpoint of addr, or nil if it was removed.
+func (b *balancer) find(addr string) *endpoint {
+	for _, e := range b.endpoints {
+		if e.addr == addr {
+			return e
+		}
+	}
+	return nil
+}
+
+// setAddrs replaces the endpoints with addrs, keeping the state of the
+// endpoints that remain.
+func (b *balancer) setAddrs(addrs []string) {
+	known := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		known[e.addr] = e
+	}
+	endpoints := make([]*endpoint, 0, len(addrs))
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		e := known[addr]
+		if e == nil {
+			e = &endpoint{addr: addr}
+		}
+		endpoints = append(endpoints, e)
+	}
+	if b.shuffle {
+		rand.Shuffle(len(endpoints), func(i, j int) { //nolint:gosec // shuffling does not need a secure source
+			endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+		})
+	}
+	b.endpoints = endpoints
+}
+
+// resolve looks up the addresses of the DNS target. The known endpoints are
+// kept if the lookup fails.
+func (b *balancer) resolve(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	hosts, err := lookupHost(ctx, b.host)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resolving = false
+	b.resolvedAt = time.Now()
+	if err != nil || len(hosts) == 0 {
+		if len(b.endpoints) == 0 {
+			return rpc.NewErrorf(rpc.CodeUnavailable, "failed to resolve %s: %v", b.host, err)
+		}
+		return nil
+	}
+	// Lookups return addresses in varying order
+	sort.Strings(hosts)
+	addrs := make([]string, len(hosts))
+	for i, host := range hosts {
+		addrs[i] = net.JoinHostPort(host, b.port)
+	}
+	b.setAddrs(addrs)
+	return nil
+}
+
+// startResolve resolves the DNS target in the background, unless it is
+// being resolved already.
+func (b *balancer) startResolve() {
+	if b.resolving {
+		return
+	}
+	b.resolving = true
+	go func() { _ = b.resolve(context.Background()) }()
+}
+
+// startChecks health checks, in the background, the endpoints not checked
+// for the check interval.
+func (b *balancer) startChecks(now time.Time) {
+	if b.check == nil {
+		return
+	}
+	for _, e := range b.endpoints {
+		if e.checking || now.Sub(e.checkedAt) < b.checkInterval {
+			continue
+		}
+		e.checking = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), b.checkInterval)
+			err := b.check(ctx, e.addr)
+			cancel()
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			e.checking = false
+			e.checkedAt = time.Now()
+			e.notServing = err != nil
+		}()
+	}
+}
+
+// healthProcedure is the method of the gRPC health checking protocol.
+const healthProcedure = "/grpc.health.v1.Health/Check"
+
+// checkHealth checks the health of service at the endpoint addr. Servers
+// without the health service are considered healthy, as gRPC clients do.
+func (c *Client) checkHealth(ctx context.Context, addr, service string) error {
+	data, err := proto.Marshal(&healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	resp, err := c.post(ctx, addr, ProtocolGRPC, healthProcedure, false, bytes.NewReader(encodeFrame(data)), &callOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err = readGRPCUnary(resp, &callOptions{})
+	if rpcErr := (*rpc.Error)(nil); errors.As(err, &rpcErr) && rpcErr.Code == rpc.CodeUnimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result := &healthpb.HealthCheckResponse{}
+	if err := proto.Unmarshal(data, result); err != nil {
+		return err
+	}
+	if result.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return rpc.NewErrorf(rpc.CodeUnavailable, "%s is %s", addr, result.GetStatus())
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBalancerDNS(t *testing.T) {
+	var mu sync.Mutex
+	hosts := []string{"10.0.0.2", "10.0.0.1"}
+	lookups := 0
+	lookupHost = func(_ context.Context, host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if host != "users.internal" {
+			t.Errorf("Expected a lookup of users.internal, got %s", host)
+		}
+		lookups++
+		if hosts == nil {
+			return nil, errors.New("no such host")
+		}
+		return append([]string(nil), hosts...), nil
+	}
+	defer func() { lookupHost = defaultLookupHost }()
+
+	ctx := context.Background()
+	b := newDNSBalancer(policyRoundRobin, false, "users.internal", "8080", time.Hour)
+	picks := make(map[string]int)
+	for range 4 {
+		addr, err := b.pick(ctx)
+		if err != nil {
+			t.Fatalf("pick() failed: %v", err)
+		}
+		picks[addr]++
+	}
+	if picks["10.0.0.1:8080"] != 2 || picks["10.0.0.2:8080"] != 2 || lookups != 1 {
+		t.Errorf("Expected 2 picks of each address after 1 lookup, got %v after %d", picks, lookups)
+	}
+
+	// A failed endpoint is evicted, and the host resolved again
+	mu.Lock()
+	hosts = []string{"10.0.0.1", "10.0.0.3"}
+	mu.Unlock()
+	b.failed("10.0.0.1:8080")
+	waitFor(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return !b.resolving && b.find("10.0.0.3:8080") != nil
+	})
+	for range 4 {
+		if addr, _ := b.pick(ctx); addr != "10.0.0.3:8080" {
+			t.Errorf("Expected the endpoint that was not evicted, got %s", addr)
+		}
+	}
+
+	// Every endpoint evicted: the one evicted the longest ago is tried
+	b.failed("10.0.0.3:8080")
+	if addr, _ := b.pick(ctx); addr != "10.0.0.1:8080" {
+		t.Errorf("Expected the endpoint evicted first, got %s", addr)
+	}
+	b.succeeded("10.0.0.1:8080")
+	if addr, _ := b.pick(ctx); addr != "10.0.0.1:8080" {
+		t.Errorf("Expected the endpoint that connected again, got %s", addr)
+	}
+
+	// Failed lookups keep the known endpoints
+	waitFor(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return !b.resolving
+	})
+	mu.Lock()
+	hosts = nil
+	mu.Unlock()
+	if err := b.resolve(ctx); err != nil || len(b.endpoints) != 2 {
+		t.Errorf("Expected the known endpoints to remain, got %d (%v)", len(b.endpoints), err)
+	}
+	if _, err := newDNSBalancer(policyPickFirst, false, "users.internal", "8080", time.Hour).pick(ctx); err == nil {
+		t.Error("Expected an error without any address")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("Condition not met")
+}
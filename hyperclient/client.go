@@ -0,0 +1,481 @@
+// Package hyperclient calls gRPC and Connect servers without generated code,
+// the client-side mirror of the dynamic services of package rpc.
+//
+// Methods are described by the descriptors of a FileDescriptorSet or, by
+// default, by the server's gRPC reflection service. Messages are
+// proto.Message values, maps and raw JSON in the proto3 JSON mapping, or Go
+// structs, which are converted like hyperway converts the messages of its
+// handlers:
+//
+//	client, err := hyperclient.New("http://localhost:8080")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	var user map[string]any
+//	err = client.Call(ctx, "user.v1.UserService/GetUser", map[string]any{"id": "1"}, &user)
+//
+// Streaming methods are called with CallServerStream, CallClientStream, and
+// CallBidiStream.
+//
+// Errors of calls are *rpc.Error values carrying the status of the server.
+//
+// Calls can be spread over several endpoints, the addresses of a dns:///
+// target or those given with WithEndpoints, with the pick_first or
+// round_robin load balancing policy of a gRPC service config:
+//
+//	client, err := hyperclient.New("dns:///users.internal:8080",
+//		hyperclient.WithServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`))
+package hyperclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// Protocol is the RPC protocol of calls.
+type Protocol string
+
+const (
+	// ProtocolGRPC calls methods with the gRPC protocol.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolConnect calls methods with the Connect protocol.
+	ProtocolConnect Protocol = "connect"
+)
+
+// Client calls the methods of the services of a server.
+type Client struct {
+	base      *url.URL
+	protocol  Protocol
+	transport http.RoundTripper
+	config    *rpc.ServiceConfig
+	balancer  *balancer
+	throttle  *retryThrottle
+	// attemptHooks are called with the stats of each attempt
+	attemptHooks       []func(ctx context.Context, stats AttemptStats)
+	interceptor        rpc.Interceptor
+	streamInterceptors []StreamInterceptor
+
+	// files describes the services; it grows with the files resolved by
+	// reflection unless a descriptor set was given
+	mu         sync.Mutex
+	files      *protoregistry.Files
+	reflection bool
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	protocol           Protocol
+	transport          http.RoundTripper
+	tlsConfig          *tls.Config
+	fdset              *descriptorpb.FileDescriptorSet
+	serviceConfig      string
+	endpoints          []string
+	resolveInterval    time.Duration
+	attemptHooks       []func(ctx context.Context, stats AttemptStats)
+	interceptors       []rpc.Interceptor
+	streamInterceptors []StreamInterceptor
+}
+
+// WithProtocol sets the protocol of calls (default: ProtocolGRPC).
+func WithProtocol(protocol Protocol) Option {
+	return func(o *options) {
+		o.protocol = protocol
+	}
+}
+
+// WithDescriptorSet describes the services of the server with fdset instead
+// of asking its reflection service. Imports of fdset missing from it, such
+// as the well-known types, are resolved from the generated files linked in
+// the program.
+func WithDescriptorSet(fdset *descriptorpb.FileDescriptorSet) Option {
+	return func(o *options) {
+		o.fdset = fdset
+	}
+}
+
+// WithTransport sends calls with transport instead of an HTTP/2 transport,
+// e.g. to call Connect servers over HTTP/1.1. Reflection and gRPC calls
+// need HTTP/2.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https targets, e.g. to
+// trust a private CA.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithServiceConfig configures the client with a gRPC service config in
+// JSON, as parsed by rpc.ParseServiceConfig. Its loadBalancingConfig, or
+// the deprecated loadBalancingPolicy, selects pick_first (the default) or
+// round_robin, and its healthCheckConfig health checks the endpoints with
+// the grpc.health.v1.Health service.
+//
+// The timeout of the method config of a method bounds its calls, and its
+// retry or hedging policy makes further attempts of calls failing with the
+// listed status codes, within the retry budget of retryThrottling. Only
+// the opening of server streams is retried, and they are not hedged.
+func WithServiceConfig(jsonConfig string) Option {
+	return func(o *options) {
+		o.serviceConfig = jsonConfig
+	}
+}
+
+// WithEndpoints sends calls to the host:port addresses addrs instead of the
+// host of the target, which remains the authority and the TLS server name
+// of calls.
+func WithEndpoints(addrs ...string) Option {
+	return func(o *options) {
+		o.endpoints = append(o.endpoints, addrs...)
+	}
+}
+
+// WithResolveInterval sets how often the host of a dns:/// target is
+// resolved again (default: 30s). It is also resolved again when an endpoint
+// fails to connect.
+func WithResolveInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.resolveInterval = interval
+	}
+}
+
+// New returns a client of the server at target, a host:port for a server
+// without TLS, an http or https URL, or dns:///host:port for the servers at
+// every address of host, with TLS if WithTLSConfig is given. Servers
+// without TLS are called over HTTP/2 with prior knowledge (h2c), as
+// rpc.NewServer serves it. No connection is made until the first call.
+//
+// Endpoints that fail to connect are evicted, for a time that grows with
+// each consecutive failure, as are those failing their health checks; when
+// every endpoint is evicted, calls try the one evicted the longest ago.
+func New(target string, opts ...Option) (*Client, error) {
+	o := &options{protocol: ProtocolGRPC, resolveInterval: defaultResolveInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.protocol != ProtocolGRPC && o.protocol != ProtocolConnect {
+		return nil, fmt.Errorf("hyperclient: unknown protocol %q", o.protocol)
+	}
+	var config *rpc.ServiceConfig
+	if o.serviceConfig != "" {
+		var err error
+		if config, err = rpc.ParseServiceConfig(o.serviceConfig); err != nil {
+			return nil, fmt.Errorf("hyperclient: %w", err)
+		}
+	}
+	policy, shuffle, err := loadBalancingPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var b *balancer
+	dnsTarget, isDNS := strings.CutPrefix(target, "dns:///")
+	if isDNS {
+		if len(o.endpoints) > 0 {
+			return nil, errors.New("hyperclient: WithEndpoints cannot be used with dns targets")
+		}
+		scheme := "http"
+		if o.tlsConfig != nil {
+			scheme = "https"
+		}
+		target = scheme + "://" + dnsTarget
+	}
+	base, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isDNS:
+		port := base.Port()
+		if port == "" {
+			port = defaultPort(base)
+		}
+		b = newDNSBalancer(policy, shuffle, base.Hostname(), port, o.resolveInterval)
+	case len(o.endpoints) > 0:
+		b = newStaticBalancer(policy, shuffle, o.endpoints)
+	default:
+		b = newStaticBalancer(policy, shuffle, []string{base.Host})
+	}
+
+	c := &Client{
+		base:               base,
+		protocol:           o.protocol,
+		transport:          o.transport,
+		config:             config,
+		balancer:           b,
+		throttle:           newRetryThrottle(config),
+		attemptHooks:       o.attemptHooks,
+		streamInterceptors: o.streamInterceptors,
+		files:              new(protoregistry.Files),
+		reflection:         o.fdset == nil,
+	}
+	if len(o.interceptors) > 0 {
+		c.interceptor = rpc.ChainInterceptors(o.interceptors...)
+	}
+	if config != nil && config.HealthCheckConfig != nil {
+		service := config.HealthCheckConfig.ServiceName
+		b.check = func(ctx context.Context, addr string) error {
+			return c.checkHealth(ctx, addr, service)
+		}
+		b.checkInterval = healthCheckInterval
+	}
+	if c.transport == nil {
+		c.transport = newTransport(base, o.tlsConfig)
+	}
+	c.transport = rpc.NewDeadlineTransport(c.transport)
+	if o.fdset != nil {
+		files := make(map[string]*descriptorpb.FileDescriptorProto, len(o.fdset.GetFile()))
+		for _, file := range o.fdset.GetFile() {
+			files[file.GetName()] = file
+		}
+		for _, file := range o.fdset.GetFile() {
+			if err := c.addFile(context.Background(), file.GetName(), files); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// parseTarget returns the base URL of target.
+func parseTarget(target string) (*url.URL, error) {
+	if target == "" {
+		return nil, errors.New("hyperclient: target is required")
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("hyperclient: invalid target %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("hyperclient: invalid target %q: want host:port or an http or https URL", target)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// defaultPort returns the port of base when it has none.
+func defaultPort(base *url.URL) string {
+	if base.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// newTransport returns an HTTP/2 transport to base, over cleartext (h2c) for
+// http URLs. TLS connections verify the host of base, whichever endpoint
+// they connect to.
+func newTransport(base *url.URL, config *tls.Config) http.RoundTripper {
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = base.Hostname()
+	}
+	transport := &http2.Transport{TLSClientConfig: config}
+	if base.Scheme == "http" {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return transport
+}
+
+// Services returns the full names of the services of the server, without
+// the reflection service.
+func (c *Client) Services(ctx context.Context) ([]string, error) {
+	if c.reflection {
+		return c.listServices(ctx)
+	}
+	var services []string
+	c.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := range fd.Services().Len() {
+			services = append(services, string(fd.Services().Get(i).FullName()))
+		}
+		return true
+	})
+	sort.Strings(services)
+	return services, nil
+}
+
+// Method returns the descriptor of method, "pkg.Service/Method".
+func (c *Client) Method(ctx context.Context, method string) (protoreflect.MethodDescriptor, error) {
+	service, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !ok || service == "" || name == "" {
+		return nil, fmt.Errorf("hyperclient: invalid method %q: want pkg.Service/Method", method)
+	}
+	sd, err := c.service(ctx, protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, rpc.NewErrorf(rpc.CodeUnimplemented, "service %s has no method %s", service, name)
+	}
+	return md, nil
+}
+
+// service returns the descriptor of the service name, resolving it with
+// reflection if needed.
+func (c *Client) service(ctx context.Context, name protoreflect.FullName) (protoreflect.ServiceDescriptor, error) {
+	c.mu.Lock()
+	d, err := c.files.FindDescriptorByName(name)
+	c.mu.Unlock()
+	if errors.Is(err, protoregistry.NotFound) && c.reflection {
+		if err = c.resolveSymbol(ctx, name); err == nil {
+			c.mu.Lock()
+			d, err = c.files.FindDescriptorByName(name)
+			c.mu.Unlock()
+		}
+	}
+	if err != nil {
+		if errors.Is(err, protoregistry.NotFound) {
+			return nil, rpc.NewErrorf(rpc.CodeUnimplemented, "unknown service %s", name)
+		}
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("hyperclient: %s is not a service", name)
+	}
+	return sd, nil
+}
+
+// Call calls the unary method, "pkg.Service/Method", with req and decodes
+// the response into resp. req is a proto.Message of the input type, a
+// map[string]any or json.RawMessage in the proto3 JSON mapping, or a Go
+// struct; resp is a pointer to one of those, or nil to discard the response.
+func (c *Client) Call(ctx context.Context, method string, req, resp any, opts ...CallOption) error {
+	co := newCallOptions(opts)
+	call := func(ctx context.Context, req any) (any, error) {
+		md, err := c.Method(ctx, method)
+		if err != nil {
+			return nil, err
+		}
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			return nil, fmt.Errorf("hyperclient: method %s is streaming", method)
+		}
+		data, err := marshalRequest(req, md.Input())
+		if err != nil {
+			return nil, err
+		}
+		data, err = c.invoke(ctx, procedureOf(md), data, co)
+		if err != nil {
+			return nil, err
+		}
+		return resp, unmarshalResponse(data, md.Output(), resp)
+	}
+	if c.interceptor == nil {
+		_, err := call(ctx, req)
+		return err
+	}
+	_, err := c.interceptor.Intercept(ctx, fullMethod(method), req, call)
+	return err
+}
+
+// CallServerStream calls the server-streaming method, "pkg.Service/Method",
+// with req, a message as for Call. The stream must be closed.
+func (c *Client) CallServerStream(ctx context.Context, method string, req any, opts ...CallOption) (Stream, error) {
+	co := newCallOptions(opts)
+	open := func(ctx context.Context, req any) (Stream, error) {
+		md, err := c.Method(ctx, method)
+		if err != nil {
+			return nil, err
+		}
+		if md.IsStreamingClient() || !md.IsStreamingServer() {
+			return nil, fmt.Errorf("hyperclient: method %s is not server-streaming", method)
+		}
+		data, err := marshalRequest(req, md.Input())
+		if err != nil {
+			return nil, err
+		}
+		return c.stream(ctx, procedureOf(md), data, md.Output(), co)
+	}
+	return c.interceptStream(ctx, fullMethod(method), req, open)
+}
+
+// fullMethod returns the full name of method, "/pkg.Service/Method".
+func fullMethod(method string) string {
+	return "/" + strings.TrimPrefix(method, "/")
+}
+
+// procedureOf returns the procedure of md, "/pkg.Service/Method".
+func procedureOf(md protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+}
+
+// CallOption configures a call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	metadata rpc.MD
+	header   *rpc.MD
+	trailer  *rpc.MD
+	// pushback and endpoint receive the retry pushback of the response
+	// and the endpoint of an attempt
+	pushback *string
+	endpoint *string
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	co := &callOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+	return co
+}
+
+// WithMetadata sends md as request headers. Values of binary keys, ending in
+// "-bin", are raw bytes and are base64-encoded.
+func WithMetadata(md rpc.MD) CallOption {
+	return func(co *callOptions) {
+		if co.metadata == nil {
+			co.metadata = make(rpc.MD)
+		}
+		for key, values := range md {
+			co.metadata.Append(key, values...)
+		}
+	}
+}
+
+// Header stores the response headers of a unary call in md.
+func Header(md *rpc.MD) CallOption {
+	return func(co *callOptions) {
+		co.header = md
+	}
+}
+
+// Trailer stores the response trailers of a unary call in md.
+func Trailer(md *rpc.MD) CallOption {
+	return func(co *callOptions) {
+		co.trailer = md
+	}
+}
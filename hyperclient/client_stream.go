@@ -0,0 +1,228 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// CallClientStream calls the client-streaming method, "pkg.Service/Method".
+// Its messages are sent with Send, and CloseAndReceive returns the
+// response.
+func (c *Client) CallClientStream(ctx context.Context, method string, opts ...CallOption) (*ClientStream, error) {
+	s, err := c.openSendStream(ctx, method, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientStream{stream: s}, nil
+}
+
+// CallBidiStream calls the bidirectional streaming method,
+// "pkg.Service/Method". Messages are sent and received at the same time,
+// which needs HTTP/2. The stream must be closed.
+func (c *Client) CallBidiStream(ctx context.Context, method string, opts ...CallOption) (*BidiStream, error) {
+	return c.openSendStream(ctx, method, true, opts)
+}
+
+// openSendStream opens a call of method, streaming the messages of the
+// client, and those of the server too if serverStreams. The stream
+// interceptors of the client see its opening, with a nil request.
+func (c *Client) openSendStream(ctx context.Context, method string, serverStreams bool, opts []CallOption) (*BidiStream, error) {
+	co := newCallOptions(opts)
+	var opened *BidiStream
+	open := func(ctx context.Context, _ any) (Stream, error) {
+		md, err := c.Method(ctx, method)
+		if err != nil {
+			return nil, err
+		}
+		if !md.IsStreamingClient() || md.IsStreamingServer() != serverStreams {
+			if serverStreams {
+				return nil, fmt.Errorf("hyperclient: method %s is not bidirectional streaming", method)
+			}
+			return nil, fmt.Errorf("hyperclient: method %s is not client-streaming", method)
+		}
+		opened = c.sendStream(ctx, procedureOf(md), md.Input(), md.Output(), co)
+		return opened, nil
+	}
+	if _, err := c.interceptStream(ctx, fullMethod(method), nil, open); err != nil {
+		if opened != nil {
+			_ = opened.Close()
+		}
+		return nil, err
+	}
+	return opened, nil
+}
+
+// sendStream calls procedure with the messages sent on the returned stream
+// as the request body. Its response is read once the server sent its
+// headers, which it may only do at the end of the call. Calls are not
+// retried, and the timeout of the method config bounds the whole stream.
+func (c *Client) sendStream(ctx context.Context, procedure string, input, output protoreflect.MessageDescriptor, co *callOptions) *BidiStream {
+	ctx, cancel := withMethodTimeout(ctx, c.config.FindMethodConfig(procedure))
+	ctx, cancelCall := context.WithCancel(ctx)
+	body, bodyWriter := io.Pipe()
+	s := &BidiStream{
+		input:  input,
+		body:   bodyWriter,
+		opened: make(chan struct{}),
+		cancel: func() {
+			cancelCall()
+			cancel()
+		},
+	}
+
+	go func() {
+		defer close(s.opened)
+		var endpoint string
+		aco := &callOptions{metadata: co.metadata, endpoint: &endpoint}
+		start := time.Now()
+		resp, err := c.sendBody(ctx, c.protocol, procedure, true, body, aco)
+		if err == nil {
+			s.recv = c.newServerStream(resp, s.cancel, output, aco)
+			err = s.recv.err
+		}
+		c.reportAttempt(ctx, AttemptStats{
+			Procedure: procedure,
+			Attempt:   1,
+			Endpoint:  endpoint,
+			Code:      errorCode(err),
+			Start:     start,
+			Latency:   time.Since(start),
+		})
+		if err != nil {
+			s.err = err
+			_ = body.CloseWithError(err)
+		}
+	}()
+	return s
+}
+
+// BidiStream sends and receives the messages of a bidirectional streaming
+// call. Send and Receive can be called from different goroutines, but each
+// from one at a time. It implements Stream for stream interceptors.
+type BidiStream struct {
+	input protoreflect.MessageDescriptor
+	// body is the request body, written by Send
+	body   *io.PipeWriter
+	cancel context.CancelFunc
+	// opened is closed once the server sent the response headers or the
+	// call failed, with err
+	opened chan struct{}
+	recv   *ServerStream
+	err    error
+}
+
+// Send sends msg, a message as the request of Client.Call. It returns
+// io.EOF once the call ended, whose error Receive returns.
+func (s *BidiStream) Send(msg any) error {
+	data, err := marshalRequest(msg, s.input)
+	if err != nil {
+		return err
+	}
+	if _, err := s.body.Write(encodeFrame(data)); err != nil {
+		return io.EOF
+	}
+	return nil
+}
+
+// CloseSend ends the messages of the client.
+func (s *BidiStream) CloseSend() error {
+	return s.body.Close()
+}
+
+// Receive implements Stream. It waits for the response headers of the call
+// first.
+func (s *BidiStream) Receive(msg any) error {
+	<-s.opened
+	if s.recv == nil {
+		return s.err
+	}
+	return s.recv.Receive(msg)
+}
+
+// Header implements Stream. It waits for the response headers of the call.
+func (s *BidiStream) Header() rpc.MD {
+	<-s.opened
+	if s.recv == nil {
+		return nil
+	}
+	return s.recv.Header()
+}
+
+// Trailer implements Stream.
+func (s *BidiStream) Trailer() rpc.MD {
+	<-s.opened
+	if s.recv == nil {
+		return nil
+	}
+	return s.recv.Trailer()
+}
+
+// Close implements Stream.
+func (s *BidiStream) Close() error {
+	s.cancel()
+	_ = s.body.CloseWithError(io.EOF)
+	<-s.opened
+	if s.recv == nil {
+		return nil
+	}
+	return s.recv.Close()
+}
+
+// ClientStream sends the messages of a client-streaming call.
+type ClientStream struct {
+	stream *BidiStream
+}
+
+// Send sends msg, a message as the request of Client.Call. It returns
+// io.EOF once the call ended, whose error CloseAndReceive returns.
+func (s *ClientStream) Send(msg any) error {
+	return s.stream.Send(msg)
+}
+
+// CloseAndReceive ends the messages of the client and decodes the response
+// into resp, a pointer as the response of Client.Call, once the call ended.
+// The response metadata is then available.
+func (s *ClientStream) CloseAndReceive(resp any) error {
+	defer func() { _ = s.stream.Close() }()
+	if err := s.stream.CloseSend(); err != nil {
+		return err
+	}
+	err := s.stream.Receive(resp)
+	if errors.Is(err, io.EOF) {
+		return rpc.NewError(rpc.CodeInternal, "response without a message")
+	}
+	if err != nil {
+		return err
+	}
+	// The status of the call follows its only message
+	switch err := s.stream.Receive(nil); {
+	case err == nil:
+		return rpc.NewError(rpc.CodeInternal, "response with more than one message")
+	case !errors.Is(err, io.EOF):
+		return err
+	}
+	return nil
+}
+
+// Header returns the response headers, waiting for them to arrive.
+func (s *ClientStream) Header() rpc.MD {
+	return s.stream.Header()
+}
+
+// Trailer returns the response trailers, once CloseAndReceive returned.
+func (s *ClientStream) Trailer() rpc.MD {
+	return s.stream.Trailer()
+}
+
+// Close ends the stream, canceling the call if CloseAndReceive was not
+// called.
+func (s *ClientStream) Close() error {
+	return s.stream.Close()
+}
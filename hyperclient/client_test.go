@@ -0,0 +1,454 @@
+package hyperclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/hyperclient"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type GreetRequest struct {
+	Name  string `json:"name"`
+	Count int32  `json:"count"`
+}
+
+type GreetResponse struct {
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+var sentAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newGreetService(opts ...rpc.ServiceOption) *rpc.Service {
+	opts = append([]rpc.ServiceOption{rpc.WithPackage("greet.v1"), rpc.WithReflection(true)}, opts...)
+	svc := rpc.NewService("GreetService", opts...)
+	rpc.MustRegister(svc, "Greet", func(ctx context.Context, req *GreetRequest) (*GreetResponse, error) {
+		if req.Name == "" {
+			return nil, rpc.NewError(rpc.CodeInvalidArgument, "name is required")
+		}
+		md := rpc.Meta(ctx)
+		md.SetHeader(rpc.Pairs("x-greeter", md.Get("x-caller")))
+		md.SetTrailer(rpc.Pairs("x-token-bin", "\x00\xff"))
+		return &GreetResponse{Message: "Hello, " + req.Name, SentAt: sentAt}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "GreetMany", func(_ context.Context, req *GreetRequest, stream rpc.ServerStream[GreetResponse]) error {
+		for i := range req.Count {
+			if err := stream.Send(&GreetResponse{Message: fmt.Sprintf("Hello %d, %s", i, req.Name)}); err != nil {
+				return err
+			}
+		}
+		if req.Name == "fail" {
+			return rpc.NewError(rpc.CodeAborted, "stream failed")
+		}
+		return nil
+	})
+	rpc.MustRegisterMethod(svc,
+		rpc.NewClientStreamMethod("GreetAll", func(ctx context.Context, stream rpc.ClientStream[GreetRequest]) (*GreetResponse, error) {
+			var names []string
+			for {
+				req, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				if req.Name == "" {
+					return nil, rpc.NewError(rpc.CodeInvalidArgument, "name is required")
+				}
+				names = append(names, req.Name)
+			}
+			rpc.Meta(ctx).SetTrailer(rpc.Pairs("x-count", strconv.Itoa(len(names))))
+			return &GreetResponse{Message: "Hello, " + strings.Join(names, " and ")}, nil
+		}),
+		rpc.NewBidiStreamMethod("Chat", func(_ context.Context, stream rpc.BidiStream[GreetRequest, GreetResponse]) error {
+			for {
+				req, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := stream.Send(&GreetResponse{Message: "Hello, " + req.Name}); err != nil {
+					return err
+				}
+			}
+		}),
+	)
+	return svc
+}
+
+func newServer(t *testing.T) (*httptest.Server, *rpc.Service) {
+	t.Helper()
+	svc := newGreetService()
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server, svc
+}
+
+func TestClient(t *testing.T) {
+	server, svc := newServer(t)
+	ctx := context.Background()
+
+	for _, protocol := range []hyperclient.Protocol{hyperclient.ProtocolGRPC, hyperclient.ProtocolConnect} {
+		t.Run(string(protocol), func(t *testing.T) {
+			client, err := hyperclient.New(server.URL, hyperclient.WithProtocol(protocol))
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+
+			t.Run("structs", func(t *testing.T) {
+				var resp GreetResponse
+				if err := client.Call(ctx, "greet.v1.GreetService/Greet", &GreetRequest{Name: "Ann"}, &resp); err != nil {
+					t.Fatalf("Call() failed: %v", err)
+				}
+				if want := (GreetResponse{Message: "Hello, Ann", SentAt: sentAt}); !reflect.DeepEqual(resp, want) {
+					t.Errorf("Expected %+v, got %+v", want, resp)
+				}
+			})
+
+			t.Run("maps", func(t *testing.T) {
+				var resp map[string]any
+				if err := client.Call(ctx, "/greet.v1.GreetService/Greet", map[string]any{"name": "Bob"}, &resp); err != nil {
+					t.Fatalf("Call() failed: %v", err)
+				}
+				want := map[string]any{"message": "Hello, Bob", "sent_at": "2024-05-01T12:00:00Z"}
+				if !reflect.DeepEqual(resp, want) {
+					t.Errorf("Expected %v, got %v", want, resp)
+				}
+			})
+
+			t.Run("dynamic messages", func(t *testing.T) {
+				md, err := client.Method(ctx, "greet.v1.GreetService/Greet")
+				if err != nil {
+					t.Fatalf("Method() failed: %v", err)
+				}
+				req := dynamicpb.NewMessage(md.Input())
+				req.Set(md.Input().Fields().ByName("name"), protoreflect.ValueOfString("Cy"))
+				resp := dynamicpb.NewMessage(md.Output())
+				if err := client.Call(ctx, "greet.v1.GreetService/Greet", req, resp); err != nil {
+					t.Fatalf("Call() failed: %v", err)
+				}
+				if got := resp.Get(md.Output().Fields().ByName("message")).String(); got != "Hello, Cy" {
+					t.Errorf("Expected Hello, Cy, got %s", got)
+				}
+			})
+
+			t.Run("metadata", func(t *testing.T) {
+				var header, trailer rpc.MD
+				err := client.Call(ctx, "greet.v1.GreetService/Greet", json.RawMessage(`{"name":"Di"}`), nil,
+					hyperclient.WithMetadata(rpc.Pairs("x-caller", "test")),
+					hyperclient.Header(&header), hyperclient.Trailer(&trailer))
+				if err != nil {
+					t.Fatalf("Call() failed: %v", err)
+				}
+				if got := header.Get("x-greeter"); len(got) != 1 || got[0] != "test" {
+					t.Errorf("Expected the x-greeter header, got %v", header)
+				}
+				if got := trailer.Get("x-token-bin"); len(got) != 1 || got[0] != "\x00\xff" {
+					t.Errorf("Expected the x-token-bin trailer, got %v", trailer)
+				}
+			})
+
+			t.Run("errors", func(t *testing.T) {
+				err := client.Call(ctx, "greet.v1.GreetService/Greet", &GreetRequest{}, &GreetResponse{})
+				var rpcErr *rpc.Error
+				if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeInvalidArgument || rpcErr.Message != "name is required" {
+					t.Errorf("Expected invalid_argument: name is required, got %v", err)
+				}
+				err = client.Call(ctx, "greet.v1.GreetService/Missing", &GreetRequest{}, nil)
+				if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnimplemented {
+					t.Errorf("Expected unimplemented, got %v", err)
+				}
+			})
+
+			t.Run("server streaming", func(t *testing.T) {
+				for _, tc := range []struct {
+					name string
+					want error
+				}{{"Eve", nil}, {"fail", rpc.NewError(rpc.CodeAborted, "stream failed")}} {
+					stream, err := client.CallServerStream(ctx, "greet.v1.GreetService/GreetMany", &GreetRequest{Name: tc.name, Count: 3})
+					if err != nil {
+						t.Fatalf("CallServerStream() failed: %v", err)
+					}
+					var messages []string
+					for {
+						var resp GreetResponse
+						if err = stream.Receive(&resp); err != nil {
+							break
+						}
+						messages = append(messages, resp.Message)
+					}
+					_ = stream.Close()
+					if len(messages) != 3 || messages[2] != "Hello 2, "+tc.name {
+						t.Errorf("Expected 3 messages, got %v", messages)
+					}
+					if tc.want == nil && !errors.Is(err, io.EOF) || tc.want != nil && (err == nil || err.Error() != tc.want.Error()) {
+						t.Errorf("Expected the stream to end with %v, got %v", tc.want, err)
+					}
+				}
+			})
+
+			t.Run("client streaming", func(t *testing.T) {
+				stream, err := client.CallClientStream(ctx, "greet.v1.GreetService/GreetAll")
+				if err != nil {
+					t.Fatalf("CallClientStream() failed: %v", err)
+				}
+				for _, name := range []string{"Fay", "Gus"} {
+					if err := stream.Send(&GreetRequest{Name: name}); err != nil {
+						t.Fatalf("Send() failed: %v", err)
+					}
+				}
+				var resp GreetResponse
+				if err := stream.CloseAndReceive(&resp); err != nil || resp.Message != "Hello, Fay and Gus" {
+					t.Errorf("Expected Hello, Fay and Gus, got %+v (%v)", resp, err)
+				}
+				if got := stream.Trailer().Get("x-count"); len(got) != 1 || got[0] != "2" {
+					t.Errorf("Expected the x-count trailer, got %v", stream.Trailer())
+				}
+
+				stream, err = client.CallClientStream(ctx, "greet.v1.GreetService/GreetAll")
+				if err != nil {
+					t.Fatalf("CallClientStream() failed: %v", err)
+				}
+				_ = stream.Send(&GreetRequest{})
+				var rpcErr *rpc.Error
+				if err := stream.CloseAndReceive(nil); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeInvalidArgument {
+					t.Errorf("Expected invalid_argument, got %v", err)
+				}
+			})
+
+			t.Run("bidirectional streaming", func(t *testing.T) {
+				stream, err := client.CallBidiStream(ctx, "greet.v1.GreetService/Chat")
+				if err != nil {
+					t.Fatalf("CallBidiStream() failed: %v", err)
+				}
+				defer func() { _ = stream.Close() }()
+				for _, name := range []string{"Hal", "Ivy"} {
+					if err := stream.Send(&GreetRequest{Name: name}); err != nil {
+						t.Fatalf("Send() failed: %v", err)
+					}
+					var resp GreetResponse
+					if err := stream.Receive(&resp); err != nil || resp.Message != "Hello, "+name {
+						t.Fatalf("Expected Hello, %s, got %+v (%v)", name, resp, err)
+					}
+				}
+				if err := stream.CloseSend(); err != nil {
+					t.Fatal(err)
+				}
+				if err := stream.Receive(nil); !errors.Is(err, io.EOF) {
+					t.Errorf("Expected the end of the stream, got %v", err)
+				}
+			})
+
+			t.Run("streams of another kind", func(t *testing.T) {
+				if _, err := client.CallClientStream(ctx, "greet.v1.GreetService/Chat"); err == nil {
+					t.Error("Expected an error for a bidirectional method")
+				}
+				if _, err := client.CallBidiStream(ctx, "greet.v1.GreetService/GreetMany"); err == nil {
+					t.Error("Expected an error for a server-streaming method")
+				}
+			})
+		})
+	}
+
+	t.Run("services", func(t *testing.T) {
+		client, err := hyperclient.New(server.URL)
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		services, err := client.Services(ctx)
+		if err != nil || !reflect.DeepEqual(services, []string{"greet.v1.GreetService"}) {
+			t.Errorf("Expected greet.v1.GreetService, got %v (%v)", services, err)
+		}
+	})
+
+	t.Run("descriptor set", func(t *testing.T) {
+		client, err := hyperclient.New(server.URL, hyperclient.WithDescriptorSet(svc.GetFileDescriptorSet()))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		services, err := client.Services(ctx)
+		if err != nil || !reflect.DeepEqual(services, []string{"greet.v1.GreetService"}) {
+			t.Errorf("Expected greet.v1.GreetService, got %v (%v)", services, err)
+		}
+		var resp GreetResponse
+		if err := client.Call(ctx, "greet.v1.GreetService/Greet", &GreetRequest{Name: "Fay"}, &resp); err != nil || resp.Message != "Hello, Fay" {
+			t.Errorf("Expected Hello, Fay, got %+v (%v)", resp, err)
+		}
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		for _, target := range []string{"", "ftp://host", "http://"} {
+			if _, err := hyperclient.New(target); err == nil {
+				t.Errorf("%q: expected an error", target)
+			}
+		}
+	})
+}
+
+// newCountingServer starts a server of svc counting the calls of the greet
+// service.
+func newCountingServer(t *testing.T, svc ...*rpc.Service) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	gw, err := rpc.NewGateway(svc...)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	calls := new(atomic.Int32)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/greet.v1.") {
+			calls.Add(1)
+		}
+		gw.ServeHTTP(w, r)
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func TestClientLoadBalancing(t *testing.T) {
+	ctx := context.Background()
+	server1, calls1 := newCountingServer(t, newGreetService())
+	server2, calls2 := newCountingServer(t, newGreetService())
+	addrs := []string{server1.Listener.Addr().String(), server2.Listener.Addr().String()}
+	call := func(client *hyperclient.Client) error {
+		return client.Call(ctx, "greet.v1.GreetService/Greet", &GreetRequest{Name: "Ann"}, nil)
+	}
+	reset := func() {
+		calls1.Store(0)
+		calls2.Store(0)
+	}
+
+	t.Run("pick first", func(t *testing.T) {
+		reset()
+		client, err := hyperclient.New("localhost", hyperclient.WithEndpoints(addrs...))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		for range 4 {
+			if err := call(client); err != nil {
+				t.Fatalf("Call() failed: %v", err)
+			}
+		}
+		if calls1.Load() != 4 || calls2.Load() != 0 {
+			t.Errorf("Expected 4 calls to the first endpoint, got %d and %d", calls1.Load(), calls2.Load())
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		reset()
+		client, err := hyperclient.New("localhost", hyperclient.WithEndpoints(addrs...),
+			hyperclient.WithServiceConfig(`{"loadBalancingConfig": [{"weighted_round_robin": {}}, {"round_robin": {}}]}`))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		for range 4 {
+			if err := call(client); err != nil {
+				t.Fatalf("Call() failed: %v", err)
+			}
+		}
+		if calls1.Load() != 2 || calls2.Load() != 2 {
+			t.Errorf("Expected 2 calls to each endpoint, got %d and %d", calls1.Load(), calls2.Load())
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		reset()
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		client, err := hyperclient.New("localhost", hyperclient.WithEndpoints(down.Listener.Addr().String(), addrs[1]))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		var rpcErr *rpc.Error
+		if err := call(client); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnavailable {
+			t.Fatalf("Expected unavailable, got %v", err)
+		}
+		for range 3 {
+			if err := call(client); err != nil {
+				t.Fatalf("Call() failed: %v", err)
+			}
+		}
+		if calls2.Load() != 3 {
+			t.Errorf("Expected 3 calls to the second endpoint, got %d", calls2.Load())
+		}
+	})
+
+	t.Run("health checks", func(t *testing.T) {
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus("greet.v1.GreetService", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthSvc := rpc.NewService("Health", rpc.WithPackage("grpc.health.v1"))
+		if err := rpc.RegisterProtoService(healthSvc, &healthpb.Health_ServiceDesc, healthServer); err != nil {
+			t.Fatalf("RegisterProtoService() failed: %v", err)
+		}
+		unhealthy, unhealthyCalls := newCountingServer(t, newGreetService(), healthSvc)
+		reset()
+
+		client, err := hyperclient.New("localhost", hyperclient.WithEndpoints(unhealthy.Listener.Addr().String(), addrs[0]),
+			hyperclient.WithServiceConfig(`{
+				"loadBalancingPolicy": "round_robin",
+				"healthCheckConfig": {"serviceName": "greet.v1.GreetService"}
+			}`))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		// The first call starts the health checks
+		if err := call(client); err != nil {
+			t.Fatalf("Call() failed: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			before := unhealthyCalls.Load()
+			for range 4 {
+				if err := call(client); err != nil {
+					t.Fatalf("Call() failed: %v", err)
+				}
+			}
+			if unhealthyCalls.Load() == before {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Error("Expected calls to skip the endpoint failing its health checks")
+	})
+
+	t.Run("invalid configs", func(t *testing.T) {
+		for _, opts := range [][]hyperclient.Option{
+			{hyperclient.WithServiceConfig(`{"loadBalancingConfig": [{"grpclb": {}}]}`)},
+			{hyperclient.WithServiceConfig(`{"loadBalancingPolicy": "random"}`)},
+			{hyperclient.WithServiceConfig(`{`)},
+		} {
+			if _, err := hyperclient.New("localhost:8080", opts...); err == nil {
+				t.Error("Expected an error")
+			}
+		}
+		if _, err := hyperclient.New("dns:///localhost:8080", hyperclient.WithEndpoints(addrs...)); err == nil {
+			t.Error("Expected an error for endpoints of a dns target")
+		}
+	})
+}
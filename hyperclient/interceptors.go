@@ -0,0 +1,118 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// StreamInterceptor wraps the streaming calls of a client, as
+// rpc.Interceptor wraps unary calls. Client-streaming and bidirectional
+// calls are opened through it with a nil request, and the stream it returns
+// is not used for them.
+type StreamInterceptor interface {
+	// InterceptStream wraps the opening of the stream of a call of method,
+	// "/package.Service/Method", with req. It can wrap the stream returned
+	// by open to observe the messages and the end of the stream.
+	InterceptStream(ctx context.Context, method string, req any, open func(context.Context, any) (Stream, error)) (Stream, error)
+}
+
+// WithInterceptors wraps the unary calls of the client with interceptors,
+// the outermost first. Interceptors are those of services, called with the
+// full method name, "/package.Service/Method", the request given to
+// Client.Call, and a handler that makes the call, including its retries,
+// and returns the response given to Client.Call:
+//
+//	client, err := hyperclient.New(target, hyperclient.WithInterceptors(
+//		&rpc.LoggingInterceptor{Logger: log.Default()},
+//		&hyperclient.TokenInterceptor{Token: tokenSource},
+//	))
+func WithInterceptors(interceptors ...rpc.Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors wraps the streaming calls of the client with
+// interceptors, the outermost first.
+func WithStreamInterceptors(interceptors ...StreamInterceptor) Option {
+	return func(o *options) {
+		o.streamInterceptors = append(o.streamInterceptors, interceptors...)
+	}
+}
+
+// interceptStream opens the stream of a call of method through the stream
+// interceptors of the client.
+func (c *Client) interceptStream(ctx context.Context, method string, req any, open func(context.Context, any) (Stream, error)) (Stream, error) {
+	for i := len(c.streamInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.streamInterceptors[i], open
+		open = func(ctx context.Context, req any) (Stream, error) {
+			return interceptor.InterceptStream(ctx, method, req, next)
+		}
+	}
+	return open(ctx, req)
+}
+
+// contextKey is the type of the context keys of the package.
+type contextKey string
+
+// outgoingMetadataKey stores the metadata sent with the calls of a context.
+const outgoingMetadataKey contextKey = "hyperclient-outgoing-metadata"
+
+// AppendToOutgoingContext returns a context whose calls send the key-value
+// pairs kv as request metadata, in addition to the metadata of ctx, e.g.
+// for interceptors to add credentials.
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md := OutgoingMetadata(ctx).Copy()
+	for key, values := range rpc.Pairs(kv...) {
+		md.Append(key, values...)
+	}
+	return context.WithValue(ctx, outgoingMetadataKey, md)
+}
+
+// OutgoingMetadata returns the metadata sent with the calls of ctx, which
+// must not be modified.
+func OutgoingMetadata(ctx context.Context) rpc.MD {
+	md, _ := ctx.Value(outgoingMetadataKey).(rpc.MD)
+	return md
+}
+
+// TokenInterceptor sends a bearer token in the authorization metadata of
+// unary and streaming calls.
+type TokenInterceptor struct {
+	// Token returns the token of a call, e.g. from a cached OAuth2 token
+	// source. Calls fail with its error, as unauthenticated unless it is
+	// an *rpc.Error.
+	Token func(ctx context.Context) (string, error)
+}
+
+// Intercept implements rpc.Interceptor.
+func (t *TokenInterceptor) Intercept(ctx context.Context, _ string, req any, handler func(context.Context, any) (any, error)) (any, error) {
+	ctx, err := t.withToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// InterceptStream implements StreamInterceptor.
+func (t *TokenInterceptor) InterceptStream(ctx context.Context, _ string, req any, open func(context.Context, any) (Stream, error)) (Stream, error) {
+	ctx, err := t.withToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return open(ctx, req)
+}
+
+// withToken returns ctx sending the token of the call.
+func (t *TokenInterceptor) withToken(ctx context.Context) (context.Context, error) {
+	token, err := t.Token(ctx)
+	if err != nil {
+		if rpcErr := (*rpc.Error)(nil); errors.As(err, &rpcErr) {
+			return nil, err
+		}
+		return nil, rpc.NewErrorf(rpc.CodeUnauthenticated, "failed to get token: %v", err)
+	}
+	return AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), nil
+}
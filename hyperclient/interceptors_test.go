@@ -0,0 +1,163 @@
+package hyperclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/hyperclient"
+	"github.com/i2y/hyperway/rpc"
+)
+
+// recordingInterceptor records the calls it intercepts, on clients and
+// servers alike.
+type recordingInterceptor struct {
+	name  string
+	mu    *sync.Mutex
+	calls *[]string
+}
+
+func (r *recordingInterceptor) Intercept(ctx context.Context, method string, req any, handler func(context.Context, any) (any, error)) (any, error) {
+	r.record(method)
+	return handler(ctx, req)
+}
+
+func (r *recordingInterceptor) InterceptStream(ctx context.Context, method string, req any, open func(context.Context, any) (hyperclient.Stream, error)) (hyperclient.Stream, error) {
+	r.record(method)
+	stream, err := open(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingStream{Stream: stream, interceptor: r}, nil
+}
+
+func (r *recordingInterceptor) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.calls = append(*r.calls, r.name+" "+call)
+}
+
+// recordingStream records the messages received by a stream.
+type recordingStream struct {
+	hyperclient.Stream
+	interceptor *recordingInterceptor
+}
+
+func (s *recordingStream) Receive(msg any) error {
+	err := s.Stream.Receive(msg)
+	if err == nil {
+		s.interceptor.record("message")
+	}
+	return err
+}
+
+// authInterceptor rejects calls without the bearer token "secret".
+type authInterceptor struct{}
+
+func (authInterceptor) Intercept(ctx context.Context, _ string, req any, handler func(context.Context, any) (any, error)) (any, error) {
+	if rpc.Meta(ctx).Get("authorization") != "Bearer secret" {
+		return nil, rpc.NewError(rpc.CodeUnauthenticated, "invalid token")
+	}
+	return handler(ctx, req)
+}
+
+func TestClientInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	shared := &recordingInterceptor{name: "shared", mu: &mu, calls: &calls}
+	inner := &recordingInterceptor{name: "inner", mu: &mu, calls: &calls}
+
+	gw, err := rpc.NewGateway(newGreetService(rpc.WithInterceptors(shared, authInterceptor{})))
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	defer server.Close()
+
+	token := "secret"
+	tokens := &hyperclient.TokenInterceptor{Token: func(context.Context) (string, error) {
+		if token == "" {
+			return "", errors.New("no token")
+		}
+		return token, nil
+	}}
+	client, err := hyperclient.New(server.URL,
+		hyperclient.WithInterceptors(shared, inner, tokens),
+		hyperclient.WithStreamInterceptors(shared, tokens))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	ctx := context.Background()
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = nil
+	}
+	recorded := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		reset()
+		var header rpc.MD
+		callCtx := hyperclient.AppendToOutgoingContext(ctx, "x-caller", "interceptor-test")
+		err := client.Call(callCtx, "greet.v1.GreetService/Greet", &GreetRequest{Name: "Ann"}, &GreetResponse{}, hyperclient.Header(&header))
+		if err != nil {
+			t.Fatalf("Call() failed: %v", err)
+		}
+		want := []string{"shared /greet.v1.GreetService/Greet", "inner /greet.v1.GreetService/Greet", "shared Greet"}
+		if got := recorded(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+		if got := header.Get("x-greeter"); len(got) != 1 || got[0] != "interceptor-test" {
+			t.Errorf("Expected the outgoing metadata to be sent, got %v", header)
+		}
+	})
+
+	t.Run("server streaming", func(t *testing.T) {
+		reset()
+		stream, err := client.CallServerStream(ctx, "greet.v1.GreetService/GreetMany", &GreetRequest{Name: "Bob", Count: 2})
+		if err != nil {
+			t.Fatalf("CallServerStream() failed: %v", err)
+		}
+		defer func() { _ = stream.Close() }()
+		for {
+			if err := stream.Receive(&GreetResponse{}); err != nil {
+				break
+			}
+		}
+		want := []string{"shared /greet.v1.GreetService/GreetMany", "shared message", "shared message"}
+		if got := recorded(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("token errors", func(t *testing.T) {
+		reset()
+		token = ""
+		defer func() { token = "secret" }()
+		var rpcErr *rpc.Error
+		err := client.Call(ctx, "greet.v1.GreetService/Greet", &GreetRequest{Name: "Ann"}, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnauthenticated {
+			t.Errorf("Expected unauthenticated, got %v", err)
+		}
+		_, err = client.CallServerStream(ctx, "greet.v1.GreetService/GreetMany", &GreetRequest{Name: "Ann"})
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnauthenticated {
+			t.Errorf("Expected unauthenticated, got %v", err)
+		}
+		// The calls failed before reaching the server
+		for _, call := range recorded() {
+			if call == "shared Greet" || call == "shared GreetMany" {
+				t.Errorf("Expected no call on the server, got %v", recorded())
+			}
+		}
+	})
+}
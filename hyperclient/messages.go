@@ -0,0 +1,105 @@
+package hyperclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+	"github.com/i2y/hyperway/rpc"
+)
+
+// jsonOptions encode responses decoded into maps and raw JSON with the field
+// names of the schema, as hyperway servers do by default.
+var jsonOptions = protojson.MarshalOptions{UseProtoNames: true}
+
+// marshalRequest encodes req as a message of md in the binary format.
+func marshalRequest(req any, md protoreflect.MessageDescriptor) ([]byte, error) {
+	switch req := req.(type) {
+	case nil:
+		return nil, nil
+	case proto.Message:
+		if name := req.ProtoReflect().Descriptor().FullName(); name != md.FullName() {
+			return nil, fmt.Errorf("hyperclient: request is a %s, not a %s", name, md.FullName())
+		}
+		return proto.Marshal(req)
+	case json.RawMessage:
+		return marshalJSONRequest(req, md)
+	case map[string]any:
+		data, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("hyperclient: invalid request: %w", err)
+		}
+		return marshalJSONRequest(data, md)
+	default:
+		msg := dynamicpb.NewMessage(md)
+		if err := reflectutil.StructToProto(req, msg); err != nil {
+			return nil, fmt.Errorf("hyperclient: invalid request: %w", err)
+		}
+		return proto.Marshal(msg)
+	}
+}
+
+// marshalJSONRequest encodes the request data, in the proto3 JSON mapping,
+// as a message of md in the binary format.
+func marshalJSONRequest(data []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("hyperclient: invalid request: %w", err)
+	}
+	return proto.Marshal(msg)
+}
+
+// unmarshalResponse decodes the response data, a message of md in the
+// binary format, into resp.
+func unmarshalResponse(data []byte, md protoreflect.MessageDescriptor, resp any) error {
+	if resp == nil {
+		return nil
+	}
+	if msg, ok := resp.(proto.Message); ok {
+		if name := msg.ProtoReflect().Descriptor().FullName(); name != md.FullName() {
+			return fmt.Errorf("hyperclient: response is a %s, not a %s", md.FullName(), name)
+		}
+		return unmarshalMessage(data, msg)
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := unmarshalMessage(data, msg); err != nil {
+		return err
+	}
+	switch resp := resp.(type) {
+	case *json.RawMessage:
+		data, err := jsonOptions.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("hyperclient: failed to encode response: %w", err)
+		}
+		*resp = data
+	case *map[string]any:
+		data, err := jsonOptions.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("hyperclient: failed to encode response: %w", err)
+		}
+		*resp = nil
+		if err := json.Unmarshal(data, resp); err != nil {
+			return fmt.Errorf("hyperclient: failed to decode response: %w", err)
+		}
+	default:
+		if err := reflectutil.ProtoToStruct(msg, resp); err != nil {
+			return fmt.Errorf("hyperclient: failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// unmarshalMessage decodes data into msg, failing the call if the response
+// is invalid.
+func unmarshalMessage(data []byte, msg proto.Message) error {
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return rpc.NewErrorf(rpc.CodeInternal, "invalid response message: %v", err)
+	}
+	return nil
+}
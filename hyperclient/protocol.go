@@ -0,0 +1,347 @@
+package hyperclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+	"github.com/i2y/hyperway/rpc"
+)
+
+const (
+	// maxMessageSize bounds the size of response messages
+	maxMessageSize = 64 << 20
+	// frameHeaderSize is the size of the header of enveloped messages
+	frameHeaderSize = 5
+	// flagCompressed marks compressed enveloped messages
+	flagCompressed = 1
+	// flagEndStream marks the end-of-stream message of Connect streams
+	flagEndStream = 2
+	// connectTrailerPrefix prefixes the trailers of Connect unary responses
+	connectTrailerPrefix = "Trailer-"
+)
+
+// skippedHeaders are response headers of the protocols rather than metadata
+// of the call.
+var skippedHeaders = map[string]bool{
+	"Content-Encoding":         true,
+	"Content-Length":           true,
+	"Connect-Accept-Encoding":  true,
+	"Connect-Content-Encoding": true,
+	"Date":                     true,
+	"Trailer":                  true,
+}
+
+// unary calls the unary procedure with protocol.
+func (c *Client) unary(ctx context.Context, protocol Protocol, procedure string, data []byte, co *callOptions) ([]byte, error) {
+	resp, err := c.send(ctx, protocol, procedure, false, data, co)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if protocol == ProtocolConnect {
+		return readConnectUnary(resp, co)
+	}
+	return readGRPCUnary(resp, co)
+}
+
+// send sends the request message data to procedure with protocol, as the
+// single message of a stream with stream, at the endpoint picked by the
+// balancer.
+func (c *Client) send(ctx context.Context, protocol Protocol, procedure string, stream bool, data []byte, co *callOptions) (*http.Response, error) {
+	if protocol == ProtocolGRPC || stream {
+		data = encodeFrame(data)
+	}
+	return c.sendBody(ctx, protocol, procedure, stream, bytes.NewReader(data), co)
+}
+
+// sendBody sends body, the enveloped messages of a stream with stream or
+// the message of a unary Connect call, to procedure with protocol at the
+// endpoint picked by the balancer.
+func (c *Client) sendBody(ctx context.Context, protocol Protocol, procedure string, stream bool, body io.Reader, co *callOptions) (*http.Response, error) {
+	addr, err := c.balancer.pick(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if co.endpoint != nil {
+		*co.endpoint = addr
+	}
+	resp, err := c.post(ctx, addr, protocol, procedure, stream, body, co)
+	switch {
+	case err == nil:
+		c.balancer.succeeded(addr)
+	case ctx.Err() == nil:
+		c.balancer.failed(addr)
+	}
+	return resp, err
+}
+
+// post sends the request body to procedure at the endpoint addr.
+func (c *Client) post(ctx context.Context, addr string, protocol Protocol, procedure string, stream bool, body io.Reader, co *callOptions) (*http.Response, error) {
+	u := c.base.JoinPath(procedure)
+	u.Host = addr
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, rpc.NewErrorf(rpc.CodeInternal, "failed to create request: %v", err)
+	}
+	req.Host = c.base.Host
+	for _, md := range []rpc.MD{OutgoingMetadata(ctx), co.metadata} {
+		for key, values := range md {
+			for _, value := range values {
+				req.Header.Add(key, grpcutil.SanitizeValue(key, value))
+			}
+		}
+	}
+	switch {
+	case protocol == ProtocolGRPC:
+		req.Header.Set("Content-Type", "application/grpc+proto")
+		req.Header.Set("Te", "trailers")
+	case stream:
+		req.Header.Set("Content-Type", "application/connect+proto")
+		req.Header.Set("Connect-Protocol-Version", "1")
+	default:
+		req.Header.Set("Content-Type", "application/proto")
+		req.Header.Set("Connect-Protocol-Version", "1")
+	}
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	return resp, nil
+}
+
+// transportError converts an error sending a request to the error of the
+// call.
+func transportError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return rpc.NewError(rpc.CodeDeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return rpc.NewError(rpc.CodeCanceled, "call canceled")
+	default:
+		return rpc.NewErrorf(rpc.CodeUnavailable, "unavailable: %v", err)
+	}
+}
+
+// readGRPCUnary reads the single message of a unary gRPC response.
+func readGRPCUnary(resp *http.Response, co *callOptions) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, rpc.NewErrorf(codeForHTTPStatus(resp.StatusCode), "HTTP %d", resp.StatusCode)
+	}
+	storeMetadata(co.header, headerMetadata(resp.Header))
+
+	// A trailers-only response carries the status in the headers
+	if resp.Header.Get("Grpc-Status") != "" {
+		storeMetadata(co.trailer, headerMetadata(resp.Header))
+		storePushback(co, resp.Header)
+		if err := grpcStatusError(resp.Header); err != nil {
+			return nil, err
+		}
+		return nil, rpc.NewError(rpc.CodeInternal, "response without a message")
+	}
+	reader := &frameReader{r: resp.Body, encoding: resp.Header.Get("Grpc-Encoding")}
+	_, message, readErr := reader.next()
+	_, _ = io.Copy(io.Discard, resp.Body) // Trailers follow the body
+	storeMetadata(co.trailer, headerMetadata(resp.Trailer))
+	storePushback(co, resp.Trailer)
+	if err := grpcStatusError(resp.Trailer); err != nil {
+		return nil, err
+	}
+	if errors.Is(readErr, io.EOF) {
+		return nil, rpc.NewError(rpc.CodeInternal, "response without a message")
+	}
+	return message, readErr
+}
+
+// readConnectUnary reads the message of a unary Connect response.
+func readConnectUnary(resp *http.Response, co *callOptions) ([]byte, error) {
+	header, trailer := make(http.Header), make(http.Header)
+	for key, values := range resp.Header {
+		if name, ok := strings.CutPrefix(key, connectTrailerPrefix); ok {
+			trailer[textproto.CanonicalMIMEHeaderKey(name)] = values
+		} else {
+			header[key] = values
+		}
+	}
+	storeMetadata(co.header, headerMetadata(header))
+	storeMetadata(co.trailer, headerMetadata(trailer))
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, transportError(err)
+	}
+	if len(body) > maxMessageSize {
+		return nil, rpc.NewError(rpc.CodeResourceExhausted, "response exceeds the message size limit")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, connectError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// encodeFrame envelopes a message for gRPC and Connect streams.
+func encodeFrame(data []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(data))) //nolint:gosec // bounded by the request size
+	copy(frame[frameHeaderSize:], data)
+	return frame
+}
+
+// frameReader reads the enveloped messages of a response body, compressed
+// with encoding.
+type frameReader struct {
+	r        io.Reader
+	encoding string
+}
+
+// next returns the flags and the message of the next envelope, or io.EOF at
+// the end of the body.
+func (fr *frameReader) next() (byte, []byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(fr.r, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, rpc.NewErrorf(rpc.CodeInternal, "truncated response: %v", err)
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return 0, nil, rpc.NewErrorf(rpc.CodeResourceExhausted, "response message of %d bytes exceeds the limit", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, message); err != nil {
+		return 0, nil, rpc.NewErrorf(rpc.CodeInternal, "truncated response: %v", err)
+	}
+	if header[0]&flagCompressed == 0 {
+		return header[0], message, nil
+	}
+
+	if fr.encoding != "gzip" {
+		return 0, nil, rpc.NewErrorf(rpc.CodeInternal, "response compressed with unsupported encoding %q", fr.encoding)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return 0, nil, rpc.NewErrorf(rpc.CodeInternal, "invalid compressed message: %v", err)
+	}
+	message, err = io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return 0, nil, rpc.NewErrorf(rpc.CodeInternal, "invalid compressed message: %v", err)
+	}
+	if len(message) > maxMessageSize {
+		return 0, nil, rpc.NewError(rpc.CodeResourceExhausted, "response message exceeds the limit")
+	}
+	return header[0], message, nil
+}
+
+// grpcStatusError returns the error of the gRPC status in h, or nil if it is
+// OK. A missing status is an internal error.
+func grpcStatusError(h http.Header) error {
+	value := h.Get("Grpc-Status")
+	if value == "" {
+		return rpc.NewError(rpc.CodeInternal, "response without grpc-status")
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return rpc.NewErrorf(rpc.CodeInternal, "invalid grpc-status %q", value)
+	}
+	if status == 0 {
+		return nil
+	}
+	return rpc.NewError(rpc.Code(grpcutil.CodeForGRPCStatus(status)), grpcutil.DecodeMessage(h.Get("Grpc-Message")))
+}
+
+// connectError returns the error of a failed Connect unary response with
+// body, or one from its HTTP status if body is not a Connect error.
+func connectError(status int, body []byte) error {
+	var e struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &e) != nil || e.Code == "" {
+		return rpc.NewErrorf(codeForHTTPStatus(status), "HTTP %d", status)
+	}
+	return rpc.NewError(rpc.Code(e.Code), e.Message)
+}
+
+// connectEndStream is the end-of-stream message of Connect streams.
+type connectEndStream struct {
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Metadata http.Header `json:"metadata"`
+}
+
+// parseConnectEndStream returns the trailers and the error of the
+// end-of-stream message data.
+func parseConnectEndStream(data []byte) (rpc.MD, error) {
+	var end connectEndStream
+	if err := json.Unmarshal(data, &end); err != nil {
+		return nil, rpc.NewErrorf(rpc.CodeInternal, "invalid end-of-stream message: %v", err)
+	}
+	trailer := headerMetadata(end.Metadata)
+	if end.Error != nil {
+		code := rpc.Code(end.Error.Code)
+		if code == "" {
+			code = rpc.CodeUnknown
+		}
+		return trailer, rpc.NewError(code, end.Error.Message)
+	}
+	return trailer, nil
+}
+
+// codeForHTTPStatus maps the HTTP status of a failed response without a
+// status of its own to an error code, as gRPC and Connect clients do.
+func codeForHTTPStatus(status int) rpc.Code {
+	return rpc.Code(grpcutil.CodeForHTTPStatus(status))
+}
+
+// headerMetadata returns the metadata of the custom fields of h, decoding
+// the base64 values of binary keys.
+func headerMetadata(h http.Header) rpc.MD {
+	md := make(rpc.MD, len(h))
+	for key, values := range h {
+		if skippedHeaders[textproto.CanonicalMIMEHeaderKey(key)] || strings.HasPrefix(strings.ToLower(key), "grpc-") {
+			continue
+		}
+		if !grpcutil.IsBinaryKey(key) {
+			md.Append(key, values...)
+			continue
+		}
+		for _, value := range values {
+			for part := range strings.SplitSeq(value, ",") {
+				part = strings.TrimSpace(part)
+				if raw, err := grpcutil.DecodeBinary(part); err == nil {
+					part = raw
+				}
+				md.Append(key, part)
+			}
+		}
+	}
+	return md
+}
+
+// storeMetadata stores md in dst, if the caller asked for it.
+func storeMetadata(dst *rpc.MD, md rpc.MD) {
+	if dst != nil {
+		*dst = md
+	}
+}
+
+// storePushback stores the retry pushback of the gRPC trailers h, if the
+// attempt asked for it.
+func storePushback(co *callOptions, h http.Header) {
+	if co.pushback != nil {
+		*co.pushback = h.Get("Grpc-Retry-Pushback-Ms")
+	}
+}
@@ -0,0 +1,166 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+	"github.com/i2y/hyperway/rpc"
+)
+
+// reflectionProcedure is the gRPC server reflection method.
+const reflectionProcedure = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+
+// reflect sends req to the reflection service of the server. The method is
+// bidirectional streaming, but servers answer each request as it arrives,
+// so a single request is sent like a unary call over gRPC.
+func (c *Client) reflect(ctx context.Context, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err = c.unary(ctx, ProtocolGRPC, reflectionProcedure, data, &callOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("hyperclient: reflection failed: %w", err)
+	}
+	resp := &reflectionpb.ServerReflectionResponse{}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		return nil, fmt.Errorf("hyperclient: invalid reflection response: %w", err)
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		code := rpc.Code(grpcutil.CodeForGRPCStatus(int(e.GetErrorCode())))
+		return nil, rpc.NewError(code, e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// listServices lists the services of the server with reflection.
+func (c *Client) listServices(ctx context.Context) ([]string, error) {
+	resp, err := c.reflect(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if !strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			services = append(services, service.GetName())
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// resolveSymbol adds the file defining symbol and its imports to the files
+// of the client, with reflection.
+func (c *Client) resolveSymbol(ctx context.Context, symbol protoreflect.FullName) error {
+	resp, err := c.reflect(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: string(symbol)},
+	})
+	if err != nil {
+		return err
+	}
+	files, name, err := reflectedFiles(resp)
+	if err != nil {
+		return err
+	}
+	return c.addFile(ctx, name, files)
+}
+
+// reflectedFiles returns the files of a reflection response by name, and the
+// name of the first one, which defines the symbol asked for.
+func reflectedFiles(resp *reflectionpb.ServerReflectionResponse) (map[string]*descriptorpb.FileDescriptorProto, string, error) {
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	var first string
+	for _, data := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(data, file); err != nil {
+			return nil, "", fmt.Errorf("hyperclient: invalid file in reflection response: %w", err)
+		}
+		if first == "" {
+			first = file.GetName()
+		}
+		files[file.GetName()] = file
+	}
+	if first == "" {
+		return nil, "", errors.New("hyperclient: reflection response without files")
+	}
+	return files, first, nil
+}
+
+// addFile adds the file name and its imports to the files of the client.
+// Files are taken from pending, the generated files of the program, or the
+// reflection service; the generated files of the well-known types are used
+// whenever they are linked, so that their Go types convert.
+func (c *Client) addFile(ctx context.Context, name string, pending map[string]*descriptorpb.FileDescriptorProto) error {
+	c.mu.Lock()
+	_, err := c.files.FindFileByPath(name)
+	c.mu.Unlock()
+	if err == nil {
+		return nil
+	}
+
+	fdp, ok := pending[name]
+	if fd, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil && (!ok || strings.HasPrefix(name, "google/protobuf/")) {
+		return c.registerFile(fd)
+	}
+	if !ok {
+		if !c.reflection {
+			return fmt.Errorf("hyperclient: file %s is missing from the descriptor set", name)
+		}
+		resp, err := c.reflect(ctx, &reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		})
+		if err != nil {
+			return err
+		}
+		files, _, err := reflectedFiles(resp)
+		if err != nil {
+			return err
+		}
+		for fileName, file := range files {
+			pending[fileName] = file
+		}
+		if fdp, ok = pending[name]; !ok {
+			return fmt.Errorf("hyperclient: reflection did not return file %s", name)
+		}
+	}
+
+	for _, dep := range fdp.GetDependency() {
+		if err := c.addFile(ctx, dep, pending); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.files.FindFileByPath(name); err == nil {
+		return nil // Added by a concurrent call
+	}
+	fd, err := protodesc.NewFile(fdp, c.files)
+	if err != nil {
+		return fmt.Errorf("hyperclient: invalid file %s: %w", name, err)
+	}
+	return c.files.RegisterFile(fd)
+}
+
+// registerFile adds the generated file fd to the files of the client.
+func (c *Client) registerFile(fd protoreflect.FileDescriptor) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	return c.files.RegisterFile(fd)
+}
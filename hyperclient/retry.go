@@ -0,0 +1,345 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// AttemptMetadataKey is the request metadata key carrying the number of the
+// attempt of calls of methods with a retry or hedging policy, starting at 1.
+// Attempts after the first also carry the standard
+// grpc-previous-rpc-attempts header, as read by rpc.PreviousRPCAttempts.
+const AttemptMetadataKey = "x-attempt"
+
+// maxAttempts caps the attempts of retry and hedging policies, as the gRPC
+// spec does.
+const maxAttempts = 5
+
+// AttemptStats describes a finished attempt of a call, for tracing.
+type AttemptStats struct {
+	// Procedure is the full name of the method, "/package.Service/Method".
+	Procedure string
+	// Attempt is the number of the attempt, 1 for the first.
+	Attempt int
+	// Endpoint is the address the attempt was sent to, empty if none was
+	// picked.
+	Endpoint string
+	// Code is the status of the attempt, empty if it succeeded.
+	Code rpc.Code
+	// Start is when the attempt started.
+	Start time.Time
+	// Latency is the time until the response of the attempt, or, for
+	// streaming calls, until the response headers arrived.
+	Latency time.Duration
+}
+
+// OnAttempt calls hook with the stats of each attempt of the calls of the
+// client, including retries and hedged attempts, with the context of the
+// attempt. Attempts losing to another hedged attempt are canceled. Hooks
+// suit tracers recording a span per attempt:
+//
+//	hyperclient.OnAttempt(func(ctx context.Context, stats hyperclient.AttemptStats) {
+//		_, span := tracer.Start(ctx, stats.Procedure, trace.WithTimestamp(stats.Start),
+//			trace.WithAttributes(attribute.Int("rpc.attempt", stats.Attempt)))
+//		span.End(trace.WithTimestamp(stats.Start.Add(stats.Latency)))
+//	})
+//
+// Hooks run on the goroutine of the attempt and should return quickly.
+func OnAttempt(hook func(ctx context.Context, stats AttemptStats)) Option {
+	return func(o *options) {
+		o.attemptHooks = append(o.attemptHooks, hook)
+	}
+}
+
+// attemptResult is the outcome of an attempt of a unary call.
+type attemptResult struct {
+	data     []byte
+	err      error
+	header   rpc.MD
+	trailer  rpc.MD
+	pushback string
+}
+
+// invoke calls the unary procedure with the request message data and
+// returns the response message, retrying or hedging the call as the method
+// config of the service config says.
+func (c *Client) invoke(ctx context.Context, procedure string, data []byte, co *callOptions) ([]byte, error) {
+	mc := c.config.FindMethodConfig(procedure)
+	ctx, cancel := withMethodTimeout(ctx, mc)
+	defer cancel()
+
+	var result attemptResult
+	switch {
+	case mc != nil && mc.HedgingPolicy != nil:
+		result = c.hedge(ctx, procedure, mc.HedgingPolicy, data, co)
+	case mc != nil && mc.RetryPolicy != nil:
+		result = c.retry(ctx, procedure, mc.RetryPolicy, data, co)
+	default:
+		result = c.attempt(ctx, procedure, 1, data, &callOptions{metadata: co.metadata})
+	}
+	storeMetadata(co.header, result.header)
+	storeMetadata(co.trailer, result.trailer)
+	return result.data, result.err
+}
+
+// withMethodTimeout bounds ctx with the timeout of mc, if it has one.
+func withMethodTimeout(ctx context.Context, mc *rpc.MethodConfig) (context.Context, context.CancelFunc) {
+	if mc == nil || mc.Timeout == "" {
+		return ctx, func() {}
+	}
+	timeout, err := time.ParseDuration(mc.Timeout)
+	if err != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// attempt makes attempt n of a unary call with co.
+func (c *Client) attempt(ctx context.Context, procedure string, n int, data []byte, co *callOptions) attemptResult {
+	var result attemptResult
+	var endpoint string
+	co.header, co.trailer, co.pushback, co.endpoint = &result.header, &result.trailer, &result.pushback, &endpoint
+	start := time.Now()
+	result.data, result.err = c.unary(ctx, c.protocol, procedure, data, co)
+	c.reportAttempt(ctx, AttemptStats{
+		Procedure: procedure,
+		Attempt:   n,
+		Endpoint:  endpoint,
+		Code:      errorCode(result.err),
+		Start:     start,
+		Latency:   time.Since(start),
+	})
+	return result
+}
+
+// reportAttempt calls the attempt hooks with stats.
+func (c *Client) reportAttempt(ctx context.Context, stats AttemptStats) {
+	for _, hook := range c.attemptHooks {
+		hook(ctx, stats)
+	}
+}
+
+// retry makes the attempts of a unary call with policy, waiting with
+// exponential backoff, or the server's pushback, between attempts that
+// failed with a retryable status code.
+func (c *Client) retry(ctx context.Context, procedure string, policy *rpc.RetryPolicy, data []byte, co *callOptions) attemptResult {
+	attempts := min(policy.MaxAttempts, maxAttempts)
+	for n := 1; ; n++ {
+		result := c.attempt(ctx, procedure, n, data, attemptOptions(co, n))
+		delay, ok := c.retryDelay(ctx, policy, n, attempts, result)
+		if !ok {
+			return result
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			result.err = transportError(ctx.Err())
+			return result
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying attempt n of attempts with
+// policy, or false if the call ends with result.
+func (c *Client) retryDelay(ctx context.Context, policy *rpc.RetryPolicy, n, attempts int, result attemptResult) (time.Duration, bool) {
+	if result.err == nil {
+		c.throttle.succeeded()
+		return 0, false
+	}
+	if !slices.Contains(policy.RetryableStatusCodes, statusName(result.err)) || ctx.Err() != nil {
+		return 0, false
+	}
+	c.throttle.failed()
+	if n >= attempts || !c.throttle.allows() {
+		return 0, false
+	}
+	if pushback, ok := parsePushback(result.pushback); ok {
+		return pushback, pushback >= 0
+	}
+	return policy.Backoff(n), true
+}
+
+// hedge runs the attempts of a unary call with policy in parallel, starting
+// one every HedgingDelay until one succeeds or fails with a fatal status
+// code. An attempt failing with a non-fatal status code starts the next
+// one at once, or after the server's pushback. The other attempts are
+// canceled once the call ends.
+func (c *Client) hedge(ctx context.Context, procedure string, policy *rpc.HedgingPolicy, data []byte, co *callOptions) attemptResult {
+	// An empty or invalid delay starts all attempts at once
+	delay, _ := time.ParseDuration(policy.HedgingDelay)
+	attempts := min(policy.MaxAttempts, maxAttempts)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan attemptResult, attempts)
+	started, running := 0, 0
+	start := func() {
+		started++
+		running++
+		n := started
+		go func() {
+			results <- c.attempt(ctx, procedure, n, data, attemptOptions(co, n))
+		}()
+	}
+
+	// The first attempt is never throttled
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last attemptResult
+	for {
+		// Stop scheduling hedges once all attempts started
+		hedgeTimer := timer.C
+		if started >= attempts {
+			hedgeTimer = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return attemptResult{err: transportError(ctx.Err())}
+
+		case <-hedgeTimer:
+			if c.throttle.allows() {
+				start()
+				timer.Reset(delay)
+			} else {
+				started = attempts // Throttled, wait for running attempts
+			}
+
+		case result := <-results:
+			running--
+			if result.err == nil {
+				c.throttle.succeeded()
+				return result
+			}
+			if !slices.Contains(policy.NonFatalStatusCodes, statusName(result.err)) {
+				return result
+			}
+			last = result
+			c.throttle.failed()
+
+			switch pushback, ok := parsePushback(result.pushback); {
+			case ok && pushback < 0:
+				started = attempts
+			case ok:
+				timer.Reset(pushback)
+			case started >= attempts:
+			case c.throttle.allows():
+				start()
+				timer.Reset(delay)
+			default:
+				started = attempts
+			}
+		}
+
+		if running == 0 && started >= attempts {
+			return last
+		}
+	}
+}
+
+// attemptOptions returns the options of attempt n of a call with co, whose
+// metadata reports the attempt.
+func attemptOptions(co *callOptions, n int) *callOptions {
+	md := co.metadata.Copy()
+	md.Set(AttemptMetadataKey, strconv.Itoa(n))
+	if n > 1 {
+		md.Set(rpc.PreviousRPCAttemptsHeader, strconv.Itoa(n-1))
+	}
+	return &callOptions{metadata: md}
+}
+
+// parsePushback parses the grpc-retry-pushback-ms trailer of a failed
+// attempt. A negative or invalid pushback, returned as -1, forbids retries.
+func parsePushback(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		return -1, true
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// errorCode returns the code of err, empty if it is nil.
+func errorCode(err error) rpc.Code {
+	if err == nil {
+		return ""
+	}
+	if rpcErr := (*rpc.Error)(nil); errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	return rpc.CodeUnknown
+}
+
+// statusName returns the status code name of err, as service configs list
+// it, such as UNAVAILABLE.
+func statusName(err error) string {
+	return strings.ToUpper(string(errorCode(err)))
+}
+
+// retryThrottle is the retry budget of a client, configured with the
+// retryThrottling of its service config: a token bucket that failed
+// attempts take a token from and successful calls return TokenRatio tokens
+// to. Retries and hedged attempts are only made while more than half of the
+// tokens remain. A nil throttle allows every retry.
+type retryThrottle struct {
+	mu         sync.Mutex
+	maxTokens  float64
+	tokens     float64
+	tokenRatio float64
+}
+
+// newRetryThrottle returns the retry budget of config, or nil.
+func newRetryThrottle(config *rpc.ServiceConfig) *retryThrottle {
+	if config == nil || config.RetryThrottling == nil {
+		return nil
+	}
+	return &retryThrottle{
+		maxTokens: float64(config.RetryThrottling.MaxTokens),
+		tokens:    float64(config.RetryThrottling.MaxTokens),
+		// Decimal places beyond 3 are ignored
+		tokenRatio: math.Floor(config.RetryThrottling.TokenRatio*1000) / 1000,
+	}
+}
+
+// allows reports whether the budget allows another attempt.
+func (t *retryThrottle) allows() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens > t.maxTokens/2
+}
+
+// failed takes a token after a failed attempt.
+func (t *retryThrottle) failed() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = max(t.tokens-1, 0)
+}
+
+// succeeded returns tokens after a successful call.
+func (t *retryThrottle) succeeded() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = min(t.tokens+t.tokenRatio, t.maxTokens)
+}
@@ -0,0 +1,235 @@
+package hyperclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/hyperclient"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type AttemptRequest struct {
+	Failures int32  `json:"failures"`
+	Code     string `json:"code"`
+	Delay    string `json:"delay"`
+}
+
+type AttemptResponse struct {
+	Attempt          string `json:"attempt"`
+	PreviousAttempts int32  `json:"previous_attempts"`
+}
+
+// newAttemptServer starts a server whose methods fail the first Failures
+// attempts of each call, and delays all but the second attempt by Delay.
+func newAttemptServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var calls atomic.Int32
+	fail := func(ctx context.Context, req *AttemptRequest) error {
+		if attempt := rpc.Meta(ctx).Get(hyperclient.AttemptMetadataKey); req.Delay != "" && attempt != "2" {
+			delay, _ := time.ParseDuration(req.Delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		if calls.Add(1) <= req.Failures {
+			return rpc.NewError(rpc.Code(req.Code), "attempt failed")
+		}
+		return nil
+	}
+	response := func(ctx context.Context) *AttemptResponse {
+		return &AttemptResponse{
+			Attempt:          rpc.Meta(ctx).Get(hyperclient.AttemptMetadataKey),
+			PreviousAttempts: int32(rpc.PreviousRPCAttempts(ctx)), //nolint:gosec // small counts
+		}
+	}
+
+	svc := rpc.NewService("AttemptService", rpc.WithPackage("attempt.v1"), rpc.WithReflection(true))
+	rpc.MustRegister(svc, "Call", func(ctx context.Context, req *AttemptRequest) (*AttemptResponse, error) {
+		if err := fail(ctx, req); err != nil {
+			return nil, err
+		}
+		return response(ctx), nil
+	})
+	rpc.MustRegisterServerStream(svc, "Stream", func(ctx context.Context, req *AttemptRequest, stream rpc.ServerStream[AttemptResponse]) error {
+		if err := fail(ctx, req); err != nil {
+			return err
+		}
+		return stream.Send(response(ctx))
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	const serviceConfig = `{
+		"methodConfig": [{
+			"name": [{"service": "attempt.v1.AttemptService"}],
+			"retryPolicy": {
+				"maxAttempts": 3,
+				"initialBackoff": "0.01s",
+				"maxBackoff": "0.05s",
+				"backoffMultiplier": 2,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}]
+	}`
+	newClient := func(t *testing.T, jsonConfig string, opts ...hyperclient.Option) *hyperclient.Client {
+		t.Helper()
+		server := newAttemptServer(t)
+		client, err := hyperclient.New(server.URL, append(opts, hyperclient.WithServiceConfig(jsonConfig))...)
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		// Resolve the service before counting attempts
+		if _, err := client.Method(ctx, "attempt.v1.AttemptService/Call"); err != nil {
+			t.Fatalf("Method() failed: %v", err)
+		}
+		return client
+	}
+
+	t.Run("retries", func(t *testing.T) {
+		var mu sync.Mutex
+		var attempts []hyperclient.AttemptStats
+		client := newClient(t, serviceConfig, hyperclient.OnAttempt(func(_ context.Context, stats hyperclient.AttemptStats) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, stats)
+		}))
+
+		var resp AttemptResponse
+		err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Failures: 2, Code: "unavailable"}, &resp)
+		if err != nil {
+			t.Fatalf("Call() failed: %v", err)
+		}
+		if resp.Attempt != "3" || resp.PreviousAttempts != 2 {
+			t.Errorf("Expected attempt 3 after 2 attempts, got %+v", resp)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(attempts) != 3 {
+			t.Fatalf("Expected 3 attempts, got %+v", attempts)
+		}
+		for i, want := range []rpc.Code{rpc.CodeUnavailable, rpc.CodeUnavailable, ""} {
+			stats := attempts[i]
+			if stats.Attempt != i+1 || stats.Code != want || stats.Procedure != "/attempt.v1.AttemptService/Call" || stats.Endpoint == "" {
+				t.Errorf("Unexpected stats of attempt %d: %+v", i+1, stats)
+			}
+		}
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		client := newClient(t, serviceConfig)
+		var rpcErr *rpc.Error
+		err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Failures: 3, Code: "unavailable"}, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnavailable {
+			t.Errorf("Expected unavailable, got %v", err)
+		}
+		// The third attempt failed, so the next call succeeds at once
+		var resp AttemptResponse
+		if err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{}, &resp); err != nil || resp.Attempt != "1" {
+			t.Errorf("Expected attempt 1, got %+v (%v)", resp, err)
+		}
+	})
+
+	t.Run("non-retryable codes", func(t *testing.T) {
+		client := newClient(t, serviceConfig)
+		var rpcErr *rpc.Error
+		err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Failures: 1, Code: "not_found"}, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeNotFound {
+			t.Errorf("Expected not_found, got %v", err)
+		}
+	})
+
+	t.Run("retry budget", func(t *testing.T) {
+		client := newClient(t, `{
+			"methodConfig": [{
+				"name": [{"service": "attempt.v1.AttemptService"}],
+				"retryPolicy": {"maxAttempts": 3, "initialBackoff": "0.01s", "retryableStatusCodes": ["UNAVAILABLE"]}
+			}],
+			"retryThrottling": {"maxTokens": 2, "tokenRatio": 0.1}
+		}`)
+		// The first failure leaves 1 of 2 tokens, which stops retries
+		var rpcErr *rpc.Error
+		err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Failures: 2, Code: "unavailable"}, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeUnavailable {
+			t.Errorf("Expected unavailable, got %v", err)
+		}
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		client := newClient(t, serviceConfig)
+		stream, err := client.CallServerStream(ctx, "attempt.v1.AttemptService/Stream", &AttemptRequest{Failures: 1, Code: "unavailable"})
+		if err != nil {
+			t.Fatalf("CallServerStream() failed: %v", err)
+		}
+		defer func() { _ = stream.Close() }()
+		var resp AttemptResponse
+		if err := stream.Receive(&resp); err != nil || resp.Attempt != "2" {
+			t.Errorf("Expected attempt 2, got %+v (%v)", resp, err)
+		}
+	})
+
+	t.Run("timeouts", func(t *testing.T) {
+		client := newClient(t, `{"methodConfig": [{"name": [{"service": "attempt.v1.AttemptService"}], "timeout": "0.05s"}]}`)
+		var rpcErr *rpc.Error
+		err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Delay: "5s"}, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeDeadlineExceeded {
+			t.Errorf("Expected deadline_exceeded, got %v", err)
+		}
+	})
+
+	t.Run("hedging", func(t *testing.T) {
+		var mu sync.Mutex
+		codes := make(map[int]rpc.Code)
+		client := newClient(t, `{
+			"methodConfig": [{
+				"name": [{"service": "attempt.v1.AttemptService", "method": "Call"}],
+				"hedgingPolicy": {"maxAttempts": 2, "hedgingDelay": "0.02s"}
+			}]
+		}`, hyperclient.OnAttempt(func(_ context.Context, stats hyperclient.AttemptStats) {
+			mu.Lock()
+			defer mu.Unlock()
+			codes[stats.Attempt] = stats.Code
+		}))
+
+		// The first attempt is slow, so the hedged one wins
+		var resp AttemptResponse
+		if err := client.Call(ctx, "attempt.v1.AttemptService/Call", &AttemptRequest{Delay: "5s"}, &resp); err != nil {
+			t.Fatalf("Call() failed: %v", err)
+		}
+		if resp.Attempt != "2" || resp.PreviousAttempts != 1 {
+			t.Errorf("Expected attempt 2, got %+v", resp)
+		}
+		waitFor(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return codes[1] == rpc.CodeCanceled && codes[2] == ""
+		})
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("Condition not met")
+}
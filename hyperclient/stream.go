@@ -0,0 +1,197 @@
+package hyperclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// Stream receives the messages of a server-streaming call. Stream
+// interceptors can wrap it.
+type Stream interface {
+	// Receive decodes the next message into msg, a pointer as the response
+	// of Client.Call. It returns io.EOF once the stream ended successfully,
+	// and the error of the call otherwise.
+	Receive(msg any) error
+	// Header returns the response headers.
+	Header() rpc.MD
+	// Trailer returns the response trailers, once Receive returned io.EOF
+	// or an error of the server.
+	Trailer() rpc.MD
+	// Close ends the stream, canceling the call if it is still running.
+	Close() error
+}
+
+// ServerStream is the Stream of the server-streaming calls of a client.
+type ServerStream struct {
+	resp     *http.Response
+	cancel   context.CancelFunc
+	protocol Protocol
+	reader   *frameReader
+	output   protoreflect.MessageDescriptor
+	header   rpc.MD
+	trailer  rpc.MD
+	// err ends the stream, io.EOF once it ended successfully
+	err error
+}
+
+// stream calls the server-streaming procedure with the request message
+// data, retrying until the stream is open as the retry policy of the method
+// config says. The timeout of the method config bounds the whole stream.
+func (c *Client) stream(ctx context.Context, procedure string, data []byte, output protoreflect.MessageDescriptor, co *callOptions) (*ServerStream, error) {
+	mc := c.config.FindMethodConfig(procedure)
+	ctx, cancel := withMethodTimeout(ctx, mc)
+	s, err := c.retryStream(ctx, procedure, mc, data, output, co)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	closeStream := s.cancel
+	s.cancel = func() {
+		closeStream()
+		cancel()
+	}
+	return s, nil
+}
+
+// retryStream makes the attempts of opening a server stream.
+func (c *Client) retryStream(ctx context.Context, procedure string, mc *rpc.MethodConfig, data []byte, output protoreflect.MessageDescriptor, co *callOptions) (*ServerStream, error) {
+	if mc == nil || mc.RetryPolicy == nil {
+		return c.attemptStream(ctx, procedure, 1, data, output, &callOptions{metadata: co.metadata})
+	}
+	attempts := min(mc.RetryPolicy.MaxAttempts, maxAttempts)
+	for n := 1; ; n++ {
+		aco := attemptOptions(co, n)
+		var pushback string
+		aco.pushback = &pushback
+		s, err := c.attemptStream(ctx, procedure, n, data, output, aco)
+		delay, ok := c.retryDelay(ctx, mc.RetryPolicy, n, attempts, attemptResult{err: err, pushback: pushback})
+		if !ok {
+			return s, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, transportError(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// attemptStream makes attempt n of opening a server stream with co.
+func (c *Client) attemptStream(ctx context.Context, procedure string, n int, data []byte, output protoreflect.MessageDescriptor, co *callOptions) (*ServerStream, error) {
+	var endpoint string
+	co.endpoint = &endpoint
+	start := time.Now()
+	s, err := c.openStream(ctx, procedure, data, output, co)
+	c.reportAttempt(ctx, AttemptStats{
+		Procedure: procedure,
+		Attempt:   n,
+		Endpoint:  endpoint,
+		Code:      errorCode(err),
+		Start:     start,
+		Latency:   time.Since(start),
+	})
+	return s, err
+}
+
+// openStream calls the server-streaming procedure with the request message
+// data.
+func (c *Client) openStream(ctx context.Context, procedure string, data []byte, output protoreflect.MessageDescriptor, co *callOptions) (*ServerStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := c.send(ctx, c.protocol, procedure, true, data, co)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := c.newServerStream(resp, cancel, output, co)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s, nil
+}
+
+// newServerStream returns the stream of the response resp, closed with the
+// error of the call if the server failed it before any message.
+func (c *Client) newServerStream(resp *http.Response, cancel context.CancelFunc, output protoreflect.MessageDescriptor, co *callOptions) *ServerStream {
+	s := &ServerStream{
+		resp:     resp,
+		cancel:   cancel,
+		protocol: c.protocol,
+		output:   output,
+		header:   headerMetadata(resp.Header),
+	}
+
+	encoding := resp.Header.Get("Grpc-Encoding")
+	switch {
+	case resp.StatusCode != http.StatusOK && c.protocol == ProtocolConnect:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		s.err = connectError(resp.StatusCode, body)
+	case resp.StatusCode != http.StatusOK:
+		s.err = rpc.NewErrorf(codeForHTTPStatus(resp.StatusCode), "HTTP %d", resp.StatusCode)
+	case c.protocol == ProtocolGRPC && resp.Header.Get("Grpc-Status") != "":
+		// A trailers-only response carries the status in the headers
+		s.trailer = s.header
+		s.err = grpcStatusError(resp.Header)
+		storePushback(co, resp.Header)
+	case c.protocol == ProtocolConnect:
+		encoding = resp.Header.Get("Connect-Content-Encoding")
+	}
+	if s.err != nil {
+		_ = s.Close()
+		return s
+	}
+	s.reader = &frameReader{r: resp.Body, encoding: encoding}
+	return s
+}
+
+// Receive implements Stream.
+func (s *ServerStream) Receive(msg any) error {
+	if s.err != nil {
+		return s.err
+	}
+	flags, data, err := s.reader.next()
+	switch {
+	case errors.Is(err, io.EOF) && s.protocol == ProtocolGRPC:
+		s.trailer = headerMetadata(s.resp.Trailer)
+		if s.err = grpcStatusError(s.resp.Trailer); s.err == nil {
+			s.err = io.EOF
+		}
+		return s.err
+	case errors.Is(err, io.EOF):
+		s.err = rpc.NewError(rpc.CodeInternal, "stream ended without an end-of-stream message")
+		return s.err
+	case err != nil:
+		s.err = err
+		return err
+	case flags&flagEndStream != 0 && s.protocol == ProtocolConnect:
+		if s.trailer, s.err = parseConnectEndStream(data); s.err == nil {
+			s.err = io.EOF
+		}
+		return s.err
+	}
+	return unmarshalResponse(data, s.output, msg)
+}
+
+// Header implements Stream.
+func (s *ServerStream) Header() rpc.MD {
+	return s.header
+}
+
+// Trailer implements Stream.
+func (s *ServerStream) Trailer() rpc.MD {
+	return s.trailer
+}
+
+// Close implements Stream.
+func (s *ServerStream) Close() error {
+	s.cancel()
+	return s.resp.Body.Close()
+}
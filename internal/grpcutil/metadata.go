@@ -0,0 +1,110 @@
+// Package grpcutil provides helpers for gRPC status and metadata encoding.
+package grpcutil
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// binarySuffix marks metadata keys with base64-encoded binary values.
+const binarySuffix = "-bin"
+
+// percentEncodedLength is the length of a percent-encoded byte ("%XX").
+const percentEncodedLength = 3
+
+// EncodeMessage percent-encodes a grpc-message value as required by the gRPC
+// over HTTP/2 spec: bytes outside printable ASCII and '%' are encoded, so
+// non-ASCII text and newlines survive HTTP/2 header validation.
+func EncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if isUnreserved(c) {
+			if b.Len() > 0 {
+				b.WriteByte(c)
+			}
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString(msg[:i])
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	if b.Len() == 0 {
+		return msg
+	}
+	return b.String()
+}
+
+// DecodeMessage decodes a percent-encoded grpc-message value. Invalid escapes
+// are kept as they are, as the spec asks receivers to do.
+func DecodeMessage(msg string) string {
+	if !strings.Contains(msg, "%") {
+		return msg
+	}
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if msg[i] == '%' && i+percentEncodedLength <= len(msg) {
+			if c, err := strconv.ParseUint(msg[i+1:i+percentEncodedLength], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += percentEncodedLength - 1
+				continue
+			}
+		}
+		b.WriteByte(msg[i])
+	}
+	return b.String()
+}
+
+// SanitizeValue makes a metadata value safe to send as an HTTP header. Values
+// of "-bin" keys are always base64-encoded as gRPC binary metadata. HTTP/2
+// servers silently drop header fields with invalid characters, so other values
+// with such characters are percent-encoded like grpc-message, and valid ones
+// are returned unchanged.
+func SanitizeValue(key, value string) string {
+	if IsBinaryKey(key) {
+		return EncodeBinary(value)
+	}
+	if validValue(value) {
+		return value
+	}
+	return EncodeMessage(value)
+}
+
+// IsBinaryKey reports whether key is a binary metadata key, ending in "-bin".
+func IsBinaryKey(key string) bool {
+	return len(key) >= len(binarySuffix) && strings.EqualFold(key[len(key)-len(binarySuffix):], binarySuffix)
+}
+
+// EncodeBinary base64-encodes a binary metadata value, without padding as gRPC
+// implementations send it.
+func EncodeBinary(value string) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(value))
+}
+
+// DecodeBinary decodes a base64-encoded binary metadata value, padded or not
+// as senders differ.
+func DecodeBinary(value string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid binary metadata value: %w", err)
+	}
+	return string(data), nil
+}
+
+// validValue reports whether value only has printable ASCII characters.
+func validValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUnreserved reports whether c is sent unencoded in a grpc-message value.
+func isUnreserved(c byte) bool {
+	return c >= ' ' && c <= '~' && c != '%'
+}
@@ -0,0 +1,94 @@
+package grpcutil
+
+import "net/http"
+
+const (
+	// statusUnknown is the gRPC status of unknown codes.
+	statusUnknown = 2
+	// statusClientClosedRequest is the HTTP status of canceled calls.
+	statusClientClosedRequest = 499
+)
+
+// codeStatus holds the statuses of an error code on each protocol.
+type codeStatus struct {
+	// code is the Connect name of the code, such as "not_found"
+	code string
+	// http is the HTTP status of Connect unary and plain HTTP errors
+	http int
+}
+
+// codeStatuses lists the error codes by gRPC status, as in the gRPC and
+// Connect specs.
+var codeStatuses = []codeStatus{
+	{"", http.StatusOK},
+	{"canceled", statusClientClosedRequest},
+	{"unknown", http.StatusInternalServerError},
+	{"invalid_argument", http.StatusBadRequest},
+	{"deadline_exceeded", http.StatusGatewayTimeout},
+	{"not_found", http.StatusNotFound},
+	{"already_exists", http.StatusConflict},
+	{"permission_denied", http.StatusForbidden},
+	{"resource_exhausted", http.StatusTooManyRequests},
+	{"failed_precondition", http.StatusBadRequest},
+	{"aborted", http.StatusConflict},
+	{"out_of_range", http.StatusBadRequest},
+	{"unimplemented", http.StatusNotImplemented},
+	{"internal", http.StatusInternalServerError},
+	{"unavailable", http.StatusServiceUnavailable},
+	{"data_loss", http.StatusInternalServerError},
+	{"unauthenticated", http.StatusUnauthorized},
+}
+
+// GRPCStatus returns the gRPC status of an error code such as "not_found";
+// UNKNOWN for unknown codes.
+func GRPCStatus(code string) int {
+	for status, s := range codeStatuses {
+		if s.code == code && code != "" {
+			return status
+		}
+	}
+	return statusUnknown
+}
+
+// CodeForGRPCStatus returns the error code of a gRPC status, "" for OK and
+// "unknown" for unknown statuses.
+func CodeForGRPCStatus(status int) string {
+	if status < 0 || status >= len(codeStatuses) {
+		return codeStatuses[statusUnknown].code
+	}
+	return codeStatuses[status].code
+}
+
+// HTTPStatus returns the HTTP status of errors with an error code, sent by
+// Connect unary and plain HTTP responses; 500 for unknown codes.
+func HTTPStatus(code string) int {
+	if code != "" {
+		for _, s := range codeStatuses {
+			if s.code == code {
+				return s.http
+			}
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForHTTPStatus returns the error code of a failed HTTP response carrying
+// no status of its own, as gRPC and Connect clients do. This is not the
+// inverse of HTTPStatus: a 400 from a proxy is an internal error, not an
+// invalid argument of the caller.
+func CodeForHTTPStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "internal"
+	case http.StatusUnauthorized:
+		return "unauthenticated"
+	case http.StatusForbidden:
+		return "permission_denied"
+	case http.StatusNotFound:
+		return "unimplemented"
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "unavailable"
+	default:
+		return "unknown"
+	}
+}
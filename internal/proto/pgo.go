@@ -4,6 +4,7 @@ package proto
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"buf.build/go/hyperpb"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -14,6 +15,8 @@ type PGOManager struct {
 	mu       sync.RWMutex
 	profiles map[string]*hyperpb.Profile     // MessageType full name -> Profile
 	msgTypes map[string]*hyperpb.MessageType // MessageType full name -> MessageType
+	// generation is incremented by every recompilation
+	generation atomic.Uint64
 }
 
 // NewPGOManager creates a new PGO manager.
@@ -62,12 +65,14 @@ func (m *PGOManager) GetProfile(fullName string) *hyperpb.Profile {
 }
 
 // RecompileWithProfile recompiles the message type with its collected profile.
+// A profile cannot be used with the recompiled type, so recording starts over
+// with a fresh one.
 func (m *PGOManager) RecompileWithProfile(fullName string) (*hyperpb.MessageType, error) {
-	m.mu.RLock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	profile, hasProfile := m.profiles[fullName]
 	msgType, hasMsgType := m.msgTypes[fullName]
-	m.mu.RUnlock()
-
 	if !hasProfile || !hasMsgType {
 		return nil, fmt.Errorf("no profile found for message type %s", fullName)
 	}
@@ -75,14 +80,41 @@ func (m *PGOManager) RecompileWithProfile(fullName string) (*hyperpb.MessageType
 	// Recompile with profile
 	optimized := msgType.Recompile(profile)
 
-	// Update stored message type
-	m.mu.Lock()
+	// Update stored message type and profile
 	m.msgTypes[fullName] = optimized
-	m.mu.Unlock()
+	m.profiles[fullName] = optimized.NewProfile()
+	m.generation.Add(1)
 
 	return optimized, nil
 }
 
+// Generation returns a counter incremented by every recompilation, so
+// decoders can cheaply detect that their message type is outdated.
+func (m *PGOManager) Generation() uint64 {
+	return m.generation.Load()
+}
+
+// Current returns the latest message type and profile of a message, or nils
+// if it was not compiled with PGO.
+func (m *PGOManager) Current(fullName string) (*hyperpb.MessageType, *hyperpb.Profile) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.msgTypes[fullName], m.profiles[fullName]
+}
+
+// Messages returns the full names of the message types compiled with PGO.
+func (m *PGOManager) Messages() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.msgTypes))
+	for name := range m.msgTypes {
+		names = append(names, name)
+	}
+	return names
+}
+
 // RecompileAll recompiles all message types with their collected profiles.
 func (m *PGOManager) RecompileAll() error {
 	m.mu.RLock()
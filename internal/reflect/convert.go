@@ -2,6 +2,7 @@
 package reflect
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -10,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 	"google.golang.org/protobuf/types/known/anypb"
@@ -17,6 +19,8 @@ import (
 	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/i2y/hyperway/schema"
 )
 
 // fieldNameCache caches snake_case to camelCase conversions
@@ -25,20 +29,54 @@ var fieldNameCache = sync.Map{}
 // fieldMappingCache caches field mappings for struct types to avoid repeated reflection
 var fieldMappingCache = sync.Map{} // map[reflect.Type]map[string]fieldMapping
 
+// messageFieldsCache caches the message fields of struct types
+var messageFieldsCache = sync.Map{} // map[reflect.Type][]schema.MessageField
+
 type fieldMapping struct {
-	fieldIndex int
+	fieldIndex []int
 	jsonName   string
 	protoName  string
 }
 
 // ProtoToStruct converts a protobuf message to a Go struct using reflection.
+// Strings and bytes are copied, so the struct doesn't reference memory of msg,
+// which may be released to an arena afterwards.
 func ProtoToStruct(msg protoreflect.Message, target any) error {
 	targetValue := reflect.ValueOf(target)
 	if targetValue.Kind() != reflect.Ptr || targetValue.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("target must be a pointer to struct")
 	}
 
-	return protoToStructDirect(msg, targetValue.Elem())
+	return protoToStructDirect(msg, targetValue.Elem(), false)
+}
+
+// ProtoToStructAliased converts a protobuf message to a Go struct like
+// ProtoToStruct, except that strings and bytes of the struct reference the
+// memory of msg instead of copies, so msg must not be released while the
+// struct is used. Well-known types are still copied.
+func ProtoToStructAliased(msg protoreflect.Message, target any) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("target must be a pointer to struct")
+	}
+
+	return protoToStructDirect(msg, targetValue.Elem(), true)
+}
+
+// stringValue returns the string of v, copied unless alias is set.
+func stringValue(v protoreflect.Value, alias bool) string {
+	if alias {
+		return v.String()
+	}
+	return strings.Clone(v.String())
+}
+
+// bytesValue returns the bytes of v, copied unless alias is set.
+func bytesValue(v protoreflect.Value, alias bool) []byte {
+	if alias {
+		return v.Bytes()
+	}
+	return bytes.Clone(v.Bytes())
 }
 
 // StructToProto converts a Go struct to a protobuf message using reflection.
@@ -55,17 +93,21 @@ func StructToProto(src any, msg protoreflect.Message) error {
 }
 
 // protoToStructDirect directly converts proto to struct using reflection
-func protoToStructDirect(msg protoreflect.Message, target reflect.Value) error {
+func protoToStructDirect(msg protoreflect.Message, target reflect.Value, alias bool) error {
 	// Iterate over all fields in the proto message
 	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
 		// Find the corresponding struct field
 		structField, found := findStructField(target, string(fd.Name()))
 		if !found {
+			// Members of a oneof of a union set the field holding it
+			if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+				_ = setUnionFieldValue(target, oneof, v, fd, alias)
+			}
 			return true // Skip unknown fields
 		}
 
 		// Set the field value
-		if err := setFieldValue(structField, v, fd); err != nil {
+		if err := setFieldValue(structField, v, fd, alias); err != nil {
 			// Log error but continue processing other fields
 			return true
 		}
@@ -79,14 +121,11 @@ func protoToStructDirect(msg protoreflect.Message, target reflect.Value) error {
 func structToProtoDirect(src reflect.Value, msg protoreflect.Message) error {
 	msgDesc := msg.Descriptor()
 
-	// Iterate over struct fields
-	for i := 0; i < src.NumField(); i++ {
-		field := src.Field(i)
-		fieldType := src.Type().Field(i)
-
-		// Skip unexported fields
-		if !fieldType.IsExported() {
-			continue
+	// Iterate over struct fields, including those of flattened embedded structs
+	for _, fieldType := range getMessageFields(src.Type()) {
+		field, err := src.FieldByIndexErr(fieldType.Index)
+		if err != nil {
+			continue // Promoted from a nil embedded struct
 		}
 
 		// Get field name from json tag or use field name
@@ -98,12 +137,26 @@ func structToProtoDirect(src reflect.Value, msg protoreflect.Message) error {
 			}
 		}
 
-		// Convert to snake_case for proto field lookup
-		protoFieldName := camelToSnake(fieldName)
+		// Fields holding a union set the field of their member in the oneof
+		if union, ok := schema.LookupUnion(fieldType.Type); ok {
+			if err := setProtoUnion(msg, fieldType.Prefix, union, field); err != nil {
+				return fmt.Errorf("failed to set field %s: %w", fieldName, err)
+			}
+			continue
+		}
+
+		// Convert to snake_case for proto field lookup, preferring the name
+		// of a protobuf tag
+		protoFieldName := fieldType.Prefix + camelToSnake(fieldName)
 		fd := msgDesc.Fields().ByName(protoreflect.Name(protoFieldName))
+		if tagName := schema.ProtobufTagName(&fieldType.StructField); tagName != "" {
+			if tagged := msgDesc.Fields().ByName(protoreflect.Name(fieldType.Prefix + tagName)); tagged != nil {
+				fd = tagged
+			}
+		}
 		if fd == nil {
 			// Try exact match
-			fd = msgDesc.Fields().ByName(protoreflect.Name(fieldName))
+			fd = msgDesc.Fields().ByName(protoreflect.Name(fieldType.Prefix + fieldName))
 			if fd == nil {
 				continue // Skip unknown fields
 			}
@@ -121,27 +174,104 @@ func structToProtoDirect(src reflect.Value, msg protoreflect.Message) error {
 	return nil
 }
 
+// setProtoUnion sets the field of the member held by value, an interface
+// holding a union, whose fields are named with prefix prepended. A nil
+// interface leaves the oneof unset, and a nil pointer sets an empty message.
+func setProtoUnion(msg protoreflect.Message, prefix string, union *schema.Union, value reflect.Value) error {
+	if value.IsNil() {
+		return nil
+	}
+	concrete := value.Elem()
+	member, ok := union.MemberOf(concrete.Type())
+	if !ok {
+		return fmt.Errorf("%v is not a registered member of union %v", concrete.Type(), union.Interface)
+	}
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(prefix + member.Name))
+	if fd == nil {
+		return nil // Skip unknown fields
+	}
+	if concrete.Kind() == reflect.Ptr && concrete.IsNil() {
+		msg.Set(fd, msg.NewField(fd))
+		return nil
+	}
+	return setProtoValue(msg, fd, concrete)
+}
+
+// setUnionFieldValue sets the struct field holding the union described by
+// oneof to a new value of the member of fd, the field set in the message.
+func setUnionFieldValue(target reflect.Value, oneof protoreflect.OneofDescriptor, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	field, found := findStructField(target, string(oneof.Name()))
+	if !found || fd.Message() == nil {
+		return nil
+	}
+	union, ok := schema.LookupUnion(field.Type())
+	if !ok {
+		return nil
+	}
+	member, ok := union.MemberByMessage(string(fd.Message().Name()))
+	if !ok {
+		return fmt.Errorf("message %s is not a member of union %v", fd.Message().Name(), union.Interface)
+	}
+
+	value := reflect.New(member.StructType())
+	if err := protoToStructDirect(protoValue.Message(), value.Elem(), alias); err != nil {
+		return err
+	}
+	if member.Type.Kind() != reflect.Ptr {
+		value = value.Elem()
+	}
+	field.Set(value)
+	return nil
+}
+
 // setFieldValue sets a struct field value from a proto value
-func setFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor) error {
+func setFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	// Handle map fields, which are repeated map entries
+	if fd.IsMap() {
+		return setMapFieldValue(field, protoValue, fd, alias)
+	}
+
 	// Handle repeated fields
 	if fd.Cardinality() == protoreflect.Repeated {
-		return setRepeatedFieldValue(field, protoValue, fd)
+		return setRepeatedFieldValue(field, protoValue, fd, alias)
 	}
 
 	// Handle non-repeated fields
-	return setSingleFieldValue(field, protoValue, fd)
+	return setSingleFieldValue(field, protoValue, fd, alias)
 }
 
 // setRepeatedFieldValue handles repeated field values
-func setRepeatedFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor) error {
+func setRepeatedFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	// Get the list
+	list := protoValue.List()
+
+	// Pointers to slices and arrays are allocated
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setRepeatedFieldValue(elem.Elem(), protoValue, fd, alias); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	// Arrays take the leading elements, up to their length
+	if field.Kind() == reflect.Array {
+		elemType := field.Type().Elem()
+		field.SetZero()
+		for i := 0; i < min(list.Len(), field.Len()); i++ {
+			if err := setListElementValue(field.Index(i), list.Get(i), fd, elemType, i, alias); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// Check if the field is a slice
 	if field.Kind() != reflect.Slice {
 		return fmt.Errorf("repeated field %s requires slice type in struct, got %v", fd.Name(), field.Kind())
 	}
 
-	// Get the list
-	list := protoValue.List()
-
 	// Create a new slice with the appropriate length
 	sliceType := field.Type()
 	elemType := sliceType.Elem()
@@ -152,7 +282,7 @@ func setRepeatedFieldValue(field reflect.Value, protoValue protoreflect.Value, f
 		elem := newSlice.Index(i)
 		listValue := list.Get(i)
 
-		if err := setListElementValue(elem, listValue, fd, elemType, i); err != nil {
+		if err := setListElementValue(elem, listValue, fd, elemType, i, alias); err != nil {
 			return err
 		}
 	}
@@ -161,8 +291,46 @@ func setRepeatedFieldValue(field reflect.Value, protoValue protoreflect.Value, f
 	return nil
 }
 
+// setMapFieldValue handles map field values
+func setMapFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	// Pointers to maps are allocated
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setMapFieldValue(elem.Elem(), protoValue, fd, alias); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	if field.Kind() != reflect.Map {
+		return fmt.Errorf("map field %s requires map type in struct, got %v", fd.Name(), field.Kind())
+	}
+
+	protoMap := protoValue.Map()
+	newMap := reflect.MakeMapWithSize(field.Type(), protoMap.Len())
+	var err error
+	protoMap.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		key := reflect.New(field.Type().Key()).Elem()
+		if err = setSingleFieldValue(key, k.Value(), fd.MapKey(), alias); err != nil {
+			return false
+		}
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err = setSingleFieldValue(elem, v, fd.MapValue(), alias); err != nil {
+			return false
+		}
+		newMap.SetMapIndex(key, elem)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("map field %s: %w", fd.Name(), err)
+	}
+
+	field.Set(newMap)
+	return nil
+}
+
 // setListElementValue sets a single element value in a list
-func setListElementValue(elem reflect.Value, listValue protoreflect.Value, fd protoreflect.FieldDescriptor, elemType reflect.Type, index int) error {
+func setListElementValue(elem reflect.Value, listValue protoreflect.Value, fd protoreflect.FieldDescriptor, elemType reflect.Type, index int, alias bool) error {
 	switch fd.Kind() { //nolint:exhaustive
 	case protoreflect.BoolKind:
 		elem.SetBool(listValue.Bool())
@@ -179,11 +347,17 @@ func setListElementValue(elem reflect.Value, listValue protoreflect.Value, fd pr
 	case protoreflect.DoubleKind:
 		elem.SetFloat(listValue.Float())
 	case protoreflect.StringKind:
-		elem.SetString(listValue.String())
+		elem.SetString(stringValue(listValue, alias))
 	case protoreflect.BytesKind:
-		elem.SetBytes(listValue.Bytes())
+		elem.SetBytes(bytesValue(listValue, alias))
 	case protoreflect.MessageKind:
-		return setMessageListElement(elem, listValue, elemType, index)
+		if isTimeValue(elem) {
+			return setTimeField(elem, listValue.Message(), timeOrDurationType(elemType))
+		}
+		if _, ok := schema.DynamicJSONType(elemType); ok {
+			return setDynamicJSONField(elem, listValue.Message())
+		}
+		return setMessageListElement(elem, listValue, elemType, index, alias)
 	default:
 		return fmt.Errorf("unsupported repeated field kind: %v", fd.Kind())
 	}
@@ -191,16 +365,16 @@ func setListElementValue(elem reflect.Value, listValue protoreflect.Value, fd pr
 }
 
 // setMessageListElement handles message type elements in a list
-func setMessageListElement(elem reflect.Value, listValue protoreflect.Value, elemType reflect.Type, index int) error {
+func setMessageListElement(elem reflect.Value, listValue protoreflect.Value, elemType reflect.Type, index int, alias bool) error {
 	if elemType.Kind() == reflect.Ptr {
 		// Create new pointer element
 		newElem := reflect.New(elemType.Elem())
-		if err := protoToStructDirect(listValue.Message(), newElem.Elem()); err != nil {
+		if err := protoToStructDirect(listValue.Message(), newElem.Elem(), alias); err != nil {
 			return fmt.Errorf("failed to convert repeated message element %d: %w", index, err)
 		}
 		elem.Set(newElem)
 	} else if elemType.Kind() == reflect.Struct {
-		if err := protoToStructDirect(listValue.Message(), elem); err != nil {
+		if err := protoToStructDirect(listValue.Message(), elem, alias); err != nil {
 			return fmt.Errorf("failed to convert repeated message element %d: %w", index, err)
 		}
 	}
@@ -208,8 +382,18 @@ func setMessageListElement(elem reflect.Value, listValue protoreflect.Value, ele
 }
 
 // setSingleFieldValue handles non-repeated field values
-func setSingleFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor) error {
-	switch fd.Kind() { //nolint:exhaustive // EnumKind and GroupKind are not needed
+func setSingleFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	// Allocate pointers to scalars, e.g. of optional fields
+	if field.Kind() == reflect.Ptr && fd.Kind() != protoreflect.MessageKind {
+		elem := reflect.New(field.Type().Elem())
+		if err := setSingleFieldValue(elem.Elem(), protoValue, fd, alias); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	switch fd.Kind() { //nolint:exhaustive // GroupKind is not needed
 	case protoreflect.BoolKind:
 		field.SetBool(protoValue.Bool())
 	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
@@ -225,19 +409,37 @@ func setSingleFieldValue(field reflect.Value, protoValue protoreflect.Value, fd
 	case protoreflect.DoubleKind:
 		field.SetFloat(protoValue.Float())
 	case protoreflect.StringKind:
-		field.SetString(protoValue.String())
+		field.SetString(stringValue(protoValue, alias))
 	case protoreflect.BytesKind:
-		field.SetBytes(protoValue.Bytes())
+		field.SetBytes(bytesValue(protoValue, alias))
+	case protoreflect.EnumKind:
+		field.SetInt(int64(protoValue.Enum()))
 	case protoreflect.MessageKind:
-		return setMessageFieldValue(field, protoValue, fd)
+		return setMessageFieldValue(field, protoValue, fd, alias)
 	default:
 		return fmt.Errorf("unsupported field kind: %v", fd.Kind())
 	}
 	return nil
 }
 
+// lazyProtoField is implemented by fields decoding a submessage themselves (rpc.Lazy).
+type lazyProtoField interface {
+	UnmarshalLazyProto(msg protoreflect.Message) error
+}
+
+// lazyValueField is implemented by fields whose value is produced on access (rpc.Lazy).
+type lazyValueField interface {
+	LazyValue() (any, error)
+}
+
 // setMessageFieldValue handles message type field values
-func setMessageFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor) error {
+func setMessageFieldValue(field reflect.Value, protoValue protoreflect.Value, fd protoreflect.FieldDescriptor, alias bool) error {
+	if field.CanAddr() {
+		if lazy, ok := field.Addr().Interface().(lazyProtoField); ok {
+			return lazy.UnmarshalLazyProto(protoValue.Message())
+		}
+	}
+
 	// Handle well-known types
 	if err := handleWellKnownProtoToStruct(field, protoValue.Message(), fd); err == nil {
 		return nil
@@ -248,9 +450,9 @@ func setMessageFieldValue(field reflect.Value, protoValue protoreflect.Value, fd
 		if field.IsNil() {
 			field.Set(reflect.New(field.Type().Elem()))
 		}
-		return protoToStructDirect(protoValue.Message(), field.Elem())
+		return protoToStructDirect(protoValue.Message(), field.Elem(), alias)
 	} else if field.Kind() == reflect.Struct {
-		return protoToStructDirect(protoValue.Message(), field)
+		return protoToStructDirect(protoValue.Message(), field, alias)
 	}
 	return nil
 }
@@ -285,26 +487,23 @@ func getFieldMappings(structType reflect.Type) map[string]fieldMapping {
 
 	mappings := make(map[string]fieldMapping)
 
-	for i := 0; i < structType.NumField(); i++ {
-		field := structType.Field(i)
-		if !field.IsExported() {
-			continue
-		}
+	for _, field := range getMessageFields(structType) {
+		mapping := fieldMapping{fieldIndex: field.Index}
 
-		mapping := fieldMapping{fieldIndex: i}
-
-		// Get field name from json tag or use field name
-		fieldName := field.Name
+		// Get field name from json tag or use field name, prefixed like the
+		// fields of the embedded struct they are promoted from
+		name := field.Name
 		if jsonTag := field.Tag.Get("json"); jsonTag != "" {
 			parts := strings.Split(jsonTag, ",")
 			if parts[0] != "" && parts[0] != "-" {
-				fieldName = parts[0]
-				mapping.jsonName = parts[0]
+				name = parts[0]
+				mapping.jsonName = field.Prefix + parts[0]
 			}
 		}
+		fieldName := field.Prefix + name
 
 		// Store proto field name (snake_case)
-		protoFieldName := camelToSnake(fieldName)
+		protoFieldName := field.Prefix + camelToSnake(name)
 		mapping.protoName = protoFieldName
 
 		// Map by multiple keys for fast lookup
@@ -319,21 +518,46 @@ func getFieldMappings(structType reflect.Type) map[string]fieldMapping {
 		if camelName != fieldName {
 			mappings[camelName] = mapping
 		}
+
+		// And the name of a protobuf tag, which takes precedence
+		if tagName := schema.ProtobufTagName(&field.StructField); tagName != "" {
+			mappings[field.Prefix+tagName] = mapping
+		}
 	}
 
 	fieldMappingCache.Store(structType, mappings)
 	return mappings
 }
 
-// findStructField finds a struct field by proto field name using cached mappings
+// getMessageFields returns the cached message fields of a struct type
+func getMessageFields(structType reflect.Type) []schema.MessageField {
+	if cached, ok := messageFieldsCache.Load(structType); ok {
+		return cached.([]schema.MessageField)
+	}
+	fields := schema.MessageFields(structType)
+	messageFieldsCache.Store(structType, fields)
+	return fields
+}
+
+// findStructField finds a struct field by proto field name using cached
+// mappings. Nil embedded structs the field is promoted from are allocated.
 func findStructField(target reflect.Value, protoFieldName string) (reflect.Value, bool) {
 	mappings := getFieldMappings(target.Type())
 
-	if mapping, ok := mappings[protoFieldName]; ok {
-		return target.Field(mapping.fieldIndex), true
+	mapping, ok := mappings[protoFieldName]
+	if !ok {
+		return reflect.Value{}, false
 	}
-
-	return reflect.Value{}, false
+	for i, index := range mapping.fieldIndex {
+		if i > 0 && target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				target.Set(reflect.New(target.Type().Elem()))
+			}
+			target = target.Elem()
+		}
+		target = target.Field(index)
+	}
+	return target, true
 }
 
 // StructToJSON converts a Go struct to JSON bytes.
@@ -379,6 +603,10 @@ func setProtoValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, va
 	if value.Kind() == reflect.Ptr && value.IsNil() {
 		return nil
 	}
+	// Handle map fields, which are repeated map entries
+	if fd.IsMap() {
+		return setProtoMap(msg, fd, value)
+	}
 	// Handle repeated fields
 	if fd.Cardinality() == protoreflect.Repeated {
 		// Dereference pointer if needed
@@ -469,7 +697,18 @@ func setProtoValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, va
 			case protoreflect.MessageKind:
 				// For repeated messages, create a new message for each element
 				nestedMsg := list.NewElement().Message()
-				if elem.Kind() == reflect.Ptr {
+				if isTimeValue(elem) {
+					if elem.Kind() == reflect.Ptr && elem.IsNil() {
+						continue // Skip nil pointers
+					}
+					if err := setTimeMessage(nestedMsg, elem); err != nil {
+						return fmt.Errorf("failed to convert repeated element %d: %w", i, err)
+					}
+				} else if _, ok := schema.DynamicJSONType(elem.Type()); ok {
+					if err := setDynamicJSONMessage(nestedMsg, elem); err != nil {
+						return fmt.Errorf("failed to convert repeated element %d: %w", i, err)
+					}
+				} else if elem.Kind() == reflect.Ptr {
 					if !elem.IsNil() {
 						if err := structToProtoDirect(elem.Elem(), nestedMsg); err != nil {
 							return fmt.Errorf("failed to convert repeated message element %d: %w", i, err)
@@ -601,6 +840,15 @@ func setProtoValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, va
 			return fmt.Errorf("expected []byte or string for field %s, got %v", fd.Name(), value.Kind())
 		}
 	case protoreflect.MessageKind:
+		// Lazy fields are encoded from their value, if set
+		if lazy, ok := value.Interface().(lazyValueField); ok {
+			nested, err := lazy.LazyValue()
+			if err != nil || nested == nil {
+				return err
+			}
+			return setProtoValue(msg, fd, reflect.ValueOf(nested))
+		}
+
 		// For nested messages, recursively convert
 		// Don't dereference here, handle it in the condition
 		nestedMsg := msg.Mutable(fd).Message()
@@ -617,6 +865,120 @@ func setProtoValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, va
 	return nil
 }
 
+// setProtoMap sets a proto map field from a Go map
+func setProtoMap(msg protoreflect.Message, fd protoreflect.FieldDescriptor, value reflect.Value) error {
+	// Dereference pointers to maps; nil ones leave the field empty
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Kind() != reflect.Map {
+		return fmt.Errorf("map field %s requires map, got %v", fd.Name(), value.Kind())
+	}
+
+	protoMap := msg.Mutable(fd).Map()
+	iter := value.MapRange()
+	for iter.Next() {
+		key, err := scalarProtoValue(fd.MapKey(), iter.Key())
+		if err != nil {
+			return fmt.Errorf("map field %s: %w", fd.Name(), err)
+		}
+
+		var elem protoreflect.Value
+		if fd.MapValue().Kind() == protoreflect.MessageKind && isTimeValue(iter.Value()) {
+			if iter.Value().Kind() == reflect.Ptr && iter.Value().IsNil() {
+				continue // Skip nil pointers
+			}
+			elem = protoMap.NewValue()
+			if err := setTimeMessage(elem.Message(), iter.Value()); err != nil {
+				return fmt.Errorf("map field %s: %w", fd.Name(), err)
+			}
+		} else if _, ok := schema.DynamicJSONType(iter.Value().Type()); ok && fd.MapValue().Kind() == protoreflect.MessageKind {
+			elem = protoMap.NewValue()
+			if err := setDynamicJSONMessage(elem.Message(), iter.Value()); err != nil {
+				return fmt.Errorf("map field %s: %w", fd.Name(), err)
+			}
+		} else if fd.MapValue().Kind() == protoreflect.MessageKind {
+			nested := reflect.Indirect(iter.Value())
+			if !nested.IsValid() || nested.Kind() != reflect.Struct {
+				continue // Skip nil pointers
+			}
+			elem = protoMap.NewValue()
+			if err := structToProtoDirect(nested, elem.Message()); err != nil {
+				return fmt.Errorf("map field %s: %w", fd.Name(), err)
+			}
+		} else if elem, err = scalarProtoValue(fd.MapValue(), iter.Value()); err != nil {
+			return fmt.Errorf("map field %s: %w", fd.Name(), err)
+		}
+		protoMap.Set(key.MapKey(), elem)
+	}
+	return nil
+}
+
+// scalarProtoValue converts a Go value to the value of a scalar field
+func scalarProtoValue(fd protoreflect.FieldDescriptor, value reflect.Value) (protoreflect.Value, error) {
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return protoreflect.Value{}, fmt.Errorf("nil value for field %s", fd.Name())
+	}
+
+	switch fd.Kind() { //nolint:exhaustive // message kinds are handled by the callers
+	case protoreflect.BoolKind:
+		if value.Kind() == reflect.Bool {
+			return protoreflect.ValueOfBool(value.Bool()), nil
+		}
+	case protoreflect.StringKind:
+		if value.Kind() == reflect.String {
+			return protoreflect.ValueOfString(value.String()), nil
+		}
+	case protoreflect.BytesKind:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return protoreflect.ValueOfBytes(value.Bytes()), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if isNumericKind(value.Kind()) {
+			n := toInt64(value)
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return protoreflect.Value{}, fmt.Errorf("int32 overflow: %d", n)
+			}
+			return protoreflect.ValueOfInt32(int32(n)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if isNumericKind(value.Kind()) {
+			return protoreflect.ValueOfInt64(toInt64(value)), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if isNumericKind(value.Kind()) {
+			n := toUint64(value)
+			if n > math.MaxUint32 {
+				return protoreflect.Value{}, fmt.Errorf("uint32 overflow: %d", n)
+			}
+			return protoreflect.ValueOfUint32(uint32(n)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if isNumericKind(value.Kind()) {
+			return protoreflect.ValueOfUint64(toUint64(value)), nil
+		}
+	case protoreflect.FloatKind:
+		if isNumericKind(value.Kind()) {
+			return protoreflect.ValueOfFloat32(float32(toFloat64(value))), nil
+		}
+	case protoreflect.DoubleKind:
+		if isNumericKind(value.Kind()) {
+			return protoreflect.ValueOfFloat64(toFloat64(value)), nil
+		}
+	case protoreflect.EnumKind:
+		if isNumericKind(value.Kind()) {
+			n := toInt64(value)
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return protoreflect.Value{}, fmt.Errorf("enum overflow: %d", n)
+			}
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported %v value for field %s", value.Kind(), fd.Name())
+}
+
 // camelToSnake converts CamelCase to snake_case with caching
 func camelToSnake(s string) string {
 	// Check cache first
@@ -792,32 +1154,123 @@ func handleWellKnownProtoToStruct(field reflect.Value, msg protoreflect.Message,
 	case "google.protobuf.Any":
 		return handleAnyProtoToStruct(field, msg)
 	}
+	if isWrapperType(typeName) {
+		return handleWrapperProtoToStruct(field, msg)
+	}
 
 	return fmt.Errorf("not a well-known type or unsupported conversion")
 }
 
-// handleTimestampProtoToStruct converts Timestamp message to time.Time
+// handleTimestampProtoToStruct converts Timestamp message to time.Time or *time.Time
 func handleTimestampProtoToStruct(field reflect.Value, msg protoreflect.Message) error {
-	if field.Type() == reflect.TypeOf(time.Time{}) {
-		seconds := msg.Get(msg.Descriptor().Fields().ByName("seconds")).Int()
-		nanos := msg.Get(msg.Descriptor().Fields().ByName("nanos")).Int()
-		t := time.Unix(seconds, nanos).UTC()
-		field.Set(reflect.ValueOf(t))
-		return nil
-	}
-	return fmt.Errorf("field type mismatch for Timestamp")
+	return setTimeField(field, msg, timeType)
 }
 
-// handleDurationProtoToStruct converts Duration message to time.Duration
+// handleDurationProtoToStruct converts Duration message to time.Duration or *time.Duration
 func handleDurationProtoToStruct(field reflect.Value, msg protoreflect.Message) error {
-	if field.Type() == reflect.TypeOf(time.Duration(0)) {
-		seconds := msg.Get(msg.Descriptor().Fields().ByName("seconds")).Int()
-		nanos := msg.Get(msg.Descriptor().Fields().ByName("nanos")).Int()
-		d := time.Duration(seconds)*time.Second + time.Duration(nanos)*time.Nanosecond
-		field.Set(reflect.ValueOf(d))
-		return nil
+	return setTimeField(field, msg, durationType)
+}
+
+// Go types of the Timestamp and Duration well-known types
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// setTimeField sets a field of type t or *t, either time.Time or
+// time.Duration, from a Timestamp or Duration message.
+func setTimeField(field reflect.Value, msg protoreflect.Message, t reflect.Type) error {
+	seconds := msg.Get(msg.Descriptor().Fields().ByName("seconds")).Int()
+	nanos := msg.Get(msg.Descriptor().Fields().ByName("nanos")).Int()
+	var value reflect.Value
+	if t == timeType {
+		value = reflect.ValueOf(time.Unix(seconds, nanos).UTC())
+	} else {
+		value = reflect.ValueOf(time.Duration(seconds)*time.Second + time.Duration(nanos)*time.Nanosecond)
+	}
+
+	switch field.Type() {
+	case t:
+		field.Set(value)
+	case reflect.PointerTo(t):
+		ptr := reflect.New(t)
+		ptr.Elem().Set(value)
+		field.Set(ptr)
+	default:
+		return fmt.Errorf("field type mismatch for %s", msg.Descriptor().Name())
 	}
-	return fmt.Errorf("field type mismatch for Duration")
+	return nil
+}
+
+// isTimeValue reports whether value is a time.Time or time.Duration, or a
+// pointer to one.
+func isTimeValue(value reflect.Value) bool {
+	t := value.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == timeType || t == durationType
+}
+
+// timeOrDurationType returns time.Time or time.Duration for t or a pointer to it.
+func timeOrDurationType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// setTimeMessage sets a Timestamp or Duration message from a time.Time or
+// time.Duration value, or a non-nil pointer to one.
+func setTimeMessage(msg protoreflect.Message, value reflect.Value) error {
+	value = reflect.Indirect(value)
+	var seconds, nanos int64
+	switch value.Type() {
+	case timeType:
+		t := value.Interface().(time.Time)
+		seconds, nanos = t.Unix(), int64(t.Nanosecond())
+	case durationType:
+		// Seconds and nanos have the same sign, as the Duration spec requires
+		d := value.Interface().(time.Duration)
+		seconds, nanos = int64(d/time.Second), int64(d%time.Second)
+	default:
+		return fmt.Errorf("expected time.Time or time.Duration, got %v", value.Type())
+	}
+	msg.Set(msg.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(seconds))
+	msg.Set(msg.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(nanos))) // #nosec G115 -- |nanos| < 1e9
+	return nil
+}
+
+// isWrapperType reports whether typeName is a wrapper type such as
+// google.protobuf.Int32Value.
+func isWrapperType(typeName string) bool {
+	switch typeName {
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
+
+// handleWrapperProtoToStruct converts a wrapper message to a scalar or a
+// pointer to one
+func handleWrapperProtoToStruct(field reflect.Value, msg protoreflect.Message) error {
+	fd := msg.Descriptor().Fields().ByName("value")
+	return setSingleFieldValue(field, msg.Get(fd), fd, false)
+}
+
+// setWrapperMessage sets the value of a wrapper message from a scalar, or a
+// non-nil pointer to one
+func setWrapperMessage(msg protoreflect.Message, value reflect.Value) error {
+	fd := msg.Descriptor().Fields().ByName("value")
+	v, err := scalarProtoValue(fd, reflect.Indirect(value))
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
 }
 
 // handleStructProtoToStruct converts Struct message to *structpb.Struct
@@ -832,7 +1285,7 @@ func handleStructProtoToStruct(field reflect.Value, msg protoreflect.Message) er
 		if fieldsDesc != nil {
 			fieldsMap := msg.Get(fieldsDesc).Map()
 			fieldsMap.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
-				key := k.String()
+				key := strings.Clone(k.String())
 				// Convert the value message to structpb.Value
 				if valueMsg := v.Message(); valueMsg != nil {
 					if value, err := convertToStructpbValue(valueMsg); err == nil {
@@ -846,6 +1299,9 @@ func handleStructProtoToStruct(field reflect.Value, msg protoreflect.Message) er
 		field.Set(reflect.ValueOf(structVal))
 		return nil
 	}
+	if wkt, ok := schema.DynamicJSONType(field.Type()); ok && wkt.TypeName == ".google.protobuf.Struct" {
+		return setDynamicJSONField(field, msg)
+	}
 	return fmt.Errorf("field type mismatch for Struct")
 }
 
@@ -885,6 +1341,9 @@ func handleListValueProtoToStruct(field reflect.Value, msg protoreflect.Message)
 		field.Set(reflect.ValueOf(listVal))
 		return nil
 	}
+	if wkt, ok := schema.DynamicJSONType(field.Type()); ok && wkt.TypeName == ".google.protobuf.ListValue" {
+		return setDynamicJSONField(field, msg)
+	}
 	return fmt.Errorf("field type mismatch for ListValue")
 }
 
@@ -900,7 +1359,7 @@ func handleFieldMaskProtoToStruct(field reflect.Value, msg protoreflect.Message)
 		if pathsDesc != nil {
 			pathsList := msg.Get(pathsDesc).List()
 			for i := 0; i < pathsList.Len(); i++ {
-				fieldMask.Paths = append(fieldMask.Paths, pathsList.Get(i).String())
+				fieldMask.Paths = append(fieldMask.Paths, strings.Clone(pathsList.Get(i).String()))
 			}
 		}
 
@@ -917,12 +1376,12 @@ func handleAnyProtoToStruct(field reflect.Value, msg protoreflect.Message) error
 
 		// Get type_url field
 		if typeURLDesc := msg.Descriptor().Fields().ByName("type_url"); typeURLDesc != nil {
-			anyVal.TypeUrl = msg.Get(typeURLDesc).String()
+			anyVal.TypeUrl = strings.Clone(msg.Get(typeURLDesc).String())
 		}
 
 		// Get value field
 		if valueDesc := msg.Descriptor().Fields().ByName("value"); valueDesc != nil {
-			anyVal.Value = msg.Get(valueDesc).Bytes()
+			anyVal.Value = bytes.Clone(msg.Get(valueDesc).Bytes())
 		}
 
 		field.Set(reflect.ValueOf(anyVal))
@@ -962,7 +1421,7 @@ func convertToStructpbValue(msg protoreflect.Message) (*structpb.Value, error) {
 	case "number_value":
 		return structpb.NewNumberValue(msg.Get(setField).Float()), nil
 	case "string_value":
-		return structpb.NewStringValue(msg.Get(setField).String()), nil
+		return structpb.NewStringValue(strings.Clone(msg.Get(setField).String())), nil
 	case "bool_value":
 		return structpb.NewBoolValue(msg.Get(setField).Bool()), nil
 	case "struct_value":
@@ -984,7 +1443,7 @@ func convertStructValue(structMsg protoreflect.Message) (*structpb.Value, error)
 	if fieldsDesc != nil {
 		fieldsMap := structMsg.Get(fieldsDesc).Map()
 		fieldsMap.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
-			key := k.String()
+			key := strings.Clone(k.String())
 			if valueMsg := v.Message(); valueMsg != nil {
 				if value, err := convertToStructpbValue(valueMsg); err == nil {
 					structVal.Fields[key] = value
@@ -1023,38 +1482,35 @@ func setProtoFieldWithWellKnown(msg protoreflect.Message, fd protoreflect.FieldD
 	typeName := string(fd.Message().FullName())
 
 	switch typeName {
-	case "google.protobuf.Timestamp":
-		if value.Type() == reflect.TypeOf(time.Time{}) {
-			t := value.Interface().(time.Time)
-			// Create a Timestamp message
-			timestampMsg := msg.Mutable(fd).Message()
-			timestampMsg.Set(timestampMsg.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
-			nanos := t.Nanosecond()
-			if nanos < 0 || nanos > 999999999 {
-				return fmt.Errorf("nanoseconds out of range: %d", nanos)
-			}
-			timestampMsg.Set(timestampMsg.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(nanos))) // #nosec G115 -- bounds already checked
+	case "google.protobuf.Timestamp", "google.protobuf.Duration":
+		// Nil pointers leave the field unset
+		if value.Kind() == reflect.Ptr && value.IsNil() {
 			return nil
 		}
-	case "google.protobuf.Duration":
-		if value.Type() == reflect.TypeOf(time.Duration(0)) {
-			d := value.Interface().(time.Duration)
-			// Create a Duration message
-			durationMsg := msg.Mutable(fd).Message()
-			seconds := int64(d / time.Second)
-			nanosRemainder := d % time.Second
-			if nanosRemainder < 0 || nanosRemainder > 999999999 {
-				return fmt.Errorf("nanoseconds out of range: %d", nanosRemainder)
-			}
-			nanos := int32(nanosRemainder) // #nosec G115 -- bounds already checked
-			durationMsg.Set(durationMsg.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(seconds))
-			durationMsg.Set(durationMsg.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(nanos))
-			return nil
+		if isTimeValue(value) {
+			return setTimeMessage(msg.Mutable(fd).Message(), value)
 		}
 	case "google.protobuf.Empty":
 		// Empty message - create empty message
 		msg.Mutable(fd).Message()
 		return nil
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		// Nil pointers leave the field unset
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return nil
+		}
+		return setWrapperMessage(msg.Mutable(fd).Message(), value)
+	case "google.protobuf.Struct", "google.protobuf.ListValue":
+		// Dynamic JSON maps and slices; nil ones leave the field unset
+		if _, ok := schema.DynamicJSONType(value.Type()); ok {
+			if value.IsNil() {
+				return nil
+			}
+			return setDynamicJSONMessage(msg.Mutable(fd).Message(), value)
+		}
 	case "google.protobuf.Any":
 		// Handle *anypb.Any
 		if value.Type() == reflect.TypeOf(&anypb.Any{}) {
@@ -1070,3 +1526,64 @@ func setProtoFieldWithWellKnown(msg protoreflect.Message, fd protoreflect.FieldD
 
 	return fmt.Errorf("not a well-known type or unsupported conversion")
 }
+
+// setDynamicJSONMessage sets a Struct or ListValue message from a
+// map[string]any or []any value, as decoded by encoding/json.
+func setDynamicJSONMessage(msg protoreflect.Message, value reflect.Value) error {
+	var src proto.Message
+	var err error
+	if value.Kind() == reflect.Map {
+		fields := make(map[string]any, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			fields[iter.Key().String()] = iter.Value().Interface()
+		}
+		src, err = structpb.NewStruct(fields)
+	} else {
+		values := make([]any, value.Len())
+		for i := range values {
+			values[i] = value.Index(i).Interface()
+		}
+		src, err = structpb.NewList(values)
+	}
+	if err != nil {
+		return err
+	}
+
+	// msg may be a dynamic message, so it is merged through the wire format
+	data, err := proto.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return proto.UnmarshalOptions{Merge: true}.Unmarshal(data, msg.Interface())
+}
+
+// setDynamicJSONField sets a map[string]any or []any field from a Struct or
+// ListValue message.
+func setDynamicJSONField(field reflect.Value, msg protoreflect.Message) error {
+	if field.Kind() == reflect.Map {
+		value, err := convertStructValue(msg)
+		if err != nil {
+			return err
+		}
+		fields := value.GetStructValue().AsMap()
+		m := reflect.MakeMapWithSize(field.Type(), len(fields))
+		for k, v := range fields {
+			m.SetMapIndex(reflect.ValueOf(k).Convert(field.Type().Key()), reflect.ValueOf(&v).Elem())
+		}
+		field.Set(m)
+		return nil
+	}
+
+	value, err := convertListValue(msg)
+	if err != nil {
+		return err
+	}
+	values := value.GetListValue().AsSlice()
+	list := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i := range values {
+		list.Index(i).Set(reflect.ValueOf(&values[i]).Elem())
+	}
+	field.Set(list)
+	return nil
+}
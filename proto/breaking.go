@@ -0,0 +1,214 @@
+package proto
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// BreakingChange is a change of a schema that breaks existing clients, on the
+// wire or in JSON.
+type BreakingChange struct {
+	// Element is the full name of the changed element, e.g. "user.v1.User.email"
+	Element string `json:"element"`
+	// Message describes the change
+	Message string `json:"message"`
+}
+
+// String returns the change as "element: message".
+func (c BreakingChange) String() string {
+	return c.Element + ": " + c.Message
+}
+
+// CheckCompatibility returns the changes from previous to current that break
+// clients of previous, sorted by element: removed services, methods,
+// messages, enums, fields, and enum values, and changed method signatures,
+// field types, cardinalities, and names. Fields and enum values may be
+// removed if their numbers are reserved.
+func CheckCompatibility(previous, current *descriptorpb.FileDescriptorSet) []BreakingChange {
+	before, after := indexSchema(previous), indexSchema(current)
+	var changes []BreakingChange
+	report := func(element, format string, args ...any) {
+		changes = append(changes, BreakingChange{Element: element, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for name, svc := range before.services {
+		next, ok := after.services[name]
+		if !ok {
+			report(name, "service removed")
+			continue
+		}
+		checkServiceCompatibility(name, svc, next, report)
+	}
+	for name, msg := range before.messages {
+		next, ok := after.messages[name]
+		if !ok {
+			report(name, "message removed")
+			continue
+		}
+		checkMessageCompatibility(name, msg, next, report)
+	}
+	for name, enum := range before.enums {
+		next, ok := after.enums[name]
+		if !ok {
+			report(name, "enum removed")
+			continue
+		}
+		checkEnumCompatibility(name, enum, next, report)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Element != changes[j].Element {
+			return changes[i].Element < changes[j].Element
+		}
+		return changes[i].Message < changes[j].Message
+	})
+	return changes
+}
+
+// schemaIndex holds the elements of a FileDescriptorSet by full name.
+type schemaIndex struct {
+	services map[string]*descriptorpb.ServiceDescriptorProto
+	messages map[string]*descriptorpb.DescriptorProto
+	enums    map[string]*descriptorpb.EnumDescriptorProto
+}
+
+// indexSchema indexes the services, messages, and enums of fdset, including
+// nested ones.
+func indexSchema(fdset *descriptorpb.FileDescriptorSet) schemaIndex {
+	index := schemaIndex{
+		services: make(map[string]*descriptorpb.ServiceDescriptorProto),
+		messages: make(map[string]*descriptorpb.DescriptorProto),
+		enums:    make(map[string]*descriptorpb.EnumDescriptorProto),
+	}
+	for _, file := range fdset.GetFile() {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = file.GetPackage() + "."
+		}
+		for _, svc := range file.GetService() {
+			index.services[prefix+svc.GetName()] = svc
+		}
+		for _, enum := range file.GetEnumType() {
+			index.enums[prefix+enum.GetName()] = enum
+		}
+		for _, msg := range file.GetMessageType() {
+			index.addMessage(prefix, msg)
+		}
+	}
+	return index
+}
+
+func (index schemaIndex) addMessage(prefix string, msg *descriptorpb.DescriptorProto) {
+	name := prefix + msg.GetName()
+	index.messages[name] = msg
+	for _, enum := range msg.GetEnumType() {
+		index.enums[name+"."+enum.GetName()] = enum
+	}
+	for _, nested := range msg.GetNestedType() {
+		index.addMessage(name+".", nested)
+	}
+}
+
+// checkServiceCompatibility reports removed methods and changed signatures.
+func checkServiceCompatibility(name string, svc, next *descriptorpb.ServiceDescriptorProto, report func(string, string, ...any)) {
+	methods := make(map[string]*descriptorpb.MethodDescriptorProto, len(next.GetMethod()))
+	for _, method := range next.GetMethod() {
+		methods[method.GetName()] = method
+	}
+	for _, method := range svc.GetMethod() {
+		element := name + "." + method.GetName()
+		after, ok := methods[method.GetName()]
+		if !ok {
+			report(element, "method removed")
+			continue
+		}
+		if method.GetInputType() != after.GetInputType() {
+			report(element, "input type changed from %s to %s", method.GetInputType(), after.GetInputType())
+		}
+		if method.GetOutputType() != after.GetOutputType() {
+			report(element, "output type changed from %s to %s", method.GetOutputType(), after.GetOutputType())
+		}
+		if method.GetClientStreaming() != after.GetClientStreaming() || method.GetServerStreaming() != after.GetServerStreaming() {
+			report(element, "streaming changed")
+		}
+	}
+}
+
+// checkMessageCompatibility reports removed fields and changed field types,
+// cardinalities, and names, matching fields by number.
+func checkMessageCompatibility(name string, msg, next *descriptorpb.DescriptorProto, report func(string, string, ...any)) {
+	fields := make(map[int32]*descriptorpb.FieldDescriptorProto, len(next.GetField()))
+	for _, field := range next.GetField() {
+		fields[field.GetNumber()] = field
+	}
+	for _, field := range msg.GetField() {
+		element := name + "." + field.GetName()
+		after, ok := fields[field.GetNumber()]
+		if !ok {
+			if !reservedField(next, field.GetNumber()) {
+				report(element, "field %d removed without reserving its number", field.GetNumber())
+			}
+			continue
+		}
+		if field.GetType() != after.GetType() || field.GetTypeName() != after.GetTypeName() {
+			report(element, "type changed from %s to %s", fieldTypeName(field), fieldTypeName(after))
+		}
+		if (field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) !=
+			(after.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) {
+			report(element, "cardinality changed")
+		}
+		if field.GetName() != after.GetName() || field.GetJsonName() != after.GetJsonName() {
+			report(element, "field %d renamed to %s", field.GetNumber(), after.GetName())
+		}
+	}
+}
+
+// checkEnumCompatibility reports removed and renamed enum values.
+func checkEnumCompatibility(name string, enum, next *descriptorpb.EnumDescriptorProto, report func(string, string, ...any)) {
+	values := make(map[int32]string, len(next.GetValue()))
+	for _, value := range next.GetValue() {
+		values[value.GetNumber()] = value.GetName()
+	}
+	for _, value := range enum.GetValue() {
+		element := name + "." + value.GetName()
+		after, ok := values[value.GetNumber()]
+		switch {
+		case !ok && !reservedEnumValue(next, value.GetNumber()):
+			report(element, "value %d removed without reserving its number", value.GetNumber())
+		case ok && after != value.GetName():
+			report(element, "value %d renamed to %s", value.GetNumber(), after)
+		}
+	}
+}
+
+// reservedField reports whether number is reserved in msg. Reserved ranges
+// of messages exclude their end.
+func reservedField(msg *descriptorpb.DescriptorProto, number int32) bool {
+	for _, r := range msg.GetReservedRange() {
+		if number >= r.GetStart() && number < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedEnumValue reports whether number is reserved in enum. Reserved
+// ranges of enums include their end.
+func reservedEnumValue(enum *descriptorpb.EnumDescriptorProto, number int32) bool {
+	for _, r := range enum.GetReservedRange() {
+		if number >= r.GetStart() && number <= r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldTypeName returns the message or enum type of field, or its scalar type.
+func fieldTypeName(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetTypeName() != "" {
+		return field.GetTypeName()
+	}
+	return field.GetType().String()
+}
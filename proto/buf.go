@@ -0,0 +1,186 @@
+package proto
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Names of the configuration files of a buf module.
+const (
+	BufYAML    = "buf.yaml"
+	BufGenYAML = "buf.gen.yaml"
+)
+
+// defaultBufOut is the output directory of the default buf plugins.
+const defaultBufOut = "gen"
+
+// BufOptions configures the buf module written by ExportBufModule.
+type BufOptions struct {
+	// Module is the name of the module on the Buf Schema Registry, e.g.
+	// "buf.build/acme/users" (optional, required to push)
+	Module string
+	// GoPackagePrefix enables managed mode in buf.gen.yaml, deriving the
+	// go_package option of each file from this import path prefix
+	GoPackagePrefix string
+	// Plugins are the plugins of buf.gen.yaml (default: DefaultBufPlugins)
+	Plugins []BufPlugin
+}
+
+// BufPlugin is a code generation plugin of buf.gen.yaml.
+type BufPlugin struct {
+	// Remote is the plugin on the Buf Schema Registry, e.g. "buf.build/protocolbuffers/go"
+	Remote string
+	// Local is the name or path of a locally installed plugin, used when Remote is empty
+	Local string
+	// Out is the output directory, relative to the module
+	Out string
+	// Opt are the plugin options, e.g. "paths=source_relative"
+	Opt []string
+}
+
+// DefaultBufPlugins returns the plugins generating Go messages and
+// Connect handlers and clients.
+func DefaultBufPlugins() []BufPlugin {
+	return []BufPlugin{
+		{Remote: "buf.build/protocolbuffers/go", Out: defaultBufOut, Opt: []string{"paths=source_relative"}},
+		{Remote: "buf.build/connectrpc/go", Out: defaultBufOut, Opt: []string{"paths=source_relative"}},
+	}
+}
+
+// ExportBufModule exports the proto files of a FileDescriptorSet as a buf
+// module: each file is moved to the directory of its package (e.g. package
+// "user.v1" to "user/v1/"), with its imports rewritten, next to a buf.yaml
+// and a buf.gen.yaml. The well-known types are provided by buf and left out.
+// The result maps paths relative to the module root to their contents.
+func (e *Exporter) ExportBufModule(fdset *descriptorpb.FileDescriptorSet, opts BufOptions) (map[string]string, error) {
+	relocated, err := relocateToPackageDirs(fdset)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := e.ExportFileDescriptorSet(relocated)
+	if err != nil {
+		return nil, err
+	}
+	for name := range files {
+		if isWellKnownFile(name) {
+			delete(files, name)
+		}
+	}
+
+	files[BufYAML] = bufYAML(opts)
+	files[BufGenYAML] = bufGenYAML(opts)
+	return files, nil
+}
+
+// ExportBufModuleToZip exports a buf module, as ExportBufModule, to a ZIP archive.
+func (e *Exporter) ExportBufModuleToZip(fdset *descriptorpb.FileDescriptorSet, opts BufOptions) ([]byte, error) {
+	files, err := e.ExportBufModule(fdset, opts)
+	if err != nil {
+		return nil, err
+	}
+	return zipFiles(files)
+}
+
+// relocateToPackageDirs returns a copy of fdset with every file moved to the
+// directory of its package and the imports updated accordingly.
+func relocateToPackageDirs(fdset *descriptorpb.FileDescriptorSet) (*descriptorpb.FileDescriptorSet, error) {
+	paths := make(map[string]string, len(fdset.File))
+	owners := make(map[string]string, len(fdset.File))
+	for _, file := range fdset.File {
+		name := file.GetName()
+		moved := packageDirPath(name, file.GetPackage())
+		if owner, ok := owners[moved]; ok && owner != name {
+			return nil, fmt.Errorf("files %s and %s both map to %s", owner, name, moved)
+		}
+		paths[name], owners[moved] = moved, name
+	}
+
+	result := &descriptorpb.FileDescriptorSet{File: make([]*descriptorpb.FileDescriptorProto, 0, len(fdset.File))}
+	for _, file := range fdset.File {
+		file = proto.Clone(file).(*descriptorpb.FileDescriptorProto)
+		file.Name = proto.String(paths[file.GetName()])
+		for i, dep := range file.Dependency {
+			if moved, ok := paths[dep]; ok {
+				file.Dependency[i] = moved
+			}
+		}
+		result.File = append(result.File, file)
+	}
+	return result, nil
+}
+
+// packageDirPath returns the path of a file in the directory of its package,
+// as required by buf lint. A file named after its package, as hyperway names
+// service files (e.g. "user.v1.proto"), is renamed to "user/v1/user_v1.proto".
+func packageDirPath(name, pkg string) string {
+	if pkg == "" || isWellKnownFile(name) {
+		return name
+	}
+	dir := strings.ReplaceAll(pkg, ".", "/")
+	if path.Dir(name) == dir {
+		return name
+	}
+	base := path.Base(name)
+	if base == pkg+".proto" {
+		base = strings.ReplaceAll(pkg, ".", "_") + ".proto"
+	}
+	return dir + "/" + base
+}
+
+// isWellKnownFile reports whether name is a file of the well-known types.
+func isWellKnownFile(name string) bool {
+	return strings.HasPrefix(name, "google/protobuf/")
+}
+
+// bufYAML returns the buf.yaml of a module.
+func bufYAML(opts BufOptions) string {
+	var b strings.Builder
+	b.WriteString("version: v2\n")
+	b.WriteString("modules:\n")
+	b.WriteString("  - path: .\n")
+	if opts.Module != "" {
+		fmt.Fprintf(&b, "    name: %s\n", opts.Module)
+	}
+	b.WriteString("lint:\n  use:\n    - STANDARD\n")
+	b.WriteString("breaking:\n  use:\n    - FILE\n")
+	return b.String()
+}
+
+// bufGenYAML returns the buf.gen.yaml of a module.
+func bufGenYAML(opts BufOptions) string {
+	plugins := opts.Plugins
+	if len(plugins) == 0 {
+		plugins = DefaultBufPlugins()
+	}
+
+	var b strings.Builder
+	b.WriteString("version: v2\n")
+	if opts.GoPackagePrefix != "" {
+		b.WriteString("managed:\n  enabled: true\n  override:\n")
+		b.WriteString("    - file_option: go_package_prefix\n")
+		fmt.Fprintf(&b, "      value: %s\n", opts.GoPackagePrefix)
+	}
+	b.WriteString("plugins:\n")
+	for _, plugin := range plugins {
+		if plugin.Remote != "" {
+			fmt.Fprintf(&b, "  - remote: %s\n", plugin.Remote)
+		} else {
+			fmt.Fprintf(&b, "  - local: %s\n", plugin.Local)
+		}
+		out := plugin.Out
+		if out == "" {
+			out = defaultBufOut
+		}
+		fmt.Fprintf(&b, "    out: %s\n", out)
+		if len(plugin.Opt) > 0 {
+			fmt.Fprintf(&b, "    opt: %s\n", strings.Join(plugin.Opt, ","))
+		}
+	}
+	b.WriteString("inputs:\n  - directory: .\n")
+	return b.String()
+}
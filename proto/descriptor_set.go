@@ -0,0 +1,124 @@
+package proto
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// wellKnownPackage is the package of the well-known types, whose files keep
+// their own language options.
+const wellKnownPackage = "google.protobuf"
+
+// ExportDescriptorSet returns a self-contained copy of fdset. Imports missing
+// from fdset, such as the well-known types, are resolved from the files linked
+// into the binary, and every file comes after its dependencies, as protoc
+// --descriptor_set_in, buf, and grpcurl -protoset expect.
+//
+// The language options of the exporter are set on the files of fdset, and
+// source code info is dropped unless IncludeComments is set.
+func (e *Exporter) ExportDescriptorSet(fdset *descriptorpb.FileDescriptorSet) (*descriptorpb.FileDescriptorSet, error) {
+	files := make(map[string]*descriptorpb.FileDescriptorProto, len(fdset.GetFile()))
+	for _, fdp := range fdset.GetFile() {
+		files[fdp.GetName()] = fdp
+	}
+
+	result := &descriptorpb.FileDescriptorSet{}
+	state := make(map[string]bool) // file name -> done; false while visiting
+	var visit func(name, importedBy string) error
+	visit = func(name, importedBy string) error {
+		done, seen := state[name]
+		if seen {
+			if !done {
+				return fmt.Errorf("import cycle through %s", name)
+			}
+			return nil
+		}
+		state[name] = false
+
+		fdp, ok := files[name]
+		if ok {
+			fdp = proto.Clone(fdp).(*descriptorpb.FileDescriptorProto)
+			e.applyLanguageOptions(fdp)
+		} else {
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("unresolved import %s of %s", name, importedBy)
+			}
+			fdp = protodesc.ToFileDescriptorProto(fd)
+		}
+		for _, dep := range fdp.GetDependency() {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		if !e.options.IncludeComments {
+			fdp.SourceCodeInfo = nil
+		}
+
+		state[name] = true
+		result.File = append(result.File, fdp)
+		return nil
+	}
+	for _, fdp := range fdset.GetFile() {
+		if err := visit(fdp.GetName(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fail here rather than in the tools the set is fed to
+	if _, err := protodesc.NewFiles(result); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	return result, nil
+}
+
+// ExportDescriptorSetBytes returns ExportDescriptorSet serialized, e.g. for a
+// .binpb or .protoset file. The output is deterministic.
+func (e *Exporter) ExportDescriptorSetBytes(fdset *descriptorpb.FileDescriptorSet) ([]byte, error) {
+	set, err := e.ExportDescriptorSet(fdset)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal descriptor set: %w", err)
+	}
+	return data, nil
+}
+
+// applyLanguageOptions sets the language options of the exporter on a file.
+// Python has no file option, so PythonPackage only applies to .proto output.
+func (e *Exporter) applyLanguageOptions(fdp *descriptorpb.FileDescriptorProto) {
+	opts := e.options.LanguageOptions
+	if fdp.GetPackage() == wellKnownPackage {
+		return
+	}
+
+	fileOpts := fdp.GetOptions()
+	if fileOpts == nil {
+		fileOpts = &descriptorpb.FileOptions{}
+	}
+	setString := func(field **string, value string) {
+		if value != "" {
+			*field = proto.String(value)
+		}
+	}
+	setString(&fileOpts.GoPackage, opts.GoPackage)
+	setString(&fileOpts.JavaPackage, opts.JavaPackage)
+	setString(&fileOpts.JavaOuterClassname, opts.JavaOuterClass)
+	setString(&fileOpts.CsharpNamespace, opts.CSharpNamespace)
+	setString(&fileOpts.PhpNamespace, opts.PhpNamespace)
+	setString(&fileOpts.PhpMetadataNamespace, opts.PhpMetadataNamespace)
+	setString(&fileOpts.RubyPackage, opts.RubyPackage)
+	setString(&fileOpts.ObjcClassPrefix, opts.ObjcClassPrefix)
+	if opts.JavaMultipleFiles {
+		fileOpts.JavaMultipleFiles = proto.Bool(true)
+	}
+	if proto.Size(fileOpts) > 0 {
+		fdp.Options = fileOpts
+	}
+}
@@ -90,6 +90,12 @@ func NewExporter(opts *ExportOptions) *Exporter {
 func (e *Exporter) ExportFileDescriptorSet(fdset *descriptorpb.FileDescriptorSet) (map[string]string, error) {
 	result := make(map[string]string)
 
+	for _, fdp := range fdset.File {
+		if err := checkGroups(fdp); err != nil {
+			return nil, err
+		}
+	}
+
 	// Add Well-Known Types to FileDescriptorSet if they are referenced but not included
 	fdset = e.addWellKnownTypes(fdset)
 
@@ -128,7 +134,7 @@ func (e *Exporter) ExportFileDescriptorSet(fdset *descriptorpb.FileDescriptorSet
 		}
 
 		// Insert language-specific options
-		content = e.insertLanguageOptions(content)
+		content = e.insertLanguageOptions(content, fdMap[fd.Path()].GetEdition())
 
 		// Ensure file ends with a newline
 		if !strings.HasSuffix(content, "\n") {
@@ -148,6 +154,10 @@ func (e *Exporter) ExportFileDescriptorSet(fdset *descriptorpb.FileDescriptorSet
 
 // ExportFileDescriptorProto exports a single proto file.
 func (e *Exporter) ExportFileDescriptorProto(fdp *descriptorpb.FileDescriptorProto) (string, error) {
+	if err := checkGroups(fdp); err != nil {
+		return "", err
+	}
+
 	// Create a FileDescriptorSet with just this file
 	fdset := &descriptorpb.FileDescriptorSet{
 		File: []*descriptorpb.FileDescriptorProto{fdp},
@@ -189,7 +199,7 @@ func (e *Exporter) ExportFileDescriptorProto(fdp *descriptorpb.FileDescriptorPro
 	result = fixProto3Optional(result, fdp)
 
 	// Insert language-specific options
-	result = e.insertLanguageOptions(result)
+	result = e.insertLanguageOptions(result, fdp.GetEdition())
 
 	// Ensure file ends with a newline
 	if !strings.HasSuffix(result, "\n") {
@@ -206,7 +216,11 @@ func (e *Exporter) ExportToZip(fdset *descriptorpb.FileDescriptorSet) ([]byte, e
 	if err != nil {
 		return nil, err
 	}
+	return zipFiles(files)
+}
 
+// zipFiles writes files, keyed by path, to a ZIP archive.
+func zipFiles(files map[string]string) ([]byte, error) {
 	// Create ZIP archive
 	var buf bytes.Buffer
 	w := zip.NewWriter(&buf)
@@ -292,6 +306,28 @@ func MergeFileDescriptorSets(sets ...*descriptorpb.FileDescriptorSet) *descripto
 	return merged
 }
 
+// checkGroups rejects files with groups, a deprecated proto2 feature that
+// exported files do not support.
+func checkGroups(fdp *descriptorpb.FileDescriptorProto) error {
+	var check func(prefix string, msgs []*descriptorpb.DescriptorProto) error
+	check = func(prefix string, msgs []*descriptorpb.DescriptorProto) error {
+		for _, msg := range msgs {
+			name := prefix + msg.GetName()
+			for _, field := range msg.Field {
+				if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+					return fmt.Errorf("%s: field %s.%s is a group, which is not supported; use a nested message instead",
+						fdp.GetName(), name, field.GetName())
+				}
+			}
+			if err := check(name+".", msg.NestedType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check("", fdp.MessageType)
+}
+
 // fixEditionsSyntax fixes the Protobuf Editions syntax format in the exported proto content.
 // The protoreflect/protoprint library outputs 'syntax = "editions";' but according to the
 // official Protobuf Editions specification, it should be 'edition = "2023";' instead.
@@ -566,11 +602,17 @@ func (opts *ExportOptions) ApplyOptions(options ...ExportOption) {
 	}
 }
 
-// insertLanguageOptions inserts language-specific options into the proto content.
+// insertLanguageOptions inserts language-specific options into the proto
+// content of a file of the given edition.
 //
 //nolint:gocyclo // This function handles multiple language options which naturally increases complexity
-func (e *Exporter) insertLanguageOptions(content string) string {
+func (e *Exporter) insertLanguageOptions(content string, edition descriptorpb.Edition) string {
 	opts := e.options.LanguageOptions
+	if edition >= descriptorpb.Edition_EDITION_2024 {
+		// Edition 2024 removes java_multiple_files, generating a file per
+		// top-level type by default
+		opts.JavaMultipleFiles = false
+	}
 
 	// If no options are specified, return content as-is
 	if opts.GoPackage == "" && opts.JavaPackage == "" && opts.CSharpNamespace == "" &&
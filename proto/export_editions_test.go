@@ -131,3 +131,29 @@ func TestEditionsSyntaxFixInFileDescriptorSet(t *testing.T) {
 func ptr[T any](v T) *T {
 	return &v
 }
+
+func TestEdition2024OmitsJavaMultipleFiles(t *testing.T) {
+	opts := DefaultExportOptions()
+	opts.LanguageOptions = LanguageOptions{JavaPackage: "com.example", JavaMultipleFiles: true}
+	exporter := NewExporter(&opts)
+	for edition, want := range map[descriptorpb.Edition]bool{
+		descriptorpb.Edition_EDITION_2023: true,
+		descriptorpb.Edition_EDITION_2024: false,
+	} {
+		content, err := exporter.ExportFileDescriptorProto(&descriptorpb.FileDescriptorProto{
+			Name:    ptr("test.proto"),
+			Package: ptr("test.v1"),
+			Syntax:  ptr("editions"),
+			Edition: ptr(edition),
+		})
+		if err != nil {
+			t.Fatalf("Failed to export %v: %v", edition, err)
+		}
+		if got := strings.Contains(content, "java_multiple_files"); got != want {
+			t.Errorf("%v: java_multiple_files present = %v, want %v:\n%s", edition, got, want, content)
+		}
+		if !strings.Contains(content, `option java_package = "com.example";`) {
+			t.Errorf("%v: expected the java_package option:\n%s", edition, content)
+		}
+	}
+}
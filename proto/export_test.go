@@ -2,8 +2,14 @@ package proto_test
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"testing"
+	"time"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/i2y/hyperway/proto"
 	"github.com/i2y/hyperway/rpc"
@@ -62,6 +68,97 @@ func TestExportProto(t *testing.T) {
 	t.Logf("Generated proto:\n%s", protoContent)
 }
 
+func TestExportSensitiveFields(t *testing.T) {
+	type LoginRequest struct {
+		User     string            `json:"user"`
+		Password string            `json:"password" sensitive:"true"`
+		Tokens   map[string]string `json:"tokens" sensitive:"true"`
+	}
+	svc := rpc.NewService("AuthService", rpc.WithPackage("auth.v1"))
+	if err := rpc.Register(svc, "Login", func(ctx context.Context, req *LoginRequest) (*TestResponse, error) {
+		return &TestResponse{Success: true}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	protoContent, err := svc.ExportProto()
+	if err != nil {
+		t.Fatalf("Failed to export proto: %v", err)
+	}
+	for _, expected := range []string{
+		"string password = 2 [debug_redact = true];",
+		"map<string, string> tokens = 3 [debug_redact = true];",
+	} {
+		if !strings.Contains(protoContent, expected) {
+			t.Errorf("Expected proto to contain %q, got:\n%s", expected, protoContent)
+		}
+	}
+	if strings.Contains(protoContent, "string user = 1 [") {
+		t.Errorf("Expected no options on fields without the tag, got:\n%s", protoContent)
+	}
+}
+
+func TestExportServices(t *testing.T) {
+	type OrderRequest struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	orders := rpc.NewService("OrderService", rpc.WithPackage("shop.v1"))
+	rpc.MustRegister(orders, "GetOrder", func(ctx context.Context, req *OrderRequest) (*TestResponse, error) {
+		return &TestResponse{}, nil
+	})
+	carts := rpc.NewService("CartService", rpc.WithPackage("shop.v1"))
+	rpc.MustRegister(carts, "Checkout", testHandler)
+	admin := rpc.NewService("AdminService", rpc.WithPackage("admin.v1"))
+	rpc.MustRegister(admin, "Ping", testHandler)
+
+	files, err := rpc.ExportServices(orders, carts, admin)
+	if err != nil {
+		t.Fatalf("Failed to export services: %v", err)
+	}
+	shop := files["shop.v1.proto"]
+	for _, expected := range []string{
+		"service OrderService",
+		"service CartService",
+		"message OrderRequest",
+		"message TestRequest",
+		`import "google/protobuf/timestamp.proto";`,
+	} {
+		if !strings.Contains(shop, expected) {
+			t.Errorf("Expected shop.v1.proto to contain %q, got:\n%s", expected, shop)
+		}
+	}
+	if n := strings.Count(shop, "message TestResponse {"); n != 1 {
+		t.Errorf("Expected the shared message to be defined once, got %d:\n%s", n, shop)
+	}
+	if !strings.Contains(files["admin.v1.proto"], "service AdminService") {
+		t.Errorf("Expected a file for the other package, got %v", files)
+	}
+
+	t.Run("conflicting messages fail", func(t *testing.T) {
+		type Item struct {
+			Name string `json:"name"`
+		}
+		other := rpc.NewService("ItemService", rpc.WithPackage("shop.v1"))
+		rpc.MustRegister(other, "GetItem", func(ctx context.Context, req *Item) (*TestResponse, error) {
+			return &TestResponse{}, nil
+		})
+		conflicting := func() *rpc.Service {
+			type Item struct {
+				SKU int64 `json:"sku"`
+			}
+			svc := rpc.NewService("StockService", rpc.WithPackage("shop.v1"))
+			rpc.MustRegister(svc, "GetStock", func(ctx context.Context, req *Item) (*TestResponse, error) {
+				return &TestResponse{}, nil
+			})
+			return svc
+		}()
+		if _, err := rpc.ExportServices(other, conflicting); err == nil || !strings.Contains(err.Error(), "shop.v1.Item") {
+			t.Errorf("Expected a conflict on shop.v1.Item, got %v", err)
+		}
+	})
+}
+
 func TestExportAllProtos(t *testing.T) {
 	// Create a test service
 	svc := rpc.NewService("TestService", rpc.WithPackage("test.v1"))
@@ -375,3 +472,204 @@ func TestExportAllProtosWithLanguageOptions(t *testing.T) {
 		}
 	}
 }
+
+type ScheduleRequest struct {
+	At time.Time `json:"at"`
+}
+
+func scheduleHandler(ctx context.Context, req *ScheduleRequest) (*TestResponse, error) {
+	return &TestResponse{Success: true}, nil
+}
+
+func TestExportDescriptorSetBytes(t *testing.T) {
+	svc := rpc.NewService("ScheduleService", rpc.WithPackage("schedule.v1"))
+	if err := rpc.Register(svc, "Schedule", scheduleHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := svc.ExportDescriptorSetBytes(proto.WithGoPackage("github.com/example/schedule;schedulev1"))
+	if err != nil {
+		t.Fatalf("Failed to export descriptor set: %v", err)
+	}
+	fdset := &descriptorpb.FileDescriptorSet{}
+	if err := protobuf.Unmarshal(data, fdset); err != nil {
+		t.Fatalf("Failed to unmarshal descriptor set: %v", err)
+	}
+
+	// Self-contained, with dependencies first
+	if _, err := protodesc.NewFiles(fdset); err != nil {
+		t.Fatalf("Expected a self-contained descriptor set: %v", err)
+	}
+	names := make([]string, 0, len(fdset.File))
+	for _, file := range fdset.File {
+		names = append(names, file.GetName())
+	}
+	if len(names) != 2 || names[0] != "google/protobuf/timestamp.proto" || names[1] != "schedule.v1.proto" {
+		t.Errorf("Expected timestamp.proto before the service file, got %v", names)
+	}
+
+	if pkg := fdset.File[1].GetOptions().GetGoPackage(); pkg != "github.com/example/schedule;schedulev1" {
+		t.Errorf("Expected the go_package option, got %q", pkg)
+	}
+	if fdset.File[0].GetOptions().GetGoPackage() != "google.golang.org/protobuf/types/known/timestamppb" {
+		t.Error("Expected the well-known types to keep their options")
+	}
+
+	// Deterministic output
+	again, err := svc.ExportDescriptorSetBytes(proto.WithGoPackage("github.com/example/schedule;schedulev1"))
+	if err != nil || string(again) != string(data) {
+		t.Error("Expected the same bytes on every export")
+	}
+}
+
+func TestExportDescriptorSetUnresolvedImport(t *testing.T) {
+	fdset := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:       protobuf.String("orders.proto"),
+			Package:    protobuf.String("orders.v1"),
+			Dependency: []string{"common/money.proto"},
+		}},
+	}
+	opts := proto.DefaultExportOptions()
+	_, err := proto.NewExporter(&opts).ExportDescriptorSetBytes(fdset)
+	if err == nil || !strings.Contains(err.Error(), "common/money.proto") {
+		t.Errorf("Expected an unresolved import error, got %v", err)
+	}
+}
+
+func TestExportBufModule(t *testing.T) {
+	svc := rpc.NewService("ScheduleService", rpc.WithPackage("schedule.v1"))
+	if err := rpc.Register(svc, "Schedule", scheduleHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := svc.ExportBufModule(proto.BufOptions{
+		Module:          "buf.build/acme/schedule",
+		GoPackagePrefix: "github.com/acme/schedule/gen",
+	})
+	if err != nil {
+		t.Fatalf("Failed to export buf module: %v", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "buf.gen.yaml,buf.yaml,schedule/v1/schedule_v1.proto" {
+		t.Errorf("Expected the service file in its package directory without the well-known types, got %v", names)
+	}
+	if !strings.Contains(files["schedule/v1/schedule_v1.proto"], `import "google/protobuf/timestamp.proto"`) {
+		t.Error("Expected the well-known type import to be kept")
+	}
+	if !strings.Contains(files[proto.BufYAML], "name: buf.build/acme/schedule") {
+		t.Errorf("Expected the module name in buf.yaml, got:\n%s", files[proto.BufYAML])
+	}
+	for _, want := range []string{"value: github.com/acme/schedule/gen", "remote: buf.build/protocolbuffers/go", "remote: buf.build/connectrpc/go"} {
+		if !strings.Contains(files[proto.BufGenYAML], want) {
+			t.Errorf("Expected %q in buf.gen.yaml, got:\n%s", want, files[proto.BufGenYAML])
+		}
+	}
+}
+
+func TestExportBufModuleRewritesImports(t *testing.T) {
+	fdset := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			{
+				Name:        protobuf.String("money.proto"),
+				Package:     protobuf.String("common.v1"),
+				Syntax:      protobuf.String("proto3"),
+				MessageType: []*descriptorpb.DescriptorProto{{Name: protobuf.String("Money")}},
+			},
+			{
+				Name:       protobuf.String("orders.proto"),
+				Package:    protobuf.String("orders.v1"),
+				Syntax:     protobuf.String("proto3"),
+				Dependency: []string{"money.proto"},
+				MessageType: []*descriptorpb.DescriptorProto{{
+					Name: protobuf.String("Order"),
+					Field: []*descriptorpb.FieldDescriptorProto{{
+						Name:     protobuf.String("total"),
+						Number:   protobuf.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: protobuf.String(".common.v1.Money"),
+						JsonName: protobuf.String("total"),
+					}},
+				}},
+			},
+		},
+	}
+	opts := proto.DefaultExportOptions()
+	files, err := proto.NewExporter(&opts).ExportBufModule(fdset, proto.BufOptions{
+		Plugins: []proto.BufPlugin{{Local: "protoc-gen-go", Out: "gen/go"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to export buf module: %v", err)
+	}
+
+	if _, ok := files["common/v1/money.proto"]; !ok {
+		t.Errorf("Expected money.proto in common/v1, got %v", files)
+	}
+	if !strings.Contains(files["orders/v1/orders.proto"], `import "common/v1/money.proto"`) {
+		t.Errorf("Expected the import to follow the moved file, got:\n%s", files["orders/v1/orders.proto"])
+	}
+	if gen := files[proto.BufGenYAML]; !strings.Contains(gen, "local: protoc-gen-go") || strings.Contains(gen, "managed:") {
+		t.Errorf("Expected the local plugin without managed mode, got:\n%s", gen)
+	}
+	if strings.Contains(files[proto.BufYAML], "name:") {
+		t.Errorf("Expected no module name, got:\n%s", files[proto.BufYAML])
+	}
+}
+
+func TestExportProto2(t *testing.T) {
+	type SearchRequest struct {
+		Query    string  `json:"query" proto:"required"`
+		PageSize int32   `json:"page_size" default:"20"`
+		Cursor   *string `json:"cursor"`
+	}
+	svc := rpc.NewService("SearchService", rpc.WithPackage("search.v1"), rpc.WithSyntax("proto2"))
+	rpc.MustRegister(svc, "Search", func(ctx context.Context, req *SearchRequest) (*TestResponse, error) {
+		return &TestResponse{}, nil
+	})
+
+	protoContent, err := svc.ExportProto()
+	if err != nil {
+		t.Fatalf("Failed to export proto: %v", err)
+	}
+	for _, expected := range []string{
+		`syntax = "proto2";`,
+		"required string query = 1;",
+		"optional int32 page_size = 2 [default = 20];",
+		"optional string cursor = 3;",
+		"optional bool success = 1;",
+	} {
+		if !strings.Contains(protoContent, expected) {
+			t.Errorf("Expected proto to contain %q, got:\n%s", expected, protoContent)
+		}
+	}
+
+	t.Run("rejects groups", func(t *testing.T) {
+		fdp := &descriptorpb.FileDescriptorProto{
+			Name:    protobuf.String("group.proto"),
+			Package: protobuf.String("test.v1"),
+			Syntax:  protobuf.String("proto2"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: protobuf.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     protobuf.String("item"),
+					Number:   protobuf.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_GROUP.Enum(),
+					TypeName: protobuf.String(".test.v1.Order.Item"),
+				}},
+				NestedType: []*descriptorpb.DescriptorProto{{Name: protobuf.String("Item")}},
+			}},
+		}
+		opts := proto.DefaultExportOptions()
+		_, err := proto.NewExporter(&opts).ExportFileDescriptorProto(fdp)
+		if err == nil || !strings.Contains(err.Error(), "Order.item is a group") {
+			t.Errorf("Expected an error naming the group, got %v", err)
+		}
+	})
+}
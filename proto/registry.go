@@ -0,0 +1,266 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LatestVersion refers to the most recently pushed version of a module.
+const LatestVersion = "latest"
+
+// maxSchemaSize bounds the size of descriptor sets read from a registry.
+const maxSchemaSize = 64 << 20
+
+var (
+	// ErrSchemaNotFound is returned by Registry.Pull for unknown modules and versions.
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrBreakingChanges is returned by Push when the schema breaks the
+	// latest registered version.
+	ErrBreakingChanges = errors.New("schema has breaking changes")
+)
+
+// Registry stores versioned FileDescriptorSets of modules.
+type Registry interface {
+	// Push publishes fdset as version of module.
+	Push(ctx context.Context, module, version string, fdset *descriptorpb.FileDescriptorSet) error
+	// Pull returns the version of module, or LatestVersion. It returns
+	// ErrSchemaNotFound if there is none.
+	Pull(ctx context.Context, module, version string) (*descriptorpb.FileDescriptorSet, error)
+}
+
+// PushOptions configures Push.
+type PushOptions struct {
+	// AllowBreaking publishes the schema even if it breaks the latest version
+	AllowBreaking bool
+}
+
+// Push checks fdset against the latest version of module in reg and
+// publishes it as version unless it has breaking changes. It returns the
+// breaking changes, with ErrBreakingChanges if they prevented the push. The
+// first version of a module is pushed without a check.
+func Push(ctx context.Context, reg Registry, module, version string, fdset *descriptorpb.FileDescriptorSet, opts PushOptions) ([]BreakingChange, error) {
+	latest, err := reg.Pull(ctx, module, LatestVersion)
+	if err != nil && !errors.Is(err, ErrSchemaNotFound) {
+		return nil, fmt.Errorf("failed to pull the latest version of %s: %w", module, err)
+	}
+
+	var changes []BreakingChange
+	if latest != nil {
+		changes = CheckCompatibility(latest, fdset)
+	}
+	if len(changes) > 0 && !opts.AllowBreaking {
+		return changes, fmt.Errorf("%w: %d changes against the latest version of %s", ErrBreakingChanges, len(changes), module)
+	}
+
+	if err := reg.Push(ctx, module, version, fdset); err != nil {
+		return changes, err
+	}
+	return changes, nil
+}
+
+// HTTPRegistry is a Registry on a simple HTTP interface: a version is
+// published with PUT <base>/<module>/<version> and read with GET of the same
+// URL, with the serialized FileDescriptorSet as the body. GET of the
+// "latest" version returns the most recently pushed one, and unknown modules
+// and versions are 404.
+type HTTPRegistry struct {
+	// BaseURL is the URL of the registry, e.g. "https://schemas.example.com/v1"
+	BaseURL string
+	// Token is sent as a bearer token if set
+	Token string
+	// Client sends the requests (default http.DefaultClient)
+	Client *http.Client
+}
+
+// NewHTTPRegistry creates a registry client for baseURL.
+func NewHTTPRegistry(baseURL, token string) *HTTPRegistry {
+	return &HTTPRegistry{BaseURL: baseURL, Token: token}
+}
+
+// Push implements Registry.
+func (r *HTTPRegistry) Push(ctx context.Context, module, version string, fdset *descriptorpb.FileDescriptorSet) error {
+	if version == "" || version == LatestVersion {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdset)
+	if err != nil {
+		return fmt.Errorf("failed to marshal descriptor set: %w", err)
+	}
+
+	resp, err := r.do(ctx, http.MethodPut, module, version, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to push %s %s: %s", module, version, responseError(resp))
+	}
+	return nil
+}
+
+// Pull implements Registry.
+func (r *HTTPRegistry) Pull(ctx context.Context, module, version string) (*descriptorpb.FileDescriptorSet, error) {
+	resp, err := r.do(ctx, http.MethodGet, module, version, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s %s", ErrSchemaNotFound, module, version)
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("failed to pull %s %s: %s", module, version, responseError(resp))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSchemaSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %w", module, version, err)
+	}
+	fdset := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fdset); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set for %s %s: %w", module, version, err)
+	}
+	return fdset, nil
+}
+
+// do sends a request for a version of module.
+func (r *HTTPRegistry) do(ctx context.Context, method, module, version string, body io.Reader) (*http.Response, error) {
+	segments := []string{strings.TrimSuffix(r.BaseURL, "/")}
+	for _, segment := range strings.Split(module, "/") {
+		segments = append(segments, url.PathEscape(segment))
+	}
+	segments = append(segments, url.PathEscape(version))
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.Join(segments, "/"), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Accept", "application/x-protobuf")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// responseError describes a failed registry response.
+func responseError(resp *http.Response) string {
+	const maxMessage = 512
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessage))
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return resp.Status + ": " + message
+	}
+	return resp.Status
+}
+
+// BufRegistry is a Registry on the Buf Schema Registry, driving the buf CLI
+// (https://buf.build/docs/installation), which must be logged in. Modules
+// are named like "buf.build/acme/api" and versions are labels.
+type BufRegistry struct {
+	// Binary is the buf executable (default "buf")
+	Binary string
+	// Exporter writes the pushed modules (default options if nil)
+	Exporter *Exporter
+}
+
+// Push implements Registry by exporting fdset as a buf module and running
+// buf push with version as its label.
+func (r *BufRegistry) Push(ctx context.Context, module, version string, fdset *descriptorpb.FileDescriptorSet) error {
+	exporter := r.Exporter
+	if exporter == nil {
+		opts := DefaultExportOptions()
+		exporter = NewExporter(&opts)
+	}
+	files, err := exporter.ExportBufModule(fdset, BufOptions{Module: module})
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "hyperway-buf-")
+	if err != nil {
+		return fmt.Errorf("failed to create module directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return fmt.Errorf("failed to write module: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write module: %w", err)
+		}
+	}
+
+	_, err = r.run(ctx, dir, "push", "--label", version)
+	return err
+}
+
+// Pull implements Registry by building the module with buf build.
+func (r *BufRegistry) Pull(ctx context.Context, module, version string) (*descriptorpb.FileDescriptorSet, error) {
+	ref := module
+	if version != "" && version != LatestVersion {
+		ref += ":" + version
+	}
+
+	dir, err := os.MkdirTemp("", "hyperway-buf-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	output := filepath.Join(dir, "image.binpb")
+
+	if out, err := r.run(ctx, "", "build", ref, "--as-file-descriptor-set", "-o", output); err != nil {
+		if strings.Contains(out, "not found") || strings.Contains(out, "does not exist") {
+			return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, ref)
+		}
+		return nil, err
+	}
+
+	data, err := os.ReadFile(output) //nolint:gosec // output is in a directory created above
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ref, err)
+	}
+	fdset := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fdset); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set for %s: %w", ref, err)
+	}
+	return fdset, nil
+}
+
+// run runs buf in dir and fails with its output if it exits non-zero.
+func (r *BufRegistry) run(ctx context.Context, dir string, args ...string) (string, error) {
+	binary := r.Binary
+	if binary == "" {
+		binary = "buf"
+	}
+	cmd := exec.CommandContext(ctx, binary, args...) //nolint:gosec // the binary is configured by the caller
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("buf %s failed: %w: %s", args[0], err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
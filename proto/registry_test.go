@@ -0,0 +1,192 @@
+package proto_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/proto"
+)
+
+// testSchema returns a schema with a User message and a UserService, changed
+// by edit.
+func testSchema(edit func(*descriptorpb.FileDescriptorProto)) *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     protobuf.String(name),
+			JsonName: protobuf.String(name),
+			Number:   protobuf.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    protobuf.String("user.v1.proto"),
+		Package: protobuf.String("user.v1"),
+		Syntax:  protobuf.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: protobuf.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("email", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("age", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: protobuf.String("Role"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: protobuf.String("ROLE_UNSPECIFIED"), Number: protobuf.Int32(0)},
+				{Name: protobuf.String("ROLE_ADMIN"), Number: protobuf.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: protobuf.String("UserService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: protobuf.String("GetUser"), InputType: protobuf.String(".user.v1.User"), OutputType: protobuf.String(".user.v1.User")},
+				{Name: protobuf.String("DeleteUser"), InputType: protobuf.String(".user.v1.User"), OutputType: protobuf.String(".user.v1.User")},
+			},
+		}},
+	}
+	if edit != nil {
+		edit(file)
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	previous := testSchema(nil)
+
+	compatible := testSchema(func(file *descriptorpb.FileDescriptorProto) {
+		user := file.MessageType[0]
+		// Removing a field whose number is reserved and adding fields is compatible
+		user.Field = user.Field[:2]
+		user.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{{Start: protobuf.Int32(3), End: protobuf.Int32(4)}}
+		user.Field = append(user.Field, &descriptorpb.FieldDescriptorProto{
+			Name: protobuf.String("name"), JsonName: protobuf.String("name"), Number: protobuf.Int32(4),
+			Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		})
+	})
+	if changes := proto.CheckCompatibility(previous, compatible); len(changes) != 0 {
+		t.Errorf("Expected no breaking changes, got %v", changes)
+	}
+
+	breaking := testSchema(func(file *descriptorpb.FileDescriptorProto) {
+		user := file.MessageType[0]
+		user.Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+		user.Field[1].Name = protobuf.String("mail")
+		user.Field[1].JsonName = protobuf.String("mail")
+		user.Field = user.Field[:2]
+		file.EnumType[0].Value = file.EnumType[0].Value[:1]
+		file.Service[0].Method = file.Service[0].Method[:1]
+		file.Service[0].Method[0].ServerStreaming = protobuf.Bool(true)
+	})
+	var got []string
+	for _, change := range proto.CheckCompatibility(previous, breaking) {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"user.v1.Role.ROLE_ADMIN: value 1 removed without reserving its number",
+		"user.v1.User.age: field 3 removed without reserving its number",
+		"user.v1.User.email: field 2 renamed to mail",
+		"user.v1.User.id: type changed from TYPE_STRING to TYPE_INT64",
+		"user.v1.UserService.DeleteUser: method removed",
+		"user.v1.UserService.GetUser: streaming changed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected breaking changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// newTestRegistry serves the HTTP registry interface from memory.
+func newTestRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	versions := make(map[string][]byte)
+	latest := make(map[string]string)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		i := strings.LastIndex(r.URL.Path, "/")
+		module, version := r.URL.Path[1:i], r.URL.Path[i+1:]
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			if _, ok := versions[module+"@"+version]; ok {
+				http.Error(w, "version exists", http.StatusConflict)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			versions[module+"@"+version] = data
+			latest[module] = version
+		case http.MethodGet:
+			if version == proto.LatestVersion {
+				version = latest[module]
+			}
+			data, ok := versions[module+"@"+version]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPush(t *testing.T) {
+	srv := newTestRegistry(t)
+	reg := proto.NewHTTPRegistry(srv.URL, "secret")
+	ctx := context.Background()
+
+	if _, err := reg.Pull(ctx, "acme/users", proto.LatestVersion); !errors.Is(err, proto.ErrSchemaNotFound) {
+		t.Fatalf("Expected ErrSchemaNotFound, got %v", err)
+	}
+
+	// The first version is pushed without a check
+	if _, err := proto.Push(ctx, reg, "acme/users", "v1.0.0", testSchema(nil), proto.PushOptions{}); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if _, err := proto.Push(ctx, reg, "acme/users", "v1.0.0", testSchema(nil), proto.PushOptions{}); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("Expected a conflict for an existing version, got %v", err)
+	}
+
+	removeMethod := testSchema(func(file *descriptorpb.FileDescriptorProto) {
+		file.Service[0].Method = file.Service[0].Method[:1]
+	})
+	changes, err := proto.Push(ctx, reg, "acme/users", "v1.1.0", removeMethod, proto.PushOptions{})
+	if !errors.Is(err, proto.ErrBreakingChanges) || len(changes) != 1 {
+		t.Fatalf("Expected the breaking push to be rejected, got %v %v", changes, err)
+	}
+	if _, err := proto.Push(ctx, reg, "acme/users", "v2.0.0", removeMethod, proto.PushOptions{AllowBreaking: true}); err != nil {
+		t.Fatalf("Failed to push with AllowBreaking: %v", err)
+	}
+
+	latest, err := reg.Pull(ctx, "acme/users", proto.LatestVersion)
+	if err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if len(latest.File[0].Service[0].Method) != 1 {
+		t.Errorf("Expected the latest version to be v2.0.0, got %v", latest)
+	}
+	if _, err := reg.Pull(ctx, "acme/users", "v1.0.0"); err != nil {
+		t.Errorf("Failed to pull v1.0.0: %v", err)
+	}
+
+	if _, err := proto.NewHTTPRegistry(srv.URL, "").Pull(ctx, "acme/users", "v1.0.0"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error without a token, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+)
+
+// typeResolver resolves the message types of google.protobuf.Any values.
+type typeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// WithMessageTypes adds message types that no method uses to the
+// descriptors of the service, such as the payloads of google.protobuf.Any
+// fields, so gateways can resolve them. types are struct values or pointers,
+// e.g. rpc.WithMessageTypes(OrderCreated{}, OrderCanceled{}).
+func WithMessageTypes(types ...any) ServiceOption {
+	return func(o *ServiceOptions) {
+		for _, t := range types {
+			o.MessageTypes = append(o.MessageTypes, reflect.TypeOf(t))
+		}
+	}
+}
+
+// resolver returns the types resolving the Any values of the service's JSON
+// messages: those of the last gateway serving the service, which include the
+// messages of all its services, or else the types linked into the binary.
+func (s *Service) resolver() typeResolver {
+	if types := s.types.Load(); types != nil {
+		return types
+	}
+	return protoregistry.GlobalTypes
+}
+
+// PackAny packs v into a google.protobuf.Any. v is a protobuf message or a
+// struct message of the service, which is encoded with its descriptor, so
+// that it can be rendered in JSON and unpacked by any client knowing the
+// service's descriptors.
+func (s *Service) PackAny(v any) (*anypb.Any, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return anypb.New(msg)
+	}
+	md, err := s.messageDescriptor(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := reflectutil.StructToProto(v, msg); err != nil {
+		return nil, fmt.Errorf("failed to convert %T to proto: %w", v, err)
+	}
+	return anypb.New(msg)
+}
+
+// UnpackAny unpacks a google.protobuf.Any into target, a pointer to a
+// protobuf message or to a struct message of the service. It fails if the
+// Any holds another type.
+func (s *Service) UnpackAny(a *anypb.Any, target any) error {
+	if msg, ok := target.(proto.Message); ok {
+		return a.UnmarshalTo(msg)
+	}
+	md, err := s.messageDescriptor(reflect.TypeOf(target))
+	if err != nil {
+		return err
+	}
+	if a.MessageName() != md.FullName() {
+		return fmt.Errorf("mismatched message type: got %q, want %q", a.MessageName(), md.FullName())
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(a.GetValue(), msg); err != nil {
+		return err
+	}
+	return reflectutil.ProtoToStruct(msg, target)
+}
+
+// messageDescriptor returns the descriptor of a struct message type, or of
+// the struct it points to.
+func (s *Service) messageDescriptor(t reflect.Type) (protoreflect.MessageDescriptor, error) {
+	if t == nil {
+		return nil, fmt.Errorf("nil message")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct message", t)
+	}
+	return s.builder.BuildMessage(t)
+}
@@ -0,0 +1,106 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type OrderCreated struct {
+	OrderID string `json:"order_id"`
+	Amount  int32  `json:"amount"`
+}
+
+type PublishRequest struct {
+	Event *anypb.Any `json:"event"`
+}
+
+type PublishResponse struct {
+	Echo *anypb.Any `json:"echo"`
+	Note *anypb.Any `json:"note"`
+}
+
+func TestAnyTypeRegistry(t *testing.T) {
+	svc := rpc.NewService("EventService", rpc.WithPackage("events.v1"),
+		rpc.WithProtoJSON(), rpc.WithMessageTypes(OrderCreated{}))
+	rpc.MustRegister(svc, "Publish", func(_ context.Context, req *PublishRequest) (*PublishResponse, error) {
+		var order OrderCreated
+		if err := svc.UnpackAny(req.Event, &order); err != nil {
+			return nil, rpc.NewError(rpc.CodeInvalidArgument, err.Error())
+		}
+		order.Amount *= 2
+		echo, err := svc.PackAny(&order)
+		if err != nil {
+			return nil, err
+		}
+		note, err := svc.PackAny(wrapperspb.String("doubled"))
+		if err != nil {
+			return nil, err
+		}
+		return &PublishResponse{Echo: echo, Note: note}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	exported, err := svc.ExportProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(exported, "message OrderCreated {") {
+		t.Errorf("Expected OrderCreated in the exported proto:\n%s", exported)
+	}
+
+	const body = `{"event":{"@type":"type.googleapis.com/events.v1.OrderCreated","order_id":"o-1","amount":21}}`
+	want := []string{
+		`"echo":{"@type":"type.googleapis.com/events.v1.OrderCreated","order_id":"o-1","amount":42}`,
+		`"note":{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"doubled"}`,
+	}
+	for _, tc := range []struct {
+		name        string
+		contentType string
+	}{
+		{"Connect", "application/json"},
+		{"gRPC-JSON", "application/grpc+json"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := []byte(body)
+			if tc.contentType == "application/grpc+json" {
+				payload = append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/events.v1.EventService/Publish", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("Connect-Protocol-Version", "1")
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+
+			// protojson randomizes its whitespace
+			got := strings.ReplaceAll(rec.Body.String(), " ", "")
+			for _, field := range want {
+				if !strings.Contains(got, field) {
+					t.Errorf("Expected %s in %q (%s)", field, got, rec.Header().Get("Grpc-Message"))
+				}
+			}
+		})
+	}
+
+	t.Run("mismatched type", func(t *testing.T) {
+		a, err := anypb.New(wrapperspb.String("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var order OrderCreated
+		if err := svc.UnpackAny(a, &order); err == nil || !strings.Contains(err.Error(), "mismatched message type") {
+			t.Errorf("Expected a mismatched type error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/i2y/hyperway/codec"
+)
+
+func TestRequestArenaRetain(t *testing.T) {
+	svc := NewService("BulkService", WithPackage("bulk.v1"))
+	var kept []*BulkRequest
+	MustRegister(svc, "Keep", func(ctx context.Context, req *BulkRequest) (*BulkResponse, error) {
+		if req.Labels["keep"] != "" {
+			codec.ArenaFrom(ctx).Retain()
+			kept = append(kept, req)
+		}
+		return &BulkResponse{Count: len(req.Items)}, nil
+	})
+	gw, err := NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	inputCodec, _, err := svc.createCodecs(reflect.TypeOf(BulkRequest{}), reflect.TypeOf(BulkResponse{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(req *BulkRequest) {
+		data, err := codec.NewStructEncoder(inputCodec.Descriptor()).EncodeStruct(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpReq := httptest.NewRequest(http.MethodPost, "/bulk.v1.BulkService/Keep", bytes.NewReader(data))
+		httpReq.Header.Set("Content-Type", "application/proto")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httpReq)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	// Later requests reuse the memory of released arenas, not retained ones
+	call(&BulkRequest{Items: []BulkItem{{SKU: "kept-sku"}}, Labels: map[string]string{"keep": "yes"}, Blob: []byte("kept-blob")})
+	for i := range 32 {
+		call(&BulkRequest{Items: []BulkItem{{SKU: "other-" + strconv.Itoa(i)}}, Blob: []byte("other-blob")})
+	}
+	if len(kept) != 1 {
+		t.Fatalf("Expected 1 kept request, got %d", len(kept))
+	}
+	if req := kept[0]; req.Items[0].SKU != "kept-sku" || string(req.Blob) != "kept-blob" || req.Labels["keep"] != "yes" {
+		t.Errorf("Expected the retained request intact, got %+v", req)
+	}
+}
+
+// BenchmarkDecodeProtobufInput compares decoding request messages into the
+// arena of the request, which the struct references, with copying them out
+// of a released message.
+func BenchmarkDecodeProtobufInput(b *testing.B) {
+	svc := NewService("BenchService", WithPackage("bench.v1"))
+	inputCodec, _, err := svc.createCodecs(reflect.TypeOf(BulkRequest{}), reflect.TypeOf(BulkResponse{}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	req := BulkRequest{Labels: map[string]string{"team": "checkout", "region": "eu-west-1"}, Blob: make([]byte, 256)}
+	for i := range 16 {
+		req.Items = append(req.Items, BulkItem{SKU: "sku-" + strconv.Itoa(i)})
+	}
+	data, err := codec.NewStructEncoder(inputCodec.Descriptor()).EncodeStruct(&req)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hctx := &handlerContext{inputCodec: inputCodec, options: &svc.options}
+
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if err := svc.decodeProtobufToStruct(context.Background(), data, reflect.ValueOf(new(BulkRequest)), hctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("arena", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			hctx.resetArena()
+			if err := svc.decodeProtobufToStruct(hctx.withArena(context.Background()), data, reflect.ValueOf(new(BulkRequest)), hctx); err != nil {
+				b.Fatal(err)
+			}
+			hctx.arena.Release()
+		}
+	})
+}
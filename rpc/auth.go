@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/i2y/hyperway/auth"
+	"github.com/i2y/hyperway/gateway"
+)
+
+// identityContextKey stores the verified identity of the caller.
+const identityContextKey contextKey = "hyperway-identity"
+
+// bearerPrefix is the authorization scheme of bearer tokens.
+const bearerPrefix = "bearer "
+
+// bearerSchemeName names the OpenAPI security scheme of verifiers other than OIDC.
+const bearerSchemeName = "bearerAuth"
+
+// AuthOptions configures the authentication of calls to a service.
+type AuthOptions struct {
+	// Verifier verifies the bearer token of each call, e.g. an
+	// auth.OIDCVerifier. Authentication is disabled without one.
+	Verifier auth.Verifier
+	// PublicMethods can be called without a token, e.g. "Login". JSON-RPC
+	// requests are authenticated before their method is known, so they
+	// always need one unless Optional is set.
+	PublicMethods []string
+	// Optional lets calls without a token through unauthenticated. Calls
+	// with an invalid token are still rejected.
+	Optional bool
+}
+
+// WithAuth requires calls to carry a bearer token in the Authorization
+// header, verified by opts.Verifier before the handler runs. The identity of
+// the caller is available to interceptors and handlers via
+// IdentityFromContext. Rejected tokens fail with CodeUnauthenticated, and
+// tokens that could not be verified, e.g. because the issuer is unreachable,
+// with CodeUnavailable.
+//
+//	verifier, err := auth.NewOIDCVerifier(auth.OIDCConfig{
+//		Issuer:    "https://accounts.google.com",
+//		Audiences: []string{clientID},
+//	})
+//	svc := rpc.NewService("OrderService", rpc.WithAuth(rpc.AuthOptions{Verifier: verifier}))
+func WithAuth(opts AuthOptions) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.Auth = opts
+	}
+}
+
+// IdentityFromContext returns the verified identity of the caller, or false
+// if the call is not authenticated.
+func IdentityFromContext(ctx context.Context) (*auth.Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey).(*auth.Identity)
+	return identity, ok
+}
+
+// authenticate verifies the bearer token of r and returns r with the identity
+// of the caller, or r and the error to report. method is nil for JSON-RPC
+// requests.
+func (s *Service) authenticate(r *http.Request, method *Method) (*http.Request, *Error) {
+	opts := s.options.Auth
+	if opts.Verifier == nil || (method != nil && slices.Contains(opts.PublicMethods, method.Name)) {
+		return r, nil
+	}
+
+	token, ok := bearerToken(r.Header)
+	if !ok {
+		if opts.Optional {
+			return r, nil
+		}
+		return r, NewError(CodeUnauthenticated, "missing bearer token")
+	}
+	identity, err := opts.Verifier.Verify(r.Context(), token)
+	if err != nil {
+		var rpcErr *Error
+		switch {
+		case errors.As(err, &rpcErr):
+			return r, rpcErr
+		case errors.Is(err, auth.ErrUnavailable):
+			return r, NewError(CodeUnavailable, "authentication unavailable")
+		default:
+			return r, NewError(CodeUnauthenticated, err.Error())
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), identityContextKey, identity)), nil
+}
+
+// bearerToken returns the bearer token of the Authorization header.
+func bearerToken(h http.Header) (string, bool) {
+	value := h.Get("Authorization")
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(value[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// writeRequestError writes an error rejecting a request before dispatch, such
+// as an authentication error, in the protocol of the request.
+func (s *Service) writeRequestError(w http.ResponseWriter, r *http.Request, hctx *handlerContext, p protocolInfo, err *Error) {
+	switch {
+	case p.isJSONRPC:
+		s.writeJSONRPCError(w, nil, NewJSONRPCError(err))
+	case p.isGRPC:
+		s.writeGRPCError(w, r, hctx, err)
+	default:
+		s.writeError(w, r, err)
+	}
+}
+
+// openAPISecurity describes the authentication of the service in OpenAPI
+// specs: an OpenID Connect scheme per trusted issuer of OIDC verifiers, or a
+// bearer scheme for other verifiers.
+func (s *Service) openAPISecurity() *gateway.ServiceSecurity {
+	opts := s.options.Auth
+	if opts.Verifier == nil {
+		return nil
+	}
+
+	var issuers []string
+	switch v := opts.Verifier.(type) {
+	case *auth.OIDCVerifier:
+		issuers = v.Issuers()
+	case *auth.OIDCProvider:
+		issuers = []string{v.Issuer()}
+	}
+	schemes := make(map[string]gateway.OpenAPISecurityScheme, max(len(issuers), 1))
+	for _, issuer := range issuers {
+		schemes[oidcSchemeName(issuer)] = gateway.OpenAPISecurityScheme{
+			Type:             "openIdConnect",
+			OpenIDConnectURL: strings.TrimSuffix(issuer, "/") + auth.DiscoveryPath,
+		}
+	}
+	if len(schemes) == 0 {
+		schemes[bearerSchemeName] = gateway.OpenAPISecurityScheme{Type: "http", Scheme: "bearer"}
+	}
+	return &gateway.ServiceSecurity{
+		Schemes:       schemes,
+		PublicMethods: opts.PublicMethods,
+		Optional:      opts.Optional,
+	}
+}
+
+// oidcSchemeName names the OpenAPI security scheme of an issuer after its
+// host and path, e.g. "oidc-accounts.google.com", so services trusting the
+// same issuer share the scheme.
+func oidcSchemeName(issuer string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(issuer, "https://"), "http://")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSuffix(name, "/"))
+	return "oidc-" + name
+}
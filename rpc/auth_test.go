@@ -0,0 +1,171 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/auth"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type SubjectRequest struct{}
+
+type SubjectResponse struct {
+	Subject string `json:"subject"`
+}
+
+// testVerifier accepts "token-<subject>" and reports "down" as unavailable.
+var testVerifier = auth.VerifierFunc(func(_ context.Context, token string) (*auth.Identity, error) {
+	switch {
+	case token == "down":
+		return nil, fmt.Errorf("%w: issuer unreachable", auth.ErrUnavailable)
+	case strings.HasPrefix(token, "token-"):
+		return &auth.Identity{Subject: strings.TrimPrefix(token, "token-")}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown token", auth.ErrInvalidToken)
+	}
+})
+
+func whoAmI(ctx context.Context, _ *SubjectRequest) (*SubjectResponse, error) {
+	identity, ok := rpc.IdentityFromContext(ctx)
+	if !ok {
+		return &SubjectResponse{Subject: "anonymous"}, nil
+	}
+	return &SubjectResponse{Subject: identity.Subject}, nil
+}
+
+func TestAuth(t *testing.T) {
+	newGateway := func(t *testing.T, opts rpc.AuthOptions) http.Handler {
+		t.Helper()
+		opts.Verifier = testVerifier
+		svc := rpc.NewService("AuthService", rpc.WithPackage("auth.v1"), rpc.WithAuth(opts))
+		rpc.MustRegister(svc, "WhoAmI", whoAmI)
+		rpc.MustRegister(svc, "Ping", whoAmI)
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	call := func(gw http.Handler, method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth.v1.AuthService/"+method, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	gw := newGateway(t, rpc.AuthOptions{PublicMethods: []string{"Ping"}})
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		want          string
+	}{
+		{"verified token", "WhoAmI", "Bearer token-alice", `"subject":"alice"`},
+		{"case-insensitive scheme", "WhoAmI", "bearer token-bob", `"subject":"bob"`},
+		{"missing token", "WhoAmI", "", `"code":"unauthenticated"`},
+		{"other scheme", "WhoAmI", "Basic dXNlcjpwYXNz", `"code":"unauthenticated"`},
+		{"invalid token", "WhoAmI", "Bearer forged", "unknown token"},
+		{"verifier unavailable", "WhoAmI", "Bearer down", `"code":"unavailable"`},
+		{"public method", "Ping", "", `"subject":"anonymous"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := call(gw, tt.method, tt.authorization)
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("Expected %s, got %s", tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("optional", func(t *testing.T) {
+		gw := newGateway(t, rpc.AuthOptions{Optional: true})
+		if rec := call(gw, "WhoAmI", ""); !strings.Contains(rec.Body.String(), `"subject":"anonymous"`) {
+			t.Errorf("Expected an anonymous call, got %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := call(gw, "WhoAmI", "Bearer forged"); !strings.Contains(rec.Body.String(), `"code":"unauthenticated"`) {
+			t.Errorf("Expected invalid tokens to be rejected, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth.v1.AuthService/WhoAmI", strings.NewReader("\x00\x00\x00\x00\x02{}"))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Grpc-Status") != "16" {
+			t.Errorf("Expected grpc-status 16, got %d %v", rec.Code, rec.Header())
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		svc := rpc.NewService("AuthService", rpc.WithPackage("auth.v1"),
+			rpc.WithAuth(rpc.AuthOptions{Verifier: testVerifier}))
+		rpc.MustRegisterServerStream(svc, "Watch", func(ctx context.Context, req *SubjectRequest, stream rpc.ServerStream[SubjectResponse]) error {
+			resp, _ := whoAmI(ctx, req)
+			return stream.Send(resp)
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+
+		for _, authorization := range []string{"", "Bearer token-dave"} {
+			req := httptest.NewRequest(http.MethodPost, "/auth.v1.AuthService/Watch", strings.NewReader("\x00\x00\x00\x00\x02{}"))
+			req.Header.Set("Content-Type", "application/connect+json")
+			req.Header.Set("Connect-Protocol-Version", "1")
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+			if authorization == "" && !strings.Contains(rec.Body.String(), "unauthenticated") {
+				t.Errorf("Expected the stream to be rejected, got %q", rec.Body.String())
+			}
+			if authorization != "" && !strings.Contains(rec.Body.String(), `"subject":"dave"`) {
+				t.Errorf("Expected dave, got %q", rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("JSON-RPC", func(t *testing.T) {
+		svc := rpc.NewService("AuthService", rpc.WithPackage("auth.v1"),
+			rpc.WithAuth(rpc.AuthOptions{Verifier: testVerifier}), rpc.WithJSONRPC("/jsonrpc"))
+		rpc.MustRegister(svc, "WhoAmI", whoAmI)
+		body := `{"jsonrpc":"2.0","method":"WhoAmI","params":{},"id":1}`
+
+		for _, authorization := range []string{"", "Bearer token-carol"} {
+			req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			rec := httptest.NewRecorder()
+			svc.JSONRPCHandler().ServeHTTP(rec, req)
+
+			var resp struct {
+				Result *SubjectResponse  `json:"result"`
+				Error  *rpc.JSONRPCError `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Unexpected response %q", rec.Body.String())
+			}
+			if authorization == "" && resp.Error == nil {
+				t.Errorf("Expected an error without a token, got %s", rec.Body.String())
+			}
+			if authorization != "" && (resp.Result == nil || resp.Result.Subject != "carol") {
+				t.Errorf("Expected carol, got %s", rec.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+// clockContextKey stores the Clock of the current call.
+const clockContextKey contextKey = "hyperway-clock"
+
+// Clock tells time for handlers. Handlers that wait or time out through the
+// clock of their context can be tested with a fake clock, see the rpctest
+// package.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel receiving the time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ClockFrom returns the clock of ctx, or the system clock if it has none.
+func ClockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockContextKey).(Clock); ok {
+		return clock
+	}
+	return realClock{}
+}
+
+// ContextWithClock returns a copy of ctx whose ClockFrom returns clock.
+func ContextWithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockContextKey, clock)
+}
@@ -0,0 +1,238 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ShapeItem struct {
+	Name  string `json:"name"`
+	Count int32  `json:"count"`
+}
+
+// Shapes holds the composite field types of the support matrix.
+type Shapes struct {
+	Times         []time.Time              `json:"times"`
+	TimePointers  []*time.Time             `json:"time_pointers"`
+	Durations     []time.Duration          `json:"durations"`
+	Items         []ShapeItem              `json:"items"`
+	ItemPointers  []*ShapeItem             `json:"item_pointers"`
+	ItemsByName   map[string]ShapeItem     `json:"items_by_name"`
+	ItemPointerBy map[string]*ShapeItem    `json:"item_pointer_by"`
+	ItemsByID     map[int64]*ShapeItem     `json:"items_by_id"`
+	TimesByName   map[string]time.Time     `json:"times_by_name"`
+	TimePointerBy map[string]*time.Time    `json:"time_pointer_by"`
+	TTLs          map[string]time.Duration `json:"ttls"`
+	Blobs         [][]byte                 `json:"blobs"`
+	BlobsByName   map[string][]byte        `json:"blobs_by_name"`
+	Labels        *[]string                `json:"labels"`
+	ItemList      *[]ShapeItem             `json:"item_list"`
+	Counts        *map[string]int32        `json:"counts"`
+	Point         [3]int32                 `json:"point"`
+	Corners       [2]ShapeItem             `json:"corners"`
+	Note          *string                  `json:"note"`
+	Flags         map[uint32]bool          `json:"flags"`
+}
+
+func newShapes() *Shapes {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	later := ts.Add(time.Hour)
+	labels := []string{"a", "b"}
+	items := []ShapeItem{{Name: "x", Count: 1}}
+	counts := map[string]int32{"a": 1, "b": 2}
+	note := "n"
+	return &Shapes{
+		Times:         []time.Time{ts, later},
+		TimePointers:  []*time.Time{&ts},
+		Durations:     []time.Duration{time.Second, 1500 * time.Millisecond},
+		Items:         []ShapeItem{{Name: "a", Count: 1}, {Name: "b"}},
+		ItemPointers:  []*ShapeItem{{Name: "p", Count: 2}},
+		ItemsByName:   map[string]ShapeItem{"a": {Name: "a", Count: 3}},
+		ItemPointerBy: map[string]*ShapeItem{"b": {Name: "b", Count: 4}},
+		ItemsByID:     map[int64]*ShapeItem{7: {Name: "seven", Count: 7}},
+		TimesByName:   map[string]time.Time{"start": ts},
+		TimePointerBy: map[string]*time.Time{"end": &later},
+		TTLs:          map[string]time.Duration{"cache": 90 * time.Second},
+		Blobs:         [][]byte{[]byte("x"), []byte("yz")},
+		BlobsByName:   map[string][]byte{"k": []byte("v")},
+		Labels:        &labels,
+		ItemList:      &items,
+		Counts:        &counts,
+		Point:         [3]int32{1, 2, 3},
+		Corners:       [2]ShapeItem{{Name: "nw"}, {Name: "se", Count: 1}},
+		Note:          &note,
+		Flags:         map[uint32]bool{1: true},
+	}
+}
+
+func TestCompositeTypes(t *testing.T) {
+	var received *Shapes
+	svc := rpc.NewService("ShapeService", rpc.WithPackage("shape.v1"))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *Shapes) (*Shapes, error) {
+		received = req
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shape.v1.ShapeService/Echo", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var md protoreflect.MessageDescriptor
+	for _, file := range svc.GetFileDescriptorSet().GetFile() {
+		if file.GetPackage() == "shape.v1" {
+			fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+			if err != nil {
+				t.Fatalf("Failed to build descriptors: %v", err)
+			}
+			md = fd.Messages().ByName("Shapes")
+		}
+	}
+	if md == nil {
+		t.Fatal("Expected a Shapes message")
+	}
+
+	t.Run("descriptors", func(t *testing.T) {
+		for name, want := range map[protoreflect.Name]string{
+			"times":           "repeated google.protobuf.Timestamp",
+			"durations":       "repeated google.protobuf.Duration",
+			"item_pointers":   "repeated shape.v1.ShapeItem",
+			"item_pointer_by": "map<string, shape.v1.ShapeItem>",
+			"items_by_id":     "map<int64, shape.v1.ShapeItem>",
+			"time_pointer_by": "map<string, google.protobuf.Timestamp>",
+			"blobs":           "repeated bytes",
+			"labels":          "repeated string",
+			"item_list":       "repeated shape.v1.ShapeItem",
+			"counts":          "map<string, int32>",
+			"point":           "repeated int32",
+			"corners":         "repeated shape.v1.ShapeItem",
+		} {
+			if got := describeField(md.Fields().ByName(name)); got != want {
+				t.Errorf("%s: expected %s, got %s", name, want, got)
+			}
+		}
+	})
+
+	t.Run("JSON round trip", func(t *testing.T) {
+		body, err := json.Marshal(newShapes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The response is sent back, so both its encoding and decoding are checked
+		for range 2 {
+			rec := call("application/json", body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+			}
+			if want := newShapes(); !reflect.DeepEqual(received, want) {
+				t.Errorf("Expected %+v, got %+v", want, received)
+			}
+			body = rec.Body.Bytes()
+		}
+	})
+
+	t.Run("binary round trip", func(t *testing.T) {
+		data, err := codec.NewStructEncoder(md).EncodeStruct(newShapes())
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		req := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(data, req); err != nil {
+			t.Fatal(err)
+		}
+		if list := req.Get(md.Fields().ByName("point")).List(); list.Len() != 3 || list.Get(2).Int() != 3 {
+			t.Errorf("Expected the array elements, got %v", list)
+		}
+
+		rec := call("application/proto", data)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if want := newShapes(); !reflect.DeepEqual(received, want) {
+			t.Errorf("Expected %+v, got %+v", want, received)
+		}
+		resp := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if !proto.Equal(resp, req) {
+			t.Errorf("Expected %v, got %v", req, resp)
+		}
+	})
+
+	t.Run("nil pointers to slices and maps are empty fields", func(t *testing.T) {
+		if rec := call("application/proto", nil); rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if received.Labels != nil || received.ItemList != nil || received.Counts != nil {
+			t.Errorf("Expected nil pointers, got %+v", received)
+		}
+	})
+
+	t.Run("nested containers are rejected", func(t *testing.T) {
+		type Matrix struct {
+			Rows [][]int32 `json:"rows"`
+		}
+		type TagSets struct {
+			Tags map[string][]string `json:"tags"`
+		}
+		type Records struct {
+			Rows []map[string]string `json:"rows"`
+		}
+		svc := rpc.NewService("NestedService", rpc.WithPackage("nested.v1"))
+		for name, err := range map[string]error{
+			"slices of slices": rpc.Register(svc, "Matrix", func(_ context.Context, _ *Matrix) (*Shapes, error) { return nil, nil }),
+			"maps of slices":   rpc.Register(svc, "TagSets", func(_ context.Context, _ *TagSets) (*Shapes, error) { return nil, nil }),
+			"slices of maps":   rpc.Register(svc, "Records", func(_ context.Context, _ *Records) (*Shapes, error) { return nil, nil }),
+		} {
+			if err == nil || !strings.Contains(err.Error(), "use a struct") {
+				t.Errorf("%s: expected an error suggesting a struct, got %v", name, err)
+			}
+		}
+	})
+}
+
+// describeField describes the type of fd like a .proto field declaration.
+func describeField(fd protoreflect.FieldDescriptor) string {
+	if fd == nil {
+		return "missing"
+	}
+	typeName := func(fd protoreflect.FieldDescriptor) string {
+		if md := fd.Message(); md != nil {
+			return string(md.FullName())
+		}
+		return fd.Kind().String()
+	}
+	switch {
+	case fd.IsMap():
+		return "map<" + typeName(fd.MapKey()) + ", " + typeName(fd.MapValue()) + ">"
+	case fd.IsList():
+		return "repeated " + typeName(fd)
+	case fd.HasPresence() && fd.Message() == nil:
+		return "optional " + typeName(fd)
+	default:
+		return typeName(fd)
+	}
+}
@@ -21,6 +21,14 @@ type Compressor interface {
 	Name() string
 }
 
+// StreamingDecompressor is implemented by compressors that decompress while
+// reading, so that DecompressionLimits reject a payload before it is held in
+// memory. Compressors without it are only used for requests while the
+// decompression limits are disabled.
+type StreamingDecompressor interface {
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
 // compressorRegistry holds registered compressors
 var compressorRegistry = struct {
 	sync.RWMutex
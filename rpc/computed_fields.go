@@ -0,0 +1,152 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// ComputedField fills derived fields of msg, a pointer to the message type it
+// was registered for, before the message is encoded.
+type ComputedField func(ctx context.Context, msg any) error
+
+// WithComputedField registers compute to fill derived fields of messages of
+// type T, such as a display name joined from its parts or a signed URL that
+// must not be cached, right before they are encoded. It applies to the
+// responses and streamed messages of all methods and protocols, including
+// messages of type T nested in them, so handlers don't duplicate
+// presentation logic:
+//
+//	rpc.WithComputedField(func(ctx context.Context, u *User) error {
+//		u.FullName = u.FirstName + " " + u.LastName
+//		return nil
+//	})
+//
+// Nested messages are computed before the messages containing them, and
+// several functions for a type run in registration order. An error fails the
+// call like a handler error.
+func WithComputedField[T any](compute func(ctx context.Context, msg *T) error) ServiceOption {
+	return func(o *ServiceOptions) {
+		if o.ComputedFields == nil {
+			o.ComputedFields = make(map[reflect.Type][]ComputedField)
+		}
+		t := reflect.TypeFor[T]()
+		o.ComputedFields[t] = append(o.ComputedFields[t], func(ctx context.Context, msg any) error {
+			return compute(ctx, msg.(*T))
+		})
+	}
+}
+
+// computedFields applies the computed fields of a service to messages.
+type computedFields struct {
+	fields map[reflect.Type][]ComputedField
+	// reach caches whether values of a type may contain computed messages
+	reach sync.Map // reflect.Type -> bool
+}
+
+// newComputedFields returns the computed fields of fields, or nil without any.
+func newComputedFields(fields map[reflect.Type][]ComputedField) *computedFields {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &computedFields{fields: fields}
+}
+
+// apply computes the fields of msg and the messages nested in it.
+func (c *computedFields) apply(ctx context.Context, msg any) error {
+	if c == nil || msg == nil {
+		return nil
+	}
+	return c.walk(ctx, reflect.ValueOf(msg))
+}
+
+// walk computes the fields of the messages in v, innermost first. Only
+// addressable messages can be computed; struct values in maps are copied
+// and stored back.
+func (c *computedFields) walk(ctx context.Context, v reflect.Value) error {
+	if !c.reaches(v.Type()) {
+		return nil
+	}
+
+	switch v.Kind() { //nolint:exhaustive // Other kinds contain no messages
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return c.walk(ctx, v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if err := c.walk(ctx, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if value.Kind() == reflect.Struct {
+				value = reflect.New(value.Type()).Elem()
+				value.Set(iter.Value())
+			}
+			if err := c.walk(ctx, value); err != nil {
+				return err
+			}
+			if value.CanAddr() {
+				v.SetMapIndex(iter.Key(), value)
+			}
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				if err := c.walk(ctx, v.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+		if !v.CanAddr() {
+			return nil
+		}
+		for _, compute := range c.fields[v.Type()] {
+			if err := compute(ctx, v.Addr().Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reaches reports whether values of t may contain messages with computed
+// fields.
+func (c *computedFields) reaches(t reflect.Type) bool {
+	if reach, ok := c.reach.Load(t); ok {
+		return reach.(bool)
+	}
+	reach := c.search(t, make(map[reflect.Type]bool))
+	c.reach.Store(t, reach)
+	return reach
+}
+
+// search looks for messages with computed fields in t, skipping the types in
+// seen to stop at recursive types.
+func (c *computedFields) search(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	if _, ok := c.fields[t]; ok {
+		return true
+	}
+
+	switch t.Kind() { //nolint:exhaustive // Other kinds contain no messages
+	case reflect.Interface:
+		return true // Depends on the dynamic type
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return c.search(t.Elem(), seen)
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if field := t.Field(i); field.IsExported() && c.search(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type TeamMember struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	FullName  string `json:"full_name"`
+}
+
+type TeamRequest struct {
+	Name string `json:"name"`
+}
+
+type TeamResponse struct {
+	Lead    *TeamMember           `json:"lead"`
+	Members []TeamMember          `json:"members"`
+	ByRole  map[string]TeamMember `json:"by_role"`
+	Summary string                `json:"summary"`
+}
+
+func TestComputedFields(t *testing.T) {
+	svc := rpc.NewService("TeamService", rpc.WithPackage("team.v1"),
+		rpc.WithComputedField(func(_ context.Context, m *TeamMember) error {
+			m.FullName = m.FirstName + " " + m.LastName
+			return nil
+		}),
+		rpc.WithComputedField(func(_ context.Context, r *TeamResponse) error {
+			if r.Lead == nil {
+				return rpc.NewError(rpc.CodeFailedPrecondition, "team has no lead")
+			}
+			// Nested messages are computed first
+			r.Summary = "led by " + r.Lead.FullName
+			return nil
+		}))
+	rpc.MustRegister(svc, "Get", func(_ context.Context, req *TeamRequest) (*TeamResponse, error) {
+		if req.Name == "" {
+			return &TeamResponse{}, nil
+		}
+		return &TeamResponse{
+			Lead:    &TeamMember{FirstName: "Ada", LastName: "Lovelace"},
+			Members: []TeamMember{{FirstName: "Alan", LastName: "Turing"}},
+			ByRole:  map[string]TeamMember{"reviewer": {FirstName: "Grace", LastName: "Hopper"}},
+		}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/team.v1.TeamService/Get", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	want := TeamResponse{
+		Lead:    &TeamMember{FullName: "Ada Lovelace"},
+		Members: []TeamMember{{FullName: "Alan Turing"}},
+		ByRole:  map[string]TeamMember{"reviewer": {FullName: "Grace Hopper"}},
+		Summary: "led by Ada Lovelace",
+	}
+	check := func(t *testing.T, data []byte) {
+		t.Helper()
+		var got TeamResponse
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Failed to decode %s: %v", data, err)
+		}
+		if got.Lead == nil || got.Lead.FullName != want.Lead.FullName ||
+			len(got.Members) != 1 || got.Members[0].FullName != want.Members[0].FullName ||
+			got.ByRole["reviewer"].FullName != want.ByRole["reviewer"].FullName ||
+			got.Summary != want.Summary {
+			t.Errorf("response = %s, want computed fields %+v", data, want)
+		}
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		check(t, call("application/json", []byte(`{"name":"core"}`)).Body.Bytes())
+	})
+
+	t.Run("gRPC-JSON", func(t *testing.T) {
+		body := `{"name":"core"}`
+		rec := call("application/grpc+json", append([]byte{0, 0, 0, 0, byte(len(body))}, body...))
+		if rec.Body.Len() < 5 {
+			t.Fatalf("Expected a response message, got %v", rec.Header())
+		}
+		check(t, rec.Body.Bytes()[5:])
+	})
+
+	t.Run("error fails the call", func(t *testing.T) {
+		rec := call("application/json", []byte(`{}`))
+		if rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "team has no lead") {
+			t.Errorf("Expected the compute error, got %d %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestComputedFieldsStreaming(t *testing.T) {
+	errStop := errors.New("stop")
+	svc := rpc.NewService("TeamService", rpc.WithPackage("team.v1"),
+		rpc.WithComputedField(func(_ context.Context, m *TeamMember) error {
+			if m.FirstName == "" {
+				return errStop
+			}
+			m.FullName = m.FirstName + " " + m.LastName
+			return nil
+		}))
+	rpc.MustRegisterServerStream(svc, "List", func(_ context.Context, _ *TeamRequest, stream rpc.ServerStream[TeamMember]) error {
+		if err := stream.Send(&TeamMember{FirstName: "Ada", LastName: "Lovelace"}); err != nil {
+			return err
+		}
+		if err := stream.Send(&TeamMember{}); !errors.Is(err, errStop) {
+			t.Errorf("Send = %v, want the compute error", err)
+		}
+		return nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/team.v1.TeamService/List", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"full_name":"Ada Lovelace"`) {
+		t.Errorf("Expected the computed field in the stream, got %s", rec.Body)
+	}
+}
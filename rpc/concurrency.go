@@ -0,0 +1,235 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// ConcurrencyLimit is a bulkhead bounding the concurrent calls of each method
+// of a service, so that an expensive method saturating its limit does not
+// starve the others. Calls over the limit wait in a queue for a free slot, or
+// fail with CodeResourceExhausted when the queue is full or the wait ends.
+// Each call of a JSON-RPC batch takes a slot of its own.
+//
+// Unlike LoadSheddingPolicy, which protects the whole service before any
+// work is done, calls are admitted after authentication, so unauthenticated
+// callers cannot fill a method's queue.
+type ConcurrencyLimit struct {
+	// MaxConcurrent is the maximum number of concurrent unary calls of each
+	// method (0 for no limit)
+	MaxConcurrent int
+	// MaxStreams is the maximum number of open streams of each streaming
+	// method (0 for no limit)
+	MaxStreams int
+	// MaxQueued is the maximum number of calls of each method waiting for a
+	// slot (0 rejects calls over the limit immediately)
+	MaxQueued int
+	// QueueTimeout bounds how long a call waits for a slot, in addition to
+	// its deadline (0 waits until the deadline)
+	QueueTimeout time.Duration
+	// OnReject is called when a call is rejected, e.g. to emit metrics.
+	OnReject func(ConcurrencyEvent)
+}
+
+// ConcurrencyEvent describes a call rejected by a concurrency limit.
+type ConcurrencyEvent struct {
+	// Method is the name of the called method.
+	Method string
+	// Limit is the concurrency limit of the method.
+	Limit int
+	// Queued reports whether the call waited in the queue before it was
+	// rejected, i.e. whether the wait timed out or was canceled.
+	Queued bool
+}
+
+// ConcurrencyStats describes the saturation of a method's concurrency limit.
+type ConcurrencyStats struct {
+	// Limit is the maximum number of concurrent calls of the method.
+	Limit int
+	// InFlight is the number of calls being handled.
+	InFlight int64
+	// Queued is the number of calls waiting for a slot.
+	Queued int64
+	// Admitted is the number of calls admitted so far.
+	Admitted int64
+	// Rejected is the number of calls rejected so far.
+	Rejected int64
+}
+
+// WithMaxConcurrency limits each unary method of the service to n concurrent
+// calls, rejecting excess calls with CodeResourceExhausted. Use
+// WithMaxStreamConcurrency to limit streaming methods and WithConcurrencyLimit
+// to queue excess calls.
+func WithMaxConcurrency(n int) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ConcurrencyLimit.MaxConcurrent = n
+	}
+}
+
+// WithMaxStreamConcurrency limits each streaming method of the service to n
+// open streams, rejecting excess streams with CodeResourceExhausted.
+func WithMaxStreamConcurrency(n int) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ConcurrencyLimit.MaxStreams = n
+	}
+}
+
+// WithConcurrencyLimit sets the concurrency limits of the service's methods.
+func WithConcurrencyLimit(limit ConcurrencyLimit) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ConcurrencyLimit = limit
+	}
+}
+
+// WithMaxConcurrency overrides the concurrency limit of the service for the
+// method: n concurrent calls, or open streams of a streaming method, or no
+// limit if n is 0. Queueing follows the service's ConcurrencyLimit.
+func (m *MethodBuilder) WithMaxConcurrency(n int) *MethodBuilder {
+	m.method.Options.MaxConcurrency = &n
+	return m
+}
+
+// bulkhead bounds the concurrent calls of a method.
+type bulkhead struct {
+	slots    chan struct{}
+	queued   atomic.Int64
+	admitted atomic.Int64
+	rejected atomic.Int64
+}
+
+// concurrencyLimit returns the concurrency limit of method, 0 for none.
+func (s *Service) concurrencyLimit(method *Method) int {
+	if method.Options.MaxConcurrency != nil {
+		return *method.Options.MaxConcurrency
+	}
+	if method.StreamType != StreamTypeUnary {
+		return s.options.ConcurrencyLimit.MaxStreams
+	}
+	return s.options.ConcurrencyLimit.MaxConcurrent
+}
+
+// bulkheadFor returns the bulkhead of method, or nil if it has no limit.
+func (s *Service) bulkheadFor(method *Method) *bulkhead {
+	if b, ok := s.bulkheads.Load(method.Name); ok {
+		return b.(*bulkhead)
+	}
+	limit := s.concurrencyLimit(method)
+	if limit <= 0 {
+		return nil
+	}
+	b, _ := s.bulkheads.LoadOrStore(method.Name, &bulkhead{slots: make(chan struct{}, limit)})
+	return b.(*bulkhead)
+}
+
+// acquire waits for a slot for a call of method within the queue bounds. It
+// returns a function releasing the slot, or an error if the call is rejected.
+func (s *Service) acquire(ctx context.Context, method *Method) (func(), *Error) {
+	b := s.bulkheadFor(method)
+	if b == nil {
+		return func() {}, nil
+	}
+	release := func() { <-b.slots }
+
+	select {
+	case b.slots <- struct{}{}:
+		b.admitted.Add(1)
+		s.observeQueueLatency(0)
+		return release, nil
+	default:
+	}
+
+	limit := &s.options.ConcurrencyLimit
+	queued := false
+	if limit.MaxQueued > 0 {
+		if b.queued.Add(1) <= int64(limit.MaxQueued) {
+			queued = true
+			start := time.Now()
+			admitted := b.wait(ctx, limit.QueueTimeout)
+			s.observeQueueLatency(time.Since(start))
+			if admitted {
+				b.queued.Add(-1)
+				b.admitted.Add(1)
+				return release, nil
+			}
+		}
+		b.queued.Add(-1)
+	}
+
+	b.rejected.Add(1)
+	if limit.OnReject != nil {
+		limit.OnReject(ConcurrencyEvent{Method: method.Name, Limit: cap(b.slots), Queued: queued})
+	}
+	return nil, NewError(CodeResourceExhausted,
+		fmt.Sprintf("too many concurrent calls of %s, try again later", method.Name))
+}
+
+// observeQueueLatency records the time a call waited for a slot, for adaptive
+// load shedding.
+func (s *Service) observeQueueLatency(latency time.Duration) {
+	if s.options.LoadShedding.MaxQueueLatency > 0 {
+		s.queueLatency.observe(latency)
+	}
+}
+
+// wait waits for a free slot until ctx is done or timeout elapses, and
+// reports whether it got one.
+func (b *bulkhead) wait(ctx context.Context, timeout time.Duration) bool {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-expired:
+		return false
+	}
+}
+
+// ConcurrencyStats reports the saturation of the concurrency limit of each
+// limited method, by method name.
+func (s *Service) ConcurrencyStats() map[string]ConcurrencyStats {
+	stats := make(map[string]ConcurrencyStats)
+	for name, method := range s.methods {
+		if b := s.bulkheadFor(method); b != nil {
+			stats[name] = b.stats()
+		}
+	}
+	return stats
+}
+
+// stats returns the current statistics of the bulkhead.
+func (b *bulkhead) stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		Limit:    cap(b.slots),
+		InFlight: int64(len(b.slots)),
+		Queued:   b.queued.Load(),
+		Admitted: b.admitted.Load(),
+		Rejected: b.rejected.Load(),
+	}
+}
+
+// debugConcurrency reports the concurrency limit of method for the debug
+// endpoints, or nil if it has none.
+func (s *Service) debugConcurrency(method *Method) *gateway.DebugConcurrency {
+	b := s.bulkheadFor(method)
+	if b == nil {
+		return nil
+	}
+	stats := b.stats()
+	return &gateway.DebugConcurrency{
+		Limit:    stats.Limit,
+		InFlight: stats.InFlight,
+		Queued:   stats.Queued,
+		Admitted: stats.Admitted,
+		Rejected: stats.Rejected,
+	}
+}
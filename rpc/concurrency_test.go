@@ -0,0 +1,139 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ReportRequest struct {
+	Block bool `json:"block"`
+}
+
+type ReportResponse struct {
+	OK bool `json:"ok"`
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var events []rpc.ConcurrencyEvent
+	started, unblock := make(chan struct{}, 4), make(chan struct{})
+	block := func(req *ReportRequest) {
+		if req.Block {
+			started <- struct{}{}
+			<-unblock
+		}
+	}
+	svc := rpc.NewService("ReportService", rpc.WithPackage("report.v1"),
+		rpc.WithConcurrencyLimit(rpc.ConcurrencyLimit{
+			MaxConcurrent: 1,
+			MaxStreams:    1,
+			MaxQueued:     1,
+			QueueTimeout:  50 * time.Millisecond,
+			OnReject: func(e rpc.ConcurrencyEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, e)
+			},
+		}))
+	rpc.MustRegister(svc, "Build", func(_ context.Context, req *ReportRequest) (*ReportResponse, error) {
+		block(req)
+		return &ReportResponse{OK: true}, nil
+	})
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Preview", func(_ context.Context, req *ReportRequest) (*ReportResponse, error) {
+		block(req)
+		return &ReportResponse{OK: true}, nil
+	}).WithMaxConcurrency(0))
+	rpc.MustRegisterServerStream(svc, "Watch", func(_ context.Context, req *ReportRequest, stream rpc.ServerStream[ReportResponse]) error {
+		block(req)
+		return stream.Send(&ReportResponse{OK: true})
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(method, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/report.v1.ReportService/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Occupy the only slot of Build and Watch
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		call("Build", "application/json", `{"block":true}`)
+	}()
+	go func() {
+		defer wg.Done()
+		call("Watch", "application/connect+json", string(connectEnvelope([]byte(`{"block":true}`))))
+	}()
+	<-started
+	<-started
+
+	// Waits in the queue until the timeout, then is rejected
+	rec := call("Build", "application/json", `{}`)
+	if !strings.Contains(rec.Body.String(), `"code":"resource_exhausted"`) {
+		t.Errorf("Expected a resource exhausted error, got %s", rec.Body)
+	}
+
+	// Streams have a limit of their own
+	rec = call("Watch", "application/connect+json", string(connectEnvelope([]byte(`{}`))))
+	if !strings.Contains(rec.Body.String(), `"resource_exhausted"`) {
+		t.Errorf("Expected the stream to be rejected, got %q", rec.Body)
+	}
+
+	// The method override lifts the limit
+	rec = call("Preview", "application/json", `{}`)
+	if !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Errorf("Expected Preview to succeed, got %s", rec.Body)
+	}
+
+	stats := svc.ConcurrencyStats()
+	if got := stats["Build"]; got.Limit != 1 || got.InFlight != 1 || got.Admitted != 1 || got.Rejected != 1 {
+		t.Errorf("Unexpected Build stats: %+v", got)
+	}
+	if _, ok := stats["Preview"]; ok {
+		t.Error("Expected no stats for Preview, which has no limit")
+	}
+
+	// A queued call is admitted when the slot is released
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() { queued <- call("Build", "application/json", `{}`) }()
+	waitFor(t, func() bool { return svc.ConcurrencyStats()["Build"].Queued == 1 })
+	close(unblock)
+	rec = <-queued
+	if !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Errorf("Expected the queued call to succeed, got %s", rec.Body)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0].Method != "Build" || !events[0].Queued || events[1].Method != "Watch" {
+		t.Errorf("Unexpected reject events: %+v", events)
+	}
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,210 @@
+package rpc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Idempotency is the idempotency level of a method, as in the
+// idempotency_level option of protobuf methods.
+type Idempotency int
+
+const (
+	// IdempotencyUnknown is the default level: calls may have side effects.
+	IdempotencyUnknown Idempotency = iota
+	// IdempotencyNoSideEffects marks methods that only read, such as Get and
+	// List methods. They accept Connect GET requests.
+	IdempotencyNoSideEffects
+	// IdempotencyIdempotent marks methods whose repeated calls have the
+	// effect of a single call.
+	IdempotencyIdempotent
+)
+
+// String returns the name of the level in protobuf descriptors.
+func (i Idempotency) String() string {
+	return i.descriptorLevel().String()
+}
+
+// descriptorLevel returns the idempotency_level option value of i.
+func (i Idempotency) descriptorLevel() descriptorpb.MethodOptions_IdempotencyLevel {
+	switch i {
+	case IdempotencyNoSideEffects:
+		return descriptorpb.MethodOptions_NO_SIDE_EFFECTS
+	case IdempotencyIdempotent:
+		return descriptorpb.MethodOptions_IDEMPOTENT
+	default:
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+}
+
+// descriptorIdempotency returns the idempotency of the method md.
+func descriptorIdempotency(md protoreflect.MethodDescriptor) Idempotency {
+	options, _ := md.Options().(*descriptorpb.MethodOptions)
+	switch options.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		return IdempotencyNoSideEffects
+	case descriptorpb.MethodOptions_IDEMPOTENT:
+		return IdempotencyIdempotent
+	default:
+		return IdempotencyUnknown
+	}
+}
+
+// WithIdempotency sets the idempotency level of the method, exported as the
+// idempotency_level option of its descriptor. Unary methods without side
+// effects are also served to Connect GET requests, which carry the message
+// in the query string so that browsers and CDNs can cache them:
+//
+//	GET /user.v1.UserService/GetUser?connect=v1&encoding=json&message=%7B%22id%22%3A%2242%22%7D
+func (m *MethodBuilder) WithIdempotency(level Idempotency) *MethodBuilder {
+	m.method.Options.Idempotency = level
+	return m
+}
+
+// WithETags sends strong ETags with the responses of unary methods without
+// side effects, and answers requests whose If-None-Match header lists the
+// ETag of the response with 304 Not Modified and no body, saving polling
+// clients the download. ETags hash the encoded response before compression,
+// with the content encoding as a suffix, so they change with the content
+// type but responses still revalidate across encodings. Connect and plain
+// HTTP requests get ETags, gRPC and gRPC-Web requests don't.
+func WithETags(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ETags = enabled
+	}
+}
+
+// WithETags overrides whether responses of the method get ETags, e.g. to
+// enable them for an idempotent method only called with POSTs.
+func (m *MethodBuilder) WithETags(enabled bool) *MethodBuilder {
+	m.method.Options.ETags = &enabled
+	return m
+}
+
+// etags reports whether responses of method get ETags.
+func (s *Service) etags(method *Method) bool {
+	if method.Options.ETags != nil {
+		return *method.Options.ETags
+	}
+	return s.options.ETags && method.Options.Idempotency == IdempotencyNoSideEffects
+}
+
+// acceptsConnectGet reports whether method is served to Connect GET requests.
+func acceptsConnectGet(method *Method) bool {
+	return method.StreamType == StreamTypeUnary && method.Options.Idempotency == IdempotencyNoSideEffects
+}
+
+// connectGetRequest converts a Connect GET request to the POST it stands
+// for, with the message of the query string as its body. Other requests,
+// and GETs of methods with side effects, are returned as they are.
+func connectGetRequest(r *http.Request, method *Method) (*http.Request, *Error) {
+	if r.Method != http.MethodGet || !acceptsConnectGet(method) {
+		return r, nil
+	}
+	query := r.URL.Query()
+	if version := query.Get("connect"); version != "" && version != "v1" {
+		return r, NewErrorf(CodeInvalidArgument, "unsupported connect version %q", version)
+	}
+
+	var contentType string
+	switch encoding := query.Get("encoding"); encoding {
+	case "json":
+		contentType = "application/json"
+	case "proto":
+		contentType = "application/proto"
+	case "":
+		return r, NewError(CodeInvalidArgument, "missing encoding query parameter")
+	default:
+		return r, NewErrorf(CodeInvalidArgument, "unsupported encoding %q", encoding)
+	}
+
+	message := []byte(query.Get("message"))
+	if query.Get("base64") == "1" {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(message), "="))
+		if err != nil {
+			return r, NewErrorf(CodeInvalidArgument, "invalid base64 message: %v", err)
+		}
+		message = decoded
+	}
+
+	post := r.Clone(r.Context())
+	post.Header.Set("Content-Type", contentType)
+	post.Header.Set("Connect-Protocol-Version", "1")
+	post.Header.Del("Content-Encoding")
+	if compression := query.Get("compression"); compression != "" {
+		post.Header.Set("Content-Encoding", compression)
+	}
+	post.Body = io.NopCloser(bytes.NewReader(message))
+	post.ContentLength = int64(len(message))
+	return post, nil
+}
+
+// isConnectGet reports whether r is a Connect GET request of method, as
+// converted by connectGetRequest.
+func isConnectGet(r *http.Request, p protocolInfo, method *Method) bool {
+	return r.Method == http.MethodGet && p.isConnect && acceptsConnectGet(method)
+}
+
+// writeResponseBody writes the encoded response data, compressed if the
+// client accepts it. With ETags enabled, it sets the ETag of data, and
+// writes 304 Not Modified without a body if the request already has it.
+func (s *Service) writeResponseBody(w http.ResponseWriter, r *http.Request, data []byte, ctx *handlerContext, canCompress bool) {
+	p := detectProtocol(r)
+	if !s.etags(ctx.method) || p.isGRPC || p.isGRPCWeb {
+		_, _ = w.Write(s.maybeCompress(data, w, canCompress))
+		return
+	}
+
+	tag := entityTag(w.Header().Get("Content-Type"), data)
+	// The encoding is chosen first, so that 304 responses carry the ETag a
+	// 200 would have
+	data = s.maybeCompress(data, w, canCompress)
+	// Strong ETags identify the bytes sent, so they differ by encoding
+	etag := tag
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+		etag += "-" + encoding
+	}
+	w.Header().Set("ETag", `"`+etag+`"`)
+	if ifNoneMatch(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// entityTag returns the opaque tag of a response of contentType with data,
+// without quotes.
+func entityTag(contentType string, data []byte) string {
+	hash := sha256.New()
+	_, _ = io.WriteString(hash, contentType)
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches tag,
+// comparing tags weakly as RFC 9110 requires, and ignoring the content
+// encoding suffix writeResponseBody adds.
+func ifNoneMatch(header, tag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`)
+		if base, _, _ := strings.Cut(candidate, "-"); base == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type GetQuoteRequest struct {
+	Symbol string `json:"symbol"`
+}
+
+type GetQuoteResponse struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+func TestConnectGetAndETags(t *testing.T) {
+	price := 101.5
+	getQuote := func(_ context.Context, req *GetQuoteRequest) (*GetQuoteResponse, error) {
+		return &GetQuoteResponse{Symbol: req.Symbol, Price: price}, nil
+	}
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"), rpc.WithETags(true))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewMethod("GetQuote", getQuote).WithIdempotency(rpc.IdempotencyNoSideEffects),
+		rpc.NewMethod("RefreshQuote", getQuote).WithIdempotency(rpc.IdempotencyIdempotent).WithETags(true),
+		rpc.NewMethod("PlaceQuote", getQuote),
+	)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	get := func(method, query string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/quote.v1.QuoteService/"+method+"?"+query, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(method string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/quote.v1.QuoteService/"+method, strings.NewReader(`{"symbol":"ACME"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	jsonQuery := "connect=v1&encoding=json&message=" + url.QueryEscape(`{"symbol":"ACME"}`)
+
+	t.Run("methods without side effects accept Connect GET", func(t *testing.T) {
+		rec := get("GetQuote", jsonQuery, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp GetQuoteResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Symbol != "ACME" {
+			t.Errorf("Unexpected response %s (%v)", rec.Body, err)
+		}
+
+		base64Query := "encoding=json&base64=1&message=" + base64.RawURLEncoding.EncodeToString([]byte(`{"symbol":"ACME"}`))
+		if rec := get("GetQuote", base64Query, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ACME") {
+			t.Errorf("Expected base64 message to be decoded, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("other methods reject GET", func(t *testing.T) {
+		for _, method := range []string{"RefreshQuote", "PlaceQuote"} {
+			if rec := get(method, jsonQuery, nil); rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s: expected 405, got %d", method, rec.Code)
+			}
+		}
+	})
+
+	t.Run("invalid queries fail with invalid_argument", func(t *testing.T) {
+		for _, query := range []string{"message=%7B%7D", "encoding=xml&message=%7B%7D", "encoding=proto&base64=1&message=!!"} {
+			rec := get("GetQuote", query, nil)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_argument") {
+				t.Errorf("%s: expected invalid_argument, got %d: %s", query, rec.Code, rec.Body)
+			}
+		}
+	})
+
+	t.Run("matching If-None-Match gets 304", func(t *testing.T) {
+		rec := get("GetQuote", jsonQuery, nil)
+		etag := rec.Header().Get("ETag")
+		if !strings.HasPrefix(etag, `"`) {
+			t.Fatalf("Expected a strong ETag, got %q", etag)
+		}
+
+		rec = get("GetQuote", jsonQuery, http.Header{"If-None-Match": {`"other", ` + etag}})
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("Expected 304 without body, got %d: %s", rec.Code, rec.Body)
+		}
+		if rec.Header().Get("ETag") != etag {
+			t.Errorf("Expected ETag %s, got %s", etag, rec.Header().Get("ETag"))
+		}
+
+		price = 102
+		defer func() { price = 101.5 }()
+		rec = get("GetQuote", jsonQuery, http.Header{"If-None-Match": {etag}})
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Errorf("Expected changed response with new ETag, got %d %s", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("304 carries the ETag of the compressed response", func(t *testing.T) {
+		query := "encoding=json&message=" + url.QueryEscape(`{"symbol":"`+strings.Repeat("A", 2048)+`"}`)
+		rec := get("GetQuote", query, http.Header{"Accept-Encoding": {"gzip"}})
+		etag := rec.Header().Get("ETag")
+		if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasSuffix(etag, `-gzip"`) {
+			t.Fatalf("Expected a gzip response with a gzip ETag, got %q %s", rec.Header().Get("Content-Encoding"), etag)
+		}
+		identityTag := get("GetQuote", query, nil).Header().Get("ETag")
+
+		// Tags of either encoding revalidate, and get the tag of this one
+		for _, match := range []string{etag, identityTag} {
+			rec := get("GetQuote", query, http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {match}})
+			if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != etag {
+				t.Errorf("If-None-Match %s: expected 304 with ETag %s, got %d %s", match, etag, rec.Code, rec.Header().Get("ETag"))
+			}
+			if rec.Header().Get("Content-Encoding") != "" {
+				t.Errorf("Expected no Content-Encoding without a body, got %q", rec.Header().Get("Content-Encoding"))
+			}
+		}
+		rec = get("GetQuote", query, http.Header{"If-None-Match": {etag}})
+		if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != identityTag {
+			t.Errorf("Expected 304 with ETag %s, got %d %s", identityTag, rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("ETags differ by codec", func(t *testing.T) {
+		jsonTag := get("GetQuote", jsonQuery, nil).Header().Get("ETag")
+		protoQuery := "encoding=proto&base64=1&message=" + base64.RawURLEncoding.EncodeToString([]byte("\x0a\x04ACME"))
+		rec := get("GetQuote", protoQuery, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/proto" {
+			t.Fatalf("Expected proto response, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if protoTag := rec.Header().Get("ETag"); jsonTag == protoTag {
+			t.Errorf("Expected different ETags for JSON and proto, got %s", jsonTag)
+		}
+		if post("GetQuote", nil).Header().Get("ETag") != jsonTag {
+			t.Error("Expected POST and GET to share the ETag of the same response")
+		}
+	})
+
+	t.Run("method option enables ETags for POSTs", func(t *testing.T) {
+		etag := post("RefreshQuote", nil).Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("Expected an ETag")
+		}
+		if rec := post("RefreshQuote", http.Header{"If-None-Match": {"W/" + etag}}); rec.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for weak comparison, got %d", rec.Code)
+		}
+		if rec := post("PlaceQuote", nil); rec.Header().Get("ETag") != "" {
+			t.Errorf("Expected no ETag for methods with side effects, got %s", rec.Header().Get("ETag"))
+		}
+	})
+}
+
+func TestIdempotencyDescriptor(t *testing.T) {
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewMethod("GetQuote", func(_ context.Context, req *GetQuoteRequest) (*GetQuoteResponse, error) {
+			return &GetQuoteResponse{Symbol: req.Symbol}, nil
+		}).WithIdempotency(rpc.IdempotencyNoSideEffects),
+	)
+	fds := svc.GetFileDescriptorSet()
+	for _, file := range fds.GetFile() {
+		for _, service := range file.GetService() {
+			for _, method := range service.GetMethod() {
+				if method.GetOptions().GetIdempotencyLevel() != descriptorpb.MethodOptions_NO_SIDE_EFFECTS {
+					t.Errorf("Expected NO_SIDE_EFFECTS, got %v", method.GetOptions().GetIdempotencyLevel())
+				}
+				return
+			}
+		}
+	}
+	t.Fatal("Method not found in descriptors")
+}
@@ -0,0 +1,209 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// Timeout headers
+const (
+	grpcTimeoutHeader    = "Grpc-Timeout"
+	connectTimeoutHeader = "Connect-Timeout-Ms"
+	// maxGRPCTimeoutValue is the largest grpc-timeout value (eight digits).
+	maxGRPCTimeoutValue = 99999999
+	// maxConnectTimeoutDigits is the maximum length of a Connect-Timeout-Ms value.
+	maxConnectTimeoutDigits = 10
+)
+
+// Sources of call timeouts
+const (
+	timeoutSourceClient = "client"
+	timeoutSourceServer = "server"
+)
+
+// deadlineErrorDomain is the domain of the ErrorInfo of exceeded deadlines.
+const deadlineErrorDomain = "hyperway"
+
+// callTimeoutContextKey stores the callTimeout of a call.
+const callTimeoutContextKey contextKey = "hyperway-call-timeout"
+
+// callTimeout describes the timeout of a call, to report the elapsed time
+// once its deadline is exceeded.
+type callTimeout struct {
+	start   time.Time
+	timeout time.Duration
+	source  string
+}
+
+// grpcTimeoutUnits are the units of grpc-timeout values, from the finest.
+var grpcTimeoutUnits = []struct {
+	unit   time.Duration
+	suffix string
+}{
+	{time.Nanosecond, "n"},
+	{time.Microsecond, "u"},
+	{time.Millisecond, "m"},
+	{time.Second, "S"},
+	{time.Minute, "M"},
+	{time.Hour, "H"},
+}
+
+// Deadline returns the deadline of the current call and whether it has one.
+// Within a handler, it reflects the caller's grpc-timeout or
+// Connect-Timeout-Ms header, or an earlier deadline set by the server.
+func Deadline(ctx context.Context) (time.Time, bool) {
+	return ctx.Deadline()
+}
+
+// methodTimeout returns the timeout of procedure in the service config, 0 for
+// none.
+func (s *Service) methodTimeout(procedure string) time.Duration {
+	mc := findMethodConfig(s.serviceConfig, procedure)
+	if mc == nil || mc.Timeout == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(mc.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0
+	}
+	return timeout
+}
+
+// withCallTimeout returns ctx with the deadline of a call: the sooner of the
+// caller's timeout and the method's timeout on the server, 0 meaning none. The
+// cancel function is nil if the call has no deadline.
+func withCallTimeout(ctx context.Context, clientTimeout, serverTimeout time.Duration) (context.Context, context.CancelFunc) {
+	t := callTimeout{start: time.Now(), timeout: clientTimeout, source: timeoutSourceClient}
+	if serverTimeout > 0 && (clientTimeout <= 0 || serverTimeout < clientTimeout) {
+		t.timeout, t.source = serverTimeout, timeoutSourceServer
+	}
+	if t.timeout <= 0 {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	return context.WithValue(ctx, callTimeoutContextKey, t), cancel
+}
+
+// callDeadlineError returns a CodeDeadlineExceeded error reporting the elapsed
+// time if the deadline of the call passed, or nil. The error carries a
+// google.rpc.ErrorInfo detail with the elapsed time, the timeout, and whether
+// the client or the server set it.
+func callDeadlineError(ctx context.Context) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	t, ok := ctx.Value(callTimeoutContextKey).(callTimeout)
+	if !ok {
+		return nil
+	}
+	elapsed := time.Since(t.start)
+	message := fmt.Sprintf("deadline exceeded after %v (%s timeout %v)", elapsed.Round(time.Millisecond), t.source, t.timeout)
+	return NewErrorWithDetails(CodeDeadlineExceeded, message).AddAnyDetail(&errdetails.ErrorInfo{
+		Reason: "DEADLINE_EXCEEDED",
+		Domain: deadlineErrorDomain,
+		Metadata: map[string]string{
+			"elapsed":        elapsed.String(),
+			"timeout":        t.timeout.String(),
+			"timeout_source": t.source,
+		},
+	})
+}
+
+// NewDeadlineTransport returns a transport that forwards the remaining time
+// of the request context to the called service, so the calls a handler makes
+// downstream don't outlive the budget of its own caller. gRPC and gRPC-Web
+// requests get a grpc-timeout header and other requests a Connect-Timeout-Ms
+// header. An existing header is only replaced if the deadline is sooner.
+// Requests whose deadline already passed fail with context.DeadlineExceeded
+// without being sent. base defaults to http.DefaultTransport.
+//
+//	client := &http.Client{Transport: rpc.NewDeadlineTransport(nil)}
+//	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+//	resp, err := client.Do(req) // inherits the deadline of ctx
+func NewDeadlineTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &deadlineTransport{base: base}
+}
+
+// deadlineTransport sets timeout headers from request deadlines.
+type deadlineTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	if err := SetTimeoutHeader(req.Header, remaining); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// SetTimeoutHeader sets the timeout header of an outgoing call from the
+// remaining time, unless header already has a shorter timeout. The protocol
+// is taken from the Content-Type header, which must be set first. Timeouts
+// that round down to zero fail with context.DeadlineExceeded.
+func SetTimeoutHeader(header http.Header, remaining time.Duration) error {
+	if strings.HasPrefix(header.Get("Content-Type"), "application/grpc") {
+		if current, err := parseGRPCTimeout(header.Get(grpcTimeoutHeader)); err == nil && current > 0 && current <= remaining {
+			return nil
+		}
+		value, ok := encodeGRPCTimeout(remaining)
+		if !ok {
+			return context.DeadlineExceeded
+		}
+		header.Set(grpcTimeoutHeader, value)
+		return nil
+	}
+
+	if current, err := strconv.ParseInt(header.Get(connectTimeoutHeader), 10, 64); err == nil && current > 0 &&
+		time.Duration(current)*time.Millisecond <= remaining {
+		return nil
+	}
+	ms := remaining.Milliseconds()
+	if ms <= 0 {
+		return context.DeadlineExceeded
+	}
+	value := strconv.FormatInt(ms, 10)
+	if len(value) > maxConnectTimeoutDigits {
+		// Longer than the protocol allows, equivalent to no timeout
+		header.Del(connectTimeoutHeader)
+		return nil
+	}
+	header.Set(connectTimeoutHeader, value)
+	return nil
+}
+
+// encodeGRPCTimeout encodes a timeout in the grpc-timeout format with the
+// finest unit that fits in eight digits. The timeout is rounded down, so the
+// callee never gets more time than remains.
+func encodeGRPCTimeout(timeout time.Duration) (string, bool) {
+	if timeout <= 0 {
+		return "", false
+	}
+	for _, u := range grpcTimeoutUnits {
+		if value := int64(timeout / u.unit); value <= maxGRPCTimeoutValue {
+			return strconv.FormatInt(value, 10) + u.suffix, true
+		}
+	}
+	return strconv.Itoa(maxGRPCTimeoutValue) + "H", true
+}
@@ -0,0 +1,242 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type BudgetRequest struct {
+	BackendURL string `json:"backend_url"`
+}
+
+type BudgetResponse struct {
+	RemainingMs int64 `json:"remaining_ms"`
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	svc := rpc.NewService("BudgetService", rpc.WithPackage("budget.v1"))
+	// Backend reports the remaining time of its call
+	rpc.MustRegister(svc, "Remaining", func(ctx context.Context, _ *BudgetRequest) (*BudgetResponse, error) {
+		deadline, ok := rpc.Deadline(ctx)
+		if !ok {
+			return &BudgetResponse{RemainingMs: -1}, nil
+		}
+		return &BudgetResponse{RemainingMs: time.Until(deadline).Milliseconds()}, nil
+	})
+	// Frontend calls the backend with its own context
+	rpc.MustRegister(svc, "Forward", func(ctx context.Context, req *BudgetRequest) (*BudgetResponse, error) {
+		client := &http.Client{Transport: rpc.NewDeadlineTransport(nil)}
+		return callRemaining(ctx, client, req.BackendURL, nil)
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+
+	t.Run("forwards the remaining budget", func(t *testing.T) {
+		resp, err := callRemaining(context.Background(), http.DefaultClient, server.URL+"/budget.v1.BudgetService/Forward",
+			http.Header{"Connect-Timeout-Ms": {"1500"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.RemainingMs <= 0 || resp.RemainingMs > 1500 {
+			t.Errorf("Expected the backend to get at most 1500ms, got %dms", resp.RemainingMs)
+		}
+	})
+
+	t.Run("applies grpc-timeout", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			server.URL+"/budget.v1.BudgetService/Remaining", strings.NewReader("\x00\x00\x00\x00\x02{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/grpc+json")
+		req.Header.Set("Grpc-Timeout", "2S")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+
+		// gRPC-JSON encodes int64 fields as strings
+		var out struct {
+			RemainingMs int64 `json:"remaining_ms,string"`
+		}
+		if len(body) < 5 || json.Unmarshal(body[5:], &out) != nil {
+			t.Fatalf("Unexpected response %q", body)
+		}
+		if out.RemainingMs <= 0 || out.RemainingMs > 2000 {
+			t.Errorf("Expected the handler to get at most 2000ms, got %dms", out.RemainingMs)
+		}
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		resp, err := callRemaining(context.Background(), http.DefaultClient, server.URL+"/budget.v1.BudgetService/Forward", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.RemainingMs != -1 {
+			t.Errorf("Expected no backend deadline, got %dms", resp.RemainingMs)
+		}
+	})
+
+	t.Run("expired deadline", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		client := &http.Client{Transport: rpc.NewDeadlineTransport(nil)}
+		_, err := callRemaining(ctx, client, server.URL+"/budget.v1.BudgetService/Remaining", nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	})
+}
+
+// callRemaining calls the Connect JSON endpoint at url with the backend URL as request.
+func callRemaining(ctx context.Context, client *http.Client, url string, header http.Header) (*BudgetResponse, error) {
+	backendURL := strings.Replace(url, "/Forward", "/Remaining", 1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url,
+		strings.NewReader(`{"backend_url":"`+backendURL+`"}`))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var out BudgetResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("unexpected response %q: %w", body, err)
+	}
+	return &out, nil
+}
+
+func TestServerTimeouts(t *testing.T) {
+	svc := rpc.NewService("BudgetService", rpc.WithPackage("budget.v1"), rpc.WithServiceConfig(`{
+		"methodConfig": [{"name": [{"service": "budget.v1.BudgetService", "method": "Wait"}], "timeout": "50ms"}]
+	}`))
+	rpc.MustRegister(svc, "Wait", func(ctx context.Context, _ *BudgetRequest) (*BudgetResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	rpc.MustRegister(svc, "Late", func(ctx context.Context, _ *BudgetRequest) (*BudgetResponse, error) {
+		time.Sleep(30 * time.Millisecond)
+		return &BudgetResponse{}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(method string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/budget.v1.BudgetService/"+method, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for name, tt := range map[string]struct {
+		header http.Header
+		want   string
+	}{
+		"without a client deadline":      {nil, "(server timeout 50ms)"},
+		"with a longer client deadline":  {http.Header{"Connect-Timeout-Ms": {"5000"}}, "(server timeout 50ms)"},
+		"with a shorter client deadline": {http.Header{"Connect-Timeout-Ms": {"20"}}, "(client timeout 20ms)"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			rec := call("Wait", tt.header)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the call to be cut short, took %v", elapsed)
+			}
+			body := rec.Body.String()
+			if rec.Code != http.StatusGatewayTimeout || !strings.Contains(body, `"code":"deadline_exceeded"`) || !strings.Contains(body, tt.want) {
+				t.Errorf("Expected a deadline exceeded error ending with %q, got %d: %s", tt.want, rec.Code, body)
+			}
+			if !strings.Contains(body, `"type":"google.rpc.ErrorInfo"`) || !strings.Contains(body, `"elapsed"`) {
+				t.Errorf("Expected an ErrorInfo detail with the elapsed time, got %s", body)
+			}
+		})
+	}
+
+	t.Run("late responses fail", func(t *testing.T) {
+		if rec := call("Late", http.Header{"Connect-Timeout-Ms": {"10"}}); !strings.Contains(rec.Body.String(), `"code":"deadline_exceeded"`) {
+			t.Errorf("Expected a response past the deadline to fail, got %s", rec.Body)
+		}
+		if rec := call("Late", nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected methods without a timeout to succeed, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("invalid timeouts are rejected", func(t *testing.T) {
+		if _, err := rpc.ParseServiceConfig(`{"methodConfig": [{"name": [{"service": "a.B"}], "timeout": "soon"}]}`); err == nil {
+			t.Error("Expected an invalid timeout to be rejected")
+		}
+	})
+}
+
+func TestSetTimeoutHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		existing    string
+		remaining   time.Duration
+		header      string
+		want        string
+	}{
+		{"gRPC milliseconds", "application/grpc", "", 1500 * time.Millisecond, "Grpc-Timeout", "1500000u"},
+		{"gRPC minutes", "application/grpc+proto", "", 200000 * time.Hour, "Grpc-Timeout", "12000000M"},
+		{"gRPC-Web", "application/grpc-web+proto", "", 2 * time.Second, "Grpc-Timeout", "2000000u"},
+		{"gRPC shorter existing", "application/grpc", "1S", time.Minute, "Grpc-Timeout", "1S"},
+		{"gRPC longer existing", "application/grpc", "1H", time.Second, "Grpc-Timeout", "1000000u"},
+		{"Connect", "application/json", "", 1500 * time.Millisecond, "Connect-Timeout-Ms", "1500"},
+		{"Connect longer existing", "application/proto", "60000", time.Second, "Connect-Timeout-Ms", "1000"},
+		{"Connect shorter existing", "application/connect+proto", "10", time.Second, "Connect-Timeout-Ms", "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Content-Type": {tt.contentType}}
+			if tt.existing != "" {
+				header.Set(tt.header, tt.existing)
+			}
+			if err := rpc.SetTimeoutHeader(header, tt.remaining); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := header.Get(tt.header); got != tt.want {
+				t.Errorf("Expected %s %q, got %q", tt.header, tt.want, got)
+			}
+		})
+	}
+
+	// A budget that rounds down to zero cannot be forwarded
+	header := http.Header{"Content-Type": {"application/json"}}
+	if err := rpc.SetTimeoutHeader(header, time.Microsecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
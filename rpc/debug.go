@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/gateway"
+)
+
+// trackStream counts a stream of method as active until the returned
+// function is called.
+func (s *Service) trackStream(method string) func() {
+	counter, _ := s.activeStreams.LoadOrStore(method, new(atomic.Int64))
+	active := counter.(*atomic.Int64)
+	active.Add(1)
+	return func() { active.Add(-1) }
+}
+
+// debugInfo reports the methods, codecs, and active streams of the service
+// for the gateway debug endpoints.
+func (s *Service) debugInfo() *gateway.ServiceDebugInfo {
+	info := &gateway.ServiceDebugInfo{
+		Methods: make([]gateway.DebugMethod, 0, len(s.methods)),
+	}
+	codecs := make(map[string]int) // message name -> index in info.Codecs
+	for _, method := range s.methods {
+		entry := gateway.DebugMethod{
+			Name:       method.Name,
+			Path:       fmt.Sprintf("/%s.%s/%s", s.packageName, s.name, method.Name),
+			StreamType: method.StreamType.String(),
+			InputType:  s.messageTypeName(method.ProtoInput, method.InputType),
+			OutputType: s.messageTypeName(method.ProtoOutput, method.OutputType),
+		}
+		s.debugInterceptors(&entry, method)
+		if counter, ok := s.activeStreams.Load(method.Name); ok {
+			entry.ActiveStreams = counter.(*atomic.Int64).Load()
+		}
+		entry.Concurrency = s.debugConcurrency(method)
+		info.Methods = append(info.Methods, entry)
+
+		// Codecs are created with the handlers, so only served methods have
+		// any. Methods sharing a message have a codec each, so they are merged.
+		if hctx, ok := s.cachedHandlerContext(method.Name); ok {
+			for _, c := range []*codec.Codec{hctx.inputCodec, hctx.outputCodec} {
+				if c == nil {
+					continue
+				}
+				stats := c.Stats()
+				if i, ok := codecs[stats.Message]; ok {
+					mergeCodecStats(&info.Codecs[i], stats)
+					continue
+				}
+				codecs[stats.Message] = len(info.Codecs)
+				info.Codecs = append(info.Codecs, stats)
+			}
+		}
+	}
+	sort.Slice(info.Methods, func(i, j int) bool {
+		return info.Methods[i].Name < info.Methods[j].Name
+	})
+	sort.Slice(info.Codecs, func(i, j int) bool {
+		return info.Codecs[i].Message < info.Codecs[j].Message
+	})
+	return info
+}
+
+// mergeCodecStats adds the counters of other to stats. Percentiles cannot be
+// merged, so the higher ones are kept.
+func mergeCodecStats(stats *codec.Stats, other codec.Stats) {
+	stats.Decodes += other.Decodes
+	stats.Bytes += other.Bytes
+	stats.Sampled += other.Sampled
+	stats.ArenaAllocs += other.ArenaAllocs
+	stats.Drifts += other.Drifts
+	stats.P50 = max(stats.P50, other.P50)
+	stats.P90 = max(stats.P90, other.P90)
+	stats.P99 = max(stats.P99, other.P99)
+}
+
+// messageTypeName returns the full protobuf name of a message type.
+func (s *Service) messageTypeName(msg proto.Message, t reflect.Type) string {
+	if msg != nil {
+		return string(msg.ProtoReflect().Descriptor().FullName())
+	}
+	desc, err := s.builder.BuildMessage(t)
+	if err != nil {
+		return t.String()
+	}
+	return string(desc.FullName())
+}
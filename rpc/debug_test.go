@@ -0,0 +1,180 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type InspectRequest struct {
+	Name string `json:"name"`
+}
+
+type InspectResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	svc := rpc.NewService("InspectService", rpc.WithPackage("inspect.v1"),
+		rpc.WithInterceptors(&rpc.RecoveryInterceptor{}))
+	rpc.MustRegister(svc, "Greet", func(_ context.Context, req *InspectRequest) (*InspectResponse, error) {
+		return &InspectResponse{Greeting: "hello " + req.Name}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "Watch", func(ctx context.Context, _ *InspectRequest, _ rpc.ServerStream[InspectResponse]) error {
+		close(started)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{EnableDebug: true}, svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	get := func(t *testing.T, path string) map[string]any {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/debug/hyperway" + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d %s", resp.StatusCode, body)
+		}
+		var v map[string]any
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", body, err)
+		}
+		return v
+	}
+
+	// Serve a protobuf call, so the request codec decodes a message
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		server.URL+"/inspect.v1.InspectService/Greet", strings.NewReader("\x0a\x05debug"))
+	req.Header.Set("Content-Type", "application/proto")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	t.Run("services", func(t *testing.T) {
+		services := get(t, "/services")["services"].([]any)
+		if len(services) != 1 {
+			t.Fatalf("Expected 1 service, got %v", services)
+		}
+		methods := services[0].(map[string]any)["methods"].([]any)
+		if len(methods) != 2 {
+			t.Fatalf("Expected 2 methods, got %v", methods)
+		}
+		greet := methods[0].(map[string]any)
+		if greet["path"] != "/inspect.v1.InspectService/Greet" || greet["stream_type"] != "unary" ||
+			greet["input_type"] != "inspect.v1.InspectRequest" {
+			t.Errorf("Unexpected method %v", greet)
+		}
+		if interceptors := greet["interceptors"].([]any); len(interceptors) != 1 || interceptors[0] != "*rpc.RecoveryInterceptor" {
+			t.Errorf("Unexpected interceptors %v", interceptors)
+		}
+		if watch := methods[1].(map[string]any); watch["stream_type"] != "server_stream" {
+			t.Errorf("Unexpected method %v", watch)
+		}
+	})
+
+	t.Run("descriptors", func(t *testing.T) {
+		if files := get(t, "/descriptors?service=inspect.v1.InspectService")["file"].([]any); len(files) == 0 {
+			t.Error("Expected descriptors of the service")
+		}
+	})
+
+	t.Run("codecs", func(t *testing.T) {
+		codecs := get(t, "/codecs")["codecs"].(map[string]any)["inspect.v1.InspectService"].([]any)
+		var decodes float64
+		for _, c := range codecs {
+			if c := c.(map[string]any); c["message"] == "inspect.v1.InspectRequest" {
+				decodes = c["decodes"].(float64)
+			}
+		}
+		if decodes < 1 {
+			t.Errorf("Expected the request codec to count decodes, got %v", codecs)
+		}
+	})
+
+	t.Run("pgo", func(t *testing.T) {
+		if _, ok := get(t, "/pgo")["generation"]; !ok {
+			t.Error("Expected the PGO generation")
+		}
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost,
+				server.URL+"/inspect.v1.InspectService/Watch", bytes.NewReader(connectEnvelope([]byte(`{}`))))
+			req.Header.Set("Content-Type", "application/connect+json")
+			req.Header.Set("Connect-Protocol-Version", "1")
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+		}()
+		<-started
+
+		if total := get(t, "/streams")["total"]; total != float64(1) {
+			t.Errorf("Expected 1 active stream, got %v", total)
+		}
+		close(release)
+		<-done
+		if total := get(t, "/streams")["total"]; total != float64(0) {
+			t.Errorf("Expected no active streams, got %v", total)
+		}
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		remote := httptest.NewRequest(http.MethodGet, "/debug/hyperway/services", http.NoBody)
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, remote)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected remote clients to be rejected, got %d", rec.Code)
+		}
+
+		gw, err := rpc.NewGatewayWithOptions(gateway.Options{
+			EnableDebug: true,
+			DebugAuthorizer: func(r *http.Request) error {
+				if r.Header.Get("X-Admin-Token") != "secret" {
+					return errors.New("admin token required")
+				}
+				return nil
+			},
+		}, svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		for token, want := range map[string]int{"": http.StatusForbidden, "secret": http.StatusOK} {
+			req := httptest.NewRequest(http.MethodGet, "/debug/hyperway/services", http.NoBody)
+			req.Header.Set("X-Admin-Token", token)
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+			if rec.Code != want {
+				t.Errorf("Token %q: expected %d, got %d", token, want, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultMaxDecompressedSize is the default limit of decompressed messages,
+// the default maximum message size of gRPC.
+const defaultMaxDecompressedSize = 4 << 20
+
+// defaultMaxDecompressionRatio is the default limit of the expansion of
+// compressed messages. Real payloads rarely compress better than 1:20, while
+// gzip bombs reach 1:1000.
+const defaultMaxDecompressionRatio = 256
+
+// minRatioCheckedSize is the decompressed size from which the ratio is
+// checked, so that small, highly repetitive messages are never rejected.
+const minRatioCheckedSize = 64 << 10
+
+// DecompressionLimitReason identifies the limit a compressed request exceeded.
+type DecompressionLimitReason string
+
+const (
+	// DecompressionLimitSize means the decompressed size exceeded MaxSize.
+	DecompressionLimitSize DecompressionLimitReason = "max_size"
+	// DecompressionLimitRatio means the payload expanded by more than MaxRatio.
+	DecompressionLimitRatio DecompressionLimitReason = "max_ratio"
+)
+
+// errDecompressionLimit stops reading a decompressed payload over a limit.
+var errDecompressionLimit = errors.New("decompression limit exceeded")
+
+// DecompressionLimits bounds the memory taken by compressed requests, so that
+// a small compressed payload cannot expand into gigabytes. Requests over a
+// limit fail with CodeResourceExhausted.
+//
+// The limits apply to compressed unary and streaming requests of all
+// protocols, whether the body or the enveloped message is compressed.
+// Registered compressors must implement StreamingDecompressor to be used
+// while limits are set, since payloads are checked as they decompress.
+type DecompressionLimits struct {
+	// MaxSize is the maximum size of a decompressed message or body in bytes
+	// (default 4 MiB, negative for no limit)
+	MaxSize int64
+	// MaxRatio is the maximum ratio of the decompressed to the compressed
+	// size (default 256, negative for no limit). It is checked once a
+	// payload decompresses to more than 64 KiB.
+	MaxRatio float64
+	// OnExceeded is called when a request is rejected, e.g. to emit metrics.
+	OnExceeded func(DecompressionLimitEvent)
+}
+
+// DecompressionLimitEvent describes a rejected compressed request.
+type DecompressionLimitEvent struct {
+	// Method is the name of the called method.
+	Method string
+	// Reason is the limit that was exceeded.
+	Reason DecompressionLimitReason
+	// Encoding is the compression of the payload, e.g. "gzip".
+	Encoding string
+	// Compressed is the number of compressed bytes read.
+	Compressed int64
+	// Decompressed is the number of bytes decompressed before the payload
+	// was rejected.
+	Decompressed int64
+}
+
+// WithDecompressionLimits bounds the size and expansion of decompressed requests.
+func WithDecompressionLimits(limits DecompressionLimits) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.DecompressionLimits = limits
+	}
+}
+
+// maxDecompressedSize returns the configured limit, or -1 for none.
+func (l DecompressionLimits) maxDecompressedSize() int64 {
+	switch {
+	case l.MaxSize == 0:
+		return defaultMaxDecompressedSize
+	case l.MaxSize < 0:
+		return -1
+	default:
+		return l.MaxSize
+	}
+}
+
+// maxRatio returns the configured ratio, or -1 for none.
+func (l DecompressionLimits) maxRatio() float64 {
+	switch {
+	case l.MaxRatio == 0:
+		return defaultMaxDecompressionRatio
+	case l.MaxRatio < 0:
+		return -1
+	default:
+		return l.MaxRatio
+	}
+}
+
+// check returns the limit exceeded by a payload of compressed bytes that
+// decompressed to decompressed bytes so far, if any.
+func (l DecompressionLimits) check(compressed, decompressed int64) DecompressionLimitReason {
+	if limit := l.maxDecompressedSize(); limit >= 0 && decompressed > limit {
+		return DecompressionLimitSize
+	}
+	if ratio := l.maxRatio(); ratio >= 0 && decompressed > minRatioCheckedSize &&
+		float64(decompressed) > ratio*float64(max(compressed, 1)) {
+		return DecompressionLimitRatio
+	}
+	return ""
+}
+
+// exceeded reports a rejected payload to OnExceeded and returns its error.
+func (l DecompressionLimits) exceeded(event DecompressionLimitEvent) error {
+	if l.OnExceeded != nil {
+		l.OnExceeded(event)
+	}
+	if event.Reason == DecompressionLimitRatio {
+		return NewErrorf(CodeResourceExhausted, "compressed message expands more than %g times", l.maxRatio())
+	}
+	return NewErrorf(CodeResourceExhausted, "decompressed message exceeds %d bytes", l.maxDecompressedSize())
+}
+
+// readDecompressed reads and decompresses r, compressed with encoding, for
+// method. Payloads are decompressed while reading and checked against the
+// limits after every read, so a payload is rejected before it is held in
+// memory. Compressors that are not StreamingDecompressors are rejected unless
+// the limits are disabled.
+func (l DecompressionLimits) readDecompressed(method, encoding string, r io.Reader) ([]byte, error) {
+	in := &countingReader{r: r}
+	event := DecompressionLimitEvent{Method: method, Encoding: encoding}
+
+	if encoding != CompressionGzip {
+		compressor, ok := GetCompressor(encoding)
+		if !ok {
+			return nil, NewErrorf(CodeUnimplemented, "unsupported compression %q", encoding)
+		}
+		streaming, ok := compressor.(StreamingDecompressor)
+		if !ok {
+			return l.decompressAll(encoding, compressor, in)
+		}
+		dr, err := streaming.NewReader(in)
+		if err != nil {
+			return nil, NewErrorf(CodeInvalidArgument, "%s decompress: %v", encoding, err)
+		}
+		defer func() { _ = dr.Close() }()
+		return l.readLimited(dr, in, encoding, event)
+	}
+
+	gz := gzipReaderPool.Get().(*gzip.Reader)
+	defer gzipReaderPool.Put(gz)
+	if err := gz.Reset(in); err != nil {
+		return nil, NewErrorf(CodeInvalidArgument, "gzip decompress reset: %v", err)
+	}
+	return l.readLimited(gz, in, encoding, event)
+}
+
+// readLimited reads the payload decompressed by r from in until it exceeds
+// the limits.
+func (l DecompressionLimits) readLimited(r io.Reader, in *countingReader, encoding string, event DecompressionLimitEvent) ([]byte, error) {
+	out := &limitedDecompressor{r: r, in: in, limits: l}
+	data, err := io.ReadAll(out)
+	if errors.Is(err, errDecompressionLimit) {
+		event.Reason, event.Compressed, event.Decompressed = out.reason, in.n, out.n
+		return nil, l.exceeded(event)
+	}
+	if err != nil {
+		return nil, NewErrorf(CodeInvalidArgument, "%s decompress read: %v", encoding, err)
+	}
+	return data, nil
+}
+
+// decompressAll decompresses a payload at once with a compressor that cannot
+// decompress while reading, which is only bounded without limits.
+func (l DecompressionLimits) decompressAll(encoding string, compressor Compressor, in io.Reader) ([]byte, error) {
+	if l.maxDecompressedSize() >= 0 || l.maxRatio() >= 0 {
+		return nil, NewErrorf(CodeUnimplemented,
+			"compression %q cannot be decompressed within the decompression limits", encoding)
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compressed message: %w", err)
+	}
+	decompressed, err := compressor.Decompress(data)
+	if err != nil {
+		return nil, NewErrorf(CodeInvalidArgument, "%s decompress: %v", encoding, err)
+	}
+	return decompressed, nil
+}
+
+// decompress decompresses a message compressed with encoding for method.
+func (l DecompressionLimits) decompress(method, encoding string, data []byte) ([]byte, error) {
+	return l.readDecompressed(method, encoding, bytes.NewReader(data))
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedDecompressor reads decompressed bytes from r until they exceed the
+// limits for the compressed bytes read from in.
+type limitedDecompressor struct {
+	r      io.Reader
+	in     *countingReader
+	limits DecompressionLimits
+	n      int64
+	reason DecompressionLimitReason
+}
+
+func (d *limitedDecompressor) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	if d.reason = d.limits.check(d.in.n, d.n); d.reason != "" {
+		return n, errDecompressionLimit
+	}
+	return n, err
+}
+
+// messageEncoding returns the compression of enveloped messages with the
+// compressed flag: Connect-Content-Encoding for Connect streams and
+// grpc-encoding for gRPC and gRPC-Web, which default to gzip.
+func messageEncoding(r *http.Request, p protocolInfo) string {
+	if p.isConnect {
+		return r.Header.Get("Connect-Content-Encoding")
+	}
+	if encoding := r.Header.Get("Grpc-Encoding"); encoding != "" {
+		return encoding
+	}
+	return CompressionGzip
+}
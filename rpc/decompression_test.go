@@ -0,0 +1,186 @@
+package rpc_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// deflateCompressor is a compressor registered for the tests, which only
+// decompresses whole payloads.
+type deflateCompressor struct{ name string }
+
+func (c *deflateCompressor) Name() string { return c.name }
+
+func (c *deflateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	err := w.Close()
+	return buf.Bytes(), err
+}
+
+func (c *deflateCompressor) Decompress(data []byte) ([]byte, error) {
+	return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+// streamingDeflateCompressor also decompresses while reading.
+type streamingDeflateCompressor struct{ deflateCompressor }
+
+func (c *streamingDeflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type ArchiveRequest struct {
+	Data string `json:"data"`
+}
+
+type ArchiveResponse struct {
+	Size int `json:"size"`
+}
+
+func TestDecompressionLimits(t *testing.T) {
+	streaming := &streamingDeflateCompressor{deflateCompressor{name: "deflate-test"}}
+	buffered := &deflateCompressor{name: "deflate-test-buffered"}
+	rpc.RegisterCompressor(streaming)
+	rpc.RegisterCompressor(buffered)
+	deflate := func(data []byte) []byte {
+		compressed, err := streaming.Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compressed
+	}
+
+	var events []rpc.DecompressionLimitEvent
+	svc := rpc.NewService("ArchiveService", rpc.WithPackage("archive.v1"),
+		rpc.WithDecompressionLimits(rpc.DecompressionLimits{
+			MaxSize:    1 << 20,
+			OnExceeded: func(e rpc.DecompressionLimitEvent) { events = append(events, e) },
+		}))
+	rpc.MustRegister(svc, "Store", func(_ context.Context, req *ArchiveRequest) (*ArchiveResponse, error) {
+		return &ArchiveResponse{Size: len(req.Data)}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	// A small body, a body over MaxSize, and a body under MaxSize that
+	// expands by far more than the default ratio
+	small := []byte(`{"data":"hello"}`)
+	huge := []byte(`{"data":"` + strings.Repeat("a", 2<<20) + `"}`)
+	bomb := []byte(`{"data":"` + strings.Repeat("a", 512<<10) + `"}`)
+	grpcFrame := func(message []byte) []byte {
+		frame := connectEnvelope(gzipBytes(t, message))
+		frame[0] = 1 // compressed
+		return frame
+	}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		headers map[string]string
+		want    string
+		reason  rpc.DecompressionLimitReason
+		// encoding is the encoding of the event, gzip by default
+		encoding string
+	}{
+		{
+			name:    "Connect compressed body",
+			body:    gzipBytes(t, small),
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "gzip"},
+			want:    `"size":5`,
+		},
+		{
+			name:    "Connect body over the size limit",
+			body:    gzipBytes(t, huge),
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "gzip"},
+			want:    "resource_exhausted",
+			reason:  rpc.DecompressionLimitSize,
+		},
+		{
+			name:    "Connect body over the ratio limit",
+			body:    gzipBytes(t, bomb),
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "gzip"},
+			want:    "resource_exhausted",
+			reason:  rpc.DecompressionLimitRatio,
+		},
+		{
+			name:    "unsupported encoding",
+			body:    small,
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "br"},
+			want:    "unimplemented",
+		},
+		{
+			name:    "streaming compressor",
+			body:    deflate(small),
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "deflate-test"},
+			want:    `"size":5`,
+		},
+		{
+			name:     "streaming compressor over the ratio limit",
+			body:     deflate(bomb),
+			headers:  map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "deflate-test"},
+			want:     "resource_exhausted",
+			reason:   rpc.DecompressionLimitRatio,
+			encoding: "deflate-test",
+		},
+		{
+			name:    "buffered compressor with limits",
+			body:    deflate(small),
+			headers: map[string]string{"Content-Type": "application/json", "Connect-Protocol-Version": "1", "Content-Encoding": "deflate-test-buffered"},
+			want:    "unimplemented",
+		},
+		{
+			name:    "gRPC message over the ratio limit",
+			body:    grpcFrame(bomb),
+			headers: map[string]string{"Content-Type": "application/grpc+json", "Grpc-Encoding": "gzip"},
+			reason:  rpc.DecompressionLimitRatio,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events = nil
+			req := httptest.NewRequest(http.MethodPost, "/archive.v1.ArchiveService/Store", bytes.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("Expected %s, got %s", tt.want, rec.Body.String())
+			}
+			if strings.HasPrefix(tt.headers["Content-Type"], "application/grpc") && rec.Header().Get("Grpc-Status") != "8" {
+				t.Errorf("Expected grpc-status 8, got %v", rec.Header())
+			}
+			if tt.reason == "" {
+				if len(events) != 0 {
+					t.Errorf("Expected no events, got %+v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("Expected one event, got %+v", events)
+			}
+			encoding := tt.encoding
+			if encoding == "" {
+				encoding = "gzip"
+			}
+			e := events[0]
+			if e.Method != "Store" || e.Reason != tt.reason || e.Encoding != encoding || e.Compressed == 0 || e.Decompressed <= e.Compressed {
+				t.Errorf("Unexpected event %+v", e)
+			}
+		})
+	}
+}
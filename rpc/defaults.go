@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// Fields tagged `default:"..."` get their default when a request leaves them
+// unset: pointer fields when they are nil, and other fields when they hold
+// the zero value, since an explicit zero cannot be told apart from an
+// omitted field with implicit presence. Defaults are applied to the request
+// message and the messages nested in it, after decoding and before
+// validation, whatever the protocol.
+
+// defaultsPlan locates the fields with defaults within a struct type.
+type defaultsPlan struct {
+	fields []fieldDefault  // Fields of the struct with a default
+	nested []nestedDefault // Fields holding messages with defaults
+}
+
+// fieldDefault is a field with a default value.
+type fieldDefault struct {
+	index   int
+	value   reflect.Value // Of the element type for pointer fields
+	pointer bool
+}
+
+// nestedDefault is a field holding messages, directly or in a slice or map,
+// that have fields with defaults.
+type nestedDefault struct {
+	index int
+	plan  *defaultsPlan
+}
+
+// defaultsPlans caches the plans of types, nil for types without defaults.
+var defaultsPlans sync.Map // map[reflect.Type]*defaultsPlan
+
+// defaultsPlanOf returns the plan of struct type t, or nil if no field of its
+// messages has a default.
+func defaultsPlanOf(t reflect.Type) *defaultsPlan {
+	if p, ok := defaultsPlans.Load(t); ok {
+		return p.(*defaultsPlan) //nolint:forcetypeassert // Only plans are stored
+	}
+	p := buildDefaultsPlan(t, make(map[reflect.Type]*defaultsPlan))
+	defaultsPlans.Store(t, p)
+	return p
+}
+
+// buildDefaultsPlan builds the plan of the messages held by values of t.
+// visiting holds the plans of the types being built, so recursive types
+// refer to their own plan.
+func buildDefaultsPlan(t reflect.Type, visiting map[reflect.Type]*defaultsPlan) *defaultsPlan {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || schema.IsTimeType(t) {
+		return nil
+	}
+	if p, ok := visiting[t]; ok {
+		return p
+	}
+
+	p := &defaultsPlan{}
+	visiting[t] = p
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() || strings.HasPrefix(f.Tag.Get("json"), "-") {
+			continue
+		}
+		if tag := f.Tag.Get("default"); tag != "" {
+			// The schema builder rejects defaults that do not fit their field
+			if value, err := schema.ParseDefault(f.Type, tag); err == nil {
+				p.fields = append(p.fields, fieldDefault{index: i, value: value, pointer: f.Type.Kind() == reflect.Ptr})
+			}
+			continue
+		}
+		if nested := buildDefaultsPlan(f.Type, visiting); nested != nil {
+			p.nested = append(p.nested, nestedDefault{index: i, plan: nested})
+		}
+	}
+	delete(visiting, t)
+	if len(p.fields) == 0 && len(p.nested) == 0 {
+		return nil
+	}
+	return p
+}
+
+// apply sets the unset fields of struct v, and of the messages it holds, to
+// their defaults.
+func (p *defaultsPlan) apply(v reflect.Value) {
+	for _, f := range p.fields {
+		field := v.Field(f.index)
+		switch {
+		case f.pointer && field.IsNil():
+			ptr := reflect.New(f.value.Type())
+			ptr.Elem().Set(f.value)
+			field.Set(ptr)
+		case !f.pointer && field.IsZero():
+			field.Set(f.value)
+		}
+	}
+	for _, n := range p.nested {
+		n.plan.applyTo(v.Field(n.index))
+	}
+}
+
+// applyTo applies the plan to the messages held by v: a struct, a pointer to
+// one, or a slice or map of them.
+func (p *defaultsPlan) applyTo(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			p.applyTo(v.Elem())
+		}
+	case reflect.Struct:
+		p.apply(v)
+	case reflect.Slice:
+		for i := range v.Len() {
+			p.applyTo(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if iter.Value().Kind() == reflect.Ptr {
+				p.applyTo(iter.Value())
+				continue
+			}
+			// Map values are not addressable, so messages are updated in a copy
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			p.applyTo(value)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	default:
+	}
+}
+
+// applyDefaults sets the unset fields of a decoded struct request to the
+// values of their default tags.
+func applyDefaults(inputVal reflect.Value, ctx *handlerContext) {
+	if ctx.useProtoInput && ctx.method.ProtoInput != nil {
+		return // Protobuf messages report the defaults of their descriptors
+	}
+	if p := defaultsPlanOf(inputVal.Type()); p != nil {
+		p.applyTo(inputVal)
+	}
+}
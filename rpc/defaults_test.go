@@ -0,0 +1,112 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type SearchFilter struct {
+	Field string `json:"field"`
+	Op    string `json:"op" default:"eq"`
+}
+
+type SearchRequest struct {
+	Query    string                  `json:"query"`
+	PageSize int32                   `json:"page_size" default:"20"`
+	Exact    *bool                   `json:"exact" default:"true"`
+	Timeout  time.Duration           `json:"timeout" default:"1m30s"`
+	Filters  []SearchFilter          `json:"filters"`
+	Extra    *SearchFilter           `json:"extra"`
+	Named    map[string]SearchFilter `json:"named"`
+}
+
+func TestDefaults(t *testing.T) {
+	var got *SearchRequest
+	svc := rpc.NewService("SearchService", rpc.WithPackage("search.v1"))
+	rpc.MustRegister(svc, "Search", func(_ context.Context, req *SearchRequest) (*SearchRequest, error) {
+		got = req
+		return req, nil
+	})
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{EnableOpenAPI: true}, svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	search := func(t *testing.T, contentType, body string) *SearchRequest {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/search.v1.SearchService/Search", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Search failed with %d: %s", rec.Code, rec.Body)
+		}
+		return got
+	}
+
+	t.Run("fills unset fields", func(t *testing.T) {
+		resp := search(t, "application/json", `{"filters":[{"field":"name"}],"extra":{},"named":{"a":{"op":"ne"},"b":{}}}`)
+		if resp.PageSize != 20 || resp.Exact == nil || !*resp.Exact || resp.Timeout != 90*time.Second {
+			t.Errorf("Expected the defaults, got %+v", resp)
+		}
+		if resp.Filters[0].Op != "eq" || resp.Extra.Op != "eq" || resp.Named["a"].Op != "ne" || resp.Named["b"].Op != "eq" {
+			t.Errorf("Expected the defaults of nested messages, got %+v", resp)
+		}
+	})
+
+	t.Run("keeps set fields", func(t *testing.T) {
+		resp := search(t, "application/json", `{"page_size":5,"exact":false,"timeout":"2s"}`)
+		if resp.PageSize != 5 || resp.Exact == nil || *resp.Exact || resp.Timeout != 2*time.Second {
+			t.Errorf("Expected the values sent, got %+v", resp)
+		}
+		if resp.Extra != nil {
+			t.Errorf("Expected unset messages to stay unset, got %+v", resp.Extra)
+		}
+	})
+
+	t.Run("applies to protobuf requests", func(t *testing.T) {
+		req := search(t, "application/proto", "")
+		if req.PageSize != 20 || req.Exact == nil || !*req.Exact || req.Timeout != 90*time.Second {
+			t.Errorf("Expected the defaults, got %+v", req)
+		}
+	})
+
+	t.Run("documents defaults in OpenAPI", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		var spec struct {
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]map[string]any `json:"properties"`
+				} `json:"schemas"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+			t.Fatalf("Failed to decode the spec: %v", err)
+		}
+		props := spec.Components.Schemas["search.v1.SearchRequest"].Properties
+		if props["page_size"]["default"] != float64(20) || props["exact"]["default"] != true || props["timeout"]["default"] != "90s" {
+			t.Errorf("Expected the defaults in the schema, got %v", props)
+		}
+		if spec.Components.Schemas["search.v1.SearchFilter"].Properties["op"]["default"] != "eq" {
+			t.Errorf("Expected the defaults of nested messages, got %v", spec.Components.Schemas["search.v1.SearchFilter"])
+		}
+	})
+
+	t.Run("rejects invalid defaults", func(t *testing.T) {
+		type BadRequest struct {
+			Count int32 `json:"count" default:"many"`
+		}
+		svc := rpc.NewService("BadService", rpc.WithPackage("bad.v1"))
+		if err := rpc.Register(svc, "Get", func(_ context.Context, req *BadRequest) (*BadRequest, error) { return req, nil }); err == nil {
+			t.Error("Expected an error for a default that is not a number")
+		}
+	})
+}
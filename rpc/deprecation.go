@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecation marks a service or method as deprecated, for clients to
+// migrate off it before it is removed. Deprecated methods have the
+// deprecated option in exported descriptors, are flagged in OpenAPI and
+// OpenRPC documents, and answer calls with the Deprecation (RFC 9745) and
+// Sunset (RFC 8594) headers:
+//
+//	rpc.MustRegisterMethod(svc,
+//		rpc.NewMethod("GetUser", getUser).WithDeprecation(rpc.Deprecation{
+//			Since:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+//			Sunset:  time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+//			Message: "Use user.v2.UserService/GetUser.",
+//		}),
+//	)
+type Deprecation struct {
+	// Since is when the method was deprecated (zero: unknown, sent as
+	// "Deprecation: true" like the drafts of RFC 9745 did)
+	Since time.Time
+	// Sunset is when the method will stop being served (zero: not sent)
+	Sunset time.Time
+	// Link is the URL of the migration guide, sent as a Link header with the
+	// "deprecation" relation
+	Link string
+	// Message tells clients what to use instead, added to the documentation
+	Message string
+	// OnCall is called with each call of the method, e.g. to log or count
+	// the clients that still have to migrate.
+	OnCall func(DeprecationEvent)
+}
+
+// DeprecationEvent describes a call of a deprecated method.
+type DeprecationEvent struct {
+	// Method is the name of the called method.
+	Method string
+	// Procedure is the full name of the method, "/package.Service/Method".
+	Procedure string
+	// Protocol is the protocol of the call, see Metadata.Protocol.
+	Protocol string
+	// ClientIP is the IP address of the client, see Metadata.ClientIP.
+	ClientIP string
+	// UserAgent is the User-Agent header of the call.
+	UserAgent string
+}
+
+// WithDeprecation marks all methods of the service as deprecated.
+func WithDeprecation(d Deprecation) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.Deprecation = &d
+	}
+}
+
+// WithDeprecation marks the method as deprecated, overriding the
+// deprecation of the service.
+func (m *MethodBuilder) WithDeprecation(d Deprecation) *MethodBuilder {
+	m.method.Options.Deprecation = &d
+	return m
+}
+
+// deprecation returns the deprecation of method, or nil if it is current.
+func (s *Service) deprecation(method *Method) *Deprecation {
+	if method.Options.Deprecation != nil {
+		return method.Options.Deprecation
+	}
+	return s.options.Deprecation
+}
+
+// announceDeprecation adds the deprecation headers to the response of a call
+// of a deprecated method, and reports the call. w is nil for calls sharing a
+// response with others, as in JSON-RPC batches.
+func (s *Service) announceDeprecation(w http.ResponseWriter, r *http.Request, hctx *handlerContext) {
+	d := s.deprecation(hctx.method)
+	if d == nil {
+		return
+	}
+
+	if w != nil {
+		header := w.Header()
+		if !d.Since.IsZero() {
+			header.Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+		} else {
+			header.Set("Deprecation", "true")
+		}
+		if !d.Sunset.IsZero() {
+			header.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+		}
+	}
+
+	if d.OnCall != nil {
+		d.OnCall(DeprecationEvent{
+			Method:    hctx.method.Name,
+			Procedure: hctx.procedure,
+			Protocol:  hctx.protocol,
+			ClientIP:  hctx.clientIP,
+			UserAgent: r.UserAgent(),
+		})
+	}
+}
+
+// deprecationComment returns the documentation of a deprecation, following
+// the Go convention of a "Deprecated:" paragraph.
+func deprecationComment(description string, d *Deprecation) string {
+	notice := "Deprecated: do not use."
+	if d.Message != "" {
+		notice = "Deprecated: " + d.Message
+	}
+	if !d.Sunset.IsZero() {
+		notice += fmt.Sprintf(" Removed after %s.", d.Sunset.UTC().Format(time.DateOnly))
+	}
+	if description == "" {
+		return notice
+	}
+	return description + "\n\n" + notice
+}
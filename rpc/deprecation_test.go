@@ -0,0 +1,166 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type LegacyRequest struct {
+	Name     string `json:"name"`
+	Nickname string `json:"nickname" deprecated:"true"`
+}
+
+type LegacyResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestDeprecation(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []rpc.DeprecationEvent
+	)
+	greet := func(_ context.Context, req *LegacyRequest) (*LegacyResponse, error) {
+		return &LegacyResponse{Greeting: "Hello, " + req.Name}, nil
+	}
+	svc := rpc.NewService("GreetService", rpc.WithPackage("greet.v1"), rpc.WithJSONRPC("/jsonrpc"))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewMethod("Greet", greet),
+		rpc.NewMethod("Hello", greet).WithDescription("Says hello.").WithDeprecation(rpc.Deprecation{
+			Since:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:  time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+			Link:    "https://example.com/migrate",
+			Message: "Use Greet.",
+			OnCall: func(event rpc.DeprecationEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+			},
+		}),
+	)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(path, body string) *httptest.ResponseRecorder {
+		mu.Lock()
+		events = nil
+		mu.Unlock()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "legacy-client/1.0")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("deprecated methods send deprecation headers", func(t *testing.T) {
+		rec := call("/greet.v1.GreetService/Hello", `{"name":"Ann"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		want := map[string]string{
+			"Deprecation": "@1767225600",
+			"Sunset":      "Wed, 01 Jul 2026 00:00:00 GMT",
+			"Link":        `<https://example.com/migrate>; rel="deprecation"`,
+		}
+		for key, value := range want {
+			if got := rec.Header().Get(key); got != value {
+				t.Errorf("Expected %s %q, got %q", key, value, got)
+			}
+		}
+		if len(events) != 1 || events[0].Procedure != "/greet.v1.GreetService/Hello" ||
+			events[0].Protocol != "http" || events[0].UserAgent != "legacy-client/1.0" {
+			t.Errorf("Expected one call to be reported, got %+v", events)
+		}
+	})
+
+	t.Run("current methods send none", func(t *testing.T) {
+		rec := call("/greet.v1.GreetService/Greet", `{"name":"Ann"}`)
+		if rec.Header().Get("Deprecation") != "" || len(events) != 0 {
+			t.Errorf("Expected no deprecation, got %v %+v", rec.Header(), events)
+		}
+	})
+
+	t.Run("JSON-RPC batches report each call", func(t *testing.T) {
+		rec := call("/jsonrpc", `[{"jsonrpc":"2.0","id":1,"method":"Hello","params":{"name":"Ann"}},`+
+			`{"jsonrpc":"2.0","id":2,"method":"Greet","params":{"name":"Bob"}}]`)
+		if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+			t.Errorf("Expected no deprecation headers for a batch, got %d %v", rec.Code, rec.Header())
+		}
+		if len(events) != 1 || events[0].Method != "Hello" || events[0].Protocol != "jsonrpc" {
+			t.Errorf("Expected the deprecated call to be reported, got %+v", events)
+		}
+	})
+
+	t.Run("descriptors and documents mark deprecated methods", func(t *testing.T) {
+		protoContent, err := svc.ExportProto()
+		if err != nil {
+			t.Fatalf("Failed to export proto: %v", err)
+		}
+		for _, expected := range []string{
+			"* Deprecated: Use Greet. Removed after 2026-07-01.",
+			"rpc Hello ( LegacyRequest ) returns ( LegacyResponse ) {\n    option deprecated = true;",
+			"string nickname = 2 [deprecated = true];",
+		} {
+			if !strings.Contains(protoContent, expected) {
+				t.Errorf("Expected proto to contain %q, got:\n%s", expected, protoContent)
+			}
+		}
+
+		spec, err := gateway.GenerateOpenAPI(svc.GetFileDescriptorSet(), gateway.OpenAPIInfo{Title: "Greet", Version: "1.0.0"})
+		if err != nil {
+			t.Fatalf("Failed to generate OpenAPI: %v", err)
+		}
+		if op := spec.Paths["/greet.v1.GreetService/Hello"].(map[string]any)["post"].(map[string]any); op["deprecated"] != true ||
+			op["description"] != "Says hello.\n\nDeprecated: Use Greet. Removed after 2026-07-01." {
+			t.Errorf("Expected a deprecated operation, got %v", op)
+		}
+		nickname := spec.Components.Schemas["greet.v1.LegacyRequest"].(map[string]any)["properties"].(map[string]any)["nickname"]
+		if nickname.(map[string]any)["deprecated"] != true {
+			t.Errorf("Expected a deprecated property, got %v", nickname)
+		}
+		if op := spec.Paths["/greet.v1.GreetService/Greet"].(map[string]any)["post"].(map[string]any); op["deprecated"] != nil {
+			t.Errorf("Expected a current operation, got %v", op)
+		}
+
+		doc, err := svc.OpenRPC()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, method := range doc.Methods {
+			if method.Deprecated != (method.Name == "Hello") {
+				t.Errorf("Unexpected deprecation of %s: %v", method.Name, method.Deprecated)
+			}
+		}
+	})
+
+	t.Run("service deprecation covers all methods", func(t *testing.T) {
+		svc := rpc.NewService("OldService", rpc.WithPackage("old.v1"), rpc.WithDeprecation(rpc.Deprecation{}))
+		rpc.MustRegisterMethod(svc, rpc.NewMethod("Greet", greet))
+		fdset := svc.GetFileDescriptorSet()
+		service := fdset.GetFile()[len(fdset.GetFile())-1].GetService()[0]
+		if !service.GetOptions().GetDeprecated() || !service.GetMethod()[0].GetOptions().GetDeprecated() {
+			t.Errorf("Expected the service and its methods to be deprecated, got %v", service)
+		}
+
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/old.v1.OldService/Greet", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Sunset") != "" {
+			t.Errorf("Expected an undated deprecation, got %v", rec.Header())
+		}
+	})
+}
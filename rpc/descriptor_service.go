@@ -0,0 +1,296 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// DynamicHandler handles the calls of a method of a service created by
+// NewServiceFromDescriptor, with messages of the method's input and output
+// types. A nil response is an empty message.
+type DynamicHandler = Handler[dynamicpb.Message, dynamicpb.Message]
+
+// DynamicServerStreamHandler handles the calls of a server-streaming method
+// of a service created by NewServiceFromDescriptor.
+type DynamicServerStreamHandler = ServerStreamHandler[dynamicpb.Message, dynamicpb.Message]
+
+// DynamicClientStreamHandler handles the calls of a client-streaming method
+// of a service created by NewServiceFromDescriptor. A nil response is an
+// empty message.
+type DynamicClientStreamHandler = ClientStreamHandler[dynamicpb.Message, dynamicpb.Message]
+
+// DynamicBidiStreamHandler handles the calls of a bidirectional streaming
+// method of a service created by NewServiceFromDescriptor.
+type DynamicBidiStreamHandler = BidiStreamHandler[dynamicpb.Message, dynamicpb.Message]
+
+// NewServiceFromDescriptor creates a service described by sd rather than by
+// Go types, such as a service of a FileDescriptorSet built by protoc or buf.
+// Its methods are registered with RegisterDynamic,
+// RegisterDynamicServerStream, RegisterDynamicClientStream, and
+// RegisterDynamicBidiStream, and handle dynamic messages. The service
+// describes itself with the file of sd, for reflection, OpenAPI documents,
+// and exports, so the package is the file's:
+//
+//	files, _ := protodesc.NewFiles(fdset)
+//	desc, _ := files.FindDescriptorByName("user.v1.UserService")
+//	svc := rpc.NewServiceFromDescriptor(desc.(protoreflect.ServiceDescriptor))
+//	err := rpc.RegisterDynamic(svc, "GetUser", getUser)
+func NewServiceFromDescriptor(sd protoreflect.ServiceDescriptor, opts ...ServiceOption) *Service {
+	opts = append(opts, WithPackage(string(sd.ParentFile().Package())))
+	svc := NewService(string(sd.Name()), opts...)
+	svc.descriptor = sd
+	return svc
+}
+
+// RegisterDynamic registers handler for the unary method name of a service
+// created by NewServiceFromDescriptor.
+func RegisterDynamic(svc *Service, name string, handler DynamicHandler) error {
+	md, err := dynamicMethod(svc, name)
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Errorf("method %s is streaming, register it with RegisterDynamicServerStream, RegisterDynamicClientStream, or RegisterDynamicBidiStream", name)
+	}
+
+	output := md.Output()
+	method := NewMethod(name, func(ctx context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error) {
+		resp, err := handler(ctx, req)
+		switch {
+		case err != nil:
+			return nil, err
+		case resp == nil:
+			return dynamicpb.NewMessage(output), nil
+		case resp.Descriptor().FullName() != output.FullName():
+			return nil, NewErrorf(CodeInternal, "method %s returned a %s, not a %s", name, resp.Descriptor().FullName(), output.FullName())
+		}
+		return resp, nil
+	}).WithIdempotency(descriptorIdempotency(md)).Build()
+	method.ProtoInput = dynamicpb.NewMessage(md.Input())
+	method.ProtoOutput = dynamicpb.NewMessage(output)
+	return svc.Register(method)
+}
+
+// MustRegisterDynamic is like RegisterDynamic but panics on error.
+func MustRegisterDynamic(svc *Service, name string, handler DynamicHandler) {
+	if err := RegisterDynamic(svc, name, handler); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterDynamicServerStream registers handler for the server-streaming
+// method name of a service created by NewServiceFromDescriptor.
+func RegisterDynamicServerStream(svc *Service, name string, handler DynamicServerStreamHandler) error {
+	md, err := dynamicMethod(svc, name)
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() || !md.IsStreamingServer() {
+		return fmt.Errorf("method %s is not server-streaming", name)
+	}
+
+	output := md.Output()
+	method := &Method{
+		Name: name,
+		Handler: wrapServerStreamHandler(func(ctx context.Context, req *dynamicpb.Message, stream ServerStream[dynamicpb.Message]) error {
+			return handler(ctx, req, &dynamicServerStream{ServerStream: stream, method: name, output: output})
+		}),
+		InputType:   reflect.TypeFor[dynamicpb.Message](),
+		OutputType:  reflect.TypeFor[dynamicpb.Message](),
+		StreamType:  StreamTypeServerStream,
+		ProtoInput:  dynamicpb.NewMessage(md.Input()),
+		ProtoOutput: dynamicpb.NewMessage(output),
+	}
+	return svc.RegisterStreamingMethod(method)
+}
+
+// MustRegisterDynamicServerStream is like RegisterDynamicServerStream but
+// panics on error.
+func MustRegisterDynamicServerStream(svc *Service, name string, handler DynamicServerStreamHandler) {
+	if err := RegisterDynamicServerStream(svc, name, handler); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterDynamicClientStream registers handler for the client-streaming
+// method name of a service created by NewServiceFromDescriptor.
+func RegisterDynamicClientStream(svc *Service, name string, handler DynamicClientStreamHandler) error {
+	md, err := dynamicMethod(svc, name)
+	if err != nil {
+		return err
+	}
+	if !md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Errorf("method %s is not client-streaming", name)
+	}
+
+	output := md.Output()
+	method := &Method{
+		Name: name,
+		Handler: wrapClientStreamHandler(func(ctx context.Context, stream ClientStream[dynamicpb.Message]) (*dynamicpb.Message, error) {
+			resp, err := handler(ctx, stream)
+			switch {
+			case err != nil:
+				return nil, err
+			case resp == nil:
+				return dynamicpb.NewMessage(output), nil
+			case resp.Descriptor().FullName() != output.FullName():
+				return nil, NewErrorf(CodeInternal, "method %s returned a %s, not a %s", name, resp.Descriptor().FullName(), output.FullName())
+			}
+			return resp, nil
+		}),
+		InputType:   reflect.TypeFor[dynamicpb.Message](),
+		OutputType:  reflect.TypeFor[dynamicpb.Message](),
+		StreamType:  StreamTypeClientStream,
+		ProtoInput:  dynamicpb.NewMessage(md.Input()),
+		ProtoOutput: dynamicpb.NewMessage(output),
+	}
+	return svc.RegisterStreamingMethod(method)
+}
+
+// MustRegisterDynamicClientStream is like RegisterDynamicClientStream but
+// panics on error.
+func MustRegisterDynamicClientStream(svc *Service, name string, handler DynamicClientStreamHandler) {
+	if err := RegisterDynamicClientStream(svc, name, handler); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterDynamicBidiStream registers handler for the bidirectional
+// streaming method name of a service created by NewServiceFromDescriptor.
+func RegisterDynamicBidiStream(svc *Service, name string, handler DynamicBidiStreamHandler) error {
+	md, err := dynamicMethod(svc, name)
+	if err != nil {
+		return err
+	}
+	if !md.IsStreamingClient() || !md.IsStreamingServer() {
+		return fmt.Errorf("method %s is not bidirectional streaming", name)
+	}
+
+	output := md.Output()
+	method := &Method{
+		Name: name,
+		Handler: wrapBidiStreamHandler(func(ctx context.Context, stream BidiStream[dynamicpb.Message, dynamicpb.Message]) error {
+			return handler(ctx, &dynamicBidiStream{BidiStream: stream, method: name, output: output})
+		}),
+		InputType:   reflect.TypeFor[dynamicpb.Message](),
+		OutputType:  reflect.TypeFor[dynamicpb.Message](),
+		StreamType:  StreamTypeBidiStream,
+		ProtoInput:  dynamicpb.NewMessage(md.Input()),
+		ProtoOutput: dynamicpb.NewMessage(output),
+	}
+	return svc.RegisterStreamingMethod(method)
+}
+
+// MustRegisterDynamicBidiStream is like RegisterDynamicBidiStream but panics
+// on error.
+func MustRegisterDynamicBidiStream(svc *Service, name string, handler DynamicBidiStreamHandler) {
+	if err := RegisterDynamicBidiStream(svc, name, handler); err != nil {
+		panic(err)
+	}
+}
+
+// dynamicServerStream checks the type of the messages sent on a dynamic
+// server stream.
+type dynamicServerStream struct {
+	ServerStream[dynamicpb.Message]
+	method string
+	output protoreflect.MessageDescriptor
+}
+
+func (s *dynamicServerStream) Send(msg *dynamicpb.Message) error {
+	if msg == nil {
+		msg = dynamicpb.NewMessage(s.output)
+	}
+	if msg.Descriptor().FullName() != s.output.FullName() {
+		return NewErrorf(CodeInternal, "method %s sent a %s, not a %s", s.method, msg.Descriptor().FullName(), s.output.FullName())
+	}
+	return s.ServerStream.Send(msg)
+}
+
+// dynamicBidiStream checks the type of the messages sent on a dynamic
+// bidirectional stream.
+type dynamicBidiStream struct {
+	BidiStream[dynamicpb.Message, dynamicpb.Message]
+	method string
+	output protoreflect.MessageDescriptor
+}
+
+func (s *dynamicBidiStream) Send(msg *dynamicpb.Message) error {
+	if msg == nil {
+		msg = dynamicpb.NewMessage(s.output)
+	}
+	if msg.Descriptor().FullName() != s.output.FullName() {
+		return NewErrorf(CodeInternal, "method %s sent a %s, not a %s", s.method, msg.Descriptor().FullName(), s.output.FullName())
+	}
+	return s.BidiStream.Send(msg)
+}
+
+// dynamicMethod returns the descriptor of the method name of a service
+// created by NewServiceFromDescriptor.
+func dynamicMethod(svc *Service, name string) (protoreflect.MethodDescriptor, error) {
+	if svc.descriptor == nil {
+		return nil, fmt.Errorf("service %s is not created from a descriptor", svc.name)
+	}
+	md := svc.descriptor.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", svc.descriptor.FullName(), name)
+	}
+	return md, nil
+}
+
+// isDynamicMessage reports whether v is a dynamic message, which only
+// protojson encodes.
+func isDynamicMessage(v any) bool {
+	_, ok := v.(*dynamicpb.Message)
+	return ok
+}
+
+// descriptorFileSet returns the file of sd, with sd as its only service, and
+// the files it imports, dependencies first. Services of the same file then
+// merge in gateways like the services of a Go package.
+func descriptorFileSet(sd protoreflect.ServiceDescriptor) *descriptorpb.FileDescriptorSet {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	add(sd.ParentFile())
+
+	file := fdset.File[len(fdset.File)-1]
+	index := int32(sd.Index()) //nolint:gosec // service count fits in int32
+	file.Service = []*descriptorpb.ServiceDescriptorProto{file.GetService()[index]}
+	if info := file.GetSourceCodeInfo(); info != nil {
+		locations := info.GetLocation()[:0]
+		for _, loc := range info.GetLocation() {
+			path := loc.GetPath()
+			if len(path) >= 2 && path[0] == schema.FileDescriptorProtoServiceField {
+				if path[1] != index {
+					continue
+				}
+				loc = proto.CloneOf(loc)
+				loc.Path[1] = 0
+			}
+			locations = append(locations, loc)
+		}
+		info.Location = locations
+	}
+	return fdset
+}
@@ -0,0 +1,171 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// greeterFile describes a service with a unary and streaming methods, and a
+// second service in the same file.
+var greeterFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("greet/v1/greet.proto"),
+	Package: proto.String("greet.v1"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{Name: proto.String("GreetRequest"), Field: []*descriptorpb.FieldDescriptorProto{{
+			Name: proto.String("name"), Number: proto.Int32(1), JsonName: proto.String("name"),
+			Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}}},
+		{Name: proto.String("GreetResponse"), Field: []*descriptorpb.FieldDescriptorProto{{
+			Name: proto.String("greeting"), Number: proto.Int32(1), JsonName: proto.String("greeting"),
+			Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}}},
+	},
+	Service: []*descriptorpb.ServiceDescriptorProto{
+		{Name: proto.String("AdminService")},
+		{Name: proto.String("GreetService"), Method: []*descriptorpb.MethodDescriptorProto{
+			{Name: proto.String("Greet"), InputType: proto.String(".greet.v1.GreetRequest"), OutputType: proto.String(".greet.v1.GreetResponse")},
+			{Name: proto.String("Watch"), InputType: proto.String(".greet.v1.GreetRequest"), OutputType: proto.String(".greet.v1.GreetResponse"), ServerStreaming: proto.Bool(true)},
+			{Name: proto.String("GreetAll"), InputType: proto.String(".greet.v1.GreetRequest"), OutputType: proto.String(".greet.v1.GreetResponse"), ClientStreaming: proto.Bool(true)},
+		}},
+	},
+}
+
+func TestServiceFromDescriptor(t *testing.T) {
+	fd, err := protodesc.NewFile(greeterFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := fd.Services().ByName("GreetService")
+	svc := rpc.NewServiceFromDescriptor(sd, rpc.WithReflection(true), rpc.WithJSONRPC("/jsonrpc"))
+	rpc.MustRegisterDynamic(svc, "Greet", func(_ context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error) {
+		name := req.Get(req.Descriptor().Fields().ByName("name")).String()
+		if name == "" {
+			return nil, rpc.NewError(rpc.CodeInvalidArgument, "name is required")
+		}
+		resp := dynamicpb.NewMessage(sd.Methods().ByName("Greet").Output())
+		resp.Set(resp.Descriptor().Fields().ByName("greeting"), protoreflect.ValueOfString("Hello, "+name))
+		return resp, nil
+	})
+	rpc.MustRegisterDynamicClientStream(svc, "GreetAll", func(_ context.Context, stream rpc.ClientStream[dynamicpb.Message]) (*dynamicpb.Message, error) {
+		var names []string
+		for {
+			req, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, req.Get(req.Descriptor().Fields().ByName("name")).String())
+		}
+		resp := dynamicpb.NewMessage(sd.Methods().ByName("GreetAll").Output())
+		resp.Set(resp.Descriptor().Fields().ByName("greeting"), protoreflect.ValueOfString("Hello, "+strings.Join(names, " and ")))
+		return resp, nil
+	})
+	if err := rpc.RegisterDynamicBidiStream(svc, "GreetAll", nil); err == nil {
+		t.Error("Expected methods of another kind to be rejected")
+	}
+	if err := rpc.RegisterDynamic(svc, "Watch", nil); err == nil {
+		t.Error("Expected streaming methods to be rejected")
+	}
+	if err := rpc.RegisterDynamic(svc, "Missing", nil); err == nil {
+		t.Error("Expected unknown methods to be rejected")
+	}
+
+	fdset := svc.GetFileDescriptorSet()
+	if len(fdset.GetFile()) != 1 || len(fdset.GetFile()[0].GetService()) != 1 || fdset.GetFile()[0].GetService()[0].GetName() != "GreetService" {
+		t.Errorf("Expected the file with only GreetService, got %v", fdset)
+	}
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	post := func(path, body string) string {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	t.Run("Connect JSON calls", func(t *testing.T) {
+		if body := post("/greet.v1.GreetService/Greet", `{"name":"ann"}`); !strings.Contains(body, `"greeting":"Hello, ann"`) {
+			t.Errorf("Expected a greeting, got %s", body)
+		}
+		if body := post("/greet.v1.GreetService/Greet", `{}`); !strings.Contains(body, "invalid_argument") {
+			t.Errorf("Expected an invalid argument error, got %s", body)
+		}
+	})
+
+	t.Run("JSON-RPC calls", func(t *testing.T) {
+		body := post("/jsonrpc", `{"jsonrpc":"2.0","method":"Greet","params":{"name":"bob"},"id":1}`)
+		if !strings.Contains(body, `"greeting":"Hello, bob"`) {
+			t.Errorf("Expected a greeting, got %s", body)
+		}
+	})
+
+	t.Run("gRPC calls", func(t *testing.T) {
+		server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+		t.Cleanup(server.Close)
+		conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+
+		method := sd.Methods().ByName("Greet")
+		req := dynamicpb.NewMessage(method.Input())
+		req.Set(method.Input().Fields().ByName("name"), protoreflect.ValueOfString("cid"))
+		resp := dynamicpb.NewMessage(method.Output())
+		if err := conn.Invoke(context.Background(), "/greet.v1.GreetService/Greet", req, resp); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if got := resp.Get(method.Output().Fields().ByName("greeting")).String(); got != "Hello, cid" {
+			t.Errorf("Expected a greeting, got %q", got)
+		}
+
+		stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true}, "/greet.v1.GreetService/GreetAll")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"ann", "bob"} {
+			req := dynamicpb.NewMessage(method.Input())
+			req.Set(method.Input().Fields().ByName("name"), protoreflect.ValueOfString(name))
+			if err := stream.SendMsg(req); err != nil {
+				t.Fatalf("SendMsg() failed: %v", err)
+			}
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		resp = dynamicpb.NewMessage(method.Output())
+		if err := stream.RecvMsg(resp); err != nil {
+			t.Fatalf("RecvMsg() failed: %v", err)
+		}
+		if got := resp.Get(method.Output().Fields().ByName("greeting")).String(); got != "Hello, ann and bob" {
+			t.Errorf("Expected a greeting, got %q", got)
+		}
+	})
+}
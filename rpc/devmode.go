@@ -0,0 +1,232 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Dev mode constants
+const (
+	devModeMaxBodySnapshot = 4096
+)
+
+// devModeHeaders lists the request headers echoed back in dev mode error responses.
+// Credentials such as Authorization and Cookie are deliberately excluded.
+var devModeHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Accept",
+	"Accept-Encoding",
+	"Connect-Protocol-Version",
+	"Connect-Timeout-Ms",
+	"Grpc-Timeout",
+	"Grpc-Encoding",
+	"User-Agent",
+	"X-Grpc-Web",
+}
+
+// DebugInfo is the diagnostic payload attached to error responses in dev mode.
+type DebugInfo struct {
+	// Method is the fully-qualified procedure path
+	Method string `json:"method,omitempty"`
+	// Request is the request message with its sensitive fields redacted, or
+	// the raw body if it could not be decoded and has no sensitive fields
+	Request any `json:"request,omitempty"`
+	// Headers contains selected request headers
+	Headers map[string]string `json:"headers,omitempty"`
+	// Descriptor describes the input and output message types
+	Descriptor *DescriptorContext `json:"descriptor,omitempty"`
+	// Stack is the goroutine stack captured when the error was reported
+	Stack string `json:"stack,omitempty"`
+	// Cause is the unwrapped Go error chain
+	Cause string `json:"cause,omitempty"`
+}
+
+// DescriptorContext describes the message types involved in a failed call.
+type DescriptorContext struct {
+	Input  string   `json:"input,omitempty"`
+	Output string   `json:"output,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// devModeError carries debug information alongside the original error.
+type devModeError struct {
+	err  error
+	info *DebugInfo
+}
+
+// Error implements the error interface.
+func (e *devModeError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the original error.
+func (e *devModeError) Unwrap() error {
+	return e.err
+}
+
+// WithDevMode enables developer mode. In dev mode, error responses include a
+// snapshot of the decoded request, selected headers, a stack trace, and
+// descriptor context. Never enable this in production.
+func WithDevMode(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.DevMode = enabled
+	}
+}
+
+// withDebugInfo attaches debug information to err when dev mode is enabled.
+func (s *Service) withDebugInfo(err error, r *http.Request, hctx *handlerContext, body []byte, input reflect.Value) error {
+	if err == nil || !s.options.DevMode {
+		return err
+	}
+	var existing *devModeError
+	if errors.As(err, &existing) {
+		return err
+	}
+
+	info := &DebugInfo{
+		Headers: make(map[string]string),
+		Stack:   string(debug.Stack()),
+		Cause:   err.Error(),
+	}
+	for _, key := range devModeHeaders {
+		if v := r.Header.Get(key); v != "" {
+			info.Headers[key] = v
+		}
+	}
+
+	if hctx != nil && hctx.method != nil {
+		info.Method = fmt.Sprintf("/%s.%s/%s", s.packageName, s.name, hctx.method.Name)
+		info.Descriptor = describeMethod(hctx)
+	}
+
+	info.Request = redactedRequest(hctx, body, input)
+
+	return &devModeError{err: err, info: info}
+}
+
+// recoverWithDebugInfo converts a recovered panic into an internal error with its stack.
+func recoverWithDebugInfo(p any) error {
+	return &devModeError{
+		err: NewErrorf(CodeInternal, "panic: %v", p),
+		info: &DebugInfo{
+			Stack: string(debug.Stack()),
+			Cause: fmt.Sprint(p),
+		},
+	}
+}
+
+// describeMethod builds the descriptor context from the handler's codecs.
+func describeMethod(hctx *handlerContext) *DescriptorContext {
+	dc := &DescriptorContext{}
+	if hctx.inputCodec != nil {
+		md := hctx.inputCodec.Descriptor()
+		dc.Input = string(md.FullName())
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			dc.Fields = append(dc.Fields, fmt.Sprintf("%d:%s %s", f.Number(), f.Name(), f.Kind()))
+		}
+	} else if hctx.method.InputType != nil {
+		dc.Input = hctx.method.InputType.String()
+	}
+	if hctx.outputCodec != nil {
+		dc.Output = string(hctx.outputCodec.Descriptor().FullName())
+	} else if hctx.method.OutputType != nil {
+		dc.Output = hctx.method.OutputType.String()
+	}
+	return dc
+}
+
+// redactedRequest returns the request of a failed call with its sensitive
+// fields redacted: the decoded input, or else the body decoded as the input
+// of the method, e.g. when validation failed. Bodies that cannot be decoded
+// are only echoed if the input has no sensitive fields.
+func redactedRequest(hctx *handlerContext, body []byte, input reflect.Value) any {
+	if !input.IsValid() && len(body) > 0 && hctx != nil && hctx.method != nil {
+		input = decodeSnapshot(hctx.method, body)
+		if !input.IsValid() {
+			if inputMaySensitive(hctx.method) {
+				return RedactedValue
+			}
+			return bodySnapshot(body)
+		}
+	}
+	switch {
+	case input.IsValid() && input.CanInterface():
+		data, err := redactedJSON(input.Interface())
+		if err != nil {
+			return RedactedValue
+		}
+		return json.RawMessage(data)
+	case len(body) > 0:
+		return bodySnapshot(body)
+	}
+	return nil
+}
+
+// decodeSnapshot decodes a JSON or protobuf body as the input of method,
+// returning the invalid value if it cannot.
+func decodeSnapshot(method *Method, body []byte) reflect.Value {
+	if method.ProtoInput != nil {
+		msg := method.ProtoInput.ProtoReflect().New().Interface()
+		if protojson.Unmarshal(body, msg) == nil || proto.Unmarshal(body, msg) == nil {
+			return reflect.ValueOf(msg)
+		}
+		return reflect.Value{}
+	}
+	if method.InputType == nil {
+		return reflect.Value{}
+	}
+	input := reflect.New(method.InputType)
+	if json.Unmarshal(body, input.Interface()) != nil {
+		return reflect.Value{}
+	}
+	return input
+}
+
+// inputMaySensitive reports whether the input of method may hold sensitive
+// fields.
+func inputMaySensitive(method *Method) bool {
+	if method.ProtoInput != nil {
+		return sensitiveDescriptor(method.ProtoInput.ProtoReflect().Descriptor(), make(map[protoreflect.FullName]bool))
+	}
+	return method.InputType == nil || maySensitive(method.InputType)
+}
+
+// bodySnapshot returns a printable, truncated view of a raw request body.
+func bodySnapshot(body []byte) any {
+	truncated := false
+	if len(body) > devModeMaxBodySnapshot {
+		body = body[:devModeMaxBodySnapshot]
+		truncated = true
+	}
+	if json.Valid(body) {
+		return json.RawMessage(append([]byte(nil), body...))
+	}
+	snapshot := map[string]any{"truncated": truncated}
+	if utf8.Valid(body) {
+		snapshot["text"] = string(body)
+	} else {
+		snapshot["bytes"] = body
+	}
+	return snapshot
+}
+
+// debugInfoFromError extracts debug information and the original error.
+func debugInfoFromError(err error) (*DebugInfo, error) {
+	var dme *devModeError
+	if errors.As(err, &dme) {
+		return dme.info, dme.err
+	}
+	return nil, err
+}
@@ -0,0 +1,136 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type DevModeRequest struct {
+	Name     string `json:"name" validate:"max=10"`
+	Password string `json:"password,omitempty" sensitive:"true"`
+}
+
+type DevModeResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestDevModeErrorResponses(t *testing.T) {
+	newServer := func(t *testing.T, devMode bool) *httptest.Server {
+		t.Helper()
+		svc := rpc.NewService("DevService",
+			rpc.WithPackage("devmode.v1"),
+			rpc.WithDevMode(devMode),
+			rpc.WithValidation(true),
+		)
+		rpc.MustRegister(svc, "Greet", func(ctx context.Context, req *DevModeRequest) (*DevModeResponse, error) {
+			if req.Name == "panic" {
+				panic("boom")
+			}
+			return nil, rpc.NewError(rpc.CodeFailedPrecondition, "greeting failed")
+		})
+
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		server := httptest.NewServer(gw)
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	call := func(t *testing.T, server *httptest.Server, body string) map[string]any {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			server.URL+"/devmode.v1.DevService/Greet", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		var result map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		result := call(t, newServer(t, false), `{"name":"Alice"}`)
+		if _, ok := result["debug"]; ok {
+			t.Error("Expected no debug information when dev mode is disabled")
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		result := call(t, newServer(t, true), `{"name":"Alice"}`)
+		if result["code"] != "failed_precondition" {
+			t.Errorf("Expected original error code, got %v", result["code"])
+		}
+
+		debug, ok := result["debug"].(map[string]any)
+		if !ok {
+			t.Fatalf("Expected debug information, got %v", result)
+		}
+		if debug["method"] != "/devmode.v1.DevService/Greet" {
+			t.Errorf("Unexpected method: %v", debug["method"])
+		}
+		request, _ := debug["request"].(map[string]any)
+		if request["name"] != "Alice" {
+			t.Errorf("Expected decoded request snapshot, got %v", debug["request"])
+		}
+		headers, _ := debug["headers"].(map[string]any)
+		if headers["Content-Type"] != "application/json" {
+			t.Errorf("Expected Content-Type header echo, got %v", headers)
+		}
+		if _, leaked := headers["Authorization"]; leaked {
+			t.Error("Authorization header must not be echoed")
+		}
+		descriptor, _ := debug["descriptor"].(map[string]any)
+		if descriptor["input"] != "devmode.v1.DevModeRequest" {
+			t.Errorf("Unexpected descriptor context: %v", descriptor)
+		}
+		if debug["stack"] == "" {
+			t.Error("Expected stack trace")
+		}
+	})
+
+	t.Run("sensitive fields are redacted", func(t *testing.T) {
+		server := newServer(t, true)
+		for name, body := range map[string]string{
+			"handler error":    `{"name":"Alice","password":"hunter2"}`,
+			"validation error": `{"name":"Alice Liddell","password":"hunter2"}`,
+		} {
+			result := call(t, server, body)
+			debug, _ := result["debug"].(map[string]any)
+			request, _ := debug["request"].(map[string]any)
+			if request["password"] != rpc.RedactedValue || request["name"] == nil {
+				t.Errorf("%s: expected the password to be redacted, got %v", name, debug["request"])
+			}
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		result := call(t, newServer(t, true), `{"name":"panic"}`)
+		if result["code"] != "internal" {
+			t.Errorf("Expected internal error, got %v", result["code"])
+		}
+		debug, _ := result["debug"].(map[string]any)
+		if stack, _ := debug["stack"].(string); !strings.Contains(stack, "panic") {
+			t.Errorf("Expected panic stack trace, got %q", stack)
+		}
+	})
+}
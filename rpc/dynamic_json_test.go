@@ -0,0 +1,129 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type EventPayload struct {
+	Attributes map[string]any   `json:"attributes"`
+	Tags       []any            `json:"tags"`
+	Batches    []map[string]any `json:"batches"`
+	Series     map[string][]any `json:"series"`
+}
+
+func TestDynamicJSONFields(t *testing.T) {
+	svc := rpc.NewService("EventService", rpc.WithPackage("event.v1"))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *EventPayload) (*EventPayload, error) {
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/event.v1.EventService/Echo", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"attributes":{"count":2,"labels":{"env":"prod"},"flags":[true,null,"x"]},` +
+		`"tags":[1,"two",{"three":3}],"batches":[{"id":"a"},{}],"series":{"cpu":[0.5,1]}}`
+	var want EventPayload
+	if err := json.Unmarshal([]byte(body), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	// struct.proto resolves from the global registry
+	var md protoreflect.MessageDescriptor
+	for _, file := range svc.GetFileDescriptorSet().GetFile() {
+		if file.GetPackage() != "event.v1" {
+			continue
+		}
+		fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+		if err != nil {
+			t.Fatalf("Failed to build descriptors: %v", err)
+		}
+		md = fd.Messages().ByName("EventPayload")
+	}
+	if md == nil {
+		t.Fatal("Expected an EventPayload message")
+	}
+
+	t.Run("fields are Struct and ListValue messages", func(t *testing.T) {
+		for name, typeName := range map[protoreflect.Name]protoreflect.FullName{
+			"attributes": "google.protobuf.Struct",
+			"tags":       "google.protobuf.ListValue",
+			"batches":    "google.protobuf.Struct",
+			"series":     "google.protobuf.ListValue",
+		} {
+			fd := md.Fields().ByName(name)
+			var got protoreflect.FullName
+			switch {
+			case fd == nil:
+			case fd.IsMap():
+				got = fd.MapValue().Message().FullName()
+			default:
+				got = fd.Message().FullName()
+			}
+			if got != typeName {
+				t.Errorf("Expected %s to hold %s, got %q", name, typeName, got)
+			}
+		}
+		if md.Fields().ByName("attributes").IsList() || !md.Fields().ByName("batches").IsList() || !md.Fields().ByName("series").IsMap() {
+			t.Error("Expected singular dynamic fields in repeated and map fields")
+		}
+	})
+
+	t.Run("JSON round trip", func(t *testing.T) {
+		rec := call("application/json", []byte(body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var got EventPayload
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode %s: %v", rec.Body, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("binary round trip", func(t *testing.T) {
+		req := dynamicpb.NewMessage(md)
+		if err := protojson.Unmarshal([]byte(body), req); err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		data, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := call("application/proto", data)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		resp := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if !proto.Equal(req, resp) {
+			t.Errorf("Expected %v, got %v", req, resp)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type DocumentAudit struct {
+	CreatedBy string `json:"created_by"`
+	Revision  int32  `json:"revision"`
+}
+
+type DocumentOwner struct {
+	Name string `json:"name"`
+}
+
+type SaveDocumentRequest struct {
+	DocumentAudit
+	*DocumentOwner `proto:"prefix=owner_"`
+	TenantID       string `json:"tenant_id"`
+	Title          string `json:"title"`
+}
+
+type SaveDocumentResponse struct {
+	DocumentAudit
+	Owner string `json:"owner"`
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	svc := rpc.NewService("DocumentService", rpc.WithPackage("document.v1"))
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Save", func(_ context.Context, req *SaveDocumentRequest) (*SaveDocumentResponse, error) {
+		resp := &SaveDocumentResponse{DocumentAudit: req.DocumentAudit}
+		resp.Revision++
+		if req.DocumentOwner != nil {
+			resp.Owner = req.TenantID + "/" + req.Name
+		}
+		return resp, nil
+	}).WithPath("/v1/tenants/{tenant_id}/documents"))
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(path, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("JSON is flattened like encoding/json does", func(t *testing.T) {
+		rec := call("/v1/tenants/acme/documents", "application/json", []byte(`{"created_by":"ann","revision":1,"name":"bob"}`))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if want := `{"created_by":"ann","revision":2,"owner":"acme/bob"}`; strings.TrimSpace(rec.Body.String()) != want {
+			t.Errorf("Expected %s, got %s", want, rec.Body)
+		}
+	})
+
+	t.Run("binary messages have the flattened fields", func(t *testing.T) {
+		files, err := protodesc.NewFiles(svc.GetFileDescriptorSet())
+		if err != nil {
+			t.Fatalf("Failed to build descriptors: %v", err)
+		}
+		desc, err := files.FindDescriptorByName("document.v1.SaveDocumentRequest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqDesc := desc.(protoreflect.MessageDescriptor)
+		req := dynamicpb.NewMessage(reqDesc)
+		for name, value := range map[protoreflect.Name]string{"created_by": "ann", "owner_name": "bob", "tenant_id": "acme"} {
+			fd := reqDesc.Fields().ByName(name)
+			if fd == nil {
+				t.Fatalf("Expected a %s field in %v", name, reqDesc.Fields())
+			}
+			req.Set(fd, protoreflect.ValueOfString(value))
+		}
+		data, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := call("/document.v1.DocumentService/Save", "application/proto", data)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		respDesc, err := files.FindDescriptorByName("document.v1.SaveDocumentResponse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := dynamicpb.NewMessage(respDesc.(protoreflect.MessageDescriptor))
+		if err := proto.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		fields := resp.Descriptor().Fields()
+		if got := resp.Get(fields.ByName("created_by")).String(); got != "ann" {
+			t.Errorf("Expected created_by ann, got %q", got)
+		}
+		if got := resp.Get(fields.ByName("revision")).Int(); got != 1 {
+			t.Errorf("Expected revision 1, got %d", got)
+		}
+		if got := resp.Get(fields.ByName("owner")).String(); got != "acme/bob" {
+			t.Errorf("Expected owner acme/bob, got %q", got)
+		}
+	})
+
+	t.Run("embedded types are not exported as messages", func(t *testing.T) {
+		protoContent, err := svc.ExportProto()
+		if err != nil {
+			t.Fatalf("Failed to export proto: %v", err)
+		}
+		if strings.Contains(protoContent, "message DocumentAudit") || !strings.Contains(protoContent, "string owner_name = 3;") {
+			t.Errorf("Expected flattened messages, got:\n%s", protoContent)
+		}
+	})
+}
@@ -3,12 +3,20 @@ package rpc
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"strings"
 
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
+// anyTypeURLPrefix prefixes the type names of details in google.protobuf.Any.
+const anyTypeURLPrefix = "type.googleapis.com/"
+
 // Protocol constants
 const (
 	protocolConnect = "connect"
@@ -100,6 +108,9 @@ func (e *ErrorWithDetails) FormatForProtocol(protocol string) any {
 			// If value is []byte, encode as base64 (unpadded for Connect protocol)
 			if b, ok := d.Value.([]byte); ok {
 				detail["value"] = base64.RawStdEncoding.EncodeToString(b)
+				if debug := detailDebugJSON(d.Type, b); debug != nil {
+					detail["debug"] = debug
+				}
 			} else {
 				detail["value"] = d.Value
 			}
@@ -122,6 +133,45 @@ func (e *ErrorWithDetails) FormatForProtocol(protocol string) any {
 	}
 }
 
+// grpcStatusDetails encodes the google.rpc.Status of a gRPC error with its
+// protobuf details, for the grpc-status-details-bin trailer. It returns ""
+// if the error has no protobuf details.
+func grpcStatusDetails(err *Error) string {
+	st := &status.Status{Code: int32(grpcStatusCode(err.Code)), Message: err.Message} //nolint:gosec // gRPC codes fit in int32
+	for _, d := range err.anyDetails {
+		if value, ok := d.Value.([]byte); ok {
+			st.Details = append(st.Details, &anypb.Any{TypeUrl: anyTypeURLPrefix + d.Type, Value: value})
+		}
+	}
+	if len(st.Details) == 0 {
+		return ""
+	}
+	data, marshalErr := proto.Marshal(st)
+	if marshalErr != nil {
+		return ""
+	}
+	return base64.RawStdEncoding.EncodeToString(data)
+}
+
+// detailDebugJSON decodes a protobuf detail of a registered type into its
+// JSON form, sent as the "debug" field of Connect error details so JSON
+// clients can read details such as field violations without protobuf.
+func detailDebugJSON(typeName string, value []byte) json.RawMessage {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil
+	}
+	msg := mt.New().Interface()
+	if err := proto.Unmarshal(value, msg); err != nil {
+		return nil
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
 // GetDetails returns the error details.
 func (e *ErrorWithDetails) GetDetails() []*ErrorDetail {
 	return e.details
@@ -139,6 +189,9 @@ func (e *ErrorWithDetails) ToError(protocol string) *Error {
 			"details": details,
 		}
 	}
+	if protocol == protocolGRPC || protocol == protocolGRPCWeb {
+		err.anyDetails = e.details
+	}
 
 	return err
 }
@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// Error sanitizer defaults
+const (
+	defaultSanitizedMessage    = "internal error"
+	defaultCorrelationIDHeader = "X-Request-Id"
+	correlationIDBytes         = 8
+)
+
+// ErrorSanitizer replaces the messages of internal errors sent to clients,
+// which often hold raw Go errors, by a generic message with a correlation ID,
+// and logs the full errors under the same ID:
+//
+//	svc := rpc.NewService("UserService", rpc.WithErrorSanitizer(rpc.ErrorSanitizer{
+//		Logger:   logger,
+//		Messages: map[rpc.Code]string{rpc.CodeUnavailable: "service unavailable"},
+//	}))
+//
+// Clients then see "internal error (correlation ID 9f86d081884c7d65)" while
+// the log record holds the original error.
+type ErrorSanitizer struct {
+	// Message replaces the messages of internal and unknown errors
+	// (default "internal error")
+	Message string
+	// Messages overrides the message per code. Errors of the listed codes are
+	// sanitized with their message, and an empty message keeps the original
+	// messages of the code, including internal and unknown errors.
+	Messages map[Code]string
+	// Logger receives the full errors (default slog.Default())
+	Logger *slog.Logger
+	// CorrelationIDHeader is the request header whose value becomes the
+	// correlation ID, a random ID if unset (default "X-Request-Id")
+	CorrelationIDHeader string
+}
+
+// WithErrorSanitizer sanitizes the messages of errors sent to clients, see
+// ErrorSanitizer.
+func WithErrorSanitizer(sanitizer ErrorSanitizer) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ErrorSanitizer = &sanitizer
+	}
+}
+
+// message returns the message replacing the messages of errors with code, and
+// whether they are sanitized.
+func (es *ErrorSanitizer) message(code Code) (string, bool) {
+	if message, ok := es.Messages[code]; ok {
+		return message, message != ""
+	}
+	if code != CodeInternal && code != CodeUnknown {
+		return "", false
+	}
+	if es.Message != "" {
+		return es.Message, true
+	}
+	return defaultSanitizedMessage, true
+}
+
+// sanitize returns rpcErr with a sanitized message, logging the original error
+// cause of the call to procedure. Errors that are not sanitized are returned
+// as is; so are all errors when es is nil.
+func (es *ErrorSanitizer) sanitize(r *http.Request, procedure string, rpcErr *Error, cause error) *Error {
+	if es == nil {
+		return rpcErr
+	}
+	message, ok := es.message(rpcErr.Code)
+	if !ok {
+		return rpcErr
+	}
+
+	id := es.correlationID(r)
+	if cause == nil {
+		cause = rpcErr
+	}
+	es.logger().LogAttrs(context.Background(), slog.LevelError, "rpc error",
+		slog.String("method", procedure),
+		slog.String("code", string(rpcErr.Code)),
+		slog.String("correlation_id", id),
+		slog.String("error", cause.Error()),
+	)
+
+	// Details may hold what the message did, and are left out too
+	return &Error{
+		Code:    rpcErr.Code,
+		Message: message + " (correlation ID " + id + ")",
+		debug:   rpcErr.debug,
+	}
+}
+
+// logger returns the logger of es, slog.Default() if unset or es is nil.
+func (es *ErrorSanitizer) logger() *slog.Logger {
+	if es == nil || es.Logger == nil {
+		return slog.Default()
+	}
+	return es.Logger
+}
+
+// correlationID returns the correlation ID of the request.
+func (es *ErrorSanitizer) correlationID(r *http.Request) string {
+	header := es.CorrelationIDHeader
+	if header == "" {
+		header = defaultCorrelationIDHeader
+	}
+	if r != nil {
+		if id := r.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	b := make([]byte, correlationIDBytes)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,93 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type SanitizeRequest struct {
+	Code string `json:"code"`
+}
+
+type SanitizeResponse struct{}
+
+func TestErrorSanitizer(t *testing.T) {
+	newGateway := func(t *testing.T, sanitizer rpc.ErrorSanitizer) http.Handler {
+		t.Helper()
+		svc := rpc.NewService("FailService",
+			rpc.WithPackage("fail.v1"),
+			rpc.WithJSONRPC("/jsonrpc"),
+			rpc.WithErrorSanitizer(sanitizer),
+		)
+		rpc.MustRegister(svc, "Fail", func(_ context.Context, req *SanitizeRequest) (*SanitizeResponse, error) {
+			if req.Code == "" {
+				return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+			}
+			return nil, rpc.NewError(rpc.Code(req.Code), "db-primary is down")
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	call := func(gw http.Handler, path, body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		req.Header.Set("X-Request-Id", "req-42")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		var resp map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			panic(err)
+		}
+		return resp
+	}
+
+	t.Run("internal errors are replaced and logged", func(t *testing.T) {
+		var logs bytes.Buffer
+		gw := newGateway(t, rpc.ErrorSanitizer{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+		resp := call(gw, "/fail.v1.FailService/Fail", `{}`)
+		if resp["code"] != "internal" || resp["message"] != "internal error (correlation ID req-42)" {
+			t.Errorf("Expected a sanitized internal error, got %v", resp)
+		}
+		if !strings.Contains(logs.String(), "correlation_id=req-42") || !strings.Contains(logs.String(), "connection refused") {
+			t.Errorf("Expected the full error to be logged, got %s", logs.String())
+		}
+	})
+
+	t.Run("other codes keep their messages unless overridden", func(t *testing.T) {
+		gw := newGateway(t, rpc.ErrorSanitizer{
+			Logger:   slog.New(slog.DiscardHandler),
+			Messages: map[rpc.Code]string{rpc.CodeUnavailable: "try again later", rpc.CodeInternal: ""},
+		})
+		for code, want := range map[string]string{
+			"not_found":   "db-primary is down",
+			"unavailable": "try again later (correlation ID req-42)",
+			"internal":    "db-primary is down",
+		} {
+			if resp := call(gw, "/fail.v1.FailService/Fail", `{"code":"`+code+`"}`); resp["message"] != want {
+				t.Errorf("Expected %q for %s, got %v", want, code, resp)
+			}
+		}
+	})
+
+	t.Run("JSON-RPC errors are sanitized", func(t *testing.T) {
+		gw := newGateway(t, rpc.ErrorSanitizer{Message: "something went wrong", Logger: slog.New(slog.DiscardHandler)})
+		resp := call(gw, "/jsonrpc", `{"jsonrpc":"2.0","method":"Fail","params":{},"id":1}`)
+		rpcErr, _ := resp["error"].(map[string]any)
+		if rpcErr["message"] != "something went wrong (correlation ID req-42)" {
+			t.Errorf("Expected a sanitized JSON-RPC error, got %v", resp)
+		}
+	})
+}
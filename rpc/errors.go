@@ -3,7 +3,8 @@ package rpc
 
 import (
 	"fmt"
-	"net/http"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
 )
 
 // Code represents a Connect/gRPC error code.
@@ -34,6 +35,10 @@ type Error struct {
 	Code    Code           `json:"code"`
 	Message string         `json:"message"`
 	Details map[string]any `json:"details,omitempty"`
+
+	debug *DebugInfo // Set only in dev mode
+	// anyDetails are the protobuf details sent in grpc-status-details-bin
+	anyDetails []*ErrorDetail
 }
 
 // Error implements the error interface.
@@ -63,34 +68,18 @@ func (e *Error) WithDetails(details map[string]any) *Error {
 	return e
 }
 
-// httpStatusCodeMap maps error codes to HTTP status codes.
-var httpStatusCodeMap = map[Code]int{
-	CodeCanceled:           http.StatusRequestTimeout,
-	CodeUnknown:            http.StatusInternalServerError,
-	CodeInvalidArgument:    http.StatusBadRequest,
-	CodeDeadlineExceeded:   http.StatusRequestTimeout,
-	CodeNotFound:           http.StatusNotFound,
-	CodeAlreadyExists:      http.StatusConflict,
-	CodePermissionDenied:   http.StatusForbidden,
-	CodeResourceExhausted:  http.StatusTooManyRequests,
-	CodeFailedPrecondition: http.StatusPreconditionFailed,
-	CodeAborted:            http.StatusConflict,
-	CodeOutOfRange:         http.StatusBadRequest,
-	CodeUnimplemented:      http.StatusNotImplemented,
-	CodeInternal:           http.StatusInternalServerError,
-	CodeUnavailable:        http.StatusServiceUnavailable,
-	CodeDataLoss:           http.StatusInternalServerError,
-	CodeUnauthenticated:    http.StatusUnauthorized,
+// HTTPStatusCode returns the HTTP status code for the error code, as in the
+// Connect protocol. Connect unary and plain HTTP error responses have this
+// status; gRPC, gRPC-Web, and Connect streaming errors are sent with 200 OK
+// and carry their code in the response instead.
+func (c Code) HTTPStatusCode() int {
+	return grpcutil.HTTPStatus(string(c))
 }
 
-// HTTPStatusCode returns the HTTP status code for the error code.
-// For Connect protocol, most errors return 200 OK with error in body.
-// This is used for non-Connect protocol responses.
-func (c Code) HTTPStatusCode() int {
-	if status, ok := httpStatusCodeMap[c]; ok {
-		return status
-	}
-	return http.StatusInternalServerError
+// GRPCStatusCode returns the gRPC status code for the error code, as sent in
+// the grpc-status of gRPC and gRPC-Web responses.
+func (c Code) GRPCStatusCode() int {
+	return grpcStatusCode(c)
 }
 
 // Common error constructors for convenience.
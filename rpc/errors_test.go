@@ -58,15 +58,15 @@ func TestHTTPStatusCode(t *testing.T) {
 		code       rpc.Code
 		httpStatus int
 	}{
-		{rpc.CodeCanceled, 408},           // Request Timeout
+		{rpc.CodeCanceled, 499},           // Client Closed Request
 		{rpc.CodeUnknown, 500},            // Internal Server Error
 		{rpc.CodeInvalidArgument, 400},    // Bad Request
-		{rpc.CodeDeadlineExceeded, 408},   // Request Timeout
+		{rpc.CodeDeadlineExceeded, 504},   // Gateway Timeout
 		{rpc.CodeNotFound, 404},           // Not Found
 		{rpc.CodeAlreadyExists, 409},      // Conflict
 		{rpc.CodePermissionDenied, 403},   // Forbidden
 		{rpc.CodeResourceExhausted, 429},  // Too Many Requests
-		{rpc.CodeFailedPrecondition, 412}, // Precondition Failed
+		{rpc.CodeFailedPrecondition, 400}, // Bad Request
 		{rpc.CodeAborted, 409},            // Conflict
 		{rpc.CodeOutOfRange, 400},         // Bad Request
 		{rpc.CodeUnimplemented, 501},      // Not Implemented
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/i2y/hyperway/gateway"
+	hyperproto "github.com/i2y/hyperway/proto"
+)
+
+// ExportServices exports several services as one set of proto files, keyed
+// by file name. Each service describes itself in a file named after its
+// package, so exporting services of the same package one by one yields
+// conflicting files; here they are merged into one file declaring all the
+// services, with the messages they share defined once.
+func ExportServices(services ...*Service) (map[string]string, error) {
+	return ExportServicesWithOptions(services)
+}
+
+// ExportServicesWithOptions exports several services as one set of proto
+// files with language-specific options, see ExportServices.
+func ExportServicesWithOptions(services []*Service, options ...hyperproto.ExportOption) (map[string]string, error) {
+	fdset, err := ServicesFileDescriptorSet(services...)
+	if err != nil {
+		return nil, err
+	}
+
+	exportOpts := hyperproto.DefaultExportOptions()
+	exportOpts.ApplyOptions(options...)
+	return hyperproto.NewExporter(&exportOpts).ExportFileDescriptorSet(fdset)
+}
+
+// ServicesFileDescriptorSet returns the descriptors of several services,
+// merged as by ExportServices. Messages of the same name in one package must
+// be identical, and services must have distinct names.
+func ServicesFileDescriptorSet(services ...*Service) (*descriptorpb.FileDescriptorSet, error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services to export")
+	}
+	gatewaySvcs := make([]*gateway.Service, 0, len(services))
+	for _, svc := range services {
+		gatewaySvcs = append(gatewaySvcs, &gateway.Service{
+			Name:        svc.name,
+			Package:     svc.packageName,
+			Descriptors: svc.buildCompleteFileDescriptorSet(),
+		})
+	}
+	fdset, err := gateway.MergeDescriptors(gatewaySvcs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge services: %w", err)
+	}
+	return fdset, nil
+}
@@ -0,0 +1,330 @@
+package rpc
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// fieldMaskFields are the request fields whose mask selects the fields of
+// the response, in order of precedence.
+var fieldMaskFields = []string{"read_mask", "update_mask"}
+
+// ApplyFieldMask prunes msg, a pointer to a struct or a protobuf message, to
+// the fields named by the paths of mask, as in AIP-157 partial responses:
+// other fields are cleared. Paths are dot-separated field names, such as
+// "author.display_name", which apply to each element of repeated fields and
+// each value of maps. A nil or empty mask, or the path "*", keeps all fields.
+// Paths naming no field are an invalid argument, and msg is left unchanged.
+func ApplyFieldMask(msg any, mask *fieldmaskpb.FieldMask) error {
+	tree := newFieldMaskTree(mask.GetPaths())
+	if tree == nil || msg == nil {
+		return nil
+	}
+	if err := validateFieldMask(msg, reflect.TypeOf(msg), tree); err != nil {
+		return err
+	}
+	return pruneFieldMask(msg, tree)
+}
+
+// WithFieldMaskFiltering prunes the responses of methods whose request has
+// a read_mask (or else update_mask) google.protobuf.FieldMask field to the
+// paths of the mask, with ApplyFieldMask. Server streams prune each
+// message. Masks naming fields the response doesn't have fail the call with
+// CodeInvalidArgument before the handler runs:
+//
+//	type GetBookRequest struct {
+//		Name     string                 `json:"name"`
+//		ReadMask *fieldmaskpb.FieldMask `json:"read_mask"`
+//	}
+func WithFieldMaskFiltering(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.FieldMaskFiltering = enabled
+	}
+}
+
+// WithFieldMaskFiltering overrides the field mask filtering of the service
+// for the method.
+func (m *MethodBuilder) WithFieldMaskFiltering(enabled bool) *MethodBuilder {
+	m.method.Options.FieldMaskFiltering = &enabled
+	return m
+}
+
+// fieldMaskFiltering reports whether responses of method are pruned to the
+// field mask of their request.
+func (s *Service) fieldMaskFiltering(method *Method) bool {
+	if method.Options.FieldMaskFiltering != nil {
+		return *method.Options.FieldMaskFiltering
+	}
+	return s.options.FieldMaskFiltering
+}
+
+// responseFieldMask returns the field mask of the request input to prune the
+// responses of method to, validated against the response type, or nil if
+// responses are sent whole.
+func (s *Service) responseFieldMask(method *Method, input reflect.Value) (fieldMaskTree, error) {
+	if !s.fieldMaskFiltering(method) || !input.IsValid() || !input.CanInterface() {
+		return nil, nil
+	}
+	tree := newFieldMaskTree(requestFieldMask(input.Interface()))
+	if tree == nil {
+		return nil, nil
+	}
+	var output any
+	if method.ProtoOutput != nil {
+		output = method.ProtoOutput
+	}
+	if err := validateFieldMask(output, method.OutputType, tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// requestFieldMask returns the paths of the first field mask field of a
+// request message, if it has one.
+func requestFieldMask(input any) []string {
+	if msg, ok := input.(proto.Message); ok {
+		m := msg.ProtoReflect()
+		for _, name := range fieldMaskFields {
+			fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+			if fd == nil || fd.Message() == nil || fd.Message().FullName() != "google.protobuf.FieldMask" || !m.Has(fd) {
+				continue
+			}
+			mask := m.Get(fd).Message()
+			paths := mask.Get(mask.Descriptor().Fields().ByName("paths")).List()
+			values := make([]string, paths.Len())
+			for i := range values {
+				values[i] = paths.Get(i).String()
+			}
+			return values
+		}
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(input))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, name := range fieldMaskFields {
+		field := structFieldByPathSegment(v, name)
+		if !field.IsValid() {
+			continue
+		}
+		if mask, ok := field.Interface().(*fieldmaskpb.FieldMask); ok && mask != nil {
+			return mask.GetPaths()
+		}
+	}
+	return nil
+}
+
+// fieldMaskTree holds the paths of a field mask by segment. A nil subtree
+// keeps the whole field.
+type fieldMaskTree map[string]fieldMaskTree
+
+// newFieldMaskTree returns the tree of paths, or nil if they keep all fields.
+func newFieldMaskTree(paths []string) fieldMaskTree {
+	tree := fieldMaskTree{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "*" {
+			return nil
+		}
+		if path == "" {
+			continue
+		}
+		tree.add(strings.Split(path, "."))
+	}
+	if len(tree) == 0 {
+		return nil
+	}
+	return tree
+}
+
+// add adds the path of segments to the tree. Paths keeping a whole field
+// take precedence over paths into it.
+func (t fieldMaskTree) add(segments []string) {
+	subtree, seen := t[segments[0]]
+	switch {
+	case len(segments) == 1:
+		t[segments[0]] = nil
+	case seen && subtree == nil:
+		// The whole field is kept already
+	default:
+		if subtree == nil {
+			subtree = fieldMaskTree{}
+			t[segments[0]] = subtree
+		}
+		subtree.add(segments[1:])
+	}
+}
+
+// validateFieldMask fails with the first path of tree naming no field of the
+// message type of msg, a protobuf message, or else of the struct type t.
+func validateFieldMask(msg any, t reflect.Type, tree fieldMaskTree) error {
+	if msg, ok := msg.(proto.Message); ok {
+		return validateProtoFieldMask(msg.ProtoReflect().Descriptor(), tree, "")
+	}
+	return validateStructFieldMask(t, tree, "")
+}
+
+// validateStructFieldMask validates tree against the struct type t.
+func validateStructFieldMask(t reflect.Type, tree fieldMaskTree, prefix string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, segment := range slices.Sorted(maps.Keys(tree)) {
+		subtree := tree[segment]
+		field, ok := reflect.StructField{}, false
+		if t.Kind() == reflect.Struct {
+			field, ok = structFieldByName(t, segment)
+		}
+		if !ok {
+			return NewErrorf(CodeInvalidArgument, "invalid field mask path %q", prefix+segment)
+		}
+		if subtree == nil {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+			ft = ft.Elem()
+		}
+		if err := validateStructFieldMask(ft, subtree, prefix+segment+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateProtoFieldMask validates tree against the message descriptor md.
+func validateProtoFieldMask(md protoreflect.MessageDescriptor, tree fieldMaskTree, prefix string) error {
+	for _, segment := range slices.Sorted(maps.Keys(tree)) {
+		subtree := tree[segment]
+		var fd protoreflect.FieldDescriptor
+		if md != nil {
+			fd = protoFieldBySegment(md, segment)
+		}
+		if fd == nil {
+			return NewErrorf(CodeInvalidArgument, "invalid field mask path %q", prefix+segment)
+		}
+		if subtree == nil {
+			continue
+		}
+		next := fd.Message()
+		if fd.IsMap() {
+			next = fd.MapValue().Message()
+		}
+		if err := validateProtoFieldMask(next, subtree, prefix+segment+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoFieldBySegment finds the field of md named by a path segment, by
+// protobuf or JSON name.
+func protoFieldBySegment(md protoreflect.MessageDescriptor, segment string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(segment)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByJSONName(segment)
+}
+
+// pruneFieldMask clears the fields of msg not in the validated tree.
+func pruneFieldMask(msg any, tree fieldMaskTree) error {
+	if msg, ok := msg.(proto.Message); ok {
+		pruneProtoMessage(msg.ProtoReflect(), tree)
+		return nil
+	}
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Pointer {
+		return fmt.Errorf("cannot apply a field mask to %T, a pointer is required", msg)
+	}
+	pruneStructValue(v, tree)
+	return nil
+}
+
+// pruneStructValue clears the fields of the struct in v, through pointers,
+// slices, and maps, not in tree.
+func pruneStructValue(v reflect.Value, tree fieldMaskTree) {
+	switch v.Kind() { //nolint:exhaustive // Other kinds contain no messages
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			pruneStructValue(v.Elem(), tree)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			pruneStructValue(v.Index(i), tree)
+		}
+	case reflect.Map:
+		// Map values aren't addressable, so they are pruned as copies
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			pruneStructValue(value, tree)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		if !v.CanSet() {
+			return
+		}
+		kept := make(map[string]fieldMaskTree, len(tree))
+		for segment, subtree := range tree {
+			if field, ok := structFieldByName(v.Type(), segment); ok {
+				kept[fmt.Sprint(field.Index)] = subtree
+			}
+		}
+		for _, messageField := range schema.MessageFields(v.Type()) {
+			field, err := v.FieldByIndexErr(messageField.Index)
+			if err != nil || !field.CanSet() {
+				continue
+			}
+			subtree, ok := kept[fmt.Sprint(messageField.Index)]
+			switch {
+			case !ok:
+				field.SetZero()
+			case subtree != nil:
+				pruneStructValue(field, subtree)
+			}
+		}
+	}
+}
+
+// pruneProtoMessage clears the fields of msg not in tree.
+func pruneProtoMessage(msg protoreflect.Message, tree fieldMaskTree) {
+	var cleared []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		subtree, ok := tree[string(fd.Name())]
+		if !ok {
+			subtree, ok = tree[fd.JSONName()]
+		}
+		switch {
+		case !ok:
+			cleared = append(cleared, fd)
+		case subtree == nil:
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := range list.Len() {
+				pruneProtoMessage(list.Get(i).Message(), subtree)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(_ protoreflect.MapKey, entry protoreflect.Value) bool {
+				pruneProtoMessage(entry.Message(), subtree)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsMap():
+			pruneProtoMessage(value.Message(), subtree)
+		}
+		return true
+	})
+	for _, fd := range cleared {
+		msg.Clear(fd)
+	}
+}
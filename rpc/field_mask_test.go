@@ -0,0 +1,181 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type BookAuthor struct {
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+}
+
+type Book struct {
+	Title    string                `json:"title"`
+	Pages    int32                 `json:"pages"`
+	Author   *BookAuthor           `json:"author"`
+	Editors  []BookAuthor          `json:"editors"`
+	Sections map[string]BookAuthor `json:"sections"`
+}
+
+type GetBookRequest struct {
+	Name     string                 `json:"name"`
+	ReadMask *fieldmaskpb.FieldMask `json:"read_mask"`
+}
+
+func newBook() *Book {
+	return &Book{
+		Title:    "Go",
+		Pages:    380,
+		Author:   &BookAuthor{DisplayName: "Alan", Email: "alan@example.com"},
+		Editors:  []BookAuthor{{DisplayName: "Brian", Email: "brian@example.com"}},
+		Sections: map[string]BookAuthor{"intro": {DisplayName: "Rob", Email: "rob@example.com"}},
+	}
+}
+
+func TestApplyFieldMask(t *testing.T) {
+	t.Run("structs", func(t *testing.T) {
+		book := newBook()
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"title", "author.display_name", "editors.email", "sections.displayName"}}
+		if err := rpc.ApplyFieldMask(book, mask); err != nil {
+			t.Fatalf("ApplyFieldMask failed: %v", err)
+		}
+		want := &Book{
+			Title:    "Go",
+			Author:   &BookAuthor{DisplayName: "Alan"},
+			Editors:  []BookAuthor{{Email: "brian@example.com"}},
+			Sections: map[string]BookAuthor{"intro": {DisplayName: "Rob"}},
+		}
+		got, _ := json.Marshal(book)
+		expected, _ := json.Marshal(want)
+		if string(got) != string(expected) {
+			t.Errorf("got %s, want %s", got, expected)
+		}
+	})
+
+	t.Run("whole fields take precedence", func(t *testing.T) {
+		book := newBook()
+		if err := rpc.ApplyFieldMask(book, &fieldmaskpb.FieldMask{Paths: []string{"author.email", "author"}}); err != nil {
+			t.Fatalf("ApplyFieldMask failed: %v", err)
+		}
+		if book.Title != "" || book.Author.DisplayName != "Alan" || book.Author.Email == "" {
+			t.Errorf("Expected only the whole author, got %+v", book)
+		}
+	})
+
+	t.Run("empty masks and wildcards keep all fields", func(t *testing.T) {
+		for _, mask := range []*fieldmaskpb.FieldMask{nil, {}, {Paths: []string{"*"}}} {
+			book := newBook()
+			if err := rpc.ApplyFieldMask(book, mask); err != nil || book.Pages != 380 || book.Author.Email == "" {
+				t.Errorf("Expected %v to keep all fields, got %+v (%v)", mask, book, err)
+			}
+		}
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		book := newBook()
+		err := rpc.ApplyFieldMask(book, &fieldmaskpb.FieldMask{Paths: []string{"title", "author.nickname"}})
+		var rpcErr *rpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeInvalidArgument || !strings.Contains(err.Error(), "author.nickname") {
+			t.Errorf("Expected invalid_argument for author.nickname, got %v", err)
+		}
+		if book.Pages != 380 {
+			t.Error("Expected the message to be left unchanged")
+		}
+	})
+
+	t.Run("protobuf messages", func(t *testing.T) {
+		msg, _ := structpb.NewStruct(map[string]any{"a": 1})
+		value := structpb.NewStructValue(msg)
+		if err := rpc.ApplyFieldMask(value, &fieldmaskpb.FieldMask{Paths: []string{"number_value"}}); err != nil {
+			t.Fatalf("ApplyFieldMask failed: %v", err)
+		}
+		if value.GetStructValue() != nil {
+			t.Errorf("Expected struct_value to be cleared, got %v", value)
+		}
+		var rpcErr *rpc.Error
+		if err := rpc.ApplyFieldMask(value, &fieldmaskpb.FieldMask{Paths: []string{"missing"}}); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeInvalidArgument {
+			t.Errorf("Expected invalid_argument, got %v", err)
+		}
+	})
+}
+
+func TestFieldMaskFiltering(t *testing.T) {
+	handlerCalls := 0
+	svc := rpc.NewService("BookService", rpc.WithPackage("book.v1"), rpc.WithFieldMaskFiltering(true))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewMethod("GetBook", func(_ context.Context, _ *GetBookRequest) (*Book, error) {
+			handlerCalls++
+			return newBook(), nil
+		}),
+		rpc.NewMethod("GetFullBook", func(_ context.Context, _ *GetBookRequest) (*Book, error) {
+			return newBook(), nil
+		}).WithFieldMaskFiltering(false),
+		rpc.NewServerStreamMethod("ListBooks", func(_ context.Context, _ *GetBookRequest, stream rpc.ServerStream[Book]) error {
+			return stream.Send(newBook())
+		}),
+	)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/book.v1.BookService/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	masked := `{"name":"go","read_mask":{"paths":["title","author.display_name"]}}`
+
+	t.Run("responses are pruned to the read mask", func(t *testing.T) {
+		rec := call("GetBook", masked)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var book Book
+		if err := json.Unmarshal(rec.Body.Bytes(), &book); err != nil {
+			t.Fatalf("Failed to decode %s: %v", rec.Body, err)
+		}
+		if book.Title != "Go" || book.Pages != 0 || book.Author == nil || book.Author.Email != "" || len(book.Editors) != 0 {
+			t.Errorf("Expected the masked book, got %s", rec.Body)
+		}
+	})
+
+	t.Run("requests without a mask get the whole response", func(t *testing.T) {
+		if rec := call("GetBook", `{"name":"go"}`); !strings.Contains(rec.Body.String(), "alan@example.com") {
+			t.Errorf("Expected the whole book, got %s", rec.Body)
+		}
+		if rec := call("GetFullBook", masked); !strings.Contains(rec.Body.String(), "alan@example.com") {
+			t.Errorf("Expected the method override to send the whole book, got %s", rec.Body)
+		}
+	})
+
+	t.Run("invalid masks fail before the handler", func(t *testing.T) {
+		handlerCalls = 0
+		rec := call("GetBook", `{"read_mask":{"paths":["isbn"]}}`)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "isbn") {
+			t.Errorf("Expected invalid_argument, got %d: %s", rec.Code, rec.Body)
+		}
+		if handlerCalls != 0 {
+			t.Error("Expected the handler not to be called")
+		}
+	})
+
+	t.Run("stream messages are pruned", func(t *testing.T) {
+		rec := call("ListBooks", masked)
+		if body := rec.Body.String(); !strings.Contains(body, `"title":"Go"`) || strings.Contains(body, "alan@example.com") {
+			t.Errorf("Expected masked stream messages, got %s", body)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type GraphQLAddress struct {
+	City string `json:"city"`
+}
+
+type GraphQLUser struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Age     int32           `json:"age"`
+	Tags    []string        `json:"tags"`
+	Address *GraphQLAddress `json:"address"`
+}
+
+type GetGraphQLUserRequest struct {
+	ID string `json:"id"`
+}
+
+type CreateGraphQLUserRequest struct {
+	User *GraphQLUser `json:"user"`
+}
+
+type WatchGraphQLUsersRequest struct {
+	Count int32 `json:"count"`
+}
+
+func newGraphQLTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	svc := rpc.NewService("UserService", rpc.WithPackage("graphql.v1"), rpc.WithGraphQL(true))
+	rpc.MustRegister(svc, "GetUser", func(ctx context.Context, req *GetGraphQLUserRequest) (*GraphQLUser, error) {
+		if req.ID != "1" {
+			return nil, rpc.NewError(rpc.CodeNotFound, "user "+req.ID+" not found")
+		}
+		return &GraphQLUser{ID: "1", Name: "Alice", Age: 30, Tags: []string{"admin"}, Address: &GraphQLAddress{City: "Tokyo"}}, nil
+	})
+	rpc.MustRegister(svc, "CreateUser", func(ctx context.Context, req *CreateGraphQLUserRequest) (*GraphQLUser, error) {
+		user := req.User
+		user.ID = "2"
+		return user, nil
+	})
+	rpc.MustRegisterServerStream(svc, "WatchUsers", func(ctx context.Context, req *WatchGraphQLUsersRequest, stream rpc.ServerStream[GraphQLUser]) error {
+		for i := int32(0); i < req.Count; i++ {
+			if err := stream.Send(&GraphQLUser{Name: strings.Repeat("x", int(i)+1)}); err != nil {
+				return err
+			}
+		}
+		return rpc.NewError(rpc.CodeAborted, "watch ended")
+	})
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postGraphQL posts a GraphQL request and returns the response body.
+func postGraphQL(t *testing.T, url, query string, variables map[string]any) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	resp, err := http.Post(url+"/graphql", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestGraphQLQueriesAndMutations(t *testing.T) {
+	server := newGraphQLTestServer(t)
+
+	t.Run("query with alias and fragment", func(t *testing.T) {
+		result := postGraphQL(t, server.URL, `
+			query Get($id: String!) {
+				alice: getUser(id: $id) { ...UserFields address { city } }
+				__typename
+			}
+			fragment UserFields on GraphQLUser { id name tags }`, map[string]any{"id": "1"})
+		want := `{"data":{"alice":{"id":"1","name":"Alice","tags":["admin"],"address":{"city":"Tokyo"}},"__typename":"Query"}}`
+		if result != want {
+			t.Errorf("Expected %s, got %s", want, result)
+		}
+	})
+
+	t.Run("mutation", func(t *testing.T) {
+		result := postGraphQL(t, server.URL, `mutation {
+			createUser(user: {name: "Bob", age: 40}) { id name age }
+		}`, nil)
+		want := `{"data":{"createUser":{"id":"2","name":"Bob","age":40}}}`
+		if result != want {
+			t.Errorf("Expected %s, got %s", want, result)
+		}
+	})
+
+	t.Run("method error", func(t *testing.T) {
+		result := postGraphQL(t, server.URL, `{ getUser(id: "9") { id } }`, nil)
+		want := `{"data":{"getUser":null},"errors":[{"message":"user 9 not found","path":["getUser"],"extensions":{"code":"NOT_FOUND"}}]}`
+		if result != want {
+			t.Errorf("Expected %s, got %s", want, result)
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		result := postGraphQL(t, server.URL, `{ getUser(id: "1") { email } }`, nil)
+		if result != `{"errors":[{"message":"Cannot query field \"email\" on type \"GraphQLUser\".","path":["getUser","email"]}]}` {
+			t.Errorf("Expected an error for the unknown field, got %s", result)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		result := postGraphQL(t, server.URL, `{ getUser(id: "1") { id }`, nil)
+		if !strings.HasPrefix(result, `{"errors":[{"message":"Syntax Error:`) {
+			t.Errorf("Expected only a syntax error, got %s", result)
+		}
+	})
+
+	t.Run("too many root fields", func(t *testing.T) {
+		var query strings.Builder
+		query.WriteString("{")
+		for i := range 101 {
+			fmt.Fprintf(&query, ` u%d: getUser(id: "1") { id }`, i)
+		}
+		query.WriteString(" }")
+		result := postGraphQL(t, server.URL, query.String(), nil)
+		if !strings.Contains(result, "more than the maximum of 100") || strings.Contains(result, `"data"`) {
+			t.Errorf("Expected the operation to be rejected, got %s", result)
+		}
+	})
+
+	t.Run("mutation over GET", func(t *testing.T) {
+		resp, err := http.Get(server.URL + `/graphql?query=mutation{createUser{id}}`)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestGraphQLSchema(t *testing.T) {
+	server := newGraphQLTestServer(t)
+
+	resp, err := http.Get(server.URL + "/graphql/schema.graphql")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	sdl, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"getUser(id: String): GraphQLUser",
+		"createUser(user: GraphQLUserInput): GraphQLUser",
+		"watchUsers(count: Int): GraphQLUser",
+		"tags: [String!]!",
+	} {
+		if !strings.Contains(string(sdl), want) {
+			t.Errorf("Expected SDL to contain %q, got:\n%s", want, sdl)
+		}
+	}
+
+	result := postGraphQL(t, server.URL, `{
+		__schema { queryType { name } mutationType { name } subscriptionType { name } }
+		__type(name: "GraphQLUser") { kind fields { name type { kind ofType { kind ofType { name } } } } }
+	}`, nil)
+	for _, want := range []string{
+		`"queryType":{"name":"Query"},"mutationType":{"name":"Mutation"},"subscriptionType":{"name":"Subscription"}`,
+		`{"name":"tags","type":{"kind":"NON_NULL","ofType":{"kind":"LIST","ofType":{"name":null}}}}`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected introspection to contain %s, got %s", want, result)
+		}
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	server := newGraphQLTestServer(t)
+
+	body := `{"query":"subscription { watchUsers(count: 2) { name } }"}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+	events, _ := io.ReadAll(resp.Body)
+	want := "event: next\ndata: {\"data\":{\"watchUsers\":{\"name\":\"x\"}}}\n\n" +
+		"event: next\ndata: {\"data\":{\"watchUsers\":{\"name\":\"xx\"}}}\n\n" +
+		"event: next\ndata: {\"errors\":[{\"message\":\"watch ended\",\"path\":[\"watchUsers\"],\"extensions\":{\"code\":\"ABORTED\"}}]}\n\n" +
+		"event: complete\ndata:\n\n"
+	if string(events) != want {
+		t.Errorf("Expected events:\n%s\ngot:\n%s", want, events)
+	}
+}
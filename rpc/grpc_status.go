@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+)
+
+// WithStrictGRPC enables strict conformance to the gRPC over HTTP/2 spec for
+// gRPC responses, as expected by grpc-go and other official clients: errors
+// before the first message are sent as trailers-only responses carrying the
+// handler's metadata, status codes follow grpc-go's mapping of wrapped and
+// context errors, and the content type follows the request. Responses always
+// use HTTP status 200.
+func WithStrictGRPC(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StrictGRPC = enabled
+	}
+}
+
+// grpcErrorFor converts an error to the *Error reported in a gRPC status. In
+// strict mode, wrapped errors are unwrapped, context errors map to
+// DEADLINE_EXCEEDED and CANCELLED, and other errors to UNKNOWN, like grpc-go
+// servers do.
+func grpcErrorFor(err error, strict bool) *Error {
+	if !strict {
+		switch e := err.(type) {
+		case *Error:
+			return e
+		case *ErrorWithDetails:
+			return e.ToError(protocolGRPC)
+		default:
+			return NewError(CodeInternal, err.Error())
+		}
+	}
+
+	var withDetails *ErrorWithDetails
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &withDetails):
+		return withDetails.ToError(protocolGRPC)
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewError(CodeDeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return NewError(CodeCanceled, err.Error())
+	default:
+		return NewError(CodeUnknown, err.Error())
+	}
+}
+
+// grpcStatusDetailsHeader carries the google.rpc.Status of gRPC errors.
+const grpcStatusDetailsHeader = "grpc-status-details-bin"
+
+// codeForGRPCStatus returns the error code of a gRPC status code.
+func codeForGRPCStatus(status int) Code {
+	return Code(grpcutil.CodeForGRPCStatus(status))
+}
+
+// setGRPCStatus sets the grpc-status and grpc-message fields of h, and
+// grpc-status-details-bin for errors with protobuf details.
+func setGRPCStatus(h http.Header, err *Error) {
+	h.Set("grpc-status", strconv.Itoa(grpcStatusCode(err.Code)))
+	h.Set("grpc-message", grpcutil.EncodeMessage(err.Message))
+	if details := grpcStatusDetails(err); details != "" {
+		h.Set(grpcStatusDetailsHeader, details)
+	}
+}
+
+// setGRPCTrailers adds trailers set by a handler after the response headers
+// were written. They use the http.TrailerPrefix, since only grpc-status and
+// grpc-message are declared up front.
+func setGRPCTrailers(h http.Header, trailers map[string][]string) {
+	for key, values := range trailers {
+		for _, value := range values {
+			h.Add(http.TrailerPrefix+key, value)
+		}
+	}
+}
+
+// writeGRPCError writes a gRPC error response. The HTTP status is always 200
+// and the status travels in the grpc-status and grpc-message headers, which
+// makes it a trailers-only response when no message was written. In strict
+// mode the content type follows the request, and the headers and trailers set
+// by the handler are included, since a trailers-only response has a single
+// header block. hctx may be nil.
+func (s *Service) writeGRPCError(w http.ResponseWriter, r *http.Request, hctx *handlerContext, err error) {
+	strict := s.options.StrictGRPC
+	rpcErr := s.options.ErrorSanitizer.sanitize(r, r.URL.Path, grpcErrorFor(err, strict), err)
+	recordStatus(r.Context(), rpcErr.Code)
+
+	h := w.Header()
+	if strict {
+		h.Set("Content-Type", determineContentType(r))
+		if hctx != nil {
+			for _, metadata := range []map[string][]string{hctx.responseHeaders, hctx.responseTrailers} {
+				for key, values := range metadata {
+					for _, value := range values {
+						h.Add(key, value)
+					}
+				}
+			}
+		}
+	} else {
+		h.Set("Content-Type", contentTypeGRPCProto)
+	}
+	setGRPCStatus(h, rpcErr)
+	w.WriteHeader(http.StatusOK)
+}
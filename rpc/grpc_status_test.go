@@ -0,0 +1,325 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ConformanceRequest struct {
+	Text string `json:"text"`
+}
+
+type ConformanceResponse struct {
+	Text string `json:"text"`
+}
+
+// grpcJSONCodec is a grpc-go codec for the gRPC+JSON content type.
+type grpcJSONCodec struct{}
+
+func (grpcJSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (grpcJSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (grpcJSONCodec) Name() string                       { return "json" }
+
+// grpcRawCodec is a grpc-go codec that sends pre-encoded messages of a content subtype.
+type grpcRawCodec struct{ subtype string }
+
+func (grpcRawCodec) Marshal(v any) ([]byte, error) { return *v.(*[]byte), nil }
+func (grpcRawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+func (c grpcRawCodec) Name() string { return c.subtype }
+
+// conformanceText encodes a ConformanceRequest or ConformanceResponse as protobuf.
+func conformanceText(text string) []byte {
+	if text == "" {
+		return []byte{}
+	}
+	return protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), text)
+}
+
+func newConformanceClient(t *testing.T, strict bool) *grpc.ClientConn {
+	t.Helper()
+	svc := rpc.NewService("ConformanceService", rpc.WithPackage("conformance.v1"), rpc.WithStrictGRPC(strict))
+	rpc.MustRegister(svc, "Echo", func(ctx context.Context, req *ConformanceRequest) (*ConformanceResponse, error) {
+		hctx := rpc.GetHandlerContext(ctx)
+		hctx.SetResponseHeader("X-Header", "header")
+		hctx.SetResponseTrailer("X-Trailer", "trailer")
+		switch req.Text {
+		case "not found":
+			return nil, rpc.NewError(rpc.CodeNotFound, "café 100% missing\n")
+		case "wrapped":
+			return nil, fmt.Errorf("lookup: %w", rpc.NewError(rpc.CodePermissionDenied, "denied"))
+		case "deadline":
+			return nil, fmt.Errorf("backend: %w", context.DeadlineExceeded)
+		case "plain":
+			return nil, errors.New("boom")
+		case "unsafe metadata":
+			hctx.SetResponseHeader("X-Note", "line 1\nline 2")
+			hctx.SetResponseTrailer("X-Data-Bin", "\x00\xff")
+		case "binary metadata":
+			md := rpc.Meta(ctx)
+			md.SetHeader(rpc.Pairs("x-echo-bin", md.Get("x-token-bin")))
+			md.SetTrailer(rpc.Pairs("x-text-bin", "abc"))
+		}
+		return &ConformanceResponse{Text: req.Text}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "Stream", func(ctx context.Context, req *ConformanceRequest, stream rpc.ServerStream[ConformanceResponse]) error {
+		rpc.GetHandlerContext(ctx).SetResponseTrailer("X-Trailer", "trailer")
+		if req.Text == "fail" {
+			return rpc.NewError(rpc.CodeFailedPrecondition, "not ready")
+		}
+		for _, text := range []string{"a", "b"} {
+			if err := stream.Send(&ConformanceResponse{Text: text}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestStrictGRPC(t *testing.T) {
+	conn := newConformanceClient(t, true)
+	ctx := context.Background()
+	echo := func(text string, opts ...grpc.CallOption) (*ConformanceResponse, error) {
+		var out ConformanceResponse
+		opts = append(opts, grpc.ForceCodec(grpcJSONCodec{}))
+		err := conn.Invoke(ctx, "/conformance.v1.ConformanceService/Echo", &ConformanceRequest{Text: text}, &out, opts...)
+		return &out, err
+	}
+
+	t.Run("success with metadata", func(t *testing.T) {
+		var header, trailer metadata.MD
+		out, err := echo("hello", grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out.Text != "hello" {
+			t.Errorf("Expected echo %q, got %q", "hello", out.Text)
+		}
+		if got := header.Get("x-header"); len(got) != 1 || got[0] != "header" {
+			t.Errorf("Expected header x-header, got %v", header)
+		}
+		if got := trailer.Get("x-trailer"); len(got) != 1 || got[0] != "trailer" {
+			t.Errorf("Expected trailer x-trailer, got %v", trailer)
+		}
+	})
+
+	t.Run("trailers-only error", func(t *testing.T) {
+		var header, trailer metadata.MD
+		_, err := echo("not found", grpc.Header(&header), grpc.Trailer(&trailer))
+		st := status.Convert(err)
+		if st.Code() != codes.NotFound || st.Message() != "café 100% missing\n" {
+			t.Errorf("Expected NotFound with the original message, got %v %q", st.Code(), st.Message())
+		}
+		// Trailers-only responses carry headers and trailers in one block
+		if got := trailer.Get("x-header"); len(got) != 1 || got[0] != "header" {
+			t.Errorf("Expected x-header in the trailers-only response, got %v", trailer)
+		}
+		if got := trailer.Get("x-trailer"); len(got) != 1 || got[0] != "trailer" {
+			t.Errorf("Expected x-trailer in the trailers-only response, got %v", trailer)
+		}
+	})
+
+	t.Run("status mapping", func(t *testing.T) {
+		tests := []struct {
+			text string
+			want codes.Code
+		}{
+			{"wrapped", codes.PermissionDenied},
+			{"deadline", codes.DeadlineExceeded},
+			{"plain", codes.Unknown},
+		}
+		for _, tt := range tests {
+			if _, err := echo(tt.text); status.Code(err) != tt.want {
+				t.Errorf("%s: expected %v, got %v", tt.text, tt.want, err)
+			}
+		}
+	})
+
+	t.Run("zero-length messages", func(t *testing.T) {
+		in, out := conformanceText(""), []byte("not empty")
+		err := conn.Invoke(ctx, "/conformance.v1.ConformanceService/Echo", &in, &out, grpc.ForceCodec(grpcRawCodec{"proto"}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(out) != 0 {
+			t.Errorf("Expected an empty response message, got %x", out)
+		}
+
+		// An empty gRPC+JSON message is the default value too
+		in, out = []byte{}, nil
+		err = conn.Invoke(ctx, "/conformance.v1.ConformanceService/Echo", &in, &out, grpc.ForceCodec(grpcRawCodec{"json"}))
+		if err != nil || string(out) != `{"text":""}` {
+			t.Errorf("Expected an empty JSON request to decode, got %s, %v", out, err)
+		}
+	})
+
+	streamDesc := &grpc.StreamDesc{StreamName: "Stream", ServerStreams: true}
+	openStream := func(text string) (grpc.ClientStream, error) {
+		stream, err := conn.NewStream(ctx, streamDesc, "/conformance.v1.ConformanceService/Stream", grpc.ForceCodec(grpcRawCodec{"proto"}))
+		if err != nil {
+			return nil, err
+		}
+		in := conformanceText(text)
+		if err := stream.SendMsg(&in); err != nil {
+			return nil, err
+		}
+		return stream, stream.CloseSend()
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		stream, err := openStream("ok")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			var msg []byte
+			if err := stream.RecvMsg(&msg); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				break
+			}
+			got = append(got, string(msg))
+		}
+		if len(got) != 2 || got[0] != string(conformanceText("a")) || got[1] != string(conformanceText("b")) {
+			t.Errorf("Unexpected messages %q", got)
+		}
+		if trailer := stream.Trailer().Get("x-trailer"); len(trailer) != 1 || trailer[0] != "trailer" {
+			t.Errorf("Expected trailer x-trailer, got %v", stream.Trailer())
+		}
+	})
+
+	t.Run("stream trailers-only error", func(t *testing.T) {
+		stream, err := openStream("fail")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg []byte
+		err = stream.RecvMsg(&msg)
+		if st := status.Convert(err); st.Code() != codes.FailedPrecondition || st.Message() != "not ready" {
+			t.Errorf("Expected FailedPrecondition, got %v", err)
+		}
+		if trailer := stream.Trailer().Get("x-trailer"); len(trailer) != 1 || trailer[0] != "trailer" {
+			t.Errorf("Expected trailer x-trailer, got %v", stream.Trailer())
+		}
+	})
+}
+
+func TestGRPCResponseMetadata(t *testing.T) {
+	conn := newConformanceClient(t, false)
+
+	var header, trailer metadata.MD
+	var out ConformanceResponse
+	err := conn.Invoke(context.Background(), "/conformance.v1.ConformanceService/Echo", &ConformanceRequest{Text: "hello"}, &out,
+		grpc.ForceCodec(grpcJSONCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := header.Get("x-header"); len(got) != 1 || got[0] != "header" {
+		t.Errorf("Expected header x-header, got %v", header)
+	}
+	if got := trailer.Get("x-trailer"); len(got) != 1 || got[0] != "trailer" {
+		t.Errorf("Expected trailer x-trailer, got %v", trailer)
+	}
+
+	t.Run("encoded status message", func(t *testing.T) {
+		err := conn.Invoke(context.Background(), "/conformance.v1.ConformanceService/Echo", &ConformanceRequest{Text: "not found"}, &out,
+			grpc.ForceCodec(grpcJSONCodec{}))
+		if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "café 100% missing\n" {
+			t.Errorf("Expected NotFound with the original message, got %v %q", st.Code(), st.Message())
+		}
+	})
+
+	t.Run("sanitized metadata", func(t *testing.T) {
+		var header, trailer metadata.MD
+		err := conn.Invoke(context.Background(), "/conformance.v1.ConformanceService/Echo", &ConformanceRequest{Text: "unsafe metadata"}, &out,
+			grpc.ForceCodec(grpcJSONCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := header.Get("x-note"); len(got) != 1 || got[0] != "line 1%0Aline 2" {
+			t.Errorf("Expected a percent-encoded x-note header, got %v", header)
+		}
+		if got := trailer.Get("x-data-bin"); len(got) != 1 || got[0] != "\x00\xff" {
+			t.Errorf("Expected binary trailer x-data-bin, got %v", trailer)
+		}
+	})
+
+	t.Run("binary metadata", func(t *testing.T) {
+		var header, trailer metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-token-bin", "\x01\x02")
+		err := conn.Invoke(ctx, "/conformance.v1.ConformanceService/Echo", &ConformanceRequest{Text: "binary metadata"}, &out,
+			grpc.ForceCodec(grpcJSONCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := header.Get("x-echo-bin"); len(got) != 1 || got[0] != "\x01\x02" {
+			t.Errorf("Expected the decoded request value echoed in x-echo-bin, got %v", header)
+		}
+		if got := trailer.Get("x-text-bin"); len(got) != 1 || got[0] != "abc" {
+			t.Errorf("Expected printable binary trailer x-text-bin, got %v", trailer)
+		}
+	})
+}
+
+func TestStrictGRPCHTTPStatus(t *testing.T) {
+	svc := rpc.NewService("ConformanceService", rpc.WithPackage("conformance.v1"), rpc.WithStrictGRPC(true))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *ConformanceRequest) (*ConformanceResponse, error) {
+		return &ConformanceResponse{Text: req.Text}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	// Requests without a message fail with a gRPC status, not an HTTP error
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		req := httptest.NewRequest(method, "/conformance.v1.ConformanceService/Echo", strings.NewReader(""))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Grpc-Status") == "" {
+			t.Errorf("%s: expected a trailers-only response, got %d %v", method, rec.Code, rec.Header())
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/grpc+json" {
+			t.Errorf("%s: expected content type application/grpc+json, got %q", method, got)
+		}
+	}
+}
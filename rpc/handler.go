@@ -17,6 +17,8 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/internal/grpcutil"
 	reflectutil "github.com/i2y/hyperway/internal/reflect"
 	"github.com/i2y/hyperway/schema"
 )
@@ -49,25 +51,6 @@ const (
 	defaultBufferSize = 4096
 	maxBufferSize     = 1024 * 1024 // 1MB
 
-	// gRPC status codes
-	grpcStatusOK                 = 0
-	grpcStatusCanceled           = 1
-	grpcStatusUnknown            = 2
-	grpcStatusInvalidArgument    = 3
-	grpcStatusDeadlineExceeded   = 4
-	grpcStatusNotFound           = 5
-	grpcStatusAlreadyExists      = 6
-	grpcStatusPermissionDenied   = 7
-	grpcStatusResourceExhausted  = 8
-	grpcStatusFailedPrecondition = 9
-	grpcStatusAborted            = 10
-	grpcStatusOutOfRange         = 11
-	grpcStatusUnimplemented      = 12
-	grpcStatusInternal           = 13
-	grpcStatusUnavailable        = 14
-	grpcStatusDataLoss           = 15
-	grpcStatusUnauthenticated    = 16
-
 	// Content type constants
 	contentTypeProto        = "application/proto"
 	contentTypeConnectProto = "application/connect+proto"
@@ -77,32 +60,9 @@ const (
 	contentTypeGRPCProto    = "application/grpc+proto"
 )
 
-// grpcStatusCodeMap maps error codes to gRPC status codes.
-var grpcStatusCodeMap = map[Code]int{
-	CodeCanceled:           grpcStatusCanceled,
-	CodeUnknown:            grpcStatusUnknown,
-	CodeInvalidArgument:    grpcStatusInvalidArgument,
-	CodeDeadlineExceeded:   grpcStatusDeadlineExceeded,
-	CodeNotFound:           grpcStatusNotFound,
-	CodeAlreadyExists:      grpcStatusAlreadyExists,
-	CodePermissionDenied:   grpcStatusPermissionDenied,
-	CodeResourceExhausted:  grpcStatusResourceExhausted,
-	CodeFailedPrecondition: grpcStatusFailedPrecondition,
-	CodeAborted:            grpcStatusAborted,
-	CodeOutOfRange:         grpcStatusOutOfRange,
-	CodeUnimplemented:      grpcStatusUnimplemented,
-	CodeInternal:           grpcStatusInternal,
-	CodeUnavailable:        grpcStatusUnavailable,
-	CodeDataLoss:           grpcStatusDataLoss,
-	CodeUnauthenticated:    grpcStatusUnauthenticated,
-}
-
 // grpcStatusCode returns the gRPC status code for an error code.
 func grpcStatusCode(code Code) int {
-	if status, ok := grpcStatusCodeMap[code]; ok {
-		return status
-	}
-	return grpcStatusUnknown
+	return grpcutil.GRPCStatus(string(code))
 }
 
 // Buffer pools for reducing allocations
@@ -153,36 +113,48 @@ type handlerContext struct {
 	inputCodec       *codec.Codec
 	outputCodec      *codec.Codec
 	method           *Method
+	procedure        string // "/package.Service/Method"
 	validator        interface{ Struct(any) error }
-	options          ServiceOptions
+	options          *ServiceOptions // Options of the service, immutable after Register
 	interceptors     []Interceptor
 	handlerInfo      *HandlerInfo // Cached handler metadata
+	arena            *codec.Arena // Arena of the request messages, released once the response is written
 	responseHeaders  map[string][]string
 	responseTrailers map[string][]string
 	requestHeaders   map[string][]string                     // Added to capture request headers
+	peer             string                                  // Remote address of the client
+	clientIP         string                                  // Client IP, from trusted proxy headers
+	authority        string                                  // Host the request was sent to
+	protocol         string                                  // Protocol name, as in profiling labels
 	useProtoInput    bool                                    // Whether to use proto.Message for input
 	useProtoOutput   bool                                    // Whether to use proto.Message for output
 	handlerFunc      func(context.Context, any) (any, error) // Cached type-erased handler
 	newInputFunc     func() reflect.Value                    // Cached function to create new input instance
 }
 
-// SetResponseHeader sets a response header.
+// SetResponseHeader sets a response header. Values of binary keys and values
+// with characters that are not allowed in headers are encoded, see
+// SetResponseTrailer.
 func (h *handlerContext) SetResponseHeader(key, value string) {
 	if h.responseHeaders == nil {
 		h.responseHeaders = make(map[string][]string)
 	}
-	h.responseHeaders[key] = append(h.responseHeaders[key], value)
+	h.responseHeaders[key] = append(h.responseHeaders[key], grpcutil.SanitizeValue(key, value))
 }
 
-// SetResponseTrailer sets a response trailer.
+// SetResponseTrailer sets a response trailer. Values of keys ending in "-bin"
+// are binary and always get base64 like gRPC binary metadata. Other values
+// with characters that are not allowed in headers, which HTTP/2 servers would
+// drop, are percent-encoded like grpc-message.
 func (h *handlerContext) SetResponseTrailer(key, value string) {
 	if h.responseTrailers == nil {
 		h.responseTrailers = make(map[string][]string)
 	}
-	h.responseTrailers[key] = append(h.responseTrailers[key], value)
+	h.responseTrailers[key] = append(h.responseTrailers[key], grpcutil.SanitizeValue(key, value))
 }
 
-// GetHandlerContext retrieves the handler context from a context.Context
+// GetHandlerContext retrieves the handler context from a context.Context.
+// Meta offers the same as a protocol-agnostic view of the call metadata.
 func GetHandlerContext(ctx context.Context) *handlerContext {
 	if hctx, ok := ctx.Value(handlerContextKey).(*handlerContext); ok {
 		return hctx
@@ -203,6 +175,59 @@ func (h *handlerContext) GetRequestHeaders() map[string][]string {
 	return h.requestHeaders
 }
 
+// setRequest captures the metadata of the request served with the context.
+func (h *handlerContext) setRequest(r *http.Request, p protocolInfo) {
+	h.requestHeaders = r.Header
+	h.peer = r.RemoteAddr
+	h.clientIP = ""
+	if ip := gateway.PeerFromRequest(r).IP; ip.IsValid() {
+		h.clientIP = ip.String()
+	}
+	h.authority = r.Host
+	h.protocol = p.protocolName()
+}
+
+// resetArena prepares the arena the request messages are decoded into.
+func (h *handlerContext) resetArena() {
+	if h.arena == nil {
+		h.arena = codec.NewArena()
+		return
+	}
+	h.arena.Reset()
+}
+
+// withArena returns reqCtx decoding request messages into the arena of the
+// call, which handlers can retain through codec.ArenaFrom.
+func (h *handlerContext) withArena(reqCtx context.Context) context.Context {
+	if h.arena == nil {
+		return reqCtx
+	}
+	return codec.WithArena(reqCtx, h.arena)
+}
+
+// retainArena keeps the request messages of ctx alive past the response,
+// for work that outlives the handler.
+func retainArena(ctx context.Context) {
+	if arena := codec.ArenaFrom(ctx); arena != nil {
+		arena.Retain()
+	}
+}
+
+// cachedHandlerContext returns the prepared context of a method, if any.
+func (s *Service) cachedHandlerContext(method string) (*handlerContext, bool) {
+	s.handlerCtxMu.RLock()
+	defer s.handlerCtxMu.RUnlock()
+	hctx, ok := s.handlerCtxCache[method]
+	return hctx, ok
+}
+
+// cacheHandlerContext stores the prepared context of a method.
+func (s *Service) cacheHandlerContext(method string, hctx *handlerContext) {
+	s.handlerCtxMu.Lock()
+	defer s.handlerCtxMu.Unlock()
+	s.handlerCtxCache[method] = hctx
+}
+
 // createHTTPHandler creates an HTTP handler for a method.
 func (s *Service) createHTTPHandler(method *Method) http.HandlerFunc {
 	// For streaming methods, create a streaming handler
@@ -221,7 +246,7 @@ func (s *Service) createHTTPHandler(method *Method) http.HandlerFunc {
 	}
 
 	// Cache the prepared context in the service
-	s.handlerCtxCache[method.Name] = cachedCtx
+	s.cacheHandlerContext(method.Name, cachedCtx)
 
 	// Create a handler that supports Connect protocol
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -232,6 +257,7 @@ func (s *Service) createHTTPHandler(method *Method) http.HandlerFunc {
 		ctx.inputCodec = cachedCtx.inputCodec
 		ctx.outputCodec = cachedCtx.outputCodec
 		ctx.method = cachedCtx.method
+		ctx.procedure = cachedCtx.procedure
 		ctx.validator = cachedCtx.validator
 		ctx.options = cachedCtx.options
 		ctx.handlerInfo = cachedCtx.handlerInfo
@@ -270,8 +296,10 @@ func (s *Service) createHTTPHandler(method *Method) http.HandlerFunc {
 			}
 			// requestHeaders is just a reference, so set to nil
 			ctx.requestHeaders = nil
+			ctx.arena.Release()
 			handlerContextPool.Put(ctx)
 		}()
+		ctx.resetArena()
 
 		s.handleRequest(w, r, ctx)
 	})
@@ -349,12 +377,21 @@ func (s *Service) createCodecs(inputType, outputType reflect.Type) (inputCodec,
 	}
 
 	// Create codecs
-	inputCodec, err = codec.New(inputDesc, codec.DefaultOptions())
+	codecOpts := codec.DefaultOptions()
+	if s.options.CodecOptions != nil {
+		codecOpts = *s.options.CodecOptions
+		// Request buffers are reused, so messages must not alias them
+		codecOpts.AllowAlias = false
+	}
+	codecOpts.UseJSONNames = s.options.JSONNaming != JSONNamingDefault && s.options.JSONNaming != JSONNamingSnakeCase
+	codecOpts.JSONInt64 = s.options.JSONInt64
+
+	inputCodec, err = codec.New(inputDesc, codecOpts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create input codec: %w", err)
 	}
 
-	outputCodec, err = codec.New(outputDesc, codec.DefaultOptions())
+	outputCodec, err = codec.New(outputDesc, codecOpts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create output codec: %w", err)
 	}
@@ -371,8 +408,9 @@ func (s *Service) initializeHandlerContext(method *Method, inputCodec, outputCod
 	ctx.inputCodec = inputCodec
 	ctx.outputCodec = outputCodec
 	ctx.method = method
+	ctx.procedure = fmt.Sprintf("/%s.%s/%s", s.packageName, s.name, method.Name)
 	ctx.validator = s.validator
-	ctx.options = s.options
+	ctx.options = &s.options
 	ctx.handlerInfo = handlerInfo
 	ctx.useProtoInput = method.ProtoInput != nil
 	ctx.useProtoOutput = method.ProtoOutput != nil
@@ -408,16 +446,20 @@ func (s *Service) initializeHeaders(ctx *handlerContext) {
 // setupInterceptors sets up the interceptor chain
 func (s *Service) setupInterceptors(ctx *handlerContext, method *Method) {
 	ctx.interceptors = ctx.interceptors[:0]
-	ctx.interceptors = append(ctx.interceptors, method.Options.Interceptors...)
-	ctx.interceptors = append(ctx.interceptors, s.options.Interceptors...)
+	chain, _ := s.interceptorChain(method) // Checked when the gateway was created
+	for _, interceptor := range chain {
+		ctx.interceptors = append(ctx.interceptors, interceptor.Interceptor)
+	}
 }
 
 // setupHandlerFunc creates the handler function for unary methods
 func (s *Service) setupHandlerFunc(ctx *handlerContext, method *Method, handlerInfo *HandlerInfo) {
 	if method.StreamType == StreamTypeUnary && handlerInfo != nil {
+		// Handler info is shared by closures with the same code, so the
+		// value is taken from the method
+		handlerValue := reflect.ValueOf(method.Handler)
 		ctx.handlerFunc = func(reqCtx context.Context, req any) (any, error) {
-			// Use cached handler value for better performance
-			results := handlerInfo.HandlerValue.Call([]reflect.Value{
+			results := handlerValue.Call([]reflect.Value{
 				reflect.ValueOf(reqCtx),
 				reflect.ValueOf(req),
 			})
@@ -546,37 +588,84 @@ func (s *Service) handleMethodNotAllowed(w http.ResponseWriter, r *http.Request,
 	case p.isConnect:
 		s.writeConnectError(w, r, NewError(CodeUnimplemented, "Method not allowed"))
 	case p.isGRPC:
-		w.Header().Set("grpc-status", fmt.Sprintf("%d", grpcStatusUnimplemented))
-		w.Header().Set("grpc-message", "Method not allowed")
-		w.WriteHeader(http.StatusOK)
+		s.writeGRPCError(w, r, nil, NewError(CodeUnimplemented, "Method not allowed"))
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// parseRequestTimeout parses timeout headers and returns a context with timeout if applicable.
-func parseRequestTimeout(r *http.Request, isConnect bool) context.Context {
+// parseRequestTimeout parses timeout headers and returns a context with timeout
+// if applicable, bounded by serverTimeout, the timeout of the method in the
+// service config (0 for none).
+func parseRequestTimeout(r *http.Request, p protocolInfo, serverTimeout time.Duration) context.Context {
 	ctx := r.Context()
 
-	if isConnect {
+	var timeout time.Duration
+	switch {
+	case p.isConnect:
 		if timeoutMs := r.Header.Get("Connect-Timeout-Ms"); timeoutMs != "" {
 			if ms, err := strconv.ParseInt(timeoutMs, 10, 64); err == nil && ms > 0 {
-				timeout := time.Duration(ms) * time.Millisecond
-				newCtx, cancel := context.WithTimeout(ctx, timeout)
-				// Store cancel func in context for deferred cleanup
-				return context.WithValue(newCtx, contextKeyCancel, cancel)
+				timeout = time.Duration(ms) * time.Millisecond
+			}
+		}
+	case p.isGRPC, p.isGRPCWeb:
+		// Parse gRPC timeout format (e.g., "10S" for 10 seconds)
+		if value := r.Header.Get("grpc-timeout"); value != "" {
+			if t, err := parseGRPCTimeout(value); err == nil && t > 0 {
+				timeout = t
 			}
 		}
 	}
 
+	if newCtx, cancel := withCallTimeout(ctx, timeout, serverTimeout); cancel != nil {
+		// Store cancel func in context for deferred cleanup
+		return context.WithValue(newCtx, contextKeyCancel, cancel)
+	}
 	return ctx
 }
 
 // handleRequest handles an HTTP request.
 func (s *Service) handleRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext) {
+	// Record the stats of the call for response hooks
+	w, r, reportStats := s.recordStats(w, r)
+	if reportStats != nil {
+		defer reportStats(ctx)
+	}
+
+	// Connect GET requests carry the message in the query string
+	r, getErr := connectGetRequest(r, ctx.method)
+	if getErr != nil {
+		s.writeConnectError(w, r, getErr)
+		return
+	}
+
 	// Setup request context
-	ctx.requestHeaders = r.Header
 	protocolInfo := detectProtocol(r)
+	ctx.setRequest(r, protocolInfo)
+
+	// Tag the request goroutine for continuous profilers
+	if s.options.ProfilingLabels {
+		withProfilingLabels(r.Context(), r.URL.Path, protocolInfo, func(labelCtx context.Context) {
+			s.routeRequest(w, r.WithContext(labelCtx), ctx, protocolInfo)
+		})
+		return
+	}
+
+	s.routeRequest(w, r, ctx, protocolInfo)
+}
+
+// routeRequest dispatches a request to the handler for its protocol and stream type.
+func (s *Service) routeRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, protocolInfo protocolInfo) {
+	// JSON-RPC calls are reported by method, as batches may mix methods
+	if !protocolInfo.isJSONRPC {
+		s.announceDeprecation(w, r, ctx)
+	}
+
+	r, release, ok := s.admitRequest(w, r, ctx, protocolInfo)
+	if !ok {
+		return
+	}
+	defer release()
 
 	// Handle JSON-RPC requests
 	if protocolInfo.isJSONRPC {
@@ -585,7 +674,7 @@ func (s *Service) handleRequest(w http.ResponseWriter, r *http.Request, ctx *han
 	}
 
 	// Validate method
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && !isConnectGet(r, protocolInfo, ctx.method) {
 		s.handleMethodNotAllowed(w, r, protocolInfo)
 		return
 	}
@@ -600,6 +689,39 @@ func (s *Service) handleRequest(w http.ResponseWriter, r *http.Request, ctx *han
 	s.handleUnaryRequest(w, r, ctx, protocolInfo)
 }
 
+// admitRequest sheds, authenticates and limits a request before dispatch. It
+// returns the request with the identity of the caller and a func releasing
+// the slots held for the call, or false after writing the error rejecting
+// the request. Streams hold their slots while they are open.
+func (s *Service) admitRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo) (*http.Request, func(), bool) {
+	// Shed calls while overloaded, before spending anything on them
+	release, err := s.admit(w.Header(), r, ctx.method)
+	if err != nil {
+		s.writeRequestError(w, r, ctx, p, err)
+		return r, nil, false
+	}
+
+	// Verify the caller before dispatching
+	r, err = s.authenticate(r, ctx.method)
+	if err != nil {
+		s.writeRequestError(w, r, ctx, p, err)
+		release()
+		return r, nil, false
+	}
+
+	// Wait for a slot within the method's concurrency limit
+	releaseSlot, err := s.acquire(r.Context(), ctx.method)
+	if err != nil {
+		s.writeRequestError(w, r, ctx, p, err)
+		release()
+		return r, nil, false
+	}
+	return r, func() {
+		releaseSlot()
+		release()
+	}, true
+}
+
 // handleStreamingRequest routes to the appropriate streaming handler
 func (s *Service) handleStreamingRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, protocolInfo protocolInfo) {
 	switch ctx.method.StreamType {
@@ -618,16 +740,17 @@ func (s *Service) handleStreamingRequest(w http.ResponseWriter, r *http.Request,
 // handleUnaryRequest handles unary RPC requests
 func (s *Service) handleUnaryRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, protocolInfo protocolInfo) {
 	// Parse timeout
-	reqCtx := parseRequestTimeout(r, protocolInfo.isConnect)
+	reqCtx := parseRequestTimeout(r, protocolInfo, s.methodTimeout(ctx.procedure))
 	if cancel, ok := reqCtx.Value(contextKeyCancel).(context.CancelFunc); ok {
 		defer cancel()
 		// Remove cancel from context to avoid leaking it
 		reqCtx = context.WithValue(reqCtx, contextKeyCancel, nil)
 	}
+	reqCtx = ctx.withArena(reqCtx)
 
 	// Special handling for gRPC
 	if protocolInfo.isGRPC {
-		s.handleGRPCRequest(w, r, ctx)
+		s.handleGRPCRequest(w, r, ctx, reqCtx)
 		return
 	}
 
@@ -637,37 +760,57 @@ func (s *Service) handleUnaryRequest(w http.ResponseWriter, r *http.Request, ctx
 
 // processUnaryRequest processes a standard unary request
 func (s *Service) processUnaryRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, protocolInfo protocolInfo, reqCtx context.Context) {
+	// In dev mode, report handler panics with their stack trace
+	if s.options.DevMode {
+		defer func() {
+			if p := recover(); p != nil {
+				s.writeError(w, r, recoverWithDebugInfo(p))
+			}
+		}()
+	}
+
 	// Read and decompress body
-	body, err := s.readRequestBody(r)
+	s.profilePhase(reqCtx, profilePhaseDecode)
+	body, err := s.readRequestBody(r, ctx.method.Name)
 	if err != nil {
-		s.writeError(w, r, err)
+		s.writeError(w, r, s.withDebugInfo(err, r, ctx, nil, reflect.Value{}))
 		return
 	}
 
 	// Decode and validate input
-	inputVal, err := s.processInput(r, body, ctx)
+	inputVal, err := s.processInput(reqCtx, r, body, ctx)
 	if err != nil {
-		s.writeError(w, r, err)
+		s.writeError(w, r, s.withDebugInfo(err, r, ctx, body, inputVal))
 		return
 	}
 
 	// Call handler
-	output, err := s.callHandler(reqCtx, inputVal, ctx)
+	output, err := s.callHandler(s.profilePhase(reqCtx, profilePhaseHandler), inputVal, ctx)
 	if err != nil {
-		s.writeError(w, r, err)
+		// Connect error responses carry the headers and trailers set by the handler
+		if protocolInfo.isConnect {
+			s.applyConnectUnaryMetadata(w.Header(), ctx)
+		}
+		s.writeError(w, r, s.withDebugInfo(err, r, ctx, body, inputVal))
 		return
 	}
 
 	// Encode and send response
+	s.profilePhase(reqCtx, profilePhaseEncode)
 	if err := s.encodeResponse(w, r, output, ctx, protocolInfo.isConnect); err != nil {
-		s.writeError(w, r, err)
+		s.writeError(w, r, s.withDebugInfo(err, r, ctx, body, inputVal))
 	}
 }
 
-// readRequestBody reads and decompresses the request body
-func (s *Service) readRequestBody(r *http.Request) ([]byte, error) {
+// readRequestBody reads and decompresses the request body of method
+func (s *Service) readRequestBody(r *http.Request, method string) ([]byte, error) {
 	defer func() { _ = r.Body.Close() }()
 
+	// Decompress while reading, within the decompression limits
+	if encoding := r.Header.Get("Content-Encoding"); encoding != CompressionIdentity && encoding != "identity" {
+		return s.options.DecompressionLimits.readDecompressed(method, encoding, r.Body)
+	}
+
 	// Read body using pooled buffer
 	buf := bufferPool.Get().(*bytes.Buffer)
 	buf.Reset()
@@ -676,34 +819,37 @@ func (s *Service) readRequestBody(r *http.Request) ([]byte, error) {
 	if _, err := io.Copy(buf, r.Body); err != nil {
 		return nil, fmt.Errorf("failed to read body: %w", err)
 	}
-	body := buf.Bytes()
-
-	// Handle compression if needed
-	if encoding := r.Header.Get("Content-Encoding"); encoding == CompressionGzip {
-		return s.decompressBody(body)
-	}
-	return body, nil
+	return buf.Bytes(), nil
 }
 
-// decompressBody decompresses a gzip-compressed body
-func (s *Service) decompressBody(body []byte) ([]byte, error) {
-	compressor, ok := GetCompressor(CompressionGzip)
-	if !ok {
-		return nil, fmt.Errorf("gzip decompression not available")
+// processInput decodes and validates the input
+func (s *Service) processInput(reqCtx context.Context, r *http.Request, body []byte, ctx *handlerContext) (reflect.Value, error) {
+	contentType := r.Header.Get("Content-Type")
+	body = s.pathRequestBody(r, body, ctx.method)
+
+	// Reject unknown fields in strict mode
+	if s.decodesAsJSON(contentType) {
+		if err := s.checkUnknownJSONFields(body, ctx); err != nil {
+			return reflect.Value{}, err
+		}
 	}
-	return compressor.Decompress(body)
-}
 
-// processInput decodes and validates the input
-func (s *Service) processInput(r *http.Request, body []byte, ctx *handlerContext) (reflect.Value, error) {
 	// Decode input
-	inputVal, err := s.decodeInput(r.Header.Get("Content-Type"), body, ctx)
+	inputVal, err := s.decodeInput(reqCtx, contentType, body, ctx)
 	if err != nil {
 		return reflect.Value{}, err
 	}
 
+	// Set the fields named by the path template of the method
+	if err := s.applyPathValues(r, inputVal, ctx.method); err != nil {
+		return reflect.Value{}, err
+	}
+
+	// Fill unset fields with their defaults
+	applyDefaults(inputVal, ctx)
+
 	// Validate if enabled
-	if err := s.validateInput(inputVal, ctx); err != nil {
+	if err := s.validateInput(reqCtx, inputVal, ctx); err != nil {
 		return reflect.Value{}, err
 	}
 
@@ -712,10 +858,19 @@ func (s *Service) processInput(r *http.Request, body []byte, ctx *handlerContext
 
 // writeError writes an error response.
 func (s *Service) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	// gRPC and gRPC-Web errors are statuses, not response bodies
+	if p := detectProtocol(r); p.isGRPC || p.isGRPCWeb {
+		s.writeGRPCError(w, r, nil, err)
+		return
+	}
+
 	// Check if this is a Connect protocol request
 	connectProtocol := r.Header.Get("Connect-Protocol-Version")
 	isConnect := connectProtocol == "1"
 
+	// Separate dev mode debug information from the original error
+	debugInfo, err := debugInfoFromError(err)
+
 	// Convert error to our Error type if needed
 	var rpcErr *Error
 
@@ -743,33 +898,46 @@ func (s *Service) writeError(w http.ResponseWriter, r *http.Request, err error)
 			rpcErr = NewError(CodeInternal, err.Error())
 		}
 	}
+	rpcErr = s.options.ErrorSanitizer.sanitize(r, r.URL.Path, rpcErr, err)
+
+	if debugInfo != nil {
+		withDebug := *rpcErr
+		withDebug.debug = debugInfo
+		rpcErr = &withDebug
+	}
 
 	if isConnect {
 		s.writeConnectError(w, r, rpcErr)
 	} else {
 		// Standard HTTP error
+		recordStatus(r.Context(), rpcErr.Code)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(rpcErr.Code.HTTPStatusCode())
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error": rpcErr.Error(),
-		})
+		response := map[string]any{
+			"error":   rpcErr.Error(),
+			"code":    string(rpcErr.Code),
+			"message": rpcErr.Message,
+		}
+		if rpcErr.debug != nil {
+			response["debug"] = rpcErr.debug
+		}
+		_ = json.NewEncoder(w).Encode(response)
 	}
 }
 
 // writeConnectError writes a Connect protocol error response.
 func (s *Service) writeConnectError(w http.ResponseWriter, r *http.Request, err *Error) {
-	// Determine response content type based on request
-	contentType := r.Header.Get("Content-Type")
-	isProto := contentType == contentTypeProto || contentType == contentTypeConnectProto
+	recordStatus(r.Context(), err.Code)
 
-	if isProto {
-		w.Header().Set("Content-Type", contentTypeProto)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-	}
-	// Connect protocol always uses HTTP 200 for errors
-	w.WriteHeader(http.StatusOK)
+	// Connect unary errors are JSON whatever the codec, with the HTTP status
+	// of their code
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Code.HTTPStatusCode())
+	_ = json.NewEncoder(w).Encode(connectErrorBody(err))
+}
 
+// connectErrorBody builds the Connect JSON error object.
+func connectErrorBody(err *Error) map[string]any {
 	response := map[string]any{
 		"code":    string(err.Code),
 		"message": err.Message,
@@ -777,29 +945,36 @@ func (s *Service) writeConnectError(w http.ResponseWriter, r *http.Request, err
 	if err.Details != nil {
 		// Check if details contains the formatted details
 		if details, ok := err.Details["details"]; ok {
-			response["details"] = details
+			response["details"] = Redact(details)
 		} else {
 			// Legacy format - wrap in array
-			response["details"] = []any{err.Details}
+			response["details"] = []any{Redact(err.Details)}
 		}
 	}
-
-	// For now, always encode as JSON even for proto requests
-	_ = json.NewEncoder(w).Encode(response)
+	if err.debug != nil {
+		response["debug"] = err.debug
+	}
+	return response
 }
 
 // HandlerFunc is the signature for RPC handlers.
 type HandlerFunc func(context.Context, any) (any, error)
 
-// decodeInput decodes the input based on content type.
-func (s *Service) decodeInput(contentType string, body []byte, ctx *handlerContext) (reflect.Value, error) {
+// decodeInput decodes the input based on content type, decoding protobuf
+// messages into the arena of reqCtx, if any.
+func (s *Service) decodeInput(reqCtx context.Context, contentType string, body []byte, ctx *handlerContext) (reflect.Value, error) {
+	// Handcrafted requests in the text format
+	if isProtoTextContentType(contentType) {
+		return s.decodeProtoTextInput(body, ctx)
+	}
+
 	// If we have a protobuf type, use it directly
 	if ctx.useProtoInput && ctx.method.ProtoInput != nil {
 		return s.decodeProtoInput(contentType, body, ctx.method.ProtoInput)
 	}
 
 	// Original logic for non-protobuf types
-	return s.decodeStructInput(contentType, body, ctx)
+	return s.decodeStructInput(reqCtx, contentType, body, ctx)
 }
 
 // decodeProtoInput decodes input for protobuf types
@@ -829,7 +1004,7 @@ func (s *Service) decodeProtoInput(contentType string, body []byte, protoInput p
 }
 
 // decodeStructInput decodes input for struct types
-func (s *Service) decodeStructInput(contentType string, body []byte, ctx *handlerContext) (reflect.Value, error) {
+func (s *Service) decodeStructInput(reqCtx context.Context, contentType string, body []byte, ctx *handlerContext) (reflect.Value, error) {
 	// Create input instance using cached function
 	if ctx.newInputFunc == nil {
 		return reflect.Value{}, NewError(CodeInternal, "newInputFunc not initialized")
@@ -838,17 +1013,17 @@ func (s *Service) decodeStructInput(contentType string, body []byte, ctx *handle
 
 	switch {
 	case s.isJSONContentType(contentType):
-		if err := json.Unmarshal(body, inputVal.Interface()); err != nil {
+		if err := s.unmarshalStructJSON(body, inputVal.Interface(), ctx, s.structProtoJSON()); err != nil {
 			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal JSON: %v", err)
 		}
 	case s.isProtobufContentType(contentType):
-		err := s.decodeProtobufToStruct(body, inputVal, ctx)
+		err := s.decodeProtobufToStruct(reqCtx, body, inputVal, ctx)
 		if err != nil {
 			return reflect.Value{}, err
 		}
 	default:
 		// Handle default case
-		err := s.decodeStructDefault(contentType, body, inputVal, ctx)
+		err := s.decodeStructDefault(reqCtx, contentType, body, inputVal, ctx)
 		if err != nil {
 			return reflect.Value{}, err
 		}
@@ -862,6 +1037,13 @@ func (s *Service) isJSONContentType(contentType string) bool {
 	return contentType == "application/json" || contentType == contentTypeConnectJSON
 }
 
+// decodesAsJSON reports whether requests of a content type are decoded as
+// JSON, which is the default for unknown content types
+func (s *Service) decodesAsJSON(contentType string) bool {
+	return !s.isProtobufContentType(contentType) && !isProtoTextContentType(contentType) &&
+		!strings.HasPrefix(contentType, "application/grpc")
+}
+
 // isProtobufContentType checks if the content type is protobuf
 func (s *Service) isProtobufContentType(contentType string) bool {
 	switch contentType {
@@ -876,6 +1058,7 @@ func (s *Service) isProtobufContentType(contentType string) bool {
 func (s *Service) unmarshalProtoJSON(body []byte, msg proto.Message) error {
 	unmarshaler := protojson.UnmarshalOptions{
 		DiscardUnknown: true,
+		Resolver:       s.resolver(),
 	}
 	if err := unmarshaler.Unmarshal(body, msg); err != nil {
 		return NewErrorf(CodeInvalidArgument, "failed to unmarshal JSON: %v", err)
@@ -898,45 +1081,65 @@ func (s *Service) decodeProtoDefault(contentType string, body []byte, msg proto.
 }
 
 // decodeProtobufToStruct decodes protobuf to struct
-func (s *Service) decodeProtobufToStruct(body []byte, inputVal reflect.Value, ctx *handlerContext) error {
+func (s *Service) decodeProtobufToStruct(reqCtx context.Context, body []byte, inputVal reflect.Value, ctx *handlerContext) error {
 	if ctx.inputCodec == nil {
 		return NewError(CodeInternal, "inputCodec not initialized")
 	}
-	msg, err := ctx.inputCodec.Unmarshal(body)
+	return unmarshalStructProto(reqCtx, ctx.inputCodec, body, inputVal.Interface())
+}
+
+// unmarshalStructProto decodes a protobuf message into the struct target. In
+// the arena of reqCtx, the message lives until the response is written, so
+// target references its strings and bytes instead of copying them. Without
+// an arena, they are copied and the message is released at once.
+func unmarshalStructProto(reqCtx context.Context, c *codec.Codec, data []byte, target any) error {
+	convert := reflectutil.ProtoToStructAliased
+	msg, err := c.UnmarshalContext(reqCtx, data)
 	if err != nil {
 		return NewErrorf(CodeInvalidArgument, "failed to unmarshal protobuf: %v", err)
 	}
-	defer ctx.inputCodec.ReleaseMessage(msg)
+	if codec.ArenaFrom(reqCtx) == nil {
+		defer c.ReleaseMessage(msg)
+		convert = reflectutil.ProtoToStruct
+	}
 
 	// Convert to struct
-	if err := reflectutil.ProtoToStruct(msg.ProtoReflect(), inputVal.Interface()); err != nil {
+	if err := convert(msg.ProtoReflect(), target); err != nil {
 		return NewErrorf(CodeInvalidArgument, "failed to convert proto to struct: %v", err)
 	}
 	return nil
 }
 
 // decodeStructDefault handles default decoding for structs
-func (s *Service) decodeStructDefault(contentType string, body []byte, inputVal reflect.Value, ctx *handlerContext) error {
+func (s *Service) decodeStructDefault(reqCtx context.Context, contentType string, body []byte, inputVal reflect.Value, ctx *handlerContext) error {
 	// For gRPC, default to protobuf
 	if strings.HasPrefix(contentType, "application/grpc") {
-		return s.decodeProtobufToStruct(body, inputVal, ctx)
+		return s.decodeProtobufToStruct(reqCtx, body, inputVal, ctx)
 	}
 	// Default to JSON
-	if err := json.Unmarshal(body, inputVal.Interface()); err != nil {
+	if err := s.unmarshalStructJSON(body, inputVal.Interface(), ctx, s.structProtoJSON()); err != nil {
 		return NewErrorf(CodeInvalidArgument, "failed to unmarshal: %v", err)
 	}
 	return nil
 }
 
-// validateInput validates the input if enabled.
-func (s *Service) validateInput(inputVal reflect.Value, ctx *handlerContext) error {
+// validateInput validates the input if enabled, within the service's validation limits.
+func (s *Service) validateInput(reqCtx context.Context, inputVal reflect.Value, ctx *handlerContext) error {
 	shouldValidate := ctx.options.EnableValidation
 	if ctx.method.Options.Validate != nil {
 		shouldValidate = *ctx.method.Options.Validate
 	}
-	if shouldValidate {
+	strict := s.strictJSON(ctx.method)
+	if !shouldValidate && !strict {
+		return nil
+	}
+	return runValidation(reqCtx, ctx, inputVal, func() error {
 		// Standard validation
 		if err := ctx.validator.Struct(inputVal.Elem().Interface()); err != nil {
+			// Each failed constraint is reported as a field violation
+			if violations := validationViolations(inputVal.Elem().Type(), err, http.Header(ctx.requestHeaders).Get("Accept-Language")); len(violations) > 0 {
+				return fieldViolationsError(violations)
+			}
 			return NewErrorf(CodeInvalidArgument, "validation failed: %v", err)
 		}
 
@@ -944,15 +1147,36 @@ func (s *Service) validateInput(inputVal reflect.Value, ctx *handlerContext) err
 		if err := schema.ValidateOneof(inputVal.Elem().Type(), inputVal.Elem().Interface()); err != nil {
 			return fmt.Errorf("oneof validation failed: %w", err)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // callHandler calls the handler function.
-func (s *Service) callHandler(ctx context.Context, inputVal reflect.Value, hctx *handlerContext) (any, error) {
+func (s *Service) callHandler(ctx context.Context, inputVal reflect.Value, hctx *handlerContext) (output any, err error) {
 	// Add handler context to the context
 	ctx = context.WithValue(ctx, handlerContextKey, hctx)
 
+	// Copy the call to the shadow sink once it completes
+	if s.shadow != nil {
+		start := time.Now()
+		defer func() {
+			s.shadow.capture(ctx, hctx, start, inputVal.Interface(), output, err)
+		}()
+	}
+
+	// Calls past their deadline fail, whatever the handler returned
+	defer func() {
+		if deadlineErr := callDeadlineError(ctx); deadlineErr != nil {
+			output, err = nil, deadlineErr
+		}
+	}()
+
+	// Reject field masks naming fields the response doesn't have
+	mask, err := s.responseFieldMask(hctx.method, inputVal)
+	if err != nil {
+		return nil, err
+	}
+
 	// Use cached handler function to avoid reflection
 	baseHandler := hctx.handlerFunc
 
@@ -971,17 +1195,36 @@ func (s *Service) callHandler(ctx context.Context, inputVal reflect.Value, hctx
 		}
 
 		// Call with interceptors
-		return handler(ctx, inputVal.Interface())
+		output, err = handler(ctx, inputVal.Interface())
+	} else {
+		// Call without interceptors
+		output, err = baseHandler(ctx, inputVal.Interface())
+	}
+	if err != nil {
+		return output, err
 	}
 
-	// Call without interceptors
-	return baseHandler(ctx, inputVal.Interface())
+	// Fill computed fields once interceptors are done with the response
+	if err = s.computed.apply(ctx, output); err != nil {
+		return nil, err
+	}
+	// Prune the response to the field mask of the request
+	if mask != nil {
+		if err = pruneFieldMask(output, mask); err != nil {
+			return nil, err
+		}
+	}
+	return s.transformResponse(ctx, output), nil
 }
 
 // encodeResponse encodes and sends the response.
 func (s *Service) encodeResponse(w http.ResponseWriter, r *http.Request, output any, ctx *handlerContext, _ bool) error {
 	// Determine content type
 	contentType := determineContentType(r)
+	if isProtoTextContentType(contentType) && !s.options.ProtoTextResponses {
+		// Text responses are a debugging aid that must be enabled
+		contentType = contentTypeJSON
+	}
 
 	// Check if client accepts compression
 	canCompress := strings.Contains(r.Header.Get("Accept-Encoding"), CompressionGzip)
@@ -989,27 +1232,20 @@ func (s *Service) encodeResponse(w http.ResponseWriter, r *http.Request, output
 	// Set the content-type header first
 	w.Header().Set("Content-Type", contentType)
 
-	// Apply response headers from context
-	if ctx.responseHeaders != nil {
+	protocolInfo := detectProtocol(r)
+	if protocolInfo.isConnect {
+		// Connect unary sends trailers as "Trailer-" prefixed headers
+		s.applyConnectUnaryMetadata(w.Header(), ctx)
+	} else {
+		// Apply response headers from context
 		for key, values := range ctx.responseHeaders {
 			for _, value := range values {
 				w.Header().Add(key, value)
 			}
 		}
-	}
 
-	// Handle trailers
-	protocolInfo := detectProtocol(r)
-	if len(ctx.responseTrailers) > 0 {
-		if protocolInfo.isConnect {
-			// Connect protocol sends trailers as regular headers with "trailer-" prefix
-			for key, values := range ctx.responseTrailers {
-				for _, value := range values {
-					w.Header().Add("trailer-"+key, value)
-				}
-			}
-		} else {
-			// gRPC and gRPC-Web use HTTP trailers
+		// gRPC and gRPC-Web use HTTP trailers
+		if len(ctx.responseTrailers) > 0 {
 			trailerKeys := make([]string, 0, len(ctx.responseTrailers))
 			for key := range ctx.responseTrailers {
 				trailerKeys = append(trailerKeys, key)
@@ -1020,11 +1256,13 @@ func (s *Service) encodeResponse(w http.ResponseWriter, r *http.Request, output
 
 	// Handle different content types
 	var err error
-	if isProtobufContentType(contentType) {
-		err = s.encodeProtobufResponse(w, output, ctx, canCompress)
+	if isProtoTextContentType(contentType) {
+		err = s.encodeProtoTextResponse(w, r, output, ctx)
+	} else if isProtobufContentType(contentType) {
+		err = s.encodeProtobufResponse(w, r, output, ctx, canCompress)
 	} else {
 		// Default to JSON
-		err = s.encodeJSONResponse(w, output, canCompress)
+		err = s.encodeJSONResponse(w, r, output, ctx, canCompress)
 	}
 
 	// Apply trailers after body is written (for non-Connect protocols)
@@ -1097,14 +1335,14 @@ func isProtobufContentType(contentType string) bool {
 }
 
 // encodeProtobufResponse encodes a protobuf response
-func (s *Service) encodeProtobufResponse(w http.ResponseWriter, output any, ctx *handlerContext, canCompress bool) error {
+func (s *Service) encodeProtobufResponse(w http.ResponseWriter, r *http.Request, output any, ctx *handlerContext, canCompress bool) error {
 	var data []byte
 	var err error
 
 	// Check if output is already a proto.Message
 	if msg, ok := output.(proto.Message); ok && ctx.useProtoOutput {
-		// Direct protobuf marshal
-		data, err = proto.Marshal(msg)
+		// Direct protobuf marshal, deterministic for stable ETags
+		data, err = proto.MarshalOptions{Deterministic: s.etags(ctx.method)}.Marshal(msg)
 		if err != nil {
 			return fmt.Errorf("failed to marshal protobuf: %w", err)
 		}
@@ -1116,39 +1354,35 @@ func (s *Service) encodeProtobufResponse(w http.ResponseWriter, output any, ctx
 		}
 	}
 
-	// Apply compression if needed
-	data = s.maybeCompress(data, w, canCompress)
-
 	// Content-Type is already set by encodeResponse
-	_, _ = w.Write(data)
+	s.writeResponseBody(w, r, data, ctx, canCompress)
+	return nil
+}
+
+// encodeProtoTextResponse encodes a response in the protobuf text format
+func (s *Service) encodeProtoTextResponse(w http.ResponseWriter, r *http.Request, output any, ctx *handlerContext) error {
+	data, err := marshalProtoText(output, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal text format: %w", err)
+	}
+	// Replaces the Accept header value set by encodeResponse
+	w.Header().Set("Content-Type", contentTypeProtoText+"; charset=utf-8")
+	s.writeResponseBody(w, r, data, ctx, false)
 	return nil
 }
 
 // encodeJSONResponse encodes a JSON response
-func (s *Service) encodeJSONResponse(w http.ResponseWriter, output any, canCompress bool) error {
+func (s *Service) encodeJSONResponse(w http.ResponseWriter, r *http.Request, output any, ctx *handlerContext, canCompress bool) error {
 	var data []byte
 	var err error
 
-	// Check if output is a proto.Message - use protojson for better compatibility
-	if msg, ok := output.(proto.Message); ok {
-		// Use protojson for proper JSON encoding of protobuf messages
-		data, err = protojson.Marshal(msg)
-		if err != nil {
-			return fmt.Errorf("failed to marshal protobuf to JSON: %w", err)
-		}
-	} else {
-		// Standard JSON marshal
-		data, err = json.Marshal(output)
-		if err != nil {
-			return fmt.Errorf("failed to marshal JSON: %w", err)
-		}
+	data, err = s.marshalMessageJSON(output, ctx, s.structProtoJSON())
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	// Apply compression if needed
-	data = s.maybeCompress(data, w, canCompress)
-
 	// Content-Type is already set by encodeResponse
-	_, _ = w.Write(data)
+	s.writeResponseBody(w, r, data, ctx, canCompress)
 	return nil
 }
 
@@ -1173,7 +1407,9 @@ func (s *Service) maybeCompress(data []byte, w http.ResponseWriter, canCompress
 }
 
 // handleGRPCRequest handles a gRPC protocol request.
-func (s *Service) handleGRPCRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext) {
+func (s *Service) handleGRPCRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, reqCtx context.Context) {
+	s.profilePhase(r.Context(), profilePhaseDecode)
+
 	// gRPC uses a 5-byte message framing
 	// Get frame header from pool
 	frameHeaderPtr := frameHeaderPool.Get().(*[]byte)
@@ -1181,7 +1417,7 @@ func (s *Service) handleGRPCRequest(w http.ResponseWriter, r *http.Request, ctx
 	defer frameHeaderPool.Put(frameHeaderPtr)
 
 	if _, err := io.ReadFull(r.Body, frameHeader); err != nil {
-		s.writeGRPCError(w, NewError(CodeInternal, "failed to read frame header"))
+		s.writeGRPCError(w, r, ctx, NewError(CodeInternal, "failed to read frame header"))
 		return
 	}
 
@@ -1209,92 +1445,103 @@ func (s *Service) handleGRPCRequest(w http.ResponseWriter, r *http.Request, ctx
 			*msgPtr = message[:0] // Reset slice
 			byteSlicePool.Put(msgPtr)
 		}()
+		if _, err := io.ReadFull(r.Body, message); err != nil {
+			s.writeGRPCError(w, r, ctx, NewError(CodeInternal, "failed to read message"))
+			return
+		}
 	} else {
-		// For very large messages, allocate directly
-		message = make([]byte, messageLength)
-	}
-
-	if _, err := io.ReadFull(r.Body, message); err != nil {
-		s.writeGRPCError(w, NewError(CodeInternal, "failed to read message"))
-		return
+		// For very large messages, grow the buffer with the data actually
+		// received rather than trusting the length prefix
+		data, err := io.ReadAll(io.LimitReader(r.Body, int64(messageLength)))
+		if err != nil || len(data) != messageLength {
+			s.writeGRPCError(w, r, ctx, NewError(CodeInternal, "failed to read message"))
+			return
+		}
+		message = data
 	}
 
-	// Decompress if needed
+	// Decompress if needed, within the decompression limits
+	p := detectProtocol(r)
 	if compressed {
-		// gRPC uses gzip by default
-		compressor, ok := GetCompressor(CompressionGzip)
-		if !ok {
-			s.writeGRPCError(w, NewError(CodeUnimplemented, "gzip compression not available"))
+		decompressed, err := s.options.DecompressionLimits.decompress(ctx.method.Name, messageEncoding(r, p), message)
+		if err != nil {
+			s.writeGRPCError(w, r, ctx, err)
 			return
 		}
+		message = decompressed
+	}
 
-		decompressed, err := compressor.Decompress(message)
-		if err != nil {
-			s.writeGRPCError(w, NewErrorf(CodeInternal, "decompression failed: %v", err))
+	// Reject unknown fields in strict mode
+	if p.wantsJSON {
+		if err := s.checkUnknownJSONFields(message, ctx); err != nil {
+			s.writeGRPCError(w, r, ctx, err)
 			return
 		}
-		message = decompressed
 	}
 
 	// Decode input
-	p := detectProtocol(r)
-	inputVal, err := s.decodeGRPCInput(message, ctx, p.wantsJSON)
+	inputVal, err := s.decodeGRPCInput(reqCtx, message, ctx, p.wantsJSON)
 	if err != nil {
-		s.writeGRPCError(w, err)
+		s.writeGRPCError(w, r, ctx, err)
 		return
 	}
 
+	// Fill unset fields with their defaults
+	applyDefaults(inputVal, ctx)
+
 	// Validate if enabled
-	if err := s.validateInput(inputVal, ctx); err != nil {
-		s.writeGRPCError(w, err)
+	if err := s.validateInput(reqCtx, inputVal, ctx); err != nil {
+		s.writeGRPCError(w, r, ctx, err)
 		return
 	}
 
-	// Call handler with potentially timeout-limited context (gRPC deadline)
-	reqCtx := r.Context()
-	if deadline := r.Header.Get("grpc-timeout"); deadline != "" {
-		// Parse gRPC timeout format (e.g., "10S" for 10 seconds)
-		if timeout, err := parseGRPCTimeout(deadline); err == nil && timeout > 0 {
-			var cancel context.CancelFunc
-			reqCtx, cancel = context.WithTimeout(reqCtx, timeout)
-			defer cancel()
-		}
-	}
-
 	// Call handler
-	output, err := s.callHandler(reqCtx, inputVal, ctx)
+	output, err := s.callHandler(s.profilePhase(reqCtx, profilePhaseHandler), inputVal, ctx)
 	if err != nil {
-		s.writeGRPCError(w, err)
+		s.writeGRPCError(w, r, ctx, err)
 		return
 	}
 
 	// Encode and send response
+	s.profilePhase(r.Context(), profilePhaseEncode)
 	if err := s.encodeGRPCResponse(w, r, output, ctx); err != nil {
-		s.writeGRPCError(w, err)
+		s.writeGRPCError(w, r, ctx, err)
 	}
 }
 
-// decodeGRPCInput decodes gRPC input.
-func (s *Service) decodeGRPCInput(data []byte, ctx *handlerContext, isJSON bool) (reflect.Value, error) {
+// decodeGRPCInput decodes gRPC input, decoding protobuf messages into the
+// arena of reqCtx, if any.
+func (s *Service) decodeGRPCInput(reqCtx context.Context, data []byte, ctx *handlerContext, isJSON bool) (reflect.Value, error) {
+	// Zero-length messages carry the default value, also for gRPC+JSON
+	if len(data) == 0 && isJSON && s.options.StrictGRPC {
+		data = []byte("{}")
+	}
+
+	// Protobuf types are decoded directly
+	if ctx.useProtoInput && ctx.method.ProtoInput != nil {
+		msg := proto.Clone(ctx.method.ProtoInput)
+		if isJSON {
+			if err := s.unmarshalProtoJSON(data, msg); err != nil {
+				return reflect.Value{}, err
+			}
+		} else if err := proto.Unmarshal(data, msg); err != nil {
+			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal protobuf: %v", err)
+		}
+		return reflect.ValueOf(msg), nil
+	}
+
 	// Create input instance
 	inputVal := reflect.New(ctx.method.InputType)
 
 	if isJSON {
 		// Decode JSON
-		if err := json.Unmarshal(data, inputVal.Interface()); err != nil {
+		if err := s.unmarshalStructJSON(data, inputVal.Interface(), ctx, true); err != nil {
 			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal JSON: %v", err)
 		}
 	} else {
 		// Decode protobuf
-		msg, err := ctx.inputCodec.Unmarshal(data)
-		if err != nil {
-			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal protobuf: %v", err)
-		}
-		defer ctx.inputCodec.ReleaseMessage(msg)
-
-		// Convert to struct
-		if err := reflectutil.ProtoToStruct(msg.ProtoReflect(), inputVal.Interface()); err != nil {
-			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to convert proto to struct: %v", err)
+		if err := unmarshalStructProto(reqCtx, ctx.inputCodec, data, inputVal.Interface()); err != nil {
+			return reflect.Value{}, err
 		}
 	}
 
@@ -1310,27 +1557,10 @@ func (s *Service) encodeGRPCResponse(w http.ResponseWriter, r *http.Request, out
 		contentType = "application/grpc+json"
 	}
 
-	// Set gRPC headers
-	w.Header().Set("Content-Type", contentType)
-	// Declare trailers that will be sent
-	w.Header().Set("Trailer", "grpc-status, grpc-message")
-	w.WriteHeader(http.StatusOK)
-
-	// Encode struct based on content type
-	var data []byte
-	var err error
-	if p.wantsJSON {
-		// Encode as JSON for gRPC+JSON
-		data, err = json.Marshal(output)
-		if err != nil {
-			return fmt.Errorf("failed to marshal struct to JSON: %w", err)
-		}
-	} else {
-		// Encode as protobuf
-		data, err = ctx.outputCodec.MarshalStruct(output)
-		if err != nil {
-			return fmt.Errorf("failed to marshal struct to protobuf: %w", err)
-		}
+	// Encode before writing headers, so failures can still be reported as a status
+	data, err := s.marshalGRPCOutput(output, ctx, p.wantsJSON)
+	if err != nil {
+		return err
 	}
 
 	// Check if compression should be used
@@ -1343,11 +1573,25 @@ func (s *Service) encodeGRPCResponse(w http.ResponseWriter, r *http.Request, out
 			if err == nil && len(compressedData) < len(data) {
 				data = compressedData
 				compressed = true
-				w.Header().Set("grpc-encoding", CompressionGzip)
 			}
 		}
 	}
 
+	// Set gRPC headers
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	if compressed {
+		h.Set("grpc-encoding", CompressionGzip)
+	}
+	for key, values := range ctx.responseHeaders {
+		for _, value := range values {
+			h.Add(key, value)
+		}
+	}
+	// Declare trailers that will be sent
+	h.Set("Trailer", "grpc-status, grpc-message")
+	w.WriteHeader(http.StatusOK)
+
 	// Write gRPC frame using pooled buffer
 	framePtr := frameHeaderPool.Get().(*[]byte)
 	frame := *framePtr
@@ -1374,9 +1618,9 @@ func (s *Service) encodeGRPCResponse(w http.ResponseWriter, r *http.Request, out
 	// Send trailers after writing the body
 	// In HTTP/2, trailers are sent as a separate HEADERS frame with END_STREAM flag
 	// The Go HTTP/2 server automatically sends trailers when we set them after writing the body
-	trailer := w.Header()
-	trailer.Set("grpc-status", "0")
-	trailer.Set("grpc-message", "")
+	h.Set("grpc-status", "0")
+	h.Set("grpc-message", "")
+	setGRPCTrailers(h, ctx.responseTrailers)
 
 	// Flush to ensure trailers are sent
 	// This is critical for HTTP/2 trailers to be properly sent
@@ -1387,20 +1631,33 @@ func (s *Service) encodeGRPCResponse(w http.ResponseWriter, r *http.Request, out
 	return nil
 }
 
-// writeGRPCError writes a gRPC error response.
-func (s *Service) writeGRPCError(w http.ResponseWriter, err error) {
-	// Convert to our Error type if needed
-	var rpcErr *Error
-	if e, ok := err.(*Error); ok {
-		rpcErr = e
-	} else {
-		rpcErr = NewError(CodeInternal, err.Error())
-	}
+// marshalGRPCOutput encodes a gRPC response message.
+func (s *Service) marshalGRPCOutput(output any, ctx *handlerContext, isJSON bool) ([]byte, error) {
+	msg, isProto := output.(proto.Message)
+	isProto = isProto && ctx.useProtoOutput
 
-	w.Header().Set("Content-Type", contentTypeGRPCProto)
-	w.Header().Set("grpc-status", fmt.Sprintf("%d", grpcStatusCode(rpcErr.Code)))
-	w.Header().Set("grpc-message", rpcErr.Message)
-	w.WriteHeader(http.StatusOK)
+	switch {
+	case isJSON:
+		// gRPC-JSON follows the proto3 JSON mapping
+		data, err := s.marshalMessageJSON(output, ctx, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return data, nil
+	case isProto:
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal protobuf: %w", err)
+		}
+		return data, nil
+	default:
+		// Encode as protobuf
+		data, err := ctx.outputCodec.MarshalStruct(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal struct to protobuf: %w", err)
+		}
+		return data, nil
+	}
 }
 
 // parseGRPCTimeout parses gRPC timeout format (e.g., "10S" for 10 seconds).
@@ -1444,7 +1701,7 @@ func (s *Service) createStreamingHTTPHandler(method *Method) http.HandlerFunc {
 	}
 
 	// Cache the prepared context
-	s.handlerCtxCache[method.Name] = cachedCtx
+	s.cacheHandlerContext(method.Name, cachedCtx)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get context from pool
@@ -1457,13 +1714,16 @@ func (s *Service) createStreamingHTTPHandler(method *Method) http.HandlerFunc {
 				clear(ctx.responseTrailers)
 			}
 			ctx.requestHeaders = nil
+			ctx.arena.Release()
 			handlerContextPool.Put(ctx)
 		}()
+		ctx.resetArena()
 
 		// Copy cached values
 		ctx.inputCodec = cachedCtx.inputCodec
 		ctx.outputCodec = cachedCtx.outputCodec
 		ctx.method = cachedCtx.method
+		ctx.procedure = cachedCtx.procedure
 		ctx.validator = cachedCtx.validator
 		ctx.options = cachedCtx.options
 		ctx.handlerInfo = cachedCtx.handlerInfo
@@ -1483,14 +1743,29 @@ func (s *Service) createStreamingHTTPHandler(method *Method) http.HandlerFunc {
 		} else {
 			clear(ctx.responseTrailers)
 		}
-		ctx.requestHeaders = r.Header
 
 		// Copy interceptors
 		ctx.interceptors = ctx.interceptors[:0]
 		ctx.interceptors = append(ctx.interceptors, cachedCtx.interceptors...)
 
+		// Record the stats of the stream for response hooks
+		w, r, reportStats := s.recordStats(w, r)
+		if reportStats != nil {
+			defer reportStats(ctx)
+		}
+
 		// Detect protocol
 		p := detectProtocol(r)
+		ctx.setRequest(r, p)
+		s.announceDeprecation(w, r, ctx)
+
+		r, release, ok := s.admitRequest(w, r, ctx, p)
+		if !ok {
+			return
+		}
+		defer release()
+
+		defer s.trackStream(method.Name)()
 
 		switch method.StreamType {
 		case StreamTypeServerStream:
@@ -1506,7 +1781,7 @@ func (s *Service) createStreamingHTTPHandler(method *Method) http.HandlerFunc {
 			case p.isConnect:
 				s.writeConnectError(w, r, err)
 			case p.isGRPC:
-				s.writeGRPCError(w, err)
+				s.writeGRPCError(w, r, ctx, err)
 			default:
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
@@ -1516,7 +1791,7 @@ func (s *Service) createStreamingHTTPHandler(method *Method) http.HandlerFunc {
 			case p.isConnect:
 				s.writeConnectError(w, r, err)
 			case p.isGRPC:
-				s.writeGRPCError(w, err)
+				s.writeGRPCError(w, r, ctx, err)
 			default:
 				http.Error(w, err.Error(), http.StatusNotImplemented)
 			}
@@ -3,13 +3,16 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"reflect"
-	"strings"
-	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 // handleJSONRPCRequest handles JSON-RPC 2.0 requests
@@ -60,7 +63,7 @@ func (s *Service) handleJSONRPCRequest(w http.ResponseWriter, r *http.Request, _
 	}
 
 	// Process the request
-	response := s.processJSONRPCRequest(r.Context(), &req)
+	response := s.processJSONRPCRequest(r.Context(), r, w.Header(), &req)
 
 	// Don't send response for notifications
 	if req.IsNotification() && response.Error == nil {
@@ -72,17 +75,22 @@ func (s *Service) handleJSONRPCRequest(w http.ResponseWriter, r *http.Request, _
 	s.writeJSONRPCResponse(w, response)
 }
 
-// processJSONRPCRequest processes a single JSON-RPC request
-func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest) *JSONRPCResponse {
+// processJSONRPCRequest processes a single JSON-RPC request, setting the
+// pushback headers of a shed call on header
+func (s *Service) processJSONRPCRequest(ctx context.Context, r *http.Request, header http.Header, req *JSONRPCRequest) *JSONRPCResponse {
 	// Create response with matching ID
 	resp := &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
 	}
 
+	// Serve the OpenRPC document
+	if req.Method == JSONRPCDiscoverMethod {
+		return s.discoverJSONRPC(resp)
+	}
+
 	// Resolve method name
-	methodName := s.resolveJSONRPCMethod(req.Method)
-	method, exists := s.methods[methodName]
+	method, exists := s.resolveJSONRPCMethod(req.Method)
 	if !exists {
 		resp.Error = &JSONRPCError{
 			Code:    JSONRPCMethodNotFound,
@@ -92,7 +100,7 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 	}
 
 	// Check if we have a cached handler context
-	cachedCtx, ok := s.handlerCtxCache[method.Name]
+	cachedCtx, ok := s.cachedHandlerContext(method.Name)
 	if !ok {
 		// Prepare handler context if not cached
 		var err error
@@ -105,13 +113,14 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 			return resp
 		}
 		// Cache it
-		s.handlerCtxCache[method.Name] = cachedCtx
+		s.cacheHandlerContext(method.Name, cachedCtx)
 	}
 
 	// Create a new handler context for this request
 	handlerCtx := &handlerContext{
 		method:           method,
-		options:          s.options,
+		procedure:        cachedCtx.procedure,
+		options:          &s.options,
 		validator:        s.validator,
 		responseHeaders:  make(map[string][]string),
 		responseTrailers: make(map[string][]string),
@@ -122,6 +131,39 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 		useProtoInput:    cachedCtx.useProtoInput,
 		useProtoOutput:   cachedCtx.useProtoOutput,
 	}
+	handlerCtx.setRequest(r, protocolInfo{isJSONRPC: true})
+	s.announceDeprecation(nil, r, handlerCtx)
+
+	// Report the stats of the call to response hooks
+	var code Code
+	if len(s.options.ResponseHooks) > 0 {
+		start := time.Now()
+		defer func() { s.reportJSONRPCStats(ctx, handlerCtx, req, resp, code, start) }()
+	}
+
+	// Shed calls while overloaded, by the priority of the method
+	release, rpcErr := s.admit(header, r, method)
+	if rpcErr != nil {
+		code = rpcErr.Code
+		resp.Error = NewJSONRPCError(rpcErr)
+		return resp
+	}
+	defer release()
+
+	// Wait for a slot within the method's concurrency limit, per call of a batch
+	releaseSlot, rpcErr := s.acquire(ctx, method)
+	if rpcErr != nil {
+		code = rpcErr.Code
+		resp.Error = NewJSONRPCError(rpcErr)
+		return resp
+	}
+	defer releaseSlot()
+
+	// Bound the call by the timeout of the method in the service config
+	if callCtx, cancel := withCallTimeout(ctx, 0, s.methodTimeout(handlerCtx.procedure)); cancel != nil {
+		defer cancel()
+		ctx = callCtx
+	}
 
 	// Decode parameters
 	inputPtr, err := s.decodeJSONRPCParams(req.Params, handlerCtx)
@@ -133,8 +175,18 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 		return resp
 	}
 
+	// Fill unset fields with their defaults
+	applyDefaults(inputPtr, handlerCtx)
+
 	// Validate input if enabled
-	if err := s.validateInput(inputPtr, handlerCtx); err != nil {
+	if err := s.validateInput(ctx, inputPtr, handlerCtx); err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) && rpcErr.Code != CodeInvalidArgument {
+			// Validation limits and deadlines are not invalid params
+			code = rpcErr.Code
+			resp.Error = NewJSONRPCError(rpcErr)
+			return resp
+		}
 		resp.Error = &JSONRPCError{
 			Code:    JSONRPCInvalidParams,
 			Message: err.Error(),
@@ -149,19 +201,29 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 	output, err := s.callHandler(ctx, inputPtr, handlerCtx)
 	if err != nil {
 		// Convert to JSON-RPC error
-		if rpcErr, ok := err.(*Error); ok {
-			resp.Error = NewJSONRPCError(rpcErr)
-		} else {
-			resp.Error = &JSONRPCError{
-				Code:    JSONRPCInternalError,
-				Message: err.Error(),
+		var rpcErr *Error
+		switch e := err.(type) {
+		case *Error:
+			rpcErr = e
+		case *ErrorWithDetails:
+			rpcErr = e.ToError(protocolConnect)
+		default:
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				rpcErr = NewError(CodeDeadlineExceeded, "Request deadline exceeded")
+			case errors.Is(err, context.Canceled):
+				rpcErr = NewError(CodeCanceled, "Request was canceled")
+			default:
+				rpcErr = NewError(CodeInternal, err.Error())
 			}
 		}
+		code = rpcErr.Code
+		resp.Error = NewJSONRPCError(s.options.ErrorSanitizer.sanitize(r, handlerCtx.procedure, rpcErr, err))
 		return resp
 	}
 
 	// Encode the result
-	resultData, err := json.Marshal(output)
+	resultData, err := s.marshalJSONRPCResult(output, handlerCtx)
 	if err != nil {
 		resp.Error = &JSONRPCError{
 			Code:    JSONRPCInternalError,
@@ -174,124 +236,61 @@ func (s *Service) processJSONRPCRequest(ctx context.Context, req *JSONRPCRequest
 	return resp
 }
 
-// resolveJSONRPCMethod converts JSON-RPC method name to internal format
-func (s *Service) resolveJSONRPCMethod(method string) string {
-	// If method contains dots, it might be fully qualified
-	if strings.Contains(method, ".") {
-		// Try to convert from JSON-RPC format to gRPC format
-		// e.g., "user.v1.UserService.CreateUser" -> "CreateUser"
-		parts := strings.Split(method, ".")
-		if len(parts) > 0 {
-			// Return the last part as the method name
-			return parts[len(parts)-1]
+// discoverJSONRPC answers rpc.discover with the OpenRPC document
+func (s *Service) discoverJSONRPC(resp *JSONRPCResponse) *JSONRPCResponse {
+	var err error
+	if resp.Result, err = s.encodedOpenRPC(); err != nil {
+		resp.Error = &JSONRPCError{
+			Code:    JSONRPCInternalError,
+			Message: fmt.Sprintf("Failed to build OpenRPC document: %v", err),
 		}
 	}
-
-	// Return as-is if it's already a simple method name
-	return method
+	return resp
 }
 
 // decodeJSONRPCParams decodes JSON-RPC parameters into the expected input type
 func (s *Service) decodeJSONRPCParams(params json.RawMessage, ctx *handlerContext) (reflect.Value, error) {
 	inputType := ctx.method.InputType
 	inputPtr := reflect.New(inputType)
+	if isDynamicMessage(ctx.method.ProtoInput) {
+		inputPtr = reflect.ValueOf(proto.Clone(ctx.method.ProtoInput))
+	}
 
 	// If params is null or empty, keep the zero value
 	if len(params) == 0 || string(params) == "null" {
 		return inputPtr, nil
 	}
 
-	// Unmarshal params into the input type
-	if err := json.Unmarshal(params, inputPtr.Interface()); err != nil {
+	// Unmarshal params into the input type, by the names of the naming policy
+	var err error
+	switch msg, ok := inputPtr.Interface().(proto.Message); {
+	case s.options.JSONNaming == JSONNamingDefault && !isDynamicMessage(msg):
+		if params, err = parseJSONInt64(params, ctx.inputCodec, s.options.JSONInt64); err == nil {
+			err = unmarshalJSON(params, inputPtr.Interface())
+		}
+	case ok:
+		err = protojson.UnmarshalOptions{DiscardUnknown: true, Resolver: s.resolver()}.Unmarshal(params, msg)
+	default:
+		err = s.unmarshalStructJSON(params, inputPtr.Interface(), ctx, true)
+	}
+	if err != nil {
 		return reflect.Value{}, fmt.Errorf("failed to decode parameters: %w", err)
 	}
 
 	return inputPtr, nil
 }
 
-// handleJSONRPCBatch handles batch JSON-RPC requests
-func (s *Service) handleJSONRPCBatch(w http.ResponseWriter, r *http.Request, body []byte) {
-	var requests []JSONRPCRequest
-	if err := json.Unmarshal(body, &requests); err != nil {
-		s.writeJSONRPCError(w, nil, &JSONRPCError{
-			Code:    JSONRPCParseError,
-			Message: "Invalid batch request",
-		})
-		return
-	}
-
-	// Check batch size limit
-	if len(requests) > s.options.JSONRPCBatchLimit {
-		s.writeJSONRPCError(w, nil, &JSONRPCError{
-			Code:    JSONRPCInvalidRequest,
-			Message: fmt.Sprintf("Batch request exceeds limit of %d", s.options.JSONRPCBatchLimit),
-		})
-		return
-	}
-
-	// Process requests in parallel with a semaphore to limit concurrency
-	const maxConcurrency = 10
-	sem := make(chan struct{}, maxConcurrency)
-
-	responses := make([]*JSONRPCResponse, 0, len(requests))
-	responseMu := sync.Mutex{}
-	wg := sync.WaitGroup{}
-
-	for i := range requests {
-		req := &requests[i]
-
-		// Validate each request
-		if req.JSONRPC != "2.0" {
-			responseMu.Lock()
-			responses = append(responses, &JSONRPCResponse{
-				JSONRPC: "2.0",
-				ID:      req.ID,
-				Error: &JSONRPCError{
-					Code:    JSONRPCInvalidRequest,
-					Message: "Invalid jsonrpc version",
-				},
-			})
-			responseMu.Unlock()
-			continue
-		}
-
-		// Skip notifications in batch
-		if req.IsNotification() {
-			continue
+// marshalJSONRPCResult encodes the result of a call like the params are
+// decoded: with encoding/json by default, otherwise by the naming policy.
+func (s *Service) marshalJSONRPCResult(output any, ctx *handlerContext) ([]byte, error) {
+	if s.options.JSONNaming == JSONNamingDefault && !isDynamicMessage(output) {
+		data, err := marshalJSON(output)
+		if err != nil {
+			return nil, err
 		}
-
-		wg.Add(1)
-		go func(req *JSONRPCRequest) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			// Process request
-			resp := s.processJSONRPCRequest(r.Context(), req)
-
-			// Add to responses
-			responseMu.Lock()
-			responses = append(responses, resp)
-			responseMu.Unlock()
-		}(req)
-	}
-
-	wg.Wait()
-
-	// If all requests were notifications, return no content
-	if len(responses) == 0 {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	// Write batch response
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(responses); err != nil {
-		// Log error, but response is already partially written
-		log.Printf("Failed to write batch response: %v", err)
+		return formatJSONInt64(data, output, ctx.outputCodec, s.options.JSONInt64)
 	}
+	return s.marshalMessageJSON(output, ctx, true)
 }
 
 // writeJSONRPCResponse writes a JSON-RPC response
@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -8,9 +9,12 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,14 +24,20 @@ const (
 	frameLengthOffset    = 1
 	frameLengthSize      = 5
 	defaultFlushInterval = 10 * time.Millisecond
+	connectFlagEndStream = 0x02
 )
 
 // handleServerStreamRequest handles server-streaming RPC requests
 func (s *Service) handleServerStreamRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo) {
 	// Add panic recovery
 	defer func() {
-		if p := recover(); p != nil {
-			err := fmt.Errorf("panic in streaming handler: %v", p)
+		if rec := recover(); rec != nil {
+			err := fmt.Errorf("panic in streaming handler: %v", rec)
+			if p.isGRPC && s.options.StrictGRPC {
+				// gRPC clients expect a status, even after messages were sent
+				s.writeGRPCError(w, r, nil, NewError(CodeInternal, err.Error()))
+				return
+			}
 			s.writeError(w, r, err)
 		}
 	}()
@@ -39,20 +49,15 @@ func (s *Service) handleServerStreamRequest(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Parse timeout
-	reqCtx := parseRequestTimeout(r, p.isConnect)
+	reqCtx := parseRequestTimeout(r, p, s.methodTimeout(ctx.procedure))
 	if cancel, ok := reqCtx.Value(contextKeyCancel).(context.CancelFunc); ok {
 		defer cancel()
 		reqCtx = context.WithValue(reqCtx, contextKeyCancel, nil)
 	}
+	reqCtx = ctx.withArena(reqCtx)
 
 	// Read and process request body
-	body, err := s.readStreamRequestBody(r, p, w)
-	if err != nil {
-		return // Error already written
-	}
-
-	// Decompress if needed
-	body, err = s.decompressRequestBody(r, body, w)
+	body, err := s.readStreamRequestBody(r, p, w, ctx.method.Name)
 	if err != nil {
 		return // Error already written
 	}
@@ -61,99 +66,136 @@ func (s *Service) handleServerStreamRequest(w http.ResponseWriter, r *http.Reque
 	s.processStreamRequest(w, r, ctx, p, body, reqCtx)
 }
 
-// readStreamRequestBody reads the request body based on protocol
-func (s *Service) readStreamRequestBody(r *http.Request, p protocolInfo, w http.ResponseWriter) ([]byte, error) {
+// readStreamRequestBody reads the request message based on protocol. A body
+// with Content-Encoding is decompressed while reading, and an enveloped message
+// with the compressed flag according to the encoding of its protocol.
+func (s *Service) readStreamRequestBody(r *http.Request, p protocolInfo, w http.ResponseWriter, method string) ([]byte, error) {
 	defer func() { _ = r.Body.Close() }()
 
-	if p.isGRPC {
-		return s.readGRPCFramedBody(r, p, w)
-	}
-	return s.readNonGRPCBody(r, p, w)
-}
-
-// readGRPCFramedBody reads a gRPC framed message
-func (s *Service) readGRPCFramedBody(r *http.Request, _ protocolInfo, w http.ResponseWriter) ([]byte, error) {
-	frameHeader := make([]byte, frameHeaderLength)
-	if _, err := io.ReadFull(r.Body, frameHeader); err != nil {
-		s.writeGRPCError(w, NewError(CodeInternal, "failed to read gRPC frame header"))
+	body, err := s.readStreamBody(r, method)
+	if err != nil {
+		s.writeStreamReadError(w, r, p, err)
 		return nil, err
 	}
-
-	// Parse frame header
-	messageLength := binary.BigEndian.Uint32(frameHeader[frameLengthOffset:frameLengthSize])
-
-	// Read message body
-	body := make([]byte, messageLength)
-	if _, err := io.ReadFull(r.Body, body); err != nil {
-		s.writeGRPCError(w, NewError(CodeInternal, "failed to read gRPC message body"))
-		return nil, err
+	if !p.isGRPC && !p.isGRPCWeb && !p.isConnect {
+		return body, nil
 	}
 
-	return body, nil
-}
-
-// readNonGRPCBody reads a non-gRPC request body
-func (s *Service) readNonGRPCBody(r *http.Request, p protocolInfo, w http.ResponseWriter) ([]byte, error) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		s.writeError(w, r, fmt.Errorf("failed to read body: %w", err))
-		return nil, err
+	// Unwrap the enveloped message
+	if len(body) < frameHeaderLength {
+		if p.isGRPC {
+			err = NewError(CodeInternal, "failed to read gRPC frame header")
+			s.writeStreamReadError(w, r, p, err)
+			return nil, err
+		}
+		return body, nil
+	}
+	flags := body[0]
+	length := binary.BigEndian.Uint32(body[frameLengthOffset:frameLengthSize])
+	if uint64(length) != uint64(len(body)-frameHeaderLength) {
+		if p.isGRPC {
+			err = NewError(CodeInternal, "failed to read gRPC message body")
+			s.writeStreamReadError(w, r, p, err)
+			return nil, err
+		}
+		// Not enveloped, e.g. a Connect unary-style request to a stream
+		return body, nil
 	}
+	body = body[frameHeaderLength:]
 
-	// Check if this is a Connect protocol request with framing
-	if p.isConnect && len(body) >= frameHeaderLength {
-		// Check if it looks like Connect framing (5-byte header)
-		length := binary.BigEndian.Uint32(body[frameLengthOffset:frameLengthSize])
-		if int(length) == len(body)-frameHeaderLength {
-			// This is a framed message, extract the actual message
-			body = body[frameHeaderLength:]
+	if flags&frameFlagCompressed != 0 {
+		encoding := messageEncoding(r, p)
+		if encoding == CompressionIdentity {
+			err = NewError(CodeInvalidArgument, "compressed message without a message encoding")
+		} else {
+			body, err = s.options.DecompressionLimits.decompress(method, encoding, body)
+		}
+		if err != nil {
+			s.writeStreamReadError(w, r, p, err)
+			return nil, err
 		}
 	}
-
 	return body, nil
 }
 
-// decompressRequestBody decompresses the request body if needed
-func (s *Service) decompressRequestBody(r *http.Request, body []byte, w http.ResponseWriter) ([]byte, error) {
-	if encoding := r.Header.Get("Content-Encoding"); encoding == CompressionGzip {
-		compressor, ok := GetCompressor(CompressionGzip)
-		if !ok {
-			s.writeError(w, r, fmt.Errorf("gzip decompression not available"))
-			return nil, fmt.Errorf("gzip decompression not available")
-		}
-		decompressed, err := compressor.Decompress(body)
+// readStreamBody reads the request body, decompressing it while reading when
+// it has a Content-Encoding.
+func (s *Service) readStreamBody(r *http.Request, method string) ([]byte, error) {
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding == CompressionIdentity || encoding == "identity" {
+		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			s.writeError(w, r, fmt.Errorf("failed to decompress request: %w", err))
-			return nil, err
+			return nil, fmt.Errorf("failed to read body: %w", err)
 		}
-		return decompressed, nil
+		return body, nil
 	}
-	return body, nil
+	return s.options.DecompressionLimits.readDecompressed(method, encoding, r.Body)
+}
+
+// writeStreamReadError reports an error reading the request of a stream.
+func (s *Service) writeStreamReadError(w http.ResponseWriter, r *http.Request, p protocolInfo, err error) {
+	if p.isGRPC {
+		s.writeGRPCError(w, r, nil, err)
+		return
+	}
+	s.writeError(w, r, err)
 }
 
 // processStreamRequest processes the streaming request
 func (s *Service) processStreamRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo, body []byte, reqCtx context.Context) {
+	// Create stream implementation
+	baseStream := newServerStreamWriter(w, r, ctx, p)
+	baseStream.computed = s.computed
+	baseStream.transformers = s.options.StreamResponseTransformers
+	defer func() { recordResponseMessages(r.Context(), baseStream.sent()) }()
+
 	// Decode input
-	inputVal, decodeErr := s.decodeInput(r.Header.Get("Content-Type"), body, ctx)
+	s.profilePhase(reqCtx, profilePhaseDecode)
+	inputVal, decodeErr := s.decodeInput(reqCtx, r.Header.Get("Content-Type"), body, ctx)
 	if decodeErr != nil {
-		s.writeProtocolError(w, r, p, decodeErr)
+		s.writeStreamSetupError(w, r, p, baseStream, decodeErr)
 		return
 	}
 
+	// Fill unset fields with their defaults
+	applyDefaults(inputVal, ctx)
+
 	// Validate if enabled
-	if err := s.validateInput(inputVal, ctx); err != nil {
-		s.writeProtocolError(w, r, p, err)
+	if err := s.validateInput(reqCtx, inputVal, ctx); err != nil {
+		s.writeStreamSetupError(w, r, p, baseStream, err)
 		return
 	}
 
-	// Create stream implementation
-	baseStream := newServerStreamWriter(w, r, ctx, p)
+	// Prune messages to the field mask of the request
+	mask, err := s.responseFieldMask(ctx.method, inputVal)
+	if err != nil {
+		s.writeStreamSetupError(w, r, p, baseStream, err)
+		return
+	}
+	baseStream.fieldMask = mask
 
 	// Add handler context to the request context
 	reqCtx = context.WithValue(reqCtx, handlerContextKey, ctx)
 
+	// Expose the routing key before any message is sent
+	reqCtx = s.applyRoutingKey(reqCtx, w, ctx.method, inputVal)
+
+	// Resume the stream after the last message the client received
+	reqCtx = s.applyResumeCursor(reqCtx, r, ctx.method)
+	baseStream.resumable = s.streamResumption(ctx.method)
+
+	// The stream context ends as soon as the client can no longer be written to
+	reqCtx, cancel := context.WithCancelCause(reqCtx)
+	defer cancel(nil)
+	baseStream.start(reqCtx, cancel, s.streamFlowControl(ctx.method), s.streamHeartbeat(ctx.method))
+
 	// Call the handler
-	if err := s.callStreamHandler(ctx, reqCtx, inputVal, baseStream); err != nil {
+	reqCtx = s.profilePhase(reqCtx, profilePhaseHandler)
+	err = s.callStreamHandler(ctx, reqCtx, inputVal, baseStream)
+	if deadlineErr := callDeadlineError(reqCtx); deadlineErr != nil {
+		err = deadlineErr
+	}
+	if err != nil {
 		baseStream.sendError(err)
 		return
 	}
@@ -162,15 +204,24 @@ func (s *Service) processStreamRequest(w http.ResponseWriter, r *http.Request, c
 	baseStream.finalize()
 }
 
-// writeProtocolError writes an error based on the protocol
-func (s *Service) writeProtocolError(w http.ResponseWriter, r *http.Request, p protocolInfo, err error) {
-	if p.isGRPC {
-		s.writeGRPCError(w, err.(*Error))
-	} else {
+// writeStreamSetupError reports an error that occurred before the handler ran.
+// Connect streaming clients expect the error in an EndStreamResponse frame.
+func (s *Service) writeStreamSetupError(w http.ResponseWriter, r *http.Request, p protocolInfo, stream *serverStreamWriter, err error) {
+	switch {
+	case p.isConnect && isConnectStreamingContentType(r.Header.Get("Content-Type")):
+		stream.sendError(err)
+	case p.isGRPC:
+		s.writeGRPCError(w, r, stream.ctx, err)
+	default:
 		s.writeError(w, r, err)
 	}
 }
 
+// isConnectStreamingContentType reports whether the content type uses Connect streaming framing.
+func isConnectStreamingContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/connect+")
+}
+
 // callStreamHandler calls the streaming handler
 func (s *Service) callStreamHandler(ctx *handlerContext, reqCtx context.Context, inputVal reflect.Value, baseStream *serverStreamWriter) error {
 	// Type assert to the wrapped handler signature
@@ -193,34 +244,6 @@ func (s *Service) callStreamHandler(ctx *handlerContext, reqCtx context.Context,
 	return nil
 }
 
-// handleClientStreamRequest handles client-streaming RPC requests
-func (s *Service) handleClientStreamRequest(w http.ResponseWriter, r *http.Request, _ *handlerContext, p protocolInfo) {
-	// For now, return unimplemented
-	err := NewError(CodeUnimplemented, "Client streaming not yet implemented")
-	switch {
-	case p.isConnect:
-		s.writeConnectError(w, r, err)
-	case p.isGRPC:
-		s.writeGRPCError(w, err)
-	default:
-		http.Error(w, err.Error(), http.StatusNotImplemented)
-	}
-}
-
-// handleBidiStreamRequest handles bidirectional streaming RPC requests
-func (s *Service) handleBidiStreamRequest(w http.ResponseWriter, r *http.Request, _ *handlerContext, p protocolInfo) {
-	// For now, return unimplemented
-	err := NewError(CodeUnimplemented, "Bidirectional streaming not yet implemented")
-	switch {
-	case p.isConnect:
-		s.writeConnectError(w, r, err)
-	case p.isGRPC:
-		s.writeGRPCError(w, err)
-	default:
-		http.Error(w, err.Error(), http.StatusNotImplemented)
-	}
-}
-
 // serverStreamWriter implements server-side streaming
 type serverStreamWriter struct {
 	w            http.ResponseWriter
@@ -236,13 +259,46 @@ type serverStreamWriter struct {
 
 	// Cached encoding function to avoid repeated checks
 	encodeFunc func(any) ([]byte, error)
+	// Fills computed fields of messages before encoding
+	computed *computedFields
+	// Prunes messages to the field mask of the request, if any
+	fieldMask fieldMaskTree
+	// Post-process messages before encoding, with the index of the next one
+	transformers []StreamResponseTransformer
+	nextIndex    int
 
 	// Batching control
 	lastFlush   time.Time
 	flushPeriod time.Duration
+
+	// Context of the handler, canceled when a write fails
+	streamCtx context.Context
+	cancel    context.CancelCauseFunc
+	// Buffers the frames written by Send under flow control, or nil
+	buffer *streamBuffer
+	// Serializes the frames written directly, by Send and heartbeats
+	writeMu   sync.Mutex
+	lastWrite atomic.Int64 // Unix nanoseconds of the last frame
+
+	// Heartbeats sent while the stream is idle
+	heartbeatFrame []byte
+	heartbeatStop  chan struct{}
+	heartbeatDone  chan struct{}
+
+	// Serves plain HTTP streams as server-sent events
+	sse bool
+	// Sends the cursors of messages, and the cursor of the last one sent
+	resumable bool
+	cursor    string
 }
 
 func newServerStreamWriter(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo) *serverStreamWriter {
+	// gRPC-Web streams are written as gRPC streams, which the gateway
+	// translates to gRPC-Web frames
+	if p.isGRPCWeb {
+		p.isGRPC = true
+	}
+
 	flusher, _ := w.(http.Flusher)
 	s := &serverStreamWriter{
 		w:           w,
@@ -252,18 +308,14 @@ func newServerStreamWriter(w http.ResponseWriter, r *http.Request, ctx *handlerC
 		flusher:     flusher,
 		flushPeriod: defaultFlushInterval, // Flush every 10ms or after each message in low-throughput scenarios
 		lastFlush:   time.Now(),
+		sse:         isEventStream(r, p),
 	}
 
 	// Pre-determine encoding function based on protocol
-	isJSON := p.wantsJSON
+	isJSON := p.wantsJSON || s.sse
 	switch {
-	case p.isGRPC && !isJSON:
-		// gRPC protobuf encoding
-		s.encodeFunc = func(msg any) ([]byte, error) {
-			return ctx.outputCodec.MarshalStruct(msg)
-		}
 	case ctx.useProtoOutput && !isJSON:
-		// Connect protobuf encoding
+		// Protobuf messages encode themselves, whatever the protocol
 		s.encodeFunc = func(msg any) ([]byte, error) {
 			if protoMsg, ok := msg.(proto.Message); ok {
 				return proto.Marshal(protoMsg)
@@ -271,8 +323,20 @@ func newServerStreamWriter(w http.ResponseWriter, r *http.Request, ctx *handlerC
 			return nil, fmt.Errorf("expected proto.Message, got %T", msg)
 		}
 	case isJSON:
-		// JSON encoding
-		s.encodeFunc = json.Marshal
+		// JSON encoding, with the protobuf JSON mapping for protobuf messages
+		s.encodeFunc = func(msg any) ([]byte, error) {
+			var data []byte
+			var err error
+			if protoMsg, ok := msg.(proto.Message); ok && ctx.useProtoOutput {
+				data, err = protojson.Marshal(protoMsg)
+			} else {
+				data, err = marshalJSON(msg)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return formatJSONInt64(data, msg, ctx.outputCodec, ctx.options.JSONInt64)
+		}
 	default:
 		// Default: use codec
 		s.encodeFunc = func(msg any) ([]byte, error) {
@@ -283,13 +347,41 @@ func newServerStreamWriter(w http.ResponseWriter, r *http.Request, ctx *handlerC
 	return s
 }
 
-// Context returns the stream context
+// start sets the context of the stream handler, starts buffering the frames
+// written by Send under flow control, and sends heartbeats every heartbeat of
+// idleness, unless it is 0.
+func (s *serverStreamWriter) start(ctx context.Context, cancel context.CancelCauseFunc, fc StreamFlowControl, heartbeat time.Duration) {
+	s.streamCtx = ctx
+	s.cancel = cancel
+	s.lastWrite.Store(time.Now().UnixNano())
+	if fc.HighWaterMark > 0 {
+		s.buffer = newStreamBuffer(s.w, s.flusher, fc, cancel)
+	}
+	if heartbeat > 0 {
+		s.startHeartbeat(heartbeat)
+	}
+}
+
+// Context returns the stream context. It is canceled when the client
+// disconnects or a write to it fails.
 func (s *serverStreamWriter) Context() context.Context {
+	if s.streamCtx != nil {
+		return s.streamCtx
+	}
 	return s.r.Context()
 }
 
 // Send sends a message to the client
 func (s *serverStreamWriter) Send(msg any) error {
+	return s.send(msg, "")
+}
+
+// send sends a message with the cursor resuming the stream after it, if any.
+func (s *serverStreamWriter) send(msg any, cursor string) error {
+	if !s.resumable {
+		cursor = ""
+	}
+
 	// Check error state with minimal lock
 	s.mu.Lock()
 	if s.err != nil {
@@ -302,10 +394,20 @@ func (s *serverStreamWriter) Send(msg any) error {
 		s.sendHeaders()
 		s.headersSent = true
 	}
+	index := s.nextIndex
+	s.nextIndex++
 	s.mu.Unlock()
 
-	// Encode the message outside of lock
-	data, err := s.encodeFunc(msg)
+	// Fill computed fields, prune, transform, and encode the message outside of lock
+	err := s.computed.apply(s.Context(), msg)
+	if err == nil && s.fieldMask != nil {
+		err = pruneFieldMask(msg, s.fieldMask)
+	}
+	var data []byte
+	if err == nil {
+		msg = transformStreamResponse(s.transformers, s.Context(), msg, index)
+		data, err = s.encodeFunc(msg)
+	}
 	if err != nil {
 		s.mu.Lock()
 		s.err = err
@@ -320,15 +422,11 @@ func (s *serverStreamWriter) Send(msg any) error {
 		writeErr = s.sendConnectMessage(data)
 	case s.protocol.isGRPC:
 		writeErr = s.sendGRPCMessage(data)
+	case s.sse:
+		writeErr = s.writeFrame(serverSentEvent("", cursor, data), true)
 	default:
 		// Plain HTTP streaming (newline-delimited JSON)
-		_, writeErr = s.w.Write(data)
-		if writeErr == nil {
-			_, writeErr = s.w.Write([]byte("\n"))
-		}
-		if writeErr == nil && s.flusher != nil {
-			s.flusher.Flush()
-		}
+		writeErr = s.writeFrame(append(data, '\n'), true)
 	}
 
 	// Update state with lock
@@ -336,15 +434,52 @@ func (s *serverStreamWriter) Send(msg any) error {
 		s.mu.Lock()
 		s.err = writeErr
 		s.mu.Unlock()
+		if s.cancel != nil {
+			s.cancel(writeErr)
+		}
 	} else {
 		s.mu.Lock()
 		s.messageCount++
+		if cursor != "" {
+			s.cursor = cursor
+		}
 		s.mu.Unlock()
 	}
 
 	return writeErr
 }
 
+// sendHeader writes the headers of the stream before its first message and
+// flushes them, as grpc.SendHeader does. Under flow control, the headers go
+// out with the first frame.
+func (s *serverStreamWriter) sendHeader() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if !s.headersSent {
+		s.sendHeaders()
+		s.headersSent = true
+		s.flush()
+	}
+	return nil
+}
+
+// sentHeaders reports whether the headers of the stream were written.
+func (s *serverStreamWriter) sentHeaders() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headersSent
+}
+
+// sent returns the number of messages sent.
+func (s *serverStreamWriter) sent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageCount
+}
+
 func (s *serverStreamWriter) sendHeaders() {
 	// Set appropriate headers based on protocol
 	if s.protocol.isConnect {
@@ -358,9 +493,16 @@ func (s *serverStreamWriter) sendHeaders() {
 		// Don't set Transfer-Encoding explicitly - Go will handle it automatically
 	} else if s.protocol.isGRPC {
 		ct := determineContentType(s.r)
+		if s.protocol.isGRPCWeb {
+			// Tells the gateway that the response is made of gRPC frames
+			ct = strings.Replace(ct, "grpc-web", "grpc", 1)
+		}
 		s.w.Header().Set("Content-Type", ct)
 		s.w.Header().Set("grpc-accept-encoding", "gzip")
-		s.w.Header().Set("Trailer", "grpc-status, grpc-message")
+		s.w.Header().Set("Trailer", "grpc-status, grpc-message, "+grpcStatusDetailsHeader)
+	} else if s.sse {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
 	}
 
 	// Apply custom headers
@@ -391,19 +533,7 @@ func (s *serverStreamWriter) sendConnectMessage(data []byte) error {
 	binary.BigEndian.PutUint32(frame[frameLengthOffset:frameLengthSize], uint32(len(data))) //nolint:gosec // length is bounded by message size limits
 	copy(frame[frameHeaderLength:], data)
 
-	// Single write for entire frame
-	if _, err := s.w.Write(frame); err != nil {
-		return err
-	}
-
-	// Smart flushing: flush if enough time has passed since last flush
-	// This balances latency and throughput
-	if s.flusher != nil && time.Since(s.lastFlush) >= s.flushPeriod {
-		s.flusher.Flush()
-		s.lastFlush = time.Now()
-	}
-
-	return nil
+	return s.writeFrame(frame, false)
 }
 
 func (s *serverStreamWriter) sendGRPCMessage(data []byte) error {
@@ -423,26 +553,72 @@ func (s *serverStreamWriter) sendGRPCMessage(data []byte) error {
 	// Data
 	copy(frame[5:], data)
 
-	// Write frame
+	return s.writeFrame(frame, false)
+}
+
+// writeFrame writes a message frame, or buffers it under flow control. Frames
+// are flushed right away with flush, and otherwise once the flush period has
+// passed, balancing latency and throughput.
+func (s *serverStreamWriter) writeFrame(frame []byte, flush bool) error {
+	s.lastWrite.Store(time.Now().UnixNano())
+	if s.buffer != nil {
+		return s.buffer.enqueue(s.Context(), bytes.Clone(frame))
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	if _, err := s.w.Write(frame); err != nil {
 		return err
 	}
-
-	// Smart flushing: flush if enough time has passed since last flush
-	// This balances latency and throughput
-	if s.flusher != nil && time.Since(s.lastFlush) >= s.flushPeriod {
+	if s.flusher != nil && (flush || time.Since(s.lastFlush) >= s.flushPeriod) {
 		s.flusher.Flush()
 		s.lastFlush = time.Now()
 	}
-
 	return nil
 }
 
+// flush flushes the frames written so far rather than waiting for the flush
+// period. Frames buffered under flow control are flushed by the buffer.
+func (s *serverStreamWriter) flush() {
+	if s.buffer != nil || s.flusher == nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.flusher.Flush()
+	s.lastFlush = time.Now()
+}
+
+// drain writes the frames buffered under flow control before the stream
+// ends, so that nothing else writes to the client concurrently. A failed
+// write ends the stream with its error. Called with mu held.
+func (s *serverStreamWriter) drain() {
+	if s.buffer == nil {
+		return
+	}
+	if err := s.buffer.close(s.Context()); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.buffer = nil
+}
+
 func (s *serverStreamWriter) sendError(err error) {
+	s.stopHeartbeat()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.drain()
 	s.err = err
+	s.setCursorTrailer()
+
+	if s.protocol.isGRPC {
+		// For gRPC, errors are sent in trailers
+		rpcErr := grpcErrorFor(err, s.ctx.options.StrictGRPC)
+		rpcErr = s.ctx.options.ErrorSanitizer.sanitize(s.r, s.r.URL.Path, rpcErr, err)
+		recordStatus(s.r.Context(), rpcErr.Code)
+		s.sendGRPCTrailers(rpcErr)
+		return
+	}
 
 	// Convert to RPC error
 	var rpcErr *Error
@@ -450,52 +626,50 @@ func (s *serverStreamWriter) sendError(err error) {
 	case *Error:
 		rpcErr = e
 	case *ErrorWithDetails:
-		protocol := protocolConnect
-		if s.protocol.isGRPC {
-			protocol = protocolGRPC
-		}
-		rpcErr = e.ToError(protocol)
+		rpcErr = e.ToError(protocolConnect)
 	default:
 		rpcErr = NewError(CodeInternal, err.Error())
 	}
+	rpcErr = s.ctx.options.ErrorSanitizer.sanitize(s.r, s.r.URL.Path, rpcErr, err)
+	recordStatus(s.r.Context(), rpcErr.Code)
 
-	if s.protocol.isConnect {
+	switch {
+	case s.protocol.isConnect:
 		// For Connect, send error as final message with end-of-stream marker
 		s.sendConnectError(rpcErr)
-	} else if s.protocol.isGRPC {
-		// For gRPC, errors are sent in trailers
-		s.sendGRPCTrailers(rpcErr)
+	case s.sse:
+		s.sendEventStreamError(rpcErr)
 	}
 }
 
-func (s *serverStreamWriter) sendConnectError(err *Error) {
-	// If headers not sent, send them now
+// sendEventStreamError sends the error ending a server-sent event stream as an
+// "error" event, with the Connect error JSON as its data.
+func (s *serverStreamWriter) sendEventStreamError(err *Error) {
 	if !s.headersSent {
 		s.sendHeaders()
 		s.headersSent = true
 	}
-
-	// Connect error format with end-of-stream marker
-	errData := map[string]any{
-		"error": map[string]any{
-			"code":    string(err.Code),
-			"message": err.Message,
-		},
-	}
-	if err.Details != nil {
-		errData["error"].(map[string]any)["details"] = err.Details
-	}
-
-	data, _ := json.Marshal(errData)
-
-	// Send with end-of-stream flag (0x02)
-	if _, err := s.w.Write([]byte{0x02}); err != nil {
+	data, marshalErr := json.Marshal(connectErrorBody(err))
+	if marshalErr != nil {
 		return
 	}
-	if err := binary.Write(s.w, binary.BigEndian, uint32(len(data))); err != nil { //nolint:gosec // bounded by message size
+	if _, writeErr := s.w.Write(serverSentEvent("error", "", data)); writeErr != nil {
 		return
 	}
-	if _, err := s.w.Write(data); err != nil {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *serverStreamWriter) sendConnectError(err *Error) {
+	// If headers not sent, send them now
+	if !s.headersSent {
+		s.sendHeaders()
+		s.headersSent = true
+	}
+
+	// The error travels in the EndStreamResponse together with any trailers
+	if writeErr := s.writeConnectEndStream(err); writeErr != nil {
 		return
 	}
 
@@ -507,19 +681,29 @@ func (s *serverStreamWriter) sendConnectError(err *Error) {
 }
 
 func (s *serverStreamWriter) sendGRPCTrailers(err *Error) {
+	// Failing before the first message is a trailers-only response
+	if !s.headersSent && s.ctx.options.StrictGRPC {
+		h := s.w.Header()
+		h.Set("Content-Type", determineContentType(s.r))
+		for _, metadata := range []map[string][]string{s.ctx.responseHeaders, s.ctx.responseTrailers} {
+			for key, values := range metadata {
+				for _, value := range values {
+					h.Add(key, value)
+				}
+			}
+		}
+		setGRPCStatus(h, err)
+		s.w.WriteHeader(http.StatusOK)
+		s.headersSent = true
+		return
+	}
+
 	// gRPC sends errors in HTTP trailers
 	trailer := s.w.Header()
-	trailer.Set("grpc-status", fmt.Sprintf("%d", grpcStatusCode(err.Code)))
-	trailer.Set("grpc-message", err.Message)
+	setGRPCStatus(trailer, err)
 
 	// Apply any custom trailers
-	if s.ctx.responseTrailers != nil {
-		for key, values := range s.ctx.responseTrailers {
-			for _, value := range values {
-				trailer.Add(key, value)
-			}
-		}
-	}
+	s.applyGRPCTrailers(trailer)
 
 	if s.flusher != nil {
 		s.flusher.Flush()
@@ -527,12 +711,15 @@ func (s *serverStreamWriter) sendGRPCTrailers(err *Error) {
 }
 
 func (s *serverStreamWriter) finalize() {
+	s.stopHeartbeat()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.drain()
 	if s.err != nil {
 		return // Error already sent
 	}
+	s.setCursorTrailer()
 
 	// Send headers if not sent
 	if !s.headersSent {
@@ -553,13 +740,11 @@ func (s *serverStreamWriter) finalize() {
 
 // finalizeConnect handles Connect protocol finalization
 func (s *serverStreamWriter) finalizeConnect() {
-	// Send end-of-stream marker
-	if err := s.sendConnectEndOfStream(); err != nil {
+	// Send the EndStreamResponse carrying trailers as metadata
+	if err := s.writeConnectEndStream(nil); err != nil {
 		return
 	}
-
-	// Apply trailers as headers
-	s.applyConnectTrailers()
+	s.connectEnded = true
 
 	// Flush for Connect protocol
 	if s.flusher != nil {
@@ -567,29 +752,46 @@ func (s *serverStreamWriter) finalizeConnect() {
 	}
 }
 
-// sendConnectEndOfStream sends the Connect end-of-stream marker
-func (s *serverStreamWriter) sendConnectEndOfStream() error {
-	endMessage := []byte("{}")
-	if _, err := s.w.Write([]byte{0x02}); err != nil { // End-of-stream flag
-		return err
+// writeConnectEndStream writes the Connect EndStreamResponse frame (flags 0x02).
+// Per the Connect spec, trailers are sent as the "metadata" object and a failed
+// stream carries its error in the "error" object.
+func (s *serverStreamWriter) writeConnectEndStream(err *Error) error {
+	endStream := make(map[string]any)
+	if err != nil {
+		endStream["error"] = connectErrorBody(err)
 	}
-	if err := binary.Write(s.w, binary.BigEndian, uint32(len(endMessage))); err != nil { //nolint:gosec // bounded by message size
-		return err
+	if metadata := s.connectTrailerMetadata(); len(metadata) > 0 {
+		endStream["metadata"] = metadata
 	}
-	_, err := s.w.Write(endMessage)
-	return err
+
+	data, marshalErr := json.Marshal(endStream)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	frameSize := frameHeaderLength + len(data)
+	frameBuf := s.getFrameBuffer(frameSize)
+	defer s.putFrameBuffer(frameBuf)
+
+	frame := (*frameBuf)[:frameSize]
+	frame[0] = connectFlagEndStream
+	binary.BigEndian.PutUint32(frame[frameLengthOffset:frameLengthSize], uint32(len(data))) //nolint:gosec // bounded by message size
+	copy(frame[frameHeaderLength:], data)
+
+	_, writeErr := s.w.Write(frame)
+	return writeErr
 }
 
-// applyConnectTrailers applies trailers as headers with "trailer-" prefix
-func (s *serverStreamWriter) applyConnectTrailers() {
-	if s.ctx.responseTrailers == nil {
-		return
+// connectTrailerMetadata returns the handler's trailers as Connect metadata.
+func (s *serverStreamWriter) connectTrailerMetadata() map[string][]string {
+	if len(s.ctx.responseTrailers) == 0 {
+		return nil
 	}
+	metadata := make(map[string][]string, len(s.ctx.responseTrailers))
 	for key, values := range s.ctx.responseTrailers {
-		for _, value := range values {
-			s.w.Header().Add("trailer-"+key, value)
-		}
+		metadata[key] = append(metadata[key], values...)
 	}
+	return metadata
 }
 
 // finalizeGRPC handles gRPC protocol finalization
@@ -606,14 +808,7 @@ func (s *serverStreamWriter) finalizeGRPC() {
 
 // applyGRPCTrailers applies custom trailers for gRPC
 func (s *serverStreamWriter) applyGRPCTrailers(trailer http.Header) {
-	if s.ctx.responseTrailers == nil {
-		return
-	}
-	for key, values := range s.ctx.responseTrailers {
-		for _, value := range values {
-			trailer.Add(key, value)
-		}
-	}
+	setGRPCTrailers(trailer, s.ctx.responseTrailers)
 }
 
 // finalizeDefault handles default protocol finalization
@@ -0,0 +1,421 @@
+package rpc_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type TickRequest struct {
+	Count int  `json:"count"`
+	Fail  bool `json:"fail"`
+}
+
+type TickResponse struct {
+	N int `json:"n"`
+}
+
+// connectFrame is a decoded Connect streaming envelope.
+type connectFrame struct {
+	flags byte
+	data  []byte
+}
+
+// readConnectFrames splits a Connect streaming body into envelopes.
+func readConnectFrames(t *testing.T, r io.Reader) []connectFrame {
+	t.Helper()
+	var frames []connectFrame
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return frames
+			}
+			t.Fatalf("Failed to read frame header: %v", err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatalf("Failed to read frame body: %v", err)
+		}
+		frames = append(frames, connectFrame{flags: header[0], data: data})
+	}
+}
+
+// connectEnvelope frames a message with the Connect streaming envelope.
+func connectEnvelope(data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
+
+func TestConnectServerStreamEndStream(t *testing.T) {
+	svc := rpc.NewService("TickService", rpc.WithPackage("stream.v1"))
+	rpc.MustRegisterServerStream(svc, "Tick", func(ctx context.Context, req *TickRequest, stream rpc.ServerStream[TickResponse]) error {
+		for i := 1; i <= req.Count; i++ {
+			if err := stream.Send(&TickResponse{N: i}); err != nil {
+				return err
+			}
+		}
+		if hctx := rpc.GetHandlerContext(ctx); hctx != nil {
+			hctx.SetResponseTrailer("X-Ticks", "done")
+		}
+		if req.Fail {
+			return rpc.NewError(rpc.CodeAborted, "stopped early")
+		}
+		return nil
+	})
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	call := func(t *testing.T, body string) []connectFrame {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			server.URL+"/stream.v1.TickService/Tick", bytes.NewReader(connectEnvelope([]byte(body))))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		return readConnectFrames(t, resp.Body)
+	}
+
+	type endStream struct {
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Metadata map[string][]string `json:"metadata"`
+	}
+
+	t.Run("success carries trailers as metadata", func(t *testing.T) {
+		frames := call(t, `{"count":2}`)
+		if len(frames) != 3 {
+			t.Fatalf("Expected 2 messages and an end-stream frame, got %d frames", len(frames))
+		}
+		last := frames[len(frames)-1]
+		if last.flags != 0x02 {
+			t.Fatalf("Expected end-stream flag, got %#x", last.flags)
+		}
+		var end endStream
+		if err := json.Unmarshal(last.data, &end); err != nil {
+			t.Fatalf("Invalid end-stream JSON %q: %v", last.data, err)
+		}
+		if end.Error != nil {
+			t.Errorf("Expected no error, got %+v", end.Error)
+		}
+		if got := end.Metadata["X-Ticks"]; len(got) != 1 || got[0] != "done" {
+			t.Errorf("Expected trailer metadata, got %v", end.Metadata)
+		}
+	})
+
+	t.Run("mid-stream error", func(t *testing.T) {
+		frames := call(t, `{"count":1,"fail":true}`)
+		if len(frames) != 2 {
+			t.Fatalf("Expected 1 message and an end-stream frame, got %d frames", len(frames))
+		}
+		var end endStream
+		if err := json.Unmarshal(frames[1].data, &end); err != nil {
+			t.Fatalf("Invalid end-stream JSON: %v", err)
+		}
+		if end.Error == nil || end.Error.Code != "aborted" || end.Error.Message != "stopped early" {
+			t.Errorf("Unexpected end-stream error: %+v", end.Error)
+		}
+		if len(end.Metadata["X-Ticks"]) != 1 {
+			t.Errorf("Expected trailers alongside error, got %v", end.Metadata)
+		}
+	})
+
+	t.Run("decode error before stream", func(t *testing.T) {
+		frames := call(t, `{"count":`)
+		if len(frames) != 1 || frames[0].flags != 0x02 {
+			t.Fatalf("Expected a single end-stream frame, got %d frames", len(frames))
+		}
+		var end endStream
+		if err := json.Unmarshal(frames[0].data, &end); err != nil {
+			t.Fatalf("Invalid end-stream JSON: %v", err)
+		}
+		if end.Error == nil || end.Error.Code != "invalid_argument" {
+			t.Errorf("Expected invalid_argument, got %+v", end.Error)
+		}
+	})
+}
+
+func TestConnectClientAndBidiStreams(t *testing.T) {
+	svc := rpc.NewService("TickService", rpc.WithPackage("stream.v1"))
+	rpc.MustRegisterMethod(svc,
+		rpc.NewClientStreamMethod("Sum", func(ctx context.Context, stream rpc.ClientStream[TickRequest]) (*TickResponse, error) {
+			sum := 0
+			for {
+				req, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return &TickResponse{N: sum}, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				sum += req.Count
+			}
+		}),
+		rpc.NewBidiStreamMethod("Echo", func(ctx context.Context, stream rpc.BidiStream[TickRequest, TickResponse]) error {
+			for {
+				req, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := stream.Send(&TickResponse{N: req.Count}); err != nil {
+					return err
+				}
+			}
+		}),
+	)
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	call := func(t *testing.T, method string, messages ...string) []connectFrame {
+		t.Helper()
+		var body []byte
+		for _, msg := range messages {
+			body = append(body, connectEnvelope([]byte(msg))...)
+		}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			server.URL+"/stream.v1.TickService/"+method, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		return readConnectFrames(t, resp.Body)
+	}
+
+	t.Run("client stream", func(t *testing.T) {
+		frames := call(t, "Sum", `{"count":2}`, `{"count":3}`)
+		if len(frames) != 2 || string(frames[0].data) != `{"n":5}` || frames[1].flags != 0x02 {
+			t.Errorf("Expected the sum and an end-stream frame, got %q", frames)
+		}
+	})
+
+	t.Run("bidi stream", func(t *testing.T) {
+		frames := call(t, "Echo", `{"count":1}`, `{"count":2}`)
+		if len(frames) != 3 || string(frames[0].data) != `{"n":1}` || string(frames[1].data) != `{"n":2}` {
+			t.Errorf("Expected two echoes and an end-stream frame, got %q", frames)
+		}
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		frames := call(t, "Sum", `{"count":`)
+		if len(frames) != 1 || frames[0].flags != 0x02 || !strings.Contains(string(frames[0].data), "invalid_argument") {
+			t.Errorf("Expected an invalid_argument end-stream frame, got %q", frames)
+		}
+	})
+}
+
+type ResumeRequest struct {
+	Session struct {
+		SessionID string `json:"session_id"`
+	} `json:"session"`
+}
+
+type ResumeResponse struct {
+	RoutingKey string `json:"routing_key"`
+}
+
+func TestStreamRoutingKey(t *testing.T) {
+	svc := rpc.NewService("SessionService",
+		rpc.WithPackage("session.v1"),
+		rpc.WithRoutingKey("Resume", "session.session_id"),
+		rpc.WithRoutingKeyHeader("X-Session-Affinity"),
+	)
+	rpc.MustRegisterServerStream(svc, "Resume", func(ctx context.Context, req *ResumeRequest, stream rpc.ServerStream[ResumeResponse]) error {
+		return stream.Send(&ResumeResponse{RoutingKey: rpc.RoutingKey(ctx)})
+	})
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		server.URL+"/session.v1.SessionService/Resume",
+		bytes.NewReader(connectEnvelope([]byte(`{"session":{"session_id":"abc-123"}}`))))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/connect+json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if got := resp.Header.Get("X-Session-Affinity"); got != "abc-123" {
+		t.Errorf("Expected routing key header, got %q", got)
+	}
+	frames := readConnectFrames(t, resp.Body)
+	if len(frames) == 0 {
+		t.Fatal("Expected at least one frame")
+	}
+	var msg ResumeResponse
+	if err := json.Unmarshal(frames[0].data, &msg); err != nil {
+		t.Fatalf("Invalid message: %v", err)
+	}
+	if msg.RoutingKey != "abc-123" {
+		t.Errorf("Expected handler to see routing key, got %q", msg.RoutingKey)
+	}
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestServerStreamCompressedRequest(t *testing.T) {
+	svc := rpc.NewService("TickService", rpc.WithPackage("stream.v1"),
+		rpc.WithDecompressionLimits(rpc.DecompressionLimits{MaxSize: 1024}))
+	rpc.MustRegisterServerStream(svc, "Tick", func(ctx context.Context, req *TickRequest, stream rpc.ServerStream[TickResponse]) error {
+		for i := 1; i <= req.Count; i++ {
+			if err := stream.Send(&TickResponse{N: i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	request := []byte(`{"count":2}`)
+	// Whitespace is valid JSON, so only the limit rejects it
+	bomb := []byte(`{"count":2` + strings.Repeat(" ", 64*1024) + `}`)
+	compressedEnvelope := func(data []byte) []byte {
+		frame := connectEnvelope(gzipBytes(t, data))
+		frame[0] = 1 // compressed
+		return frame
+	}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "Connect compressed message",
+			body:    compressedEnvelope(request),
+			headers: map[string]string{"Content-Type": "application/connect+json", "Connect-Content-Encoding": "gzip"},
+			want:    `{"n":2}`,
+		},
+		{
+			name:    "Connect compressed body",
+			body:    gzipBytes(t, connectEnvelope(request)),
+			headers: map[string]string{"Content-Type": "application/connect+json", "Content-Encoding": "gzip"},
+			want:    `{"n":2}`,
+		},
+		{
+			name:    "gRPC compressed message",
+			body:    compressedEnvelope([]byte{0x08, 0x02}), // count: 2
+			headers: map[string]string{"Content-Type": "application/grpc+proto", "Grpc-Encoding": "gzip"},
+			want:    "\x00\x00\x00\x00\x02\x08\x02", // n: 2
+		},
+		{
+			name:    "compressed message without encoding",
+			body:    compressedEnvelope(request),
+			headers: map[string]string{"Content-Type": "application/connect+json"},
+			want:    "invalid_argument",
+		},
+		{
+			name:    "Connect message over the limit",
+			body:    compressedEnvelope(bomb),
+			headers: map[string]string{"Content-Type": "application/connect+json", "Connect-Content-Encoding": "gzip"},
+			want:    "resource_exhausted",
+		},
+		{
+			name:    "body over the limit",
+			body:    gzipBytes(t, connectEnvelope(bomb)),
+			headers: map[string]string{"Content-Type": "application/connect+json", "Content-Encoding": "gzip"},
+			want:    "resource_exhausted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/stream.v1.TickService/Tick", bytes.NewReader(tt.body))
+			if strings.HasPrefix(tt.headers["Content-Type"], "application/connect") {
+				req.Header.Set("Connect-Protocol-Version", "1")
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("Expected %s, got %d %q", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("gRPC message over the limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/stream.v1.TickService/Tick", bytes.NewReader(compressedEnvelope(bomb)))
+		req.Header.Set("Content-Type", "application/grpc+proto")
+		req.Header.Set("Grpc-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if status := rec.Header().Get("Grpc-Status"); status != "8" {
+			t.Errorf("Expected grpc-status 8, got %q", status)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// hedgeResult is the outcome of one hedged attempt.
+type hedgeResult struct {
+	attempt int
+	resp    any
+	err     error
+}
+
+// hedge runs up to policy.MaxAttempts attempts of a call in parallel, starting
+// a new attempt every HedgingDelay until one succeeds or fails with a fatal
+// status code. Attempts that fail with a non-fatal status code start the next
+// attempt immediately. Losing attempts are canceled and awaited before hedge
+// returns, since they share the handler context of the call.
+func (r *RetryInterceptor) hedge(
+	ctx context.Context,
+	policy *HedgingPolicy,
+	req any,
+	handler func(context.Context, any) (any, error),
+) (any, error) {
+	// An empty or invalid delay starts all attempts at once
+	delay, _ := time.ParseDuration(policy.HedgingDelay)
+	attemptCtx, cancel := context.WithCancel(ctx)
+	results := make(chan hedgeResult, policy.MaxAttempts)
+	started, running := 0, 0
+
+	start := func() {
+		started++
+		running++
+		attempt := started
+		go func() {
+			resp, err := handler(withAttempt(attemptCtx, attempt), req)
+			results <- hedgeResult{attempt: attempt, resp: resp, err: err}
+		}()
+	}
+	finish := func(result hedgeResult) (any, error) {
+		cancel()
+		for ; running > 0; running-- {
+			<-results
+		}
+		setPreviousAttemptsHeader(ctx, result.attempt)
+		return result.resp, result.err
+	}
+
+	// The first attempt is never throttled
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		// Stop scheduling hedges once all attempts started
+		hedgeTimer := timer.C
+		if started >= policy.MaxAttempts {
+			hedgeTimer = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			for ; running > 0; running-- {
+				<-results
+			}
+			return nil, ctx.Err()
+
+		case <-hedgeTimer:
+			if r.checkThrottle() {
+				start()
+				timer.Reset(delay)
+			} else {
+				started = policy.MaxAttempts // Throttled, wait for running attempts
+			}
+
+		case result := <-results:
+			running--
+			if result.err == nil {
+				r.addTokens()
+				return finish(result)
+			}
+			if !slices.Contains(policy.NonFatalStatusCodes, extractStatusCode(result.err)) {
+				return finish(result)
+			}
+			lastErr = result.err
+			r.consumeToken()
+
+			// Server pushback overrides the hedging delay
+			switch pushbackMs := extractPushbackMs(result.err); {
+			case pushbackMs < 0:
+				started = policy.MaxAttempts
+			case pushbackMs > 0:
+				timer.Reset(time.Duration(pushbackMs) * time.Millisecond)
+			case started >= policy.MaxAttempts:
+			case r.checkThrottle():
+				start()
+				timer.Reset(delay)
+			default:
+				started = policy.MaxAttempts
+			}
+		}
+
+		if running == 0 && started >= policy.MaxAttempts {
+			return finish(hedgeResult{attempt: started, err: lastErr})
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// InterceptorPhase orders interceptors: those of earlier phases run first,
+// wrapping those of later phases.
+type InterceptorPhase int
+
+// Interceptor phases, outermost first
+const (
+	// PhaseAuth authenticates and authorizes calls
+	PhaseAuth InterceptorPhase = iota
+	// PhaseRateLimit rejects calls over rate limits
+	PhaseRateLimit
+	// PhaseLogging logs and measures calls
+	PhaseLogging
+	// PhaseHandler runs right before the handler, as do the interceptors
+	// added with WithInterceptors
+	PhaseHandler
+)
+
+// String returns the name of the phase, e.g. "rate_limit".
+func (p InterceptorPhase) String() string {
+	switch p {
+	case PhaseAuth:
+		return "auth"
+	case PhaseRateLimit:
+		return "rate_limit"
+	case PhaseLogging:
+		return "logging"
+	case PhaseHandler:
+		return "handler"
+	default:
+		return fmt.Sprintf("InterceptorPhase(%d)", int(p))
+	}
+}
+
+// NamedInterceptor is an interceptor of the registry.
+type NamedInterceptor struct {
+	// Name identifies the interceptor, e.g. "jwt" or "access_log"
+	Name string
+	// Phase orders the interceptor in chains
+	Phase InterceptorPhase
+	// Interceptor wraps the handler calls
+	Interceptor Interceptor
+}
+
+// interceptorRegistry holds the interceptors registered by name.
+var interceptorRegistry = struct {
+	sync.RWMutex
+	byName map[string]NamedInterceptor
+}{byName: make(map[string]NamedInterceptor)}
+
+// RegisterInterceptor registers an interceptor under name, so that services
+// and methods apply it with WithNamedInterceptors. In a chain, it runs in
+// phase order: auth, then rate limiting, then logging, then right before the
+// handler. Interceptors of the same phase run in the order they are named.
+// Names are unique.
+func RegisterInterceptor(name string, phase InterceptorPhase, interceptor Interceptor) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("interceptor name is required")
+	case interceptor == nil:
+		return fmt.Errorf("interceptor %q is nil", name)
+	case phase < PhaseAuth || phase > PhaseHandler:
+		return fmt.Errorf("interceptor %q has an unknown phase %v", name, phase)
+	}
+
+	interceptorRegistry.Lock()
+	defer interceptorRegistry.Unlock()
+	if _, ok := interceptorRegistry.byName[name]; ok {
+		return fmt.Errorf("interceptor %q is already registered", name)
+	}
+	interceptorRegistry.byName[name] = NamedInterceptor{Name: name, Phase: phase, Interceptor: interceptor}
+	return nil
+}
+
+// MustRegisterInterceptor registers an interceptor and panics on error.
+func MustRegisterInterceptor(name string, phase InterceptorPhase, interceptor Interceptor) {
+	if err := RegisterInterceptor(name, phase, interceptor); err != nil {
+		panic(err)
+	}
+}
+
+// RegisteredInterceptors returns the registered interceptors in phase order,
+// then by name.
+func RegisteredInterceptors() []NamedInterceptor {
+	interceptorRegistry.RLock()
+	defer interceptorRegistry.RUnlock()
+	interceptors := make([]NamedInterceptor, 0, len(interceptorRegistry.byName))
+	for _, interceptor := range interceptorRegistry.byName {
+		interceptors = append(interceptors, interceptor)
+	}
+	sort.Slice(interceptors, func(i, j int) bool {
+		if interceptors[i].Phase != interceptors[j].Phase {
+			return interceptors[i].Phase < interceptors[j].Phase
+		}
+		return interceptors[i].Name < interceptors[j].Name
+	})
+	return interceptors
+}
+
+// WithNamedInterceptors applies registered interceptors to all methods of the
+// service. Unknown names fail the creation of the gateway.
+func WithNamedInterceptors(names ...string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.NamedInterceptors = append(o.NamedInterceptors, names...)
+	}
+}
+
+// WithNamedInterceptors applies registered interceptors to the method, in
+// addition to those of the service.
+func (m *MethodBuilder) WithNamedInterceptors(names ...string) *MethodBuilder {
+	m.method.Options.NamedInterceptors = append(m.method.Options.NamedInterceptors, names...)
+	return m
+}
+
+// interceptorChain returns the interceptors of method, outermost first: the
+// named interceptors of the method and the service, and the interceptors
+// added with WithInterceptors, ordered by phase.
+func (s *Service) interceptorChain(method *Method) ([]NamedInterceptor, error) {
+	var chain []NamedInterceptor
+	seen := make(map[string]bool)
+	interceptorRegistry.RLock()
+	for _, name := range slices.Concat(method.Options.NamedInterceptors, s.options.NamedInterceptors) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		interceptor, ok := interceptorRegistry.byName[name]
+		if !ok {
+			interceptorRegistry.RUnlock()
+			return nil, fmt.Errorf("method %s: unknown interceptor %q", method.Name, name)
+		}
+		chain = append(chain, interceptor)
+	}
+	interceptorRegistry.RUnlock()
+
+	for _, interceptor := range slices.Concat(method.Options.Interceptors, s.options.Interceptors) {
+		chain = append(chain, NamedInterceptor{Phase: PhaseHandler, Interceptor: interceptor})
+	}
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].Phase < chain[j].Phase
+	})
+	return chain, nil
+}
+
+// checkInterceptors checks that the named interceptors of all methods are
+// registered.
+func (s *Service) checkInterceptors() error {
+	for _, method := range s.methods {
+		if _, err := s.interceptorChain(method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// debugInterceptors describes the interceptor chain of method for the debug
+// endpoints.
+func (s *Service) debugInterceptors(entry *gateway.DebugMethod, method *Method) {
+	chain, _ := s.interceptorChain(method) // Checked when the gateway was created
+	for _, interceptor := range chain {
+		typeName := fmt.Sprintf("%T", interceptor.Interceptor)
+		entry.Interceptors = append(entry.Interceptors, typeName)
+		entry.InterceptorChain = append(entry.InterceptorChain, gateway.DebugInterceptor{
+			Name:  interceptor.Name,
+			Phase: interceptor.Phase.String(),
+			Type:  typeName,
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type PingRequest struct{}
+
+type PingResponse struct {
+	Trace []string `json:"trace"`
+}
+
+// traceInterceptor appends its name to the trace of the response.
+type traceInterceptor struct {
+	name string
+}
+
+func (i *traceInterceptor) Intercept(ctx context.Context, method string, req any, handler func(context.Context, any) (any, error)) (any, error) {
+	resp, err := handler(ctx, req)
+	if r, ok := resp.(*PingResponse); ok {
+		r.Trace = append([]string{i.name}, r.Trace...)
+	}
+	return resp, err
+}
+
+func init() {
+	rpc.MustRegisterInterceptor("test.auth", rpc.PhaseAuth, &traceInterceptor{name: "auth"})
+	rpc.MustRegisterInterceptor("test.ratelimit", rpc.PhaseRateLimit, &traceInterceptor{name: "ratelimit"})
+	rpc.MustRegisterInterceptor("test.log", rpc.PhaseLogging, &traceInterceptor{name: "log"})
+}
+
+func TestNamedInterceptors(t *testing.T) {
+	if err := rpc.RegisterInterceptor("test.auth", rpc.PhaseAuth, &traceInterceptor{}); err == nil {
+		t.Error("Expected registering a name twice to fail")
+	}
+
+	svc := rpc.NewService("PingService", rpc.WithPackage("ping.v1"),
+		rpc.WithInterceptors(&traceInterceptor{name: "plain"}),
+		rpc.WithNamedInterceptors("test.log", "test.auth"))
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Ping", func(_ context.Context, _ *PingRequest) (*PingResponse, error) {
+		return &PingResponse{}, nil
+	}).WithNamedInterceptors("test.ratelimit"))
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{EnableDebug: true}, svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	t.Run("chain runs in phase order", func(t *testing.T) {
+		resp, err := http.Post(server.URL+"/ping.v1.PingService/Ping", "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var ping PingResponse
+		if err := json.NewDecoder(resp.Body).Decode(&ping); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(ping.Trace, ","); got != "auth,ratelimit,log,plain" {
+			t.Errorf("Expected auth,ratelimit,log,plain, got %s", got)
+		}
+	})
+
+	t.Run("debug endpoint lists the chain", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/debug/hyperway/services")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var services struct {
+			Services []struct {
+				Methods []struct {
+					InterceptorChain []gateway.DebugInterceptor `json:"interceptor_chain"`
+				} `json:"methods"`
+			} `json:"services"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&services); err != nil || len(services.Services) != 1 {
+			t.Fatalf("Unexpected services response: %v", err)
+		}
+		var chain []string
+		for _, i := range services.Services[0].Methods[0].InterceptorChain {
+			chain = append(chain, i.Name+"/"+i.Phase+"/"+i.Type)
+		}
+		want := "test.auth/auth/*rpc_test.traceInterceptor,test.ratelimit/rate_limit/*rpc_test.traceInterceptor," +
+			"test.log/logging/*rpc_test.traceInterceptor,/handler/*rpc_test.traceInterceptor"
+		if got := strings.Join(chain, ","); got != want {
+			t.Errorf("Expected chain %s, got %s", want, got)
+		}
+	})
+
+	t.Run("unknown names fail the gateway", func(t *testing.T) {
+		svc := rpc.NewService("PingService", rpc.WithPackage("ping.v1"), rpc.WithNamedInterceptors("test.missing"))
+		rpc.MustRegister(svc, "Ping", func(_ context.Context, _ *PingRequest) (*PingResponse, error) {
+			return &PingResponse{}, nil
+		})
+		if _, err := rpc.NewGateway(svc); err == nil || !strings.Contains(err.Error(), `unknown interceptor "test.missing"`) {
+			t.Errorf("Expected an unknown interceptor error, got %v", err)
+		}
+	})
+}
@@ -61,6 +61,8 @@ func (t *TimeoutInterceptor) Intercept(ctx context.Context, method string, req a
 	case res := <-done:
 		return res.resp, res.err
 	case <-timeoutCtx.Done():
+		// The handler still uses the request
+		retainArena(ctx)
 		return nil, fmt.Errorf("request timeout after %v", t.Timeout)
 	}
 }
@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// encoding/json encodes time.Duration as integer nanoseconds, while the
+// descriptors, the OpenAPI document and the proto3 JSON mapping all describe
+// it as a google.protobuf.Duration string like "3.5s". JSON of struct
+// messages encoded with encoding/json is rewritten along a plan of where the
+// durations of the message type are, so durations are encoded as strings
+// and decoded from strings or, as before, integer nanoseconds.
+
+// durationPlan locates the durations within values of a Go type.
+type durationPlan struct {
+	duration bool                     // The value is a duration
+	fields   map[string]*durationPlan // Object members, by lower-cased JSON name
+	elem     *durationPlan            // Elements of arrays, values of objects, or nil
+	object   bool                     // elem applies to the values of an object
+}
+
+// durationPlans caches the plans of types, nil for types without durations.
+var durationPlans sync.Map // map[reflect.Type]*durationPlan
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// durationPlanOf returns the plan of t, or nil if its values hold no
+// durations.
+func durationPlanOf(t reflect.Type) *durationPlan {
+	if p, ok := durationPlans.Load(t); ok {
+		return p.(*durationPlan)
+	}
+	p := buildDurationPlan(t, make(map[reflect.Type]*durationPlan))
+	durationPlans.Store(t, p)
+	return p
+}
+
+// buildDurationPlan builds the plan of t. visiting holds the plans of the
+// types being built, so recursive types refer to their own plan.
+func buildDurationPlan(t reflect.Type, visiting map[reflect.Type]*durationPlan) *durationPlan {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return &durationPlan{duration: true}
+	}
+	// Types encoding themselves are left alone
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) ||
+		t.Implements(textMarshalerType) {
+		return nil
+	}
+	if p, ok := visiting[t]; ok {
+		return p
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil // Bytes are base64 strings
+		}
+		if elem := buildDurationPlan(t.Elem(), visiting); elem != nil {
+			return &durationPlan{elem: elem}
+		}
+	case reflect.Map:
+		if elem := buildDurationPlan(t.Elem(), visiting); elem != nil {
+			return &durationPlan{elem: elem, object: true}
+		}
+	case reflect.Struct:
+		p := &durationPlan{fields: make(map[string]*durationPlan)}
+		visiting[t] = p
+		addDurationFields(p, t, visiting)
+		delete(visiting, t)
+		if len(p.fields) > 0 {
+			return p
+		}
+	default:
+	}
+	return nil
+}
+
+// addDurationFields adds the fields of struct type t holding durations to p,
+// including the promoted fields of embedded structs.
+func addDurationFields(p *durationPlan, t reflect.Type, visiting map[reflect.Type]*durationPlan) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addDurationFields(p, ft, visiting)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if union, ok := schema.LookupUnion(f.Type); ok {
+			// Unions are encoded as their members, see json_unions.go
+			for _, member := range union.Members {
+				if mp := buildDurationPlan(member.Type, visiting); mp != nil {
+					p.fields[strings.ToLower(member.Name)] = mp
+				}
+			}
+			continue
+		}
+		if fp := buildDurationPlan(f.Type, visiting); fp != nil {
+			p.fields[strings.ToLower(name)] = fp
+		}
+	}
+}
+
+// encodeJSONDurations rewrites the integer durations of data, the
+// encoding/json encoding of a value planned by p, to strings.
+func encodeJSONDurations(data []byte, p *durationPlan) ([]byte, error) {
+	var out bytes.Buffer
+	if err := rewriteJSONDurations(&out, data, p, formatJSONDuration); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decodeJSONDurations rewrites the string durations of data, JSON decoded
+// into a value planned by p, to integer nanoseconds for encoding/json.
+func decodeJSONDurations(data []byte, p *durationPlan) ([]byte, error) {
+	var out bytes.Buffer
+	if err := rewriteJSONDurations(&out, data, p, parseJSONDuration); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// rewriteJSONDurations writes data to out with the durations located by p
+// rewritten by convert. Values not matching the plan are copied, leaving
+// their errors to encoding/json.
+func rewriteJSONDurations(out *bytes.Buffer, data []byte, p *durationPlan, convert func([]byte) ([]byte, error)) error {
+	data = bytes.TrimSpace(data)
+	if p == nil || len(data) == 0 {
+		out.Write(data)
+		return nil
+	}
+	switch {
+	case p.duration:
+		converted, err := convert(data)
+		if err != nil {
+			return err
+		}
+		out.Write(converted)
+		return nil
+	case data[0] == '{' && (p.fields != nil || p.object):
+		return rewriteJSONObject(out, data, p, convert)
+	case data[0] == '[' && p.elem != nil && !p.object:
+		return rewriteJSONArray(out, data, p.elem, convert)
+	default:
+		out.Write(data)
+		return nil
+	}
+}
+
+// rewriteJSONObject rewrites the members of a JSON object.
+func rewriteJSONObject(out *bytes.Buffer, data []byte, p *durationPlan, convert func([]byte) ([]byte, error)) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte('{')
+	for i := 0; dec.More(); i++ {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		name, _ := key.(string)
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		out.Write(quoted)
+		out.WriteByte(':')
+
+		elem := p.elem
+		if !p.object {
+			elem = p.fields[strings.ToLower(name)]
+		}
+		if err := rewriteJSONDurations(out, value, elem, convert); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// rewriteJSONArray rewrites the elements of a JSON array.
+func rewriteJSONArray(out *bytes.Buffer, data []byte, elem *durationPlan, convert func([]byte) ([]byte, error)) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if err := rewriteJSONDurations(out, value, elem, convert); err != nil {
+			return err
+		}
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+// formatJSONDuration formats integer nanoseconds like the proto3 JSON
+// mapping does, with 0, 3, 6 or 9 fractional digits: "3s", "-1.500s".
+func formatJSONDuration(data []byte) ([]byte, error) {
+	nanos, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		// Not an integer, left to encoding/json
+		return data, nil //nolint:nilerr // the value is copied as-is
+	}
+	sign := ""
+	if nanos < 0 {
+		sign = "-"
+	}
+	seconds, frac := nanos/int64(time.Second), nanos%int64(time.Second)
+	if seconds < 0 {
+		seconds = -seconds
+	}
+	if frac < 0 {
+		frac = -frac
+	}
+	s := sign + strconv.FormatInt(seconds, 10)
+	if frac != 0 {
+		digits := fmt.Sprintf("%09d", frac)
+		for strings.HasSuffix(digits, "000") {
+			digits = digits[:len(digits)-3]
+		}
+		s += "." + digits
+	}
+	return strconv.AppendQuote(nil, s+"s"), nil
+}
+
+// parseJSONDuration parses a duration string such as "3.5s" or "1m30s" to
+// integer nanoseconds. Numbers are kept, as integer nanoseconds.
+func parseJSONDuration(data []byte) ([]byte, error) {
+	if data[0] != '"' {
+		return data, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+	return strconv.AppendInt(nil, int64(d), 10), nil
+}
@@ -0,0 +1,331 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/codec"
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+	"github.com/i2y/hyperway/schema"
+)
+
+// maxPooledJSONBufferSize is the capacity above which JSON buffers are not
+// returned to the pool, so a few large responses don't pin memory.
+const maxPooledJSONBufferSize = 64 * 1024
+
+// JSONEncoder writes the JSON encoding of v to w. It lets services use a
+// faster JSON library for responses of non-protobuf messages, e.g.
+//
+//	rpc.WithJSONEncoder(func(w io.Writer, v any) error {
+//		return sonic.ConfigDefault.NewEncoder(w).Encode(v)
+//	})
+//
+// A trailing newline is trimmed from the output.
+type JSONEncoder func(w io.Writer, v any) error
+
+// WithJSONEncoder replaces the pooled encoding/json encoder used for JSON
+// responses of non-protobuf messages, including gRPC-JSON ones that would
+// otherwise follow the proto3 JSON mapping. Protobuf messages always use
+// protojson.
+func WithJSONEncoder(enc JSONEncoder) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONEncoder = enc
+	}
+}
+
+// WithProtoJSON encodes and decodes Connect and plain JSON of struct messages
+// with the proto3 JSON mapping, like gRPC-JSON always does: 64-bit integers
+// are strings, Timestamps RFC 3339, Durations like "1.5s", and enums their
+// names. Without it, these requests use encoding/json, whose output existing
+// JSON clients may rely on, except that durations are strings as well.
+func WithProtoJSON() ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ProtoJSON = true
+	}
+}
+
+// JSONNaming selects the field names of JSON requests and responses.
+type JSONNaming int
+
+const (
+	// JSONNamingDefault names the fields of struct messages after their json
+	// tags and those of protobuf messages in lowerCamelCase.
+	JSONNamingDefault JSONNaming = iota
+	// JSONNamingSnakeCase uses the snake_case field names of the descriptors.
+	JSONNamingSnakeCase
+	// JSONNamingCamelCase uses lowerCamelCase names, the proto3 JSON standard.
+	JSONNamingCamelCase
+	// JSONNamingGoNames uses the names of the Go struct fields. Protobuf
+	// messages keep their lowerCamelCase names.
+	JSONNamingGoNames
+)
+
+// String returns the name of the naming policy.
+func (n JSONNaming) String() string {
+	switch n {
+	case JSONNamingDefault:
+		return "default"
+	case JSONNamingSnakeCase:
+		return "snake_case"
+	case JSONNamingCamelCase:
+		return "lowerCamelCase"
+	case JSONNamingGoNames:
+		return "go"
+	default:
+		return fmt.Sprintf("JSONNaming(%d)", int(n))
+	}
+}
+
+// WithJSONNaming names the fields of JSON requests and responses, JSON-RPC
+// params and results, and the schemas of the OpenAPI and OpenRPC documents
+// after naming. Any naming but the default encodes struct messages with the
+// proto3 JSON mapping as WithProtoJSON does, since encoding/json can only use
+// the json tags. Requests are accepted with both the chosen and the
+// snake_case names.
+func WithJSONNaming(naming JSONNaming) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONNaming = naming
+	}
+}
+
+// WithJSONInt64 encodes the 64-bit integers of JSON responses, JSON-RPC
+// results, and server stream messages as strings or numbers, and sets the
+// jstype of their fields so OpenAPI and OpenRPC schemas describe strings as
+// `type: string, format: int64`. By default, encoding/json writes numbers,
+// which JavaScript clients silently round above 2^53, while the proto3 JSON
+// mapping of gRPC-JSON, WithProtoJSON, and protobuf messages writes strings.
+// Requests are accepted with either form.
+func WithJSONInt64(encoding codec.JSONInt64) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONInt64 = encoding
+	}
+}
+
+// int64JSType returns the jstype of the 64-bit integer fields of the
+// descriptors built for encoding.
+func int64JSType(encoding codec.JSONInt64) descriptorpb.FieldOptions_JSType {
+	switch encoding {
+	case codec.JSONInt64String:
+		return descriptorpb.FieldOptions_JS_STRING
+	case codec.JSONInt64Number:
+		return descriptorpb.FieldOptions_JS_NUMBER
+	case codec.JSONInt64Default:
+	}
+	return descriptorpb.FieldOptions_JS_NORMAL
+}
+
+// formatJSONInt64 rewrites the 64-bit integers of data, the JSON encoding of
+// msg, a protobuf message or a struct message of the codec c, per encoding.
+func formatJSONInt64(data []byte, msg any, c *codec.Codec, encoding codec.JSONInt64) ([]byte, error) {
+	if encoding == codec.JSONInt64Default {
+		return data, nil
+	}
+	var md protoreflect.MessageDescriptor
+	if pm, ok := msg.(proto.Message); ok {
+		md = pm.ProtoReflect().Descriptor()
+	} else if c != nil {
+		md = c.Descriptor()
+	}
+	return codec.RewriteJSONInt64(data, md, encoding)
+}
+
+// parseJSONInt64 unquotes the 64-bit integers of data, a JSON request for
+// the messages of the codec c, for encoding/json, which only accepts numbers.
+func parseJSONInt64(data []byte, c *codec.Codec, encoding codec.JSONInt64) ([]byte, error) {
+	if encoding == codec.JSONInt64Default || c == nil {
+		return data, nil
+	}
+	return codec.RewriteJSONInt64(data, c.Descriptor(), codec.JSONInt64Number)
+}
+
+// jsonNames returns the json_name style of the descriptors built for the
+// naming policy.
+func (n JSONNaming) jsonNames() schema.JSONNameStyle {
+	switch n {
+	case JSONNamingSnakeCase:
+		return schema.JSONNameProto
+	case JSONNamingCamelCase:
+		return schema.JSONNameCamelCase
+	case JSONNamingGoNames:
+		return schema.JSONNameGo
+	case JSONNamingDefault:
+	}
+	return schema.JSONNameUnset
+}
+
+// structProtoJSON reports whether Connect and plain JSON of struct messages
+// follow the proto3 JSON mapping.
+func (s *Service) structProtoJSON() bool {
+	return s.options.ProtoJSON || s.options.JSONNaming != JSONNamingDefault
+}
+
+// jsonMarshalOptions returns the protojson options encoding protobuf or,
+// with structMessage, struct messages under the naming policy. Struct
+// messages emit zero values like encoding/json does.
+func (s *Service) jsonMarshalOptions(structMessage bool) protojson.MarshalOptions {
+	opts := protojson.MarshalOptions{EmitUnpopulated: structMessage, Resolver: s.resolver()}
+	switch s.options.JSONNaming {
+	case JSONNamingDefault:
+		opts.UseProtoNames = structMessage
+	case JSONNamingSnakeCase:
+		opts.UseProtoNames = true
+	case JSONNamingCamelCase, JSONNamingGoNames:
+	}
+	return opts
+}
+
+// jsonBuffer is a pooled buffer with an encoder writing into it.
+type jsonBuffer struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// jsonBufferPool reuses buffers and encoders across JSON responses.
+var jsonBufferPool = sync.Pool{
+	New: func() any {
+		b := &jsonBuffer{}
+		b.enc = json.NewEncoder(&b.buf)
+		return b
+	},
+}
+
+// getJSONBuffer returns an empty buffer from the pool.
+func getJSONBuffer() *jsonBuffer {
+	b := jsonBufferPool.Get().(*jsonBuffer)
+	b.buf.Reset()
+	return b
+}
+
+// putJSONBuffer returns b to the pool. Its bytes must not be used afterwards.
+func putJSONBuffer(b *jsonBuffer) {
+	if b.buf.Cap() > maxPooledJSONBufferSize {
+		return
+	}
+	jsonBufferPool.Put(b)
+}
+
+// encodeJSON appends the JSON encoding of v to b, using the configured
+// encoder or the pooled encoding/json encoder. The output matches json.Marshal.
+// Messages are encoded with marshalMessageJSON instead.
+func (s *Service) encodeJSON(b *jsonBuffer, v any) ([]byte, error) {
+	var err error
+	if s.options.JSONEncoder != nil {
+		err = s.options.JSONEncoder(&b.buf, v)
+	} else {
+		err = b.enc.Encode(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Encoders terminate values with a newline, json.Marshal doesn't
+	return bytes.TrimSuffix(b.buf.Bytes(), []byte("\n")), nil
+}
+
+// marshalMessageJSON encodes a response message, with its 64-bit integers
+// encoded as configured by WithJSONInt64. Protobuf messages use protojson
+// with the names of the naming policy. With protoJSON, struct messages
+// follow the proto3 JSON mapping through their dynamic descriptor unless a
+// JSONEncoder is configured; otherwise they use encodeJSON, with
+// time.Duration fields encoded as strings like "3.5s".
+func (s *Service) marshalMessageJSON(output any, ctx *handlerContext, protoJSON bool) ([]byte, error) {
+	data, err := s.encodeMessageJSON(output, ctx, protoJSON)
+	if err != nil {
+		return nil, err
+	}
+	return formatJSONInt64(data, output, ctx.outputCodec, s.options.JSONInt64)
+}
+
+// encodeMessageJSON encodes a response message for marshalMessageJSON.
+func (s *Service) encodeMessageJSON(output any, ctx *handlerContext, protoJSON bool) ([]byte, error) {
+	if msg, ok := output.(proto.Message); ok {
+		return s.jsonMarshalOptions(false).Marshal(msg)
+	}
+	if !protoJSON || s.options.JSONEncoder != nil || ctx.outputCodec == nil {
+		// The data outlives the call, so it is copied out of the pooled buffer
+		buf := getJSONBuffer()
+		defer putJSONBuffer(buf)
+		data, err := s.encodeJSON(buf, output)
+		if err != nil {
+			return nil, err
+		}
+		if plan := unionPlanOf(reflect.TypeOf(output)); plan != nil {
+			if data, err = encodeJSONUnions(data, reflect.ValueOf(output), plan); err != nil {
+				return nil, err
+			}
+		}
+		if plan := durationPlanOf(reflect.TypeOf(output)); plan != nil {
+			return encodeJSONDurations(data, plan)
+		}
+		return bytes.Clone(data), nil
+	}
+
+	msg := dynamicpb.NewMessage(ctx.outputCodec.Descriptor())
+	if err := reflectutil.StructToProto(output, msg); err != nil {
+		return nil, fmt.Errorf("failed to convert struct to proto: %w", err)
+	}
+	return s.jsonMarshalOptions(true).Marshal(msg)
+}
+
+// marshalJSON encodes v with encoding/json, with union fields encoded as
+// their members and time.Duration fields as strings like "3.5s".
+func marshalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if plan := unionPlanOf(reflect.TypeOf(v)); plan != nil {
+		if data, err = encodeJSONUnions(data, reflect.ValueOf(v), plan); err != nil {
+			return nil, err
+		}
+	}
+	if plan := durationPlanOf(reflect.TypeOf(v)); plan != nil {
+		return encodeJSONDurations(data, plan)
+	}
+	return data, nil
+}
+
+// unmarshalJSON decodes JSON into target with encoding/json, decoding union
+// members into the fields holding them, and accepting time.Duration fields
+// as strings like "3.5s" as well as integer nanoseconds.
+func unmarshalJSON(data []byte, target any) error {
+	if plan := durationPlanOf(reflect.TypeOf(target)); plan != nil {
+		var err error
+		if data, err = decodeJSONDurations(data, plan); err != nil {
+			return err
+		}
+	}
+	if plan := unionPlanOf(reflect.TypeOf(target)); plan != nil {
+		return decodeJSONUnions(data, reflect.ValueOf(target), plan)
+	}
+	return json.Unmarshal(data, target)
+}
+
+// unmarshalStructJSON decodes a JSON request into a struct message. With
+// protoJSON it goes through the dynamic descriptor, accepting everything the
+// proto3 JSON mapping does: quoted 64-bit integers, RFC 3339 Timestamps,
+// Durations, enum names, and both the proto and the lowerCamelCase field
+// names. Unknown fields are ignored like encoding/json does.
+func (s *Service) unmarshalStructJSON(data []byte, target any, ctx *handlerContext, protoJSON bool) error {
+	if !protoJSON || ctx.inputCodec == nil {
+		data, err := parseJSONInt64(data, ctx.inputCodec, s.options.JSONInt64)
+		if err != nil {
+			return err
+		}
+		return unmarshalJSON(data, target)
+	}
+	msg := dynamicpb.NewMessage(ctx.inputCodec.Descriptor())
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true, Resolver: s.resolver()}).Unmarshal(data, msg); err != nil {
+		return err
+	}
+	return reflectutil.ProtoToStruct(msg, target)
+}
@@ -0,0 +1,373 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type AuthorRequest struct {
+	Name string `json:"name"`
+}
+
+type AuthorResponse struct {
+	Name  string            `json:"name"`
+	Bio   string            `json:"bio"`
+	Tags  []string          `json:"tags"`
+	Links map[string]string `json:"links"`
+}
+
+func authorHandler(_ context.Context, req *AuthorRequest) (*AuthorResponse, error) {
+	return &AuthorResponse{
+		Name:  req.Name,
+		Bio:   "<b>Gophers</b> & friends",
+		Tags:  []string{"go", "rpc", "json"},
+		Links: map[string]string{"home": "https://example.com/?a=1&b=2"},
+	}, nil
+}
+
+func newAuthorGateway(tb testing.TB, opts ...rpc.ServiceOption) http.Handler {
+	tb.Helper()
+	svc := rpc.NewService("AuthorService", append([]rpc.ServiceOption{rpc.WithPackage("author.v1")}, opts...)...)
+	rpc.MustRegister(svc, "Get", authorHandler)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		tb.Fatalf("Failed to create gateway: %v", err)
+	}
+	return gw
+}
+
+func newAuthorRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/author.v1.AuthorService/Get", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	return req
+}
+
+func TestJSONEncoding(t *testing.T) {
+	want, err := authorHandler(context.Background(), &AuthorRequest{Name: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBody, _ := json.Marshal(want)
+
+	t.Run("pooled encoder matches json.Marshal", func(t *testing.T) {
+		gw := newAuthorGateway(t)
+		// Repeated calls reuse pooled buffers
+		for range 3 {
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, newAuthorRequest())
+			if rec.Code != http.StatusOK || rec.Body.String() != string(wantBody) {
+				t.Fatalf("Expected %s, got %d %s", wantBody, rec.Code, rec.Body)
+			}
+		}
+	})
+
+	t.Run("custom encoder", func(t *testing.T) {
+		gw := newAuthorGateway(t, rpc.WithJSONEncoder(func(w io.Writer, v any) error {
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			return enc.Encode(v)
+		}))
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, newAuthorRequest())
+		if body := rec.Body.String(); !strings.Contains(body, `"<b>Gophers</b> & friends"`) || strings.HasSuffix(body, "\n") {
+			t.Errorf("Expected the custom encoder output without newline, got %q", body)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/author.v1.AuthorService/Get",
+			strings.NewReader("\x00\x00\x00\x00\x11{\"name\":\"gopher\"}"))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec = httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if body := rec.Body.String(); !strings.Contains(body, `"<b>Gophers</b> & friends"`) {
+			t.Errorf("Expected gRPC JSON responses to use the custom encoder, got %q", body)
+		}
+	})
+}
+
+type ScheduleRequest struct {
+	ID      int64         `json:"id"`
+	StartAt time.Time     `json:"start_at"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+type ScheduleResponse struct {
+	ID      int64             `json:"id"`
+	StartAt time.Time         `json:"start_at"`
+	Timeout time.Duration     `json:"timeout"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func TestProtoJSON(t *testing.T) {
+	newGateway := func(t *testing.T, opts ...rpc.ServiceOption) http.Handler {
+		t.Helper()
+		svc := rpc.NewService("ScheduleService", append([]rpc.ServiceOption{rpc.WithPackage("schedule.v1")}, opts...)...)
+		rpc.MustRegister(svc, "Echo", func(_ context.Context, req *ScheduleRequest) (*ScheduleResponse, error) {
+			return &ScheduleResponse{
+				ID:      req.ID,
+				StartAt: req.StartAt,
+				Timeout: req.Timeout,
+				Labels:  map[string]string{"team": "gophers"},
+			}, nil
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	const body = `{"id":"9007199254740993","startAt":"2024-01-02T03:04:05Z","timeout":"1.5s"}`
+	want := []string{
+		`"id":"9007199254740993"`,
+		`"start_at":"2024-01-02T03:04:05Z"`,
+		`"timeout":"1.500s"`,
+		`"labels":{"team":"gophers"}`,
+	}
+
+	t.Run("gRPC-JSON", func(t *testing.T) {
+		frame := append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+		req := httptest.NewRequest(http.MethodPost, "/schedule.v1.ScheduleService/Echo", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		newGateway(t).ServeHTTP(rec, req)
+
+		if status := rec.Header().Get("Grpc-Status"); status != "0" {
+			t.Fatalf("grpc-status = %q: %s", status, rec.Header().Get("Grpc-Message"))
+		}
+		for _, field := range want {
+			if !strings.Contains(rec.Body.String(), field) {
+				t.Errorf("Expected %s in %q", field, rec.Body)
+			}
+		}
+	})
+
+	t.Run("Connect with WithProtoJSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/schedule.v1.ScheduleService/Echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		newGateway(t, rpc.WithProtoJSON()).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		for _, field := range want {
+			if !strings.Contains(rec.Body.String(), field) {
+				t.Errorf("Expected %s in %s", field, rec.Body)
+			}
+		}
+	})
+
+	t.Run("Connect without WithProtoJSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/schedule.v1.ScheduleService/Echo",
+			strings.NewReader(`{"id":42,"timeout":1500000000}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		newGateway(t).ServeHTTP(rec, req)
+
+		// Integer nanoseconds are still accepted, durations are strings
+		if !strings.Contains(rec.Body.String(), `"id":42`) || !strings.Contains(rec.Body.String(), `"timeout":"1.500s"`) {
+			t.Errorf("Expected encoding/json output, got %d %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+type TimerRequest struct {
+	Deadline  *time.Time      `json:"deadline"`
+	Delay     time.Duration   `json:"delay"`
+	Backoff   *time.Duration  `json:"backoff"`
+	Intervals []time.Duration `json:"intervals"`
+	Marks     []time.Time     `json:"marks"`
+	Nested    struct {
+		Limits map[string]time.Duration `json:"limits"`
+	} `json:"nested"`
+}
+
+func TestTimeJSONMapping(t *testing.T) {
+	svc := rpc.NewService("TimerService", rpc.WithPackage("timer.v1"))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *TimerRequest) (*TimerRequest, error) {
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	const body = `{"deadline":"2024-01-02T03:04:05.5Z","delay":"-1.5s","backoff":"0.000250s",` +
+		`"intervals":["1s","120s"],"marks":["2024-01-02T03:04:05Z"],"nested":{"limits":{"read":"3s"}}}`
+	want := []string{
+		`"deadline":"2024-01-02T03:04:05.5`,
+		`"delay":"-1.500s"`,
+		`"backoff":"0.000250s"`,
+		`"intervals":["1s","120s"]`,
+		`"marks":["2024-01-02T03:04:05Z"]`,
+		`"read":"3s"`,
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		connect     bool
+	}{
+		{"Connect", "application/json", true},
+		{"plain JSON", "application/json", false},
+		{"gRPC-JSON", "application/grpc+json", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := []byte(body)
+			if tc.contentType == "application/grpc+json" {
+				payload = append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/timer.v1.TimerService/Echo", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.connect {
+				req.Header.Set("Connect-Protocol-Version", "1")
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || rec.Header().Get("Grpc-Message") != "" {
+				t.Fatalf("status = %d %q: %s", rec.Code, rec.Header().Get("Grpc-Message"), rec.Body)
+			}
+			// protojson randomizes its whitespace
+			got := strings.ReplaceAll(rec.Body.String(), " ", "")
+			for _, field := range want {
+				if !strings.Contains(got, field) {
+					t.Errorf("Expected %s in %q", field, got)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid duration", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/timer.v1.TimerService/Echo", strings.NewReader(`{"delay":"soon"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), `"invalid_argument"`) || !strings.Contains(rec.Body.String(), `delay: invalid duration`) {
+			t.Errorf("Expected an invalid argument error, got %s", rec.Body)
+		}
+	})
+}
+
+type AccountRequest struct {
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+}
+
+type AccountResponse struct {
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+}
+
+func TestJSONNaming(t *testing.T) {
+	newGateway := func(t *testing.T, naming rpc.JSONNaming) http.Handler {
+		t.Helper()
+		svc := rpc.NewService("AccountService", rpc.WithPackage("account.v1"),
+			rpc.WithJSONNaming(naming), rpc.WithJSONRPC("/jsonrpc"))
+		rpc.MustRegister(svc, "Get", func(_ context.Context, req *AccountRequest) (*AccountResponse, error) {
+			return &AccountResponse{UserID: req.UserID, DisplayName: req.DisplayName}, nil
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	post := func(gw http.Handler, path, body string) string {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		// protojson randomizes whitespace
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, rec.Body.Bytes()); err != nil {
+			t.Fatalf("Invalid JSON response %s: %v", rec.Body, err)
+		}
+		return compact.String()
+	}
+
+	tests := []struct {
+		naming rpc.JSONNaming
+		body   string
+		want   string
+	}{
+		{rpc.JSONNamingDefault, `{"user_id":7,"display_name":"gopher"}`, `{"user_id":7,"display_name":"gopher"}`},
+		{rpc.JSONNamingSnakeCase, `{"user_id":"7","display_name":"gopher"}`, `{"user_id":"7","display_name":"gopher"}`},
+		{rpc.JSONNamingCamelCase, `{"userId":"7","displayName":"gopher"}`, `{"userId":"7","displayName":"gopher"}`},
+		{rpc.JSONNamingGoNames, `{"UserID":"7","DisplayName":"gopher"}`, `{"UserID":"7","DisplayName":"gopher"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.naming.String(), func(t *testing.T) {
+			gw := newGateway(t, tt.naming)
+			if got := post(gw, "/account.v1.AccountService/Get", tt.body); got != tt.want {
+				t.Errorf("Connect response = %s, want %s", got, tt.want)
+			}
+
+			rpcBody := `{"jsonrpc":"2.0","method":"Get","id":1,"params":` + tt.body + `}`
+			if got := post(gw, "/jsonrpc", rpcBody); !strings.Contains(got, `"result":`+tt.want) {
+				t.Errorf("JSON-RPC response = %s, want result %s", got, tt.want)
+			}
+
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", http.NoBody))
+			var doc struct {
+				Components struct {
+					Schemas map[string]struct {
+						Properties map[string]any `json:"properties"`
+					} `json:"schemas"`
+				} `json:"components"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("Failed to parse OpenAPI: %v", err)
+			}
+			properties := doc.Components.Schemas["account.v1.AccountRequest"].Properties
+			var want map[string]any
+			_ = json.Unmarshal([]byte(tt.body), &want)
+			for name := range want {
+				if _, ok := properties[name]; !ok {
+					t.Errorf("OpenAPI properties %v lack %s", properties, name)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkJSONResponse compares the pooled encoder with a json.Marshal
+// based encoder on unary Connect JSON calls.
+func BenchmarkJSONResponse(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		opts []rpc.ServiceOption
+	}{
+		{"pooled", nil},
+		{"marshal", []rpc.ServiceOption{rpc.WithJSONEncoder(func(w io.Writer, v any) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		})}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			gw := newAuthorGateway(b, bm.opts...)
+			b.ReportAllocs()
+			for b.Loop() {
+				gw.ServeHTTP(httptest.NewRecorder(), newAuthorRequest())
+			}
+		})
+	}
+}
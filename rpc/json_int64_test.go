@@ -0,0 +1,106 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type LedgerEntry struct {
+	ID      int64            `json:"id"`
+	Amount  uint64           `json:"amount"`
+	Count   int32            `json:"count"`
+	Refs    []int64          `json:"refs"`
+	Totals  map[string]int64 `json:"totals"`
+	Parent  *LedgerEntry     `json:"parent"`
+	Comment string           `json:"comment"`
+}
+
+func newLedgerService(t *testing.T, opts ...rpc.ServiceOption) (*rpc.Service, http.Handler) {
+	t.Helper()
+	opts = append([]rpc.ServiceOption{rpc.WithPackage("ledger.v1"), rpc.WithJSONRPC("/jsonrpc")}, opts...)
+	svc := rpc.NewService("LedgerService", opts...)
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *LedgerEntry) (*LedgerEntry, error) {
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	return svc, gw
+}
+
+func TestJSONInt64(t *testing.T) {
+	const request = `{"id":"9007199254740993","amount":18446744073709551615,"count":7,` +
+		`"refs":[1,"9007199254740995"],"totals":{"a":"9007199254740997"},"parent":{"id":2},"comment":"12"}`
+	post := func(gw http.Handler, path, body string) string {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+	jsonRPC := `{"jsonrpc":"2.0","id":1,"method":"LedgerService.Echo","params":` + request + `}`
+
+	t.Run("strings", func(t *testing.T) {
+		_, gw := newLedgerService(t, rpc.WithJSONInt64(codec.JSONInt64String))
+		for _, body := range []string{
+			post(gw, "/ledger.v1.LedgerService/Echo", request),
+			post(gw, "/jsonrpc", jsonRPC),
+		} {
+			for _, want := range []string{
+				`"id":"9007199254740993"`, `"amount":"18446744073709551615"`, `"count":7`,
+				`"refs":["1","9007199254740995"]`, `"totals":{"a":"9007199254740997"}`, `"parent":{"id":"2"`, `"comment":"12"`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected %s in %s", want, body)
+				}
+			}
+		}
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		// The proto3 JSON mapping writes strings, which are rewritten
+		_, gw := newLedgerService(t, rpc.WithJSONInt64(codec.JSONInt64Number), rpc.WithProtoJSON())
+		body := post(gw, "/ledger.v1.LedgerService/Echo", request)
+		for _, want := range []string{
+			`"id":9007199254740993`, `"amount":18446744073709551615`, `"refs":[1,9007199254740995]`, `"totals":{"a":9007199254740997}`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected %s in %s", want, body)
+			}
+		}
+	})
+
+	t.Run("OpenAPI schemas", func(t *testing.T) {
+		svc, _ := newLedgerService(t, rpc.WithJSONInt64(codec.JSONInt64String))
+		spec, err := gateway.GenerateOpenAPI(svc.GetFileDescriptorSet(), gateway.OpenAPIInfo{Title: "Ledger", Version: "1.0.0"})
+		if err != nil {
+			t.Fatalf("Failed to generate OpenAPI: %v", err)
+		}
+		properties := spec.Components.Schemas["ledger.v1.LedgerEntry"].(map[string]any)["properties"].(map[string]any)
+		for _, name := range []string{"id", "amount"} {
+			if property := properties[name].(map[string]any); property["type"] != "string" || property["format"] != "int64" {
+				t.Errorf("Expected %s to be a string of format int64, got %v", name, property)
+			}
+		}
+		if items := properties["refs"].(map[string]any)["items"].(map[string]any); items["type"] != "string" {
+			t.Errorf("Expected string items, got %v", items)
+		}
+		if values := properties["totals"].(map[string]any)["additionalProperties"].(map[string]any); values["type"] != "string" {
+			t.Errorf("Expected string values, got %v", values)
+		}
+		if count := properties["count"].(map[string]any); count["type"] != "integer" {
+			t.Errorf("Expected count to stay an integer, got %v", count)
+		}
+	})
+}
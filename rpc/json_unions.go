@@ -0,0 +1,506 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// encoding/json encodes an interface field as the value it holds, losing its
+// type, and can't decode it at all. Fields holding a union registered with
+// schema.RegisterUnion are instead encoded like the proto3 JSON mapping
+// encodes their oneof, as a member named after the type of the value:
+// {"circle":{"radius":1}} for a Shape field holding a Circle. JSON of struct
+// messages is rewritten along a plan of where the unions of the message type
+// are, walking the value alongside to find the types of their values.
+
+// unionPlan locates the union fields within values of a Go type.
+type unionPlan struct {
+	fields  map[string]*unionPlanField // Struct fields with unions, by lower-cased JSON name
+	members map[string]*unionPlanField // Union members, by lower-cased name
+	elem    *unionPlan                 // Elements of arrays, values of maps, or nil
+	object  bool                       // elem applies to the values of a map
+}
+
+// unionPlanField is a struct field holding a union, or containing fields
+// that do.
+type unionPlanField struct {
+	index  []int               // Index sequence of the struct field
+	union  *schema.Union       // The union held by the field, or nil
+	member *schema.UnionMember // A member of union, for unionPlan.members
+	field  *unionPlanField     // The field holding the member
+	plan   *unionPlan          // The plan of a field containing unions
+}
+
+// unionPlans caches the plans of types, nil for types without unions.
+var unionPlans sync.Map // map[reflect.Type]*unionPlan
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// unionPlanOf returns the plan of t, or nil if its values hold no unions.
+func unionPlanOf(t reflect.Type) *unionPlan {
+	if t == nil {
+		return nil
+	}
+	if p, ok := unionPlans.Load(t); ok {
+		return p.(*unionPlan)
+	}
+	p := buildUnionPlan(t, make(map[reflect.Type]*unionPlan))
+	unionPlans.Store(t, p)
+	return p
+}
+
+// buildUnionPlan builds the plan of t. visiting holds the plans of the types
+// being built, so recursive types refer to their own plan.
+func buildUnionPlan(t reflect.Type, visiting map[reflect.Type]*unionPlan) *unionPlan {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Types encoding themselves are left alone
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) ||
+		t.Implements(textMarshalerType) {
+		return nil
+	}
+	if p, ok := visiting[t]; ok {
+		return p
+	}
+
+	switch t.Kind() { //nolint:exhaustive // Other kinds hold no unions
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil // Bytes are base64 strings
+		}
+		if elem := buildUnionPlan(t.Elem(), visiting); elem != nil {
+			return &unionPlan{elem: elem}
+		}
+	case reflect.Map:
+		if elem := buildUnionPlan(t.Elem(), visiting); elem != nil {
+			return &unionPlan{elem: elem, object: true}
+		}
+	case reflect.Struct:
+		p := &unionPlan{fields: make(map[string]*unionPlanField), members: make(map[string]*unionPlanField)}
+		visiting[t] = p
+		addUnionFields(p, t, nil, visiting)
+		delete(visiting, t)
+		if len(p.fields) > 0 {
+			return p
+		}
+	}
+	return nil
+}
+
+// addUnionFields adds the fields of struct type t with unions to p,
+// including the promoted fields of embedded structs, at index within the
+// struct type of p.
+func addUnionFields(p *unionPlan, t reflect.Type, index []int, visiting map[reflect.Type]*unionPlan) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldIndex := append(slices.Clip(index), i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// encoding/json ignores unexported embedded pointers, it can't set them
+			if f.IsExported() || f.Type.Kind() != reflect.Ptr {
+				addUnionFields(p, ft, fieldIndex, visiting)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if union, ok := schema.LookupUnion(f.Type); ok {
+			field := &unionPlanField{index: fieldIndex, union: union}
+			p.fields[strings.ToLower(name)] = field
+			for m := range union.Members {
+				p.members[strings.ToLower(union.Members[m].Name)] = &unionPlanField{
+					index: fieldIndex, union: union, member: &union.Members[m], field: field,
+				}
+			}
+			continue
+		}
+		if fp := buildUnionPlan(f.Type, visiting); fp != nil {
+			p.fields[strings.ToLower(name)] = &unionPlanField{index: fieldIndex, plan: fp}
+		}
+	}
+}
+
+// encodeJSONUnions rewrites data, the encoding/json encoding of v, a value
+// planned by p, with its union fields encoded as their members.
+func encodeJSONUnions(data []byte, v reflect.Value, p *unionPlan) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSONUnions(&out, data, v, p); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// writeJSONUnions writes data, the encoding of v, to out with the union
+// fields located by p rewritten. Values not matching the plan are copied.
+func writeJSONUnions(out *bytes.Buffer, data []byte, v reflect.Value, p *unionPlan) error {
+	data = bytes.TrimSpace(data)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if p == nil || len(data) == 0 || !v.IsValid() {
+		out.Write(data)
+		return nil
+	}
+	switch {
+	case data[0] == '{' && p.fields != nil && v.Kind() == reflect.Struct:
+		return writeJSONUnionStruct(out, data, v, p)
+	case data[0] == '{' && p.object && v.Kind() == reflect.Map:
+		return writeJSONUnionMap(out, data, v, p.elem)
+	case data[0] == '[' && p.elem != nil && !p.object && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		return writeJSONUnionArray(out, data, v, p.elem)
+	default:
+		out.Write(data)
+		return nil
+	}
+}
+
+// writeJSONUnionStruct writes the members of the JSON object of struct v.
+// Union fields are written as their members, and omitted when nil.
+func writeJSONUnionStruct(out *bytes.Buffer, data []byte, v reflect.Value, p *unionPlan) error {
+	out.WriteByte('{')
+	n := 0
+	err := rangeJSONObject(data, func(name string, value []byte) error {
+		key, fv, fp := name, reflect.Value{}, (*unionPlan)(nil)
+		if f := p.fields[strings.ToLower(name)]; f != nil {
+			var err error
+			if fv, err = v.FieldByIndexErr(f.index); err != nil {
+				fv = reflect.Value{}
+			}
+			if f.union != nil && fv.IsValid() {
+				if fv.IsNil() {
+					return nil // Unset oneofs are omitted
+				}
+				member, ok := f.union.MemberOf(fv.Elem().Type())
+				if !ok {
+					return fmt.Errorf("%v is not a registered member of union %v", fv.Elem().Type(), f.union.Interface)
+				}
+				key, fv, fp = member.Name, fv.Elem(), unionPlanOf(member.StructType())
+				if bytes.Equal(value, []byte("null")) {
+					value = []byte("{}") // A nil pointer is an empty member
+				}
+			} else {
+				fp = f.plan
+			}
+		}
+
+		if n > 0 {
+			out.WriteByte(',')
+		}
+		n++
+		quoted, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		out.Write(quoted)
+		out.WriteByte(':')
+		if err := writeJSONUnions(out, value, fv, fp); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	out.WriteByte('}')
+	return err
+}
+
+// writeJSONUnionMap writes the members of the JSON object of map v.
+func writeJSONUnionMap(out *bytes.Buffer, data []byte, v reflect.Value, elem *unionPlan) error {
+	values := make(map[string]reflect.Value, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := formatJSONMapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		values[key] = iter.Value()
+	}
+
+	out.WriteByte('{')
+	n := 0
+	err := rangeJSONObject(data, func(name string, value []byte) error {
+		if n > 0 {
+			out.WriteByte(',')
+		}
+		n++
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		out.Write(quoted)
+		out.WriteByte(':')
+		if err := writeJSONUnions(out, value, values[name], elem); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	out.WriteByte('}')
+	return err
+}
+
+// writeJSONUnionArray writes the elements of the JSON array of slice or
+// array v.
+func writeJSONUnionArray(out *bytes.Buffer, data []byte, v reflect.Value, elem *unionPlan) error {
+	out.WriteByte('[')
+	i := 0
+	err := rangeJSONArray(data, func(value []byte) error {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		var ev reflect.Value
+		if i < v.Len() {
+			ev = v.Index(i)
+		}
+		i++
+		return writeJSONUnions(out, value, ev, elem)
+	})
+	out.WriteByte(']')
+	return err
+}
+
+// formatJSONMapKey formats a map key like encoding/json does.
+func formatJSONMapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() { //nolint:exhaustive // encoding/json supports no other keys
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %v", k.Type())
+}
+
+// decodeJSONUnions decodes data into v, a value planned by p, with
+// encoding/json, decoding the union members located by p into new values of
+// their types set on the fields holding them. v is a non-nil pointer or
+// settable.
+func decodeJSONUnions(data []byte, v reflect.Value, p *unionPlan) error {
+	data = bytes.TrimSpace(data)
+	if v.Kind() == reflect.Ptr {
+		if bytes.Equal(data, []byte("null")) {
+			if v.CanSet() {
+				v.SetZero()
+			}
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeJSONUnions(data, v.Elem(), p)
+	}
+	if p == nil || len(data) == 0 {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	switch {
+	case data[0] == '{' && p.fields != nil && v.Kind() == reflect.Struct:
+		return decodeJSONUnionStruct(data, v, p)
+	case data[0] == '{' && p.object && v.Kind() == reflect.Map:
+		return decodeJSONUnionMap(data, v, p.elem)
+	case data[0] == '[' && p.elem != nil && !p.object && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		return decodeJSONUnionArray(data, v, p.elem)
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+// decodeJSONUnionStruct decodes a JSON object into struct v. Members of
+// unions and fields containing them are decoded after the other fields.
+func decodeJSONUnionStruct(data []byte, v reflect.Value, p *unionPlan) error {
+	type planned struct {
+		field *unionPlanField
+		value []byte
+	}
+	var later []planned
+	var rest bytes.Buffer
+	rest.WriteByte('{')
+	err := rangeJSONObject(data, func(name string, value []byte) error {
+		lower := strings.ToLower(name)
+		if m := p.members[lower]; m != nil {
+			later = append(later, planned{m, value})
+			return nil
+		}
+		if f := p.fields[lower]; f != nil && f.plan != nil {
+			later = append(later, planned{f, value})
+			return nil
+		}
+		if rest.Len() > 1 {
+			rest.WriteByte(',')
+		}
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		rest.Write(quoted)
+		rest.WriteByte(':')
+		rest.Write(value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	rest.WriteByte('}')
+	if err := json.Unmarshal(rest.Bytes(), v.Addr().Interface()); err != nil {
+		return err
+	}
+
+	set := make(map[*unionPlanField]string)
+	for _, f := range later {
+		if f.field.member == nil {
+			if err := decodeJSONUnions(f.value, fieldByIndexAlloc(v, f.field.index), f.field.plan); err != nil {
+				return err
+			}
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(f.value), []byte("null")) {
+			continue // Unset like protojson leaves it
+		}
+		if other, ok := set[f.field.field]; ok {
+			return fmt.Errorf("union %v has both %s and %s set", f.field.union.Interface, other, f.field.member.Name)
+		}
+		set[f.field.field] = f.field.member.Name
+
+		member := f.field.member
+		value := reflect.New(member.StructType())
+		if err := decodeJSONUnions(f.value, value, unionPlanOf(member.StructType())); err != nil {
+			return fmt.Errorf("%s: %w", member.Name, err)
+		}
+		if member.Type.Kind() != reflect.Ptr {
+			value = value.Elem()
+		}
+		fieldByIndexAlloc(v, f.field.index).Set(value)
+	}
+	return nil
+}
+
+// decodeJSONUnionMap decodes a JSON object into map v.
+func decodeJSONUnionMap(data []byte, v reflect.Value, elem *unionPlan) error {
+	raw := reflect.New(reflect.MapOf(v.Type().Key(), rawMessageType))
+	if err := json.Unmarshal(data, raw.Interface()); err != nil {
+		return err
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), raw.Elem().Len()))
+	}
+	iter := raw.Elem().MapRange()
+	for iter.Next() {
+		value := reflect.New(v.Type().Elem())
+		if err := decodeJSONUnions(iter.Value().Bytes(), value.Elem(), elem); err != nil {
+			return err
+		}
+		v.SetMapIndex(iter.Key(), value.Elem())
+	}
+	return nil
+}
+
+// decodeJSONUnionArray decodes a JSON array into slice or array v. Like
+// encoding/json, extra elements are dropped and missing ones zeroed for
+// arrays.
+func decodeJSONUnionArray(data []byte, v reflect.Value, elem *unionPlan) error {
+	var values [][]byte
+	if err := rangeJSONArray(data, func(value []byte) error {
+		values = append(values, value)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), len(values), len(values)))
+	}
+	for i := range v.Len() {
+		if i >= len(values) {
+			v.Index(i).SetZero()
+			continue
+		}
+		if err := decodeJSONUnions(values[i], v.Index(i), elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndexAlloc returns the field of struct v at index, allocating the
+// nil embedded structs it is promoted from.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// rangeJSONObject calls fn with the name and value of each member of the
+// JSON object data.
+func rangeJSONObject(data []byte, fn func(name string, value []byte) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		name, _ := key.(string)
+		if err := fn(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeJSONArray calls fn with each element of the JSON array data.
+func rangeJSONArray(data []byte, fn func(value []byte) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultJSONRPCBatchConcurrency is the default number of calls of a batch
+// running in parallel.
+const defaultJSONRPCBatchConcurrency = 10
+
+// JSONRPCBatchOptions configures how the calls of JSON-RPC batches run.
+type JSONRPCBatchOptions struct {
+	// Concurrency is the maximum number of calls of a batch running in
+	// parallel (default: 10, 1 runs the calls one after another in order)
+	Concurrency int
+	// Timeout bounds each batch: calls still running or waiting when it
+	// expires get a deadline exceeded error, while the responses of the
+	// finished calls are kept (0 for no timeout)
+	Timeout time.Duration
+}
+
+// JSONRPCBatchStats describes a JSON-RPC batch once its response is complete.
+type JSONRPCBatchStats struct {
+	// Size is the number of requests in the batch, notifications included.
+	Size int
+	// Notifications is the number of notifications in the batch.
+	Notifications int
+	// Failures is the number of responses with an error, including invalid
+	// requests and calls that timed out.
+	Failures int
+	// TimedOut is the number of calls that had not finished when the batch
+	// timed out.
+	TimedOut int
+	// Latency is the time taken to handle the batch.
+	Latency time.Duration
+}
+
+// WithJSONRPCBatch configures the execution of JSON-RPC batches. The calls of
+// a batch run in parallel on a pool of workers, and their responses are
+// streamed in the order of the requests as soon as they and the responses
+// before them are ready:
+//
+//	svc := rpc.NewService("UserService",
+//		rpc.WithJSONRPC("/jsonrpc"),
+//		rpc.WithJSONRPCBatch(rpc.JSONRPCBatchOptions{Concurrency: 4, Timeout: 5 * time.Second}),
+//	)
+func WithJSONRPCBatch(opts JSONRPCBatchOptions) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONRPCBatch = opts
+	}
+}
+
+// OnJSONRPCBatch calls hook with the stats of each JSON-RPC batch once its
+// response is complete, e.g. to record batch sizes. The calls of the batch
+// are also reported to the hooks of OnResponse.
+func OnJSONRPCBatch(hook func(ctx context.Context, stats JSONRPCBatchStats)) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONRPCBatchHooks = append(o.JSONRPCBatchHooks, hook)
+	}
+}
+
+// jsonrpcBatchCall is a request of a batch and its response.
+type jsonrpcBatchCall struct {
+	// req is nil for elements that are not valid requests
+	req  *JSONRPCRequest
+	resp *JSONRPCResponse
+	// done is closed once resp is set
+	done chan struct{}
+}
+
+// handleJSONRPCBatch handles batch JSON-RPC requests. A failing call does not
+// fail the batch: each request gets its own response, errors included, and
+// notifications are run without a response.
+func (s *Service) handleJSONRPCBatch(w http.ResponseWriter, r *http.Request, body []byte) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(body, &elems); err != nil {
+		s.writeJSONRPCError(w, nil, &JSONRPCError{
+			Code:    JSONRPCParseError,
+			Message: "Invalid batch request",
+		})
+		return
+	}
+
+	// An empty batch is an invalid request
+	if len(elems) == 0 {
+		s.writeJSONRPCError(w, nil, &JSONRPCError{
+			Code:    JSONRPCInvalidRequest,
+			Message: "Empty batch request",
+		})
+		return
+	}
+
+	// Check batch size limit
+	if len(elems) > s.options.JSONRPCBatchLimit {
+		s.writeJSONRPCError(w, nil, &JSONRPCError{
+			Code:    JSONRPCInvalidRequest,
+			Message: fmt.Sprintf("Batch request exceeds limit of %d", s.options.JSONRPCBatchLimit),
+		})
+		return
+	}
+
+	start := time.Now()
+	ctx := r.Context()
+	if s.options.JSONRPCBatch.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.options.JSONRPCBatch.Timeout)
+		defer cancel()
+	}
+
+	// Answer invalid elements in place and run the others
+	calls := make([]*jsonrpcBatchCall, len(elems))
+	pending := make([]*jsonrpcBatchCall, 0, len(elems))
+	for i, elem := range elems {
+		call := &jsonrpcBatchCall{done: make(chan struct{})}
+		call.req, call.resp = parseJSONRPCBatchElement(elem)
+		if call.resp != nil {
+			close(call.done)
+		} else {
+			pending = append(pending, call)
+		}
+		calls[i] = call
+	}
+	finished := s.runJSONRPCBatch(ctx, r, pending)
+
+	stats := JSONRPCBatchStats{Size: len(calls)}
+	s.writeJSONRPCBatch(ctx, w, calls, &stats)
+
+	// Notifications have no response, but the batch waits for them
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+	for _, call := range calls {
+		if call.req != nil && call.req.IsNotification() {
+			stats.Notifications++
+			if !isJSONRPCBatchCallDone(call) {
+				stats.TimedOut++
+			}
+		}
+	}
+	// Calls still running got the canceled ctx, and must not outlive the
+	// request they belong to
+	<-finished
+
+	stats.Latency = time.Since(start)
+	for _, hook := range s.options.JSONRPCBatchHooks {
+		hook(r.Context(), stats)
+	}
+}
+
+// parseJSONRPCBatchElement parses an element of a batch. It returns the
+// response of elements that are not valid requests.
+func parseJSONRPCBatchElement(elem json.RawMessage) (*JSONRPCRequest, *JSONRPCResponse) {
+	var req JSONRPCRequest
+	if err := json.Unmarshal(elem, &req); err != nil {
+		return nil, &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error: &JSONRPCError{
+				Code:    JSONRPCInvalidRequest,
+				Message: "Invalid request",
+			},
+		}
+	}
+	if req.JSONRPC != "2.0" {
+		return nil, &JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    JSONRPCInvalidRequest,
+				Message: "Invalid jsonrpc version",
+			},
+		}
+	}
+	return &req, nil
+}
+
+// runJSONRPCBatch runs calls on a pool of workers in the background. Calls
+// not started when ctx is done are skipped. The returned channel is closed
+// once the workers have returned.
+func (s *Service) runJSONRPCBatch(ctx context.Context, r *http.Request, calls []*jsonrpcBatchCall) <-chan struct{} {
+	queue := make(chan *jsonrpcBatchCall, len(calls))
+	for _, call := range calls {
+		queue <- call
+	}
+	close(queue)
+
+	workers := s.options.JSONRPCBatch.Concurrency
+	if workers <= 0 {
+		workers = defaultJSONRPCBatchConcurrency
+	}
+	workers = min(workers, len(calls))
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for call := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				s.runJSONRPCBatchCall(ctx, r, call)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	return finished
+}
+
+// runJSONRPCBatchCall runs a call of a batch, turning a panic of its handler
+// into an internal error so that the other calls are not affected.
+func (s *Service) runJSONRPCBatchCall(ctx context.Context, r *http.Request, call *jsonrpcBatchCall) {
+	defer close(call.done)
+	defer func() {
+		if rec := recover(); rec != nil {
+			call.resp = &JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      call.req.ID,
+				Error:   s.jsonrpcPanicError(r, call.req.Method, rec),
+			}
+		}
+	}()
+	// The response of the batch is shared, so the pushback of a shed call is
+	// only in the RetryInfo detail of its error
+	call.resp = s.processJSONRPCRequest(ctx, r, make(http.Header), call.req)
+}
+
+// jsonrpcPanicError reports the panic of a call to method like the panics of
+// other handlers: logged with its stack trace to the error sanitizer's logger,
+// and answered with an internal error that only carries the panic value in
+// dev mode.
+func (s *Service) jsonrpcPanicError(r *http.Request, method string, rec any) *JSONRPCError {
+	info, cause := debugInfoFromError(recoverWithDebugInfo(rec))
+	s.options.ErrorSanitizer.logger().LogAttrs(r.Context(), slog.LevelError, "panic in JSON-RPC call",
+		slog.String("method", method),
+		slog.String("panic", info.Cause),
+		slog.String("stack", info.Stack),
+	)
+	rpcErr := NewError(CodeInternal, "Internal error")
+	if s.options.DevMode {
+		rpcErr = cause.(*Error)
+	}
+	return NewJSONRPCError(s.options.ErrorSanitizer.sanitize(r, method, rpcErr, cause))
+}
+
+// writeJSONRPCBatch streams the responses of a batch in the order of its
+// requests, flushing each one as soon as it and those before it are ready.
+// Calls that have not finished when ctx is done get a timeout error.
+func (s *Service) writeJSONRPCBatch(ctx context.Context, w http.ResponseWriter, calls []*jsonrpcBatchCall, stats *JSONRPCBatchStats) {
+	flusher, _ := w.(http.Flusher)
+	wrote := false
+	for _, call := range calls {
+		if call.req != nil && call.req.IsNotification() {
+			continue
+		}
+
+		resp := awaitJSONRPCBatchCall(ctx, call)
+		if resp == nil {
+			stats.TimedOut++
+			resp = &JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      call.req.ID,
+				Error:   NewJSONRPCError(NewError(CodeDeadlineExceeded, "batch timed out before the call finished")),
+			}
+		}
+		if resp.Error != nil {
+			stats.Failures++
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			data, _ = json.Marshal(&JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      resp.ID,
+				Error: &JSONRPCError{
+					Code:    JSONRPCInternalError,
+					Message: "Failed to encode response",
+				},
+			})
+		}
+
+		sep := ","
+		if !wrote {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			sep = "["
+			wrote = true
+		}
+		if _, err := w.Write(append([]byte(sep), data...)); err != nil {
+			// Log error, but response is already partially written
+			s.logBatchWriteError(ctx, err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// If all requests were notifications, return no content
+	if !wrote {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if _, err := w.Write([]byte("]\n")); err != nil {
+		s.logBatchWriteError(ctx, err)
+	}
+}
+
+// logBatchWriteError logs a failure to write the response of a batch to the
+// error sanitizer's logger.
+func (s *Service) logBatchWriteError(ctx context.Context, err error) {
+	s.options.ErrorSanitizer.logger().LogAttrs(ctx, slog.LevelError, "failed to write JSON-RPC batch response",
+		slog.String("error", err.Error()),
+	)
+}
+
+// awaitJSONRPCBatchCall waits for the response of a call, or returns nil if
+// ctx is done first.
+func awaitJSONRPCBatchCall(ctx context.Context, call *jsonrpcBatchCall) *JSONRPCResponse {
+	select {
+	case <-call.done:
+		return call.resp
+	case <-ctx.Done():
+		// Prefer a response that is ready
+		if isJSONRPCBatchCallDone(call) {
+			return call.resp
+		}
+		return nil
+	}
+}
+
+// isJSONRPCBatchCallDone reports whether a call has finished.
+func isJSONRPCBatchCallDone(call *jsonrpcBatchCall) bool {
+	select {
+	case <-call.done:
+		return true
+	default:
+		return false
+	}
+}
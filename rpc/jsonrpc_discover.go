@@ -0,0 +1,260 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// JSONRPCDiscoverMethod is the reserved JSON-RPC method returning the OpenRPC document.
+const JSONRPCDiscoverMethod = "rpc.discover"
+
+// openRPCVersion is the OpenRPC specification version of generated documents.
+const openRPCVersion = "1.2.6"
+
+// JSONRPCMethodNaming controls how methods are named over JSON-RPC.
+type JSONRPCMethodNaming int
+
+const (
+	// JSONRPCNamingFlat exposes methods by their bare name ("CreateUser").
+	// Qualified names are also accepted and resolved by their last segment.
+	JSONRPCNamingFlat JSONRPCMethodNaming = iota
+	// JSONRPCNamingService exposes methods as "Service.Method" ("UserService.CreateUser").
+	// Fully-qualified names ("user.v1.UserService.CreateUser") are also accepted.
+	JSONRPCNamingService
+)
+
+// WithJSONRPCMethodNaming sets how methods are named over JSON-RPC.
+func WithJSONRPCMethodNaming(naming JSONRPCMethodNaming) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONRPCMethodNaming = naming
+	}
+}
+
+// WithJSONRPCMethods limits JSON-RPC to the listed methods. Methods not listed
+// stay available over Connect, gRPC, and gRPC-Web. A per-method setting made with
+// MethodBuilder.JSONRPC takes precedence.
+func WithJSONRPCMethods(methods ...string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.JSONRPCMethods = append(o.JSONRPCMethods, methods...)
+	}
+}
+
+// JSONRPC sets whether the method is exposed over JSON-RPC.
+func (m *MethodBuilder) JSONRPC(enabled bool) *MethodBuilder {
+	m.method.Options.JSONRPC = &enabled
+	return m
+}
+
+// jsonRPCExposed reports whether a method is reachable over JSON-RPC.
+func (s *Service) jsonRPCExposed(method *Method) bool {
+	// Streaming methods cannot be expressed as JSON-RPC calls
+	if method.StreamType != StreamTypeUnary {
+		return false
+	}
+	if method.Options.JSONRPC != nil {
+		return *method.Options.JSONRPC
+	}
+	if len(s.options.JSONRPCMethods) == 0 {
+		return true
+	}
+	for _, name := range s.options.JSONRPCMethods {
+		if name == method.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonRPCMethodName returns the public JSON-RPC name of a method.
+func (s *Service) jsonRPCMethodName(method *Method) string {
+	if s.options.JSONRPCMethodNaming == JSONRPCNamingService {
+		return s.name + "." + method.Name
+	}
+	return method.Name
+}
+
+// resolveJSONRPCMethod finds the exposed method for a JSON-RPC method name.
+func (s *Service) resolveJSONRPCMethod(name string) (*Method, bool) {
+	var methodName string
+	switch s.options.JSONRPCMethodNaming {
+	case JSONRPCNamingService:
+		for _, prefix := range []string{s.name + ".", s.packageName + "." + s.name + "."} {
+			if rest, ok := strings.CutPrefix(name, prefix); ok && !strings.Contains(rest, ".") {
+				methodName = rest
+				break
+			}
+		}
+	default:
+		// e.g., "user.v1.UserService.CreateUser" -> "CreateUser"
+		methodName = name[strings.LastIndex(name, ".")+1:]
+	}
+
+	method, ok := s.methods[methodName]
+	if !ok || !s.jsonRPCExposed(method) {
+		return nil, false
+	}
+	return method, true
+}
+
+// OpenRPCDocument is an OpenRPC description of the JSON-RPC methods of a service.
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+// OpenRPCInfo describes the API.
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenRPCMethod describes a single JSON-RPC method.
+type OpenRPCMethod struct {
+	Name           string                `json:"name"`
+	Description    string                `json:"description,omitempty"`
+	Deprecated     bool                  `json:"deprecated,omitempty"`
+	ParamStructure string                `json:"paramStructure"`
+	Params         []OpenRPCContentDescr `json:"params"`
+	Result         OpenRPCContentDescr   `json:"result"`
+}
+
+// OpenRPCContentDescr describes a parameter or result.
+type OpenRPCContentDescr struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Schema   any    `json:"schema"`
+}
+
+// OpenRPCComponents holds reusable schemas.
+type OpenRPCComponents struct {
+	Schemas map[string]any `json:"schemas"`
+}
+
+// OpenRPC builds the OpenRPC document for the methods exposed over JSON-RPC.
+// Schemas are generated from the same descriptors as the OpenAPI spec.
+func (s *Service) OpenRPC() (*OpenRPCDocument, error) {
+	fdset := s.GetFileDescriptorSet()
+	spec, err := gateway.GenerateOpenAPI(fdset, gateway.OpenAPIInfo{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schemas: %w", err)
+	}
+
+	// Map method names to their message types as declared in the descriptors
+	messageTypes := make(map[string][2]string)
+	for _, file := range fdset.GetFile() {
+		for _, svc := range file.GetService() {
+			if file.GetPackage() != s.packageName || svc.GetName() != s.name {
+				continue
+			}
+			for _, m := range svc.GetMethod() {
+				messageTypes[m.GetName()] = [2]string{
+					strings.TrimPrefix(m.GetInputType(), "."),
+					strings.TrimPrefix(m.GetOutputType(), "."),
+				}
+			}
+		}
+	}
+
+	doc := &OpenRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info: OpenRPCInfo{
+			Title:       s.packageName + "." + s.name,
+			Description: s.options.Description,
+			Version:     "1.0.0",
+		},
+		Methods:    []OpenRPCMethod{},
+		Components: OpenRPCComponents{Schemas: spec.Components.Schemas},
+	}
+
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		method := s.methods[name]
+		if !s.jsonRPCExposed(method) {
+			continue
+		}
+		types, ok := messageTypes[method.Name]
+		if !ok {
+			continue
+		}
+		inputName, outputName := types[0], types[1]
+
+		doc.Methods = append(doc.Methods, OpenRPCMethod{
+			Name:           s.jsonRPCMethodName(method),
+			Description:    method.Options.Description,
+			Deprecated:     s.deprecation(method) != nil,
+			ParamStructure: "by-name",
+			Params:         openRPCParams(spec.Components.Schemas[inputName]),
+			Result: OpenRPCContentDescr{
+				Name:   "result",
+				Schema: map[string]any{"$ref": "#/components/schemas/" + outputName},
+			},
+		})
+	}
+
+	return doc, nil
+}
+
+// encodedOpenRPC returns the encoded OpenRPC document, built once until a
+// method is registered, as every rpc.discover call of a batch would build it.
+func (s *Service) encodedOpenRPC() (json.RawMessage, error) {
+	s.openRPCMu.Lock()
+	defer s.openRPCMu.Unlock()
+	if s.openRPCDoc == nil {
+		doc, err := s.OpenRPC()
+		if err != nil {
+			return nil, err
+		}
+		if s.openRPCDoc, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	return s.openRPCDoc, nil
+}
+
+// resetOpenRPC drops the encoded OpenRPC document when a method is registered.
+func (s *Service) resetOpenRPC() {
+	s.openRPCMu.Lock()
+	defer s.openRPCMu.Unlock()
+	s.openRPCDoc = nil
+}
+
+// openRPCParams turns the top-level properties of a request schema into by-name params.
+func openRPCParams(schema any) []OpenRPCContentDescr {
+	params := []OpenRPCContentDescr{}
+	object, _ := schema.(map[string]any)
+	properties, _ := object["properties"].(map[string]any)
+
+	required := make(map[string]bool)
+	if names, ok := object["required"].([]string); ok {
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		params = append(params, OpenRPCContentDescr{
+			Name:     name,
+			Required: required[name],
+			Schema:   properties[name],
+		})
+	}
+	return params
+}
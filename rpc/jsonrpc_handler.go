@@ -12,13 +12,20 @@ func (s *Service) JSONRPCHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a dummy handler context since we don't know the method yet
 		ctx := &handlerContext{
-			options:          s.options,
+			options:          &s.options,
 			validator:        s.validator,
 			responseHeaders:  make(map[string][]string),
 			responseTrailers: make(map[string][]string),
 			requestHeaders:   r.Header,
 		}
 
+		// Verify the caller before decoding the request
+		r, authErr := s.authenticate(r, nil)
+		if authErr != nil {
+			s.writeJSONRPCError(w, nil, NewJSONRPCError(authErr))
+			return
+		}
+
 		// Handle the JSON-RPC request
 		s.handleJSONRPCRequest(w, r, ctx)
 	})
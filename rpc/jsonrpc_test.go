@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Test types
@@ -203,3 +207,391 @@ func TestJSONRPCHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestJSONRPCNamingAndDiscovery(t *testing.T) {
+	svc := NewService("GreeterService",
+		WithPackage("greeter.v1"),
+		WithJSONRPC("/jsonrpc"),
+		WithJSONRPCMethodNaming(JSONRPCNamingService),
+		WithJSONRPCMethods("SayHello", "Internal"),
+	)
+	MustRegisterMethod(svc,
+		NewMethod("SayHello", testHandler).WithDescription("Greets a user"),
+		NewMethod("SayGoodbye", testHandler),
+		NewMethod("Internal", testHandler).JSONRPC(false),
+	)
+
+	gw, err := NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(t *testing.T, method string) JSONRPCResponse {
+		t.Helper()
+		body, _ := json.Marshal(JSONRPCRequest{
+			JSONRPC: "2.0",
+			Method:  method,
+			Params:  json.RawMessage(`{"name": "World"}`),
+			ID:      1,
+		})
+		httpReq := httptest.NewRequest("POST", "/jsonrpc", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, httpReq)
+
+		var resp JSONRPCResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("service naming", func(t *testing.T) {
+		for _, method := range []string{"GreeterService.SayHello", "greeter.v1.GreeterService.SayHello"} {
+			if resp := call(t, method); resp.Error != nil {
+				t.Errorf("Expected %s to succeed, got %+v", method, resp.Error)
+			}
+		}
+		if resp := call(t, "SayHello"); resp.Error == nil || resp.Error.Code != JSONRPCMethodNotFound {
+			t.Errorf("Expected flat name to be rejected, got %+v", resp)
+		}
+	})
+
+	t.Run("disabled methods", func(t *testing.T) {
+		for _, method := range []string{"GreeterService.SayGoodbye", "GreeterService.Internal"} {
+			if resp := call(t, method); resp.Error == nil || resp.Error.Code != JSONRPCMethodNotFound {
+				t.Errorf("Expected %s to be hidden, got %+v", method, resp)
+			}
+		}
+	})
+
+	t.Run("rpc.discover", func(t *testing.T) {
+		resp := call(t, JSONRPCDiscoverMethod)
+		if resp.Error != nil {
+			t.Fatalf("Discover failed: %+v", resp.Error)
+		}
+		var doc OpenRPCDocument
+		if err := json.Unmarshal(resp.Result, &doc); err != nil {
+			t.Fatalf("Invalid OpenRPC document: %v", err)
+		}
+		if len(doc.Methods) != 1 {
+			t.Fatalf("Expected only the exposed method, got %+v", doc.Methods)
+		}
+		method := doc.Methods[0]
+		if method.Name != "GreeterService.SayHello" || method.Description != "Greets a user" {
+			t.Errorf("Unexpected method: %+v", method)
+		}
+		if len(method.Params) != 1 || method.Params[0].Name != "name" {
+			t.Errorf("Expected a single name param, got %+v", method.Params)
+		}
+		if _, ok := doc.Components.Schemas["greeter.v1.TestResponse"]; !ok {
+			t.Errorf("Expected result schema in components, got %v", doc.Components.Schemas)
+		}
+	})
+
+	t.Run("rpc.discover reuses the document until registration", func(t *testing.T) {
+		first, second := call(t, JSONRPCDiscoverMethod), call(t, JSONRPCDiscoverMethod)
+		if !bytes.Equal(first.Result, second.Result) {
+			t.Errorf("Expected the same document, got %s and %s", first.Result, second.Result)
+		}
+		if svc.openRPCDoc == nil {
+			t.Fatal("Expected the document to be cached")
+		}
+		MustRegisterMethod(svc, NewMethod("Internal2", testHandler))
+		if svc.openRPCDoc != nil {
+			t.Error("Expected registration to drop the cached document")
+		}
+	})
+}
+
+type batchCallRequest struct {
+	Name    string `json:"name"`
+	DelayMs int    `json:"delay_ms"`
+}
+
+func TestJSONRPCBatchExecution(t *testing.T) {
+	var running, maxRunning, notified atomic.Int64
+	handler := func(ctx context.Context, req *batchCallRequest) (*TestResponse, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		select {
+		case <-time.After(time.Duration(req.DelayMs) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		switch req.Name {
+		case "panic":
+			panic("boom")
+		case "fail":
+			return nil, NewError(CodeNotFound, "no such user")
+		case "notify":
+			notified.Add(1)
+		}
+		return &TestResponse{Message: "Hello, " + req.Name}, nil
+	}
+
+	newGateway := func(t *testing.T, opts JSONRPCBatchOptions, stats *JSONRPCBatchStats, extra ...ServiceOption) http.Handler {
+		t.Helper()
+		svc := NewService("BatchService", append([]ServiceOption{
+			WithPackage("batch.v1"),
+			WithJSONRPC("/jsonrpc"),
+			WithJSONRPCBatch(opts),
+			OnJSONRPCBatch(func(_ context.Context, s JSONRPCBatchStats) { *stats = s }),
+		}, extra...)...)
+		MustRegister(svc, "Greet", handler)
+		gw, err := NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+
+	send := func(t *testing.T, gw http.Handler, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		httpReq := httptest.NewRequest("POST", "/jsonrpc", bytes.NewReader([]byte(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, httpReq)
+		return w
+	}
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) []JSONRPCResponse {
+		t.Helper()
+		var responses []JSONRPCResponse
+		if err := json.NewDecoder(w.Body).Decode(&responses); err != nil {
+			t.Fatalf("Failed to decode batch response %q: %v", w.Body.String(), err)
+		}
+		return responses
+	}
+
+	t.Run("responses keep request order", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		maxRunning.Store(0)
+		gw := newGateway(t, JSONRPCBatchOptions{Concurrency: 2}, &stats)
+		w := send(t, gw, `[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "a", "delay_ms": 60}, "id": 1},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "b", "delay_ms": 30}, "id": 2},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "c"}, "id": 3},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "d"}, "id": 4}
+		]`)
+		responses := decode(t, w)
+		if len(responses) != 4 {
+			t.Fatalf("Expected 4 responses, got %d", len(responses))
+		}
+		for i, resp := range responses {
+			if resp.ID != float64(i+1) {
+				t.Errorf("Response %d has ID %v", i, resp.ID)
+			}
+		}
+		if m := maxRunning.Load(); m != 2 {
+			t.Errorf("Expected 2 calls in parallel, got %d", m)
+		}
+		if stats.Size != 4 || stats.Failures != 0 || stats.Latency <= 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		maxRunning.Store(0)
+		gw := newGateway(t, JSONRPCBatchOptions{Concurrency: 1}, &stats)
+		decode(t, send(t, gw, `[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "a", "delay_ms": 5}, "id": 1},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "b", "delay_ms": 5}, "id": 2}
+		]`))
+		if m := maxRunning.Load(); m != 1 {
+			t.Errorf("Expected calls to run one at a time, got %d in parallel", m)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		notified.Store(0)
+		gw := newGateway(t, JSONRPCBatchOptions{}, &stats)
+		w := send(t, gw, `[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "panic"}, "id": 1},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "fail"}, "id": 2},
+			1,
+			{"jsonrpc": "1.0", "method": "Greet", "id": 4},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "notify"}},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "ok"}, "id": 6}
+		]`)
+		responses := decode(t, w)
+		if len(responses) != 5 {
+			t.Fatalf("Expected 5 responses, got %+v", responses)
+		}
+		wantCodes := []int{JSONRPCInternalError, JSONRPCMethodNotFound, JSONRPCInvalidRequest, JSONRPCInvalidRequest}
+		for i, code := range wantCodes {
+			if responses[i].Error == nil || responses[i].Error.Code != code {
+				t.Errorf("Response %d: expected error %d, got %+v", i, code, responses[i])
+			}
+		}
+		if responses[2].ID != nil || responses[3].ID != float64(4) {
+			t.Errorf("Unexpected IDs of invalid requests: %v, %v", responses[2].ID, responses[3].ID)
+		}
+		if responses[4].Error != nil || responses[4].ID != float64(6) {
+			t.Errorf("Expected the last call to succeed, got %+v", responses[4])
+		}
+		if notified.Load() != 1 {
+			t.Error("Expected the notification to run")
+		}
+		if stats.Size != 6 || stats.Notifications != 1 || stats.Failures != 4 || stats.TimedOut != 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("panic is logged with its stack", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		var logs bytes.Buffer
+		gw := newGateway(t, JSONRPCBatchOptions{}, &stats, WithErrorSanitizer(ErrorSanitizer{
+			Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+		}))
+		httpReq := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(`[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "panic"}, "id": 1}
+		]`))
+		httpReq.Header.Set("X-Request-Id", "req-1")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, httpReq)
+		responses := decode(t, w)
+		if len(responses) != 1 || responses[0].Error == nil {
+			t.Fatalf("Expected an error response, got %+v", responses)
+		}
+		if got := responses[0].Error; got.Code != JSONRPCInternalError || strings.Contains(got.Message, "boom") || !strings.Contains(got.Message, "req-1") {
+			t.Errorf("Expected a sanitized internal error, got %+v", got)
+		}
+		var record struct {
+			Msg    string `json:"msg"`
+			Method string `json:"method"`
+			Panic  string `json:"panic"`
+			Stack  string `json:"stack"`
+		}
+		line, _, _ := strings.Cut(logs.String(), "\n")
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log record %q: %v", logs.String(), err)
+		}
+		if record.Msg != "panic in JSON-RPC call" || record.Method != "Greet" || record.Panic != "boom" || !strings.Contains(record.Stack, "goroutine") {
+			t.Errorf("Unexpected log record: %+v", record)
+		}
+	})
+
+	t.Run("timeout keeps finished calls", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		gw := newGateway(t, JSONRPCBatchOptions{Concurrency: 1, Timeout: 50 * time.Millisecond}, &stats)
+		w := send(t, gw, `[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "fast"}, "id": 1},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "slow", "delay_ms": 5000}, "id": 2},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "queued"}, "id": 3}
+		]`)
+		responses := decode(t, w)
+		if len(responses) != 3 {
+			t.Fatalf("Expected 3 responses, got %+v", responses)
+		}
+		if responses[0].Error != nil {
+			t.Errorf("Expected the first call to succeed, got %+v", responses[0].Error)
+		}
+		for _, resp := range responses[1:] {
+			if resp.Error == nil || resp.Error.Code != JSONRPCServerError {
+				t.Errorf("Expected a timeout error, got %+v", resp.Error)
+			}
+		}
+		if stats.TimedOut < 1 || stats.Failures != 2 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		if n := running.Load(); n != 0 {
+			t.Errorf("Expected no call to outlive the batch, %d still running", n)
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		w := send(t, newGateway(t, JSONRPCBatchOptions{}, &stats), `[]`)
+		var resp JSONRPCResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Error == nil || resp.Error.Code != JSONRPCInvalidRequest {
+			t.Errorf("Expected an invalid request error, got %+v", resp)
+		}
+	})
+
+	t.Run("only notifications", func(t *testing.T) {
+		var stats JSONRPCBatchStats
+		notified.Store(0)
+		w := send(t, newGateway(t, JSONRPCBatchOptions{}, &stats), `[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "notify"}},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "notify"}}
+		]`)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", w.Code)
+		}
+		if notified.Load() != 2 || stats.Notifications != 2 {
+			t.Errorf("Expected both notifications to run, got %d (stats %+v)", notified.Load(), stats)
+		}
+	})
+}
+
+func TestJSONRPCConcurrencyLimit(t *testing.T) {
+	started, unblock := make(chan struct{}, 3), make(chan struct{})
+	svc := NewService("LimitedService",
+		WithPackage("limited.v1"),
+		WithJSONRPC("/jsonrpc"),
+	)
+	MustRegisterMethod(svc, NewMethod("Greet", func(_ context.Context, req *TestRequest) (*TestResponse, error) {
+		started <- struct{}{}
+		<-unblock
+		return &TestResponse{Message: "Hello, " + req.Name}, nil
+	}).WithMaxConcurrency(1))
+	gw, err := NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		httpReq := httptest.NewRequest("POST", "/jsonrpc", bytes.NewReader([]byte(`[
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "a"}, "id": 1},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "b"}, "id": 2},
+			{"jsonrpc": "2.0", "method": "Greet", "params": {"name": "c"}, "id": 3}
+		]`)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, httpReq)
+		done <- w
+	}()
+
+	// The calls of the batch run in parallel, but only one gets the slot
+	<-started
+	deadline := time.Now().Add(time.Second)
+	for svc.ConcurrencyStats()["Greet"].Rejected != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected two rejected calls, got stats %+v", svc.ConcurrencyStats()["Greet"])
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+
+	var responses []JSONRPCResponse
+	if err := json.NewDecoder((<-done).Body).Decode(&responses); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	succeeded, rejected := 0, 0
+	for _, resp := range responses {
+		switch {
+		case resp.Error == nil:
+			succeeded++
+		case resp.Error.Code == JSONRPCServerError && strings.Contains(resp.Error.Message, "too many concurrent calls"):
+			rejected++
+		default:
+			t.Errorf("Unexpected error: %+v", resp.Error)
+		}
+	}
+	if succeeded != 1 || rejected != 2 {
+		t.Errorf("Expected 1 call to succeed and 2 to be rejected, got %d and %d", succeeded, rejected)
+	}
+}
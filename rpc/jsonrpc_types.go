@@ -90,9 +90,12 @@ func errorCodeToJSONRPC(code Code) int {
 
 // NewJSONRPCError creates a JSON-RPC error from a hyperway error
 func NewJSONRPCError(err *Error) *JSONRPCError {
-	return &JSONRPCError{
+	jsonErr := &JSONRPCError{
 		Code:    errorCodeToJSONRPC(err.Code),
 		Message: err.Message,
-		Data:    err.Details,
 	}
+	if err.Details != nil {
+		jsonErr.Data = Redact(err.Details)
+	}
+	return jsonErr
 }
@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+)
+
+// Lazy is a message field whose decoding is deferred until it is accessed.
+//
+// Use it for large nested subtrees of request messages that handlers read only
+// occasionally. The JSON request decoder keeps the raw JSON of the field, and
+// Get decodes it into T on first access. Protobuf requests are decoded as a
+// whole, so their lazy fields are decoded with the rest of the message. The
+// field has the same schema as a *T field, so clients are unaffected.
+//
+//	type IngestRequest struct {
+//		ID      string             `json:"id"`
+//		Payload rpc.Lazy[Document] `json:"payload"`
+//	}
+//
+// Validation tags inside T are not checked by request validation, since the
+// subtree is not decoded before the handler runs.
+type Lazy[T any] struct {
+	state *lazyState[T]
+}
+
+// lazyState is shared by copies of a Lazy.
+type lazyState[T any] struct {
+	raw   []byte // raw JSON
+	once  sync.Once
+	value *T
+	err   error
+}
+
+// NewLazy returns a Lazy holding an already decoded value, for use in
+// responses and tests.
+func NewLazy[T any](value *T) Lazy[T] {
+	state := &lazyState[T]{value: value}
+	state.once.Do(func() {})
+	return Lazy[T]{state: state}
+}
+
+// IsSet reports whether the field was present.
+func (l Lazy[T]) IsSet() bool {
+	return l.state != nil
+}
+
+// Get decodes the field on first access and returns the value.
+// It returns nil without error if the field was not present.
+func (l Lazy[T]) Get() (*T, error) {
+	if l.state == nil {
+		return nil, nil
+	}
+	s := l.state
+	s.once.Do(func() {
+		s.value, s.err = s.decode()
+	})
+	return s.value, s.err
+}
+
+// Raw returns the raw JSON of the field, or nil if it was not received as JSON.
+func (l Lazy[T]) Raw() json.RawMessage {
+	if l.state == nil {
+		return nil
+	}
+	return l.state.raw
+}
+
+// decode decodes the raw bytes into a new T.
+func (s *lazyState[T]) decode() (*T, error) {
+	value := new(T)
+	if err := unmarshalJSON(s.raw, value); err != nil {
+		return nil, NewErrorf(CodeInvalidArgument, "failed to decode lazy field: %v", err)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw JSON for decoding on access.
+func (l *Lazy[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		l.state = nil
+		return nil
+	}
+	l.state = &lazyState[T]{raw: bytes.Clone(data)}
+	return nil
+}
+
+// MarshalJSON encodes the value, decoding it first if needed.
+func (l Lazy[T]) MarshalJSON() ([]byte, error) {
+	if l.state == nil {
+		return []byte("null"), nil
+	}
+	value, err := l.Get()
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(value)
+}
+
+// UnmarshalLazyProto sets the value from a decoded protobuf submessage. The
+// request message is released after the handler returns, so the submessage
+// is converted at once rather than retained.
+func (l *Lazy[T]) UnmarshalLazyProto(msg protoreflect.Message) error {
+	value := new(T)
+	if err := reflectutil.ProtoToStruct(msg, value); err != nil {
+		return fmt.Errorf("failed to decode lazy field: %w", err)
+	}
+	*l = NewLazy(value)
+	return nil
+}
+
+// LazyValue returns the decoded value for encoding, or nil if the field is unset.
+func (l Lazy[T]) LazyValue() (any, error) {
+	value, err := l.Get()
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// LazyElemType returns the type of T, which determines the field's schema.
+func (Lazy[T]) LazyElemType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,192 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type LazyDocument struct {
+	Title string   `json:"title"`
+	Lines []string `json:"lines"`
+}
+
+type LazyIngestRequest struct {
+	ID       string                 `json:"id"`
+	Document rpc.Lazy[LazyDocument] `json:"document"`
+	Extra    rpc.Lazy[LazyDocument] `json:"extra"`
+}
+
+type LazyIngestResponse struct {
+	ID       string                 `json:"id"`
+	Title    string                 `json:"title"`
+	ExtraSet bool                   `json:"extra_set"`
+	Echo     rpc.Lazy[LazyDocument] `json:"echo"`
+}
+
+func newLazyServer(t *testing.T) (*rpc.Service, *httptest.Server) {
+	t.Helper()
+	svc := rpc.NewService("LazyService", rpc.WithPackage("lazy.v1"))
+	rpc.MustRegister(svc, "Ingest", func(ctx context.Context, req *LazyIngestRequest) (*LazyIngestResponse, error) {
+		doc, err := req.Document.Get()
+		if err != nil {
+			return nil, err
+		}
+		resp := &LazyIngestResponse{ID: req.ID, ExtraSet: req.Extra.IsSet()}
+		if doc != nil {
+			resp.Title = doc.Title
+			resp.Echo = rpc.NewLazy(&LazyDocument{Title: doc.Title + "!"})
+		}
+		return resp, nil
+	})
+
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+	return svc, server
+}
+
+func postLazy(t *testing.T, url, contentType string, body []byte) []byte {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Connect-Protocol-Version", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return data
+}
+
+func TestLazyFieldJSON(t *testing.T) {
+	_, server := newLazyServer(t)
+
+	body := postLazy(t, server.URL+"/lazy.v1.LazyService/Ingest", "application/json",
+		[]byte(`{"id":"1","document":{"title":"Report","lines":["a","b"]}}`))
+
+	var resp struct {
+		ID       string       `json:"id"`
+		Title    string       `json:"title"`
+		ExtraSet bool         `json:"extra_set"`
+		Echo     LazyDocument `json:"echo"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", body, err)
+	}
+	if resp.Title != "Report" || resp.ExtraSet || resp.Echo.Title != "Report!" {
+		t.Errorf("Unexpected response: %s", body)
+	}
+
+	t.Run("invalid subtree fails on access", func(t *testing.T) {
+		body := postLazy(t, server.URL+"/lazy.v1.LazyService/Ingest", "application/json",
+			[]byte(`{"id":"1","document":{"title":42}}`))
+		if !strings.Contains(string(body), "invalid_argument") {
+			t.Errorf("Expected invalid_argument, got %s", body)
+		}
+	})
+}
+
+func TestLazyFieldProtobuf(t *testing.T) {
+	svc, server := newLazyServer(t)
+
+	files, err := protodesc.NewFiles(svc.GetFileDescriptorSet())
+	if err != nil {
+		t.Fatalf("Failed to build descriptors: %v", err)
+	}
+	find := func(name string) protoreflect.MessageDescriptor {
+		desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			t.Fatalf("Failed to find %s: %v", name, err)
+		}
+		return desc.(protoreflect.MessageDescriptor)
+	}
+
+	// The lazy field has the schema of its element type
+	reqDesc := find("lazy.v1.LazyIngestRequest")
+	docField := reqDesc.Fields().ByName("document")
+	if docField == nil || docField.Message() == nil || docField.Message().FullName() != "lazy.v1.LazyDocument" {
+		t.Fatalf("Expected document to be a LazyDocument message, got %v", docField)
+	}
+
+	req := dynamicpb.NewMessage(reqDesc)
+	req.Set(reqDesc.Fields().ByName("id"), protoreflect.ValueOfString("1"))
+	doc := dynamicpb.NewMessage(docField.Message())
+	doc.Set(docField.Message().Fields().ByName("title"), protoreflect.ValueOfString("Report"))
+	req.Set(docField, protoreflect.ValueOfMessage(doc))
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	body := postLazy(t, server.URL+"/lazy.v1.LazyService/Ingest", "application/proto", data)
+
+	respDesc := find("lazy.v1.LazyIngestResponse")
+	resp := dynamicpb.NewMessage(respDesc)
+	if err := proto.Unmarshal(body, resp); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %v", body, err)
+	}
+	if got := resp.Get(respDesc.Fields().ByName("title")).String(); got != "Report" {
+		t.Errorf("Expected title Report, got %q", got)
+	}
+	echo := resp.Get(respDesc.Fields().ByName("echo")).Message()
+	if got := echo.Get(echo.Descriptor().Fields().ByName("title")).String(); got != "Report!" {
+		t.Errorf("Expected encoded lazy response field, got %q", got)
+	}
+}
+
+type LazyJob struct {
+	Timeout time.Duration `json:"timeout"`
+	Size    int64         `json:"size"`
+}
+
+type LazyJobRequest struct {
+	Job rpc.Lazy[LazyJob] `json:"job"`
+}
+
+func TestLazyFieldDurationsAndInt64(t *testing.T) {
+	svc := rpc.NewService("LazyJobService", rpc.WithPackage("lazy.v1"), rpc.WithJSONInt64(codec.JSONInt64String))
+	rpc.MustRegister(svc, "Run", func(_ context.Context, req *LazyJobRequest) (*LazyJob, error) {
+		job, err := req.Job.Get()
+		if err != nil {
+			return nil, err
+		}
+		return job, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+
+	body := postLazy(t, server.URL+"/lazy.v1.LazyJobService/Run", "application/json",
+		[]byte(`{"job":{"timeout":"1.5s","size":"9007199254740993"}}`))
+	if want := `{"timeout":"1.500s","size":"9007199254740993"}`; strings.TrimSpace(string(body)) != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+}
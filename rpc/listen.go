@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listen address schemes
+const (
+	unixScheme      = "unix://"
+	systemdScheme   = "systemd://"
+	staleSocketDial = time.Second // Time to tell stale unix sockets from live ones
+)
+
+// Environment of systemd socket activation, see sd_listen_fds(3)
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd
+// (SD_LISTEN_FDS_START).
+var systemdFirstFD = 3
+
+// Listen announces on addr, one of:
+//
+//   - "host:port", a TCP address such as ":8080"
+//   - "unix:///run/app.sock", a Unix domain socket, or "unix://@app" for an
+//     abstract socket on Linux. A stale socket file left by a previous
+//     process is replaced.
+//   - "systemd://" or "systemd://name", a socket passed by systemd socket
+//     activation: the first one, or the one named with FileDescriptorName=.
+//
+// Run, ListenAndServe, and the hyperway serve command accept the same
+// addresses; use Listen to serve a server created by NewServer:
+//
+//	lis, err := rpc.Listen("unix:///run/billing.sock")
+//	err = server.Serve(lis)
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixScheme):
+		return listenUnix(strings.TrimPrefix(addr, unixScheme))
+	case strings.HasPrefix(addr, systemdScheme):
+		return listenSystemd(strings.TrimPrefix(addr, systemdScheme))
+	default:
+		return (&net.ListenConfig{}).Listen(context.Background(), "tcp", addr)
+	}
+}
+
+// isTCPAddr reports whether Listen announces on addr over TCP.
+func isTCPAddr(addr string) bool {
+	return !strings.HasPrefix(addr, unixScheme) && !strings.HasPrefix(addr, systemdScheme)
+}
+
+// listenUnix listens on the Unix domain socket at path, removing a stale
+// socket file nobody accepts connections on.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("unix socket path is empty")
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		dialer := &net.Dialer{Timeout: staleSocketDial}
+		if conn, err := dialer.DialContext(context.Background(), "unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket: %w", err)
+		}
+	}
+	return (&net.ListenConfig{}).Listen(context.Background(), "unix", path)
+}
+
+// listenSystemd returns the socket passed by systemd with name, or the first
+// one if name is empty.
+func listenSystemd(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv(listenPIDEnv)); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	count, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	if err != nil || count <= 0 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	names := strings.Split(os.Getenv(listenFDNamesEnv), ":")
+
+	index := 0
+	if name != "" {
+		index = -1
+		for i, n := range names {
+			if n == name && i < count {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+		}
+	}
+
+	file := os.NewFile(uintptr(systemdFirstFD+index), name)
+	defer func() { _ = file.Close() }() // The listener holds a duplicate
+	lis, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket %d is not a listening socket: %w", systemdFirstFD+index, err)
+	}
+	return lis, nil
+}
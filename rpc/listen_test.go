@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListen(t *testing.T) {
+	get := func(t *testing.T, network, addr string) string {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+		resp, err := client.Get("http://hyperway/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	hello := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+
+	t.Run("serves unix sockets", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hyperway.sock")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- Run(ctx, unixScheme+path, hello) }()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(path); err == nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if body := get(t, "unix", path); body != "hello" {
+			t.Errorf("Expected hello, got %q", body)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Expected a graceful shutdown, got %v", err)
+		}
+
+		lis, err := Listen(unixScheme + path)
+		if err != nil {
+			t.Fatalf("Expected the socket to be reusable, got %v", err)
+		}
+		_ = lis.Close()
+	})
+
+	t.Run("replaces stale unix sockets only", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "stale.sock")
+		lis, err := Listen(unixScheme + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Listen(unixScheme + path); err == nil || !strings.Contains(err.Error(), "in use") {
+			t.Errorf("Expected a socket in use to fail, got %v", err)
+		}
+		lis.(*net.UnixListener).SetUnlinkOnClose(false)
+		_ = lis.Close()
+		lis, err = Listen(unixScheme + path)
+		if err != nil {
+			t.Fatalf("Expected the stale socket to be replaced, got %v", err)
+		}
+		_ = lis.Close()
+	})
+
+	t.Run("serves systemd sockets", func(t *testing.T) {
+		tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = tcp.Close() }()
+		file, err := tcp.File()
+		if err != nil {
+			t.Skipf("Sockets can't be passed as files: %v", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		// The socket is passed second, after a socket named "metrics"
+		first := systemdFirstFD
+		systemdFirstFD = int(file.Fd()) - 1
+		t.Cleanup(func() { systemdFirstFD = first })
+		t.Setenv(listenPIDEnv, strconv.Itoa(os.Getpid()))
+		t.Setenv(listenFDsEnv, "2")
+		t.Setenv(listenFDNamesEnv, "metrics:api")
+
+		if _, err := Listen(systemdScheme + "admin"); err == nil {
+			t.Error("Expected an unknown socket name to fail")
+		}
+		lis, err := Listen(systemdScheme + "api")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		server := &http.Server{Handler: hello, ReadHeaderTimeout: time.Second}
+		go func() { _ = server.Serve(lis) }()
+		defer func() { _ = server.Close() }()
+		if body := get(t, "tcp", tcp.Addr().String()); body != "hello" {
+			t.Errorf("Expected hello, got %q", body)
+		}
+
+		t.Setenv(listenPIDEnv, "1")
+		if _, err := Listen(systemdScheme); err == nil {
+			t.Error("Expected sockets passed to another process to be ignored")
+		}
+	})
+}
@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Pushback headers of rejected calls
+const (
+	// RetryPushbackHeader tells clients how many milliseconds to wait before
+	// retrying a call, or not to retry it if negative, as in gRPC.
+	RetryPushbackHeader = "Grpc-Retry-Pushback-Ms"
+	retryAfterHeader    = "Retry-After"
+)
+
+// defaultPushback is the default time clients are asked to wait before
+// retrying a shed call.
+const defaultPushback = time.Second
+
+// Adaptive load shedding defaults
+const (
+	// defaultMaxCPU is the CPU utilization above which calls are shed.
+	defaultMaxCPU = 0.9
+	// sheddableLoad is the fraction of the limits above which sheddable
+	// calls are shed, leaving the headroom to other calls.
+	sheddableLoad = 0.8
+	// queueLatencyWindow is how long a queue latency measurement lasts
+	// without new ones, so that shedding every call does not freeze it.
+	queueLatencyWindow = time.Second
+	// queueLatencyWeight is the weight of past measurements in the average
+	// queue latency, out of queueLatencyWeight+1.
+	queueLatencyWeight = 7
+)
+
+// Priority is the priority of a method's calls under load shedding.
+type Priority int
+
+const (
+	// PrioritySheddable calls are shed first, once the service reaches 80%
+	// of its limits, e.g. prefetching or batch jobs.
+	PrioritySheddable Priority = -1
+	// PriorityDefault calls are shed once the service reaches its limits.
+	PriorityDefault Priority = 0
+	// PriorityCritical calls are only shed past MaxInFlight or by the
+	// Overloaded function, e.g. health checks or checkouts.
+	PriorityCritical Priority = 1
+)
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case PrioritySheddable:
+		return "sheddable"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "default"
+	}
+}
+
+// loadThreshold returns the fraction of the limits above which calls of the
+// priority are shed.
+func (p Priority) loadThreshold() float64 {
+	switch {
+	case p < PriorityDefault:
+		return sheddableLoad
+	case p > PriorityDefault:
+		return math.Inf(1)
+	default:
+		return 1
+	}
+}
+
+// LoadShedReason identifies why a call was shed.
+type LoadShedReason string
+
+const (
+	// LoadShedMaxInFlight means the service was already handling MaxInFlight calls.
+	LoadShedMaxInFlight LoadShedReason = "max_in_flight"
+	// LoadShedOverloaded means the Overloaded function reported overload.
+	LoadShedOverloaded LoadShedReason = "overloaded"
+	// LoadShedQueueLatency means calls waited longer than MaxQueueLatency.
+	LoadShedQueueLatency LoadShedReason = "queue_latency"
+	// LoadShedCPU means the CPU utilization exceeded MaxCPU.
+	LoadShedCPU LoadShedReason = "cpu"
+)
+
+// LoadSheddingPolicy rejects calls while the service is overloaded, before
+// they are authenticated or decoded, so an overloaded server spends as
+// little as possible on calls it cannot serve.
+//
+// Besides the MaxInFlight hard limit, the service adapts to its utilization:
+// calls are shed early while admitted calls wait too long in the queues of
+// their method's concurrency limit, or while the CPU is busy. Calls are shed
+// by priority, see Priority and MethodBuilder.WithPriority: sheddable calls
+// at 80% of the limits, then default ones, while critical calls are only
+// shed past MaxInFlight.
+//
+// Shed calls fail with CodeUnavailable in every protocol, with a
+// google.rpc.RetryInfo detail, a Grpc-Retry-Pushback-Ms header (a trailer in
+// gRPC's trailers-only responses) and a Retry-After header telling clients
+// when to retry. Each call of a JSON-RPC batch is admitted on its own, and a
+// shed one gets an error response with the RetryInfo detail only. gRPC clients with a retry policy honor the pushback, and so
+// does NewWaitForReadyTransport.
+type LoadSheddingPolicy struct {
+	// MaxInFlight is the maximum number of calls the service handles
+	// concurrently, including open streams (0 for no limit)
+	MaxInFlight int
+	// MaxQueueLatency sheds calls while admitted calls wait longer than this
+	// for a slot of their method's concurrency limit on average, see
+	// ConcurrencyLimit (0 to ignore queue latency)
+	MaxQueueLatency time.Duration
+	// CPUUsage returns the CPU utilization of the server, from 0 to 1
+	// (optional). It is called for every call and must be fast, e.g. return
+	// a periodically sampled value.
+	CPUUsage func() float64
+	// MaxCPU is the CPU utilization above which calls are shed (default 0.9)
+	MaxCPU float64
+	// Overloaded reports overload from other signals, e.g. CPU usage or
+	// queue lengths (optional). It is called for every call and must be fast.
+	Overloaded func(r *http.Request) bool
+	// Pushback is how long clients should wait before retrying (default 1s,
+	// negative to tell clients not to retry)
+	Pushback time.Duration
+	// OnShed is called when a call is shed, e.g. to emit metrics.
+	OnShed func(LoadShedEvent)
+}
+
+// LoadShedEvent describes a shed call.
+type LoadShedEvent struct {
+	// Method is the name of the called method.
+	Method string
+	// Reason is why the call was shed.
+	Reason LoadShedReason
+	// InFlight is the number of calls being handled when it was shed.
+	InFlight int64
+	// Priority is the priority of the method.
+	Priority Priority
+}
+
+// WithLoadShedding rejects calls while the service is overloaded.
+func WithLoadShedding(policy LoadSheddingPolicy) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.LoadShedding = policy
+	}
+}
+
+// WithPriority sets the priority of the method's calls under load shedding.
+func (m *MethodBuilder) WithPriority(p Priority) *MethodBuilder {
+	m.method.Options.Priority = p
+	return m
+}
+
+// enabled reports whether the policy sheds any call.
+func (p *LoadSheddingPolicy) enabled() bool {
+	return p.MaxInFlight > 0 || p.MaxQueueLatency > 0 || p.CPUUsage != nil || p.Overloaded != nil
+}
+
+// admit reserves a slot for a call of method. It returns a function releasing
+// the slot, or an error with the pushback headers set on header if the call
+// is shed.
+func (s *Service) admit(header http.Header, r *http.Request, method *Method) (func(), *Error) {
+	policy := &s.options.LoadShedding
+	if !policy.enabled() {
+		return func() {}, nil
+	}
+
+	inFlight := s.inFlight.Add(1)
+	release := func() { s.inFlight.Add(-1) }
+	priority := method.Options.Priority
+	reason := s.shedReason(r, policy, priority, inFlight)
+	if reason == "" {
+		return release, nil
+	}
+	release()
+
+	if policy.OnShed != nil {
+		policy.OnShed(LoadShedEvent{Method: method.Name, Reason: reason, InFlight: inFlight - 1, Priority: priority})
+	}
+	setPushbackHeaders(header, policy.Pushback)
+	return nil, shedError(r, policy.Pushback)
+}
+
+// shedReason returns why a call of the given priority is shed while inFlight
+// calls are being handled, including it, or "" if it is admitted.
+func (s *Service) shedReason(r *http.Request, policy *LoadSheddingPolicy, priority Priority, inFlight int64) LoadShedReason {
+	threshold := priority.loadThreshold()
+	if policy.MaxInFlight > 0 {
+		// Every priority gets at least one slot
+		limit := max(int64(min(threshold, 1)*float64(policy.MaxInFlight)), 1)
+		if inFlight > limit {
+			return LoadShedMaxInFlight
+		}
+	}
+	if policy.MaxQueueLatency > 0 &&
+		float64(s.queueLatency.average()) > threshold*float64(policy.MaxQueueLatency) {
+		return LoadShedQueueLatency
+	}
+	if policy.CPUUsage != nil {
+		maxCPU := policy.MaxCPU
+		if maxCPU <= 0 {
+			maxCPU = defaultMaxCPU
+		}
+		// Critical calls do not need the CPU usage
+		if !math.IsInf(threshold, 1) && policy.CPUUsage() > threshold*maxCPU {
+			return LoadShedCPU
+		}
+	}
+	if policy.Overloaded != nil && policy.Overloaded(r) {
+		return LoadShedOverloaded
+	}
+	return ""
+}
+
+// shedError returns the error of a shed call, with a google.rpc.RetryInfo
+// detail unless clients are asked not to retry.
+func shedError(r *http.Request, pushback time.Duration) *Error {
+	err := NewErrorWithDetails(CodeUnavailable, "server overloaded, try again later")
+	if pushback == 0 {
+		pushback = defaultPushback
+	}
+	if pushback > 0 {
+		err.AddAnyDetail(&errdetails.RetryInfo{RetryDelay: durationpb.New(pushback)})
+	}
+	protocol := protocolConnect
+	if strings.Contains(r.Header.Get("Content-Type"), "grpc") {
+		protocol = protocolGRPC
+	}
+	return err.ToError(protocol)
+}
+
+// latencyAverage is a moving average of latencies, forgotten after
+// queueLatencyWindow without measurements.
+type latencyAverage struct {
+	nanos      atomic.Int64
+	measuredAt atomic.Int64
+}
+
+// observe adds a measured latency to the average.
+func (a *latencyAverage) observe(latency time.Duration) {
+	now := time.Now().UnixNano()
+	stale := now-a.measuredAt.Swap(now) > int64(queueLatencyWindow)
+	for {
+		old := a.nanos.Load()
+		next := int64(latency)
+		if !stale {
+			next = (old*queueLatencyWeight + next) / (queueLatencyWeight + 1)
+		}
+		if a.nanos.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// average returns the average latency, 0 if the last measurement is stale.
+func (a *latencyAverage) average() time.Duration {
+	if time.Now().UnixNano()-a.measuredAt.Load() > int64(queueLatencyWindow) {
+		return 0
+	}
+	return time.Duration(a.nanos.Load())
+}
+
+// setPushbackHeaders tells clients when to retry a shed call.
+func setPushbackHeaders(h http.Header, pushback time.Duration) {
+	if pushback == 0 {
+		pushback = defaultPushback
+	}
+	if pushback < 0 {
+		h.Set(RetryPushbackHeader, "-1")
+		return
+	}
+	h.Set(RetryPushbackHeader, strconv.FormatInt(pushback.Milliseconds(), 10))
+	// Retry-After has a resolution of seconds
+	h.Set(retryAfterHeader, strconv.FormatInt(int64((pushback+time.Second-1)/time.Second), 10))
+}
+
+// RetryPushback returns the time a server asked to wait before retrying a
+// call, from the Grpc-Retry-Pushback-Ms header of its response or trailers.
+// ok is false if the server sent no pushback, and retry is false if it asked
+// not to retry.
+func RetryPushback(resp *http.Response) (delay time.Duration, retry, ok bool) {
+	value := resp.Header.Get(RetryPushbackHeader)
+	if value == "" {
+		value = resp.Trailer.Get(RetryPushbackHeader)
+	}
+	if value == "" {
+		return 0, false, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		// Malformed or negative pushback means don't retry
+		return 0, false, true
+	}
+	return time.Duration(ms) * time.Millisecond, true, true
+}
@@ -0,0 +1,308 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type QuoteRequest struct {
+	Symbol string `json:"symbol"`
+}
+
+type QuoteResponse struct {
+	Price float64 `json:"price"`
+}
+
+func TestLoadShedding(t *testing.T) {
+	var events []rpc.LoadShedEvent
+	var overloaded atomic.Bool
+	started, unblock := make(chan struct{}), make(chan struct{})
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"),
+		rpc.WithLoadShedding(rpc.LoadSheddingPolicy{
+			MaxInFlight: 1,
+			Overloaded:  func(*http.Request) bool { return overloaded.Load() },
+			Pushback:    1500 * time.Millisecond,
+			OnShed:      func(e rpc.LoadShedEvent) { events = append(events, e) },
+		}))
+	rpc.MustRegister(svc, "Get", func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		if req.Symbol == "block" {
+			close(started)
+			<-unblock
+		}
+		return &QuoteResponse{Price: 1.5}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/quote.v1.QuoteService/Get", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if contentType == "application/json" {
+			req.Header.Set("Connect-Protocol-Version", "1")
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Occupy the only slot
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call("application/json", `{"symbol":"block"}`)
+	}()
+	<-started
+
+	rec := call("application/json", `{"symbol":"go"}`)
+	if !strings.Contains(rec.Body.String(), `"code":"unavailable"`) {
+		t.Errorf("Expected a Connect unavailable error, got %s", rec.Body)
+	}
+	if got := rec.Header().Get(rpc.RetryPushbackHeader); got != "1500" {
+		t.Errorf("pushback = %q, want 1500", got)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	rec = call("application/grpc+json", "\x00\x00\x00\x00\x02{}")
+	if rec.Header().Get("Grpc-Status") != "14" || rec.Header().Get(rpc.RetryPushbackHeader) != "1500" {
+		t.Errorf("Expected UNAVAILABLE with pushback, got %v", rec.Header())
+	}
+
+	close(unblock)
+	<-done
+	if rec := call("application/json", `{"symbol":"go"}`); !strings.Contains(rec.Body.String(), `"price":1.5`) {
+		t.Errorf("Expected the call to succeed once the slot is free, got %s", rec.Body)
+	}
+
+	overloaded.Store(true)
+	if rec := call("application/json", `{}`); rec.Header().Get(rpc.RetryPushbackHeader) == "" {
+		t.Errorf("Expected the call to be shed while overloaded, got %s", rec.Body)
+	}
+
+	want := []rpc.LoadShedReason{rpc.LoadShedMaxInFlight, rpc.LoadShedMaxInFlight, rpc.LoadShedOverloaded}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, e := range events {
+		if e.Reason != want[i] || e.Method != "Get" {
+			t.Errorf("event %d = %+v, want reason %s", i, e, want[i])
+		}
+	}
+}
+
+func TestAdaptiveLoadShedding(t *testing.T) {
+	var (
+		cpu    atomic.Value
+		events []rpc.LoadShedEvent
+	)
+	cpu.Store(0.0)
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"),
+		rpc.WithConcurrencyLimit(rpc.ConcurrencyLimit{MaxConcurrent: 1, MaxQueued: 1}),
+		rpc.WithLoadShedding(rpc.LoadSheddingPolicy{
+			MaxQueueLatency: 2 * time.Millisecond,
+			CPUUsage:        func() float64 { return cpu.Load().(float64) },
+			OnShed:          func(e rpc.LoadShedEvent) { events = append(events, e) },
+		}))
+	quote := func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		return &QuoteResponse{Price: 1}, nil
+	}
+	rpc.MustRegister(svc, "Get", quote)
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Prefetch", quote).WithPriority(rpc.PrioritySheddable))
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Checkout", quote).WithPriority(rpc.PriorityCritical))
+	rpc.MustRegister(svc, "Slow", func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		started <- struct{}{}
+		<-unblock
+		return &QuoteResponse{Price: 2}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/quote.v1.QuoteService/"+method, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	shed := func(method string) bool {
+		return strings.Contains(call(method).Body.String(), `"code":"unavailable"`)
+	}
+
+	t.Run("CPU sheds by priority", func(t *testing.T) {
+		cpu.Store(0.8)
+		if !shed("Prefetch") || shed("Get") || shed("Checkout") {
+			t.Error("Expected only sheddable calls to be shed at 80% CPU")
+		}
+		cpu.Store(0.95)
+		if !shed("Prefetch") || !shed("Get") || shed("Checkout") {
+			t.Error("Expected all but critical calls to be shed past MaxCPU")
+		}
+		cpu.Store(0.0)
+		if shed("Prefetch") {
+			t.Error("Expected calls to be admitted once the CPU is idle")
+		}
+	})
+
+	t.Run("shed calls carry RetryInfo", func(t *testing.T) {
+		cpu.Store(1.0)
+		defer cpu.Store(0.0)
+		rec := call("Get")
+		if !strings.Contains(rec.Body.String(), `"type":"google.rpc.RetryInfo"`) || rec.Header().Get(rpc.RetryPushbackHeader) != "1000" {
+			t.Errorf("Expected a RetryInfo detail and a pushback, got %v: %s", rec.Header(), rec.Body)
+		}
+	})
+
+	t.Run("queue latency", func(t *testing.T) {
+		done := make(chan struct{})
+		for range 2 {
+			go func() {
+				call("Slow")
+				done <- struct{}{}
+			}()
+		}
+		<-started
+		for svc.ConcurrencyStats()["Slow"].Queued == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(40 * time.Millisecond)
+		close(unblock)
+		<-done
+		<-done
+
+		if !shed("Get") || shed("Checkout") {
+			t.Error("Expected all but critical calls to be shed while calls queue too long")
+		}
+	})
+
+	events = events[len(events)-1:]
+	if e := events[0]; e.Reason != rpc.LoadShedQueueLatency || e.Method != "Get" || e.Priority != rpc.PriorityDefault {
+		t.Errorf("Expected a queue latency event for Get, got %+v", e)
+	}
+}
+
+func TestJSONRPCLoadShedding(t *testing.T) {
+	var cpu atomic.Value
+	cpu.Store(0.85)
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"),
+		rpc.WithJSONRPC("/jsonrpc"),
+		rpc.WithLoadShedding(rpc.LoadSheddingPolicy{
+			CPUUsage: func() float64 { return cpu.Load().(float64) },
+		}))
+	quote := func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		return &QuoteResponse{Price: 1}, nil
+	}
+	rpc.MustRegister(svc, "Get", quote)
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Prefetch", quote).WithPriority(rpc.PrioritySheddable))
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Each call of a batch is shed by the priority of its method
+	rec := call(`[
+		{"jsonrpc": "2.0", "method": "Prefetch", "params": {}, "id": 1},
+		{"jsonrpc": "2.0", "method": "Get", "params": {}, "id": 2}
+	]`)
+	var responses []rpc.JSONRPCResponse
+	if err := json.NewDecoder(rec.Body).Decode(&responses); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	if len(responses) != 2 || responses[0].Error == nil || responses[1].Error != nil {
+		t.Fatalf("Expected only the sheddable call to be shed, got %+v", responses)
+	}
+	if e := responses[0].Error; e.Code != rpc.JSONRPCServerError || e.Message != "server overloaded, try again later" {
+		t.Errorf("Unexpected error of the shed call: %+v", e)
+	}
+	if data, _ := json.Marshal(responses[0].Error.Data); !strings.Contains(string(data), "google.rpc.RetryInfo") {
+		t.Errorf("Expected a RetryInfo detail, got %s", data)
+	}
+
+	// Single calls also get the pushback headers
+	cpu.Store(0.95)
+	rec = call(`{"jsonrpc": "2.0", "method": "Get", "params": {}, "id": 1}`)
+	if !strings.Contains(rec.Body.String(), "server overloaded") || rec.Header().Get(rpc.RetryPushbackHeader) != "1000" {
+		t.Errorf("Expected the call to be shed with a pushback, got %v: %s", rec.Header(), rec.Body)
+	}
+}
+
+func TestWaitForReadyTransport(t *testing.T) {
+	var shed atomic.Int32
+	shed.Store(2)
+	svc := rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"),
+		rpc.WithLoadShedding(rpc.LoadSheddingPolicy{
+			Overloaded: func(*http.Request) bool { return shed.Add(-1) >= 0 },
+			Pushback:   10 * time.Millisecond,
+		}))
+	rpc.MustRegister(svc, "Get", func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		return &QuoteResponse{Price: 2}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	post := func(client *http.Client) *http.Response {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			server.URL+"/quote.v1.QuoteService/Get", strings.NewReader(`{"symbol":"go"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	client := &http.Client{Transport: rpc.NewWaitForReadyTransport(nil)}
+	if resp := post(client); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the call to wait until the server is ready, got %d", resp.StatusCode)
+	}
+	if n := shed.Load(); n >= 0 {
+		t.Errorf("Expected two shed attempts, %d left", n)
+	}
+
+	// Servers asking not to retry fail the call right away
+	svc = rpc.NewService("QuoteService", rpc.WithPackage("quote.v1"),
+		rpc.WithLoadShedding(rpc.LoadSheddingPolicy{
+			Overloaded: func(*http.Request) bool { return true },
+			Pushback:   -1,
+		}))
+	rpc.MustRegister(svc, "Get", func(_ context.Context, req *QuoteRequest) (*QuoteResponse, error) {
+		return &QuoteResponse{}, nil
+	})
+	if gw, err = rpc.NewGateway(svc); err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server.Config.Handler = gw
+	if resp := post(client); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without retries, got %d", resp.StatusCode)
+	}
+}
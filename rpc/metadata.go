@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+)
+
+// MD is a set of call metadata: request or response headers, or trailers.
+// Like gRPC metadata, keys are lower-case, whatever the protocol of the call,
+// and values of binary keys, ending in "-bin", are raw bytes: they are
+// base64-encoded on the wire.
+type MD map[string][]string
+
+// Pairs returns the metadata of key/value pairs, with repeated keys keeping
+// all their values. It panics on an odd number of strings.
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic(fmt.Sprintf("rpc.Pairs: odd number of strings: %d", len(kv)))
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md.Append(kv[i], kv[i+1])
+	}
+	return md
+}
+
+// Get returns the values of key.
+func (md MD) Get(key string) []string {
+	return md[strings.ToLower(key)]
+}
+
+// Set replaces the values of key.
+func (md MD) Set(key string, values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	md[strings.ToLower(key)] = values
+}
+
+// Append adds values to key.
+func (md MD) Append(key string, values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	key = strings.ToLower(key)
+	md[key] = append(md[key], values...)
+}
+
+// Len returns the number of keys.
+func (md MD) Len() int {
+	return len(md)
+}
+
+// Copy returns a copy of md.
+func (md MD) Copy() MD {
+	out := make(MD, len(md))
+	for key, values := range md {
+		out[key] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// Metadata is the metadata of a call, the same for all protocols: the
+// incoming request headers, the peer, and the outgoing headers and trailers,
+// sent as HTTP trailers over gRPC and gRPC-Web and as "Trailer-" headers or
+// end-of-stream metadata over Connect.
+type Metadata struct {
+	hctx *handlerContext
+}
+
+// Meta returns the metadata of the call handled with ctx. Outside of a call,
+// as in unit tests of handlers, the metadata is empty and its setters do
+// nothing.
+func Meta(ctx context.Context) Metadata {
+	return Metadata{hctx: GetHandlerContext(ctx)}
+}
+
+// Incoming returns a copy of the request headers.
+func (m Metadata) Incoming() MD {
+	md := make(MD)
+	if m.hctx == nil {
+		return md
+	}
+	for key, values := range m.hctx.requestHeaders {
+		md.Append(key, decodeValues(key, values)...)
+	}
+	return md
+}
+
+// Get returns the first value of a request header, or "".
+func (m Metadata) Get(key string) string {
+	if values := m.Values(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns the values of a request header.
+func (m Metadata) Values(key string) []string {
+	if m.hctx == nil {
+		return nil
+	}
+	return decodeValues(key, m.hctx.GetRequestHeader(http.CanonicalHeaderKey(key)))
+}
+
+// Protocol returns the protocol of the call: "connect", "grpc", "grpc-web",
+// "jsonrpc", or "http" for plain HTTP requests.
+func (m Metadata) Protocol() string {
+	if m.hctx == nil {
+		return ""
+	}
+	return m.hctx.protocol
+}
+
+// Procedure returns the procedure of the call, e.g.
+// "/user.v1.UserService/GetUser".
+func (m Metadata) Procedure() string {
+	if m.hctx == nil {
+		return ""
+	}
+	return m.hctx.procedure
+}
+
+// Peer returns the network address of the connection, "host:port", which is
+// the last proxy for requests forwarded by proxies.
+func (m Metadata) Peer() string {
+	if m.hctx == nil {
+		return ""
+	}
+	return m.hctx.peer
+}
+
+// ClientIP returns the IP address of the client, read from the proxy headers
+// of requests forwarded by gateway.Options.TrustedProxies, see gateway.Peer.
+func (m Metadata) ClientIP() string {
+	if m.hctx == nil {
+		return ""
+	}
+	return m.hctx.clientIP
+}
+
+// Authority returns the host the call was sent to, the ":authority" of
+// HTTP/2 requests.
+func (m Metadata) Authority() string {
+	if m.hctx == nil {
+		return ""
+	}
+	return m.hctx.authority
+}
+
+// SetHeader adds md to the response headers, base64-encoding binary values. Headers are sent with the first
+// message of a stream, so setting them later has no effect.
+func (m Metadata) SetHeader(md MD) {
+	if m.hctx == nil {
+		return
+	}
+	for key, values := range md {
+		for _, value := range values {
+			m.hctx.SetResponseHeader(key, value)
+		}
+	}
+}
+
+// SetTrailer adds md to the response trailers, base64-encoding binary values.
+func (m Metadata) SetTrailer(md MD) {
+	if m.hctx == nil {
+		return
+	}
+	for key, values := range md {
+		for _, value := range values {
+			m.hctx.SetResponseTrailer(key, value)
+		}
+	}
+}
+
+// decodeValues decodes the base64 values of binary keys. A header may carry
+// several comma-separated values; values that are not valid base64 are kept
+// as sent.
+func decodeValues(key string, values []string) []string {
+	if !grpcutil.IsBinaryKey(key) || len(values) == 0 {
+		return values
+	}
+	decoded := make([]string, 0, len(values))
+	for _, value := range values {
+		for part := range strings.SplitSeq(value, ",") {
+			part = strings.TrimSpace(part)
+			if raw, err := grpcutil.DecodeBinary(part); err == nil {
+				part = raw
+			}
+			decoded = append(decoded, part)
+		}
+	}
+	return decoded
+}
@@ -0,0 +1,154 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type CallerRequest struct{}
+
+type CallerResponse struct {
+	Client    string `json:"client"`
+	Protocol  string `json:"protocol"`
+	Procedure string `json:"procedure"`
+	Peer      string `json:"peer"`
+	ClientIP  string `json:"client_ip"`
+	Authority string `json:"authority"`
+}
+
+func TestMeta(t *testing.T) {
+	svc := rpc.NewService("CallerService", rpc.WithPackage("meta.v1"), rpc.WithJSONRPC("/jsonrpc"))
+	rpc.MustRegister(svc, "Describe", func(ctx context.Context, _ *CallerRequest) (*CallerResponse, error) {
+		md := rpc.Meta(ctx)
+		md.SetHeader(rpc.Pairs("X-Served-By", "meta"))
+		md.SetTrailer(rpc.Pairs("x-cost", "1", "x-cost", "2"))
+		return &CallerResponse{
+			Client:    md.Get("x-client"),
+			Protocol:  md.Protocol(),
+			Procedure: md.Procedure(),
+			Peer:      md.Peer(),
+			ClientIP:  md.ClientIP(),
+			Authority: md.Authority(),
+		}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(t *testing.T, path, body string, connect bool) (*httptest.ResponseRecorder, CallerResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Host = "api.example.com"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Client", "cli/1.0")
+		if connect {
+			req.Header.Set("Connect-Protocol-Version", "1")
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		var resp CallerResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %s: %v", rec.Body, err)
+		}
+		return rec, resp
+	}
+
+	t.Run("Connect", func(t *testing.T) {
+		rec, resp := call(t, "/meta.v1.CallerService/Describe", `{}`, true)
+		want := CallerResponse{
+			Client:    "cli/1.0",
+			Protocol:  "connect",
+			Procedure: "/meta.v1.CallerService/Describe",
+			Peer:      "192.0.2.1:1234",
+			ClientIP:  "192.0.2.1",
+			Authority: "api.example.com",
+		}
+		if resp != want {
+			t.Errorf("Expected %+v, got %+v", want, resp)
+		}
+		if got := rec.Header().Get("X-Served-By"); got != "meta" {
+			t.Errorf("Expected the header set with Meta, got %q", got)
+		}
+		if got := rec.Header().Values("Trailer-X-Cost"); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+			t.Errorf("Expected both trailer values, got %v", got)
+		}
+	})
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		if _, resp := call(t, "/meta.v1.CallerService/Describe", `{}`, false); resp.Protocol != "http" || resp.Client != "cli/1.0" {
+			t.Errorf("Unexpected metadata %+v", resp)
+		}
+	})
+
+	t.Run("JSON-RPC", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(`{"jsonrpc":"2.0","method":"Describe","params":{},"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Client", "cli/1.0")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		var resp struct {
+			Result CallerResponse `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %s: %v", rec.Body, err)
+		}
+		if resp.Result.Protocol != "jsonrpc" || resp.Result.Client != "cli/1.0" {
+			t.Errorf("Unexpected metadata %+v", resp.Result)
+		}
+	})
+
+	t.Run("binary metadata", func(t *testing.T) {
+		svc := rpc.NewService("BinaryService", rpc.WithPackage("meta.v1"))
+		rpc.MustRegister(svc, "Echo", func(ctx context.Context, _ *CallerRequest) (*CallerResponse, error) {
+			md := rpc.Meta(ctx)
+			md.SetHeader(rpc.Pairs("x-echo-bin", md.Get("x-token-bin")))
+			md.SetTrailer(rpc.Pairs("x-parts-bin", strings.Join(md.Values("x-parts-bin"), "|")))
+			return &CallerResponse{}, nil
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/meta.v1.BinaryService/Echo", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		req.Header.Set("X-Token-Bin", "AQI=")   // Padded
+		req.Header.Set("X-Parts-Bin", "YQ, Yg") // Comma-separated values
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Echo-Bin"); got != "AQI" {
+			t.Errorf("Expected the decoded value re-encoded without padding, got %q", got)
+		}
+		if got := rec.Header().Get("Trailer-X-Parts-Bin"); got != "YXxi" {
+			t.Errorf("Expected the base64 of \"a|b\", got %q", got)
+		}
+	})
+
+	t.Run("outside of a call", func(t *testing.T) {
+		md := rpc.Meta(context.Background())
+		md.SetHeader(rpc.Pairs("x-ignored", "1"))
+		if md.Get("x-client") != "" || md.Protocol() != "" || md.Incoming().Len() != 0 {
+			t.Error("Expected empty metadata outside of a call")
+		}
+	})
+}
+
+func TestMD(t *testing.T) {
+	md := rpc.Pairs("X-Tenant", "a", "x-tenant", "b")
+	md.Set("X-Region", "eu")
+	if got := md.Get("x-tenant"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected both values under a lower-case key, got %v", got)
+	}
+	copied := md.Copy()
+	copied.Append("x-region", "us")
+	if len(md.Get("X-Region")) != 1 || len(copied.Get("x-region")) != 2 {
+		t.Errorf("Expected Copy to be independent, got %v and %v", md, copied)
+	}
+}
@@ -0,0 +1,421 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Defaults of MockOptions
+const (
+	defaultMockStreamMessages = 3
+	defaultMockMaxRepeated    = 3
+	defaultMockMaxDepth       = 3
+	mockNumberRange           = 1000
+	mockBytesLength           = 8
+	mockEpoch                 = 1704067200      // 2024-01-01T00:00:00Z, the earliest generated timestamp
+	mockTimeRange             = 365 * 24 * 3600 // Seconds after mockEpoch
+	mockCentsPerUnit          = 100
+)
+
+// MockOptions configures the responses of mock services.
+type MockOptions struct {
+	// Responses are canned responses in protobuf JSON by method, as
+	// "pkg.Service/Method". A server-streaming method sends each element of
+	// a JSON array, or a single object. Other methods get generated responses.
+	Responses map[string]string
+	// Errors are returned by methods, as "pkg.Service/Method", instead of
+	// responses.
+	Errors map[string]*Error
+	// Seed makes generated responses reproducible: the same seed and calls
+	// give the same responses. Zero picks a random seed.
+	Seed uint64
+	// Latency delays every response and every message of a stream.
+	Latency time.Duration
+	// StreamMessages is the number of generated messages of server streams (default: 3).
+	StreamMessages int
+	// MaxRepeated is the maximum number of elements of generated repeated
+	// and map fields (default: 3).
+	MaxRepeated int
+	// MaxDepth bounds the nesting of generated messages (default: 3). Message
+	// fields deeper than that are left unset.
+	MaxDepth int
+	// ServiceOptions are applied to every service, e.g. WithReflection(true).
+	ServiceOptions []ServiceOption
+}
+
+// NewMockService creates a service for every service of fdset whose methods
+// return canned or generated responses that are valid for the schema, for
+// frontend development and contract tests before the real handlers exist:
+//
+//	services, err := rpc.NewMockService(fdset, rpc.MockOptions{
+//		Responses: map[string]string{"user.v1.UserService/GetUser": `{"id":"1","name":"Ann"}`},
+//		Seed:      1,
+//	})
+//	handler, err := rpc.NewGateway(services...)
+//
+// Unary and server-streaming methods are mocked. Well-known types may be left
+// out of fdset.
+func NewMockService(fdset *descriptorpb.FileDescriptorSet, opts MockOptions) ([]*Service, error) {
+	files, err := mockFiles(fdset)
+	if err != nil {
+		return nil, err
+	}
+	gen := newMockGenerator(opts, dynamicpb.NewTypes(files))
+	known := make(map[string]bool)
+
+	var services []*Service
+	for _, file := range fdset.GetFile() {
+		fd, err := files.FindFileByPath(file.GetName())
+		if err != nil {
+			return nil, err
+		}
+		for i := range fd.Services().Len() {
+			sd := fd.Services().Get(i)
+			svc := NewServiceFromDescriptor(sd, opts.ServiceOptions...)
+			for j := range sd.Methods().Len() {
+				md := sd.Methods().Get(j)
+				key := fmt.Sprintf("%s/%s", sd.FullName(), md.Name())
+				known[key] = true
+				if err := registerMock(svc, md, key, gen, opts); err != nil {
+					return nil, err
+				}
+			}
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return nil, errors.New("mock: the descriptor set defines no services")
+	}
+	for _, keys := range []map[string]string{opts.Responses, errorKeys(opts.Errors)} {
+		for key := range keys {
+			if !known[key] {
+				return nil, fmt.Errorf("mock: no method %s", key)
+			}
+		}
+	}
+	return services, nil
+}
+
+// errorKeys returns the methods of errors.
+func errorKeys(errs map[string]*Error) map[string]string {
+	keys := make(map[string]string, len(errs))
+	for key := range errs {
+		keys[key] = ""
+	}
+	return keys
+}
+
+// registerMock registers the mock of md, named key in the options.
+func registerMock(svc *Service, md protoreflect.MethodDescriptor, key string, gen *mockGenerator, opts MockOptions) error {
+	canned, err := cannedResponses(md, opts.Responses[key], gen.resolver)
+	if err != nil {
+		return fmt.Errorf("mock: invalid response of %s: %w", key, err)
+	}
+	mockErr := opts.Errors[key]
+
+	switch {
+	case md.IsStreamingClient():
+		// Client and bidirectional streams can't be served by dynamic services
+		return nil
+	case md.IsStreamingServer():
+		return RegisterDynamicServerStream(svc, string(md.Name()), func(ctx context.Context, _ *dynamicpb.Message, stream ServerStream[dynamicpb.Message]) error {
+			if mockErr != nil {
+				if err := mockDelay(ctx, opts.Latency); err != nil {
+					return err
+				}
+				return mockErr
+			}
+			count := len(canned)
+			if canned == nil {
+				count = gen.streamMessages
+			}
+			for i := range count {
+				if err := mockDelay(ctx, opts.Latency); err != nil {
+					return err
+				}
+				msg := gen.message(md.Output())
+				if canned != nil {
+					msg = proto.CloneOf(canned[i])
+				}
+				if err := stream.Send(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return RegisterDynamic(svc, string(md.Name()), func(ctx context.Context, _ *dynamicpb.Message) (*dynamicpb.Message, error) {
+			if err := mockDelay(ctx, opts.Latency); err != nil {
+				return nil, err
+			}
+			if mockErr != nil {
+				return nil, mockErr
+			}
+			if canned != nil {
+				return proto.CloneOf(canned[0]), nil
+			}
+			return gen.message(md.Output()), nil
+		})
+	}
+}
+
+// cannedResponses parses the canned response of md: an object, or for server
+// streams an array of objects. It returns nil without a canned response.
+func cannedResponses(md protoreflect.MethodDescriptor, response string, resolver *dynamicpb.Types) ([]*dynamicpb.Message, error) {
+	if response == "" {
+		return nil, nil
+	}
+	objects := []json.RawMessage{json.RawMessage(response)}
+	if trimmed := strings.TrimSpace(response); strings.HasPrefix(trimmed, "[") {
+		if !md.IsStreamingServer() {
+			return nil, errors.New("only server streams send several messages")
+		}
+		if err := json.Unmarshal([]byte(trimmed), &objects); err != nil {
+			return nil, err
+		}
+	}
+	unmarshal := protojson.UnmarshalOptions{Resolver: resolver}
+	messages := make([]*dynamicpb.Message, len(objects))
+	for i, object := range objects {
+		messages[i] = dynamicpb.NewMessage(md.Output())
+		if err := unmarshal.Unmarshal(object, messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// mockDelay waits for latency, or returns the error of a call canceled
+// meanwhile.
+func mockDelay(ctx context.Context, latency time.Duration) error {
+	if latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return NewError(CodeDeadlineExceeded, ctx.Err().Error())
+	}
+}
+
+// mockFiles builds the files of fdset, whatever their order, with the
+// well-known types it leaves out.
+func mockFiles(fdset *descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	files := &protoregistry.Files{}
+	included := make(map[string]bool)
+	for _, file := range fdset.GetFile() {
+		included[file.GetName()] = true
+	}
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if strings.HasPrefix(fd.Path(), "google/protobuf/") && !included[fd.Path()] {
+			_ = files.RegisterFile(fd)
+		}
+		return true
+	})
+
+	pending := fdset.GetFile()
+	for len(pending) > 0 {
+		var next []*descriptorpb.FileDescriptorProto
+		var lastErr error
+		for _, file := range pending {
+			fd, err := protodesc.NewFile(file, files)
+			if err != nil {
+				next = append(next, file)
+				lastErr = fmt.Errorf("mock: invalid descriptor %s: %w", file.GetName(), err)
+				continue
+			}
+			if err := files.RegisterFile(fd); err != nil {
+				return nil, fmt.Errorf("mock: %w", err)
+			}
+		}
+		if len(next) == len(pending) {
+			return nil, lastErr
+		}
+		pending = next
+	}
+	return files, nil
+}
+
+// mockGenerator generates messages with random values valid for their
+// schema.
+type mockGenerator struct {
+	mu             sync.Mutex
+	rand           *rand.Rand
+	streamMessages int
+	maxRepeated    int
+	maxDepth       int
+	resolver       *dynamicpb.Types
+}
+
+func newMockGenerator(opts MockOptions, resolver *dynamicpb.Types) *mockGenerator {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64() //nolint:gosec // mock data does not need a secure source
+	}
+	g := &mockGenerator{
+		rand:           rand.New(rand.NewPCG(seed, seed)), //nolint:gosec // mock data does not need a secure source
+		streamMessages: defaultMockStreamMessages,
+		maxRepeated:    defaultMockMaxRepeated,
+		maxDepth:       defaultMockMaxDepth,
+		resolver:       resolver,
+	}
+	if opts.StreamMessages > 0 {
+		g.streamMessages = opts.StreamMessages
+	}
+	if opts.MaxRepeated > 0 {
+		g.maxRepeated = opts.MaxRepeated
+	}
+	if opts.MaxDepth > 0 {
+		g.maxDepth = opts.MaxDepth
+	}
+	return g
+}
+
+// message generates a message of type md.
+func (g *mockGenerator) message(md protoreflect.MessageDescriptor) *dynamicpb.Message {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	msg := dynamicpb.NewMessage(md)
+	g.fill(msg, 0)
+	return msg
+}
+
+// fill sets the fields of msg: every field but one of each oneof, and no
+// message fields below the maximum depth.
+func (g *mockGenerator) fill(msg protoreflect.Message, depth int) {
+	md := msg.Descriptor()
+	if g.wellKnown(msg) {
+		return
+	}
+	chosen := make(map[protoreflect.FullName]protoreflect.FieldDescriptor)
+	oneofs := md.Oneofs()
+	for i := range oneofs.Len() {
+		if oneof := oneofs.Get(i); !oneof.IsSynthetic() {
+			chosen[oneof.FullName()] = oneof.Fields().Get(g.rand.IntN(oneof.Fields().Len()))
+		}
+	}
+
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && chosen[oneof.FullName()] != fd {
+			continue
+		}
+		if g.isMessage(fd) && depth >= g.maxDepth {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			m := msg.Mutable(fd).Map()
+			for range 1 + g.rand.IntN(g.maxRepeated) {
+				key := g.scalar(fd.MapKey())
+				if g.isMessage(fd.MapValue()) {
+					value := m.NewValue()
+					g.fill(value.Message(), depth+1)
+					m.Set(key.MapKey(), value)
+					continue
+				}
+				m.Set(key.MapKey(), g.scalar(fd.MapValue()))
+			}
+		case fd.IsList():
+			list := msg.Mutable(fd).List()
+			for range 1 + g.rand.IntN(g.maxRepeated) {
+				if g.isMessage(fd) {
+					g.fill(list.AppendMutable().Message(), depth+1)
+					continue
+				}
+				list.Append(g.scalar(fd))
+			}
+		case g.isMessage(fd):
+			g.fill(msg.Mutable(fd).Message(), depth+1)
+		default:
+			msg.Set(fd, g.scalar(fd))
+		}
+	}
+}
+
+// isMessage reports whether fd holds messages.
+func (g *mockGenerator) isMessage(fd protoreflect.FieldDescriptor) bool {
+	return fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+}
+
+// scalar generates a value of a scalar field.
+func (g *mockGenerator) scalar(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	r := g.rand
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(r.IntN(2) == 1) //nolint:mnd // true or false
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(r.IntN(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(r.Int32N(mockNumberRange))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(r.Int64N(mockNumberRange))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(r.Uint32N(mockNumberRange))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(r.Uint64N(mockNumberRange))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(g.amount()))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(g.amount())
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(fmt.Sprintf("%s-%d", fd.Name(), r.IntN(mockNumberRange)))
+	case protoreflect.BytesKind:
+		b := make([]byte, mockBytesLength)
+		for i := range b {
+			b[i] = byte(r.Uint32())
+		}
+		return protoreflect.ValueOfBytes(b)
+	default:
+		return fd.Default()
+	}
+}
+
+// amount generates a number with two decimals.
+func (g *mockGenerator) amount() float64 {
+	return math.Round(g.rand.Float64()*mockNumberRange*mockCentsPerUnit) / mockCentsPerUnit
+}
+
+// wellKnown fills well-known types whose JSON form constrains their values,
+// and reports whether msg is one of them.
+func (g *mockGenerator) wellKnown(msg protoreflect.Message) bool {
+	fields := msg.Descriptor().Fields()
+	set := func(name string, value protoreflect.Value) {
+		msg.Set(fields.ByName(protoreflect.Name(name)), value)
+	}
+	switch msg.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		set("seconds", protoreflect.ValueOfInt64(mockEpoch+g.rand.Int64N(mockTimeRange)))
+	case "google.protobuf.Duration":
+		set("seconds", protoreflect.ValueOfInt64(g.rand.Int64N(mockNumberRange)))
+	case "google.protobuf.FieldMask":
+		msg.Mutable(fields.ByName("paths")).List().Append(protoreflect.ValueOfString("name"))
+	case "google.protobuf.Value":
+		set("string_value", protoreflect.ValueOfString(fmt.Sprintf("value-%d", g.rand.IntN(mockNumberRange))))
+	case "google.protobuf.Any", "google.protobuf.Struct", "google.protobuf.ListValue", "google.protobuf.Empty":
+		// Left empty: an Any needs a type, and structs are free-form
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// catalogFile describes a service whose messages have enums, oneofs, maps,
+// recursion, and well-known types.
+var catalogFile = func() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), Number: proto.Int32(number), JsonName: proto.String(name),
+			Type: typ.Enum(), Label: label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	price := field("price", 4, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, "", false)
+	price.OneofIndex = proto.Int32(0)
+	free := field("free", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL, "", false)
+	free.OneofIndex = proto.Int32(0)
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("catalog/v1/catalog.proto"),
+		Package:    proto.String("catalog.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("STATUS_ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("id", 1, str, "", false)}},
+			{
+				Name: proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, str, "", false),
+					field("status", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".catalog.v1.Status", false),
+					field("tags", 3, str, "", true),
+					price, free,
+					field("created_at", 6, msg, ".google.protobuf.Timestamp", false),
+					field("children", 7, msg, ".catalog.v1.Item", true),
+					field("labels", 8, msg, ".catalog.v1.Item.LabelsEntry", true),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("pricing")}},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name:    proto.String("LabelsEntry"),
+					Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, str, "", false), field("value", 2, str, "", false)},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("CatalogService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetItem"), InputType: proto.String(".catalog.v1.GetRequest"), OutputType: proto.String(".catalog.v1.Item")},
+				{Name: proto.String("ListItems"), InputType: proto.String(".catalog.v1.GetRequest"), OutputType: proto.String(".catalog.v1.Item"), ServerStreaming: proto.Bool(true)},
+				{Name: proto.String("DeleteItem"), InputType: proto.String(".catalog.v1.GetRequest"), OutputType: proto.String(".catalog.v1.Item")},
+				{Name: proto.String("Import"), InputType: proto.String(".catalog.v1.Item"), OutputType: proto.String(".catalog.v1.Item"), ClientStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+}()
+
+func TestMockService(t *testing.T) {
+	fdset := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{catalogFile}}
+	files := &protoregistry.Files{}
+	_ = files.RegisterFile(timestamppb.File_google_protobuf_timestamp_proto)
+	fd, err := protodesc.NewFile(catalogFile, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := fd.Messages().ByName("Item")
+
+	newGateway := func(t *testing.T, opts rpc.MockOptions) http.Handler {
+		t.Helper()
+		services, err := rpc.NewMockService(fdset, opts)
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		gw, err := rpc.NewGateway(services...)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	post := func(gw http.Handler, method string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/catalog.v1.CatalogService/"+method, strings.NewReader(`{"id":"1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("generates valid responses", func(t *testing.T) {
+		gw := newGateway(t, rpc.MockOptions{Seed: 1, MaxDepth: 2})
+		code, body := post(gw, "GetItem")
+		if code != http.StatusOK {
+			t.Fatalf("Expected a response, got %d: %s", code, body)
+		}
+		resp := dynamicpb.NewMessage(item)
+		if err := protojson.Unmarshal([]byte(body), resp); err != nil {
+			t.Fatalf("Expected an Item, got %s: %v", body, err)
+		}
+		fields := item.Fields()
+		if resp.Get(fields.ByName("id")).String() == "" || !resp.Has(fields.ByName("created_at")) {
+			t.Errorf("Expected fields to be set, got %s", body)
+		}
+		if resp.WhichOneof(item.Oneofs().ByName("pricing")) == nil {
+			t.Errorf("Expected a field of the oneof to be set, got %s", body)
+		}
+		if resp.Get(fields.ByName("labels")).Map().Len() == 0 {
+			t.Errorf("Expected map entries, got %s", body)
+		}
+
+		// Grandchildren are nested MaxDepth levels deep, so they have no children
+		depth := 0
+		for node := resp.ProtoReflect(); ; depth++ {
+			children := node.Get(fields.ByName("children")).List()
+			if children.Len() == 0 {
+				break
+			}
+			node = children.Get(0).Message()
+		}
+		if depth != 2 {
+			t.Errorf("Expected messages nested 2 levels deep, got %d: %s", depth, body)
+		}
+
+		_, again := post(newGateway(t, rpc.MockOptions{Seed: 1, MaxDepth: 2}), "GetItem")
+		if again != body {
+			t.Errorf("Expected the same seed to give the same response, got %s and %s", body, again)
+		}
+	})
+
+	t.Run("serves canned responses and errors", func(t *testing.T) {
+		gw := newGateway(t, rpc.MockOptions{
+			Responses: map[string]string{"catalog.v1.CatalogService/GetItem": `{"id":"canned","status":"STATUS_ACTIVE"}`},
+			Errors:    map[string]*rpc.Error{"catalog.v1.CatalogService/DeleteItem": rpc.NewError(rpc.CodePermissionDenied, "read only")},
+		})
+		// protojson randomly adds spaces, so the response is compacted
+		_, body := post(gw, "GetItem")
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, []byte(body)); err != nil || compact.String() != `{"id":"canned","status":"STATUS_ACTIVE"}` {
+			t.Errorf("Expected the canned response, got %s", body)
+		}
+		if code, body := post(gw, "DeleteItem"); code != http.StatusForbidden || !strings.Contains(body, "read only") {
+			t.Errorf("Expected the canned error, got %d: %s", code, body)
+		}
+		if code, _ := post(gw, "Import"); code == http.StatusOK {
+			t.Error("Expected client streams to be unimplemented")
+		}
+	})
+
+	t.Run("streams messages", func(t *testing.T) {
+		stream := func(t *testing.T, opts rpc.MockOptions) []string {
+			t.Helper()
+			server := httptest.NewServer(h2c.NewHandler(newGateway(t, opts), &http2.Server{}))
+			t.Cleanup(server.Close)
+			conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+				grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+
+			s, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, "/catalog.v1.CatalogService/ListItems")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SendMsg(dynamicpb.NewMessage(fd.Messages().ByName("GetRequest"))); err != nil {
+				t.Fatal(err)
+			}
+			_ = s.CloseSend()
+			var ids []string
+			for {
+				msg := dynamicpb.NewMessage(item)
+				err := s.RecvMsg(msg)
+				if errors.Is(err, io.EOF) {
+					return ids
+				}
+				if err != nil {
+					t.Fatalf("Stream failed: %v", err)
+				}
+				ids = append(ids, msg.Get(item.Fields().ByName("id")).String())
+			}
+		}
+
+		if ids := stream(t, rpc.MockOptions{StreamMessages: 4}); len(ids) != 4 {
+			t.Errorf("Expected 4 generated messages, got %v", ids)
+		}
+		canned := rpc.MockOptions{Responses: map[string]string{"catalog.v1.CatalogService/ListItems": `[{"id":"a"},{"id":"b"}]`}}
+		if ids := stream(t, canned); strings.Join(ids, ",") != "a,b" {
+			t.Errorf("Expected the canned messages, got %v", ids)
+		}
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		for name, opts := range map[string]rpc.MockOptions{
+			"unknown method":   {Responses: map[string]string{"catalog.v1.CatalogService/Missing": `{}`}},
+			"invalid response": {Responses: map[string]string{"catalog.v1.CatalogService/GetItem": `{"unknown":1}`}},
+			"unary array":      {Responses: map[string]string{"catalog.v1.CatalogService/GetItem": `[{}]`}},
+			"unknown error":    {Errors: map[string]*rpc.Error{"other.Service/Get": rpc.NewError(rpc.CodeInternal, "")}},
+		} {
+			if _, err := rpc.NewMockService(fdset, opts); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Page sizes of PageRequest.Size.
+const (
+	// DefaultPageSize is the page size of requests not asking for one.
+	DefaultPageSize = 50
+	// MaxPageSize bounds the page size of requests; larger ones are served
+	// pages of this size.
+	MaxPageSize = 1000
+)
+
+// PageRequest holds the pagination fields of list requests, page_size and
+// page_token as in AIP-158. Embed it in requests, whose messages then have
+// the fields:
+//
+//	type ListUsersRequest struct {
+//		rpc.PageRequest
+//		Filter string `json:"filter"`
+//	}
+type PageRequest struct {
+	PageSize  int32  `json:"page_size,omitempty" validate:"gte=0" doc:"Maximum number of items to return; the server may return fewer. Unset uses the default of the server."`
+	PageToken string `json:"page_token,omitempty" doc:"Token of the page to return, the next_page_token of the previous response. Unset for the first page."`
+}
+
+// PageResponse holds the pagination fields of list responses,
+// next_page_token and total_size as in AIP-158. Embed it in responses, or
+// return a Page.
+type PageResponse struct {
+	NextPageToken string `json:"next_page_token,omitempty" doc:"Token of the next page, unset on the last page."`
+	TotalSize     int32  `json:"total_size,omitempty" doc:"Number of items of all pages, if known."`
+}
+
+// Page is a list response holding a page of items:
+//
+//	rpc.NewMethod("ListUsers", func(ctx context.Context, req *ListUsersRequest) (*rpc.Page[User], error) {
+//		return rpc.Paginate(users, req.PageRequest)
+//	})
+//
+// Its message is named after the type of the items, such as UserPage.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	PageResponse
+}
+
+// Size returns the page size to serve: DefaultPageSize when the request
+// leaves it unset, and at most MaxPageSize. Negative sizes are an invalid
+// argument.
+func (r PageRequest) Size() (int, error) {
+	return r.SizeWithin(DefaultPageSize, MaxPageSize)
+}
+
+// SizeWithin returns the page size to serve like Size, with the given default
+// and maximum.
+func (r PageRequest) SizeWithin(defaultSize, maxSize int) (int, error) {
+	switch {
+	case r.PageSize < 0:
+		return 0, NewErrorf(CodeInvalidArgument, "page_size must not be negative, got %d", r.PageSize)
+	case r.PageSize == 0:
+		return min(defaultSize, maxSize), nil
+	default:
+		return min(int(r.PageSize), maxSize), nil
+	}
+}
+
+// pageOffset is the cursor of the page tokens of Paginate.
+type pageOffset struct {
+	Offset int `json:"offset"`
+}
+
+// Offset returns the offset of the page requested from a list paginated by
+// Paginate: 0 for the first page. Malformed tokens are an invalid argument.
+func (r PageRequest) Offset() (int, error) {
+	if r.PageToken == "" {
+		return 0, nil
+	}
+	var cursor pageOffset
+	if err := DecodePageToken(r.PageToken, &cursor); err != nil {
+		return 0, err
+	}
+	if cursor.Offset < 0 {
+		return 0, NewError(CodeInvalidArgument, "invalid page_token")
+	}
+	return cursor.Offset, nil
+}
+
+// EncodePageToken returns a page token holding cursor, the position of the
+// next page in the list, such as the key of its first item. Tokens are opaque
+// to clients but not encrypted, so cursors must not hold what clients may not
+// see.
+func EncodePageToken(cursor any) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodePageToken decodes the cursor of a page token from EncodePageToken.
+// Malformed tokens are an invalid argument.
+func DecodePageToken(token string, cursor any) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return NewError(CodeInvalidArgument, "invalid page_token")
+	}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return NewError(CodeInvalidArgument, "invalid page_token")
+	}
+	return nil
+}
+
+// NewPage returns a page of items continued by the page at next, a cursor
+// encoded with EncodePageToken, or the last page if next is nil.
+func NewPage[T any](items []T, next any) (*Page[T], error) {
+	page := &Page[T]{Items: items}
+	if next != nil {
+		token, err := EncodePageToken(next)
+		if err != nil {
+			return nil, err
+		}
+		page.NextPageToken = token
+	}
+	return page, nil
+}
+
+// Paginate returns the page of items requested by req, for lists held in
+// memory. Its page tokens hold the offset of the next page.
+func Paginate[T any](items []T, req PageRequest) (*Page[T], error) {
+	size, err := req.Size()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+	start := min(offset, len(items))
+	end := min(start+size, len(items))
+
+	var next any
+	if end < len(items) {
+		next = pageOffset{Offset: end}
+	}
+	page, err := NewPage(items[start:end], next)
+	if err != nil {
+		return nil, err
+	}
+	page.TotalSize = int32(min(len(items), math.MaxInt32)) //nolint:gosec // clamped to int32
+	return page, nil
+}
@@ -0,0 +1,127 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type PagedUser struct {
+	Name string `json:"name"`
+}
+
+type ListPagedUsersRequest struct {
+	rpc.PageRequest
+	Filter string `json:"filter"`
+}
+
+func TestPagination(t *testing.T) {
+	users := make([]PagedUser, 5)
+	for i := range users {
+		users[i] = PagedUser{Name: fmt.Sprintf("user%d", i)}
+	}
+	svc := rpc.NewService("UserService", rpc.WithPackage("users.v1"))
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("ListUsers", func(_ context.Context, req *ListPagedUsersRequest) (*rpc.Page[PagedUser], error) {
+		return rpc.Paginate(users, req.PageRequest)
+	}))
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	list := func(body string) (*httptest.ResponseRecorder, rpc.Page[PagedUser]) {
+		req := httptest.NewRequest(http.MethodPost, "/users.v1.UserService/ListUsers", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		var page rpc.Page[PagedUser]
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to decode page %s: %v", rec.Body, err)
+			}
+		}
+		return rec, page
+	}
+
+	t.Run("pages are followed to the end", func(t *testing.T) {
+		var names []string
+		token := ""
+		for range len(users) {
+			rec, page := list(fmt.Sprintf(`{"page_size":2,"page_token":%q}`, token))
+			if rec.Code != http.StatusOK || page.TotalSize != 5 {
+				t.Fatalf("Expected a page of 5 users, got %d: %s", rec.Code, rec.Body)
+			}
+			for _, user := range page.Items {
+				names = append(names, user.Name)
+			}
+			if token = page.NextPageToken; token == "" {
+				break
+			}
+		}
+		if got := strings.Join(names, ","); got != "user0,user1,user2,user3,user4" {
+			t.Errorf("Expected all users once, got %s", got)
+		}
+	})
+
+	t.Run("page sizes are bounded", func(t *testing.T) {
+		size, err := rpc.PageRequest{PageSize: 5000}.Size()
+		if err != nil || size != rpc.MaxPageSize {
+			t.Errorf("Expected %d, got %d %v", rpc.MaxPageSize, size, err)
+		}
+		if size, err := (rpc.PageRequest{}).SizeWithin(10, 100); err != nil || size != 10 {
+			t.Errorf("Expected the default size, got %d %v", size, err)
+		}
+	})
+
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		for _, body := range []string{`{"page_token":"not a token"}`, `{"page_size":-1}`} {
+			if rec, _ := list(body); !strings.Contains(rec.Body.String(), `"code":"invalid_argument"`) {
+				t.Errorf("Expected an invalid argument error for %s, got %s", body, rec.Body)
+			}
+		}
+	})
+
+	t.Run("cursor pages", func(t *testing.T) {
+		type cursor struct {
+			After string `json:"after"`
+		}
+		page, err := rpc.NewPage(users[:2], cursor{After: "user1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var next cursor
+		if err := rpc.DecodePageToken(page.NextPageToken, &next); err != nil || next.After != "user1" {
+			t.Errorf("Expected the cursor back, got %+v %v", next, err)
+		}
+		if last, _ := rpc.NewPage(users[4:], nil); last.NextPageToken != "" {
+			t.Errorf("Expected no token on the last page, got %q", last.NextPageToken)
+		}
+	})
+
+	t.Run("messages have the AIP-158 fields", func(t *testing.T) {
+		protoContent, err := svc.ExportProto()
+		if err != nil {
+			t.Fatalf("Failed to export proto: %v", err)
+		}
+		for _, expected := range []string{
+			"message ListPagedUsersRequest {",
+			"int32 page_size = 1;",
+			"string page_token = 2;",
+			"message PagedUserPage {",
+			"repeated PagedUser items = 1;",
+			"string next_page_token = 2;",
+			"int32 total_size = 3;",
+			"rpc ListUsers ( ListPagedUsersRequest ) returns ( PagedUserPage );",
+		} {
+			if !strings.Contains(protoContent, expected) {
+				t.Errorf("Expected proto to contain %q, got:\n%s", expected, protoContent)
+			}
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ItemStatus reports the failure of one item of a batch request.
+//
+// Batch methods report mixed outcomes by succeeding with the results of the
+// items that succeeded and a repeated ItemStatus field listing the others,
+// rather than failing the whole call:
+//
+//	type CreateUsersResponse struct {
+//		Users    []User           `json:"users"`
+//		Failures []rpc.ItemStatus `json:"failures"`
+//	}
+type ItemStatus struct {
+	// Index is the position of the item in the request
+	Index int32 `json:"index"`
+	// Code is the error code of the item, e.g. "invalid_argument"
+	Code string `json:"code"`
+	// Message describes the failure
+	Message string `json:"message,omitempty"`
+}
+
+// ItemStatusFor returns the status of the item at index that failed with err.
+// Codes of *Error values are kept; context errors map to deadline_exceeded
+// and canceled, and other errors to unknown.
+func ItemStatusFor(index int, err error) ItemStatus {
+	rpcErr := grpcErrorFor(err, true)
+	return ItemStatus{Index: int32(index), Code: string(rpcErr.Code), Message: rpcErr.Message} //nolint:gosec // batch sizes fit in int32
+}
+
+// PartialFailure collects the failed items of a batch request. It is safe
+// for concurrent use, so items can be processed in parallel.
+type PartialFailure struct {
+	mu       sync.Mutex
+	failures []ItemStatus
+}
+
+// Add records that the item at index failed with err. A nil err is ignored.
+func (p *PartialFailure) Add(index int, err error) {
+	if err == nil {
+		return
+	}
+	status := ItemStatusFor(index, err)
+	p.mu.Lock()
+	p.failures = append(p.failures, status)
+	p.mu.Unlock()
+}
+
+// Len returns the number of failed items.
+func (p *PartialFailure) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.failures)
+}
+
+// Failures returns the failed items, sorted by index.
+func (p *PartialFailure) Failures() []ItemStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	failures := slices.Clone(p.failures)
+	slices.SortFunc(failures, func(a, b ItemStatus) int { return int(a.Index - b.Index) })
+	return failures
+}
+
+// Err returns an error when all of total items failed, and nil otherwise, so
+// that a batch without any success fails as a whole. The error has the code
+// shared by all items, or aborted when they differ, and lists the failures in
+// its details.
+func (p *PartialFailure) Err(total int) error {
+	failures := p.Failures()
+	if total == 0 || len(failures) < total {
+		return nil
+	}
+
+	code := Code(failures[0].Code)
+	for _, failure := range failures[1:] {
+		if Code(failure.Code) != code {
+			code = CodeAborted
+			break
+		}
+	}
+	return NewError(code, fmt.Sprintf("all %d items failed", total)).
+		WithDetails(map[string]any{"failures": failures})
+}
+
+// RunBatch calls fn with every item of a batch request, in order. It returns
+// the results of the items that succeeded, in order, and the failures of the
+// others; clients match the results to the items by skipping the failed
+// indexes. Once ctx is done, the remaining items fail with its error.
+func RunBatch[TIn, TOut any](ctx context.Context, items []TIn, fn func(context.Context, TIn) (TOut, error)) ([]TOut, []ItemStatus) {
+	var failures PartialFailure
+	results := make([]TOut, 0, len(items))
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			failures.Add(i, err)
+			continue
+		}
+		result, err := fn(ctx, item)
+		if err != nil {
+			failures.Add(i, err)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, failures.Failures()
+}
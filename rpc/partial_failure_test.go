@@ -0,0 +1,92 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type Note struct {
+	Title string `json:"title"`
+}
+
+type CreateNotesRequest struct {
+	Notes []Note `json:"notes"`
+}
+
+type CreateNotesResponse struct {
+	Notes    []Note           `json:"notes"`
+	Failures []rpc.ItemStatus `json:"failures"`
+}
+
+func createNotes(ctx context.Context, req *CreateNotesRequest) (*CreateNotesResponse, error) {
+	notes, failures := rpc.RunBatch(ctx, req.Notes, func(_ context.Context, note Note) (Note, error) {
+		switch note.Title {
+		case "":
+			return Note{}, rpc.NewError(rpc.CodeInvalidArgument, "title is required")
+		case "taken":
+			return Note{}, rpc.NewError(rpc.CodeAlreadyExists, "title is taken")
+		}
+		return note, nil
+	})
+	return &CreateNotesResponse{Notes: notes, Failures: failures}, nil
+}
+
+func TestPartialFailure(t *testing.T) {
+	svc := rpc.NewService("NoteService", rpc.WithPackage("note.v1"))
+	rpc.MustRegister(svc, "CreateNotes", createNotes)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	body := `{"notes":[{"title":"a"},{"title":""},{"title":"b"},{"title":"taken"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/note.v1.NoteService/CreateNotes", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, req)
+
+	var resp CreateNotesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+	if len(resp.Notes) != 2 || resp.Notes[0].Title != "a" || resp.Notes[1].Title != "b" {
+		t.Errorf("Expected the successful notes in order, got %+v", resp.Notes)
+	}
+	want := []rpc.ItemStatus{
+		{Index: 1, Code: "invalid_argument", Message: "title is required"},
+		{Index: 3, Code: "already_exists", Message: "title is taken"},
+	}
+	if len(resp.Failures) != len(want) || resp.Failures[0] != want[0] || resp.Failures[1] != want[1] {
+		t.Errorf("Expected failures %+v, got %+v", want, resp.Failures)
+	}
+}
+
+func TestPartialFailureErr(t *testing.T) {
+	var failures rpc.PartialFailure
+	failures.Add(2, rpc.NewError(rpc.CodeNotFound, "missing"))
+	failures.Add(0, rpc.NewError(rpc.CodeNotFound, "missing"))
+	failures.Add(1, nil)
+	if failures.Len() != 2 || failures.Failures()[0].Index != 0 {
+		t.Errorf("Expected two failures sorted by index, got %+v", failures.Failures())
+	}
+	if err := failures.Err(3); err != nil {
+		t.Errorf("Expected no error with a successful item, got %v", err)
+	}
+
+	failures.Add(1, errors.New("disk full"))
+	var rpcErr *rpc.Error
+	if err := failures.Err(3); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeAborted || rpcErr.Details["failures"] == nil {
+		t.Errorf("Expected an aborted error listing the failures, got %v", err)
+	}
+	if status := rpc.ItemStatusFor(4, context.DeadlineExceeded); status.Code != string(rpc.CodeDeadlineExceeded) || status.Index != 4 {
+		t.Errorf("Expected deadline_exceeded, got %+v", status)
+	}
+}
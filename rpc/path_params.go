@@ -0,0 +1,324 @@
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// WithPath serves a unary method under a path template such as
+// "/users/{id}" in addition to its RPC path. Each variable matches one path
+// segment and names a scalar request field, with the same dot-separated
+// syntax as WithRoutingKey. The gateway sets the fields from the path after
+// decoding the body, so path values take precedence, and the body may be
+// empty. Requests are still POSTs with the usual protocols and content
+// types, and the template appears as a path of its own in OpenAPI specs.
+func WithPath(method, template string) ServiceOption {
+	return func(o *ServiceOptions) {
+		if o.Paths == nil {
+			o.Paths = make(map[string]string)
+		}
+		o.Paths[method] = template
+	}
+}
+
+// WithPath serves the method under a path template as well.
+// See the service option of the same name for the template syntax.
+func (m *MethodBuilder) WithPath(template string) *MethodBuilder {
+	m.method.Options.Path = template
+	return m
+}
+
+// pathTemplate returns the configured path template of a method.
+func (s *Service) pathTemplate(method *Method) string {
+	if method.Options.Path != "" {
+		return method.Options.Path
+	}
+	return s.options.Paths[method.Name]
+}
+
+// pathRoute returns the gateway route of a method with a path template, or
+// nil if it has none. The variables must resolve to scalar request fields.
+func (s *Service) pathRoute(method *Method, handler http.Handler) (*gateway.Route, error) {
+	template := s.pathTemplate(method)
+	if template == "" {
+		return nil, nil
+	}
+	if method.StreamType != StreamTypeUnary {
+		return nil, fmt.Errorf("method %s: path templates are only supported for unary methods", method.Name)
+	}
+	parsed, err := gateway.ParsePathTemplate(template)
+	if err != nil {
+		return nil, fmt.Errorf("method %s: %w", method.Name, err)
+	}
+	route := &gateway.Route{Method: method.Name, Template: template, Handler: handler}
+	for _, variable := range parsed.Variables() {
+		if !pathFieldExists(method, variable) {
+			return nil, fmt.Errorf("method %s: path variable %s is not a scalar field of %s", method.Name, variable, method.InputType)
+		}
+		if sensitivePathField(method, variable) {
+			route.Sensitive = append(route.Sensitive, variable)
+		}
+	}
+	return route, nil
+}
+
+// sensitivePathField reports whether a field path of the input of method
+// resolves to a struct field tagged sensitive, or to a protobuf field with
+// the debug_redact option.
+func sensitivePathField(method *Method, path string) bool {
+	if method.ProtoInput != nil {
+		_, fd, ok := resolveProtoPathField(method.ProtoInput.ProtoReflect().Descriptor(), path)
+		return ok && debugRedact(fd)
+	}
+	t := method.InputType
+	var field reflect.StructField
+	for _, segment := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		var ok bool
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		if field, ok = structFieldByName(t, segment); !ok {
+			return false
+		}
+		t = field.Type
+	}
+	return sensitiveField(field)
+}
+
+// pathFieldExists reports whether a field path resolves to a scalar field of
+// the input of method.
+func pathFieldExists(method *Method, path string) bool {
+	if method.ProtoInput != nil {
+		_, fd, ok := resolveProtoPathField(method.ProtoInput.ProtoReflect().Descriptor(), path)
+		return ok && fd.Kind() != protoreflect.BytesKind
+	}
+	return setStructPathField(reflect.New(method.InputType).Elem(), path, "") == nil
+}
+
+// pathRequestBody returns the body to decode for a request. Requests routed
+// by a path template may omit the body of JSON messages.
+func (s *Service) pathRequestBody(r *http.Request, body []byte, method *Method) []byte {
+	if len(bytes.TrimSpace(body)) > 0 || s.pathTemplate(method) == "" || !s.decodesAsJSON(r.Header.Get("Content-Type")) {
+		return body
+	}
+	return []byte("{}")
+}
+
+// applyPathValues sets the input fields named by the variables of the path
+// template of method to the path values of r, if it was routed by it.
+func (s *Service) applyPathValues(r *http.Request, input reflect.Value, method *Method) error {
+	template := s.pathTemplate(method)
+	if template == "" {
+		return nil
+	}
+	parsed, err := gateway.ParsePathTemplate(template)
+	if err != nil {
+		return NewErrorf(CodeInternal, "invalid path template: %v", err)
+	}
+
+	for _, variable := range parsed.Variables() {
+		value := r.PathValue(variable)
+		if value == "" {
+			continue
+		}
+		if msg, ok := input.Interface().(proto.Message); ok {
+			err = setProtoPathField(msg.ProtoReflect(), variable, value)
+		} else {
+			err = setStructPathField(input, variable, value)
+		}
+		if err != nil {
+			return NewErrorf(CodeInvalidArgument, "invalid path parameter %s: %v", variable, err)
+		}
+	}
+	return nil
+}
+
+// setStructPathField sets the field at path in a struct to value, allocating
+// nil pointers on the way. With an empty value it only checks that the field
+// exists and is a scalar.
+func setStructPathField(v reflect.Value, path, value string) error {
+	for _, segment := range strings.Split(path, ".") {
+		v = allocIndirect(v)
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is not a message", segment)
+		}
+		field, ok := structFieldByName(v.Type(), segment)
+		if !ok {
+			return fmt.Errorf("unknown field %s", segment)
+		}
+		for i, index := range field.Index {
+			if i > 0 {
+				v = allocIndirect(v)
+			}
+			v = v.Field(index)
+		}
+	}
+
+	v = allocIndirect(v)
+	if !scalarKind(v.Kind()) {
+		return fmt.Errorf("%s is not a scalar", path)
+	}
+	if value == "" {
+		return nil
+	}
+	return setScalar(v, value)
+}
+
+// allocIndirect dereferences pointers, allocating nil ones.
+func allocIndirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// scalarKind reports whether fields of kind can be set from a path segment.
+func scalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// setScalar parses value into a scalar field.
+func setScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// resolveProtoPathField resolves a field path against a message descriptor.
+// It returns the path of message fields leading to the final field, which
+// must be a singular scalar or enum.
+func resolveProtoPathField(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, protoreflect.FieldDescriptor, bool) {
+	segments := strings.Split(path, ".")
+	var parents []protoreflect.FieldDescriptor
+	for i, segment := range segments {
+		fd := md.Fields().ByName(protoreflect.Name(segment))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(segment)
+		}
+		if fd == nil || fd.IsList() || fd.IsMap() {
+			return nil, nil, false
+		}
+		if i == len(segments)-1 {
+			if fd.Message() != nil {
+				return nil, nil, false
+			}
+			return parents, fd, true
+		}
+		if fd.Message() == nil {
+			return nil, nil, false
+		}
+		parents = append(parents, fd)
+		md = fd.Message()
+	}
+	return nil, nil, false
+}
+
+// setProtoPathField sets the field at path in a message to value.
+func setProtoPathField(msg protoreflect.Message, path, value string) error {
+	parents, fd, ok := resolveProtoPathField(msg.Descriptor(), path)
+	if !ok {
+		return fmt.Errorf("unknown field %s", path)
+	}
+	for _, parent := range parents {
+		msg = msg.Mutable(parent).Message()
+	}
+
+	v, err := protoScalar(fd, value)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+// protoScalar parses value as a value of a scalar or enum field. Enum values
+// are given by name or number.
+func protoScalar(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err //nolint:gosec // parsed with 32 bits
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err //nolint:gosec // parsed with 32 bits
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown %s value %s", fd.Enum().FullName(), value)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil //nolint:gosec // parsed with 32 bits
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+	}
+}
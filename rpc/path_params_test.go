@@ -0,0 +1,125 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type GetAccountRequest struct {
+	ID      int64  `json:"id"`
+	Region  string `json:"region"`
+	Verbose bool   `json:"verbose"`
+}
+
+type GetAccountResponse struct {
+	Summary string `json:"summary"`
+}
+
+func TestPathParameters(t *testing.T) {
+	svc := rpc.NewService("AccountService", rpc.WithPackage("account.v1"),
+		rpc.WithPath("GetAccount", "/regions/{region}/accounts/{id}"))
+	rpc.MustRegister(svc, "GetAccount", func(_ context.Context, req *GetAccountRequest) (*GetAccountResponse, error) {
+		summary := req.Region + "/" + strings.Repeat("#", int(req.ID))
+		if req.Verbose {
+			summary += " (verbose)"
+		}
+		return &GetAccountResponse{Summary: summary}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{"RPC path", "/account.v1.AccountService/GetAccount", `{"id":2,"region":"eu"}`, http.StatusOK, `"summary":"eu/##"`},
+		{"template without body", "/regions/us/accounts/3", "", http.StatusOK, `"summary":"us/###"`},
+		{"template with body", "/regions/us/accounts/1", `{"verbose":true}`, http.StatusOK, `"summary":"us/# (verbose)"`},
+		{"path values take precedence", "/regions/us/accounts/1", `{"id":5,"region":"eu"}`, http.StatusOK, `"summary":"us/#"`},
+		{"escaped segment", "/regions/ap%2Fne/accounts/1", "", http.StatusOK, `"summary":"ap/ne/#"`},
+		{"invalid value", "/regions/us/accounts/abc", "", http.StatusBadRequest, "invalid path parameter id"},
+		{"unmatched path", "/regions/us/accounts", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body = %s, want %s", rec.Body, tt.want)
+			}
+		})
+	}
+
+	t.Run("OpenAPI", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", http.NoBody))
+		body, _ := io.ReadAll(rec.Body)
+
+		var spec struct {
+			Paths map[string]struct {
+				Post struct {
+					OperationID string `json:"operationId"`
+					Parameters  []struct {
+						Name   string         `json:"name"`
+						In     string         `json:"in"`
+						Schema map[string]any `json:"schema"`
+					} `json:"parameters"`
+				} `json:"post"`
+			} `json:"paths"`
+		}
+		if err := json.Unmarshal(body, &spec); err != nil {
+			t.Fatalf("Failed to parse OpenAPI: %v", err)
+		}
+		operation := spec.Paths["/regions/{region}/accounts/{id}"].Post
+		if operation.OperationID != "AccountService_GetAccount_Path" {
+			t.Errorf("operationId = %q", operation.OperationID)
+		}
+		if len(operation.Parameters) != 2 || operation.Parameters[0].Name != "region" || operation.Parameters[1].Name != "id" {
+			t.Fatalf("parameters = %+v", operation.Parameters)
+		}
+		if operation.Parameters[1].In != "path" || operation.Parameters[1].Schema["type"] == "string" {
+			t.Errorf("id parameter = %+v, want an integer path parameter", operation.Parameters[1])
+		}
+	})
+}
+
+func TestPathParametersInvalidTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"unknown field", "/accounts/{name}"},
+		{"malformed variable", "/accounts/{id"},
+		{"relative path", "accounts/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := rpc.NewService("AccountService", rpc.WithPackage("account.v1"))
+			rpc.MustRegisterMethod(svc, rpc.NewMethod("GetAccount",
+				func(_ context.Context, req *GetAccountRequest) (*GetAccountResponse, error) {
+					return &GetAccountResponse{}, nil
+				}).WithPath(tt.template))
+			if _, err := rpc.NewGateway(svc); err == nil {
+				t.Errorf("NewGateway accepted path template %q", tt.template)
+			}
+		})
+	}
+}
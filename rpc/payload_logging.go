@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultPayloadLogBytes bounds the logged JSON of each message.
+const defaultPayloadLogBytes = 4096
+
+// PayloadLoggingInterceptor logs the request and response messages of unary
+// calls as JSON, for debugging. The values of struct fields tagged
+// `sensitive:"true"` are replaced by RedactedValue, and protobuf fields with
+// the debug_redact option are left out, so logs can be shared without
+// leaking credentials or personal data:
+//
+//	svc := rpc.NewService("UserService",
+//		rpc.WithInterceptors(&rpc.PayloadLoggingInterceptor{Logger: logger}),
+//	)
+//
+// Messages are only encoded when the logger is enabled for Level.
+type PayloadLoggingInterceptor struct {
+	// Logger receives the records (default slog.Default())
+	Logger *slog.Logger
+	// Level of the records (default slog.LevelDebug)
+	Level slog.Leveler
+	// MaxBytes truncates the JSON of larger messages (default 4096, negative:
+	// no limit)
+	MaxBytes int
+}
+
+// Intercept logs the messages of a call once it returns.
+func (l *PayloadLoggingInterceptor) Intercept(ctx context.Context, method string, req any, handler func(context.Context, any) (any, error)) (any, error) {
+	logger, level := l.logger(), l.level()
+	if !logger.Enabled(ctx, level) {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	if procedure := Meta(ctx).Procedure(); procedure != "" {
+		method = procedure
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("request", l.payload(req)),
+	}
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			attrs = append(attrs, slog.String("code", string(rpcErr.Code)))
+		}
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.String("response", l.payload(resp)))
+	}
+	logger.LogAttrs(ctx, level, "rpc payload", attrs...)
+	return resp, err
+}
+
+// payload returns the redacted JSON of a message, truncated to MaxBytes.
+func (l *PayloadLoggingInterceptor) payload(msg any) string {
+	data, err := redactedJSON(msg)
+	if err != nil {
+		return "<unencodable: " + err.Error() + ">"
+	}
+	limit := l.MaxBytes
+	if limit == 0 {
+		limit = defaultPayloadLogBytes
+	}
+	if limit > 0 && len(data) > limit {
+		return string(data[:limit]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+// logger returns the configured logger or the default one.
+func (l *PayloadLoggingInterceptor) logger() *slog.Logger {
+	if l.Logger != nil {
+		return l.Logger
+	}
+	return slog.Default()
+}
+
+// level returns the configured level or debug.
+func (l *PayloadLoggingInterceptor) level() slog.Level {
+	if l.Level != nil {
+		return l.Level.Level()
+	}
+	return slog.LevelDebug
+}
+
+// redactedJSON encodes a message for logging: protobuf messages with
+// protojson, other values with encoding/json, redacted.
+func redactedJSON(msg any) ([]byte, error) {
+	if pm, ok := msg.(proto.Message); ok {
+		return protojson.Marshal(redactProto(pm))
+	}
+	return json.Marshal(Redact(msg))
+}
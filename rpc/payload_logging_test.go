@@ -0,0 +1,143 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type Contact struct {
+	Phone string `json:"phone" sensitive:"true"`
+	City  string `json:"city"`
+}
+
+type SignupRequest struct {
+	Email    string   `json:"email" sensitive:"true"`
+	Password string   `json:"password,omitempty" sensitive:"true"`
+	Plan     string   `json:"plan"`
+	Contact  *Contact `json:"contact,omitempty"`
+}
+
+type SignupResponse struct {
+	UserID string `json:"user_id"`
+}
+
+func TestPayloadLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	svc := rpc.NewService("SignupService", rpc.WithPackage("signup.v1"),
+		rpc.WithInterceptors(&rpc.PayloadLoggingInterceptor{Logger: logger}))
+	rpc.MustRegisterMethod(svc, rpc.NewMethod("Signup", func(_ context.Context, req *SignupRequest) (*SignupResponse, error) {
+		if req.Plan == "taken" {
+			return nil, rpc.NewError(rpc.CodeAlreadyExists, "account exists").WithDetails(map[string]any{"attempt": req})
+		}
+		return &SignupResponse{UserID: "u1"}, nil
+	}).WithPath("/v1/signups/{email}"))
+	gw, err := rpc.NewGatewayWithOptions(gateway.Options{Logger: logger}, svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(path, body string) *httptest.ResponseRecorder {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	records := func(t *testing.T) map[string]map[string]any {
+		t.Helper()
+		byMsg := make(map[string]map[string]any)
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("Invalid log line %q: %v", line, err)
+			}
+			byMsg[record["msg"].(string)] = record
+		}
+		return byMsg
+	}
+
+	t.Run("messages are logged redacted", func(t *testing.T) {
+		call("/signup.v1.SignupService/Signup", `{"email":"ann@example.com","password":"hunter2","plan":"pro","contact":{"phone":"555-0100","city":"Oslo"}}`)
+		record := records(t)["rpc payload"]
+		if record == nil {
+			t.Fatalf("Expected a payload record, got %s", logs.String())
+		}
+		want := `{"contact":{"city":"Oslo","phone":"[REDACTED]"},"email":"[REDACTED]","password":"[REDACTED]","plan":"pro"}`
+		if record["request"] != want {
+			t.Errorf("Expected request %s, got %v", want, record["request"])
+		}
+		if record["response"] != `{"user_id":"u1"}` || record["level"] != "DEBUG" || record["method"] != "/signup.v1.SignupService/Signup" {
+			t.Errorf("Unexpected record %v", record)
+		}
+	})
+
+	t.Run("error details are redacted", func(t *testing.T) {
+		rec := call("/signup.v1.SignupService/Signup", `{"email":"ann@example.com","password":"hunter2","plan":"taken"}`)
+		if body := rec.Body.String(); strings.Contains(body, "hunter2") || strings.Contains(body, "ann@example.com") ||
+			!strings.Contains(body, `"plan":"taken"`) {
+			t.Errorf("Expected redacted error details, got %s", body)
+		}
+		if record := records(t)["rpc payload"]; record["code"] != "already_exists" {
+			t.Errorf("Expected the error code in the payload record, got %v", record)
+		}
+	})
+
+	t.Run("access logs redact sensitive path values", func(t *testing.T) {
+		rec := call("/v1/signups/ann@example.com", `{"plan":"pro"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		byMsg := records(t)
+		if got := byMsg["rpc request"]["method"]; got != "/v1/signups/[REDACTED]" {
+			t.Errorf("Expected the redacted path in the access log, got %v", got)
+		}
+		if strings.Contains(logs.String(), "ann@example.com") {
+			t.Errorf("Expected no email in the logs, got %s", logs.String())
+		}
+	})
+
+	t.Run("nothing is encoded when the level is disabled", func(t *testing.T) {
+		interceptor := &rpc.PayloadLoggingInterceptor{Logger: logger, Level: slog.LevelDebug - 1}
+		logs.Reset()
+		if _, err := interceptor.Intercept(context.Background(), "Signup", &SignupRequest{}, func(context.Context, any) (any, error) {
+			return &SignupResponse{}, nil
+		}); err != nil || logs.Len() != 0 {
+			t.Errorf("Expected no record, got %v %s", err, logs.String())
+		}
+	})
+}
+
+func TestRedact(t *testing.T) {
+	type Audit struct {
+		Actor string `json:"actor" sensitive:"true"`
+	}
+	type Event struct {
+		Audit
+		Name   string `json:"name"`
+		Secret string `sensitive:"true"`
+		Skip   string `json:"-"`
+	}
+	data, err := json.Marshal(rpc.Redact([]any{Event{Audit: Audit{Actor: "ann"}, Name: "login", Skip: "x"}, "plain"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"Secret":"","actor":"[REDACTED]","name":"login"},"plain"]`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+	if plain := (SignupResponse{UserID: "u1"}); rpc.Redact(plain) != plain {
+		t.Error("Expected values without sensitive fields to be returned as they are")
+	}
+}
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Profiling label keys attached to request goroutines when profiling labels are enabled.
+const (
+	// ProfileLabelMethod is the procedure path, e.g. "/user.v1.UserService/GetUser".
+	ProfileLabelMethod = "rpc.method"
+	// ProfileLabelProtocol is one of "connect", "grpc", "grpc-web", "jsonrpc", or "http".
+	ProfileLabelProtocol = "rpc.protocol"
+	// ProfileLabelCodec is "json" or "proto".
+	ProfileLabelCodec = "rpc.codec"
+	// ProfileLabelPhase is one of "decode", "handler", or "encode".
+	ProfileLabelPhase = "rpc.phase"
+)
+
+// Profiling phases
+const (
+	profilePhaseDecode  = "decode"
+	profilePhaseHandler = "handler"
+	profilePhaseEncode  = "encode"
+)
+
+// Protocol names used in profiling labels in addition to the error detail protocols.
+const (
+	protocolJSONRPC = "jsonrpc"
+	protocolHTTP    = "http"
+)
+
+// WithProfilingLabels tags request goroutines with pprof labels for the method,
+// protocol, codec, and processing phase, so continuous profilers such as Parca or
+// Pyroscope attribute CPU time to individual RPCs. Handlers receive a context
+// carrying the labels, so goroutines they start with pprof.Do inherit them.
+// Server streaming messages are encoded while the handler runs and count
+// toward the handler phase.
+func WithProfilingLabels(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ProfilingLabels = enabled
+	}
+}
+
+// protocolName returns the protocol name used in profiling labels.
+func (p protocolInfo) protocolName() string {
+	switch {
+	case p.isGRPCWeb:
+		return protocolGRPCWeb
+	case p.isGRPC:
+		return protocolGRPC
+	case p.isJSONRPC:
+		return protocolJSONRPC
+	case p.isConnect:
+		return protocolConnect
+	default:
+		return protocolHTTP
+	}
+}
+
+// codecName returns the codec name used in profiling labels.
+func (p protocolInfo) codecName() string {
+	if p.wantsProto && !p.wantsJSON {
+		return "proto"
+	}
+	return "json"
+}
+
+// withProfilingLabels runs fn with request-level profiling labels applied to the
+// current goroutine. fn receives the labeled context.
+func withProfilingLabels(ctx context.Context, path string, p protocolInfo, fn func(context.Context)) {
+	labels := pprof.Labels(
+		ProfileLabelMethod, path,
+		ProfileLabelProtocol, p.protocolName(),
+		ProfileLabelCodec, p.codecName(),
+	)
+	pprof.Do(ctx, labels, fn)
+}
+
+// profilePhase marks the current goroutine as being in the given phase and returns
+// the labeled context. It is a no-op when profiling labels are disabled. The
+// enclosing withProfilingLabels call restores the previous labels when it returns.
+func (s *Service) profilePhase(ctx context.Context, phase string) context.Context {
+	if !s.options.ProfilingLabels {
+		return ctx
+	}
+	ctx = pprof.WithLabels(ctx, pprof.Labels(ProfileLabelPhase, phase))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
@@ -0,0 +1,90 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ProfileRequest struct {
+	Name string `json:"name"`
+}
+
+type ProfileResponse struct {
+	Labels map[string]string `json:"labels"`
+}
+
+func TestProfilingLabels(t *testing.T) {
+	newServer := func(t *testing.T, enabled bool) *httptest.Server {
+		t.Helper()
+		svc := rpc.NewService("ProfileService",
+			rpc.WithPackage("profile.v1"),
+			rpc.WithProfilingLabels(enabled),
+		)
+		rpc.MustRegister(svc, "Echo", func(ctx context.Context, req *ProfileRequest) (*ProfileResponse, error) {
+			labels := make(map[string]string)
+			pprof.ForLabels(ctx, func(key, value string) bool {
+				labels[key] = value
+				return true
+			})
+			return &ProfileResponse{Labels: labels}, nil
+		})
+
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		server := httptest.NewServer(gw)
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	call := func(t *testing.T, server *httptest.Server) string {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			server.URL+"/profile.v1.ProfileService/Echo", strings.NewReader(`{"name":"a"}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return string(body)
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		body := call(t, newServer(t, true))
+		for _, want := range []string{
+			`"rpc.method":"/profile.v1.ProfileService/Echo"`,
+			`"rpc.protocol":"connect"`,
+			`"rpc.codec":"json"`,
+			`"rpc.phase":"handler"`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected label %s in %s", want, body)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		body := call(t, newServer(t, false))
+		if strings.Contains(body, "rpc.method") {
+			t.Errorf("Expected no labels when disabled, got %s", body)
+		}
+	})
+}
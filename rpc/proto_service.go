@@ -0,0 +1,427 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// RegisterProtoService registers the methods of a service generated by
+// protoc-gen-go-grpc, described by desc and implemented by impl, so that
+// existing generated services can be served by the gateway alongside
+// services of Go types while migrating:
+//
+//	svc := rpc.NewService("UserService", rpc.WithPackage("user.v1"))
+//	err := rpc.RegisterProtoService(svc, &userv1.UserService_ServiceDesc, &userServer{})
+//
+// The service must be named like the generated one, or be created from its
+// descriptor with NewServiceFromDescriptor, and describes itself with the
+// generated file. Implementations receive the request headers as incoming
+// gRPC metadata, may set response metadata with grpc.SetHeader,
+// grpc.SendHeader, and grpc.SetTrailer, and may return status errors. All
+// kinds of methods are served, including client and bidirectional streaming.
+//
+// The interceptors of the service run around unary calls as for other
+// methods, and the gRPC interceptors the implementation was served with can
+// be kept with WithGRPCUnaryInterceptors and WithGRPCStreamInterceptors.
+func RegisterProtoService(svc *Service, desc *grpc.ServiceDesc, impl any, opts ...ProtoServiceOption) error {
+	if desc.HandlerType != nil {
+		ht := reflect.TypeOf(desc.HandlerType).Elem()
+		if st := reflect.TypeOf(impl); st == nil || !st.Implements(ht) {
+			return fmt.Errorf("%T does not implement %s", impl, ht)
+		}
+	}
+	sd, err := protoServiceDescriptor(svc, desc)
+	if err != nil {
+		return err
+	}
+	var options protoServiceOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	for i := range desc.Methods {
+		if err := registerProtoMethod(svc, sd, &desc.Methods[i], impl, &options); err != nil {
+			return err
+		}
+	}
+	for i := range desc.Streams {
+		if err := registerProtoStream(svc, sd, &desc.Streams[i], impl, &options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegisterProtoService is like RegisterProtoService but panics on error.
+func MustRegisterProtoService(svc *Service, desc *grpc.ServiceDesc, impl any, opts ...ProtoServiceOption) {
+	if err := RegisterProtoService(svc, desc, impl, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// ProtoServiceOption configures the registration of a generated service.
+type ProtoServiceOption func(*protoServiceOptions)
+
+// protoServiceOptions holds the gRPC interceptors of a generated service.
+type protoServiceOptions struct {
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+}
+
+// WithGRPCUnaryInterceptors runs gRPC interceptors around the unary methods
+// of a generated service, the first one outermost, like
+// grpc.ChainUnaryInterceptor does for a grpc.Server.
+func WithGRPCUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) ProtoServiceOption {
+	return func(o *protoServiceOptions) {
+		o.unary = append(o.unary, interceptors...)
+	}
+}
+
+// WithGRPCStreamInterceptors runs gRPC interceptors around the streaming
+// methods of a generated service, the first one outermost, like
+// grpc.ChainStreamInterceptor does for a grpc.Server.
+func WithGRPCStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) ProtoServiceOption {
+	return func(o *protoServiceOptions) {
+		o.stream = append(o.stream, interceptors...)
+	}
+}
+
+// unaryInterceptor returns the chain of the unary interceptors, or nil if
+// there are none.
+func (o *protoServiceOptions) unaryInterceptor() grpc.UnaryServerInterceptor {
+	if len(o.unary) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		for i := len(o.unary) - 1; i >= 0; i-- {
+			interceptor, next := o.unary[i], handler
+			handler = func(ctx context.Context, req any) (any, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// serveStream calls handler with the stream interceptors around it.
+func (o *protoServiceOptions) serveStream(impl any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	for i := len(o.stream) - 1; i >= 0; i-- {
+		interceptor, next := o.stream[i], handler
+		handler = func(srv any, stream grpc.ServerStream) error {
+			return interceptor(srv, stream, info, next)
+		}
+	}
+	return handler(impl, stream)
+}
+
+// protoServiceDescriptor returns the descriptor of the generated service of
+// desc, which svc then describes itself with.
+func protoServiceDescriptor(svc *Service, desc *grpc.ServiceDesc) (protoreflect.ServiceDescriptor, error) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("service %s is not registered, import its generated package: %w", desc.ServiceName, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", desc.ServiceName)
+	}
+
+	switch {
+	case svc.descriptor != nil:
+		if svc.descriptor.FullName() != sd.FullName() {
+			return nil, fmt.Errorf("service %s cannot serve %s", svc.descriptor.FullName(), sd.FullName())
+		}
+	case svc.packageName+"."+svc.name != desc.ServiceName:
+		return nil, fmt.Errorf("service %s.%s cannot serve %s, create it with the generated name", svc.packageName, svc.name, desc.ServiceName)
+	case len(svc.methods) > 0:
+		return nil, fmt.Errorf("service %s already has methods of Go types", desc.ServiceName)
+	default:
+		svc.descriptor = sd
+	}
+	return svc.descriptor, nil
+}
+
+// protoMethod returns the descriptor of the method name of the generated
+// service sd, and empty messages of its generated input and output types.
+func protoMethod(sd protoreflect.ServiceDescriptor, name string) (protoreflect.MethodDescriptor, proto.Message, proto.Message, error) {
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, nil, nil, fmt.Errorf("service %s has no method %s", sd.FullName(), name)
+	}
+	input, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("method %s: %w", name, err)
+	}
+	output, err := protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("method %s: %w", name, err)
+	}
+	return md, input.New().Interface(), output.New().Interface(), nil
+}
+
+// registerProtoMethod registers the generated unary method m of impl.
+func registerProtoMethod(svc *Service, sd protoreflect.ServiceDescriptor, m *grpc.MethodDesc, impl any, opts *protoServiceOptions) error {
+	md, input, output, err := protoMethod(sd, m.MethodName)
+	if err != nil {
+		return err
+	}
+	procedure := fmt.Sprintf("/%s/%s", sd.FullName(), m.MethodName)
+	interceptor := opts.unaryInterceptor()
+
+	handler := func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		ctx = protoServiceContext(ctx, newProtoTransportStream(ctx, procedure, nil))
+		dec := func(v any) error {
+			proto.Merge(v.(proto.Message), req)
+			return nil
+		}
+		resp, err := m.Handler(impl, ctx, dec, interceptor)
+		if err != nil {
+			return nil, protoServiceError(err)
+		}
+		msg, ok := resp.(proto.Message)
+		if !ok || msg == nil || reflect.ValueOf(msg).IsNil() {
+			return proto.Clone(output), nil
+		}
+		return msg, nil
+	}
+	return svc.Register(&Method{
+		Name:        m.MethodName,
+		Handler:     handler,
+		InputType:   reflect.TypeOf(input).Elem(),
+		OutputType:  reflect.TypeOf(output).Elem(),
+		Options:     MethodOptions{Idempotency: descriptorIdempotency(md)},
+		ProtoInput:  input,
+		ProtoOutput: output,
+	})
+}
+
+// registerProtoStream registers the generated streaming method s of impl.
+func registerProtoStream(svc *Service, sd protoreflect.ServiceDescriptor, s *grpc.StreamDesc, impl any, opts *protoServiceOptions) error {
+	_, input, output, err := protoMethod(sd, s.StreamName)
+	if err != nil {
+		return err
+	}
+	procedure := fmt.Sprintf("/%s/%s", sd.FullName(), s.StreamName)
+	info := &grpc.StreamServerInfo{FullMethod: procedure, IsClientStream: s.ClientStreams, IsServerStream: s.ServerStreams}
+
+	serve := func(ctx context.Context, stream *protoServerStream) error {
+		stream.transport = newProtoTransportStream(ctx, procedure, stream.writer)
+		stream.ctx = protoServiceContext(ctx, stream.transport)
+		return protoServiceError(opts.serveStream(impl, stream, info, s.Handler))
+	}
+	method := &Method{
+		Name:        s.StreamName,
+		InputType:   reflect.TypeOf(input).Elem(),
+		OutputType:  reflect.TypeOf(output).Elem(),
+		ProtoInput:  input,
+		ProtoOutput: output,
+	}
+	switch {
+	case s.ClientStreams && s.ServerStreams:
+		method.StreamType = StreamTypeBidiStream
+		method.Handler = func(ctx context.Context, stream any) error {
+			recv, ok := stream.(*recvStream)
+			if !ok {
+				return fmt.Errorf("invalid stream type: %T", stream)
+			}
+			return serve(ctx, &protoServerStream{writer: recv.serverStreamWriter, recv: recv})
+		}
+	case s.ClientStreams:
+		method.StreamType = StreamTypeClientStream
+		method.Handler = func(ctx context.Context, stream any) (any, error) {
+			recv, ok := stream.(*recvStream)
+			if !ok {
+				return nil, fmt.Errorf("invalid stream type: %T", stream)
+			}
+			ps := &protoServerStream{writer: recv.serverStreamWriter, recv: recv, clientStream: true}
+			if err := serve(ctx, ps); err != nil {
+				return nil, err
+			}
+			if ps.response == nil {
+				return proto.Clone(output), nil
+			}
+			return ps.response, nil
+		}
+	default:
+		method.StreamType = StreamTypeServerStream
+		method.Handler = func(ctx context.Context, req any, stream any) error {
+			writer, ok := stream.(*serverStreamWriter)
+			if !ok {
+				return fmt.Errorf("invalid stream type: %T", stream)
+			}
+			return serve(ctx, &protoServerStream{writer: writer, req: req.(proto.Message)})
+		}
+	}
+	return svc.RegisterStreamingMethod(method)
+}
+
+// protoServiceContext returns the context generated implementations are
+// called with, carrying the request headers as incoming gRPC metadata and
+// the transport stream setting the response metadata of the call.
+func protoServiceContext(ctx context.Context, stream *protoTransportStream) context.Context {
+	ctx = metadata.NewIncomingContext(ctx, metadata.MD(stream.meta.Incoming()))
+	return grpc.NewContextWithServerTransportStream(ctx, stream)
+}
+
+// protoServiceError converts the gRPC status errors of generated
+// implementations to errors of the same code, message, and details.
+func protoServiceError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Proto().GetCode() == 0 {
+		return err
+	}
+	rpcErr := NewErrorWithDetails(codeForGRPCStatus(int(st.Code())), st.Message())
+	for _, detail := range st.Proto().GetDetails() {
+		typeName := detail.GetTypeUrl()
+		if idx := strings.LastIndex(typeName, "/"); idx >= 0 {
+			typeName = typeName[idx+1:]
+		}
+		rpcErr.AddDetail(&ErrorDetail{Type: typeName, Value: detail.GetValue()})
+	}
+	if len(rpcErr.details) == 0 {
+		return rpcErr.base
+	}
+	return rpcErr
+}
+
+// errProtoHeaderSent is returned when metadata is set after the headers of
+// a call were sent, as grpc-go does.
+var errProtoHeaderSent = status.Error(codes.Internal, "transport: the stream is done or WriteHeader was already called")
+
+// protoTransportStream sets the response metadata of the call of a generated
+// implementation, for grpc.SetHeader, grpc.SendHeader, and grpc.SetTrailer.
+type protoTransportStream struct {
+	method string
+	meta   Metadata
+	// writer writes the headers of streams, nil for unary calls
+	writer *serverStreamWriter
+
+	mu         sync.Mutex
+	headerSent bool
+}
+
+func newProtoTransportStream(ctx context.Context, procedure string, writer *serverStreamWriter) *protoTransportStream {
+	return &protoTransportStream{method: procedure, meta: Meta(ctx), writer: writer}
+}
+
+func (s *protoTransportStream) Method() string {
+	return s.method
+}
+
+func (s *protoTransportStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.headerSent || (s.writer != nil && s.writer.sentHeaders()) {
+		return errProtoHeaderSent
+	}
+	s.meta.SetHeader(MD(md))
+	return nil
+}
+
+// SendHeader sets md and writes the headers of streams right away. Unary
+// calls send their headers with the response, which nothing is written
+// before.
+func (s *protoTransportStream) SendHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.headerSent || (s.writer != nil && s.writer.sentHeaders()) {
+		return errProtoHeaderSent
+	}
+	s.meta.SetHeader(MD(md))
+	s.headerSent = true
+	if s.writer != nil {
+		return s.writer.sendHeader()
+	}
+	return nil
+}
+
+func (s *protoTransportStream) SetTrailer(md metadata.MD) error {
+	s.meta.SetTrailer(MD(md))
+	return nil
+}
+
+// protoServerStream is the grpc.ServerStream of a generated streaming
+// implementation: it receives the request of server streams once, or the
+// messages of the client of client and bidirectional streams, and sends
+// messages on the stream of the call.
+type protoServerStream struct {
+	ctx       context.Context
+	transport *protoTransportStream
+	writer    *serverStreamWriter
+	// recv receives the messages of the client, nil for server streams
+	recv     *recvStream
+	req      proto.Message
+	received bool
+	// Client streams send the response once the implementation returns
+	clientStream bool
+	response     proto.Message
+}
+
+func (s *protoServerStream) SetHeader(md metadata.MD) error {
+	return s.transport.SetHeader(md)
+}
+
+func (s *protoServerStream) SendHeader(md metadata.MD) error {
+	return s.transport.SendHeader(md)
+}
+
+func (s *protoServerStream) SetTrailer(md metadata.MD) {
+	_ = s.transport.SetTrailer(md)
+}
+
+func (s *protoServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg sends m right away, like grpc-go does, since implementations may
+// wait for long between messages. The response of a client stream, sent by
+// SendAndClose, is kept until the implementation returns.
+func (s *protoServerStream) SendMsg(m any) error {
+	if s.clientStream {
+		msg, ok := m.(proto.Message)
+		if !ok {
+			return errors.New("protoServerStream: not a protobuf message")
+		}
+		s.response = msg
+		return nil
+	}
+	if err := s.writer.Send(m); err != nil {
+		return err
+	}
+	s.writer.flush()
+	return nil
+}
+
+func (s *protoServerStream) RecvMsg(m any) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return errors.New("protoServerStream: not a protobuf message")
+	}
+	if s.recv != nil {
+		in, err := s.recv.Recv()
+		if err != nil {
+			return err
+		}
+		proto.Merge(msg, in.(proto.Message))
+		return nil
+	}
+	if s.received {
+		return io.EOF
+	}
+	proto.Merge(msg, s.req)
+	s.received = true
+	return nil
+}
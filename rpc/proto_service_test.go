@@ -0,0 +1,273 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// healthServer is a generated service implementation that reads and writes
+// gRPC metadata.
+type healthServer struct {
+	*health.Server
+}
+
+func (s healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if err := grpc.SetHeader(ctx, metadata.Pairs("x-caller", strings.Join(md.Get("x-caller"), ","))); err != nil {
+		return nil, err
+	}
+	return s.Server.Check(ctx, req)
+}
+
+func TestRegisterProtoService(t *testing.T) {
+	svc := rpc.NewService("Health", rpc.WithPackage("grpc.health.v1"))
+	if err := rpc.RegisterProtoService(svc, &healthpb.Health_ServiceDesc, healthServer{health.NewServer()}); err != nil {
+		t.Fatalf("RegisterProtoService() failed: %v", err)
+	}
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+	conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+
+	t.Run("unary over gRPC", func(t *testing.T) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-caller", "test")
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+		if err != nil {
+			t.Fatalf("Check() failed: %v", err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected SERVING, got %v", resp.GetStatus())
+		}
+		if got := header.Get("x-caller"); len(got) != 1 || got[0] != "test" {
+			t.Errorf("Expected the x-caller header, got %v", header)
+		}
+	})
+
+	t.Run("status errors", func(t *testing.T) {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+		if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "unknown service" {
+			t.Errorf("Expected NotFound: unknown service, got %v", err)
+		}
+	})
+
+	t.Run("server streaming", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch() failed: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected SERVING, got %v (%v)", resp, err)
+		}
+	})
+
+	t.Run("Connect JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", strings.NewReader(`{"service":""}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"SERVING"`) {
+			t.Errorf("Expected SERVING, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("descriptors", func(t *testing.T) {
+		files := svc.GetFileDescriptorSet().GetFile()
+		file := files[len(files)-1]
+		if file.GetName() != "grpc/health/v1/health.proto" || len(file.GetService()) != 1 {
+			t.Errorf("Expected the generated file, got %s", file.GetName())
+		}
+	})
+
+	t.Run("invalid registrations", func(t *testing.T) {
+		for name, svc := range map[string]*rpc.Service{
+			"other name":    rpc.NewService("Checker", rpc.WithPackage("grpc.health.v1")),
+			"other package": rpc.NewService("Health", rpc.WithPackage("health.v2")),
+		} {
+			if err := rpc.RegisterProtoService(svc, &healthpb.Health_ServiceDesc, health.NewServer()); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+		svc := rpc.NewService("Health", rpc.WithPackage("grpc.health.v1"))
+		if err := rpc.RegisterProtoService(svc, &healthpb.Health_ServiceDesc, struct{}{}); err == nil {
+			t.Error("Expected an error for an implementation of another service")
+		}
+	})
+}
+
+// testServer is a generated service implementation with client and
+// bidirectional streaming methods.
+type testServer struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testServer) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	return &testpb.Empty{}, nil
+}
+
+func (testServer) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(req.GetPayload().GetBody())) //nolint:gosec // test payloads are small
+	}
+}
+
+func (testServer) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	if err := stream.SendHeader(metadata.Pairs("x-stream", "open")); err != nil {
+		return err
+	}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestRegisterProtoServiceStreams(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(method string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, method)
+	}
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		record(info.FullMethod)
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		record(info.FullMethod)
+		return handler(srv, ss)
+	}
+	svc := rpc.NewService("TestService", rpc.WithPackage("grpc.testing"))
+	rpc.MustRegisterProtoService(svc, &testpb.TestService_ServiceDesc, testServer{},
+		rpc.WithGRPCUnaryInterceptors(unary), rpc.WithGRPCStreamInterceptors(stream))
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+	conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := testpb.NewTestServiceClient(conn)
+
+	t.Run("client streaming", func(t *testing.T) {
+		stream, err := client.StreamingInputCall(context.Background())
+		if err != nil {
+			t.Fatalf("StreamingInputCall() failed: %v", err)
+		}
+		for _, body := range []string{"abc", "de"} {
+			if err := stream.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil || resp.GetAggregatedPayloadSize() != 5 {
+			t.Errorf("Expected a size of 5, got %v (%v)", resp, err)
+		}
+	})
+
+	t.Run("bidirectional streaming", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stream, err := client.FullDuplexCall(ctx)
+		if err != nil {
+			t.Fatalf("FullDuplexCall() failed: %v", err)
+		}
+		// The headers arrive before any message is sent
+		header, err := stream.Header()
+		if err != nil || len(header.Get("x-stream")) != 1 {
+			t.Fatalf("Expected the x-stream header, got %v (%v)", header, err)
+		}
+		for _, body := range []string{"ping", "pong"} {
+			if err := stream.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+			resp, err := stream.Recv()
+			if err != nil || string(resp.GetPayload().GetBody()) != body {
+				t.Fatalf("Expected %s, got %v (%v)", body, resp, err)
+			}
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+			t.Errorf("Expected the end of the stream, got %v", err)
+		}
+	})
+
+	t.Run("interceptors", func(t *testing.T) {
+		mu.Lock()
+		calls = nil
+		mu.Unlock()
+		if _, err := client.EmptyCall(context.Background(), &testpb.Empty{}); err != nil {
+			t.Fatalf("EmptyCall() failed: %v", err)
+		}
+		stream, err := client.StreamingInputCall(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			t.Fatalf("CloseAndRecv() failed: %v", err)
+		}
+		want := []string{"/grpc.testing.TestService/EmptyCall", "/grpc.testing.TestService/StreamingInputCall"}
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(calls, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected interceptors for %v, got %v", want, calls)
+		}
+	})
+}
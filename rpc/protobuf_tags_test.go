@@ -0,0 +1,119 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// Annotation mixes hand-written fields with a generated struct and a field
+// copied from generated code.
+type Annotation struct {
+	Text     string                                `json:"text"`
+	Offset   int64                                 `protobuf:"zigzag64,1,opt,name=offset_ns,json=offsetNs,proto3" json:"offset_ns,omitempty"`
+	Location *descriptorpb.SourceCodeInfo_Location `json:"location"`
+}
+
+func TestProtobufTags(t *testing.T) {
+	var received *Annotation
+	svc := rpc.NewService("AnnotationService", rpc.WithPackage("annotation.v1"), rpc.WithProtobufTags(true))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *Annotation) (*Annotation, error) {
+		received = req
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	var md protoreflect.MessageDescriptor
+	for _, file := range svc.GetFileDescriptorSet().GetFile() {
+		if file.GetPackage() == "annotation.v1" {
+			fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+			if err != nil {
+				t.Fatalf("Failed to build descriptors: %v", err)
+			}
+			md = fd.Messages().ByName("Annotation")
+		}
+	}
+	if md == nil {
+		t.Fatal("Expected an Annotation message")
+	}
+
+	t.Run("generated structs get the generated descriptors", func(t *testing.T) {
+		if fd := md.Fields().ByName("offset_ns"); fd == nil || fd.Number() != 1 || fd.Kind() != protoreflect.Sint64Kind {
+			t.Errorf("Expected offset_ns to be sint64 field 1, got %v", fd)
+		}
+		if fd := md.Fields().ByName("text"); fd == nil || fd.Number() != 2 {
+			t.Errorf("Expected text to be field 2, got %v", fd)
+		}
+		got := md.Fields().ByName("location").Message()
+		want := (&descriptorpb.SourceCodeInfo_Location{}).ProtoReflect().Descriptor()
+		for i := range want.Fields().Len() {
+			wfd := want.Fields().Get(i)
+			gfd := got.Fields().ByNumber(wfd.Number())
+			if gfd == nil || gfd.Name() != wfd.Name() || gfd.Kind() != wfd.Kind() || gfd.Cardinality() != wfd.Cardinality() {
+				t.Errorf("Expected %v, got %v", wfd, gfd)
+			}
+		}
+	})
+
+	t.Run("wire compatible with the generated messages", func(t *testing.T) {
+		location := &descriptorpb.SourceCodeInfo_Location{
+			Path:                    []int32{4, 0, 2, 1},
+			Span:                    []int32{10, 2, 30},
+			LeadingComments:         proto.String(" The offset.\n"),
+			LeadingDetachedComments: []string{" detached\n"},
+		}
+		data, err := proto.Marshal(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := dynamicpb.NewMessage(md)
+		req.Set(md.Fields().ByName("text"), protoreflect.ValueOfString("note"))
+		req.Set(md.Fields().ByName("offset_ns"), protoreflect.ValueOfInt64(-42))
+		nested := req.Mutable(md.Fields().ByName("location")).Message()
+		if err := proto.Unmarshal(data, nested.Interface()); err != nil {
+			t.Fatalf("Failed to decode the generated message: %v", err)
+		}
+		body, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		httpReq := httptest.NewRequest(http.MethodPost, "/annotation.v1.AnnotationService/Echo", strings.NewReader(string(body)))
+		httpReq.Header.Set("Content-Type", "application/proto")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httpReq)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if received.Offset != -42 || received.Text != "note" || !proto.Equal(received.Location, location) {
+			t.Errorf("Expected the request, got %+v", received)
+		}
+
+		resp := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		data, err = proto.Marshal(resp.Get(md.Fields().ByName("location")).Message().Interface())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &descriptorpb.SourceCodeInfo_Location{}
+		if err := proto.Unmarshal(data, got); err != nil || !proto.Equal(got, location) {
+			t.Errorf("Expected %v, got %v (%v)", location, got, err)
+		}
+	})
+}
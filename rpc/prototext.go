@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+)
+
+// contentTypeProtoText is the content type of the protobuf text format.
+const contentTypeProtoText = "text/x-protobuf"
+
+// protoTextMarshalOptions format text responses for reading.
+var protoTextMarshalOptions = prototext.MarshalOptions{Multiline: true, Indent: "  "}
+
+// WithProtoTextResponses encodes responses in the protobuf text format for
+// unary requests that accept text/x-protobuf, or send it without an Accept
+// header. Requests in the text format are always accepted, which makes it
+// easy to handcraft requests with nested messages:
+//
+//	curl -H 'Content-Type: text/x-protobuf' \
+//		-d 'user { name: "gopher" tags: "admin" }' \
+//		http://localhost:8080/users.v1.UserService/Update
+//
+// The text format is meant for debugging and is not stable, so responses
+// use JSON unless this is enabled.
+func WithProtoTextResponses(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ProtoTextResponses = enabled
+	}
+}
+
+// isProtoTextContentType reports whether a content type or Accept header
+// names the protobuf text format.
+func isProtoTextContentType(contentType string) bool {
+	return strings.HasPrefix(strings.TrimSpace(contentType), contentTypeProtoText)
+}
+
+// decodeProtoTextInput decodes a request in the protobuf text format.
+// Struct messages are decoded through their dynamic descriptor.
+func (s *Service) decodeProtoTextInput(body []byte, ctx *handlerContext) (reflect.Value, error) {
+	if ctx.useProtoInput && ctx.method.ProtoInput != nil {
+		msg := proto.Clone(ctx.method.ProtoInput)
+		if err := prototext.Unmarshal(body, msg); err != nil {
+			return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal text format: %v", err)
+		}
+		return reflect.ValueOf(msg), nil
+	}
+
+	if ctx.inputCodec == nil || ctx.newInputFunc == nil {
+		return reflect.Value{}, NewError(CodeInternal, "input codec not initialized")
+	}
+	msg := dynamicpb.NewMessage(ctx.inputCodec.Descriptor())
+	if err := prototext.Unmarshal(body, msg); err != nil {
+		return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to unmarshal text format: %v", err)
+	}
+	inputVal := ctx.newInputFunc()
+	if err := reflectutil.ProtoToStruct(msg, inputVal.Interface()); err != nil {
+		return reflect.Value{}, NewErrorf(CodeInvalidArgument, "failed to convert proto to struct: %v", err)
+	}
+	return inputVal, nil
+}
+
+// marshalProtoText encodes a response in the protobuf text format. Struct
+// messages are encoded through their dynamic descriptor.
+func marshalProtoText(output any, ctx *handlerContext) ([]byte, error) {
+	msg, ok := output.(proto.Message)
+	if !ok {
+		if ctx.outputCodec == nil {
+			return nil, errors.New("output codec not initialized")
+		}
+		dynamic := dynamicpb.NewMessage(ctx.outputCodec.Descriptor())
+		if err := reflectutil.StructToProto(output, dynamic); err != nil {
+			return nil, fmt.Errorf("failed to convert struct to proto: %w", err)
+		}
+		msg = dynamic
+	}
+	return protoTextMarshalOptions.Marshal(msg)
+}
@@ -0,0 +1,83 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ShipmentAddress struct {
+	City  string   `json:"city"`
+	Lines []string `json:"lines"`
+}
+
+type ShipmentRequest struct {
+	ID      int64            `json:"id"`
+	Address *ShipmentAddress `json:"address"`
+}
+
+type ShipmentResponse struct {
+	Label string `json:"label"`
+	Lines int32  `json:"lines"`
+}
+
+func TestProtoText(t *testing.T) {
+	newGateway := func(t *testing.T, opts ...rpc.ServiceOption) http.Handler {
+		t.Helper()
+		svc := rpc.NewService("ShipmentService", append([]rpc.ServiceOption{rpc.WithPackage("shipment.v1")}, opts...)...)
+		rpc.MustRegister(svc, "Ship", func(_ context.Context, req *ShipmentRequest) (*ShipmentResponse, error) {
+			if req.Address == nil {
+				return &ShipmentResponse{Label: "no address"}, nil
+			}
+			return &ShipmentResponse{Label: req.Address.City, Lines: int32(len(req.Address.Lines))}, nil //nolint:gosec // test input
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	// The text format randomizes whitespace, so only values are compared
+	const body = `id: 7 address { city: "Kyoto" lines: "1-2-3" lines: "Apt \"B\"" }`
+
+	tests := []struct {
+		name        string
+		opts        []rpc.ServiceOption
+		body        string
+		accept      string
+		wantStatus  int
+		contentType string
+		want        string
+	}{
+		{"JSON response by default", nil, body, "", http.StatusOK, "application/json", `"label":"Kyoto"`},
+		{"text response", []rpc.ServiceOption{rpc.WithProtoTextResponses(true)}, body, "", http.StatusOK, "text/x-protobuf", `"Kyoto"`},
+		{"JSON accepted", []rpc.ServiceOption{rpc.WithProtoTextResponses(true)}, body, "application/json", http.StatusOK, "application/json", `"lines":2`},
+		{"empty message", []rpc.ServiceOption{rpc.WithProtoTextResponses(true)}, "", "", http.StatusOK, "text/x-protobuf", `"no address"`},
+		{"invalid text", nil, `address { city: 1 }`, "", http.StatusBadRequest, "application/json", "failed to unmarshal text format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shipment.v1.ShipmentService/Ship", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/x-protobuf")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			newGateway(t, tt.opts...).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.contentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body = %s, want %s", rec.Body, tt.want)
+			}
+		})
+	}
+}
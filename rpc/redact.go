@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/i2y/hyperway/gateway"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// sensitiveTag marks struct fields holding secrets or personal data, whose
+// values are redacted wherever hyperway logs or echoes messages:
+//
+//	type SignupRequest struct {
+//		Email    string `json:"email" sensitive:"true"`
+//		Password string `json:"password" sensitive:"true"`
+//		Plan     string `json:"plan"`
+//	}
+const sensitiveTag = "sensitive"
+
+// RedactedValue replaces the values of sensitive fields.
+const RedactedValue = gateway.RedactedValue
+
+// maxRedactDepth bounds the nesting walked by Redact, so cyclic values end.
+const maxRedactDepth = 32
+
+// sensitiveTypes caches whether values of a type may hold sensitive fields.
+var sensitiveTypes sync.Map // reflect.Type -> bool
+
+// protoMessageType is the type of proto.Message, whose fields are redacted
+// with the debug_redact option rather than struct tags.
+var protoMessageType = reflect.TypeFor[proto.Message]()
+
+// Redact returns v for logging, with the values of struct fields tagged
+// `sensitive:"true"` replaced by RedactedValue. Values of types that can't
+// hold such fields are returned as they are; others are copied into maps and
+// slices that encode to the JSON encoding/json would produce, with the same
+// field names. Zero values of sensitive fields are kept, as they reveal
+// nothing but their absence.
+func Redact(v any) any {
+	if v == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(v), 0)
+}
+
+// redactValue redacts a value, see Redact.
+func redactValue(v reflect.Value, depth int) any {
+	switch {
+	case !v.IsValid() || !v.CanInterface():
+		return nil
+	case !maySensitive(v.Type()):
+		return v.Interface()
+	case depth > maxRedactDepth:
+		return RedactedValue
+	}
+
+	switch v.Kind() { //nolint:exhaustive // Only containers may hold struct fields
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), depth+1)
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			out[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value(), depth+1)
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]any)
+		redactStruct(v, out, depth)
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+// redactStruct adds the fields of a struct to out by JSON name, including the
+// promoted fields of embedded structs.
+func redactStruct(v reflect.Value, out map[string]any, depth int) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				redactStruct(fv, out, depth+1)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		switch {
+		case strings.Contains(opts, "omitempty") && fv.IsZero():
+		case sensitiveField(field) && !fv.IsZero():
+			out[name] = RedactedValue
+		default:
+			out[name] = redactValue(fv, depth+1)
+		}
+	}
+}
+
+// sensitiveField reports whether a struct field is tagged sensitive.
+func sensitiveField(field reflect.StructField) bool {
+	return field.Tag.Get(sensitiveTag) == "true"
+}
+
+// maySensitive reports whether values of t may hold sensitive fields, either
+// in their own struct fields or in interface values.
+func maySensitive(t reflect.Type) bool {
+	if cached, ok := sensitiveTypes.Load(t); ok {
+		return cached.(bool)
+	}
+	result := holdsSensitive(t, make(map[reflect.Type]bool))
+	sensitiveTypes.Store(t, result)
+	return result
+}
+
+// holdsSensitive implements maySensitive. Types being visited are skipped,
+// as the outer call sees all their fields.
+func holdsSensitive(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t.Implements(protoMessageType) || reflect.PointerTo(t).Implements(protoMessageType) {
+		return false
+	}
+	switch t.Kind() { //nolint:exhaustive // Other kinds hold no fields
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return holdsSensitive(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			return false
+		}
+		visiting[t] = true
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if (field.IsExported() || field.Anonymous) && (sensitiveField(field) || holdsSensitive(field.Type, visiting)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactProto returns a copy of msg without the fields marked with the
+// debug_redact option, or msg itself if it has none set.
+func redactProto(msg proto.Message) proto.Message {
+	if !hasRedactedFields(msg.ProtoReflect()) {
+		return msg
+	}
+	clone := proto.Clone(msg)
+	clearRedactedFields(clone.ProtoReflect())
+	return clone
+}
+
+// hasRedactedFields reports whether a debug_redact field of m or its nested
+// messages is set.
+func hasRedactedFields(m protoreflect.Message) bool {
+	found := false
+	rangeMessages(m, func(m protoreflect.Message, fd protoreflect.FieldDescriptor) bool {
+		found = debugRedact(fd)
+		return !found
+	})
+	return found
+}
+
+// clearRedactedFields clears the debug_redact fields of m and its nested
+// messages.
+func clearRedactedFields(m protoreflect.Message) {
+	var clears []func()
+	rangeMessages(m, func(m protoreflect.Message, fd protoreflect.FieldDescriptor) bool {
+		if debugRedact(fd) {
+			clears = append(clears, func() { m.Clear(fd) })
+		}
+		return true
+	})
+	for _, fn := range clears {
+		fn()
+	}
+}
+
+// rangeMessages calls fn with the set fields of m and of its nested messages
+// until fn returns false. Fields are not descended into when fn reports them.
+func rangeMessages(m protoreflect.Message, fn func(protoreflect.Message, protoreflect.FieldDescriptor) bool) bool {
+	more := true
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if more = fn(m, fd); !more || debugRedact(fd) {
+			return more
+		}
+		switch {
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			for i := 0; i < v.List().Len() && more; i++ {
+				more = rangeMessages(v.List().Get(i).Message(), fn)
+			}
+		case fd.IsMap() && fd.MapValue().Kind() == protoreflect.MessageKind:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				more = rangeMessages(mv.Message(), fn)
+				return more
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Kind() == protoreflect.MessageKind:
+			more = rangeMessages(v.Message(), fn)
+		}
+		return more
+	})
+	return more
+}
+
+// sensitiveDescriptor reports whether md or the messages it nests, which are
+// not in visited, have fields with the debug_redact option.
+func sensitiveDescriptor(md protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) bool {
+	if visited[md.FullName()] {
+		return false
+	}
+	visited[md.FullName()] = true
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if debugRedact(fd) {
+			return true
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Message() != nil && sensitiveDescriptor(fd.Message(), visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// debugRedact reports whether a field has the debug_redact option.
+func debugRedact(fd protoreflect.FieldDescriptor) bool {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && opts.GetDebugRedact()
+}
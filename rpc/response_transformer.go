@@ -0,0 +1,64 @@
+package rpc
+
+import "context"
+
+// ResponseTransformer returns the response of a unary call to encode in
+// place of msg, the response of the handler. It may change and return msg
+// itself, or return another message of the same type; nil keeps msg.
+type ResponseTransformer func(ctx context.Context, msg any) any
+
+// StreamResponseTransformer is a ResponseTransformer for the messages of
+// server streams, called with the index of each message in its stream,
+// starting at 0.
+type StreamResponseTransformer func(ctx context.Context, msg any, index int) any
+
+// WithResponseTransformer registers transform to post-process the responses
+// of unary calls of all protocols after the handler, its interceptors, and
+// computed fields, right before they are encoded, e.g. to trim fields by a
+// FieldMask of the request or format values for the caller's locale:
+//
+//	rpc.WithResponseTransformer(func(ctx context.Context, msg any) any {
+//		if u, ok := msg.(*User); ok && rpc.Meta(ctx).Get("X-Hide-Email") != "" {
+//			u.Email = ""
+//		}
+//		return msg
+//	})
+//
+// Several transformers run in registration order, each with the result of
+// the previous one. Errors are not transformed.
+func WithResponseTransformer(transform ResponseTransformer) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ResponseTransformers = append(o.ResponseTransformers, transform)
+	}
+}
+
+// WithStreamResponseTransformer registers transform to post-process each
+// message of server streams before it is encoded, like
+// WithResponseTransformer does for unary responses.
+func WithStreamResponseTransformer(transform StreamResponseTransformer) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StreamResponseTransformers = append(o.StreamResponseTransformers, transform)
+	}
+}
+
+// transformResponse applies the response transformers of the service to the
+// response msg of a unary call.
+func (s *Service) transformResponse(ctx context.Context, msg any) any {
+	for _, transform := range s.options.ResponseTransformers {
+		if transformed := transform(ctx, msg); transformed != nil {
+			msg = transformed
+		}
+	}
+	return msg
+}
+
+// transformStreamResponse applies the stream response transformers of the
+// service to message index of a server stream.
+func transformStreamResponse(transformers []StreamResponseTransformer, ctx context.Context, msg any, index int) any {
+	for _, transform := range transformers {
+		if transformed := transform(ctx, msg, index); transformed != nil {
+			msg = transformed
+		}
+	}
+	return msg
+}
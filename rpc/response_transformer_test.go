@@ -0,0 +1,77 @@
+package rpc_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+func TestResponseTransformer(t *testing.T) {
+	svc := rpc.NewService("TeamService", rpc.WithPackage("team.v1"),
+		rpc.WithComputedField(func(_ context.Context, m *TeamMember) error {
+			m.FullName = m.FirstName + " " + m.LastName
+			return nil
+		}),
+		rpc.WithResponseTransformer(func(ctx context.Context, msg any) any {
+			// Computed fields are filled before transformers run
+			m := msg.(*TeamMember)
+			if rpc.Meta(ctx).Get("X-Initials") != "" {
+				return &TeamMember{FullName: m.FirstName[:1] + m.LastName[:1]}
+			}
+			return nil
+		}),
+		rpc.WithResponseTransformer(func(_ context.Context, msg any) any {
+			m := msg.(*TeamMember)
+			m.FullName = strings.ToUpper(m.FullName)
+			return m
+		}),
+		rpc.WithStreamResponseTransformer(func(_ context.Context, msg any, index int) any {
+			m := msg.(*TeamMember)
+			m.FullName = fmt.Sprintf("%d. %s", index+1, m.FullName)
+			return m
+		}))
+	rpc.MustRegister(svc, "Get", func(_ context.Context, _ *TeamRequest) (*TeamMember, error) {
+		return &TeamMember{FirstName: "Ada", LastName: "Lovelace"}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "List", func(_ context.Context, _ *TeamRequest, stream rpc.ServerStream[TeamMember]) error {
+		if err := stream.Send(&TeamMember{FirstName: "Ada", LastName: "Lovelace"}); err != nil {
+			return err
+		}
+		return stream.Send(&TeamMember{FirstName: "Alan", LastName: "Turing"})
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(method string, header http.Header) string {
+		req := httptest.NewRequest(http.MethodPost, "/team.v1.TeamService/"+method, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	t.Run("transformers run in order on unary responses", func(t *testing.T) {
+		if body := call("Get", nil); !strings.Contains(body, `"full_name":"ADA LOVELACE"`) {
+			t.Errorf("Expected the transformed response, got %s", body)
+		}
+		if body := call("Get", http.Header{"X-Initials": {"1"}}); !strings.Contains(body, `"full_name":"AL"`) || strings.Contains(body, "Ada") {
+			t.Errorf("Expected the replaced response, got %s", body)
+		}
+	})
+
+	t.Run("stream transformers get the message index", func(t *testing.T) {
+		body := call("List", nil)
+		if !strings.Contains(body, `"full_name":"1. Ada Lovelace"`) || !strings.Contains(body, `"full_name":"2. Alan Turing"`) {
+			t.Errorf("Expected the transformed stream, got %s", body)
+		}
+	})
+}
@@ -33,6 +33,25 @@ type RetryPolicy struct {
 	RetryableStatusCodes []string `json:"retryableStatusCodes"`
 }
 
+// HedgingPolicy defines the hedging configuration for a method according to
+// gRPC spec. Hedged attempts run in parallel: the first attempt starts
+// immediately and another one starts after each HedgingDelay, until one
+// succeeds or fails with a fatal status code.
+type HedgingPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the original request.
+	// Must be greater than 1. Required.
+	MaxAttempts int `json:"maxAttempts"`
+
+	// HedgingDelay is the delay before starting the next attempt.
+	// Format: "0.5s", "500ms", etc. Default: 0 (all attempts start at once)
+	HedgingDelay string `json:"hedgingDelay,omitempty"`
+
+	// NonFatalStatusCodes defines which status codes allow the remaining
+	// attempts to continue. Other failures are returned immediately, and a
+	// non-fatal failure starts the next attempt without waiting for the delay.
+	NonFatalStatusCodes []string `json:"nonFatalStatusCodes,omitempty"`
+}
+
 // RetryThrottling controls client-side retry throttling.
 type RetryThrottling struct {
 	// MaxTokens is the maximum number of tokens in the bucket.
@@ -54,6 +73,9 @@ type MethodConfig struct {
 
 	// RetryPolicy for the method.
 	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// HedgingPolicy for the method. Mutually exclusive with RetryPolicy.
+	HedgingPolicy *HedgingPolicy `json:"hedgingPolicy,omitempty"`
 }
 
 // MethodName identifies a gRPC method.
@@ -72,6 +94,28 @@ type ServiceConfig struct {
 
 	// RetryThrottling controls client-side retry throttling.
 	RetryThrottling *RetryThrottling `json:"retryThrottling,omitempty"`
+
+	// LoadBalancingConfig lists the load balancing policies of clients in
+	// order of preference, each an object with the policy name as its only
+	// key, such as [{"round_robin": {}}]. Clients use the first policy they
+	// support.
+	LoadBalancingConfig []map[string]json.RawMessage `json:"loadBalancingConfig,omitempty"`
+
+	// LoadBalancingPolicy names the load balancing policy of clients, such as
+	// "round_robin". Deprecated by the gRPC spec: LoadBalancingConfig takes
+	// precedence.
+	LoadBalancingPolicy string `json:"loadBalancingPolicy,omitempty"`
+
+	// HealthCheckConfig enables client-side health checking of endpoints.
+	HealthCheckConfig *HealthCheckConfig `json:"healthCheckConfig,omitempty"`
+}
+
+// HealthCheckConfig configures client-side health checking with the
+// grpc.health.v1.Health service.
+type HealthCheckConfig struct {
+	// ServiceName is the service whose health is checked; empty for the
+	// overall health of the server.
+	ServiceName string `json:"serviceName"`
 }
 
 // ValidateRetryPolicy validates a retry policy according to gRPC spec.
@@ -104,25 +148,6 @@ func ValidateRetryPolicy(policy *RetryPolicy) error {
 	}
 
 	// Validate status codes
-	validStatusCodes := map[string]bool{
-		"CANCELED":            true,
-		"UNKNOWN":             true,
-		"INVALID_ARGUMENT":    true,
-		"DEADLINE_EXCEEDED":   true,
-		"NOT_FOUND":           true,
-		"ALREADY_EXISTS":      true,
-		"PERMISSION_DENIED":   true,
-		"RESOURCE_EXHAUSTED":  true,
-		"FAILED_PRECONDITION": true,
-		"ABORTED":             true,
-		"OUT_OF_RANGE":        true,
-		"UNIMPLEMENTED":       true,
-		"INTERNAL":            true,
-		"UNAVAILABLE":         true,
-		"DATA_LOSS":           true,
-		"UNAUTHENTICATED":     true,
-	}
-
 	for _, code := range policy.RetryableStatusCodes {
 		if !validStatusCodes[code] {
 			return fmt.Errorf("invalid retryable status code: %s", code)
@@ -132,6 +157,56 @@ func ValidateRetryPolicy(policy *RetryPolicy) error {
 	return nil
 }
 
+// validStatusCodes are the status code names accepted in service configs.
+var validStatusCodes = map[string]bool{
+	"CANCELED":            true,
+	"UNKNOWN":             true,
+	"INVALID_ARGUMENT":    true,
+	"DEADLINE_EXCEEDED":   true,
+	"NOT_FOUND":           true,
+	"ALREADY_EXISTS":      true,
+	"PERMISSION_DENIED":   true,
+	"RESOURCE_EXHAUSTED":  true,
+	"FAILED_PRECONDITION": true,
+	"ABORTED":             true,
+	"OUT_OF_RANGE":        true,
+	"UNIMPLEMENTED":       true,
+	"INTERNAL":            true,
+	"UNAVAILABLE":         true,
+	"DATA_LOSS":           true,
+	"UNAUTHENTICATED":     true,
+}
+
+// ValidateHedgingPolicy validates a hedging policy according to gRPC spec.
+func ValidateHedgingPolicy(policy *HedgingPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	// maxAttempts MUST be specified and MUST be greater than 1
+	if policy.MaxAttempts <= 1 {
+		return fmt.Errorf("maxAttempts must be greater than 1, got %d", policy.MaxAttempts)
+	}
+
+	if policy.HedgingDelay != "" {
+		delay, err := time.ParseDuration(policy.HedgingDelay)
+		if err != nil {
+			return fmt.Errorf("invalid hedgingDelay: %w", err)
+		}
+		if delay < 0 {
+			return fmt.Errorf("hedgingDelay must be non-negative, got %v", delay)
+		}
+	}
+
+	for _, code := range policy.NonFatalStatusCodes {
+		if !validStatusCodes[code] {
+			return fmt.Errorf("invalid non-fatal status code: %s", code)
+		}
+	}
+
+	return nil
+}
+
 // ValidateRetryThrottling validates retry throttling configuration.
 func ValidateRetryThrottling(throttling *RetryThrottling) error {
 	if throttling == nil {
@@ -158,11 +233,22 @@ func ParseServiceConfig(jsonConfig string) (*ServiceConfig, error) {
 		return nil, fmt.Errorf("failed to parse service config: %w", err)
 	}
 
-	// Validate all retry policies
+	// Validate all retry and hedging policies
 	for i, mc := range config.MethodConfig {
+		if mc.Timeout != "" {
+			if timeout, err := time.ParseDuration(mc.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout in methodConfig[%d]: %q", i, mc.Timeout)
+			}
+		}
+		if mc.RetryPolicy != nil && mc.HedgingPolicy != nil {
+			return nil, fmt.Errorf("methodConfig[%d] must not have both a retry and a hedging policy", i)
+		}
 		if err := ValidateRetryPolicy(mc.RetryPolicy); err != nil {
 			return nil, fmt.Errorf("invalid retry policy in methodConfig[%d]: %w", i, err)
 		}
+		if err := ValidateHedgingPolicy(mc.HedgingPolicy); err != nil {
+			return nil, fmt.Errorf("invalid hedging policy in methodConfig[%d]: %w", i, err)
+		}
 	}
 
 	// Validate retry throttling
@@ -170,9 +256,27 @@ func ParseServiceConfig(jsonConfig string) (*ServiceConfig, error) {
 		return nil, fmt.Errorf("invalid retry throttling: %w", err)
 	}
 
+	for i, lb := range config.LoadBalancingConfig {
+		if len(lb) != 1 {
+			return nil, fmt.Errorf("loadBalancingConfig[%d] must name exactly one policy, got %d", i, len(lb))
+		}
+	}
+
 	return &config, nil
 }
 
+// Backoff returns the delay before the retry following the given attempt,
+// counted from 1: exponential backoff capped at MaxBackoff, with ±20% jitter.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	return retryBackoff(p, attempt)
+}
+
+// FindMethodConfig returns the config of the method
+// "/package.Service/Method", or nil if no config names it or its service.
+func (c *ServiceConfig) FindMethodConfig(procedure string) *MethodConfig {
+	return findMethodConfig(c, procedure)
+}
+
 // retryBackoff calculates the backoff duration for a retry attempt.
 func retryBackoff(policy *RetryPolicy, attempt int) time.Duration {
 	if policy == nil || attempt <= 0 {
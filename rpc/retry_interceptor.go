@@ -4,6 +4,8 @@ package rpc
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,15 +15,25 @@ import (
 const (
 	methodPartsCount          = 3
 	throttleInitialTokenRatio = 2
+	tokenRatioScale           = 1000 // Decimal places beyond 3 are ignored
 )
 
-// RetryInterceptor implements retry logic according to gRPC specification.
+// RetryInterceptor implements retry and hedging logic according to gRPC specification.
+//
+// Methods with a retry policy are attempted again after retryable failures,
+// with exponential backoff. Methods with a hedging policy run several
+// attempts in parallel, so handlers of hedged methods must be idempotent and
+// safe to run concurrently. Handlers learn the number of previous attempts
+// via PreviousRPCAttempts.
 type RetryInterceptor struct {
 	serviceConfig *ServiceConfig
 	throttle      *retryThrottle
 }
 
 // retryThrottle implements token bucket algorithm for retry throttling.
+// Failed attempts take a token and successful ones return TokenRatio tokens.
+// Retries and hedged attempts are only permitted while more than half of the
+// tokens remain.
 type retryThrottle struct {
 	mu         sync.Mutex
 	maxTokens  float64
@@ -39,8 +51,8 @@ func NewRetryInterceptor(config *ServiceConfig) *RetryInterceptor {
 	if config != nil && config.RetryThrottling != nil {
 		interceptor.throttle = &retryThrottle{
 			maxTokens:  float64(config.RetryThrottling.MaxTokens),
-			tokens:     float64(config.RetryThrottling.MaxTokens) / throttleInitialTokenRatio, // Start at half capacity
-			tokenRatio: config.RetryThrottling.TokenRatio,
+			tokens:     float64(config.RetryThrottling.MaxTokens), // Start with a full bucket
+			tokenRatio: math.Floor(config.RetryThrottling.TokenRatio*tokenRatioScale) / tokenRatioScale,
 		}
 	}
 
@@ -54,18 +66,18 @@ func (r *RetryInterceptor) Intercept(
 	req any,
 	handler func(context.Context, any) (any, error),
 ) (any, error) {
-	// Find retry policy for this method
-	policy := r.findRetryPolicy(method)
-	if policy == nil {
-		// No retry policy, execute once
+	// Find retry or hedging policy for this method
+	config := r.findMethodConfig(procedureName(ctx, method))
+	switch {
+	case config == nil:
 		return handler(ctx, req)
-	}
-
-	// Check if we have tokens for retry
-	if !r.checkThrottle() {
-		// No tokens available, execute once without retry
+	case config.HedgingPolicy != nil:
+		return r.hedge(ctx, config.HedgingPolicy, req, handler)
+	case config.RetryPolicy == nil:
+		// No retry policy, execute once
 		return handler(ctx, req)
 	}
+	policy := config.RetryPolicy
 
 	var lastErr error
 	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
@@ -77,11 +89,12 @@ func (r *RetryInterceptor) Intercept(
 		}
 
 		// Execute the request
-		resp, err := handler(ctx, req)
+		resp, err := handler(withAttempt(ctx, attempt), req)
 
 		if err == nil {
 			// Success! Add tokens back
 			r.addTokens()
+			setPreviousAttemptsHeader(ctx, attempt)
 			return resp, nil
 		}
 
@@ -89,11 +102,14 @@ func (r *RetryInterceptor) Intercept(
 
 		// Check if error is retryable
 		if !r.isRetryable(err, policy) {
+			setPreviousAttemptsHeader(ctx, attempt)
 			return nil, err
 		}
+		r.consumeToken()
 
-		// Check if this is the last attempt
-		if attempt >= policy.MaxAttempts {
+		// Check if this is the last attempt, or retries are throttled
+		if attempt >= policy.MaxAttempts || !r.checkThrottle() {
+			setPreviousAttemptsHeader(ctx, attempt)
 			break
 		}
 
@@ -101,6 +117,7 @@ func (r *RetryInterceptor) Intercept(
 		if pushbackMs := extractPushbackMs(err); pushbackMs != 0 {
 			if pushbackMs < 0 {
 				// Negative value means don't retry
+				setPreviousAttemptsHeader(ctx, attempt)
 				return nil, err
 			}
 			// Wait for pushback duration
@@ -121,20 +138,20 @@ func (r *RetryInterceptor) Intercept(
 			return nil, ctx.Err()
 		case <-time.After(backoff):
 		}
-
-		// Consume a token for retry
-		if !r.consumeToken() {
-			// No more tokens, stop retrying
-			break
-		}
 	}
 
 	return nil, lastErr
 }
 
-// findRetryPolicy finds the retry policy for a given method.
-func (r *RetryInterceptor) findRetryPolicy(method string) *RetryPolicy {
-	if r.serviceConfig == nil {
+// findMethodConfig finds the method config for a given method.
+func (r *RetryInterceptor) findMethodConfig(method string) *MethodConfig {
+	return findMethodConfig(r.serviceConfig, method)
+}
+
+// findMethodConfig finds the config of a "/package.Service/Method" method in
+// config, or nil.
+func findMethodConfig(config *ServiceConfig, method string) *MethodConfig {
+	if config == nil {
 		return nil
 	}
 
@@ -148,7 +165,8 @@ func (r *RetryInterceptor) findRetryPolicy(method string) *RetryPolicy {
 	methodName := parts[2]
 
 	// Find matching method config
-	for _, mc := range r.serviceConfig.MethodConfig {
+	for i := range config.MethodConfig {
+		mc := &config.MethodConfig[i]
 		for _, name := range mc.Name {
 			// Check if service matches
 			if name.Service != serviceName {
@@ -157,7 +175,7 @@ func (r *RetryInterceptor) findRetryPolicy(method string) *RetryPolicy {
 
 			// If method is empty, it applies to all methods in the service
 			if name.Method == "" || name.Method == methodName {
-				return mc.RetryPolicy
+				return mc
 			}
 		}
 	}
@@ -165,6 +183,69 @@ func (r *RetryInterceptor) findRetryPolicy(method string) *RetryPolicy {
 	return nil
 }
 
+// procedureName returns the full "/package.Service/Method" name of a call.
+// Services pass the bare method name to interceptors, so the full name is
+// taken from the handler context.
+func procedureName(ctx context.Context, method string) string {
+	if strings.HasPrefix(method, "/") {
+		return method
+	}
+	if hctx := GetHandlerContext(ctx); hctx != nil && hctx.procedure != "" {
+		return hctx.procedure
+	}
+	return method
+}
+
+// PreviousRPCAttemptsHeader carries the number of preceding attempts of a call.
+// Clients that retry send it with requests, and the retry interceptor sets it
+// on responses when the server made several attempts.
+const PreviousRPCAttemptsHeader = "Grpc-Previous-Rpc-Attempts"
+
+// previousAttemptsContextKey stores the number of previous attempts of a call.
+const previousAttemptsContextKey contextKey = "hyperway-previous-rpc-attempts"
+
+// PreviousRPCAttempts returns the number of attempts of the current call that
+// preceded this one, counting attempts made by the client (as reported in the
+// grpc-previous-rpc-attempts request header) and by the retry interceptor.
+func PreviousRPCAttempts(ctx context.Context) int {
+	if n, ok := ctx.Value(previousAttemptsContextKey).(int); ok {
+		return n
+	}
+	return clientPreviousAttempts(ctx)
+}
+
+// clientPreviousAttempts returns the number of attempts reported by the client.
+func clientPreviousAttempts(ctx context.Context) int {
+	hctx := GetHandlerContext(ctx)
+	if hctx == nil {
+		return 0
+	}
+	values := hctx.GetRequestHeader(PreviousRPCAttemptsHeader)
+	if len(values) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(values[0])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// withAttempt returns the context for the given attempt of a call, starting at 1.
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, previousAttemptsContextKey, clientPreviousAttempts(ctx)+attempt-1)
+}
+
+// setPreviousAttemptsHeader reports the attempts that preceded the final one.
+func setPreviousAttemptsHeader(ctx context.Context, attempt int) {
+	if attempt <= 1 {
+		return
+	}
+	if hctx := GetHandlerContext(ctx); hctx != nil {
+		hctx.SetResponseHeader(PreviousRPCAttemptsHeader, strconv.Itoa(clientPreviousAttempts(ctx)+attempt-1))
+	}
+}
+
 // isRetryable checks if an error is retryable according to the policy.
 func (r *RetryInterceptor) isRetryable(err error, policy *RetryPolicy) bool {
 	if err == nil || policy == nil {
@@ -184,7 +265,7 @@ func (r *RetryInterceptor) isRetryable(err error, policy *RetryPolicy) bool {
 	return false
 }
 
-// checkThrottle checks if retry is allowed by throttle.
+// checkThrottle checks if another attempt is allowed by throttle.
 func (r *RetryInterceptor) checkThrottle() bool {
 	if r.throttle == nil {
 		return true
@@ -193,24 +274,19 @@ func (r *RetryInterceptor) checkThrottle() bool {
 	r.throttle.mu.Lock()
 	defer r.throttle.mu.Unlock()
 
-	return r.throttle.tokens >= 1
+	return r.throttle.tokens > r.throttle.maxTokens/throttleInitialTokenRatio
 }
 
-// consumeToken consumes a token for retry.
-func (r *RetryInterceptor) consumeToken() bool {
+// consumeToken takes a token after a failed attempt.
+func (r *RetryInterceptor) consumeToken() {
 	if r.throttle == nil {
-		return true
+		return
 	}
 
 	r.throttle.mu.Lock()
 	defer r.throttle.mu.Unlock()
 
-	if r.throttle.tokens >= 1 {
-		r.throttle.tokens--
-		return true
-	}
-
-	return false
+	r.throttle.tokens = math.Max(r.throttle.tokens-1, 0)
 }
 
 // addTokens adds tokens back after successful RPC.
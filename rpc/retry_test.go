@@ -3,8 +3,14 @@ package rpc
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const (
@@ -372,3 +378,244 @@ func TestParseServiceConfig(t *testing.T) {
 		t.Errorf("Expected max tokens 100, got %d", config.RetryThrottling.MaxTokens)
 	}
 }
+
+func TestParseServiceConfigHedging(t *testing.T) {
+	config, err := ParseServiceConfig(`{
+		"methodConfig": [{
+			"name": [{"service": "test.Service"}],
+			"hedgingPolicy": {
+				"maxAttempts": 3,
+				"hedgingDelay": "0.5s",
+				"nonFatalStatusCodes": ["UNAVAILABLE"]
+			}
+		}]
+	}`)
+	if err != nil {
+		t.Fatalf("Failed to parse service config: %v", err)
+	}
+	policy := config.MethodConfig[0].HedgingPolicy
+	if policy == nil || policy.MaxAttempts != 3 || policy.HedgingDelay != "0.5s" {
+		t.Errorf("Unexpected hedging policy: %+v", policy)
+	}
+
+	invalid := map[string]string{
+		"both policies": `{"methodConfig": [{
+			"name": [{"service": "test.Service"}],
+			"retryPolicy": {"maxAttempts": 2, "retryableStatusCodes": ["UNAVAILABLE"]},
+			"hedgingPolicy": {"maxAttempts": 2}
+		}]}`,
+		"max attempts": `{"methodConfig": [{"hedgingPolicy": {"maxAttempts": 1}}]}`,
+		"delay":        `{"methodConfig": [{"hedgingPolicy": {"maxAttempts": 2, "hedgingDelay": "-1s"}}]}`,
+		"status code":  `{"methodConfig": [{"hedgingPolicy": {"maxAttempts": 2, "nonFatalStatusCodes": ["NOPE"]}}]}`,
+	}
+	for name, jsonConfig := range invalid {
+		if _, err := ParseServiceConfig(jsonConfig); err == nil {
+			t.Errorf("Expected error for invalid %s", name)
+		}
+	}
+}
+
+func TestParseServiceConfigLoadBalancing(t *testing.T) {
+	config, err := ParseServiceConfig(`{
+		"loadBalancingConfig": [{"weighted_round_robin": {}}, {"round_robin": {}}],
+		"loadBalancingPolicy": "pick_first",
+		"healthCheckConfig": {"serviceName": "test.Service"}
+	}`)
+	if err != nil {
+		t.Fatalf("Failed to parse service config: %v", err)
+	}
+	if len(config.LoadBalancingConfig) != 2 || config.LoadBalancingConfig[1]["round_robin"] == nil {
+		t.Errorf("Unexpected load balancing config: %v", config.LoadBalancingConfig)
+	}
+	if config.LoadBalancingPolicy != "pick_first" {
+		t.Errorf("Expected load balancing policy pick_first, got %s", config.LoadBalancingPolicy)
+	}
+	if config.HealthCheckConfig == nil || config.HealthCheckConfig.ServiceName != "test.Service" {
+		t.Errorf("Unexpected health check config: %+v", config.HealthCheckConfig)
+	}
+
+	if _, err := ParseServiceConfig(`{"loadBalancingConfig": [{"pick_first": {}, "round_robin": {}}]}`); err == nil {
+		t.Error("Expected error for a load balancing config with two policies")
+	}
+}
+
+func TestHedging(t *testing.T) {
+	newInterceptor := func(delay string, throttling *RetryThrottling) *RetryInterceptor {
+		return NewRetryInterceptor(&ServiceConfig{
+			MethodConfig: []MethodConfig{{
+				Name: []MethodName{{Service: "test.Service"}},
+				HedgingPolicy: &HedgingPolicy{
+					MaxAttempts:         3,
+					HedgingDelay:        delay,
+					NonFatalStatusCodes: []string{"UNAVAILABLE"},
+				},
+			}},
+			RetryThrottling: throttling,
+		})
+	}
+
+	t.Run("First Success Wins", func(t *testing.T) {
+		var calls, canceled atomic.Int32
+		handler := func(ctx context.Context, req any) (any, error) {
+			attempt := PreviousRPCAttempts(ctx) + 1
+			calls.Add(1)
+			if attempt == 2 {
+				return testSuccess, nil
+			}
+			// The first attempt is slow and loses
+			select {
+			case <-ctx.Done():
+				canceled.Add(1)
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+				return "slow", nil
+			}
+		}
+
+		start := time.Now()
+		resp, err := newInterceptor("20ms", nil).Intercept(context.Background(), "/test.Service/Method", "req", handler)
+		duration := time.Since(start)
+		if err != nil || resp != testSuccess {
+			t.Fatalf("Expected success, got %v, %v", resp, err)
+		}
+		if duration < 15*time.Millisecond || duration > 500*time.Millisecond {
+			t.Errorf("Expected the second attempt after the hedging delay, took %v", duration)
+		}
+		if calls.Load() != 2 || canceled.Load() != 1 {
+			t.Errorf("Expected 2 calls with the losing one canceled, got %d calls, %d canceled", calls.Load(), canceled.Load())
+		}
+	})
+
+	t.Run("Fatal Error", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := func(ctx context.Context, req any) (any, error) {
+			calls.Add(1)
+			return nil, &Error{Code: CodeInvalidArgument}
+		}
+
+		_, err := newInterceptor("1h", nil).Intercept(context.Background(), "/test.Service/Method", "req", handler)
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if calls.Load() != 1 {
+			t.Errorf("Expected 1 call, got %d", calls.Load())
+		}
+	})
+
+	t.Run("Non-Fatal Errors", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := func(ctx context.Context, req any) (any, error) {
+			calls.Add(1)
+			return nil, &Error{Code: CodeUnavailable}
+		}
+
+		// Non-fatal failures start the next attempt without waiting for the delay
+		start := time.Now()
+		_, err := newInterceptor("1h", nil).Intercept(context.Background(), "/test.Service/Method", "req", handler)
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if calls.Load() != 3 {
+			t.Errorf("Expected 3 calls, got %d", calls.Load())
+		}
+		if duration := time.Since(start); duration > time.Second {
+			t.Errorf("Expected no hedging delay, took %v", duration)
+		}
+	})
+
+	t.Run("Throttled", func(t *testing.T) {
+		interceptor := newInterceptor("0s", &RetryThrottling{MaxTokens: 4, TokenRatio: 0.1})
+		var calls atomic.Int32
+		handler := func(ctx context.Context, req any) (any, error) {
+			calls.Add(1)
+			return nil, &Error{Code: CodeUnavailable}
+		}
+
+		// Two failures leave half of the tokens, which stops further hedges
+		_, _ = interceptor.Intercept(context.Background(), "/test.Service/Method", "req", handler)
+		calls.Store(0)
+		_, _ = interceptor.Intercept(context.Background(), "/test.Service/Method", "req", handler)
+		if calls.Load() != 1 {
+			t.Errorf("Expected 1 call due to throttling, got %d", calls.Load())
+		}
+	})
+}
+
+func TestRetryThrottleTokens(t *testing.T) {
+	interceptor := NewRetryInterceptor(&ServiceConfig{
+		RetryThrottling: &RetryThrottling{MaxTokens: 10, TokenRatio: 0.5555},
+	})
+
+	// Retries are allowed while more than half of the tokens remain
+	for range 4 {
+		interceptor.consumeToken()
+	}
+	if !interceptor.checkThrottle() {
+		t.Error("Expected retries to be allowed with 6 tokens")
+	}
+	interceptor.consumeToken()
+	if interceptor.checkThrottle() {
+		t.Error("Expected retries to be throttled with 5 tokens")
+	}
+
+	// Successes return tokenRatio tokens, truncated to three decimal places
+	interceptor.addTokens()
+	if got := interceptor.throttle.tokens; got != 5.555 {
+		t.Errorf("Expected 5.555 tokens, got %v", got)
+	}
+	for range 20 {
+		interceptor.addTokens()
+	}
+	if got := interceptor.throttle.tokens; got != 10 {
+		t.Errorf("Expected tokens capped at 10, got %v", got)
+	}
+}
+
+func TestRetryInterceptorService(t *testing.T) {
+	config := &ServiceConfig{
+		MethodConfig: []MethodConfig{{
+			Name: []MethodName{{Service: "retry.v1.RetryService", Method: "Echo"}},
+			RetryPolicy: &RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       "1ms",
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			},
+		}},
+	}
+
+	svc := NewService("RetryService",
+		WithPackage("retry.v1"),
+		WithInterceptors(NewRetryInterceptor(config)),
+	)
+	MustRegister(svc, "Echo", func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		previous := PreviousRPCAttempts(ctx)
+		if previous < 3 {
+			return nil, NewError(CodeUnavailable, "try again")
+		}
+		return wrapperspb.String(fmt.Sprint(previous)), nil
+	})
+
+	gw, err := NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		http.DefaultClient, server.URL+"/retry.v1.RetryService/Echo")
+	req := connect.NewRequest(&wrapperspb.StringValue{})
+	req.Header().Set(PreviousRPCAttemptsHeader, "1")
+	resp, err := client.CallUnary(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	// The client already made one attempt, and the server succeeds on its third
+	if got := resp.Msg.GetValue(); got != "3" {
+		t.Errorf("Expected the handler to see 3 previous attempts, got %q", got)
+	}
+	if got := resp.Header().Get(PreviousRPCAttemptsHeader); got != "3" {
+		t.Errorf("Expected %s: 3, got %q", PreviousRPCAttemptsHeader, got)
+	}
+}
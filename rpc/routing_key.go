@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+// DefaultRoutingKeyHeader is the response header carrying the routing key of a stream.
+const DefaultRoutingKeyHeader = "X-Routing-Key"
+
+// routingKeyContextKey stores the routing key of the current stream.
+const routingKeyContextKey contextKey = "hyperway-routing-key"
+
+// WithRoutingKey derives a routing key for a streaming method from a field of its
+// first request message. fieldPath is a dot-separated path such as
+// "session.id"; each segment matches a JSON name, protobuf field name, or Go
+// field name. The key is sent in the response header configured with
+// WithRoutingKeyHeader so L7 load balancers can route resumed sessions to the
+// same backend, and is available to handlers via RoutingKey.
+func WithRoutingKey(method, fieldPath string) ServiceOption {
+	return func(o *ServiceOptions) {
+		if o.RoutingKeys == nil {
+			o.RoutingKeys = make(map[string]string)
+		}
+		o.RoutingKeys[method] = fieldPath
+	}
+}
+
+// WithRoutingKeyHeader sets the response header carrying routing keys
+// (default: "X-Routing-Key").
+func WithRoutingKeyHeader(header string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.RoutingKeyHeader = header
+	}
+}
+
+// WithRoutingKey derives a routing key from a field of the first request message.
+// See the service option of the same name for the field path syntax.
+func (m *MethodBuilder) WithRoutingKey(fieldPath string) *MethodBuilder {
+	m.method.Options.RoutingKey = fieldPath
+	return m
+}
+
+// RoutingKey returns the routing key derived for the current stream, or "" if none.
+func RoutingKey(ctx context.Context) string {
+	key, _ := ctx.Value(routingKeyContextKey).(string)
+	return key
+}
+
+// routingKeyPath returns the configured field path for a method.
+func (s *Service) routingKeyPath(method *Method) string {
+	if method.Options.RoutingKey != "" {
+		return method.Options.RoutingKey
+	}
+	return s.options.RoutingKeys[method.Name]
+}
+
+// applyRoutingKey extracts the routing key from the first request message,
+// exposes it in the response headers, and returns a context carrying it.
+func (s *Service) applyRoutingKey(ctx context.Context, w http.ResponseWriter, method *Method, input reflect.Value) context.Context {
+	path := s.routingKeyPath(method)
+	if path == "" {
+		return ctx
+	}
+	key, ok := extractRoutingKey(input, path)
+	if !ok || key == "" {
+		return ctx
+	}
+
+	header := s.options.RoutingKeyHeader
+	if header == "" {
+		header = DefaultRoutingKeyHeader
+	}
+	w.Header().Set(header, key)
+	return context.WithValue(ctx, routingKeyContextKey, key)
+}
+
+// extractRoutingKey resolves a dot-separated field path against a request message.
+func extractRoutingKey(v reflect.Value, path string) (string, bool) {
+	if v.IsValid() && v.CanInterface() {
+		if msg, ok := v.Interface().(proto.Message); ok {
+			return extractProtoRoutingKey(msg.ProtoReflect(), path)
+		}
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		v = reflect.Indirect(v)
+		if !v.IsValid() {
+			return "", false
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			v = structFieldByPathSegment(v, segment)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return "", false
+			}
+			v = v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+		default:
+			return "", false
+		}
+	}
+
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return "", false
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// structFieldByPathSegment finds the struct field matching a path segment by
+// JSON name, Go name, or snake_case name. Fields promoted from nil embedded
+// structs are invalid.
+func structFieldByPathSegment(v reflect.Value, segment string) reflect.Value {
+	if field, ok := structFieldByName(v.Type(), segment); ok {
+		if v, err := v.FieldByIndexErr(field.Index); err == nil {
+			return v
+		}
+	}
+	return reflect.Value{}
+}
+
+// structFieldByName finds the field of a struct type matching a path segment,
+// see structFieldByPathSegment. Fields of flattened embedded structs match as
+// the fields of their message do.
+func structFieldByName(t reflect.Type, segment string) (reflect.StructField, bool) {
+	normalized := strings.ReplaceAll(segment, "_", "")
+	for _, messageField := range schema.MessageFields(t) {
+		field := messageField.StructField
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name == segment {
+			return field, true
+		}
+		if strings.EqualFold(field.Name, normalized) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// extractProtoRoutingKey resolves a field path against a protobuf message.
+func extractProtoRoutingKey(msg protoreflect.Message, path string) (string, bool) {
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		fields := msg.Descriptor().Fields()
+		fd := fields.ByName(protoreflect.Name(segment))
+		if fd == nil {
+			fd = fields.ByJSONName(segment)
+		}
+		if fd == nil || !msg.Has(fd) {
+			return "", false
+		}
+		value := msg.Get(fd)
+		if i == len(segments)-1 {
+			if fd.Kind() == protoreflect.EnumKind {
+				if ev := fd.Enum().Values().ByNumber(value.Enum()); ev != nil {
+					return string(ev.Name()), true
+				}
+			}
+			return value.String(), true
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return "", false
+		}
+		msg = value.Message()
+	}
+	return "", false
+}
@@ -1,6 +1,7 @@
 package rpc_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,6 +13,8 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/protobuf/encoding/protowire"
+
 	"github.com/i2y/hyperway/rpc"
 )
 
@@ -91,6 +94,60 @@ func TestService_MethodRegistration(t *testing.T) {
 	}
 }
 
+func TestService_MessageNameCollisions(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type ItemList struct {
+		Items []Item `json:"items"`
+	}
+	type StockItem struct {
+		Stock struct {
+			Item struct {
+				SKU string `json:"sku"`
+			} `json:"item"`
+		} `json:"stock"`
+	}
+	svc := rpc.NewService("ItemService", rpc.WithPackage("collisions.v1"))
+	rpc.MustRegister(svc, "ListItems", func(context.Context, *CreateUserRequest) (*ItemList, error) {
+		return &ItemList{}, nil
+	})
+	// Anonymous structs are named after their parents, so they don't collide
+	rpc.MustRegister(svc, "GetStock", func(context.Context, *StockItem) (*CreateUserResponse, error) {
+		return &CreateUserResponse{}, nil
+	})
+
+	err := func() error {
+		type Item struct {
+			SKU int64 `json:"sku"`
+		}
+		type ItemList struct {
+			Items []Item `json:"items"`
+		}
+		return rpc.Register(svc, "ListOtherItems", func(context.Context, *CreateUserRequest) (*ItemList, error) {
+			return &ItemList{}, nil
+		})
+	}()
+	if err == nil || !strings.Contains(err.Error(), "message collisions.v1.Item would describe both") ||
+		!strings.Contains(err.Error(), "of ListItems") {
+		t.Fatalf("Expected a message name collision, got %v", err)
+	}
+
+	// Exports are stable across runs
+	first, err := svc.ExportProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if again, _ := svc.ExportProto(); again != first {
+			t.Fatalf("Expected the same export, got:\n%s\nthen:\n%s", first, again)
+		}
+	}
+	if !strings.Contains(first, "message StockItem_Stock_Item {") {
+		t.Errorf("Expected parent-prefixed anonymous messages, got:\n%s", first)
+	}
+}
+
 func TestService_HTTPHandler(t *testing.T) {
 	svc := rpc.NewService("UserService", rpc.WithPackage("user.v1"))
 
@@ -475,9 +532,9 @@ func TestConnectTimeoutHeader(t *testing.T) {
 		}
 		defer func() { _ = resp.Body.Close() }()
 
-		// Should return 200 with error in body (Connect protocol)
-		if resp.StatusCode != http.StatusOK {
-			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		// Connect unary errors have the HTTP status of their code
+		if resp.StatusCode != http.StatusGatewayTimeout {
+			t.Errorf("Expected status 504, got %d", resp.StatusCode)
 		}
 
 		var result map[string]any
@@ -588,9 +645,9 @@ func TestErrorCodes(t *testing.T) {
 			}
 			defer func() { _ = resp.Body.Close() }()
 
-			// Connect protocol returns 200 with error in body
-			if resp.StatusCode != http.StatusOK {
-				t.Errorf("Expected status 200, got %d", resp.StatusCode)
+			// Connect unary errors have the HTTP status of their code
+			if want := rpc.Code(tt.expectedCode).HTTPStatusCode(); resp.StatusCode != want {
+				t.Errorf("Expected status %d, got %d", want, resp.StatusCode)
 			}
 
 			var result map[string]any
@@ -642,3 +699,79 @@ func BenchmarkService_JSONRequest(b *testing.B) {
 		_ = resp.Body.Close()
 	}
 }
+
+type PatchItemRequest struct {
+	Count *int32  `json:"count"`
+	Name  *string `json:"name"`
+	Flag  *bool   `json:"flag"`
+}
+
+func TestPointerScalarsAsWrappers(t *testing.T) {
+	svc := rpc.NewService("ItemService", rpc.WithPackage("item.v1"), rpc.WithPointerScalarsAsWrappers(true))
+	rpc.MustRegister(svc, "Patch", func(_ context.Context, req *PatchItemRequest) (*PatchItemRequest, error) {
+		if req.Count == nil || *req.Count != 7 || req.Name == nil || *req.Name != "" || req.Flag != nil {
+			return nil, rpc.NewErrorf(rpc.CodeInvalidArgument, "unexpected request %+v", req)
+		}
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	exported, err := svc.ExportProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`import "google/protobuf/wrappers.proto";`, "google.protobuf.Int32Value count = 1;", "google.protobuf.BoolValue flag = 3;"} {
+		if !strings.Contains(exported, want) {
+			t.Errorf("Expected %q in the exported proto:\n%s", want, exported)
+		}
+	}
+
+	t.Run("gRPC", func(t *testing.T) {
+		// count = Int32Value{value: 7}, name = StringValue{}, flag unset
+		payload := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType),
+			protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 7))
+		payload = protowire.AppendBytes(protowire.AppendTag(payload, 2, protowire.BytesType), nil)
+		frame := append([]byte{0, 0, 0, 0, byte(len(payload))}, payload...)
+		req := httptest.NewRequest(http.MethodPost, "/item.v1.ItemService/Patch", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		if status := rec.Header().Get("Grpc-Status"); status != "0" {
+			t.Fatalf("grpc-status = %q: %s", status, rec.Header().Get("Grpc-Message"))
+		}
+		// Fields may be encoded in any order
+		fields := func(b []byte) map[protowire.Number][]byte {
+			m := make(map[protowire.Number][]byte)
+			for len(b) > 0 {
+				num, _, n := protowire.ConsumeField(b)
+				if n < 0 {
+					t.Fatalf("Malformed message %x", b)
+				}
+				m[num], b = b[:n], b[n:]
+			}
+			return m
+		}
+		got, want := fields(rec.Body.Bytes()[5:]), fields(payload)
+		if len(got) != len(want) || !bytes.Equal(got[1], want[1]) || !bytes.Equal(got[2], want[2]) {
+			t.Errorf("Expected the wrappers to round-trip, got %x, want %x", rec.Body.Bytes()[5:], payload)
+		}
+	})
+
+	t.Run("gRPC-JSON", func(t *testing.T) {
+		const body = `{"count":7,"name":""}`
+		frame := append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+		req := httptest.NewRequest(http.MethodPost, "/item.v1.ItemService/Patch", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		got := strings.ReplaceAll(rec.Body.String(), " ", "")
+		if !strings.Contains(got, `{"count":7,"name":"","flag":null}`) {
+			t.Errorf("Unexpected response %q: %s", got, rec.Header().Get("Grpc-Message"))
+		}
+	})
+}
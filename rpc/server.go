@@ -0,0 +1,474 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	ossignal "os/signal"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// Server defaults
+const (
+	defaultReadHeaderTimeout    = 10 * time.Second  // Slowloris mitigation
+	defaultIdleTimeout          = 120 * time.Second // Close idle keep-alive connections
+	defaultMaxConcurrentStreams = 250
+	defaultShutdownTimeout      = 30 * time.Second // Time for calls in flight to complete on shutdown
+)
+
+// clientIdentityContextKey stores the verified client certificate identity.
+const clientIdentityContextKey contextKey = "hyperway-client-identity"
+
+// ServerOption configures a server created by NewServer or ListenAndServe.
+type ServerOption func(*serverOptions)
+
+// serverOptions holds server configuration.
+type serverOptions struct {
+	certFile          string
+	keyFile           string
+	tlsConfig         *tls.Config
+	clientCAs         *x509.CertPool
+	clientAuth        *tls.ClientAuthType
+	keepalive         *gateway.KeepaliveParameters
+	enforcement       *gateway.KeepaliveEnforcementPolicy
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	shutdownTimeout   time.Duration
+	maxStreams        uint32
+	maxConnsPerIP     int
+	onConnLimit       func(gateway.ClientLimitEvent)
+	http3             bool
+	proxyProtocol     bool
+	trustedProxies    []string
+}
+
+// WithTLS serves HTTP/2 over TLS with the given certificate and key files.
+// Without TLS, the server accepts HTTP/1.1 and cleartext HTTP/2 (h2c).
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(o *serverOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithTLSConfig sets the base TLS configuration, e.g. to load certificates
+// dynamically with GetCertificate. It is cloned before use.
+func WithTLSConfig(config *tls.Config) ServerOption {
+	return func(o *serverOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithClientCAs enables mutual TLS. Clients must present a certificate signed
+// by one of the CAs in pool, and its identity is available to handlers via
+// ClientIdentityFromContext.
+func WithClientCAs(pool *x509.CertPool) ServerOption {
+	return func(o *serverOptions) {
+		o.clientCAs = pool
+	}
+}
+
+// WithClientAuth overrides the client certificate policy, e.g.
+// tls.VerifyClientCertIfGiven to accept clients without certificates.
+// The default is tls.RequireAndVerifyClientCert when client CAs are set.
+func WithClientAuth(auth tls.ClientAuthType) ServerOption {
+	return func(o *serverOptions) {
+		o.clientAuth = &auth
+	}
+}
+
+// WithKeepalive sends HTTP/2 PING frames after Time without reads and closes
+// connections whose PING is not acknowledged within Timeout. MaxConnectionIdle,
+// MaxConnectionAge, and MaxConnectionAgeGrace bound the lifetime of connections.
+func WithKeepalive(params gateway.KeepaliveParameters) ServerOption {
+	return func(o *serverOptions) {
+		o.keepalive = &params
+	}
+}
+
+// WithKeepaliveEnforcement closes HTTP/2 connections of clients that send
+// PING frames more often than policy permits with a GOAWAY frame
+// (ENHANCE_YOUR_CALM, "too_many_pings"), as gRPC servers do.
+func WithKeepaliveEnforcement(policy gateway.KeepaliveEnforcementPolicy) ServerOption {
+	return func(o *serverOptions) {
+		o.enforcement = &policy
+	}
+}
+
+// WithReadHeaderTimeout sets the time allowed to read request headers (default: 10s).
+func WithReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.readHeaderTimeout = timeout
+	}
+}
+
+// WithReadTimeout bounds the time to read a request, including its body (default:
+// none). It also bounds client and bidirectional streams, so only set it if the
+// service has none.
+func WithReadTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout bounds the time to write a response (default: none). It also
+// bounds server and bidirectional streams, so only set it if the service has
+// none.
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithMaxHeaderBytes limits the size of request headers, including HTTP/2
+// header lists (default: 1 MiB).
+func WithMaxHeaderBytes(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxHeaderBytes = n
+	}
+}
+
+// WithShutdownTimeout sets how long Run waits for calls in flight to complete
+// when shutting down, before closing the remaining connections (default: 30s).
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithIdleTimeout sets how long idle connections are kept open (default: 120s).
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxConcurrentStreams limits concurrent HTTP/2 streams per connection (default: 250).
+func WithMaxConcurrentStreams(streams uint32) ServerOption {
+	return func(o *serverOptions) {
+		o.maxStreams = streams
+	}
+}
+
+// WithMaxConnectionsPerIP closes new connections of remote IPs that already
+// have max connections open, so a single client can't exhaust the server.
+// onLimit, if not nil, is called for each rejected connection.
+func WithMaxConnectionsPerIP(maxConns int, onLimit func(gateway.ClientLimitEvent)) ServerOption {
+	return func(o *serverOptions) {
+		o.maxConnsPerIP = maxConns
+		o.onConnLimit = onLimit
+	}
+}
+
+// WithHTTP3 makes ListenAndServe also serve HTTP/3 over QUIC on the UDP port
+// of its address, and advertise it to HTTP/1.1 and HTTP/2 clients with the
+// Alt-Svc header. HTTP/3 requires TLS. Use NewHTTP3Server to run the HTTP/3
+// server separately.
+func WithHTTP3() ServerOption {
+	return func(o *serverOptions) {
+		o.http3 = true
+	}
+}
+
+// WithProxyProtocol makes ListenAndServe read the PROXY protocol header that
+// load balancers such as HAProxy or AWS Network Load Balancers send first on
+// connections from trustedProxies, or on all connections without any, so
+// clients are identified by their own address. See
+// gateway.NewProxyProtocolListener to use it with servers created by
+// NewServer. HTTP/3 connections don't carry the header.
+func WithProxyProtocol(trustedProxies ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.proxyProtocol = true
+		o.trustedProxies = trustedProxies
+	}
+}
+
+// ClientIdentity is the identity of a client authenticated with a verified
+// TLS certificate.
+type ClientIdentity struct {
+	// Certificate is the verified leaf certificate.
+	Certificate *x509.Certificate
+	// CommonName is the subject common name.
+	CommonName string
+	// DNSNames are the DNS subject alternative names.
+	DNSNames []string
+	// URIs are the URI subject alternative names, such as SPIFFE IDs.
+	URIs []string
+	// EmailAddresses are the email subject alternative names.
+	EmailAddresses []string
+}
+
+// ClientIdentityFromContext returns the verified client certificate identity
+// of the current request, or false if the client did not present a verified
+// certificate.
+func ClientIdentityFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	identity, ok := ctx.Value(clientIdentityContextKey).(*ClientIdentity)
+	return identity, ok
+}
+
+// newClientIdentity builds the identity of a verified certificate.
+func newClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	identity := &ClientIdentity{
+		Certificate:    cert,
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity
+}
+
+// withClientIdentity exposes verified client certificates to handlers.
+func withClientIdentity(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			identity := newClientIdentity(r.TLS.VerifiedChains[0][0])
+			r = r.WithContext(context.WithValue(r.Context(), clientIdentityContextKey, identity))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// NewServer creates an HTTP server for handler, usually a gateway, configured
+// for gRPC, Connect, and gRPC-Web clients. With TLS it negotiates HTTP/2 via
+// ALPN; without TLS it accepts HTTP/1.1 and h2c. Read and write timeouts are
+// not set by default, since they would cut off long-lived streams. Use Run to
+// serve with graceful shutdown.
+func NewServer(addr string, handler http.Handler, opts ...ServerOption) (*http.Server, error) {
+	server, _, err := newServerOptions(opts).newServer(addr, handler)
+	return server, err
+}
+
+// newServer creates the server of NewServer, with the transport serving its
+// HTTP/2 connections.
+func (o *serverOptions) newServer(addr string, handler http.Handler) (*http.Server, *gateway.HTTP2Transport, error) {
+	transport := gateway.NewHTTP2Transport(gateway.Options{
+		KeepaliveParams:            o.keepalive,
+		KeepaliveEnforcementPolicy: o.enforcement,
+		MaxConnectionsPerIP:        o.maxConnsPerIP,
+		OnClientLimit:              o.onConnLimit,
+	})
+	h2s := transport.Server()
+	h2s.MaxConcurrentStreams = o.maxStreams
+	if o.keepalive == nil || o.keepalive.MaxConnectionIdle <= 0 {
+		h2s.IdleTimeout = o.idleTimeout
+	}
+
+	tlsConfig, err := o.buildTLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           withClientIdentity(handler),
+		ReadHeaderTimeout: o.readHeaderTimeout,
+		ReadTimeout:       o.readTimeout,
+		WriteTimeout:      o.writeTimeout,
+		IdleTimeout:       o.idleTimeout,
+		MaxHeaderBytes:    o.maxHeaderBytes,
+		TLSConfig:         tlsConfig,
+	}
+
+	// Cleartext HTTP/2 (h2c) without TLS, h2 and http/1.1 via ALPN with TLS
+	if err := transport.ConfigureServer(server); err != nil {
+		return nil, nil, err
+	}
+	return server, transport, nil
+}
+
+// NewHTTP3Server creates an HTTP/3 server for handler on the UDP address addr,
+// with the same TLS, client identity, keepalive, and stream limit options as
+// NewServer. HTTP/3 requires TLS. Wrap the handler of the HTTP/1.1 and HTTP/2
+// server with gateway.AltSvcHandler to advertise the HTTP/3 server.
+func NewHTTP3Server(addr string, handler http.Handler, opts ...ServerOption) (*http3.Server, error) {
+	return newServerOptions(opts).newHTTP3Server(addr, handler)
+}
+
+// newHTTP3Server creates the server of NewHTTP3Server.
+func (o *serverOptions) newHTTP3Server(addr string, handler http.Handler) (*http3.Server, error) {
+	tlsConfig, err := o.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return nil, errors.New("HTTP/3 requires TLS")
+	}
+
+	server := gateway.NewHTTP3Server(addr, withClientIdentity(handler), tlsConfig, gateway.Options{
+		KeepaliveParams: o.keepalive,
+	})
+	server.QUICConfig.MaxIncomingStreams = int64(o.maxStreams)
+	if o.keepalive == nil || o.keepalive.MaxConnectionIdle <= 0 {
+		server.IdleTimeout = o.idleTimeout
+	}
+	return server, nil
+}
+
+// newServerOptions applies opts to the defaults.
+func newServerOptions(opts []ServerOption) *serverOptions {
+	o := &serverOptions{
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		shutdownTimeout:   defaultShutdownTimeout,
+		maxStreams:        defaultMaxConcurrentStreams,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// buildTLSConfig returns the TLS configuration, or nil if TLS is not enabled.
+func (o *serverOptions) buildTLSConfig() (*tls.Config, error) {
+	if o.tlsConfig == nil && o.certFile == "" && o.keyFile == "" {
+		if o.clientCAs != nil {
+			return nil, errors.New("client CAs require TLS")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.tlsConfig != nil {
+		config = o.tlsConfig.Clone()
+		if config.MinVersion == 0 {
+			config.MinVersion = tls.VersionTLS12
+		}
+	}
+
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("TLS requires a certificate")
+	}
+
+	if o.clientCAs != nil {
+		config.ClientCAs = o.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if o.clientAuth != nil {
+		config.ClientAuth = *o.clientAuth
+	}
+	return config, nil
+}
+
+// ListenAndServe serves handler on addr until the server fails. See NewServer
+// for the protocols served, and WithHTTP3 to serve HTTP/3 as well.
+//
+//	gw, _ := rpc.NewGateway(svc)
+//	err := rpc.ListenAndServe(":8443", gw,
+//		rpc.WithTLS("server.crt", "server.key"),
+//		rpc.WithClientCAs(pool),
+//	)
+func ListenAndServe(addr string, handler http.Handler, opts ...ServerOption) error {
+	return newServerOptions(opts).serve(context.Background(), addr, handler)
+}
+
+// Run serves handler on addr like ListenAndServe, until the server fails, ctx
+// is done, or the process receives SIGINT or SIGTERM. It then stops accepting
+// connections and waits for calls in flight to complete within the shutdown
+// timeout, before closing the remaining connections.
+//
+//	gw, _ := rpc.NewGateway(svc)
+//	if err := rpc.Run(context.Background(), ":8080", gw); err != nil {
+//		log.Fatal(err)
+//	}
+func Run(ctx context.Context, addr string, handler http.Handler, opts ...ServerOption) error {
+	ctx, stop := ossignal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return newServerOptions(opts).serve(ctx, addr, handler)
+}
+
+// serve serves handler on addr until a server fails, or ctx is done and the
+// servers are shut down.
+func (o *serverOptions) serve(ctx context.Context, addr string, handler http.Handler) error {
+	server, transport, err := o.newServer(addr, handler)
+	if err != nil {
+		return err
+	}
+	serve := []func() error{func() error { return o.listenAndServe(server) }}
+	closeAll := []func() error{server.Close}
+	shutdown := []func(context.Context) error{server.Shutdown, transport.Shutdown}
+	if o.http3 {
+		if !isTCPAddr(addr) {
+			return errors.New("HTTP/3 requires a host:port address")
+		}
+		h3, err := o.newHTTP3Server(addr, handler)
+		if err != nil {
+			return err
+		}
+		server.Handler = gateway.AltSvcHandler(server.Handler, h3)
+		serve = append(serve, h3.ListenAndServe)
+		closeAll = append(closeAll, h3.Close)
+		shutdown = append(shutdown, h3.Shutdown)
+	}
+
+	// Serve until a server fails or ctx is done, then stop all of them
+	errs := make(chan error, len(serve))
+	for _, fn := range serve {
+		go func() { errs <- fn() }()
+	}
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.shutdownTimeout)
+		defer cancel()
+		for _, fn := range shutdown {
+			if err = fn(shutdownCtx); err != nil {
+				break
+			}
+		}
+	}
+	for _, fn := range closeAll {
+		_ = fn()
+	}
+	return err
+}
+
+// listenAndServe serves server on its address, see Listen, reading PROXY
+// protocol headers if enabled.
+func (o *serverOptions) listenAndServe(server *http.Server) error {
+	addr := server.Addr
+	if addr == "" {
+		addr = ":http"
+		if server.TLSConfig != nil {
+			addr = ":https"
+		}
+	}
+	lis, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	if o.proxyProtocol {
+		proxied, err := gateway.NewProxyProtocolListener(lis, o.trustedProxies...)
+		if err != nil {
+			_ = lis.Close()
+			return err
+		}
+		lis = proxied
+	}
+	if server.TLSConfig != nil {
+		// Certificates are already in the TLS config
+		return server.ServeTLS(lis, "", "")
+	}
+	return server.Serve(lis)
+}
@@ -0,0 +1,424 @@
+package rpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+type WhoAmIRequest struct{}
+
+type WhoAmIResponse struct {
+	CommonName string   `json:"common_name"`
+	URIs       []string `json:"uris"`
+}
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate signed by the CA.
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeKeyPair writes a certificate and key as PEM files.
+func writeKeyPair(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func newWhoAmIGateway(t *testing.T) http.Handler {
+	t.Helper()
+	svc := rpc.NewService("IdentityService", rpc.WithPackage("identity.v1"))
+	rpc.MustRegister(svc, "WhoAmI", func(ctx context.Context, _ *WhoAmIRequest) (*WhoAmIResponse, error) {
+		identity, ok := rpc.ClientIdentityFromContext(ctx)
+		if !ok {
+			return nil, rpc.NewError(rpc.CodeUnauthenticated, "no client certificate")
+		}
+		return &WhoAmIResponse{CommonName: identity.CommonName, URIs: identity.URIs}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	return gw
+}
+
+// startServer serves server on a local port and returns its address.
+func startServer(t *testing.T, server *http.Server) string {
+	t.Helper()
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if server.TLSConfig != nil {
+			_ = server.ServeTLS(lis, "", "")
+		} else {
+			_ = server.Serve(lis)
+		}
+	}()
+	t.Cleanup(func() { _ = server.Close() })
+	return lis.Addr().String()
+}
+
+func callWhoAmI(client *http.Client, url string) (*http.Response, string, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url+"/identity.v1.IdentityService/WhoAmI", strings.NewReader("{}"))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	return resp, string(body), err
+}
+
+func TestListenAndServeMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	spiffeID, _ := url.Parse("spiffe://example.org/billing")
+	clientCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffeID},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	certFile, keyFile := writeKeyPair(t, serverCert)
+
+	server, err := rpc.NewServer("127.0.0.1:0", newWhoAmIGateway(t),
+		rpc.WithTLS(certFile, keyFile),
+		rpc.WithClientCAs(ca.pool),
+		// Serves HTTP/2 connections through the keepalive transport
+		rpc.WithKeepaliveEnforcement(gateway.DefaultKeepaliveEnforcementPolicy()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server.ErrorLog = log.New(io.Discard, "", 0) // Expected handshake failures
+	addr := startServer(t, server)
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http2.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: ca.pool, Certificates: certs, MinVersion: tls.VersionTLS12},
+		}}
+	}
+
+	t.Run("exposes the client identity over HTTP/2", func(t *testing.T) {
+		resp, body, err := callWhoAmI(newClient(clientCert), "https://"+addr)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.Proto != "HTTP/2.0" {
+			t.Errorf("Expected HTTP/2 via ALPN, got %s", resp.Proto)
+		}
+		if !strings.Contains(body, `"common_name":"billing"`) || !strings.Contains(body, "spiffe://example.org/billing") {
+			t.Errorf("Expected client identity, got %s", body)
+		}
+	})
+
+	t.Run("rejects clients without a certificate", func(t *testing.T) {
+		if _, _, err := callWhoAmI(newClient(), "https://"+addr); err == nil {
+			t.Error("Expected the TLS handshake to fail")
+		}
+	})
+}
+
+func TestNewServerCleartext(t *testing.T) {
+	server, err := rpc.NewServer("127.0.0.1:0", newWhoAmIGateway(t))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	addr := startServer(t, server)
+
+	// Without TLS there is no client identity
+	_, body, err := callWhoAmI(http.DefaultClient, "http://"+addr)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if !strings.Contains(body, string(rpc.CodeUnauthenticated)) {
+		t.Errorf("Expected unauthenticated, got %s", body)
+	}
+
+	if _, err := rpc.NewServer(":0", http.NotFoundHandler(), rpc.WithClientCAs(x509.NewCertPool())); err == nil {
+		t.Error("Expected client CAs without TLS to fail")
+	}
+}
+
+func TestNewHTTP3Server(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	certFile, keyFile := writeKeyPair(t, serverCert)
+
+	svc := rpc.NewService("CountService", rpc.WithPackage("count.v1"))
+	rpc.MustRegisterServerStream(svc, "Count", func(ctx context.Context, req *wrapperspb.Int32Value, stream rpc.ServerStream[wrapperspb.Int32Value]) error {
+		for i := range req.GetValue() {
+			if err := stream.Send(wrapperspb.Int32(i + 1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", gw)
+	mux.Handle("/identity.v1.IdentityService/", newWhoAmIGateway(t))
+
+	if _, err := rpc.NewHTTP3Server("127.0.0.1:0", mux); err == nil {
+		t.Error("Expected HTTP/3 without TLS to fail")
+	}
+	server, err := rpc.NewHTTP3Server("127.0.0.1:0", mux,
+		rpc.WithTLS(certFile, keyFile),
+		rpc.WithClientCAs(ca.pool),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	conn, err := (&net.ListenConfig{}).ListenPacket(context.Background(), "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(conn) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS13,
+	}}
+	t.Cleanup(func() { _ = transport.Close() })
+	client := &http.Client{Transport: transport}
+	baseURL := "https://" + conn.LocalAddr().String()
+
+	t.Run("exposes the client identity", func(t *testing.T) {
+		resp, body, err := callWhoAmI(client, baseURL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.Proto != "HTTP/3.0" {
+			t.Errorf("Expected HTTP/3, got %s", resp.Proto)
+		}
+		if !strings.Contains(body, `"common_name":"billing"`) {
+			t.Errorf("Expected client identity, got %s", body)
+		}
+	})
+
+	t.Run("sends gRPC trailers", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			baseURL+"/identity.v1.IdentityService/WhoAmI", strings.NewReader("\x00\x00\x00\x00\x02{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/grpc+json")
+		req.Header.Set("TE", "trailers")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+
+		if !strings.Contains(string(body), `"common_name":"billing"`) {
+			t.Errorf("Expected client identity, got %q", body)
+		}
+		if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+			t.Errorf("Expected trailer grpc-status 0, got %q (headers %v)", got, resp.Header)
+		}
+	})
+
+	t.Run("streams responses", func(t *testing.T) {
+		countClient := connect.NewClient[wrapperspb.Int32Value, wrapperspb.Int32Value](
+			client, baseURL+"/count.v1.CountService/Count")
+		stream, err := countClient.CallServerStream(context.Background(), connect.NewRequest(wrapperspb.Int32(3)))
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		defer func() { _ = stream.Close() }()
+
+		var got []int32
+		for stream.Receive() {
+			got = append(got, stream.Msg().GetValue())
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if len(got) != 3 || got[2] != 3 {
+			t.Errorf("Expected messages 1..3, got %v", got)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	server, err := rpc.NewServer(":0", http.NotFoundHandler(),
+		rpc.WithReadTimeout(time.Second),
+		rpc.WithWriteTimeout(2*time.Second),
+		rpc.WithMaxHeaderBytes(4096),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if server.ReadTimeout != time.Second || server.WriteTimeout != 2*time.Second || server.MaxHeaderBytes != 4096 {
+		t.Errorf("Expected the configured limits, got %v, %v and %d", server.ReadTimeout, server.WriteTimeout, server.MaxHeaderBytes)
+	}
+
+	started := make(chan struct{})
+	svc := rpc.NewService("SlowService", rpc.WithPackage("slow.v1"))
+	rpc.MustRegister(svc, "Echo", func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return req, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	_ = lis.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- rpc.Run(ctx, addr, gw) }()
+	waitFor(t, func() bool {
+		conn, err := (&net.Dialer{}).DialContext(context.Background(), "tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	})
+
+	// An h2c call in flight completes before Run returns
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		&http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}},
+		"http://"+addr+"/slow.v1.SlowService/Echo", connect.WithGRPC())
+	type result struct {
+		resp *connect.Response[wrapperspb.StringValue]
+		err  error
+	}
+	call := make(chan result, 1)
+	go func() {
+		resp, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("hello")))
+		call <- result{resp, err}
+	}()
+	<-started
+	cancel()
+
+	if res := <-call; res.err != nil || res.resp.Msg.GetValue() != "hello" {
+		t.Errorf("Expected the call in flight to complete, got %v", res.err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a graceful shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after shutdown")
+	}
+}
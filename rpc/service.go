@@ -3,23 +3,33 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 
+	"github.com/i2y/hyperway/codec"
 	"github.com/i2y/hyperway/gateway"
 	hyperproto "github.com/i2y/hyperway/proto"
 	"github.com/i2y/hyperway/schema"
 )
 
+// syntaxProto2 is the syntax selected by WithSyntax("proto2").
+const syntaxProto2 = "proto2"
+
 // Interceptor is our own interceptor interface that works with dynamic types.
 type Interceptor interface {
 	// Intercept wraps the handler call.
@@ -34,8 +44,20 @@ type Service struct {
 	options         ServiceOptions
 	builder         *schema.Builder
 	validator       *validator.Validate
-	handlerCtxCache map[string]*handlerContext // Cache prepared handler contexts
-	serviceConfig   *ServiceConfig             // gRPC service configuration
+	handlerCtxCache map[string]*handlerContext           // Cache prepared handler contexts
+	handlerCtxMu    sync.RWMutex                         // Guards handlerCtxCache
+	serviceConfig   *ServiceConfig                       // gRPC service configuration
+	shadow          *shadowCopier                        // Emits shadow copies of calls, if configured
+	activeStreams   sync.Map                             // map[method name]*atomic.Int64
+	inFlight        atomic.Int64                         // Calls being handled, counted with load shedding
+	queueLatency    latencyAverage                       // Time admitted calls waited for a concurrency slot, with adaptive load shedding
+	bulkheads       sync.Map                             // map[method name]*bulkhead, for methods with a concurrency limit
+	computed        *computedFields                      // Fills computed fields of responses, if any
+	types           atomic.Pointer[gateway.TypeRegistry] // Message types of the last gateway serving the service
+	keepaliveTime   atomic.Int64                         // Keepalive time of the last gateway serving the service, the default stream heartbeat
+	descriptor      protoreflect.ServiceDescriptor       // Describes the service instead of its Go types, see NewServiceFromDescriptor
+	openRPCDoc      json.RawMessage                      // Encoded OpenRPC document served by rpc.discover, reset on registration
+	openRPCMu       sync.Mutex                           // Guards openRPCDoc
 }
 
 // ServiceOptions configures a service.
@@ -46,12 +68,24 @@ type ServiceOptions struct {
 	EnableValidation bool
 	// EnableReflection enables gRPC reflection
 	EnableReflection bool
+	// EnableGraphQL serves the service over GraphQL at the gateway's GraphQL path
+	EnableGraphQL bool
 	// Interceptors to apply to all methods
 	Interceptors []Interceptor
+	// NamedInterceptors are registered interceptors to apply to all methods
+	NamedInterceptors []string
 	// Edition sets the Protobuf edition (e.g., "2023", "2024")
 	Edition string
 	// UseEditions enables Protobuf Editions mode instead of proto3
 	UseEditions bool
+	// Syntax selects "proto2" instead of proto3 when editions are not used
+	Syntax string
+	// PointerScalarsAsWrappers maps pointer scalars to wrapper types instead of proto3 optional fields
+	PointerScalarsAsWrappers bool
+	// ProtobufTags names and numbers fields by their protoc-gen-go protobuf tags
+	ProtobufTags bool
+	// MessageTypes are added to the descriptors of the service, e.g. the payloads of Any fields
+	MessageTypes []reflect.Type
 	// ServiceConfig is the gRPC service configuration (JSON string)
 	ServiceConfig string
 	// Description is the service-level documentation
@@ -62,6 +96,76 @@ type ServiceOptions struct {
 	JSONRPCPath string
 	// JSONRPCBatchLimit is the maximum number of requests in a batch (default: 100)
 	JSONRPCBatchLimit int
+	// JSONRPCBatch configures the execution of JSON-RPC batches
+	JSONRPCBatch JSONRPCBatchOptions
+	// JSONRPCMethodNaming controls how methods are named over JSON-RPC
+	JSONRPCMethodNaming JSONRPCMethodNaming
+	// JSONRPCMethods limits JSON-RPC to these methods (empty exposes all unary methods)
+	JSONRPCMethods []string
+	// DevMode includes request snapshots, headers, and stack traces in error responses
+	DevMode bool
+	// ProfilingLabels tags request goroutines with pprof labels
+	ProfilingLabels bool
+	// ConnectTrailers controls trailer propagation for Connect unary responses
+	ConnectTrailers ConnectTrailerOptions
+	// RoutingKeys maps streaming method names to the request field path of their routing key
+	RoutingKeys map[string]string
+	// RoutingKeyHeader is the response header carrying routing keys (default: "X-Routing-Key")
+	RoutingKeyHeader string
+	// ValidationLimits bounds the cost of input validation
+	ValidationLimits ValidationLimits
+	// StrictGRPC follows the gRPC over HTTP/2 spec strictly in gRPC responses
+	StrictGRPC bool
+	// ShadowCopy emits copies of calls to an analytics sink
+	ShadowCopy ShadowCopyOptions
+	// JSONEncoder encodes JSON responses of non-protobuf messages (default: pooled encoding/json)
+	JSONEncoder JSONEncoder
+	// StrictJSON rejects unknown JSON fields and validates all requests
+	StrictJSON bool
+	// ProtoTextResponses encodes responses in the protobuf text format for requests accepting it
+	ProtoTextResponses bool
+	// ETags sends ETags with responses of methods without side effects and honors If-None-Match
+	ETags bool
+	// ProtoJSON encodes Connect and plain JSON of struct messages with the proto3 JSON mapping (default: encoding/json)
+	ProtoJSON bool
+	// JSONNaming names the fields of JSON messages (default: json tags for structs, lowerCamelCase for protobuf)
+	JSONNaming JSONNaming
+	// JSONInt64 encodes 64-bit integers in JSON as strings or numbers (default: numbers with encoding/json, strings with the proto3 JSON mapping)
+	JSONInt64 codec.JSONInt64
+	// CodecOptions configures the protobuf codecs of struct messages (default: codec.DefaultOptions())
+	CodecOptions *codec.Options
+	// Auth authenticates calls with bearer tokens
+	Auth AuthOptions
+	// DecompressionLimits bounds the size of decompressed requests
+	DecompressionLimits DecompressionLimits
+	// Paths maps unary method names to path templates serving them
+	Paths map[string]string
+	// LoadShedding rejects calls while the service is overloaded
+	LoadShedding LoadSheddingPolicy
+	// ConcurrencyLimit bounds the concurrent calls of each method
+	ConcurrencyLimit ConcurrencyLimit
+	// ComputedFields fills derived fields of messages by type before they are encoded
+	ComputedFields map[reflect.Type][]ComputedField
+	// StreamFlowControl buffers server stream messages up to a high-water mark (default: unbuffered)
+	StreamFlowControl StreamFlowControl
+	// StreamHeartbeat is the idle time after which server streams send a heartbeat (default: the gateway's keepalive time)
+	StreamHeartbeat time.Duration
+	// StreamResumption lets clients resume server streams from the cursor of the last message they received
+	StreamResumption bool
+	// Deprecation marks all methods of the service as deprecated
+	Deprecation *Deprecation
+	// ErrorSanitizer replaces the messages of internal errors sent to clients
+	ErrorSanitizer *ErrorSanitizer
+	// ResponseHooks are called with the stats of each call once its response is complete
+	ResponseHooks []func(context.Context, RPCStats)
+	// FieldMaskFiltering prunes responses to the read_mask or update_mask of their request
+	FieldMaskFiltering bool
+	// ResponseTransformers post-process the responses of unary calls before they are encoded
+	ResponseTransformers []ResponseTransformer
+	// StreamResponseTransformers post-process the messages of server streams before they are encoded
+	StreamResponseTransformers []StreamResponseTransformer
+	// JSONRPCBatchHooks are called with the stats of each JSON-RPC batch once its response is complete
+	JSONRPCBatchHooks []func(context.Context, JSONRPCBatchStats)
 }
 
 // Method represents an RPC method.
@@ -84,8 +188,36 @@ type MethodOptions struct {
 	Validate *bool
 	// Interceptors specific to this method
 	Interceptors []Interceptor
+	// NamedInterceptors are registered interceptors specific to this method
+	NamedInterceptors []string
 	// Description is the method-level documentation
 	Description string
+	// RoutingKey is the request field path used to derive a stream routing key
+	RoutingKey string
+	// Path is a path template serving the method in addition to its RPC path
+	Path string
+	// JSONRPC overrides whether the method is exposed over JSON-RPC
+	JSONRPC *bool
+	// StrictJSON overrides the strict JSON mode of the service
+	StrictJSON *bool
+	// MaxConcurrency overrides the concurrency limit of the service (0 for no limit)
+	MaxConcurrency *int
+	// StreamFlowControl overrides the stream flow control of the service
+	StreamFlowControl *StreamFlowControl
+	// StreamHeartbeat overrides the stream heartbeat interval of the service
+	StreamHeartbeat *time.Duration
+	// StreamResumption overrides the stream resumption of the service
+	StreamResumption *bool
+	// Deprecation marks the method as deprecated, overriding the service
+	Deprecation *Deprecation
+	// Priority is the priority of the method's calls under load shedding
+	Priority Priority
+	// Idempotency is the idempotency level of the method
+	Idempotency Idempotency
+	// ETags overrides whether responses of the method get ETags
+	ETags *bool
+	// FieldMaskFiltering overrides the field mask filtering of the service
+	FieldMaskFiltering *bool
 }
 
 // Global instances for performance - thread-safe and can be reused
@@ -137,18 +269,42 @@ func NewService(name string, opts ...ServiceOption) *Service {
 		}
 	}
 
+	// Start emitting shadow copies if a sink is configured
+	if svc.options.ShadowCopy.Sink != nil {
+		svc.shadow = newShadowCopier(svc, svc.options.ShadowCopy)
+	}
+	svc.computed = newComputedFields(svc.options.ComputedFields)
+
 	// Get or create schema builder from global cache
 	// Include edition settings in cache key to ensure different builders for different editions
 	cacheKey := svc.packageName
 	if svc.options.UseEditions {
 		cacheKey = fmt.Sprintf("%s_editions_%s", svc.packageName, svc.options.Edition)
+	} else if svc.options.Syntax == syntaxProto2 {
+		cacheKey += "_proto2"
+	}
+	if svc.options.JSONNaming != JSONNamingDefault {
+		cacheKey = fmt.Sprintf("%s_json_%s", cacheKey, svc.options.JSONNaming)
+	}
+	if svc.options.PointerScalarsAsWrappers {
+		cacheKey += "_wrappers"
+	}
+	if svc.options.ProtobufTags {
+		cacheKey += "_pbtags"
+	}
+	if svc.options.JSONInt64 != codec.JSONInt64Default {
+		cacheKey = fmt.Sprintf("%s_int64_%s", cacheKey, svc.options.JSONInt64)
 	}
 
 	if cachedBuilder, ok := globalBuilderCache.Load(cacheKey); ok {
 		svc.builder = cachedBuilder.(*schema.Builder)
 	} else {
 		builderOpts := schema.BuilderOptions{
-			PackageName: svc.packageName,
+			PackageName:              svc.packageName,
+			JSONNames:                svc.options.JSONNaming.jsonNames(),
+			PointerScalarsAsWrappers: svc.options.PointerScalarsAsWrappers,
+			Int64JSType:              int64JSType(svc.options.JSONInt64),
+			ProtobufTags:             svc.options.ProtobufTags,
 		}
 
 		// Configure editions mode if enabled
@@ -158,6 +314,8 @@ func NewService(name string, opts ...ServiceOption) *Service {
 			if builderOpts.Edition == "" {
 				builderOpts.Edition = schema.Edition2023 // Default to 2023
 			}
+		} else if svc.options.Syntax == syntaxProto2 {
+			builderOpts.SyntaxMode = schema.SyntaxProto2
 		}
 
 		newBuilder := schema.NewBuilder(builderOpts)
@@ -222,7 +380,14 @@ func (s *Service) Register(method *Method) error {
 		}
 	}
 
+	if s.descriptor == nil {
+		if err := s.checkMessageNames(method); err != nil {
+			return err
+		}
+	}
+
 	s.methods[method.Name] = method
+	s.resetOpenRPC()
 	return nil
 }
 
@@ -263,7 +428,7 @@ func NewServerStreamMethod[TIn, TOut any](name string, handler ServerStreamHandl
 	return &MethodBuilder{
 		method: &Method{
 			Name:       name,
-			Handler:    handler,
+			Handler:    wrapServerStreamHandler(handler),
 			InputType:  reflect.TypeOf(in),
 			OutputType: reflect.TypeOf(out),
 			StreamType: StreamTypeServerStream,
@@ -278,7 +443,7 @@ func NewClientStreamMethod[TIn, TOut any](name string, handler ClientStreamHandl
 	return &MethodBuilder{
 		method: &Method{
 			Name:       name,
-			Handler:    handler,
+			Handler:    wrapClientStreamHandler(handler),
 			InputType:  reflect.TypeOf(in),
 			OutputType: reflect.TypeOf(out),
 			StreamType: StreamTypeClientStream,
@@ -293,7 +458,7 @@ func NewBidiStreamMethod[TIn, TOut any](name string, handler BidiStreamHandler[T
 	return &MethodBuilder{
 		method: &Method{
 			Name:       name,
-			Handler:    handler,
+			Handler:    wrapBidiStreamHandler(handler),
 			InputType:  reflect.TypeOf(in),
 			OutputType: reflect.TypeOf(out),
 			StreamType: StreamTypeBidiStream,
@@ -371,6 +536,14 @@ func WithReflection(enabled bool) ServiceOption {
 	}
 }
 
+// WithGraphQL serves the service over GraphQL: unary methods become queries
+// or mutations and server-streaming methods become subscriptions.
+func WithGraphQL(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.EnableGraphQL = enabled
+	}
+}
+
 // ExportProto exports the service definition as a .proto file.
 func (s *Service) ExportProto() (string, error) {
 	return s.ExportProtoWithOptions()
@@ -436,6 +609,54 @@ func (s *Service) ExportAllProtosWithOptions(options ...hyperproto.ExportOption)
 	return exporter.ExportFileDescriptorSet(fdset)
 }
 
+// ExportDescriptorSetBytes exports the service definition as a serialized,
+// self-contained FileDescriptorSet, with the well-known types it uses. The
+// result can be passed to protoc --descriptor_set_in, buf, or grpcurl -protoset.
+func (s *Service) ExportDescriptorSetBytes(options ...hyperproto.ExportOption) ([]byte, error) {
+	fdset := s.buildCompleteFileDescriptorSet()
+	if fdset == nil || len(fdset.File) == 0 {
+		return nil, fmt.Errorf("no proto files to export")
+	}
+
+	exportOpts := hyperproto.DefaultExportOptions()
+	exportOpts.ApplyOptions(options...)
+	return hyperproto.NewExporter(&exportOpts).ExportDescriptorSetBytes(fdset)
+}
+
+// ExportBufModule exports all proto files as a buf module, in directories
+// matching their packages with a buf.yaml and a buf.gen.yaml, ready for
+// buf generate or buf push. The result maps paths relative to the module
+// root to their contents.
+func (s *Service) ExportBufModule(buf hyperproto.BufOptions, options ...hyperproto.ExportOption) (map[string]string, error) {
+	fdset := s.buildCompleteFileDescriptorSet()
+	if fdset == nil || len(fdset.File) == 0 {
+		return nil, fmt.Errorf("no proto files to export")
+	}
+
+	exportOpts := hyperproto.DefaultExportOptions()
+	exportOpts.ApplyOptions(options...)
+	return hyperproto.NewExporter(&exportOpts).ExportBufModule(fdset, buf)
+}
+
+// PushSchema publishes the self-contained FileDescriptorSet of the service as
+// version of module in reg, after checking it against the latest registered
+// version. It returns the breaking changes, with hyperproto.ErrBreakingChanges
+// if they prevented the push.
+func (s *Service) PushSchema(ctx context.Context, reg hyperproto.Registry, module, version string, opts hyperproto.PushOptions, options ...hyperproto.ExportOption) ([]hyperproto.BreakingChange, error) {
+	fdset := s.buildCompleteFileDescriptorSet()
+	if fdset == nil || len(fdset.File) == 0 {
+		return nil, fmt.Errorf("no proto files to export")
+	}
+
+	exportOpts := hyperproto.DefaultExportOptions()
+	exportOpts.ApplyOptions(options...)
+	fdset, err := hyperproto.NewExporter(&exportOpts).ExportDescriptorSet(fdset)
+	if err != nil {
+		return nil, err
+	}
+	return hyperproto.Push(ctx, reg, module, version, fdset, opts)
+}
+
 // GetFileDescriptorSet returns the FileDescriptorSet for this service.
 func (s *Service) GetFileDescriptorSet() *descriptorpb.FileDescriptorSet {
 	return s.buildCompleteFileDescriptorSet()
@@ -446,13 +667,20 @@ func (s *Service) collectMessageTypes() map[string]reflect.Type {
 	messageTypes := make(map[string]reflect.Type)
 	for _, method := range s.methods {
 		// Add input and output types
-		messageTypes[method.InputType.Name()] = method.InputType
-		messageTypes[method.OutputType.Name()] = method.OutputType
+		messageTypes[schema.MessageName(method.InputType)] = method.InputType
+		messageTypes[schema.MessageName(method.OutputType)] = method.OutputType
 
 		// Also collect nested types by traversing the type structure
 		collectNestedTypes(method.InputType, messageTypes, s.packageName)
 		collectNestedTypes(method.OutputType, messageTypes, s.packageName)
 	}
+	for _, typ := range s.options.MessageTypes {
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		messageTypes[schema.MessageName(typ)] = typ
+		collectNestedTypes(typ, messageTypes, s.packageName)
+	}
 	return messageTypes
 }
 
@@ -460,9 +688,13 @@ func (s *Service) collectMessageTypes() map[string]reflect.Type {
 func (s *Service) buildMessageProtos(messageTypes map[string]reflect.Type) ([]*descriptorpb.DescriptorProto, *descriptorpb.FileDescriptorSet) {
 	// Create a new builder for this specific file to avoid conflicts
 	builderOpts := schema.BuilderOptions{
-		PackageName: s.packageName,
-		SyntaxMode:  s.builder.GetSyntaxMode(),
-		Edition:     s.builder.GetEdition(),
+		PackageName:              s.packageName,
+		SyntaxMode:               s.builder.GetSyntaxMode(),
+		Edition:                  s.builder.GetEdition(),
+		JSONNames:                s.options.JSONNaming.jsonNames(),
+		PointerScalarsAsWrappers: s.options.PointerScalarsAsWrappers,
+		Int64JSType:              int64JSType(s.options.JSONInt64),
+		ProtobufTags:             s.options.ProtobufTags,
 	}
 
 	// Configure editions mode if enabled
@@ -523,11 +755,44 @@ func (s *Service) buildMessageProtos(messageTypes map[string]reflect.Type) ([]*d
 		for _, msg := range allMessages {
 			messageProtos = append(messageProtos, msg)
 		}
+		sort.Slice(messageProtos, func(i, j int) bool {
+			return messageProtos[i].GetName() < messageProtos[j].GetName()
+		})
 	}
 
 	return messageProtos, builtFiles
 }
 
+// addMessageComments carries message and field comments (from doc and validate
+// tags) from the built files over to the service file, whose message indices differ.
+func (s *Service) addMessageComments(sourceCodeInfo *schema.SourceCodeInfoBuilder, messageProtos []*descriptorpb.DescriptorProto, builtFiles *descriptorpb.FileDescriptorSet) {
+	newIndices := make(map[*descriptorpb.DescriptorProto]int32, len(messageProtos))
+	for i, msg := range messageProtos {
+		newIndices[msg] = int32(i) //nolint:gosec // message count fits in int32
+	}
+
+	for _, file := range builtFiles.GetFile() {
+		if file.GetPackage() != s.packageName {
+			continue
+		}
+		for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+			path := loc.GetPath()
+			if len(path) < 2 || path[0] != schema.FileDescriptorProtoMessageTypeField || int(path[1]) >= len(file.MessageType) {
+				continue
+			}
+			newIndex, ok := newIndices[file.MessageType[path[1]]]
+			if !ok {
+				continue
+			}
+			newPath := append([]int32{path[0], newIndex}, path[2:]...)
+			sourceCodeInfo.AddLocation(newPath, &schema.CommentInfo{
+				Leading:  loc.GetLeadingComments(),
+				Trailing: loc.GetTrailingComments(),
+			})
+		}
+	}
+}
+
 // buildServiceProto creates the service descriptor with all methods.
 func (s *Service) buildServiceProto(sourceCodeInfo *schema.SourceCodeInfoBuilder) *descriptorpb.ServiceDescriptorProto {
 	// Create service descriptor
@@ -537,19 +802,25 @@ func (s *Service) buildServiceProto(sourceCodeInfo *schema.SourceCodeInfoBuilder
 	}
 
 	// Add service comment if available
-	if s.options.Description != "" {
+	description := s.options.Description
+	if d := s.options.Deprecation; d != nil {
+		serviceProto.Options = &descriptorpb.ServiceOptions{Deprecated: ptr(true)}
+		description = deprecationComment(description, d)
+	}
+	if description != "" {
 		path := []int32{schema.FileDescriptorProtoServiceField, 0} // First service
 		sourceCodeInfo.AddLocation(path, &schema.CommentInfo{
-			Leading: s.options.Description,
+			Leading: description,
 		})
 	}
 
-	// Add method descriptors
+	// Add method descriptors, sorted so that exports are stable
 	methodIndex := int32(0)
-	for methodName, method := range s.methods {
+	for _, methodName := range slices.Sorted(maps.Keys(s.methods)) {
+		method := s.methods[methodName]
 		// Get type names
-		inputTypeName := fmt.Sprintf(".%s.%s", s.packageName, method.InputType.Name())
-		outputTypeName := fmt.Sprintf(".%s.%s", s.packageName, method.OutputType.Name())
+		inputTypeName := fmt.Sprintf(".%s.%s", s.packageName, schema.MessageName(method.InputType))
+		outputTypeName := fmt.Sprintf(".%s.%s", s.packageName, schema.MessageName(method.OutputType))
 
 		// Create method descriptor
 		methodProto := &descriptorpb.MethodDescriptorProto{
@@ -574,13 +845,24 @@ func (s *Service) buildServiceProto(sourceCodeInfo *schema.SourceCodeInfoBuilder
 		serviceProto.Method = append(serviceProto.Method, methodProto)
 
 		// Add method comment if available
-		if method.Options.Description != "" {
+		description := method.Options.Description
+		if d := s.deprecation(method); d != nil {
+			methodProto.Options = &descriptorpb.MethodOptions{Deprecated: ptr(true)}
+			description = deprecationComment(description, d)
+		}
+		if method.Options.Idempotency != IdempotencyUnknown {
+			if methodProto.Options == nil {
+				methodProto.Options = &descriptorpb.MethodOptions{}
+			}
+			methodProto.Options.IdempotencyLevel = method.Options.Idempotency.descriptorLevel().Enum()
+		}
+		if description != "" {
 			path := []int32{
 				schema.FileDescriptorProtoServiceField, 0, // First service
 				schema.ServiceDescriptorProtoMethodField, methodIndex,
 			}
 			sourceCodeInfo.AddLocation(path, &schema.CommentInfo{
-				Leading: method.Options.Description,
+				Leading: description,
 			})
 		}
 		methodIndex++
@@ -591,6 +873,10 @@ func (s *Service) buildServiceProto(sourceCodeInfo *schema.SourceCodeInfoBuilder
 
 // buildCompleteFileDescriptorSet builds a complete FileDescriptorSet including service definition.
 func (s *Service) buildCompleteFileDescriptorSet() *descriptorpb.FileDescriptorSet {
+	if s.descriptor != nil {
+		return descriptorFileSet(s.descriptor)
+	}
+
 	// Create SourceCodeInfo builder for service file
 	sourceCodeInfo := schema.NewSourceCodeInfoBuilder()
 
@@ -600,6 +886,8 @@ func (s *Service) buildCompleteFileDescriptorSet() *descriptorpb.FileDescriptorS
 	// Build all message types and collect their descriptors
 	messageProtos, builtFiles := s.buildMessageProtos(messageTypes)
 
+	s.addMessageComments(sourceCodeInfo, messageProtos, builtFiles)
+
 	// Create service descriptor
 	serviceProto := s.buildServiceProto(sourceCodeInfo)
 
@@ -635,6 +923,9 @@ func (s *Service) createFileDescriptor(messageProtos []*descriptorpb.DescriptorP
 			edition = schema.Edition2023
 		}
 		fileProto.Edition = schema.StringToEdition(edition)
+		schema.ApplyNamingStyle(fileProto)
+	} else if s.options.Syntax == syntaxProto2 {
+		fileProto.Syntax = ptr(syntaxProto2)
 	} else {
 		fileProto.Syntax = ptr("proto3")
 	}
@@ -659,12 +950,35 @@ func (s *Service) collectImports(builtFiles *descriptorpb.FileDescriptorSet) []s
 			}
 		}
 	}
-	// Convert map to slice
-	imports := make([]string, 0, len(importMap))
-	for imp := range importMap {
-		imports = append(imports, imp)
+	return slices.Sorted(maps.Keys(importMap))
+}
+
+// checkMessageNames fails if a message of method has the name of a message
+// of another Go type in the service's other methods, since the service file
+// can only describe one of them.
+func (s *Service) checkMessageNames(method *Method) error {
+	owners := make(map[string]reflect.Type)
+	methodNames := make(map[string]string)
+	add := func(m *Method) error {
+		for _, rt := range []reflect.Type{m.InputType, m.OutputType} {
+			types := s.builder.MessageTypes(rt)
+			for _, name := range slices.Sorted(maps.Keys(types)) {
+				typ := types[name]
+				if other, ok := owners[name]; ok && other != typ {
+					return fmt.Errorf("message %s.%s would describe both %s of %s and %s of %s, rename one of them",
+						s.packageName, name, schema.GoTypeName(other), methodNames[name], schema.GoTypeName(typ), m.Name)
+				}
+				owners[name], methodNames[name] = typ, m.Name
+			}
+		}
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.methods)) {
+		if name != method.Name {
+			_ = add(s.methods[name])
+		}
 	}
-	return imports
+	return add(method)
 }
 
 // collectNestedTypes recursively collects all types referenced by a given type
@@ -674,6 +988,12 @@ func collectNestedTypes(t reflect.Type, collected map[string]reflect.Type, packa
 		t = t.Elem()
 	}
 
+	// Lazy fields are collected as their element type
+	if elem, ok := schema.LazyElemType(t); ok {
+		collectNestedTypes(elem, collected, packageName)
+		return
+	}
+
 	// Handle maps
 	if t.Kind() == reflect.Map {
 		collectNestedTypes(t.Key(), collected, packageName)
@@ -687,7 +1007,7 @@ func collectNestedTypes(t reflect.Type, collected map[string]reflect.Type, packa
 	}
 
 	// Skip if already collected or if it's a well-known type
-	if _, exists := collected[t.Name()]; exists {
+	if _, exists := collected[schema.MessageName(t)]; exists {
 		return
 	}
 
@@ -702,24 +1022,42 @@ func collectNestedTypes(t reflect.Type, collected map[string]reflect.Type, packa
 	}
 
 	// Add to collected
-	if t.Name() != "" {
-		collected[t.Name()] = t
+	if name := schema.MessageName(t); name != "" {
+		collected[name] = t
 	}
 
-	// Process all fields
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		if field.IsExported() {
-			collectNestedTypes(field.Type, collected, packageName)
-		}
+	// Process all fields, those of flattened embedded structs in their place
+	for _, field := range schema.MessageFields(t) {
+		collectNestedTypes(field.Type, collected, packageName)
+	}
+}
+
+// DefaultGatewayOptions returns the gateway options of NewGateway, to be
+// extended with NewGatewayWithOptions, e.g. with a Logger.
+func DefaultGatewayOptions() gateway.Options {
+	return gateway.Options{
+		EnableOpenAPI: true,
+		OpenAPIPath:   "/openapi.json",
+		EnableDocs:    true,
+		CORSConfig:    gateway.DefaultCORSConfig(),
 	}
 }
 
 // NewGateway creates a gateway for the service.
 func NewGateway(services ...*Service) (http.Handler, error) {
+	return NewGatewayWithOptions(DefaultGatewayOptions(), services...)
+}
+
+// NewGatewayWithOptions creates a gateway for the services with custom gateway options.
+// Reflection is enabled if either opts or any of the services enable it.
+func NewGatewayWithOptions(opts gateway.Options, services ...*Service) (http.Handler, error) {
 	gatewaySvcs := make([]*gateway.Service, 0, len(services))
 
 	for _, svc := range services {
+		if err := svc.checkInterceptors(); err != nil {
+			return nil, err
+		}
+
 		// Build handlers for each method
 		handlers := make(map[string]http.Handler)
 
@@ -728,12 +1066,22 @@ func NewGateway(services ...*Service) (http.Handler, error) {
 		fdset := svc.buildCompleteFileDescriptorSet()
 
 		// Create method handlers
+		var routes []gateway.Route
 		for _, method := range svc.methods {
 			// Create handler path - use fully qualified service name
 			path := fmt.Sprintf("/%s.%s/%s", svc.packageName, svc.name, method.Name)
 
 			// Create actual handler for the method
 			handlers[path] = svc.createHTTPHandler(method)
+
+			// Serve it under its path template as well
+			route, err := svc.pathRoute(method, handlers[path])
+			if err != nil {
+				return nil, err
+			}
+			if route != nil {
+				routes = append(routes, *route)
+			}
 		}
 
 		// Add JSON-RPC handler if enabled
@@ -746,30 +1094,44 @@ func NewGateway(services ...*Service) (http.Handler, error) {
 			Package:     svc.packageName,
 			Handlers:    handlers,
 			Descriptors: fdset,
+			SchemaHash:  svc.SchemaHash(),
+			Security:    svc.openAPISecurity(),
+			Debug:       svc.debugInfo,
+			Routes:      routes,
 		}
 		gatewaySvcs = append(gatewaySvcs, gatewaySvc)
 	}
 
 	// Check if any service has reflection enabled
-	enableReflection := false
 	for _, svc := range services {
 		if svc.options.EnableReflection {
-			enableReflection = true
+			opts.EnableReflection = true
+			break
+		}
+	}
+
+	for _, svc := range services {
+		if svc.options.EnableGraphQL {
+			opts.EnableGraphQL = true
 			break
 		}
 	}
 
 	// Create gateway with options from services
-	gw, err := gateway.New(gatewaySvcs, gateway.Options{
-		EnableReflection: enableReflection,
-		EnableOpenAPI:    true,
-		OpenAPIPath:      "/openapi.json",
-		CORSConfig:       gateway.DefaultCORSConfig(),
-	})
+	gw, err := gateway.New(gatewaySvcs, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gateway: %w", err)
 	}
 
+	// Resolve Any values with the message types of all the services, and
+	// default stream heartbeats to the keepalive time
+	for _, svc := range services {
+		svc.types.Store(gw.Types())
+		if opts.KeepaliveParams != nil {
+			svc.keepaliveTime.Store(int64(opts.KeepaliveParams.Time))
+		}
+	}
+
 	return gw, nil
 }
 
@@ -813,8 +1175,21 @@ func MustRegisterMethod(svc *Service, methods ...*MethodBuilder) {
 
 // RegisterServerStream registers a server-streaming method with type safety.
 func RegisterServerStream[TIn, TOut any](svc *Service, name string, handler ServerStreamHandler[TIn, TOut]) error {
-	// Create a wrapper that converts the typed handler to an untyped one
-	wrappedHandler := func(ctx context.Context, req any, stream any) error {
+	method := &Method{
+		Name:       name,
+		Handler:    wrapServerStreamHandler(handler),
+		InputType:  reflect.TypeOf((*TIn)(nil)).Elem(),
+		OutputType: reflect.TypeOf((*TOut)(nil)).Elem(),
+		StreamType: StreamTypeServerStream,
+	}
+
+	return svc.RegisterStreamingMethod(method)
+}
+
+// wrapServerStreamHandler converts a typed server-streaming handler to an
+// untyped one.
+func wrapServerStreamHandler[TIn, TOut any](handler ServerStreamHandler[TIn, TOut]) func(context.Context, any, any) error {
+	return func(ctx context.Context, req any, stream any) error {
 		// Type assert the request
 		typedReq, ok := req.(*TIn)
 		if !ok {
@@ -835,16 +1210,37 @@ func RegisterServerStream[TIn, TOut any](svc *Service, name string, handler Serv
 		// Call the original handler
 		return handler(ctx, typedReq, typedStream)
 	}
+}
 
-	method := &Method{
-		Name:       name,
-		Handler:    wrappedHandler,
-		InputType:  reflect.TypeOf((*TIn)(nil)).Elem(),
-		OutputType: reflect.TypeOf((*TOut)(nil)).Elem(),
-		StreamType: StreamTypeServerStream,
+// wrapClientStreamHandler converts a typed client-streaming handler to an
+// untyped one. A nil response is sent as an empty message.
+func wrapClientStreamHandler[TIn, TOut any](handler ClientStreamHandler[TIn, TOut]) func(context.Context, any) (any, error) {
+	return func(ctx context.Context, stream any) (any, error) {
+		baseStream, ok := stream.(*recvStream)
+		if !ok {
+			return nil, fmt.Errorf("invalid stream type: %T", stream)
+		}
+		output, err := handler(ctx, &typedClientStream[TIn]{baseStream})
+		if err != nil {
+			return nil, err
+		}
+		if output == nil {
+			output = new(TOut)
+		}
+		return output, nil
 	}
+}
 
-	return svc.RegisterStreamingMethod(method)
+// wrapBidiStreamHandler converts a typed bidirectional streaming handler to
+// an untyped one.
+func wrapBidiStreamHandler[TIn, TOut any](handler BidiStreamHandler[TIn, TOut]) func(context.Context, any) error {
+	return func(ctx context.Context, stream any) error {
+		baseStream, ok := stream.(*recvStream)
+		if !ok {
+			return fmt.Errorf("invalid stream type: %T", stream)
+		}
+		return handler(ctx, &typedBidiStream[TIn, TOut]{baseStream})
+	}
 }
 
 // MustRegisterServerStream registers a server-streaming method and panics on error.
@@ -894,6 +1290,49 @@ func WithEdition(edition string) ServiceOption {
 	}
 }
 
+// WithSyntax selects the syntax of the service's descriptors: "proto3" (the
+// default), "proto2" for consumers that still require it, or "editions",
+// like WithEdition with the default edition. In proto2, fields tagged
+// `proto:"required"` are required and `default` tags set the default values
+// of scalar fields. Unknown syntaxes select proto3 with a warning.
+func WithSyntax(syntax string) ServiceOption {
+	return func(o *ServiceOptions) {
+		switch syntax {
+		case "proto3", syntaxProto2:
+			o.UseEditions = false
+			o.Syntax = syntax
+		case "editions":
+			o.UseEditions = true
+		default:
+			log.Printf("Warning: unknown syntax %q, using proto3", syntax)
+			o.UseEditions = false
+			o.Syntax = "proto3"
+		}
+	}
+}
+
+// WithPointerScalarsAsWrappers maps pointers to scalars, such as *int32 and
+// *string, to wrapper types like google.protobuf.Int32Value instead of proto3
+// optional fields, for compatibility with existing APIs using wrapper types.
+// A nil pointer leaves the field unset.
+func WithPointerScalarsAsWrappers(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.PointerScalarsAsWrappers = enabled
+	}
+}
+
+// WithProtobufTags takes the names, numbers, JSON names, and integer
+// encodings of fields from the `protobuf:"..."` tags protoc-gen-go emits,
+// such as `protobuf:"zigzag64,3,opt,name=offset,proto3"`, so structs copied
+// from or embedding generated code get the descriptors of the generated
+// messages and stay compatible with them on the wire. Fields without a tag
+// are numbered as usual, skipping the numbers taken by tags.
+func WithProtobufTags(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ProtobufTags = enabled
+	}
+}
+
 // WithServiceConfig sets the gRPC service configuration.
 func WithServiceConfig(jsonConfig string) ServiceOption {
 	return func(o *ServiceOptions) {
@@ -908,6 +1347,15 @@ func WithDescription(description string) ServiceOption {
 	}
 }
 
+// WithCodecOptions configures the protobuf codecs of struct messages, e.g. to
+// select the codec backend or recompile hyperpb types from decode profiles.
+// AllowAlias is ignored, since request buffers are reused after decoding.
+func WithCodecOptions(opts codec.Options) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.CodecOptions = &opts
+	}
+}
+
 // WithJSONRPC enables JSON-RPC 2.0 support with optional path.
 func WithJSONRPC(path string) ServiceOption {
 	return func(o *ServiceOptions) {
@@ -134,11 +134,7 @@ func TestServiceWithEditions(t *testing.T) {
 		method := NewMethod("Test", handler)
 		err := svc.Register(method.Build())
 		if err != nil {
-			// EDITION_2024 might not be supported yet by the Go protobuf runtime
-			if testing.Verbose() {
-				t.Logf("Register with EDITION_2024 failed (this might be expected): %v", err)
-			}
-			t.Skip("EDITION_2024 not yet supported by Go protobuf runtime")
+			t.Fatalf("Failed to register method: %v", err)
 		}
 
 		// Get the file descriptor set
@@ -200,4 +196,45 @@ func TestServiceWithEditions(t *testing.T) {
 			t.Errorf("Edition = %q, want %q", opts.Edition, "2024")
 		}
 	})
+
+	t.Run("Proto2 service", func(t *testing.T) {
+		type Input struct {
+			Name string `json:"name" proto:"required"`
+		}
+		svc := NewService("TestService", WithPackage("proto2.v1"), WithSyntax("proto2"))
+		if err := Register(svc, "Greet", func(ctx context.Context, in *Input) (*Input, error) { return in, nil }); err != nil {
+			t.Fatalf("Failed to register method: %v", err)
+		}
+
+		for _, file := range svc.GetFileDescriptorSet().File {
+			if file.GetSyntax() != "proto2" {
+				t.Errorf("File %s syntax = %q, want %q", file.GetName(), file.GetSyntax(), "proto2")
+			}
+			for _, msg := range file.MessageType {
+				if msg.GetName() == "Input" && msg.Field[0].GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+					t.Errorf("Field name label = %v, want required", msg.Field[0].GetLabel())
+				}
+			}
+		}
+		if svc.builder == NewService("TestService", WithPackage("proto2.v1")).builder {
+			t.Error("Proto2 and proto3 services should have different builders")
+		}
+	})
+
+	t.Run("WithSyntax option", func(t *testing.T) {
+		opts := &ServiceOptions{}
+		WithSyntax("editions")(opts)
+		if !opts.UseEditions {
+			t.Error("WithSyntax(\"editions\") should set UseEditions to true")
+		}
+		WithSyntax("proto2")(opts)
+		if opts.UseEditions || opts.Syntax != "proto2" {
+			t.Errorf("WithSyntax(\"proto2\") = %+v, want proto2 without editions", opts)
+		}
+		WithSyntax("editions")(opts)
+		WithSyntax("proto4")(opts)
+		if opts.UseEditions || opts.Syntax != "proto3" {
+			t.Errorf("WithSyntax(\"proto4\") = %+v, want proto3 without editions", opts)
+		}
+	})
 }
@@ -123,8 +123,15 @@ func (s *Service) RegisterStreamingMethod(method *Method) error {
 		}
 	}
 
+	if s.descriptor == nil {
+		if err := s.checkMessageNames(method); err != nil {
+			return err
+		}
+	}
+
 	// Don't wrap the handler - we'll handle it at runtime
 
 	s.methods[method.Name] = method
+	s.resetOpenRPC()
 	return nil
 }
@@ -0,0 +1,303 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/codec"
+)
+
+// defaultShadowBufferSize is the default number of shadow records waiting to be emitted.
+const defaultShadowBufferSize = 1024
+
+// ErrShadowBufferFull is reported to ShadowCopyOptions.OnError when a shadow
+// record is dropped because the sink does not keep up.
+var ErrShadowBufferFull = errors.New("shadow copy buffer full")
+
+// ShadowRecord is a copy of a completed unary call emitted to a ShadowSink.
+// Messages use the protobuf binary encoding, so consumers can decode them with
+// the descriptors identified by SchemaHash even as the schema evolves.
+type ShadowRecord struct {
+	// Procedure is the called method, e.g. "/user.v1.UserService/GetUser"
+	Procedure string
+	// Time is when the call completed
+	Time time.Time
+	// Duration is how long the handler ran
+	Duration time.Duration
+	// SchemaHash identifies the descriptors of the service, see Service.SchemaHash
+	SchemaHash string
+	// RequestType is the full protobuf name of the request message
+	RequestType string
+	// ResponseType is the full protobuf name of the response message
+	ResponseType string
+	// Request is the redacted request message
+	Request []byte
+	// Response is the redacted response message, nil if the call failed
+	Response []byte
+	// Code is the error code of a failed call, empty on success
+	Code Code
+}
+
+// ShadowSink receives shadow copies of calls, e.g. to forward them to an
+// analytics pipeline. Emit is called from a background goroutine, one record
+// at a time, so it never delays responses.
+type ShadowSink interface {
+	Emit(ctx context.Context, record *ShadowRecord) error
+}
+
+// ShadowSinkFunc adapts a function to a ShadowSink.
+type ShadowSinkFunc func(ctx context.Context, record *ShadowRecord) error
+
+// Emit implements ShadowSink.
+func (f ShadowSinkFunc) Emit(ctx context.Context, record *ShadowRecord) error {
+	return f(ctx, record)
+}
+
+// ShadowCopyOptions configures shadow copies of calls to an analytics sink.
+type ShadowCopyOptions struct {
+	// Sink receives the records; shadow copies are disabled without one
+	Sink ShadowSink
+	// Methods limits copies to these unary methods. Empty copies all of them.
+	Methods []string
+	// SampleRate is the fraction of calls copied. 0 or 1 copies all calls.
+	SampleRate float64
+	// Redact clears these dot-separated field paths (e.g. "user.password") in
+	// requests and responses. Segments match protobuf or JSON field names.
+	Redact []string
+	// BufferSize is the number of records waiting for the sink (default 1024).
+	// Records are dropped while the buffer is full.
+	BufferSize int
+	// OnError is called when the sink fails or a record is dropped
+	OnError func(error)
+}
+
+// WithShadowCopy asynchronously emits a sampled, redacted copy of unary calls
+// to opts.Sink, tagged with the schema hash of the service. Copies are made
+// after the handler returns, so handlers must not modify their request or
+// response afterwards.
+func WithShadowCopy(opts ShadowCopyOptions) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ShadowCopy = opts
+	}
+}
+
+// SchemaHash returns a hash of the descriptors of the service, as carried by
+// shadow records. It changes when messages or methods change, but not when
+// only comments do. Consumers can map it to GetFileDescriptorSet.
+func (s *Service) SchemaHash() string {
+	fdset := s.buildCompleteFileDescriptorSet()
+	for _, file := range fdset.File {
+		file.SourceCodeInfo = nil
+		for _, svc := range file.Service {
+			slices.SortFunc(svc.Method, func(a, b *descriptorpb.MethodDescriptorProto) int {
+				return strings.Compare(a.GetName(), b.GetName())
+			})
+		}
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdset)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// shadowCall is a sampled call waiting to be encoded and emitted.
+type shadowCall struct {
+	ctx         context.Context
+	procedure   string
+	start       time.Time
+	end         time.Time
+	input       any
+	output      any
+	err         error
+	inputCodec  *codec.Codec
+	outputCodec *codec.Codec
+}
+
+// shadowCopier queues sampled calls and emits them to the sink.
+type shadowCopier struct {
+	opts       ShadowCopyOptions
+	calls      chan *shadowCall
+	hashOnce   sync.Once
+	schemaHash string
+	svc        *Service
+}
+
+// newShadowCopier starts the goroutine emitting shadow records of svc.
+func newShadowCopier(svc *Service, opts ShadowCopyOptions) *shadowCopier {
+	size := opts.BufferSize
+	if size <= 0 {
+		size = defaultShadowBufferSize
+	}
+	c := &shadowCopier{
+		opts:  opts,
+		calls: make(chan *shadowCall, size),
+		svc:   svc,
+	}
+	go c.run()
+	return c
+}
+
+// sampled reports whether a call of method should be copied.
+func (c *shadowCopier) sampled(method string) bool {
+	if len(c.opts.Methods) > 0 && !slices.Contains(c.opts.Methods, method) {
+		return false
+	}
+	rate := c.opts.SampleRate
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate //nolint:gosec // sampling does not need a secure source
+}
+
+// capture queues a completed call of a unary method, without blocking.
+func (c *shadowCopier) capture(ctx context.Context, hctx *handlerContext, start time.Time, input, output any, err error) {
+	if !c.sampled(hctx.method.Name) {
+		return
+	}
+	// The input is emitted after the response is written
+	retainArena(ctx)
+	call := &shadowCall{
+		ctx:         context.WithoutCancel(ctx),
+		procedure:   hctx.procedure,
+		start:       start,
+		end:         time.Now(),
+		input:       input,
+		output:      output,
+		err:         err,
+		inputCodec:  hctx.inputCodec,
+		outputCodec: hctx.outputCodec,
+	}
+	select {
+	case c.calls <- call:
+	default:
+		c.reportError(ErrShadowBufferFull)
+	}
+}
+
+// run emits queued calls until the process exits.
+func (c *shadowCopier) run() {
+	for call := range c.calls {
+		record, err := c.record(call)
+		if err == nil {
+			err = c.opts.Sink.Emit(call.ctx, record)
+		}
+		if err != nil {
+			c.reportError(fmt.Errorf("shadow copy of %s: %w", call.procedure, err))
+		}
+	}
+}
+
+// reportError passes err to the OnError callback, if any.
+func (c *shadowCopier) reportError(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+// record encodes and redacts a call.
+func (c *shadowCopier) record(call *shadowCall) (*ShadowRecord, error) {
+	c.hashOnce.Do(func() {
+		c.schemaHash = c.svc.SchemaHash()
+	})
+
+	record := &ShadowRecord{
+		Procedure:  call.procedure,
+		Time:       call.end,
+		Duration:   call.end.Sub(call.start),
+		SchemaHash: c.schemaHash,
+	}
+
+	var err error
+	record.Request, record.RequestType, err = c.encode(call.input, call.inputCodec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	if call.err != nil {
+		record.Code = grpcErrorFor(call.err, true).Code
+		return record, nil
+	}
+	record.Response, record.ResponseType, err = c.encode(call.output, call.outputCodec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return record, nil
+}
+
+// encode returns the redacted protobuf encoding of a message and its type name.
+func (c *shadowCopier) encode(msg any, msgCodec *codec.Codec) ([]byte, string, error) {
+	var data []byte
+	var desc protoreflect.MessageDescriptor
+	var err error
+	if pm, ok := msg.(proto.Message); ok {
+		desc = pm.ProtoReflect().Descriptor()
+		data, err = proto.Marshal(pm)
+	} else if msgCodec != nil {
+		desc = msgCodec.Descriptor()
+		data, err = msgCodec.MarshalStruct(msg)
+	} else {
+		return nil, "", fmt.Errorf("no codec for %T", msg)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(c.opts.Redact) == 0 {
+		return data, string(desc.FullName()), nil
+	}
+
+	redacted := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, redacted); err != nil {
+		return nil, "", err
+	}
+	for _, path := range c.opts.Redact {
+		redactField(redacted, strings.Split(path, "."))
+	}
+	data, err = proto.Marshal(redacted)
+	return data, string(desc.FullName()), err
+}
+
+// redactField clears the field at path in msg, descending into repeated and
+// map values of message fields along the way.
+func redactField(msg protoreflect.Message, path []string) {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(path[0]))
+	if fd == nil {
+		fd = fields.ByJSONName(path[0])
+	}
+	if fd == nil || !msg.Has(fd) {
+		return
+	}
+	if len(path) == 1 {
+		msg.Clear(fd)
+		return
+	}
+
+	switch {
+	case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+		list := msg.Mutable(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			redactField(list.Get(i).Message(), path[1:])
+		}
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.MessageKind:
+		msg.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+			redactField(v.Message(), path[1:])
+			return true
+		})
+	case !fd.IsList() && !fd.IsMap() && fd.Kind() == protoreflect.MessageKind:
+		redactField(msg.Mutable(fd).Message(), path[1:])
+	}
+}
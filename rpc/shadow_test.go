@@ -0,0 +1,138 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ShadowLoginRequest struct {
+	User     string              `json:"user"`
+	Password string              `json:"password"`
+	Profile  *ShadowLoginProfile `json:"profile"`
+}
+
+type ShadowLoginProfile struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+type ShadowLoginResponse struct {
+	Token string `json:"token"`
+}
+
+func TestShadowCopy(t *testing.T) {
+	records := make(chan *rpc.ShadowRecord, 10)
+	svc := rpc.NewService("LoginService", rpc.WithPackage("shadow.v1"), rpc.WithShadowCopy(rpc.ShadowCopyOptions{
+		Sink: rpc.ShadowSinkFunc(func(_ context.Context, record *rpc.ShadowRecord) error {
+			records <- record
+			return nil
+		}),
+		Methods: []string{"Login"},
+		Redact:  []string{"password", "profile.secret", "token"},
+	}))
+	rpc.MustRegister(svc, "Login", func(_ context.Context, req *ShadowLoginRequest) (*ShadowLoginResponse, error) {
+		if req.User == "" {
+			return nil, rpc.NewError(rpc.CodeUnauthenticated, "no user")
+		}
+		return &ShadowLoginResponse{Token: "secret-token"}, nil
+	})
+	rpc.MustRegister(svc, "Ping", func(_ context.Context, _ *ShadowLoginRequest) (*ShadowLoginResponse, error) {
+		return &ShadowLoginResponse{}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(method, body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/shadow.v1.LoginService/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	next := func() *rpc.ShadowRecord {
+		t.Helper()
+		select {
+		case record := <-records:
+			return record
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a shadow record")
+			return nil
+		}
+	}
+
+	// Consumers decode records with the descriptors of the service
+	files, err := protodesc.NewFiles(svc.GetFileDescriptorSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode := func(typeName string, data []byte) protoreflect.Message {
+		t.Helper()
+		desc, err := files.FindDescriptorByName(protoreflect.FullName(typeName))
+		if err != nil {
+			t.Fatalf("Unknown type %q: %v", typeName, err)
+		}
+		msg := dynamicpb.NewMessage(desc.(protoreflect.MessageDescriptor))
+		if err := proto.Unmarshal(data, msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	field := func(msg protoreflect.Message, name string) protoreflect.Value {
+		return msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name)))
+	}
+
+	t.Run("redacted copy", func(t *testing.T) {
+		call("Ping", `{}`) // not selected
+		call("Login", `{"user":"alice","password":"hunter2","profile":{"name":"Alice","secret":"s3"}}`)
+		record := next()
+
+		if record.Procedure != "/shadow.v1.LoginService/Login" || record.Code != "" {
+			t.Errorf("Unexpected record %+v", record)
+		}
+		if record.SchemaHash == "" || record.SchemaHash != svc.SchemaHash() {
+			t.Errorf("Expected schema hash %q, got %q", svc.SchemaHash(), record.SchemaHash)
+		}
+
+		req := decode(record.RequestType, record.Request)
+		if got := field(req, "user").String(); got != "alice" {
+			t.Errorf("Expected user alice, got %q", got)
+		}
+		if got := field(req, "password").String(); got != "" {
+			t.Errorf("Expected the password to be redacted, got %q", got)
+		}
+		profile := field(req, "profile").Message()
+		if field(profile, "name").String() != "Alice" || field(profile, "secret").String() != "" {
+			t.Errorf("Expected the profile secret to be redacted, got %v", profile)
+		}
+		if resp := decode(record.ResponseType, record.Response); field(resp, "token").String() != "" {
+			t.Errorf("Expected the token to be redacted")
+		}
+	})
+
+	t.Run("failed call", func(t *testing.T) {
+		call("Login", `{}`)
+		record := next()
+		if record.Code != rpc.CodeUnauthenticated || record.Response != nil {
+			t.Errorf("Expected an unauthenticated record without response, got %+v", record)
+		}
+	})
+
+	select {
+	case record := <-records:
+		t.Errorf("Unexpected record for %s", record.Procedure)
+	default:
+	}
+}
@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/i2y/hyperway/gateway"
+)
+
+// RPCStats describes a finished call, for metrics.
+type RPCStats struct {
+	// Method is the name of the called method.
+	Method string
+	// Procedure is the full name of the method, "/package.Service/Method".
+	Procedure string
+	// Protocol is the protocol of the call, see Metadata.Protocol.
+	Protocol string
+	// StreamType is the stream type of the method.
+	StreamType StreamType
+	// Code is the status of the call, empty if it succeeded.
+	Code Code
+	// Latency is the time from the start of the call until its response was
+	// complete.
+	Latency time.Duration
+	// Attempts is the number of attempts of the call: 1, plus the previous
+	// attempts reported by the client and the retries and hedged attempts
+	// of the service.
+	Attempts int
+	// RequestBytes is the size of the request body, as received.
+	RequestBytes int64
+	// ResponseBytes is the size of the response body, as sent.
+	ResponseBytes int64
+	// RequestMessages is the number of request messages received.
+	RequestMessages int
+	// ResponseMessages is the number of response messages sent.
+	ResponseMessages int
+}
+
+// OnResponse calls hook with the stats of each call of the service once its
+// response is complete, whatever the protocol, including streams and the
+// calls of JSON-RPC batches. Unlike interceptors, hooks see calls rejected
+// before the handler runs and the final status of responses, and cost
+// nothing to calls of services without hooks, which suits exporters of
+// metrics:
+//
+//	svc := rpc.NewService("UserService", rpc.OnResponse(func(ctx context.Context, stats rpc.RPCStats) {
+//		latency.Record(ctx, stats.Latency.Seconds(), metric.WithAttributes(
+//			attribute.String("rpc.method", stats.Method),
+//			attribute.String("rpc.status", string(stats.Code)),
+//		))
+//	}))
+//
+// Hooks run on the goroutine serving the call, after its response, and
+// should return quickly.
+func OnResponse(hook func(ctx context.Context, stats RPCStats)) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ResponseHooks = append(o.ResponseHooks, hook)
+	}
+}
+
+// statsContextKey stores the statsWriter of a call.
+const statsContextKey contextKey = "hyperway-rpc-stats"
+
+// statsWriter records the status, size and messages of a response, and the
+// size of the request body.
+type statsWriter struct {
+	*gateway.ResponseRecorder
+	start    time.Time
+	code     Code
+	messages int
+	body     *countingBody
+}
+
+// countingBody counts bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read reads from the underlying body and counts bytes.
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// recordStats wraps a call to record its stats when the service has response
+// hooks. The returned function reports them.
+func (s *Service) recordStats(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func(*handlerContext)) {
+	if len(s.options.ResponseHooks) == 0 {
+		return w, r, nil
+	}
+	sw := &statsWriter{ResponseRecorder: &gateway.ResponseRecorder{ResponseWriter: w}, start: time.Now()}
+	r = r.WithContext(context.WithValue(r.Context(), statsContextKey, sw))
+	if r.Body != nil && r.Body != http.NoBody {
+		sw.body = &countingBody{ReadCloser: r.Body}
+		r.Body = sw.body
+	}
+	return sw, r, func(hctx *handlerContext) {
+		s.reportStats(r.Context(), sw, hctx)
+	}
+}
+
+// recordStatus records the status of a failed call, written by an error
+// writer of its protocol.
+func recordStatus(ctx context.Context, code Code) {
+	if sw, ok := ctx.Value(statsContextKey).(*statsWriter); ok {
+		sw.code = code
+	}
+}
+
+// recordResponseMessages records the number of messages sent on a stream.
+func recordResponseMessages(ctx context.Context, n int) {
+	if sw, ok := ctx.Value(statsContextKey).(*statsWriter); ok {
+		sw.messages = n
+	}
+}
+
+// reportStats calls the response hooks with the stats of a call served over
+// HTTP. JSON-RPC calls are reported by processJSONRPCRequest instead, one by
+// one, as batches may mix methods.
+func (s *Service) reportStats(ctx context.Context, sw *statsWriter, hctx *handlerContext) {
+	if hctx.protocol == protocolJSONRPC {
+		return
+	}
+	stats := RPCStats{
+		Method:        hctx.method.Name,
+		Procedure:     hctx.procedure,
+		Protocol:      hctx.protocol,
+		StreamType:    hctx.method.StreamType,
+		Code:          sw.statusCode(),
+		Latency:       time.Since(sw.start),
+		Attempts:      attempts(hctx),
+		ResponseBytes: sw.BytesWritten(),
+	}
+	if sw.body != nil {
+		stats.RequestBytes = sw.body.n
+	}
+	if stats.RequestBytes > 0 {
+		stats.RequestMessages = 1
+	}
+	switch {
+	case hctx.method.StreamType != StreamTypeUnary:
+		stats.ResponseMessages = sw.messages
+	case stats.Code == "":
+		stats.ResponseMessages = 1
+	}
+	s.callResponseHooks(ctx, stats)
+}
+
+// reportJSONRPCStats calls the response hooks with the stats of a JSON-RPC
+// call. Errors without a code are invalid params or internal errors.
+func (s *Service) reportJSONRPCStats(ctx context.Context, hctx *handlerContext, req *JSONRPCRequest, resp *JSONRPCResponse, code Code, start time.Time) {
+	if code == "" && resp.Error != nil {
+		code = CodeInternal
+		if resp.Error.Code == JSONRPCInvalidParams {
+			code = CodeInvalidArgument
+		}
+	}
+	stats := RPCStats{
+		Method:        hctx.method.Name,
+		Procedure:     hctx.procedure,
+		Protocol:      protocolJSONRPC,
+		StreamType:    hctx.method.StreamType,
+		Code:          code,
+		Latency:       time.Since(start),
+		Attempts:      attempts(hctx),
+		RequestBytes:  int64(len(req.Params)),
+		ResponseBytes: int64(len(resp.Result)),
+	}
+	if len(req.Params) > 0 {
+		stats.RequestMessages = 1
+	}
+	if code == "" {
+		stats.ResponseMessages = 1
+	}
+	s.callResponseHooks(ctx, stats)
+}
+
+// statusCode returns the status of the call: the one recorded by the error
+// writers, or else the status of gRPC responses and failed HTTP responses.
+func (w *statsWriter) statusCode() Code {
+	if w.code != "" {
+		return w.code
+	}
+	h := w.Header()
+	for _, key := range []string{"Grpc-Status", http.TrailerPrefix + "Grpc-Status"} {
+		if status, err := strconv.Atoi(h.Get(key)); err == nil && status != 0 {
+			return codeForGRPCStatus(status)
+		}
+	}
+	if status := w.Status(); status >= http.StatusBadRequest {
+		return codeForHTTPStatus(status)
+	}
+	return ""
+}
+
+// attempts returns the number of attempts of a call: the final attempt
+// reported by the retry interceptor, or else the attempt of the client.
+func attempts(hctx *handlerContext) int {
+	if values := hctx.responseHeaders[PreviousRPCAttemptsHeader]; len(values) > 0 {
+		if n, err := strconv.Atoi(values[len(values)-1]); err == nil && n >= 0 {
+			return n + 1
+		}
+	}
+	n, err := strconv.Atoi(http.Header(hctx.requestHeaders).Get(PreviousRPCAttemptsHeader))
+	if err != nil || n < 0 {
+		return 1
+	}
+	return n + 1
+}
+
+// callResponseHooks calls the response hooks of the service.
+func (s *Service) callResponseHooks(ctx context.Context, stats RPCStats) {
+	for _, hook := range s.options.ResponseHooks {
+		hook(ctx, stats)
+	}
+}
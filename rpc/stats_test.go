@@ -0,0 +1,162 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type StatsRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type StatsResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestOnResponse(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []rpc.RPCStats
+	)
+	svc := rpc.NewService("StatsService",
+		rpc.WithPackage("stats.v1"),
+		rpc.WithJSONRPC("/jsonrpc"),
+		rpc.OnResponse(func(_ context.Context, stats rpc.RPCStats) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, stats)
+		}),
+	)
+	rpc.MustRegister(svc, "Greet", func(_ context.Context, req *StatsRequest) (*StatsResponse, error) {
+		if req.Name == "" {
+			return nil, rpc.NewError(rpc.CodeNotFound, "nobody to greet")
+		}
+		return &StatsResponse{Greeting: "Hello, " + req.Name}, nil
+	})
+	rpc.MustRegisterServerStream(svc, "Repeat", func(_ context.Context, req *StatsRequest, stream rpc.ServerStream[StatsResponse]) error {
+		for range req.Count {
+			if err := stream.Send(&StatsResponse{Greeting: "Hello, " + req.Name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	call := func(t *testing.T, req *http.Request) (*httptest.ResponseRecorder, rpc.RPCStats) {
+		t.Helper()
+		mu.Lock()
+		calls = nil
+		mu.Unlock()
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(calls) != 1 {
+			t.Fatalf("Expected stats of 1 call, got %+v", calls)
+		}
+		return rec, calls[0]
+	}
+	unary := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/stats.v1.StatsService/Greet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		return req
+	}
+
+	t.Run("successful calls", func(t *testing.T) {
+		req := unary(`{"name":"ann"}`)
+		req.Header.Set(rpc.PreviousRPCAttemptsHeader, "2")
+		rec, stats := call(t, req)
+		if stats.Code != "" || stats.Method != "Greet" || stats.Procedure != "/stats.v1.StatsService/Greet" || stats.Protocol != "connect" {
+			t.Errorf("Expected a successful Connect call of Greet, got %+v", stats)
+		}
+		if stats.Attempts != 3 || stats.Latency <= 0 {
+			t.Errorf("Expected 3 attempts and a latency, got %+v", stats)
+		}
+		if stats.RequestBytes != int64(len(`{"name":"ann"}`)) || stats.ResponseBytes != int64(rec.Body.Len()) {
+			t.Errorf("Expected the sizes of the messages, got %+v for %s", stats, rec.Body)
+		}
+		if stats.RequestMessages != 1 || stats.ResponseMessages != 1 {
+			t.Errorf("Expected 1 message each way, got %+v", stats)
+		}
+	})
+
+	t.Run("failed calls", func(t *testing.T) {
+		_, stats := call(t, unary(`{}`))
+		if stats.Code != rpc.CodeNotFound || stats.ResponseMessages != 0 {
+			t.Errorf("Expected a not found call without response, got %+v", stats)
+		}
+		_, stats = call(t, unary(`{"name":`))
+		if stats.Code != rpc.CodeInvalidArgument {
+			t.Errorf("Expected an invalid argument call, got %+v", stats)
+		}
+	})
+
+	t.Run("failed calls report one status per protocol", func(t *testing.T) {
+		for _, tc := range []struct {
+			name        string
+			contentType string
+			connect     bool
+			body        []byte
+		}{
+			{"connect", "application/json", true, []byte(`{}`)},
+			{"http", "application/json", false, []byte(`{}`)},
+			{"grpc", "application/grpc+json", false, connectEnvelope([]byte(`{}`))},
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/stats.v1.StatsService/Greet", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.connect {
+				req.Header.Set("Connect-Protocol-Version", "1")
+			}
+			_, stats := call(t, req)
+			if stats.Code != rpc.CodeNotFound {
+				t.Errorf("%s: expected a not found call, got %+v", tc.name, stats)
+			}
+		}
+	})
+
+	t.Run("streams count messages", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/stats.v1.StatsService/Repeat",
+			bytes.NewReader(connectEnvelope([]byte(`{"name":"ann","count":3}`))))
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec, stats := call(t, req)
+		if stats.Code != "" || stats.StreamType != rpc.StreamTypeServerStream || stats.ResponseMessages != 3 {
+			t.Errorf("Expected a stream of 3 messages, got %+v", stats)
+		}
+		if stats.ResponseBytes != int64(rec.Body.Len()) {
+			t.Errorf("Expected %d bytes, got %+v", rec.Body.Len(), stats)
+		}
+	})
+
+	t.Run("JSON-RPC batches report each call", func(t *testing.T) {
+		mu.Lock()
+		calls = nil
+		mu.Unlock()
+		req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(
+			`[{"jsonrpc":"2.0","method":"Greet","params":{"name":"ann"},"id":1},{"jsonrpc":"2.0","method":"Greet","params":{},"id":2}]`))
+		req.Header.Set("Content-Type", "application/json")
+		gw.ServeHTTP(httptest.NewRecorder(), req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(calls) != 2 {
+			t.Fatalf("Expected stats of 2 calls, got %+v", calls)
+		}
+		codes := map[rpc.Code]bool{calls[0].Code: true, calls[1].Code: true}
+		if !codes[""] || !codes[rpc.CodeNotFound] || calls[0].Protocol != "jsonrpc" {
+			t.Errorf("Expected a successful and a not found JSON-RPC call, got %+v", calls)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package rpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// statusMappingCodes are the error codes with their gRPC status.
+var statusMappingCodes = map[rpc.Code]codes.Code{
+	rpc.CodeCanceled:           codes.Canceled,
+	rpc.CodeUnknown:            codes.Unknown,
+	rpc.CodeInvalidArgument:    codes.InvalidArgument,
+	rpc.CodeDeadlineExceeded:   codes.DeadlineExceeded,
+	rpc.CodeNotFound:           codes.NotFound,
+	rpc.CodeAlreadyExists:      codes.AlreadyExists,
+	rpc.CodePermissionDenied:   codes.PermissionDenied,
+	rpc.CodeResourceExhausted:  codes.ResourceExhausted,
+	rpc.CodeFailedPrecondition: codes.FailedPrecondition,
+	rpc.CodeAborted:            codes.Aborted,
+	rpc.CodeOutOfRange:         codes.OutOfRange,
+	rpc.CodeUnimplemented:      codes.Unimplemented,
+	rpc.CodeInternal:           codes.Internal,
+	rpc.CodeUnavailable:        codes.Unavailable,
+	rpc.CodeDataLoss:           codes.DataLoss,
+	rpc.CodeUnauthenticated:    codes.Unauthenticated,
+}
+
+func TestStatusMapping(t *testing.T) {
+	svc := rpc.NewService("StatusService", rpc.WithPackage("status.v1"))
+	fail := func(code string) error {
+		return rpc.NewError(rpc.Code(code), "failed with "+code)
+	}
+	rpc.MustRegister(svc, "Fail", func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return nil, fail(req.GetValue())
+	})
+	rpc.MustRegisterServerStream(svc, "FailStream", func(_ context.Context, req *wrapperspb.StringValue, stream rpc.ServerStream[wrapperspb.StringValue]) error {
+		if err := stream.Send(wrapperspb.String("first")); err != nil {
+			return err
+		}
+		return fail(req.GetValue())
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(gw, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	h2Client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	for name, opts := range map[string][]connect.ClientOption{
+		"connect":  nil,
+		"grpc":     {connect.WithGRPC()},
+		"grpc-web": {connect.WithGRPCWeb()},
+	} {
+		t.Run("connect-go "+name+" clients", func(t *testing.T) {
+			unary := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+				h2Client, server.URL+"/status.v1.StatusService/Fail", opts...)
+			stream := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+				h2Client, server.URL+"/status.v1.StatusService/FailStream", opts...)
+			for code := range statusMappingCodes {
+				_, err := unary.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String(string(code))))
+				var connectErr *connect.Error
+				if !errors.As(err, &connectErr) || connectErr.Code().String() != string(code) || connectErr.Message() != "failed with "+string(code) {
+					t.Errorf("Expected a %s error from Fail, got %v", code, err)
+				}
+
+				responses, err := stream.CallServerStream(context.Background(), connect.NewRequest(wrapperspb.String(string(code))))
+				if err != nil {
+					t.Fatalf("Failed to open stream: %v", err)
+				}
+				received := 0
+				for responses.Receive() {
+					received++
+				}
+				if got := connect.CodeOf(responses.Err()); got.String() != string(code) || received != 1 {
+					t.Errorf("Expected a message and a %s error from FailStream, got %d and %v", code, received, responses.Err())
+				}
+				_ = responses.Close()
+			}
+		})
+	}
+
+	t.Run("grpc-go clients", func(t *testing.T) {
+		conn, err := grpc.NewClient("passthrough:///"+strings.TrimPrefix(server.URL, "http://"),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		for code, want := range statusMappingCodes {
+			err := conn.Invoke(context.Background(), "/status.v1.StatusService/Fail", wrapperspb.String(string(code)), &wrapperspb.StringValue{})
+			if st := status.Convert(err); st.Code() != want || st.Message() != "failed with "+string(code) {
+				t.Errorf("Expected %v for %s, got %v", want, code, err)
+			}
+		}
+	})
+
+	t.Run("plain HTTP clients", func(t *testing.T) {
+		for code := range statusMappingCodes {
+			req := httptest.NewRequest(http.MethodPost, "/status.v1.StatusService/Fail", strings.NewReader(`"`+string(code)+`"`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+			if rec.Code != code.HTTPStatusCode() || !strings.Contains(rec.Body.String(), `"code":"`+string(code)+`"`) {
+				t.Errorf("Expected %d and the code %s, got %d: %s", code.HTTPStatusCode(), code, rec.Code, rec.Body)
+			}
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// StreamFlowControl buffers the messages of server streams, so that handlers
+// producing messages faster than the client reads them are slowed down
+// instead of growing memory. Send encodes a message into the buffer and
+// returns; a writer drains the buffer to the client, subject to HTTP/2 flow
+// control. Once HighWaterMark bytes are buffered, Send blocks until the
+// client has read the buffer down to LowWaterMark, the stream is canceled,
+// or the client disconnects.
+type StreamFlowControl struct {
+	// HighWaterMark is the number of encoded bytes buffered before Send
+	// blocks (0 writes each message from Send, without a buffer)
+	HighWaterMark int
+	// LowWaterMark is the number of buffered bytes below which a blocked
+	// Send resumes (default: HighWaterMark / 2)
+	LowWaterMark int
+	// SendTimeout bounds how long a write waits for the client to read,
+	// failing the stream with CodeResourceExhausted when it expires (0 waits
+	// until the stream ends)
+	SendTimeout time.Duration
+}
+
+// WithStreamFlowControl buffers the messages of the service's server streams
+// with the given marks.
+func WithStreamFlowControl(fc StreamFlowControl) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StreamFlowControl = fc
+	}
+}
+
+// WithStreamFlowControl overrides the stream flow control of the service for
+// the method.
+func (m *MethodBuilder) WithStreamFlowControl(fc StreamFlowControl) *MethodBuilder {
+	m.method.Options.StreamFlowControl = &fc
+	return m
+}
+
+// streamFlowControl returns the flow control of the streams of method.
+func (s *Service) streamFlowControl(method *Method) StreamFlowControl {
+	if method.Options.StreamFlowControl != nil {
+		return *method.Options.StreamFlowControl
+	}
+	return s.options.StreamFlowControl
+}
+
+// errStreamSendTimeout is returned by Send when the client did not read the
+// stream within the send timeout.
+var errStreamSendTimeout = NewError(CodeResourceExhausted, "client did not read the stream in time")
+
+// streamBuffer holds the frames of a stream until a writer goroutine writes
+// them to the client.
+type streamBuffer struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	rc      *http.ResponseController
+	fc      StreamFlowControl
+	cancel  context.CancelCauseFunc // Cancels the stream when a write fails
+
+	mu     sync.Mutex
+	frames [][]byte
+	size   int   // Buffered bytes
+	closed bool  // No more frames will be enqueued
+	err    error // Write error, ending the stream
+	ready  chan struct{}
+	space  chan struct{}
+	done   chan struct{}
+}
+
+// newStreamBuffer starts the writer of a buffered stream.
+func newStreamBuffer(w http.ResponseWriter, flusher http.Flusher, fc StreamFlowControl, cancel context.CancelCauseFunc) *streamBuffer {
+	if fc.LowWaterMark <= 0 || fc.LowWaterMark > fc.HighWaterMark {
+		fc.LowWaterMark = fc.HighWaterMark / 2
+	}
+	b := &streamBuffer{
+		w:       w,
+		flusher: flusher,
+		rc:      http.NewResponseController(w),
+		fc:      fc,
+		cancel:  cancel,
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// enqueue adds a frame, which the buffer takes ownership of, waiting for room
+// while the buffer is above its high-water mark.
+func (b *streamBuffer) enqueue(ctx context.Context, frame []byte) error {
+	for {
+		b.mu.Lock()
+		if b.err != nil {
+			b.mu.Unlock()
+			return b.err
+		}
+		// A frame larger than the buffer is accepted once it is empty
+		if b.size == 0 || b.size+len(frame) <= b.fc.HighWaterMark {
+			b.frames = append(b.frames, frame)
+			b.size += len(frame)
+			b.mu.Unlock()
+			signal(b.ready)
+			return nil
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-b.space:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// run writes the buffered frames until the buffer is closed and drained.
+func (b *streamBuffer) run() {
+	defer close(b.done)
+	for {
+		b.mu.Lock()
+		frames, closed := b.frames, b.closed
+		b.frames = nil
+		b.mu.Unlock()
+
+		if len(frames) == 0 {
+			if closed {
+				return
+			}
+			<-b.ready
+			continue
+		}
+
+		err := b.write(frames)
+		b.mu.Lock()
+		for _, frame := range frames {
+			b.size -= len(frame)
+		}
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+		resume := b.err != nil || b.size <= b.fc.LowWaterMark
+		b.mu.Unlock()
+		if resume {
+			signal(b.space)
+		}
+		if err != nil {
+			b.cancel(err)
+			b.discard()
+			return
+		}
+	}
+}
+
+// write writes frames and flushes them, within the send timeout.
+func (b *streamBuffer) write(frames [][]byte) error {
+	if b.fc.SendTimeout > 0 {
+		_ = b.rc.SetWriteDeadline(time.Now().Add(b.fc.SendTimeout)) // Unsupported by some writers
+	}
+	for _, frame := range frames {
+		if _, err := b.w.Write(frame); err != nil {
+			return writeError(err)
+		}
+	}
+	if b.flusher != nil {
+		if err := b.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return writeError(err)
+		}
+	}
+	return nil
+}
+
+// writeError reports a write that timed out as such.
+func writeError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return errStreamSendTimeout
+	}
+	return err
+}
+
+// discard drops the frames enqueued after a write error.
+func (b *streamBuffer) discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.frames, b.size = nil, 0
+}
+
+// close writes the remaining frames and stops the writer. If ctx is done,
+// pending writes are abandoned so the stream can end. It returns the write
+// error of the stream, if any.
+func (b *streamBuffer) close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	signal(b.ready)
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		_ = b.rc.SetWriteDeadline(time.Now()) // Unblocks a write to a client that stopped reading
+		<-b.done
+	}
+	_ = b.rc.SetWriteDeadline(time.Time{}) // Lets the stream end be written
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// signal wakes up a waiter on ch without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
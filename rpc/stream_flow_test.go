@@ -0,0 +1,111 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type FeedRequest struct {
+	Count int `json:"count"`
+}
+
+type FeedItem struct {
+	N       int    `json:"n"`
+	Payload string `json:"payload"`
+}
+
+// slowClientWriter is a response writer whose writes wait until the client
+// reads, or fail once the client is gone.
+type slowClientWriter struct {
+	*httptest.ResponseRecorder
+	reading chan struct{}
+	gone    bool
+}
+
+func (w *slowClientWriter) Write(p []byte) (int, error) {
+	if w.gone {
+		return 0, errors.New("client disconnected")
+	}
+	<-w.reading
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamFlowControl(t *testing.T) {
+	var sent atomic.Int32
+	var streamErr atomic.Value
+	svc := rpc.NewService("FeedService", rpc.WithPackage("feed.v1"),
+		rpc.WithStreamFlowControl(rpc.StreamFlowControl{HighWaterMark: 1024}))
+	rpc.MustRegisterServerStream(svc, "Feed", func(_ context.Context, req *FeedRequest, stream rpc.ServerStream[FeedItem]) error {
+		for i := 1; i <= req.Count; i++ {
+			if err := stream.Send(&FeedItem{N: i, Payload: strings.Repeat("x", 100)}); err != nil {
+				streamErr.Store(context.Cause(stream.Context()))
+				return err
+			}
+			sent.Add(1)
+		}
+		return nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	serve := func(w http.ResponseWriter) <-chan struct{} {
+		req := httptest.NewRequest(http.MethodPost, "/feed.v1.FeedService/Feed",
+			bytes.NewReader(connectEnvelope([]byte(`{"count":100}`))))
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			gw.ServeHTTP(w, req)
+		}()
+		return done
+	}
+
+	t.Run("send blocks until the client reads", func(t *testing.T) {
+		sent.Store(0)
+		w := &slowClientWriter{ResponseRecorder: httptest.NewRecorder(), reading: make(chan struct{})}
+		done := serve(w)
+
+		// Wait for the handler to stall on the full buffer
+		for last := int32(-1); sent.Load() != last; time.Sleep(50 * time.Millisecond) {
+			last = sent.Load()
+		}
+		if n := sent.Load(); n == 0 || n > 12 {
+			t.Errorf("Expected Send to block after about 1KB of messages, sent %d", n)
+		}
+
+		close(w.reading)
+		<-done
+		frames := readConnectFrames(t, w.Body)
+		if len(frames) != 101 {
+			t.Fatalf("Expected 100 messages and an end-stream frame, got %d frames", len(frames))
+		}
+		if !strings.Contains(string(frames[99].data), `"n":100`) || frames[100].flags != 0x02 {
+			t.Errorf("Unexpected stream end: %q, %q", frames[99].data, frames[100].data)
+		}
+	})
+
+	t.Run("disconnect cancels the stream context", func(t *testing.T) {
+		w := &slowClientWriter{ResponseRecorder: httptest.NewRecorder(), gone: true}
+		select {
+		case <-serve(w):
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stream did not end after the client disconnected")
+		}
+		cause, _ := streamErr.Load().(error)
+		if cause == nil || !strings.Contains(cause.Error(), "client disconnected") {
+			t.Errorf("Expected the stream context to be canceled by the failed write, got %v", cause)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// WithStreamHeartbeat sends a heartbeat on server streams that have been idle
+// for interval, so that proxies and browsers don't time them out. Connect and
+// gRPC streams send an empty message, which clients decode as a message with
+// all fields at their defaults, and newline-delimited JSON streams send a
+// blank line. A negative interval disables heartbeats, which otherwise default
+// to the keepalive time of the gateway's KeepaliveParams.
+func WithStreamHeartbeat(interval time.Duration) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StreamHeartbeat = interval
+	}
+}
+
+// WithStreamHeartbeat overrides the heartbeat interval of the service for the
+// method. A negative interval disables heartbeats.
+func (m *MethodBuilder) WithStreamHeartbeat(interval time.Duration) *MethodBuilder {
+	m.method.Options.StreamHeartbeat = &interval
+	return m
+}
+
+// heartbeatWriter is a response writer sending heartbeats its own way, such
+// as the SSE comments of GraphQL subscriptions served by the gateway.
+type heartbeatWriter interface {
+	WriteHeartbeat() error
+}
+
+// streamHeartbeat returns the heartbeat interval of the streams of method, or
+// 0 if they send no heartbeats.
+func (s *Service) streamHeartbeat(method *Method) time.Duration {
+	interval := s.options.StreamHeartbeat
+	if method.Options.StreamHeartbeat != nil {
+		interval = *method.Options.StreamHeartbeat
+	}
+	if interval == 0 {
+		interval = time.Duration(s.keepaliveTime.Load())
+	}
+	return max(interval, 0)
+}
+
+// startHeartbeat sends heartbeats on the stream while it is idle for interval.
+func (s *serverStreamWriter) startHeartbeat(interval time.Duration) {
+	if s.protocol.isConnect || s.protocol.isGRPC {
+		var data []byte
+		if s.protocol.wantsJSON {
+			data = []byte("{}")
+		}
+		s.heartbeatFrame = make([]byte, frameHeaderLength+len(data))
+		binary.BigEndian.PutUint32(s.heartbeatFrame[frameLengthOffset:frameLengthSize], uint32(len(data))) //nolint:gosec // constant length
+		copy(s.heartbeatFrame[frameHeaderLength:], data)
+	} else if s.sse {
+		s.heartbeatFrame = []byte(": heartbeat\n\n")
+	} else {
+		s.heartbeatFrame = []byte("\n")
+	}
+
+	s.heartbeatStop = make(chan struct{})
+	s.heartbeatDone = make(chan struct{})
+	go s.heartbeat(interval)
+}
+
+// heartbeat sends heartbeats until the stream ends.
+func (s *serverStreamWriter) heartbeat(interval time.Duration) {
+	defer close(s.heartbeatDone)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.heartbeatStop:
+			return
+		case <-s.Context().Done():
+			return
+		case <-timer.C:
+		}
+
+		if idle := time.Since(time.Unix(0, s.lastWrite.Load())); idle < interval {
+			timer.Reset(interval - idle)
+			continue
+		}
+		if err := s.sendHeartbeat(); err != nil {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// sendHeartbeat writes a heartbeat, sending the headers first if no message
+// has been sent yet.
+func (s *serverStreamWriter) sendHeartbeat() error {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return s.err
+	}
+	if !s.headersSent {
+		s.sendHeaders()
+		s.headersSent = true
+	}
+	s.mu.Unlock()
+
+	var err error
+	if hw, ok := s.w.(heartbeatWriter); ok {
+		err = hw.WriteHeartbeat()
+	} else {
+		err = s.writeFrame(s.heartbeatFrame, true)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		s.cancel(err)
+		return err
+	}
+	return nil
+}
+
+// stopHeartbeat stops the heartbeats before the stream ends. Called without
+// mu held, as a heartbeat being sent takes it.
+func (s *serverStreamWriter) stopHeartbeat() {
+	if s.heartbeatStop == nil {
+		return
+	}
+	close(s.heartbeatStop)
+	<-s.heartbeatDone
+	s.heartbeatStop = nil
+}
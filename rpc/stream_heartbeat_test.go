@@ -0,0 +1,96 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/gateway"
+	"github.com/i2y/hyperway/rpc"
+)
+
+func TestStreamHeartbeat(t *testing.T) {
+	pulse := func(_ context.Context, _ *TickRequest, stream rpc.ServerStream[TickResponse]) error {
+		if err := stream.Send(&TickResponse{N: 1}); err != nil {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+		return stream.Send(&TickResponse{N: 2})
+	}
+	newService := func(opts ...rpc.ServiceOption) *rpc.Service {
+		svc := rpc.NewService("PulseService", append([]rpc.ServiceOption{rpc.WithPackage("pulse.v1")}, opts...)...)
+		rpc.MustRegisterServerStream(svc, "Pulse", pulse)
+		rpc.MustRegisterMethod(svc, rpc.NewServerStreamMethod("Quiet", pulse).WithStreamHeartbeat(-1))
+		return svc
+	}
+	call := func(gw http.Handler, method string, connect bool) *httptest.ResponseRecorder {
+		body := []byte(`{}`)
+		if connect {
+			body = connectEnvelope(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/pulse.v1.PulseService/"+method, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if connect {
+			req.Header.Set("Content-Type", "application/connect+json")
+			req.Header.Set("Connect-Protocol-Version", "1")
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	gw, err := rpc.NewGateway(newService(rpc.WithStreamHeartbeat(20*time.Millisecond), rpc.WithGraphQL(true)))
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	t.Run("idle Connect stream sends empty messages", func(t *testing.T) {
+		frames := readConnectFrames(t, call(gw, "Pulse", true).Body)
+		if len(frames) < 5 {
+			t.Fatalf("Expected heartbeats between the messages, got %d frames", len(frames))
+		}
+		if string(frames[0].data) != `{"n":1}` || string(frames[len(frames)-2].data) != `{"n":2}` {
+			t.Errorf("Unexpected messages: %q, %q", frames[0].data, frames[len(frames)-2].data)
+		}
+		for _, frame := range frames[1 : len(frames)-2] {
+			if frame.flags != 0 || string(frame.data) != "{}" {
+				t.Errorf("Expected an empty message heartbeat, got flags %#x and %q", frame.flags, frame.data)
+			}
+		}
+	})
+
+	t.Run("method override disables heartbeats", func(t *testing.T) {
+		if frames := readConnectFrames(t, call(gw, "Quiet", true).Body); len(frames) != 3 {
+			t.Errorf("Expected 2 messages and an end-stream frame, got %d frames", len(frames))
+		}
+	})
+
+	t.Run("GraphQL subscription sends SSE comments", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"subscription { pulse { n } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		events := rec.Body.String()
+		if !strings.Contains(events, "\n\n: heartbeat\n\n") || strings.Count(events, "event: next") != 2 {
+			t.Errorf("Expected heartbeat comments between two events, got %q", events)
+		}
+	})
+
+	t.Run("default from gateway keepalive", func(t *testing.T) {
+		gw, err := rpc.NewGatewayWithOptions(gateway.Options{
+			KeepaliveParams: &gateway.KeepaliveParameters{Time: 20 * time.Millisecond},
+		}, newService())
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		body := call(gw, "Pulse", false).Body.String()
+		if !strings.HasPrefix(body, "{\"n\":1}\n\n") || !strings.HasSuffix(body, "\n{\"n\":2}\n") {
+			t.Errorf("Expected blank line heartbeats between the messages, got %q", body)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// handleClientStreamRequest handles client-streaming RPC requests: the
+// handler receives the messages of the client and its response is sent as
+// the only message of the response stream.
+func (s *Service) handleClientStreamRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo) {
+	s.serveRecvStream(w, r, ctx, p, func(reqCtx context.Context, stream *recvStream) error {
+		output, err := s.callClientStreamHandler(ctx, reqCtx, stream)
+		if err != nil {
+			return err
+		}
+		return stream.Send(output)
+	})
+}
+
+// handleBidiStreamRequest handles bidirectional streaming RPC requests
+func (s *Service) handleBidiStreamRequest(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo) {
+	s.serveRecvStream(w, r, ctx, p, func(reqCtx context.Context, stream *recvStream) error {
+		return s.callBidiStreamHandler(ctx, reqCtx, stream)
+	})
+}
+
+// serveRecvStream serves a stream receiving the messages of the client with
+// call, writing its responses like the ones of server streams.
+func (s *Service) serveRecvStream(w http.ResponseWriter, r *http.Request, ctx *handlerContext, p protocolInfo, call func(context.Context, *recvStream) error) {
+	defer func() { _ = r.Body.Close() }()
+
+	// Only accept POST
+	if r.Method != http.MethodPost {
+		s.handleMethodNotAllowed(w, r, p)
+		return
+	}
+
+	// Parse timeout
+	reqCtx := parseRequestTimeout(r, p, s.methodTimeout(ctx.procedure))
+	if cancel, ok := reqCtx.Value(contextKeyCancel).(context.CancelFunc); ok {
+		defer cancel()
+		reqCtx = context.WithValue(reqCtx, contextKeyCancel, nil)
+	}
+
+	// Read the messages of the client while responses are written, which
+	// HTTP/1.1 only allows once enabled
+	_ = http.NewResponseController(w).EnableFullDuplex()
+
+	writer := newServerStreamWriter(w, r, ctx, p)
+	writer.computed = s.computed
+	writer.transformers = s.options.StreamResponseTransformers
+	defer func() { recordResponseMessages(r.Context(), writer.sent()) }()
+
+	// Add handler context to the request context
+	reqCtx = context.WithValue(reqCtx, handlerContextKey, ctx)
+
+	// The stream context ends as soon as the client can no longer be written
+	// to. Client streams send a single response, so only bidirectional
+	// streams send heartbeats.
+	reqCtx, cancel := context.WithCancelCause(reqCtx)
+	defer cancel(nil)
+	var heartbeat time.Duration
+	if ctx.method.StreamType == StreamTypeBidiStream {
+		heartbeat = s.streamHeartbeat(ctx.method)
+	}
+	writer.start(reqCtx, cancel, s.streamFlowControl(ctx.method), heartbeat)
+
+	stream := &recvStream{serverStreamWriter: writer, reader: s.newStreamReader(reqCtx, r, ctx, p)}
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.writeRecvStreamError(w, r, p, writer, fmt.Errorf("panic in streaming handler: %v", rec))
+		}
+	}()
+	err := call(s.profilePhase(reqCtx, profilePhaseHandler), stream)
+	if deadlineErr := callDeadlineError(reqCtx); deadlineErr != nil {
+		err = deadlineErr
+	}
+	if err != nil {
+		s.writeRecvStreamError(w, r, p, writer, err)
+		return
+	}
+	writer.finalize()
+}
+
+// writeRecvStreamError ends a stream with err. Responses that have not
+// started yet are written as errors of their protocol, since plain HTTP
+// streams have no way to carry an error once they have.
+func (s *Service) writeRecvStreamError(w http.ResponseWriter, r *http.Request, p protocolInfo, writer *serverStreamWriter, err error) {
+	writer.mu.Lock()
+	started := writer.headersSent
+	writer.mu.Unlock()
+	if started || p.isGRPC || p.isGRPCWeb || (p.isConnect && isConnectStreamingContentType(r.Header.Get("Content-Type"))) {
+		writer.sendError(err)
+		return
+	}
+	writer.stopHeartbeat()
+	s.writeError(w, r, err)
+}
+
+// callClientStreamHandler calls the client-streaming handler
+func (s *Service) callClientStreamHandler(ctx *handlerContext, reqCtx context.Context, stream *recvStream) (any, error) {
+	if wrappedHandler, ok := ctx.method.Handler.(func(context.Context, any) (any, error)); ok {
+		return wrappedHandler(reqCtx, stream)
+	}
+	return nil, NewErrorf(CodeInternal, "invalid client stream handler %T", ctx.method.Handler)
+}
+
+// callBidiStreamHandler calls the bidirectional streaming handler
+func (s *Service) callBidiStreamHandler(ctx *handlerContext, reqCtx context.Context, stream *recvStream) error {
+	if wrappedHandler, ok := ctx.method.Handler.(func(context.Context, any) error); ok {
+		return wrappedHandler(reqCtx, stream)
+	}
+	return NewErrorf(CodeInternal, "invalid bidi stream handler %T", ctx.method.Handler)
+}
+
+// recvStream is the stream of a client-streaming or bidirectional call. It
+// receives the messages of the client and sends responses like server
+// streams do.
+type recvStream struct {
+	*serverStreamWriter
+	reader *streamReader
+}
+
+// Recv returns the next message of the client, or io.EOF once the client has
+// sent all of them.
+func (s *recvStream) Recv() (any, error) {
+	// The client may wait for the responses sent so far before sending more
+	if s.sentHeaders() {
+		s.flush()
+	}
+	input, err := s.reader.recv()
+	if err != nil {
+		return nil, err
+	}
+	return input.Interface(), nil
+}
+
+// streamReader reads the messages of the client of a stream. gRPC, gRPC-Web,
+// and Connect streams send a frame per message, while other requests carry
+// a single message in the body.
+type streamReader struct {
+	s         *Service
+	ctx       context.Context
+	r         *http.Request
+	hctx      *handlerContext
+	protocol  protocolInfo
+	enveloped bool
+
+	mu   sync.Mutex
+	done bool
+}
+
+func (s *Service) newStreamReader(ctx context.Context, r *http.Request, hctx *handlerContext, p protocolInfo) *streamReader {
+	return &streamReader{
+		s:         s,
+		ctx:       ctx,
+		r:         r,
+		hctx:      hctx,
+		protocol:  p,
+		enveloped: p.isGRPC || p.isGRPCWeb || (p.isConnect && isConnectStreamingContentType(r.Header.Get("Content-Type"))),
+	}
+}
+
+// recv decodes, fills with defaults, and validates the next message.
+func (sr *streamReader) recv() (reflect.Value, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.done {
+		return reflect.Value{}, io.EOF
+	}
+
+	body, err := sr.next()
+	if err != nil {
+		sr.done = true
+		return reflect.Value{}, err
+	}
+	input, err := sr.s.decodeInput(sr.ctx, sr.r.Header.Get("Content-Type"), body, sr.hctx)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	applyDefaults(input, sr.hctx)
+	if err := sr.s.validateInput(sr.ctx, input, sr.hctx); err != nil {
+		return reflect.Value{}, err
+	}
+	return input, nil
+}
+
+// next reads the payload of the next message, decompressing it if needed.
+func (sr *streamReader) next() ([]byte, error) {
+	method := sr.hctx.method.Name
+	if !sr.enveloped {
+		sr.done = true
+		body, err := sr.s.readStreamBody(sr.r, method)
+		if err != nil {
+			return nil, sr.readError(err)
+		}
+		if len(body) == 0 {
+			return nil, io.EOF
+		}
+		return body, nil
+	}
+
+	var header [frameHeaderLength]byte
+	if _, err := io.ReadFull(sr.r.Body, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, sr.readError(err)
+	}
+	flags := header[0]
+	length := binary.BigEndian.Uint32(header[frameLengthOffset:frameLengthSize])
+	// Read what was sent rather than allocating the announced length
+	data, err := io.ReadAll(io.LimitReader(sr.r.Body, int64(length)))
+	if err != nil {
+		return nil, sr.readError(err)
+	}
+	if uint64(len(data)) != uint64(length) {
+		return nil, NewError(CodeInvalidArgument, "failed to read message body")
+	}
+	if sr.protocol.isConnect && flags&connectFlagEndStream != 0 {
+		return nil, io.EOF
+	}
+
+	if flags&frameFlagCompressed != 0 {
+		encoding := messageEncoding(sr.r, sr.protocol)
+		if encoding == CompressionIdentity {
+			return nil, NewError(CodeInvalidArgument, "compressed message without a message encoding")
+		}
+		return sr.s.options.DecompressionLimits.decompress(method, encoding, data)
+	}
+	return data, nil
+}
+
+// readError returns the error of a failed read of the request body, which
+// is canceled when the call is.
+func (sr *streamReader) readError(err error) error {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return err
+	case sr.ctx.Err() != nil:
+		return NewError(CodeCanceled, "stream was canceled")
+	default:
+		return NewErrorf(CodeInvalidArgument, "failed to read message: %v", err)
+	}
+}
+
+// Implement typed client and bidirectional streams
+type typedClientStream[T any] struct {
+	*recvStream
+}
+
+func (s *typedClientStream[T]) Recv() (*T, error) {
+	msg, err := s.recvStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*T), nil
+}
+
+type typedBidiStream[TIn, TOut any] struct {
+	*recvStream
+}
+
+func (s *typedBidiStream[TIn, TOut]) Recv() (*TIn, error) {
+	msg, err := s.recvStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*TIn), nil
+}
+
+func (s *typedBidiStream[TIn, TOut]) Send(msg *TOut) error {
+	return s.recvStream.Send(msg)
+}
@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// LastEventIDHeader is the request header carrying the cursor to resume a
+// stream from, and the response trailer carrying the cursor of the last
+// message sent. It is the header browsers send when reconnecting to
+// server-sent events.
+const LastEventIDHeader = "Last-Event-ID"
+
+// resumeCursorContextKey stores the cursor to resume the current stream from.
+const resumeCursorContextKey contextKey = "hyperway-resume-cursor"
+
+// WithStreamResumption lets clients resume the service's server streams
+// after losing their connection. Handlers send messages with a cursor using
+// SendWithCursor, and clients reconnecting with the cursor of the last message
+// they received in the Last-Event-ID header get the handler called again,
+// which reads the cursor with ResumeCursor to continue after it. Delivery is
+// at-least-once: messages sent but not received before the connection was
+// lost are sent again.
+//
+// Cursors are the ids of server-sent events, served to plain HTTP stream
+// requests accepting text/event-stream, and the last cursor sent is
+// reported in the Last-Event-ID trailer of Connect and gRPC streams.
+func WithStreamResumption(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StreamResumption = enabled
+	}
+}
+
+// WithStreamResumption overrides the stream resumption of the service for the
+// method.
+func (m *MethodBuilder) WithStreamResumption(enabled bool) *MethodBuilder {
+	m.method.Options.StreamResumption = &enabled
+	return m
+}
+
+// streamResumption reports whether the streams of method can be resumed.
+func (s *Service) streamResumption(method *Method) bool {
+	if method.Options.StreamResumption != nil {
+		return *method.Options.StreamResumption
+	}
+	return s.options.StreamResumption
+}
+
+// ResumeCursor returns the cursor of the last message received by a client
+// resuming the current stream, or "" for a new stream.
+func ResumeCursor(ctx context.Context) string {
+	cursor, _ := ctx.Value(resumeCursorContextKey).(string)
+	return cursor
+}
+
+// applyResumeCursor returns a context carrying the cursor a client resumes
+// the stream from, if the method can be resumed.
+func (s *Service) applyResumeCursor(ctx context.Context, r *http.Request, method *Method) context.Context {
+	if !s.streamResumption(method) {
+		return ctx
+	}
+	if cursor := r.Header.Get(LastEventIDHeader); cursor != "" {
+		return context.WithValue(ctx, resumeCursorContextKey, cursor)
+	}
+	return ctx
+}
+
+// SendWithCursor sends msg on stream with the cursor resuming the stream after
+// it. Streams of methods without stream resumption, and streams not served by
+// the gateway such as test fakes, send msg without the cursor.
+func SendWithCursor[T any](stream ServerStream[T], msg *T, cursor string) error {
+	if strings.ContainsAny(cursor, "\r\n") {
+		return fmt.Errorf("invalid stream cursor %q: cursors cannot contain line breaks", cursor)
+	}
+	if s, ok := stream.(*typedServerStream[T]); ok {
+		return s.send(msg, cursor)
+	}
+	return stream.Send(msg)
+}
+
+// isEventStream reports whether a plain HTTP stream request accepts
+// server-sent events.
+func isEventStream(r *http.Request, p protocolInfo) bool {
+	return !p.isConnect && !p.isGRPC && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serverSentEvent formats a message as a server-sent event, with the cursor
+// as its id.
+func serverSentEvent(event, cursor string, data []byte) []byte {
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+	if cursor != "" {
+		buf.WriteString("id: " + cursor + "\n")
+	}
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// setCursorTrailer reports the cursor of the last message sent in the
+// Last-Event-ID trailer. Called with mu held.
+func (s *serverStreamWriter) setCursorTrailer() {
+	if s.cursor == "" {
+		return
+	}
+	if s.ctx.responseTrailers == nil {
+		s.ctx.responseTrailers = make(map[string][]string)
+	}
+	s.ctx.responseTrailers[LastEventIDHeader] = []string{s.cursor}
+}
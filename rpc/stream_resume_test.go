@@ -0,0 +1,110 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type ReplayRequest struct {
+	Fail bool `json:"fail"`
+}
+
+type ReplayEvent struct {
+	N int `json:"n"`
+}
+
+func TestStreamResumption(t *testing.T) {
+	replay := func(ctx context.Context, req *ReplayRequest, stream rpc.ServerStream[ReplayEvent]) error {
+		start := 1
+		if cursor := rpc.ResumeCursor(ctx); cursor != "" {
+			n, err := strconv.Atoi(cursor)
+			if err != nil {
+				return rpc.NewError(rpc.CodeInvalidArgument, "invalid cursor")
+			}
+			start = n + 1
+		}
+		for i := start; i <= 3; i++ {
+			if err := rpc.SendWithCursor(stream, &ReplayEvent{N: i}, strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		if req.Fail {
+			return rpc.NewError(rpc.CodeUnavailable, "feed interrupted")
+		}
+		return nil
+	}
+	svc := rpc.NewService("ReplayService", rpc.WithPackage("replay.v1"), rpc.WithStreamResumption(true))
+	rpc.MustRegisterServerStream(svc, "Replay", replay)
+	rpc.MustRegisterMethod(svc, rpc.NewServerStreamMethod("Live", replay).WithStreamResumption(false))
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	events := func(method, body, lastEventID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/replay.v1.ReplayService/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("server-sent events carry cursors", func(t *testing.T) {
+		rec := events("Replay", `{}`, "")
+		if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Expected text/event-stream, got %q", ct)
+		}
+		want := "id: 1\ndata: {\"n\":1}\n\nid: 2\ndata: {\"n\":2}\n\nid: 3\ndata: {\"n\":3}\n\n"
+		if rec.Body.String() != want {
+			t.Errorf("Expected events:\n%s\ngot:\n%s", want, rec.Body)
+		}
+	})
+
+	t.Run("reconnect resumes after the last event", func(t *testing.T) {
+		rec := events("Replay", `{"fail":true}`, "2")
+		want := "id: 3\ndata: {\"n\":3}\n\nevent: error\ndata: {\"code\":\"unavailable\",\"message\":\"feed interrupted\"}\n\n"
+		if rec.Body.String() != want {
+			t.Errorf("Expected events:\n%s\ngot:\n%s", want, rec.Body)
+		}
+	})
+
+	t.Run("method without resumption ignores cursors", func(t *testing.T) {
+		rec := events("Live", `{}`, "2")
+		if body := rec.Body.String(); !strings.HasPrefix(body, "data: {\"n\":1}\n\n") || strings.Contains(body, "id:") {
+			t.Errorf("Expected events without ids from the start, got %q", body)
+		}
+	})
+
+	t.Run("Connect stream reports the last cursor", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/replay.v1.ReplayService/Replay", bytes.NewReader(connectEnvelope([]byte(`{}`))))
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		frames := readConnectFrames(t, rec.Body)
+		if len(frames) != 4 {
+			t.Fatalf("Expected 3 messages and an end-stream frame, got %d frames", len(frames))
+		}
+		var end struct {
+			Metadata map[string][]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(frames[3].data, &end); err != nil {
+			t.Fatalf("Invalid end-stream JSON %q: %v", frames[3].data, err)
+		}
+		if got := end.Metadata[rpc.LastEventIDHeader]; len(got) != 1 || got[0] != "3" {
+			t.Errorf("Expected the last cursor in the end-stream metadata, got %v", end.Metadata)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package rpc
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"reflect"
 )
@@ -21,6 +22,22 @@ const (
 	StreamTypeBidiStream
 )
 
+// String returns the name of the stream type, e.g. "server_stream".
+func (t StreamType) String() string {
+	switch t {
+	case StreamTypeUnary:
+		return "unary"
+	case StreamTypeServerStream:
+		return "server_stream"
+	case StreamTypeClientStream:
+		return "client_stream"
+	case StreamTypeBidiStream:
+		return "bidi_stream"
+	default:
+		return fmt.Sprintf("StreamType(%d)", int(t))
+	}
+}
+
 // ServerStream represents a server-side stream.
 type ServerStream[T any] interface {
 	// Send sends a message to the client.
@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WithStrictJSON rejects JSON requests with fields the input message doesn't
+// have, instead of ignoring them, and validates all requests as with
+// WithValidation. Both fail with CodeInvalidArgument and a
+// google.rpc.BadRequest detail listing a field violation per offending path,
+// such as "items[2].nmae". Unknown fields are checked in Connect, gRPC-JSON,
+// and plain JSON requests.
+func WithStrictJSON(enabled bool) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.StrictJSON = enabled
+	}
+}
+
+// WithStrictJSON overrides the strict JSON mode of the service for the method.
+func (m *MethodBuilder) WithStrictJSON(enabled bool) *MethodBuilder {
+	m.method.Options.StrictJSON = &enabled
+	return m
+}
+
+// strictJSON reports whether method is in strict JSON mode.
+func (s *Service) strictJSON(method *Method) bool {
+	if method.Options.StrictJSON != nil {
+		return *method.Options.StrictJSON
+	}
+	return s.options.StrictJSON
+}
+
+// checkUnknownJSONFields fails with the unknown fields of a JSON request in
+// strict mode. Malformed JSON is left for the decoder to report.
+func (s *Service) checkUnknownJSONFields(body []byte, ctx *handlerContext) error {
+	if !s.strictJSON(ctx.method) {
+		return nil
+	}
+	md := inputDescriptor(ctx)
+	if md == nil {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil //nolint:nilerr // reported by the decoder
+	}
+	var violations []*errdetails.BadRequest_FieldViolation
+	collectUnknownFields(value, md, "", &violations)
+	return fieldViolationsError(violations)
+}
+
+// inputDescriptor returns the descriptor of the input message of a method.
+func inputDescriptor(ctx *handlerContext) protoreflect.MessageDescriptor {
+	if ctx.useProtoInput && ctx.method.ProtoInput != nil {
+		return ctx.method.ProtoInput.ProtoReflect().Descriptor()
+	}
+	if ctx.inputCodec != nil {
+		return ctx.inputCodec.Descriptor()
+	}
+	return nil
+}
+
+// collectUnknownFields appends a violation for each key of a JSON object that
+// names no field of md, recursing into message fields. Well-known types have
+// their own JSON mapping and are left to the decoder.
+func collectUnknownFields(value any, md protoreflect.MessageDescriptor, path string, violations *[]*errdetails.BadRequest_FieldViolation) {
+	object, ok := value.(map[string]any)
+	if !ok || strings.HasPrefix(string(md.FullName()), "google.protobuf.") {
+		return
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(key))
+		}
+		switch {
+		case fd == nil:
+			*violations = append(*violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fieldPath,
+				Description: "unknown field",
+			})
+		case fd.IsMap():
+			entries, _ := object[key].(map[string]any)
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			for _, k := range slices.Sorted(maps.Keys(entries)) {
+				collectUnknownFields(entries[k], fd.MapValue().Message(), fmt.Sprintf("%s[%q]", fieldPath, k), violations)
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			items, _ := object[key].([]any)
+			for i, item := range items {
+				collectUnknownFields(item, fd.Message(), fmt.Sprintf("%s[%d]", fieldPath, i), violations)
+			}
+		default:
+			collectUnknownFields(object[key], fd.Message(), fieldPath, violations)
+		}
+	}
+}
+
+// validationViolations converts the field errors of a validation error to
+// violations of the JSON field paths of t, with the failed tag as the reason
+// (e.g. "MIN") and the registered messages of the tag, localized for
+// acceptLanguage. It returns nil for other errors.
+func validationViolations(t reflect.Type, err error, acceptLanguage string) []*errdetails.BadRequest_FieldViolation {
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return nil
+	}
+	defaults, locale, localized := validationCatalogs(acceptLanguage)
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		field := jsonFieldPath(t, fe.StructNamespace())
+		description := expandValidationMessage(defaults[fe.Tag()], field, fe.Param())
+		if description == "" {
+			constraint := fe.Tag()
+			if fe.Param() != "" {
+				constraint += "=" + fe.Param()
+			}
+			description = fmt.Sprintf("failed the %s constraint", constraint)
+		}
+		violation := &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+			Reason:      strings.ToUpper(fe.Tag()),
+		}
+		if message := expandValidationMessage(localized[fe.Tag()], field, fe.Param()); message != "" {
+			violation.LocalizedMessage = &errdetails.LocalizedMessage{Locale: locale, Message: message}
+		}
+		violations = append(violations, violation)
+	}
+	return violations
+}
+
+// jsonFieldPath converts the Go namespace of a validation error in t, such as
+// "Order.Items[0].Name", to the JSON names of the fields, "items[0].name".
+func jsonFieldPath(t reflect.Type, namespace string) string {
+	segments := strings.Split(namespace, ".")[1:] // Without the type name
+	for i, segment := range segments {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			break
+		}
+		name, index, indexed := strings.Cut(segment, "[")
+		field, ok := t.FieldByName(name)
+		if !ok {
+			break
+		}
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" && tag != "-" {
+			name = tag
+		}
+		if indexed {
+			name += "[" + index
+		}
+		segments[i] = name
+		t = field.Type
+	}
+	return strings.Join(segments, ".")
+}
+
+// fieldViolationsError returns an InvalidArgument error listing violations
+// in its message and in a google.rpc.BadRequest detail, or nil without any.
+func fieldViolationsError(violations []*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(violations))
+	for i, v := range violations {
+		descriptions[i] = v.GetField() + ": " + v.GetDescription()
+	}
+	return NewErrorWithDetails(CodeInvalidArgument, "invalid request: "+strings.Join(descriptions, "; ")).
+		AddAnyDetail(&errdetails.BadRequest{FieldViolations: violations})
+}
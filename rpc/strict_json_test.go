@@ -0,0 +1,199 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type OrderItem struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int32  `json:"quantity" validate:"min=1"`
+}
+
+type PlaceOrderRequest struct {
+	Customer string      `json:"customer" validate:"required"`
+	Items    []OrderItem `json:"items" validate:"dive"`
+}
+
+type PlaceOrderResponse struct {
+	Accepted bool `json:"accepted"`
+}
+
+func placeOrder(_ context.Context, _ *PlaceOrderRequest) (*PlaceOrderResponse, error) {
+	return &PlaceOrderResponse{Accepted: true}, nil
+}
+
+// fieldViolations returns the field violations of a Connect error response.
+func fieldViolations(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	var connectErr struct {
+		Code    string `json:"code"`
+		Details []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &connectErr); err != nil || connectErr.Code != "invalid_argument" || len(connectErr.Details) != 1 {
+		t.Fatalf("Expected an invalid_argument error with one detail, got %s", body)
+	}
+	if connectErr.Details[0].Type != "google.rpc.BadRequest" {
+		t.Fatalf("detail type = %s", connectErr.Details[0].Type)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(connectErr.Details[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var badRequest errdetails.BadRequest
+	if err := proto.Unmarshal(data, &badRequest); err != nil {
+		t.Fatal(err)
+	}
+	violations := make(map[string]string)
+	for _, v := range badRequest.GetFieldViolations() {
+		violations[v.GetField()] = v.GetDescription()
+	}
+	return violations
+}
+
+func TestStrictJSON(t *testing.T) {
+	newGateway := func(t *testing.T, strict bool, builder func(*rpc.MethodBuilder) *rpc.MethodBuilder) http.Handler {
+		t.Helper()
+		svc := rpc.NewService("OrderService", rpc.WithPackage("order.v1"), rpc.WithStrictJSON(strict))
+		rpc.MustRegisterMethod(svc, builder(rpc.NewMethod("Place", placeOrder)))
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return gw
+	}
+	same := func(m *rpc.MethodBuilder) *rpc.MethodBuilder { return m }
+	call := func(gw http.Handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/order.v1.OrderService/Place", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		rec := call(newGateway(t, true, same),
+			`{"customer":"gopher","coupon":"X","items":[{"sku":"a","quantity":1},{"sku":"b","quantity":1,"qty":2}]}`)
+		got := fieldViolations(t, rec.Body.Bytes())
+		want := map[string]string{"coupon": "unknown field", "items[1].qty": "unknown field"}
+		if len(got) != len(want) || got["coupon"] != want["coupon"] || got["items[1].qty"] != want["items[1].qty"] {
+			t.Errorf("violations = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("reports each failed constraint", func(t *testing.T) {
+		rec := call(newGateway(t, true, same), `{"items":[{"sku":"a","quantity":1},{"quantity":0}]}`)
+		got := fieldViolations(t, rec.Body.Bytes())
+		for field, description := range map[string]string{
+			"customer":          "failed the required constraint",
+			"items[1].sku":      "failed the required constraint",
+			"items[1].quantity": "failed the min=1 constraint",
+		} {
+			if got[field] != description {
+				t.Errorf("violation of %s = %q, want %q", field, got[field], description)
+			}
+		}
+	})
+
+	t.Run("accepts valid requests", func(t *testing.T) {
+		rec := call(newGateway(t, true, same), `{"customer":"gopher","items":[{"sku":"a","quantity":2}]}`)
+		if !strings.Contains(rec.Body.String(), `"accepted":true`) {
+			t.Errorf("Expected success, got %s", rec.Body)
+		}
+	})
+
+	t.Run("gRPC-JSON", func(t *testing.T) {
+		body := `{"customer":"gopher","coupon":"X"}`
+		frame := append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+		req := httptest.NewRequest(http.MethodPost, "/order.v1.OrderService/Place", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		newGateway(t, true, same).ServeHTTP(rec, req)
+		if rec.Header().Get("Grpc-Status") != "3" || !strings.Contains(rec.Header().Get("Grpc-Message"), "coupon") {
+			t.Errorf("Expected INVALID_ARGUMENT naming the field, got %v", rec.Header())
+		}
+	})
+
+	t.Run("method overrides service", func(t *testing.T) {
+		lenient := newGateway(t, true, func(m *rpc.MethodBuilder) *rpc.MethodBuilder { return m.WithStrictJSON(false) })
+		if rec := call(lenient, `{"customer":"gopher","coupon":"X"}`); !strings.Contains(rec.Body.String(), `"accepted":true`) {
+			t.Errorf("Expected unknown fields to be ignored, got %s", rec.Body)
+		}
+		strict := newGateway(t, false, func(m *rpc.MethodBuilder) *rpc.MethodBuilder { return m.WithStrictJSON(true) })
+		if rec := call(strict, `{"customer":"gopher","coupon":"X"}`); !strings.Contains(rec.Body.String(), "invalid_argument") {
+			t.Errorf("Expected unknown fields to be rejected, got %s", rec.Body)
+		}
+	})
+}
+
+func TestValidationViolationDetails(t *testing.T) {
+	svc := rpc.NewService("OrderService", rpc.WithPackage("order.v1"), rpc.WithValidation(true))
+	rpc.MustRegister(svc, "Place", placeOrder)
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	body := `{"customer":"gopher","items":[{"sku":"a","quantity":0}]}`
+
+	t.Run("Connect", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/order.v1.OrderService/Place", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		got := fieldViolations(t, rec.Body.Bytes())
+		if len(got) != 1 || got["items[0].quantity"] != "failed the min=1 constraint" {
+			t.Errorf("violations = %v", got)
+		}
+		// JSON clients can read the violations from the debug form
+		want := `"debug":{"fieldViolations":[{"field":"items[0].quantity","description":"failed the min=1 constraint","reason":"MIN"}]}`
+		if compact := strings.ReplaceAll(rec.Body.String(), " ", ""); !strings.Contains(compact, strings.ReplaceAll(want, " ", "")) {
+			t.Errorf("Expected the debug form of the detail, got %s", rec.Body)
+		}
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		frame := append([]byte{0, 0, 0, 0, byte(len(body))}, body...)
+		req := httptest.NewRequest(http.MethodPost, "/order.v1.OrderService/Place", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc+json")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Grpc-Status") != "3" {
+			t.Fatalf("Expected INVALID_ARGUMENT, got %v", rec.Header())
+		}
+		data, err := base64.RawStdEncoding.DecodeString(rec.Header().Get("Grpc-Status-Details-Bin"))
+		if err != nil {
+			t.Fatalf("Failed to decode grpc-status-details-bin: %v", err)
+		}
+		var st status.Status
+		if err := proto.Unmarshal(data, &st); err != nil || st.GetCode() != 3 || len(st.GetDetails()) != 1 {
+			t.Fatalf("Unexpected status %v: %v", &st, err)
+		}
+		var badRequest errdetails.BadRequest
+		if err := st.GetDetails()[0].UnmarshalTo(&badRequest); err != nil {
+			t.Fatalf("Failed to unpack BadRequest: %v", err)
+		}
+		v := badRequest.GetFieldViolations()
+		if len(v) != 1 || v[0].GetField() != "items[0].quantity" || v[0].GetReason() != "MIN" {
+			t.Errorf("Unexpected violations: %v", v)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// connectTrailerPrefix is prepended to trailer keys in Connect unary responses.
+const connectTrailerPrefix = "Trailer-"
+
+// TrailerMerge controls how a Connect unary trailer interacts with a response
+// header of the same name.
+type TrailerMerge int
+
+const (
+	// TrailerMergeKeepBoth sends the header and the "Trailer-" prefixed trailer.
+	TrailerMergeKeepBoth TrailerMerge = iota
+	// TrailerMergePreferHeader drops trailers whose key was also set as a response header.
+	TrailerMergePreferHeader
+	// TrailerMergePreferTrailer drops response headers whose key was also set as a trailer.
+	TrailerMergePreferTrailer
+	// TrailerMergeAsHeaders sends trailers as plain response headers without the
+	// "Trailer-" prefix. This is not Connect compliant and exists for clients and
+	// proxies that only read headers.
+	TrailerMergeAsHeaders
+)
+
+// ConnectTrailerOptions controls how response trailers reach Connect unary
+// clients, which receive them as "Trailer-" prefixed headers on both successful
+// and error responses.
+type ConnectTrailerOptions struct {
+	// Allow limits propagation to these trailer keys (case-insensitive).
+	// Empty allows all trailers.
+	Allow []string
+	// Deny drops these trailer keys (case-insensitive). Deny takes precedence over Allow.
+	Deny []string
+	// Merge controls trailers whose key was also set as a response header.
+	Merge TrailerMerge
+}
+
+// WithConnectTrailers configures trailer propagation for Connect unary responses.
+// gRPC and gRPC-Web responses always carry trailers as HTTP trailers.
+func WithConnectTrailers(opts ConnectTrailerOptions) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ConnectTrailers = opts
+	}
+}
+
+// allows reports whether the trailer key may be propagated.
+func (o *ConnectTrailerOptions) allows(key string) bool {
+	// Keys with the Connect- prefix are reserved for the protocol
+	if len(key) >= len("Connect-") && strings.EqualFold(key[:len("Connect-")], "Connect-") {
+		return false
+	}
+	for _, denied := range o.Deny {
+		if strings.EqualFold(denied, key) {
+			return false
+		}
+	}
+	if len(o.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range o.Allow {
+		if strings.EqualFold(allowed, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConnectUnaryMetadata copies handler-set response headers and trailers
+// into h for a Connect unary response.
+func (s *Service) applyConnectUnaryMetadata(h http.Header, hctx *handlerContext) {
+	opts := &s.options.ConnectTrailers
+
+	// Collect trailers that survive filtering, keyed by canonical name
+	trailers := make(http.Header, len(hctx.responseTrailers))
+	for key, values := range hctx.responseTrailers {
+		if !opts.allows(key) {
+			continue
+		}
+		for _, value := range values {
+			trailers.Add(key, value)
+		}
+	}
+
+	headers := make(http.Header, len(hctx.responseHeaders))
+	for key, values := range hctx.responseHeaders {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+
+	for key, values := range headers {
+		if _, ok := trailers[key]; ok && opts.Merge == TrailerMergePreferTrailer {
+			continue
+		}
+		for _, value := range values {
+			h.Add(key, value)
+		}
+	}
+
+	for key, values := range trailers {
+		if _, ok := headers[key]; ok && opts.Merge == TrailerMergePreferHeader {
+			continue
+		}
+		name := connectTrailerPrefix + key
+		if opts.Merge == TrailerMergeAsHeaders {
+			name = key
+		}
+		for _, value := range values {
+			h.Add(name, value)
+		}
+	}
+}
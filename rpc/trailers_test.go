@@ -0,0 +1,128 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+func TestConnectUnaryTrailers(t *testing.T) {
+	newClient := func(t *testing.T, opts rpc.ConnectTrailerOptions) *connect.Client[wrapperspb.StringValue, wrapperspb.StringValue] {
+		t.Helper()
+		svc := rpc.NewService("TrailerService",
+			rpc.WithPackage("trailer.v1"),
+			rpc.WithConnectTrailers(opts),
+		)
+		rpc.MustRegister(svc, "Echo", func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+			hctx := rpc.GetHandlerContext(ctx)
+			hctx.SetResponseHeader("X-Shared", "header")
+			hctx.SetResponseTrailer("X-Shared", "trailer")
+			hctx.SetResponseTrailer("X-Request-Cost", "3")
+			hctx.SetResponseTrailer("X-Internal", "secret")
+			return wrapperspb.String(req.GetValue()), nil
+		})
+
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		server := httptest.NewServer(gw)
+		t.Cleanup(server.Close)
+		return connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+			http.DefaultClient, server.URL+"/trailer.v1.TrailerService/Echo")
+	}
+
+	call := func(t *testing.T, client *connect.Client[wrapperspb.StringValue, wrapperspb.StringValue]) (header, trailer http.Header) {
+		t.Helper()
+		resp, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("hi")))
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if resp.Msg.GetValue() != "hi" {
+			t.Errorf("Unexpected response: %v", resp.Msg)
+		}
+		return resp.Header(), resp.Trailer()
+	}
+
+	t.Run("default propagates all trailers", func(t *testing.T) {
+		header, trailer := call(t, newClient(t, rpc.ConnectTrailerOptions{}))
+		if got := trailer.Get("X-Request-Cost"); got != "3" {
+			t.Errorf("Expected trailer X-Request-Cost=3, got %q", got)
+		}
+		if got := trailer.Get("X-Shared"); got != "trailer" {
+			t.Errorf("Expected trailer X-Shared=trailer, got %q", got)
+		}
+		if got := header.Get("X-Shared"); got != "header" {
+			t.Errorf("Expected header X-Shared=header, got %q", got)
+		}
+	})
+
+	t.Run("allow and deny", func(t *testing.T) {
+		_, trailer := call(t, newClient(t, rpc.ConnectTrailerOptions{
+			Allow: []string{"x-request-cost", "x-internal"},
+			Deny:  []string{"X-Internal"},
+		}))
+		if trailer.Get("X-Request-Cost") != "3" {
+			t.Error("Expected allowed trailer to be propagated")
+		}
+		if trailer.Get("X-Internal") != "" || trailer.Get("X-Shared") != "" {
+			t.Errorf("Expected only allowed trailers, got %v", trailer)
+		}
+	})
+
+	t.Run("prefer header", func(t *testing.T) {
+		header, trailer := call(t, newClient(t, rpc.ConnectTrailerOptions{Merge: rpc.TrailerMergePreferHeader}))
+		if trailer.Get("X-Shared") != "" || header.Get("X-Shared") != "header" {
+			t.Errorf("Expected header to win, got header %q trailer %q", header.Get("X-Shared"), trailer.Get("X-Shared"))
+		}
+	})
+
+	t.Run("prefer trailer", func(t *testing.T) {
+		header, trailer := call(t, newClient(t, rpc.ConnectTrailerOptions{Merge: rpc.TrailerMergePreferTrailer}))
+		if header.Get("X-Shared") != "" || trailer.Get("X-Shared") != "trailer" {
+			t.Errorf("Expected trailer to win, got header %q trailer %q", header.Get("X-Shared"), trailer.Get("X-Shared"))
+		}
+	})
+
+	t.Run("as headers", func(t *testing.T) {
+		header, trailer := call(t, newClient(t, rpc.ConnectTrailerOptions{Merge: rpc.TrailerMergeAsHeaders}))
+		if len(trailer) != 0 {
+			t.Errorf("Expected no trailers, got %v", trailer)
+		}
+		if got := header.Values("X-Shared"); len(got) != 2 {
+			t.Errorf("Expected header and trailer values in headers, got %v", got)
+		}
+	})
+
+	t.Run("error responses carry trailers", func(t *testing.T) {
+		svc := rpc.NewService("TrailerService", rpc.WithPackage("trailer.v1"))
+		rpc.MustRegister(svc, "Fail", func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+			rpc.GetHandlerContext(ctx).SetResponseTrailer("X-Request-Cost", "3")
+			return nil, rpc.NewError(rpc.CodeUnavailable, "try again")
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/trailer.v1.TrailerService/Fail", strings.NewReader(`"hi"`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Body.String(), "unavailable") {
+			t.Errorf("Expected unavailable error, got %s", rec.Body.String())
+		}
+		if got := rec.Header().Get("Trailer-X-Request-Cost"); got != "3" {
+			t.Errorf("Expected Trailer-X-Request-Cost on error response, got %v", rec.Header())
+		}
+	})
+}
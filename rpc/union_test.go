@@ -0,0 +1,194 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/i2y/hyperway/codec"
+	"github.com/i2y/hyperway/rpc"
+	"github.com/i2y/hyperway/schema"
+)
+
+type Figure interface {
+	Area() float64
+}
+
+type Circle struct {
+	Radius float64 `json:"radius"`
+}
+
+func (c Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type RoundedRect struct {
+	Width  float64       `json:"width"`
+	Height float64       `json:"height"`
+	Fade   time.Duration `json:"fade"`
+}
+
+func (r *RoundedRect) Area() float64 { return r.Width * r.Height }
+
+type DrawingLayer struct {
+	Fill Figure `json:"fill"`
+}
+
+type Drawing struct {
+	Name   string         `json:"name"`
+	Figure Figure         `json:"figure"`
+	Layers []DrawingLayer `json:"layers"`
+}
+
+func init() {
+	schema.MustRegisterUnion[Figure](Circle{}, &RoundedRect{})
+}
+
+func newDrawing() *Drawing {
+	return &Drawing{
+		Name:   "d",
+		Figure: Circle{Radius: 2},
+		Layers: []DrawingLayer{{Fill: &RoundedRect{Width: 1, Height: 2, Fade: 1500 * time.Millisecond}}, {}},
+	}
+}
+
+func TestUnionFields(t *testing.T) {
+	var received *Drawing
+	newGateway := func(opts ...rpc.ServiceOption) (*rpc.Service, http.Handler) {
+		svc := rpc.NewService("DrawingService", append([]rpc.ServiceOption{rpc.WithPackage("drawing.v1")}, opts...)...)
+		rpc.MustRegister(svc, "Echo", func(_ context.Context, req *Drawing) (*Drawing, error) {
+			received = req
+			return req, nil
+		})
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatalf("Failed to create gateway: %v", err)
+		}
+		return svc, gw
+	}
+	call := func(gw http.Handler, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/drawing.v1.DrawingService/Echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	svc, gw := newGateway()
+
+	var md protoreflect.MessageDescriptor
+	for _, file := range svc.GetFileDescriptorSet().GetFile() {
+		if file.GetPackage() == "drawing.v1" {
+			fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+			if err != nil {
+				t.Fatalf("Failed to build descriptors: %v", err)
+			}
+			md = fd.Messages().ByName("Drawing")
+		}
+	}
+	if md == nil {
+		t.Fatal("Expected a Drawing message")
+	}
+
+	t.Run("descriptors", func(t *testing.T) {
+		oneof := md.Oneofs().ByName("figure")
+		if oneof == nil || oneof.Fields().Len() != 2 {
+			t.Fatalf("Expected a figure oneof of two fields, got %v", oneof)
+		}
+		for i, want := range []string{"drawing.v1.Circle", "drawing.v1.RoundedRect"} {
+			if got := string(oneof.Fields().Get(i).Message().FullName()); got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		}
+		if fd := md.Fields().ByName("rounded_rect"); fd == nil || fd.ContainingOneof() != oneof {
+			t.Errorf("Expected rounded_rect in the figure oneof, got %v", fd)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		const request = `{"name":"d","circle":{"radius":2},` +
+			`"layers":[{"rounded_rect":{"width":1,"height":2,"fade":"1.5s"}},{}]}`
+		rec := call(gw, "application/json", request)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if want := newDrawing(); !reflect.DeepEqual(received, want) {
+			t.Errorf("Expected %+v, got %+v", want, received)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{`"circle":{"radius":2}`, `"rounded_rect":{"width":1,"height":2,"fade":"1.500s"}`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected %s in %s", want, body)
+			}
+		}
+		if strings.Contains(body, `"figure"`) || strings.Contains(body, `"fill"`) {
+			t.Errorf("Expected the union fields to be encoded as their members, got %s", body)
+		}
+
+		// The response decodes to the same values
+		if rec := call(gw, "application/json", body); rec.Code != http.StatusOK || !reflect.DeepEqual(received, newDrawing()) {
+			t.Errorf("Expected the response to round trip, got %d: %+v", rec.Code, received)
+		}
+	})
+
+	t.Run("proto3 JSON mapping", func(t *testing.T) {
+		_, gw := newGateway(rpc.WithProtoJSON())
+		rec := call(gw, "application/json", `{"name":"d","circle":{"radius":2},"layers":[{"roundedRect":{"width":1,"height":2,"fade":"1.5s"}},{}]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if want := newDrawing(); !reflect.DeepEqual(received, want) {
+			t.Errorf("Expected %+v, got %+v", want, received)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, `"circle":{"radius":2}`) {
+			t.Errorf("Expected the circle member, got %s", body)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		data, err := codec.NewStructEncoder(md).EncodeStruct(newDrawing())
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		rec := call(gw, "application/proto", string(data))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if want := newDrawing(); !reflect.DeepEqual(received, want) {
+			t.Errorf("Expected %+v, got %+v", want, received)
+		}
+		resp := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if fd := resp.WhichOneof(md.Oneofs().ByName("figure")); fd == nil || fd.Name() != "circle" {
+			t.Errorf("Expected the circle member to be set, got %v", fd)
+		}
+	})
+
+	t.Run("several members are rejected", func(t *testing.T) {
+		rec := call(gw, "application/json", `{"circle":{"radius":2},"rounded_rect":{}}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("interfaces must be registered", func(t *testing.T) {
+		type Unregistered interface{ Unregistered() }
+		type Holder struct {
+			Value Unregistered `json:"value"`
+		}
+		svc := rpc.NewService("HolderService", rpc.WithPackage("holder.v1"))
+		err := rpc.Register(svc, "Get", func(_ context.Context, _ *Holder) (*Drawing, error) { return nil, nil })
+		if err == nil || !strings.Contains(err.Error(), "schema.RegisterUnion") {
+			t.Errorf("Expected an error suggesting schema.RegisterUnion, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/internal/grpcutil"
+	reflectutil "github.com/i2y/hyperway/internal/reflect"
+)
+
+// maxUpstreamMessageSize bounds the size of upstream responses.
+const maxUpstreamMessageSize = 64 << 20
+
+// upstreamSkippedHeaders are request and response headers that belong to a
+// single hop or protocol and are not forwarded.
+var upstreamSkippedHeaders = map[string]bool{
+	"Accept":                   true,
+	"Accept-Encoding":          true,
+	"Connection":               true,
+	"Content-Encoding":         true,
+	"Content-Length":           true,
+	"Content-Type":             true,
+	"Host":                     true,
+	"Keep-Alive":               true,
+	"Proxy-Connection":         true,
+	"Te":                       true,
+	"Trailer":                  true,
+	"Transfer-Encoding":        true,
+	"Upgrade":                  true,
+	"X-Grpc-Web":               true,
+	"X-User-Agent":             true,
+	connectTimeoutHeader:       true,
+	"Connect-Protocol-Version": true,
+}
+
+// Upstream is an external gRPC server that methods forward their calls to,
+// so a service can translate Connect, gRPC-Web, and JSON requests for a
+// backend that only speaks gRPC.
+type Upstream struct {
+	target    *url.URL
+	transport http.RoundTripper
+}
+
+// UpstreamOption configures an Upstream.
+type UpstreamOption func(*Upstream)
+
+// WithUpstreamTransport sends upstream calls with transport, which must
+// speak HTTP/2 to the target, e.g. to configure TLS. Calls still get a
+// grpc-timeout from their deadline.
+func WithUpstreamTransport(transport http.RoundTripper) UpstreamOption {
+	return func(u *Upstream) {
+		u.transport = transport
+	}
+}
+
+// NewUpstream returns the gRPC server at target, an "http" URL for
+// cleartext HTTP/2 (h2c) or an "https" URL for HTTP/2 over TLS.
+func NewUpstream(target string, opts ...UpstreamOption) (*Upstream, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q: want an http or https URL", target)
+	}
+
+	upstream := &Upstream{target: u}
+	for _, opt := range opts {
+		opt(upstream)
+	}
+	if upstream.transport == nil {
+		transport := &http2.Transport{}
+		if u.Scheme == "http" {
+			transport.AllowHTTP = true
+			transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		upstream.transport = transport
+	}
+	upstream.transport = NewDeadlineTransport(upstream.transport)
+	return upstream, nil
+}
+
+// ProxyTo returns a handler forwarding calls to the method of the same
+// service and name on upstream over gRPC. Requests arrive in any protocol
+// the service speaks and are re-encoded in the binary format, so TIn and
+// TOut must describe the same messages as the upstream method, e.g. its
+// generated types:
+//
+//	orders, _ := rpc.NewUpstream("http://orders:9090")
+//	rpc.MustRegister(svc, "CreateOrder", rpc.ProxyTo[ordersv1.CreateOrderRequest, ordersv1.CreateOrderResponse](orders))
+//
+// Request headers other than protocol and hop-by-hop ones are forwarded
+// as metadata, the deadline as grpc-timeout, and the response headers,
+// trailers, and status are passed back. Interceptors, authentication, and
+// validation of the service apply before the call is forwarded.
+func ProxyTo[TIn, TOut any](upstream *Upstream) Handler[TIn, TOut] {
+	return func(ctx context.Context, req *TIn) (*TOut, error) {
+		hctx := GetHandlerContext(ctx)
+		if hctx == nil {
+			return nil, NewError(CodeInternal, "proxy called outside of a service")
+		}
+		data, err := marshalUpstreamRequest(req, hctx)
+		if err != nil {
+			return nil, NewErrorf(CodeInternal, "failed to encode upstream request: %v", err)
+		}
+		data, err = upstream.call(ctx, hctx, data)
+		if err != nil {
+			return nil, err
+		}
+		resp := new(TOut)
+		if err := unmarshalUpstreamResponse(data, resp, hctx); err != nil {
+			return nil, NewErrorf(CodeInternal, "failed to decode upstream response: %v", err)
+		}
+		return resp, nil
+	}
+}
+
+// marshalUpstreamRequest encodes a request message in the binary format.
+func marshalUpstreamRequest(req any, hctx *handlerContext) ([]byte, error) {
+	if msg, ok := req.(proto.Message); ok {
+		return proto.Marshal(msg)
+	}
+	if hctx.inputCodec == nil {
+		return nil, errors.New("input codec not initialized")
+	}
+	return hctx.inputCodec.MarshalStruct(req)
+}
+
+// unmarshalUpstreamResponse decodes a response message in the binary format.
+func unmarshalUpstreamResponse(data []byte, resp any, hctx *handlerContext) error {
+	if msg, ok := resp.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+	if hctx.outputCodec == nil {
+		return errors.New("output codec not initialized")
+	}
+	msg, err := hctx.outputCodec.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	defer hctx.outputCodec.ReleaseMessage(msg)
+	return reflectutil.ProtoToStruct(msg.ProtoReflect(), resp)
+}
+
+// call sends a unary gRPC request with the message data and returns the
+// response message.
+func (u *Upstream) call(ctx context.Context, hctx *handlerContext, data []byte) ([]byte, error) {
+	frame := make([]byte, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(data))) //nolint:gosec // bounded by the request size limit
+	copy(frame[frameHeaderSize:], data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.target.JoinPath(hctx.procedure).String(), bytes.NewReader(frame))
+	if err != nil {
+		return nil, NewErrorf(CodeInternal, "failed to create upstream request: %v", err)
+	}
+	for key, values := range hctx.requestHeaders {
+		if !upstreamSkippedHeaders[textproto.CanonicalMIMEHeaderKey(key)] && !isGRPCHeader(key) {
+			req.Header[key] = values
+		}
+	}
+	req.Header.Set("Content-Type", contentTypeGRPCProto)
+	req.Header.Set("Te", "trailers")
+
+	resp, err := u.transport.RoundTrip(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, NewError(CodeDeadlineExceeded, "upstream deadline exceeded")
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, NewError(CodeCanceled, "upstream call canceled")
+		}
+		return nil, NewErrorf(CodeUnavailable, "upstream unavailable: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewErrorf(codeForHTTPStatus(resp.StatusCode), "upstream responded with HTTP %d", resp.StatusCode)
+	}
+	forwardUpstreamMetadata(resp.Header, hctx.SetResponseHeader)
+
+	// A trailers-only response carries the status in the headers
+	if resp.Header.Get("Grpc-Status") != "" {
+		return nil, upstreamStatus(resp.Header)
+	}
+	message, readErr := readUpstreamMessage(resp.Body)
+	_, _ = io.Copy(io.Discard, resp.Body) // Trailers follow the body
+	forwardUpstreamMetadata(resp.Trailer, hctx.SetResponseTrailer)
+	if err := upstreamStatus(resp.Trailer); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return message, nil
+}
+
+// readUpstreamMessage reads the single message of a unary gRPC response.
+func readUpstreamMessage(body io.Reader) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(body, header); err != nil {
+		return nil, NewErrorf(CodeInternal, "upstream response without a message: %v", err)
+	}
+	if header[0]&1 != 0 {
+		return nil, NewError(CodeInternal, "upstream response is compressed")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxUpstreamMessageSize {
+		return nil, NewErrorf(CodeResourceExhausted, "upstream response of %d bytes exceeds the limit", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, NewErrorf(CodeInternal, "truncated upstream response: %v", err)
+	}
+	return message, nil
+}
+
+// upstreamStatus returns the error of the gRPC status in h, or nil if it is
+// OK. A missing status is an internal error.
+func upstreamStatus(h http.Header) error {
+	value := h.Get("Grpc-Status")
+	if value == "" {
+		return NewError(CodeInternal, "upstream response without grpc-status")
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return NewErrorf(CodeInternal, "invalid upstream grpc-status %q", value)
+	}
+	if status == 0 {
+		return nil
+	}
+	return NewError(codeForGRPCStatus(status), grpcutil.DecodeMessage(h.Get("Grpc-Message")))
+}
+
+// forwardUpstreamMetadata passes the custom metadata of an upstream response
+// to set.
+func forwardUpstreamMetadata(h http.Header, set func(key, value string)) {
+	for key, values := range h {
+		if upstreamSkippedHeaders[key] || isGRPCHeader(key) || key == "Date" {
+			continue
+		}
+		for _, value := range values {
+			set(key, value)
+		}
+	}
+}
+
+// isGRPCHeader reports whether key is reserved by the gRPC protocol.
+func isGRPCHeader(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), "grpc-")
+}
+
+// codeForHTTPStatus maps the HTTP status of a failed gRPC response to an
+// error code as gRPC clients do.
+func codeForHTTPStatus(status int) Code {
+	return Code(grpcutil.CodeForHTTPStatus(status))
+}
@@ -0,0 +1,133 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type InventoryRequest struct {
+	SKU      string `json:"sku"`
+	Quantity int64  `json:"quantity"`
+}
+
+type InventoryResponse struct {
+	SKU       string   `json:"sku"`
+	Available int64    `json:"available"`
+	Locations []string `json:"locations"`
+}
+
+func TestProxyTo(t *testing.T) {
+	// A gRPC backend, served by another service here
+	backend := rpc.NewService("InventoryService", rpc.WithPackage("inventory.v1"))
+	rpc.MustRegister(backend, "Reserve", func(ctx context.Context, req *InventoryRequest) (*InventoryResponse, error) {
+		hctx := rpc.GetHandlerContext(ctx)
+		if req.SKU == "" {
+			return nil, rpc.NewError(rpc.CodeInvalidArgument, "sku is required")
+		}
+		if _, ok := rpc.Deadline(ctx); !ok {
+			return nil, rpc.NewError(rpc.CodeFailedPrecondition, "expected a deadline")
+		}
+		hctx.SetResponseHeader("X-Warehouse", "kyoto")
+		hctx.SetResponseTrailer("X-Reserved-By", strings.Join(hctx.GetRequestHeader("X-Client"), ","))
+		return &InventoryResponse{SKU: req.SKU, Available: 100 - req.Quantity, Locations: []string{"A1", "B2"}}, nil
+	})
+	backendGateway, err := rpc.NewGateway(backend)
+	if err != nil {
+		t.Fatalf("Failed to create backend gateway: %v", err)
+	}
+	server := httptest.NewServer(h2c.NewHandler(backendGateway, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	upstream, err := rpc.NewUpstream(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	front := rpc.NewService("InventoryService", rpc.WithPackage("inventory.v1"))
+	rpc.MustRegister(front, "Reserve", rpc.ProxyTo[InventoryRequest, InventoryResponse](upstream))
+	gw, err := rpc.NewGateway(front)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/inventory.v1.InventoryService/Reserve", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Connect-Protocol-Version", "1")
+		req.Header.Set("Connect-Timeout-Ms", "5000")
+		req.Header.Set("X-Client", "checkout")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Connect JSON", func(t *testing.T) {
+		rec := call("application/json", []byte(`{"sku":"gopher","quantity":3}`))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), `"available":97`) || !strings.Contains(rec.Body.String(), `"locations":["A1","B2"]`) {
+			t.Errorf("body = %s", rec.Body)
+		}
+		if got := rec.Header().Get("X-Warehouse"); got != "kyoto" {
+			t.Errorf("X-Warehouse = %q, want the upstream header", got)
+		}
+		if got := rec.Header().Get("Trailer-X-Reserved-By"); got != "checkout" {
+			t.Errorf("Trailer-X-Reserved-By = %q, want the forwarded request header", got)
+		}
+	})
+
+	t.Run("gRPC-Web", func(t *testing.T) {
+		rec := call("application/grpc-web+json", append([]byte{0, 0, 0, 0, 14}, `{"sku":"tiny"}`...))
+		if !strings.Contains(rec.Body.String(), `"available":100`) {
+			t.Errorf("body = %q", rec.Body)
+		}
+	})
+
+	t.Run("upstream error", func(t *testing.T) {
+		rec := call("application/json", []byte(`{}`))
+		if !strings.Contains(rec.Body.String(), `"code":"invalid_argument"`) || !strings.Contains(rec.Body.String(), "sku is required") {
+			t.Errorf("Expected the upstream status, got %d %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("unavailable upstream", func(t *testing.T) {
+		down, err := rpc.NewUpstream("http://127.0.0.1:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := rpc.NewService("InventoryService", rpc.WithPackage("inventory.v1"))
+		rpc.MustRegister(svc, "Reserve", rpc.ProxyTo[InventoryRequest, InventoryResponse](down))
+		gw, err := rpc.NewGateway(svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/inventory.v1.InventoryService/Reserve", strings.NewReader(`{"sku":"a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), `"code":"unavailable"`) {
+			t.Errorf("Expected unavailable, got %d %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestNewUpstreamRejectsInvalidTargets(t *testing.T) {
+	for _, target := range []string{"orders:9090", "grpc://orders:9090", "http://"} {
+		if _, err := rpc.NewUpstream(target); err == nil {
+			t.Errorf("NewUpstream(%q) succeeded", target)
+		}
+	}
+}
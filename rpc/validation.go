@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+// RegisterValidation registers a validation function for a validate tag, such
+// as `validate:"sku"`, shared by all services. Like the other registration
+// functions, it must be called before services handle requests.
+//
+//	rpc.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+//		return skuPattern.MatchString(fl.Field().String())
+//	})
+func RegisterValidation(tag string, fn validator.Func) error {
+	return globalValidator.RegisterValidation(tag, fn)
+}
+
+// RegisterStructValidation registers a struct-level validation of types, for
+// rules spanning several fields. fn reports violations with
+// sl.ReportError(value, goFieldName, goFieldName, tag, param), which are
+// reported with the JSON path of the field like other failed constraints.
+//
+//	rpc.RegisterStructValidation(func(sl validator.StructLevel) {
+//		r := sl.Current().Interface().(ListEventsRequest)
+//		if r.Start.After(r.End) {
+//			sl.ReportError(r.Start, "Start", "Start", "start_before_end", "")
+//		}
+//	}, ListEventsRequest{})
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...any) {
+	globalValidator.RegisterStructValidation(fn, types...)
+}
+
+// RegisterValidationMessages registers the messages of failed validate tags
+// for a locale, such as "ja" or "pt-BR". In messages, "{field}" is replaced
+// with the JSON path of the field and "{param}" with the tag parameter, e.g.
+// "must be at least {param}" for min=1.
+//
+// Messages of the empty locale replace the default descriptions of field
+// violations, "failed the min=1 constraint". Messages of other locales are
+// added as the localized messages of field violations, for requests whose
+// Accept-Language header matches the locale.
+func RegisterValidationMessages(locale string, messages map[string]string) error {
+	tag := language.Und
+	if locale != "" {
+		var err error
+		if tag, err = language.Parse(locale); err != nil {
+			return err
+		}
+	}
+
+	validationMessages.mu.Lock()
+	defer validationMessages.mu.Unlock()
+	catalog, ok := validationMessages.byLocale[tag]
+	if !ok {
+		catalog = make(map[string]string)
+		validationMessages.byLocale[tag] = catalog
+		if tag != language.Und {
+			validationMessages.locales = append(validationMessages.locales, tag)
+			validationMessages.matcher = language.NewMatcher(validationMessages.locales)
+		}
+	}
+	for name, message := range messages {
+		catalog[name] = message
+	}
+	return nil
+}
+
+// validationMessages holds the registered validation messages.
+var validationMessages = struct {
+	mu       sync.RWMutex
+	byLocale map[language.Tag]map[string]string
+	locales  []language.Tag // Registered locales, except the default
+	matcher  language.Matcher
+}{byLocale: make(map[language.Tag]map[string]string)}
+
+// validationCatalogs returns the messages of the default locale, and of the
+// registered locale best matching acceptLanguage, if any.
+func validationCatalogs(acceptLanguage string) (defaults map[string]string, locale string, localized map[string]string) {
+	validationMessages.mu.RLock()
+	defer validationMessages.mu.RUnlock()
+	defaults = validationMessages.byLocale[language.Und]
+	if acceptLanguage == "" || validationMessages.matcher == nil {
+		return defaults, "", nil
+	}
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(preferred) == 0 {
+		return defaults, "", nil
+	}
+	_, index, confidence := validationMessages.matcher.Match(preferred...)
+	if confidence == language.No {
+		return defaults, "", nil
+	}
+	tag := validationMessages.locales[index]
+	return defaults, tag.String(), validationMessages.byLocale[tag]
+}
+
+// expandValidationMessage fills the placeholders of a message template.
+func expandValidationMessage(template, field, param string) string {
+	if template == "" {
+		return ""
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(template)
+}
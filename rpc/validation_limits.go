@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// ValidationLimitReason identifies the limit that aborted validation.
+type ValidationLimitReason string
+
+const (
+	// ValidationLimitItems means the request had more repeated or map elements than MaxItems.
+	ValidationLimitItems ValidationLimitReason = "max_items"
+	// ValidationLimitTimeout means validation exceeded its time budget.
+	ValidationLimitTimeout ValidationLimitReason = "timeout"
+	// ValidationLimitDeadline means the request deadline expired or the request was canceled.
+	ValidationLimitDeadline ValidationLimitReason = "deadline"
+)
+
+// ValidationLimits bounds the cost of input validation, so that validate tags
+// over huge repeated fields cannot block a request for seconds.
+//
+// Requests over a limit fail with CodeResourceExhausted. Validation also stops
+// when the request deadline expires or the request is canceled, failing with
+// CodeDeadlineExceeded or CodeCanceled.
+type ValidationLimits struct {
+	// MaxItems is the maximum total number of repeated and map elements in a
+	// validated request (0 for no limit). It is checked before validation runs.
+	MaxItems int
+	// Timeout is the time budget of validation (0 for no limit). A validation
+	// that is abandoned keeps running in the background until it finishes.
+	Timeout time.Duration
+	// OnExceeded is called when validation is aborted, e.g. to emit metrics.
+	OnExceeded func(ValidationLimitEvent)
+}
+
+// ValidationLimitEvent describes an aborted validation.
+type ValidationLimitEvent struct {
+	// Method is the name of the called method.
+	Method string
+	// Reason is the limit that aborted validation.
+	Reason ValidationLimitReason
+	// Items is the number of elements counted, up to MaxItems+1.
+	Items int
+	// Elapsed is the time spent before validation was aborted.
+	Elapsed time.Duration
+}
+
+// WithValidationLimits bounds the cost of input validation.
+func WithValidationLimits(limits ValidationLimits) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.ValidationLimits = limits
+	}
+}
+
+// runValidation runs validate within the configured limits.
+func runValidation(reqCtx context.Context, hctx *handlerContext, input reflect.Value, validate func() error) error {
+	limits := hctx.options.ValidationLimits
+	start := time.Now()
+
+	exceeded := func(reason ValidationLimitReason, items int) {
+		if limits.OnExceeded != nil {
+			limits.OnExceeded(ValidationLimitEvent{
+				Method:  hctx.method.Name,
+				Reason:  reason,
+				Items:   items,
+				Elapsed: time.Since(start),
+			})
+		}
+	}
+
+	// Short-circuit requests that are already over
+	if err := reqCtx.Err(); err != nil {
+		exceeded(ValidationLimitDeadline, 0)
+		return contextError(err)
+	}
+
+	items := 0
+	if limits.MaxItems > 0 {
+		items = countItems(input, limits.MaxItems)
+		if items > limits.MaxItems {
+			exceeded(ValidationLimitItems, items)
+			return NewErrorf(CodeResourceExhausted, "validation cost limit exceeded: more than %d items", limits.MaxItems)
+		}
+	}
+
+	_, hasDeadline := reqCtx.Deadline()
+	if limits.Timeout <= 0 && !hasDeadline {
+		return validate()
+	}
+
+	// Run validation in the background so the request can be released early
+	done := make(chan error, 1)
+	go func() {
+		done <- validate()
+	}()
+
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		timer := time.NewTimer(limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-timeout:
+		// The validation still reads the input
+		retainArena(reqCtx)
+		exceeded(ValidationLimitTimeout, items)
+		return NewErrorf(CodeResourceExhausted, "validation cost limit exceeded: took longer than %v", limits.Timeout)
+	case <-reqCtx.Done():
+		retainArena(reqCtx)
+		exceeded(ValidationLimitDeadline, items)
+		return contextError(reqCtx.Err())
+	}
+}
+
+// contextError converts a context error to an RPC error.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewError(CodeDeadlineExceeded, "deadline exceeded during validation")
+	}
+	return NewError(CodeCanceled, "request canceled during validation")
+}
+
+// countItems counts the repeated and map elements reachable from the exported
+// fields of v. Counting stops once limit is exceeded. Byte slices count as one
+// value, since their elements are never validated individually.
+func countItems(v reflect.Value, limit int) int {
+	count := 0
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		if count > limit {
+			return
+		}
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Struct:
+			t := v.Type()
+			for i := 0; i < v.NumField(); i++ {
+				if t.Field(i).IsExported() {
+					walk(v.Field(i))
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				return
+			}
+			count += v.Len()
+			for i := 0; i < v.Len() && count <= limit; i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Map:
+			count += v.Len()
+			iter := v.MapRange()
+			for iter.Next() && count <= limit {
+				walk(iter.Value())
+			}
+		}
+	}
+	walk(v)
+	return count
+}
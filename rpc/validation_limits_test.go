@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type BulkItem struct {
+	SKU string `json:"sku" validate:"required"`
+}
+
+type BulkRequest struct {
+	Items  []BulkItem        `json:"items" validate:"dive"`
+	Labels map[string]string `json:"labels"`
+	Blob   []byte            `json:"blob"`
+}
+
+type BulkResponse struct {
+	Count int `json:"count"`
+}
+
+func TestValidationLimitsMaxItems(t *testing.T) {
+	var events []ValidationLimitEvent
+	svc := NewService("BulkService",
+		WithPackage("bulk.v1"),
+		WithValidation(true),
+		WithValidationLimits(ValidationLimits{
+			MaxItems:   5,
+			OnExceeded: func(e ValidationLimitEvent) { events = append(events, e) },
+		}),
+	)
+	MustRegister(svc, "Import", func(ctx context.Context, req *BulkRequest) (*BulkResponse, error) {
+		return &BulkResponse{Count: len(req.Items)}, nil
+	})
+
+	gw, err := NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(body string) string {
+		req := httptest.NewRequest(http.MethodPost, "/bulk.v1.BulkService/Import", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	if body := call(`{"items":[{"sku":"a"},{"sku":"b"}],"labels":{"k":"v"},"blob":"AAAAAAAAAAAAAAAA"}`); !strings.Contains(body, `"count":2`) {
+		t.Errorf("Expected request under the limit to succeed, got %s", body)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %v", events)
+	}
+
+	body := call(`{"items":[{"sku":"a"},{"sku":"b"},{"sku":"c"}],"labels":{"a":"1","b":"2","c":"3"}}`)
+	if !strings.Contains(body, string(CodeResourceExhausted)) {
+		t.Errorf("Expected resource_exhausted, got %s", body)
+	}
+	if len(events) != 1 || events[0].Method != "Import" || events[0].Reason != ValidationLimitItems || events[0].Items <= 5 {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestRunValidationTimeBudget(t *testing.T) {
+	slow := func(ctx context.Context) func() error {
+		return func() error {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			return nil
+		}
+	}
+	newContext := func(limits ValidationLimits, events *[]ValidationLimitEvent) *handlerContext {
+		limits.OnExceeded = func(e ValidationLimitEvent) { *events = append(*events, e) }
+		return &handlerContext{
+			method:  &Method{Name: "Slow"},
+			options: &ServiceOptions{ValidationLimits: limits},
+		}
+	}
+	input := reflect.ValueOf(&BulkRequest{})
+
+	tests := []struct {
+		name       string
+		limits     ValidationLimits
+		ctx        func() (context.Context, context.CancelFunc)
+		wantCode   Code
+		wantReason ValidationLimitReason
+	}{
+		{
+			name:       "timeout",
+			limits:     ValidationLimits{Timeout: 10 * time.Millisecond},
+			ctx:        func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			wantCode:   CodeResourceExhausted,
+			wantReason: ValidationLimitTimeout,
+		},
+		{
+			name: "request deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantCode:   CodeDeadlineExceeded,
+			wantReason: ValidationLimitDeadline,
+		},
+		{
+			name: "already canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantCode:   CodeCanceled,
+			wantReason: ValidationLimitDeadline,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			stop, stopValidation := context.WithCancel(context.Background())
+			defer stopValidation()
+
+			var events []ValidationLimitEvent
+			start := time.Now()
+			err := runValidation(ctx, newContext(tt.limits, &events), input, slow(stop))
+
+			var rpcErr *Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != tt.wantCode {
+				t.Fatalf("Expected %s, got %v", tt.wantCode, err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Expected validation to be abandoned early, took %v", elapsed)
+			}
+			if len(events) != 1 || events[0].Reason != tt.wantReason {
+				t.Errorf("Expected one %s event, got %+v", tt.wantReason, events)
+			}
+		})
+	}
+
+	t.Run("finishes within budget", func(t *testing.T) {
+		var events []ValidationLimitEvent
+		want := NewError(CodeInvalidArgument, "bad")
+		err := runValidation(context.Background(), newContext(ValidationLimits{Timeout: time.Second}, &events), input, func() error { return want })
+		if err != want || len(events) != 0 {
+			t.Errorf("Expected the validation error without events, got %v %v", err, events)
+		}
+	})
+}
+
+func TestCountItems(t *testing.T) {
+	req := &BulkRequest{
+		Items:  []BulkItem{{SKU: "a"}, {SKU: "b"}},
+		Labels: map[string]string{"a": "1"},
+		Blob:   make([]byte, 1024),
+	}
+	if got := countItems(reflect.ValueOf(req), 100); got != 3 {
+		t.Errorf("Expected 3 items, got %d", got)
+	}
+	if got := countItems(reflect.ValueOf(req), 1); got != 2 {
+		t.Errorf("Expected counting to stop after the limit, got %d", got)
+	}
+}
@@ -0,0 +1,121 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+type BookRoomRequest struct {
+	Room  string `json:"room" validate:"room_code"`
+	Start int64  `json:"start_at"`
+	End   int64  `json:"end_at"`
+}
+
+type BookRoomResponse struct {
+	Booked bool `json:"booked"`
+}
+
+func init() {
+	if err := rpc.RegisterValidation("room_code", func(fl validator.FieldLevel) bool {
+		return strings.HasPrefix(fl.Field().String(), "R-")
+	}); err != nil {
+		panic(err)
+	}
+	rpc.RegisterStructValidation(func(sl validator.StructLevel) {
+		req := sl.Current().Interface().(BookRoomRequest)
+		if req.Start >= req.End {
+			sl.ReportError(req.Start, "Start", "Start", "start_before_end", "")
+		}
+	}, BookRoomRequest{})
+	for locale, messages := range map[string]map[string]string{
+		"":   {"room_code": "{field} must be a room code such as R-101"},
+		"ja": {"room_code": "{field} は部屋コードではありません", "start_before_end": "開始は終了より前にしてください"},
+	} {
+		if err := rpc.RegisterValidationMessages(locale, messages); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestCustomValidation(t *testing.T) {
+	svc := rpc.NewService("RoomService", rpc.WithPackage("room.v1"), rpc.WithValidation(true))
+	rpc.MustRegister(svc, "Book", func(_ context.Context, _ *BookRoomRequest) (*BookRoomResponse, error) {
+		return &BookRoomResponse{Booked: true}, nil
+	})
+	gw, err := rpc.NewGateway(svc)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	call := func(body, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/room.v1.RoomService/Book", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	violations := func(t *testing.T, rec *httptest.ResponseRecorder) []*errdetails.BadRequest_FieldViolation {
+		t.Helper()
+		var connectErr struct {
+			Details []struct {
+				Value string `json:"value"`
+			} `json:"details"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &connectErr); err != nil || len(connectErr.Details) != 1 {
+			t.Fatalf("Expected an error with one detail, got %s", rec.Body)
+		}
+		data, _ := base64.RawStdEncoding.DecodeString(connectErr.Details[0].Value)
+		var badRequest errdetails.BadRequest
+		if err := proto.Unmarshal(data, &badRequest); err != nil {
+			t.Fatal(err)
+		}
+		return badRequest.GetFieldViolations()
+	}
+
+	if rec := call(`{"room":"R-101","start_at":1,"end_at":2}`, ""); !strings.Contains(rec.Body.String(), `"booked":true`) {
+		t.Errorf("Expected a valid request to succeed, got %s", rec.Body)
+	}
+
+	t.Run("default messages", func(t *testing.T) {
+		v := violations(t, call(`{"room":"101","start_at":2,"end_at":1}`, ""))
+		if len(v) != 2 {
+			t.Fatalf("Expected two violations, got %v", v)
+		}
+		if v[0].GetField() != "room" || v[0].GetReason() != "ROOM_CODE" || v[0].GetDescription() != "room must be a room code such as R-101" {
+			t.Errorf("Unexpected field violation: %v", v[0])
+		}
+		if v[1].GetField() != "start_at" || v[1].GetReason() != "START_BEFORE_END" || v[1].GetDescription() != "failed the start_before_end constraint" {
+			t.Errorf("Unexpected struct-level violation: %v", v[1])
+		}
+		if v[0].GetLocalizedMessage() != nil {
+			t.Errorf("Expected no localized message without Accept-Language, got %v", v[0].GetLocalizedMessage())
+		}
+	})
+
+	t.Run("localized messages", func(t *testing.T) {
+		v := violations(t, call(`{"room":"101","start_at":2,"end_at":1}`, "fr;q=0.9, ja-JP"))
+		if len(v) != 2 {
+			t.Fatalf("Expected two violations, got %v", v)
+		}
+		for i, want := range []string{"room は部屋コードではありません", "開始は終了より前にしてください"} {
+			if got := v[i].GetLocalizedMessage(); got.GetLocale() != "ja" || got.GetMessage() != want {
+				t.Errorf("Localized message %d = %v, want %q", i, got, want)
+			}
+		}
+	})
+}
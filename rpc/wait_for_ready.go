@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Backoff of calls waiting for a server that refuses connections
+const (
+	waitForReadyInitialBackoff = 100 * time.Millisecond
+	waitForReadyMaxBackoff     = 5 * time.Second
+)
+
+// NewWaitForReadyTransport returns a transport with the wait-for-ready
+// semantics of gRPC: calls that find the server not ready wait and are sent
+// again until it is, instead of failing fast. A server is not ready when it
+// refuses connections, which is retried with exponential backoff, or when it
+// sheds the call with a pushback (see LoadSheddingPolicy), which is retried
+// after the pushback. Calls are never sent again when the server asks not
+// to retry, or once it may have processed them.
+//
+// Calls wait until their request context ends, so they should have a
+// deadline. Requests with a body are only sent again if it can be recreated
+// with GetBody, as for bodies given to http.NewRequest as bytes or strings.
+// base defaults to http.DefaultTransport.
+//
+//	client := &http.Client{Transport: rpc.NewWaitForReadyTransport(rpc.NewDeadlineTransport(nil))}
+func NewWaitForReadyTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &waitForReadyTransport{base: base}
+}
+
+// waitForReadyTransport sends calls again while the server is not ready.
+type waitForReadyTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *waitForReadyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	backoff := waitForReadyInitialBackoff
+	for {
+		resp, err := t.base.RoundTrip(req)
+		delay, ok := notReadyDelay(resp, err, backoff)
+		if !ok || !replayable {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, waitForReadyMaxBackoff)
+
+		// RoundTrippers must not modify the request
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// notReadyDelay reports whether a call failed because the server was not
+// ready, and how long to wait before sending it again.
+func notReadyDelay(resp *http.Response, err error, backoff time.Duration) (time.Duration, bool) {
+	if err != nil {
+		// Only refused connections are known not to have reached the server
+		var opErr *net.OpError
+		return backoff, errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	if delay, retry, ok := RetryPushback(resp); ok {
+		return delay, retry
+	}
+	return 0, false
+}
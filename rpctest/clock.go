@@ -0,0 +1,92 @@
+package rpctest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is an rpc.Clock that only moves when advanced. Handlers driven by
+// a StreamDriver see it through rpc.ClockFrom.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	changed chan struct{}
+}
+
+// fakeTimer is a pending After call.
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock returns a fake clock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the fake time once the clock has been
+// advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the timers that expire, in
+// order of expiry.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].at.Before(c.timers[j].at)
+	})
+	n := 0
+	for ; n < len(c.timers) && !c.timers[n].at.After(c.now); n++ {
+		c.timers[n].ch <- c.timers[n].at
+	}
+	c.timers = c.timers[n:]
+}
+
+// Timers returns the number of pending timers.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least n timers are pending, so a test can
+// advance the clock after the handler started waiting on it.
+func (c *FakeClock) WaitForTimers(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		pending, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if pending >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
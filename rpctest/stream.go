@@ -0,0 +1,311 @@
+// Package rpctest provides utilities for testing hyperway handlers without a
+// server.
+//
+// A StreamDriver runs a streaming handler in the background and steps through
+// it from the test: every message the test feeds is received by the handler
+// before Send returns, and every message the handler sends waits until the
+// test reads it. Cancellations and fake time can therefore be injected at
+// exact points of a conversation:
+//
+//	d := rpctest.DriveBidiStream(t, chatHandler)
+//	d.Send(&ChatMessage{Text: "hello"})
+//	d.Expect(&ChatMessage{Text: "echo: hello"})
+//	d.AwaitTimers(1)
+//	d.Advance(time.Minute) // the handler's idle timeout fires
+//	if _, err := d.Finish(); err == nil { ... }
+package rpctest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/i2y/hyperway/rpc"
+)
+
+// DefaultTimeout is how long driver operations wait for the handler before
+// failing the test.
+const DefaultTimeout = 5 * time.Second
+
+// errHandlerPanicked wraps panics recovered from driven handlers.
+var errHandlerPanicked = errors.New("handler panicked")
+
+// Option configures a StreamDriver.
+type Option func(*options)
+
+type options struct {
+	ctx     context.Context
+	clock   *FakeClock
+	timeout time.Duration
+}
+
+// WithContext sets the parent context of the handler (default: context.Background()).
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithClock sets the fake clock of the handler (default: a clock at the Unix epoch).
+func WithClock(clock *FakeClock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithTimeout sets how long driver operations wait for the handler (default: DefaultTimeout).
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// StreamDriver drives a streaming handler deterministically. Its methods
+// must be called from the test goroutine, since they fail the test when the
+// handler doesn't behave as expected.
+type StreamDriver[TIn, TOut any] struct {
+	tb        testing.TB
+	ctx       context.Context
+	cancel    context.CancelFunc
+	clock     *FakeClock
+	timeout   time.Duration
+	in        chan *TIn
+	inClosed  chan struct{}
+	closeOnce sync.Once
+	out       chan *TOut
+	done      chan struct{}
+	resp      *TOut
+	err       error
+}
+
+// DriveServerStream starts a server-streaming handler with req.
+func DriveServerStream[TIn, TOut any](
+	tb testing.TB, handler rpc.ServerStreamHandler[TIn, TOut], req *TIn, opts ...Option,
+) *StreamDriver[TIn, TOut] {
+	tb.Helper()
+	d := newStreamDriver[TIn, TOut](tb, opts)
+	d.CloseSend()
+	go d.run(func(s *driverStream[TIn, TOut]) (*TOut, error) {
+		return nil, handler(d.ctx, req, s)
+	})
+	return d
+}
+
+// DriveClientStream starts a client-streaming handler. Its response is
+// returned by Finish.
+func DriveClientStream[TIn, TOut any](
+	tb testing.TB, handler rpc.ClientStreamHandler[TIn, TOut], opts ...Option,
+) *StreamDriver[TIn, TOut] {
+	tb.Helper()
+	d := newStreamDriver[TIn, TOut](tb, opts)
+	go d.run(func(s *driverStream[TIn, TOut]) (*TOut, error) {
+		return handler(d.ctx, s)
+	})
+	return d
+}
+
+// DriveBidiStream starts a bidirectional streaming handler.
+func DriveBidiStream[TIn, TOut any](
+	tb testing.TB, handler rpc.BidiStreamHandler[TIn, TOut], opts ...Option,
+) *StreamDriver[TIn, TOut] {
+	tb.Helper()
+	d := newStreamDriver[TIn, TOut](tb, opts)
+	go d.run(func(s *driverStream[TIn, TOut]) (*TOut, error) {
+		return nil, handler(d.ctx, s)
+	})
+	return d
+}
+
+func newStreamDriver[TIn, TOut any](tb testing.TB, opts []Option) *StreamDriver[TIn, TOut] {
+	o := options{
+		ctx:     context.Background(),
+		timeout: DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.clock == nil {
+		o.clock = NewFakeClock(time.Unix(0, 0).UTC())
+	}
+
+	ctx, cancel := context.WithCancel(rpc.ContextWithClock(o.ctx, o.clock))
+	d := &StreamDriver[TIn, TOut]{
+		tb:       tb,
+		ctx:      ctx,
+		cancel:   cancel,
+		clock:    o.clock,
+		timeout:  o.timeout,
+		in:       make(chan *TIn),
+		inClosed: make(chan struct{}),
+		out:      make(chan *TOut),
+		done:     make(chan struct{}),
+	}
+	// Don't leak handlers of failed tests
+	tb.Cleanup(func() {
+		cancel()
+		select {
+		case <-d.done:
+		case <-time.After(d.timeout):
+		}
+	})
+	return d
+}
+
+// run calls the handler and records its result.
+func (d *StreamDriver[TIn, TOut]) run(call func(*driverStream[TIn, TOut]) (*TOut, error)) {
+	defer close(d.done)
+	defer func() {
+		if rec := recover(); rec != nil {
+			d.err = fmt.Errorf("%w: %v", errHandlerPanicked, rec)
+		}
+	}()
+	d.resp, d.err = call(&driverStream[TIn, TOut]{d: d})
+}
+
+// Context returns the context passed to the handler.
+func (d *StreamDriver[TIn, TOut]) Context() context.Context {
+	return d.ctx
+}
+
+// Clock returns the fake clock of the handler.
+func (d *StreamDriver[TIn, TOut]) Clock() *FakeClock {
+	return d.clock
+}
+
+// Send feeds a client message and returns once the handler received it.
+func (d *StreamDriver[TIn, TOut]) Send(msg *TIn) {
+	d.tb.Helper()
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case d.in <- msg:
+	case <-d.done:
+		d.tb.Fatalf("handler returned before receiving %v: %v", msg, d.err)
+	case <-timer.C:
+		d.tb.Fatalf("handler did not receive %v within %v", msg, d.timeout)
+	}
+}
+
+// CloseSend ends the client stream. Further receives of the handler return io.EOF.
+func (d *StreamDriver[TIn, TOut]) CloseSend() {
+	d.closeOnce.Do(func() {
+		close(d.inClosed)
+	})
+}
+
+// Recv returns the next message sent by the handler.
+func (d *StreamDriver[TIn, TOut]) Recv() *TOut {
+	d.tb.Helper()
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-d.out:
+		return msg
+	case <-d.done:
+		d.tb.Fatalf("handler returned instead of sending a message: %v", d.err)
+	case <-timer.C:
+		d.tb.Fatalf("handler did not send a message within %v", d.timeout)
+	}
+	return nil
+}
+
+// Expect asserts that the handler sends want, in order. Messages are
+// compared with proto.Equal or reflect.DeepEqual.
+func (d *StreamDriver[TIn, TOut]) Expect(want ...*TOut) {
+	d.tb.Helper()
+	for i, w := range want {
+		if got := d.Recv(); !messagesEqual(got, w) {
+			d.tb.Errorf("message %d: got %v, want %v", i, got, w)
+		}
+	}
+}
+
+// Cancel cancels the context of the handler, as a client disconnecting would.
+func (d *StreamDriver[TIn, TOut]) Cancel() {
+	d.cancel()
+}
+
+// AwaitTimers waits until the handler has at least n pending timers on the
+// fake clock, so the clock can be advanced past them.
+func (d *StreamDriver[TIn, TOut]) AwaitTimers(n int) {
+	d.tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	if err := d.clock.WaitForTimers(ctx, n); err != nil {
+		d.tb.Fatalf("handler did not wait on %d timers within %v", n, d.timeout)
+	}
+}
+
+// Advance moves the fake clock of the handler forward.
+func (d *StreamDriver[TIn, TOut]) Advance(dur time.Duration) {
+	d.clock.Advance(dur)
+}
+
+// Finish waits for the handler to return and returns its response (for
+// client streams) and error. Messages the handler sends meanwhile fail the
+// test, since they were not expected.
+func (d *StreamDriver[TIn, TOut]) Finish() (*TOut, error) {
+	d.tb.Helper()
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-d.out:
+			d.tb.Errorf("unexpected message %v", msg)
+		case <-d.done:
+			return d.resp, d.err
+		case <-timer.C:
+			d.tb.Fatalf("handler did not return within %v", d.timeout)
+			return nil, nil
+		}
+	}
+}
+
+// driverStream is the stream seen by a driven handler.
+type driverStream[TIn, TOut any] struct {
+	d *StreamDriver[TIn, TOut]
+}
+
+// Send implements rpc.ServerStream and rpc.BidiStream.
+func (s *driverStream[TIn, TOut]) Send(msg *TOut) error {
+	select {
+	case s.d.out <- msg:
+		return nil
+	case <-s.d.ctx.Done():
+		return s.d.ctx.Err()
+	}
+}
+
+// Recv implements rpc.ClientStream and rpc.BidiStream.
+func (s *driverStream[TIn, TOut]) Recv() (*TIn, error) {
+	select {
+	case msg := <-s.d.in:
+		return msg, nil
+	case <-s.d.inClosed:
+		return nil, io.EOF
+	case <-s.d.ctx.Done():
+		return nil, s.d.ctx.Err()
+	}
+}
+
+// Context implements the stream interfaces.
+func (s *driverStream[TIn, TOut]) Context() context.Context {
+	return s.d.ctx
+}
+
+// messagesEqual compares two messages.
+func messagesEqual(a, b any) bool {
+	if pa, ok := a.(proto.Message); ok {
+		if pb, ok := b.(proto.Message); ok {
+			return proto.Equal(pa, pb)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,156 @@
+package rpctest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/i2y/hyperway/rpc"
+	"github.com/i2y/hyperway/rpctest"
+)
+
+type Number struct {
+	Value int `json:"value"`
+}
+
+type TickRequest struct {
+	Count int `json:"count"`
+}
+
+type Tick struct {
+	Seq int       `json:"seq"`
+	At  time.Time `json:"at"`
+}
+
+func sumHandler(_ context.Context, stream rpc.ClientStream[Number]) (*Number, error) {
+	total := 0
+	for {
+		n, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return &Number{Value: total}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		total += n.Value
+	}
+}
+
+func tickHandler(ctx context.Context, req *TickRequest, stream rpc.ServerStream[Tick]) error {
+	clock := rpc.ClockFrom(ctx)
+	for seq := 0; seq < req.Count; seq++ {
+		if seq > 0 {
+			select {
+			case <-clock.After(time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := stream.Send(&Tick{Seq: seq, At: clock.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doubleHandler(_ context.Context, stream rpc.BidiStream[Number, Number]) error {
+	for {
+		n, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&Number{Value: n.Value * 2}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		d := rpctest.DriveClientStream(t, sumHandler)
+		for i := 1; i <= 3; i++ {
+			d.Send(&Number{Value: i})
+		}
+		d.CloseSend()
+		resp, err := d.Finish()
+		if err != nil || resp.Value != 6 {
+			t.Errorf("Expected 6, got %v, %v", resp, err)
+		}
+	})
+
+	t.Run("cancel after first message", func(t *testing.T) {
+		d := rpctest.DriveClientStream(t, sumHandler)
+		d.Send(&Number{Value: 1})
+		d.Cancel()
+		if _, err := d.Finish(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context canceled, got %v", err)
+		}
+	})
+}
+
+func TestServerStreamFakeTime(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d := rpctest.DriveServerStream(t, tickHandler, &TickRequest{Count: 3},
+		rpctest.WithClock(rpctest.NewFakeClock(start)))
+
+	d.Expect(&Tick{Seq: 0, At: start})
+	d.AwaitTimers(1)
+	d.Advance(time.Second)
+	d.Expect(&Tick{Seq: 1, At: start.Add(time.Second)})
+
+	// Disconnect while the handler waits for the last tick
+	d.AwaitTimers(1)
+	d.Cancel()
+	if _, err := d.Finish(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled, got %v", err)
+	}
+}
+
+func TestBidiStream(t *testing.T) {
+	d := rpctest.DriveBidiStream(t, doubleHandler)
+	d.Send(&Number{Value: 1})
+	d.Expect(&Number{Value: 2})
+	d.Send(&Number{Value: 21})
+	if got := d.Recv(); got.Value != 42 {
+		t.Errorf("Expected 42, got %d", got.Value)
+	}
+	d.CloseSend()
+	if _, err := d.Finish(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := rpctest.NewFakeClock(time.Unix(0, 0))
+	late := clock.After(2 * time.Second)
+	early := clock.After(time.Second)
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("Expected a zero duration to fire immediately")
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case at := <-early:
+		if !at.Equal(time.Unix(1, 0)) {
+			t.Errorf("Expected the timer to fire at 1s, got %v", at)
+		}
+	default:
+		t.Error("Expected the 1s timer to fire")
+	}
+	if clock.Timers() != 1 {
+		t.Errorf("Expected 1 pending timer, got %d", clock.Timers())
+	}
+
+	clock.Advance(time.Second)
+	<-late
+	if !clock.Now().Equal(time.Unix(2, 0)) {
+		t.Errorf("Expected 2s, got %v", clock.Now())
+	}
+}
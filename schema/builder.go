@@ -4,8 +4,10 @@ package schema
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"unicode"
@@ -19,6 +21,7 @@ import (
 	_ "google.golang.org/protobuf/types/known/durationpb"
 	_ "google.golang.org/protobuf/types/known/emptypb"
 	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // ErrSkipField is returned when a field should be skipped during processing.
@@ -41,6 +44,27 @@ func title(s string) string {
 	return string(r)
 }
 
+// mapEntryName returns the name of the map entry message of a map field,
+// which protobuf derives from the field name: "items_by_id" has the entry
+// "ItemsByIdEntry".
+func mapEntryName(fieldName string) string {
+	var b strings.Builder
+	upperNext := true
+	for _, r := range fieldName {
+		switch {
+		case r == '_':
+			upperNext = true
+		case upperNext:
+			b.WriteRune(unicode.ToUpper(r))
+			upperNext = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("Entry")
+	return b.String()
+}
+
 // Builder converts Go types to Protobuf FileDescriptorSet.
 type Builder struct {
 	mu          sync.RWMutex
@@ -53,7 +77,13 @@ type Builder struct {
 	currentFile      *descriptorpb.FileDescriptorProto
 	messageTypes     map[string]*descriptorpb.DescriptorProto
 	pendingTypes     []pendingType
-	wellKnownImports map[string]bool // Track well-known type imports
+	wellKnownImports map[string]bool         // Track well-known type imports
+	goTypes          map[string]reflect.Type // Go types of the messages, by name
+
+	// Go types of the messages built for each type, by message name
+	builtTypes map[reflect.Type]map[string]reflect.Type
+	// Field numbers of the message being built taken by protobuf tags
+	taggedNumbers map[int32]bool
 
 	// Comment tracking
 	sourceCodeInfo  *SourceCodeInfoBuilder
@@ -82,14 +112,43 @@ type BuilderOptions struct {
 	// MaxCacheSize limits the cache size (0 = unlimited)
 	MaxCacheSize int
 
-	// SyntaxMode specifies proto3 or editions mode
+	// SyntaxMode specifies proto3, proto2, or editions mode
 	SyntaxMode SyntaxMode
 	// Edition specifies the edition year (e.g., "2023", "2024")
 	Edition string
 	// Features specifies the default feature set for editions mode
 	Features *FeatureSet
+
+	// JSONNames selects the json_name of message fields (default: unset)
+	JSONNames JSONNameStyle
+	// PointerScalarsAsWrappers maps pointers to scalars, such as *int32 and
+	// *string, to wrapper types like google.protobuf.Int32Value instead of
+	// proto3 optional fields
+	PointerScalarsAsWrappers bool
+	// Int64JSType sets the jstype option of 64-bit integer fields, e.g.
+	// JS_STRING for fields encoded as JSON strings (default: unset)
+	Int64JSType descriptorpb.FieldOptions_JSType
+	// ProtobufTags takes the names, numbers, JSON names, and integer
+	// encodings of fields from the `protobuf:"..."` tags protoc-gen-go emits,
+	// so generated structs get the descriptors of the generated messages
+	ProtobufTags bool
 }
 
+// JSONNameStyle selects the json_name set on the fields of built messages.
+type JSONNameStyle int
+
+const (
+	// JSONNameUnset leaves json_name unset, so the proto3 JSON mapping
+	// derives lowerCamelCase names from the field names.
+	JSONNameUnset JSONNameStyle = iota
+	// JSONNameProto uses the field names, which are snake_case.
+	JSONNameProto
+	// JSONNameCamelCase uses the lowerCamelCase form of the field names.
+	JSONNameCamelCase
+	// JSONNameGo uses the names of the Go struct fields.
+	JSONNameGo
+)
+
 // Cache size constants for pre-allocation
 const (
 	defaultMessageCacheSize = 32
@@ -109,9 +168,13 @@ func NewBuilder(opts BuilderOptions) *Builder {
 		if opts.Edition == "" {
 			opts.Edition = Edition2023 // Default to 2023
 		}
-		if opts.Features == nil {
+		if opts.Features == nil && opts.Edition == Edition2024 {
+			opts.Features = DefaultEdition2024Features()
+		} else if opts.Features == nil {
 			opts.Features = DefaultEdition2023Features()
 		}
+	} else if opts.SyntaxMode == SyntaxProto2 && opts.Features == nil {
+		opts.Features = DefaultProto2Features()
 	} else if opts.Features == nil {
 		// Proto3 mode (default)
 		opts.Features = DefaultProto3Features()
@@ -121,6 +184,7 @@ func NewBuilder(opts BuilderOptions) *Builder {
 		// Pre-allocate maps with reasonable initial capacities
 		cache:       make(map[reflect.Type]protoreflect.MessageDescriptor, defaultMessageCacheSize),
 		fileCache:   make(map[string]*descriptorpb.FileDescriptorProto, defaultFileCacheSize),
+		builtTypes:  make(map[reflect.Type]map[string]reflect.Type, defaultMessageCacheSize),
 		packageName: opts.PackageName,
 		options:     opts,
 	}
@@ -162,6 +226,7 @@ func (b *Builder) BuildMessage(rt reflect.Type) (protoreflect.MessageDescriptor,
 
 	// Finalize the file
 	b.finalizeFile(name)
+	b.builtTypes[rt] = b.goTypes
 
 	// Create and cache the message descriptor
 	return b.createAndCacheDescriptor(rt, name)
@@ -188,7 +253,7 @@ func (b *Builder) prepareType(rt reflect.Type) (reflect.Type, string, error) {
 		return nil, "", fmt.Errorf("type %v is not a struct", rt)
 	}
 
-	name := rt.Name()
+	name := MessageName(rt)
 	if name == "" {
 		name = "AnonymousMessage"
 	}
@@ -215,6 +280,8 @@ func (b *Builder) initializeBuildContext(name string) {
 		}
 		fileFeatures := CreateFileFeatures(b.options.Edition)
 		ApplyFeaturesToFileOptions(b.currentFile.Options, fileFeatures)
+	} else if b.options.SyntaxMode == SyntaxProto2 {
+		b.currentFile.Syntax = proto("proto2")
 	} else {
 		b.currentFile.Syntax = proto("proto3")
 	}
@@ -223,6 +290,7 @@ func (b *Builder) initializeBuildContext(name string) {
 	b.messageTypes = make(map[string]*descriptorpb.DescriptorProto, defaultMessageTypesSize)
 	b.pendingTypes = nil
 	b.wellKnownImports = make(map[string]bool)
+	b.goTypes = make(map[string]reflect.Type, defaultMessageTypesSize)
 
 	// Initialize comment tracking
 	b.sourceCodeInfo = NewSourceCodeInfoBuilder()
@@ -236,6 +304,7 @@ func (b *Builder) initializeBuildContext(name string) {
 func (b *Builder) buildAllMessageTypes(rt reflect.Type, name string) error {
 	// Build the main message
 	visited := make(map[reflect.Type]bool)
+	b.goTypes[name] = rt
 	msgProto, err := b.collectMessageType(rt, name, visited)
 	if err != nil {
 		return err
@@ -248,6 +317,9 @@ func (b *Builder) buildAllMessageTypes(rt reflect.Type, name string) error {
 		b.pendingTypes = nil
 
 		for _, p := range pending {
+			if err := b.claimMessageName(p.name, p.rt); err != nil {
+				return err
+			}
 			if _, exists := b.messageTypes[p.name]; !exists {
 				msg, err := b.collectMessageType(p.rt, p.name, visited)
 				if err != nil {
@@ -258,18 +330,86 @@ func (b *Builder) buildAllMessageTypes(rt reflect.Type, name string) error {
 		}
 	}
 
-	// Add all collected messages to the file
-	b.currentFile.MessageType = make([]*descriptorpb.DescriptorProto, 0, len(b.messageTypes))
-	messageIndex := int32(0)
-	for msgName, msg := range b.messageTypes {
-		b.currentFile.MessageType = append(b.currentFile.MessageType, msg)
-		b.messageIndices[msgName] = messageIndex
-		messageIndex++
+	// Add all collected messages to the file, sorted so that exports are stable
+	names := make([]string, 0, len(b.messageTypes))
+	for msgName := range b.messageTypes {
+		names = append(names, msgName)
+	}
+	sort.Strings(names)
+	b.currentFile.MessageType = make([]*descriptorpb.DescriptorProto, 0, len(names))
+	for i, msgName := range names {
+		b.currentFile.MessageType = append(b.currentFile.MessageType, b.messageTypes[msgName])
+		b.messageIndices[msgName] = int32(i) //nolint:gosec // message count fits in int32
 	}
 
 	return nil
 }
 
+// claimMessageName records that the message name stands for the Go type rt,
+// failing if it already stands for another type: two types of the same name
+// from different Go packages, or a type named like the message of an
+// anonymous struct.
+func (b *Builder) claimMessageName(name string, rt reflect.Type) error {
+	if other, ok := b.goTypes[name]; ok && other != rt {
+		return fmt.Errorf("message %s.%s would describe both %s and %s, rename one of them",
+			b.packageName, name, GoTypeName(other), GoTypeName(rt))
+	}
+	b.goTypes[name] = rt
+	return nil
+}
+
+// MessageTypes returns the Go types of the messages built for rt, by message
+// name, or nil if rt has not been built.
+func (b *Builder) MessageTypes(rt reflect.Type) map[string]reflect.Type {
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return maps.Clone(b.builtTypes[rt])
+}
+
+// GoTypeName returns the name of a Go type qualified with its full package
+// path, such as "github.com/acme/api/users.User", or the type literal of
+// anonymous types.
+func GoTypeName(rt reflect.Type) string {
+	if rt.Name() == "" || rt.PkgPath() == "" {
+		return rt.String()
+	}
+	return rt.PkgPath() + "." + rt.Name()
+}
+
+// MessageName returns the name of the message of a named Go type: its name,
+// or for instances of generic types, the names of the type arguments followed
+// by the name of the generic type, such as "UserPage" for Page[*users.User].
+func MessageName(rt reflect.Type) string {
+	name := rt.Name()
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	// Type arguments are spelled with their package paths, such as
+	// "Page[*github.com/acme/api/users.User]"
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_./-", r)
+	})
+	var sb strings.Builder
+	for _, word := range append(words[1:], words[0]) {
+		sb.WriteString(title(word[strings.LastIndex(word, ".")+1:]))
+	}
+	return sb.String()
+}
+
+// nestedMessageName names the message of an anonymous struct after the
+// message and field holding it, e.g. "CreateUserRequest_Options", so that
+// anonymous structs of fields with the same name in different messages get
+// different messages.
+func nestedMessageName(parent, field string) string {
+	if parent == "" {
+		return title(field)
+	}
+	return parent + "_" + title(field)
+}
+
 // addCommentsToFile adds all collected comments to the source code info.
 func (b *Builder) addCommentsToFile() {
 	// Add message comments
@@ -303,6 +443,7 @@ func (b *Builder) addImportsToFile() {
 		for importPath := range b.wellKnownImports {
 			b.currentFile.Dependency = append(b.currentFile.Dependency, importPath)
 		}
+		sort.Strings(b.currentFile.Dependency)
 	}
 }
 
@@ -314,6 +455,8 @@ func (b *Builder) finalizeFile(name string) {
 		b.currentFile.SourceCodeInfo = sourceCodeInfo
 	}
 
+	ApplyNamingStyle(b.currentFile)
+
 	// Cache the file
 	b.fileCache[strings.ToLower(name)] = b.currentFile
 }
@@ -347,8 +490,8 @@ func (b *Builder) createAndCacheDescriptor(rt reflect.Type, name string) (protor
 
 // collectMessageType collects a message type and all its dependencies.
 func (b *Builder) collectMessageType(rt reflect.Type, name string, visited map[reflect.Type]bool) (*descriptorpb.DescriptorProto, error) {
-	if visited[rt] {
-		return b.messageTypes[name], nil // Already processed
+	if msg, ok := b.messageTypes[name]; ok && visited[rt] {
+		return msg, nil // Already processed
 	}
 	visited[rt] = true
 
@@ -399,17 +542,19 @@ func (b *Builder) addOneofDescriptors(msgProto *descriptorpb.DescriptorProto, on
 // processStructFields processes all fields in a struct
 func (b *Builder) processStructFields(rt reflect.Type, msgProto *descriptorpb.DescriptorProto, oneofGroups []OneofGroup, visited map[reflect.Type]bool, name string) error {
 	fieldNumber := int32(1)
+	b.taggedNumbers = b.protobufTagNumbers(rt)
 	// Pre-allocate map with expected capacity based on field count
 	processedOneofFields := make(map[string]bool, rt.NumField()/oneofFieldRatio)
 
-	for i := 0; i < rt.NumField(); i++ {
-		field := rt.Field(i)
-		if !field.IsExported() {
-			continue
-		}
+	// Fields of embedded structs are flattened into the message
+	for _, messageField := range MessageFields(rt) {
+		field := messageField.StructField
 
 		// Check if this field is a tagged oneof struct
-		oneofIndex, processed := b.checkOneofField(&field, oneofGroups, processedOneofFields)
+		oneofIndex, processed := int32(-1), false
+		if len(field.Index) == 1 {
+			oneofIndex, processed = b.checkOneofField(&field, oneofGroups, processedOneofFields)
+		}
 		if oneofIndex >= 0 {
 			if !processed {
 				group := oneofGroups[oneofIndex]
@@ -421,8 +566,16 @@ func (b *Builder) processStructFields(rt reflect.Type, msgProto *descriptorpb.De
 			continue
 		}
 
+		// Fields holding a union are oneofs of their members
+		if union, ok := LookupUnion(field.Type); ok {
+			if err := b.processUnionField(&field, messageField.Prefix, union, &fieldNumber, msgProto); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Regular field processing
-		if err := b.processRegularField(&field, &fieldNumber, msgProto, visited, name); err != nil {
+		if err := b.processRegularField(&field, messageField.Prefix, &fieldNumber, msgProto, visited, name); err != nil {
 			return err
 		}
 	}
@@ -445,9 +598,82 @@ func (b *Builder) checkOneofField(field *reflect.StructField, oneofGroups []Oneo
 	return -1, false
 }
 
-// processRegularField processes a regular (non-oneof) field
-func (b *Builder) processRegularField(field *reflect.StructField, fieldNumber *int32, msgProto *descriptorpb.DescriptorProto, visited map[reflect.Type]bool, name string) error {
-	fieldProto, nestedTypes, err := b.buildFieldDescriptor(field, *fieldNumber, visited, name)
+// nextFieldNumber returns the number of the next field without a protobuf
+// tag, skipping the numbers taken by tags.
+func (b *Builder) nextFieldNumber(fieldNumber *int32) int32 {
+	for b.taggedNumbers[*fieldNumber] {
+		*fieldNumber++
+	}
+	return *fieldNumber
+}
+
+// protobufTagNumbers returns the field numbers taken by the protobuf tags of
+// the fields of struct type rt, including those of tagged oneofs, or nil if
+// the builder doesn't honor the tags.
+func (b *Builder) protobufTagNumbers(rt reflect.Type) map[int32]bool {
+	if !b.options.ProtobufTags {
+		return nil
+	}
+	numbers := make(map[int32]bool)
+	add := func(field *reflect.StructField) {
+		if pt, ok, err := LookupProtobufTag(field); ok && err == nil {
+			numbers[pt.Number] = true
+		}
+	}
+	for _, messageField := range MessageFields(rt) {
+		field := messageField.StructField
+		add(&field)
+		if ft := field.Type; field.Tag.Get("hyperway") == "oneof" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for i := 0; ft.Kind() == reflect.Struct && i < ft.NumField(); i++ {
+				subField := ft.Field(i)
+				add(&subField)
+			}
+		}
+	}
+	return numbers
+}
+
+// processUnionField adds a oneof for a field holding a union, named with
+// prefix prepended like its message fields, one per member.
+func (b *Builder) processUnionField(field *reflect.StructField, prefix string, union *Union, fieldNumber *int32, msgProto *descriptorpb.DescriptorProto) error {
+	fieldName, skip := b.extractFieldName(field)
+	if skip {
+		return nil
+	}
+	oneofIndex := len(msgProto.OneofDecl)
+	if oneofIndex > math.MaxInt32 {
+		return fmt.Errorf("too many oneof groups: %d exceeds int32 range", oneofIndex)
+	}
+	msgProto.OneofDecl = append(msgProto.OneofDecl, &descriptorpb.OneofDescriptorProto{
+		Name: proto(prefix + fieldName),
+	})
+
+	for _, member := range union.Members {
+		fieldProto := &descriptorpb.FieldDescriptorProto{
+			Name:       proto(prefix + member.Name),
+			Number:     proto(b.nextFieldNumber(fieldNumber)),
+			Label:      labelPtr(descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL),
+			OneofIndex: proto(int32(oneofIndex)),
+		}
+		b.setJSONName(fieldProto, member.StructType().Name())
+		if err := b.setFieldType(fieldProto, member.StructType(), member.Message); err != nil {
+			return fmt.Errorf("failed to build union field %s.%s: %w", field.Name, member.Name, err)
+		}
+		applyOptionTags(fieldProto, field)
+		msgProto.Field = append(msgProto.Field, fieldProto)
+		*fieldNumber++
+	}
+	return nil
+}
+
+// processRegularField processes a regular (non-oneof) field, named with
+// prefix prepended.
+func (b *Builder) processRegularField(field *reflect.StructField, prefix string, fieldNumber *int32, msgProto *descriptorpb.DescriptorProto, visited map[reflect.Type]bool, name string) error {
+	number := b.nextFieldNumber(fieldNumber)
+	fieldProto, nestedTypes, err := b.buildFieldDescriptor(field, prefix, number, visited, name)
 	if err != nil {
 		if errors.Is(err, ErrSkipField) {
 			return nil
@@ -468,7 +694,7 @@ func (b *Builder) processRegularField(field *reflect.StructField, fieldNumber *i
 		msgProto.Field = append(msgProto.Field, fieldProto)
 
 		// Store field comment for later processing
-		if fieldComment != nil && fieldComment.Leading != "" {
+		if fieldComment != nil {
 			if b.fieldComments[name] == nil {
 				b.fieldComments[name] = make([]*fieldCommentInfo, 0)
 			}
@@ -478,7 +704,9 @@ func (b *Builder) processRegularField(field *reflect.StructField, fieldNumber *i
 			})
 		}
 
-		*fieldNumber++
+		if fieldProto.GetNumber() == number {
+			*fieldNumber++
+		}
 	}
 
 	// Add any nested types (like map entries) to this message
@@ -503,25 +731,55 @@ func (b *Builder) extractFieldName(field *reflect.StructField) (string, bool) {
 	return toSnakeCase(fieldName), false
 }
 
+// lowerCamelCase converts a field name to its default JSON name, dropping
+// underscores and capitalizing the letters following them like protoc does.
+func lowerCamelCase(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			sb.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
 // analyzeFieldType analyzes the Go type to determine proto field characteristics
 func (b *Builder) analyzeFieldType(ft reflect.Type) (fieldType reflect.Type, isRepeated, isMap, isExplicitlyOptional bool) {
 	fieldType = ft
 
+	// Dynamic JSON maps and slices are singular Struct and ListValue messages
+	if _, ok := DynamicJSONType(ft); ok {
+		return
+	}
+
 	switch ft.Kind() { //nolint:exhaustive // Other types handled as-is in default
 	case reflect.Slice:
 		if ft.Elem().Kind() != reflect.Uint8 { // Not []byte
 			isRepeated = true
 			fieldType = ft.Elem()
 		}
+	case reflect.Array:
+		isRepeated = true
+		fieldType = ft.Elem()
 	case reflect.Map:
 		isMap = true
 	case reflect.Ptr:
+		// Pointers to slices, arrays, and maps are fields of their element,
+		// as repeated and map fields have no presence
+		switch ft.Elem().Kind() { //nolint:exhaustive // Other pointers are optional
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return b.analyzeFieldType(ft.Elem())
+		}
 		// Pointer types are explicitly optional in proto3
 		fieldType = ft.Elem()
-		// Check if it's a pointer to slice (not supported as optional)
-		if fieldType.Kind() != reflect.Slice {
-			isExplicitlyOptional = true
-		}
+		isExplicitlyOptional = true
 	default:
 		// All other types are handled as-is
 	}
@@ -529,9 +787,11 @@ func (b *Builder) analyzeFieldType(ft reflect.Type) (fieldType reflect.Type, isR
 	return
 }
 
-// buildFieldDescriptor builds a field descriptor from a struct field.
+// buildFieldDescriptor builds a field descriptor from a struct field, named
+// with prefix prepended.
 func (b *Builder) buildFieldDescriptor(
 	field *reflect.StructField,
+	prefix string,
 	number int32,
 	_ map[reflect.Type]bool,
 	parentMessageName string,
@@ -541,20 +801,64 @@ func (b *Builder) buildFieldDescriptor(
 	if skip {
 		return nil, nil, ErrSkipField
 	}
+	fieldName = prefix + fieldName
 
 	fieldProto := &descriptorpb.FieldDescriptorProto{
 		Name:   proto(fieldName),
 		Number: proto(number),
 	}
 
+	// Fields of generated structs are named and numbered by their protobuf tags
+	pt, err := b.protobufTag(field)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pt != nil {
+		if pt.Name != "" {
+			fieldProto.Name = proto(prefix + pt.Name)
+		}
+		fieldProto.Number = proto(pt.Number)
+	}
+	b.setJSONName(fieldProto, field.Name)
+	if pt != nil && pt.JSONName != "" {
+		fieldProto.JsonName = proto(pt.JSONName)
+	}
+
+	// Groups are a deprecated proto2 feature, and nested messages replace them
+	if field.Tag.Get("proto") == protoTagGroup {
+		return nil, nil, fmt.Errorf("field %s: groups are not supported, use a nested message instead", field.Name)
+	}
+
+	// Defaults are applied to unset fields at decode time, so they must fit the field
+	if tag := field.Tag.Get("default"); tag != "" {
+		if _, err := ParseDefault(field.Type, tag); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Analyze field type
 	ft, isRepeated, isMap, isExplicitlyOptional := b.analyzeFieldType(field.Type)
 
+	// Pointer scalars may map to wrapper types, which have presence of their own
+	if isExplicitlyOptional && b.options.PointerScalarsAsWrappers {
+		if wrapper, ok := WrapperTypeName(ft); ok {
+			b.setFieldLabel(fieldProto, false, false, false)
+			b.wellKnownImports[WrappersProto] = true
+			fieldProto.Type = typePtr(descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+			fieldProto.TypeName = proto(wrapper)
+			if err := b.applyFieldTags(fieldProto, field, false, false); err != nil {
+				return nil, nil, err
+			}
+			return fieldProto, nil, nil
+		}
+	}
+
 	// Set field label
 	b.setFieldLabel(fieldProto, isRepeated, isMap, isExplicitlyOptional)
 
 	// Handle special field types
 	if isMap {
+		applyOptionTags(fieldProto, field)
 		return b.buildMapField(field, fieldProto, number, parentMessageName)
 	}
 
@@ -563,16 +867,53 @@ func (b *Builder) buildFieldDescriptor(
 	}
 
 	// Set regular field type
-	if err := b.setFieldType(fieldProto, ft, field.Name); err != nil {
+	if err := b.setFieldType(fieldProto, ft, nestedMessageName(parentMessageName, field.Name)); err != nil {
 		return nil, nil, err
 	}
 
 	// Apply field tags
-	b.applyFieldTags(fieldProto, field, isRepeated, isMap)
+	if err := b.applyFieldTags(fieldProto, field, isRepeated, isMap); err != nil {
+		return nil, nil, err
+	}
+	if pt != nil {
+		applyProtobufEncoding(fieldProto, pt)
+	}
+	b.applyInt64JSType(fieldProto)
 
 	return fieldProto, nil, nil
 }
 
+// setJSONName sets the JSON name of a field under the JSON naming option of
+// the builder, goName being the name of the Go field or type it describes.
+func (b *Builder) setJSONName(fieldProto *descriptorpb.FieldDescriptorProto, goName string) {
+	switch b.options.JSONNames {
+	case JSONNameProto:
+		fieldProto.JsonName = proto(fieldProto.GetName())
+	case JSONNameCamelCase:
+		fieldProto.JsonName = proto(lowerCamelCase(fieldProto.GetName()))
+	case JSONNameGo:
+		fieldProto.JsonName = proto(goName)
+	case JSONNameUnset:
+	}
+}
+
+// applyInt64JSType sets the jstype option of 64-bit integer fields, if the
+// builder has one.
+func (b *Builder) applyInt64JSType(fieldProto *descriptorpb.FieldDescriptorProto) {
+	if b.options.Int64JSType == descriptorpb.FieldOptions_JS_NORMAL {
+		return
+	}
+	switch fieldProto.GetType() { //nolint:exhaustive // Only 64-bit integers have a jstype
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		if fieldProto.Options == nil {
+			fieldProto.Options = &descriptorpb.FieldOptions{}
+		}
+		fieldProto.Options.Jstype = b.options.Int64JSType.Enum()
+	}
+}
+
 // setFieldLabel sets the field label based on field characteristics and syntax mode.
 func (b *Builder) setFieldLabel(fieldProto *descriptorpb.FieldDescriptorProto, isRepeated, isMap, isExplicitlyOptional bool) {
 	if isRepeated || isMap {
@@ -587,7 +928,7 @@ func (b *Builder) setFieldLabel(fieldProto *descriptorpb.FieldDescriptorProto, i
 			// For pointer fields, this is already the correct behavior
 			// For non-pointer fields, the features system handles the presence
 			// No need to set Proto3Optional in editions mode
-		} else if isExplicitlyOptional {
+		} else if isExplicitlyOptional && b.options.SyntaxMode == SyntaxProto3 {
 			// Proto3 mode: Set proto3_optional for explicitly optional fields (pointer types)
 			fieldProto.Proto3Optional = proto(true)
 		}
@@ -602,9 +943,10 @@ func (b *Builder) buildEmptyField(fieldProto *descriptorpb.FieldDescriptorProto)
 	return fieldProto
 }
 
-// setFieldType sets the field type in the field descriptor.
-func (b *Builder) setFieldType(fieldProto *descriptorpb.FieldDescriptorProto, ft reflect.Type, fieldName string) error {
-	protoType, typeName, err := b.getFieldType(ft, fieldName)
+// setFieldType sets the field type in the field descriptor. Anonymous
+// structs are described by a message named nestedName.
+func (b *Builder) setFieldType(fieldProto *descriptorpb.FieldDescriptorProto, ft reflect.Type, nestedName string) error {
+	protoType, typeName, err := b.getFieldType(ft, nestedName)
 	if err != nil {
 		return err
 	}
@@ -616,12 +958,14 @@ func (b *Builder) setFieldType(fieldProto *descriptorpb.FieldDescriptorProto, ft
 	return nil
 }
 
-// applyFieldTags applies validation and proto tags to the field descriptor.
-func (b *Builder) applyFieldTags(fieldProto *descriptorpb.FieldDescriptorProto, field *reflect.StructField, isRepeated, isMap bool) {
+// applyFieldTags applies validation, proto, and features tags to the field
+// descriptor.
+func (b *Builder) applyFieldTags(fieldProto *descriptorpb.FieldDescriptorProto, field *reflect.StructField, isRepeated, isMap bool) error {
 	// Handle validation tags
 	if validateTag := field.Tag.Get("validate"); validateTag != "" {
 		AddValidationMetadata(fieldProto, validateTag)
 	}
+	applyOptionTags(fieldProto, field)
 
 	// Extract all tags for field characteristics
 	tags := make(map[string]string)
@@ -635,6 +979,13 @@ func (b *Builder) applyFieldTags(fieldProto *descriptorpb.FieldDescriptorProto,
 	if b.options.SyntaxMode == SyntaxEditions {
 		// In Editions mode, apply field features
 		chars := ExtractFieldCharacteristics(tags)
+		if featuresTag := field.Tag.Get("features"); featuresTag != "" {
+			features, err := ParseFeaturesTag(featuresTag)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			chars.Features = features
+		}
 
 		// Get parent features (file-level features)
 		var parentFeatures *descriptorpb.FeatureSet
@@ -642,41 +993,104 @@ func (b *Builder) applyFieldTags(fieldProto *descriptorpb.FieldDescriptorProto,
 			parentFeatures = b.currentFile.Options.Features
 		}
 
-		// Create field-specific features
+		// Create field-specific features, set on the field if it overrides any
 		fieldFeatures := CreateFieldFeatures(parentFeatures, chars)
-
-		// Apply features to field options if they differ from parent
-		if fieldFeatures != nil && !featuresEqual(parentFeatures, fieldFeatures) {
+		if err := checkFieldFeatures(fieldProto, fieldFeatures); err != nil {
+			return err
+		}
+		if fieldFeatures != nil {
 			if fieldProto.Options == nil {
 				fieldProto.Options = &descriptorpb.FieldOptions{}
 			}
 			ApplyFeaturesToFieldOptions(fieldProto.Options, fieldFeatures)
 		}
 
-		// Set default value if specified
-		if chars.DefaultValue != "" {
+		// Set default value if specified; message fields, such as durations
+		// and wrappers, cannot have one in descriptors
+		if chars.DefaultValue != "" && fieldProto.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			if fieldFeatures.GetFieldPresence() == descriptorpb.FeatureSet_IMPLICIT {
+				return fmt.Errorf("field %s: fields with implicit presence cannot have a default", field.Name)
+			}
 			// For Editions, default values are set directly on the field
 			fieldProto.DefaultValue = proto(chars.DefaultValue)
 		}
+	} else if b.options.SyntaxMode == SyntaxProto2 {
+		b.applyProto2Tags(fieldProto, field, isRepeated || isMap)
 	} else if tags["proto"] == protoTagOptional && !isRepeated && !isMap {
 		// Proto3 mode: Support proto:"optional" tag
 		fieldProto.Proto3Optional = proto(true)
 	}
+	return nil
+}
+
+// applyProto2Tags marks fields tagged `proto:"required"` required, and sets
+// the default value of scalar fields with a `default` tag, in proto2 mode.
+func (b *Builder) applyProto2Tags(fieldProto *descriptorpb.FieldDescriptorProto, field *reflect.StructField, isRepeated bool) {
+	if isRepeated {
+		return
+	}
+	if field.Tag.Get("proto") == protoTagRequired {
+		fieldProto.Label = labelPtr(descriptorpb.FieldDescriptorProto_LABEL_REQUIRED)
+	}
+
+	// Messages, such as durations and wrappers, cannot have a default, and
+	// those of enums name a value
+	switch fieldProto.GetType() { //nolint:exhaustive // Scalars have defaults
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return
+	default:
+	}
+	if tag := field.Tag.Get("default"); tag != "" {
+		if v, err := ParseDefault(field.Type, tag); err == nil {
+			fieldProto.DefaultValue = proto(formatDefault(v))
+		}
+	}
 }
 
-// getFieldType returns the protobuf type for a Go type.
-func (b *Builder) getFieldType(ft reflect.Type, fieldName string) (descriptorpb.FieldDescriptorProto_Type, string, error) {
+// applyOptionTags sets the field options of fields tagged
+// `sensitive:"true"`, marked debug_redact so tools reading the descriptors
+// know they hold secrets or personal data, and of fields tagged
+// `deprecated:"true"`, marked deprecated.
+func applyOptionTags(fieldProto *descriptorpb.FieldDescriptorProto, field *reflect.StructField) {
+	sensitive := field.Tag.Get("sensitive") == "true"
+	deprecated := field.Tag.Get("deprecated") == "true"
+	if !sensitive && !deprecated {
+		return
+	}
+	if fieldProto.Options == nil {
+		fieldProto.Options = &descriptorpb.FieldOptions{}
+	}
+	if sensitive {
+		fieldProto.Options.DebugRedact = proto(true)
+	}
+	if deprecated {
+		fieldProto.Options.Deprecated = proto(true)
+	}
+}
+
+// getFieldType returns the protobuf type for a Go type, naming the message of
+// anonymous structs nestedName.
+func (b *Builder) getFieldType(ft reflect.Type, nestedName string) (descriptorpb.FieldDescriptorProto_Type, string, error) {
 	// Handle pointer types
 	if ft.Kind() == reflect.Ptr {
 		ft = ft.Elem()
 	}
 
+	// Lazy fields have the schema of their element type
+	if elem, ok := LazyElemType(ft); ok {
+		ft = elem
+	}
+
 	// Check for well-known types first
 	if wkt, ok := IsWellKnownType(ft); ok {
 		// Add import if not already added
 		b.wellKnownImports[wkt.ImportPath] = true
 		return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, wkt.TypeName, nil
 	}
+	if wkt, ok := DynamicJSONType(ft); ok {
+		b.wellKnownImports[wkt.ImportPath] = true
+		return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, wkt.TypeName, nil
+	}
 
 	// Check for time.Duration (which is int64, not struct)
 	const timePackage = "time"
@@ -686,11 +1100,11 @@ func (b *Builder) getFieldType(ft reflect.Type, fieldName string) (descriptorpb.
 	}
 
 	// Delegate to helper function to reduce cyclomatic complexity
-	return b.getBasicFieldType(ft, fieldName)
+	return b.getBasicFieldType(ft, nestedName)
 }
 
 // getBasicFieldType handles basic Go types
-func (b *Builder) getBasicFieldType(ft reflect.Type, fieldName string) (descriptorpb.FieldDescriptorProto_Type, string, error) {
+func (b *Builder) getBasicFieldType(ft reflect.Type, nestedName string) (descriptorpb.FieldDescriptorProto_Type, string, error) {
 	switch ft.Kind() { //nolint:exhaustive // Unsupported types handled in default case
 	case reflect.String:
 		return descriptorpb.FieldDescriptorProto_TYPE_STRING, "", nil
@@ -712,11 +1126,18 @@ func (b *Builder) getBasicFieldType(ft reflect.Type, fieldName string) (descript
 		if ft.Elem().Kind() == reflect.Uint8 {
 			return descriptorpb.FieldDescriptorProto_TYPE_BYTES, "", nil
 		}
-		return 0, "", fmt.Errorf("unsupported slice type: %v", ft)
+		return 0, "", fmt.Errorf("unsupported slice type: %v (repeated and map fields can't hold slices, use a struct with a repeated field instead)", ft)
+	case reflect.Array, reflect.Map:
+		return 0, "", fmt.Errorf("unsupported field type: %v (repeated and map fields can't hold arrays or maps, use a struct with a repeated or map field instead)", ft)
+	case reflect.Interface:
+		if _, ok := LookupUnion(ft); ok {
+			return 0, "", fmt.Errorf("unsupported field type: %v (unions are oneofs, which can't be repeated or map values, use a struct holding the union instead)", ft)
+		}
+		return 0, "", fmt.Errorf("unsupported interface type: %v (register its concrete types with schema.RegisterUnion)", ft)
 	case reflect.Struct:
-		typeName := ft.Name()
+		typeName := MessageName(ft)
 		if typeName == "" {
-			typeName = fmt.Sprintf("%s_Message", title(fieldName))
+			typeName = nestedName
 		}
 
 		// Add to pending types to process
@@ -740,12 +1161,14 @@ func (b *Builder) buildMapField(
 	parentMessageName string,
 ) (*descriptorpb.FieldDescriptorProto, []*descriptorpb.DescriptorProto, error) {
 	mapType := field.Type
+	if mapType.Kind() == reflect.Ptr {
+		mapType = mapType.Elem()
+	}
 	keyType := mapType.Key()
 	valueType := mapType.Elem()
 
 	// Create map entry message name
-	fieldNameTitle := title(field.Name)
-	entryName := fmt.Sprintf("%sEntry", fieldNameTitle)
+	entryName := mapEntryName(fieldProto.GetName())
 
 	// Build the map entry message descriptor
 	entryMsg := &descriptorpb.DescriptorProto{
@@ -768,7 +1191,7 @@ func (b *Builder) buildMapField(
 	entryMsg.Field = append(entryMsg.Field, keyField)
 
 	// Add value field
-	valueFieldType, valueTypeName, err := b.getFieldType(valueType, "value")
+	valueFieldType, valueTypeName, err := b.getFieldType(valueType, nestedMessageName(parentMessageName, field.Name+"Value"))
 	if err != nil {
 		return nil, nil, fmt.Errorf("invalid map value type %v: %w", valueType, err)
 	}
@@ -781,6 +1204,7 @@ func (b *Builder) buildMapField(
 	if valueTypeName != "" {
 		valueField.TypeName = proto(valueTypeName)
 	}
+	b.applyInt64JSType(valueField)
 	entryMsg.Field = append(entryMsg.Field, valueField)
 
 	// Reference the map entry type - it will be nested in the parent message
@@ -797,8 +1221,6 @@ func proto[T any](v T) *T {
 	return &v
 }
 
-// Note: featuresEqual function moved to features_compare.go to reduce complexity
-
 func labelPtr(l descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto_Label {
 	return &l
 }
@@ -892,7 +1314,8 @@ func (b *Builder) processEmbeddedOneof(
 		}
 
 		// Build field descriptor for this oneof field
-		fieldProto, _, err := b.buildFieldDescriptor(&subField, *fieldNumber, nil, "")
+		number := b.nextFieldNumber(fieldNumber)
+		fieldProto, _, err := b.buildFieldDescriptor(&subField, "", number, nil, msgProto.GetName())
 		if err != nil {
 			if errors.Is(err, ErrSkipField) {
 				continue
@@ -913,7 +1336,9 @@ func (b *Builder) processEmbeddedOneof(
 			fieldProto.Name = proto(toSnakeCase(subField.Name))
 
 			msgProto.Field = append(msgProto.Field, fieldProto)
-			*fieldNumber++
+			if fieldProto.GetNumber() == number {
+				*fieldNumber++
+			}
 		}
 	}
 
@@ -959,9 +1384,19 @@ func (b *Builder) extractMessageComment(rt reflect.Type) *CommentInfo {
 }
 
 // extractFieldComment extracts field-level documentation from a struct field.
+// Validation rules and the default value are recorded as a trailing comment
+// so that documentation generators can turn them into constraints.
 func (b *Builder) extractFieldComment(field *reflect.StructField) *CommentInfo {
-	if doc := ExtractCommentFromTag(string(field.Tag)); doc != "" {
-		return &CommentInfo{Leading: doc}
+	trailing := BuildValidationComment(ParseValidationTag(field.Tag.Get("validate")))
+	if def := buildDefaultComment(field); def != "" {
+		trailing = strings.TrimPrefix(trailing+"\n"+def, "\n")
 	}
-	return nil
+	comment := &CommentInfo{
+		Leading:  ExtractCommentFromTag(string(field.Tag)),
+		Trailing: trailing,
+	}
+	if comment.Leading == "" && comment.Trailing == "" {
+		return nil
+	}
+	return comment
 }
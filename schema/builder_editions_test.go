@@ -119,11 +119,7 @@ func TestBuilderWithEditions(t *testing.T) {
 
 		_, err := builder.BuildMessage(reflect.TypeOf(TestMessage{}))
 		if err != nil {
-			// EDITION_2024 might not be supported yet by the Go protobuf runtime
-			if testing.Verbose() {
-				t.Logf("BuildMessage with EDITION_2024 failed (this might be expected): %v", err)
-			}
-			t.Skip("EDITION_2024 not yet supported by Go protobuf runtime")
+			t.Fatalf("BuildMessage failed: %v", err)
 		}
 
 		// Get the file descriptor
@@ -0,0 +1,109 @@
+package schema_test
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+type EmbeddedAudit struct {
+	CreatedBy string `json:"created_by"`
+	Version   int32  `json:"version"`
+}
+
+type EmbeddedOwner struct {
+	Name string `json:"name"`
+}
+
+type embeddedTenant struct {
+	TenantID string `json:"tenant_id"`
+}
+
+type EmbeddedNode struct {
+	*EmbeddedNode
+	Label string `json:"label"`
+}
+
+func TestBuilder_EmbeddedStructs(t *testing.T) {
+	fieldNames := func(t *testing.T, rt reflect.Type) []string {
+		t.Helper()
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+		md, err := builder.BuildMessage(rt)
+		if err != nil {
+			t.Fatalf("BuildMessage() failed: %v", err)
+		}
+		var names []string
+		for i := 0; i < md.Fields().Len(); i++ {
+			fd := md.Fields().Get(i)
+			if int(fd.Number()) != i+1 {
+				t.Errorf("Expected %s to be field %d, got %d", fd.Name(), i+1, fd.Number())
+			}
+			names = append(names, string(fd.Name()))
+		}
+		return names
+	}
+
+	t.Run("embedded structs are flattened", func(t *testing.T) {
+		type Document struct {
+			ID string `json:"id"`
+			EmbeddedAudit
+			*EmbeddedOwner `proto:"prefix=owner_"`
+			embeddedTenant
+			Title string `json:"title"`
+		}
+		got := fieldNames(t, reflect.TypeOf(Document{}))
+		want := []string{"id", "created_by", "version", "owner_name", "tenant_id", "title"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected fields %v, got %v", want, got)
+		}
+	})
+
+	t.Run("nested embedded structs stay messages", func(t *testing.T) {
+		type Document struct {
+			EmbeddedAudit `proto:"nested"`
+			EmbeddedOwner `json:"owner"`
+		}
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+		md, err := builder.BuildMessage(reflect.TypeOf(Document{}))
+		if err != nil {
+			t.Fatalf("BuildMessage() failed: %v", err)
+		}
+		for _, name := range []protoreflect.Name{"embedded_audit", "owner"} {
+			if fd := md.Fields().ByName(name); fd == nil || fd.Kind() != protoreflect.MessageKind {
+				t.Errorf("Expected %s to be a message field, got %v", name, fd)
+			}
+		}
+	})
+
+	t.Run("shallower fields hide promoted ones", func(t *testing.T) {
+		type First struct {
+			Label string
+			Name  string
+			Count int32
+		}
+		type Second struct {
+			Name string
+		}
+		type Document struct {
+			First
+			Second
+			Count int64
+		}
+		// Name is ambiguous between First and Second, like in encoding/json
+		got := fieldNames(t, reflect.TypeOf(Document{}))
+		want := []string{"label", "count"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected fields %v, got %v", want, got)
+		}
+	})
+
+	t.Run("self-embedding structs end", func(t *testing.T) {
+		got := fieldNames(t, reflect.TypeOf(EmbeddedNode{}))
+		if want := []string{"label"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected fields %v, got %v", want, got)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package schema_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -187,3 +188,87 @@ func TestBuilder_PointerFields(t *testing.T) {
 // 		t.Error("Expected error for circular reference, got nil")
 // 	}
 // }
+
+func TestBuilder_AnonymousMessageNames(t *testing.T) {
+	builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+
+	type Order struct {
+		Options struct {
+			Gift bool `json:"gift"`
+		} `json:"options"`
+		Shipping struct {
+			Options struct {
+				Express bool `json:"express"`
+			} `json:"options"`
+		} `json:"shipping"`
+		Notes map[string]struct {
+			Text string `json:"text"`
+		} `json:"notes"`
+	}
+
+	md, err := builder.BuildMessage(reflect.TypeOf(Order{}))
+	if err != nil {
+		t.Fatalf("BuildMessage() failed: %v", err)
+	}
+	tests := map[string]string{
+		"options":  "test.v1.Order_Options",
+		"shipping": "test.v1.Order_Shipping",
+	}
+	for field, want := range tests {
+		if got := md.Fields().ByName(protoreflect.Name(field)).Message().FullName(); string(got) != want {
+			t.Errorf("%s: expected message %s, got %s", field, want, got)
+		}
+	}
+	shipping := md.Fields().ByName("shipping").Message()
+	if got := shipping.Fields().ByName("options").Message().FullName(); got != "test.v1.Order_Shipping_Options" {
+		t.Errorf("Expected the nested anonymous struct to be prefixed with its parents, got %s", got)
+	}
+	if got := md.Fields().ByName("notes").MapValue().Message().FullName(); got != "test.v1.Order_NotesValue" {
+		t.Errorf("Expected map values to be named after their field, got %s", got)
+	}
+
+	// Messages are sorted, so rebuilding gives the same file
+	fdset := builder.GetFileDescriptorSet()
+	var names []string
+	for _, msg := range fdset.GetFile()[0].GetMessageType() {
+		names = append(names, msg.GetName())
+	}
+	if want := []string{"Order", "Order_NotesValue", "Order_Options", "Order_Shipping", "Order_Shipping_Options"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected messages %v, got %v", want, names)
+	}
+	if types := builder.MessageTypes(reflect.TypeOf(&Order{})); len(types) != 5 || types["Order"] != reflect.TypeOf(Order{}) {
+		t.Errorf("Expected the Go types of the 5 messages, got %v", types)
+	}
+}
+
+func TestBuilder_MessageNameCollisions(t *testing.T) {
+	builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+
+	type Address struct {
+		Street string `json:"street"`
+	}
+	otherAddress := func() reflect.Type {
+		type Address struct {
+			Line1 string `json:"line1"`
+		}
+		return reflect.TypeOf(Address{})
+	}()
+	type Shipment struct {
+		From Address `json:"from"`
+		To   struct {
+			Address
+		} `json:"to"`
+	}
+	if _, err := builder.BuildMessage(reflect.TypeOf(Shipment{})); err != nil {
+		t.Fatalf("Expected the same type under one name to build, got %v", err)
+	}
+
+	conflicting := reflect.StructOf([]reflect.StructField{
+		{Name: "Home", Type: reflect.TypeOf(Address{}), Tag: `json:"home"`},
+		{Name: "Work", Type: otherAddress, Tag: `json:"work"`},
+	})
+	_, err := builder.BuildMessage(conflicting)
+	if err == nil || !strings.Contains(err.Error(), "message test.v1.Address would describe both") {
+		t.Errorf("Expected a collision on test.v1.Address, got %v", err)
+	}
+}
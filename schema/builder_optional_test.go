@@ -3,7 +3,9 @@ package schema_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/i2y/hyperway/schema"
@@ -213,3 +215,51 @@ func TestBuilder_NestedOptionalFields(t *testing.T) {
 		})
 	}
 }
+
+func TestBuilder_PointerScalarsAsWrappers(t *testing.T) {
+	builder := schema.NewBuilder(schema.BuilderOptions{
+		PackageName:              "test.v1",
+		PointerScalarsAsWrappers: true,
+	})
+
+	type WrapperFieldsMessage struct {
+		Name    *string        `json:"name"`
+		Count   *int32         `json:"count"`
+		Total   *int64         `json:"total"`
+		Size    *uint          `json:"size"`
+		Enabled *bool          `json:"enabled"`
+		Ratio   *float32       `json:"ratio"`
+		Timeout *time.Duration `json:"timeout"`
+		Plain   string         `json:"plain"`
+	}
+
+	md, err := builder.BuildMessage(reflect.TypeOf(WrapperFieldsMessage{}))
+	if err != nil {
+		t.Fatalf("BuildMessage() failed: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"name":    "google.protobuf.StringValue",
+		"count":   "google.protobuf.Int32Value",
+		"total":   "google.protobuf.Int64Value",
+		"size":    "google.protobuf.UInt64Value",
+		"enabled": "google.protobuf.BoolValue",
+		"ratio":   "google.protobuf.FloatValue",
+		"timeout": "google.protobuf.Duration",
+	} {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Message() == nil || string(fd.Message().FullName()) != want {
+			t.Errorf("Field %s: expected %s, got %v", name, want, fd)
+			continue
+		}
+		if fd.HasOptionalKeyword() && name != "timeout" {
+			t.Errorf("Field %s: expected no proto3 optional with a wrapper type", name)
+		}
+	}
+	if fd := md.Fields().ByName("plain"); fd.Kind() != protoreflect.StringKind {
+		t.Errorf("Expected plain to stay a string, got %v", fd.Kind())
+	}
+	if !builder.GetWellKnownImports()[schema.WrappersProto] {
+		t.Error("Expected wrappers.proto to be imported")
+	}
+}
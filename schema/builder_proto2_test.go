@@ -0,0 +1,104 @@
+package schema_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+func TestBuilder_Proto2(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type Proto2Message struct {
+		ID       string            `json:"id" proto:"required"`
+		Name     *string           `json:"name"`
+		Limit    int32             `json:"limit" default:"20"`
+		Ratio    float64           `json:"ratio" default:"0.5"`
+		Enabled  bool              `json:"enabled" default:"1"`
+		Tags     []string          `json:"tags" proto:"required"`
+		Labels   map[string]string `json:"labels"`
+		Address  *Address          `json:"address" proto:"required"`
+		Optional string            `json:"optional" proto:"optional"`
+	}
+
+	builder := schema.NewBuilder(schema.BuilderOptions{
+		PackageName: "test.v1",
+		SyntaxMode:  schema.SyntaxProto2,
+	})
+	md, err := builder.BuildMessage(reflect.TypeOf(Proto2Message{}))
+	if err != nil {
+		t.Fatalf("BuildMessage() failed: %v", err)
+	}
+	if md.Syntax() != protoreflect.Proto2 {
+		t.Errorf("Expected proto2 syntax, got %v", md.Syntax())
+	}
+
+	tests := []struct {
+		name         string
+		cardinality  protoreflect.Cardinality
+		defaultValue string
+	}{
+		{"id", protoreflect.Required, ""},
+		{"name", protoreflect.Optional, ""},
+		{"limit", protoreflect.Optional, "20"},
+		{"ratio", protoreflect.Optional, "0.5"},
+		{"enabled", protoreflect.Optional, "true"},
+		{"tags", protoreflect.Repeated, ""},
+		{"labels", protoreflect.Repeated, ""},
+		{"address", protoreflect.Required, ""},
+		{"optional", protoreflect.Optional, ""},
+	}
+	for _, tt := range tests {
+		fd := md.Fields().ByName(protoreflect.Name(tt.name))
+		if fd == nil {
+			t.Errorf("Field %s not found", tt.name)
+			continue
+		}
+		if fd.Cardinality() != tt.cardinality {
+			t.Errorf("Field %s: expected %v, got %v", tt.name, tt.cardinality, fd.Cardinality())
+		}
+		if !fd.HasPresence() && fd.Cardinality() != protoreflect.Repeated {
+			t.Errorf("Field %s: expected explicit presence", tt.name)
+		}
+		var defaultValue string
+		if fd.HasDefault() {
+			defaultValue = fd.Default().String()
+		}
+		if defaultValue != tt.defaultValue {
+			t.Errorf("Field %s: expected default %q, got %q", tt.name, tt.defaultValue, defaultValue)
+		}
+	}
+
+	for _, file := range builder.GetFileDescriptorSet().File {
+		for _, msg := range file.MessageType {
+			for _, field := range msg.Field {
+				if field.GetProto3Optional() {
+					t.Errorf("Field %s should not be proto3 optional in proto2", field.GetName())
+				}
+			}
+		}
+	}
+}
+
+func TestBuilder_RejectsGroups(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type GroupMessage struct {
+		Item *Item `json:"item" proto:"group"`
+	}
+
+	builder := schema.NewBuilder(schema.BuilderOptions{
+		PackageName: "test.v1",
+		SyntaxMode:  schema.SyntaxProto2,
+	})
+	_, err := builder.BuildMessage(reflect.TypeOf(GroupMessage{}))
+	if err == nil || !strings.Contains(err.Error(), "groups are not supported") {
+		t.Errorf("Expected an error rejecting the group, got %v", err)
+	}
+}
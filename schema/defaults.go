@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCommentPrefix starts the line of a trailing field comment carrying
+// the value of a `default` tag.
+const defaultCommentPrefix = "Default: "
+
+// ParseDefault parses the `default` tag of a field of type t. Strings, bools,
+// integers, floats, and time.Duration values (e.g. "1m30s") can have a
+// default; the value returned has the element type of pointers.
+func ParseDefault(t reflect.Type, tag string) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	v := reflect.New(t).Elem()
+	if IsDurationType(t) {
+		d, err := time.ParseDuration(tag)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default %q: %w", tag, err)
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(tag)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(tag)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(tag, 10, t.Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(tag, 10, t.Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(tag, t.Bits())
+		v.SetFloat(f)
+	default:
+		return reflect.Value{}, fmt.Errorf("default values are not supported for %s fields", t)
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid default %q for %s: %w", tag, t, err)
+	}
+	return v, nil
+}
+
+// formatDefault formats a default value as in the protobuf JSON mapping,
+// durations as seconds like "90s".
+func formatDefault(v reflect.Value) string {
+	if IsDurationType(v.Type()) {
+		return strconv.FormatFloat(time.Duration(v.Int()).Seconds(), 'f', -1, 64) + "s"
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// buildDefaultComment returns the comment line recording the `default` tag
+// of a field, so documentation generators can show it, or "" without one.
+func buildDefaultComment(field *reflect.StructField) string {
+	tag := field.Tag.Get("default")
+	if tag == "" {
+		return ""
+	}
+	v, err := ParseDefault(field.Type, tag)
+	if err != nil {
+		return ""
+	}
+	return defaultCommentPrefix + formatDefault(v)
+}
+
+// ParseDefaultComment returns the default value recorded in a trailing field
+// comment by the builder.
+func ParseDefaultComment(comment string) (string, bool) {
+	for line := range strings.SplitSeq(comment, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimLeft(line, " "), defaultCommentPrefix); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
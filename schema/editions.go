@@ -13,6 +13,9 @@ const (
 	SyntaxProto3 SyntaxMode = iota
 	// SyntaxEditions represents editions syntax mode.
 	SyntaxEditions
+	// SyntaxProto2 represents proto2 syntax mode, for consumers that still
+	// require it.
+	SyntaxProto2
 )
 
 // Edition constants for supported editions.
@@ -89,6 +92,16 @@ func DefaultProto3Features() *FeatureSet {
 	}
 }
 
+// DefaultProto2Features returns the default feature set for proto2.
+func DefaultProto2Features() *FeatureSet {
+	return &FeatureSet{
+		FieldPresence:         FieldPresenceExplicit,
+		RepeatedFieldEncoding: RepeatedFieldEncodingExpanded,
+		EnumType:              EnumTypeClosed,
+		UTF8Validation:        UTF8ValidationNone,
+	}
+}
+
 // DefaultEdition2023Features returns the default feature set for Edition 2023.
 func DefaultEdition2023Features() *FeatureSet {
 	return &FeatureSet{
@@ -99,6 +112,13 @@ func DefaultEdition2023Features() *FeatureSet {
 	}
 }
 
+// DefaultEdition2024Features returns the default feature set for Edition 2024,
+// which keeps those of Edition 2023. Edition 2024 also enforces the naming
+// style of the protobuf style guide, and exports only top-level symbols.
+func DefaultEdition2024Features() *FeatureSet {
+	return DefaultEdition2023Features()
+}
+
 // Clone creates a copy of the FeatureSet.
 func (fs *FeatureSet) Clone() *FeatureSet {
 	if fs == nil {
@@ -2,6 +2,9 @@
 package schema
 
 import (
+	"fmt"
+	"strings"
+
 	protoproto "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
@@ -13,6 +16,7 @@ const (
 	protoTagExplicit = "explicit"
 	protoTagUnpacked = "unpacked"
 	protoTagOptional = "optional"
+	protoTagGroup    = "group"
 )
 
 // CreateFileFeatures creates a FeatureSet for file-level features based on the edition.
@@ -20,8 +24,9 @@ func CreateFileFeatures(edition string) *descriptorpb.FeatureSet {
 	features := &descriptorpb.FeatureSet{}
 
 	switch edition {
-	case Edition2023:
-		// Edition 2023 defaults
+	case Edition2023, Edition2024:
+		// Edition 2023 defaults, which Edition 2024 keeps; its new naming
+		// style and symbol visibility features are left to their defaults
 		features.FieldPresence = descriptorpb.FeatureSet_EXPLICIT.Enum()
 		features.EnumType = descriptorpb.FeatureSet_OPEN.Enum()
 		features.RepeatedFieldEncoding = descriptorpb.FeatureSet_PACKED.Enum()
@@ -41,14 +46,20 @@ func CreateFileFeatures(edition string) *descriptorpb.FeatureSet {
 	return features
 }
 
-// CreateFieldFeatures creates features for a field based on its characteristics and parent features.
+// CreateFieldFeatures creates the features a field overrides, those of its
+// characteristics that differ from the parent features, or nil if it
+// overrides none. Fields only carry the features they override, since
+// features such as enum_type cannot be set on fields.
 func CreateFieldFeatures(parentFeatures *descriptorpb.FeatureSet, fieldCharacteristics FieldCharacteristics) *descriptorpb.FeatureSet {
 	if parentFeatures == nil {
 		return nil
 	}
 
-	// Clone parent features
-	features := protoproto.Clone(parentFeatures).(*descriptorpb.FeatureSet)
+	// Features of the features tag, overridden by the proto tag
+	features := &descriptorpb.FeatureSet{}
+	if fieldCharacteristics.Features != nil {
+		features = protoproto.Clone(fieldCharacteristics.Features).(*descriptorpb.FeatureSet)
+	}
 
 	// Override based on field characteristics
 	switch {
@@ -65,6 +76,22 @@ func CreateFieldFeatures(parentFeatures *descriptorpb.FeatureSet, fieldCharacter
 		features.RepeatedFieldEncoding = descriptorpb.FeatureSet_EXPANDED.Enum()
 	}
 
+	// Drop the features the field inherits anyway
+	if compareFieldPresence(features.FieldPresence, parentFeatures.FieldPresence) {
+		features.FieldPresence = nil
+	}
+	if compareRepeatedFieldEncoding(features.RepeatedFieldEncoding, parentFeatures.RepeatedFieldEncoding) {
+		features.RepeatedFieldEncoding = nil
+	}
+	if compareUTF8Validation(features.Utf8Validation, parentFeatures.Utf8Validation) {
+		features.Utf8Validation = nil
+	}
+	if compareEnumType(features.EnumType, parentFeatures.EnumType) {
+		features.EnumType = nil
+	}
+	if protoproto.Size(features) == 0 {
+		return nil
+	}
 	return features
 }
 
@@ -75,6 +102,8 @@ type FieldCharacteristics struct {
 	ForceExplicitPresence bool
 	ForceUnpacked         bool
 	DefaultValue          string
+	// Features are the features of the `features` tag
+	Features *descriptorpb.FeatureSet
 }
 
 // ApplyFeaturesToFileOptions applies features to FileOptions for editions mode.
@@ -139,6 +168,99 @@ func MergeFeatures(parent, child *descriptorpb.FeatureSet) *descriptorpb.Feature
 	return merged
 }
 
+// Feature names of the `features` tag
+const (
+	featureFieldPresence         = "field_presence"
+	featureRepeatedFieldEncoding = "repeated_field_encoding"
+	featureUTF8Validation        = "utf8_validation"
+	featureEnumType              = "enum_type"
+)
+
+// ParseFeaturesTag parses a `features` tag overriding the features of a field
+// in editions mode, a comma-separated list of features and their values
+// named as in .proto files, like
+// `features:"utf8_validation=NONE,repeated_field_encoding=EXPANDED"`.
+// field_presence, repeated_field_encoding, utf8_validation, and enum_type
+// can be set.
+func ParseFeaturesTag(tag string) (*descriptorpb.FeatureSet, error) {
+	features := &descriptorpb.FeatureSet{}
+	for item := range strings.SplitSeq(tag, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid feature %q, expected name=VALUE", item)
+		}
+		name, value = strings.TrimSpace(name), strings.ToUpper(strings.TrimSpace(value))
+
+		var number int32
+		var values map[string]int32
+		switch name {
+		case featureFieldPresence:
+			values = descriptorpb.FeatureSet_FieldPresence_value
+		case featureRepeatedFieldEncoding:
+			values = descriptorpb.FeatureSet_RepeatedFieldEncoding_value
+		case featureUTF8Validation:
+			values = descriptorpb.FeatureSet_Utf8Validation_value
+		case featureEnumType:
+			values = descriptorpb.FeatureSet_EnumType_value
+		default:
+			return nil, fmt.Errorf("unsupported feature %q", name)
+		}
+		number, ok = values[value]
+		if !ok || number == 0 {
+			return nil, fmt.Errorf("invalid value %q for feature %s", value, name)
+		}
+
+		switch name {
+		case featureFieldPresence:
+			features.FieldPresence = descriptorpb.FeatureSet_FieldPresence(number).Enum()
+		case featureRepeatedFieldEncoding:
+			features.RepeatedFieldEncoding = descriptorpb.FeatureSet_RepeatedFieldEncoding(number).Enum()
+		case featureUTF8Validation:
+			features.Utf8Validation = descriptorpb.FeatureSet_Utf8Validation(number).Enum()
+		case featureEnumType:
+			features.EnumType = descriptorpb.FeatureSet_EnumType(number).Enum()
+		}
+	}
+	return features, nil
+}
+
+// checkFieldFeatures reports the features a field overrides that do not
+// apply to it, which protoc rejects.
+func checkFieldFeatures(field *descriptorpb.FieldDescriptorProto, features *descriptorpb.FeatureSet) error {
+	if features == nil {
+		return nil
+	}
+	repeated := field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	switch {
+	case features.EnumType != nil:
+		return fmt.Errorf("field %s: enum_type applies to enums, not fields", field.GetName())
+	case features.Utf8Validation != nil && field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return fmt.Errorf("field %s: utf8_validation applies to string fields only", field.GetName())
+	case features.RepeatedFieldEncoding != nil && !repeated:
+		return fmt.Errorf("field %s: repeated_field_encoding applies to repeated fields only", field.GetName())
+	case features.GetRepeatedFieldEncoding() == descriptorpb.FeatureSet_PACKED && !isPackable(field.GetType()):
+		return fmt.Errorf("field %s: only repeated scalar numeric fields can be packed", field.GetName())
+	case features.FieldPresence != nil && repeated:
+		return fmt.Errorf("field %s: repeated fields cannot set field_presence", field.GetName())
+	case features.GetFieldPresence() == descriptorpb.FeatureSet_IMPLICIT &&
+		field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
+		return fmt.Errorf("field %s: message fields cannot have implicit presence", field.GetName())
+	default:
+		return nil
+	}
+}
+
+// isPackable reports whether repeated fields of a type can be packed.
+func isPackable(t descriptorpb.FieldDescriptorProto_Type) bool {
+	switch t { //nolint:exhaustive // Scalar numeric types are packable
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+		descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return false
+	default:
+		return true
+	}
+}
+
 // ExtractFieldCharacteristics extracts field characteristics from struct tags.
 func ExtractFieldCharacteristics(tags map[string]string) FieldCharacteristics {
 	chars := FieldCharacteristics{}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	protoproto "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -143,6 +144,100 @@ func TestEditionsFeatures(t *testing.T) {
 		}
 	})
 
+	t.Run("Field-level features from the features tag", func(t *testing.T) {
+		builder := NewBuilder(BuilderOptions{
+			PackageName: "test.v1",
+			SyntaxMode:  SyntaxEditions,
+			Edition:     Edition2023,
+		})
+
+		type TestMessage struct {
+			Raw     string  `json:"raw" features:"utf8_validation=none"`
+			Samples []int64 `json:"samples" features:"repeated_field_encoding=EXPANDED"`
+			Count   int32   `json:"count" features:"field_presence=EXPLICIT"`
+		}
+
+		if _, err := builder.BuildMessage(reflect.TypeOf(TestMessage{})); err != nil {
+			t.Fatalf("BuildMessage failed: %v", err)
+		}
+		msg := builder.GetFileDescriptorSet().File[0].MessageType[0]
+		want := map[string]*descriptorpb.FeatureSet{
+			"raw":     {Utf8Validation: descriptorpb.FeatureSet_NONE.Enum()},
+			"samples": {RepeatedFieldEncoding: descriptorpb.FeatureSet_EXPANDED.Enum()},
+			"count":   nil, // Explicit presence is the file default
+		}
+		for _, field := range msg.Field {
+			if got := field.GetOptions().GetFeatures(); !protoproto.Equal(got, want[field.GetName()]) {
+				t.Errorf("%s features = %v, want %v", field.GetName(), got, want[field.GetName()])
+			}
+		}
+	})
+
+	t.Run("Invalid features tags", func(t *testing.T) {
+		tests := map[string]any{
+			"unsupported feature": struct {
+				Name string `json:"name" features:"message_encoding=DELIMITED"`
+			}{},
+			"invalid value": struct {
+				Name string `json:"name" features:"utf8_validation=STRICT"`
+			}{},
+			"utf8 validation of a number": struct {
+				Count int32 `json:"count" features:"utf8_validation=NONE"`
+			}{},
+			"encoding of a singular field": struct {
+				Count int32 `json:"count" features:"repeated_field_encoding=EXPANDED"`
+			}{},
+			"enum type of a field": struct {
+				Status int32 `json:"status" features:"enum_type=CLOSED"`
+			}{},
+			"implicit presence with a default": struct {
+				Count int32 `json:"count" proto:"implicit" default:"1"`
+			}{},
+		}
+		for name, msg := range tests {
+			builder := NewBuilder(BuilderOptions{
+				PackageName: "invalid.v1",
+				SyntaxMode:  SyntaxEditions,
+				Edition:     Edition2024,
+			})
+			if _, err := builder.BuildMessage(reflect.TypeOf(msg)); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("Edition 2024 naming style", func(t *testing.T) {
+		builder := NewBuilder(BuilderOptions{
+			PackageName: "test.v1",
+			SyntaxMode:  SyntaxEditions,
+			Edition:     Edition2024,
+		})
+
+		type TestMessage struct {
+			Line1 string `json:"line_1"`
+			Name  string `json:"name"`
+			Inner struct {
+				Value string `json:"value"`
+			} `json:"inner"`
+		}
+
+		if _, err := builder.BuildMessage(reflect.TypeOf(TestMessage{})); err != nil {
+			t.Fatalf("BuildMessage failed: %v", err)
+		}
+		for _, msg := range builder.GetFileDescriptorSet().File[0].MessageType {
+			legacy := msg.GetOptions().GetFeatures().GetEnforceNamingStyle() == descriptorpb.FeatureSet_STYLE_LEGACY
+			if legacy != (msg.GetName() == "TestMessage_Inner") {
+				t.Errorf("Message %s: legacy naming style = %v", msg.GetName(), legacy)
+			}
+			for _, field := range msg.Field {
+				legacy := field.GetOptions().GetFeatures().GetEnforceNamingStyle() == descriptorpb.FeatureSet_STYLE_LEGACY
+				if legacy != (field.GetName() == "line_1") {
+					t.Errorf("Field %s: legacy naming style = %v", field.GetName(), legacy)
+				}
+			}
+		}
+	})
+
 	t.Run("Default values in Editions", func(t *testing.T) {
 		builder := NewBuilder(BuilderOptions{
 			PackageName: "test.v1",
@@ -0,0 +1,154 @@
+package schema
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Proto tags of embedded structs
+const (
+	protoTagNested = "nested"
+	protoTagPrefix = "prefix="
+)
+
+// MessageField is a field of the message of a struct type: a field of the
+// struct itself, or one promoted from an embedded struct.
+type MessageField struct {
+	reflect.StructField
+	// Prefix is prepended to the protobuf name of the field, from the
+	// `proto:"prefix=..."` tags of the structs it is promoted from.
+	Prefix string
+}
+
+// MessageFields returns the fields of the message of the struct type rt, in
+// declaration order. Embedded structs are flattened like encoding/json
+// flattens them into JSON objects: their exported fields take their place,
+// with Index the index sequence from rt, unless the embedded field has a
+// JSON name or is tagged `proto:"nested"`, which keeps it as a field of its
+// own. A shallower field hides promoted fields of the same name, and fields
+// of the same name at the same depth hide each other unless exactly one has
+// a JSON name. Embedded structs tagged `proto:"prefix=..."` have the prefix
+// prepended to the names of their fields, which tells them apart.
+func MessageFields(rt reflect.Type) []MessageField {
+	var fields []MessageField
+	collectMessageFields(rt, nil, "", map[reflect.Type]bool{rt: true}, &fields)
+	return dominantFields(fields)
+}
+
+// collectMessageFields appends the fields of rt to fields, those of
+// flattened embedded structs recursively. embedding holds the structs being
+// flattened, so structs embedding themselves through pointers end.
+func collectMessageFields(rt reflect.Type, index []int, prefix string, embedding map[reflect.Type]bool, fields *[]MessageField) {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		field.Index = append(slices.Clip(index), i)
+		if embedded, ok := FlattenedStruct(&field); ok {
+			if !embedding[embedded] {
+				embedding[embedded] = true
+				collectMessageFields(embedded, field.Index, prefix+embeddedPrefix(&field), embedding, fields)
+				delete(embedding, embedded)
+			}
+			continue
+		}
+		if !field.IsExported() || jsonFieldName(&field) == "-" {
+			continue
+		}
+		*fields = append(*fields, MessageField{StructField: field, Prefix: prefix})
+	}
+}
+
+// FlattenedStruct returns the struct type of an embedded field whose fields
+// are flattened into the message of the embedding struct, see MessageFields.
+func FlattenedStruct(field *reflect.StructField) (reflect.Type, bool) {
+	if !field.Anonymous || jsonFieldName(field) != "" ||
+		field.Tag.Get("proto") == protoTagNested || field.Tag.Get("hyperway") == "oneof" {
+		return nil, false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		// encoding/json ignores unexported embedded pointers, it can't set them
+		if !field.IsExported() {
+			return nil, false
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	if _, ok := IsWellKnownType(t); ok {
+		return nil, false
+	}
+	return t, true
+}
+
+// embeddedPrefix returns the prefix of the fields of an embedded struct
+// tagged `proto:"prefix=..."`.
+func embeddedPrefix(field *reflect.StructField) string {
+	if prefix, ok := strings.CutPrefix(field.Tag.Get("proto"), protoTagPrefix); ok {
+		return prefix
+	}
+	return ""
+}
+
+// jsonFieldName returns the name in the json tag of a field, if any.
+func jsonFieldName(field *reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+// dominantFields drops the fields hidden by others of the same name, keeping
+// the order of the rest.
+func dominantFields(fields []MessageField) []MessageField {
+	byName := make(map[string][]int, len(fields))
+	for i := range fields {
+		name := fields[i].Prefix + fields[i].Name
+		if jsonName := jsonFieldName(&fields[i].StructField); jsonName != "" {
+			name = fields[i].Prefix + jsonName
+		}
+		byName[name] = append(byName[name], i)
+	}
+
+	hidden := make(map[int]bool)
+	for _, indexes := range byName {
+		if len(indexes) == 1 {
+			continue
+		}
+		depth := len(fields[indexes[0]].Index)
+		for _, i := range indexes {
+			depth = min(depth, len(fields[i].Index))
+		}
+		var shallowest, tagged []int
+		for _, i := range indexes {
+			if len(fields[i].Index) == depth {
+				shallowest = append(shallowest, i)
+				if jsonFieldName(&fields[i].StructField) != "" {
+					tagged = append(tagged, i)
+				}
+			}
+		}
+		dominant := -1
+		switch {
+		case len(shallowest) == 1:
+			dominant = shallowest[0]
+		case len(tagged) == 1:
+			dominant = tagged[0]
+		}
+		for _, i := range indexes {
+			if i != dominant {
+				hidden[i] = true
+			}
+		}
+	}
+	if len(hidden) == 0 {
+		return fields
+	}
+
+	dominant := make([]MessageField, 0, len(fields)-len(hidden))
+	for i, field := range fields {
+		if !hidden[i] {
+			dominant = append(dominant, field)
+		}
+	}
+	return dominant
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"regexp"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Names following the style Edition 2024 enforces by default
+var (
+	titleCaseName      = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	lowerSnakeCaseName = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z][a-z0-9]*)*$`)
+	upperSnakeCaseName = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z][A-Z0-9]*)*$`)
+	packageName        = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)*$`)
+)
+
+// ApplyNamingStyle keeps the names of an Edition 2024 file that do not follow
+// the style guide, such as the messages of anonymous structs named
+// Parent_Field, from failing to compile: it sets enforce_naming_style to
+// STYLE_LEGACY on each element with such a name, or on the file for its
+// package. Other files are left unchanged.
+func ApplyNamingStyle(fdp *descriptorpb.FileDescriptorProto) {
+	if fdp.GetEdition() < descriptorpb.Edition_EDITION_2024 {
+		return
+	}
+	if !packageName.MatchString(fdp.GetPackage()) {
+		if fdp.Options == nil {
+			fdp.Options = &descriptorpb.FileOptions{}
+		}
+		fdp.Options.Features = legacyNamingStyle(fdp.Options.Features)
+	}
+	applyMessagesNamingStyle(fdp.MessageType)
+	applyEnumsNamingStyle(fdp.EnumType)
+	for _, svc := range fdp.Service {
+		if !titleCaseName.MatchString(svc.GetName()) {
+			if svc.Options == nil {
+				svc.Options = &descriptorpb.ServiceOptions{}
+			}
+			svc.Options.Features = legacyNamingStyle(svc.Options.Features)
+		}
+		for _, method := range svc.Method {
+			if !titleCaseName.MatchString(method.GetName()) {
+				if method.Options == nil {
+					method.Options = &descriptorpb.MethodOptions{}
+				}
+				method.Options.Features = legacyNamingStyle(method.Options.Features)
+			}
+		}
+	}
+}
+
+// applyMessagesNamingStyle applies the naming style to messages and their
+// fields, oneofs, and nested types.
+func applyMessagesNamingStyle(msgs []*descriptorpb.DescriptorProto) {
+	for _, msg := range msgs {
+		if !titleCaseName.MatchString(msg.GetName()) {
+			if msg.Options == nil {
+				msg.Options = &descriptorpb.MessageOptions{}
+			}
+			msg.Options.Features = legacyNamingStyle(msg.Options.Features)
+		}
+		for _, field := range msg.Field {
+			if !lowerSnakeCaseName.MatchString(field.GetName()) {
+				if field.Options == nil {
+					field.Options = &descriptorpb.FieldOptions{}
+				}
+				field.Options.Features = legacyNamingStyle(field.Options.Features)
+			}
+		}
+		for _, oneof := range msg.OneofDecl {
+			if !lowerSnakeCaseName.MatchString(oneof.GetName()) {
+				if oneof.Options == nil {
+					oneof.Options = &descriptorpb.OneofOptions{}
+				}
+				oneof.Options.Features = legacyNamingStyle(oneof.Options.Features)
+			}
+		}
+		applyMessagesNamingStyle(msg.NestedType)
+		applyEnumsNamingStyle(msg.EnumType)
+	}
+}
+
+// applyEnumsNamingStyle applies the naming style to enums and their values.
+func applyEnumsNamingStyle(enums []*descriptorpb.EnumDescriptorProto) {
+	for _, enum := range enums {
+		if !titleCaseName.MatchString(enum.GetName()) {
+			if enum.Options == nil {
+				enum.Options = &descriptorpb.EnumOptions{}
+			}
+			enum.Options.Features = legacyNamingStyle(enum.Options.Features)
+		}
+		for _, value := range enum.Value {
+			if !upperSnakeCaseName.MatchString(value.GetName()) {
+				if value.Options == nil {
+					value.Options = &descriptorpb.EnumValueOptions{}
+				}
+				value.Options.Features = legacyNamingStyle(value.Options.Features)
+			}
+		}
+	}
+}
+
+// legacyNamingStyle returns features with the legacy naming style.
+func legacyNamingStyle(features *descriptorpb.FeatureSet) *descriptorpb.FeatureSet {
+	if features == nil {
+		features = &descriptorpb.FeatureSet{}
+	}
+	features.EnforceNamingStyle = descriptorpb.FeatureSet_STYLE_LEGACY.Enum()
+	return features
+}
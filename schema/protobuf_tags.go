@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtobufTag is a parsed `protobuf:"..."` struct tag, as protoc-gen-go
+// emits on the fields of generated structs, e.g.
+// `protobuf:"zigzag64,3,opt,name=offset,json=offsetMs,proto3"`.
+type ProtobufTag struct {
+	// Encoding is the wire encoding: varint, zigzag32, zigzag64, fixed32,
+	// fixed64, bytes, or group.
+	Encoding string
+	// Number is the field number.
+	Number int32
+	// Cardinality is opt, req, or rep.
+	Cardinality string
+	// Name is the field name.
+	Name string
+	// JSONName is the JSON name, if it differs from the default.
+	JSONName string
+	// Packed is set for packed repeated fields.
+	Packed bool
+	// Oneof is set for the fields of oneof wrappers.
+	Oneof bool
+}
+
+// ParseProtobufTag parses the value of a protobuf struct tag.
+func ParseProtobufTag(tag string) (ProtobufTag, error) {
+	const minParts = 3 // encoding, number, cardinality
+	parts := strings.Split(tag, ",")
+	if len(parts) < minParts {
+		return ProtobufTag{}, fmt.Errorf("invalid protobuf tag %q: want encoding,number,cardinality", tag)
+	}
+
+	pt := ProtobufTag{Encoding: parts[0], Cardinality: parts[2]}
+	switch pt.Encoding {
+	case "varint", "zigzag32", "zigzag64", "fixed32", "fixed64", "bytes", "group":
+	default:
+		return ProtobufTag{}, fmt.Errorf("invalid protobuf tag %q: unknown encoding %q", tag, pt.Encoding)
+	}
+	number, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil || number < 1 || number > maxFieldNumber {
+		return ProtobufTag{}, fmt.Errorf("invalid protobuf tag %q: invalid field number %q", tag, parts[1])
+	}
+	pt.Number = int32(number)
+	switch pt.Cardinality {
+	case "opt", "req", "rep":
+	default:
+		return ProtobufTag{}, fmt.Errorf("invalid protobuf tag %q: unknown cardinality %q", tag, pt.Cardinality)
+	}
+
+	for _, part := range parts[minParts:] {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "name":
+			pt.Name = value
+		case "json":
+			pt.JSONName = value
+		case "packed":
+			pt.Packed = true
+		case "oneof":
+			pt.Oneof = true
+		default:
+			// proto3, enum=, def=, and others are implied by the Go type
+		}
+	}
+	return pt, nil
+}
+
+// maxFieldNumber is the largest valid protobuf field number.
+const maxFieldNumber = 1<<29 - 1
+
+// LookupProtobufTag returns the parsed protobuf tag of field, if it has one.
+func LookupProtobufTag(field *reflect.StructField) (ProtobufTag, bool, error) {
+	tag, ok := field.Tag.Lookup("protobuf")
+	if !ok {
+		return ProtobufTag{}, false, nil
+	}
+	pt, err := ParseProtobufTag(tag)
+	if err != nil {
+		return ProtobufTag{}, false, fmt.Errorf("field %s: %w", field.Name, err)
+	}
+	return pt, true, nil
+}
+
+// ProtobufTagName returns the name in the protobuf tag of field, or "" if it
+// has none.
+func ProtobufTagName(field *reflect.StructField) string {
+	pt, ok, err := LookupProtobufTag(field)
+	if !ok || err != nil {
+		return ""
+	}
+	return pt.Name
+}
+
+// protobufTag returns the protobuf tag of field if the builder honors them
+// and the field has one.
+func (b *Builder) protobufTag(field *reflect.StructField) (*ProtobufTag, error) {
+	if !b.options.ProtobufTags {
+		return nil, nil
+	}
+	pt, ok, err := LookupProtobufTag(field)
+	if !ok {
+		return nil, err
+	}
+	return &pt, nil
+}
+
+// applyProtobufEncoding sets the type of an integer field to the one its
+// protobuf tag encodes it as, e.g. sint64 for zigzag64, so the field is
+// compatible with the generated message on the wire.
+func applyProtobufEncoding(fieldProto *descriptorpb.FieldDescriptorProto, pt *ProtobufTag) {
+	signed := true
+	switch fieldProto.GetType() { //nolint:exhaustive // Only integers have encodings to choose
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_INT64:
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+		signed = false
+	default:
+		return
+	}
+	bits64 := fieldProto.GetType() == descriptorpb.FieldDescriptorProto_TYPE_INT64 ||
+		fieldProto.GetType() == descriptorpb.FieldDescriptorProto_TYPE_UINT64
+
+	var t descriptorpb.FieldDescriptorProto_Type
+	switch {
+	case pt.Encoding == "zigzag32" && signed && !bits64:
+		t = descriptorpb.FieldDescriptorProto_TYPE_SINT32
+	case pt.Encoding == "zigzag64" && signed && bits64:
+		t = descriptorpb.FieldDescriptorProto_TYPE_SINT64
+	case pt.Encoding == "fixed32" && !bits64:
+		t = descriptorpb.FieldDescriptorProto_TYPE_FIXED32
+		if signed {
+			t = descriptorpb.FieldDescriptorProto_TYPE_SFIXED32
+		}
+	case pt.Encoding == "fixed64" && bits64:
+		t = descriptorpb.FieldDescriptorProto_TYPE_FIXED64
+		if signed {
+			t = descriptorpb.FieldDescriptorProto_TYPE_SFIXED64
+		}
+	default:
+		return
+	}
+	fieldProto.Type = typePtr(t)
+}
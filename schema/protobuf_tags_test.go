@@ -0,0 +1,88 @@
+package schema_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+func TestParseProtobufTag(t *testing.T) {
+	pt, err := schema.ParseProtobufTag("zigzag64,3,opt,name=offset_ms,json=offsetMs,proto3")
+	if err != nil {
+		t.Fatalf("ParseProtobufTag() failed: %v", err)
+	}
+	want := schema.ProtobufTag{Encoding: "zigzag64", Number: 3, Cardinality: "opt", Name: "offset_ms", JSONName: "offsetMs"}
+	if pt != want {
+		t.Errorf("Expected %+v, got %+v", want, pt)
+	}
+
+	for _, tag := range []string{"bytes,1", "bits,1,opt", "bytes,0,opt", "bytes,x,opt", "bytes,1,many"} {
+		if _, err := schema.ParseProtobufTag(tag); err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
+
+type TaggedEvent struct {
+	Title  string            `json:"title"`
+	ID     uint64            `protobuf:"fixed64,1,opt,name=id,proto3" json:"id,omitempty"`
+	Offset int64             `protobuf:"zigzag64,5,opt,name=offset_ms,json=offsetMs,proto3" json:"offset,omitempty"`
+	Labels map[string]string `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty"`
+	Note   string            `json:"note"`
+	Rank   int32             `json:"rank"`
+}
+
+func TestBuilder_ProtobufTags(t *testing.T) {
+	describe := func(md protoreflect.MessageDescriptor) map[string]string {
+		fields := make(map[string]string)
+		for i := range md.Fields().Len() {
+			fd := md.Fields().Get(i)
+			fields[string(fd.Name())] = fmt.Sprintf("%v %s %d", fd.Kind(), fd.JSONName(), fd.Number())
+		}
+		return fields
+	}
+
+	t.Run("honored", func(t *testing.T) {
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "tags.v1", ProtobufTags: true})
+		md, err := builder.BuildMessage(reflect.TypeOf(TaggedEvent{}))
+		if err != nil {
+			t.Fatalf("BuildMessage() failed: %v", err)
+		}
+		want := map[string]string{
+			"title":     "string title 2",
+			"id":        "fixed64 id 1",
+			"offset_ms": "sint64 offsetMs 5",
+			"labels":    "message labels 4",
+			"note":      "string note 3",
+			"rank":      "int32 rank 6",
+		}
+		if got := describe(md); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("ignored by default", func(t *testing.T) {
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "tags.v1"})
+		md, err := builder.BuildMessage(reflect.TypeOf(TaggedEvent{}))
+		if err != nil {
+			t.Fatalf("BuildMessage() failed: %v", err)
+		}
+		if fd := md.Fields().ByName("offset"); fd == nil || fd.Number() != 3 || fd.Kind() != protoreflect.Int64Kind {
+			t.Errorf("Expected offset to be the third int64 field, got %v", fd)
+		}
+	})
+
+	t.Run("invalid tags", func(t *testing.T) {
+		type Invalid struct {
+			ID string `protobuf:"bytes,one,opt,name=id"`
+		}
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "tags.v1", ProtobufTags: true})
+		if _, err := builder.BuildMessage(reflect.TypeOf(Invalid{})); err == nil {
+			t.Error("Expected an error for an invalid field number")
+		}
+	})
+}
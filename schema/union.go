@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Union is a Go interface whose values are one of a set of registered
+// concrete struct types. A field of the interface type is described by a
+// oneof named after the field, with a message field per concrete type named
+// after the type in snake_case, so the type of the value is preserved in
+// protobuf and JSON alike.
+type Union struct {
+	// Interface is the interface type.
+	Interface reflect.Type
+	// Members are the concrete types, in registration order.
+	Members []UnionMember
+}
+
+// UnionMember is a concrete type of a union.
+type UnionMember struct {
+	// Type is the type as registered, a struct or a pointer to a struct.
+	// Decoded values have this type.
+	Type reflect.Type
+	// Name is the name of the field of the type in the oneof, e.g.
+	// "rounded_rect" for RoundedRect.
+	Name string
+	// Message is the name of the message of the struct type.
+	Message string
+}
+
+// unions holds the registered unions by interface type.
+var unions sync.Map // map[reflect.Type]*Union
+
+// RegisterUnion registers the concrete types of the values of members as
+// the types that fields of the interface type I may hold:
+//
+//	schema.MustRegisterUnion[Shape](Circle{}, &Square{})
+//
+// Values of a member type decode as that type, a struct or a pointer to
+// one; encoding accepts both. Members must be distinct named structs, and
+// an interface is registered once.
+func RegisterUnion[I any](members ...I) error {
+	iface := reflect.TypeFor[I]()
+	if iface.Kind() != reflect.Interface {
+		return fmt.Errorf("union type %v is not an interface", iface)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("union %v has no members", iface)
+	}
+
+	union := &Union{Interface: iface, Members: make([]UnionMember, 0, len(members))}
+	names := make(map[string]reflect.Type, len(members))
+	for _, member := range members {
+		t := reflect.TypeOf(member)
+		if t == nil {
+			return fmt.Errorf("union %v has a nil member", iface)
+		}
+		st := t
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		if st.Kind() != reflect.Struct || st.Name() == "" {
+			return fmt.Errorf("union %v member %v is not a named struct or a pointer to one", iface, t)
+		}
+		if _, ok := IsWellKnownType(st); ok {
+			return fmt.Errorf("union %v member %v is a well-known type", iface, t)
+		}
+		name := toSnakeCase(MessageName(st))
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("union %v members %v and %v are both named %q", iface, other, t, name)
+		}
+		names[name] = t
+		union.Members = append(union.Members, UnionMember{Type: t, Name: name, Message: MessageName(st)})
+	}
+
+	if _, loaded := unions.LoadOrStore(iface, union); loaded {
+		return fmt.Errorf("union %v is already registered", iface)
+	}
+	return nil
+}
+
+// MustRegisterUnion registers a union and panics on error.
+func MustRegisterUnion[I any](members ...I) {
+	if err := RegisterUnion(members...); err != nil {
+		panic(err)
+	}
+}
+
+// LookupUnion returns the union registered for the interface type t.
+func LookupUnion(t reflect.Type) (*Union, bool) {
+	if t == nil || t.Kind() != reflect.Interface {
+		return nil, false
+	}
+	union, ok := unions.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return union.(*Union), true
+}
+
+// MemberOf returns the member of a value of type t, registered as t or, for
+// structs and pointers to them, as the other of the two.
+func (u *Union) MemberOf(t reflect.Type) (*UnionMember, bool) {
+	for i := range u.Members {
+		member := &u.Members[i]
+		if member.Type == t || member.Type == reflect.PointerTo(t) ||
+			(t.Kind() == reflect.Ptr && member.Type == t.Elem()) {
+			return member, true
+		}
+	}
+	return nil, false
+}
+
+// MemberByMessage returns the member whose struct type has the message
+// named message.
+func (u *Union) MemberByMessage(message string) (*UnionMember, bool) {
+	for i := range u.Members {
+		if u.Members[i].Message == message {
+			return &u.Members[i], true
+		}
+	}
+	return nil, false
+}
+
+// StructType returns the struct type of the member.
+func (m *UnionMember) StructType() reflect.Type {
+	if m.Type.Kind() == reflect.Ptr {
+		return m.Type.Elem()
+	}
+	return m.Type
+}
@@ -0,0 +1,110 @@
+package schema_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/i2y/hyperway/schema"
+)
+
+type Payment interface {
+	isPayment()
+}
+
+type CardPayment struct {
+	Number string `json:"number"`
+}
+
+func (CardPayment) isPayment() {}
+
+type BankTransfer struct {
+	IBAN string `json:"iban"`
+}
+
+func (*BankTransfer) isPayment() {}
+
+func TestRegisterUnion(t *testing.T) {
+	if err := schema.RegisterUnion[Payment](CardPayment{}, &BankTransfer{}); err != nil {
+		t.Fatalf("RegisterUnion() failed: %v", err)
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		union, ok := schema.LookupUnion(reflect.TypeFor[Payment]())
+		if !ok {
+			t.Fatal("Expected the union to be registered")
+		}
+		for _, tc := range []struct {
+			value any
+			name  string
+		}{
+			{CardPayment{}, "card_payment"},
+			{&CardPayment{}, "card_payment"},
+			{&BankTransfer{}, "bank_transfer"},
+		} {
+			member, ok := union.MemberOf(reflect.TypeOf(tc.value))
+			if !ok || member.Name != tc.name {
+				t.Errorf("%T: expected member %s, got %+v", tc.value, tc.name, member)
+			}
+		}
+		if member, ok := union.MemberByMessage("BankTransfer"); !ok || member.Type != reflect.TypeFor[*BankTransfer]() {
+			t.Errorf("Expected the *BankTransfer member, got %+v", member)
+		}
+	})
+
+	t.Run("invalid registrations", func(t *testing.T) {
+		type Other interface{ isOther() }
+		for name, err := range map[string]error{
+			"already registered": schema.RegisterUnion[Payment](CardPayment{}),
+			"not an interface":   schema.RegisterUnion[CardPayment](CardPayment{}),
+			"no members":         schema.RegisterUnion[Other](),
+			"not a named struct": schema.RegisterUnion[any](1),
+			"both named":         schema.RegisterUnion[any](CardPayment{}, &CardPayment{}),
+		} {
+			if err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("descriptors", func(t *testing.T) {
+		type Order struct {
+			ID      string  `json:"id"`
+			Payment Payment `json:"payment"`
+			Note    string  `json:"note"`
+		}
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+		md, err := builder.BuildMessage(reflect.TypeOf(Order{}))
+		if err != nil {
+			t.Fatalf("BuildMessage() failed: %v", err)
+		}
+		oneof := md.Oneofs().ByName("payment")
+		if oneof == nil {
+			t.Fatal("Expected a payment oneof")
+		}
+		var names []string
+		for i := range md.Fields().Len() {
+			fd := md.Fields().Get(i)
+			names = append(names, string(fd.Name()))
+			if inOneof := fd.ContainingOneof() == oneof; inOneof != strings.Contains(string(fd.Name()), "_") {
+				t.Errorf("%s: unexpected oneof %v", fd.Name(), fd.ContainingOneof())
+			}
+		}
+		if got := strings.Join(names, ","); got != "id,card_payment,bank_transfer,note" {
+			t.Errorf("Expected id,card_payment,bank_transfer,note, got %s", got)
+		}
+		if got := md.Fields().ByName("bank_transfer").Message().Name(); got != "BankTransfer" {
+			t.Errorf("Expected a BankTransfer message, got %s", got)
+		}
+	})
+
+	t.Run("repeated unions are rejected", func(t *testing.T) {
+		type Batch struct {
+			Payments []Payment `json:"payments"`
+		}
+		builder := schema.NewBuilder(schema.BuilderOptions{PackageName: "test.v1"})
+		if _, err := builder.BuildMessage(reflect.TypeOf(Batch{})); err == nil || !strings.Contains(err.Error(), "oneofs") {
+			t.Errorf("Expected an error about oneofs, got %v", err)
+		}
+	})
+}
@@ -16,6 +16,15 @@ const (
 	WellKnownStruct    = ".google.protobuf.Struct"
 	WellKnownListValue = ".google.protobuf.ListValue"
 	WellKnownFieldMask = ".google.protobuf.FieldMask"
+
+	WellKnownDoubleValue = ".google.protobuf.DoubleValue"
+	WellKnownFloatValue  = ".google.protobuf.FloatValue"
+	WellKnownInt64Value  = ".google.protobuf.Int64Value"
+	WellKnownUInt64Value = ".google.protobuf.UInt64Value"
+	WellKnownInt32Value  = ".google.protobuf.Int32Value"
+	WellKnownUInt32Value = ".google.protobuf.UInt32Value"
+	WellKnownBoolValue   = ".google.protobuf.BoolValue"
+	WellKnownStringValue = ".google.protobuf.StringValue"
 )
 
 // Well-known type import paths
@@ -85,6 +94,56 @@ func IsWellKnownType(t reflect.Type) (WellKnownType, bool) {
 	return WellKnownType{}, false
 }
 
+// DynamicJSONType reports whether t holds dynamic JSON, as decoded by
+// encoding/json, and returns its well-known type: google.protobuf.Struct for
+// map[string]any, and google.protobuf.ListValue for []any. Fields of these
+// types are singular messages, not maps or repeated fields.
+func DynamicJSONType(t reflect.Type) (WellKnownType, bool) {
+	switch {
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && isEmptyInterface(t.Elem()):
+		return wellKnownTypes["google.golang.org/protobuf/types/known/structpb.Struct"], true
+	case t.Kind() == reflect.Slice && isEmptyInterface(t.Elem()):
+		return wellKnownTypes["google.golang.org/protobuf/types/known/structpb.ListValue"], true
+	default:
+		return WellKnownType{}, false
+	}
+}
+
+// isEmptyInterface reports whether t is an interface without methods, such
+// as any.
+func isEmptyInterface(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() == 0
+}
+
+// WrapperTypeName returns the wrapper type of a scalar Go type, e.g.
+// google.protobuf.Int32Value for int32, used for pointer scalars with
+// PointerScalarsAsWrappers.
+func WrapperTypeName(t reflect.Type) (string, bool) {
+	switch t.Kind() { //nolint:exhaustive // Other types have no wrapper
+	case reflect.Float64:
+		return WellKnownDoubleValue, true
+	case reflect.Float32:
+		return WellKnownFloatValue, true
+	case reflect.Int, reflect.Int64:
+		if IsDurationType(t) {
+			return "", false
+		}
+		return WellKnownInt64Value, true
+	case reflect.Uint, reflect.Uint64:
+		return WellKnownUInt64Value, true
+	case reflect.Int32:
+		return WellKnownInt32Value, true
+	case reflect.Uint32:
+		return WellKnownUInt32Value, true
+	case reflect.Bool:
+		return WellKnownBoolValue, true
+	case reflect.String:
+		return WellKnownStringValue, true
+	default:
+		return "", false
+	}
+}
+
 // IsEmptyType checks if a type should be treated as google.protobuf.Empty
 func IsEmptyType(t reflect.Type, tag reflect.StructTag) bool {
 	// Check for explicit proto:"empty" tag
@@ -121,3 +180,20 @@ func IsTimeType(t reflect.Type) bool {
 func IsDurationType(t reflect.Type) bool {
 	return t.PkgPath() == timePackagePath && t.Name() == "Duration"
 }
+
+// lazyField is implemented by field types that defer decoding of a message
+// until it is accessed (rpc.Lazy).
+type lazyField interface {
+	LazyElemType() reflect.Type
+}
+
+var lazyFieldType = reflect.TypeOf((*lazyField)(nil)).Elem()
+
+// LazyElemType reports whether t is a lazily decoded field type and returns
+// the element type that determines its schema.
+func LazyElemType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || !t.Implements(lazyFieldType) {
+		return nil, false
+	}
+	return reflect.Zero(t).Interface().(lazyField).LazyElemType(), true
+}
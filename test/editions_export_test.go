@@ -1,6 +1,10 @@
 package test
 
 import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -68,9 +72,69 @@ func TestEditionsProtoExport(t *testing.T) {
 }
 
 func TestEditions2024ProtoExport(t *testing.T) {
-	// Skip test as Edition 2024 is not yet supported by the Go Protobuf runtime
-	t.Skip("Edition 2024 is not yet supported by the Go Protobuf runtime")
+	type Line struct {
+		SKU      string  `json:"sku" features:"utf8_validation=NONE"`
+		Quantity []int32 `json:"quantity" features:"repeated_field_encoding=EXPANDED"`
+	}
+	type Order struct {
+		ID      string   `json:"id" proto:"required"`
+		Lines   []Line   `json:"lines"`
+		Note    string   `json:"note" proto:"implicit"`
+		Address struct { // Named Order_Address
+			City string `json:"city"`
+		} `json:"address"`
+	}
 
-	// Once supported, this test would verify Edition 2024 export functionality
-	// The implementation is ready in Hyperway, waiting for Go Protobuf runtime support
+	svc := rpc.NewService("OrderService",
+		rpc.WithPackage("editions.test"),
+		rpc.WithEdition("2024"),
+	)
+	if err := rpc.Register(svc, "PlaceOrder", func(ctx context.Context, req *Order) (*Order, error) {
+		return req, nil
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	allProtos, err := svc.ExportAllProtos()
+	if err != nil {
+		t.Fatalf("ExportAllProtos failed: %v", err)
+	}
+	protoContent := allProtos["editions.test.proto"]
+	t.Logf("Exported proto:\n%s", protoContent)
+	for _, expected := range []string{
+		`edition = "2024";`,
+		"string id = 1 [features = { field_presence: LEGACY_REQUIRED }];",
+		"string note = 3 [features = { field_presence: IMPLICIT }];",
+		"string sku = 1 [features = { utf8_validation: NONE }];",
+		"repeated int32 quantity = 2 [features = { repeated_field_encoding: EXPANDED }];",
+		"option features = { enforce_naming_style: STYLE_LEGACY };",
+	} {
+		if !strings.Contains(protoContent, expected) {
+			t.Errorf("Expected proto to contain %q", expected)
+		}
+	}
+	if strings.Contains(protoContent, "enum_type") {
+		t.Error("Fields should only set the features they override")
+	}
+
+	// Check that protoc, when installed, compiles the exported files
+	protoc, err := exec.LookPath("protoc")
+	if err != nil {
+		t.Skip("protoc not found")
+	}
+	dir := t.TempDir()
+	var files []string
+	for name, content := range allProtos {
+		if strings.HasPrefix(name, "google/") {
+			continue // Bundled with protoc
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	args := append([]string{"--proto_path=" + dir, "--descriptor_set_out=" + filepath.Join(dir, "out.pb")}, files...)
+	if out, err := exec.CommandContext(t.Context(), protoc, args...).CombinedOutput(); err != nil {
+		t.Errorf("protoc failed: %v\n%s", err, out)
+	}
 }